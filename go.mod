@@ -4,12 +4,14 @@ go 1.22
 
 require (
 	filippo.io/age v1.1.1
+	github.com/klauspost/compress v1.17.4
 	github.com/spf13/cobra v1.8.0
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/crypto v0.17.0
 	golang.org/x/sys v0.15.0
 )
 
 require (
+	filippo.io/edwards25519 v1.0.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/crypto v0.17.0 // indirect
 )
@@ -0,0 +1,188 @@
+// Package cli provides command-line interface implementation for cryptkeeper.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"cryptkeeper/internal/core"
+	"cryptkeeper/internal/ecs"
+	"cryptkeeper/internal/modules/win_activity"
+	"cryptkeeper/internal/modules/win_amcache"
+	"cryptkeeper/internal/modules/win_applications"
+	"cryptkeeper/internal/modules/win_crashdumps"
+	"cryptkeeper/internal/modules/win_grouppolicy"
+	"cryptkeeper/internal/modules/win_lnk"
+	"cryptkeeper/internal/modules/win_prefetch"
+	"cryptkeeper/internal/modules/win_srum"
+	"cryptkeeper/internal/winutil"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+)
+
+var (
+	analyzeOut      string
+	analyzeIdentity string
+	analyzeHMACKey  string
+	analyzeECS      bool
+)
+
+// analysisPasses are the parsers that can run over raw artifacts collected
+// earlier. SRUM network usage is absent: its export records host-local
+// times, which the collection holds no full time zone rules to convert.
+var analysisPasses = []core.AnalysisPass{
+	{Module: "windows/amcache", Name: "driver_inventory", Run: win_amcache.AnalyzeDriverInventory},
+	{Module: "windows/amcache", Name: "application_shortcuts", Inputs: []string{"windows/lnk"}, Run: win_amcache.AnalyzeApplicationShortcuts},
+	{Module: "windows/grouppolicy", Name: "gpo_settings", Run: win_grouppolicy.AnalyzeGPOSettings},
+	{Module: "windows/activity", Name: "bam", Inputs: []string{"windows/registry"}, Run: win_activity.AnalyzeBAM},
+	{Module: "windows/applications", Name: "outlook_mailboxes", Run: win_applications.AnalyzeMailboxes},
+	{Module: "windows/srum", Name: "app_timeline", Run: win_srum.AnalyzeAppTimeline},
+	{Module: "windows/crashdumps", Name: "crash_dumps", Inputs: []string{"windows/amcache"}, Run: win_crashdumps.AnalyzeCrashDumps},
+	{Module: "windows/prefetch", Name: "prefetch_parsed", Run: win_prefetch.AnalyzePrefetch},
+	{Module: "windows/lnk", Name: "lnk_parsed", Run: win_lnk.AnalyzeLNK},
+}
+
+// analyzeCmd represents the analyze command.
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze <artifacts-dir-or-archive>",
+	Short: "Re-run parsers over an already-collected tree",
+	Long: `The analyze command runs the parsing passes (Amcache driver inventory, Group
+Policy settings, BAM/DAM entries, Outlook mailboxes, SRUM App Timeline, crash
+dump headers, prefetch files, shortcuts) over
+raw artifacts that were collected earlier, without touching the host they came
+from. Parsed JSON
+is written into the tree, each module manifest is updated, and the root
+manifest re-indexes the rewritten files. With --export-ecs, the parsed
+execution, logon, and network artifacts are also mapped to Elastic Common
+Schema events in ecs_events.ndjson at the top of the tree. An archive is first extracted to
+--out, limited to the modules the passes read. A sealed manifest is re-sealed
+with --hmac-key, which must be the key used at collection.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runAnalyze,
+}
+
+func init() {
+	analyzeCmd.Flags().StringVar(&analyzeOut, "out", "", "directory to extract an archive into before analysis")
+	analyzeCmd.Flags().StringVar(&analyzeIdentity, "identity", "", "age identity file or OpenSSH private key for encrypted archives, or \"-\" to prompt for the passphrase of a passphrase-encrypted one")
+	analyzeCmd.Flags().StringVar(&analyzeHMACKey, "hmac-key", "", "key used to seal the manifest at collection time")
+	analyzeCmd.Flags().BoolVar(&analyzeECS, "export-ecs", false, "also write ecs_events.ndjson, the execution, logon, and network artifacts as Elastic Common Schema events")
+}
+
+// analysisOutput is the report printed by analyze.
+type analysisOutput struct {
+	*core.AnalysisReport
+	ECSExport *ecs.Summary `json:"ecs_export,omitempty"`
+}
+
+func runAnalyze(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	artifactsDir, err := analysisTree(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	manifest, err := core.ReadCollectionManifest(artifactsDir)
+	if err != nil {
+		return err
+	}
+	ctx = winutil.WithCollectSettings(ctx, &winutil.CollectSettings{NoHash: manifest.Hashing == core.HashingDisabled})
+
+	report, err := core.AnalyzeCollection(ctx, artifactsDir, analysisPasses, []byte(analyzeHMACKey))
+	if err != nil {
+		return err
+	}
+	output := analysisOutput{AnalysisReport: report}
+	if analyzeECS {
+		// A collection made with --time-format epoch records its time as a number
+		created, _ := winutil.ParseTime(manifest.CreatedUTC)
+		output.ECSExport, err = ecs.Export(ctx, artifactsDir, manifest.Host, created)
+		if err != nil {
+			return err
+		}
+		resealed, err := core.ReindexCollection(artifactsDir, []string{ecs.FileName}, []byte(analyzeHMACKey))
+		if err != nil {
+			return err
+		}
+		report.Resealed = report.Resealed || resealed
+		report.ManifestUpdated = true
+	}
+	if err := printJSON(output, "analysis report"); err != nil {
+		return err
+	}
+
+	for _, pass := range report.Passes {
+		if pass.Status == core.AnalysisFailed {
+			return fmt.Errorf("one or more analysis passes failed")
+		}
+	}
+	return nil
+}
+
+// analysisTree returns the artifacts directory to analyze. A directory is
+// analyzed in place; an archive is extracted to --out first, and only the
+// modules the passes read are written.
+func analysisTree(ctx context.Context, path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		if analyzeOut != "" {
+			return "", fmt.Errorf("--out applies only when analyzing an archive")
+		}
+		return path, nil
+	}
+
+	if analyzeOut == "" {
+		return "", fmt.Errorf("--out is required when analyzing an archive")
+	}
+	var identities []age.Identity
+	if analyzeIdentity != "" {
+		identities, err = loadIdentities(analyzeIdentity)
+		if err != nil {
+			return "", fmt.Errorf("invalid --identity: %w", err)
+		}
+	}
+	outDir, err := filepath.Abs(analyzeOut)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var modules []string
+	for _, pass := range analysisPasses {
+		for _, module := range pass.Modules() {
+			if !seen[module] {
+				seen[module] = true
+				modules = append(modules, module)
+			}
+		}
+	}
+	if analyzeECS {
+		for _, module := range ecs.Modules {
+			if !seen[module] {
+				seen[module] = true
+				modules = append(modules, module)
+			}
+		}
+	}
+	report, err := core.ExtractArchive(ctx, path, outDir, modules, identities)
+	if err != nil {
+		return "", err
+	}
+	if !report.ManifestFound {
+		return "", fmt.Errorf("archive has no collection manifest")
+	}
+	if !report.OK() {
+		return "", fmt.Errorf("extracted files failed verification: %d mismatched, %d unlisted", len(report.Mismatched), len(report.Unlisted))
+	}
+	return outDir, nil
+}
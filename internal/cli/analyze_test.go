@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/core"
+	"cryptkeeper/internal/modules/win_applications"
+	"cryptkeeper/internal/modules/win_grouppolicy"
+)
+
+// analyzeTestKey seals the sample collection.
+const analyzeTestKey = "case-4471"
+
+// policyDWORD is a REG_DWORD policy record of a Registry.pol file.
+type policyDWORD struct {
+	key, value string
+	data       uint32
+}
+
+// registryPol encodes records in the PReg format of Registry.pol files:
+// [key;value;type;size;data] in UTF-16LE after the header.
+func registryPol(records ...policyDWORD) []byte {
+	data := []byte{'P', 'R', 'e', 'g', 0x01, 0x00, 0x00, 0x00}
+	char := func(c rune) {
+		data = binary.LittleEndian.AppendUint16(data, uint16(c))
+	}
+	str := func(s string) {
+		for _, u := range utf16.Encode([]rune(s)) {
+			data = binary.LittleEndian.AppendUint16(data, u)
+		}
+		char(0)
+	}
+	for _, r := range records {
+		char('[')
+		str(r.key)
+		char(';')
+		str(r.value)
+		char(';')
+		data = binary.LittleEndian.AppendUint32(data, 4) // REG_DWORD
+		char(';')
+		data = binary.LittleEndian.AppendUint32(data, 4)
+		char(';')
+		data = binary.LittleEndian.AppendUint32(data, r.data)
+		char(']')
+	}
+	return data
+}
+
+// writeSampleFile writes a file of the sample tree and returns its path.
+func writeSampleFile(t *testing.T, root, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newSampleCollection writes a sealed collection as a Windows host would
+// leave it: raw Registry.pol and OST copies with their module manifests, but
+// none of the parsed output the analyze passes produce.
+func newSampleCollection(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	modified := time.Date(2024, 2, 27, 8, 15, 0, 0, time.UTC)
+
+	gpDir := filepath.Join(dir, "windows_grouppolicy", "windows", "grouppolicy")
+	pol := registryPol(
+		policyDWORD{`Software\Policies\Microsoft\Windows Defender`, "DisableAntiSpyware", 1},
+		policyDWORD{`Software\Policies\Microsoft\Windows\WindowsUpdate\AU`, "NoAutoUpdate", 0},
+	)
+	writeSampleFile(t, gpDir, "local/Machine/Registry.pol", pol)
+	gpManifest := win_grouppolicy.NewGroupPolicyManifest(context.Background(), "host")
+	gpManifest.IncrementTotalFiles()
+	gpManifest.AddItem(`local\Machine\Registry.pol`, int64(len(pol)), "", false, modified, "registry_pol", `C:\Windows\System32\GroupPolicy\Machine\Registry.pol`, "Group Policy registry settings (machine scope)")
+	if err := gpManifest.WriteManifest(filepath.Join(gpDir, "manifest.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A 4K-page OST, whose header is described but whose folders are not
+	ost := make([]byte, 4096)
+	copy(ost, "!BDN")
+	binary.LittleEndian.PutUint16(ost[8:], 0x4f53)
+	binary.LittleEndian.PutUint16(ost[10:], 36)
+	appsDir := filepath.Join(dir, "windows_applications", "windows", "applications")
+	writeSampleFile(t, appsDir, "users/alice/outlook/alice@example.com.ost", ost)
+	appsManifest := win_applications.NewApplicationManifest(context.Background(), "host")
+	appsManifest.AddItem(`users\alice\outlook\alice@example.com.ost`, int64(len(ost)), "", false, modified, "outlook", "Outlook data file")
+	if err := appsManifest.WriteManifest(filepath.Join(appsDir, "manifest.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	writeSampleFile(t, dir, "windows_evtx/Security.evtx", []byte(strings.Repeat("ElfFile", 512)))
+	writeSampleFile(t, dir, "tool_info.json", []byte(`{"version":"test"}`))
+
+	manifest, err := core.BuildCollectionManifest(context.Background(), dir, "host", "run", modified, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Seal([]byte(analyzeTestKey))
+	if err := core.WriteCollectionManifest(dir, manifest, core.ManifestFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// runAnalyzeCommand runs analyze with its flags cleared of any earlier run.
+func runAnalyzeCommand(t *testing.T, args ...string) error {
+	t.Helper()
+	reset := func() {
+		analyzeOut, analyzeIdentity, analyzeHMACKey, analyzeECS = "", "", "", false
+	}
+	reset()
+	t.Cleanup(reset)
+	return runCommand(t, append([]string{"analyze"}, args...)...)
+}
+
+func TestAnalyzeSampleArchive(t *testing.T) {
+	meta, err := core.BundleAndMaybeEncrypt(context.Background(), newSampleCollection(t), t.TempDir(), "host", time.Now(), core.ArchiveEncryption{}, core.ArchiveCompression{}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	if err := runAnalyzeCommand(t, meta.Path, "--out", outDir, "--hmac-key", analyzeTestKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the modules the passes read are extracted
+	if _, err := os.Stat(filepath.Join(outDir, "windows_evtx")); !os.IsNotExist(err) {
+		t.Errorf("windows_evtx extracted for analysis: %v", err)
+	}
+
+	gpDir := filepath.Join(outDir, "windows_grouppolicy", "windows", "grouppolicy")
+	var settings win_grouppolicy.GPOSettings
+	readJSON(t, filepath.Join(gpDir, "gpo_settings.json"), &settings)
+	if len(settings.PolicyFiles) != 1 || len(settings.PolicyFiles[0].Settings) != 2 || settings.PolicyFiles[0].Scope != "machine" {
+		t.Fatalf("gpo_settings.json = %+v", settings)
+	}
+	if len(settings.Findings) != 1 || settings.Findings[0].Finding != "Microsoft Defender disabled by policy" {
+		t.Errorf("findings = %+v", settings.Findings)
+	}
+
+	var mailboxes []win_applications.OutlookMailbox
+	readJSON(t, filepath.Join(outDir, "windows_applications", "windows", "applications", "users", "alice", "outlook", "outlook_mailboxes.json"), &mailboxes)
+	if len(mailboxes) != 1 || mailboxes[0].Client != "ost" || mailboxes[0].Format != "unicode_4k" || mailboxes[0].Modified != "2024-02-27T08:15:00Z" {
+		t.Fatalf("outlook_mailboxes.json = %+v", mailboxes)
+	}
+
+	// The parsed output is indexed in the re-sealed root manifest; only the
+	// files left in the archive are missing
+	verifyAnalyzed(t, outDir)
+	manifest, err := core.ReadCollectionManifest(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexed := make(map[string]bool)
+	for _, file := range manifest.Files {
+		indexed[file.Path] = true
+	}
+	for _, name := range []string{
+		"windows_grouppolicy/windows/grouppolicy/gpo_settings.json",
+		"windows_applications/windows/applications/users/alice/outlook/outlook_mailboxes.json",
+	} {
+		if !indexed[name] {
+			t.Errorf("%s is not in the root manifest", name)
+		}
+	}
+
+	// Analyzing the tree again rewrites the output in place
+	if err := runAnalyzeCommand(t, outDir, "--hmac-key", analyzeTestKey); err != nil {
+		t.Fatal(err)
+	}
+	gpManifest, err := win_grouppolicy.LoadGroupPolicyManifest(filepath.Join(gpDir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gpManifest.Items) != 2 || gpManifest.PolicyFindings != 1 {
+		t.Errorf("grouppolicy manifest after a second analysis = %+v", gpManifest.Items)
+	}
+	verifyAnalyzed(t, outDir)
+
+	// A sealed collection is not rewritten without its key
+	if err := runAnalyzeCommand(t, outDir); err == nil || !strings.Contains(err.Error(), "--hmac-key") {
+		t.Errorf("analyze without the key = %v", err)
+	}
+}
+
+// verifyAnalyzed checks an analyzed extraction of the sample collection
+// against its re-sealed manifest.
+func verifyAnalyzed(t *testing.T, dir string) {
+	t.Helper()
+	report, err := core.VerifyCollection(context.Background(), dir, []byte(analyzeTestKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notExtracted := []string{"tool_info.json", "windows_evtx/Security.evtx"}
+	if len(report.Mismatched) != 0 || len(report.Unexpected) != 0 || !reflect.DeepEqual(report.Missing, notExtracted) {
+		t.Fatalf("analyzed collection does not verify: %+v", report)
+	}
+	if report.SealValid == nil || !*report.SealValid {
+		t.Fatalf("seal of the analyzed collection = %v, %s", report.SealValid, report.SealError)
+	}
+}
+
+// readJSON decodes a JSON file written by an analysis pass.
+func readJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+}
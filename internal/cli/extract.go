@@ -0,0 +1,124 @@
+// Package cli provides command-line interface implementation for cryptkeeper.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"cryptkeeper/internal/core"
+	"cryptkeeper/internal/winutil"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+)
+
+var (
+	extractModules  []string
+	extractOut      string
+	extractIdentity string
+	extractList     bool
+)
+
+// extractCmd represents the extract command.
+var extractCmd = &cobra.Command{
+	Use:   "extract <archive>",
+	Short: "Unpack an archive or selected modules from it, verifying their hashes",
+	Long: `The extract command streams a cryptkeeper archive once, decrypting it with
+--identity when it is age-encrypted, and writes the whole artifacts tree, or
+only the files of the modules named with --module. Every extracted file is hashed as it is written and
+checked against the archive's root manifest (JSON or MessagePack). With --list it prints
+the archive's files and per-module sizes without extracting anything.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runExtract,
+}
+
+func init() {
+	extractCmd.Flags().StringArrayVar(&extractModules, "module", nil, "module to extract, e.g. windows/registry (repeatable; default: every file)")
+	extractCmd.Flags().StringVar(&extractOut, "out", "", "directory to extract into")
+	extractCmd.Flags().StringVar(&extractIdentity, "identity", "", "age identity file or OpenSSH private key for encrypted archives, or \"-\" to prompt for the passphrase of a passphrase-encrypted one")
+	extractCmd.Flags().BoolVar(&extractList, "list", false, "list archive contents and per-module sizes without extracting")
+}
+
+// loadIdentities reads the identities an --identity value names: an identity
+// file, or with "-" the passphrase of an archive written with
+// --encrypt-passphrase, prompted for on the console.
+func loadIdentities(path string) ([]age.Identity, error) {
+	if path != "-" {
+		return core.LoadAgeIdentities(path)
+	}
+	passphrase, err := winutil.PromptSecret("Archive passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return []age.Identity{identity}, nil
+}
+
+func runExtract(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	archivePath := args[0]
+
+	var identities []age.Identity
+	if extractIdentity != "" {
+		var err error
+		identities, err = loadIdentities(extractIdentity)
+		if err != nil {
+			return fmt.Errorf("invalid --identity: %w", err)
+		}
+	}
+
+	if extractList {
+		listing, err := core.ListArchive(ctx, archivePath, identities)
+		if err != nil {
+			return err
+		}
+		return printJSON(listing, "archive listing")
+	}
+
+	if extractOut == "" {
+		return fmt.Errorf("--out is required")
+	}
+	outDir, err := filepath.Abs(extractOut)
+	if err != nil {
+		return fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	report, err := core.ExtractArchive(ctx, archivePath, outDir, extractModules, identities)
+	if err != nil {
+		return err
+	}
+	if err := printJSON(report, "extract report"); err != nil {
+		return err
+	}
+
+	if report.Extracted == 0 {
+		if len(extractModules) == 0 {
+			return fmt.Errorf("no files found in the archive")
+		}
+		return fmt.Errorf("no files found for the requested modules")
+	}
+	if !report.OK() {
+		return fmt.Errorf("extracted files failed verification")
+	}
+	return nil
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v interface{}, what string) error {
+	jsonBytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", what, err)
+	}
+	fmt.Println(string(jsonBytes))
+	return nil
+}
@@ -3,24 +3,35 @@ package cli
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	"cryptkeeper/internal/core"
 	"cryptkeeper/internal/modules/sysinfo"
+	"cryptkeeper/internal/modules/win_activity"
 	"cryptkeeper/internal/modules/win_ads"
 	"cryptkeeper/internal/modules/win_amcache"
 	"cryptkeeper/internal/modules/win_applications"
+	"cryptkeeper/internal/modules/win_aumid"
 	"cryptkeeper/internal/modules/win_bits"
 	"cryptkeeper/internal/modules/win_browser"
 	"cryptkeeper/internal/modules/win_certificates"
+	"cryptkeeper/internal/modules/win_certutil"
+	"cryptkeeper/internal/modules/win_crashdumps"
+	"cryptkeeper/internal/modules/win_custompaths"
 	"cryptkeeper/internal/modules/win_evtx"
 	"cryptkeeper/internal/modules/win_fileshares"
 	"cryptkeeper/internal/modules/win_firewall_net"
+	"cryptkeeper/internal/modules/win_grouppolicy"
 	"cryptkeeper/internal/modules/win_iis"
 	"cryptkeeper/internal/modules/win_jumplists"
 	"cryptkeeper/internal/modules/win_kerberos"
@@ -33,6 +44,8 @@ import (
 	"cryptkeeper/internal/modules/win_networkinfo"
 	"cryptkeeper/internal/modules/win_persistence"
 	"cryptkeeper/internal/modules/win_prefetch"
+	"cryptkeeper/internal/modules/win_printspooler"
+	"cryptkeeper/internal/modules/win_proxy"
 	"cryptkeeper/internal/modules/win_rdp"
 	"cryptkeeper/internal/modules/win_recyclebin"
 	"cryptkeeper/internal/modules/win_registry"
@@ -43,28 +56,93 @@ import (
 	"cryptkeeper/internal/modules/win_tasks"
 	"cryptkeeper/internal/modules/win_tokens"
 	"cryptkeeper/internal/modules/win_trustedinstaller"
+	"cryptkeeper/internal/modules/win_updates"
 	"cryptkeeper/internal/modules/win_usb"
 	"cryptkeeper/internal/modules/win_usn"
 	"cryptkeeper/internal/modules/win_vss"
 	"cryptkeeper/internal/modules/win_wmi"
+	"cryptkeeper/internal/modules/win_wsl"
 	"cryptkeeper/internal/parse"
 	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
 	// Existing flags
 	since     string
-	encryptAge string
+	until     string
+	encryptAge []string
+	encryptSSH []string
+	encryptPassphrase string
+	scryptWorkFactor  int
+	signKey           string
 	
 	// New flags for the expanded functionality
-	parallel      int
-	moduleTimeout time.Duration
-	out           string
-	keepTmp       bool
+	parallel       int
+	moduleTimeout  time.Duration
+	out            string
+	keepTmp        bool
+	selfDelete     bool
+	parseArtifacts bool
+	cleanTemp      bool
+	correlate      bool
+	includePaths   []string
+	hmacKey        string
+	hmacKeyPrompt  bool
+	minFreeSpaceMB int64
+	offlineRoot    string
+	iocHashesPath  string
+	loadThrottle   bool
+	throttleCPU    float64
+	throttleQueue  float64
+	manifestFormat string
+	compression    string
+	compressionLevel int
+	splitSize      string
+	timeFormat     string
+	dumpCommands   bool
+	wslImageCapMB  int64
+	pagefileCapMB  int64
+	rawMFTCapMB    int64
+	noHash         bool
+	hashWorkers    int
+	dedup          bool
+	dataStoreCapMB int64
+	copyMailboxes  bool
+	fetchPAC       bool
+	profileName    string
+	modulesOnly    []string
+	excludeModules []string
+	printConfig    bool
+	maxFileMB      int64
+	maxModuleMB    int64
+	maxTotalSize   string
+	peTriage       bool
+	pinSHA256      []string
+	uploadS3       string
+	deleteAfterUpload bool
+	evtxEventIDs   []string
+	useSnapshot    bool
+	hostnameFlag   string
+	strict         bool
+	coverageFlag   bool
+	progressFlag   bool
+	dryRun         bool
+	withIndex      bool
 )
 
+// hmacKeyEnv names the environment variable that supplies the HMAC key when
+// neither --hmac-key nor --hmac-key-prompt is given, keeping the key out of
+// the command line that remote execution tools log.
+const hmacKeyEnv = "CRYPTKEEPER_HMAC_KEY"
+
+// peTriageModules are the modules whose collected files --pe-triage parses:
+// operator-chosen paths, system drivers, and CryptnetUrlCache downloads.
+var peTriageModules = []string{"windows/custompaths", "windows/services_drivers", "windows/certutil"}
+
 // harvestCmd represents the harvest command.
 var harvestCmd = &cobra.Command{
 	Use:   "harvest",
@@ -77,12 +155,83 @@ using age public key encryption.`,
 
 func init() {
 	// Define flags
+	harvestCmd.Flags().StringVar(&profileName, "profile", DefaultProfile, "collection profile: "+strings.Join(profileNames(), ", "))
+	harvestCmd.Flags().StringSliceVar(&modulesOnly, "modules", nil, "modules to run instead of the profile's set, e.g. windows/registry,windows/evtx")
+	harvestCmd.Flags().StringSliceVar(&excludeModules, "exclude-modules", nil, "modules to leave out of the profile's set; not combinable with --modules, and unknown names are rejected")
+	harvestCmd.Flags().BoolVar(&printConfig, "print-config", false, "print the expanded profile, module set, and flag values as JSON and exit without collecting")
 	harvestCmd.Flags().StringVar(&since, "since", "", "RFC3339 timestamp or duration like 7d, 72h, 15m, 30s, 2w")
+	harvestCmd.Flags().StringVar(&until, "until", "", "end of the analysis window: RFC3339 timestamp or duration before now like 1d, 12h")
 	harvestCmd.Flags().IntVar(&parallel, "parallel", 4, "maximum concurrent modules (1-64)")
 	harvestCmd.Flags().DurationVar(&moduleTimeout, "module-timeout", 60*time.Second, "per-module timeout")
-	harvestCmd.Flags().StringVar(&encryptAge, "encrypt-age", "", "Age public key for encryption (must start with age1)")
+	harvestCmd.Flags().StringArrayVar(&encryptAge, "encrypt-age", nil, "age public key to encrypt to (must start with age1); repeatable, e.g. once per responder plus an escrow key")
+	harvestCmd.Flags().StringArrayVar(&encryptSSH, "encrypt-ssh", nil, "SSH public key (ssh-ed25519 or ssh-rsa, as in authorized_keys) to encrypt to; repeatable and combinable with --encrypt-age")
+	harvestCmd.Flags().StringVar(&signKey, "sign-key", "", "unencrypted Ed25519 private key (OpenSSH or PKCS#8 PEM) to write a detached signature of the archive to <archive>.sig")
+	harvestCmd.Flags().StringVar(&encryptPassphrase, "encrypt-passphrase", "", "encrypt the archive with a passphrase instead of public keys; \"-\" prompts for it on the console")
+	harvestCmd.Flags().IntVar(&scryptWorkFactor, "scrypt-work-factor", core.DefaultScryptWorkFactor, "log2 scrypt work factor for --encrypt-passphrase")
+	harvestCmd.Flags().MarkHidden("scrypt-work-factor")
 	harvestCmd.Flags().StringVar(&out, "out", "", "output directory for final archive (default: temp directory)")
 	harvestCmd.Flags().BoolVar(&keepTmp, "keep-tmp", false, "keep temporary artifacts directory for debugging")
+	harvestCmd.Flags().BoolVar(&cleanTemp, "clean-temp", false, "remove abandoned cryptkeeper temp directories, untouched for 24h and whose process has exited, before collecting")
+	harvestCmd.Flags().BoolVar(&correlate, "correlate", false, "run cross-artifact correlation passes (e.g. SRUM per-application network totals)")
+	harvestCmd.Flags().BoolVar(&parseArtifacts, "parse", false, "decode supported binary artifacts into structured JSON alongside the raw copies")
+	harvestCmd.Flags().StringArrayVar(&includePaths, "include-path", nil, "additional file, directory, or glob to collect (supports *, ?, **; repeatable)")
+	harvestCmd.Flags().BoolVar(&peTriage, "pe-triage", false, "parse the headers, sections, and imports of collected executables into pe_triage.json")
+	harvestCmd.Flags().StringVar(&hmacKey, "hmac-key", "", "secret key used to seal collection_manifest.json with an HMAC for tamper evidence (or set "+hmacKeyEnv+")")
+	harvestCmd.Flags().BoolVar(&hmacKeyPrompt, "hmac-key-prompt", false, "prompt for the HMAC key on the console instead of passing it; fails when run non-interactively")
+	harvestCmd.Flags().BoolVar(&noHash, "no-hash", false, "skip SHA-256 hashing of collected files for maximum copy speed; manifests record sha256 as null")
+	harvestCmd.Flags().IntVar(&hashWorkers, "hash-workers", 0, "copy without hashing, then hash the collected files in a separate pass with this many workers (0 hashes each file while copying it)")
+	harvestCmd.Flags().BoolVar(&dedup, "dedup", false, "store files with identical content once in the archive, as links recorded in the root manifest")
+	harvestCmd.Flags().StringVar(&manifestFormat, "manifest-format", core.ManifestFormatJSON, "root manifest encoding: json, or msgpack for a compact binary manifest on very large collections")
+	harvestCmd.Flags().StringVar(&compression, "compression", core.CompressionGzip, "archive compression: gzip (.tar.gz) or zstd (.tar.zst), which is several times faster on large collections")
+	harvestCmd.Flags().IntVar(&compressionLevel, "compression-level", 0, "compression level, 1-9 for gzip or 1-22 for zstd; higher is smaller and slower, 0 is the codec's default")
+	harvestCmd.Flags().StringVar(&splitSize, "split-size", "", "write the archive as numbered volumes (.001, .002, ...) of at most this size, e.g. 1GB or 500MB; concatenated in order they are the archive")
+	harvestCmd.Flags().StringVar(&timeFormat, "time-format", winutil.TimeFormatRFC3339, "timestamp format in JSON output: rfc3339 (UTC), epoch (Unix seconds), or epoch-ms (Unix milliseconds)")
+	harvestCmd.Flags().Int64Var(&maxFileMB, "max-file-mb", winutil.DefaultMaxFileSizeMB, "largest file in MB copied whole; larger files keep only their tail (0 for no limit; alias --max-file-size)")
+	harvestCmd.Flags().Int64Var(&maxModuleMB, "max-module-mb", winutil.DefaultMaxTotalMB, "total MB each module may copy (0 for no limit; aliases --max-module-size, --max-total-mb)")
+	harvestCmd.Flags().StringVar(&maxTotalSize, "max-total-size", "", "total size all modules together may copy, e.g. 20GB; once a copy would exceed it, that file and every later one is skipped (default: unlimited)")
+	harvestCmd.Flags().StringSliceVar(&evtxEventIDs, "evtx-event-ids", nil, "query only these event IDs or ranges (e.g. 4624,4625,4688 or triage) within --since and write NDJSON instead of exporting whole logs")
+	harvestCmd.Flags().Int64Var(&wslImageCapMB, "wsl-image-cap-mb", win_wsl.DefaultImageCapMB, "largest WSL ext4.vhdx in MB to copy; larger images are only described (0 disables copying)")
+	harvestCmd.Flags().Int64Var(&pagefileCapMB, "pagefile-cap-mb", 0, "largest pagefile.sys, swapfile.sys, or hiberfil.sys in MB to copy; larger files are only described (0 disables copying)")
+	harvestCmd.Flags().Int64Var(&rawMFTCapMB, "raw-mft-cap-mb", 0, "largest raw $MFT of the system drive in MB to copy (0 disables copying)")
+	harvestCmd.Flags().Int64Var(&dataStoreCapMB, "datastore-cap-mb", win_updates.DefaultDataStoreCapMB, "largest Windows Update DataStore.edb in MB to copy; larger databases are only described (0 disables copying)")
+	harvestCmd.Flags().BoolVar(&fetchPAC, "fetch-pac", false, "download PAC scripts named by http(s) AutoConfigURL values; this contacts the configured PAC server")
+	harvestCmd.Flags().BoolVar(&copyMailboxes, "copy-mailboxes", false, "copy whole Outlook PST/OST files; by default they are only described (with --parse, down to their folder hierarchy)")
+	harvestCmd.Flags().Int64Var(&minFreeSpaceMB, "min-free-space-mb", winutil.DefaultMinFreeSpaceMB, "free space in MB to keep on the output volume; copies stop once it would be crossed (0 disables)")
+	harvestCmd.Flags().BoolVar(&loadThrottle, "adaptive-throttle", false, "delay copies while CPU or disk queue length is above the throttle thresholds")
+	harvestCmd.Flags().Float64Var(&throttleCPU, "throttle-cpu-percent", winutil.DefaultThrottleCPUPercent, "CPU utilization percent above which --adaptive-throttle backs off")
+	harvestCmd.Flags().Float64Var(&throttleQueue, "throttle-disk-queue", winutil.DefaultThrottleDiskQueue, "disk queue length above which --adaptive-throttle backs off")
+	harvestCmd.Flags().BoolVar(&dumpCommands, "dump-commands", false, "record every external command run on the host (command line, times, exit code, output size) in commands_executed.jsonl")
+	harvestCmd.Flags().BoolVar(&useSnapshot, "use-snapshot", false, "create one shadow copy of the system volume for the run and read every file-based module from it; deleted when collection ends")
+	harvestCmd.Flags().StringVar(&hostnameFlag, "hostname", "", "host name for the archive file name and manifests instead of the detected one, e.g. when collecting from a mounted image")
+	harvestCmd.Flags().BoolVar(&strict, "strict", false, "abort the run on the first module error, cancelling the remaining modules, and exit non-zero; for testing cryptkeeper itself")
+	harvestCmd.Flags().BoolVar(&coverageFlag, "coverage", false, "write coverage.json in each module directory listing the locations the module probed and whether each was found, empty, absent, or denied")
+	harvestCmd.Flags().BoolVar(&dryRun, "dry-run", false, "walk every module's sources and record what would be copied, with sizes, without copying files or creating an archive; the output reports the projected file count and bytes")
+	harvestCmd.Flags().BoolVar(&progressFlag, "progress", false, "write one JSON line to stderr as each module starts, finishes, fails, or is skipped, with its elapsed time and item count, for a wrapping UI")
+	harvestCmd.Flags().BoolVar(&withIndex, "with-index", false, "add index.html and README.txt at the archive root summarizing the host, module results, findings, and each module's outputs")
+	harvestCmd.Flags().StringVar(&offlineRoot, "root", "", "collect from a mounted image or alternate root (e.g. E:\\) instead of the live system; live-only modules are skipped")
+	harvestCmd.Flags().StringVar(&iocHashesPath, "ioc-hashes", "", "file of known-bad SHA-256 hashes (one per line, optionally hash,label) to match against collected files")
+	harvestCmd.Flags().StringArrayVar(&pinSHA256, "pin-sha256", nil, "base64 SHA-256 of a delivery endpoint's SubjectPublicKeyInfo to require in its TLS chain (repeatable for key rotation)")
+	harvestCmd.Flags().StringVar(&uploadS3, "upload-s3", "", "upload the archive, its volumes, and sidecar files to s3://bucket/prefix after packing, with credentials from the standard AWS environment variables")
+	harvestCmd.Flags().BoolVar(&deleteAfterUpload, "delete-after-upload", false, "remove the local archive and sidecar files once --upload-s3 has succeeded")
+	harvestCmd.Flags().BoolVar(&selfDelete, "self-delete", false, "remove the cryptkeeper binary and local artifacts on exit after successful remote delivery")
+	harvestCmd.Flags().SetNormalizeFunc(normalizeHarvestFlag)
+}
+
+// harvestFlagAliases maps other names the size caps are known by to their
+// flags. --max-total-mb is the per-module cap, not --max-total-size.
+var harvestFlagAliases = map[string]string{
+	"max-file-size":   "max-file-mb",
+	"max-module-size": "max-module-mb",
+	"max-total-mb":    "max-module-mb",
+}
+
+// normalizeHarvestFlag resolves a flag alias to the flag it names, so the
+// alias sets it and counts as setting it for profile defaults.
+func normalizeHarvestFlag(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if flag, ok := harvestFlagAliases[name]; ok {
+		name = flag
+	}
+	return pflag.NormalizedName(name)
 }
 
 func runHarvest(cmd *cobra.Command, args []string) error {
@@ -90,7 +239,16 @@ func runHarvest(cmd *cobra.Command, args []string) error {
 	now := time.Now()
 	
 	// Create logger for minimal stderr output
-	logger := log.New(os.Stderr, "", log.LstdFlags)
+	logger := log.New(winutil.ConsoleOutput(os.Stderr), "", log.LstdFlags)
+	
+	// Expand the profile first so its flag defaults are seen by every check below
+	if err := applyProfile(cmd, profileName); err != nil {
+		return err
+	}
+	selectedModules, err := selectModules(profileName, modulesOnly, excludeModules)
+	if err != nil {
+		return err
+	}
 	
 	// Validate and clamp parallelism
 	if parallel < 1 {
@@ -105,34 +263,279 @@ func runHarvest(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("module-timeout must be positive")
 	}
 	
-	// Validate age public key if provided
-	var agePublicKey string
-	var ageRecipientSet bool
-	if encryptAge != "" {
-		if err := core.ValidateAgePublicKey(encryptAge); err != nil {
-			return fmt.Errorf("invalid --encrypt-age: %w", err)
+	// Self-delete is only safe once the archive has left the host
+	if err := checkSelfDeleteFlags(selfDelete, keepTmp, deliveryTargetConfigured()); err != nil {
+		return err
+	}
+	
+	// Pins only constrain the HTTPS delivery clients, so they need a target
+	var pins core.SPKIPins
+	if len(pinSHA256) > 0 {
+		pins, err = core.ParseSPKIPins(pinSHA256)
+		if err != nil {
+			return fmt.Errorf("invalid --pin-sha256: %w", err)
+		}
+		if !deliveryTargetConfigured() {
+			return fmt.Errorf("--pin-sha256 requires a remote delivery target")
 		}
-		agePublicKey = encryptAge
-		ageRecipientSet = true
 	}
 	
-	// Parse and normalize since flag (for future use)
-	sinceNormalized, sinceWasSet, err := parse.NormalizeSince(since, now)
+	// Check the upload destination and credentials before collecting anything
+	var uploader *core.S3Uploader
+	if uploadS3 != "" {
+		target, err := core.ParseS3URL(uploadS3)
+		if err != nil {
+			return fmt.Errorf("invalid --upload-s3: %w", err)
+		}
+		creds, err := core.S3CredentialsFromEnv()
+		if err != nil {
+			return fmt.Errorf("--upload-s3: %w", err)
+		}
+		uploader, err = core.NewS3Uploader(target, creds, pins)
+		if err != nil {
+			return fmt.Errorf("--upload-s3: %w", err)
+		}
+	}
+	if deleteAfterUpload {
+		if uploadS3 == "" {
+			return fmt.Errorf("--delete-after-upload requires --upload-s3")
+		}
+		if keepTmp {
+			return fmt.Errorf("--delete-after-upload cannot be combined with --keep-tmp")
+		}
+	}
+	
+	// Validate the age and SSH recipients if provided
+	recipients, err := encryptionRecipients(encryptAge, encryptSSH)
 	if err != nil {
 		return err
 	}
+	ageRecipientSet := len(recipients) > 0
+	if encryptPassphrase != "" && ageRecipientSet {
+		return fmt.Errorf("--encrypt-passphrase cannot be combined with --encrypt-age or --encrypt-ssh")
+	}
+	// Load the signing key up front so a bad key fails before collection starts
+	var signingKey ed25519.PrivateKey
+	if signKey != "" {
+		signingKey, err = core.LoadSigningKey(signKey)
+		if err != nil {
+			return fmt.Errorf("invalid --sign-key: %w", err)
+		}
+	}
+	if scryptWorkFactor < core.MinScryptWorkFactor || scryptWorkFactor > core.MaxScryptWorkFactor {
+		return fmt.Errorf("invalid --scrypt-work-factor %d: must be between %d and %d", scryptWorkFactor, core.MinScryptWorkFactor, core.MaxScryptWorkFactor)
+	}
 	
-	// Get hostname for archive naming
-	hostname, err := os.Hostname()
+	eventIDs, err := win_evtx.ParseEventIDs(evtxEventIDs)
 	if err != nil {
-		hostname = "unknown"
+		return fmt.Errorf("invalid --evtx-event-ids: %w", err)
 	}
 	
-	// Create temporary artifacts directory
-	artifactsDir, err := core.CreateTempDir()
+	// Runs pushed through PsExec or an EDR agent have nobody to answer a prompt
+	session := winutil.CurrentSession()
+	if hmacKeyPrompt {
+		if hmacKey != "" {
+			return fmt.Errorf("--hmac-key-prompt cannot be combined with --hmac-key")
+		}
+		if !session.Interactive {
+			return fmt.Errorf("--hmac-key-prompt needs an interactive console, but %s; set the key in the %s environment variable instead", session.Reason, hmacKeyEnv)
+		}
+	} else if hmacKey == "" {
+		hmacKey = os.Getenv(hmacKeyEnv)
+	}
+	if encryptPassphrase == "-" && !session.Interactive {
+		return fmt.Errorf("--encrypt-passphrase - needs an interactive console, but %s", session.Reason)
+	}
+	
+	// Both the seal and IOC matching depend on file hashes
+	if noHash && (hmacKey != "" || hmacKeyPrompt) {
+		return fmt.Errorf("--hmac-key cannot be combined with --no-hash: the seal would not cover file contents")
+	}
+	if noHash && iocHashesPath != "" {
+		return fmt.Errorf("--ioc-hashes cannot be combined with --no-hash: there are no hashes to match")
+	}
+	if noHash && dedup {
+		return fmt.Errorf("--dedup cannot be combined with --no-hash: identical files are found by their hashes")
+	}
+	if hashWorkers < 0 || hashWorkers > 64 {
+		return fmt.Errorf("invalid --hash-workers %d: must be between 0 and 64", hashWorkers)
+	}
+	if noHash && hashWorkers > 0 {
+		return fmt.Errorf("--hash-workers cannot be combined with --no-hash: there is no hashing pass to parallelize")
+	}
+	
+	if err := core.ValidateManifestFormat(manifestFormat); err != nil {
+		return fmt.Errorf("invalid --manifest-format: %w", err)
+	}
+	if err := core.ValidateCompression(compression); err != nil {
+		return fmt.Errorf("invalid --compression: %w", err)
+	}
+	var splitBytes int64
+	if splitSize != "" {
+		size, err := parse.ParseByteSize(splitSize)
+		if err != nil {
+			return fmt.Errorf("invalid --split-size: %w", err)
+		}
+		if size < core.MinSplitSize {
+			return fmt.Errorf("invalid --split-size %s: volumes must be at least 1MB", splitSize)
+		}
+		splitBytes = size
+	}
+	if level, clamped := core.ClampCompressionLevel(compression, compressionLevel); clamped {
+		logger.Printf("Warning: --compression-level %d is outside the %s range; using %d", compressionLevel, compression, level)
+		compressionLevel = level
+	}
+	if err := winutil.SetTimeFormat(timeFormat); err != nil {
+		return fmt.Errorf("invalid --time-format: %w", err)
+	}
+	
+	clampedFileMB, warning, err := clampSizeCaps(maxFileMB, maxModuleMB)
+	if err != nil {
+		return err
+	}
+	if warning != "" {
+		logger.Printf("Warning: %s", warning)
+	}
+	maxFileMB = clampedFileMB
+	var totalSizeBudget int64
+	if maxTotalSize != "" {
+		size, err := parse.ParseByteSize(maxTotalSize)
+		if err != nil {
+			return fmt.Errorf("invalid --max-total-size: %w", err)
+		}
+		if size <= 0 {
+			return fmt.Errorf("--max-total-size must be positive")
+		}
+		totalSizeBudget = size
+	}
+	
+	// Load the IOC hash set up front so a bad file fails before collection starts
+	var iocHashes *core.IOCHashSet
+	if iocHashesPath != "" {
+		set, err := core.LoadIOCHashes(iocHashesPath)
+		if err != nil {
+			return fmt.Errorf("invalid --ioc-hashes: %w", err)
+		}
+		iocHashes = set
+	}
+	
+	// Parse and normalize since flag
+	sinceNormalized, sinceWasSet, err := parse.NormalizeSince(since, now)
+	if err != nil {
+		return err
+	}
+	untilNormalized, untilWasSet, err := parse.NormalizeUntil(until, now)
+	if err != nil {
+		return err
+	}
+	if sinceWasSet && untilWasSet {
+		sinceTime, _ := time.Parse(time.RFC3339, sinceNormalized)
+		untilTime, _ := time.Parse(time.RFC3339, untilNormalized)
+		if untilTime.Before(sinceTime) {
+			return fmt.Errorf("--until must not be earlier than --since")
+		}
+	}
+	
+	// Show what would run, without touching the host
+	if printConfig {
+		return printJSON(harvestConfig(cmd, profileName, selectedModules), "configuration")
+	}
+	
+	if hmacKeyPrompt {
+		key, err := winutil.PromptSecret("HMAC key: ")
+		if errors.Is(err, winutil.ErrNonInteractive) {
+			return fmt.Errorf("--hmac-key-prompt: %w; set the key in the %s environment variable instead", err, hmacKeyEnv)
+		}
+		if err != nil {
+			return fmt.Errorf("--hmac-key-prompt: %w", err)
+		}
+		if key == "" {
+			return fmt.Errorf("--hmac-key-prompt: no key entered")
+		}
+		hmacKey = key
+	}
+	if encryptPassphrase == "-" {
+		passphrase, err := promptPassphrase()
+		if err != nil {
+			return fmt.Errorf("--encrypt-passphrase: %w", err)
+		}
+		encryptPassphrase = passphrase
+	}
+	if !session.Interactive {
+		logger.Printf("Running non-interactively: %s", session.Reason)
+	}
+	
+	if hostnameFlag != "" {
+		if err := core.ValidateHostnameOverride(hostnameFlag); err != nil {
+			return fmt.Errorf("invalid --hostname: %w", err)
+		}
+	}
+	if useSnapshot && offlineRoot != "" {
+		return fmt.Errorf("--use-snapshot cannot be combined with --root: an image is already a fixed point in time")
+	}
+	
+	// Resolve the alternate root before any module looks up system paths
+	if offlineRoot != "" {
+		resolved, err := filepath.Abs(offlineRoot)
+		if err != nil {
+			return fmt.Errorf("failed to resolve --root: %w", err)
+		}
+		info, err := os.Stat(resolved)
+		if err != nil {
+			return fmt.Errorf("invalid --root: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("invalid --root: %s is not a directory", resolved)
+		}
+		if _, err := os.Stat(filepath.Join(resolved, "Windows")); err != nil {
+			logger.Printf("Warning: --root %s has no Windows directory; system artifacts will not be found", resolved)
+		}
+		offlineRoot = resolved
+		winutil.SetOfflineRoot(offlineRoot)
+	}
+	
+	// Record the host time zone once so local times can be placed on a UTC timeline
+	hostTimezone, err := winutil.CurrentTimezone()
+	if err != nil && !errors.Is(err, winutil.ErrRequiresLiveSystem) {
+		logger.Printf("Warning: failed to read host time zone: %v", err)
+	}
+	
+	// Name the archive after the target: --hostname, an image's own computer
+	// name, or the running system's; the FQDN is recorded alongside
+	hostNames := core.ResolveHostNames(ctx, hostnameFlag)
+	hostname := hostNames.Hostname
+	if hostNames.Error != "" {
+		logger.Printf("Warning: failed to read host names from the registry: %s", hostNames.Error)
+	}
+	
+	// Prune temp directories left behind by crashed runs
+	if cleanTemp {
+		removed, err := core.CleanStaleTempDirs(core.DefaultStaleTempAge)
+		for _, dir := range removed {
+			logger.Printf("Removed stale temporary directory: %s", dir)
+		}
+		if err != nil {
+			logger.Printf("Warning: stale temp cleanup incomplete: %v", err)
+		}
+	}
+	
+	// Create a uniquely named temporary artifacts directory for this run
+	runID, err := core.NewRunID()
+	if err != nil {
+		return err
+	}
+	artifactsDir, err := core.CreateTempDir(runID)
 	if err != nil {
 		return fmt.Errorf("failed to create temporary directory: %w", err)
 	}
+	// Set up cleanup of temp directory unless --keep-tmp is set
+	if !keepTmp {
+		defer func() {
+			if err := core.RemoveTempDir(artifactsDir); err != nil {
+				log.Printf("Warning: failed to clean up temporary directory %s: %v", artifactsDir, err)
+			}
+		}()
+	}
 	
 	// Determine output directory for final archive
 	var outDir string
@@ -148,189 +551,451 @@ func runHarvest(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("failed to resolve output directory: %w", err)
 		}
 		
+		if err := core.CheckOutputDir(artifactsDir, outDir); err != nil {
+			return err
+		}
 		if err := os.MkdirAll(outDir, 0755); err != nil {
 			return fmt.Errorf("failed to create output directory: %w", err)
 		}
 	}
+	// Keep module walks and copies out of the collection and its archive
+	winutil.SetRunOutput(artifactsDir, outDir)
 	
-	// Set up cleanup of temp directory unless --keep-tmp is set
-	if !keepTmp {
-		defer func() {
-			if err := core.RemoveTempDir(artifactsDir); err != nil {
-				log.Printf("Warning: failed to clean up temporary directory %s: %v", artifactsDir, err)
+	// Refuse to start on a volume that is already near full, then guard every copy
+	if minFreeSpaceMB > 0 {
+		for _, dir := range []string{artifactsDir, outDir} {
+			if err := winutil.CheckFreeSpace(dir, minFreeSpaceMB); err != nil {
+				var lowSpace *winutil.LowDiskSpaceError
+				if errors.As(err, &lowSpace) {
+					return fmt.Errorf("insufficient free space for %s: %w", dir, err)
+				}
+				logger.Printf("Warning: %v", err)
 			}
-		}()
+		}
+	}
+	winutil.SetAdaptiveThrottle(loadThrottle, throttleCPU, throttleQueue)
+	
+	// Identify the build that produced this collection inside the archive itself
+	if err := core.WriteToolInfo(artifactsDir); err != nil {
+		return err
+	}
+	
+	// Put the self-delete on the custody record before collecting, so the
+	// delivered archive documents it; without the record it is not performed
+	selfDeleteRecorded := false
+	if selfDelete {
+		if err := core.RecordSelfDeleteIntent(ctx, artifactsDir, outDir); err != nil {
+			logger.Printf("Warning: self-delete will not be performed: %v", err)
+		} else {
+			selfDeleteRecorded = true
+		}
+	}
+	
+	// Audit the exec surface from before the first module starts
+	if dumpCommands {
+		if err := winutil.StartCommandAudit(artifactsDir); err != nil {
+			return err
+		}
+	}
+	
+	// One snapshot for the whole run, so modules neither hit locked files nor
+	// each read the volume at a different moment
+	var snapshot *winutil.Snapshot
+	if useSnapshot {
+		snapshot, err = winutil.CreateSnapshot(ctx, winutil.LiveSystemDrive())
+		if err != nil {
+			return fmt.Errorf("--use-snapshot: %w", err)
+		}
+		logger.Printf("Created shadow copy %s of %s at %s", snapshot.ID, snapshot.Drive, snapshot.Device)
+		winutil.UseSnapshot(snapshot)
+		// Cancellation of the collection must not leave the snapshot behind
+		defer deleteSnapshot(snapshot, logger)
 	}
 	
 	// Create run orchestrator
 	run := core.NewRun(parallel, moduleTimeout, artifactsDir, core.SystemClock{}, logger)
+	collectSettings := winutil.NewCollectSettings(maxFileMB, maxModuleMB, totalSizeBudget)
+	if dryRun {
+		collectSettings.DryRun = winutil.NewDryRun()
+	}
+	collectSettings.MinFreeSpace = winutil.NewFreeSpaceGuard(minFreeSpaceMB)
+	// A separate hashing pass leaves the copies unhashed
+	collectSettings.NoHash = noHash || hashWorkers > 0
+	sizeBudget := collectSettings.Budget
+	run.SetCollectSettings(collectSettings)
+	run.SetOfflineRoot(offlineRoot)
+	run.SetStrict(strict)
+	run.SetCoverage(coverageFlag)
+	if progressFlag {
+		run.SetProgress(os.Stderr)
+	}
+	if hostname != hostNames.ShortName {
+		run.SetEnv(core.NamedEnv{Env: core.SystemEnv{}, Name: hostname})
+	}
+	
+	// Register the modules the profile selected, in a fixed order
+	selected := make(map[string]bool, len(selectedModules))
+	for _, name := range selectedModules {
+		selected[name] = true
+	}
+	var modulesRun []string
+	register := func(m core.Module) {
+		if selected[m.Name()] {
+			run.Register(m)
+			modulesRun = append(modulesRun, m.Name())
+		}
+	}
 	
-	// Register modules
 	sysInfoModule := sysinfo.NewSysInfo()
-	run.Register(sysInfoModule)
+	register(sysInfoModule)
 	
 	winEvtxModule := win_evtx.NewWinEvtx()
 	// Pass since time to WinEvtx module if available
 	if sinceWasSet && sinceNormalized != "" {
 		winEvtxModule.SetSinceTime(sinceNormalized)
 	}
-	run.Register(winEvtxModule)
+	winEvtxModule.SetEventIDs(eventIDs)
+	register(winEvtxModule)
 	
 	winRegistryModule := win_registry.NewWinRegistry()
-	run.Register(winRegistryModule)
+	register(winRegistryModule)
 	
 	winPrefetchModule := win_prefetch.NewWinPrefetch()
-	run.Register(winPrefetchModule)
+	if sinceWasSet && sinceNormalized != "" {
+		winPrefetchModule.SetSinceTime(sinceNormalized)
+	}
+	register(winPrefetchModule)
 	
 	winAmcacheModule := win_amcache.NewWinAmcache()
-	run.Register(winAmcacheModule)
+	winAmcacheModule.SetParse(parseArtifacts)
+	if sinceWasSet && sinceNormalized != "" {
+		winAmcacheModule.SetSinceTime(sinceNormalized)
+	}
+	register(winAmcacheModule)
 	
 	winJumpListsModule := win_jumplists.NewWinJumpLists()
-	run.Register(winJumpListsModule)
+	if sinceWasSet && sinceNormalized != "" {
+		winJumpListsModule.SetSinceTime(sinceNormalized)
+	}
+	register(winJumpListsModule)
 	
 	winLNKModule := win_lnk.NewWinLNK()
-	run.Register(winLNKModule)
+	if sinceWasSet && sinceNormalized != "" {
+		winLNKModule.SetSinceTime(sinceNormalized)
+	}
+	register(winLNKModule)
 	
 	winSRUMModule := win_srum.NewWinSRUM()
-	run.Register(winSRUMModule)
+	winSRUMModule.SetCorrelate(correlate)
+	winSRUMModule.SetParse(parseArtifacts)
+	winSRUMModule.SetWindow(sinceNormalized, untilNormalized)
+	register(winSRUMModule)
 	
 	winBITSModule := win_bits.NewWinBITS()
-	run.Register(winBITSModule)
+	register(winBITSModule)
 	
 	winTasksModule := win_tasks.NewWinTasks()
-	run.Register(winTasksModule)
+	register(winTasksModule)
 	
 	winServicesDriversModule := win_services_drivers.NewWinServicesDrivers()
-	run.Register(winServicesDriversModule)
+	register(winServicesDriversModule)
 	
 	winWMIModule := win_wmi.NewWinWMI()
-	run.Register(winWMIModule)
+	register(winWMIModule)
 	
 	winFirewallNetModule := win_firewall_net.NewWinFirewallNet()
-	run.Register(winFirewallNetModule)
+	register(winFirewallNetModule)
 	
 	winRDPModule := win_rdp.NewWinRDP()
-	run.Register(winRDPModule)
+	register(winRDPModule)
 	
 	winUSBModule := win_usb.NewWinUSB()
-	run.Register(winUSBModule)
+	register(winUSBModule)
 	
 	winBrowserModule := win_browser.NewWinBrowser()
-	run.Register(winBrowserModule)
+	if sinceWasSet && sinceNormalized != "" {
+		winBrowserModule.SetSinceTime(sinceNormalized)
+	}
+	register(winBrowserModule)
 	
 	winRecycleBinModule := win_recyclebin.NewWinRecycleBin()
-	run.Register(winRecycleBinModule)
+	if sinceWasSet && sinceNormalized != "" {
+		winRecycleBinModule.SetSinceTime(sinceNormalized)
+	}
+	register(winRecycleBinModule)
 	
 	winIISModule := win_iis.NewWinIIS()
-	run.Register(winIISModule)
+	register(winIISModule)
 
 	// Register new artifact collection modules
 	winNetworkInfoModule := win_networkinfo.NewWinNetworkInfo()
-	run.Register(winNetworkInfoModule)
+	register(winNetworkInfoModule)
 
 	winSystemConfigModule := win_systemconfig.NewWinSystemConfig()
-	run.Register(winSystemConfigModule)
+	register(winSystemConfigModule)
 
 	winMemoryProcessModule := win_memory_process.NewWinMemoryProcess()
-	run.Register(winMemoryProcessModule)
+	winMemoryProcessModule.SetPagefileCap(pagefileCapMB)
+	register(winMemoryProcessModule)
 
 	winApplicationsModule := win_applications.NewWinApplications()
-	run.Register(winApplicationsModule)
+	winApplicationsModule.SetParse(parseArtifacts)
+	winApplicationsModule.SetCopyMailboxes(copyMailboxes)
+	if sinceWasSet && sinceNormalized != "" {
+		winApplicationsModule.SetSinceTime(sinceNormalized)
+	}
+	register(winApplicationsModule)
 
 	winPersistenceModule := win_persistence.NewWinPersistence()
-	run.Register(winPersistenceModule)
+	register(winPersistenceModule)
 
 	winModernModule := win_modern.NewWinModern()
-	run.Register(winModernModule)
+	register(winModernModule)
 
 	winMFTModule := win_mft.NewWinMFT()
-	run.Register(winMFTModule)
+	winMFTModule.SetRawMFTCap(rawMFTCapMB)
+	register(winMFTModule)
 
 	winUSNModule := win_usn.NewWinUSN()
-	run.Register(winUSNModule)
+	register(winUSNModule)
 
 	winVSSModule := win_vss.NewWinVSS()
-	run.Register(winVSSModule)
+	register(winVSSModule)
 
 	winFileSharesModule := win_fileshares.NewWinFileShares()
-	run.Register(winFileSharesModule)
+	register(winFileSharesModule)
 
 	winLSAModule := win_lsa.NewWinLSA()
-	run.Register(winLSAModule)
+	register(winLSAModule)
 
 	winKerberosModule := win_kerberos.NewWinKerberos()
-	run.Register(winKerberosModule)
+	register(winKerberosModule)
 
 	winLogonModule := win_logon.NewWinLogon()
-	run.Register(winLogonModule)
+	register(winLogonModule)
 
 	winTokensModule := win_tokens.NewWinTokens()
-	run.Register(winTokensModule)
+	register(winTokensModule)
 
 	winADSModule := win_ads.NewWinADS()
-	run.Register(winADSModule)
+	register(winADSModule)
 
 	winSignaturesModule := win_signatures.NewWinSignatures()
-	run.Register(winSignaturesModule)
+	register(winSignaturesModule)
 
 	winCertificatesModule := win_certificates.NewWinCertificates()
-	run.Register(winCertificatesModule)
+	register(winCertificatesModule)
 
 	winTrustedInstallerModule := win_trustedinstaller.NewWinTrustedInstaller()
-	run.Register(winTrustedInstallerModule)
-	
-	// Collect module names for output
-	modulesRun := []string{
-		sysInfoModule.Name(), 
-		winEvtxModule.Name(), 
-		winRegistryModule.Name(),
-		winPrefetchModule.Name(),
-		winAmcacheModule.Name(),
-		winJumpListsModule.Name(),
-		winLNKModule.Name(),
-		winSRUMModule.Name(),
-		winBITSModule.Name(),
-		winTasksModule.Name(),
-		winServicesDriversModule.Name(),
-		winWMIModule.Name(),
-		winFirewallNetModule.Name(),
-		winRDPModule.Name(),
-		winUSBModule.Name(),
-		winBrowserModule.Name(),
-		winRecycleBinModule.Name(),
-		winIISModule.Name(),
-		// New artifact collection modules
-		winNetworkInfoModule.Name(),
-		winSystemConfigModule.Name(),
-		winMemoryProcessModule.Name(),
-		winApplicationsModule.Name(),
-		winPersistenceModule.Name(),
-		winModernModule.Name(),
-		winMFTModule.Name(),
-		winUSNModule.Name(),
-		winVSSModule.Name(),
-		winFileSharesModule.Name(),
-		winLSAModule.Name(),
-		winKerberosModule.Name(),
-		winLogonModule.Name(),
-		winTokensModule.Name(),
-		winADSModule.Name(),
-		winSignaturesModule.Name(),
-		winCertificatesModule.Name(),
-		winTrustedInstallerModule.Name(),
+	register(winTrustedInstallerModule)
+
+	winGroupPolicyModule := win_grouppolicy.NewWinGroupPolicy()
+	winGroupPolicyModule.SetParse(parseArtifacts)
+	register(winGroupPolicyModule)
+
+	winPrintSpoolerModule := win_printspooler.NewWinPrintSpooler()
+	if sinceWasSet && sinceNormalized != "" {
+		winPrintSpoolerModule.SetSinceTime(sinceNormalized)
+	}
+	register(winPrintSpoolerModule)
+
+	winActivityModule := win_activity.NewWinActivity()
+	register(winActivityModule)
+
+	winWSLModule := win_wsl.NewWinWSL()
+	winWSLModule.SetImageCap(wslImageCapMB)
+	if sinceWasSet && sinceNormalized != "" {
+		winWSLModule.SetSinceTime(sinceNormalized)
+	}
+	register(winWSLModule)
+
+	winAUMIDModule := win_aumid.NewWinAUMID()
+	register(winAUMIDModule)
+
+	winUpdatesModule := win_updates.NewWinUpdates()
+	winUpdatesModule.SetDataStoreCap(dataStoreCapMB)
+	register(winUpdatesModule)
+
+	winCertutilModule := win_certutil.NewWinCertutil()
+	register(winCertutilModule)
+
+	winProxyModule := win_proxy.NewWinProxy()
+	winProxyModule.SetFetchPAC(fetchPAC)
+	register(winProxyModule)
+
+	winCrashDumpsModule := win_crashdumps.NewWinCrashDumps()
+	register(winCrashDumpsModule)
+	
+	// Operator-specified paths are only collected when requested
+	if len(includePaths) > 0 {
+		winCustomPathsModule := win_custompaths.NewWinCustomPaths(includePaths)
+		if sinceWasSet && sinceNormalized != "" {
+			winCustomPathsModule.SetSinceTime(sinceNormalized)
+		}
+		run.Register(winCustomPathsModule)
+		modulesRun = append(modulesRun, winCustomPathsModule.Name())
+	}
+	
+	// A dependency cycle would stall collection, so refuse to start
+	if err := run.CheckDependencies(); err != nil {
+		return err
 	}
 	
 	// Execute all modules
 	logger.Printf("Starting collection with %d modules, %d parallel, %s timeout", 
 		len(modulesRun), parallel, moduleTimeout)
 	
-	results, collectErr := run.CollectAll(ctx)
+	// Ctrl-C or SIGTERM stops collection but still packages what was gathered;
+	// a second signal terminates immediately
+	collectCtx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	results, collectErr := run.CollectAll(collectCtx)
+	interrupted := collectCtx.Err() != nil
+	stopSignals()
+	// Bundling reads the artifacts directory, not the volume
+	if snapshot != nil {
+		deleteSnapshot(snapshot, logger)
+	}
+	if interrupted {
+		logger.Printf("Collection interrupted; packaging partial results")
+		if collectErr == nil {
+			collectErr = fmt.Errorf("collection interrupted before all modules finished")
+		}
+	}
 	if collectErr != nil {
 		logger.Printf("Collection completed with errors: %v", collectErr)
 	} else {
 		logger.Printf("Collection completed successfully")
 	}
 	
+	// Close the command audit so it is indexed like any other collected file
+	if dumpCommands {
+		if err := winutil.StopCommandAudit(); err != nil {
+			logger.Printf("Warning: command audit log incomplete: %v", err)
+		}
+	}
+	
+	// A dry run ends with the projection; nothing was copied to index or pack
+	if dryRun {
+		projectedFiles, projectedBytes := collectSettings.DryRun.Totals()
+		logger.Printf("Dry run: %d files, %d bytes would be copied", projectedFiles, projectedBytes)
+		finalArtifactsDir := artifactsDir
+		if !keepTmp {
+			finalArtifactsDir = ""
+		}
+		output := schema.NewRunOutput(finalArtifactsDir, "", false, ageRecipientSet, parallel, moduleTimeout, modulesRun, results, 0, 0, now)
+		output.SetRunID(runID)
+		output.SetProfile(profileName)
+		output.SetHostNames(hostNames)
+		output.SetInterrupted(interrupted)
+		output.SetSizeCaps(maxFileMB, maxModuleMB, totalSizeBudget)
+		output.SetSizeBudgetExhausted(sizeBudget.Exhausted())
+		output.SetOfflineRoot(offlineRoot)
+		output.SetDryRun(projectedFiles, projectedBytes)
+		if sinceWasSet {
+			output.SetSince(since, sinceNormalized)
+		}
+		if untilWasSet {
+			output.SetUntil(until, untilNormalized)
+		}
+		jsonBytes, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal output JSON: %w", err)
+		}
+		fmt.Println(string(jsonBytes))
+		return collectErr
+	}
+	
+	// One file summarizing every module manifest, packed with the collection
+	combinedManifest := core.BuildCombinedManifest(artifactsDir, hostname, runID, now, results)
+	if err := core.WriteCombinedManifest(filepath.Join(artifactsDir, core.CombinedManifestName), combinedManifest); err != nil {
+		return fmt.Errorf("failed to write combined manifest: %w", err)
+	}
+	
+	// Index every collected file before packing, sealing the index when a key is set
+	collectionManifest, err := core.BuildCollectionManifest(ctx, artifactsDir, hostname, runID, now, !noHash, hashWorkers)
+	if err != nil {
+		return fmt.Errorf("failed to build collection manifest: %w", err)
+	}
+	
+	// Check every collected file against the known-bad hash set
+	iocMatches := 0
+	if iocHashes != nil {
+		iocReport := core.MatchIOCs(collectionManifest, iocHashes, modulesRun)
+		iocMatches = len(iocReport.Matches)
+		if iocReport.SHA1Unmatched > 0 {
+			logger.Printf("Warning: %d SHA-1 IOC hashes not checked; collected files are hashed with SHA-256 only", iocReport.SHA1Unmatched)
+		}
+		if iocMatches > 0 {
+			logger.Printf("HIGH: %d collected files match --ioc-hashes; see %s", iocMatches, core.IOCMatchesName)
+		}
+		if err := core.WriteIOCReport(artifactsDir, iocReport); err != nil {
+			return fmt.Errorf("failed to write IOC report: %w", err)
+		}
+		if err := collectionManifest.AddFile(artifactsDir, core.IOCMatchesName); err != nil {
+			return fmt.Errorf("failed to index IOC report: %w", err)
+		}
+	}
+	
+	// Triage the executables collected from custom paths, drivers, and the URL cache
+	peFlagged := 0
+	if peTriage {
+		peReport, err := core.TriagePEFiles(ctx, artifactsDir, collectionManifest, peTriageModules, now)
+		if err != nil {
+			return fmt.Errorf("failed to triage executables: %w", err)
+		}
+		peFlagged = peReport.FlaggedCount
+		if peFlagged > 0 {
+			logger.Printf("%d of %d collected executables flagged as packed or with an anomalous timestamp; see %s", peFlagged, peReport.PECount, core.PETriageName)
+		}
+		if err := core.WritePETriageReport(artifactsDir, peReport); err != nil {
+			return fmt.Errorf("failed to write PE triage report: %w", err)
+		}
+		if err := collectionManifest.AddFile(artifactsDir, core.PETriageName); err != nil {
+			return fmt.Errorf("failed to index PE triage report: %w", err)
+		}
+	}
+	// Describe the collection for recipients who open the archive without cryptkeeper
+	if withIndex {
+		indexInfo := core.IndexInfo{
+			Hostname:    hostname,
+			FQDN:        hostNames.FQDN,
+			RunID:       runID,
+			Profile:     profileName,
+			OfflineRoot: offlineRoot,
+			Created:     now,
+			Interrupted: interrupted,
+			IOCMatches:  iocMatches,
+			PEFlagged:   peFlagged,
+		}
+		if hostTimezone != nil {
+			indexInfo.UTCOffset = hostTimezone.UTCOffset
+		}
+		index := core.BuildCollectionIndex(artifactsDir, collectionManifest, manifestFormat, results, run.Descriptions(), indexInfo)
+		if err := core.WriteCollectionIndex(artifactsDir, index); err != nil {
+			return fmt.Errorf("failed to write collection index: %w", err)
+		}
+		for _, name := range []string{core.IndexHTMLName, core.IndexTextName} {
+			if err := collectionManifest.AddFile(artifactsDir, name); err != nil {
+				return fmt.Errorf("failed to index %s: %w", name, err)
+			}
+		}
+	}
+	// Point duplicate files at their first copy so the archive stores it once
+	var duplicates map[string]string
+	if dedup {
+		count, saved := collectionManifest.MarkDuplicates()
+		if count > 0 {
+			logger.Printf("Deduplicating %d files with identical content (%d bytes)", count, saved)
+		}
+		duplicates = collectionManifest.Duplicates()
+	}
+	if hmacKey != "" {
+		collectionManifest.Seal([]byte(hmacKey))
+	}
+	if err := core.WriteCollectionManifest(artifactsDir, collectionManifest, manifestFormat); err != nil {
+		return fmt.Errorf("failed to write collection manifest: %w", err)
+	}
+	
 	// Bundle and optionally encrypt the artifacts
 	logger.Printf("Creating archive...")
 	packageMeta, err := core.BundleAndMaybeEncrypt(
@@ -339,13 +1004,64 @@ func runHarvest(cmd *cobra.Command, args []string) error {
 		outDir, 
 		hostname, 
 		now, 
-		agePublicKey,
+		core.ArchiveEncryption{
+			Recipients:       recipients,
+			Passphrase:       encryptPassphrase,
+			ScryptWorkFactor: scryptWorkFactor,
+		},
+		core.ArchiveCompression{Codec: compression, Level: compressionLevel},
+		splitBytes,
+		duplicates,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create archive: %w", err)
 	}
 	
-	logger.Printf("Archive created: %s", packageMeta.Path)
+	if len(packageMeta.Volumes) > 0 {
+		logger.Printf("Archive created: %s, split into %d volumes", packageMeta.Path, len(packageMeta.Volumes))
+	} else {
+		logger.Printf("Archive created: %s", packageMeta.Path)
+	}
+	
+	// Sign the archive as written, for chain of custody
+	if signingKey != nil {
+		if err := core.SignArchive(ctx, packageMeta, signingKey); err != nil {
+			return err
+		}
+		logger.Printf("Archive signed: %s", packageMeta.Signature)
+	}
+	
+	// The archive cannot hold its own hash, so the copy naming it sits beside it
+	combinedManifest.SetArchive(packageMeta)
+	combinedPath := core.CombinedManifestPath(packageMeta.Path)
+	if err := core.WriteCombinedManifest(combinedPath, combinedManifest); err != nil {
+		logger.Printf("Warning: failed to write %s: %v", combinedPath, err)
+		combinedPath = ""
+	}
+	
+	// Push the archive off the host; it stays on disk if the upload fails
+	var upload *core.S3Upload
+	var uploadErr error
+	if uploader != nil {
+		uploadPaths := archiveFiles(packageMeta, combinedPath)
+		logger.Printf("Uploading %d files to %s...", len(uploadPaths), uploadS3)
+		upload, uploadErr = uploader.UploadFiles(ctx, uploadPaths)
+		if uploadErr != nil {
+			logger.Printf("Warning: upload to %s failed; the archive is kept locally: %v", uploadS3, uploadErr)
+		} else if deleteAfterUpload {
+			upload.DeletedLocal = true
+			for _, path := range uploadPaths {
+				if err := os.Remove(path); err != nil {
+					logger.Printf("Warning: failed to remove uploaded %s: %v", path, err)
+					upload.DeletedLocal = false
+				}
+			}
+		}
+	}
+	
+	// Summarize what was collected and how well it packed
+	stats := core.ComputeRunStats(artifactsDir, collectionManifest, results, packageMeta.BytesWritten, time.Since(now))
+	logger.Printf("Collected %d bytes in %d files; archive is %d bytes (ratio %.2f)", stats.RawBytes, stats.FileCount, stats.ArchiveBytes, stats.CompressionRatio)
 	
 	// Build output structure
 	finalArtifactsDir := artifactsDir
@@ -367,10 +1083,39 @@ func runHarvest(cmd *cobra.Command, args []string) error {
 		now,
 	)
 	
+	output.SetRunID(runID)
+	output.SetProfile(profileName)
+	output.SetManifestSealed(hmacKey != "")
+	output.SetSession(session)
+	output.SetSnapshot(snapshot)
+	output.SetHostNames(hostNames)
+	output.SetHashing(!noHash)
+	output.SetHashWorkers(hashWorkers)
+	output.SetInterrupted(interrupted)
+	output.SetLowDiskSpace(collectSettings.MinFreeSpace.Tripped())
+	output.SetSizeCaps(maxFileMB, maxModuleMB, totalSizeBudget)
+	output.SetSizeBudgetExhausted(sizeBudget.Exhausted())
+	output.SetOfflineRoot(offlineRoot)
+	output.SetIOCMatches(iocMatches)
+	output.SetPEFlagged(peFlagged)
+	output.SetCompression(packageMeta.Compression, packageMeta.CompressionLevel)
+	output.SetArchiveVolumes(packageMeta.Volumes)
+	output.SetArchiveSHA256(packageMeta.SHA256)
+	output.SetSignature(packageMeta.Signature, packageMeta.SigningPublicKey)
+	output.SetCombinedManifest(combinedPath)
+	output.SetUpload(upload)
+	output.SetDeduplicated(packageMeta.Deduplicated)
+	output.SetThrottleWait(winutil.AdaptiveThrottleWait())
+	output.SetHostTimezone(hostTimezone)
+	output.SetStats(stats)
+	
 	// Set since fields if provided
 	if sinceWasSet {
 		output.SetSince(since, sinceNormalized)
 	}
+	if untilWasSet {
+		output.SetUntil(until, untilNormalized)
+	}
 	
 	// Marshal and output JSON with pretty formatting
 	jsonBytes, err := json.MarshalIndent(output, "", "  ")
@@ -380,6 +1125,132 @@ func runHarvest(cmd *cobra.Command, args []string) error {
 	
 	fmt.Println(string(jsonBytes))
 	
+	// Schedule removal of the tool and local copies once delivery has succeeded
+	if selfDelete {
+		delivered := upload != nil && uploadErr == nil
+		localCopies := append([]string{artifactsDir}, archiveFiles(packageMeta, combinedPath)...)
+		logger.Printf("Self-delete requested: scheduling removal of binary, %s and %s on exit", artifactsDir, packageMeta.Path)
+		if err := core.ScheduleSelfDelete(delivered, selfDeleteRecorded, localCopies); err != nil {
+			logger.Printf("Self-delete not performed: %v", err)
+		}
+	}
+	
 	// Return collection error as the command result, if any
+	if collectErr == nil && uploadErr != nil {
+		return fmt.Errorf("failed to upload archive: %w", uploadErr)
+	}
 	return collectErr
-}
\ No newline at end of file
+}
+
+// checkSelfDeleteFlags refuses --self-delete with --keep-tmp, which would
+// leave the artifacts behind, and without a remote delivery target, which
+// would destroy the only copy of the evidence.
+func checkSelfDeleteFlags(selfDelete, keepTmp, deliveryConfigured bool) error {
+	if !selfDelete {
+		return nil
+	}
+	if keepTmp {
+		return fmt.Errorf("--self-delete cannot be combined with --keep-tmp")
+	}
+	if !deliveryConfigured {
+		return fmt.Errorf("--self-delete requires a remote delivery target so evidence is not lost")
+	}
+	return nil
+}
+
+// deliveryTargetConfigured reports whether any remote delivery destination was requested.
+func deliveryTargetConfigured() bool {
+	return uploadS3 != ""
+}
+
+// archiveFiles returns the files a run leaves beside the collection: the
+// archive or its volumes, then the combined manifest copy and the signature
+// when they were written.
+func archiveFiles(meta *core.PackageMetadata, combinedPath string) []string {
+	files := []string{meta.Path}
+	if len(meta.Volumes) > 0 {
+		files = files[:0]
+		for _, volume := range meta.Volumes {
+			files = append(files, volume.Path)
+		}
+	}
+	if combinedPath != "" {
+		files = append(files, combinedPath)
+	}
+	if meta.Signature != "" {
+		files = append(files, meta.Signature)
+	}
+	return files
+}
+
+// promptPassphrase asks for the archive passphrase twice on the console, as
+// a mistyped one would leave the archive unreadable.
+func promptPassphrase() (string, error) {
+	passphrase, err := winutil.PromptSecret("Archive passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("no passphrase entered")
+	}
+	confirm, err := winutil.PromptSecret("Confirm passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm != passphrase {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// encryptionRecipients validates the --encrypt-age and --encrypt-ssh
+// keys and returns them together; the archive can be decrypted with the
+// identity of any one of them.
+func encryptionRecipients(ageKeys []string, sshKeys []string) ([]string, error) {
+	var recipients []string
+	for _, key := range ageKeys {
+		recipients = append(recipients, strings.TrimSpace(key))
+	}
+	if err := core.ValidateAgePublicKeys(recipients); err != nil {
+		return nil, fmt.Errorf("invalid --encrypt-age: %w", err)
+	}
+	for _, key := range sshKeys {
+		key = strings.TrimSpace(key)
+		if err := core.ValidateSSHRecipient(key); err != nil {
+			return nil, fmt.Errorf("invalid --encrypt-ssh: %w", err)
+		}
+		recipients = append(recipients, key)
+	}
+	return recipients, nil
+}
+
+// deleteSnapshot removes the run's shadow copy once modules no longer read
+// from it, logging its ID on failure so the operator can remove it by hand.
+func deleteSnapshot(snapshot *winutil.Snapshot, logger *log.Logger) {
+	if snapshot.Deleted {
+		return
+	}
+	if err := snapshot.Delete(context.Background()); err != nil {
+		logger.Printf("Warning: %v; remove it with: vssadmin delete shadows /shadow=%s", err, snapshot.ID)
+		return
+	}
+	logger.Printf("Deleted shadow copy %s", snapshot.ID)
+}
+
+// clampSizeCaps validates the --max-file-mb and --max-module-mb values and
+// returns the file cap to use: lowered to the module cap when it would exceed
+// it, with the warning to log. Zero removes a cap, so only a module cap can
+// lower the file cap.
+func clampSizeCaps(fileMB, moduleMB int64) (int64, string, error) {
+	if fileMB < 0 || moduleMB < 0 {
+		return 0, "", fmt.Errorf("--max-file-mb and --max-module-mb must not be negative; 0 removes the cap")
+	}
+	if moduleMB > 0 && (fileMB == 0 || fileMB > moduleMB) {
+		fileCap := fmt.Sprint(fileMB)
+		if fileMB == 0 {
+			fileCap = "0 (no limit)"
+		}
+		return moduleMB, fmt.Sprintf("--max-file-mb %s exceeds --max-module-mb %d; using %d", fileCap, moduleMB, moduleMB), nil
+	}
+	return fileMB, "", nil
+}
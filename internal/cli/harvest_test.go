@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestClampSizeCaps(t *testing.T) {
+	tests := []struct {
+		name             string
+		fileMB, moduleMB int64
+		wantFileMB       int64
+		wantWarning      bool
+	}{
+		{"file cap below module cap", 64, 512, 64, false},
+		{"file cap equal to module cap", 512, 512, 512, false},
+		{"file cap above module cap is clamped", 1024, 512, 512, true},
+		{"unlimited file cap is clamped to module cap", 0, 512, 512, true},
+		{"unlimited module cap keeps file cap", 1024, 0, 1024, false},
+		{"both unlimited", 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileMB, warning, err := clampSizeCaps(tt.fileMB, tt.moduleMB)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fileMB != tt.wantFileMB {
+				t.Errorf("file cap = %d, want %d", fileMB, tt.wantFileMB)
+			}
+			if (warning != "") != tt.wantWarning {
+				t.Errorf("warning = %q, want warning %v", warning, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestClampSizeCapsRejectsNegative(t *testing.T) {
+	for _, caps := range [][2]int64{{-1, 512}, {64, -1}, {-1, -1}} {
+		_, _, err := clampSizeCaps(caps[0], caps[1])
+		if err == nil {
+			t.Fatalf("caps %d and %d accepted", caps[0], caps[1])
+		}
+		if !strings.Contains(err.Error(), "must not be negative") {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+}
+
+func TestSizeCapFlagAliases(t *testing.T) {
+	flags := pflag.NewFlagSet("harvest", pflag.ContinueOnError)
+	var fileMB, moduleMB int64
+	flags.Int64Var(&fileMB, "max-file-mb", 512, "")
+	flags.Int64Var(&moduleMB, "max-module-mb", 2048, "")
+	flags.SetNormalizeFunc(normalizeHarvestFlag)
+
+	if err := flags.Parse([]string{"--max-file-size", "10", "--max-total-mb", "20"}); err != nil {
+		t.Fatal(err)
+	}
+	if fileMB != 10 || moduleMB != 20 {
+		t.Fatalf("caps = %d/%d, want 10/20", fileMB, moduleMB)
+	}
+	// Profile defaults must not override a cap set through an alias
+	if !flags.Changed("max-file-mb") || !flags.Changed("max-module-mb") {
+		t.Fatal("alias did not mark its flag as set")
+	}
+
+	if err := flags.Parse([]string{"--max-module-size", "30"}); err != nil {
+		t.Fatal(err)
+	}
+	if moduleMB != 30 {
+		t.Fatalf("module cap = %d, want 30", moduleMB)
+	}
+}
+
+func TestHarvestRegistersSizeCapAliases(t *testing.T) {
+	for alias, name := range harvestFlagAliases {
+		flag := harvestCmd.Flags().Lookup(alias)
+		if flag == nil || flag.Name != name {
+			t.Errorf("--%s does not resolve to --%s", alias, name)
+		}
+	}
+}
+
+func TestCheckSelfDeleteFlags(t *testing.T) {
+	tests := []struct {
+		name                                    string
+		selfDelete, keepTmp, deliveryConfigured bool
+		wantErr                                 bool
+	}{
+		{"not requested", false, true, false, false},
+		{"with delivery", true, false, true, false},
+		{"no delivery target", true, false, false, true},
+		{"keep tmp", true, true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSelfDeleteFlags(tt.selfDelete, tt.keepTmp, tt.deliveryConfigured)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkSelfDeleteFlags = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
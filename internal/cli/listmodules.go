@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"cryptkeeper/internal/core"
+	"cryptkeeper/internal/modules/sysinfo"
+	"cryptkeeper/internal/modules/win_activity"
+	"cryptkeeper/internal/modules/win_ads"
+	"cryptkeeper/internal/modules/win_amcache"
+	"cryptkeeper/internal/modules/win_applications"
+	"cryptkeeper/internal/modules/win_aumid"
+	"cryptkeeper/internal/modules/win_bits"
+	"cryptkeeper/internal/modules/win_browser"
+	"cryptkeeper/internal/modules/win_certificates"
+	"cryptkeeper/internal/modules/win_certutil"
+	"cryptkeeper/internal/modules/win_crashdumps"
+	"cryptkeeper/internal/modules/win_custompaths"
+	"cryptkeeper/internal/modules/win_evtx"
+	"cryptkeeper/internal/modules/win_fileshares"
+	"cryptkeeper/internal/modules/win_firewall_net"
+	"cryptkeeper/internal/modules/win_grouppolicy"
+	"cryptkeeper/internal/modules/win_iis"
+	"cryptkeeper/internal/modules/win_jumplists"
+	"cryptkeeper/internal/modules/win_kerberos"
+	"cryptkeeper/internal/modules/win_lnk"
+	"cryptkeeper/internal/modules/win_logon"
+	"cryptkeeper/internal/modules/win_lsa"
+	"cryptkeeper/internal/modules/win_memory_process"
+	"cryptkeeper/internal/modules/win_mft"
+	"cryptkeeper/internal/modules/win_modern"
+	"cryptkeeper/internal/modules/win_networkinfo"
+	"cryptkeeper/internal/modules/win_persistence"
+	"cryptkeeper/internal/modules/win_prefetch"
+	"cryptkeeper/internal/modules/win_printspooler"
+	"cryptkeeper/internal/modules/win_proxy"
+	"cryptkeeper/internal/modules/win_rdp"
+	"cryptkeeper/internal/modules/win_recyclebin"
+	"cryptkeeper/internal/modules/win_registry"
+	"cryptkeeper/internal/modules/win_services_drivers"
+	"cryptkeeper/internal/modules/win_signatures"
+	"cryptkeeper/internal/modules/win_srum"
+	"cryptkeeper/internal/modules/win_systemconfig"
+	"cryptkeeper/internal/modules/win_tasks"
+	"cryptkeeper/internal/modules/win_tokens"
+	"cryptkeeper/internal/modules/win_trustedinstaller"
+	"cryptkeeper/internal/modules/win_updates"
+	"cryptkeeper/internal/modules/win_usb"
+	"cryptkeeper/internal/modules/win_usn"
+	"cryptkeeper/internal/modules/win_vss"
+	"cryptkeeper/internal/modules/win_wmi"
+	"cryptkeeper/internal/modules/win_wsl"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	listModulesJSON bool
+)
+
+// listModulesCmd represents the list-modules command.
+var listModulesCmd = &cobra.Command{
+	Use:   "list-modules",
+	Short: "List the modules harvest can run",
+	Long: `The list-modules command prints the name and a one-line description of every
+module harvest can run, in the order harvest registers them. The names are the
+ones --modules and --exclude-modules accept. The list is the same on every
+platform, so a selection can be prepared on an analyst workstation.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runListModules,
+}
+
+func init() {
+	listModulesCmd.Flags().BoolVar(&listModulesJSON, "json", false, "print the modules as JSON")
+}
+
+// catalogModules returns a fresh instance of every module harvest can
+// register, in registration order, to read names and descriptions from.
+// Constructors only allocate, and each module has a stub outside Windows, so
+// this works in any build.
+func catalogModules() []core.Module {
+	return []core.Module{
+		sysinfo.NewSysInfo(),
+		win_evtx.NewWinEvtx(),
+		win_registry.NewWinRegistry(),
+		win_prefetch.NewWinPrefetch(),
+		win_amcache.NewWinAmcache(),
+		win_jumplists.NewWinJumpLists(),
+		win_lnk.NewWinLNK(),
+		win_srum.NewWinSRUM(),
+		win_bits.NewWinBITS(),
+		win_tasks.NewWinTasks(),
+		win_services_drivers.NewWinServicesDrivers(),
+		win_wmi.NewWinWMI(),
+		win_firewall_net.NewWinFirewallNet(),
+		win_rdp.NewWinRDP(),
+		win_usb.NewWinUSB(),
+		win_browser.NewWinBrowser(),
+		win_recyclebin.NewWinRecycleBin(),
+		win_iis.NewWinIIS(),
+		win_networkinfo.NewWinNetworkInfo(),
+		win_systemconfig.NewWinSystemConfig(),
+		win_memory_process.NewWinMemoryProcess(),
+		win_applications.NewWinApplications(),
+		win_persistence.NewWinPersistence(),
+		win_modern.NewWinModern(),
+		win_mft.NewWinMFT(),
+		win_usn.NewWinUSN(),
+		win_vss.NewWinVSS(),
+		win_fileshares.NewWinFileShares(),
+		win_lsa.NewWinLSA(),
+		win_kerberos.NewWinKerberos(),
+		win_logon.NewWinLogon(),
+		win_tokens.NewWinTokens(),
+		win_ads.NewWinADS(),
+		win_signatures.NewWinSignatures(),
+		win_certificates.NewWinCertificates(),
+		win_trustedinstaller.NewWinTrustedInstaller(),
+		win_grouppolicy.NewWinGroupPolicy(),
+		win_printspooler.NewWinPrintSpooler(),
+		win_activity.NewWinActivity(),
+		win_wsl.NewWinWSL(),
+		win_aumid.NewWinAUMID(),
+		win_updates.NewWinUpdates(),
+		win_certutil.NewWinCertutil(),
+		win_proxy.NewWinProxy(),
+		win_crashdumps.NewWinCrashDumps(),
+	}
+}
+
+// moduleNames returns the names of modules, in order.
+func moduleNames(modules []core.Module) []string {
+	names := make([]string, 0, len(modules))
+	for _, module := range modules {
+		names = append(names, module.Name())
+	}
+	return names
+}
+
+// moduleInfo describes a module in the list-modules output.
+type moduleInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	EnabledBy   string `json:"enabled_by,omitempty"` // Flag that adds the module instead of --modules
+}
+
+// listModules describes every selectable module, then windows/custompaths,
+// which runs whenever --include-path is given.
+func listModules() []moduleInfo {
+	modules := catalogModules()
+	infos := make([]moduleInfo, 0, len(modules)+1)
+	for _, module := range modules {
+		infos = append(infos, describeModule(module))
+	}
+	custom := describeModule(win_custompaths.NewWinCustomPaths(nil))
+	custom.EnabledBy = "--include-path"
+	return append(infos, custom)
+}
+
+func describeModule(module core.Module) moduleInfo {
+	info := moduleInfo{Name: module.Name()}
+	if described, ok := module.(core.DescribedModule); ok {
+		info.Description = described.Describe()
+	}
+	return info
+}
+
+func runListModules(cmd *cobra.Command, args []string) error {
+	modules := listModules()
+	if listModulesJSON {
+		return printJSON(modules, "module list")
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tDESCRIPTION")
+	for _, module := range modules {
+		description := module.Description
+		if module.EnabledBy != "" {
+			description += fmt.Sprintf(" (runs with %s)", module.EnabledBy)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", module.Name, description)
+	}
+	return w.Flush()
+}
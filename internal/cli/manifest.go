@@ -0,0 +1,70 @@
+// Package cli provides command-line interface implementation for cryptkeeper.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"cryptkeeper/internal/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	rebuildHMACKey        string
+	rebuildManifestFormat string
+)
+
+// manifestCmd represents the manifest command.
+var manifestCmd = &cobra.Command{
+	Use:   "manifest <artifacts-dir>",
+	Short: "Regenerate the root manifest from an artifacts tree",
+	Long: `The manifest command rebuilds the root manifest of an artifacts directory,
+for a run that stopped before bundling or a tree that was edited by hand. It
+re-walks the tree, recomputes the SHA-256 of every file, and writes a fresh
+collection_manifest.json. Each module manifest is checked against the files
+in its directory, reporting listed files that are missing or whose hash no
+longer matches, and files on disk that no module manifest lists. Module
+manifests themselves are left as collected. With --hmac-key the new manifest
+is sealed.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runManifest,
+}
+
+func init() {
+	manifestCmd.Flags().StringVar(&rebuildHMACKey, "hmac-key", "", "key to seal the rebuilt manifest with; required when the previous manifest was sealed")
+	manifestCmd.Flags().StringVar(&rebuildManifestFormat, "manifest-format", "", "root manifest encoding: json or msgpack (default: that of the previous manifest, else json)")
+}
+
+func runManifest(cmd *cobra.Command, args []string) error {
+	artifactsDir := args[0]
+	if info, err := os.Stat(artifactsDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not an artifacts directory", artifactsDir)
+	}
+
+	format := rebuildManifestFormat
+	if format == "" {
+		format = core.ManifestFormatJSON
+		if _, err := os.Stat(filepath.Join(artifactsDir, core.CollectionManifestName)); os.IsNotExist(err) {
+			if _, err := os.Stat(filepath.Join(artifactsDir, core.CollectionManifestMsgpackName)); err == nil {
+				format = core.ManifestFormatMsgpack
+			}
+		}
+	}
+
+	report, err := core.RebuildCollectionManifest(context.Background(), artifactsDir, format, []byte(rebuildHMACKey))
+	if err != nil {
+		return err
+	}
+	if err := printJSON(report, "manifest rebuild report"); err != nil {
+		return err
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("root manifest rebuilt, but module manifests disagree with the tree")
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// DefaultProfile is the profile harvest uses when --profile is not given.
+const DefaultProfile = "full"
+
+// knownModules lists every module harvest registers, in registration order.
+// windows/custompaths is absent: it runs whenever --include-path is given.
+var knownModules = moduleNames(catalogModules())
+
+// collectionProfile is a named module set for a common investigation.
+type collectionProfile struct {
+	Description string
+	Modules     []string          // nil selects every known module
+	Flags       map[string]string // Harvest flag defaults the profile changes; flags given on the command line win
+}
+
+// smallCaps keeps the large optional copies out of the quick profiles.
+var smallCaps = map[string]string{
+	"max-file-mb":      "64",
+	"max-module-mb":    "512",
+	"wsl-image-cap-mb": "0",
+	"datastore-cap-mb": "0",
+}
+
+// collectionProfiles are the profiles --profile accepts.
+var collectionProfiles = map[string]collectionProfile{
+	"full": {
+		Description: "every module with the default size caps",
+	},
+	"triage": {
+		Description: "fast execution and persistence artifacts with small size caps",
+		Modules: []string{
+			"sysinfo", "windows/evtx", "windows/registry", "windows/prefetch",
+			"windows/amcache", "windows/jumplists", "windows/lnk", "windows/tasks",
+			"windows/services_drivers", "windows/wmi", "windows/networkinfo",
+			"windows/systemconfig", "windows/memory_process", "windows/persistence",
+			"windows/activity",
+		},
+		Flags: smallCaps,
+	},
+	"credentials": {
+		Description: "credential material, authentication, and logon artifacts",
+		Modules: []string{
+			"sysinfo", "windows/evtx", "windows/registry", "windows/rdp",
+			"windows/browser", "windows/lsa", "windows/kerberos", "windows/logon",
+			"windows/tokens", "windows/certificates", "windows/grouppolicy",
+			"windows/certutil",
+		},
+		Flags: smallCaps,
+	},
+	"malware": {
+		Description: "execution, persistence, and file system artifacts for malware hunting",
+		Modules: []string{
+			"sysinfo", "windows/evtx", "windows/registry", "windows/prefetch",
+			"windows/amcache", "windows/jumplists", "windows/lnk", "windows/bits",
+			"windows/tasks", "windows/services_drivers", "windows/wmi",
+			"windows/recyclebin", "windows/memory_process", "windows/persistence",
+			"windows/modern", "windows/usn", "windows/ads", "windows/signatures",
+			"windows/trustedinstaller", "windows/printspooler", "windows/activity",
+			"windows/certutil", "windows/crashdumps",
+		},
+		Flags: map[string]string{
+			"wsl-image-cap-mb": "0",
+			"datastore-cap-mb": "0",
+		},
+	},
+	"network": {
+		Description: "network configuration, remote access, shares, and per-application network usage",
+		Modules: []string{
+			"sysinfo", "windows/evtx", "windows/srum", "windows/bits",
+			"windows/firewall_net", "windows/rdp", "windows/browser", "windows/iis",
+			"windows/networkinfo", "windows/fileshares", "windows/certutil",
+			"windows/proxy",
+		},
+		Flags: smallCaps,
+	},
+}
+
+// profileNames returns the accepted --profile values, sorted.
+func profileNames() []string {
+	names := make([]string, 0, len(collectionProfiles))
+	for name := range collectionProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile sets the named profile's flag defaults on every flag the
+// command line left unset.
+func applyProfile(cmd *cobra.Command, name string) error {
+	profile, ok := collectionProfiles[name]
+	if !ok {
+		return fmt.Errorf("invalid --profile %q: must be one of %s", name, strings.Join(profileNames(), ", "))
+	}
+	for flag, value := range profile.Flags {
+		if cmd.Flags().Changed(flag) {
+			continue
+		}
+		if err := cmd.Flags().Set(flag, value); err != nil {
+			return fmt.Errorf("profile %s: failed to set --%s: %w", name, flag, err)
+		}
+	}
+	return nil
+}
+
+// selectModules expands a profile into the modules to run, in registration
+// order. A non-empty include list replaces the profile's modules; exclude
+// removes modules from the profile's set. Unknown names in either list are
+// an error, so a typo never runs a module the operator meant to leave out.
+// Names are trimmed, so a list written as
+// "windows/registry, windows/prefetch" is accepted.
+func selectModules(name string, include, exclude []string) ([]string, error) {
+	include = trimModuleNames(include)
+	exclude = trimModuleNames(exclude)
+	if len(include) > 0 && len(exclude) > 0 {
+		return nil, fmt.Errorf("--modules and --exclude-modules cannot be combined; list only the modules to run with --modules")
+	}
+	if unknown := unknownModules(include); len(unknown) > 0 {
+		return nil, fmt.Errorf("--modules: unknown module %q; known modules: %s", unknown[0], strings.Join(knownModules, ", "))
+	}
+	if unknown := unknownModules(exclude); len(unknown) > 0 {
+		return nil, fmt.Errorf("--exclude-modules: unknown module %q; known modules: %s", unknown[0], strings.Join(knownModules, ", "))
+	}
+
+	base := collectionProfiles[name].Modules
+	if base == nil {
+		base = knownModules
+	}
+	if len(include) > 0 {
+		base = include
+	}
+	selected := make(map[string]bool, len(base))
+	for _, module := range base {
+		selected[module] = true
+	}
+	for _, module := range exclude {
+		delete(selected, module)
+	}
+
+	modules := make([]string, 0, len(selected))
+	for _, module := range knownModules {
+		if selected[module] {
+			modules = append(modules, module)
+		}
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("no modules selected")
+	}
+	return modules, nil
+}
+
+// unknownModules returns the names that are not in knownModules.
+func unknownModules(names []string) []string {
+	var unknown []string
+	for _, name := range trimModuleNames(names) {
+		known := false
+		for _, module := range knownModules {
+			if name == module {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+// trimModuleNames strips the spaces around each name and drops empty ones.
+func trimModuleNames(names []string) []string {
+	trimmed := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			trimmed = append(trimmed, name)
+		}
+	}
+	return trimmed
+}
+
+// HarvestConfig is the expanded configuration printed by --print-config.
+type HarvestConfig struct {
+	Profile     string            `json:"profile"`
+	Description string            `json:"description"`
+	Modules     []string          `json:"modules"`
+	Flags       map[string]string `json:"flags"`
+}
+
+// harvestConfig records the selected modules and the effective value of
+// every harvest flag, with the HMAC key masked.
+func harvestConfig(cmd *cobra.Command, profile string, modules []string) HarvestConfig {
+	config := HarvestConfig{
+		Profile:     profile,
+		Description: collectionProfiles[profile].Description,
+		Modules:     modules,
+		Flags:       make(map[string]string),
+	}
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == "help" {
+			return
+		}
+		value := flag.Value.String()
+		if flag.Name == "hmac-key" && value != "" {
+			value = "<set>"
+		}
+		config.Flags[flag.Name] = value
+	})
+	return config
+}
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestSelectModulesRejectsUnknownNames(t *testing.T) {
+	tests := []struct {
+		name             string
+		include, exclude []string
+		flag             string
+	}{
+		{"include", []string{"windows/registry", "windows/regsitry"}, nil, "--modules"},
+		{"exclude", nil, []string{"windows/wmi", "windows/wimi"}, "--exclude-modules"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modules, err := selectModules("triage", tt.include, tt.exclude)
+			if err == nil {
+				t.Fatalf("selectModules accepted a misspelt name and selected %v", modules)
+			}
+			msg := err.Error()
+			if !strings.HasPrefix(msg, tt.flag+":") || !strings.Contains(msg, "windows/registry") {
+				t.Fatalf("error %q should name %s and list the known modules", msg, tt.flag)
+			}
+		})
+	}
+}
+
+func TestSelectModulesExcludesFromProfile(t *testing.T) {
+	modules, err := selectModules("triage", nil, []string{" windows/wmi", "windows/prefetch "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, module := range modules {
+		if module == "windows/wmi" || module == "windows/prefetch" {
+			t.Fatalf("excluded module %s selected: %v", module, modules)
+		}
+	}
+	if want := len(collectionProfiles["triage"].Modules) - 2; len(modules) != want {
+		t.Fatalf("selected %d modules, want %d", len(modules), want)
+	}
+}
+
+func TestSelectModulesRejectsIncludeWithExclude(t *testing.T) {
+	if _, err := selectModules("full", []string{"windows/registry"}, []string{"windows/wmi"}); err == nil {
+		t.Fatal("--modules combined with --exclude-modules was accepted")
+	}
+}
+
+func TestProfilesExpandToTheirModules(t *testing.T) {
+	for _, name := range profileNames() {
+		t.Run(name, func(t *testing.T) {
+			profile := collectionProfiles[name]
+			if unknown := unknownModules(profile.Modules); len(unknown) > 0 {
+				t.Fatalf("profile lists unknown modules %v", unknown)
+			}
+			for flag := range profile.Flags {
+				if harvestCmd.Flags().Lookup(flag) == nil {
+					t.Errorf("profile sets unknown flag --%s", flag)
+				}
+			}
+
+			modules, err := selectModules(name, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := knownModules
+			if profile.Modules != nil {
+				want = inRegistrationOrder(profile.Modules)
+			}
+			if !reflect.DeepEqual(modules, want) {
+				t.Fatalf("modules = %v\nwant %v", modules, want)
+			}
+		})
+	}
+
+	// Spot checks of the curated sets
+	for _, tt := range []struct {
+		profile, module string
+		want            bool
+	}{
+		{"triage", "windows/prefetch", true},
+		{"triage", "windows/usn", false},
+		{"credentials", "windows/lsa", true},
+		{"credentials", "windows/prefetch", false},
+		{"malware", "windows/usn", true},
+		{"network", "windows/firewall_net", true},
+		{"full", "windows/usn", true},
+	} {
+		modules, _ := selectModules(tt.profile, nil, nil)
+		got := false
+		for _, module := range modules {
+			got = got || module == tt.module
+		}
+		if got != tt.want {
+			t.Errorf("%s selects %s = %v, want %v", tt.profile, tt.module, got, tt.want)
+		}
+	}
+}
+
+// inRegistrationOrder sorts module names as harvest registers them.
+func inRegistrationOrder(names []string) []string {
+	index := make(map[string]int, len(knownModules))
+	for i, module := range knownModules {
+		index[module] = i
+	}
+	sorted := append([]string(nil), names...)
+	sort.Slice(sorted, func(i, j int) bool { return index[sorted[i]] < index[sorted[j]] })
+	return sorted
+}
+
+func TestModuleFlagsOverrideProfile(t *testing.T) {
+	// --modules replaces the profile's set, even with modules it leaves out
+	modules, err := selectModules("credentials", []string{"windows/usn", "windows/registry"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := inRegistrationOrder([]string{"windows/usn", "windows/registry"}); !reflect.DeepEqual(modules, want) {
+		t.Errorf("--modules = %v, want %v", modules, want)
+	}
+
+	// Excluding a module the profile does not select is harmless
+	modules, err = selectModules("network", nil, []string{"windows/srum", "windows/usn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modules) != len(collectionProfiles["network"].Modules)-1 {
+		t.Errorf("network without srum = %v", modules)
+	}
+	for _, module := range modules {
+		if module == "windows/srum" {
+			t.Errorf("excluded windows/srum selected")
+		}
+	}
+
+	if _, err := selectModules("triage", nil, collectionProfiles["triage"].Modules); err == nil || err.Error() != "no modules selected" {
+		t.Errorf("excluding every module = %v", err)
+	}
+}
+
+func TestApplyProfileKeepsCommandLineFlags(t *testing.T) {
+	cmd := &cobra.Command{Use: "harvest"}
+	var fileMB, moduleMB, wslMB, datastoreMB int64
+	cmd.Flags().Int64Var(&fileMB, "max-file-mb", 512, "")
+	cmd.Flags().Int64Var(&moduleMB, "max-module-mb", 2048, "")
+	cmd.Flags().Int64Var(&wslMB, "wsl-image-cap-mb", 4096, "")
+	cmd.Flags().Int64Var(&datastoreMB, "datastore-cap-mb", 1024, "")
+	var hmacKey string
+	cmd.Flags().StringVar(&hmacKey, "hmac-key", "", "")
+	if err := cmd.Flags().Parse([]string{"--max-file-mb", "10", "--hmac-key", "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyProfile(cmd, "triage"); err != nil {
+		t.Fatal(err)
+	}
+	if fileMB != 10 || moduleMB != 512 || wslMB != 0 || datastoreMB != 0 {
+		t.Fatalf("caps after triage = %d, %d, %d, %d", fileMB, moduleMB, wslMB, datastoreMB)
+	}
+
+	config := harvestConfig(cmd, "triage", []string{"windows/registry"})
+	want := map[string]string{"max-file-mb": "10", "max-module-mb": "512", "wsl-image-cap-mb": "0", "datastore-cap-mb": "0", "hmac-key": "<set>"}
+	if !reflect.DeepEqual(config.Flags, want) || config.Description != collectionProfiles["triage"].Description {
+		t.Errorf("config = %+v", config)
+	}
+
+	if err := applyProfile(cmd, "trige"); err == nil || !strings.Contains(err.Error(), "credentials, full, malware, network, triage") {
+		t.Errorf("unknown profile = %v", err)
+	}
+}
@@ -26,4 +26,11 @@ func Execute() error {
 func init() {
 	// Add subcommands
 	rootCmd.AddCommand(harvestCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(extractCmd)
+	rootCmd.AddCommand(analyzeCmd)
+	rootCmd.AddCommand(manifestCmd)
+	rootCmd.AddCommand(sanitizeCmd)
+	rootCmd.AddCommand(listModulesCmd)
+	rootCmd.AddCommand(versionCmd)
 }
\ No newline at end of file
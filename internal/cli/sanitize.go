@@ -0,0 +1,92 @@
+// Package cli provides command-line interface implementation for cryptkeeper.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"cryptkeeper/internal/core"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sanitizeMap        string
+	sanitizeOut        string
+	sanitizeIdentity   string
+	sanitizeEncryptAge []string
+	sanitizeEncryptSSH []string
+)
+
+// sanitizeCmd represents the sanitize command.
+var sanitizeCmd = &cobra.Command{
+	Use:   "sanitize <artifacts-dir-or-archive>",
+	Short: "Write a copy of a collection with users, host, and SIDs pseudonymized",
+	Long: `The sanitize command writes a new archive of a collection, given as an
+artifacts directory or an archive, in which the host name, user names, and
+user SIDs are replaced by stable pseudonyms (host001, user001, S-1-5-21-0-0-1)
+in every text output and in every file path. The same identifier maps to the
+same pseudonym everywhere, so references between outputs still line up.
+Binary artifacts such as hives, event logs, and prefetch files are copied
+byte for byte.
+
+The mapping is read from --map when it exists, so pseudonyms stay stable
+across collections, extended with the identifiers found, and written back.
+It reverses the sanitization: keep it apart from the sanitized archive.
+Entries given with an empty pseudonym are assigned one, to redact names the
+collection does not reveal by path.
+
+The input must match its root manifest. The copy gets a freshly built root
+manifest, unsealed; module manifests are sanitized as text and keep the
+hashes of the original files.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runSanitize,
+}
+
+func init() {
+	sanitizeCmd.Flags().StringVar(&sanitizeMap, "map", "", "pseudonym mapping file to read and update, e.g. users.json")
+	sanitizeCmd.Flags().StringVar(&sanitizeOut, "out", "", "directory to write the sanitized archive to")
+	sanitizeCmd.Flags().StringVar(&sanitizeIdentity, "identity", "", "age identity file or OpenSSH private key for encrypted archives, or \"-\" to prompt for the passphrase of a passphrase-encrypted one")
+	sanitizeCmd.Flags().StringArrayVar(&sanitizeEncryptAge, "encrypt-age", nil, "age public key to encrypt the sanitized archive to (must start with age1); repeatable")
+	sanitizeCmd.Flags().StringArrayVar(&sanitizeEncryptSSH, "encrypt-ssh", nil, "SSH public key (ssh-ed25519 or ssh-rsa) to encrypt the sanitized archive to; repeatable and combinable with --encrypt-age")
+}
+
+func runSanitize(cmd *cobra.Command, args []string) error {
+	if sanitizeMap == "" {
+		return fmt.Errorf("--map is required")
+	}
+	if sanitizeOut == "" {
+		return fmt.Errorf("--out is required")
+	}
+	recipients, err := encryptionRecipients(sanitizeEncryptAge, sanitizeEncryptSSH)
+	if err != nil {
+		return err
+	}
+
+	var identities []age.Identity
+	if sanitizeIdentity != "" {
+		var err error
+		identities, err = loadIdentities(sanitizeIdentity)
+		if err != nil {
+			return fmt.Errorf("invalid --identity: %w", err)
+		}
+	}
+
+	outDir, err := filepath.Abs(sanitizeOut)
+	if err != nil {
+		return fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	report, err := core.SanitizeCollection(context.Background(), args[0], outDir, sanitizeMap, recipients, identities)
+	if err != nil {
+		return err
+	}
+	return printJSON(report, "sanitize report")
+}
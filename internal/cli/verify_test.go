@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/core"
+
+	"filippo.io/age"
+)
+
+// runCommand runs the CLI with args, discarding what it prints, and resets
+// the verify flags afterwards.
+func runCommand(t *testing.T, args ...string) error {
+	t.Helper()
+	t.Cleanup(func() {
+		verifyHMACKey, verifyIdentity, verifySignedBy = "", "", ""
+	})
+	stdout := os.Stdout
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+		devNull.Close()
+	}()
+	rootCmd.SetArgs(args)
+	return rootCmd.Execute()
+}
+
+func TestVerifyStreamedZstdAgeArchive(t *testing.T) {
+	artifactsDir := t.TempDir()
+	for name, content := range map[string]string{
+		"sysinfo/host.json": `{"hostname":"host"}`,
+		"tool_info.json":    `{"version":"test"}`,
+	} {
+		path := filepath.Join(artifactsDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	manifest, err := core.BuildCollectionManifest(context.Background(), artifactsDir, "host", "run", now, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := core.WriteCollectionManifest(artifactsDir, manifest, core.ManifestFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sink bytes.Buffer
+	encryption := core.ArchiveEncryption{Recipients: []string{identity.Recipient().String()}}
+	if _, err := core.StreamArchive(context.Background(), artifactsDir, &sink, now, encryption, core.ArchiveCompression{Codec: core.CompressionZstd}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "streamed.tar.zst.age")
+	identityPath := filepath.Join(dir, "identity.txt")
+	if err := os.WriteFile(archivePath, sink.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(identityPath, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCommand(t, "verify", archivePath, "--identity", identityPath); err != nil {
+		t.Fatalf("verify of the streamed archive failed: %v", err)
+	}
+
+	// A flipped byte in the ciphertext body fails verification
+	corrupt := append([]byte{}, sink.Bytes()...)
+	corrupt[len(corrupt)-20] ^= 0xFF
+	if err := os.WriteFile(archivePath, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCommand(t, "verify", archivePath, "--identity", identityPath); err == nil {
+		t.Fatal("verify accepted a corrupted archive")
+	}
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"cryptkeeper/internal/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	versionJSON bool
+)
+
+// versionCmd represents the version command.
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the cryptkeeper version and build information",
+	Long: `The version command prints the version, VCS commit, build date, Go toolchain,
+and platform of this binary. The same information is recorded in every
+collection's tool_info.json, root manifest, and run output.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runVersion,
+}
+
+func init() {
+	versionCmd.Flags().BoolVar(&versionJSON, "json", false, "print build information as JSON")
+}
+
+func runVersion(cmd *cobra.Command, args []string) error {
+	info := core.CurrentBuildInfo()
+	if !versionJSON {
+		fmt.Fprintln(cmd.OutOrStdout(), info.String())
+		return nil
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal build info: %w", err)
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), string(data))
+	return nil
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Analysis pass outcomes.
+const (
+	AnalysisOK      = "ok"
+	AnalysisSkipped = "skipped"
+	AnalysisFailed  = "failed"
+)
+
+// AnalysisPass re-runs one of a module's parsers over raw artifacts it
+// collected earlier, without touching the host they came from.
+type AnalysisPass struct {
+	Module string   // Module whose directory the pass reads and writes, e.g. "windows/amcache"
+	Name   string   // What the pass produces, e.g. "driver_inventory"
+	Inputs []string // Other modules whose collected files the pass also reads
+
+	// Run parses the files under moduleDir, the module's directory in the
+	// collection (the outDir its Collect was given), and returns the paths
+	// relative to moduleDir of every file it wrote or rewrote, including the
+	// module manifest.
+	Run func(ctx context.Context, moduleDir string) ([]string, error)
+}
+
+// Modules returns the module directories a pass reads.
+func (p AnalysisPass) Modules() []string {
+	return append([]string{p.Module}, p.Inputs...)
+}
+
+// AnalysisResult records the outcome of one pass.
+type AnalysisResult struct {
+	Module string   `json:"module"`
+	Pass   string   `json:"pass"`
+	Status string   `json:"status"`
+	Files  []string `json:"files,omitempty"` // Paths relative to the artifacts directory
+	Error  string   `json:"error,omitempty"`
+}
+
+// AnalysisReport describes an analyze run over a collection.
+type AnalysisReport struct {
+	ArtifactsDir    string           `json:"artifacts_dir"`
+	Passes          []AnalysisResult `json:"passes"`
+	ManifestUpdated bool             `json:"manifest_updated"`
+	Resealed        bool             `json:"resealed"`
+}
+
+// AnalyzeCollection runs the passes whose module was collected over the
+// artifacts directory, then re-indexes every file they wrote in the root
+// manifest. A sealed manifest is only rewritten when key verifies its seal,
+// and is sealed again with the same key afterwards.
+func AnalyzeCollection(ctx context.Context, artifactsDir string, passes []AnalysisPass, key []byte) (*AnalysisReport, error) {
+	manifest, err := ReadCollectionManifest(artifactsDir)
+	if err != nil {
+		return nil, err
+	}
+	format := manifestFormat(artifactsDir)
+	if manifest.HMAC != "" {
+		if len(key) == 0 {
+			return nil, fmt.Errorf("collection manifest is sealed; the --hmac-key used at collection is required to re-seal it after analysis")
+		}
+		if err := manifest.CheckSeal(key); err != nil {
+			return nil, fmt.Errorf("refusing to analyze: %w", err)
+		}
+	}
+
+	report := &AnalysisReport{ArtifactsDir: artifactsDir, Passes: make([]AnalysisResult, 0, len(passes))}
+	var written []string
+	for _, pass := range passes {
+		select {
+		case <-ctx.Done():
+			return report, ctx.Err()
+		default:
+		}
+
+		result := AnalysisResult{Module: pass.Module, Pass: pass.Name}
+		dir := ModuleDir(pass.Module)
+		moduleDir := filepath.Join(artifactsDir, dir)
+		if _, err := os.Stat(moduleDir); err != nil {
+			result.Status = AnalysisSkipped
+			result.Error = "module was not collected"
+			report.Passes = append(report.Passes, result)
+			continue
+		}
+
+		files, err := pass.Run(ctx, moduleDir)
+		for _, file := range files {
+			result.Files = append(result.Files, filepath.ToSlash(filepath.Join(dir, file)))
+		}
+		written = append(written, result.Files...)
+		switch {
+		case err != nil:
+			result.Status = AnalysisFailed
+			result.Error = err.Error()
+		case len(files) == 0:
+			result.Status = AnalysisSkipped
+			result.Error = "no input artifacts in the collection"
+		default:
+			result.Status = AnalysisOK
+		}
+		report.Passes = append(report.Passes, result)
+	}
+
+	if len(written) == 0 {
+		return report, nil
+	}
+	resealed, err := reindexFiles(artifactsDir, manifest, format, written, key)
+	if err != nil {
+		return report, err
+	}
+	report.Resealed = resealed
+	report.ManifestUpdated = true
+
+	return report, nil
+}
+
+// ReindexCollection indexes files written into a collection after it was
+// made, relative paths given, in the root manifest. A sealed manifest is
+// only rewritten when key verifies its seal, and is sealed again with the
+// same key. It reports whether the manifest was re-sealed.
+func ReindexCollection(artifactsDir string, relPaths []string, key []byte) (bool, error) {
+	manifest, err := ReadCollectionManifest(artifactsDir)
+	if err != nil {
+		return false, err
+	}
+	format := manifestFormat(artifactsDir)
+	if manifest.HMAC != "" {
+		if len(key) == 0 {
+			return false, fmt.Errorf("collection manifest is sealed; the --hmac-key used at collection is required to re-seal it")
+		}
+		if err := manifest.CheckSeal(key); err != nil {
+			return false, fmt.Errorf("refusing to re-index: %w", err)
+		}
+	}
+	return reindexFiles(artifactsDir, manifest, format, relPaths, key)
+}
+
+// manifestFormat returns the format the root manifest was written in.
+func manifestFormat(artifactsDir string) string {
+	if _, err := os.Stat(filepath.Join(artifactsDir, CollectionManifestName)); os.IsNotExist(err) {
+		return ManifestFormatMsgpack
+	}
+	return ManifestFormatJSON
+}
+
+// reindexFiles adds relPaths to manifest, re-seals it when it was sealed,
+// and writes it back in format.
+func reindexFiles(artifactsDir string, manifest *CollectionManifest, format string, relPaths []string, key []byte) (bool, error) {
+	sorted := append([]string(nil), relPaths...)
+	sort.Strings(sorted)
+	for _, relPath := range sorted {
+		if err := manifest.AddFile(artifactsDir, relPath); err != nil {
+			return false, fmt.Errorf("failed to index %s: %w", relPath, err)
+		}
+	}
+	resealed := false
+	if manifest.HMAC != "" {
+		manifest.Seal(key)
+		resealed = true
+	}
+	if err := WriteCollectionManifest(artifactsDir, manifest, format); err != nil {
+		return resealed, fmt.Errorf("failed to write collection manifest: %w", err)
+	}
+	return resealed, nil
+}
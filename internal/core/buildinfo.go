@@ -0,0 +1,117 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// ToolInfoName is the file written to the artifacts root identifying the cryptkeeper build.
+const ToolInfoName = "tool_info.json"
+
+// DefaultVersion is reported when no version was embedded at build time.
+const DefaultVersion = "v0.1.0"
+
+// Build identifiers embedded with -ldflags, e.g.
+//
+//	go build -ldflags "-X cryptkeeper/internal/core.version=v0.2.0 -X cryptkeeper/internal/core.commit=$(git rev-parse HEAD) -X cryptkeeper/internal/core.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// BuildInfo identifies the cryptkeeper build that produced a collection.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`     // VCS revision, suffixed -dirty for uncommitted changes
+	BuildDate string `json:"build_date,omitempty"` // RFC3339; the commit time when not embedded
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"` // GOOS/GOARCH
+}
+
+var (
+	buildInfoOnce sync.Once
+	buildInfo     BuildInfo
+)
+
+// CurrentBuildInfo returns the running binary's build information. Values
+// embedded with -ldflags take precedence; anything missing is filled from the
+// module and VCS metadata the Go toolchain records in the binary.
+func CurrentBuildInfo() BuildInfo {
+	buildInfoOnce.Do(func() {
+		buildInfo = BuildInfo{
+			Version:   version,
+			Commit:    commit,
+			BuildDate: buildDate,
+			GoVersion: runtime.Version(),
+			Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		}
+
+		if info, ok := debug.ReadBuildInfo(); ok {
+			if buildInfo.Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+				buildInfo.Version = info.Main.Version
+			}
+			var revision, vcsTime string
+			var modified bool
+			for _, setting := range info.Settings {
+				switch setting.Key {
+				case "vcs.revision":
+					revision = setting.Value
+				case "vcs.time":
+					vcsTime = setting.Value
+				case "vcs.modified":
+					modified = setting.Value == "true"
+				}
+			}
+			if buildInfo.Commit == "" && revision != "" {
+				buildInfo.Commit = revision
+				if modified {
+					buildInfo.Commit += "-dirty"
+				}
+			}
+			if buildInfo.BuildDate == "" {
+				buildInfo.BuildDate = vcsTime
+			}
+		}
+
+		if buildInfo.Version == "" {
+			buildInfo.Version = DefaultVersion
+		}
+	})
+	return buildInfo
+}
+
+// Version returns the running binary's version string.
+func Version() string {
+	return CurrentBuildInfo().Version
+}
+
+// String renders the build information on one line for the version command.
+func (b BuildInfo) String() string {
+	commit := b.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	date := b.BuildDate
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("cryptkeeper %s (commit %s, built %s, %s %s)", b.Version, commit, date, b.GoVersion, b.Platform)
+}
+
+// WriteToolInfo writes tool_info.json to the root of artifactsDir.
+func WriteToolInfo(artifactsDir string) error {
+	data, err := json.MarshalIndent(CurrentBuildInfo(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal tool info: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, ToolInfoName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write tool info: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestBuildInfoIsRecordedInCollection(t *testing.T) {
+	info := CurrentBuildInfo()
+	if info.Version == "" || Version() != info.Version {
+		t.Fatalf("version = %q", info.Version)
+	}
+	if info.GoVersion != runtime.Version() || info.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Errorf("build info = %+v", info)
+	}
+	if line := info.String(); !strings.HasPrefix(line, "cryptkeeper "+info.Version+" (commit ") {
+		t.Errorf("version line = %q", line)
+	}
+
+	dir := t.TempDir()
+	if err := WriteToolInfo(dir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ToolInfoName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var toolInfo BuildInfo
+	if err := json.Unmarshal(data, &toolInfo); err != nil {
+		t.Fatal(err)
+	}
+	if toolInfo != info {
+		t.Errorf("tool_info.json = %s, want %+v", data, info)
+	}
+
+	// The root manifest carries the same build in either encoding
+	manifest, err := BuildCollectionManifest(context.Background(), dir, "host", testRunID, testTimestamp, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{ManifestFormatJSON, ManifestFormatMsgpack} {
+		if err := WriteCollectionManifest(dir, manifest, format); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadCollectionManifest(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read.Tool == nil || *read.Tool != info {
+			t.Errorf("%s manifest tool = %+v, want %+v", format, read.Tool, info)
+		}
+	}
+	data, err = os.ReadFile(filepath.Join(dir, CollectionManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"version": "`+info.Version+`"`) {
+		t.Errorf("collection_manifest.json does not record version %s", info.Version)
+	}
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// CombinedManifestName is the file at the artifacts root that aggregates
+// every module manifest. A copy naming the finished archive and its hash is
+// written next to the archive as the archive path plus this suffix.
+const CombinedManifestName = "combined_manifest.json"
+
+// CombinedManifest gathers the module manifests of a run into one file, so a
+// review tool can load a collection's contents without walking it.
+type CombinedManifest struct {
+	CreatedUTC string                     `json:"created_utc"`
+	Host       string                     `json:"host"`
+	RunID      string                     `json:"run_id,omitempty"`
+	Totals     CombinedTotals             `json:"totals"`
+	Modules    map[string]*CombinedModule `json:"modules"` // Keyed by module name
+	Archive    *CombinedArchive           `json:"archive,omitempty"`
+}
+
+// CombinedTotals sums the module entries of a combined manifest.
+type CombinedTotals struct {
+	Modules int   `json:"modules"`
+	Failed  int   `json:"failed"`
+	Items   int   `json:"items"`
+	Errors  int   `json:"errors"`
+	Files   int   `json:"files"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// CombinedModule is one module's entry in the combined manifest.
+type CombinedModule struct {
+	Dir            string            `json:"dir"` // Output directory relative to the artifacts root
+	OK             bool              `json:"ok"`
+	Error          string            `json:"error,omitempty"`
+	Skipped        string            `json:"skipped,omitempty"`
+	Manifests      []string          `json:"manifests"` // Module manifests read, relative to the artifacts root
+	Items          int               `json:"items"`
+	TotalFiles     int               `json:"total_files,omitempty"`     // Candidates the manifests report finding
+	CollectedFiles int               `json:"collected_files,omitempty"` // Of those, the ones copied
+	Files          int               `json:"files"`                     // Files in the module directory
+	Bytes          int64             `json:"bytes"`
+	Errors         []json.RawMessage `json:"errors"` // Manifest errors, as each module records them
+}
+
+// CombinedArchive identifies the archive a collection was packed into.
+type CombinedArchive struct {
+	Path    string          `json:"path"`
+	SHA256  string          `json:"sha256"`
+	Size    int64           `json:"size"`
+	Volumes []ArchiveVolume `json:"volumes,omitempty"`
+}
+
+// BuildCombinedManifest reads the manifest.json files in each module's output
+// directory and totals their items and errors with the module's result.
+func BuildCombinedManifest(artifactsDir, hostname, runID string, created time.Time, results []Result) *CombinedManifest {
+	combined := &CombinedManifest{
+		CreatedUTC: winutil.FormatTime(created),
+		Host:       hostname,
+		RunID:      runID,
+		Modules:    make(map[string]*CombinedModule, len(results)),
+	}
+
+	for _, result := range results {
+		module := &CombinedModule{
+			Dir:       SanitizeName(result.Module),
+			OK:        result.OK,
+			Error:     result.Error,
+			Skipped:   result.Skipped,
+			Manifests: make([]string, 0, 1),
+			Errors:    make([]json.RawMessage, 0),
+		}
+		module.read(artifactsDir)
+
+		combined.Modules[result.Module] = module
+		combined.Totals.Modules++
+		if !result.OK {
+			combined.Totals.Failed++
+		}
+		combined.Totals.Items += module.Items
+		combined.Totals.Errors += len(module.Errors)
+		combined.Totals.Files += module.Files
+		combined.Totals.Bytes += module.Bytes
+	}
+	return combined
+}
+
+// read walks the module directory, counting its files and folding in every
+// module manifest found. Fields a manifest lacks or records in another shape
+// are left out rather than failing the whole entry.
+func (m *CombinedModule) read(artifactsDir string) {
+	filepath.WalkDir(filepath.Join(artifactsDir, m.Dir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			m.Files++
+			m.Bytes += info.Size()
+		}
+		if d.Name() != moduleManifestName {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(data, &fields) != nil {
+			return nil
+		}
+		if rel, err := filepath.Rel(artifactsDir, path); err == nil {
+			m.Manifests = append(m.Manifests, filepath.ToSlash(rel))
+		}
+
+		var items []json.RawMessage
+		if json.Unmarshal(fields["items"], &items) == nil {
+			m.Items += len(items)
+		}
+		var errs []json.RawMessage
+		if json.Unmarshal(fields["errors"], &errs) == nil {
+			m.Errors = append(m.Errors, errs...)
+		}
+		var count int
+		if json.Unmarshal(fields["total_files"], &count) == nil {
+			m.TotalFiles += count
+		}
+		count = 0
+		if json.Unmarshal(fields["collected_files"], &count) == nil {
+			m.CollectedFiles += count
+		}
+		return nil
+	})
+}
+
+// SetArchive records the finished archive in the manifest.
+func (c *CombinedManifest) SetArchive(meta *PackageMetadata) {
+	c.Archive = &CombinedArchive{
+		Path:    meta.Path,
+		SHA256:  meta.SHA256,
+		Size:    meta.BytesWritten,
+		Volumes: meta.Volumes,
+	}
+}
+
+// CombinedManifestPath returns where the copy of the combined manifest that
+// records the finished archive is written next to it.
+func CombinedManifestPath(archivePath string) string {
+	return archivePath + "." + CombinedManifestName
+}
+
+// WriteCombinedManifest writes the combined manifest to path.
+func WriteCombinedManifest(path string, combined *CombinedManifest) error {
+	data, err := json.MarshalIndent(combined, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"cryptkeeper/internal/coverage"
+	"cryptkeeper/internal/winutil"
+)
+
+// CoverageReportName is the file each module directory gets with --coverage.
+const CoverageReportName = "coverage.json"
+
+// CoverageReport is the content of a module's coverage.json: every location
+// the module probed, with what it found there.
+type CoverageReport struct {
+	Module       string           `json:"module"`
+	CollectedUTC string           `json:"collected_utc"`
+	Probes       []coverage.Probe `json:"probes"`
+	Outcomes     map[string]int   `json:"outcomes"` // Probe count per outcome
+}
+
+// NewCoverageReport summarizes the probes recorded for a module.
+func NewCoverageReport(ctx context.Context, module string, probes []coverage.Probe) *CoverageReport {
+	report := &CoverageReport{
+		Module:       module,
+		CollectedUTC: winutil.FormatTime(winutil.Now(ctx)),
+		Probes:       make([]coverage.Probe, 0, len(probes)),
+		Outcomes:     make(map[string]int),
+	}
+	for _, probe := range probes {
+		report.Probes = append(report.Probes, probe)
+		report.Outcomes[probe.Outcome]++
+	}
+	return report
+}
+
+// writeCoverageReport writes coverage.json to a module's output directory.
+func writeCoverageReport(moduleDir string, report *CoverageReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(moduleDir, CoverageReportName), data, 0644)
+}
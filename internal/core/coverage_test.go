@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"cryptkeeper/internal/coverage"
+	"cryptkeeper/internal/winutil"
+)
+
+// probingModule checks one location that exists and one that does not.
+func probingModule(present, absent string) *fakeModule {
+	return &fakeModule{name: "windows/browser", collect: func(ctx context.Context, outDir string) error {
+		userDir := filepath.Join(outDir, "alice")
+		if err := os.MkdirAll(userDir, 0755); err != nil {
+			return err
+		}
+		winutil.CollectSettingsFrom(ctx).Coverage.Check(userDir, "Edge History", present)
+		winutil.CollectSettingsFrom(ctx).Coverage.Check(userDir, "Firefox profiles", absent)
+		return nil
+	}}
+}
+
+func TestCoverageRecordsPresentAndAbsentPaths(t *testing.T) {
+	profile := t.TempDir()
+	present := filepath.Join(profile, "History")
+	if err := os.WriteFile(present, []byte("SQLite format 3\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	absent := filepath.Join(profile, "Mozilla", "Firefox", "Profiles")
+
+	run := newTestRun(t, 1)
+	run.SetCoverage(true)
+	run.Register(probingModule(present, absent))
+	run.Register(&fakeModule{name: "sysinfo"})
+	if _, err := run.CollectAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(run.artifactsDir, "windows_browser", CoverageReportName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report CoverageReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	want := []coverage.Probe{
+		{Target: "Edge History", Path: present, Outcome: coverage.Found},
+		{Target: "Firefox profiles", Path: absent, Outcome: coverage.Absent},
+	}
+	if report.Module != "windows/browser" || !reflect.DeepEqual(report.Probes, want) {
+		t.Fatalf("report = %+v", report)
+	}
+	if want := map[string]int{coverage.Found: 1, coverage.Absent: 1}; !reflect.DeepEqual(report.Outcomes, want) {
+		t.Fatalf("outcomes = %v, want %v", report.Outcomes, want)
+	}
+	// A module that probed nothing gets no report
+	if _, err := os.Stat(filepath.Join(run.artifactsDir, "sysinfo", CoverageReportName)); !os.IsNotExist(err) {
+		t.Errorf("coverage report for a module without probes: %v", err)
+	}
+
+	// Without --coverage nothing is examined or written
+	plain := newTestRun(t, 1)
+	plain.Register(probingModule(present, absent))
+	if _, err := plain.CollectAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(plain.artifactsDir, "windows_browser", CoverageReportName)); !os.IsNotExist(err) {
+		t.Errorf("coverage report written without --coverage: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// Progress event types written with --progress.
+const (
+	EventStarted  = "started"
+	EventFinished = "finished"
+	EventFailed   = "failed"
+	EventSkipped  = "skipped"
+)
+
+// ProgressEvent is one module lifecycle event, written as a single NDJSON
+// line so a wrapping UI can follow a run while it is in progress.
+type ProgressEvent struct {
+	Event      string `json:"event"`
+	Module     string `json:"module"`
+	TimeUTC    string `json:"time_utc"`
+	ElapsedMS  int64  `json:"elapsed_ms"`            // Since the run started
+	DurationMS int64  `json:"duration_ms,omitempty"` // Of the module, once it has ended
+	Items      int    `json:"items"`
+	Error      string `json:"error,omitempty"`
+	Skipped    string `json:"skipped,omitempty"`
+}
+
+// progressEmitter serializes events from the worker pool onto one writer.
+type progressEmitter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	clock   Clock
+	started time.Time
+}
+
+// emit writes one event line. Write errors are ignored: progress output is
+// advisory and must never fail a collection.
+func (e *progressEmitter) emit(event ProgressEvent) {
+	if e == nil {
+		return
+	}
+	now := e.clock.Now().UTC()
+	event.TimeUTC = winutil.FormatTime(now)
+	event.ElapsedMS = now.Sub(e.started).Milliseconds()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(data)
+}
+
+// moduleStarted reports that a module has begun collecting.
+func (e *progressEmitter) moduleStarted(name string) {
+	e.emit(ProgressEvent{Event: EventStarted, Module: name})
+}
+
+// moduleEnded reports how a module's result came out.
+func (e *progressEmitter) moduleEnded(result Result) {
+	event := ProgressEvent{
+		Event:   EventFinished,
+		Module:  result.Module,
+		Items:   result.Items,
+		Error:   result.Error,
+		Skipped: result.Skipped,
+	}
+	switch {
+	case result.Skipped != "":
+		event.Event = EventSkipped
+	case !result.OK:
+		event.Event = EventFailed
+	}
+	if result.EndedAt.After(result.StartedAt) {
+		event.DurationMS = result.EndedAt.Sub(result.StartedAt).Milliseconds()
+	}
+	e.emit(event)
+}
+
+// countItems returns the number of items in a module's manifest, or the
+// number of files it wrote when it has no manifest.
+func countItems(moduleDir string) int {
+	if data, err := os.ReadFile(filepath.Join(moduleDir, moduleManifestName)); err == nil {
+		var parsed moduleManifestItems
+		if json.Unmarshal(data, &parsed) == nil && parsed.Items != nil {
+			return len(parsed.Items)
+		}
+	}
+
+	count := 0
+	filepath.WalkDir(moduleDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			count++
+		}
+		return nil
+	})
+	return count
+}
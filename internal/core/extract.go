@@ -0,0 +1,473 @@
+package core
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/klauspost/compress/zstd"
+)
+
+// archivePrefix is the directory every entry is stored under in an archive.
+const archivePrefix = "artifacts/"
+
+// ageHeader is the first line of a binary age file.
+var ageHeader = []byte("age-encryption.org/v1")
+
+// ArchiveEntry is a regular file stored in an archive.
+type ArchiveEntry struct {
+	Path        string `json:"path"` // Slash-separated path relative to the artifacts directory
+	Size        int64  `json:"size"`
+	DuplicateOf string `json:"duplicate_of,omitempty"` // Stored as a link to this identical file
+}
+
+// ArchiveModule summarizes the files a single module directory contributed to an archive.
+type ArchiveModule struct {
+	Module string `json:"module"` // Top-level directory; "" for files at the artifacts root
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// ArchiveListing is the content of an archive as reported by extract --list.
+type ArchiveListing struct {
+	Archive    string          `json:"archive"`
+	Encrypted  bool            `json:"encrypted"`
+	FileCount  int             `json:"file_count"`
+	TotalBytes int64           `json:"total_bytes"`
+	Modules    []ArchiveModule `json:"modules"`
+	Files      []ArchiveEntry  `json:"files"`
+}
+
+// ExtractReport describes a selective extraction and the hash checks made on it.
+type ExtractReport struct {
+	Archive       string   `json:"archive"`
+	OutDir        string   `json:"out_dir"`
+	Modules       []string `json:"modules"`
+	Extracted     int      `json:"extracted"`
+	Bytes         int64    `json:"bytes"`
+	Verified      int      `json:"verified"`
+	Mismatched    []string `json:"mismatched"` // Hash or size differs from collection_manifest.json
+	Unlisted      []string `json:"unlisted"`   // Not present in collection_manifest.json
+	ManifestFound bool     `json:"manifest_found"`
+	Hashing       string   `json:"hashing,omitempty"`    // "disabled" when only sizes could be compared
+	Unresolved    []string `json:"unresolved,omitempty"` // Deduplicated entries whose linked content is not in the archive
+}
+
+// OK reports whether every extracted file matched the manifest.
+func (r *ExtractReport) OK() bool {
+	return r.ManifestFound && len(r.Mismatched) == 0 && len(r.Unlisted) == 0 && len(r.Unresolved) == 0
+}
+
+// LoadAgeIdentities reads X25519 identities from an age identity file, as
+// written by age-keygen, or the identity of an unencrypted OpenSSH private
+// key, for archives encrypted with --encrypt-ssh.
+func LoadAgeIdentities(path string) ([]age.Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity file: %w", err)
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		identity, err := agessh.ParseIdentity(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH identity file %s: %w", path, err)
+		}
+		return []age.Identity{identity}, nil
+	}
+
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity file %s: %w", path, err)
+	}
+	return identities, nil
+}
+
+// ModuleDir returns the top-level artifacts directory a module name or
+// directory refers to, e.g. "windows/registry" -> "windows_registry".
+func ModuleDir(module string) string {
+	return SanitizeName(strings.Trim(module, "/"))
+}
+
+// ListArchive reads an archive and reports its files and per-module sizes
+// without extracting anything.
+func ListArchive(ctx context.Context, archivePath string, identities []age.Identity) (*ArchiveListing, error) {
+	listing := &ArchiveListing{
+		Archive: archivePath,
+		Modules: make([]ArchiveModule, 0),
+		Files:   make([]ArchiveEntry, 0),
+	}
+
+	byModule := make(map[string]*ArchiveModule)
+	sizes := make(map[string]int64)
+	encrypted, err := walkArchive(ctx, archivePath, identities, func(relPath string, header *tar.Header, _ io.Reader) error {
+		// A deduplicated file is listed with the size it extracts to
+		entry := ArchiveEntry{Path: relPath, Size: header.Size}
+		if header.Typeflag == tar.TypeLink {
+			target, err := archiveRelPath(header.Linkname)
+			if err != nil {
+				return err
+			}
+			entry.Size = sizes[target]
+			entry.DuplicateOf = target
+		}
+		sizes[relPath] = entry.Size
+		listing.Files = append(listing.Files, entry)
+		listing.FileCount++
+		listing.TotalBytes += entry.Size
+
+		module := topLevelDir(relPath)
+		summary, ok := byModule[module]
+		if !ok {
+			summary = &ArchiveModule{Module: module}
+			byModule[module] = summary
+		}
+		summary.Files++
+		summary.Bytes += entry.Size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	listing.Encrypted = encrypted
+
+	for _, summary := range byModule {
+		listing.Modules = append(listing.Modules, *summary)
+	}
+	sort.Slice(listing.Modules, func(i, j int) bool { return listing.Modules[i].Module < listing.Modules[j].Module })
+
+	return listing, nil
+}
+
+// ExtractArchive streams an archive once and writes the entries under the
+// requested module directories to outDir, or every entry when no module is
+// requested. Each extracted file is hashed
+// as it is written and checked against the root manifest (JSON or
+// MessagePack), which is always extracted too. Entries seen before the
+// manifest are checked once it is read.
+func ExtractArchive(ctx context.Context, archivePath, outDir string, modules []string, identities []age.Identity) (*ExtractReport, error) {
+	report := &ExtractReport{
+		Archive:    archivePath,
+		OutDir:     outDir,
+		Modules:    modules,
+		Mismatched: make([]string, 0),
+		Unlisted:   make([]string, 0),
+	}
+
+	if report.Modules == nil {
+		report.Modules = make([]string, 0)
+	}
+	all := len(modules) == 0
+	wanted := make(map[string]bool, len(modules))
+	for _, module := range modules {
+		wanted[ModuleDir(module)] = true
+	}
+
+	var expected map[string]ManifestEntry
+	pending := make([]ManifestEntry, 0)
+	check := func(got ManifestEntry) {
+		want, ok := expected[got.Path]
+		switch {
+		case !ok:
+			report.Unlisted = append(report.Unlisted, got.Path)
+		case want.Size != got.Size || (want.SHA256 != "" && want.SHA256 != got.SHA256):
+			report.Mismatched = append(report.Mismatched, got.Path)
+		default:
+			report.Verified++
+		}
+	}
+
+	record := func(relPath string, size int64, sha256Hex string) {
+		report.Extracted++
+		report.Bytes += size
+		got := ManifestEntry{Path: relPath, Size: size, SHA256: sha256Hex}
+		if expected == nil {
+			pending = append(pending, got)
+		} else {
+			check(got)
+		}
+	}
+
+	// Duplicates stored as hard links by --dedup are rehydrated as full
+	// copies. Links whose target lies outside the requested modules wait for
+	// a second pass over the archive.
+	extracted := make(map[string]bool)
+	unresolved := make(map[string][]archiveLink)
+	_, err := walkArchive(ctx, archivePath, identities, func(relPath string, header *tar.Header, body io.Reader) error {
+		isManifest := relPath == CollectionManifestName || relPath == CollectionManifestMsgpackName
+		isSchema := relPath == CollectionManifestSchemaName
+		if !all && !isManifest && !isSchema && !wanted[topLevelDir(relPath)] {
+			return nil
+		}
+
+		if header.Typeflag == tar.TypeLink {
+			target, err := archiveRelPath(header.Linkname)
+			if err != nil {
+				return err
+			}
+			if !extracted[target] {
+				unresolved[target] = append(unresolved[target], archiveLink{relPath: relPath, header: header})
+				return nil
+			}
+			size, sha256Hex, err := copyExtracted(outDir, target, relPath, header)
+			if err != nil {
+				return err
+			}
+			record(relPath, size, sha256Hex)
+			return nil
+		}
+
+		var manifestData bytes.Buffer
+		var copyTo io.Writer
+		if isManifest {
+			copyTo = &manifestData
+		}
+		size, sha256Hex, err := extractFile(outDir, relPath, header, body, copyTo)
+		if err != nil {
+			return err
+		}
+
+		if isSchema {
+			return nil
+		}
+		if isManifest {
+			manifest, err := DecodeCollectionManifest(manifestData.Bytes())
+			if err != nil {
+				return fmt.Errorf("failed to parse collection manifest: %w", err)
+			}
+			expected = make(map[string]ManifestEntry, len(manifest.Files))
+			for _, entry := range manifest.Files {
+				expected[entry.Path] = entry
+			}
+			report.ManifestFound = true
+			report.Hashing = manifest.Hashing
+			for _, entry := range pending {
+				check(entry)
+			}
+			pending = nil
+			return nil
+		}
+
+		extracted[relPath] = true
+		record(relPath, size, sha256Hex)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if len(unresolved) > 0 {
+		_, err := walkArchive(ctx, archivePath, identities, func(relPath string, header *tar.Header, body io.Reader) error {
+			links, ok := unresolved[relPath]
+			if !ok || header.Typeflag != tar.TypeReg {
+				return nil
+			}
+			delete(unresolved, relPath)
+
+			first := links[0].relPath
+			size, sha256Hex, err := extractFile(outDir, first, links[0].header, body, nil)
+			if err != nil {
+				return err
+			}
+			record(first, size, sha256Hex)
+			for _, link := range links[1:] {
+				size, sha256Hex, err := copyExtracted(outDir, first, link.relPath, link.header)
+				if err != nil {
+					return err
+				}
+				record(link.relPath, size, sha256Hex)
+			}
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+		for _, links := range unresolved {
+			for _, link := range links {
+				report.Unresolved = append(report.Unresolved, link.relPath)
+			}
+		}
+		sort.Strings(report.Unresolved)
+	}
+
+	if !report.ManifestFound {
+		// Nothing to verify against; report every extracted file as unlisted
+		for _, entry := range pending {
+			report.Unlisted = append(report.Unlisted, entry.Path)
+		}
+	}
+	sort.Strings(report.Mismatched)
+	sort.Strings(report.Unlisted)
+
+	return report, nil
+}
+
+// archiveLink is a hard link entry waiting for the file it links to.
+type archiveLink struct {
+	relPath string
+	header  *tar.Header
+}
+
+// extractFile writes an archive entry's body to its path under outDir, also
+// copying it to copyTo when set, and returns its size and SHA-256.
+func extractFile(outDir, relPath string, header *tar.Header, body io.Reader, copyTo io.Writer) (int64, string, error) {
+	destPath := filepath.Join(outDir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return 0, "", fmt.Errorf("failed to create directory for %s: %w", relPath, err)
+	}
+
+	hasher := sha256.New()
+	writers := []io.Writer{hasher}
+	if copyTo != nil {
+		writers = append(writers, copyTo)
+	}
+
+	file, err := os.Create(destPath)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create %s: %w", destPath, err)
+	}
+	size, err := io.Copy(io.MultiWriter(append(writers, file)...), body)
+	closeErr := file.Close()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to extract %s: %w", relPath, err)
+	}
+	if closeErr != nil {
+		return 0, "", fmt.Errorf("failed to close %s: %w", destPath, closeErr)
+	}
+	os.Chtimes(destPath, header.ModTime, header.ModTime)
+
+	return size, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// copyExtracted rehydrates a deduplicated entry by copying the already
+// extracted file it links to.
+func copyExtracted(outDir, target, relPath string, header *tar.Header) (int64, string, error) {
+	source, err := os.Open(filepath.Join(outDir, filepath.FromSlash(target)))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open link target %s: %w", target, err)
+	}
+	defer source.Close()
+
+	return extractFile(outDir, relPath, header, source, nil)
+}
+
+// walkArchive decrypts and decompresses an archive and calls fn for each
+// regular file or hard link with its path relative to the artifacts directory. It reports
+// whether the archive was age-encrypted.
+func walkArchive(ctx context.Context, archivePath string, identities []age.Identity, fn func(relPath string, header *tar.Header, body io.Reader) error) (bool, error) {
+	file, err := openArchiveFile(archivePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	tarReader, encrypted, err := openArchiveReader(file, identities)
+	if err != nil {
+		return encrypted, err
+	}
+
+	for {
+		// Check for context cancellation
+		select {
+		case <-ctx.Done():
+			return encrypted, ctx.Err()
+		default:
+		}
+
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return encrypted, nil
+		}
+		if err != nil {
+			return encrypted, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeLink {
+			continue
+		}
+
+		relPath, err := archiveRelPath(header.Name)
+		if err != nil {
+			return encrypted, err
+		}
+		if err := fn(relPath, header, tarReader); err != nil {
+			return encrypted, err
+		}
+	}
+}
+
+// zstdMagic starts every zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// openArchiveReader composes the reader stack matching buildArchiveWriter:
+// age decryption when the stream starts with an age header, then gzip or
+// zstd as the decrypted stream's magic says, then tar.
+func openArchiveReader(src io.Reader, identities []age.Identity) (*tar.Reader, bool, error) {
+	buffered := bufio.NewReader(src)
+	encrypted := false
+
+	r := buffered
+	if head, _ := buffered.Peek(len(ageHeader)); bytes.Equal(head, ageHeader) {
+		encrypted = true
+		if len(identities) == 0 {
+			return nil, encrypted, fmt.Errorf("archive is age-encrypted; --identity is required")
+		}
+		decrypted, err := age.Decrypt(buffered, identities...)
+		if err != nil {
+			return nil, encrypted, fmt.Errorf("failed to decrypt archive: %w", err)
+		}
+		r = bufio.NewReader(decrypted)
+	}
+
+	if head, _ := r.Peek(len(zstdMagic)); bytes.Equal(head, zstdMagic) {
+		// A single-threaded decoder runs no goroutines that would need closing
+		zstdReader, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, encrypted, fmt.Errorf("failed to open zstd stream: %w", err)
+		}
+		return tar.NewReader(zstdReader), encrypted, nil
+	}
+
+	gzReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, encrypted, fmt.Errorf("failed to open gzip stream: %w", err)
+	}
+
+	return tar.NewReader(gzReader), encrypted, nil
+}
+
+// archiveRelPath strips the artifacts/ prefix from a tar entry name and
+// rejects names that would escape the extraction directory.
+func archiveRelPath(name string) (string, error) {
+	if !strings.HasPrefix(name, archivePrefix) {
+		return "", fmt.Errorf("unexpected archive entry %q outside %s", name, archivePrefix)
+	}
+	relPath := strings.TrimPrefix(name, archivePrefix)
+	clean := path.Clean(relPath)
+	if relPath == "" || clean != relPath || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(clean, `\`) {
+		return "", fmt.Errorf("unsafe archive entry %q", name)
+	}
+	return clean, nil
+}
+
+// topLevelDir returns the first path segment of a relative path, or "" for a
+// file at the root.
+func topLevelDir(relPath string) string {
+	dir, _, found := strings.Cut(relPath, "/")
+	if !found {
+		return ""
+	}
+	return dir
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// extractTestFiles is a collection with several module directories.
+var extractTestFiles = map[string]string{
+	"windows_registry/SYSTEM":          strings.Repeat("regf", 2048),
+	"windows_registry/manifest.json":   `{"module":"windows/registry"}`,
+	"windows_evtx/Security.evtx":       strings.Repeat("ElfFile", 1024),
+	"windows_prefetch/CMD.EXE-1A2B.pf": "MAM\x04",
+	"tool_info.json":                   `{"version":"test"}`,
+}
+
+// bundleTestCollection archives dir without encryption and returns the archive path.
+func bundleTestCollection(t *testing.T, dir string) string {
+	t.Helper()
+	meta, err := BundleAndMaybeEncrypt(context.Background(), dir, t.TempDir(), "host", testTimestamp, ArchiveEncryption{}, ArchiveCompression{}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return meta.Path
+}
+
+func TestExtractArchiveSelectsModules(t *testing.T) {
+	archive := bundleTestCollection(t, newTestCollection(t, extractTestFiles))
+	outDir := t.TempDir()
+	report, err := ExtractArchive(context.Background(), archive, outDir, []string{"windows/registry", "windows_prefetch/"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Extracted != 3 || report.Verified != 3 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	var got []string
+	err = filepath.WalkDir(outDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(outDir, path)
+		got = append(got, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The root manifest always comes along so the files can be checked again later
+	want := []string{CollectionManifestName, "windows_prefetch/CMD.EXE-1A2B.pf", "windows_registry/SYSTEM", "windows_registry/manifest.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("extracted %v, want %v", got, want)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "windows_registry", "SYSTEM"))
+	if err != nil || string(data) != extractTestFiles["windows_registry/SYSTEM"] {
+		t.Fatalf("SYSTEM extracted with different content: %v", err)
+	}
+
+	listing, err := ListArchive(context.Background(), archive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listing.Encrypted || listing.FileCount != len(extractTestFiles)+1 {
+		t.Fatalf("listing = %+v", listing)
+	}
+	var registry ArchiveModule
+	for _, module := range listing.Modules {
+		if module.Module == "windows_registry" {
+			registry = module
+		}
+	}
+	if registry.Files != 2 || registry.Bytes != int64(len(extractTestFiles["windows_registry/SYSTEM"])+len(extractTestFiles["windows_registry/manifest.json"])) {
+		t.Errorf("windows_registry listing = %+v", registry)
+	}
+}
+
+func TestExtractArchiveReportsCorruptedEntry(t *testing.T) {
+	dir := newTestCollection(t, extractTestFiles)
+	// Same size, different content: only the hash tells them apart
+	if err := os.WriteFile(filepath.Join(dir, "windows_evtx", "Security.evtx"), []byte(strings.Repeat("ElfFilf", 1024)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "windows_evtx", "dropped.txt"), []byte("added after hashing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archive := bundleTestCollection(t, dir)
+
+	report, err := ExtractArchive(context.Background(), archive, t.TempDir(), []string{"windows/evtx"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() {
+		t.Fatalf("corrupted entry verified: %+v", report)
+	}
+	if !reflect.DeepEqual(report.Mismatched, []string{"windows_evtx/Security.evtx"}) || !reflect.DeepEqual(report.Unlisted, []string{"windows_evtx/dropped.txt"}) {
+		t.Fatalf("mismatched %v, unlisted %v", report.Mismatched, report.Unlisted)
+	}
+
+	// The untouched modules still verify on their own
+	report, err = ExtractArchive(context.Background(), archive, t.TempDir(), []string{"windows/registry"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Verified != 2 {
+		t.Fatalf("unaffected module did not verify: %+v", report)
+	}
+}
+
+func TestExtractArchiveRejectsUnsafeEntry(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "crafted.tar.gz")
+	file, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	body := "escaped"
+	if err := tw.WriteHeader(&tar.Header{Name: archivePrefix + "../../evil.txt", Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte(body))
+	tw.Close()
+	gz.Close()
+	file.Close()
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, err := ExtractArchive(context.Background(), archive, outDir, nil, nil); err == nil || !strings.Contains(err.Error(), "unsafe archive entry") {
+		t.Fatalf("ExtractArchive = %v, want an unsafe entry error", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(outDir), "evil.txt")); !os.IsNotExist(err) {
+		t.Fatalf("entry written outside the output directory: %v", err)
+	}
+}
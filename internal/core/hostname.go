@@ -0,0 +1,208 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// Sources of the registry names recorded in HostNames.
+const (
+	HostNameSourceRegistry = "registry"    // reg query on the live system
+	HostNameSourceHive     = "system_hive" // SYSTEM hive of the --root image
+)
+
+// Registry keys naming the computer, under HKLM\SYSTEM on the live system and
+// under the current control set in a SYSTEM hive file.
+const (
+	activeComputerNameKey = `Control\ComputerName\ActiveComputerName`
+	computerNameKey       = `Control\ComputerName\ComputerName`
+	tcpipParametersKey    = `Services\Tcpip\Parameters`
+)
+
+// HostNames are the names of the collection target. Hostname is the one used
+// in the archive file name and manifests: the --hostname override, else the
+// computer name of a --root image, else the short name of the running system.
+type HostNames struct {
+	Hostname     string `json:"hostname"`
+	Override     bool   `json:"override,omitempty"`      // Hostname came from --hostname
+	ShortName    string `json:"short_name"`              // Name the collecting system reports
+	ComputerName string `json:"computer_name,omitempty"` // NetBIOS name, from ComputerName
+	DNSHostname  string `json:"dns_hostname,omitempty"`  // Tcpip\Parameters Hostname
+	Domain       string `json:"domain,omitempty"`        // Primary DNS suffix, Tcpip\Parameters Domain
+	FQDN         string `json:"fqdn,omitempty"`
+	Source       string `json:"source,omitempty"` // Where the registry names were read
+	Error        string `json:"error,omitempty"`  // Why the registry names could not be read
+}
+
+// AssembleFQDN joins a host name and its primary DNS suffix. A host without a
+// domain has no fully qualified name.
+func AssembleFQDN(host, domain string) string {
+	host = strings.Trim(strings.TrimSpace(host), ".")
+	domain = strings.Trim(strings.TrimSpace(domain), ".")
+	if host == "" || domain == "" {
+		return ""
+	}
+	if strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(domain)) {
+		return host
+	}
+	return host + "." + domain
+}
+
+// setRegistryNames records the names read from the registry. The DNS host
+// name is preferred over the NetBIOS name for the FQDN, since NetBIOS names
+// are truncated to 15 characters.
+func (h *HostNames) setRegistryNames(computerName, dnsHostname, domain, source string) {
+	h.ComputerName = strings.TrimSpace(computerName)
+	h.DNSHostname = strings.TrimSpace(dnsHostname)
+	h.Domain = strings.Trim(strings.TrimSpace(domain), ".")
+	h.Source = source
+	host := h.DNSHostname
+	if host == "" {
+		host = h.ComputerName
+	}
+	h.FQDN = AssembleFQDN(host, h.Domain)
+}
+
+// hostNamesFromRegQuery picks the computer name, DNS host name, and domain
+// out of `reg query` output for the ActiveComputerName and Tcpip\Parameters
+// keys.
+func hostNamesFromRegQuery(keys []winutil.RegKey) (string, string, string) {
+	var computerName, dnsHostname, domain string
+	for _, key := range keys {
+		path := strings.ToLower(key.Path)
+		values := make(map[string]string)
+		for _, v := range key.Values {
+			values[strings.ToLower(v.Name)] = strings.TrimSpace(v.Data)
+		}
+		switch {
+		case strings.HasSuffix(path, strings.ToLower(activeComputerNameKey)):
+			computerName = values["computername"]
+		case strings.HasSuffix(path, strings.ToLower(tcpipParametersKey)):
+			dnsHostname = firstNonEmpty(values["hostname"], values["nv hostname"])
+			domain = firstNonEmpty(values["domain"], values["nv domain"])
+		}
+	}
+	return computerName, dnsHostname, domain
+}
+
+// hostNamesFromHive reads the computer name, DNS host name, and domain from
+// the current control set of a SYSTEM hive. The hive file has no
+// ActiveComputerName, which only exists while Windows runs, so the
+// configured ComputerName is used.
+func hostNamesFromHive(system *regf.Hive) (string, string, string, error) {
+	controlSet, err := hiveCurrentControlSet(system)
+	if err != nil {
+		return "", "", "", err
+	}
+	read := func(keyPath string, names ...string) string {
+		key, err := system.OpenKey(controlSet + `\` + keyPath)
+		if err != nil {
+			return ""
+		}
+		for _, name := range names {
+			if value, err := key.Value(name); err == nil {
+				if s := strings.TrimSpace(value.String()); s != "" {
+					return s
+				}
+			}
+		}
+		return ""
+	}
+	return read(computerNameKey, "ComputerName"),
+		read(tcpipParametersKey, "Hostname", "NV Hostname"),
+		read(tcpipParametersKey, "Domain", "NV Domain"),
+		nil
+}
+
+// hiveCurrentControlSet returns the ControlSet00N key name that Select\Current
+// points at; a hive file has no CurrentControlSet link.
+func hiveCurrentControlSet(system *regf.Hive) (string, error) {
+	key, err := system.OpenKey("Select")
+	if err != nil {
+		return "", fmt.Errorf("failed to open Select key: %w", err)
+	}
+	value, err := key.Value("Current")
+	if err != nil {
+		return "", fmt.Errorf("failed to read Select\\Current: %w", err)
+	}
+	current, ok := value.Uint64()
+	if !ok || current == 0 {
+		return "", fmt.Errorf("invalid Select\\Current value")
+	}
+	return fmt.Sprintf("ControlSet%03d", current), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ValidateHostnameOverride checks that a --hostname value can name an
+// archive file: letters, digits, dots, hyphens, and underscores only.
+func ValidateHostnameOverride(name string) error {
+	if name == "" {
+		return fmt.Errorf("host name is empty")
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return fmt.Errorf("host name %q may only contain letters, digits, '.', '-', and '_'", name)
+		}
+	}
+	return nil
+}
+
+// ResolveHostNames gathers the names of the collection target: the short
+// name the running system reports, and the computer name, DNS host name,
+// domain, and FQDN from the registry of the live system or, under --root,
+// from the image's SYSTEM hive. A non-empty override becomes Hostname.
+func ResolveHostNames(ctx context.Context, override string) *HostNames {
+	names := &HostNames{ShortName: "unknown"}
+	if short, err := winutil.Hostname(ctx); err == nil && short != "" {
+		names.ShortName = short
+	}
+
+	if winutil.IsOffline() {
+		hivePath := filepath.Join(winutil.SystemRoot(), "System32", "config", "SYSTEM")
+		system, err := regf.Open(hivePath)
+		if err == nil {
+			var computerName, dnsHostname, domain string
+			computerName, dnsHostname, domain, err = hostNamesFromHive(system)
+			system.Close()
+			if err == nil {
+				names.setRegistryNames(computerName, dnsHostname, domain, HostNameSourceHive)
+			}
+		}
+		if err != nil {
+			names.Error = err.Error()
+		}
+	} else {
+		computerName, dnsHostname, domain, err := readLiveHostNames(ctx)
+		if err == nil {
+			names.setRegistryNames(computerName, dnsHostname, domain, HostNameSourceRegistry)
+		} else if !errors.Is(err, errors.ErrUnsupported) {
+			names.Error = err.Error()
+		}
+	}
+
+	switch {
+	case override != "":
+		names.Hostname = override
+		names.Override = true
+	case winutil.IsOffline() && names.ComputerName != "":
+		// The collecting system's own name does not identify an image
+		names.Hostname = names.ComputerName
+	default:
+		names.Hostname = names.ShortName
+	}
+	return names
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// readLiveHostNames is not implemented off Windows, which has no registry.
+func readLiveHostNames(ctx context.Context) (string, string, string, error) {
+	return "", "", "", errors.ErrUnsupported
+}
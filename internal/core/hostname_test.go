@@ -0,0 +1,172 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+	"cryptkeeper/internal/winutil"
+)
+
+func TestAssembleFQDN(t *testing.T) {
+	for _, tt := range []struct{ host, domain, want string }{
+		{"WS-0142", "corp.example.com", "WS-0142.corp.example.com"},
+		{"ws-0142", " corp.example.com. ", "ws-0142.corp.example.com"},
+		{"WS-0142.corp.example.com", "CORP.EXAMPLE.COM", "WS-0142.corp.example.com"},
+		{"WS-0142", "", ""},
+		{"", "corp.example.com", ""},
+	} {
+		if got := AssembleFQDN(tt.host, tt.domain); got != tt.want {
+			t.Errorf("AssembleFQDN(%q, %q) = %q, want %q", tt.host, tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestHostNamesFromRegQuery(t *testing.T) {
+	output := []byte("\r\n" +
+		"HKEY_LOCAL_MACHINE\\SYSTEM\\CurrentControlSet\\Control\\ComputerName\\ActiveComputerName\r\n" +
+		"    ComputerName    REG_SZ    FINANCE-LAPTOP-\r\n" +
+		"\r\n" +
+		"HKEY_LOCAL_MACHINE\\SYSTEM\\CurrentControlSet\\Services\\Tcpip\\Parameters\r\n" +
+		"    NV Hostname    REG_SZ    finance-laptop-0142\r\n" +
+		"    Domain    REG_SZ    \r\n" +
+		"    NV Domain    REG_SZ    corp.example.com\r\n" +
+		"    EnableICMPRedirect    REG_DWORD    0x1\r\n")
+	computerName, dnsHostname, domain := hostNamesFromRegQuery(winutil.ParseRegQuery(output))
+	if computerName != "FINANCE-LAPTOP-" || dnsHostname != "finance-laptop-0142" || domain != "corp.example.com" {
+		t.Fatalf("names = %q, %q, %q", computerName, dnsHostname, domain)
+	}
+
+	// The NetBIOS name is cut at 15 characters, so the DNS name makes the FQDN
+	var names HostNames
+	names.setRegistryNames(computerName, dnsHostname, domain, HostNameSourceRegistry)
+	if names.FQDN != "finance-laptop-0142.corp.example.com" || names.Source != HostNameSourceRegistry {
+		t.Fatalf("names = %+v", names)
+	}
+	names.setRegistryNames("WS-0142", "", "corp.example.com.", HostNameSourceRegistry)
+	if names.FQDN != "WS-0142.corp.example.com" || names.Domain != "corp.example.com" {
+		t.Fatalf("names without a DNS host name = %+v", names)
+	}
+}
+
+// systemHive builds the SYSTEM hive of a domain-joined workstation named
+// computerName whose current control set is ControlSet002.
+func systemHive(computerName string) *regftest.Key {
+	return &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Select", Values: []regftest.Value{regftest.DWORD("Current", 2)}},
+		regftest.Path(`ControlSet001\Control\ComputerName`, &regftest.Key{Name: "ComputerName", Values: []regftest.Value{
+			regftest.String("ComputerName", "OLD-NAME"),
+		}}),
+		{Name: "ControlSet002", Subkeys: []*regftest.Key{
+			regftest.Path(`Control\ComputerName`, &regftest.Key{Name: "ComputerName", Values: []regftest.Value{
+				regftest.String("ComputerName", computerName),
+			}}),
+			regftest.Path(`Services\Tcpip`, &regftest.Key{Name: "Parameters", Values: []regftest.Value{
+				regftest.String("Hostname", ""),
+				regftest.String("NV Hostname", strings.ToLower(computerName)),
+				regftest.String("Domain", "corp.example.com"),
+			}}),
+		}},
+	}}
+}
+
+func TestHostNamesFromHive(t *testing.T) {
+	system, err := regf.Open(regftest.WriteFile(t, "SYSTEM", systemHive("WS-0142")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer system.Close()
+	computerName, dnsHostname, domain, err := hostNamesFromHive(system)
+	if err != nil || computerName != "WS-0142" || dnsHostname != "ws-0142" || domain != "corp.example.com" {
+		t.Fatalf("names = %q, %q, %q, %v", computerName, dnsHostname, domain, err)
+	}
+
+	empty, err := regf.Open(regftest.WriteFile(t, "SYSTEM", &regftest.Key{Name: "ROOT"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Close()
+	if _, _, _, err := hostNamesFromHive(empty); err == nil || !strings.Contains(err.Error(), "Select") {
+		t.Fatalf("hive without Select = %v", err)
+	}
+}
+
+// withShortName returns a context in which the collecting system reports name.
+func withShortName(name string) context.Context {
+	return winutil.WithCollectSettings(context.Background(), &winutil.CollectSettings{
+		Hostname: func() (string, error) { return name, nil },
+		Getenv:   func(string) string { return "" },
+	})
+}
+
+func TestResolveHostNamesOfAnImage(t *testing.T) {
+	ctx := withShortName("EXAMINER-07")
+	root := t.TempDir()
+	// SystemRoot joins the root and Windows with a backslash, which is part of
+	// the directory name off Windows
+	config := filepath.Join(root+`\Windows`, "System32", "config")
+	if err := os.MkdirAll(config, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(regftest.WriteFile(t, "SYSTEM", systemHive("WS-0142")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config, "SYSTEM"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	winutil.SetOfflineRoot(root)
+	t.Cleanup(func() { winutil.SetOfflineRoot("") })
+
+	// The examiner's machine does not name the image
+	names := ResolveHostNames(ctx, "")
+	if names.Hostname != "WS-0142" || names.ShortName != "EXAMINER-07" || names.FQDN != "ws-0142.corp.example.com" || names.Source != HostNameSourceHive || names.Override || names.Error != "" {
+		t.Fatalf("names = %+v", names)
+	}
+
+	names = ResolveHostNames(ctx, "WS-0142-CLONE")
+	if names.Hostname != "WS-0142-CLONE" || !names.Override || names.ComputerName != "WS-0142" || names.FQDN != "ws-0142.corp.example.com" {
+		t.Fatalf("names with --hostname = %+v", names)
+	}
+
+	// An image without a readable hive keeps the collecting system's name
+	winutil.SetOfflineRoot(t.TempDir())
+	names = ResolveHostNames(ctx, "")
+	if names.Hostname != "EXAMINER-07" || names.Error == "" || names.FQDN != "" {
+		t.Fatalf("names without a hive = %+v", names)
+	}
+}
+
+func TestHostnameOverrideNamesTheArchive(t *testing.T) {
+	ctx := withShortName("WS-0142")
+	if err := ValidateHostnameOverride("WS-0142-CLONE"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", `..\WS-0142`, "WS 0142", "WS/0142"} {
+		if err := ValidateHostnameOverride(name); err == nil {
+			t.Errorf("ValidateHostnameOverride(%q) accepted", name)
+		}
+	}
+
+	names := ResolveHostNames(ctx, "WS-0142-CLONE")
+	if names.Hostname != "WS-0142-CLONE" || !names.Override || names.ShortName != "WS-0142" {
+		t.Fatalf("names = %+v", names)
+	}
+	dir := newTestCollection(t, defaultTestFiles)
+	meta, err := BundleAndMaybeEncrypt(context.Background(), dir, t.TempDir(), names.Hostname, testTimestamp, ArchiveEncryption{}, ArchiveCompression{Codec: CompressionGzip}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base := filepath.Base(meta.Path); !strings.HasPrefix(base, "cryptkeeper_WS-0142-CLONE_") {
+		t.Fatalf("archive = %s", base)
+	}
+
+	// Without an override the running system's name is used
+	if names := ResolveHostNames(ctx, ""); names.Hostname != "WS-0142" || names.Override {
+		t.Fatalf("names = %+v", names)
+	}
+}
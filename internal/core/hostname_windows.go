@@ -0,0 +1,24 @@
+//go:build windows
+
+package core
+
+import (
+	"context"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// readLiveHostNames queries the computer name, DNS host name, and domain of
+// the running system.
+func readLiveHostNames(ctx context.Context) (string, string, string, error) {
+	var keys []winutil.RegKey
+	for _, key := range []string{activeComputerNameKey, tcpipParametersKey} {
+		output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", `HKLM\SYSTEM\CurrentControlSet\` + key})
+		if err != nil {
+			return "", "", "", err
+		}
+		keys = append(keys, winutil.ParseRegQuery(output)...)
+	}
+	computerName, dnsHostname, domain := hostNamesFromRegQuery(keys)
+	return computerName, dnsHostname, domain, nil
+}
@@ -0,0 +1,398 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// IndexHTMLName and IndexTextName are the files --with-index writes to the
+// artifacts root.
+const (
+	IndexHTMLName = "index.html"
+	IndexTextName = "README.txt"
+)
+
+// maxIndexOutputs caps the files listed per module; the root manifest lists
+// them all.
+const maxIndexOutputs = 25
+
+// findingSummaryKeys are the module summary keys (see schema.Summary) whose
+// counts report findings rather than volume, with the label the index shows
+// for each.
+var findingSummaryKeys = map[string]string{
+	"policy_findings":         "Group Policy findings",
+	"integrity_violations":    "System integrity violations",
+	"control_set_divergences": "Control set divergences",
+	"proxy_findings":          "Proxy and redirection findings",
+}
+
+// IndexInfo is the run information the index opens with.
+type IndexInfo struct {
+	Hostname    string
+	FQDN        string
+	RunID       string
+	Profile     string
+	OfflineRoot string
+	UTCOffset   string // Host time zone offset, e.g. "-05:00"
+	Created     time.Time
+	Interrupted bool
+	IOCMatches  int
+	PEFlagged   int
+}
+
+// IndexModule is one module's row in the index.
+type IndexModule struct {
+	Name        string
+	Dir         string // Output directory relative to the artifacts root
+	Description string
+	Status      string // "ok", "failed", or "skipped"
+	Detail      string // Error or skip reason
+	Files       int
+	Bytes       int64
+	Summary     []IndexCount
+	Outputs     []string // Paths relative to the artifacts root, at most maxIndexOutputs
+	MoreOutputs int      // Files not listed in Outputs
+}
+
+// IndexCount is one module summary count.
+type IndexCount struct {
+	Key   string
+	Count int
+}
+
+// IndexFinding is a count worth a reader's attention, with the file that
+// has the details.
+type IndexFinding struct {
+	Module string
+	Label  string
+	Count  int
+	Link   string
+}
+
+// CollectionIndex is the content of index.html and README.txt.
+type CollectionIndex struct {
+	IndexInfo
+	CreatedUTC   string
+	ManifestName string // Root manifest file, in the format it is written in
+	FileCount    int
+	TotalBytes   int64
+	Modules      []IndexModule
+	Findings     []IndexFinding
+	RunFiles     []string // Files at the artifacts root
+}
+
+// moduleManifestSummary is the part of a module manifest the index reads.
+type moduleManifestSummary struct {
+	Summary map[string]int `json:"summary"`
+}
+
+// BuildCollectionIndex summarizes a collection from its root manifest, the
+// module results, and the summary counts of each module manifest. Modules
+// are listed in result order, whether or not they produced output; format is
+// the format the root manifest will be written in.
+func BuildCollectionIndex(artifactsDir string, manifest *CollectionManifest, format string, results []Result, descriptions map[string]string, info IndexInfo) *CollectionIndex {
+	manifestName := CollectionManifestName
+	if format == ManifestFormatMsgpack {
+		manifestName = CollectionManifestMsgpackName
+	}
+	index := &CollectionIndex{
+		IndexInfo:    info,
+		CreatedUTC:   winutil.FormatTime(info.Created),
+		ManifestName: manifestName,
+		FileCount:    manifest.FileCount,
+		TotalBytes:   manifest.TotalBytes,
+		Modules:      make([]IndexModule, 0, len(results)),
+		Findings:     make([]IndexFinding, 0),
+		RunFiles:     make([]string, 0),
+	}
+
+	byDir := make(map[string]*IndexModule, len(results))
+	summaries := make(map[string]map[string]int, len(results))
+	manifests := make(map[string]string, len(results))
+	for _, result := range results {
+		module := IndexModule{
+			Name:        result.Module,
+			Dir:         SanitizeName(result.Module),
+			Description: descriptions[result.Module],
+			Status:      "ok",
+		}
+		switch {
+		case result.Skipped != "":
+			module.Status = "skipped"
+			module.Detail = result.Skipped
+		case !result.OK:
+			module.Status = "failed"
+			module.Detail = result.Error
+		}
+		index.Modules = append(index.Modules, module)
+	}
+	for i := range index.Modules {
+		byDir[index.Modules[i].Dir] = &index.Modules[i]
+	}
+
+	for _, entry := range manifest.Files {
+		dir, _, nested := strings.Cut(entry.Path, "/")
+		if !nested {
+			index.RunFiles = append(index.RunFiles, entry.Path)
+			continue
+		}
+		module, ok := byDir[dir]
+		if !ok {
+			continue
+		}
+		module.Files++
+		module.Bytes += entry.Size
+		if len(module.Outputs) < maxIndexOutputs {
+			module.Outputs = append(module.Outputs, entry.Path)
+		} else {
+			module.MoreOutputs++
+		}
+
+		if path.Base(entry.Path) == moduleManifestName {
+			summary := readModuleSummary(filepath.Join(artifactsDir, filepath.FromSlash(entry.Path)))
+			if len(summary) == 0 {
+				continue
+			}
+			if summaries[dir] == nil {
+				summaries[dir] = make(map[string]int)
+				manifests[dir] = entry.Path
+			}
+			for key, count := range summary {
+				summaries[dir][key] += count
+			}
+		}
+	}
+
+	if info.IOCMatches > 0 {
+		index.Findings = append(index.Findings, IndexFinding{Label: "Files matching --ioc-hashes", Count: info.IOCMatches, Link: IOCMatchesName})
+	}
+	if info.PEFlagged > 0 {
+		index.Findings = append(index.Findings, IndexFinding{Label: "Executables flagged by --pe-triage", Count: info.PEFlagged, Link: PETriageName})
+	}
+	for i := range index.Modules {
+		module := &index.Modules[i]
+		summary := summaries[module.Dir]
+		for key, count := range summary {
+			module.Summary = append(module.Summary, IndexCount{Key: key, Count: count})
+			if label, ok := findingSummaryKeys[key]; ok && count > 0 {
+				index.Findings = append(index.Findings, IndexFinding{Module: module.Name, Label: label, Count: count, Link: manifests[module.Dir]})
+			}
+		}
+		sort.Slice(module.Summary, func(a, b int) bool { return module.Summary[a].Key < module.Summary[b].Key })
+	}
+	sort.SliceStable(index.Findings, func(i, j int) bool { return index.Findings[i].Count > index.Findings[j].Count })
+
+	return index
+}
+
+// readModuleSummary returns the summary counts of a module manifest, or nil
+// when it cannot be read.
+func readModuleSummary(manifestPath string) map[string]int {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil
+	}
+	var parsed moduleManifestSummary
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil
+	}
+	return parsed.Summary
+}
+
+// WriteCollectionIndex writes index.html and README.txt to the artifacts
+// root. The HTML is a single page with no external assets, and links point
+// into the collection by relative path, so it opens from the extracted
+// archive in any browser.
+func WriteCollectionIndex(artifactsDir string, index *CollectionIndex) error {
+	htmlFile, err := os.Create(filepath.Join(artifactsDir, IndexHTMLName))
+	if err != nil {
+		return err
+	}
+	if err := indexTemplate.Execute(htmlFile, index); err != nil {
+		htmlFile.Close()
+		return fmt.Errorf("failed to render %s: %w", IndexHTMLName, err)
+	}
+	if err := htmlFile.Close(); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(artifactsDir, IndexTextName), []byte(index.text()), 0644)
+}
+
+// text renders the index as plain text for README.txt.
+func (index *CollectionIndex) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cryptkeeper collection of %s\n\n", index.Hostname)
+	for _, field := range index.hostFields() {
+		fmt.Fprintf(&b, "  %-14s %s\n", field[0]+":", field[1])
+	}
+	fmt.Fprintf(&b, "\nFiles are grouped by module, one directory each. %s lists every file\nwith its size and SHA-256; %s has this summary with links.\n", index.ManifestName, IndexHTMLName)
+
+	b.WriteString("\nTop findings\n\n")
+	if len(index.Findings) == 0 {
+		b.WriteString("  None\n")
+	}
+	for _, finding := range index.Findings {
+		label := finding.Label
+		if finding.Module != "" {
+			label = finding.Module + ": " + label
+		}
+		fmt.Fprintf(&b, "  %d  %s (%s)\n", finding.Count, label, finding.Link)
+	}
+
+	b.WriteString("\nModules\n")
+	for _, module := range index.Modules {
+		fmt.Fprintf(&b, "\n  %s [%s]", module.Name, module.Status)
+		if module.Detail != "" {
+			fmt.Fprintf(&b, ": %s", module.Detail)
+		}
+		b.WriteString("\n")
+		if module.Description != "" {
+			fmt.Fprintf(&b, "    %s\n", module.Description)
+		}
+		if module.Files == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "    %s/  %d files, %d bytes\n", module.Dir, module.Files, module.Bytes)
+		for _, count := range module.Summary {
+			fmt.Fprintf(&b, "    %s: %d\n", count.Key, count.Count)
+		}
+	}
+
+	if len(index.RunFiles) > 0 {
+		b.WriteString("\nRun files\n\n")
+		for _, name := range index.RunFiles {
+			fmt.Fprintf(&b, "  %s\n", name)
+		}
+	}
+	return b.String()
+}
+
+// hostFields lists the labelled run details shared by both renderings.
+func (index *CollectionIndex) hostFields() [][2]string {
+	fields := [][2]string{{"Host", index.Hostname}}
+	if index.FQDN != "" {
+		fields = append(fields, [2]string{"FQDN", index.FQDN})
+	}
+	fields = append(fields, [2]string{"Collected", index.CreatedUTC})
+	if index.UTCOffset != "" {
+		fields = append(fields, [2]string{"UTC offset", index.UTCOffset})
+	}
+	if index.RunID != "" {
+		fields = append(fields, [2]string{"Run ID", index.RunID})
+	}
+	if index.Profile != "" {
+		fields = append(fields, [2]string{"Profile", index.Profile})
+	}
+	if index.OfflineRoot != "" {
+		fields = append(fields, [2]string{"Offline root", index.OfflineRoot})
+	}
+	if index.Interrupted {
+		fields = append(fields, [2]string{"Interrupted", "yes; some modules did not finish"})
+	}
+	fields = append(fields, [2]string{"Files", fmt.Sprintf("%d (%d bytes)", index.FileCount, index.TotalBytes)})
+	return fields
+}
+
+// indexHref turns a collection path into a relative link, escaping each
+// path segment so names with spaces or # open the right file.
+func indexHref(relPath string) template.URL {
+	segments := strings.Split(relPath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return template.URL("./" + strings.Join(segments, "/"))
+}
+
+// indexTemplate renders index.html.
+var indexTemplate = template.Must(template.New(IndexHTMLName).Funcs(template.FuncMap{
+	"href":   indexHref,
+	"fields": (*CollectionIndex).hostFields,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>cryptkeeper collection of {{.Hostname}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+.ok { color: #1a7f37; } .failed { color: #cf222e; } .skipped { color: #777; }
+code, .path { font-family: monospace; }
+ul { margin: 0.2em 0; padding-left: 1.2em; }
+</style>
+</head>
+<body>
+<h1>cryptkeeper collection of {{.Hostname}}</h1>
+<table>
+{{- range fields .}}
+<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{- end}}
+</table>
+<p>Files are grouped by module, one directory each. <a href="{{href .ManifestName}}"><code>{{.ManifestName}}</code></a> lists every file with its size and SHA-256.</p>
+
+<h2>Top findings</h2>
+{{- if .Findings}}
+<table>
+<tr><th>Count</th><th>Finding</th><th>Details</th></tr>
+{{- range .Findings}}
+<tr><td>{{.Count}}</td><td>{{if .Module}}{{.Module}}: {{end}}{{.Label}}</td><td><a class="path" href="{{href .Link}}">{{.Link}}</a></td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>None.</p>
+{{- end}}
+
+<h2>Modules</h2>
+<table>
+<tr><th>Module</th><th>Status</th><th>Description</th><th>Files</th><th>Bytes</th></tr>
+{{- range .Modules}}
+<tr><td>{{if .Files}}<a href="#{{.Dir}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td><td class="{{.Status}}">{{.Status}}{{if .Detail}}: {{.Detail}}{{end}}</td><td>{{.Description}}</td><td>{{.Files}}</td><td>{{.Bytes}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Module outputs</h2>
+{{- range .Modules}}{{if .Files}}
+<h3 id="{{.Dir}}"><a class="path" href="{{href .Dir}}/">{{.Dir}}/</a></h3>
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+{{- if .Summary}}
+<ul>
+{{- range .Summary}}
+<li><code>{{.Key}}</code>: {{.Count}}</li>
+{{- end}}
+</ul>
+{{- end}}
+<ul>
+{{- range .Outputs}}
+<li><a class="path" href="{{href .}}">{{.}}</a></li>
+{{- end}}
+{{- if .MoreOutputs}}
+<li>and {{.MoreOutputs}} more</li>
+{{- end}}
+</ul>
+{{- end}}{{end}}
+{{- if .RunFiles}}
+
+<h2>Run files</h2>
+<ul>
+{{- range .RunFiles}}
+<li><a class="path" href="{{href .}}">{{.}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
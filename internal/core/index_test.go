@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectionIndexLinksEveryModule(t *testing.T) {
+	dir := newTestCollection(t, map[string]string{
+		"sysinfo/host.json":                    `{"hostname":"WS-0142"}`,
+		"windows_registry/SYSTEM":              "regf",
+		"windows_registry/manifest.json":       `{"summary":{"hives":1}}`,
+		"windows_prefetch/CMD.EXE-4A81B364.pf": "MAM\x04",
+		"windows_grouppolicy/manifest.json":    `{"summary":{"policy_findings":3}}`,
+		"windows_grouppolicy/Registry.pol":     "PReg",
+		"windows_browser/History #1/places.db": "SQLite format 3",
+		"tool_info.json":                       `{"version":"test"}`,
+	})
+	manifest, err := ReadCollectionManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []Result{
+		{Module: "sysinfo", OK: true},
+		{Module: "windows/registry", OK: true},
+		{Module: "windows/prefetch", OK: true},
+		{Module: "windows/grouppolicy", OK: true},
+		{Module: "windows/browser", OK: true},
+		{Module: "windows/wmi", Error: "access denied"},
+		{Module: "windows/usn", Skipped: "not selected by the profile"},
+	}
+	descriptions := map[string]string{
+		"windows/registry": "Registry hives",
+		"windows/prefetch": "Prefetch files",
+	}
+	index := BuildCollectionIndex(dir, manifest, ManifestFormatJSON, results, descriptions, IndexInfo{Hostname: "WS-0142", Created: testTimestamp})
+	if err := WriteCollectionIndex(dir, index); err != nil {
+		t.Fatal(err)
+	}
+	page, err := os.ReadFile(filepath.Join(dir, IndexHTMLName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readme, err := os.ReadFile(filepath.Join(dir, IndexTextName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	html, text := string(page), string(readme)
+
+	for _, result := range results {
+		if !result.OK {
+			continue
+		}
+		moduleDir := SanitizeName(result.Module)
+		for _, want := range []string{
+			`<a href="#` + moduleDir + `">` + result.Module + `</a>`,
+			`<h3 id="` + moduleDir + `"><a class="path" href="./` + moduleDir + `/">` + moduleDir + `/</a></h3>`,
+		} {
+			if !strings.Contains(html, want) {
+				t.Errorf("index.html does not link %s: missing %s", result.Module, want)
+			}
+		}
+		if !strings.Contains(text, "  "+result.Module+" [ok]") || !strings.Contains(text, "    "+moduleDir+"/  ") {
+			t.Errorf("README.txt does not list %s and its directory", result.Module)
+		}
+	}
+
+	for _, want := range []string{
+		`<td class="failed">failed: access denied</td>`,
+		`<td class="skipped">skipped: not selected by the profile</td>`,
+		`<td>Registry hives</td>`,
+		`href="./windows_browser/History%20%231/places.db"`,
+		`<td>3</td><td>windows/grouppolicy: Group Policy findings</td>`,
+		`href="./collection_manifest.json"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("index.html is missing %s", want)
+		}
+	}
+	// Modules without output are listed but not linked
+	if strings.Contains(html, `id="windows_wmi"`) || strings.Contains(html, `href="#windows_usn"`) {
+		t.Error("index.html links a module that wrote nothing")
+	}
+
+	// The index files are indexed like any other run file once the manifest
+	// is rebuilt
+	rebuilt, err := BuildCollectionManifest(context.Background(), dir, "WS-0142", testRunID, testTimestamp, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for _, entry := range rebuilt.Files {
+		if entry.Path == IndexHTMLName || entry.Path == IndexTextName {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Fatalf("found %d of the index files in the rebuilt manifest", found)
+	}
+}
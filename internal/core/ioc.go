@@ -0,0 +1,154 @@
+package core
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IOCMatchesName is the file name of the IOC match report in the artifacts directory.
+const IOCMatchesName = "ioc_matches.json"
+
+// IOCSeverityHigh marks a collected file whose hash is on the responder's known-bad list.
+const IOCSeverityHigh = "high"
+
+// IOCHashSet holds known-bad hashes loaded from an --ioc-hashes file, keyed by
+// lowercase hex digest with the optional label as the value.
+type IOCHashSet struct {
+	SHA256 map[string]string
+	SHA1   map[string]string
+}
+
+// Len returns the total number of hashes in the set.
+func (s *IOCHashSet) Len() int {
+	return len(s.SHA256) + len(s.SHA1)
+}
+
+// IOCMatch is a collected file whose hash appears in the IOC hash set.
+type IOCMatch struct {
+	Path      string `json:"path"`   // Slash-separated path relative to the artifacts directory
+	Module    string `json:"module"` // Module that collected the file
+	Algorithm string `json:"algorithm"`
+	Hash      string `json:"hash"`
+	Label     string `json:"label,omitempty"`
+	Severity  string `json:"severity"`
+}
+
+// IOCReport is the content of ioc_matches.json.
+type IOCReport struct {
+	CreatedUTC    string     `json:"created_utc"`
+	Host          string     `json:"host"`
+	RunID         string     `json:"run_id,omitempty"`
+	IOCCount      int        `json:"ioc_count"`
+	FilesChecked  int        `json:"files_checked"`
+	SHA1Unmatched int        `json:"sha1_unmatched,omitempty"` // SHA-1 IOCs that could not be checked
+	Matches       []IOCMatch `json:"matches"`
+}
+
+// LoadIOCHashes reads a newline-separated list of SHA-256 or SHA-1 hashes, each
+// optionally followed by ",label". Blank lines and lines starting with # are ignored.
+func LoadIOCHashes(path string) (*IOCHashSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IOC hash file: %w", err)
+	}
+	defer file.Close()
+
+	set := &IOCHashSet{
+		SHA256: make(map[string]string),
+		SHA1:   make(map[string]string),
+	}
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, label, _ := strings.Cut(line, ",")
+		hash = strings.ToLower(strings.TrimSpace(hash))
+		label = strings.TrimSpace(label)
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid hash %q", path, lineNo, hash)
+		}
+
+		switch len(hash) {
+		case 64:
+			set.SHA256[hash] = label
+		case 40:
+			set.SHA1[hash] = label
+		default:
+			return nil, fmt.Errorf("%s:%d: hash %q is neither SHA-256 nor SHA-1", path, lineNo, hash)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read IOC hash file: %w", err)
+	}
+	if set.Len() == 0 {
+		return nil, fmt.Errorf("IOC hash file %s contains no hashes", path)
+	}
+
+	return set, nil
+}
+
+// MatchIOCs checks every file in the collection manifest against the IOC set.
+// modules lists the registered module names so each match can be attributed to
+// the module whose output directory holds the file. The collection manifest records SHA-256 only, so
+// SHA-1 entries are reported as unmatched rather than silently dropped.
+func MatchIOCs(manifest *CollectionManifest, set *IOCHashSet, modules []string) *IOCReport {
+	report := &IOCReport{
+		CreatedUTC:    manifest.CreatedUTC,
+		Host:          manifest.Host,
+		RunID:         manifest.RunID,
+		IOCCount:      set.Len(),
+		FilesChecked:  len(manifest.Files),
+		SHA1Unmatched: len(set.SHA1),
+		Matches:       make([]IOCMatch, 0),
+	}
+
+	moduleByDir := make(map[string]string, len(modules))
+	for _, name := range modules {
+		moduleByDir[SanitizeName(name)] = name
+	}
+
+	for _, entry := range manifest.Files {
+		label, ok := set.SHA256[strings.ToLower(entry.SHA256)]
+		if !ok {
+			continue
+		}
+		dir, _, _ := strings.Cut(entry.Path, "/")
+		module := moduleByDir[dir]
+		if module == "" {
+			module = dir
+		}
+		report.Matches = append(report.Matches, IOCMatch{
+			Path:      entry.Path,
+			Module:    module,
+			Algorithm: "sha256",
+			Hash:      entry.SHA256,
+			Label:     label,
+			Severity:  IOCSeverityHigh,
+		})
+	}
+
+	sort.Slice(report.Matches, func(i, j int) bool { return report.Matches[i].Path < report.Matches[j].Path })
+	return report
+}
+
+// WriteIOCReport writes ioc_matches.json to the root of artifactsDir.
+func WriteIOCReport(artifactsDir string, report *IOCReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal IOC report: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(artifactsDir, IOCMatchesName), data, 0644)
+}
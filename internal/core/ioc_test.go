@@ -0,0 +1,116 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeIOCFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "iocs.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMatchIOCsFindsPlantedFile(t *testing.T) {
+	planted := "MZ\x90\x00 Cobalt Strike beacon stand-in"
+	files := map[string]string{
+		"windows_custompaths/C/Users/Public/svchost.exe": planted,
+		"windows_prefetch/SVCHOST.EXE-1A2B3C4D.pf":       "MAM\x04",
+	}
+	for name, content := range defaultTestFiles {
+		files[name] = content
+	}
+	dir := newTestCollection(t, files)
+	manifest, err := ReadCollectionManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte(planted))
+	hash := hex.EncodeToString(sum[:])
+	iocs := writeIOCFile(t, "# case 4471 hashes\r\n\r\n"+
+		strings.ToUpper(hash)+", beacon loader \r\n"+
+		strings.Repeat("ab", 32)+"\n"+
+		"da39a3ee5e6b4b0d3255bfef95601890afd80709,empty file (SHA-1)\n")
+	set, err := LoadIOCHashes(iocs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Len() != 3 || set.SHA256[hash] != "beacon loader" {
+		t.Fatalf("hash set = %+v", set)
+	}
+
+	report := MatchIOCs(manifest, set, []string{"windows/custompaths", "windows/prefetch"})
+	if report.IOCCount != 3 || report.FilesChecked != len(files) || report.SHA1Unmatched != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	want := IOCMatch{
+		Path:      "windows_custompaths/C/Users/Public/svchost.exe",
+		Module:    "windows/custompaths",
+		Algorithm: "sha256",
+		Hash:      hash,
+		Label:     "beacon loader",
+		Severity:  IOCSeverityHigh,
+	}
+	if len(report.Matches) != 1 || report.Matches[0] != want {
+		t.Fatalf("matches = %+v, want %+v", report.Matches, want)
+	}
+
+	if err := WriteIOCReport(dir, report); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, IOCMatchesName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written IOCReport
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if written.Host != "host" || len(written.Matches) != 1 || written.Matches[0] != want {
+		t.Fatalf("ioc_matches.json = %s", data)
+	}
+
+	// The report is indexed once added to the manifest
+	if err := manifest.AddFile(dir, IOCMatchesName); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCollectionManifest(dir, manifest, ManifestFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	verification, err := VerifyCollection(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verification.OK() || verification.Checked != len(files)+1 {
+		t.Fatalf("collection with the IOC report does not verify: %+v", verification)
+	}
+}
+
+func TestLoadIOCHashesRejectsBadLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"not hex", "not-a-hash,label\n", "iocs.txt:1: invalid hash"},
+		{"md5", "# md5 is not supported\nd41d8cd98f00b204e9800998ecf8427e\n", "iocs.txt:2: hash \"d41d8cd98f00b204e9800998ecf8427e\" is neither SHA-256 nor SHA-1"},
+		{"empty", "# nothing yet\n\n", "contains no hashes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadIOCHashes(writeIOCFile(t, tt.content)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("LoadIOCHashes = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
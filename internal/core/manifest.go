@@ -0,0 +1,451 @@
+// Package core provides the root collection manifest and its tamper-evidence seal.
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// CollectionManifestName is the file name of the root manifest in the artifacts directory.
+const CollectionManifestName = "collection_manifest.json"
+
+// ManifestHMACAlgorithm identifies the MAC recorded in a sealed collection manifest.
+const ManifestHMACAlgorithm = "HMAC-SHA256"
+
+// HashingDisabled is the Hashing value of a manifest built without hashes.
+const HashingDisabled = "disabled"
+
+// ManifestEntry is a single collected file in the root manifest.
+type ManifestEntry struct {
+	Path   string `json:"path"` // Slash-separated path relative to the artifacts directory
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"` // Empty, and written as null, when hashing was disabled
+
+	// DuplicateOf is the path of an identical file whose bytes the archive
+	// stores in place of this one's, set when bundling with --dedup.
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+// MarshalJSON writes a missing hash as null rather than an empty string.
+func (e ManifestEntry) MarshalJSON() ([]byte, error) {
+	var sha256Hex *string
+	if e.SHA256 != "" {
+		sha256Hex = &e.SHA256
+	}
+	return json.Marshal(struct {
+		Path        string  `json:"path"`
+		Size        int64   `json:"size"`
+		SHA256      *string `json:"sha256"`
+		DuplicateOf string  `json:"duplicate_of,omitempty"`
+	}{e.Path, e.Size, sha256Hex, e.DuplicateOf})
+}
+
+// CollectionManifest indexes every file in the artifacts directory. When sealed
+// with an HMAC key it also carries a MAC over the sorted (path, size, sha256)
+// tuples, so any change to a collected file or to the manifest's file list after
+// collection is detectable by anyone holding the key. A manifest built with
+// hashing disabled records sizes only and has Hashing set to HashingDisabled.
+type CollectionManifest struct {
+	CreatedUTC         string          `json:"created_utc"`
+	Host               string          `json:"host"`
+	RunID              string          `json:"run_id,omitempty"`
+	CryptkeeperVersion string          `json:"cryptkeeper_version"`
+	Tool               *BuildInfo      `json:"tool,omitempty"`
+	Hashing            string          `json:"hashing,omitempty"`
+	FileCount          int             `json:"file_count"`
+	TotalBytes         int64           `json:"total_bytes"`
+	Files              []ManifestEntry `json:"files"`
+	HMACAlgorithm      string          `json:"hmac_algorithm,omitempty"`
+	HMAC               string          `json:"hmac,omitempty"`
+}
+
+// BuildCollectionManifest hashes every file under artifactsDir, excluding the
+// root manifest files, and returns the entries sorted by path. With hashing
+// false the files are only sized. Up to hashWorkers files are hashed at once.
+func BuildCollectionManifest(ctx context.Context, artifactsDir, hostname, runID string, timestamp time.Time, hashing bool, hashWorkers int) (*CollectionManifest, error) {
+	entries, err := hashTree(ctx, artifactsDir, hashing, hashWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	tool := CurrentBuildInfo()
+	manifest := &CollectionManifest{
+		CreatedUTC:         winutil.FormatTime(timestamp),
+		Host:               hostname,
+		RunID:              runID,
+		CryptkeeperVersion: tool.Version,
+		Tool:               &tool,
+		FileCount:          len(entries),
+		Files:              entries,
+	}
+	if !hashing {
+		manifest.Hashing = HashingDisabled
+	}
+	for _, entry := range entries {
+		manifest.TotalBytes += entry.Size
+	}
+
+	return manifest, nil
+}
+
+// AddFile hashes a file written into artifactsDir after the manifest was built,
+// unless the manifest was built without hashes, and indexes it, keeping entries sorted by path. It must be called before Seal.
+// An existing entry for the same path, such as a file rewritten by analyze, is replaced.
+func (m *CollectionManifest) AddFile(artifactsDir, relPath string) error {
+	relPath = filepath.ToSlash(relPath)
+	size, sha256Hex, err := hashFile(filepath.Join(artifactsDir, filepath.FromSlash(relPath)), m.Hashing != HashingDisabled)
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range m.Files {
+		if entry.Path == relPath {
+			m.TotalBytes -= entry.Size
+			m.Files = append(m.Files[:i], m.Files[i+1:]...)
+			break
+		}
+	}
+	m.Files = append(m.Files, ManifestEntry{Path: relPath, Size: size, SHA256: sha256Hex})
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	m.FileCount = len(m.Files)
+	m.TotalBytes += size
+	return nil
+}
+
+// MarkDuplicates points every file whose content matches an earlier file, in
+// path order, at that file, so the bundler can store the bytes once. Entries
+// without a hash and empty files are left alone. It returns the number of
+// duplicates and the bytes they would have added to the archive. The seal does
+// not cover the mapping: a rehydrated file whose content differs from its
+// recorded hash still fails verification.
+func (m *CollectionManifest) MarkDuplicates() (int, int64) {
+	duplicates := 0
+	var saved int64
+	first := make(map[string]string)
+	for i := range m.Files {
+		entry := &m.Files[i]
+		entry.DuplicateOf = ""
+		if entry.SHA256 == "" || entry.Size == 0 {
+			continue
+		}
+		if target, ok := first[entry.SHA256]; ok {
+			entry.DuplicateOf = target
+			duplicates++
+			saved += entry.Size
+			continue
+		}
+		first[entry.SHA256] = entry.Path
+	}
+	return duplicates, saved
+}
+
+// Duplicates returns the DuplicateOf mapping recorded by MarkDuplicates,
+// keyed by the duplicate's path.
+func (m *CollectionManifest) Duplicates() map[string]string {
+	duplicates := make(map[string]string)
+	for _, entry := range m.Files {
+		if entry.DuplicateOf != "" {
+			duplicates[entry.Path] = entry.DuplicateOf
+		}
+	}
+	return duplicates
+}
+
+// Seal computes the manifest HMAC with the given key.
+func (m *CollectionManifest) Seal(key []byte) {
+	m.HMACAlgorithm = ManifestHMACAlgorithm
+	m.HMAC = hex.EncodeToString(manifestMAC(m.Files, key))
+}
+
+// CheckSeal verifies the manifest HMAC against its own file list.
+func (m *CollectionManifest) CheckSeal(key []byte) error {
+	if m.HMAC == "" {
+		return fmt.Errorf("manifest is not sealed")
+	}
+	if m.HMACAlgorithm != ManifestHMACAlgorithm {
+		return fmt.Errorf("unsupported manifest HMAC algorithm %q", m.HMACAlgorithm)
+	}
+
+	recorded, err := hex.DecodeString(m.HMAC)
+	if err != nil {
+		return fmt.Errorf("malformed manifest HMAC: %w", err)
+	}
+	if !hmac.Equal(recorded, manifestMAC(m.Files, key)) {
+		return fmt.Errorf("manifest HMAC mismatch: file list or hashes were modified, or the key is wrong")
+	}
+
+	return nil
+}
+
+// WriteCollectionManifest writes the manifest to the root of artifactsDir in
+// the given format. MessagePack manifests are accompanied by a schema note.
+func WriteCollectionManifest(artifactsDir string, manifest *CollectionManifest, format string) error {
+	if format == ManifestFormatMsgpack {
+		if err := os.WriteFile(filepath.Join(artifactsDir, CollectionManifestSchemaName), []byte(collectionManifestSchema), 0644); err != nil {
+			return fmt.Errorf("failed to write collection manifest schema: %w", err)
+		}
+		return os.WriteFile(filepath.Join(artifactsDir, CollectionManifestMsgpackName), encodeManifestMsgpack(manifest), 0644)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal collection manifest: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(artifactsDir, CollectionManifestName), data, 0644)
+}
+
+// ReadCollectionManifest loads the root manifest from a collection directory,
+// reading collection_manifest.json or, failing that, collection_manifest.msgpack.
+func ReadCollectionManifest(artifactsDir string) (*CollectionManifest, error) {
+	var data []byte
+	var err error
+	for _, name := range []string{CollectionManifestName, CollectionManifestMsgpackName} {
+		data, err = os.ReadFile(filepath.Join(artifactsDir, name))
+		if !os.IsNotExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collection manifest: %w", err)
+	}
+
+	manifest, err := DecodeCollectionManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse collection manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// VerificationReport lists the differences between a manifest and the files on disk.
+type VerificationReport struct {
+	Checked    int      `json:"checked"`
+	Hashing    string   `json:"hashing,omitempty"` // "disabled" when only sizes could be compared
+	Mismatched []string `json:"mismatched"`
+	Missing    []string `json:"missing"`
+	Unexpected []string `json:"unexpected"`
+	SealValid  *bool    `json:"seal_valid,omitempty"`
+	SealError  string   `json:"seal_error,omitempty"`
+}
+
+// OK reports whether verification found no discrepancies.
+func (r *VerificationReport) OK() bool {
+	sealOK := r.SealValid == nil || *r.SealValid
+	return sealOK && len(r.Mismatched) == 0 && len(r.Missing) == 0 && len(r.Unexpected) == 0
+}
+
+// VerifyCollection recomputes hashes under artifactsDir and compares them with
+// the root manifest. A manifest built with hashing disabled has no hashes to
+// compare, so only presence and sizes are checked and the report says so.
+// When key is non-empty the manifest seal is checked too.
+func VerifyCollection(ctx context.Context, artifactsDir string, key []byte) (*VerificationReport, error) {
+	manifest, err := ReadCollectionManifest(artifactsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	hashing := manifest.Hashing != HashingDisabled
+	actual, err := hashTree(ctx, artifactsDir, hashing, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return compareWithManifest(manifest, actual, key), nil
+}
+
+// compareWithManifest reports how the files found, excluding the root
+// manifest itself, differ from the root manifest, checking its seal when key
+// is non-empty.
+func compareWithManifest(manifest *CollectionManifest, actual []ManifestEntry, key []byte) *VerificationReport {
+	report := &VerificationReport{
+		Hashing:    manifest.Hashing,
+		Mismatched: make([]string, 0),
+		Missing:    make([]string, 0),
+		Unexpected: make([]string, 0),
+	}
+
+	onDisk := make(map[string]ManifestEntry, len(actual))
+	for _, entry := range actual {
+		onDisk[entry.Path] = entry
+	}
+
+	for _, expected := range manifest.Files {
+		report.Checked++
+		got, ok := onDisk[expected.Path]
+		if !ok {
+			report.Missing = append(report.Missing, expected.Path)
+			continue
+		}
+		if got.Size != expected.Size || got.SHA256 != expected.SHA256 {
+			report.Mismatched = append(report.Mismatched, expected.Path)
+		}
+		delete(onDisk, expected.Path)
+	}
+	for path := range onDisk {
+		report.Unexpected = append(report.Unexpected, path)
+	}
+	sort.Strings(report.Unexpected)
+
+	if len(key) > 0 {
+		valid := true
+		if err := manifest.CheckSeal(key); err != nil {
+			valid = false
+			report.SealError = err.Error()
+		}
+		report.SealValid = &valid
+	}
+
+	return report
+}
+
+// manifestMAC computes the HMAC over the canonical encoding of the entries:
+// one "path\x00size\x00sha256\n" record per file, sorted by path.
+func manifestMAC(entries []ManifestEntry, key []byte) []byte {
+	sorted := make([]ManifestEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	mac := hmac.New(sha256.New, key)
+	for _, entry := range sorted {
+		io.WriteString(mac, entry.Path)
+		mac.Write([]byte{0})
+		io.WriteString(mac, strconv.FormatInt(entry.Size, 10))
+		mac.Write([]byte{0})
+		io.WriteString(mac, entry.SHA256)
+		mac.Write([]byte{'\n'})
+	}
+	return mac.Sum(nil)
+}
+
+// hashTree returns a sorted manifest entry for every regular file under root,
+// excluding the root manifest files. The files are listed first and then
+// hashed by up to workers goroutines, so that hashing, which is CPU-bound on
+// fast storage, can use more than one core.
+func hashTree(ctx context.Context, root string, hashing bool, workers int) ([]ManifestEntry, error) {
+	paths := make([]string, 0)
+	entries := make([]ManifestEntry, 0)
+	err := winutil.StreamWalk(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Check for context cancellation
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return fmt.Errorf("failed to calculate relative path for %s: %w", path, err)
+		}
+		relPath = filepath.ToSlash(relPath)
+		if isCollectionManifestFile(relPath) {
+			return nil
+		}
+
+		paths = append(paths, path)
+		entries = append(entries, ManifestEntry{Path: relPath})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+
+	if err := hashEntries(ctx, paths, entries, hashing, workers); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// hashEntries fills in the size and hash of entries[i] from paths[i] using up
+// to workers goroutines, and returns the first error any of them hit.
+func hashEntries(ctx context.Context, paths []string, entries []ManifestEntry, hashing bool, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				size, sha256Hex, err := hashEntryFile(paths[i], hashing)
+				if err != nil {
+					once.Do(func() { firstErr = err })
+					continue
+				}
+				entries[i].Size = size
+				entries[i].SHA256 = sha256Hex
+			}
+		}()
+	}
+
+	for i := range paths {
+		if ctx.Err() != nil {
+			once.Do(func() { firstErr = ctx.Err() })
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
+
+// hashEntryFile hashes one file for hashEntries; replaced when counting workers.
+var hashEntryFile = hashFile
+
+// hashFile returns the size and SHA-256 of a file, or only its size when
+// hashing is false.
+func hashFile(path string, hashing bool) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if !hashing {
+		stat, err := file.Stat()
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to stat file %s: %w", path, err)
+		}
+		return stat.Size(), "", nil
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to hash file %s: %w", path, err)
+	}
+
+	return size, hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,291 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sealTestCollection writes a collection whose root manifest is sealed with key.
+func sealTestCollection(t *testing.T, key []byte) (string, *CollectionManifest) {
+	t.Helper()
+	dir := newTestCollection(t, defaultTestFiles)
+	manifest, err := ReadCollectionManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Seal(key)
+	if err := WriteCollectionManifest(dir, manifest, ManifestFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	return dir, manifest
+}
+
+func TestSealedManifestVerifies(t *testing.T) {
+	key := []byte("case-4471-key")
+	dir, manifest := sealTestCollection(t, key)
+	if manifest.HMACAlgorithm != ManifestHMACAlgorithm || len(manifest.HMAC) != 64 {
+		t.Fatalf("seal = %s %q", manifest.HMACAlgorithm, manifest.HMAC)
+	}
+
+	report, err := VerifyCollection(context.Background(), dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.SealValid == nil || !*report.SealValid || report.Checked != len(defaultTestFiles) {
+		t.Fatalf("sealed collection did not verify: %+v", report)
+	}
+
+	report, err = VerifyCollection(context.Background(), dir, []byte("another key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || *report.SealValid || !strings.Contains(report.SealError, "mismatch") {
+		t.Fatalf("wrong key verified: %+v", report)
+	}
+}
+
+func TestSealFailsWhenAHashIsMutated(t *testing.T) {
+	key := []byte("case-4471-key")
+	dir, manifest := sealTestCollection(t, key)
+
+	// An insider alters a file and rewrites its manifest entry to match,
+	// leaving the seal in place
+	target := "sysinfo/host.json"
+	altered := []byte(`{"hostname":"decoy"}`)
+	if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(target)), altered, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(altered)
+	for i := range manifest.Files {
+		if manifest.Files[i].Path == target {
+			manifest.Files[i].SHA256 = hex.EncodeToString(sum[:])
+			manifest.Files[i].Size = int64(len(altered))
+		}
+	}
+	if err := WriteCollectionManifest(dir, manifest, ManifestFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := VerifyCollection(context.Background(), dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Mismatched) != 0 {
+		t.Fatalf("rewritten entry should match the file on disk: %+v", report)
+	}
+	if report.OK() || report.SealValid == nil || *report.SealValid {
+		t.Fatalf("mutated hash passed verification: %+v", report)
+	}
+
+	// Without the key only the hashes are compared, which the rewrite satisfies
+	report, err = VerifyCollection(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.SealValid != nil {
+		t.Fatalf("unkeyed verification = %+v", report)
+	}
+}
+
+func TestCheckSealRejectsUnsealedAndMalformed(t *testing.T) {
+	key := []byte("case-4471-key")
+	manifest := &CollectionManifest{Files: []ManifestEntry{{Path: "a", Size: 1, SHA256: strings.Repeat("0", 64)}}}
+	if err := manifest.CheckSeal(key); err == nil || !strings.Contains(err.Error(), "not sealed") {
+		t.Errorf("unsealed manifest = %v", err)
+	}
+
+	manifest.Seal(key)
+	manifest.HMACAlgorithm = "hmac-md5"
+	if err := manifest.CheckSeal(key); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("unknown algorithm = %v", err)
+	}
+	manifest.HMACAlgorithm = ManifestHMACAlgorithm
+	manifest.HMAC = "not hex"
+	if err := manifest.CheckSeal(key); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("malformed HMAC = %v", err)
+	}
+}
+
+func TestManifestMACIgnoresEntryOrder(t *testing.T) {
+	key := []byte("k")
+	entries := []ManifestEntry{
+		{Path: "b", Size: 2, SHA256: "bb"},
+		{Path: "a", Size: 1, SHA256: "aa"},
+	}
+	reversed := []ManifestEntry{entries[1], entries[0]}
+	if hex.EncodeToString(manifestMAC(entries, key)) != hex.EncodeToString(manifestMAC(reversed, key)) {
+		t.Fatal("HMAC depends on entry order")
+	}
+	// Fields are delimited, so moving a digit between size and path changes it
+	shifted := []ManifestEntry{{Path: "b2", Size: 0, SHA256: "bb"}, entries[1]}
+	if hex.EncodeToString(manifestMAC(entries, key)) == hex.EncodeToString(manifestMAC(shifted, key)) {
+		t.Fatal("HMAC does not separate fields")
+	}
+	if entries[0].Path != "b" {
+		t.Fatal("manifestMAC reordered its input")
+	}
+}
+
+func TestManifestWithoutHashes(t *testing.T) {
+	dir := newTestCollection(t, defaultTestFiles)
+	manifest, err := BuildCollectionManifest(context.Background(), dir, "host", testRunID, testTimestamp, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Hashing != HashingDisabled {
+		t.Fatalf("hashing = %q", manifest.Hashing)
+	}
+	if err := WriteCollectionManifest(dir, manifest, ManifestFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, CollectionManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"hashing": "disabled"`) || !strings.Contains(string(data), `"sha256": null`) || strings.Contains(string(data), `"sha256": ""`) {
+		t.Fatalf("collection_manifest.json = %s", data)
+	}
+
+	// Only sizes can be compared, so same-size tampering goes unnoticed but resizing does not
+	report, err := VerifyCollection(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Hashing != HashingDisabled || report.Checked != len(defaultTestFiles) {
+		t.Fatalf("report = %+v", report)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sysinfo", "host.json"), []byte(`{"hostname":"evil-twin"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err = VerifyCollection(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || len(report.Mismatched) != 1 || report.Mismatched[0] != "sysinfo/host.json" {
+		t.Fatalf("resized file not reported: %+v", report)
+	}
+}
+
+// hashWorkerFiles returns a collection of n files of distinct content.
+func hashWorkerFiles(n int) map[string]string {
+	files := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		files[fmt.Sprintf("windows/evtx/%03d.evtx", i)] = strings.Repeat(fmt.Sprintf("event %d ", i), 512+i)
+	}
+	return files
+}
+
+func TestHashWorkersMatchASinglePass(t *testing.T) {
+	files := hashWorkerFiles(40)
+	dir := newTestCollection(t, files)
+
+	single, err := BuildCollectionManifest(context.Background(), dir, "host", testRunID, testTimestamp, true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range single.Files {
+		if content, ok := files[entry.Path]; !ok || entry.SHA256 != sha256Hex(content) || entry.Size != int64(len(content)) {
+			t.Fatalf("single pass entry %+v", entry)
+		}
+	}
+	if len(single.Files) != len(files) {
+		t.Fatalf("single pass listed %d files, want %d", len(single.Files), len(files))
+	}
+
+	// More workers than files are capped, not left waiting
+	for _, workers := range []int{8, 64} {
+		parallel, err := BuildCollectionManifest(context.Background(), dir, "host", testRunID, testTimestamp, true, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parallel.Files, single.Files) {
+			t.Fatalf("%d workers produced different entries than one", workers)
+		}
+	}
+}
+
+func TestHashWorkersRunConcurrently(t *testing.T) {
+	dir := newTestCollection(t, hashWorkerFiles(16))
+
+	// Each call waits until a second one is in flight, which can only happen
+	// if more than one worker is hashing at a time
+	var inFlight, peak int32
+	var together sync.Once
+	ready := make(chan struct{})
+	hashEntryFile = func(path string, hashing bool) (int64, string, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		if n >= 2 {
+			together.Do(func() { close(ready) })
+		}
+		select {
+		case <-ready:
+		case <-time.After(5 * time.Second):
+			return 0, "", fmt.Errorf("%s hashed alone", path)
+		}
+		return hashFile(path, hashing)
+	}
+	t.Cleanup(func() { hashEntryFile = hashFile })
+
+	if _, err := BuildCollectionManifest(context.Background(), dir, "host", testRunID, testTimestamp, true, 4); err != nil {
+		t.Fatal(err)
+	}
+	if peak < 2 || peak > 4 {
+		t.Fatalf("%d hashes in flight with 4 workers", peak)
+	}
+}
+
+func TestHashWorkersReportAFailedFile(t *testing.T) {
+	dir := newTestCollection(t, hashWorkerFiles(16))
+	hashEntryFile = func(path string, hashing bool) (int64, string, error) {
+		if filepath.Base(path) == "007.evtx" {
+			return 0, "", fmt.Errorf("failed to open file %s: access denied", path)
+		}
+		return hashFile(path, hashing)
+	}
+	t.Cleanup(func() { hashEntryFile = hashFile })
+
+	_, err := BuildCollectionManifest(context.Background(), dir, "host", testRunID, testTimestamp, true, 4)
+	if err == nil || !strings.Contains(err.Error(), "007.evtx") {
+		t.Fatalf("failed hash = %v", err)
+	}
+}
+
+func BenchmarkHashWorkers(b *testing.B) {
+	dir := b.TempDir()
+	block := make([]byte, 1<<20)
+	for i := range block {
+		block[i] = byte(i * 7)
+	}
+	for i := 0; i < 16; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.vhdx", i)), block, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(16 << 20)
+			for i := 0; i < b.N; i++ {
+				if _, err := BuildCollectionManifest(context.Background(), dir, "host", testRunID, testTimestamp, true, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
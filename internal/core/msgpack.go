@@ -0,0 +1,616 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Collection manifest formats.
+const (
+	ManifestFormatJSON    = "json"
+	ManifestFormatMsgpack = "msgpack"
+)
+
+// CollectionManifestMsgpackName is the file name of a MessagePack root manifest.
+const CollectionManifestMsgpackName = "collection_manifest.msgpack"
+
+// CollectionManifestSchemaName is the sidecar note written next to a
+// MessagePack manifest describing its layout for readers without cryptkeeper.
+const CollectionManifestSchemaName = "collection_manifest.msgpack.txt"
+
+// collectionManifestSchema is the content of CollectionManifestSchemaName.
+const collectionManifestSchema = `collection_manifest.msgpack is a MessagePack (https://msgpack.org) encoding
+of the root collection manifest. It holds the same fields as
+collection_manifest.json, as a single map with string keys:
+
+  created_utc          str    RFC3339 creation time
+  host                 str
+  run_id               str    omitted when unset
+  cryptkeeper_version  str
+  tool                 map with str values: version, commit, build_date,
+                       go_version, platform (empty values omitted)
+  hashing              str    "disabled" when files were not hashed, else omitted
+  file_count           int
+  total_bytes          int
+  files                array of maps:
+    path               str    slash-separated, relative to the artifacts directory
+    size               int
+    sha256             str    lowercase hex; nil when hashing was disabled
+    duplicate_of       str    path of the identical file the archive stores
+                              in place of this one; omitted unless --dedup
+  hmac_algorithm       str    omitted when unsealed
+  hmac                 str    lowercase hex, omitted when unsealed
+
+Decode with any MessagePack library, or run "cryptkeeper verify <dir>".
+`
+
+// ValidateManifestFormat checks a --manifest-format value.
+func ValidateManifestFormat(format string) error {
+	switch format {
+	case ManifestFormatJSON, ManifestFormatMsgpack:
+		return nil
+	}
+	return fmt.Errorf("unsupported manifest format %q (use %s or %s)", format, ManifestFormatJSON, ManifestFormatMsgpack)
+}
+
+// isCollectionManifestFile reports whether a relative path is one of the root
+// manifest files, which are not themselves indexed.
+func isCollectionManifestFile(relPath string) bool {
+	switch relPath {
+	case CollectionManifestName, CollectionManifestMsgpackName, CollectionManifestSchemaName:
+		return true
+	}
+	return false
+}
+
+// DecodeCollectionManifest parses a root manifest in either format, detected
+// from its first byte: JSON manifests are objects starting with '{', while
+// MessagePack manifests start with a map header.
+func DecodeCollectionManifest(data []byte) (*CollectionManifest, error) {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("collection manifest is empty")
+	}
+
+	if trimmed[0] == '{' {
+		var manifest CollectionManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, err
+		}
+		return &manifest, nil
+	}
+
+	if b := data[0]; (b >= 0x80 && b <= 0x8f) || b == 0xde || b == 0xdf {
+		return decodeManifestMsgpack(data)
+	}
+	return nil, fmt.Errorf("unrecognized collection manifest format")
+}
+
+// encodeManifestMsgpack encodes a manifest with the same keys and omissions as its JSON form.
+func encodeManifestMsgpack(m *CollectionManifest) []byte {
+	var w msgpackWriter
+
+	fields := 6
+	if m.RunID != "" {
+		fields++
+	}
+	if m.Tool != nil {
+		fields++
+	}
+	if m.Hashing != "" {
+		fields++
+	}
+	if m.HMACAlgorithm != "" {
+		fields++
+	}
+	if m.HMAC != "" {
+		fields++
+	}
+
+	w.mapHeader(fields)
+	w.str("created_utc")
+	w.str(m.CreatedUTC)
+	w.str("host")
+	w.str(m.Host)
+	if m.RunID != "" {
+		w.str("run_id")
+		w.str(m.RunID)
+	}
+	w.str("cryptkeeper_version")
+	w.str(m.CryptkeeperVersion)
+	if m.Tool != nil {
+		w.str("tool")
+		w.stringMap(buildInfoFields(m.Tool))
+	}
+	if m.Hashing != "" {
+		w.str("hashing")
+		w.str(m.Hashing)
+	}
+	w.str("file_count")
+	w.int(int64(m.FileCount))
+	w.str("total_bytes")
+	w.int(m.TotalBytes)
+	w.str("files")
+	w.arrayHeader(len(m.Files))
+	for _, entry := range m.Files {
+		if entry.DuplicateOf != "" {
+			w.mapHeader(4)
+		} else {
+			w.mapHeader(3)
+		}
+		w.str("path")
+		w.str(entry.Path)
+		w.str("size")
+		w.int(entry.Size)
+		w.str("sha256")
+		if entry.SHA256 == "" {
+			w.nil()
+		} else {
+			w.str(entry.SHA256)
+		}
+		if entry.DuplicateOf != "" {
+			w.str("duplicate_of")
+			w.str(entry.DuplicateOf)
+		}
+	}
+	if m.HMACAlgorithm != "" {
+		w.str("hmac_algorithm")
+		w.str(m.HMACAlgorithm)
+	}
+	if m.HMAC != "" {
+		w.str("hmac")
+		w.str(m.HMAC)
+	}
+
+	return w.buf.Bytes()
+}
+
+// decodeManifestMsgpack decodes a MessagePack manifest. Unknown keys are skipped.
+func decodeManifestMsgpack(data []byte) (*CollectionManifest, error) {
+	r := &msgpackReader{data: data}
+	manifest := &CollectionManifest{}
+
+	fields, err := r.mapHeader()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < fields; i++ {
+		key, err := r.str()
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "created_utc":
+			manifest.CreatedUTC, err = r.str()
+		case "host":
+			manifest.Host, err = r.str()
+		case "run_id":
+			manifest.RunID, err = r.str()
+		case "cryptkeeper_version":
+			manifest.CryptkeeperVersion, err = r.str()
+		case "tool":
+			manifest.Tool, err = r.buildInfo()
+		case "hashing":
+			manifest.Hashing, err = r.str()
+		case "file_count":
+			var n int64
+			n, err = r.int()
+			manifest.FileCount = int(n)
+		case "total_bytes":
+			manifest.TotalBytes, err = r.int()
+		case "files":
+			manifest.Files, err = r.manifestEntries()
+		case "hmac_algorithm":
+			manifest.HMACAlgorithm, err = r.str()
+		case "hmac":
+			manifest.HMAC, err = r.str()
+		default:
+			err = r.skip(0)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", key, err)
+		}
+	}
+
+	if manifest.Files == nil {
+		manifest.Files = make([]ManifestEntry, 0)
+	}
+	return manifest, nil
+}
+
+// manifestEntries decodes the files array.
+func (r *msgpackReader) manifestEntries() ([]ManifestEntry, error) {
+	count, err := r.arrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	// Each entry takes well over one byte, which bounds a hostile count
+	if count > len(r.data)-r.pos {
+		return nil, errMsgpackTruncated
+	}
+
+	entries := make([]ManifestEntry, 0, count)
+	for i := 0; i < count; i++ {
+		fields, err := r.mapHeader()
+		if err != nil {
+			return nil, err
+		}
+		var entry ManifestEntry
+		for j := 0; j < fields; j++ {
+			key, err := r.str()
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "path":
+				entry.Path, err = r.str()
+			case "size":
+				entry.Size, err = r.int()
+			case "sha256":
+				entry.SHA256, err = r.nullableStr()
+			case "duplicate_of":
+				entry.DuplicateOf, err = r.str()
+			default:
+				err = r.skip(0)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("files[%d].%s: %w", i, key, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// buildInfoFields lists a build's non-empty fields under their JSON names.
+func buildInfoFields(b *BuildInfo) [][2]string {
+	fields := make([][2]string, 0, 5)
+	for _, field := range [][2]string{
+		{"version", b.Version},
+		{"commit", b.Commit},
+		{"build_date", b.BuildDate},
+		{"go_version", b.GoVersion},
+		{"platform", b.Platform},
+	} {
+		if field[1] != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// buildInfo decodes the tool map.
+func (r *msgpackReader) buildInfo() (*BuildInfo, error) {
+	fields, err := r.mapHeader()
+	if err != nil {
+		return nil, err
+	}
+	info := &BuildInfo{}
+	for i := 0; i < fields; i++ {
+		key, err := r.str()
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "version":
+			info.Version, err = r.str()
+		case "commit":
+			info.Commit, err = r.str()
+		case "build_date":
+			info.BuildDate, err = r.str()
+		case "go_version":
+			info.GoVersion, err = r.str()
+		case "platform":
+			info.Platform, err = r.str()
+		default:
+			err = r.skip(0)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tool.%s: %w", key, err)
+		}
+	}
+	return info, nil
+}
+
+// msgpackWriter encodes the subset of MessagePack used by the manifest.
+type msgpackWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *msgpackWriter) mapHeader(n int) {
+	switch {
+	case n < 16:
+		w.buf.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		w.buf.WriteByte(0xde)
+		w.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		w.buf.WriteByte(0xdf)
+		w.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+func (w *msgpackWriter) arrayHeader(n int) {
+	switch {
+	case n < 16:
+		w.buf.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		w.buf.WriteByte(0xdc)
+		w.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		w.buf.WriteByte(0xdd)
+		w.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+func (w *msgpackWriter) str(s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		w.buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		w.buf.WriteByte(0xd9)
+		w.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		w.buf.WriteByte(0xda)
+		w.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		w.buf.WriteByte(0xdb)
+		w.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+	w.buf.WriteString(s)
+}
+
+func (w *msgpackWriter) nil() {
+	w.buf.WriteByte(0xc0)
+}
+
+// stringMap writes a map of string keys to string values in the given order.
+func (w *msgpackWriter) stringMap(fields [][2]string) {
+	w.mapHeader(len(fields))
+	for _, field := range fields {
+		w.str(field[0])
+		w.str(field[1])
+	}
+}
+
+func (w *msgpackWriter) int(v int64) {
+	switch {
+	case v >= 0 && v < 128:
+		w.buf.WriteByte(byte(v))
+	case v >= -32 && v < 0:
+		w.buf.WriteByte(byte(int8(v)))
+	case v >= 0 && v <= math.MaxUint32:
+		w.buf.WriteByte(0xce)
+		w.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(v)))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		w.buf.WriteByte(0xd2)
+		w.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(int32(v))))
+	default:
+		w.buf.WriteByte(0xd3)
+		w.buf.Write(binary.BigEndian.AppendUint64(nil, uint64(v)))
+	}
+}
+
+var errMsgpackTruncated = errors.New("msgpack data is truncated")
+
+// maxMsgpackDepth bounds nesting when skipping unknown values.
+const maxMsgpackDepth = 32
+
+// msgpackReader decodes the subset of MessagePack used by the manifest and
+// can skip any other value.
+type msgpackReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, errMsgpackTruncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *msgpackReader) byte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *msgpackReader) uint(size int) (uint64, error) {
+	b, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (r *msgpackReader) mapHeader() (int, error) {
+	b, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b >= 0x80 && b <= 0x8f:
+		return int(b & 0x0f), nil
+	case b == 0xde:
+		n, err := r.uint(2)
+		return int(n), err
+	case b == 0xdf:
+		n, err := r.uint(4)
+		return int(n), err
+	}
+	return 0, fmt.Errorf("expected msgpack map, found type 0x%02x", b)
+}
+
+func (r *msgpackReader) arrayHeader() (int, error) {
+	b, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b >= 0x90 && b <= 0x9f:
+		return int(b & 0x0f), nil
+	case b == 0xdc:
+		n, err := r.uint(2)
+		return int(n), err
+	case b == 0xdd:
+		n, err := r.uint(4)
+		return int(n), err
+	}
+	return 0, fmt.Errorf("expected msgpack array, found type 0x%02x", b)
+}
+
+func (r *msgpackReader) str() (string, error) {
+	b, err := r.byte()
+	if err != nil {
+		return "", err
+	}
+	var n uint64
+	switch {
+	case b >= 0xa0 && b <= 0xbf:
+		n = uint64(b & 0x1f)
+	case b == 0xd9:
+		n, err = r.uint(1)
+	case b == 0xda:
+		n, err = r.uint(2)
+	case b == 0xdb:
+		n, err = r.uint(4)
+	default:
+		return "", fmt.Errorf("expected msgpack string, found type 0x%02x", b)
+	}
+	if err != nil {
+		return "", err
+	}
+	s, err := r.next(int(n))
+	return string(s), err
+}
+
+// nullableStr reads a string, or nil as "".
+func (r *msgpackReader) nullableStr() (string, error) {
+	if r.pos < len(r.data) && r.data[r.pos] == 0xc0 {
+		r.pos++
+		return "", nil
+	}
+	return r.str()
+}
+
+func (r *msgpackReader) int() (int64, error) {
+	b, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b >= 0xcc && b <= 0xcf:
+		n, err := r.uint(1 << (b - 0xcc))
+		if err == nil && n > math.MaxInt64 {
+			return 0, fmt.Errorf("msgpack integer overflows int64")
+		}
+		return int64(n), err
+	case b >= 0xd0 && b <= 0xd3:
+		size := 1 << (b - 0xd0)
+		n, err := r.uint(size)
+		switch size {
+		case 1:
+			return int64(int8(n)), err
+		case 2:
+			return int64(int16(n)), err
+		case 4:
+			return int64(int32(n)), err
+		}
+		return int64(n), err
+	}
+	return 0, fmt.Errorf("expected msgpack integer, found type 0x%02x", b)
+}
+
+// skip discards one value of any type.
+func (r *msgpackReader) skip(depth int) error {
+	if depth > maxMsgpackDepth {
+		return fmt.Errorf("msgpack value nests too deeply")
+	}
+	b, err := r.byte()
+	if err != nil {
+		return err
+	}
+
+	var length uint64
+	elements := 0 // Nested values following the header
+	switch {
+	case b <= 0x7f, b >= 0xe0, b == 0xc0, b == 0xc2, b == 0xc3:
+		return nil
+	case b >= 0x80 && b <= 0x8f:
+		elements = 2 * int(b&0x0f)
+	case b >= 0x90 && b <= 0x9f:
+		elements = int(b & 0x0f)
+	case b >= 0xa0 && b <= 0xbf:
+		length = uint64(b & 0x1f)
+	case b == 0xc4 || b == 0xd9:
+		length, err = r.uint(1)
+	case b == 0xc5 || b == 0xda:
+		length, err = r.uint(2)
+	case b == 0xc6 || b == 0xdb:
+		length, err = r.uint(4)
+	case b == 0xc7, b == 0xc8, b == 0xc9:
+		// ext 8/16/32: length, type byte, data
+		length, err = r.uint(1 << (b - 0xc7))
+		length++
+	case b == 0xca:
+		length = 4
+	case b == 0xcb:
+		length = 8
+	case b >= 0xcc && b <= 0xcf:
+		length = 1 << (b - 0xcc)
+	case b >= 0xd0 && b <= 0xd3:
+		length = 1 << (b - 0xd0)
+	case b >= 0xd4 && b <= 0xd8:
+		// fixext 1/2/4/8/16: type byte and data
+		length = 1 + 1<<(b-0xd4)
+	case b == 0xdc || b == 0xdd:
+		var n uint64
+		n, err = r.uint(2 << (b - 0xdc))
+		elements = int(n)
+	case b == 0xde || b == 0xdf:
+		var n uint64
+		n, err = r.uint(2 << (b - 0xde))
+		elements = 2 * int(n)
+	default:
+		return fmt.Errorf("invalid msgpack type 0x%02x", b)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.next(int(length)); err != nil {
+		return err
+	}
+	if elements > len(r.data)-r.pos {
+		return errMsgpackTruncated
+	}
+	for i := 0; i < elements; i++ {
+		if err := r.skip(depth + 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifestMsgpackRoundTrip(t *testing.T) {
+	manifest := &CollectionManifest{
+		CreatedUTC:         "2024-03-01T12:00:00Z",
+		Host:               "WS-0142",
+		RunID:              testRunID,
+		CryptkeeperVersion: "1.4.0",
+		Tool:               &BuildInfo{Version: "1.4.0", Commit: "3f2a9c1-dirty", GoVersion: "go1.22.1", Platform: "windows/amd64"},
+		Files: []ManifestEntry{
+			{Path: "windows_evtx/Security.evtx", Size: 68 << 20, SHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+			{Path: "windows_usn/$J", Size: 5 << 32, SHA256: "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"},
+			{Path: "users/jürgen/ntuser_漢字.dat", Size: 0, SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+			{Path: "windows_prefetch/CMD.EXE-4A81B364.pf", Size: 1234, SHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", DuplicateOf: "windows_evtx/Security.evtx"},
+		},
+	}
+	// Enough entries to need 16- and 32-bit array headers
+	for i := 0; i < 70000; i++ {
+		manifest.Files = append(manifest.Files, ManifestEntry{Path: fmt.Sprintf("fsinventory/%06d.txt", i), Size: int64(i), SHA256: fmt.Sprintf("%064x", i)})
+	}
+	manifest.FileCount = len(manifest.Files)
+	for _, entry := range manifest.Files {
+		manifest.TotalBytes += entry.Size
+	}
+	manifest.Seal([]byte("case-4471-key"))
+
+	unhashed := &CollectionManifest{
+		CreatedUTC: "2024-03-01T12:00:00Z",
+		Host:       "WS-0142",
+		Hashing:    HashingDisabled,
+		FileCount:  1,
+		TotalBytes: 10,
+		Files:      []ManifestEntry{{Path: "sysinfo/host.json", Size: 10}},
+	}
+
+	for name, original := range map[string]*CollectionManifest{"sealed": manifest, "unhashed": unhashed} {
+		t.Run(name, func(t *testing.T) {
+			decoded, err := DecodeCollectionManifest(encodeManifestMsgpack(original))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, original) {
+				t.Fatal("manifest changed in a MessagePack round trip")
+			}
+		})
+	}
+	decoded, err := DecodeCollectionManifest(encodeManifestMsgpack(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.CheckSeal([]byte("case-4471-key")); err != nil {
+		t.Fatalf("seal does not check after a round trip: %v", err)
+	}
+}
+
+func TestDecodeManifestMsgpackRejectsTruncation(t *testing.T) {
+	data := encodeManifestMsgpack(&CollectionManifest{
+		CreatedUTC: "2024-03-01T12:00:00Z",
+		Host:       "WS-0142",
+		Files:      []ManifestEntry{{Path: "sysinfo/host.json", Size: 10, SHA256: fmt.Sprintf("%064x", 1)}},
+	})
+	for _, n := range []int{1, len(data) / 2, len(data) - 1} {
+		if _, err := DecodeCollectionManifest(data[:n]); err == nil {
+			t.Errorf("manifest truncated to %d of %d bytes decoded", n, len(data))
+		}
+	}
+}
+
+func TestVerifyCollectionWithMsgpackManifest(t *testing.T) {
+	dir := newTestCollection(t, defaultTestFiles)
+	if err := os.Remove(filepath.Join(dir, CollectionManifestName)); err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("case-4471-key")
+	manifest, err := BuildCollectionManifest(context.Background(), dir, "host", testRunID, testTimestamp, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Seal(key)
+	if err := WriteCollectionManifest(dir, manifest, ManifestFormatMsgpack); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, CollectionManifestSchemaName)); err != nil {
+		t.Fatalf("no schema note beside the MessagePack manifest: %v", err)
+	}
+
+	report, err := VerifyCollection(context.Background(), dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Checked != len(defaultTestFiles) || report.SealValid == nil {
+		t.Fatalf("collection with a MessagePack manifest did not verify: %+v", report)
+	}
+
+	// The archive is verified against the same manifest
+	meta, err := BundleAndMaybeEncrypt(context.Background(), dir, t.TempDir(), "host", testTimestamp, ArchiveEncryption{}, ArchiveCompression{}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveReport, err := VerifyArchive(context.Background(), meta.Path, nil, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !archiveReport.OK() || archiveReport.Checked != len(defaultTestFiles) {
+		t.Fatalf("archive with a MessagePack manifest did not verify: %+v", archiveReport)
+	}
+	extractReport, err := ExtractArchive(context.Background(), meta.Path, t.TempDir(), []string{"sysinfo"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !extractReport.OK() || extractReport.Verified != 1 {
+		t.Fatalf("extraction against a MessagePack manifest did not verify: %+v", extractReport)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "sysinfo", "host.json"), []byte(`{"hostname":"evil"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err = VerifyCollection(context.Background(), dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || len(report.Mismatched) != 1 || report.Mismatched[0] != "sysinfo/host.json" {
+		t.Fatalf("altered file not reported against the MessagePack manifest: %+v", report)
+	}
+}
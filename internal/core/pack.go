@@ -5,6 +5,8 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -12,28 +14,179 @@ import (
 	"strings"
 	"time"
 
+	"cryptkeeper/internal/winutil"
+
 	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/klauspost/compress/zstd"
 )
 
 // PackageMetadata contains information about the created package.
 type PackageMetadata struct {
-	Path         string `json:"archive_path"`
-	Encrypted    bool   `json:"encrypted"`
-	FileCount    int    `json:"file_count"`
-	BytesWritten int64  `json:"bytes_written"`
+	Path             string `json:"archive_path"`
+	Encrypted        bool   `json:"encrypted"`
+	Compression      string `json:"compression"`       // CompressionGzip or CompressionZstd
+	CompressionLevel int    `json:"compression_level"` // Level the codec compressed at
+	FileCount        int    `json:"file_count"`
+	BytesWritten     int64  `json:"bytes_written"`
+	SHA256           string `json:"sha256"` // Of the archive, or of its volumes concatenated
+	Deduplicated     int    `json:"deduplicated,omitempty"` // Files stored as references to identical content
+	// Files the archive was split into with --split-size; Path is then the
+	// archive they concatenate to, which is not itself written
+	Volumes []ArchiveVolume `json:"volumes,omitempty"`
+	// Detached signature written by SignArchive, and the key that made it
+	Signature        string `json:"signature,omitempty"`
+	SigningPublicKey string `json:"signing_public_key,omitempty"`
+}
+
+// Scrypt work factors of passphrase encryption, as log2 of the work: age's
+// own default and the accepted range. The age command refuses to decrypt
+// archives above MaxScryptWorkFactor.
+const (
+	DefaultScryptWorkFactor = 18
+	MinScryptWorkFactor     = 10
+	MaxScryptWorkFactor     = 22
+)
+
+// ArchiveEncryption selects how an archive is encrypted: to public key
+// recipients, any one of whose identities decrypts it, or with a passphrase.
+// age allows a passphrase only on its own, so the two are exclusive.
+type ArchiveEncryption struct {
+	Recipients       []string // age or SSH public keys, parsed by ParseRecipient
+	Passphrase       string
+	ScryptWorkFactor int // log2 of the scrypt work; 0 selects DefaultScryptWorkFactor
+}
+
+// Enabled reports whether any encryption is selected.
+func (e ArchiveEncryption) Enabled() bool {
+	return len(e.Recipients) > 0 || e.Passphrase != ""
+}
+
+// recipients parses the age recipients the encryption selects.
+func (e ArchiveEncryption) recipients() ([]age.Recipient, error) {
+	if e.Passphrase != "" {
+		if len(e.Recipients) > 0 {
+			return nil, fmt.Errorf("a passphrase cannot be combined with public key recipients")
+		}
+		recipient, err := age.NewScryptRecipient(e.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create passphrase recipient: %w", err)
+		}
+		workFactor := e.ScryptWorkFactor
+		if workFactor == 0 {
+			workFactor = DefaultScryptWorkFactor
+		}
+		if workFactor < MinScryptWorkFactor || workFactor > MaxScryptWorkFactor {
+			return nil, fmt.Errorf("scrypt work factor %d is outside %d-%d", workFactor, MinScryptWorkFactor, MaxScryptWorkFactor)
+		}
+		recipient.SetWorkFactor(workFactor)
+		return []age.Recipient{recipient}, nil
+	}
+
+	recipients := make([]age.Recipient, 0, len(e.Recipients))
+	for _, key := range e.Recipients {
+		recipient, err := ParseRecipient(key)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// Archive compression codecs. The archive name ends in .tar.gz or .tar.zst
+// to match, so standard tools pick the right decompressor.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// ValidateCompression checks a --compression value.
+func ValidateCompression(compression string) error {
+	switch compression {
+	case CompressionGzip, CompressionZstd:
+		return nil
+	}
+	return fmt.Errorf("unsupported compression %q (use %s or %s)", compression, CompressionGzip, CompressionZstd)
+}
+
+// Compression levels each codec accepts, and the level it uses by default:
+// gzip's 1-9, and zstd's 1-22 as the zstd command numbers them.
+const (
+	DefaultGzipLevel = 6
+	MaxGzipLevel     = 9
+	DefaultZstdLevel = 3
+	MaxZstdLevel     = 22
+)
+
+// ArchiveCompression selects the archive codec and its level.
+type ArchiveCompression struct {
+	Codec string // CompressionGzip or CompressionZstd; empty selects gzip
+	Level int    // 0 selects the codec's default level
+}
+
+// ClampCompressionLevel returns the level a codec compresses at when asked
+// for level, and whether level had to be clamped into the codec's range.
+// Level 0 selects the codec's default.
+func ClampCompressionLevel(codec string, level int) (int, bool) {
+	defaultLevel, maxLevel := DefaultGzipLevel, MaxGzipLevel
+	if codec == CompressionZstd {
+		defaultLevel, maxLevel = DefaultZstdLevel, MaxZstdLevel
+	}
+	switch {
+	case level == 0:
+		return defaultLevel, false
+	case level < 1:
+		return 1, true
+	case level > maxLevel:
+		return maxLevel, true
+	}
+	return level, false
+}
+
+// normalizeCompression selects gzip when no codec is given, checks the codec,
+// and clamps the level into its range.
+func normalizeCompression(compression ArchiveCompression) (ArchiveCompression, error) {
+	if compression.Codec == "" {
+		compression.Codec = CompressionGzip
+	}
+	if err := ValidateCompression(compression.Codec); err != nil {
+		return compression, err
+	}
+	compression.Level, _ = ClampCompressionLevel(compression.Codec, compression.Level)
+	return compression, nil
 }
 
-// BundleAndMaybeEncrypt creates a tar.gz archive of the artifacts directory,
-// optionally encrypting it with the provided age public key.
-func BundleAndMaybeEncrypt(ctx context.Context, artifactsDir, outDir, hostname string, timestamp time.Time, agePublicKey string) (*PackageMetadata, error) {
+// archiveExtension returns the archive name suffix for a codec.
+func archiveExtension(compression string) string {
+	if compression == CompressionZstd {
+		return ".tar.zst"
+	}
+	return ".tar.gz"
+}
+
+// BundleAndMaybeEncrypt creates a tar archive of the artifacts directory,
+// compressed with gzip or, when compression is CompressionZstd, zstd, and
+// optionally encrypting it as selected by encryption: to any mix of age and
+// SSH public keys, or with a passphrase. Files listed in
+// duplicates, as returned by CollectionManifest.Duplicates, and the files
+// they map to are stored once: the first of them the walk reaches is written
+// in full and the rest as tar hard links to it. A positive splitSize writes the
+// archive as volumes of at most splitSize bytes, named after it with .001,
+// .002, and so on appended, which concatenated in order are the archive.
+func BundleAndMaybeEncrypt(ctx context.Context, artifactsDir, outDir, hostname string, timestamp time.Time, encryption ArchiveEncryption, compression ArchiveCompression, splitSize int64, duplicates map[string]string) (*PackageMetadata, error) {
 	// Generate output filename
 	timeStr := timestamp.UTC().Format("20060102T150405Z")
-	baseFilename := fmt.Sprintf("cryptkeeper_%s_%s.tar.gz", hostname, timeStr)
+	compression, err := normalizeCompression(compression)
+	if err != nil {
+		return nil, err
+	}
+	baseFilename := fmt.Sprintf("cryptkeeper_%s_%s%s", hostname, timeStr, archiveExtension(compression.Codec))
 	
 	var outputPath string
 	var encrypted bool
 	
-	if agePublicKey != "" {
+	if encryption.Enabled() {
 		outputPath = filepath.Join(outDir, baseFilename+".age")
 		encrypted = true
 	} else {
@@ -41,48 +194,127 @@ func BundleAndMaybeEncrypt(ctx context.Context, artifactsDir, outDir, hostname s
 		encrypted = false
 	}
 
-	// Create output file
-	outFile, err := os.Create(outputPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create output file %s: %w", outputPath, err)
+	if err := CheckOutputDir(artifactsDir, outDir); err != nil {
+		return nil, err
+	}
+	// Reject bad keys before an empty archive is left behind
+	if _, err := encryption.recipients(); err != nil {
+		return nil, err
 	}
-	defer outFile.Close()
-
-	// Set up the writer pipeline
-	var gzWriter *gzip.Writer
-	var tarWriter *tar.Writer
-	var encWriter io.WriteCloser
-	var bytesWritten int64
 
-	if encrypted {
-		// Parse the age recipient
-		recipient, err := age.ParseX25519Recipient(agePublicKey)
+	// Create the output file, or the first of its volumes
+	var outFile *os.File
+	var volumes *volumeWriter
+	var isOutput func(os.FileInfo) bool
+	var dst io.Writer
+	if splitSize > 0 {
+		vw, err := newVolumeWriter(outputPath, splitSize)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse age public key: %w", err)
+			return nil, err
 		}
-
-		// Create encrypted writer
-		encWriter, err = age.Encrypt(outFile, recipient)
+		defer vw.finish()
+		volumes, isOutput, dst = vw, vw.isVolume, vw
+	} else {
+		file, err := os.Create(outputPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create age encryption writer: %w", err)
+			return nil, fmt.Errorf("failed to create output file %s: %w", outputPath, err)
+		}
+		defer file.Close()
+		outStat, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat output file %s: %w", outputPath, err)
 		}
+		outFile, dst = file, file
+		isOutput = func(info os.FileInfo) bool { return os.SameFile(info, outStat) }
+	}
+
+	// Set up the writer pipeline, hashing the archive as it is written
+	archiveHash := sha256.New()
+	bytesCounter := &countingWriter{wrapped: io.MultiWriter(dst, archiveHash)}
+	fileCount, deduplicated, err := writeArchive(ctx, bytesCounter, artifactsDir, timestamp, archiveWriterOptions{Encryption: encryption, Compression: compression}, duplicates, isOutput)
+	if err != nil {
+		return nil, err
+	}
+	var bytesWritten int64
 
-		// Create gzip writer on top of encrypted writer
-		gzWriter = gzip.NewWriter(encWriter)
+	// Get the final file size
+	var written []ArchiveVolume
+	if volumes != nil {
+		written, err = volumes.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, volume := range written {
+			bytesWritten += volume.Size
+		}
+	} else if stat, err := outFile.Stat(); err == nil {
+		bytesWritten = stat.Size()
 	} else {
-		// Create gzip writer directly on file
-		gzWriter = gzip.NewWriter(outFile)
+		bytesWritten = bytesCounter.count
 	}
 
-	// Create tar writer on top of gzip writer
-	tarWriter = tar.NewWriter(gzWriter)
+	return &PackageMetadata{
+		Path:             outputPath,
+		Encrypted:        encrypted,
+		Compression:      compression.Codec,
+		CompressionLevel: compression.Level,
+		FileCount:        fileCount,
+		BytesWritten:     bytesWritten,
+		SHA256:           hex.EncodeToString(archiveHash.Sum(nil)),
+		Deduplicated:     deduplicated,
+		Volumes:          written,
+	}, nil
+}
+
+// StreamArchive writes the archive of the artifacts directory to sink, as
+// BundleAndMaybeEncrypt would write it to a file, with the same compression
+// and encryption, for delivery that leaves no archive on the subject host.
+// The sink, e.g. an upload pipe, is left open. The metadata has no Path;
+// BytesWritten and SHA256 describe the bytes written to sink.
+func StreamArchive(ctx context.Context, artifactsDir string, sink io.Writer, timestamp time.Time, encryption ArchiveEncryption, compression ArchiveCompression, duplicates map[string]string) (*PackageMetadata, error) {
+	compression, err := normalizeCompression(compression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := encryption.recipients(); err != nil {
+		return nil, err
+	}
+
+	archiveHash := sha256.New()
+	bytesCounter := &countingWriter{wrapped: io.MultiWriter(sink, archiveHash)}
+	notOutput := func(os.FileInfo) bool { return false }
+	fileCount, deduplicated, err := writeArchive(ctx, bytesCounter, artifactsDir, timestamp, archiveWriterOptions{Encryption: encryption, Compression: compression}, duplicates, notOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PackageMetadata{
+		Encrypted:        encryption.Enabled(),
+		Compression:      compression.Codec,
+		CompressionLevel: compression.Level,
+		FileCount:        fileCount,
+		BytesWritten:     bytesCounter.count,
+		SHA256:           hex.EncodeToString(archiveHash.Sum(nil)),
+		Deduplicated:     deduplicated,
+	}, nil
+}
+
+// writeArchive writes the tar archive of artifactsDir to dst through the
+// writer stack opts selects, leaving out files isOutput reports as the
+// archive's own output. It returns the number of files stored, and how many
+// of them are hard links to duplicates. dst is left open.
+func writeArchive(ctx context.Context, dst io.Writer, artifactsDir string, timestamp time.Time, opts archiveWriterOptions, duplicates map[string]string, isOutput func(os.FileInfo) bool) (fileCount, deduplicated int, err error) {
+	archive, err := buildArchiveWriter(dst, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	tarWriter := archive.Writer
+	// storedAs maps each group of identical files, named by the file the
+	// others duplicate, to the one among them stored in full
+	storedAs := make(map[string]string)
 
-	// Track statistics
-	fileCount := 0
-	bytesCounter := &countingWriter{wrapped: tarWriter}
-	
 	// Walk the artifacts directory and add files to the archive
-	err = filepath.WalkDir(artifactsDir, func(path string, d os.DirEntry, err error) error {
+	err = winutil.StreamWalk(artifactsDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -99,6 +331,13 @@ func BundleAndMaybeEncrypt(ctx context.Context, artifactsDir, outDir, hostname s
 			return nil
 		}
 
+		// Never bundle the archive being written, whatever path reaches it
+		if !d.IsDir() {
+			if info, err := d.Info(); err == nil && isOutput(info) {
+				return nil
+			}
+		}
+
 		// Calculate relative path for the tar archive
 		relPath, err := filepath.Rel(artifactsDir, path)
 		if err != nil {
@@ -114,11 +353,41 @@ func BundleAndMaybeEncrypt(ctx context.Context, artifactsDir, outDir, hostname s
 				Name:     tarPath + "/",
 				Mode:     0755,
 				Typeflag: tar.TypeDir,
-				ModTime:  timestamp,
+				ModTime:  timestamp.Truncate(time.Second),
+				Format:   tar.FormatPAX,
 			}
 			return tarWriter.WriteHeader(header)
 		}
 
+		// A file whose content is already in the archive becomes a hard link.
+		// Walk order need not match manifest order, so whichever copy is
+		// reached first is stored in full, be it a duplicate or the original.
+		slashPath := filepath.ToSlash(relPath)
+		group := slashPath
+		if target, ok := duplicates[slashPath]; ok {
+			group = target
+		}
+		if target, ok := storedAs[group]; ok {
+			info, err := d.Info()
+			if err != nil {
+				return fmt.Errorf("failed to stat file %s: %w", path, err)
+			}
+			header := &tar.Header{
+				Name:     tarPath,
+				Linkname: archivePrefix + target,
+				Mode:     0644,
+				Typeflag: tar.TypeLink,
+				ModTime:  info.ModTime().Truncate(time.Second),
+				Format:   tar.FormatPAX,
+			}
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return fmt.Errorf("failed to write tar link for %s: %w", path, err)
+			}
+			fileCount++
+			deduplicated++
+			return nil
+		}
+
 		// Handle regular files
 		file, err := os.Open(path)
 		if err != nil {
@@ -132,12 +401,15 @@ func BundleAndMaybeEncrypt(ctx context.Context, artifactsDir, outDir, hostname s
 			return fmt.Errorf("failed to stat file %s: %w", path, err)
 		}
 
-		// Create tar header
+		// Create tar header. PAX records carry names that are not ASCII or
+		// exceed the USTAR limits (user profiles with Cyrillic or CJK names)
+		// as UTF-8 in full; whole-second times keep them off every other entry
 		header := &tar.Header{
 			Name:    tarPath,
 			Mode:    0644,
 			Size:    info.Size(),
-			ModTime: info.ModTime(),
+			ModTime: info.ModTime().Truncate(time.Second),
+			Format:  tar.FormatPAX,
 		}
 
 		if err := tarWriter.WriteHeader(header); err != nil {
@@ -145,46 +417,103 @@ func BundleAndMaybeEncrypt(ctx context.Context, artifactsDir, outDir, hostname s
 		}
 
 		// Copy file contents using streaming I/O
-		if _, err := io.Copy(bytesCounter, file); err != nil {
+		if _, err := io.Copy(tarWriter, file); err != nil {
 			return fmt.Errorf("failed to copy file %s to archive: %w", path, err)
 		}
 
 		fileCount++
+		storedAs[group] = slashPath
 		return nil
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to walk artifacts directory: %w", err)
+		return 0, 0, fmt.Errorf("failed to walk artifacts directory: %w", err)
 	}
 
-	// Close writers in correct order
-	if err := tarWriter.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close tar writer: %w", err)
+	// Flush the tar writer, then the compressor, then the encryptor
+	if err := archive.Close(); err != nil {
+		return 0, 0, err
 	}
+	return fileCount, deduplicated, nil
+}
 
-	if err := gzWriter.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close gzip writer: %w", err)
-	}
 
-	if encrypted {
-		if err := encWriter.Close(); err != nil {
-			return nil, fmt.Errorf("failed to close age encryption writer: %w", err)
+// archiveWriterOptions selects the compression and encryption layers of an archive.
+type archiveWriterOptions struct {
+	Encryption  ArchiveEncryption  // Disabled unless Enabled reports true
+	Compression ArchiveCompression // Level already clamped
+}
+
+// archiveLayer is one stage of the writer stack beneath the tar writer.
+type archiveLayer struct {
+	name   string
+	closer io.Closer
+}
+
+// archiveWriter is the tar → gzip or zstd → age writer stack. Every archive output
+// path builds it through buildArchiveWriter so the layers cannot drift apart.
+type archiveWriter struct {
+	*tar.Writer
+	layers []archiveLayer // In the order added: innermost (closest to dst) first, so age precedes the compressor
+}
+
+// buildArchiveWriter composes the archive writer stack on top of dst.
+func buildArchiveWriter(dst io.Writer, opts archiveWriterOptions) (*archiveWriter, error) {
+	aw := &archiveWriter{}
+	w := dst
+
+	if opts.Encryption.Enabled() {
+		recipients, err := opts.Encryption.recipients()
+		if err != nil {
+			return nil, err
 		}
+
+		// Create encrypted writer
+		encWriter, err := age.Encrypt(w, recipients...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create age encryption writer: %w", err)
+		}
+		aw.layers = append(aw.layers, archiveLayer{name: "age encryption", closer: encWriter})
+		w = encWriter
 	}
 
-	// Get the final file size
-	if stat, err := outFile.Stat(); err == nil {
-		bytesWritten = stat.Size()
+	// Create the compressor on top of the encrypted writer or the file
+	var compressed io.Writer
+	if opts.Compression.Codec == CompressionZstd {
+		zstdWriter, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(opts.Compression.Level)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		aw.layers = append(aw.layers, archiveLayer{name: "zstd", closer: zstdWriter})
+		compressed = zstdWriter
 	} else {
-		bytesWritten = bytesCounter.count
+		gzWriter, err := gzip.NewWriterLevel(w, opts.Compression.Level)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip writer: %w", err)
+		}
+		aw.layers = append(aw.layers, archiveLayer{name: "gzip", closer: gzWriter})
+		compressed = gzWriter
 	}
 
-	return &PackageMetadata{
-		Path:         outputPath,
-		Encrypted:    encrypted,
-		FileCount:    fileCount,
-		BytesWritten: bytesWritten,
-	}, nil
+	// Create tar writer on top of the compressor
+	aw.Writer = tar.NewWriter(compressed)
+	return aw, nil
+}
+
+// Close flushes and closes the tar writer and then every layer beneath it,
+// in reverse of the order they were added: the compressor has flushed its
+// last block into age before age writes its final chunk. The underlying
+// destination is left open for the caller.
+func (aw *archiveWriter) Close() error {
+	if err := aw.Writer.Close(); err != nil {
+		return fmt.Errorf("failed to close tar writer: %w", err)
+	}
+	for i := len(aw.layers) - 1; i >= 0; i-- {
+		if err := aw.layers[i].closer.Close(); err != nil {
+			return fmt.Errorf("failed to close %s writer: %w", aw.layers[i].name, err)
+		}
+	}
+	return nil
 }
 
 // countingWriter wraps another writer and counts bytes written.
@@ -202,6 +531,9 @@ func (c *countingWriter) Write(p []byte) (int, error) {
 // ValidateAgePublicKey validates that a string is a valid age public key.
 func ValidateAgePublicKey(key string) error {
 	if !strings.HasPrefix(key, "age1") {
+		if strings.HasPrefix(key, "ssh-") {
+			return fmt.Errorf("%s is an SSH public key; pass it with --encrypt-ssh", strings.Fields(key)[0])
+		}
 		return fmt.Errorf("age public key must start with 'age1'")
 	}
 	
@@ -211,4 +543,42 @@ func ValidateAgePublicKey(key string) error {
 	}
 	
 	return nil
-}
\ No newline at end of file
+}
+
+// ValidateAgePublicKeys validates every key in a list of age public keys,
+// naming the first one that is malformed.
+func ValidateAgePublicKeys(keys []string) error {
+	for i, key := range keys {
+		if err := ValidateAgePublicKey(key); err != nil {
+			return fmt.Errorf("recipient %d (%q): %w", i+1, key, err)
+		}
+	}
+	return nil
+}
+
+// ValidateSSHRecipient validates that a string is an SSH public key age can
+// encrypt to: an ssh-ed25519 or ssh-rsa key in authorized_keys form, e.g.
+// "ssh-ed25519 AAAA... analyst@example".
+func ValidateSSHRecipient(key string) error {
+	if _, err := agessh.ParseRecipient(key); err != nil {
+		return fmt.Errorf("invalid SSH public key: %w", err)
+	}
+	return nil
+}
+
+// ParseRecipient parses an age public key (age1...) or an SSH public key
+// into an age recipient.
+func ParseRecipient(key string) (age.Recipient, error) {
+	if strings.HasPrefix(key, "age1") {
+		recipient, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse age public key: %w", err)
+		}
+		return recipient, nil
+	}
+	recipient, err := agessh.ParseRecipient(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH public key: %w", err)
+	}
+	return recipient, nil
+}
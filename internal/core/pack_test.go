@@ -0,0 +1,598 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/ssh"
+)
+
+// testTimestamp is the collection time of test archives.
+var testTimestamp = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestCollection writes an artifacts directory holding files, keyed by
+// slash path, and its root manifest.
+func newTestCollection(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest, err := BuildCollectionManifest(context.Background(), dir, "host", testRunID, testTimestamp, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCollectionManifest(dir, manifest, ManifestFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// defaultTestFiles is the content of a small collection.
+var defaultTestFiles = map[string]string{
+	"sysinfo/host.json":          `{"hostname":"host"}`,
+	"windows/evtx/Security.evtx": string(bytes.Repeat([]byte("event "), 4096)),
+	"tool_info.json":             `{"version":"test"}`,
+}
+
+// newTestIdentity returns a new age identity.
+func newTestIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+func TestStreamArchiveZstdAgeVerifies(t *testing.T) {
+	artifactsDir := newTestCollection(t, defaultTestFiles)
+	responder, escrow := newTestIdentity(t), newTestIdentity(t)
+	encryption := ArchiveEncryption{Recipients: []string{responder.Recipient().String(), escrow.Recipient().String()}}
+
+	var sink bytes.Buffer
+	meta, err := StreamArchive(context.Background(), artifactsDir, &sink, testTimestamp, encryption, ArchiveCompression{Codec: CompressionZstd, Level: 19}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.Encrypted || meta.Compression != CompressionZstd || meta.CompressionLevel != 19 || meta.BytesWritten != int64(sink.Len()) {
+		t.Fatalf("metadata = %+v for %d bytes", meta, sink.Len())
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "streamed.tar.zst.age")
+	if err := os.WriteFile(archivePath, sink.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Any one recipient's identity decrypts it
+	for _, identity := range []age.Identity{responder, escrow} {
+		report, err := VerifyArchive(context.Background(), archivePath, []age.Identity{identity}, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.Encrypted || !report.OK() {
+			t.Fatalf("streamed archive did not verify: %+v", report)
+		}
+		if report.Checked != len(defaultTestFiles) {
+			t.Fatalf("checked %d files, want %d", report.Checked, len(defaultTestFiles))
+		}
+	}
+}
+
+func TestStreamArchiveMatchesBundle(t *testing.T) {
+	artifactsDir := newTestCollection(t, defaultTestFiles)
+	for _, codec := range []string{CompressionGzip, CompressionZstd} {
+		t.Run(codec, func(t *testing.T) {
+			compression := ArchiveCompression{Codec: codec, Level: 5}
+			meta, err := BundleAndMaybeEncrypt(context.Background(), artifactsDir, t.TempDir(), "host", testTimestamp, ArchiveEncryption{}, compression, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bundled, err := os.ReadFile(meta.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sink bytes.Buffer
+			streamed, err := StreamArchive(context.Background(), artifactsDir, &sink, testTimestamp, ArchiveEncryption{}, compression, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sink.Bytes(), bundled) {
+				t.Fatal("streamed archive differs from the bundled one")
+			}
+			if streamed.SHA256 != meta.SHA256 || streamed.FileCount != meta.FileCount {
+				t.Fatalf("streamed %+v, bundled %+v", streamed, meta)
+			}
+		})
+	}
+}
+
+func TestBundleExtractsForEachCodec(t *testing.T) {
+	artifactsDir := newTestCollection(t, defaultTestFiles)
+	identity := newTestIdentity(t)
+	tests := []struct {
+		codec      string
+		encryption ArchiveEncryption
+		identities []age.Identity
+		suffix     string
+	}{
+		{CompressionGzip, ArchiveEncryption{}, nil, ".tar.gz"},
+		{CompressionZstd, ArchiveEncryption{}, nil, ".tar.zst"},
+		{CompressionGzip, ArchiveEncryption{Recipients: []string{identity.Recipient().String()}}, []age.Identity{identity}, ".tar.gz.age"},
+		{CompressionZstd, ArchiveEncryption{Recipients: []string{identity.Recipient().String()}}, []age.Identity{identity}, ".tar.zst.age"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimPrefix(tt.suffix, "."), func(t *testing.T) {
+			meta, err := BundleAndMaybeEncrypt(context.Background(), artifactsDir, t.TempDir(), "host", testTimestamp, tt.encryption, ArchiveCompression{Codec: tt.codec}, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(meta.Path, tt.suffix) {
+				t.Fatalf("archive %s does not end in %s", meta.Path, tt.suffix)
+			}
+			if meta.Compression != tt.codec {
+				t.Fatalf("metadata records %q compression, want %q", meta.Compression, tt.codec)
+			}
+
+			outDir := t.TempDir()
+			report, err := ExtractArchive(context.Background(), meta.Path, outDir, nil, tt.identities)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() {
+				t.Fatalf("extraction did not verify: %+v", report)
+			}
+			for name, want := range defaultTestFiles {
+				got, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Fatalf("%s extracted with different content", name)
+				}
+			}
+		})
+	}
+}
+
+func TestBundleKeepsUnicodeNames(t *testing.T) {
+	// A profile name past the 100-byte USTAR name field once encoded as UTF-8
+	const name = "windows_custompaths/C/Users/山田太郎/Documents/議事録_2024年3月_最終版_ドラフト.docx"
+	content := "PK\x03\x04 議事録"
+	files := map[string]string{name: content}
+	for file, data := range defaultTestFiles {
+		files[file] = data
+	}
+	archive := bundleTestCollection(t, newTestCollection(t, files))
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	found := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(header.Name, "/"+name) {
+			continue
+		}
+		found = true
+		if header.Format != tar.FormatPAX {
+			t.Errorf("entry written in %v, want PAX", header.Format)
+		}
+		if header.Size != int64(len(content)) {
+			t.Errorf("entry size = %d, want %d", header.Size, len(content))
+		}
+	}
+	if !found {
+		t.Fatalf("archive has no entry named %s", name)
+	}
+
+	outDir := t.TempDir()
+	report, err := ExtractArchive(context.Background(), archive, outDir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("extraction did not verify: %+v", report)
+	}
+	got, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Fatalf("%s extracted as %q, want %q", name, got, content)
+	}
+}
+
+func TestClampCompressionLevel(t *testing.T) {
+	tests := []struct {
+		codec   string
+		level   int
+		want    int
+		clamped bool
+	}{
+		{CompressionGzip, 0, DefaultGzipLevel, false},
+		{CompressionGzip, 1, 1, false},
+		{CompressionGzip, 12, MaxGzipLevel, true},
+		{CompressionGzip, -3, 1, true},
+		{CompressionZstd, 0, DefaultZstdLevel, false},
+		{CompressionZstd, 12, 12, false},
+		{CompressionZstd, 30, MaxZstdLevel, true},
+	}
+	for _, tt := range tests {
+		if got, clamped := ClampCompressionLevel(tt.codec, tt.level); got != tt.want || clamped != tt.clamped {
+			t.Errorf("ClampCompressionLevel(%s, %d) = %d, %v; want %d, %v", tt.codec, tt.level, got, clamped, tt.want, tt.clamped)
+		}
+	}
+}
+
+func TestBundlePassesGzipLevelThrough(t *testing.T) {
+	artifactsDir := newTestCollection(t, compressionCorpus(256<<10))
+	// The gzip header's extra flags record the fastest and the best levels
+	xfl := map[int]byte{1: 4, 9: 2}
+	sizes := make(map[int]int64)
+	for level, want := range xfl {
+		meta, err := BundleAndMaybeEncrypt(context.Background(), artifactsDir, t.TempDir(), "host", testTimestamp, ArchiveEncryption{}, ArchiveCompression{Codec: CompressionGzip, Level: level}, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.CompressionLevel != level {
+			t.Fatalf("metadata records level %d, want %d", meta.CompressionLevel, level)
+		}
+		archive, err := os.ReadFile(meta.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if archive[8] != want {
+			t.Fatalf("level %d archive has gzip extra flags %d, want %d", level, archive[8], want)
+		}
+		sizes[level] = meta.BytesWritten
+	}
+	if sizes[9] >= sizes[1] {
+		t.Fatalf("level 9 archive is %d bytes, not smaller than level 1's %d", sizes[9], sizes[1])
+	}
+}
+
+// compressionCorpus returns a fixed collection of about size bytes of
+// compressible, log-like text.
+func compressionCorpus(size int) map[string]string {
+	rng := mathrand.New(mathrand.NewSource(1))
+	words := []string{"svchost.exe", "logon", "4624", "NT AUTHORITY\\SYSTEM", "C:\\Windows\\System32", "failed", "0x0", "explorer.exe", "HKLM\\SOFTWARE"}
+	files := make(map[string]string)
+	for i := 0; i < 8; i++ {
+		var b strings.Builder
+		for b.Len() < size/8 {
+			fmt.Fprintf(&b, "%d %s %s\n", rng.Int63(), words[rng.Intn(len(words))], words[rng.Intn(len(words))])
+		}
+		files[fmt.Sprintf("windows/evtx/log%d.txt", i)] = b.String()
+	}
+	return files
+}
+
+func BenchmarkBundleGzipLevel(b *testing.B) {
+	dir := b.TempDir()
+	for name, content := range compressionCorpus(8 << 20) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for _, level := range []int{1, 9} {
+		b.Run(fmt.Sprintf("level%d", level), func(b *testing.B) {
+			outDir := b.TempDir()
+			var written int64
+			for i := 0; i < b.N; i++ {
+				meta, err := BundleAndMaybeEncrypt(context.Background(), dir, outDir, "host", testTimestamp, ArchiveEncryption{}, ArchiveCompression{Codec: CompressionGzip, Level: level}, 0, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				written = meta.BytesWritten
+			}
+			b.ReportMetric(float64(written), "archive-bytes")
+		})
+	}
+}
+
+// newTestSSHKey returns an ssh-ed25519 public key in authorized_keys form and
+// the path of its unencrypted OpenSSH private key.
+func newTestSSHKey(t *testing.T) (string, string) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(private, "analyst@example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublic))) + " analyst@example"
+	return authorizedKey, keyPath
+}
+
+func TestSSHRecipientRoundTrip(t *testing.T) {
+	artifactsDir := newTestCollection(t, defaultTestFiles)
+	recipient, keyPath := newTestSSHKey(t)
+	if err := ValidateSSHRecipient(recipient); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := BundleAndMaybeEncrypt(context.Background(), artifactsDir, t.TempDir(), "host", testTimestamp, ArchiveEncryption{Recipients: []string{recipient}}, ArchiveCompression{}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identities, err := LoadAgeIdentities(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	report, err := ExtractArchive(context.Background(), meta.Path, outDir, nil, identities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Extracted != len(defaultTestFiles) {
+		t.Fatalf("extraction with the SSH identity did not verify: %+v", report)
+	}
+	got, err := os.ReadFile(filepath.Join(outDir, "sysinfo", "host.json"))
+	if err != nil || string(got) != defaultTestFiles["sysinfo/host.json"] {
+		t.Fatalf("host.json = %q, %v", got, err)
+	}
+
+	// Another responder's SSH key does not open it
+	_, otherKeyPath := newTestSSHKey(t)
+	other, err := LoadAgeIdentities(otherKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExtractArchive(context.Background(), meta.Path, t.TempDir(), nil, other); err == nil {
+		t.Fatal("archive opened with the wrong SSH identity")
+	}
+}
+
+// archiveEntries reads the headers of an unencrypted gzip archive, keyed by
+// path relative to the artifacts directory.
+func archiveEntries(t *testing.T, archive string) map[string]*tar.Header {
+	t.Helper()
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]*tar.Header)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[strings.TrimPrefix(header.Name, archivePrefix)] = header
+	}
+}
+
+// dedupTestFiles hold one system DLL copied by three modules.
+func dedupTestFiles() (map[string]string, string) {
+	dll := make([]byte, 64<<10)
+	mathrand.New(mathrand.NewSource(7)).Read(dll)
+	return map[string]string{
+		"windows_custompaths/C/Windows/System32/wintrust.dll": string(dll),
+		"windows_services/binaries/wintrust.dll":              string(dll),
+		"windows_signatures/System32/wintrust.dll":            string(dll),
+		"windows_prefetch/WINTRUST.DLL-0B1C2D3E.pf":           "prefetch",
+		"windows_evtx/empty1.evtx":                            "",
+		"windows_evtx/empty2.evtx":                            "",
+	}, string(dll)
+}
+
+func TestBundleDedupStoresContentOnce(t *testing.T) {
+	files, dll := dedupTestFiles()
+	dir := newTestCollection(t, files)
+	manifest, err := ReadCollectionManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Empty files are identical too, but there is nothing to save
+	if count, saved := manifest.MarkDuplicates(); count != 2 || saved != int64(2*len(dll)) {
+		t.Fatalf("MarkDuplicates = %d, %d", count, saved)
+	}
+	duplicates := manifest.Duplicates()
+	want := map[string]string{
+		"windows_services/binaries/wintrust.dll":   "windows_custompaths/C/Windows/System32/wintrust.dll",
+		"windows_signatures/System32/wintrust.dll": "windows_custompaths/C/Windows/System32/wintrust.dll",
+	}
+	if !reflect.DeepEqual(duplicates, want) {
+		t.Fatalf("duplicates = %v, want %v", duplicates, want)
+	}
+	if err := WriteCollectionManifest(dir, manifest, ManifestFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := BundleAndMaybeEncrypt(context.Background(), dir, t.TempDir(), "host", testTimestamp, ArchiveEncryption{}, ArchiveCompression{}, 0, duplicates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Deduplicated != 2 || meta.FileCount != len(files)+1 {
+		t.Fatalf("metadata = %+v", meta)
+	}
+	// Random bytes do not compress, so a second copy would double the archive
+	if info, err := os.Stat(meta.Path); err != nil || info.Size() > int64(len(dll))+16<<10 {
+		t.Fatalf("archive of one %d-byte file is %d bytes (%v)", len(dll), info.Size(), err)
+	}
+	var full []string
+	var links int
+	entries := archiveEntries(t, meta.Path)
+	for name := range files {
+		header := entries[name]
+		switch {
+		case header == nil:
+			t.Fatalf("%s is not in the archive", name)
+		case header.Typeflag == tar.TypeLink:
+			links++
+		case header.Size == int64(len(dll)):
+			full = append(full, name)
+		}
+	}
+	if len(full) != 1 || links != 2 {
+		t.Fatalf("DLL stored in full as %v and as %d links", full, links)
+	}
+
+	// Extraction rehydrates every copy, and the result verifies
+	outDir := t.TempDir()
+	report, err := ExtractArchive(context.Background(), meta.Path, outDir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("extraction did not verify: %+v", report)
+	}
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+		if err != nil || string(got) != content {
+			t.Fatalf("%s extracted with %d bytes, want %d (%v)", name, len(got), len(content), err)
+		}
+	}
+}
+
+func TestBundleDedupIgnoresWalkOrder(t *testing.T) {
+	// Whichever copy the walk reaches first is stored, and the other linked,
+	// whether or not it is the copy the mapping names as the original
+	files := map[string]string{"a/tool.exe": "MZ tool", "b/tool.exe": "MZ tool"}
+	dir := newTestCollection(t, files)
+	for _, duplicates := range []map[string]string{
+		{"b/tool.exe": "a/tool.exe"},
+		{"a/tool.exe": "b/tool.exe"},
+	} {
+		meta, err := BundleAndMaybeEncrypt(context.Background(), dir, t.TempDir(), "host", testTimestamp, ArchiveEncryption{}, ArchiveCompression{}, 0, duplicates)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries := archiveEntries(t, meta.Path)
+		a, b := entries["a/tool.exe"], entries["b/tool.exe"]
+		if meta.Deduplicated != 1 || (a.Typeflag == tar.TypeLink) == (b.Typeflag == tar.TypeLink) {
+			t.Fatalf("with %v: a is type %c, b is type %c", duplicates, a.Typeflag, b.Typeflag)
+		}
+	}
+}
+
+func TestBundleNeverIncludesItsArchive(t *testing.T) {
+	// Random content keeps the archive large enough to split
+	image := make([]byte, 16*1024)
+	mathrand.New(mathrand.NewSource(3)).Read(image)
+	files := map[string]string{"windows/wsl/ext4.vhdx": string(image)}
+	for name, content := range defaultTestFiles {
+		files[name] = content
+	}
+	artifactsDir := newTestCollection(t, files)
+	compression := ArchiveCompression{Codec: CompressionGzip}
+
+	// With --out left empty the archive goes next to the artifacts directory
+	parent := filepath.Dir(artifactsDir)
+	meta, err := BundleAndMaybeEncrypt(context.Background(), artifactsDir, parent, "host", testTimestamp, ArchiveEncryption{}, compression, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := archiveEntries(t, meta.Path)
+	for name := range want {
+		if strings.Contains(name, "cryptkeeper_host_") {
+			t.Fatalf("archive includes %s", name)
+		}
+	}
+
+	// A link can place the output inside the tree under a path that does not
+	// look like it; the archive, or each of its volumes, is still left out
+	link := filepath.Join(t.TempDir(), "out")
+	if err := os.Symlink(filepath.Join(artifactsDir, "windows"), link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	for _, splitSize := range []int64{0, 4096} {
+		meta, err := BundleAndMaybeEncrypt(context.Background(), artifactsDir, link, "host", testTimestamp.Add(time.Minute), ArchiveEncryption{}, compression, splitSize, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archive := meta.Path
+		if splitSize > 0 {
+			if len(meta.Volumes) < 2 {
+				t.Fatalf("split into %d volumes", len(meta.Volumes))
+			}
+			var joined bytes.Buffer
+			for _, volume := range meta.Volumes {
+				data, err := os.ReadFile(volume.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				joined.Write(data)
+			}
+			archive = filepath.Join(t.TempDir(), "joined.tar.gz")
+			if err := os.WriteFile(archive, joined.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got := archiveEntries(t, archive)
+		for name := range got {
+			if _, ok := want[name]; !ok {
+				t.Errorf("split size %d: archive includes %s", splitSize, name)
+			}
+		}
+		if len(got) != len(want) {
+			t.Errorf("split size %d: %d entries, want %d", splitSize, len(got), len(want))
+		}
+		os.Remove(meta.Path)
+		for _, volume := range meta.Volumes {
+			os.Remove(volume.Path)
+		}
+	}
+
+	// An output directory that is plainly inside the tree is refused
+	if _, err := BundleAndMaybeEncrypt(context.Background(), artifactsDir, filepath.Join(artifactsDir, "windows"), "host", testTimestamp, ArchiveEncryption{}, compression, 0, nil); err == nil || !strings.Contains(err.Error(), "would include itself") {
+		t.Fatalf("output inside the artifacts directory = %v", err)
+	}
+}
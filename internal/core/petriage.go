@@ -0,0 +1,377 @@
+package core
+
+import (
+	"context"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// PETriageName is the file name of the PE triage report in the artifacts directory.
+const PETriageName = "pe_triage.json"
+
+// PackedEntropy is the section entropy, in bits per byte, at or above which
+// a section is taken to hold compressed or encrypted code.
+const PackedEntropy = 7.2
+
+// Findings recorded on triaged executables.
+const (
+	PEFindingHighEntropy    = "high_entropy_section"  // An executable or writable section's entropy is at or above PackedEntropy
+	PEFindingPackerSection  = "packer_section_name"   // A section carries the name a known packer gives it
+	PEFindingTimestampZero  = "timestamp_zero"        // The header compile time is unset
+	PEFindingTimestampEarly = "timestamp_before_1993" // The compile time predates the PE format
+	PEFindingTimestampAhead = "timestamp_in_future"   // The compile time is after the collection
+)
+
+// peSignature is the "PE\0\0" signature whose offset e_lfanew records.
+const peSignature = 0x00004550
+
+// imageFileDLL is the COFF characteristics bit of a DLL.
+const imageFileDLL = 0x2000
+
+// imageDebugTypeRepro marks a reproducible build, whose TimeDateStamp is a
+// content hash rather than a compile time.
+const imageDebugTypeRepro = 16
+
+// peEpoch is the earliest plausible compile time: the PE format shipped with
+// Windows NT 3.1 in 1993.
+var peEpoch = time.Date(1993, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// packerSections are section names written by common packers and protectors.
+var packerSections = map[string]bool{
+	"upx0": true, "upx1": true, "upx2": true, ".aspack": true, ".adata": true,
+	".mpress1": true, ".mpress2": true, ".petite": true, ".themida": true,
+	".vmp0": true, ".vmp1": true, ".enigma1": true, ".nsp0": true, ".nsp1": true,
+}
+
+// suspiciousImports are APIs used for process injection, credential dumping,
+// and hooking. A or W suffixes are ignored when matching.
+var suspiciousImports = map[string]bool{
+	"VirtualAllocEx": true, "WriteProcessMemory": true, "ReadProcessMemory": true,
+	"CreateRemoteThread": true, "CreateRemoteThreadEx": true, "NtCreateThreadEx": true,
+	"RtlCreateUserThread": true, "QueueUserAPC": true, "NtQueueApcThread": true,
+	"SetThreadContext": true, "NtUnmapViewOfSection": true, "ZwUnmapViewOfSection": true,
+	"NtWriteVirtualMemory": true, "SetWindowsHookEx": true, "MiniDumpWriteDump": true,
+	"IsDebuggerPresent": true, "CheckRemoteDebuggerPresent": true,
+}
+
+// PESection describes one section of a triaged executable.
+type PESection struct {
+	Name        string  `json:"name"`
+	VirtualSize uint32  `json:"virtual_size"`
+	RawSize     uint32  `json:"raw_size"`
+	Entropy     float64 `json:"entropy"` // Shannon entropy of the raw data, in bits per byte
+	Executable  bool    `json:"executable"`
+	Writable    bool    `json:"writable"`
+	HighEntropy bool    `json:"high_entropy,omitempty"`
+	PackerName  bool    `json:"packer_name,omitempty"`
+}
+
+// PETriageEntry is the triage of one collected executable.
+type PETriageEntry struct {
+	Path              string      `json:"path"`   // Slash-separated path relative to the artifacts directory
+	Module            string      `json:"module"` // Module that collected the file
+	Machine           string      `json:"machine,omitempty"`
+	Is64Bit           bool        `json:"is_64bit"`
+	IsDLL             bool        `json:"is_dll"`
+	Subsystem         uint16      `json:"subsystem,omitempty"`
+	TimeDateStamp     uint32      `json:"time_date_stamp"`
+	CompileTimeUTC    string      `json:"compile_time_utc,omitempty"`
+	Reproducible      bool        `json:"reproducible,omitempty"` // TimeDateStamp is a build hash, not a time
+	Sections          []PESection `json:"sections,omitempty"`
+	ImportedLibraries []string    `json:"imported_libraries,omitempty"`
+	ImportCount       int         `json:"import_count"`
+	SuspiciousImports []string    `json:"suspicious_imports,omitempty"`
+	Packed            bool        `json:"packed"`
+	Findings          []string    `json:"findings,omitempty"`
+	Error             string      `json:"error,omitempty"`
+}
+
+// PETriageReport is the content of pe_triage.json.
+type PETriageReport struct {
+	CreatedUTC   string          `json:"created_utc"`
+	Host         string          `json:"host"`
+	RunID        string          `json:"run_id,omitempty"`
+	Modules      []string        `json:"modules"`       // Modules whose files were checked
+	FilesChecked int             `json:"files_checked"` // Files read for an MZ header
+	PECount      int             `json:"pe_count"`
+	FlaggedCount int             `json:"flagged_count"`
+	Files        []PETriageEntry `json:"files"`
+}
+
+// TriagePEFiles parses the headers of every executable that the given
+// modules collected, as listed in the collection manifest. Files that do not
+// start with an MZ header are skipped; executables that fail to parse, such
+// as tail-copied ones, are reported with the error.
+func TriagePEFiles(ctx context.Context, artifactsDir string, manifest *CollectionManifest, modules []string, now time.Time) (*PETriageReport, error) {
+	report := &PETriageReport{
+		CreatedUTC: winutil.FormatTime(now),
+		Host:       manifest.Host,
+		RunID:      manifest.RunID,
+		Modules:    modules,
+		Files:      make([]PETriageEntry, 0),
+	}
+
+	moduleByDir := make(map[string]string, len(modules))
+	for _, name := range modules {
+		moduleByDir[SanitizeName(name)] = name
+	}
+
+	for _, file := range manifest.Files {
+		select {
+		case <-ctx.Done():
+			return report, ctx.Err()
+		default:
+		}
+		dir, _, _ := strings.Cut(file.Path, "/")
+		module, ok := moduleByDir[dir]
+		if !ok {
+			continue
+		}
+
+		report.FilesChecked++
+		path := filepath.Join(artifactsDir, filepath.FromSlash(file.Path))
+		if !hasMZHeader(path) {
+			continue
+		}
+		entry := TriagePE(path, now)
+		entry.Path = file.Path
+		entry.Module = module
+		report.PECount++
+		if len(entry.Findings) > 0 {
+			report.FlaggedCount++
+		}
+		report.Files = append(report.Files, entry)
+	}
+
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].Path < report.Files[j].Path })
+	return report, nil
+}
+
+// TriagePE parses the COFF and optional headers, section table, and import
+// table of the executable at path. now bounds a plausible compile time.
+func TriagePE(path string, now time.Time) (entry PETriageEntry) {
+	// Malformed headers in hostile files must not stop the run
+	defer func() {
+		if r := recover(); r != nil {
+			entry = PETriageEntry{Error: fmt.Sprintf("malformed executable: %v", r)}
+		}
+	}()
+
+	file, err := pe.Open(path)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	defer file.Close()
+
+	entry.Machine = machineName(file.Machine)
+	entry.IsDLL = file.Characteristics&imageFileDLL != 0
+	entry.TimeDateStamp = file.TimeDateStamp
+	switch header := file.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		entry.Subsystem = header.Subsystem
+	case *pe.OptionalHeader64:
+		entry.Is64Bit = true
+		entry.Subsystem = header.Subsystem
+	}
+	entry.Reproducible = isReproducible(file)
+
+	for _, section := range file.Sections {
+		info := PESection{
+			Name:        section.Name,
+			VirtualSize: section.VirtualSize,
+			RawSize:     section.Size,
+			Executable:  section.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE != 0,
+			Writable:    section.Characteristics&pe.IMAGE_SCN_MEM_WRITE != 0,
+		}
+		if section.Size > 0 {
+			entropy, err := ShannonEntropy(section.Open())
+			if err != nil {
+				entry.Error = fmt.Sprintf("section %s: %v", section.Name, err)
+			}
+			info.Entropy = math.Round(entropy*1000) / 1000
+		}
+		info.HighEntropy = info.Entropy >= PackedEntropy
+		info.PackerName = packerSections[strings.ToLower(section.Name)]
+		// Read-only data such as resources or compressed debug info is often
+		// dense; packed code lands in sections that execute or are unpacked into
+		if info.HighEntropy && (info.Executable || info.Writable) {
+			entry.Findings = appendOnce(entry.Findings, PEFindingHighEntropy)
+		}
+		if info.PackerName {
+			entry.Findings = appendOnce(entry.Findings, PEFindingPackerSection)
+		}
+		entry.Sections = append(entry.Sections, info)
+	}
+	entry.Packed = len(entry.Findings) > 0
+
+	// Symbols read "name:library"; debug/pe's ImportedLibraries is a stub
+	// that returns nothing for PE files
+	if symbols, err := file.ImportedSymbols(); err == nil {
+		entry.ImportCount = len(symbols)
+		for _, symbol := range symbols {
+			name, library, _ := strings.Cut(symbol, ":")
+			if library != "" {
+				entry.ImportedLibraries = appendOnce(entry.ImportedLibraries, library)
+			}
+			if suspiciousImports[name] || suspiciousImports[strings.TrimSuffix(strings.TrimSuffix(name, "A"), "W")] {
+				entry.SuspiciousImports = appendOnce(entry.SuspiciousImports, name)
+			}
+		}
+		sort.Strings(entry.SuspiciousImports)
+	} else if entry.Error == "" {
+		entry.Error = fmt.Sprintf("imports: %v", err)
+	}
+
+	if !entry.Reproducible {
+		compiled := time.Unix(int64(file.TimeDateStamp), 0).UTC()
+		switch {
+		case file.TimeDateStamp == 0:
+			entry.Findings = append(entry.Findings, PEFindingTimestampZero)
+		case compiled.Before(peEpoch):
+			entry.Findings = append(entry.Findings, PEFindingTimestampEarly)
+		case compiled.After(now.Add(24 * time.Hour)):
+			entry.Findings = append(entry.Findings, PEFindingTimestampAhead)
+		}
+		if file.TimeDateStamp != 0 {
+			entry.CompileTimeUTC = winutil.FormatTime(compiled)
+		}
+	}
+	return entry
+}
+
+// ShannonEntropy returns the entropy of everything r yields, in bits per byte.
+func ShannonEntropy(r io.Reader) (float64, error) {
+	var counts [256]int64
+	var total int64
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			counts[b]++
+		}
+		total += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if total == 0 {
+		return 0, nil
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy, nil
+}
+
+// isReproducible reports whether the debug directory has a reproducible
+// build entry.
+func isReproducible(file *pe.File) bool {
+	var debugDir pe.DataDirectory
+	switch header := file.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if header.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_DEBUG {
+			debugDir = header.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_DEBUG]
+		}
+	case *pe.OptionalHeader64:
+		if header.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_DEBUG {
+			debugDir = header.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_DEBUG]
+		}
+	}
+	if debugDir.Size == 0 {
+		return false
+	}
+
+	for _, section := range file.Sections {
+		if debugDir.VirtualAddress < section.VirtualAddress || debugDir.VirtualAddress >= section.VirtualAddress+section.VirtualSize {
+			continue
+		}
+		data := make([]byte, debugDir.Size)
+		if _, err := section.ReadAt(data, int64(debugDir.VirtualAddress-section.VirtualAddress)); err != nil {
+			return false
+		}
+		// Each IMAGE_DEBUG_DIRECTORY is 28 bytes with its Type at offset 12
+		for offset := 0; offset+28 <= len(data); offset += 28 {
+			if binary.LittleEndian.Uint32(data[offset+12:]) == imageDebugTypeRepro {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// hasMZHeader reports whether the file at path starts with an MZ header
+// whose e_lfanew points at a PE signature.
+func hasMZHeader(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, 64)
+	if _, err := io.ReadFull(file, header); err != nil || header[0] != 'M' || header[1] != 'Z' {
+		return false
+	}
+	signature := make([]byte, 4)
+	if _, err := file.ReadAt(signature, int64(binary.LittleEndian.Uint32(header[0x3c:]))); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(signature) == peSignature
+}
+
+// machineName names the common COFF machine types.
+func machineName(machine uint16) string {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "i386"
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "amd64"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "arm64"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return "arm"
+	}
+	return fmt.Sprintf("0x%04x", machine)
+}
+
+// appendOnce appends value unless list already holds it.
+func appendOnce(list []string, value string) []string {
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// WritePETriageReport writes pe_triage.json to the root of artifactsDir.
+func WritePETriageReport(artifactsDir string, report *PETriageReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal PE triage report: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(artifactsDir, PETriageName), data, 0644)
+}
@@ -0,0 +1,265 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"debug/pe"
+	"encoding/binary"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPE describes an executable for buildTestPE.
+type testPE struct {
+	timestamp uint32
+	imports   []string // Functions imported from KERNEL32.dll
+	packed    bool     // Add a UPX1 section of random bytes that is writable and executes
+}
+
+// buildTestPE returns a PE32+ console executable with a .text section of
+// repeated instructions, an .rdata section holding the import table, and, if
+// packed, a UPX1 section.
+func buildTestPE(t *testing.T, spec testPE) []byte {
+	t.Helper()
+	const fileAlign, sectionAlign, headersSize = 0x200, 0x1000, 0x400
+	const rdataRVA = 0x2000
+	align := func(data []byte) []byte {
+		for len(data)%fileAlign != 0 {
+			data = append(data, 0)
+		}
+		return data
+	}
+
+	// Import descriptors, then the lookup and address tables, then the
+	// hint/name entries and the library name
+	n := len(spec.imports)
+	iltOffset := 2 * 20
+	iatOffset := iltOffset + 8*(n+1)
+	rdata := make([]byte, iatOffset+8*(n+1))
+	for i, name := range spec.imports {
+		rva := uint64(rdataRVA + len(rdata))
+		binary.LittleEndian.PutUint64(rdata[iltOffset+8*i:], rva)
+		binary.LittleEndian.PutUint64(rdata[iatOffset+8*i:], rva)
+		rdata = append(rdata, 0, 0)
+		rdata = append(rdata, name...)
+		rdata = append(rdata, 0)
+		if len(rdata)%2 != 0 {
+			rdata = append(rdata, 0)
+		}
+	}
+	binary.LittleEndian.PutUint32(rdata[0:], uint32(rdataRVA+iltOffset))
+	binary.LittleEndian.PutUint32(rdata[12:], uint32(rdataRVA+len(rdata)))
+	binary.LittleEndian.PutUint32(rdata[16:], uint32(rdataRVA+iatOffset))
+	rdata = append(rdata, "KERNEL32.dll\x00"...)
+
+	type section struct {
+		name  string
+		chars uint32
+		data  []byte
+	}
+	sections := []section{
+		{".text", pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_MEM_EXECUTE | pe.IMAGE_SCN_MEM_READ, bytes.Repeat([]byte{0x48, 0x89, 0xc3, 0x90}, 128)},
+		{".rdata", pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ, align(rdata)},
+	}
+	if spec.packed {
+		random := make([]byte, 4096)
+		mathrand.New(mathrand.NewSource(1)).Read(random)
+		sections = append(sections, section{"UPX1", pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_EXECUTE | pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_WRITE, random})
+	}
+
+	var headers bytes.Buffer
+	write := func(v interface{}) {
+		if err := binary.Write(&headers, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+	write(dos)
+	write([]byte("PE\x00\x00"))
+	write(pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections:     uint16(len(sections)),
+		TimeDateStamp:        spec.timestamp,
+		SizeOfOptionalHeader: uint16(binary.Size(pe.OptionalHeader64{})),
+		Characteristics:      pe.IMAGE_FILE_EXECUTABLE_IMAGE | pe.IMAGE_FILE_LARGE_ADDRESS_AWARE,
+	})
+	optional := pe.OptionalHeader64{
+		Magic:                       0x20b,
+		AddressOfEntryPoint:         0x1000,
+		BaseOfCode:                  0x1000,
+		ImageBase:                   0x140000000,
+		SectionAlignment:            sectionAlign,
+		FileAlignment:               fileAlign,
+		MajorOperatingSystemVersion: 6,
+		MajorSubsystemVersion:       6,
+		SizeOfImage:                 uint32(sectionAlign * (len(sections) + 1)),
+		SizeOfHeaders:               headersSize,
+		Subsystem:                   pe.IMAGE_SUBSYSTEM_WINDOWS_CUI,
+		NumberOfRvaAndSizes:         16,
+	}
+	optional.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT] = pe.DataDirectory{VirtualAddress: rdataRVA, Size: 40}
+	write(optional)
+
+	body := make([]byte, 0)
+	for i, s := range sections {
+		header := pe.SectionHeader32{
+			VirtualSize:      uint32(len(s.data)),
+			VirtualAddress:   uint32(sectionAlign * (i + 1)),
+			SizeOfRawData:    uint32(len(s.data)),
+			PointerToRawData: uint32(headersSize + len(body)),
+			Characteristics:  s.chars,
+		}
+		copy(header.Name[:], s.name)
+		write(header)
+		body = append(body, s.data...)
+	}
+	if headers.Len() > headersSize {
+		t.Fatalf("headers take %d bytes", headers.Len())
+	}
+	image := make([]byte, headersSize)
+	copy(image, headers.Bytes())
+	return append(image, body...)
+}
+
+// writeTestPE writes an executable built from spec and returns its path.
+func writeTestPE(t *testing.T, spec testPE) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tool.exe")
+	if err := os.WriteFile(path, buildTestPE(t, spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTriagePEReadsHeadersAndEntropy(t *testing.T) {
+	compiled := time.Date(2023, 6, 1, 9, 30, 0, 0, time.UTC)
+	entry := TriagePE(writeTestPE(t, testPE{timestamp: uint32(compiled.Unix()), imports: []string{"GetTickCount", "ExitProcess"}}), testTimestamp)
+	if entry.Error != "" {
+		t.Fatal(entry.Error)
+	}
+	if entry.Machine != "amd64" || !entry.Is64Bit || entry.IsDLL || entry.Subsystem != pe.IMAGE_SUBSYSTEM_WINDOWS_CUI {
+		t.Errorf("headers = %+v", entry)
+	}
+	if entry.TimeDateStamp != uint32(compiled.Unix()) || entry.CompileTimeUTC != "2023-06-01T09:30:00Z" || entry.Reproducible {
+		t.Errorf("compile time = %d, %q", entry.TimeDateStamp, entry.CompileTimeUTC)
+	}
+
+	// Four instruction bytes repeated evenly carry exactly two bits each
+	if len(entry.Sections) != 2 {
+		t.Fatalf("sections = %+v", entry.Sections)
+	}
+	text := entry.Sections[0]
+	if want := (PESection{Name: ".text", VirtualSize: 512, RawSize: 512, Entropy: 2, Executable: true}); text != want {
+		t.Errorf(".text = %+v, want %+v", text, want)
+	}
+	if rdata := entry.Sections[1]; rdata.Name != ".rdata" || rdata.Entropy <= 0 || rdata.Entropy >= PackedEntropy || rdata.Executable || rdata.Writable {
+		t.Errorf(".rdata = %+v", rdata)
+	}
+
+	if entry.ImportCount != 2 || !reflect.DeepEqual(entry.ImportedLibraries, []string{"KERNEL32.dll"}) || entry.SuspiciousImports != nil {
+		t.Errorf("imports = %d from %v, suspicious %v", entry.ImportCount, entry.ImportedLibraries, entry.SuspiciousImports)
+	}
+	if entry.Packed || entry.Findings != nil {
+		t.Errorf("benign executable flagged: %v", entry.Findings)
+	}
+}
+
+func TestTriagePEFlagsPackedInjector(t *testing.T) {
+	entry := TriagePE(writeTestPE(t, testPE{
+		imports: []string{"VirtualAllocEx", "WriteProcessMemory", "CreateRemoteThread", "SetWindowsHookExW", "LoadLibraryA"},
+		packed:  true,
+	}), testTimestamp)
+	if entry.Error != "" {
+		t.Fatal(entry.Error)
+	}
+	upx := entry.Sections[2]
+	if upx.Name != "UPX1" || upx.Entropy < 7.9 || !upx.HighEntropy || !upx.PackerName {
+		t.Errorf("UPX1 = %+v", upx)
+	}
+	if want := []string{"CreateRemoteThread", "SetWindowsHookExW", "VirtualAllocEx", "WriteProcessMemory"}; !reflect.DeepEqual(entry.SuspiciousImports, want) {
+		t.Errorf("suspicious imports = %v, want %v", entry.SuspiciousImports, want)
+	}
+	if want := []string{PEFindingHighEntropy, PEFindingPackerSection, PEFindingTimestampZero}; !entry.Packed || !reflect.DeepEqual(entry.Findings, want) {
+		t.Errorf("findings = %v, want %v", entry.Findings, want)
+	}
+	if entry.CompileTimeUTC != "" {
+		t.Errorf("unset timestamp reported as %s", entry.CompileTimeUTC)
+	}
+}
+
+func TestTriagePETimestampFindings(t *testing.T) {
+	tests := []struct {
+		name     string
+		compiled time.Time
+		want     []string
+	}{
+		{"before the PE format", time.Date(1992, 6, 1, 0, 0, 0, 0, time.UTC), []string{PEFindingTimestampEarly}},
+		{"an hour after collection", testTimestamp.Add(time.Hour), nil},
+		{"after collection", testTimestamp.Add(72 * time.Hour), []string{PEFindingTimestampAhead}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := TriagePE(writeTestPE(t, testPE{timestamp: uint32(tt.compiled.Unix())}), testTimestamp)
+			if !reflect.DeepEqual(entry.Findings, tt.want) {
+				t.Errorf("findings = %v, want %v", entry.Findings, tt.want)
+			}
+		})
+	}
+}
+
+func TestShannonEntropy(t *testing.T) {
+	every := make([]byte, 256)
+	for i := range every {
+		every[i] = byte(i)
+	}
+	for _, tt := range []struct {
+		data string
+		want float64
+	}{
+		{"", 0},
+		{strings.Repeat("A", 1000), 0},
+		{"ABAB", 1},
+		{string(every), 8},
+	} {
+		got, err := ShannonEntropy(strings.NewReader(tt.data))
+		if err != nil || got != tt.want {
+			t.Errorf("entropy of %d bytes = %v, %v, want %v", len(tt.data), got, err, tt.want)
+		}
+	}
+}
+
+func TestTriagePEFilesReadsCollectedExecutables(t *testing.T) {
+	files := map[string]string{
+		"windows_custompaths/C/Users/Public/svc.exe":    string(buildTestPE(t, testPE{imports: []string{"VirtualAllocEx"}, packed: true})),
+		"windows_custompaths/C/Users/Public/notes.txt":  "MZ is not enough",
+		"windows_custompaths/C/Users/Public/broken.exe": "MZ" + strings.Repeat("\x00", 58) + "\x40\x00\x00\x00PE\x00\x00\x64\x86",
+		"windows_prefetch/SVC.EXE-1A2B3C4D.pf":          string(buildTestPE(t, testPE{})),
+	}
+	dir := newTestCollection(t, files)
+	manifest, err := ReadCollectionManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := TriagePEFiles(context.Background(), dir, manifest, []string{"windows/custompaths"}, testTimestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.FilesChecked != 3 || report.PECount != 2 || report.FlaggedCount != 1 || report.Host != "host" {
+		t.Fatalf("report = %+v", report)
+	}
+	broken, packed := report.Files[0], report.Files[1]
+	if broken.Path != "windows_custompaths/C/Users/Public/broken.exe" || broken.Error == "" || broken.Module != "windows/custompaths" {
+		t.Errorf("truncated executable = %+v", broken)
+	}
+	if packed.Path != "windows_custompaths/C/Users/Public/svc.exe" || !packed.Packed || !reflect.DeepEqual(packed.SuspiciousImports, []string{"VirtualAllocEx"}) {
+		t.Errorf("packed executable = %+v", packed)
+	}
+}
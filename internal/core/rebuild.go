@@ -0,0 +1,252 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// moduleManifestName is the file name every module writes its manifest under.
+const moduleManifestName = "manifest.json"
+
+// ModuleManifestCheck lists the differences between one module manifest and
+// the files in its directory.
+type ModuleManifestCheck struct {
+	Manifest string   `json:"manifest"` // Slash-separated path relative to the artifacts directory
+	Items    int      `json:"items"`
+	Missing  []string `json:"missing"`         // Listed in the manifest but not on disk
+	Stale    []string `json:"stale"`           // Listed with a hash that no longer matches the file
+	Unlisted []string `json:"unlisted"`        // On disk under the manifest's directory but not listed
+	Error    string   `json:"error,omitempty"` // The manifest could not be parsed
+}
+
+// RebuildReport describes a root manifest regenerated from an artifacts tree.
+type RebuildReport struct {
+	ArtifactsDir      string                `json:"artifacts_dir"`
+	PreviousManifest  bool                  `json:"previous_manifest"`
+	PreviousSealValid *bool                 `json:"previous_seal_valid,omitempty"` // Checked with the new key when the previous manifest was sealed
+	FileCount         int                   `json:"file_count"`
+	TotalBytes        int64                 `json:"total_bytes"`
+	Added             []string              `json:"added"`   // Not in the previous root manifest
+	Removed           []string              `json:"removed"` // In the previous root manifest but no longer on disk
+	Changed           []string              `json:"changed"` // Size or hash differs from the previous root manifest
+	ModuleManifests   []ModuleManifestCheck `json:"module_manifests"`
+	UnmanifestedFiles []string              `json:"unmanifested_files"` // Under a module directory that has no manifest
+	Sealed            bool                  `json:"sealed"`
+}
+
+// OK reports whether the rebuilt index agreed with every module manifest.
+func (r *RebuildReport) OK() bool {
+	if len(r.UnmanifestedFiles) > 0 {
+		return false
+	}
+	for _, check := range r.ModuleManifests {
+		if check.Error != "" || len(check.Missing) > 0 || len(check.Stale) > 0 || len(check.Unlisted) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// moduleManifestFile is the part of a module manifest the rebuild reads.
+type moduleManifestFile struct {
+	Host  string `json:"host"`
+	Items []struct {
+		Path   string `json:"path"`
+		SHA256 string `json:"sha256"`
+	} `json:"items"`
+}
+
+// RebuildCollectionManifest re-walks artifactsDir, recomputes every file hash,
+// checks each module manifest against the files in its directory, and writes
+// a fresh root manifest in the given format. Host and run ID are carried over
+// from the previous root manifest when one is readable, and otherwise taken
+// from the first module manifest. Module manifests are reported on, not
+// rewritten, since they record what was seen at collection time. When key is
+// non-empty the new manifest is sealed with it; a sealed previous manifest
+// requires a key, and whether that key verified the old seal is reported.
+func RebuildCollectionManifest(ctx context.Context, artifactsDir, format string, key []byte) (*RebuildReport, error) {
+	if err := ValidateManifestFormat(format); err != nil {
+		return nil, err
+	}
+	entries, err := hashTree(ctx, artifactsDir, true, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RebuildReport{
+		ArtifactsDir:      artifactsDir,
+		Added:             make([]string, 0),
+		Removed:           make([]string, 0),
+		Changed:           make([]string, 0),
+		ModuleManifests:   make([]ModuleManifestCheck, 0),
+		UnmanifestedFiles: make([]string, 0),
+	}
+
+	var hostname, runID string
+	previous, err := ReadCollectionManifest(artifactsDir)
+	if err == nil {
+		report.PreviousManifest = true
+		hostname, runID = previous.Host, previous.RunID
+		if previous.HMAC != "" {
+			if len(key) == 0 {
+				return nil, fmt.Errorf("collection manifest is sealed; an --hmac-key is required to seal the rebuilt manifest")
+			}
+			valid := previous.CheckSeal(key) == nil
+			report.PreviousSealValid = &valid
+		}
+		compareRootManifest(report, previous.Files, entries)
+	}
+
+	onDisk := make(map[string]ManifestEntry, len(entries))
+	for _, entry := range entries {
+		onDisk[entry.Path] = entry
+	}
+	readFile := func(relPath string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(artifactsDir, filepath.FromSlash(relPath)))
+	}
+	var manifestHost string
+	report.ModuleManifests, report.UnmanifestedFiles, manifestHost = checkModuleManifests(readFile, entries, onDisk)
+	if hostname == "" {
+		hostname = manifestHost
+	}
+
+	tool := CurrentBuildInfo()
+	manifest := &CollectionManifest{
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
+		Host:               hostname,
+		RunID:              runID,
+		CryptkeeperVersion: tool.Version,
+		Tool:               &tool,
+		FileCount:          len(entries),
+		Files:              entries,
+	}
+	for _, entry := range entries {
+		manifest.TotalBytes += entry.Size
+	}
+	if len(key) > 0 {
+		manifest.Seal(key)
+		report.Sealed = true
+	}
+	report.FileCount = manifest.FileCount
+	report.TotalBytes = manifest.TotalBytes
+
+	if err := WriteCollectionManifest(artifactsDir, manifest, format); err != nil {
+		return report, fmt.Errorf("failed to write collection manifest: %w", err)
+	}
+
+	return report, nil
+}
+
+// compareRootManifest records how the files on disk differ from the previous
+// root manifest.
+func compareRootManifest(report *RebuildReport, previous, current []ManifestEntry) {
+	before := make(map[string]ManifestEntry, len(previous))
+	for _, entry := range previous {
+		before[entry.Path] = entry
+	}
+	for _, entry := range current {
+		old, ok := before[entry.Path]
+		if !ok {
+			report.Added = append(report.Added, entry.Path)
+			continue
+		}
+		// A previous manifest built without hashes can only be compared by size
+		if entry.Size != old.Size || (old.SHA256 != "" && entry.SHA256 != old.SHA256) {
+			report.Changed = append(report.Changed, entry.Path)
+		}
+		delete(before, entry.Path)
+	}
+	for relPath := range before {
+		report.Removed = append(report.Removed, relPath)
+	}
+	sort.Strings(report.Removed)
+}
+
+// checkModuleManifests compares every module manifest among entries, read
+// with readFile, with the files under its directory. It returns a check per
+// manifest, the files under no manifest's directory, and the first host name
+// the manifests record. Files at the artifacts root belong to the run, not a
+// module, and are not checked.
+func checkModuleManifests(readFile func(relPath string) ([]byte, error), entries []ManifestEntry, onDisk map[string]ManifestEntry) ([]ModuleManifestCheck, []string, string) {
+	checks := make([]ModuleManifestCheck, 0)
+	unmanifested := make([]string, 0)
+	manifestDirs := make([]string, 0)
+	for _, entry := range entries {
+		if path.Base(entry.Path) == moduleManifestName && strings.Contains(entry.Path, "/") {
+			manifestDirs = append(manifestDirs, path.Dir(entry.Path))
+		}
+	}
+
+	var hostname string
+	listed := make(map[string]bool)
+	for _, dir := range manifestDirs {
+		relPath := path.Join(dir, moduleManifestName)
+		check := ModuleManifestCheck{
+			Manifest: relPath,
+			Missing:  make([]string, 0),
+			Stale:    make([]string, 0),
+			Unlisted: make([]string, 0),
+		}
+		listed[relPath] = true
+
+		var parsed moduleManifestFile
+		data, err := readFile(relPath)
+		if err == nil {
+			err = json.Unmarshal(data, &parsed)
+		}
+		if err != nil {
+			check.Error = err.Error()
+			checks = append(checks, check)
+			continue
+		}
+		if hostname == "" {
+			hostname = parsed.Host
+		}
+
+		check.Items = len(parsed.Items)
+		for _, item := range parsed.Items {
+			// Manifests written on Windows use backslash separators
+			itemPath := path.Join(dir, strings.ReplaceAll(item.Path, `\`, "/"))
+			listed[itemPath] = true
+			entry, ok := onDisk[itemPath]
+			if !ok {
+				check.Missing = append(check.Missing, itemPath)
+				continue
+			}
+			// Placeholder notes are listed without a hash
+			if item.SHA256 != "" && !strings.EqualFold(item.SHA256, entry.SHA256) {
+				check.Stale = append(check.Stale, itemPath)
+			}
+		}
+		checks = append(checks, check)
+	}
+
+	// Attribute each unlisted file to the deepest manifest directory above it
+	for _, entry := range entries {
+		if listed[entry.Path] || !strings.Contains(entry.Path, "/") {
+			continue
+		}
+		owner := -1
+		for i, check := range checks {
+			dir := path.Dir(check.Manifest) + "/"
+			if strings.HasPrefix(entry.Path, dir) && (owner < 0 || len(check.Manifest) > len(checks[owner].Manifest)) {
+				owner = i
+			}
+		}
+		if owner < 0 {
+			unmanifested = append(unmanifested, entry.Path)
+			continue
+		}
+		checks[owner].Unlisted = append(checks[owner].Unlisted, entry.Path)
+	}
+
+	return checks, unmanifested, hostname
+}
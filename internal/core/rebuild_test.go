@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sha256Hex returns the hex SHA-256 of content, as module manifests list it.
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRebuildReportsOutOfSyncManifests(t *testing.T) {
+	prefetchManifest := fmt.Sprintf(`{"host":"WS-0142","items":[
+		{"path":"A.pf","sha256":%q},
+		{"path":"B.pf","sha256":%q},
+		{"path":"gone.pf","sha256":%q},
+		{"path":"placeholder.txt","sha256":""}
+	]}`, sha256Hex("prefetch a"), sha256Hex("prefetch b"), sha256Hex("deleted"))
+	appsManifest := fmt.Sprintf(`{"host":"WS-0142","items":[{"path":"users\\alice\\alice.ost","sha256":%q}]}`, sha256Hex("mailbox"))
+	dir := newTestCollection(t, map[string]string{
+		"windows_prefetch/manifest.json":                                  prefetchManifest,
+		"windows_prefetch/A.pf":                                           "prefetch a",
+		"windows_prefetch/B.pf":                                           "prefetch b",
+		"windows_prefetch/placeholder.txt":                                "access denied",
+		"windows_applications/windows/applications/manifest.json":         appsManifest,
+		"windows_applications/windows/applications/users/alice/alice.ost": "mailbox",
+		"windows_evtx/Security.evtx":                                      "events",
+		"tool_info.json":                                                  `{"version":"test"}`,
+	})
+	previous, err := ReadCollectionManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous.Seal([]byte("case-4471"))
+	if err := WriteCollectionManifest(dir, previous, ManifestFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	// After the run: one file edited, one added, one deleted by hand
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("windows_prefetch/B.pf", "prefetch b, edited")
+	write("windows_prefetch/C.pf", "prefetch c")
+	if err := os.Remove(filepath.Join(dir, "windows_evtx", "Security.evtx")); err != nil {
+		t.Fatal(err)
+	}
+	write("windows_evtx/System.evtx", "more events")
+
+	if _, err := RebuildCollectionManifest(context.Background(), dir, ManifestFormatJSON, nil); err == nil || !strings.Contains(err.Error(), "--hmac-key") {
+		t.Fatalf("rebuild of a sealed tree without a key = %v", err)
+	}
+	report, err := RebuildCollectionManifest(context.Background(), dir, ManifestFormatJSON, []byte("case-4471"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.OK() || !report.PreviousManifest || report.PreviousSealValid == nil || !*report.PreviousSealValid || !report.Sealed {
+		t.Fatalf("report = %+v", report)
+	}
+	if want := []string{"windows_evtx/System.evtx", "windows_prefetch/C.pf"}; !reflect.DeepEqual(report.Added, want) {
+		t.Errorf("added = %v, want %v", report.Added, want)
+	}
+	if want := []string{"windows_evtx/Security.evtx"}; !reflect.DeepEqual(report.Removed, want) {
+		t.Errorf("removed = %v, want %v", report.Removed, want)
+	}
+	if want := []string{"windows_prefetch/B.pf"}; !reflect.DeepEqual(report.Changed, want) {
+		t.Errorf("changed = %v, want %v", report.Changed, want)
+	}
+	if want := []string{"windows_evtx/System.evtx"}; !reflect.DeepEqual(report.UnmanifestedFiles, want) {
+		t.Errorf("unmanifested = %v, want %v", report.UnmanifestedFiles, want)
+	}
+
+	// Windows separators in a nested module manifest still match
+	want := []ModuleManifestCheck{
+		{Manifest: "windows_applications/windows/applications/manifest.json", Items: 1, Missing: []string{}, Stale: []string{}, Unlisted: []string{}},
+		{
+			Manifest: "windows_prefetch/manifest.json",
+			Items:    4,
+			Missing:  []string{"windows_prefetch/gone.pf"},
+			Stale:    []string{"windows_prefetch/B.pf"},
+			Unlisted: []string{"windows_prefetch/C.pf"},
+		},
+	}
+	if !reflect.DeepEqual(report.ModuleManifests, want) {
+		t.Fatalf("module manifests =\n%+v\nwant\n%+v", report.ModuleManifests, want)
+	}
+
+	// The rebuilt manifest indexes the tree as it now is
+	verify, err := VerifyCollection(context.Background(), dir, []byte("case-4471"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verify.Missing)+len(verify.Mismatched)+len(verify.Unexpected) != 0 || verify.SealValid == nil || !*verify.SealValid {
+		t.Fatalf("rebuilt manifest does not verify: %+v", verify)
+	}
+	rebuilt, err := ReadCollectionManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Host != "host" || rebuilt.RunID != testRunID || rebuilt.FileCount != report.FileCount || report.FileCount != 9 {
+		t.Fatalf("rebuilt manifest = host %q, run %q, %d files", rebuilt.Host, rebuilt.RunID, rebuilt.FileCount)
+	}
+}
+
+func TestRebuildWithoutARootManifest(t *testing.T) {
+	dir := newTestCollection(t, map[string]string{
+		"windows_prefetch/manifest.json": fmt.Sprintf(`{"host":"WS-0142","items":[{"path":"A.pf","sha256":%q}]}`, sha256Hex("prefetch a")),
+		"windows_prefetch/A.pf":          "prefetch a",
+	})
+	if err := os.Remove(filepath.Join(dir, CollectionManifestName)); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := RebuildCollectionManifest(context.Background(), dir, ManifestFormatJSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.PreviousManifest || report.Sealed || len(report.Added) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	// The host comes from the module manifests when no root manifest is left
+	rebuilt, err := ReadCollectionManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Host != "WS-0142" || rebuilt.FileCount != 2 || rebuilt.HMAC != "" {
+		t.Fatalf("rebuilt manifest = %+v", rebuilt)
+	}
+}
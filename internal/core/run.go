@@ -3,14 +3,23 @@ package core
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
+
+	"cryptkeeper/internal/coverage"
+	"cryptkeeper/internal/progress"
+	"cryptkeeper/internal/winutil"
 )
 
+// InterruptedReportName is the file written to the artifacts root when collection is cancelled.
+const InterruptedReportName = "interrupted.json"
+
 // Module defines the interface that all collection modules must implement.
 type Module interface {
 	// Name returns the module's identifier, used for directory naming and reporting.
@@ -19,15 +28,54 @@ type Module interface {
 	Collect(ctx context.Context, outDir string) error
 }
 
+// LiveSystemModule is implemented by modules that query the running OS
+// (commands, APIs, live registry) rather than reading files, and therefore
+// cannot collect from a mounted image or alternate root.
+type LiveSystemModule interface {
+	RequiresLiveSystem() bool
+}
+
+// DependentModule is implemented by modules that read another module's
+// output. DependsOn lists the names of the modules that must finish before it
+// starts; names that are not registered in the run are ignored.
+type DependentModule interface {
+	DependsOn() []string
+}
+
+// DescribedModule is implemented by modules that summarize what they collect
+// in one line, shown next to their output in the archive index.
+type DescribedModule interface {
+	Describe() string
+}
+
+// SkipRequiresLiveSystem is the skip reason for live-only modules in an offline run.
+const SkipRequiresLiveSystem = "requires_live_system"
+
+// SkipStrictAbort is the skip reason for modules a strict run did not start
+// because another module had already failed.
+const SkipStrictAbort = "strict_abort"
+
 // Result captures the execution result of a single module.
 type Result struct {
 	Module    string    `json:"name"`
 	OK        bool      `json:"ok"`
 	Error     string    `json:"error"`
+	Skipped   string    `json:"skipped,omitempty"` // Reason the module was not run
+	Items     int       `json:"items,omitempty"`   // Items in the module manifest, or files written without one
 	StartedAt time.Time `json:"started_utc"`
 	EndedAt   time.Time `json:"ended_utc"`
 }
 
+// MarshalJSON writes the start and end times in the run's time format.
+func (r Result) MarshalJSON() ([]byte, error) {
+	type result Result
+	return json.Marshal(struct {
+		result
+		StartedAt string `json:"started_utc"`
+		EndedAt   string `json:"ended_utc"`
+	}{result(r), winutil.FormatTime(r.StartedAt), winutil.FormatTime(r.EndedAt)})
+}
+
 // Clock provides time functions for testability.
 type Clock interface {
 	Now() time.Time
@@ -41,6 +89,37 @@ func (SystemClock) Now() time.Time {
 	return time.Now()
 }
 
+// Env provides the host name and environment variables for testability.
+type Env interface {
+	Hostname() (string, error)
+	Getenv(key string) string
+}
+
+// SystemEnv implements Env using the operating system.
+type SystemEnv struct{}
+
+// Hostname returns the host name reported by the kernel.
+func (SystemEnv) Hostname() (string, error) {
+	return os.Hostname()
+}
+
+// Getenv returns the value of the environment variable key.
+func (SystemEnv) Getenv(key string) string {
+	return os.Getenv(key)
+}
+
+// NamedEnv reports a fixed host name, such as --hostname, and reads
+// environment variables from Env.
+type NamedEnv struct {
+	Env
+	Name string
+}
+
+// Hostname returns the fixed name.
+func (e NamedEnv) Hostname() (string, error) {
+	return e.Name, nil
+}
+
 // Run orchestrates the execution of multiple modules with concurrency control.
 type Run struct {
 	modules       []Module
@@ -48,7 +127,29 @@ type Run struct {
 	moduleTimeout time.Duration
 	artifactsDir  string
 	clock         Clock
+	env           Env
 	logger        *log.Logger
+	tracker       *progress.Tracker
+	offlineRoot   string
+	strict        bool
+	coverage      bool
+	progress      *progressEmitter
+	settings      *winutil.CollectSettings
+}
+
+// InterruptedModule records where one module stopped when collection was cancelled.
+type InterruptedModule struct {
+	Module         string `json:"name"`
+	InFlight       string `json:"in_flight,omitempty"`      // Source file being copied at cancellation
+	LastCompleted  string `json:"last_completed,omitempty"` // Last source file fully copied
+	CompletedFiles int64  `json:"completed_files"`
+}
+
+// InterruptedReport is the content of interrupted.json.
+type InterruptedReport struct {
+	InterruptedUTC string              `json:"interrupted_utc"`
+	Reason         string              `json:"reason"`
+	Modules        []InterruptedModule `json:"modules"`
 }
 
 // NewRun creates a new Run orchestrator.
@@ -57,7 +158,7 @@ func NewRun(parallelism int, moduleTimeout time.Duration, artifactsDir string, c
 		clock = SystemClock{}
 	}
 	if logger == nil {
-		logger = log.New(os.Stderr, "", log.LstdFlags)
+		logger = log.New(winutil.ConsoleOutput(os.Stderr), "", log.LstdFlags)
 	}
 	
 	// Clamp parallelism to reasonable bounds
@@ -74,8 +175,62 @@ func NewRun(parallelism int, moduleTimeout time.Duration, artifactsDir string, c
 		moduleTimeout: moduleTimeout,
 		artifactsDir:  artifactsDir,
 		clock:         clock,
+		env:           SystemEnv{},
 		logger:        logger,
+		tracker:       progress.Default,
+		settings:      &winutil.CollectSettings{},
+	}
+}
+
+// SetOfflineRoot marks the run as collecting from a mounted image or alternate
+// root, so modules that require the live system are skipped.
+func (r *Run) SetOfflineRoot(root string) {
+	r.offlineRoot = root
+}
+
+// SetEnv replaces the host name and environment variable source modules read.
+func (r *Run) SetEnv(env Env) {
+	if env == nil {
+		env = SystemEnv{}
+	}
+	r.env = env
+}
+
+// SetStrict makes the first module failure abort the run: modules still
+// running are cancelled, those not yet started are skipped, and CollectAll
+// returns that failure. By default every module runs regardless of others.
+func (r *Run) SetStrict(enabled bool) {
+	r.strict = enabled
+}
+
+// SetCoverage makes every module that reports the locations it probes write
+// them to a coverage.json in its output directory.
+func (r *Run) SetCoverage(enabled bool) {
+	r.coverage = enabled
+}
+
+// SetProgress makes the run write a ProgressEvent line to w as each module
+// starts and ends. A nil w turns progress events off.
+func (r *Run) SetProgress(w io.Writer) {
+	if w == nil {
+		r.progress = nil
+		return
+	}
+	r.progress = &progressEmitter{w: w, clock: r.clock}
+}
+
+// SetCollectSettings sets the copy limits every module's Collect context
+// carries, alongside the run's clock and Env. Nil restores the defaults.
+func (r *Run) SetCollectSettings(settings *winutil.CollectSettings) {
+	if settings == nil {
+		settings = &winutil.CollectSettings{}
 	}
+	r.settings = settings
+}
+
+// CollectSettings returns the copy limits modules collect under.
+func (r *Run) CollectSettings() *winutil.CollectSettings {
+	return r.settings
 }
 
 // Register adds a module to the execution list.
@@ -83,13 +238,69 @@ func (r *Run) Register(m Module) {
 	r.modules = append(r.modules, m)
 }
 
+// Descriptions maps the name of each registered module that implements
+// DescribedModule to its description.
+func (r *Run) Descriptions() map[string]string {
+	descriptions := make(map[string]string, len(r.modules))
+	for _, module := range r.modules {
+		if described, ok := module.(DescribedModule); ok {
+			descriptions[module.Name()] = described.Describe()
+		}
+	}
+	return descriptions
+}
+
 // CollectAll executes all registered modules concurrently with the configured constraints.
-// It returns results for all modules, including those that failed.
+// A module that declares dependencies starts only once they have finished,
+// whether or not they succeeded. It returns results for all modules,
+// including those that failed, or an error without running anything when the
+// dependencies form a cycle. In strict mode the returned error is the first
+// module failure, which cancelled the rest of the run.
 func (r *Run) CollectAll(ctx context.Context) ([]Result, error) {
 	if len(r.modules) == 0 {
 		return []Result{}, nil
 	}
 
+	dependencies, err := r.dependencies()
+	if err != nil {
+		return nil, err
+	}
+
+	if r.progress != nil {
+		r.progress.started = r.clock.Now().UTC()
+	}
+
+	// Modules read the time, host name, and environment, and record coverage
+	// probes, through their context
+	settings := *r.settings
+	settings.Now, settings.Hostname, settings.Getenv = r.clock.Now, r.env.Hostname, r.env.Getenv
+	if r.coverage {
+		settings.Coverage = coverage.NewRecorder()
+		settings.Coverage.Start(r.artifactsDir, true)
+	}
+
+	// Attribute file copies to modules so cancellation can report them
+	r.tracker.SetRoot(r.artifactsDir)
+
+	// A strict run cancels its remaining modules on the first failure
+	runCtx, abort := context.WithCancelCause(winutil.WithCollectSettings(ctx, &settings))
+	defer abort(nil)
+	var strictOnce sync.Once
+	var strictErr error
+
+	// Capture in-flight copies the moment the run is cancelled
+	var interrupted *InterruptedReport
+	stopWatch := make(chan struct{})
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		select {
+		case <-runCtx.Done():
+			interrupted = r.interruptedReport(context.Cause(runCtx))
+		case <-stopWatch:
+		}
+	}()
+
 	// Create semaphore for concurrency control
 	semaphore := make(chan struct{}, r.parallelism)
 	
@@ -97,24 +308,61 @@ func (r *Run) CollectAll(ctx context.Context) ([]Result, error) {
 	results := make(chan Result, len(r.modules))
 	var wg sync.WaitGroup
 
+	// Closed as each module finishes, releasing the modules that depend on it
+	finished := make([]chan struct{}, len(r.modules))
+	for i := range finished {
+		finished[i] = make(chan struct{})
+	}
+
 	// Start all modules
-	for _, module := range r.modules {
+	for i, module := range r.modules {
 		wg.Add(1)
-		go func(m Module) {
+		go func(i int, m Module) {
 			defer wg.Done()
+			defer close(finished[i])
+			
+			// Wait for prerequisites before taking a slot, so a waiting
+			// module never holds one its prerequisite needs
+			for _, dep := range dependencies[i] {
+				<-finished[dep]
+			}
 			
 			// Acquire semaphore
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
-			
-			result := r.executeModule(ctx, m)
+
+			if r.strict && runCtx.Err() != nil {
+				result := r.strictSkip(m, context.Cause(runCtx))
+				r.progress.moduleEnded(result)
+				results <- result
+				return
+			}
+			r.progress.moduleStarted(m.Name())
+			result := r.executeModule(runCtx, m)
+			r.progress.moduleEnded(result)
+			if r.strict && !result.OK {
+				strictOnce.Do(func() {
+					strictErr = fmt.Errorf("strict mode: module %s failed: %s", result.Module, result.Error)
+					abort(strictErr)
+				})
+			}
 			results <- result
-		}(module)
+		}(i, module)
 	}
 
 	// Wait for all modules to complete
 	wg.Wait()
 	close(results)
+	close(stopWatch)
+	<-watchDone
+
+	if interrupted != nil {
+		if err := r.writeInterruptedReport(interrupted); err != nil {
+			r.logger.Printf("Warning: failed to write %s: %v", InterruptedReportName, err)
+		} else {
+			r.logger.Printf("Collection interrupted; in-flight files recorded in %s", InterruptedReportName)
+		}
+	}
 
 	// Collect results
 	var allResults []Result
@@ -131,6 +379,10 @@ func (r *Run) CollectAll(ctx context.Context) ([]Result, error) {
 		}
 	}
 
+	if strictErr != nil {
+		return allResults, strictErr
+	}
+
 	// Return aggregated error if any modules failed
 	var combinedError error
 	if errorCount > 0 {
@@ -144,11 +396,74 @@ func (r *Run) CollectAll(ctx context.Context) ([]Result, error) {
 	return allResults, combinedError
 }
 
+// strictSkip records a module a strict run did not start.
+func (r *Run) strictSkip(module Module, cause error) Result {
+	now := r.clock.Now().UTC()
+	r.logger.Printf("Module %s skipped: %s", module.Name(), SkipStrictAbort)
+	return Result{
+		Module:    module.Name(),
+		OK:        false,
+		Error:     fmt.Sprintf("not started: %v", cause),
+		Skipped:   SkipStrictAbort,
+		StartedAt: now,
+		EndedAt:   now,
+	}
+}
+
+// interruptedReport snapshots the copy state of every registered module.
+func (r *Run) interruptedReport(reason error) *InterruptedReport {
+	report := &InterruptedReport{
+		InterruptedUTC: winutil.FormatTime(r.clock.Now()),
+		Reason:         reason.Error(),
+		Modules:        make([]InterruptedModule, 0, len(r.modules)),
+	}
+
+	byDir := make(map[string]progress.ModuleProgress)
+	for _, mp := range r.tracker.Snapshot() {
+		byDir[mp.ModuleDir] = mp
+	}
+	for _, m := range r.modules {
+		mp := byDir[SanitizeName(m.Name())]
+		report.Modules = append(report.Modules, InterruptedModule{
+			Module:         m.Name(),
+			InFlight:       mp.InFlight,
+			LastCompleted:  mp.LastCompleted,
+			CompletedFiles: mp.CompletedFiles,
+		})
+	}
+
+	return report
+}
+
+// writeInterruptedReport writes interrupted.json to the artifacts root.
+func (r *Run) writeInterruptedReport(report *InterruptedReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(r.artifactsDir, InterruptedReportName), data, 0644)
+}
+
 // executeModule runs a single module with timeout and error handling.
 func (r *Run) executeModule(parentCtx context.Context, module Module) Result {
 	startTime := r.clock.Now().UTC()
+
+	// Live-only modules would describe the examiner's machine, not the image
+	if r.offlineRoot != "" {
+		if live, ok := module.(LiveSystemModule); ok && live.RequiresLiveSystem() {
+			r.logger.Printf("Module %s skipped: %s", module.Name(), SkipRequiresLiveSystem)
+			return Result{
+				Module:    module.Name(),
+				OK:        true,
+				Skipped:   SkipRequiresLiveSystem,
+				StartedAt: startTime,
+				EndedAt:   r.clock.Now().UTC(),
+			}
+		}
+	}
 	
-	// Create module-specific timeout context
+	// Create module-specific timeout context; parentCtx carries the run's settings
 	ctx, cancel := context.WithTimeout(parentCtx, r.moduleTimeout)
 	defer cancel()
 
@@ -167,6 +482,14 @@ func (r *Run) executeModule(parentCtx context.Context, module Module) Result {
 	// Execute the module
 	err := module.Collect(ctx, moduleDir)
 	endTime := r.clock.Now().UTC()
+	items := countItems(moduleDir)
+
+	// Record what the module examined, also when it failed partway
+	if probes := winutil.CollectSettingsFrom(ctx).Coverage.Probes(filepath.Base(moduleDir)); len(probes) > 0 {
+		if covErr := writeCoverageReport(moduleDir, NewCoverageReport(ctx, module.Name(), probes)); covErr != nil {
+			r.logger.Printf("Warning: failed to write %s for %s: %v", CoverageReportName, module.Name(), covErr)
+		}
+	}
 
 	if err != nil {
 		r.logger.Printf("Module %s failed: %v", module.Name(), err)
@@ -174,6 +497,7 @@ func (r *Run) executeModule(parentCtx context.Context, module Module) Result {
 			Module:    module.Name(),
 			OK:        false,
 			Error:     err.Error(),
+			Items:     items,
 			StartedAt: startTime,
 			EndedAt:   endTime,
 		}
@@ -184,6 +508,7 @@ func (r *Run) executeModule(parentCtx context.Context, module Module) Result {
 		Module:    module.Name(),
 		OK:        true,
 		Error:     "",
+		Items:     items,
 		StartedAt: startTime,
 		EndedAt:   endTime,
 	}
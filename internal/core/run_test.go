@@ -0,0 +1,287 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/progress"
+	"cryptkeeper/internal/winutil"
+)
+
+// fakeModule is a module whose Collect is a test function.
+type fakeModule struct {
+	name    string
+	collect func(ctx context.Context, outDir string) error
+}
+
+func (m *fakeModule) Name() string { return m.name }
+
+func (m *fakeModule) Collect(ctx context.Context, outDir string) error {
+	if m.collect == nil {
+		return nil
+	}
+	return m.collect(ctx, outDir)
+}
+
+// newTestRun returns a run writing into a temporary directory with logging
+// discarded.
+func newTestRun(t *testing.T, parallelism int) *Run {
+	t.Helper()
+	return NewRun(parallelism, time.Minute, t.TempDir(), nil, log.New(io.Discard, "", 0))
+}
+
+func TestCollectSettingsReachModuleContext(t *testing.T) {
+	run := newTestRun(t, 2)
+	settings := &winutil.CollectSettings{Budget: winutil.NewSizeBudget(1 << 20)}
+	run.SetCollectSettings(settings)
+
+	var got *winutil.CollectSettings
+	run.Register(&fakeModule{name: "settings", collect: func(ctx context.Context, outDir string) error {
+		got = winutil.CollectSettingsFrom(ctx)
+		return nil
+	}})
+	if _, err := run.CollectAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got.Budget != settings.Budget || got.Now == nil || got.Hostname == nil || got.Getenv == nil {
+		t.Fatalf("module context carries %+v, not the run's collect settings and environment", got)
+	}
+
+	run.SetCollectSettings(nil)
+	if run.CollectSettings() == nil || run.CollectSettings().Budget != nil {
+		t.Fatal("nil settings did not restore the defaults")
+	}
+}
+
+func TestCancelledRunRecordsInFlightCopy(t *testing.T) {
+	run := newTestRun(t, 2)
+	srcDir := t.TempDir()
+	first := filepath.Join(srcDir, "Application.evtx")
+	slow := filepath.Join(srcDir, "Security.evtx")
+	for _, path := range []string{first, slow} {
+		if err := os.WriteFile(path, []byte("ElfFile\x00"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inFlight := make(chan struct{})
+	run.Register(&fakeModule{name: "windows/evtx", collect: func(ctx context.Context, outDir string) error {
+		if _, _, _, err := winutil.FullCopy(ctx, first, filepath.Join(outDir, "Application.evtx")); err != nil {
+			return err
+		}
+		// A copy that trickles one chunk at a time until the run is cancelled
+		done := progress.BeginCopy(slow, filepath.Join(outDir, "Security.evtx"))
+		defer done(false)
+		close(inFlight)
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}})
+	run.Register(&fakeModule{name: "sysinfo"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-inFlight
+		cancel()
+	}()
+	if _, err := run.CollectAll(ctx); err == nil {
+		t.Fatal("cancelled run reported no error")
+	}
+
+	data, err := os.ReadFile(filepath.Join(run.artifactsDir, InterruptedReportName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report InterruptedReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Reason != context.Canceled.Error() || len(report.Modules) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	byName := make(map[string]InterruptedModule)
+	for _, m := range report.Modules {
+		byName[m.Module] = m
+	}
+	evtx := byName["windows/evtx"]
+	if evtx.InFlight != slow || evtx.LastCompleted != first || evtx.CompletedFiles != 1 {
+		t.Fatalf("windows/evtx = %+v, want %s in flight after %s", evtx, slow, first)
+	}
+	if idle := byName["sysinfo"]; idle.InFlight != "" || idle.LastCompleted != "" {
+		t.Fatalf("sysinfo = %+v, want no copies", idle)
+	}
+}
+
+func TestCompletedRunWritesNoInterruptedReport(t *testing.T) {
+	run := newTestRun(t, 1)
+	run.Register(&fakeModule{name: "sysinfo"})
+	if _, err := run.CollectAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(run.artifactsDir, InterruptedReportName)); !os.IsNotExist(err) {
+		t.Fatalf("%s written for a completed run: %v", InterruptedReportName, err)
+	}
+}
+
+// liveModule is a fake module that queries the running OS.
+type liveModule struct{ fakeModule }
+
+func (m *liveModule) RequiresLiveSystem() bool { return true }
+
+func TestOfflineRunSkipsLiveModules(t *testing.T) {
+	root := t.TempDir()
+	hive := filepath.Join(root, "Windows", "System32", "config", "SYSTEM")
+	if err := os.MkdirAll(filepath.Dir(hive), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hive, []byte("regf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := newTestRun(t, 2)
+	run.SetOfflineRoot(root)
+	liveRan := false
+	run.Register(&liveModule{fakeModule{name: "windows/networkinfo", collect: func(ctx context.Context, outDir string) error {
+		liveRan = true
+		return nil
+	}}})
+	// A file-based module reads from the root
+	run.Register(&fakeModule{name: "windows/registry", collect: func(ctx context.Context, outDir string) error {
+		_, _, _, err := winutil.FullCopy(ctx, hive, filepath.Join(outDir, "SYSTEM"))
+		return err
+	}})
+
+	results, err := run.CollectAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if liveRan {
+		t.Error("live-only module ran against an offline root")
+	}
+	byName := make(map[string]Result)
+	for _, result := range results {
+		byName[result.Module] = result
+	}
+	if live := byName["windows/networkinfo"]; !live.OK || live.Skipped != SkipRequiresLiveSystem {
+		t.Errorf("live module result = %+v", live)
+	}
+	if registry := byName["windows/registry"]; !registry.OK || registry.Skipped != "" {
+		t.Errorf("file module result = %+v", registry)
+	}
+	if data, err := os.ReadFile(filepath.Join(run.artifactsDir, "windows_registry", "SYSTEM")); err != nil || string(data) != "regf" {
+		t.Errorf("hive from the root = %q, %v", data, err)
+	}
+
+	// The same module runs when collecting from the live system
+	live := newTestRun(t, 1)
+	live.Register(&liveModule{fakeModule{name: "windows/networkinfo", collect: func(ctx context.Context, outDir string) error {
+		liveRan = true
+		return nil
+	}}})
+	if _, err := live.CollectAll(context.Background()); err != nil || !liveRan {
+		t.Fatalf("live run: ran = %v, err = %v", liveRan, err)
+	}
+}
+
+// strictTestRun registers a module that fails once a slow one has started
+// and a module that depends on the failing one. Unless waitForCancel is
+// set, the slow module finishes on its own after the failure.
+func strictTestRun(t *testing.T, strict, waitForCancel bool) (run *Run, slowCause *error, dependentRan *bool) {
+	run = newTestRun(t, 2)
+	run.SetStrict(strict)
+	slowCause, dependentRan = new(error), new(bool)
+	started, failed := make(chan struct{}), make(chan struct{})
+	run.Register(&fakeModule{name: "windows/evtx", collect: func(ctx context.Context, outDir string) error {
+		close(started)
+		if !waitForCancel {
+			<-failed
+			return nil
+		}
+		<-ctx.Done()
+		*slowCause = context.Cause(ctx)
+		return ctx.Err()
+	}})
+	run.Register(&fakeModule{name: "windows/registry", collect: func(ctx context.Context, outDir string) error {
+		<-started
+		defer close(failed)
+		return errors.New("failed to copy SYSTEM: access denied")
+	}})
+	run.Register(&dependentModule{fakeModule{name: "windows/prefetch", collect: func(ctx context.Context, outDir string) error {
+		*dependentRan = true
+		return nil
+	}}, []string{"windows/registry"}})
+	return run, slowCause, dependentRan
+}
+
+func TestStrictRunStopsOnFirstFailure(t *testing.T) {
+	run, slowCause, dependentRan := strictTestRun(t, true, true)
+	results, err := run.CollectAll(context.Background())
+	if err == nil || err.Error() != "strict mode: module windows/registry failed: failed to copy SYSTEM: access denied" {
+		t.Fatalf("strict run = %v", err)
+	}
+	// The running module is cancelled with the failure as the cause, and the
+	// one not yet started is skipped
+	if *slowCause != err {
+		t.Errorf("running module cancelled with %v", *slowCause)
+	}
+	if *dependentRan {
+		t.Error("module started after the run was aborted")
+	}
+	byName := make(map[string]Result)
+	for _, result := range results {
+		byName[result.Module] = result
+	}
+	if len(results) != 3 {
+		t.Fatalf("results = %+v", results)
+	}
+	if evtx := byName["windows/evtx"]; evtx.OK {
+		t.Errorf("cancelled module result = %+v", evtx)
+	}
+	if prefetch := byName["windows/prefetch"]; prefetch.OK || prefetch.Skipped != SkipStrictAbort || !strings.Contains(prefetch.Error, "windows/registry failed") {
+		t.Errorf("skipped module result = %+v", prefetch)
+	}
+
+	// What was collected before the abort is still described
+	data, err := os.ReadFile(filepath.Join(run.artifactsDir, InterruptedReportName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report InterruptedReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(report.Reason, "strict mode:") {
+		t.Fatalf("report reason = %q", report.Reason)
+	}
+}
+
+func TestBestEffortRunCompletesAfterAFailure(t *testing.T) {
+	run, _, dependentRan := strictTestRun(t, false, false)
+	results, err := run.CollectAll(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "windows/registry") || strings.Contains(err.Error(), "strict mode") {
+		t.Fatalf("run = %v", err)
+	}
+	if !*dependentRan {
+		t.Error("dependent of a failed module did not run")
+	}
+	for _, result := range results {
+		if result.OK != (result.Module != "windows/registry") || result.Skipped != "" {
+			t.Errorf("result = %+v", result)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(run.artifactsDir, InterruptedReportName)); !os.IsNotExist(err) {
+		t.Errorf("%s written for a completed run: %v", InterruptedReportName, err)
+	}
+}
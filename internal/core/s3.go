@@ -0,0 +1,482 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3PartSize is the size of each part of a multipart upload. Files no larger
+// are sent with a single PUT. S3 allows 10,000 parts, so this covers archives
+// up to 640 GB. A variable so tests can upload in small parts.
+var s3PartSize int64 = 64 << 20
+
+// s3Attempts is how many times a request that failed on the network or with
+// a server error is sent before the upload gives up.
+const s3Attempts = 3
+
+// S3Target is the bucket and key prefix an s3://bucket/prefix URL names.
+type S3Target struct {
+	Bucket string
+	Prefix string // Empty, or ends in "/"
+}
+
+// ParseS3URL parses an --upload-s3 URL of the form s3://bucket/prefix.
+func ParseS3URL(raw string) (*S3Target, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an s3://bucket/prefix URL", raw)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("%q must not carry credentials, a query, or a fragment", raw)
+	}
+	target := &S3Target{Bucket: u.Host, Prefix: strings.Trim(u.Path, "/")}
+	if target.Prefix != "" {
+		target.Prefix += "/"
+	}
+	return target, nil
+}
+
+// String returns the target as an s3:// URL.
+func (t *S3Target) String() string {
+	return "s3://" + t.Bucket + "/" + t.Prefix
+}
+
+// S3Credentials are the access key, region, and endpoint an upload signs its
+// requests with.
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Temporary credentials only
+	Region          string
+	Endpoint        string // S3-compatible service URL; empty for AWS
+}
+
+// S3CredentialsFromEnv reads credentials from the standard AWS environment
+// variables: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN,
+// AWS_REGION or AWS_DEFAULT_REGION (default us-east-1), and
+// AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL for S3-compatible services.
+func S3CredentialsFromEnv() (S3Credentials, error) {
+	creds := S3Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Region:          firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		Endpoint:        firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	if creds.Region == "" {
+		creds.Region = "us-east-1"
+	}
+	return creds, nil
+}
+
+// firstEnv returns the first of the named environment variables that is set.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// S3Object is one file uploaded to the bucket.
+type S3Object struct {
+	Path  string `json:"path"` // Local file that was uploaded
+	Key   string `json:"key"`
+	ETag  string `json:"etag"`
+	Size  int64  `json:"size"`
+	Parts int    `json:"parts,omitempty"` // Parts of a multipart upload; 0 for a single PUT
+}
+
+// S3Upload records where a run's archive was uploaded.
+type S3Upload struct {
+	URL          string     `json:"url"`
+	Objects      []S3Object `json:"objects"`
+	DeletedLocal bool       `json:"deleted_local,omitempty"` // Local copies removed by --delete-after-upload
+	Error        string     `json:"error,omitempty"`
+}
+
+// S3Uploader uploads files to an S3 bucket with Signature Version 4 signed
+// requests.
+type S3Uploader struct {
+	target    *S3Target
+	creds     S3Credentials
+	endpoint  *url.URL
+	pathStyle bool
+	client    *http.Client
+}
+
+// NewS3Uploader returns an uploader for target. When pins is non-empty the
+// endpoint's TLS chain must carry a pinned key.
+func NewS3Uploader(target *S3Target, creds S3Credentials, pins SPKIPins) (*S3Uploader, error) {
+	uploader := &S3Uploader{target: target, creds: creds}
+
+	// AWS is addressed virtual-hosted style; S3-compatible services and bucket
+	// names with dots, which no wildcard certificate covers, take the bucket
+	// in the path
+	endpoint := creds.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + creds.Region + ".amazonaws.com"
+		uploader.pathStyle = strings.Contains(target.Bucket, ".")
+	} else {
+		uploader.pathStyle = true
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %w", endpoint, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: want an http or https URL", endpoint)
+	}
+	if len(pins) > 0 && u.Scheme != "https" {
+		return nil, fmt.Errorf("S3 endpoint %q is not HTTPS, so --pin-sha256 cannot be enforced", endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	uploader.endpoint = u
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(pins) > 0 {
+		transport.TLSClientConfig = pins.TLSConfig("")
+	}
+	uploader.client = &http.Client{Transport: transport}
+	return uploader, nil
+}
+
+// UploadFiles uploads each file under the target prefix, named by its base
+// name, in order. On failure it returns the objects uploaded so far with the
+// error.
+func (u *S3Uploader) UploadFiles(ctx context.Context, paths []string) (*S3Upload, error) {
+	upload := &S3Upload{URL: u.target.String(), Objects: make([]S3Object, 0, len(paths))}
+	for _, path := range paths {
+		object, err := u.uploadFile(ctx, path)
+		if err != nil {
+			upload.Error = err.Error()
+			return upload, err
+		}
+		upload.Objects = append(upload.Objects, object)
+	}
+	return upload, nil
+}
+
+// uploadFile sends one file with a single PUT, or as a multipart upload when
+// it is larger than one part.
+func (u *S3Uploader) uploadFile(ctx context.Context, path string) (S3Object, error) {
+	object := S3Object{Path: path, Key: u.target.Prefix + filepath.Base(path)}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return object, fmt.Errorf("failed to open %s for upload: %w", path, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return object, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	object.Size = info.Size()
+
+	if object.Size <= s3PartSize {
+		resp, err := u.send(ctx, http.MethodPut, object.Key, nil, io.NewSectionReader(file, 0, object.Size))
+		if err != nil {
+			return object, err
+		}
+		object.ETag = resp.Header.Get("ETag")
+		return object, nil
+	}
+
+	object.ETag, object.Parts, err = u.multipartUpload(ctx, object.Key, file, object.Size)
+	return object, err
+}
+
+// s3CompletedPart is a part listed in a CompleteMultipartUpload request.
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// multipartUpload sends file in s3PartSize parts and returns the ETag of the
+// assembled object and the number of parts. A failed upload is aborted so
+// its parts do not linger in the bucket.
+func (u *S3Uploader) multipartUpload(ctx context.Context, key string, file *os.File, size int64) (string, int, error) {
+	resp, err := u.send(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp.Body, &initiated); err != nil || initiated.UploadID == "" {
+		return "", 0, fmt.Errorf("unexpected CreateMultipartUpload response for %s", key)
+	}
+
+	etag, parts, err := u.uploadParts(ctx, key, initiated.UploadID, file, size)
+	if err != nil {
+		abortCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		u.send(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil)
+		return "", 0, err
+	}
+	return etag, parts, nil
+}
+
+// uploadParts sends the parts of a multipart upload and completes it.
+func (u *S3Uploader) uploadParts(ctx context.Context, key, uploadID string, file *os.File, size int64) (string, int, error) {
+	parts := make([]s3CompletedPart, 0, (size+s3PartSize-1)/s3PartSize)
+	for offset := int64(0); offset < size; offset += s3PartSize {
+		length := size - offset
+		if length > s3PartSize {
+			length = s3PartSize
+		}
+		number := len(parts) + 1
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := u.send(ctx, http.MethodPut, key, query, io.NewSectionReader(file, offset, length))
+		if err != nil {
+			return "", 0, fmt.Errorf("part %d: %w", number, err)
+		}
+		parts = append(parts, s3CompletedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return "", 0, err
+	}
+	resp, err := u.send(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(body))
+	if err != nil {
+		return "", 0, err
+	}
+	// S3 can report a failed completion in the body of a 200 response
+	var completed struct {
+		XMLName xml.Name
+		ETag    string
+		Code    string
+		Message string
+	}
+	if err := xml.Unmarshal(resp.Body, &completed); err != nil {
+		return "", 0, fmt.Errorf("unexpected CompleteMultipartUpload response for %s: %w", key, err)
+	}
+	if completed.XMLName.Local == "Error" {
+		return "", 0, fmt.Errorf("failed to complete upload of %s: %s (%s)", key, completed.Message, completed.Code)
+	}
+	return completed.ETag, len(parts), nil
+}
+
+// s3Response is the headers and body of a successful request.
+type s3Response struct {
+	Header http.Header
+	Body   []byte
+}
+
+// send signs and sends a request for key, retrying network failures and
+// server errors. body, read once to hash it and again for each attempt, may
+// be nil.
+func (u *S3Uploader) send(ctx context.Context, method, key string, query url.Values, body io.ReadSeeker) (*s3Response, error) {
+	payloadHash := emptySHA256
+	if body != nil {
+		hasher := sha256.New()
+		if _, err := io.Copy(hasher, body); err != nil {
+			return nil, fmt.Errorf("failed to read upload of %s: %w", key, err)
+		}
+		payloadHash = hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= s3Attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(attempt-1) * 2 * time.Second):
+			}
+		}
+		var reqBody io.Reader
+		var length int64
+		if body != nil {
+			end, err := body.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			if end > 0 {
+				reqBody, length = io.NopCloser(body), end
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, u.objectURL(key, query).String(), reqBody)
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = length
+		u.sign(req, payloadHash, time.Now())
+
+		resp, err := u.client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = fmt.Errorf("%s %s: %w", method, key, err)
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = fmt.Errorf("%s %s: failed to read response: %w", method, key, err)
+			continue
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return &s3Response{Header: resp.Header, Body: data}, nil
+		}
+
+		lastErr = s3Error(method, key, resp.StatusCode, data)
+		if resp.StatusCode < 500 {
+			return nil, lastErr
+		}
+	}
+	return nil, lastErr
+}
+
+// s3Error describes a failed request from the error document S3 returns.
+func s3Error(method, key string, status int, body []byte) error {
+	var doc struct {
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(body, &doc) == nil && doc.Code != "" {
+		return fmt.Errorf("%s %s: %s (%s, HTTP %d)", method, key, doc.Message, doc.Code, status)
+	}
+	return fmt.Errorf("%s %s: HTTP %d", method, key, status)
+}
+
+// emptySHA256 is the hash of an empty request body.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// objectURL returns the URL of key in the bucket with the given query.
+func (u *S3Uploader) objectURL(key string, query url.Values) *url.URL {
+	target := *u.endpoint
+	rawPath := u.endpoint.Path
+	if u.pathStyle {
+		rawPath += "/" + s3Escape(u.target.Bucket, true)
+	} else {
+		target.Host = u.target.Bucket + "." + target.Host
+	}
+	rawPath += "/" + s3Escape(key, false)
+
+	target.RawPath = rawPath
+	target.Path, _ = url.PathUnescape(rawPath)
+	target.RawQuery = s3CanonicalQuery(query)
+	return &target
+}
+
+// sign adds a Signature Version 4 Authorization header to req.
+func (u *S3Uploader) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + u.creds.Region + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if u.creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + u.creds.SecretAccessKey)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery encodes query sorted by key, as Signature Version 4
+// requires; a key with an empty value is written "key=".
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes every byte but the unreserved characters of RFC
+// 3986, and "/" unless encodeSlash is set.
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
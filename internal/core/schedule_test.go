@@ -0,0 +1,87 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dependentModule is a fake module that waits for the modules it names.
+type dependentModule struct {
+	fakeModule
+	deps []string
+}
+
+func (m *dependentModule) DependsOn() []string { return m.deps }
+
+func TestDependentModuleRunsAfterPrerequisite(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	// The prerequisite holds its slot until the independent module has
+	// started, so the dependent cannot be holding the other one
+	independentStarted := make(chan struct{})
+	run := newTestRun(t, 2)
+	run.Register(&dependentModule{
+		fakeModule: fakeModule{name: "windows/amcache", collect: func(ctx context.Context, outDir string) error {
+			record("amcache started")
+			return nil
+		}},
+		deps: []string{"windows/registry", "windows/not_registered"},
+	})
+	run.Register(&fakeModule{name: "windows/registry", collect: func(ctx context.Context, outDir string) error {
+		select {
+		case <-independentStarted:
+		case <-time.After(5 * time.Second):
+			return errors.New("independent module never started")
+		}
+		record("registry finished")
+		return nil
+	}})
+	run.Register(&fakeModule{name: "windows/prefetch", collect: func(ctx context.Context, outDir string) error {
+		close(independentStarted)
+		return nil
+	}})
+
+	if err := run.CheckDependencies(); err != nil {
+		t.Fatal(err)
+	}
+	results, err := run.CollectAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("results = %+v", results)
+	}
+	if want := []string{"registry finished", "amcache started"}; !reflect.DeepEqual(events, want) {
+		t.Fatalf("events = %q, want %q", events, want)
+	}
+}
+
+func TestDependencyCycleIsRejected(t *testing.T) {
+	run := newTestRun(t, 2)
+	ran := false
+	collect := func(ctx context.Context, outDir string) error {
+		ran = true
+		return nil
+	}
+	run.Register(&fakeModule{name: "windows/prefetch", collect: collect})
+	run.Register(&dependentModule{fakeModule: fakeModule{name: "a", collect: collect}, deps: []string{"b"}})
+	run.Register(&dependentModule{fakeModule: fakeModule{name: "b", collect: collect}, deps: []string{"a"}})
+
+	const want = "module dependency cycle: a -> b -> a"
+	if err := run.CheckDependencies(); err == nil || err.Error() != want {
+		t.Fatalf("CheckDependencies = %v, want %q", err, want)
+	}
+	if results, err := run.CollectAll(context.Background()); err == nil || results != nil || ran {
+		t.Fatalf("CollectAll with a cycle = %+v, %v; ran = %v", results, err, ran)
+	}
+}
@@ -0,0 +1,141 @@
+// Package core provides self-removal support for covert collection runs.
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// ErrSelfDeleteRequiresDelivery is returned when self-deletion is requested but
+// the archive was not successfully delivered to a remote destination.
+var ErrSelfDeleteRequiresDelivery = errors.New("self-delete requires a successful remote delivery of the archive")
+
+// ErrSelfDeleteIntentNotRecorded is returned when self-deletion is requested
+// but its intent could not be written to the collection's custody record.
+var ErrSelfDeleteIntentNotRecorded = errors.New("self-delete requires its intent to be recorded in the collection first")
+
+// SelfDeleteIntentName is the custody record written to the artifacts root
+// when --self-delete is requested, so the archive documents that the tool
+// removed itself.
+const SelfDeleteIntentName = "self_delete_intent.json"
+
+// SelfDeleteIntent is the content of self_delete_intent.json.
+type SelfDeleteIntent struct {
+	RequestedUTC string `json:"requested_utc"`
+	Executable   string `json:"executable"`
+	ArtifactsDir string `json:"artifacts_dir"`
+	OutputDir    string `json:"output_dir"` // Archive and sidecar files written here are removed too
+	Condition    string `json:"condition"`
+}
+
+// RecordSelfDeleteIntent writes self_delete_intent.json to the root of
+// artifactsDir before anything is collected, so it is packed and delivered
+// with the evidence. ScheduleSelfDelete refuses to run unless it succeeded.
+func RecordSelfDeleteIntent(ctx context.Context, artifactsDir, outputDir string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to resolve executable path: %w", err)
+	}
+	intent := SelfDeleteIntent{
+		RequestedUTC: winutil.FormatTime(winutil.Now(ctx)),
+		Executable:   exePath,
+		ArtifactsDir: artifactsDir,
+		OutputDir:    outputDir,
+		Condition:    "after successful remote delivery of the archive",
+	}
+	data, err := json.MarshalIndent(intent, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal self-delete intent: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, SelfDeleteIntentName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write self-delete intent: %w", err)
+	}
+	return nil
+}
+
+// CheckSelfDeleteAllowed refuses self-deletion unless its intent is on record
+// and the archive has left the host, so the only copy of the evidence is
+// never destroyed.
+func CheckSelfDeleteAllowed(delivered, intentRecorded bool) error {
+	if !intentRecorded {
+		return ErrSelfDeleteIntentNotRecorded
+	}
+	if !delivered {
+		return ErrSelfDeleteRequiresDelivery
+	}
+	return nil
+}
+
+// ScheduleSelfDelete launches the trampoline detached from this process. The removal
+// happens after exit, so callers should return promptly once this succeeds.
+func ScheduleSelfDelete(delivered, intentRecorded bool, paths []string) error {
+	if err := CheckSelfDeleteAllowed(delivered, intentRecorded); err != nil {
+		return err
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to resolve executable path: %w", err)
+	}
+	if err := startSelfDelete(exePath, paths); err != nil {
+		return fmt.Errorf("failed to start self-delete trampoline: %w", err)
+	}
+	return nil
+}
+
+// windowsSelfDeleteCommandLine builds the cmd.exe arguments of the Windows
+// trampoline, as a command line passed verbatim: Go's per-argument escaping
+// of exec.Command produces \" sequences that cmd.exe does not understand.
+// With /s, cmd.exe strips only the outer quotes, leaving each quoted path
+// intact. The ping provides a short delay so this process has exited before
+// del runs. Paths that cmd.exe would expand or split are refused.
+func windowsSelfDeleteCommandLine(exePath string, paths []string) (string, error) {
+	quote := func(p string) (string, error) {
+		if strings.ContainsAny(p, "\"%\r\n") {
+			return "", fmt.Errorf("cannot safely quote %q for cmd.exe", p)
+		}
+		return `"` + p + `"`, nil
+	}
+
+	exe, err := quote(exePath)
+	if err != nil {
+		return "", err
+	}
+	steps := []string{"ping 127.0.0.1 -n 3 > nul", "del /f /q " + exe}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		quoted, err := quote(p)
+		if err != nil {
+			return "", err
+		}
+		steps = append(steps, "rmdir /s /q "+quoted+" 2> nul", "del /f /q "+quoted+" 2> nul")
+	}
+	return `/d /s /c "` + strings.Join(steps, " & ") + `"`, nil
+}
+
+// posixSelfDeleteScript builds the sh -c script of the trampoline, with a
+// short sleep so this process has exited before removal.
+func posixSelfDeleteScript(exePath string, paths []string) string {
+	steps := []string{"sleep 2", "rm -f " + shellQuote(exePath)}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		steps = append(steps, "rm -rf "+shellQuote(p))
+	}
+	return strings.Join(steps, "; ")
+}
+
+// shellQuote wraps a path in single quotes for POSIX sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
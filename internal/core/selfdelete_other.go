@@ -0,0 +1,21 @@
+//go:build !windows
+
+package core
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startSelfDelete runs the trampoline in its own session, so it is not
+// killed with this process's group when the shell that started it exits.
+func startSelfDelete(exePath string, paths []string) error {
+	cmd := exec.Command("sh", "-c", posixSelfDeleteScript(exePath, paths))
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Do not wait: the trampoline must outlive this process
+	return cmd.Process.Release()
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCheckSelfDeleteAllowed(t *testing.T) {
+	tests := []struct {
+		name                      string
+		delivered, intentRecorded bool
+		want                      error
+	}{
+		{"delivered and recorded", true, true, nil},
+		{"not delivered", false, true, ErrSelfDeleteRequiresDelivery},
+		{"intent not recorded", true, false, ErrSelfDeleteIntentNotRecorded},
+		{"neither", false, false, ErrSelfDeleteIntentNotRecorded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckSelfDeleteAllowed(tt.delivered, tt.intentRecorded); !errors.Is(err, tt.want) {
+				t.Fatalf("CheckSelfDeleteAllowed(%v, %v) = %v, want %v", tt.delivered, tt.intentRecorded, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleSelfDeleteRefusesWithoutDelivery(t *testing.T) {
+	dir := t.TempDir()
+	keep := filepath.Join(dir, "archive.tar.gz")
+	if err := os.WriteFile(keep, []byte("evidence"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ScheduleSelfDelete(false, true, []string{keep}); !errors.Is(err, ErrSelfDeleteRequiresDelivery) {
+		t.Fatalf("ScheduleSelfDelete without delivery = %v", err)
+	}
+	if err := ScheduleSelfDelete(true, false, []string{keep}); !errors.Is(err, ErrSelfDeleteIntentNotRecorded) {
+		t.Fatalf("ScheduleSelfDelete without a custody record = %v", err)
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Fatalf("refused self-delete removed the archive: %v", err)
+	}
+}
+
+func TestWindowsSelfDeleteCommandLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		exe     string
+		paths   []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "executable only",
+			exe:  `C:\Tools\cryptkeeper.exe`,
+			want: `/d /s /c "ping 127.0.0.1 -n 3 > nul & del /f /q "C:\Tools\cryptkeeper.exe""`,
+		},
+		{
+			name:  "paths with spaces",
+			exe:   `C:\IR Tools\cryptkeeper.exe`,
+			paths: []string{`C:\Temp\cryptkeeper-1-x`, "", `D:\Out Dir\host.tar.gz`},
+			want: `/d /s /c "ping 127.0.0.1 -n 3 > nul & del /f /q "C:\IR Tools\cryptkeeper.exe"` +
+				` & rmdir /s /q "C:\Temp\cryptkeeper-1-x" 2> nul & del /f /q "C:\Temp\cryptkeeper-1-x" 2> nul` +
+				` & rmdir /s /q "D:\Out Dir\host.tar.gz" 2> nul & del /f /q "D:\Out Dir\host.tar.gz" 2> nul"`,
+		},
+		{
+			name:    "percent would expand",
+			exe:     `C:\Tools\cryptkeeper.exe`,
+			paths:   []string{`C:\Temp\%PATH%`},
+			wantErr: true,
+		},
+		{
+			name:    "quote would end the argument",
+			exe:     `C:\Tools\crypt"keeper.exe`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := windowsSelfDeleteCommandLine(tt.exe, tt.paths)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("accepted %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("command line\n got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPOSIXSelfDeleteScript(t *testing.T) {
+	got := posixSelfDeleteScript("/opt/ir tools/cryptkeeper", []string{"/tmp/it's here", ""})
+	want := `sleep 2; rm -f '/opt/ir tools/cryptkeeper'; rm -rf '/tmp/it'\''s here'`
+	if got != want {
+		t.Fatalf("script\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestPOSIXSelfDeleteScriptRemovesQuotedPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "ir tools", "cryptkeeper")
+	artifacts := filepath.Join(dir, "it's here")
+	for _, path := range []string{exe, filepath.Join(artifacts, "file")} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out, err := exec.Command("sh", "-c", posixSelfDeleteScript(exe, []string{artifacts})).CombinedOutput(); err != nil {
+		t.Fatalf("script failed: %v: %s", err, out)
+	}
+	for _, path := range []string{exe, artifacts} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", path)
+		}
+	}
+}
+
+func TestRecordSelfDeleteIntent(t *testing.T) {
+	dir := t.TempDir()
+	if err := RecordSelfDeleteIntent(context.Background(), dir, "/out"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, SelfDeleteIntentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var intent SelfDeleteIntent
+	if err := json.Unmarshal(data, &intent); err != nil {
+		t.Fatal(err)
+	}
+	if intent.Executable == "" || intent.ArtifactsDir != dir || intent.OutputDir != "/out" || intent.RequestedUTC == "" {
+		t.Fatalf("intent = %+v", intent)
+	}
+
+	if err := RecordSelfDeleteIntent(context.Background(), filepath.Join(dir, "missing"), "/out"); err == nil {
+		t.Fatal("intent written into a missing directory")
+	}
+}
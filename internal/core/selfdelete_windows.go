@@ -0,0 +1,39 @@
+//go:build windows
+
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// startSelfDelete uses cmd.exe because a running executable cannot delete
+// itself on Windows. The trampoline is detached from this console and in its
+// own process group, so closing the console or a Ctrl+C does not stop it.
+func startSelfDelete(exePath string, paths []string) error {
+	args, err := windowsSelfDeleteCommandLine(exePath, paths)
+	if err != nil {
+		return err
+	}
+	comspec := os.Getenv("ComSpec")
+	if comspec == "" {
+		comspec = filepath.Join(os.Getenv("SystemRoot"), "System32", "cmd.exe")
+	}
+
+	cmd := exec.Command(comspec)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine:       syscall.EscapeArg(comspec) + " " + args,
+		CreationFlags: windows.DETACHED_PROCESS | windows.CREATE_NEW_PROCESS_GROUP,
+		HideWindow:    true,
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Do not wait: the trampoline must outlive this process
+	return cmd.Process.Release()
+}
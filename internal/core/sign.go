@@ -0,0 +1,261 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cryptkeeper/internal/winutil"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SignatureSuffix is appended to an archive's path to name its detached
+// signature.
+const SignatureSuffix = ".sig"
+
+// SignatureAlgorithm is the scheme of detached archive signatures: Ed25519
+// over the SHA-512 of the archive (RFC 8032 Ed25519ph), so an archive of any
+// size is signed without holding it in memory.
+const SignatureAlgorithm = "ed25519ph"
+
+// ArchiveSignature is the content of a detached archive signature file.
+type ArchiveSignature struct {
+	Algorithm string `json:"algorithm"`
+	Archive   string `json:"archive"`    // File name of the signed archive
+	PublicKey string `json:"public_key"` // OpenSSH authorized_keys format
+	Signature string `json:"signature"`  // Base64
+	SignedUTC string `json:"signed_utc"`
+}
+
+// SignaturePath returns the path of the detached signature of an archive.
+func SignaturePath(archivePath string) string {
+	return archivePath + SignatureSuffix
+}
+
+// LoadSigningKey reads an unencrypted Ed25519 private key in OpenSSH or
+// PKCS#8 PEM format, as written by ssh-keygen -t ed25519 or openssl genpkey.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open signing key: %w", err)
+	}
+	raw, err := ssh.ParseRawPrivateKey(data)
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return nil, fmt.Errorf("signing key %s is passphrase-protected; use an unencrypted key", path)
+		}
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+	switch key := raw.(type) {
+	case ed25519.PrivateKey:
+		return key, nil
+	case *ed25519.PrivateKey:
+		return *key, nil
+	default:
+		return nil, fmt.Errorf("signing key %s is %T, not an Ed25519 key", path, raw)
+	}
+}
+
+// FormatSigningPublicKey returns the public half of key in OpenSSH
+// authorized_keys format.
+func FormatSigningPublicKey(key ed25519.PrivateKey) (string, error) {
+	public, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(public))), nil
+}
+
+// SignArchive signs the archive described by meta, reading its volumes in
+// order when it was split, and writes the signature next to the archive. It
+// records the signature path and public key in meta.
+func SignArchive(ctx context.Context, meta *PackageMetadata, key ed25519.PrivateKey) error {
+	digest, err := archiveDigest(meta.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read archive for signing: %w", err)
+	}
+	signature, err := key.Sign(rand.Reader, digest, &ed25519.Options{Hash: crypto.SHA512})
+	if err != nil {
+		return fmt.Errorf("failed to sign archive: %w", err)
+	}
+	publicKey, err := FormatSigningPublicKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode signing public key: %w", err)
+	}
+
+	sig := ArchiveSignature{
+		Algorithm: SignatureAlgorithm,
+		Archive:   filepath.Base(meta.Path),
+		PublicKey: publicKey,
+		Signature: base64.StdEncoding.EncodeToString(signature),
+		SignedUTC: winutil.FormatTime(winutil.Now(ctx)),
+	}
+	data, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := SignaturePath(meta.Path)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write signature %s: %w", path, err)
+	}
+
+	meta.Signature = path
+	meta.SigningPublicKey = publicKey
+	return nil
+}
+
+// archiveDigest returns the SHA-512 of an archive, or of its volumes
+// concatenated.
+func archiveDigest(archivePath string) ([]byte, error) {
+	file, err := openArchiveFile(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hasher := sha512.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
+
+// Signature check statuses. Only a signature made with the key given to
+// check against passes: one that merely verifies with the key it names
+// itself proves nothing, as anyone can re-sign a modified archive.
+const (
+	SignatureTrusted   = "trusted"         // Valid and made with the trusted key
+	SignatureUntrusted = "valid_untrusted" // Valid with the key it names, with no trusted key to check against
+	SignatureWrongKey  = "wrong_key"       // Valid, but made with another key than the trusted one
+	SignatureMissing   = "missing"         // A trusted key was given but the archive is unsigned
+	SignatureInvalid   = "invalid"         // Unreadable, or does not match the archive
+)
+
+// untrustedSignatureWarning explains why a valid signature did not pass.
+const untrustedSignatureWarning = "signature is valid for the key it names, but no --signed-by key was given to trust that key"
+
+// SignatureCheck is the result of verifying a detached archive signature.
+type SignatureCheck struct {
+	Path      string `json:"path"`
+	Status    string `json:"status"`
+	PublicKey string `json:"public_key,omitempty"`
+	Valid     bool   `json:"valid"`
+	Trusted   *bool  `json:"trusted,omitempty"` // Whether the signing key is the one checked against
+	Warning   string `json:"warning,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// OK reports whether the signature verified with the trusted key.
+func (c *SignatureCheck) OK() bool {
+	return c.Status == SignatureTrusted
+}
+
+// classify sets the status from the outcome of the check.
+func (c *SignatureCheck) classify(missing bool) {
+	switch {
+	case missing:
+		c.Status = SignatureMissing
+	case !c.Valid:
+		c.Status = SignatureInvalid
+	case c.Trusted == nil:
+		c.Status = SignatureUntrusted
+		c.Warning = untrustedSignatureWarning
+	case *c.Trusted:
+		c.Status = SignatureTrusted
+	default:
+		c.Status = SignatureWrongKey
+	}
+}
+
+// VerifyArchiveSignature checks the detached signature next to an archive,
+// or next to the archive a first volume belongs to. trustedKey, an OpenSSH
+// public key or a file holding one, is the key the signature must have been
+// made with; without it the signature is only checked against the key it
+// names and, even when valid, does not pass. It returns nil when there is no
+// signature and no trusted key.
+func VerifyArchiveSignature(archivePath, trustedKey string) (*SignatureCheck, error) {
+	var trusted ssh.PublicKey
+	if trustedKey != "" {
+		text := []byte(trustedKey)
+		if data, err := os.ReadFile(trustedKey); err == nil {
+			text = data
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trusted signing key: %w", err)
+		}
+		trusted = key
+	}
+
+	sigPath := SignaturePath(strings.TrimSuffix(archivePath, ".001"))
+	check := &SignatureCheck{Path: sigPath}
+	data, err := os.ReadFile(sigPath)
+	if os.IsNotExist(err) && trusted == nil {
+		return nil, nil
+	}
+	if err != nil {
+		check.Error = err.Error()
+		check.classify(os.IsNotExist(err))
+		return check, nil
+	}
+	defer check.classify(false)
+
+	var sig ArchiveSignature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		check.Error = fmt.Sprintf("failed to parse signature: %v", err)
+		return check, nil
+	}
+	check.PublicKey = sig.PublicKey
+	if sig.Algorithm != SignatureAlgorithm {
+		check.Error = fmt.Sprintf("unsupported signature algorithm %q", sig.Algorithm)
+		return check, nil
+	}
+	signer, _, _, _, err := ssh.ParseAuthorizedKey([]byte(sig.PublicKey))
+	if err != nil {
+		check.Error = fmt.Sprintf("failed to parse signing key: %v", err)
+		return check, nil
+	}
+	if trusted != nil {
+		match := bytes.Equal(signer.Marshal(), trusted.Marshal())
+		check.Trusted = &match
+	}
+	cryptoKey, ok := signer.(ssh.CryptoPublicKey)
+	if !ok {
+		check.Error = "signing key is not an Ed25519 key"
+		return check, nil
+	}
+	publicKey, ok := cryptoKey.CryptoPublicKey().(ed25519.PublicKey)
+	if !ok {
+		check.Error = "signing key is not an Ed25519 key"
+		return check, nil
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		check.Error = fmt.Sprintf("failed to decode signature: %v", err)
+		return check, nil
+	}
+
+	digest, err := archiveDigest(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive for signature check: %w", err)
+	}
+	if err := ed25519.VerifyWithOptions(publicKey, digest, signature, &ed25519.Options{Hash: crypto.SHA512}); err != nil {
+		check.Error = "signature does not match the archive"
+		return check, nil
+	}
+	check.Valid = true
+	return check, nil
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// signedTestArchive writes an archive and signs it with a new key, returning
+// the archive path and the key.
+func signedTestArchive(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "host.tar.gz")
+	if err := os.WriteFile(path, []byte("archive bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SignArchive(context.Background(), &PackageMetadata{Path: path}, key); err != nil {
+		t.Fatal(err)
+	}
+	return path, key
+}
+
+func signingPublicKey(t *testing.T, key ed25519.PrivateKey) string {
+	t.Helper()
+	publicKey, err := FormatSigningPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publicKey
+}
+
+func TestVerifyArchiveSignatureStatus(t *testing.T) {
+	path, key := signedTestArchive(t)
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		trustedKey string
+		status     string
+		ok         bool
+	}{
+		{"signed-by the signing key", signingPublicKey(t, key), SignatureTrusted, true},
+		{"signed-by another key", signingPublicKey(t, otherKey), SignatureWrongKey, false},
+		{"no signed-by", "", SignatureUntrusted, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check, err := VerifyArchiveSignature(path, tt.trustedKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !check.Valid {
+				t.Fatalf("signature not valid: %s", check.Error)
+			}
+			if check.Status != tt.status || check.OK() != tt.ok {
+				t.Fatalf("status %s, OK %v; want %s, %v", check.Status, check.OK(), tt.status, tt.ok)
+			}
+			if (check.Warning != "") != (tt.status == SignatureUntrusted) {
+				t.Fatalf("warning %q for status %s", check.Warning, check.Status)
+			}
+		})
+	}
+}
+
+func TestVerifyArchiveSignatureTampered(t *testing.T) {
+	path, key := signedTestArchive(t)
+	if err := os.WriteFile(path, []byte("modified bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, trustedKey := range []string{"", signingPublicKey(t, key)} {
+		check, err := VerifyArchiveSignature(path, trustedKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if check.Status != SignatureInvalid || check.OK() || check.Error == "" {
+			t.Fatalf("tampered archive: status %s, OK %v, error %q", check.Status, check.OK(), check.Error)
+		}
+	}
+}
+
+func TestVerifyArchiveSignatureUnsigned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host.tar.gz")
+	if err := os.WriteFile(path, []byte("archive bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check, err := VerifyArchiveSignature(path, "")
+	if err != nil || check != nil {
+		t.Fatalf("unsigned archive without signed-by = %+v, %v; want no check", check, err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, err = VerifyArchiveSignature(path, signingPublicKey(t, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Status != SignatureMissing || check.OK() {
+		t.Fatalf("unsigned archive with signed-by: status %s, OK %v", check.Status, check.OK())
+	}
+}
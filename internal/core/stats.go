@@ -0,0 +1,130 @@
+package core
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ModuleStats is one module's contribution to a collection.
+type ModuleStats struct {
+	Module         string  `json:"module"`
+	Files          int     `json:"files"`
+	Bytes          int64   `json:"bytes"`
+	Share          float64 `json:"share"`           // Fraction of all collected bytes
+	TruncatedFiles int     `json:"truncated_files"` // Items its manifest marks as truncated by the size caps
+	Duration       string  `json:"duration"`
+}
+
+// RunStats summarizes how much a run collected and how well it packed.
+type RunStats struct {
+	FileCount        int           `json:"file_count"`
+	RawBytes         int64         `json:"raw_bytes"`         // Sum of the collected file sizes
+	ArchiveBytes     int64         `json:"archive_bytes"`     // Size of the archive as written
+	CompressionRatio float64       `json:"compression_ratio"` // Raw bytes per archive byte
+	TruncatedFiles   int           `json:"truncated_files"`
+	RunFileBytes     int64         `json:"run_file_bytes"` // Files at the artifacts root, such as the IOC and PE triage reports
+	WallClock        string        `json:"wall_clock"`
+	Modules          []ModuleStats `json:"modules"` // Largest contribution first
+}
+
+// moduleManifestItems is the part of a module manifest the stats read.
+type moduleManifestItems struct {
+	Items []struct {
+		Truncated bool `json:"truncated"`
+	} `json:"items"`
+}
+
+// ComputeRunStats aggregates the indexed files of a run by module directory,
+// counts the items each module manifest marks as truncated, and compares the
+// collected bytes with the archive size. Files at the artifacts root belong to
+// the run rather than a module and are counted apart.
+func ComputeRunStats(artifactsDir string, manifest *CollectionManifest, results []Result, archiveBytes int64, wallClock time.Duration) *RunStats {
+	stats := &RunStats{
+		ArchiveBytes: archiveBytes,
+		WallClock:    wallClock.Round(time.Millisecond).String(),
+		Modules:      make([]ModuleStats, 0, len(results)),
+	}
+
+	byDir := make(map[string]*ModuleStats, len(results))
+	for _, result := range results {
+		module := &ModuleStats{Module: result.Module}
+		if !result.StartedAt.IsZero() && result.EndedAt.After(result.StartedAt) {
+			module.Duration = result.EndedAt.Sub(result.StartedAt).Round(time.Millisecond).String()
+		} else {
+			module.Duration = time.Duration(0).String()
+		}
+		byDir[SanitizeName(result.Module)] = module
+	}
+
+	for _, entry := range manifest.Files {
+		stats.FileCount++
+		stats.RawBytes += entry.Size
+		dir, _, nested := strings.Cut(entry.Path, "/")
+		if !nested {
+			stats.RunFileBytes += entry.Size
+			continue
+		}
+		module, ok := byDir[dir]
+		if !ok {
+			module = &ModuleStats{Module: dir, Duration: time.Duration(0).String()}
+			byDir[dir] = module
+		}
+		module.Files++
+		module.Bytes += entry.Size
+
+		if path.Base(entry.Path) == moduleManifestName {
+			module.TruncatedFiles += countTruncated(filepath.Join(artifactsDir, filepath.FromSlash(entry.Path)))
+		}
+	}
+
+	for _, module := range byDir {
+		if stats.RawBytes > 0 {
+			module.Share = roundTo(float64(module.Bytes)/float64(stats.RawBytes), 4)
+		}
+		stats.TruncatedFiles += module.TruncatedFiles
+		stats.Modules = append(stats.Modules, *module)
+	}
+	sort.Slice(stats.Modules, func(i, j int) bool {
+		if stats.Modules[i].Bytes != stats.Modules[j].Bytes {
+			return stats.Modules[i].Bytes > stats.Modules[j].Bytes
+		}
+		return stats.Modules[i].Module < stats.Modules[j].Module
+	})
+
+	if archiveBytes > 0 {
+		stats.CompressionRatio = roundTo(float64(stats.RawBytes)/float64(archiveBytes), 2)
+	}
+	return stats
+}
+
+// countTruncated returns how many items of a module manifest are marked as
+// truncated, or 0 when it cannot be read.
+func countTruncated(manifestPath string) int {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return 0
+	}
+	var parsed moduleManifestItems
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return 0
+	}
+	count := 0
+	for _, item := range parsed.Items {
+		if item.Truncated {
+			count++
+		}
+	}
+	return count
+}
+
+// roundTo rounds x to the given number of decimal places.
+func roundTo(x float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(x*scale) / scale
+}
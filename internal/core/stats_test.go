@@ -0,0 +1,59 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComputeRunStats(t *testing.T) {
+	registryManifest := `{"items":[{"path":"SYSTEM","truncated":true},{"path":"SAM","truncated":false},{"path":"SOFTWARE","truncated":true}]}`
+	registryManifest += strings.Repeat(" ", 400-len(registryManifest))
+	dir := newTestCollection(t, map[string]string{
+		"windows_evtx/Security.evtx":     strings.Repeat("e", 6000),
+		"windows_evtx/System.evtx":       strings.Repeat("e", 2000),
+		"windows_registry/manifest.json": registryManifest,
+		"windows_registry/SYSTEM":        strings.Repeat("r", 1000),
+		"notes/operator.txt":             strings.Repeat("n", 100),
+		"tool_info.json":                 strings.Repeat("t", 500),
+	})
+	manifest, err := ReadCollectionManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []Result{
+		{Module: "windows/registry", OK: true, StartedAt: testTimestamp, EndedAt: testTimestamp.Add(250 * time.Millisecond)},
+		{Module: "windows/evtx", OK: true, StartedAt: testTimestamp, EndedAt: testTimestamp.Add(1500 * time.Millisecond)},
+		{Module: "windows/prefetch", Skipped: "requires_live_system"},
+	}
+
+	stats := ComputeRunStats(dir, manifest, results, 4000, 2*time.Minute+1234*time.Microsecond)
+	want := &RunStats{
+		FileCount:        6,
+		RawBytes:         10000,
+		ArchiveBytes:     4000,
+		CompressionRatio: 2.5,
+		TruncatedFiles:   2,
+		RunFileBytes:     500,
+		WallClock:        "2m0.001s",
+		Modules: []ModuleStats{
+			{Module: "windows/evtx", Files: 2, Bytes: 8000, Share: 0.8, Duration: "1.5s"},
+			{Module: "windows/registry", Files: 2, Bytes: 1400, Share: 0.14, TruncatedFiles: 2, Duration: "250ms"},
+			// A directory no module result names is still attributed
+			{Module: "notes", Files: 1, Bytes: 100, Share: 0.01, Duration: "0s"},
+			{Module: "windows/prefetch", Duration: "0s"},
+		},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("stats =\n%+v\nwant\n%+v", stats, want)
+	}
+
+	// Ratios are rounded, and left at zero without an archive
+	if stats := ComputeRunStats(dir, manifest, results, 3000, 0); stats.CompressionRatio != 3.33 {
+		t.Errorf("ratio over 3000 bytes = %v", stats.CompressionRatio)
+	}
+	if stats := ComputeRunStats(dir, manifest, results, 0, 0); stats.CompressionRatio != 0 {
+		t.Errorf("ratio without an archive = %v", stats.CompressionRatio)
+	}
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// SPKIPins holds the base64 SHA-256 digests of the SubjectPublicKeyInfo a
+// delivery endpoint may present. More than one pin allows a key rotation.
+type SPKIPins map[string]bool
+
+// ParseSPKIPins validates --pin-sha256 values: standard base64, optionally
+// prefixed "sha256/" as in HPKP, decoding to 32 bytes.
+func ParseSPKIPins(values []string) (SPKIPins, error) {
+	pins := make(SPKIPins, len(values))
+	for _, value := range values {
+		pin := strings.TrimPrefix(strings.TrimSpace(value), "sha256/")
+		digest, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil {
+			return nil, fmt.Errorf("pin %q is not base64: %w", value, err)
+		}
+		if len(digest) != sha256.Size {
+			return nil, fmt.Errorf("pin %q is %d bytes, want a %d-byte SHA-256 digest", value, len(digest), sha256.Size)
+		}
+		pins[pin] = true
+	}
+	return pins, nil
+}
+
+// SPKIPin returns the pin of a certificate's public key.
+func SPKIPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// Match reports whether cert carries a pinned public key.
+func (p SPKIPins) Match(cert *x509.Certificate) bool {
+	return p[SPKIPin(cert)]
+}
+
+// TLSConfig returns a client configuration that completes a handshake only
+// when the leaf, an intermediate, or the root of the server's chain carries a
+// pinned key. The usual chain verification still runs first, so a pin narrows
+// the trust store rather than replacing it; a tampered store alone cannot
+// admit an interception proxy.
+func (p SPKIPins) TLSConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			for _, cert := range cs.PeerCertificates {
+				if p.Match(cert) {
+					return nil
+				}
+			}
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					if p.Match(cert) {
+						return nil
+					}
+				}
+			}
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("server presented no certificate")
+			}
+			return fmt.Errorf("no certificate in the chain of %s matches --pin-sha256 (leaf key %s)", cs.ServerName, SPKIPin(cs.PeerCertificates[0]))
+		},
+	}
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// otherPin is a well-formed pin of a key no test server holds.
+var otherPin = base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+// pinnedClient returns a client using the pinned configuration that trusts
+// root, as the system store would trust a public CA.
+func pinnedClient(pins SPKIPins, root *x509.Certificate) *http.Client {
+	config := pins.TLSConfig("")
+	if root != nil {
+		config.RootCAs = x509.NewCertPool()
+		config.RootCAs.AddCert(root)
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+}
+
+func TestParseSPKIPins(t *testing.T) {
+	pins, err := ParseSPKIPins([]string{"sha256/" + otherPin, " " + otherPin + " "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || !pins[otherPin] {
+		t.Fatalf("pins = %v", pins)
+	}
+
+	for _, tt := range []struct{ value, want string }{
+		{"not*base64", "is not base64"},
+		{base64.StdEncoding.EncodeToString(make([]byte, 20)), "is 20 bytes"},
+	} {
+		if _, err := ParseSPKIPins([]string{otherPin, tt.value}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseSPKIPins(%q) = %v, want %q", tt.value, err, tt.want)
+		}
+	}
+}
+
+func TestSPKIPinsTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(server.Close)
+	cert := server.Certificate()
+	pin := SPKIPin(cert)
+
+	get := func(client *http.Client) error {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	// The old and new keys are both pinned during a rotation
+	if err := get(pinnedClient(SPKIPins{otherPin: true, pin: true}, cert)); err != nil {
+		t.Fatalf("pinned server refused: %v", err)
+	}
+
+	err := get(pinnedClient(SPKIPins{otherPin: true}, cert))
+	if err == nil || !strings.Contains(err.Error(), "matches --pin-sha256 (leaf key "+pin+")") {
+		t.Fatalf("unpinned server = %v", err)
+	}
+
+	// A pin does not stand in for chain verification
+	var unknownAuthority x509.UnknownAuthorityError
+	if err := get(pinnedClient(SPKIPins{pin: true}, nil)); !errors.As(err, &unknownAuthority) {
+		t.Fatalf("untrusted pinned server = %v", err)
+	}
+}
+
+func TestS3UploaderEnforcesPins(t *testing.T) {
+	fake := &fakeS3{t: t, objects: make(map[string][]byte), parts: make(map[string]map[int][]byte)}
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+	path, data := writeUploadFile(t, "WS-0142.sig", 300)
+
+	upload := func(ctx context.Context, pins SPKIPins) error {
+		creds := docCreds
+		creds.Endpoint = server.URL
+		uploader, err := NewS3Uploader(&S3Target{Bucket: "evidence"}, creds, pins)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := uploader.client.Transport.(*http.Transport).TLSClientConfig
+		config.RootCAs = x509.NewCertPool()
+		config.RootCAs.AddCert(server.Certificate())
+		_, err = uploader.UploadFiles(ctx, []string{path})
+		return err
+	}
+
+	// A refused handshake is retried like any network failure, so the
+	// deadline cuts the attempts short
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := upload(ctx, SPKIPins{otherPin: true}); err == nil || len(fake.objects) != 0 {
+		t.Fatalf("upload to an unpinned endpoint = %v, stored %d objects", err, len(fake.objects))
+	}
+	if err := upload(context.Background(), SPKIPins{SPKIPin(server.Certificate()): true}); err != nil {
+		t.Fatal(err)
+	}
+	if string(fake.objects["WS-0142.sig"]) != string(data) {
+		t.Fatalf("objects = %v", fake.objects)
+	}
+
+	// Pins cannot be checked over plain HTTP
+	creds := docCreds
+	creds.Endpoint = "http://minio.internal:9000"
+	if _, err := NewS3Uploader(&S3Target{Bucket: "evidence"}, creds, SPKIPins{otherPin: true}); err == nil {
+		t.Error("pinned HTTP endpoint accepted")
+	}
+}
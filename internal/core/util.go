@@ -2,11 +2,30 @@
 package core
 
 import (
+	"crypto/rand"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
+// TempDirPrefix is the prefix of every temporary artifacts directory created by cryptkeeper.
+const TempDirPrefix = "cryptkeeper-"
+
+// DefaultStaleTempAge is how old an abandoned temporary directory must be before it is pruned.
+const DefaultStaleTempAge = 24 * time.Hour
+
+// tempDirPattern matches directories created by CreateTempDir
+// (cryptkeeper-<pid>-<run uuid>-<random>), capturing the PID, and by older
+// releases (cryptkeeper_<random>).
+var tempDirPattern = regexp.MustCompile(`^(?:cryptkeeper-(\d+)-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}-\d+|cryptkeeper_\d+)$`)
+
 // SanitizeName cleans a module name for safe use as a directory name.
 // It removes or replaces characters that could be problematic in file paths.
 func SanitizeName(name string) string {
@@ -30,9 +49,103 @@ func SanitizeName(name string) string {
 	return name
 }
 
-// CreateTempDir creates a temporary directory for artifacts with a cryptkeeper prefix.
-func CreateTempDir() (string, error) {
-	return os.MkdirTemp("", "cryptkeeper_*")
+// NewRunID returns a random RFC 4122 version 4 UUID identifying a single run.
+func NewRunID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate run ID: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// CreateTempDir creates a uniquely named temporary directory for artifacts.
+// The name records the process ID and run ID so concurrent invocations on the
+// same host never collide and abandoned directories can be attributed.
+func CreateTempDir(runID string) (string, error) {
+	pattern := fmt.Sprintf("%s%d-%s-*", TempDirPrefix, os.Getpid(), runID)
+	return os.MkdirTemp("", pattern)
+}
+
+// CheckOutputDir rejects an archive output directory at or inside the
+// artifacts directory, where the archive would be bundled into itself.
+func CheckOutputDir(artifactsDir, outDir string) error {
+	if winutil.PathWithin(outDir, artifactsDir) {
+		return fmt.Errorf("output directory %s is inside the artifacts directory %s; the archive would include itself", outDir, artifactsDir)
+	}
+	return nil
+}
+
+// CleanStaleTempDirs removes cryptkeeper temporary directories left behind by
+// crashed runs: those in which nothing was modified for maxAge and whose
+// creating process, when the name records it, is no longer running. Only
+// directories whose names match the cryptkeeper pattern are considered;
+// anything else in the temp dir is untouched. Returns the paths that were
+// removed.
+func CleanStaleTempDirs(maxAge time.Duration) ([]string, error) {
+	return cleanStaleTempDirsIn(os.TempDir(), maxAge, time.Now())
+}
+
+// cleanStaleTempDirsIn implements CleanStaleTempDirs for a specific parent directory.
+func cleanStaleTempDirsIn(parent string, maxAge time.Duration, now time.Time) ([]string, error) {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read temp directory %s: %w", parent, err)
+	}
+
+	removed := make([]string, 0)
+	var firstErr error
+	for _, entry := range entries {
+		match := tempDirPattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		path := filepath.Join(parent, entry.Name())
+
+		// Lstat so a symlink or junction named like a temp dir is never followed
+		info, err := os.Lstat(path)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		// A long run only touches files deep in its tree, so the directory's
+		// own time says nothing about whether it is still in use
+		if now.Sub(newestModTime(path, info.ModTime())) < maxAge {
+			continue
+		}
+		if match[1] != "" {
+			if pid, err := strconv.Atoi(match[1]); err == nil && processRunning(pid) {
+				continue
+			}
+		}
+
+		if err := os.RemoveAll(path); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to remove stale temp directory %s: %w", path, err)
+			}
+			continue
+		}
+		removed = append(removed, path)
+	}
+
+	return removed, firstErr
+}
+
+// newestModTime returns the latest modification time in the tree at root,
+// starting from rootTime. Symlinks are not followed.
+func newestModTime(root string, rootTime time.Time) time.Time {
+	newest := rootTime
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest
 }
 
 // RemoveTempDir safely removes a temporary directory and its contents.
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRunID = "0a1b2c3d-4e5f-4a6b-8c7d-8e9fa0b1c2d3"
+
+func TestCreateTempDirIsUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		dir, err := CreateTempDir(testRunID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		if seen[dir] {
+			t.Fatalf("CreateTempDir returned %s twice", dir)
+		}
+		seen[dir] = true
+
+		name := filepath.Base(dir)
+		if !strings.HasPrefix(name, fmt.Sprintf("%s%d-%s-", TempDirPrefix, os.Getpid(), testRunID)) {
+			t.Fatalf("name %s does not record the PID and run ID", name)
+		}
+		if !tempDirPattern.MatchString(name) {
+			t.Fatalf("name %s is not recognized as a cryptkeeper temp dir", name)
+		}
+	}
+}
+
+// exitedPID returns the PID of a process that has exited.
+func exitedPID(t *testing.T) int {
+	t.Helper()
+	name, args := "true", []string{}
+	if runtime.GOOS == "windows" {
+		name, args = "cmd", []string{"/c", "exit"}
+	}
+	cmd := exec.Command(name, args...)
+	if err := cmd.Run(); err != nil {
+		t.Skipf("cannot start a short-lived process: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+// makeTempTree creates parent/name with a file inside, every time set to modTime.
+func makeTempTree(t *testing.T, parent, name string, modTime time.Time) string {
+	t.Helper()
+	dir := filepath.Join(parent, name)
+	file := filepath.Join(dir, "module", "file.bin")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{file, filepath.Dir(file), dir} {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCleanStaleTempDirsPrunesByAge(t *testing.T) {
+	parent := t.TempDir()
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	dead := exitedPID(t)
+
+	stale := makeTempTree(t, parent, fmt.Sprintf("cryptkeeper-%d-%s-123", dead, testRunID), old)
+	legacy := makeTempTree(t, parent, "cryptkeeper_456", old)
+	recent := makeTempTree(t, parent, fmt.Sprintf("cryptkeeper-%d-%s-789", dead, testRunID), now.Add(-time.Hour))
+	unrelated := makeTempTree(t, parent, "cryptkeeper-notes", old)
+	other := makeTempTree(t, parent, "someone-else", old)
+
+	// A run still writing deep in its tree is not stale, whatever the root says
+	active := makeTempTree(t, parent, fmt.Sprintf("cryptkeeper-%d-%s-321", dead, testRunID), old)
+	if err := os.Chtimes(filepath.Join(active, "module", "file.bin"), now, now); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := cleanStaleTempDirsIn(parent, DefaultStaleTempAge, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("removed %v, want %s and %s", removed, stale, legacy)
+	}
+	for _, dir := range []string{stale, legacy} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("stale %s kept", dir)
+		}
+	}
+	for _, dir := range []string{recent, unrelated, other, active} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("%s removed: %v", dir, err)
+		}
+	}
+}
+
+func TestCleanStaleTempDirsSkipsRunningProcess(t *testing.T) {
+	parent := t.TempDir()
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+
+	// An idle run of this very process, e.g. waiting on a slow upload
+	running := makeTempTree(t, parent, fmt.Sprintf("cryptkeeper-%d-%s-123", os.Getpid(), testRunID), old)
+
+	removed, err := cleanStaleTempDirsIn(parent, DefaultStaleTempAge, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("removed %v of a running process", removed)
+	}
+	if _, err := os.Stat(running); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCleanStaleTempDirsDoesNotFollowSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need a privilege on Windows")
+	}
+	parent := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	target := makeTempTree(t, t.TempDir(), "evidence", old)
+	link := filepath.Join(parent, "cryptkeeper_999")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cleanStaleTempDirsIn(parent, DefaultStaleTempAge, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "module", "file.bin")); err != nil {
+		t.Fatalf("symlink target was pruned: %v", err)
+	}
+}
+
+func TestProcessRunning(t *testing.T) {
+	if !processRunning(os.Getpid()) {
+		t.Fatal("own process reported as not running")
+	}
+	if processRunning(exitedPID(t)) {
+		t.Fatal("exited process reported as running")
+	}
+	if processRunning(0) || processRunning(-1) {
+		t.Fatal("invalid PID reported as running")
+	}
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+
+	"filippo.io/age"
+)
+
+// ArchiveVerificationReport lists the differences between an archive's
+// contents and the manifests packed in it, and the result of checking its
+// detached signature.
+type ArchiveVerificationReport struct {
+	Archive   string `json:"archive"`
+	Encrypted bool   `json:"encrypted"`
+	VerificationReport
+	ModuleManifests   []ModuleManifestCheck `json:"module_manifests"`
+	UnmanifestedFiles []string              `json:"unmanifested_files"` // Under a module directory that has no manifest
+	Signature         *SignatureCheck       `json:"signature,omitempty"`
+}
+
+// OK reports whether the archive matched its root manifest and every module
+// manifest, and the signature, when there is one, verified. Files a module
+// manifest does not list are reported but not a failure, as modules write
+// reports and coverage files next to the items they list.
+func (r *ArchiveVerificationReport) OK() bool {
+	if !r.VerificationReport.OK() {
+		return false
+	}
+	for _, check := range r.ModuleManifests {
+		if check.Error != "" || len(check.Missing) > 0 || len(check.Stale) > 0 {
+			return false
+		}
+	}
+	return r.Signature == nil || r.Signature.OK()
+}
+
+// VerifyArchive streams an archive once, decrypting it with identities when it
+// is age-encrypted, and hashes every entry. The hashes are compared with the
+// archive's root manifest and each module manifest in it, and the manifest
+// seal is checked when key is non-empty. A detached signature next to the
+// archive is verified, against trustedKey when that is given.
+func VerifyArchive(ctx context.Context, archivePath string, identities []age.Identity, key []byte, trustedKey string) (*ArchiveVerificationReport, error) {
+	entries := make([]ManifestEntry, 0)
+	links := make(map[string]string)
+	manifests := make(map[string][]byte)
+
+	encrypted, err := walkArchive(ctx, archivePath, identities, func(relPath string, header *tar.Header, body io.Reader) error {
+		if header.Typeflag == tar.TypeLink {
+			target, err := archiveRelPath(header.Linkname)
+			if err != nil {
+				return err
+			}
+			links[relPath] = target
+			return nil
+		}
+
+		// Manifests are kept to compare against once every hash is known
+		hasher := sha256.New()
+		var reader io.Reader = body
+		var kept *bytes.Buffer
+		if relPath == CollectionManifestName || relPath == CollectionManifestMsgpackName || path.Base(relPath) == moduleManifestName {
+			kept = &bytes.Buffer{}
+			reader = io.TeeReader(body, kept)
+		}
+		size, err := io.Copy(hasher, reader)
+		if err != nil {
+			return fmt.Errorf("failed to read %s from archive: %w", relPath, err)
+		}
+		if kept != nil {
+			manifests[relPath] = kept.Bytes()
+		}
+		entries = append(entries, ManifestEntry{Path: relPath, Size: size, SHA256: hex.EncodeToString(hasher.Sum(nil))})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A deduplicated file has the content of the copy it links to
+	byPath := make(map[string]ManifestEntry, len(entries)+len(links))
+	for _, entry := range entries {
+		byPath[entry.Path] = entry
+	}
+	for relPath, target := range links {
+		if entry, ok := byPath[target]; ok {
+			entry.Path = relPath
+			entries = append(entries, entry)
+			byPath[relPath] = entry
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	data, ok := manifests[CollectionManifestName]
+	if !ok {
+		data, ok = manifests[CollectionManifestMsgpackName]
+	}
+	if !ok {
+		return nil, fmt.Errorf("archive %s has no collection manifest", archivePath)
+	}
+	manifest, err := DecodeCollectionManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse collection manifest: %w", err)
+	}
+
+	actual := make([]ManifestEntry, 0, len(entries))
+	for _, entry := range entries {
+		if isCollectionManifestFile(entry.Path) {
+			continue
+		}
+		if manifest.Hashing == HashingDisabled {
+			entry.SHA256 = ""
+		}
+		actual = append(actual, entry)
+	}
+
+	report := &ArchiveVerificationReport{
+		Archive:            archivePath,
+		Encrypted:          encrypted,
+		VerificationReport: *compareWithManifest(manifest, actual, key),
+	}
+	readManifest := func(relPath string) ([]byte, error) {
+		if data, ok := manifests[relPath]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("%s is not in the archive", relPath)
+	}
+	report.ModuleManifests, report.UnmanifestedFiles, _ = checkModuleManifests(readManifest, actual, byPath)
+
+	report.Signature, err = VerifyArchiveSignature(archivePath, trustedKey)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// MinSplitSize is the smallest --split-size accepted, keeping a large
+// collection from turning into millions of volume files.
+const MinSplitSize = 1 << 20
+
+// ArchiveVolume is one file of an archive split with --split-size.
+type ArchiveVolume struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// volumeWriter writes a byte stream across numbered files base.001,
+// base.002, and so on, each at most maxSize bytes, so the volumes
+// concatenated in order are the stream. A volume is only started once there
+// is data for it, so no trailing volume is ever empty.
+type volumeWriter struct {
+	base    string
+	maxSize int64
+	file    *os.File
+	hasher  hash.Hash
+	written int64 // Bytes in the current volume
+	volumes []ArchiveVolume
+	infos   []os.FileInfo
+}
+
+// newVolumeWriter creates the first volume of base.
+func newVolumeWriter(base string, maxSize int64) (*volumeWriter, error) {
+	vw := &volumeWriter{base: base, maxSize: maxSize}
+	if err := vw.next(); err != nil {
+		return nil, err
+	}
+	return vw, nil
+}
+
+// VolumePath returns the path of the index'th volume of base, counting from 1.
+func VolumePath(base string, index int) string {
+	return fmt.Sprintf("%s.%03d", base, index)
+}
+
+// next finishes the current volume, if any, and creates the next one.
+func (vw *volumeWriter) next() error {
+	if err := vw.finish(); err != nil {
+		return err
+	}
+	path := VolumePath(vw.base, len(vw.volumes)+1)
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create archive volume %s: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat archive volume %s: %w", path, err)
+	}
+	vw.file = file
+	vw.hasher = sha256.New()
+	vw.written = 0
+	vw.infos = append(vw.infos, info)
+	return nil
+}
+
+// finish closes the current volume and records its size and hash.
+func (vw *volumeWriter) finish() error {
+	if vw.file == nil {
+		return nil
+	}
+	path := vw.file.Name()
+	err := vw.file.Close()
+	vw.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to close archive volume %s: %w", path, err)
+	}
+	vw.volumes = append(vw.volumes, ArchiveVolume{
+		Path:   path,
+		Size:   vw.written,
+		SHA256: hex.EncodeToString(vw.hasher.Sum(nil)),
+	})
+	return nil
+}
+
+// Write fills the current volume up to maxSize and continues in the next.
+func (vw *volumeWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if vw.written == vw.maxSize {
+			if err := vw.next(); err != nil {
+				return total, err
+			}
+		}
+		chunk := p
+		if room := vw.maxSize - vw.written; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		n, err := vw.file.Write(chunk)
+		vw.hasher.Write(chunk[:n])
+		vw.written += int64(n)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close finishes the last volume and returns every volume written.
+func (vw *volumeWriter) Close() ([]ArchiveVolume, error) {
+	if err := vw.finish(); err != nil {
+		return nil, err
+	}
+	return vw.volumes, nil
+}
+
+// isVolume reports whether info is one of the volumes being written.
+func (vw *volumeWriter) isVolume(info os.FileInfo) bool {
+	for _, volume := range vw.infos {
+		if os.SameFile(info, volume) {
+			return true
+		}
+	}
+	return false
+}
+
+// volumeReader reads the volumes of a split archive in order as one stream.
+type volumeReader struct {
+	io.Reader
+	files []*os.File
+}
+
+// Close closes every volume.
+func (vr *volumeReader) Close() error {
+	var first error
+	for _, file := range vr.files {
+		if err := file.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// openArchiveFile opens an archive for reading. The first volume of a split
+// archive (name.001), or the archive name itself when only its volumes
+// exist, opens every consecutive volume as one stream.
+func openArchiveFile(archivePath string) (io.ReadCloser, error) {
+	base := strings.TrimSuffix(archivePath, ".001")
+	if base == archivePath {
+		if _, err := os.Stat(archivePath); err == nil || !os.IsNotExist(err) {
+			return os.Open(archivePath)
+		}
+		if _, err := os.Stat(VolumePath(base, 1)); err != nil {
+			return os.Open(archivePath)
+		}
+	}
+
+	vr := &volumeReader{}
+	for index := 1; ; index++ {
+		file, err := os.Open(VolumePath(base, index))
+		if os.IsNotExist(err) && index > 1 {
+			break
+		}
+		if err != nil {
+			vr.Close()
+			return nil, err
+		}
+		vr.files = append(vr.files, file)
+	}
+	readers := make([]io.Reader, len(vr.files))
+	for i, file := range vr.files {
+		readers[i] = file
+	}
+	vr.Reader = io.MultiReader(readers...)
+	return vr, nil
+}
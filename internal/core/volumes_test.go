@@ -0,0 +1,191 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// splitTestFiles is a collection whose archive does not compress below a
+// few volumes of 4 KB.
+func splitTestFiles() map[string]string {
+	image := make([]byte, 20000)
+	mathrand.New(mathrand.NewSource(1009)).Read(image)
+	files := map[string]string{"windows_memory/pagefile.sys": string(image)}
+	for name, content := range defaultTestFiles {
+		files[name] = content
+	}
+	return files
+}
+
+// joinVolumes concatenates the volumes in order, checking each against the
+// size and hash the metadata lists for it.
+func joinVolumes(t *testing.T, volumes []ArchiveVolume, maxSize int64) []byte {
+	t.Helper()
+	var joined bytes.Buffer
+	for i, volume := range volumes {
+		data, err := os.ReadFile(volume.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != volume.Size || hex.EncodeToString(sum[:]) != volume.SHA256 {
+			t.Fatalf("volume %s is %d bytes with hash %x, metadata lists %+v", volume.Path, len(data), sum, volume)
+		}
+		// Every volume but the last is full, and none is empty
+		if volume.Size == 0 || volume.Size > maxSize || (i < len(volumes)-1 && volume.Size != maxSize) {
+			t.Fatalf("volume %d of %d is %d bytes", i+1, len(volumes), volume.Size)
+		}
+		joined.Write(data)
+	}
+	return joined.Bytes()
+}
+
+func TestSplitArchiveConcatenatesToTheUnsplitArchive(t *testing.T) {
+	artifactsDir := newTestCollection(t, splitTestFiles())
+	compression := ArchiveCompression{Codec: CompressionGzip}
+
+	whole, err := BundleAndMaybeEncrypt(context.Background(), artifactsDir, t.TempDir(), "host", testTimestamp, ArchiveEncryption{}, compression, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsplit, err := os.ReadFile(whole.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const splitSize = 4096
+	outDir := t.TempDir()
+	meta, err := BundleAndMaybeEncrypt(context.Background(), artifactsDir, outDir, "host", testTimestamp, ArchiveEncryption{}, compression, splitSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Volumes) < 5 {
+		t.Fatalf("split into %d volumes", len(meta.Volumes))
+	}
+	for i, volume := range meta.Volumes {
+		if volume.Path != VolumePath(meta.Path, i+1) {
+			t.Fatalf("volume %d is %s", i+1, volume.Path)
+		}
+	}
+	if _, err := os.Stat(meta.Path); !os.IsNotExist(err) {
+		t.Fatalf("unsplit archive written next to its volumes: %v", err)
+	}
+
+	joined := joinVolumes(t, meta.Volumes, splitSize)
+	if !bytes.Equal(joined, unsplit) {
+		t.Fatalf("volumes join to %d bytes that differ from the %d byte unsplit archive", len(joined), len(unsplit))
+	}
+	if meta.SHA256 != whole.SHA256 || meta.BytesWritten != whole.BytesWritten || meta.FileCount != whole.FileCount {
+		t.Fatalf("split metadata = %+v, unsplit %+v", meta, whole)
+	}
+
+	// The archive path, its first volume, and the joined file all read as
+	// the one archive
+	joinedPath := filepath.Join(t.TempDir(), "joined.tar.gz")
+	if err := os.WriteFile(joinedPath, joined, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, archive := range []string{meta.Path, meta.Volumes[0].Path, joinedPath} {
+		report, err := VerifyArchive(context.Background(), archive, nil, nil, "")
+		if err != nil {
+			t.Fatalf("%s: %v", archive, err)
+		}
+		if !report.OK() || report.Checked != len(splitTestFiles()) {
+			t.Fatalf("%s did not verify: %+v", archive, report)
+		}
+		extracted, err := ExtractArchive(context.Background(), archive, t.TempDir(), nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", archive, err)
+		}
+		if !extracted.OK() || extracted.Verified != len(splitTestFiles()) {
+			t.Fatalf("%s did not extract: %+v", archive, extracted)
+		}
+	}
+
+	// A missing volume cuts the stream short
+	if err := os.Remove(meta.Volumes[2].Path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyArchive(context.Background(), meta.Path, nil, nil, ""); err == nil {
+		t.Fatal("archive with a missing volume verified")
+	}
+}
+
+func TestSplitEncryptedArchiveVerifiesAndExtracts(t *testing.T) {
+	artifactsDir := newTestCollection(t, splitTestFiles())
+	identity := newTestIdentity(t)
+	encryption := ArchiveEncryption{Recipients: []string{identity.Recipient().String()}}
+
+	const splitSize = 5000
+	meta, err := BundleAndMaybeEncrypt(context.Background(), artifactsDir, t.TempDir(), "host", testTimestamp, encryption, ArchiveCompression{Codec: CompressionZstd}, splitSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := joinVolumes(t, meta.Volumes, splitSize)
+	sum := sha256.Sum256(joined)
+	if !meta.Encrypted || meta.SHA256 != hex.EncodeToString(sum[:]) || meta.BytesWritten != int64(len(joined)) {
+		t.Fatalf("metadata = %+v for %d joined bytes", meta, len(joined))
+	}
+
+	identities := []age.Identity{identity}
+	report, err := VerifyArchive(context.Background(), meta.Volumes[0].Path, identities, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Encrypted || !report.OK() {
+		t.Fatalf("split archive did not verify: %+v", report)
+	}
+	outDir := t.TempDir()
+	extracted, err := ExtractArchive(context.Background(), meta.Path, outDir, []string{"windows_memory"}, identities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !extracted.OK() || extracted.Extracted != 1 {
+		t.Fatalf("extract = %+v", extracted)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "windows_memory", "pagefile.sys"))
+	if err != nil || string(data) != splitTestFiles()["windows_memory/pagefile.sys"] {
+		t.Fatalf("extracted pagefile.sys is %d bytes: %v", len(data), err)
+	}
+}
+
+func TestVolumeWriterStartsVolumesOnlyForData(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "archive.tar.gz")
+	vw, err := newVolumeWriter(base, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writes that straddle and exactly fill volumes
+	for _, chunk := range []string{"0123456", "789abcdefghij", "klmnopqrst"} {
+		if n, err := vw.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	volumes, err := vw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, volume := range volumes {
+		data, err := os.ReadFile(volume.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(data))
+	}
+	if !reflect.DeepEqual(got, []string{"0123456789", "abcdefghij", "klmnopqrst"}) {
+		t.Fatalf("volumes = %q", got)
+	}
+	if _, err := os.Stat(VolumePath(base, 4)); !os.IsNotExist(err) {
+		t.Fatalf("empty fourth volume: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+// Package coverage records the locations collection modules probed and what
+// they found there, so a module that collected nothing can be told apart from
+// one that never looked.
+package coverage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Probe outcomes.
+const (
+	Found  = "found"  // The file exists and is not empty, or the directory has entries
+	Empty  = "empty"  // The file is zero bytes, or the directory has no entries
+	Absent = "absent" // Nothing exists at the path
+	Denied = "denied" // The path exists but could not be read
+	Failed = "error"  // Any other failure
+)
+
+// Probe is one location a module examined.
+type Probe struct {
+	Target  string `json:"target"` // What the module looked for, e.g. "Firefox profiles"
+	Path    string `json:"path"`
+	Outcome string `json:"outcome"`
+	Entries int    `json:"entries,omitempty"` // Directory entries, for a found directory
+	Error   string `json:"error,omitempty"`
+}
+
+// Recorder attributes probes to modules by the first path component of the
+// output directory given with them, relative to the artifacts root, the way
+// progress.Tracker attributes copies. Each run has its own, which modules
+// reach through their Collect context; a nil Recorder records nothing.
+type Recorder struct {
+	mu      sync.Mutex
+	root    string
+	enabled bool
+	probes  map[string][]Probe
+}
+
+// NewRecorder creates a disabled recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{probes: make(map[string][]Probe)}
+}
+
+// Start sets the artifacts directory, clears earlier probes, and enables or
+// disables recording. Probing costs nothing while recording is disabled.
+func (r *Recorder) Start(root string, enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.root = root
+	r.enabled = enabled
+	r.probes = make(map[string][]Probe)
+}
+
+// Enabled reports whether probes are being recorded.
+func (r *Recorder) Enabled() bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enabled
+}
+
+// Record adds a probe for the module owning outDir, which is the module's
+// output directory or any directory beneath it.
+func (r *Recorder) Record(outDir string, probe Probe) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.enabled {
+		return
+	}
+	if dir := r.moduleDir(outDir); dir != "" {
+		r.probes[dir] = append(r.probes[dir], probe)
+	}
+}
+
+// Check examines path, records the outcome for the module owning outDir,
+// and returns it. It returns "" without touching path while recording is
+// disabled.
+func (r *Recorder) Check(outDir, target, path string) string {
+	if !r.Enabled() {
+		return ""
+	}
+	probe := Examine(target, path)
+	r.Record(outDir, probe)
+	return probe.Outcome
+}
+
+// Probes returns the probes recorded for a top-level module directory, e.g.
+// "windows_browser", in the order they were made.
+func (r *Recorder) Probes(moduleDir string) []Probe {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Probe(nil), r.probes[moduleDir]...)
+}
+
+// moduleDir returns the top-level directory of outDir under the root.
+func (r *Recorder) moduleDir(outDir string) string {
+	if r.root == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(r.root, outDir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+}
+
+// Examine classifies what exists at path.
+func Examine(target, path string) Probe {
+	probe := Probe{Target: target, Path: path}
+	stat, err := os.Stat(path)
+	if err != nil {
+		probe.Outcome, probe.Error = classify(err)
+		return probe
+	}
+	if !stat.IsDir() {
+		probe.Outcome = Found
+		if stat.Size() == 0 {
+			probe.Outcome = Empty
+		}
+		return probe
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		probe.Outcome, probe.Error = classify(err)
+		return probe
+	}
+	probe.Entries = len(entries)
+	probe.Outcome = Found
+	if len(entries) == 0 {
+		probe.Outcome = Empty
+	}
+	return probe
+}
+
+// classify maps a stat or read error to an outcome.
+func classify(err error) (string, string) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return Absent, ""
+	case errors.Is(err, fs.ErrPermission):
+		return Denied, err.Error()
+	}
+	return Failed, err.Error()
+}
@@ -0,0 +1,117 @@
+package coverage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeProbeTree writes a profile with a non-empty and an empty file, and
+// an empty and a non-empty directory.
+func writeProbeTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, sub := range []string{"Profiles/abcd1234.default-release", "Cache"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(sub)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "places.sqlite"), []byte("SQLite format 3\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cookies.sqlite"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestExamine(t *testing.T) {
+	dir := writeProbeTree(t)
+	for _, tt := range []struct {
+		path    string
+		outcome string
+		entries int
+	}{
+		{"places.sqlite", Found, 0},
+		{"cookies.sqlite", Empty, 0},
+		{"Profiles", Found, 1},
+		{"Cache", Empty, 0},
+		{"formhistory.sqlite", Absent, 0},
+		{"Edge/User Data", Absent, 0},
+	} {
+		probe := Examine("Firefox", filepath.Join(dir, filepath.FromSlash(tt.path)))
+		if probe.Outcome != tt.outcome || probe.Entries != tt.entries || probe.Error != "" || probe.Target != "Firefox" {
+			t.Errorf("Examine(%s) = %+v, want %s with %d entries", tt.path, probe, tt.outcome, tt.entries)
+		}
+	}
+
+	// A path below a file is neither absent nor denied
+	if probe := Examine("Firefox", filepath.Join(dir, "places.sqlite", "x")); probe.Outcome == Found || probe.Outcome == Empty {
+		t.Errorf("path below a file = %+v", probe)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("permissions do not apply to root")
+	}
+	locked := filepath.Join(dir, "Locked")
+	if err := os.Mkdir(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+	if probe := Examine("Firefox", locked); probe.Outcome != Denied || probe.Error == "" {
+		t.Errorf("unreadable directory = %+v", probe)
+	}
+}
+
+func TestRecorderAttributesProbesToModules(t *testing.T) {
+	dir := writeProbeTree(t)
+	root := t.TempDir()
+	recorder := NewRecorder()
+
+	// Nothing is examined or kept while recording is disabled
+	if outcome := recorder.Check(filepath.Join(root, "windows_browser"), "Firefox", dir); outcome != "" {
+		t.Fatalf("disabled recorder checked %s", outcome)
+	}
+	recorder.Start(root, true)
+	if probes := recorder.Probes("windows_browser"); len(probes) != 0 {
+		t.Fatalf("probes before any check = %v", probes)
+	}
+
+	// Probes from a subdirectory belong to the module directory above it
+	userDir := filepath.Join(root, "windows_browser", "alice", "firefox")
+	if outcome := recorder.Check(userDir, "Firefox places", filepath.Join(dir, "places.sqlite")); outcome != Found {
+		t.Fatalf("present file = %s", outcome)
+	}
+	if outcome := recorder.Check(userDir, "Firefox history", filepath.Join(dir, "formhistory.sqlite")); outcome != Absent {
+		t.Fatalf("missing file = %s", outcome)
+	}
+	recorder.Record(filepath.Join(root, "windows_prefetch"), Probe{Target: "Prefetch", Path: `C:\Windows\Prefetch`, Outcome: Denied, Error: "access denied"})
+	// Directories outside the artifacts root are not attributed
+	recorder.Record(t.TempDir(), Probe{Target: "stray", Outcome: Found})
+	recorder.Record(root, Probe{Target: "root", Outcome: Found})
+
+	want := []Probe{
+		{Target: "Firefox places", Path: filepath.Join(dir, "places.sqlite"), Outcome: Found},
+		{Target: "Firefox history", Path: filepath.Join(dir, "formhistory.sqlite"), Outcome: Absent},
+	}
+	if got := recorder.Probes("windows_browser"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("browser probes = %+v, want %+v", got, want)
+	}
+	if got := recorder.Probes("windows_prefetch"); len(got) != 1 || got[0].Outcome != Denied {
+		t.Fatalf("prefetch probes = %+v", got)
+	}
+
+	// A new run starts over
+	recorder.Start(root, false)
+	if got := recorder.Probes("windows_browser"); len(got) != 0 || recorder.Enabled() {
+		t.Fatalf("after restart: %v, enabled %v", got, recorder.Enabled())
+	}
+
+	// Outside a --coverage run modules hold no recorder
+	var none *Recorder
+	none.Record(userDir, Probe{Target: "stray", Outcome: Found})
+	if outcome := none.Check(userDir, "Firefox places", filepath.Join(dir, "places.sqlite")); outcome != "" || none.Enabled() || none.Probes("windows_browser") != nil {
+		t.Fatalf("nil recorder checked %q", outcome)
+	}
+}
@@ -0,0 +1,267 @@
+// Package ecs maps parsed execution, authentication, and network artifacts
+// of a collection onto Elastic Common Schema events, one JSON object per
+// line, for loading into a SIEM.
+package ecs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Version is the ECS release the field names follow.
+const Version = "8.11.0"
+
+// FileName is the export written to the artifacts directory.
+const FileName = "ecs_events.ndjson"
+
+// Modules lists the collection modules whose output the export reads.
+var Modules = []string{"windows/amcache", "windows/srum", "windows/activity", "windows/evtx"}
+
+// Event is one ECS document. Only fields the mapped artifacts fill are
+// declared; empty ones are left out.
+type Event struct {
+	Timestamp   string       `json:"@timestamp"`
+	ECS         ECSInfo      `json:"ecs"`
+	Event       EventFields  `json:"event"`
+	Host        Host         `json:"host"`
+	User        *User        `json:"user,omitempty"`
+	Process     *Process     `json:"process,omitempty"`
+	Source      *Endpoint    `json:"source,omitempty"`
+	Destination *Endpoint    `json:"destination,omitempty"`
+	Network     *Network     `json:"network,omitempty"`
+	Winlog      *Winlog      `json:"winlog,omitempty"`
+	Related     *Related     `json:"related,omitempty"`
+	Labels      *EventLabels `json:"labels,omitempty"`
+}
+
+// ECSInfo is the ecs field set.
+type ECSInfo struct {
+	Version string `json:"version"`
+}
+
+// EventFields is the event field set.
+type EventFields struct {
+	Kind     string   `json:"kind"`
+	Category []string `json:"category"`
+	Type     []string `json:"type"`
+	Action   string   `json:"action"`
+	Outcome  string   `json:"outcome,omitempty"`
+	Code     string   `json:"code,omitempty"` // Windows event ID
+	Provider string   `json:"provider,omitempty"`
+	Module   string   `json:"module"`
+	Dataset  string   `json:"dataset"` // cryptkeeper.<artifact>
+	Created  string   `json:"created"` // When the collection was made
+	Start    string   `json:"start,omitempty"`
+	End      string   `json:"end,omitempty"`
+	Duration int64    `json:"duration,omitempty"` // Nanoseconds
+}
+
+// Host is the host field set.
+type Host struct {
+	Name string `json:"name"`
+}
+
+// User is the user field set.
+type User struct {
+	ID     string `json:"id,omitempty"` // SID
+	Name   string `json:"name,omitempty"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// Process is the process field set.
+type Process struct {
+	Executable  string         `json:"executable,omitempty"`
+	Name        string         `json:"name,omitempty"`
+	PID         int64          `json:"pid,omitempty"`
+	CommandLine string         `json:"command_line,omitempty"`
+	Hash        *Hash          `json:"hash,omitempty"`
+	Parent      *ParentProcess `json:"parent,omitempty"`
+}
+
+// ParentProcess is the process.parent field set.
+type ParentProcess struct {
+	Executable string `json:"executable,omitempty"`
+	Name       string `json:"name,omitempty"`
+	PID        int64  `json:"pid,omitempty"`
+}
+
+// Hash is the hash field set.
+type Hash struct {
+	SHA1 string `json:"sha1,omitempty"`
+}
+
+// Endpoint is the source or destination field set.
+type Endpoint struct {
+	IP     string `json:"ip,omitempty"`
+	Port   int    `json:"port,omitempty"`
+	Domain string `json:"domain,omitempty"`
+	Bytes  uint64 `json:"bytes,omitempty"`
+}
+
+// Network is the network field set.
+type Network struct {
+	Bytes uint64 `json:"bytes"`
+}
+
+// Winlog is the winlog field set Winlogbeat writes for Windows events.
+type Winlog struct {
+	Channel  string       `json:"channel"`
+	EventID  string       `json:"event_id"`
+	RecordID uint64       `json:"record_id,omitempty"`
+	Logon    *WinlogLogon `json:"logon,omitempty"`
+}
+
+// WinlogLogon is the winlog.logon field set.
+type WinlogLogon struct {
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type,omitempty"` // Logon type name, e.g. RemoteInteractive
+}
+
+// Related is the related field set.
+type Related struct {
+	User []string `json:"user,omitempty"`
+	IP   []string `json:"ip,omitempty"`
+	Hash []string `json:"hash,omitempty"`
+}
+
+// EventLabels carries the collected file an event was mapped from.
+type EventLabels struct {
+	Source string `json:"cryptkeeper_source"` // Path relative to the artifacts directory
+}
+
+// Summary describes an export.
+type Summary struct {
+	File    string         `json:"file"`
+	Events  int            `json:"events"`
+	Sources map[string]int `json:"sources"` // Events per dataset
+	Errors  []string       `json:"errors,omitempty"`
+}
+
+// exporter writes events for one collection.
+type exporter struct {
+	artifactsDir string
+	host         string
+	created      string
+	out          *bufio.Writer
+	summary      *Summary
+}
+
+// Export maps the collection under artifactsDir into ecs_events.ndjson in
+// the same directory. host names the collected machine and created is when
+// the collection was made. Artifacts a module did not produce are
+// skipped; ones that fail to parse are reported in the summary.
+func Export(ctx context.Context, artifactsDir, host string, created time.Time) (*Summary, error) {
+	file, err := os.Create(filepath.Join(artifactsDir, FileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", FileName, err)
+	}
+	defer file.Close()
+
+	e := &exporter{
+		artifactsDir: artifactsDir,
+		host:         host,
+		created:      timestamp(created),
+		out:          bufio.NewWriter(file),
+		summary:      &Summary{File: FileName, Sources: make(map[string]int)},
+	}
+	sources := []struct {
+		name string
+		run  func() error
+	}{
+		{"srum app timeline", e.srumAppTimeline},
+		{"srum network usage", e.srumNetworkUsage},
+		{"bam", e.bam},
+		{"amcache", e.amcacheFiles},
+		{"event logs", e.eventLogs},
+	}
+	for _, source := range sources {
+		if err := ctx.Err(); err != nil {
+			return e.summary, err
+		}
+		if err := source.run(); err != nil {
+			e.summary.Errors = append(e.summary.Errors, fmt.Sprintf("%s: %v", source.name, err))
+		}
+	}
+
+	if err := e.out.Flush(); err != nil {
+		return e.summary, fmt.Errorf("failed to write %s: %w", FileName, err)
+	}
+	if err := file.Close(); err != nil {
+		return e.summary, fmt.Errorf("failed to write %s: %w", FileName, err)
+	}
+	return e.summary, nil
+}
+
+// emit fills the fields every event shares and writes it. Events without a
+// time are dropped, as @timestamp is required.
+func (e *exporter) emit(event Event, dataset, source string) error {
+	if event.Timestamp == "" {
+		return nil
+	}
+	event.ECS.Version = Version
+	event.Event.Kind = "event"
+	event.Event.Module = "cryptkeeper"
+	event.Event.Dataset = "cryptkeeper." + dataset
+	event.Event.Created = e.created
+	event.Host.Name = e.host
+	event.Labels = &EventLabels{Source: filepath.ToSlash(source)}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	e.out.Write(data)
+	if err := e.out.WriteByte('\n'); err != nil {
+		return err
+	}
+	e.summary.Events++
+	e.summary.Sources[event.Event.Dataset]++
+	return nil
+}
+
+// readJSON decodes a module output file, returning false when the module
+// did not write it.
+func (e *exporter) readJSON(rel string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(e.artifactsDir, rel))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", rel, err)
+	}
+	return true, nil
+}
+
+// lines calls fn for each line of an NDJSON file.
+func lines(r io.Reader, fn func([]byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// timestamp renders t as ECS expects it, regardless of --time-format.
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
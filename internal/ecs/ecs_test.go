@@ -0,0 +1,324 @@
+package ecs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/modules/win_activity"
+	"cryptkeeper/internal/modules/win_evtx"
+	"cryptkeeper/internal/modules/win_srum"
+)
+
+const (
+	aliceSID = "S-1-5-21-1004336348-1177238915-682003330-1001"
+	bobSID   = "S-1-5-21-1004336348-1177238915-682003330-1002"
+)
+
+// ecsFields are the ECS 8.11 fields, plus the winlog fields Winlogbeat adds,
+// that the export may write. labels holds custom keys of its own.
+var ecsFields = map[string]bool{
+	"@timestamp": true, "ecs.version": true, "host.name": true,
+	"event.kind": true, "event.category": true, "event.type": true, "event.action": true,
+	"event.outcome": true, "event.code": true, "event.provider": true, "event.module": true,
+	"event.dataset": true, "event.created": true, "event.start": true, "event.end": true,
+	"event.duration": true, "user.id": true, "user.name": true, "user.domain": true,
+	"process.executable": true, "process.name": true, "process.pid": true, "process.command_line": true,
+	"process.hash.sha1": true, "process.parent.executable": true, "process.parent.name": true,
+	"process.parent.pid": true, "source.ip": true, "source.port": true, "source.domain": true,
+	"source.bytes": true, "destination.ip": true, "destination.port": true, "destination.domain": true,
+	"destination.bytes": true, "network.bytes": true, "winlog.channel": true, "winlog.event_id": true,
+	"winlog.record_id": true, "winlog.logon.id": true, "winlog.logon.type": true,
+	"related.user": true, "related.ip": true, "related.hash": true,
+}
+
+// ecsTypes are the event.type values ECS allows with each event.category
+// the export uses.
+var ecsTypes = map[string][]string{
+	"authentication": {"start", "end", "info"},
+	"process":        {"access", "change", "end", "info", "start"},
+	"network":        {"access", "allowed", "connection", "denied", "end", "info", "protocol", "start"},
+}
+
+// writeArtifact writes v as JSON at rel under dir.
+func writeArtifact(t *testing.T, dir, rel string, v interface{}) {
+	t.Helper()
+	path := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestArtifacts writes the SRUM, BAM, and event log output of a
+// collection from a host someone logged on to over RDP.
+func writeTestArtifacts(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeArtifact(t, dir, filepath.Join(srumDir, "srum_app_timeline.json"), win_srum.AppTimelineReport{
+		AppTimeline: []win_srum.SRUMTimelineEntry{
+			{
+				TimestampUTC: "2024-03-01T10:06:00Z", EndTimeUTC: "2024-03-01T10:05:00Z", DurationMS: 300000,
+				App: `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`, User: aliceSID,
+			},
+			// Without a time the row cannot be placed and is dropped
+			{App: "Microsoft.WindowsCalculator_8wekyb3d8bbwe!App"},
+		},
+	})
+	writeArtifact(t, dir, filepath.Join(srumDir, "network_usage.json"), win_srum.NetworkUsageReport{
+		Applications: []win_srum.AppNetworkUsage{{
+			App: `C:\Users\alice\AppData\Local\Temp\rclone.exe`, Users: []string{aliceSID, bobSID},
+			BytesSent: 734003200, BytesRecv: 1048576,
+			FirstSeen: "2024-03-01T10:10:00Z", LastSeen: "2024-03-01T11:10:00Z",
+		}},
+	})
+	writeArtifact(t, dir, filepath.Join(activityDir, "bam.json"), win_activity.BAMReport{
+		Users: []win_activity.BAMUser{{SID: aliceSID, Entries: []win_activity.BAMEntry{{
+			Path: `\Device\HarddiskVolume3\Tools\PsExec64.exe`, ResolvedPath: `C:\Tools\PsExec64.exe`,
+			LastRun: "2024-03-01T10:20:00Z", Source: "bam",
+		}}}},
+	})
+
+	path := filepath.Join(dir, evtxDir, "Security.ndjson")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	for _, event := range []win_evtx.TriageEvent{
+		{Channel: "Security", EventID: 4624, Provider: "Microsoft-Windows-Security-Auditing", TimeCreatedUTC: "2024-03-01T09:58:12Z", RecordID: 90211, Data: map[string]string{
+			"TargetUserSid": aliceSID, "TargetUserName": "alice", "TargetDomainName": "CORP", "TargetLogonId": "0x3e7a21",
+			"LogonType": "10", "IpAddress": "10.0.4.17", "IpPort": "50123", "WorkstationName": "KALI",
+			"ProcessName": `C:\Windows\System32\svchost.exe`, "ProcessId": "0x3a4",
+		}},
+		{Channel: "Security", EventID: 4625, Provider: "Microsoft-Windows-Security-Auditing", TimeCreatedUTC: "2024-03-01T09:57:40Z", RecordID: 90208, Data: map[string]string{
+			"TargetUserSid": "S-1-0-0", "TargetUserName": "administrator", "TargetDomainName": "-", "LogonType": "3",
+			"IpAddress": "10.0.4.17", "IpPort": "0", "WorkstationName": "-", "ProcessName": "-",
+		}},
+		{Channel: "Security", EventID: 4688, Provider: "Microsoft-Windows-Security-Auditing", TimeCreatedUTC: "2024-03-01T10:00:01Z", RecordID: 90230, Data: map[string]string{
+			"SubjectUserSid": aliceSID, "SubjectUserName": "alice", "SubjectDomainName": "CORP",
+			"NewProcessName": `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`, "NewProcessId": "0x1a2c",
+			"CommandLine": "powershell -enc SQBFAFgA", "ParentProcessName": `C:\Windows\explorer.exe`, "ProcessId": "0x11f0",
+		}},
+		// The log being cleared has no mapping
+		{Channel: "Security", EventID: 1102, Provider: "Microsoft-Windows-Eventlog", TimeCreatedUTC: "2024-03-01T11:30:00Z", RecordID: 90400},
+		{Channel: "Security", EventID: 4634, Provider: "Microsoft-Windows-Security-Auditing", TimeCreatedUTC: "2024-03-01T11:00:00Z", RecordID: 90301, Data: map[string]string{
+			"TargetUserSid": aliceSID, "TargetUserName": "alice", "TargetDomainName": "CORP", "TargetLogonId": "0x3e7a21", "LogonType": "10",
+		}},
+	} {
+		if err := encoder.Encode(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// flatten adds the dotted name of every leaf field of doc to fields.
+func flatten(prefix string, doc map[string]interface{}, fields map[string]interface{}) {
+	for key, value := range doc {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flatten(name, nested, fields)
+			continue
+		}
+		fields[name] = value
+	}
+}
+
+// readExport returns the flattened fields of each exported event.
+func readExport(t *testing.T, dir string) []map[string]interface{} {
+	t.Helper()
+	file, err := os.Open(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		fields := make(map[string]interface{})
+		flatten("", doc, fields)
+		events = append(events, fields)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestExportWritesECSFieldNames(t *testing.T) {
+	dir := writeTestArtifacts(t)
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	summary, err := Export(context.Background(), dir, "WS-0142", created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSources := map[string]int{
+		"cryptkeeper.srum_app_timeline":  1,
+		"cryptkeeper.srum_network_usage": 1,
+		"cryptkeeper.bam":                1,
+		"cryptkeeper.evtx":               4,
+	}
+	if summary.Events != 7 || !reflect.DeepEqual(summary.Sources, wantSources) || len(summary.Errors) != 0 {
+		t.Fatalf("summary = %+v", summary)
+	}
+
+	events := readExport(t, dir)
+	if len(events) != summary.Events {
+		t.Fatalf("%d events written, summary counts %d", len(events), summary.Events)
+	}
+	for _, event := range events {
+		for name := range event {
+			if !ecsFields[name] && !strings.HasPrefix(name, "labels.") {
+				t.Errorf("%s: %s is not an ECS field", event["event.dataset"], name)
+			}
+			if label := strings.TrimPrefix(name, "labels."); label != name && strings.ContainsAny(label, ". ") {
+				t.Errorf("label %q is not a valid label key", label)
+			}
+		}
+		if _, err := time.Parse(time.RFC3339Nano, event["@timestamp"].(string)); err != nil {
+			t.Errorf("@timestamp = %v", event["@timestamp"])
+		}
+		if event["ecs.version"] != Version || event["host.name"] != "WS-0142" || event["event.kind"] != "event" ||
+			event["event.created"] != "2024-03-01T12:00:00Z" || event["event.module"] != "cryptkeeper" {
+			t.Errorf("common fields = %v", event)
+		}
+		// Every type must be allowed with every category of the event
+		for _, category := range event["event.category"].([]interface{}) {
+			allowed, ok := ecsTypes[category.(string)]
+			if !ok {
+				t.Errorf("unexpected event.category %v", category)
+				continue
+			}
+			for _, eventType := range event["event.type"].([]interface{}) {
+				if !contains(allowed, eventType.(string)) {
+					t.Errorf("event.type %v is not allowed with event.category %v", eventType, category)
+				}
+			}
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestExportMappings(t *testing.T) {
+	dir := writeTestArtifacts(t)
+	if _, err := Export(context.Background(), dir, "WS-0142", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	byAction := make(map[string]map[string]interface{})
+	for _, event := range readExport(t, dir) {
+		byAction[event["event.action"].(string)] = event
+	}
+
+	for _, tt := range []struct {
+		action string
+		want   map[string]interface{}
+	}{
+		{"logged-in", map[string]interface{}{
+			"event.category": []interface{}{"authentication"}, "event.type": []interface{}{"start"},
+			"event.outcome": "success", "event.code": "4624", "winlog.event_id": "4624", "winlog.record_id": 90211.0,
+			"user.id": aliceSID, "user.name": "alice", "user.domain": "CORP",
+			"winlog.logon.id": "0x3e7a21", "winlog.logon.type": "RemoteInteractive",
+			"source.ip": "10.0.4.17", "source.port": 50123.0, "source.domain": "KALI",
+			"process.executable": `C:\Windows\System32\svchost.exe`, "process.name": "svchost.exe", "process.pid": 932.0,
+			"related.user": []interface{}{"alice"}, "related.ip": []interface{}{"10.0.4.17"},
+		}},
+		{"logon-failed", map[string]interface{}{
+			"event.outcome": "failure", "user.name": "administrator", "winlog.logon.type": "Network",
+			"source.ip": "10.0.4.17",
+		}},
+		{"created-process", map[string]interface{}{
+			"event.category": []interface{}{"process"}, "event.type": []interface{}{"start"},
+			"@timestamp": "2024-03-01T10:00:01Z", "user.name": "alice",
+			"process.executable": `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`, "process.name": "powershell.exe",
+			"process.pid": 6700.0, "process.command_line": "powershell -enc SQBFAFgA",
+			"process.parent.executable": `C:\Windows\explorer.exe`, "process.parent.name": "explorer.exe", "process.parent.pid": 4592.0,
+		}},
+		{"logged-out", map[string]interface{}{"event.type": []interface{}{"end"}, "winlog.logon.id": "0x3e7a21"}},
+		{"app-timeline", map[string]interface{}{
+			"@timestamp": "2024-03-01T10:06:00Z", "event.start": "2024-03-01T10:00:00Z", "event.end": "2024-03-01T10:05:00Z",
+			"event.duration": 3e11, "process.name": "powershell.exe", "user.id": aliceSID,
+			"labels.cryptkeeper_source": "windows_srum/windows/srum/srum_app_timeline.json",
+		}},
+		{"network-usage", map[string]interface{}{
+			"event.category": []interface{}{"network"}, "process.executable": `C:\Users\alice\AppData\Local\Temp\rclone.exe`,
+			"source.bytes": 734003200.0, "destination.bytes": 1048576.0, "network.bytes": 735051776.0,
+			"related.user": []interface{}{aliceSID, bobSID}, "@timestamp": "2024-03-01T11:10:00Z",
+		}},
+		{"last-run", map[string]interface{}{
+			"process.executable": `C:\Tools\PsExec64.exe`, "process.name": "PsExec64.exe", "event.provider": "BAM",
+			"user.id": aliceSID, "@timestamp": "2024-03-01T10:20:00Z",
+		}},
+	} {
+		event, ok := byAction[tt.action]
+		if !ok {
+			t.Errorf("no %s event", tt.action)
+			continue
+		}
+		for name, want := range tt.want {
+			if got := event[name]; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %s = %#v, want %#v", tt.action, name, got, want)
+			}
+		}
+	}
+
+	// "-" stands for no value and is not exported
+	failed := byAction["logon-failed"]
+	for _, name := range []string{"user.domain", "source.domain", "source.port", "process.name"} {
+		if value, ok := failed[name]; ok {
+			t.Errorf("logon-failed: %s = %v", name, value)
+		}
+	}
+}
+
+func TestExportWithoutArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	summary, err := Export(context.Background(), dir, "WS-0142", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Events != 0 || len(summary.Errors) != 0 {
+		t.Fatalf("summary = %+v", summary)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, FileName)); err != nil || len(data) != 0 {
+		t.Fatalf("%s = %q, %v", FileName, data, err)
+	}
+
+	// A damaged report is an error for that source only
+	writeArtifact(t, dir, filepath.Join(activityDir, "bam.json"), "not a report")
+	summary, err = Export(context.Background(), dir, "WS-0142", time.Now())
+	if err != nil || len(summary.Errors) != 1 || !strings.HasPrefix(summary.Errors[0], "bam: ") {
+		t.Fatalf("summary = %+v, %v", summary, err)
+	}
+}
@@ -0,0 +1,395 @@
+package ecs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/modules/win_activity"
+	"cryptkeeper/internal/modules/win_amcache"
+	"cryptkeeper/internal/modules/win_evtx"
+	"cryptkeeper/internal/modules/win_srum"
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// Module output locations, relative to the artifacts directory.
+var (
+	srumDir     = filepath.Join("windows_srum", "windows", "srum")
+	activityDir = filepath.Join("windows_activity", "windows", "activity")
+	amcacheDir  = filepath.Join("windows_amcache", "windows", "amcache")
+	evtxDir     = filepath.Join("windows_evtx", "windows", "evtx")
+)
+
+// logonTypes names Windows logon types the way Winlogbeat does.
+var logonTypes = map[string]string{
+	"2":  "Interactive",
+	"3":  "Network",
+	"4":  "Batch",
+	"5":  "Service",
+	"7":  "Unlock",
+	"8":  "NetworkCleartext",
+	"9":  "NewCredentials",
+	"10": "RemoteInteractive",
+	"11": "CachedInteractive",
+}
+
+// srumAppTimeline maps App Timeline rows to process activity spans.
+func (e *exporter) srumAppTimeline() error {
+	rel := filepath.Join(srumDir, "srum_app_timeline.json")
+	var report win_srum.AppTimelineReport
+	if ok, err := e.readJSON(rel, &report); !ok {
+		return err
+	}
+	for _, entry := range report.AppTimeline {
+		end := parseTime(entry.EndTimeUTC)
+		event := Event{
+			Timestamp: timestamp(parseTime(entry.TimestampUTC)),
+			Event: EventFields{
+				Category: []string{"process"},
+				Type:     []string{"info"},
+				Action:   "app-timeline",
+				Provider: "SRUM",
+				End:      timestamp(end),
+			},
+			Process: process(entry.App),
+			User:    sidUser(entry.User),
+		}
+		if entry.DurationMS > 0 {
+			event.Event.Duration = entry.DurationMS * int64(time.Millisecond)
+			if !end.IsZero() {
+				event.Event.Start = timestamp(end.Add(-time.Duration(entry.DurationMS) * time.Millisecond))
+			}
+		}
+		if event.Timestamp == "" {
+			event.Timestamp = event.Event.End
+		}
+		if err := e.emit(event, "srum_app_timeline", rel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// srumNetworkUsage maps the per-application SRUM network totals. Bytes the
+// host sent are source bytes and bytes it received destination bytes.
+func (e *exporter) srumNetworkUsage() error {
+	rel := filepath.Join(srumDir, "network_usage.json")
+	var report win_srum.NetworkUsageReport
+	if ok, err := e.readJSON(rel, &report); !ok {
+		return err
+	}
+	for _, app := range report.Applications {
+		event := Event{
+			Timestamp: timestamp(parseTime(app.LastSeen)),
+			Event: EventFields{
+				Category: []string{"network"},
+				Type:     []string{"info"},
+				Action:   "network-usage",
+				Provider: "SRUM",
+				Start:    timestamp(parseTime(app.FirstSeen)),
+				End:      timestamp(parseTime(app.LastSeen)),
+			},
+			Process:     process(app.App),
+			Source:      &Endpoint{Bytes: app.BytesSent},
+			Destination: &Endpoint{Bytes: app.BytesRecv},
+			Network:     &Network{Bytes: app.BytesSent + app.BytesRecv},
+		}
+		if len(app.Users) == 1 {
+			event.User = sidUser(app.Users[0])
+		} else if len(app.Users) > 1 {
+			event.Related = &Related{User: app.Users}
+		}
+		if err := e.emit(event, "srum_network_usage", rel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bam maps BAM and DAM last-run times to process events.
+func (e *exporter) bam() error {
+	rel := filepath.Join(activityDir, "bam.json")
+	var report win_activity.BAMReport
+	if ok, err := e.readJSON(rel, &report); !ok {
+		return err
+	}
+	for _, user := range report.Users {
+		for _, entry := range user.Entries {
+			path := entry.ResolvedPath
+			if path == "" {
+				path = entry.Path
+			}
+			event := Event{
+				Timestamp: timestamp(parseTime(entry.LastRun)),
+				Event: EventFields{
+					Category: []string{"process"},
+					Type:     []string{"info"},
+					Action:   "last-run",
+					Provider: strings.ToUpper(entry.Source),
+				},
+				Process: process(path),
+				User:    sidUser(user.SID),
+			}
+			if err := e.emit(event, "bam", rel); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// amcacheFiles maps InventoryApplicationFile entries of the collected
+// Amcache hive, timed by when their key was last written.
+func (e *exporter) amcacheFiles() error {
+	rel := filepath.Join(amcacheDir, "Amcache.hve")
+	manifest, err := win_amcache.LoadAmcacheManifest(filepath.Join(e.artifactsDir, amcacheDir, "manifest.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read amcache manifest: %w", err)
+	}
+	for _, item := range manifest.Items {
+		if item.Path == "Amcache.hve" && item.Truncated {
+			return fmt.Errorf("Amcache.hve copy is truncated")
+		}
+	}
+	hive, err := regf.Open(filepath.Join(e.artifactsDir, rel))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer hive.Close()
+
+	files, errs, err := win_amcache.ParseApplicationFiles(hive)
+	if err != nil {
+		return err
+	}
+	for _, msg := range errs {
+		e.summary.Errors = append(e.summary.Errors, "amcache: "+msg)
+	}
+	for _, file := range files {
+		event := Event{
+			Timestamp: timestamp(parseTime(file.KeyLastWritten)),
+			Event: EventFields{
+				Category: []string{"process"},
+				Type:     []string{"info"},
+				Action:   "application-file-recorded",
+				Provider: "Amcache",
+			},
+			Process: process(file.Path),
+		}
+		if file.SHA1 != "" {
+			event.Process.Hash = &Hash{SHA1: file.SHA1}
+			event.Related = &Related{Hash: []string{file.SHA1}}
+		}
+		if err := e.emit(event, "amcache", rel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventLogs maps logon, logoff, and process events from the NDJSON files
+// written by --evtx-event-ids. Other event IDs are not mapped.
+func (e *exporter) eventLogs() error {
+	matches, err := filepath.Glob(filepath.Join(e.artifactsDir, evtxDir, "*.ndjson"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+	for _, path := range matches {
+		rel, _ := filepath.Rel(e.artifactsDir, path)
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = lines(file, func(line []byte) error {
+			var triage win_evtx.TriageEvent
+			if json.Unmarshal(line, &triage) != nil {
+				return nil
+			}
+			event, ok := windowsEvent(triage)
+			if !ok {
+				return nil
+			}
+			return e.emit(event, "evtx", rel)
+		})
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+// windowsEvent maps one Security log event, reporting false for event IDs
+// without a mapping.
+func windowsEvent(triage win_evtx.TriageEvent) (Event, bool) {
+	data := triage.Data
+	event := Event{
+		Timestamp: timestamp(parseTime(triage.TimeCreatedUTC)),
+		Event: EventFields{
+			Code:     strconv.Itoa(triage.EventID),
+			Provider: triage.Provider,
+		},
+		Winlog: &Winlog{
+			Channel:  triage.Channel,
+			EventID:  strconv.Itoa(triage.EventID),
+			RecordID: triage.RecordID,
+		},
+	}
+
+	switch triage.EventID {
+	case 4624, 4625:
+		event.Event.Category = []string{"authentication"}
+		event.Event.Type = []string{"start"}
+		event.Event.Action, event.Event.Outcome = "logged-in", "success"
+		if triage.EventID == 4625 {
+			event.Event.Action, event.Event.Outcome = "logon-failed", "failure"
+		}
+		event.User = account(data["TargetUserSid"], data["TargetUserName"], data["TargetDomainName"])
+		event.Winlog.Logon = logon(data["TargetLogonId"], data["LogonType"])
+		event.Source = remote(data["IpAddress"], data["IpPort"], data["WorkstationName"])
+		if name := fieldValue(data["ProcessName"]); name != "" {
+			event.Process = process(name)
+			event.Process.PID = parsePID(data["ProcessId"])
+		}
+	case 4634, 4647:
+		event.Event.Category = []string{"authentication"}
+		event.Event.Type = []string{"end"}
+		event.Event.Action, event.Event.Outcome = "logged-out", "success"
+		event.User = account(data["TargetUserSid"], data["TargetUserName"], data["TargetDomainName"])
+		event.Winlog.Logon = logon(data["TargetLogonId"], data["LogonType"])
+	case 4688:
+		event.Event.Category = []string{"process"}
+		event.Event.Type = []string{"start"}
+		event.Event.Action = "created-process"
+		event.User = account(data["SubjectUserSid"], data["SubjectUserName"], data["SubjectDomainName"])
+		event.Process = process(data["NewProcessName"])
+		event.Process.PID = parsePID(data["NewProcessId"])
+		event.Process.CommandLine = fieldValue(data["CommandLine"])
+		if parent := fieldValue(data["ParentProcessName"]); parent != "" || data["ProcessId"] != "" {
+			event.Process.Parent = &ParentProcess{
+				Executable: parent,
+				Name:       baseName(parent),
+				PID:        parsePID(data["ProcessId"]),
+			}
+		}
+	default:
+		return Event{}, false
+	}
+
+	if event.User != nil && event.User.Name != "" {
+		event.Related = &Related{User: []string{event.User.Name}}
+	}
+	if event.Source != nil && event.Source.IP != "" {
+		if event.Related == nil {
+			event.Related = &Related{}
+		}
+		event.Related.IP = []string{event.Source.IP}
+	}
+	return event, true
+}
+
+// process returns the process fields for a recorded application, which is
+// an executable path or, for packaged apps and services, only a name.
+func process(app string) *Process {
+	app = strings.TrimSpace(app)
+	if strings.ContainsAny(app, `\/`) {
+		return &Process{Executable: app, Name: baseName(app)}
+	}
+	return &Process{Name: app}
+}
+
+// sidUser returns user fields for a SID, or nil when there is none.
+func sidUser(sid string) *User {
+	if sid == "" {
+		return nil
+	}
+	return &User{ID: sid}
+}
+
+// account returns user fields from an event's SID, name, and domain.
+func account(sid, name, domain string) *User {
+	user := &User{ID: fieldValue(sid), Name: fieldValue(name), Domain: fieldValue(domain)}
+	if *user == (User{}) {
+		return nil
+	}
+	return user
+}
+
+// logon returns the winlog.logon fields for a logon ID and type number.
+func logon(id, logonType string) *WinlogLogon {
+	l := &WinlogLogon{ID: fieldValue(id), Type: logonTypes[logonType]}
+	if l.Type == "" {
+		l.Type = fieldValue(logonType)
+	}
+	if *l == (WinlogLogon{}) {
+		return nil
+	}
+	return l
+}
+
+// remote returns the source fields of a logon from another machine.
+func remote(ip, port, workstation string) *Endpoint {
+	source := &Endpoint{IP: fieldValue(ip), Domain: fieldValue(workstation)}
+	if n, err := strconv.Atoi(fieldValue(port)); err == nil && n > 0 {
+		source.Port = n
+	}
+	if *source == (Endpoint{}) {
+		return nil
+	}
+	return source
+}
+
+// fieldValue returns an event data value, treating "-" as empty.
+func fieldValue(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// parsePID reads a process ID, written in hexadecimal by the Security log.
+func parsePID(s string) int64 {
+	s = fieldValue(s)
+	base := 10
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s, base = s[2:], 16
+	}
+	n, err := strconv.ParseInt(s, base, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// parseTime reads a time written by a module, or returns the zero time.
+func parseTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := winutil.ParseTime(s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// baseName returns the final element of a Windows path.
+func baseName(path string) string {
+	if i := strings.LastIndexAny(path, `\/`); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
@@ -0,0 +1,789 @@
+// Package ese provides a minimal read-only reader for Extensible Storage
+// Engine (JET Blue) database files such as SRUDB.dat. It walks table b-trees
+// page by page so collected databases can be parsed without the Windows ESE
+// API, which refuses files that were copied while open. Indexes are not read,
+// uncommitted transaction log content is not replayed, and long values
+// stored outside their record, or compressed with Xpress, are returned as
+// errors rather than read.
+package ese
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// headerSignature is the magic number at offset 4 of the file header.
+const headerSignature = 0x89abcdef
+
+// File header offsets.
+const (
+	headerRevisionOffset = 0xe8
+	headerPageSizeOffset = 0xec
+)
+
+// Page header fields. Pages of 16 KB and more written by format revision
+// 0x11 and later carry a 40-byte extension after the common header.
+const (
+	pageHeaderSize      = 40
+	largePageHeaderSize = 80
+	pageTagCountOffset  = 0x22
+	pageFlagsOffset     = 0x24
+	largePageRevision   = 0x11
+)
+
+// Page flags.
+const (
+	pageFlagLeaf      = 0x02
+	pageFlagSpaceTree = 0x20
+	pageFlagIndex     = 0x40
+	pageFlagLongValue = 0x80
+)
+
+// Page tag flags.
+const (
+	tagFlagDefunct   = 0x02
+	tagFlagCommonKey = 0x04
+)
+
+// catalogFixedSizes are the widths of MSysObjects' fixed columns: ObjidTable,
+// Type, Id, ColtypOrPgnoFDP, SpaceUsage, Flags, PagesOrLocale, RootFlag, and
+// RecordOffset.
+var catalogFixedSizes = []int{4, 2, 4, 4, 4, 4, 4, 1, 2}
+
+// catalogFDP is the root page of MSysObjects, the catalog of every table,
+// column, index, and long-value tree.
+const catalogFDP = 4
+
+// Catalog entry types.
+const (
+	catalogTable  = 1
+	catalogColumn = 2
+)
+
+// Column types (JET_coltyp).
+const (
+	ColtypBit           = 1
+	ColtypUnsignedByte  = 2
+	ColtypShort         = 3
+	ColtypLong          = 4
+	ColtypCurrency      = 5
+	ColtypIEEESingle    = 6
+	ColtypIEEEDouble    = 7
+	ColtypDateTime      = 8
+	ColtypBinary        = 9
+	ColtypText          = 10
+	ColtypLongBinary    = 11
+	ColtypLongText      = 12
+	ColtypUnsignedLong  = 14
+	ColtypLongLong      = 15
+	ColtypGUID          = 16
+	ColtypUnsignedShort = 17
+)
+
+// Tagged value header flags.
+const (
+	tagHeaderCompressed  = 0x02
+	tagHeaderSeparated   = 0x04
+	tagHeaderMultiValues = 0x08
+	tagHeaderTwoValues   = 0x10
+	tagHeaderNull        = 0x20
+)
+
+// Small-page tagged offset flags.
+const (
+	tagOffsetExtendedInfo = 0x4000
+	tagOffsetNull         = 0x2000
+)
+
+// firstVariableColumn is the lowest variable column identifier; fixed
+// columns are numbered below it and tagged columns from 256.
+const firstVariableColumn = 128
+
+// maxTreeDepth bounds b-tree recursion so corrupt pages cannot loop forever.
+const maxTreeDepth = 32
+
+// ErrNoSuchTable is returned when a table is not in the catalog.
+var ErrNoSuchTable = errors.New("no such table")
+
+// oleEpoch is day zero of an OLE automation date (JET_coltypDateTime).
+var oleEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// DB is an open ESE database file.
+type DB struct {
+	r          io.ReaderAt
+	closer     io.Closer
+	pageSize   int
+	pageCount  int
+	largePages bool
+	tables     map[string]*Table
+}
+
+// Column describes a column from the catalog.
+type Column struct {
+	ID       uint32
+	Name     string
+	Type     uint32
+	Size     uint32 // Declared size of fixed columns
+	Codepage uint32 // 1200 for UTF-16 text
+}
+
+// Table describes a table from the catalog.
+type Table struct {
+	Name    string
+	FDP     uint32 // Root page of the table's data tree
+	Columns []Column
+}
+
+// Row is a single table record. Values are bool, int64, float64, time.Time,
+// string, or []byte; null columns are absent.
+type Row struct {
+	Values  map[string]interface{}
+	Errors  map[string]error // Columns present in the record that could not be decoded
+	columns []Column
+}
+
+// Open opens a database file for reading.
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	db, err := NewReader(f, stat.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	db.closer = f
+	return db, nil
+}
+
+// NewReader reads a database of the given size from r.
+func NewReader(r io.ReaderAt, size int64) (*DB, error) {
+	header := make([]byte, 0xf0)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read database header: %w", err)
+	}
+	if binary.LittleEndian.Uint32(header[4:]) != headerSignature {
+		return nil, fmt.Errorf("not an ESE database")
+	}
+
+	pageSize := int(binary.LittleEndian.Uint32(header[headerPageSizeOffset:]))
+	if pageSize == 0 {
+		pageSize = 4096
+	}
+	if pageSize < 2048 || pageSize > 32768 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size %d", pageSize)
+	}
+
+	db := &DB{
+		r:          r,
+		pageSize:   pageSize,
+		pageCount:  int(size/int64(pageSize)) - 2, // The header and its shadow come first
+		largePages: pageSize >= 16384 && binary.LittleEndian.Uint32(header[headerRevisionOffset:]) >= largePageRevision,
+		tables:     make(map[string]*Table),
+	}
+	if err := db.loadCatalog(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close releases the underlying file.
+func (db *DB) Close() error {
+	if db.closer != nil {
+		return db.closer.Close()
+	}
+	return nil
+}
+
+// Tables returns the names of all tables in the catalog.
+func (db *DB) Tables() []string {
+	names := make([]string, 0, len(db.tables))
+	for _, t := range db.tables {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// Table returns the catalog entry for a table, matched case-insensitively.
+func (db *DB) Table(name string) (*Table, error) {
+	t, ok := db.tables[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchTable, name)
+	}
+	return t, nil
+}
+
+// ForEachRow calls fn for every record of a table in key order. Returning an
+// error from fn stops the scan and is returned.
+func (db *DB) ForEachRow(table string, fn func(Row) error) error {
+	t, err := db.Table(table)
+	if err != nil {
+		return err
+	}
+	sizes := fixedSizes(t.Columns)
+	return db.walkTree(t.FDP, 0, func(record []byte) error {
+		row := Row{Values: make(map[string]interface{}, len(t.Columns)), columns: t.Columns}
+		raw, err := db.splitRecord(record, sizes)
+		if err != nil {
+			return fmt.Errorf("table %s: %w", t.Name, err)
+		}
+		for _, column := range t.Columns {
+			data, ok := raw[column.ID]
+			if !ok {
+				continue
+			}
+			value, err := decodeValue(column, data)
+			if err != nil {
+				if row.Errors == nil {
+					row.Errors = make(map[string]error)
+				}
+				row.Errors[column.Name] = err
+				continue
+			}
+			row.Values[column.Name] = value
+		}
+		return fn(row)
+	})
+}
+
+// Get returns the value of a named column, or nil when it is unknown or null.
+func (r Row) Get(column string) interface{} {
+	if v, ok := r.Values[column]; ok {
+		return v
+	}
+	for name, v := range r.Values {
+		if strings.EqualFold(name, column) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Int returns a column as a signed integer.
+func (r Row) Int(column string) int64 {
+	switch v := r.Get(column).(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Time returns a DateTime column, or a 64-bit column holding a FILETIME,
+// in UTC. It is zero when the column is null or unset.
+func (r Row) Time(column string) time.Time {
+	switch v := r.Get(column).(type) {
+	case time.Time:
+		return v
+	case int64:
+		return filetime(uint64(v))
+	}
+	return time.Time{}
+}
+
+// Bytes returns a binary or text column's raw value.
+func (r Row) Bytes(column string) []byte {
+	switch v := r.Get(column).(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return nil
+}
+
+// IntColumns returns the names of the row's non-null integer columns.
+func (r Row) IntColumns() []string {
+	var names []string
+	for _, column := range r.columns {
+		switch r.Values[column.Name].(type) {
+		case int64, bool:
+			names = append(names, column.Name)
+		}
+	}
+	return names
+}
+
+// loadCatalog reads MSysObjects into db.tables.
+func (db *DB) loadCatalog() error {
+	byObjID := make(map[uint32]*Table)
+	var columns []struct {
+		table uint32
+		Column
+	}
+
+	err := db.walkTree(catalogFDP, 0, func(record []byte) error {
+		raw, err := db.splitRecord(record, catalogFixedSizes)
+		if err != nil {
+			return nil
+		}
+		objTable := uint32Value(raw[1])
+		kind := uint16Value(raw[2])
+		id := uint32Value(raw[3])
+		coltypOrFDP := uint32Value(raw[4])
+		name := string(raw[firstVariableColumn].data)
+
+		switch kind {
+		case catalogTable:
+			t := &Table{Name: name, FDP: coltypOrFDP}
+			byObjID[objTable] = t
+			db.tables[strings.ToLower(name)] = t
+		case catalogColumn:
+			columns = append(columns, struct {
+				table uint32
+				Column
+			}{objTable, Column{ID: id, Name: name, Type: coltypOrFDP, Size: uint32Value(raw[5]), Codepage: uint32Value(raw[7])}})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+	if len(db.tables) == 0 {
+		return fmt.Errorf("catalog has no tables")
+	}
+	for _, c := range columns {
+		if t := byObjID[c.table]; t != nil {
+			t.Columns = append(t.Columns, c.Column)
+		}
+	}
+	return nil
+}
+
+// readPage returns the raw bytes of a page number.
+func (db *DB) readPage(n uint32) ([]byte, error) {
+	if n < 1 || int(n) > db.pageCount {
+		return nil, fmt.Errorf("page %d out of range", n)
+	}
+	page := make([]byte, db.pageSize)
+	read, err := db.r.ReadAt(page, int64(n+1)*int64(db.pageSize))
+	if err != nil && !(err == io.EOF && read == db.pageSize) {
+		return nil, fmt.Errorf("failed to read page %d: %w", n, err)
+	}
+	return page, nil
+}
+
+// pageValue is one tagged value on a page.
+type pageValue struct {
+	data  []byte
+	flags uint16
+}
+
+// pageValues returns the tagged values of a page; value 0 is the page's
+// own header (its common key prefix, or root page space information).
+func (db *DB) pageValues(page []byte) ([]pageValue, error) {
+	headerSize := pageHeaderSize
+	offsetMask, sizeMask := uint16(0x1fff), uint16(0x1fff)
+	if db.largePages {
+		headerSize = largePageHeaderSize
+		offsetMask, sizeMask = 0x7fff, 0x7fff
+	}
+	count := int(binary.LittleEndian.Uint16(page[pageTagCountOffset:]))
+	if count*4 > len(page)-headerSize {
+		return nil, fmt.Errorf("page tag count %d exceeds page", count)
+	}
+
+	values := make([]pageValue, 0, count)
+	for i := 0; i < count; i++ {
+		tag := page[len(page)-4*(i+1):]
+		sizeWord := binary.LittleEndian.Uint16(tag[0:])
+		offsetWord := binary.LittleEndian.Uint16(tag[2:])
+		start := headerSize + int(offsetWord&offsetMask)
+		end := start + int(sizeWord&sizeMask)
+		if end > len(page)-4*count || start > end {
+			return nil, fmt.Errorf("page tag %d out of bounds", i)
+		}
+		value := pageValue{data: page[start:end], flags: offsetWord >> 13}
+		if db.largePages && len(value.data) >= 2 {
+			value.flags = binary.LittleEndian.Uint16(value.data) >> 13
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// entryData strips the key from a b-tree entry and returns what follows it:
+// a child page number on branch pages, the record on leaf pages.
+func (db *DB) entryData(value pageValue) ([]byte, error) {
+	data := value.data
+	offset := 0
+	if value.flags&tagFlagCommonKey != 0 {
+		offset = 2
+	}
+	if len(data) < offset+2 {
+		return nil, fmt.Errorf("entry too short")
+	}
+	localKey := int(binary.LittleEndian.Uint16(data[offset:]) & 0x1fff)
+	offset += 2 + localKey
+	if offset > len(data) {
+		return nil, fmt.Errorf("entry key exceeds entry")
+	}
+	return data[offset:], nil
+}
+
+// walkTree calls fn with every leaf record in the b-tree rooted at pageNum.
+func (db *DB) walkTree(pageNum uint32, depth int, fn func(record []byte) error) error {
+	if depth > maxTreeDepth {
+		return fmt.Errorf("b-tree deeper than %d levels", maxTreeDepth)
+	}
+	page, err := db.readPage(pageNum)
+	if err != nil {
+		return err
+	}
+	flags := binary.LittleEndian.Uint32(page[pageFlagsOffset:])
+	if flags&(pageFlagSpaceTree|pageFlagIndex|pageFlagLongValue) != 0 {
+		return nil
+	}
+	values, err := db.pageValues(page)
+	if err != nil {
+		return fmt.Errorf("page %d: %w", pageNum, err)
+	}
+
+	for _, value := range values[min(1, len(values)):] {
+		if value.flags&tagFlagDefunct != 0 {
+			continue
+		}
+		data, err := db.entryData(value)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", pageNum, err)
+		}
+		if flags&pageFlagLeaf != 0 {
+			if err := fn(data); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(data) < 4 {
+			return fmt.Errorf("page %d: branch entry without child page", pageNum)
+		}
+		child := binary.LittleEndian.Uint32(data)
+		if child == pageNum {
+			return fmt.Errorf("page %d: branch entry points to itself", pageNum)
+		}
+		if err := db.walkTree(child, depth+1, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rawValue is a column's bytes as stored in a record.
+type rawValue struct {
+	data   []byte
+	header byte // Tagged value header flags, zero for fixed and variable columns
+}
+
+// splitRecord returns the raw bytes of every non-null column in a record,
+// keyed by column identifier. fixedSizes gives the width of each fixed
+// column, indexed from identifier 1.
+func (db *DB) splitRecord(record []byte, fixedSizes []int) (map[uint32]rawValue, error) {
+	if len(record) < 4 {
+		return nil, fmt.Errorf("record too short")
+	}
+	lastFixed := int(record[0])
+	lastVariable := int(record[1])
+	variableOffset := int(binary.LittleEndian.Uint16(record[2:]))
+	if variableOffset < 4 || variableOffset > len(record) {
+		return nil, fmt.Errorf("invalid variable data offset %d", variableOffset)
+	}
+	raw := make(map[uint32]rawValue)
+
+	// Fixed columns are packed in identifier order, followed by a bitmap
+	// with a set bit for each null column
+	bitmapSize := (lastFixed + 7) / 8
+	fixedEnd := variableOffset - bitmapSize
+	if fixedEnd < 4 {
+		return nil, fmt.Errorf("fixed column bitmap exceeds record")
+	}
+	bitmap := record[fixedEnd:variableOffset]
+	offset := 4
+	for id := 1; id <= lastFixed && id <= len(fixedSizes); id++ {
+		size := fixedSizes[id-1]
+		if size == 0 || offset+size > fixedEnd {
+			break
+		}
+		if bitmap[(id-1)/8]&(1<<((id-1)%8)) == 0 {
+			raw[uint32(id)] = rawValue{data: record[offset : offset+size]}
+		}
+		offset += size
+	}
+
+	// Variable columns: an array of end offsets, high bit set when null,
+	// then the values themselves
+	count := 0
+	if lastVariable >= firstVariableColumn {
+		count = lastVariable - firstVariableColumn + 1
+	}
+	dataStart := variableOffset + 2*count
+	if dataStart > len(record) {
+		return nil, fmt.Errorf("variable column offsets exceed record")
+	}
+	previous := 0
+	for i := 0; i < count; i++ {
+		word := binary.LittleEndian.Uint16(record[variableOffset+2*i:])
+		end := int(word & 0x7fff)
+		if dataStart+end > len(record) || end < previous {
+			return nil, fmt.Errorf("variable column %d exceeds record", firstVariableColumn+i)
+		}
+		if word&0x8000 == 0 {
+			raw[uint32(firstVariableColumn+i)] = rawValue{data: record[dataStart+previous : dataStart+end]}
+		}
+		previous = end
+	}
+
+	// Tagged columns: (identifier, offset) pairs, then the values
+	tagged := record[dataStart+previous:]
+	if len(tagged) < 4 {
+		return raw, nil
+	}
+	offsetMask := uint16(0x1fff)
+	if db.largePages {
+		offsetMask = 0x7fff
+	}
+	entries := int(binary.LittleEndian.Uint16(tagged[2:])&offsetMask) / 4
+	if entries == 0 || entries*4 > len(tagged) {
+		return nil, fmt.Errorf("invalid tagged column array")
+	}
+	for i := 0; i < entries; i++ {
+		id := uint32(binary.LittleEndian.Uint16(tagged[4*i:]))
+		word := binary.LittleEndian.Uint16(tagged[4*i+2:])
+		start := int(word & offsetMask)
+		end := len(tagged)
+		if i+1 < entries {
+			end = int(binary.LittleEndian.Uint16(tagged[4*i+6:]) & offsetMask)
+		}
+		if start > end || end > len(tagged) {
+			return nil, fmt.Errorf("tagged column %d exceeds record", id)
+		}
+		value := rawValue{data: tagged[start:end]}
+
+		// Large pages always give each value a header byte; small pages
+		// flag the ones that have it
+		hasHeader := db.largePages || word&tagOffsetExtendedInfo != 0
+		if !db.largePages && word&tagOffsetNull != 0 {
+			continue
+		}
+		if hasHeader {
+			if len(value.data) == 0 {
+				continue
+			}
+			value.header, value.data = value.data[0], value.data[1:]
+		}
+		raw[id] = value
+	}
+	return raw, nil
+}
+
+// fixedSizes returns the width of each fixed column of a table, indexed
+// from identifier 1, with zero for identifiers the table does not define.
+func fixedSizes(columns []Column) []int {
+	var sizes []int
+	for _, column := range columns {
+		if column.ID < 1 || column.ID >= firstVariableColumn {
+			continue
+		}
+		for len(sizes) < int(column.ID) {
+			sizes = append(sizes, 0)
+		}
+		sizes[column.ID-1] = fixedSize(column)
+	}
+	return sizes
+}
+
+// fixedSize returns the stored width of a fixed column.
+func fixedSize(column Column) int {
+	switch column.Type {
+	case ColtypBit, ColtypUnsignedByte:
+		return 1
+	case ColtypShort, ColtypUnsignedShort:
+		return 2
+	case ColtypLong, ColtypUnsignedLong, ColtypIEEESingle:
+		return 4
+	case ColtypCurrency, ColtypIEEEDouble, ColtypDateTime, ColtypLongLong:
+		return 8
+	case ColtypGUID:
+		return 16
+	}
+	return int(column.Size)
+}
+
+// decodeValue converts a column's stored bytes to a Go value.
+func decodeValue(column Column, value rawValue) (interface{}, error) {
+	data := value.data
+	switch {
+	case value.header&tagHeaderNull != 0:
+		return nil, nil
+	case value.header&tagHeaderSeparated != 0:
+		return nil, fmt.Errorf("long value stored outside the record is not read")
+	case value.header&tagHeaderTwoValues != 0:
+		// The first byte is the length of the first value
+		if len(data) < 1 || 1+int(data[0]) > len(data) {
+			return nil, fmt.Errorf("invalid two-value column")
+		}
+		data = data[1 : 1+int(data[0])]
+	case value.header&tagHeaderMultiValues != 0:
+		// An array of value offsets; only the first value is returned
+		if len(data) < 2 {
+			return nil, fmt.Errorf("invalid multi-value column")
+		}
+		first := int(binary.LittleEndian.Uint16(data) & 0x7fff)
+		end := len(data)
+		if first >= 4 {
+			end = int(binary.LittleEndian.Uint16(data[2:]) & 0x7fff)
+		}
+		if first > end || end > len(data) {
+			return nil, fmt.Errorf("invalid multi-value column")
+		}
+		data = data[first:end]
+	}
+	if value.header&tagHeaderCompressed != 0 {
+		decompressed, err := decompress(data)
+		if err != nil {
+			return nil, err
+		}
+		data = decompressed
+	}
+
+	need := map[uint32]int{
+		ColtypBit: 1, ColtypUnsignedByte: 1, ColtypShort: 2, ColtypUnsignedShort: 2,
+		ColtypLong: 4, ColtypUnsignedLong: 4, ColtypIEEESingle: 4, ColtypCurrency: 8,
+		ColtypIEEEDouble: 8, ColtypDateTime: 8, ColtypLongLong: 8, ColtypGUID: 16,
+	}[column.Type]
+	if len(data) < need {
+		return nil, fmt.Errorf("column %s holds %d bytes, want %d", column.Name, len(data), need)
+	}
+
+	switch column.Type {
+	case ColtypBit:
+		return data[0] != 0, nil
+	case ColtypUnsignedByte:
+		return int64(data[0]), nil
+	case ColtypShort:
+		return int64(int16(binary.LittleEndian.Uint16(data))), nil
+	case ColtypUnsignedShort:
+		return int64(binary.LittleEndian.Uint16(data)), nil
+	case ColtypLong:
+		return int64(int32(binary.LittleEndian.Uint32(data))), nil
+	case ColtypUnsignedLong:
+		return int64(binary.LittleEndian.Uint32(data)), nil
+	case ColtypCurrency, ColtypLongLong:
+		return int64(binary.LittleEndian.Uint64(data)), nil
+	case ColtypIEEESingle:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data))), nil
+	case ColtypIEEEDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	case ColtypDateTime:
+		return oleTime(math.Float64frombits(binary.LittleEndian.Uint64(data))), nil
+	case ColtypGUID:
+		return formatGUID(data), nil
+	case ColtypText, ColtypLongText:
+		if column.Codepage == 1200 {
+			return decodeUTF16(data), nil
+		}
+		return strings.TrimRight(string(data), "\x00"), nil
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// decompress expands a value compressed with ESE's 7-bit schemes, which
+// pack ASCII or ASCII-range UTF-16 text seven bits per character. The first
+// byte holds the scheme in its upper five bits and the number of bits used in
+// the final byte, less one, in its lower three.
+func decompress(data []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("compressed value too short")
+	}
+	scheme := data[0] >> 3
+	if scheme != 1 && scheme != 2 {
+		return nil, fmt.Errorf("compression scheme %d is not supported", scheme)
+	}
+	packed := data[1:]
+	bits := (len(packed)-1)*8 + int(data[0]&0x07) + 1
+	chars := bits / 7
+
+	out := make([]byte, 0, chars*2)
+	for i := 0; i < chars; i++ {
+		bit := i * 7
+		word := uint16(packed[bit/8])
+		if bit/8+1 < len(packed) {
+			word |= uint16(packed[bit/8+1]) << 8
+		}
+		c := byte(word>>(bit%8)) & 0x7f
+		out = append(out, c)
+		if scheme == 2 {
+			out = append(out, 0)
+		}
+	}
+	return out, nil
+}
+
+// oleTime converts an OLE automation date, in days since 1899-12-30, to UTC.
+// Zero, the unset value, stays zero.
+func oleTime(days float64) time.Time {
+	if days == 0 || math.IsNaN(days) || math.IsInf(days, 0) || math.Abs(days) > 2958465 {
+		return time.Time{}
+	}
+	return oleEpoch.Add(time.Duration(days * float64(24*time.Hour))).Round(time.Millisecond)
+}
+
+// filetime converts a FILETIME to UTC, or zero when unset.
+func filetime(ft uint64) time.Time {
+	const epochDelta = 116444736000000000 // 100ns intervals between 1601 and 1970
+	if ft < epochDelta || ft == math.MaxInt64 || ft == math.MaxUint64 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ft-epochDelta)*100).UTC()
+}
+
+// formatGUID formats a little-endian GUID as {XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}.
+func formatGUID(b []byte) string {
+	return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}",
+		binary.LittleEndian.Uint32(b[0:]), binary.LittleEndian.Uint16(b[4:]), binary.LittleEndian.Uint16(b[6:]), b[8:10], b[10:16])
+}
+
+// decodeUTF16 decodes UTF-16LE bytes, stopping at the first NUL.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
+
+// uint16Value and uint32Value read a little-endian fixed column, or zero
+// when it is null.
+func uint16Value(v rawValue) uint16 {
+	if len(v.data) < 2 {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(v.data)
+}
+
+func uint32Value(v rawValue) uint32 {
+	if len(v.data) < 4 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(v.data)
+}
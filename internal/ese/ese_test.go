@@ -0,0 +1,209 @@
+package ese
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/ese/esetest"
+)
+
+var recorded = time.Date(2024, 2, 27, 21, 0, 0, 0, time.UTC)
+
+// sampleTables has a table of every column kind, with a row that leaves a
+// fixed, a variable, and a tagged column null.
+func sampleTables() []esetest.Table {
+	return []esetest.Table{
+		{
+			Name: "Samples",
+			Columns: []esetest.Column{
+				esetest.Long("AutoIncId"),
+				esetest.DateTime("TimeStamp"),
+				esetest.Bit("Enabled"),
+				esetest.UnsignedShort("Port"),
+				esetest.LongLong("EndTime"),
+				esetest.IEEEDouble("Ratio"),
+				esetest.GUID("Interface"),
+				esetest.Text("Label"),
+				esetest.UnicodeText("Title"),
+				esetest.Binary("Hash"),
+				esetest.LongBinary("Blob"),
+				esetest.LongText("Notes"),
+			},
+			Rows: []esetest.Row{
+				{
+					"AutoIncId": 1,
+					"TimeStamp": recorded,
+					"Enabled":   true,
+					"Port":      50102,
+					"EndTime":   esetest.Filetime(recorded.Add(90 * time.Second)),
+					"Ratio":     0.25,
+					"Interface": []byte{0x78, 0x56, 0x34, 0x12, 0xbc, 0x9a, 0xf0, 0xde, 1, 2, 3, 4, 5, 6, 7, 8},
+					"Label":     "wlan",
+					"Title":     "Übersicht",
+					"Hash":      []byte{0xde, 0xad, 0xbe, 0xef},
+					"Blob":      []byte("\\Device\\HarddiskVolume3\\Users\\Public\\rclone.exe"),
+					"Notes":     "copied while open",
+				},
+				{"AutoIncId": -2, "Port": 443, "Title": "second"},
+			},
+		},
+		{Name: "Empty", Columns: []esetest.Column{esetest.Long("Id")}},
+	}
+}
+
+func openSample(t *testing.T) *DB {
+	t.Helper()
+	data := esetest.Build(sampleTables()...)
+	db, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCatalog(t *testing.T) {
+	db := openSample(t)
+	tables := db.Tables()
+	sort.Strings(tables)
+	if !reflect.DeepEqual(tables, []string{"Empty", "MSysObjects", "Samples"}) {
+		t.Fatalf("tables = %v", tables)
+	}
+
+	// Names match case-insensitively
+	table, err := db.Table("samples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Name != "Samples" || table.FDP != 5 || len(table.Columns) != 12 {
+		t.Fatalf("table = %+v", table)
+	}
+	for _, want := range []Column{
+		{ID: 1, Name: "AutoIncId", Type: ColtypLong, Size: 4},
+		{ID: 7, Name: "Interface", Type: ColtypGUID, Size: 16},
+		{ID: 129, Name: "Title", Type: ColtypText, Codepage: 1200},
+		{ID: 256, Name: "Blob", Type: ColtypLongBinary},
+	} {
+		found := false
+		for _, column := range table.Columns {
+			if column.Name == want.Name {
+				found = true
+				if column != want {
+					t.Errorf("column %s = %+v, want %+v", want.Name, column, want)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("column %s missing", want.Name)
+		}
+	}
+
+	if _, err := db.Table("SruDbIdMapTable"); !errors.Is(err, ErrNoSuchTable) {
+		t.Fatalf("missing table = %v", err)
+	}
+	if err := db.ForEachRow("SruDbIdMapTable", func(Row) error { return nil }); !errors.Is(err, ErrNoSuchTable) {
+		t.Fatalf("rows of a missing table = %v", err)
+	}
+}
+
+func TestForEachRowDecodesEveryColumnKind(t *testing.T) {
+	db := openSample(t)
+	var rows []Row
+	if err := db.ForEachRow("Samples", func(row Row) error {
+		rows = append(rows, row)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("%d rows, want 2", len(rows))
+	}
+
+	first := rows[0]
+	want := map[string]interface{}{
+		"AutoIncId": int64(1),
+		"TimeStamp": recorded,
+		"Enabled":   true,
+		"Port":      int64(50102),
+		"EndTime":   int64(esetest.Filetime(recorded.Add(90 * time.Second))),
+		"Ratio":     0.25,
+		"Interface": "{12345678-9ABC-DEF0-0102-030405060708}",
+		"Label":     "wlan",
+		"Title":     "Übersicht",
+		"Hash":      []byte{0xde, 0xad, 0xbe, 0xef},
+		"Blob":      []byte("\\Device\\HarddiskVolume3\\Users\\Public\\rclone.exe"),
+		"Notes":     "copied while open",
+	}
+	if first.Errors != nil || !reflect.DeepEqual(first.Values, want) {
+		t.Fatalf("row = %v, errors %v\nwant %v", first.Values, first.Errors, want)
+	}
+	if first.Int("autoincid") != 1 || first.Int("Enabled") != 1 || !first.Time("EndTime").Equal(recorded.Add(90*time.Second)) || !first.Time("TimeStamp").Equal(recorded) {
+		t.Fatalf("row accessors = %d, %v, %v", first.Int("autoincid"), first.Time("EndTime"), first.Time("TimeStamp"))
+	}
+	if !reflect.DeepEqual(first.IntColumns(), []string{"AutoIncId", "Enabled", "Port", "EndTime"}) {
+		t.Fatalf("integer columns = %v", first.IntColumns())
+	}
+
+	// Null columns of every kind are absent
+	second := rows[1]
+	if !reflect.DeepEqual(second.Values, map[string]interface{}{"AutoIncId": int64(-2), "Port": int64(443), "Title": "second"}) {
+		t.Fatalf("second row = %v", second.Values)
+	}
+	if second.Get("TimeStamp") != nil || !second.Time("TimeStamp").IsZero() || second.Bytes("Blob") != nil {
+		t.Fatalf("null columns of the second row = %v", second.Values)
+	}
+
+	// An empty table has no rows, and fn's error stops the scan
+	if err := db.ForEachRow("Empty", func(Row) error { t.Fatal("row in an empty table"); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	stop := errors.New("stop")
+	count := 0
+	if err := db.ForEachRow("Samples", func(Row) error { count++; return stop }); err != stop || count != 1 {
+		t.Fatalf("stopped scan = %v after %d rows", err, count)
+	}
+}
+
+func TestNewReaderRejectsDamagedDatabases(t *testing.T) {
+	valid := esetest.Build(sampleTables()...)
+	tests := []struct {
+		name   string
+		damage func(db []byte) []byte
+		want   string
+	}{
+		{"not ESE", func(db []byte) []byte { return append([]byte("SQLite format 3\x00"), db[16:]...) }, "not an ESE database"},
+		{"header cut", func(db []byte) []byte { return db[:0x80] }, "failed to read database header"},
+		{"odd page size", func(db []byte) []byte {
+			binary.LittleEndian.PutUint32(db[headerPageSizeOffset:], 3000)
+			return db
+		}, "invalid page size"},
+		{"catalog missing", func(db []byte) []byte { return db[:5*4096] }, "page 4 out of range"},
+		{"catalog tag count", func(db []byte) []byte {
+			binary.LittleEndian.PutUint16(db[5*4096+pageTagCountOffset:], 0x7fff)
+			return db
+		}, "exceeds page"},
+	}
+	for _, tt := range tests {
+		data := tt.damage(append([]byte(nil), valid...))
+		if _, err := NewReader(bytes.NewReader(data), int64(len(data))); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDecompressSevenBitText(t *testing.T) {
+	// "SRUM" packed seven bits per character: 28 bits, the last byte using 4
+	packed := []byte{1<<3 | 3, 0x53, 0x69, 0xb5, 0x09}
+	out, err := decompress(packed)
+	if err != nil || string(out) != "SRUM" {
+		t.Fatalf("decompress = %q, %v", out, err)
+	}
+	if _, err := decompress([]byte{3 << 3, 0}); err == nil || !strings.Contains(err.Error(), "scheme 3") {
+		t.Fatalf("Xpress value = %v", err)
+	}
+}
@@ -0,0 +1,422 @@
+// Package esetest builds small ESE databases for tests of the packages that
+// parse collected ones, such as SRUDB.dat. The databases it writes are well
+// formed as far as ese reads them: 4 KB pages, an MSysObjects catalog and a
+// single leaf page per table, and records holding their fixed, variable, and
+// tagged columns inline.
+package esetest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// Column types (JET_coltyp), as in ese.
+const (
+	typeBit           = 1
+	typeUnsignedByte  = 2
+	typeShort         = 3
+	typeLong          = 4
+	typeIEEEDouble    = 7
+	typeDateTime      = 8
+	typeBinary        = 9
+	typeText          = 10
+	typeLongBinary    = 11
+	typeLongText      = 12
+	typeUnsignedLong  = 14
+	typeLongLong      = 15
+	typeGUID          = 16
+	typeUnsignedShort = 17
+)
+
+// Layout of the written file.
+const (
+	pageSize       = 4096
+	pageHeaderSize = 40
+	catalogPage    = 4 // Root of MSysObjects, as in every ESE database
+	firstTablePage = 5
+	pageFlagRoot   = 0x01
+	pageFlagLeaf   = 0x02
+)
+
+// Column is a column to declare. Identifiers are given in order of
+// declaration within each of the fixed, variable, and tagged ranges.
+type Column struct {
+	Name     string
+	Type     uint32
+	Codepage uint32
+}
+
+// Row holds a record's values by column name; absent columns are null.
+// Integer columns take any Go integer, Bit a bool, DateTime a time.Time,
+// IEEEDouble a float64, text columns a string, and binary ones []byte.
+type Row map[string]interface{}
+
+// Table is a table to write with its records in key order.
+type Table struct {
+	Name    string
+	Columns []Column
+	Rows    []Row
+}
+
+// Bit, UnsignedByte, Short, UnsignedShort, Long, UnsignedLong, LongLong,
+// IEEEDouble, DateTime, and GUID return fixed columns.
+func Bit(name string) Column           { return Column{Name: name, Type: typeBit} }
+func UnsignedByte(name string) Column  { return Column{Name: name, Type: typeUnsignedByte} }
+func Short(name string) Column         { return Column{Name: name, Type: typeShort} }
+func UnsignedShort(name string) Column { return Column{Name: name, Type: typeUnsignedShort} }
+func Long(name string) Column          { return Column{Name: name, Type: typeLong} }
+func UnsignedLong(name string) Column  { return Column{Name: name, Type: typeUnsignedLong} }
+func LongLong(name string) Column      { return Column{Name: name, Type: typeLongLong} }
+func IEEEDouble(name string) Column    { return Column{Name: name, Type: typeIEEEDouble} }
+func DateTime(name string) Column      { return Column{Name: name, Type: typeDateTime} }
+func GUID(name string) Column          { return Column{Name: name, Type: typeGUID} }
+
+// Text returns a variable ASCII text column; UnicodeText a UTF-16 one.
+func Text(name string) Column        { return Column{Name: name, Type: typeText, Codepage: 1252} }
+func UnicodeText(name string) Column { return Column{Name: name, Type: typeText, Codepage: 1200} }
+
+// Binary returns a variable binary column.
+func Binary(name string) Column { return Column{Name: name, Type: typeBinary} }
+
+// LongText and LongBinary return tagged columns, as ESE uses for values
+// that may exceed 255 bytes.
+func LongText(name string) Column   { return Column{Name: name, Type: typeLongText, Codepage: 1200} }
+func LongBinary(name string) Column { return Column{Name: name, Type: typeLongBinary} }
+
+// Filetime converts a time to a Windows FILETIME, the form SRUM stores in
+// LongLong columns such as EndTime.
+func Filetime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix()+11644473600)*10000000 + uint64(t.Nanosecond()/100)
+}
+
+// Build returns a database file holding tables. It panics when a table does
+// not fit on one page or a value does not suit its column.
+func Build(tables ...Table) []byte {
+	pages := make([][]byte, firstTablePage+len(tables))
+
+	// The catalog lists MSysObjects itself, then each table and its columns
+	catalog := [][]byte{catalogRecord(2, 1, 2, catalogPage, 0, 0, "MSysObjects")}
+	for i, table := range tables {
+		objID := uint32(firstTablePage + i)
+		catalog = append(catalog, catalogRecord(objID, 1, objID, objID, 0, 0, table.Name))
+		columns := assignIDs(table.Columns)
+		for _, column := range columns {
+			catalog = append(catalog, catalogRecord(objID, 2, column.id, column.Type, uint32(fixedSize(column.Type)), column.Codepage, column.Name))
+		}
+
+		records := make([][]byte, 0, len(table.Rows))
+		for _, row := range table.Rows {
+			records = append(records, record(table.Name, columns, row))
+		}
+		pages[objID] = leafPage(table.Name, records)
+	}
+	pages[catalogPage] = leafPage("MSysObjects", catalog)
+
+	header := make([]byte, pageSize)
+	binary.LittleEndian.PutUint32(header[4:], 0x89abcdef)
+	binary.LittleEndian.PutUint32(header[8:], 0x620)   // Format version
+	binary.LittleEndian.PutUint32(header[0xe8:], 0x14) // Format revision of Windows 10
+	binary.LittleEndian.PutUint32(header[0xec:], pageSize)
+
+	// The header and its shadow copy, then page 1 onwards
+	data := append(append([]byte(nil), header...), header...)
+	for _, page := range pages[1:] {
+		if page == nil {
+			page = make([]byte, pageSize)
+		}
+		data = append(data, page...)
+	}
+	return data
+}
+
+// WriteFile writes the database built from tables to name in a temporary
+// directory and returns its path.
+func WriteFile(t *testing.T, name string, tables ...Table) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, Build(tables...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// column is a declared column with its identifier.
+type column struct {
+	Column
+	id uint32
+}
+
+// assignIDs numbers fixed columns from 1, variable ones from 128, and
+// tagged ones from 256.
+func assignIDs(columns []Column) []column {
+	next := map[int]uint32{0: 1, 1: 128, 2: 256}
+	out := make([]column, 0, len(columns))
+	for _, c := range columns {
+		kind := columnKind(c.Type)
+		out = append(out, column{Column: c, id: next[kind]})
+		next[kind]++
+	}
+	return out
+}
+
+// columnKind is 0 for fixed, 1 for variable, and 2 for tagged column types.
+func columnKind(coltyp uint32) int {
+	switch coltyp {
+	case typeText, typeBinary:
+		return 1
+	case typeLongText, typeLongBinary:
+		return 2
+	}
+	return 0
+}
+
+// fixedSize returns the stored width of a fixed column type, or zero.
+func fixedSize(coltyp uint32) int {
+	switch coltyp {
+	case typeBit, typeUnsignedByte:
+		return 1
+	case typeShort, typeUnsignedShort:
+		return 2
+	case typeLong, typeUnsignedLong:
+		return 4
+	case typeIEEEDouble, typeDateTime, typeLongLong:
+		return 8
+	case typeGUID:
+		return 16
+	}
+	return 0
+}
+
+// catalogRecord returns an MSysObjects record. Its fixed columns are
+// ObjidTable, Type, Id, ColtypOrPgnoFDP, SpaceUsage, Flags, PagesOrLocale,
+// RootFlag, and RecordOffset; Name is its first variable column.
+func catalogRecord(objTable uint32, kind uint16, id, coltypOrFDP, size, codepage uint32, name string) []byte {
+	fixed := binary.LittleEndian.AppendUint32(nil, objTable)
+	fixed = binary.LittleEndian.AppendUint16(fixed, kind)
+	fixed = binary.LittleEndian.AppendUint32(fixed, id)
+	fixed = binary.LittleEndian.AppendUint32(fixed, coltypOrFDP)
+	fixed = binary.LittleEndian.AppendUint32(fixed, size)
+	fixed = binary.LittleEndian.AppendUint32(fixed, 0)
+	fixed = binary.LittleEndian.AppendUint32(fixed, codepage)
+	fixed = append(fixed, 1)
+	fixed = binary.LittleEndian.AppendUint16(fixed, 0)
+	return packRecord(9, fixed, make([]byte, 2), [][]byte{[]byte(name)}, nil)
+}
+
+// record encodes a row of a table.
+func record(table string, columns []column, row Row) []byte {
+	for name := range row {
+		found := false
+		for _, c := range columns {
+			found = found || c.Name == name
+		}
+		if !found {
+			panic(fmt.Sprintf("esetest: table %s has no column %s", table, name))
+		}
+	}
+
+	// Fixed columns up to the last non-null one, with a null bitmap
+	lastFixed := 0
+	for _, c := range columns {
+		if _, ok := row[c.Name]; ok && columnKind(c.Type) == 0 {
+			lastFixed = int(c.id)
+		}
+	}
+	var fixed []byte
+	bitmap := make([]byte, (lastFixed+7)/8)
+	for _, c := range columns {
+		if columnKind(c.Type) != 0 || int(c.id) > lastFixed {
+			continue
+		}
+		v, ok := row[c.Name]
+		if !ok {
+			bitmap[(c.id-1)/8] |= 1 << ((c.id - 1) % 8)
+			fixed = append(fixed, make([]byte, fixedSize(c.Type))...)
+			continue
+		}
+		fixed = append(fixed, encode(table, c, v)...)
+	}
+
+	// Variable columns up to the last non-null one, null ones left empty
+	var variable [][]byte
+	for _, c := range columns {
+		if columnKind(c.Type) != 1 {
+			continue
+		}
+		if v, ok := row[c.Name]; ok {
+			for len(variable) < int(c.id)-128 {
+				variable = append(variable, nil)
+			}
+			variable = append(variable, encode(table, c, v))
+		}
+	}
+
+	tagged := make(map[uint32][]byte)
+	for _, c := range columns {
+		if v, ok := row[c.Name]; ok && columnKind(c.Type) == 2 {
+			tagged[c.id] = encode(table, c, v)
+		}
+	}
+	return packRecord(lastFixed, fixed, bitmap, variable, tagged)
+}
+
+// packRecord lays out a record: the last fixed and variable identifiers and
+// the offset of the variable data, the fixed columns and their null bitmap,
+// the variable end offsets and values, then the tagged identifier and offset
+// pairs and values. A nil variable value is null.
+func packRecord(lastFixed int, fixed, bitmap []byte, variable [][]byte, tagged map[uint32][]byte) []byte {
+	out := []byte{byte(lastFixed), byte(127 + len(variable)), 0, 0}
+	out = append(append(out, fixed...), bitmap...)
+	binary.LittleEndian.PutUint16(out[2:], uint16(len(out)))
+
+	end := 0
+	var values []byte
+	for _, v := range variable {
+		end += len(v)
+		word := uint16(end)
+		if v == nil {
+			word |= 0x8000
+		}
+		out = binary.LittleEndian.AppendUint16(out, word)
+		values = append(values, v...)
+	}
+	out = append(out, values...)
+
+	ids := make([]uint32, 0, len(tagged))
+	for id := range tagged {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	offset := 4 * len(ids)
+	values = nil
+	for _, id := range ids {
+		out = binary.LittleEndian.AppendUint16(out, uint16(id))
+		out = binary.LittleEndian.AppendUint16(out, uint16(offset))
+		offset += len(tagged[id])
+		values = append(values, tagged[id]...)
+	}
+	return append(out, values...)
+}
+
+// encode converts a value to the stored bytes of its column.
+func encode(table string, c column, v interface{}) []byte {
+	bad := func() []byte {
+		panic(fmt.Sprintf("esetest: %T value for column %s of table %s", v, c.Name, table))
+	}
+	switch c.Type {
+	case typeBit:
+		b, ok := v.(bool)
+		if !ok {
+			return bad()
+		}
+		if b {
+			return []byte{1}
+		}
+		return []byte{0}
+	case typeUnsignedByte, typeShort, typeUnsignedShort, typeLong, typeUnsignedLong, typeLongLong:
+		n, ok := integer(v)
+		if !ok {
+			return bad()
+		}
+		return binary.LittleEndian.AppendUint64(nil, n)[:fixedSize(c.Type)]
+	case typeIEEEDouble:
+		f, ok := v.(float64)
+		if !ok {
+			return bad()
+		}
+		return binary.LittleEndian.AppendUint64(nil, math.Float64bits(f))
+	case typeDateTime:
+		t, ok := v.(time.Time)
+		if !ok {
+			return bad()
+		}
+		days := float64(t.Sub(time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC))) / float64(24*time.Hour)
+		return binary.LittleEndian.AppendUint64(nil, math.Float64bits(days))
+	case typeText, typeLongText:
+		s, ok := v.(string)
+		if !ok {
+			return bad()
+		}
+		if c.Codepage != 1200 {
+			return []byte(s)
+		}
+		var out []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			out = binary.LittleEndian.AppendUint16(out, u)
+		}
+		return out
+	case typeGUID:
+		b, ok := v.([]byte)
+		if !ok || len(b) != 16 {
+			return bad()
+		}
+		return b
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return bad()
+	}
+	return b
+}
+
+// integer returns any Go integer as its two's complement bits.
+func integer(v interface{}) (uint64, bool) {
+	switch n := v.(type) {
+	case int:
+		return uint64(n), true
+	case int8:
+		return uint64(n), true
+	case int16:
+		return uint64(n), true
+	case int32:
+		return uint64(n), true
+	case int64:
+		return uint64(n), true
+	case uint:
+		return uint64(n), true
+	case uint8:
+		return uint64(n), true
+	case uint16:
+		return uint64(n), true
+	case uint32:
+		return uint64(n), true
+	case uint64:
+		return n, true
+	}
+	return 0, false
+}
+
+// leafPage lays records out on a root leaf page, each keyed by its position.
+// Tag 0, the page's own header, is empty.
+func leafPage(table string, records [][]byte) []byte {
+	page := make([]byte, pageSize)
+	binary.LittleEndian.PutUint32(page[0x24:], pageFlagRoot|pageFlagLeaf)
+	binary.LittleEndian.PutUint16(page[0x22:], uint16(len(records)+1))
+
+	offset := 0
+	for i, rec := range records {
+		entry := binary.LittleEndian.AppendUint16(nil, 4)
+		entry = binary.BigEndian.AppendUint32(entry, uint32(i+1))
+		entry = append(entry, rec...)
+		if pageHeaderSize+offset+len(entry) > pageSize-4*(len(records)+1) {
+			panic(fmt.Sprintf("esetest: table %s does not fit on one page", table))
+		}
+		copy(page[pageHeaderSize+offset:], entry)
+
+		tag := page[pageSize-4*(i+2):]
+		binary.LittleEndian.PutUint16(tag[0:], uint16(len(entry)))
+		binary.LittleEndian.PutUint16(tag[2:], uint16(offset))
+		offset += len(entry)
+	}
+	return page
+}
@@ -0,0 +1,378 @@
+// Package lnk provides a minimal reader for Windows shell link (.lnk) files,
+// decoding the target path and AppUserModelID that collection modules map
+// shortcuts by, and the target metadata the link records.
+package lnk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// Shell link header flags (MS-SHLLINK 2.1.1).
+const (
+	lnkHasTargetIDList = 1 << 0
+	lnkHasLinkInfo     = 1 << 1
+	lnkHasName         = 1 << 2
+	lnkHasRelativePath = 1 << 3
+	lnkHasWorkingDir   = 1 << 4
+	lnkHasArguments    = 1 << 5
+	lnkHasIconLocation = 1 << 6
+	lnkIsUnicode       = 1 << 7
+)
+
+// LinkInfo flags (MS-SHLLINK 2.3).
+const (
+	linkInfoVolumeIDAndLocalBasePath  = 1 << 0
+	linkInfoCommonNetworkRelativeLink = 1 << 1
+)
+
+// Drive types of a LinkInfo VolumeID.
+var driveTypes = map[uint32]string{
+	0: "unknown",
+	1: "no_root_dir",
+	2: "removable",
+	3: "fixed",
+	4: "remote",
+	5: "cdrom",
+	6: "ramdisk",
+}
+
+// Extra data block signatures.
+const (
+	lnkEnvironmentBlock   = 0xA0000001
+	lnkPropertyStoreBlock = 0xA0000009
+)
+
+// lnkHeaderSize is the fixed ShellLinkHeader size.
+const lnkHeaderSize = 0x4C
+
+// vtLPWSTR is the VARIANT type of a NUL-terminated UTF-16 string property.
+const vtLPWSTR = 0x1F
+
+// appUserModelFMTID is the System.AppUserModel property set as stored on
+// disk (GUID 9F4C2855-9F79-4B39-A8D0-E1D42DE1D5F3); property 5 is the ID.
+var appUserModelFMTID = []byte{0x55, 0x28, 0x4C, 0x9F, 0x79, 0x9F, 0x39, 0x4B, 0xA8, 0xD0, 0xE1, 0xD4, 0x2D, 0xE1, 0xD5, 0xF3}
+
+// appUserModelIDProperty is the property ID of System.AppUserModel.ID.
+const appUserModelIDProperty = 5
+
+var errLnkTruncated = errors.New("shortcut is truncated")
+
+// Shortcut holds the fields of a .lnk file that modules correlate shortcuts by.
+type Shortcut struct {
+	TargetPath     string // Local base path from LinkInfo, else the environment-variable target
+	NetworkPath    string // UNC path from LinkInfo, for a target on a share
+	AppUserModelID string // Explicit System.AppUserModel.ID, if the shortcut sets one
+
+	// StringData fields, empty when the link does not set them
+	Description      string
+	RelativePath     string
+	WorkingDirectory string
+	Arguments        string
+	IconLocation     string
+
+	// The target's times and size when the link was last resolved; the
+	// times are zero when unset
+	TargetCreated  time.Time
+	TargetAccessed time.Time
+	TargetModified time.Time
+	TargetSize     uint32
+
+	Volume *Volume // From LinkInfo, for a target on a local volume
+}
+
+// Volume describes the volume a link's target was on.
+type Volume struct {
+	DriveType    string
+	SerialNumber uint32
+	Label        string
+}
+
+// Target returns the local target path, or the UNC path of a target on a
+// share.
+func (s *Shortcut) Target() string {
+	if s.TargetPath != "" {
+		return s.TargetPath
+	}
+	return s.NetworkPath
+}
+
+// Parse decodes a shell link (.lnk) file.
+func Parse(data []byte) (*Shortcut, error) {
+	if len(data) < lnkHeaderSize || binary.LittleEndian.Uint32(data) != lnkHeaderSize {
+		return nil, errors.New("not a shell link file")
+	}
+	flags := binary.LittleEndian.Uint32(data[0x14:])
+	pos := lnkHeaderSize
+	shortcut := &Shortcut{
+		TargetCreated:  winutil.FiletimeToUTC(binary.LittleEndian.Uint64(data[0x1C:])),
+		TargetAccessed: winutil.FiletimeToUTC(binary.LittleEndian.Uint64(data[0x24:])),
+		TargetModified: winutil.FiletimeToUTC(binary.LittleEndian.Uint64(data[0x2C:])),
+		TargetSize:     binary.LittleEndian.Uint32(data[0x34:]),
+	}
+
+	if flags&lnkHasTargetIDList != 0 {
+		if pos+2 > len(data) {
+			return nil, errLnkTruncated
+		}
+		pos += 2 + int(binary.LittleEndian.Uint16(data[pos:]))
+		if pos > len(data) {
+			return nil, errLnkTruncated
+		}
+	}
+
+	if flags&lnkHasLinkInfo != 0 {
+		if pos+4 > len(data) {
+			return nil, errLnkTruncated
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		if size < 4 || pos+size > len(data) {
+			return nil, errLnkTruncated
+		}
+		info := data[pos : pos+size]
+		shortcut.TargetPath = linkInfoBasePath(info)
+		shortcut.NetworkPath = linkInfoNetworkPath(info)
+		shortcut.Volume = linkInfoVolume(info)
+		pos += size
+	}
+
+	// StringData fields appear in flag order
+	stringData := []struct {
+		flag  uint32
+		field *string
+	}{
+		{lnkHasName, &shortcut.Description},
+		{lnkHasRelativePath, &shortcut.RelativePath},
+		{lnkHasWorkingDir, &shortcut.WorkingDirectory},
+		{lnkHasArguments, &shortcut.Arguments},
+		{lnkHasIconLocation, &shortcut.IconLocation},
+	}
+	for _, sd := range stringData {
+		if flags&sd.flag == 0 {
+			continue
+		}
+		if pos+2 > len(data) {
+			return nil, errLnkTruncated
+		}
+		count := int(binary.LittleEndian.Uint16(data[pos:]))
+		pos += 2
+		size := count
+		if flags&lnkIsUnicode != 0 {
+			size *= 2
+		}
+		if pos+size > len(data) {
+			return nil, errLnkTruncated
+		}
+		// Counted, not NUL-terminated
+		if flags&lnkIsUnicode != 0 {
+			*sd.field = decodeUTF16(data[pos : pos+size])
+		} else {
+			*sd.field = cString(data[pos : pos+size])
+		}
+		pos += size
+	}
+
+	// ExtraData blocks run until a terminal block smaller than four bytes
+	for pos+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		if size < 8 || pos+size > len(data) {
+			break
+		}
+		block := data[pos : pos+size]
+		switch binary.LittleEndian.Uint32(block[4:]) {
+		case lnkEnvironmentBlock:
+			if shortcut.TargetPath == "" && len(block) >= 788 {
+				shortcut.TargetPath = decodeUTF16(block[268:788])
+				if shortcut.TargetPath == "" {
+					shortcut.TargetPath = cString(block[8:268])
+				}
+			}
+		case lnkPropertyStoreBlock:
+			if id := propertyStoreAUMID(block[8:]); id != "" {
+				shortcut.AppUserModelID = id
+			}
+		}
+		pos += size
+	}
+
+	return shortcut, nil
+}
+
+// linkInfoBasePath returns the local path a LinkInfo structure points to.
+func linkInfoBasePath(info []byte) string {
+	if len(info) < 0x1C || binary.LittleEndian.Uint32(info[8:])&1 == 0 {
+		return ""
+	}
+	headerSize := binary.LittleEndian.Uint32(info[4:])
+
+	var base, suffix string
+	if headerSize >= 0x24 && len(info) >= 0x24 {
+		base = utf16At(info, int(binary.LittleEndian.Uint32(info[0x1C:])))
+		suffix = utf16At(info, int(binary.LittleEndian.Uint32(info[0x20:])))
+	}
+	if base == "" {
+		base = cStringAt(info, int(binary.LittleEndian.Uint32(info[0x10:])))
+		suffix = cStringAt(info, int(binary.LittleEndian.Uint32(info[0x18:])))
+	}
+	return base + suffix
+}
+
+// linkInfoNetworkPath returns the UNC path of a LinkInfo structure whose
+// target is on a share: the share name joined with the common path suffix.
+func linkInfoNetworkPath(info []byte) string {
+	if len(info) < 0x1C || binary.LittleEndian.Uint32(info[8:])&linkInfoCommonNetworkRelativeLink == 0 {
+		return ""
+	}
+	headerSize := binary.LittleEndian.Uint32(info[4:])
+	offset := int(binary.LittleEndian.Uint32(info[0x14:]))
+	if offset <= 0 || offset+0x14 > len(info) {
+		return ""
+	}
+	link := info[offset:]
+	size := int(binary.LittleEndian.Uint32(link))
+	if size < 0x14 || size > len(link) {
+		return ""
+	}
+	link = link[:size]
+
+	// NetName is ANSI, with a Unicode copy when the structure is long enough
+	netNameOffset := int(binary.LittleEndian.Uint32(link[8:]))
+	var share string
+	if netNameOffset > 0x14 && size >= 0x1C {
+		share = utf16At(link, int(binary.LittleEndian.Uint32(link[0x14:])))
+	}
+	if share == "" {
+		share = cStringAt(link, netNameOffset)
+	}
+	if share == "" {
+		return ""
+	}
+
+	var suffix string
+	if headerSize >= 0x24 && len(info) >= 0x24 {
+		suffix = utf16At(info, int(binary.LittleEndian.Uint32(info[0x20:])))
+	}
+	if suffix == "" {
+		suffix = cStringAt(info, int(binary.LittleEndian.Uint32(info[0x18:])))
+	}
+	if suffix == "" {
+		return share
+	}
+	return share + `\` + suffix
+}
+
+// linkInfoVolume returns the VolumeID of a LinkInfo structure with a local
+// target.
+func linkInfoVolume(info []byte) *Volume {
+	if len(info) < 0x1C || binary.LittleEndian.Uint32(info[8:])&linkInfoVolumeIDAndLocalBasePath == 0 {
+		return nil
+	}
+	offset := int(binary.LittleEndian.Uint32(info[0x0C:]))
+	if offset <= 0 || offset+0x10 > len(info) {
+		return nil
+	}
+	id := info[offset:]
+	size := int(binary.LittleEndian.Uint32(id))
+	if size < 0x10 || size > len(id) {
+		return nil
+	}
+	id = id[:size]
+
+	driveType, ok := driveTypes[binary.LittleEndian.Uint32(id[4:])]
+	if !ok {
+		driveType = driveTypes[0]
+	}
+	volume := &Volume{
+		DriveType:    driveType,
+		SerialNumber: binary.LittleEndian.Uint32(id[8:]),
+	}
+	// A label offset of 0x14 means the label is Unicode, at the offset that follows
+	labelOffset := int(binary.LittleEndian.Uint32(id[0x0C:]))
+	if labelOffset == 0x14 && size >= 0x14 {
+		volume.Label = utf16At(id, int(binary.LittleEndian.Uint32(id[0x10:])))
+	} else {
+		volume.Label = cStringAt(id, labelOffset)
+	}
+	return volume
+}
+
+// propertyStoreAUMID finds System.AppUserModel.ID in a serialized property store.
+func propertyStoreAUMID(store []byte) string {
+	pos := 0
+	for pos+24 <= len(store) {
+		size := int(binary.LittleEndian.Uint32(store[pos:]))
+		if size == 0 || pos+size > len(store) || size < 24 {
+			return ""
+		}
+		storage := store[pos : pos+size]
+		if bytes.Equal(storage[8:24], appUserModelFMTID) {
+			return storageStringValue(storage[24:], appUserModelIDProperty)
+		}
+		pos += size
+	}
+	return ""
+}
+
+// storageStringValue returns an integer-named VT_LPWSTR property from a
+// serialized property storage's value list.
+func storageStringValue(values []byte, id uint32) string {
+	pos := 0
+	for pos+4 <= len(values) {
+		size := int(binary.LittleEndian.Uint32(values[pos:]))
+		if size == 0 || pos+size > len(values) {
+			return ""
+		}
+		// ValueSize, ID, reserved byte, then the typed value
+		value := values[pos : pos+size]
+		if size >= 17 && binary.LittleEndian.Uint32(value[4:]) == id && binary.LittleEndian.Uint16(value[9:]) == vtLPWSTR {
+			count := int(binary.LittleEndian.Uint32(value[13:]))
+			if 17+count*2 <= len(value) {
+				return decodeUTF16(value[17 : 17+count*2])
+			}
+		}
+		pos += size
+	}
+	return ""
+}
+
+// decodeUTF16 decodes little-endian UTF-16 up to the first NUL.
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+// utf16At decodes a NUL-terminated UTF-16 string at offset.
+func utf16At(b []byte, offset int) string {
+	if offset <= 0 || offset >= len(b) {
+		return ""
+	}
+	return decodeUTF16(b[offset:])
+}
+
+// cString returns b up to the first NUL.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// cStringAt returns the NUL-terminated string at offset.
+func cStringAt(b []byte, offset int) string {
+	if offset <= 0 || offset >= len(b) {
+		return ""
+	}
+	return cString(b[offset:])
+}
@@ -0,0 +1,232 @@
+package lnk
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+var (
+	fixtureCreated  = time.Date(2024, 2, 10, 14, 0, 0, 0, time.UTC)
+	fixtureAccessed = time.Date(2024, 3, 1, 9, 15, 0, 0, time.UTC)
+	fixtureModified = time.Date(2024, 2, 28, 17, 45, 30, 0, time.UTC)
+)
+
+func utf16z(s string) []byte {
+	units := append(utf16.Encode([]rune(s)), 0)
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+func cz(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func le32(b []byte, offset int, v int) {
+	binary.LittleEndian.PutUint32(b[offset:], uint32(v))
+}
+
+func filetimeOf(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100 + 116444736000000000)
+}
+
+// shellLink assembles a Unicode shell link: the header, an optional
+// LinkTargetIDList, an optional LinkInfo, StringData, and the terminal block.
+func shellLink(flags uint32, idList, linkInfo []byte, stringData ...string) []byte {
+	flags |= lnkIsUnicode
+	if idList != nil {
+		flags |= lnkHasTargetIDList
+	}
+	if linkInfo != nil {
+		flags |= lnkHasLinkInfo
+	}
+	data := make([]byte, lnkHeaderSize)
+	le32(data, 0, lnkHeaderSize)
+	le32(data, 0x14, int(flags))
+	binary.LittleEndian.PutUint64(data[0x1C:], filetimeOf(fixtureCreated))
+	binary.LittleEndian.PutUint64(data[0x24:], filetimeOf(fixtureAccessed))
+	binary.LittleEndian.PutUint64(data[0x2C:], filetimeOf(fixtureModified))
+	le32(data, 0x34, 48213)
+	if idList != nil {
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(idList)))
+		data = append(data, idList...)
+	}
+	data = append(data, linkInfo...)
+	for _, s := range stringData {
+		units := utf16.Encode([]rune(s))
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(units)))
+		for _, u := range units {
+			data = binary.LittleEndian.AppendUint16(data, u)
+		}
+	}
+	return append(data, 0, 0, 0, 0)
+}
+
+// volumeID builds a LinkInfo VolumeID; a Unicode label follows the
+// 0x14-byte header, as Windows writes labels outside the ANSI code page.
+func volumeID(driveType, serial int, label string, unicode bool) []byte {
+	if unicode {
+		id := make([]byte, 0x14)
+		le32(id, 0x0C, 0x14)
+		le32(id, 0x10, 0x14)
+		id = append(id, utf16z(label)...)
+		le32(id, 0, len(id))
+		le32(id, 4, driveType)
+		le32(id, 8, serial)
+		return id
+	}
+	id := make([]byte, 0x10)
+	le32(id, 0x0C, 0x10)
+	id = append(id, cz(label)...)
+	le32(id, 0, len(id))
+	le32(id, 4, driveType)
+	le32(id, 8, serial)
+	return id
+}
+
+// localLinkInfo builds a LinkInfo for a target on a local volume. With
+// unicode set it also carries the Unicode base path, and the ANSI copy holds
+// the "?" Windows substitutes for characters outside the code page.
+func localLinkInfo(volume []byte, basePath string, unicode bool) []byte {
+	headerSize, ansiPath := 0x1C, basePath
+	if unicode {
+		headerSize, ansiPath = 0x24, "?"
+	}
+	info := make([]byte, headerSize)
+	le32(info, 4, headerSize)
+	le32(info, 8, linkInfoVolumeIDAndLocalBasePath)
+	le32(info, 0x0C, len(info))
+	info = append(info, volume...)
+	le32(info, 0x10, len(info))
+	info = append(info, cz(ansiPath)...)
+	le32(info, 0x18, len(info))
+	info = append(info, 0)
+	if unicode {
+		le32(info, 0x1C, len(info))
+		info = append(info, utf16z(basePath)...)
+		le32(info, 0x20, len(info))
+		info = append(info, 0, 0)
+	}
+	le32(info, 0, len(info))
+	return info
+}
+
+// networkLinkInfo builds a LinkInfo for a target on a share.
+func networkLinkInfo(share, suffix string) []byte {
+	info := make([]byte, 0x1C)
+	le32(info, 4, 0x1C)
+	le32(info, 8, linkInfoCommonNetworkRelativeLink)
+	le32(info, 0x14, len(info))
+	link := make([]byte, 0x14)
+	le32(link, 8, 0x14)
+	link = append(link, cz(share)...)
+	le32(link, 0, len(link))
+	info = append(info, link...)
+	le32(info, 0x18, len(info))
+	info = append(info, cz(suffix)...)
+	le32(info, 0, len(info))
+	return info
+}
+
+func checkTimes(t *testing.T, s *Shortcut) {
+	t.Helper()
+	if !s.TargetCreated.Equal(fixtureCreated) || !s.TargetAccessed.Equal(fixtureAccessed) || !s.TargetModified.Equal(fixtureModified) || s.TargetSize != 48213 {
+		t.Fatalf("target times = %v, %v, %v, size %d", s.TargetCreated, s.TargetAccessed, s.TargetModified, s.TargetSize)
+	}
+}
+
+func TestParseLocalTarget(t *testing.T) {
+	info := localLinkInfo(volumeID(3, 0x5A1B2C3D, "OS", false), `C:\Users\alice\Documents\report.docx`, false)
+	idList := make([]byte, 20) // Skipped, not decoded
+	data := shellLink(lnkHasWorkingDir|lnkHasArguments, idList, info, `C:\Users\alice\Documents`, `/safe "report.docx"`)
+
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Target() != `C:\Users\alice\Documents\report.docx` || s.NetworkPath != "" {
+		t.Fatalf("target = %q, network path %q", s.TargetPath, s.NetworkPath)
+	}
+	if s.WorkingDirectory != `C:\Users\alice\Documents` || s.Arguments != `/safe "report.docx"` {
+		t.Fatalf("working directory %q, arguments %q", s.WorkingDirectory, s.Arguments)
+	}
+	if s.Volume == nil || *s.Volume != (Volume{DriveType: "fixed", SerialNumber: 0x5A1B2C3D, Label: "OS"}) {
+		t.Fatalf("volume = %+v", s.Volume)
+	}
+	checkTimes(t, s)
+}
+
+func TestParseUNCTarget(t *testing.T) {
+	data := shellLink(lnkHasName, nil, networkLinkInfo(`\\fileserver\finance`, `2024\q3-forecast.xlsx`), "Q3 forecast")
+
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `\\fileserver\finance\2024\q3-forecast.xlsx`; s.NetworkPath != want || s.Target() != want {
+		t.Fatalf("network path = %q, target %q; want %q", s.NetworkPath, s.Target(), want)
+	}
+	if s.TargetPath != "" || s.Volume != nil {
+		t.Fatalf("share target reported a local path %q or volume %+v", s.TargetPath, s.Volume)
+	}
+	if s.Description != "Q3 forecast" {
+		t.Fatalf("description = %q", s.Description)
+	}
+	checkTimes(t, s)
+}
+
+func TestParseUnicodeLabelAndPath(t *testing.T) {
+	info := localLinkInfo(volumeID(2, 0x0BADF00D, "Données 資料", true), `E:\Überweisungen\報告.pdf`, true)
+	data := shellLink(0, nil, info)
+
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TargetPath != `E:\Überweisungen\報告.pdf` {
+		t.Fatalf("target = %q", s.TargetPath)
+	}
+	if s.Volume == nil || s.Volume.Label != "Données 資料" || s.Volume.DriveType != "removable" || s.Volume.SerialNumber != 0x0BADF00D {
+		t.Fatalf("volume = %+v", s.Volume)
+	}
+}
+
+func TestParseRejectsTruncatedLinks(t *testing.T) {
+	info := localLinkInfo(volumeID(3, 1, "OS", false), `C:\Windows\notepad.exe`, false)
+	data := shellLink(lnkHasArguments, make([]byte, 20), info, `C:\secret.txt`)
+	idListEnd := lnkHeaderSize + 2 + 20
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, nil},
+		{"short header", data[:lnkHeaderSize-1], nil},
+		{"before the ID list size", data[:lnkHeaderSize+1], errLnkTruncated},
+		{"inside the ID list", shellLink(0, make([]byte, 20), nil)[:lnkHeaderSize+10], errLnkTruncated},
+		{"inside the link info", data[:idListEnd+len(info)-1], errLnkTruncated},
+		{"inside the arguments", data[:len(data)-8], errLnkTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.data)
+			if err == nil {
+				t.Fatalf("Parse accepted a truncated link: %+v", s)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Parse = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// A missing terminal block only ends the extra data early
+	if _, err := Parse(data[:len(data)-4]); err != nil {
+		t.Fatalf("link without a terminal block: %v", err)
+	}
+}
@@ -7,7 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // SysInfo represents the system information module.
@@ -23,6 +24,16 @@ func (s *SysInfo) Name() string {
 	return "sysinfo"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (s *SysInfo) Describe() string {
+	return "System information"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (s *SysInfo) RequiresLiveSystem() bool {
+	return true
+}
+
 // SystemInfo represents the structure of collected system information.
 type SystemInfo struct {
 	OS            string `json:"os"`
@@ -36,23 +47,23 @@ type SystemInfo struct {
 // Collect gathers system information and writes it to a JSON file in the output directory.
 func (s *SysInfo) Collect(ctx context.Context, outDir string) error {
 	// Get hostname
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Get current time
-	now := time.Now().UTC()
+	now := winutil.Now(ctx).UTC()
 
 	// Get uptime information (OS-specific implementation)
-	uptimeSeconds, bootTime := getUptime()
+	uptimeSeconds, bootTime := getUptime(now)
 
 	// Create system info structure
 	sysInfo := SystemInfo{
 		OS:            runtime.GOOS,
 		Arch:          runtime.GOARCH,
 		Hostname:      hostname,
-		TimeUTC:       now.Format(time.RFC3339),
+		TimeUTC:       winutil.FormatTime(now),
 		UptimeSeconds: uptimeSeconds,
 		BootTimeUTC:   bootTime,
 	}
@@ -7,11 +7,13 @@ import (
 	"unsafe"
 
 	"golang.org/x/sys/unix"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // getUptime returns the system uptime in seconds and boot time for macOS systems.
 // It uses sysctl to get the kern.boottime.
-func getUptime() (uptimeSeconds int64, bootTimeUTC string) {
+func getUptime(now time.Time) (uptimeSeconds int64, bootTimeUTC string) {
 	// Get boot time using sysctl kern.boottime
 	tv, err := unix.SysctlTimeval("kern.boottime")
 	if err != nil {
@@ -22,17 +24,16 @@ func getUptime() (uptimeSeconds int64, bootTimeUTC string) {
 	bootTime := time.Unix(tv.Sec, tv.Usec*1000).UTC()
 	
 	// Calculate uptime
-	now := time.Now().UTC()
 	uptime := now.Sub(bootTime)
 	uptimeSeconds = int64(uptime.Seconds())
 	
-	bootTimeUTC = bootTime.Format(time.RFC3339)
+	bootTimeUTC = winutil.FormatTime(bootTime)
 
 	return uptimeSeconds, bootTimeUTC
 }
 
 // Alternative implementation using raw sysctl if the above doesn't work
-func getUptimeAlternative() (uptimeSeconds int64, bootTimeUTC string) {
+func getUptimeAlternative(now time.Time) (uptimeSeconds int64, bootTimeUTC string) {
 	// This implementation uses the raw sysctl syscall
 	mib := []int32{1, 21} // CTL_KERN, KERN_BOOTTIME
 	
@@ -54,10 +55,9 @@ func getUptimeAlternative() (uptimeSeconds int64, bootTimeUTC string) {
 	}
 	
 	bootTime := time.Unix(tv.Sec, tv.Usec*1000).UTC()
-	now := time.Now().UTC()
 	uptime := now.Sub(bootTime)
 	uptimeSeconds = int64(uptime.Seconds())
-	bootTimeUTC = bootTime.Format(time.RFC3339)
+	bootTimeUTC = winutil.FormatTime(bootTime)
 
 	return uptimeSeconds, bootTimeUTC
 }
\ No newline at end of file
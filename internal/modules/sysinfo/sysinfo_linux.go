@@ -7,11 +7,14 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // getUptime returns the system uptime in seconds and boot time for Linux systems.
-// It reads from /proc/uptime which contains uptime and idle time as floating point seconds.
-func getUptime() (uptimeSeconds int64, bootTimeUTC string) {
+// It reads from /proc/uptime which contains uptime and idle time as floating point seconds,
+// and dates the boot back from now.
+func getUptime(now time.Time) (uptimeSeconds int64, bootTimeUTC string) {
 	// Read /proc/uptime
 	data, err := os.ReadFile("/proc/uptime")
 	if err != nil {
@@ -32,9 +35,8 @@ func getUptime() (uptimeSeconds int64, bootTimeUTC string) {
 	uptimeSeconds = int64(uptime)
 	
 	// Calculate boot time
-	now := time.Now().UTC()
-	bootTime := now.Add(-time.Duration(uptimeSeconds) * time.Second)
-	bootTimeUTC = bootTime.Format(time.RFC3339)
+	bootTime := now.UTC().Add(-time.Duration(uptimeSeconds) * time.Second)
+	bootTimeUTC = winutil.FormatTime(bootTime)
 
 	return uptimeSeconds, bootTimeUTC
 }
\ No newline at end of file
@@ -2,8 +2,10 @@
 
 package sysinfo
 
+import "time"
+
 // getUptime returns zero values for unsupported operating systems.
 // This provides a safe fallback that won't cause the module to fail.
-func getUptime() (uptimeSeconds int64, bootTimeUTC string) {
+func getUptime(now time.Time) (uptimeSeconds int64, bootTimeUTC string) {
 	return 0, ""
 }
\ No newline at end of file
@@ -0,0 +1,64 @@
+package sysinfo
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/core"
+	"cryptkeeper/internal/winutil"
+)
+
+// frozenClock reports the same instant on every call.
+type frozenClock time.Time
+
+func (c frozenClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestCollectUnderAFrozenClock(t *testing.T) {
+	frozen := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+
+	collect := func() ([]core.Result, SystemInfo) {
+		artifactsDir := t.TempDir()
+		run := core.NewRun(1, time.Minute, artifactsDir, frozenClock(frozen), log.New(io.Discard, "", 0))
+		run.SetEnv(core.NamedEnv{Env: core.SystemEnv{}, Name: "WS-0142"})
+		run.Register(NewSysInfo())
+		results, err := run.CollectAll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(artifactsDir, "sysinfo", "sysinfo.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var info SystemInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			t.Fatal(err)
+		}
+		return results, info
+	}
+
+	first, info := collect()
+	if len(first) != 1 || !first[0].OK || !first[0].StartedAt.Equal(frozen) || !first[0].EndedAt.Equal(frozen) {
+		t.Fatalf("results = %+v", first)
+	}
+	if info.TimeUTC != "2024-03-01T11:00:00Z" || info.Hostname != "WS-0142" || info.OS != runtime.GOOS {
+		t.Fatalf("sysinfo = %+v", info)
+	}
+	// The boot time is derived from the run's clock, not the system's
+	if info.BootTimeUTC != "" && info.BootTimeUTC != winutil.FormatTime(frozen.Add(-time.Duration(info.UptimeSeconds)*time.Second)) {
+		t.Errorf("boot time %s does not follow the frozen clock", info.BootTimeUTC)
+	}
+
+	second, again := collect()
+	if first[0] != second[0] || again.TimeUTC != info.TimeUTC || again.Hostname != info.Hostname {
+		t.Fatalf("second run = %+v, %+v", second, again)
+	}
+}
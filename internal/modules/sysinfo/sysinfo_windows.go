@@ -5,11 +5,13 @@ package sysinfo
 import (
 	"syscall"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // getUptime returns the system uptime in seconds and boot time for Windows systems.
-// It uses GetTickCount64 to get the uptime in milliseconds.
-func getUptime() (uptimeSeconds int64, bootTimeUTC string) {
+// It uses GetTickCount64 to get the uptime in milliseconds, and dates the boot back from now.
+func getUptime(now time.Time) (uptimeSeconds int64, bootTimeUTC string) {
 	// Load kernel32.dll
 	kernel32 := syscall.MustLoadDLL("kernel32.dll")
 	defer kernel32.Release()
@@ -25,15 +27,14 @@ func getUptime() (uptimeSeconds int64, bootTimeUTC string) {
 	uptimeSeconds = uptimeMs / 1000
 
 	// Calculate boot time
-	now := time.Now().UTC()
-	bootTime := now.Add(-time.Duration(uptimeMs) * time.Millisecond)
-	bootTimeUTC = bootTime.Format(time.RFC3339)
+	bootTime := now.UTC().Add(-time.Duration(uptimeMs) * time.Millisecond)
+	bootTimeUTC = winutil.FormatTime(bootTime)
 
 	return uptimeSeconds, bootTimeUTC
 }
 
 // Alternative implementation using syscall if the above doesn't work
-func getUptimeAlternative() (uptimeSeconds int64, bootTimeUTC string) {
+func getUptimeAlternative(now time.Time) (uptimeSeconds int64, bootTimeUTC string) {
 	// This is a fallback using direct syscall
 	kernel32, err := syscall.LoadLibrary("kernel32.dll")
 	if err != nil {
@@ -50,9 +51,8 @@ func getUptimeAlternative() (uptimeSeconds int64, bootTimeUTC string) {
 	uptimeMs := int64(ret)
 	uptimeSeconds = uptimeMs / 1000
 
-	now := time.Now().UTC()
-	bootTime := now.Add(-time.Duration(uptimeMs) * time.Millisecond)
-	bootTimeUTC = bootTime.Format(time.RFC3339)
+	bootTime := now.UTC().Add(-time.Duration(uptimeMs) * time.Millisecond)
+	bootTimeUTC = winutil.FormatTime(bootTime)
 
 	return uptimeSeconds, bootTimeUTC
 }
\ No newline at end of file
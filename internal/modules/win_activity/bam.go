@@ -0,0 +1,276 @@
+package win_activity
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// registryHiveCopy is where the windows/registry module leaves its copy of
+// the SYSTEM hive, relative to the artifacts directory.
+var registryHiveCopy = filepath.Join("windows_registry", "windows", "registry", "SYSTEM.hiv")
+
+// bamSettingsPaths are the per-user settings keys relative to a control set.
+// Windows 10 1809 and later use State\UserSettings; 1709 through 1803 kept
+// UserSettings directly under the service key.
+var bamSettingsPaths = []struct {
+	source string
+	path   string
+}{
+	{"bam", `Services\bam\State\UserSettings`},
+	{"bam", `Services\bam\UserSettings`},
+	{"dam", `Services\dam\State\UserSettings`},
+	{"dam", `Services\dam\UserSettings`},
+}
+
+// bamMetadataValues are bookkeeping values stored alongside execution entries.
+var bamMetadataValues = map[string]bool{
+	"version":        true,
+	"sequencenumber": true,
+}
+
+// BAMEntry is a program's last execution time recorded by BAM or DAM.
+type BAMEntry struct {
+	Path         string `json:"path"`                    // As recorded, e.g. \Device\HarddiskVolume3\Windows\System32\cmd.exe
+	ResolvedPath string `json:"resolved_path,omitempty"` // With the volume device mapped to its drive letter
+	LastRun      string `json:"last_run"`                // RFC3339 UTC
+	LastRunRaw   uint64 `json:"last_run_filetime"`       // FILETIME as stored
+	Source       string `json:"source"`                  // "bam" or "dam"
+}
+
+// BAMUser groups the entries recorded for one user SID.
+type BAMUser struct {
+	SID            string     `json:"sid"`
+	KeyLastWritten string     `json:"key_last_written,omitempty"`
+	Entries        []BAMEntry `json:"entries"`
+}
+
+// BAMReport is the structure written to bam.json.
+type BAMReport struct {
+	CollectedUTC string    `json:"collected_utc"`
+	HiveSource   string    `json:"hive_source"` // "registry_module", "copy", or "reg_save"
+	HiveDirty    bool      `json:"hive_dirty"`  // Pending transaction log changes were not applied
+	ControlSet   string    `json:"control_set"`
+	Users        []BAMUser `json:"users"`
+	Errors       []string  `json:"errors,omitempty"`
+}
+
+// EntryCount returns the number of entries across all users.
+func (r *BAMReport) EntryCount() int {
+	count := 0
+	for _, user := range r.Users {
+		count += len(user.Entries)
+	}
+	return count
+}
+
+// ParseBAM reads BAM and DAM entries from the current control set of a
+// SYSTEM hive. volumes maps lowercased \Device\HarddiskVolumeN prefixes to
+// drive letters and may be nil when the mapping is unknown.
+func ParseBAM(hive *regf.Hive, volumes map[string]string) (*BAMReport, error) {
+	report := &BAMReport{HiveDirty: hive.Dirty()}
+
+	controlSet, err := CurrentControlSet(hive)
+	if err != nil {
+		return nil, err
+	}
+	report.ControlSet = controlSet
+
+	report.Users, report.Errors = parseBAMUsers(hive, controlSet, volumes)
+
+	return report, nil
+}
+
+// parseBAMUsers reads the BAM and DAM entries of one control set, grouped by
+// user SID and sorted by SID, with each user's most recent execution first.
+func parseBAMUsers(hive *regf.Hive, controlSet string, volumes map[string]string) ([]BAMUser, []string) {
+	var errs []string
+	bySID := make(map[string]*BAMUser)
+	for _, settings := range bamSettingsPaths {
+		key, err := hive.OpenKey(controlSet + `\` + settings.path)
+		if errors.Is(err, regf.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", settings.path, err))
+			continue
+		}
+
+		sids, err := key.Subkeys()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", settings.path, err))
+			continue
+		}
+		for _, sidKey := range sids {
+			values, err := sidKey.Values()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s\\%s: %v", settings.path, sidKey.Name, err))
+				continue
+			}
+
+			user, ok := bySID[sidKey.Name]
+			if !ok {
+				user = &BAMUser{SID: sidKey.Name, Entries: make([]BAMEntry, 0)}
+				bySID[sidKey.Name] = user
+			}
+			if written := formatTime(sidKey); written > user.KeyLastWritten {
+				user.KeyLastWritten = written
+			}
+
+			for _, value := range values {
+				if bamMetadataValues[strings.ToLower(value.Name)] || value.Type != regf.TypeBinary || len(value.Data) < 8 {
+					continue
+				}
+				raw := binary.LittleEndian.Uint64(value.Data[:8])
+				lastRun := winutil.FiletimeToUTC(raw)
+				if lastRun.IsZero() {
+					continue
+				}
+				user.Entries = append(user.Entries, BAMEntry{
+					Path:         value.Name,
+					ResolvedPath: ResolveDevicePath(value.Name, volumes),
+					LastRun:      winutil.FormatTime(lastRun),
+					LastRunRaw:   raw,
+					Source:       settings.source,
+				})
+			}
+		}
+	}
+
+	users := make([]BAMUser, 0, len(bySID))
+	for _, user := range bySID {
+		// Most recent execution first
+		sort.SliceStable(user.Entries, func(i, j int) bool { return user.Entries[i].LastRun > user.Entries[j].LastRun })
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].SID < users[j].SID })
+
+	return users, errs
+}
+
+// CurrentControlSet returns the ControlSet00N key name that Select\Current
+// points at; a hive file has no CurrentControlSet link.
+func CurrentControlSet(hive *regf.Hive) (string, error) {
+	selectKey, err := hive.OpenKey("Select")
+	if err != nil {
+		return "", fmt.Errorf("failed to open Select key: %w", err)
+	}
+	value, err := selectKey.Value("Current")
+	if err != nil {
+		return "", fmt.Errorf("failed to read Select\\Current: %w", err)
+	}
+	current, ok := value.Uint64()
+	if !ok || current == 0 {
+		return "", fmt.Errorf("invalid Select\\Current value")
+	}
+	return fmt.Sprintf("ControlSet%03d", current), nil
+}
+
+// ResolveDevicePath replaces a \Device\HarddiskVolumeN prefix with its drive
+// letter. It returns "" when the path has no device prefix or it is unmapped.
+func ResolveDevicePath(path string, volumes map[string]string) string {
+	lower := strings.ToLower(path)
+	if !strings.HasPrefix(lower, `\device\`) {
+		return ""
+	}
+	rest := lower[len(`\device\`):]
+	end := strings.IndexByte(rest, '\\')
+	if end < 0 {
+		return ""
+	}
+	device := lower[:len(`\device\`)+end]
+	drive, ok := volumes[device]
+	if !ok {
+		return ""
+	}
+	return drive + path[len(device):]
+}
+
+// formatTime formats a key's last write time as RFC3339, or "" when unset.
+func formatTime(key *regf.Key) string {
+	if key.LastWritten.IsZero() {
+		return ""
+	}
+	return winutil.FormatTime(key.LastWritten)
+}
+
+// WriteBAMReport parses the SYSTEM hive at hivePath and writes bam.json to
+// outDir, replacing any bam.json already listed in the manifest.
+func WriteBAMReport(ctx context.Context, hivePath, hiveSource string, volumes map[string]string, outDir string, manifest *ActivityManifest) error {
+	hive, err := regf.Open(hivePath)
+	if err != nil {
+		return err
+	}
+	defer hive.Close()
+
+	report, err := ParseBAM(hive, volumes)
+	if err != nil {
+		return err
+	}
+	report.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+	report.HiveSource = hiveSource
+
+	outputPath := filepath.Join(outDir, "bam.json")
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal BAM entries: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write BAM entries: %w", err)
+	}
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat BAM entries: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash BAM entries: %w", err)
+	}
+	manifest.RemoveItem("bam.json")
+	note := fmt.Sprintf("BAM/DAM execution entries from %s (%d users, %d entries)", report.ControlSet, len(report.Users), report.EntryCount())
+	manifest.AddItem("bam.json", stat.Size(), sha256Hex, false, stat.ModTime(), "bam", note)
+	manifest.SetEntriesFound(report.EntryCount())
+
+	return nil
+}
+
+// AnalyzeBAM rebuilds bam.json and control_sets.json from the SYSTEM hive
+// the windows/registry module left beside a collected windows/activity
+// directory, for the analyze command. Volume device paths are left
+// unresolved, as the drive letter mapping of the host is not recorded in the
+// collection.
+func AnalyzeBAM(ctx context.Context, moduleDir string) ([]string, error) {
+	hivePath := filepath.Join(filepath.Dir(moduleDir), registryHiveCopy)
+	if _, err := os.Stat(hivePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	activityDir := filepath.Join(moduleDir, "windows", "activity")
+	manifestPath := filepath.Join(activityDir, "manifest.json")
+	manifest, err := LoadActivityManifest(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read activity manifest: %w", err)
+	}
+	if err := WriteBAMReport(ctx, hivePath, "registry_module", nil, activityDir, manifest); err != nil {
+		return nil, err
+	}
+	files := []string{"windows/activity/bam.json"}
+	if err := WriteControlSetReport(ctx, hivePath, "registry_module", activityDir, manifest); err != nil {
+		manifest.AddError("control_sets.json", err.Error())
+	} else {
+		files = append(files, "windows/activity/control_sets.json")
+	}
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return files, fmt.Errorf("failed to write activity manifest: %w", err)
+	}
+	return append(files, "windows/activity/manifest.json"), nil
+}
@@ -0,0 +1,124 @@
+package win_activity
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+)
+
+const (
+	testUserSID  = "S-1-5-21-3623811015-3361044348-30300820-1013"
+	testAdminSID = "S-1-5-21-3623811015-3361044348-30300820-500"
+)
+
+// bamTime returns a BAM execution value: the FILETIME of the last run
+// followed by the 16 bytes of padding Windows stores after it.
+func bamTime(path string, t time.Time) regftest.Value {
+	data := binary.LittleEndian.AppendUint64(nil, regftest.Filetime(t))
+	return regftest.Binary(path, append(data, make([]byte, 16)...))
+}
+
+// openHive writes root as a SYSTEM hive and opens it.
+func openHive(t *testing.T, root *regftest.Key) *regf.Hive {
+	t.Helper()
+	hive, err := regf.Open(regftest.WriteFile(t, "SYSTEM", root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hive.Close() })
+	return hive
+}
+
+func TestParseBAM(t *testing.T) {
+	lastWritten := time.Date(2024, 3, 1, 9, 15, 2, 0, time.UTC)
+	hive := openHive(t, &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Select", Values: []regftest.Value{regftest.DWORD("Current", 1)}},
+		{Name: "ControlSet001", Subkeys: []*regftest.Key{{Name: "Services", Subkeys: []*regftest.Key{
+			regftest.Path(`bam\State\UserSettings`, &regftest.Key{
+				Name:        testUserSID,
+				LastWritten: lastWritten,
+				Values: []regftest.Value{
+					bamTime(`\Device\HarddiskVolume3\Windows\System32\cmd.exe`, time.Date(2024, 3, 1, 8, 2, 11, 0, time.UTC)),
+					bamTime(`\Device\HarddiskVolume3\Users\alice\AppData\Local\Temp\svch0st.exe`, time.Date(2024, 3, 1, 9, 14, 58, 0, time.UTC)),
+					bamTime("Microsoft.Windows.Explorer", time.Date(2024, 2, 29, 17, 0, 0, 0, time.UTC)),
+					// Too short for a FILETIME, never run, and bookkeeping
+					regftest.Binary(`\Device\HarddiskVolume3\Windows\notepad.exe`, []byte{1, 2, 3, 4}),
+					regftest.Binary(`\Device\HarddiskVolume3\Windows\regedit.exe`, make([]byte, 24)),
+					regftest.DWORD("Version", 1),
+					regftest.DWORD("SequenceNumber", 412),
+				},
+			}),
+			// Windows 10 1709 through 1803
+			regftest.Path(`dam\UserSettings`, &regftest.Key{Name: testAdminSID, Values: []regftest.Value{
+				bamTime(`\Device\HarddiskVolume4\Tools\psexec.exe`, time.Date(2024, 2, 28, 23, 30, 0, 0, time.UTC)),
+			}}),
+		}}}},
+	}})
+
+	report, err := ParseBAM(hive, map[string]string{`\device\harddiskvolume3`: "C:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ControlSet != "ControlSet001" || report.HiveDirty || len(report.Errors) != 0 || report.EntryCount() != 4 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	want := []BAMUser{
+		{SID: testUserSID, KeyLastWritten: "2024-03-01T09:15:02Z", Entries: []BAMEntry{
+			{
+				Path:         `\Device\HarddiskVolume3\Users\alice\AppData\Local\Temp\svch0st.exe`,
+				ResolvedPath: `C:\Users\alice\AppData\Local\Temp\svch0st.exe`,
+				LastRun:      "2024-03-01T09:14:58Z",
+				LastRunRaw:   regftest.Filetime(time.Date(2024, 3, 1, 9, 14, 58, 0, time.UTC)),
+				Source:       "bam",
+			},
+			{
+				Path:         `\Device\HarddiskVolume3\Windows\System32\cmd.exe`,
+				ResolvedPath: `C:\Windows\System32\cmd.exe`,
+				LastRun:      "2024-03-01T08:02:11Z",
+				LastRunRaw:   regftest.Filetime(time.Date(2024, 3, 1, 8, 2, 11, 0, time.UTC)),
+				Source:       "bam",
+			},
+			{
+				Path:       "Microsoft.Windows.Explorer",
+				LastRun:    "2024-02-29T17:00:00Z",
+				LastRunRaw: regftest.Filetime(time.Date(2024, 2, 29, 17, 0, 0, 0, time.UTC)),
+				Source:     "bam",
+			},
+		}},
+		// The volume is not in the map, so the path is left as recorded
+		{SID: testAdminSID, Entries: []BAMEntry{{
+			Path:       `\Device\HarddiskVolume4\Tools\psexec.exe`,
+			LastRun:    "2024-02-28T23:30:00Z",
+			LastRunRaw: regftest.Filetime(time.Date(2024, 2, 28, 23, 30, 0, 0, time.UTC)),
+			Source:     "dam",
+		}}},
+	}
+	if !reflect.DeepEqual(report.Users, want) {
+		t.Fatalf("users = %+v\nwant %+v", report.Users, want)
+	}
+}
+
+func TestParseBAMNeedsTheCurrentControlSet(t *testing.T) {
+	for _, root := range []*regftest.Key{
+		{Name: "ROOT", Subkeys: []*regftest.Key{{Name: "ControlSet001"}}},
+		{Name: "ROOT", Subkeys: []*regftest.Key{{Name: "Select", Values: []regftest.Value{regftest.DWORD("Current", 0)}}}},
+	} {
+		if _, err := ParseBAM(openHive(t, root), nil); err == nil {
+			t.Errorf("ParseBAM of a hive without a current control set succeeded")
+		}
+	}
+
+	// A control set without BAM is an empty report, not an error
+	report, err := ParseBAM(openHive(t, &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Select", Values: []regftest.Value{regftest.DWORD("Current", 1)}},
+		regftest.Path(`ControlSet001\Services`),
+	}}), nil)
+	if err != nil || len(report.Users) != 0 || len(report.Errors) != 0 {
+		t.Fatalf("report = %+v, %v", report, err)
+	}
+}
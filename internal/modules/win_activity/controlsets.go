@@ -0,0 +1,434 @@
+package win_activity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// controlSetName matches the ControlSet00N keys at the root of a SYSTEM hive.
+var controlSetName = regexp.MustCompile(`(?i)^ControlSet\d{3}$`)
+
+// Divergence categories and kinds recorded in control_sets.json.
+const (
+	CategoryService = "service"
+	CategoryUSB     = "usb"
+	CategoryBAM     = "bam"
+
+	// DivergenceMissing: the record is present in some control sets only.
+	DivergenceMissing = "missing"
+	// DivergenceModified: the record is present in every set but its values differ.
+	DivergenceModified = "modified"
+)
+
+// ControlSetSelect holds the values of the SYSTEM hive's Select key. Each
+// names a ControlSet00N by number; 0 means unset.
+type ControlSetSelect struct {
+	Current       uint64 `json:"current"`
+	Default       uint64 `json:"default"`
+	LastKnownGood uint64 `json:"last_known_good"`
+	Failed        uint64 `json:"failed"`
+}
+
+// ServiceRecord is a Services subkey of one control set.
+type ServiceRecord struct {
+	ControlSet string `json:"control_set"`
+	Name       string `json:"name"`
+	ImagePath  string `json:"image_path,omitempty"`
+	ServiceDll string `json:"service_dll,omitempty"`
+	ObjectName string `json:"object_name,omitempty"`
+	Start      string `json:"start,omitempty"`
+	Type       string `json:"type,omitempty"`
+}
+
+// USBRecord is a USB storage device instance under Enum\USBSTOR of one control set.
+type USBRecord struct {
+	ControlSet   string `json:"control_set"`
+	Device       string `json:"device"`   // e.g. Disk&Ven_SanDisk&Prod_Cruzer&Rev_1.00
+	Instance     string `json:"instance"` // Serial number, with &0 appended when it is not unique
+	FriendlyName string `json:"friendly_name,omitempty"`
+	LastWritten  string `json:"last_written,omitempty"`
+}
+
+// ControlSetBAM holds the BAM and DAM users of one control set.
+type ControlSetBAM struct {
+	ControlSet string    `json:"control_set"`
+	Users      []BAMUser `json:"users"`
+}
+
+// ControlSetDivergence is a record that is not the same in every control set.
+type ControlSetDivergence struct {
+	Category string            `json:"category"` // "service", "usb", or "bam"
+	Kind     string            `json:"kind"`     // "missing" or "modified"
+	Name     string            `json:"name"`     // Service name, USBSTOR device\instance, or SID\path
+	Present  []string          `json:"present_in,omitempty"`
+	Absent   []string          `json:"absent_from,omitempty"`
+	Field    string            `json:"field,omitempty"`  // Differing value of a modified record
+	Values   map[string]string `json:"values,omitempty"` // Field value per control set
+}
+
+// ControlSetReport is the structure written to control_sets.json.
+type ControlSetReport struct {
+	CollectedUTC string                 `json:"collected_utc"`
+	HiveSource   string                 `json:"hive_source"`
+	Select       ControlSetSelect       `json:"select"`
+	ControlSets  []string               `json:"control_sets"`
+	Services     []ServiceRecord        `json:"services"`
+	USBDevices   []USBRecord            `json:"usb_devices"`
+	BAM          []ControlSetBAM        `json:"bam"`
+	Divergences  []ControlSetDivergence `json:"divergences"`
+	Errors       []string               `json:"errors,omitempty"`
+}
+
+// ReadControlSets returns the Select key values and the ControlSet00N keys
+// present in a SYSTEM hive, in name order.
+func ReadControlSets(hive *regf.Hive) (ControlSetSelect, []string, error) {
+	var sel ControlSetSelect
+	selectKey, err := hive.OpenKey("Select")
+	if err != nil {
+		return sel, nil, fmt.Errorf("failed to open Select key: %w", err)
+	}
+	for name, dest := range map[string]*uint64{
+		"Current":       &sel.Current,
+		"Default":       &sel.Default,
+		"LastKnownGood": &sel.LastKnownGood,
+		"Failed":        &sel.Failed,
+	} {
+		if value, err := selectKey.Value(name); err == nil {
+			*dest, _ = value.Uint64()
+		}
+	}
+
+	root, err := hive.Root()
+	if err != nil {
+		return sel, nil, err
+	}
+	subkeys, err := root.Subkeys()
+	if err != nil {
+		return sel, nil, err
+	}
+	var sets []string
+	for _, key := range subkeys {
+		if controlSetName.MatchString(key.Name) {
+			sets = append(sets, key.Name)
+		}
+	}
+	sort.Slice(sets, func(i, j int) bool { return strings.ToLower(sets[i]) < strings.ToLower(sets[j]) })
+	return sel, sets, nil
+}
+
+// ParseControlSets reads services, USB storage devices, and BAM/DAM entries
+// from every control set of a SYSTEM hive and lists the records that differ
+// between sets. BAM entries are expected to be newer in the current set, so
+// only entries missing from it are flagged.
+func ParseControlSets(hive *regf.Hive) (*ControlSetReport, error) {
+	sel, sets, err := ReadControlSets(hive)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("no ControlSet00N keys in hive")
+	}
+
+	report := &ControlSetReport{
+		Select:      sel,
+		ControlSets: sets,
+		Services:    make([]ServiceRecord, 0),
+		USBDevices:  make([]USBRecord, 0),
+		BAM:         make([]ControlSetBAM, 0, len(sets)),
+	}
+	for _, set := range sets {
+		services, err := parseServices(hive, set)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s\\Services: %v", set, err))
+		}
+		report.Services = append(report.Services, services...)
+
+		devices, err := parseUSBStor(hive, set)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s\\Enum\\USBSTOR: %v", set, err))
+		}
+		report.USBDevices = append(report.USBDevices, devices...)
+
+		users, errs := parseBAMUsers(hive, set, nil)
+		for _, e := range errs {
+			report.Errors = append(report.Errors, set+`\`+e)
+		}
+		report.BAM = append(report.BAM, ControlSetBAM{ControlSet: set, Users: users})
+	}
+
+	current := ""
+	if sel.Current != 0 {
+		current = fmt.Sprintf("ControlSet%03d", sel.Current)
+	}
+	report.Divergences = CompareControlSets(sets, current, report.Services, report.USBDevices, report.BAM)
+	return report, nil
+}
+
+// parseServices reads the Services subkeys of a control set.
+func parseServices(hive *regf.Hive, controlSet string) ([]ServiceRecord, error) {
+	key, err := hive.OpenKey(controlSet + `\Services`)
+	if err != nil {
+		return nil, err
+	}
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]ServiceRecord, 0, len(subkeys))
+	for _, sub := range subkeys {
+		record := ServiceRecord{
+			ControlSet: controlSet,
+			Name:       sub.Name,
+			ImagePath:  stringValue(sub, "ImagePath"),
+			ObjectName: stringValue(sub, "ObjectName"),
+			Start:      dwordValue(sub, "Start"),
+			Type:       dwordValue(sub, "Type"),
+		}
+		if params, err := sub.Subkey("Parameters"); err == nil {
+			record.ServiceDll = stringValue(params, "ServiceDll")
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// parseUSBStor reads the device instances under Enum\USBSTOR of a control set.
+func parseUSBStor(hive *regf.Hive, controlSet string) ([]USBRecord, error) {
+	key, err := hive.OpenKey(controlSet + `\Enum\USBSTOR`)
+	if errors.Is(err, regf.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	devices, err := key.Subkeys()
+	if err != nil {
+		return nil, err
+	}
+	var records []USBRecord
+	for _, device := range devices {
+		instances, err := device.Subkeys()
+		if err != nil {
+			return records, err
+		}
+		for _, instance := range instances {
+			records = append(records, USBRecord{
+				ControlSet:   controlSet,
+				Device:       device.Name,
+				Instance:     instance.Name,
+				FriendlyName: stringValue(instance, "FriendlyName"),
+				LastWritten:  formatTime(instance),
+			})
+		}
+	}
+	return records, nil
+}
+
+// CompareControlSets lists the services, USB devices, and BAM entries that
+// are not the same across sets. A BAM entry is reported only when current,
+// the set Select\Current names, lacks it.
+func CompareControlSets(sets []string, current string, services []ServiceRecord, devices []USBRecord, bam []ControlSetBAM) []ControlSetDivergence {
+	divergences := make([]ControlSetDivergence, 0)
+
+	// Services: presence, then each compared field
+	serviceFields := []struct {
+		name string
+		get  func(ServiceRecord) string
+	}{
+		{"image_path", func(r ServiceRecord) string { return r.ImagePath }},
+		{"service_dll", func(r ServiceRecord) string { return r.ServiceDll }},
+		{"object_name", func(r ServiceRecord) string { return r.ObjectName }},
+		{"start", func(r ServiceRecord) string { return r.Start }},
+		{"type", func(r ServiceRecord) string { return r.Type }},
+	}
+	byService := make(map[string]map[string]ServiceRecord)
+	names := make(map[string]string)
+	for _, record := range services {
+		lower := strings.ToLower(record.Name)
+		if byService[lower] == nil {
+			byService[lower] = make(map[string]ServiceRecord)
+			names[lower] = record.Name
+		}
+		byService[lower][record.ControlSet] = record
+	}
+	for lower, perSet := range byService {
+		if d, ok := presence(CategoryService, names[lower], sets, func(set string) bool { _, ok := perSet[set]; return ok }); ok {
+			divergences = append(divergences, d)
+			continue
+		}
+		for _, field := range serviceFields {
+			values := make(map[string]string, len(sets))
+			distinct := make(map[string]bool)
+			for _, set := range sets {
+				values[set] = field.get(perSet[set])
+				distinct[strings.ToLower(values[set])] = true
+			}
+			if len(distinct) > 1 {
+				divergences = append(divergences, ControlSetDivergence{
+					Category: CategoryService,
+					Kind:     DivergenceModified,
+					Name:     names[lower],
+					Field:    field.name,
+					Values:   values,
+				})
+			}
+		}
+	}
+
+	// USB storage devices: presence only
+	byDevice := make(map[string]map[string]bool)
+	deviceNames := make(map[string]string)
+	for _, record := range devices {
+		name := record.Device + `\` + record.Instance
+		lower := strings.ToLower(name)
+		if byDevice[lower] == nil {
+			byDevice[lower] = make(map[string]bool)
+			deviceNames[lower] = name
+		}
+		byDevice[lower][record.ControlSet] = true
+	}
+	for lower, perSet := range byDevice {
+		if d, ok := presence(CategoryUSB, deviceNames[lower], sets, func(set string) bool { return perSet[set] }); ok {
+			divergences = append(divergences, d)
+		}
+	}
+
+	// BAM: entries a non-current set holds that the current set lacks
+	inCurrent := make(map[string]bool)
+	for _, set := range bam {
+		if set.ControlSet != current {
+			continue
+		}
+		for _, user := range set.Users {
+			for _, entry := range user.Entries {
+				inCurrent[strings.ToLower(user.SID+`\`+entry.Path)] = true
+			}
+		}
+	}
+	if current != "" {
+		byEntry := make(map[string]*ControlSetDivergence)
+		for _, set := range bam {
+			if set.ControlSet == current {
+				continue
+			}
+			for _, user := range set.Users {
+				for _, entry := range user.Entries {
+					name := user.SID + `\` + entry.Path
+					lower := strings.ToLower(name)
+					if inCurrent[lower] {
+						continue
+					}
+					d, ok := byEntry[lower]
+					if !ok {
+						d = &ControlSetDivergence{Category: CategoryBAM, Kind: DivergenceMissing, Name: name, Absent: []string{current}}
+						byEntry[lower] = d
+					}
+					d.Present = append(d.Present, set.ControlSet)
+				}
+			}
+		}
+		for _, d := range byEntry {
+			divergences = append(divergences, *d)
+		}
+	}
+
+	sort.Slice(divergences, func(i, j int) bool {
+		a, b := divergences[i], divergences[j]
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		if !strings.EqualFold(a.Name, b.Name) {
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		}
+		return a.Field < b.Field
+	})
+	return divergences
+}
+
+// presence reports a missing divergence when has is false for some but not
+// all of sets.
+func presence(category, name string, sets []string, has func(string) bool) (ControlSetDivergence, bool) {
+	d := ControlSetDivergence{Category: category, Kind: DivergenceMissing, Name: name}
+	for _, set := range sets {
+		if has(set) {
+			d.Present = append(d.Present, set)
+		} else {
+			d.Absent = append(d.Absent, set)
+		}
+	}
+	return d, len(d.Present) > 0 && len(d.Absent) > 0
+}
+
+// stringValue returns a string value of key, or "" when it is absent.
+func stringValue(key *regf.Key, name string) string {
+	value, err := key.Value(name)
+	if err != nil {
+		return ""
+	}
+	return value.String()
+}
+
+// dwordValue returns a numeric value of key in decimal, or "" when it is absent.
+func dwordValue(key *regf.Key, name string) string {
+	value, err := key.Value(name)
+	if err != nil {
+		return ""
+	}
+	n, ok := value.Uint64()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+// WriteControlSetReport parses every control set of the SYSTEM hive at
+// hivePath and writes control_sets.json to outDir, replacing any
+// control_sets.json already listed in the manifest.
+func WriteControlSetReport(ctx context.Context, hivePath, hiveSource, outDir string, manifest *ActivityManifest) error {
+	hive, err := regf.Open(hivePath)
+	if err != nil {
+		return err
+	}
+	defer hive.Close()
+
+	report, err := ParseControlSets(hive)
+	if err != nil {
+		return err
+	}
+	report.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+	report.HiveSource = hiveSource
+
+	outputPath := filepath.Join(outDir, "control_sets.json")
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal control sets: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write control sets: %w", err)
+	}
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat control sets: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash control sets: %w", err)
+	}
+	manifest.RemoveItem("control_sets.json")
+	note := fmt.Sprintf("Services, USB storage, and BAM/DAM entries per control set (%d sets, %d divergences)", len(report.ControlSets), len(report.Divergences))
+	manifest.AddItem("control_sets.json", stat.Size(), sha256Hex, false, stat.ModTime(), "control_sets", note)
+	manifest.SetControlSetDivergences(len(report.Divergences))
+
+	return nil
+}
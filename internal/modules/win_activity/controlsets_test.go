@@ -0,0 +1,156 @@
+package win_activity
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/regf/regftest"
+)
+
+// controlSet builds a ControlSet00N key holding services, USB storage
+// devices, and the BAM settings of one user.
+func controlSet(name string, services []*regftest.Key, usbstor []*regftest.Key, bam ...regftest.Value) *regftest.Key {
+	serviceKeys := append([]*regftest.Key{
+		regftest.Path(`bam\State\UserSettings`, &regftest.Key{Name: testUserSID, Values: bam}),
+	}, services...)
+	set := &regftest.Key{Name: name, Subkeys: []*regftest.Key{{Name: "Services", Subkeys: serviceKeys}}}
+	if len(usbstor) > 0 {
+		set.Subkeys = append(set.Subkeys, regftest.Path(`Enum\USBSTOR`, usbstor...))
+	}
+	return set
+}
+
+// service builds a Services subkey.
+func service(name, imagePath string, start uint32) *regftest.Key {
+	return &regftest.Key{Name: name, Values: []regftest.Value{
+		regftest.String("ImagePath", imagePath),
+		regftest.String("ObjectName", "LocalSystem"),
+		regftest.DWORD("Start", start),
+		regftest.DWORD("Type", 16),
+	}}
+}
+
+func TestParseControlSetsReportsDivergence(t *testing.T) {
+	cmdRun := bamTime(`\Device\HarddiskVolume3\Windows\System32\cmd.exe`, time.Date(2024, 3, 1, 8, 2, 11, 0, time.UTC))
+	toolRun := bamTime(`\Device\HarddiskVolume3\Users\Public\rcl.exe`, time.Date(2024, 2, 20, 3, 0, 0, 0, time.UTC))
+	usbWritten := time.Date(2024, 2, 19, 14, 0, 0, 0, time.UTC)
+
+	// The last known good set still holds what the current one was cleaned of
+	hive := openHive(t, &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Select", Values: []regftest.Value{
+			regftest.DWORD("Current", 2),
+			regftest.DWORD("Default", 2),
+			regftest.DWORD("LastKnownGood", 1),
+			regftest.DWORD("Failed", 0),
+		}},
+		controlSet("ControlSet001",
+			[]*regftest.Key{
+				service("Spooler", `%SystemRoot%\System32\spoolsv.exe`, 2),
+				service("WinDefend", `"C:\ProgramData\Microsoft\Windows Defender\Platform\4.18.24010.12-0\MsMpEng.exe"`, 2),
+				service("rclsvc", `C:\Users\Public\rcl.exe -svc`, 2),
+			},
+			[]*regftest.Key{{Name: "Disk&Ven_SanDisk&Prod_Cruzer&Rev_1.00", Subkeys: []*regftest.Key{{
+				Name:        "4C530001230509115204&0",
+				LastWritten: usbWritten,
+				Values:      []regftest.Value{regftest.String("FriendlyName", "SanDisk Cruzer USB Device")},
+			}}}},
+			cmdRun, toolRun),
+		controlSet("ControlSet002",
+			[]*regftest.Key{
+				service("spooler", `%SystemRoot%\system32\SPOOLSV.EXE`, 2),
+				service("WinDefend", `"C:\ProgramData\Microsoft\Windows Defender\Platform\4.18.24010.12-0\MsMpEng.exe"`, 4),
+			},
+			nil,
+			cmdRun),
+		{Name: "MountedDevices"},
+	}})
+
+	report, err := ParseControlSets(hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ControlSetSelect{Current: 2, Default: 2, LastKnownGood: 1}); report.Select != want {
+		t.Fatalf("select = %+v", report.Select)
+	}
+	if !reflect.DeepEqual(report.ControlSets, []string{"ControlSet001", "ControlSet002"}) || len(report.Errors) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	// bam is a service of both sets too
+	if len(report.Services) != 7 || len(report.USBDevices) != 1 || len(report.BAM) != 2 {
+		t.Fatalf("records = %d services, %d devices, %d BAM sets", len(report.Services), len(report.USBDevices), len(report.BAM))
+	}
+	if usb := report.USBDevices[0]; usb.ControlSet != "ControlSet001" || usb.FriendlyName != "SanDisk Cruzer USB Device" || usb.LastWritten != "2024-02-19T14:00:00Z" {
+		t.Fatalf("USB device = %+v", usb)
+	}
+
+	// Case differences are not divergence, and neither is the BAM entry
+	// both sets hold
+	want := []ControlSetDivergence{
+		{
+			Category: CategoryBAM,
+			Kind:     DivergenceMissing,
+			Name:     testUserSID + `\\Device\HarddiskVolume3\Users\Public\rcl.exe`,
+			Present:  []string{"ControlSet001"},
+			Absent:   []string{"ControlSet002"},
+		},
+		{
+			Category: CategoryService,
+			Kind:     DivergenceMissing,
+			Name:     "rclsvc",
+			Present:  []string{"ControlSet001"},
+			Absent:   []string{"ControlSet002"},
+		},
+		{
+			Category: CategoryService,
+			Kind:     DivergenceModified,
+			Name:     "WinDefend",
+			Field:    "start",
+			Values:   map[string]string{"ControlSet001": "2", "ControlSet002": "4"},
+		},
+		{
+			Category: CategoryUSB,
+			Kind:     DivergenceMissing,
+			Name:     `Disk&Ven_SanDisk&Prod_Cruzer&Rev_1.00\4C530001230509115204&0`,
+			Present:  []string{"ControlSet001"},
+			Absent:   []string{"ControlSet002"},
+		},
+	}
+	if !reflect.DeepEqual(report.Divergences, want) {
+		t.Fatalf("divergences = %+v\nwant %+v", report.Divergences, want)
+	}
+}
+
+func TestCompareControlSetsFlagsBAMOnlyAgainstTheCurrentSet(t *testing.T) {
+	sets := []string{"ControlSet001", "ControlSet002"}
+	entry := func(path string) BAMUser {
+		return BAMUser{SID: testUserSID, Entries: []BAMEntry{{Path: path}}}
+	}
+	bam := []ControlSetBAM{
+		{ControlSet: "ControlSet001", Users: []BAMUser{entry("old.exe")}},
+		{ControlSet: "ControlSet002", Users: []BAMUser{entry("new.exe")}},
+	}
+
+	// Executions newer than the other set are expected in the current one
+	divergences := CompareControlSets(sets, "ControlSet002", nil, nil, bam)
+	if len(divergences) != 1 || divergences[0].Name != testUserSID+`\old.exe` || !reflect.DeepEqual(divergences[0].Absent, []string{"ControlSet002"}) {
+		t.Fatalf("divergences = %+v", divergences)
+	}
+	divergences = CompareControlSets(sets, "ControlSet001", nil, nil, bam)
+	if len(divergences) != 1 || divergences[0].Name != testUserSID+`\new.exe` {
+		t.Fatalf("divergences with ControlSet001 current = %+v", divergences)
+	}
+	// Without Select\Current there is nothing to compare BAM against
+	if divergences := CompareControlSets(sets, "", nil, nil, bam); len(divergences) != 0 {
+		t.Fatalf("divergences without a current set = %+v", divergences)
+	}
+}
+
+func TestParseControlSetsWithoutControlSets(t *testing.T) {
+	hive := openHive(t, &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Select", Values: []regftest.Value{regftest.DWORD("Current", 1)}},
+	}})
+	if _, err := ParseControlSets(hive); err == nil {
+		t.Fatal("ParseControlSets of a hive without control sets succeeded")
+	}
+}
@@ -0,0 +1,133 @@
+// Package win_activity provides Windows Background Activity Moderator (BAM/DAM) execution artifact collection for cryptkeeper.
+package win_activity
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
+)
+
+// ActivityItem represents a collected activity artifact.
+type ActivityItem struct {
+	Path      string `json:"path"`           // Relative path in the archive
+	Size      int64  `json:"size"`           // File size in bytes
+	SHA256    string `json:"sha256"`         // SHA-256 hash
+	Truncated bool   `json:"truncated"`      // Whether the file was truncated due to size limits
+	Note      string `json:"note,omitempty"` // Description of the file
+	Modified  string `json:"modified"`       // File modification time (RFC3339)
+	FileType  string `json:"file_type"`      // Type: "bam"
+}
+
+// ActivityError represents an error that occurred during collection.
+type ActivityError struct {
+	Target string `json:"target"` // What failed (e.g., specific file path)
+	Error  string `json:"error"`  // Error message
+}
+
+// ActivityManifest represents the complete manifest for activity collection.
+type ActivityManifest struct {
+	CreatedUTC         string          `json:"created_utc"`
+	Host               string          `json:"host"`
+	CryptkeeperVersion string          `json:"cryptkeeper_version"`
+	Items              []ActivityItem  `json:"items"`
+	Errors             []ActivityError `json:"errors"`
+	TotalFiles         int             `json:"total_files"`
+	CollectedFiles     int             `json:"collected_files"`
+	EntriesFound       int             `json:"entries_found"`
+	ControlSetDiffs    int             `json:"control_set_divergences"`
+	Summary            schema.Summary  `json:"summary"`
+}
+
+// NewActivityManifest creates a new activity manifest with basic information.
+func NewActivityManifest(ctx context.Context, hostname string) *ActivityManifest {
+	return &ActivityManifest{
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
+		Host:               hostname,
+		CryptkeeperVersion: "v0.1.0",
+		Items:              make([]ActivityItem, 0),
+		Errors:             make([]ActivityError, 0),
+		TotalFiles:         0,
+		CollectedFiles:     0,
+		EntriesFound:       0,
+		Summary:            schema.NewSummary(),
+	}
+}
+
+// AddItem adds a successfully collected activity item to the manifest.
+func (am *ActivityManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, note string) {
+	am.Items = append(am.Items, ActivityItem{
+		Path:      path,
+		Size:      size,
+		SHA256:    sha256,
+		Truncated: truncated,
+		Note:      note,
+		Modified:  winutil.FormatTime(modified),
+		FileType:  fileType,
+	})
+	am.CollectedFiles++
+}
+
+// RemoveItem drops every item recorded under path, so a file that is
+// regenerated is listed once.
+func (am *ActivityManifest) RemoveItem(path string) {
+	items := am.Items[:0]
+	for _, item := range am.Items {
+		if item.Path != path {
+			items = append(items, item)
+		}
+	}
+	am.CollectedFiles -= len(am.Items) - len(items)
+	am.Items = items
+}
+
+// AddError adds an error to the manifest for a failed collection.
+func (am *ActivityManifest) AddError(target, errorMsg string) {
+	am.Errors = append(am.Errors, ActivityError{
+		Target: target,
+		Error:  errorMsg,
+	})
+}
+
+// IncrementTotalFiles increments the count of total files found.
+func (am *ActivityManifest) IncrementTotalFiles() {
+	am.TotalFiles++
+}
+
+// SetEntriesFound sets the number of BAM and DAM execution entries decoded.
+func (am *ActivityManifest) SetEntriesFound(count int) {
+	am.EntriesFound = count
+	am.Summary.Set(schema.SummaryBAMEntries, count)
+}
+
+// SetControlSetDivergences sets the number of records that differ between control sets.
+func (am *ActivityManifest) SetControlSetDivergences(count int) {
+	am.ControlSetDiffs = count
+	am.Summary.Set(schema.SummaryControlSetDivergences, count)
+}
+
+// WriteManifest writes the manifest to a JSON file.
+func (am *ActivityManifest) WriteManifest(manifestPath string) error {
+	data, err := json.MarshalIndent(am, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath, data, 0644)
+}
+
+// LoadActivityManifest reads a manifest written by WriteManifest.
+func LoadActivityManifest(manifestPath string) (*ActivityManifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var am ActivityManifest
+	if err := json.Unmarshal(data, &am); err != nil {
+		return nil, err
+	}
+	return &am, nil
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package win_activity
+
+import (
+	"context"
+)
+
+// WinActivity represents the Windows BAM/DAM execution activity collection module (no-op on non-Windows).
+type WinActivity struct{}
+
+// NewWinActivity creates a new Windows activity collection module.
+func NewWinActivity() *WinActivity {
+	return &WinActivity{}
+}
+
+// DependsOn reports that the module runs after windows/registry.
+func (w *WinActivity) DependsOn() []string {
+	return []string{"windows/registry"}
+}
+
+// Name returns the module's identifier.
+func (w *WinActivity) Name() string {
+	return "windows/activity"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinActivity) Describe() string {
+	return "BAM/DAM execution activity"
+}
+
+// Collect is a no-op on non-Windows systems.
+func (w *WinActivity) Collect(ctx context.Context, outDir string) error {
+	// No-op on non-Windows systems
+	return nil
+}
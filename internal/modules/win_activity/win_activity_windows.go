@@ -0,0 +1,145 @@
+//go:build windows
+
+package win_activity
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// WinActivity represents the Windows BAM/DAM execution activity collection module.
+type WinActivity struct{}
+
+// NewWinActivity creates a new Windows activity collection module.
+func NewWinActivity() *WinActivity {
+	return &WinActivity{}
+}
+
+// Name returns the module's identifier.
+func (w *WinActivity) Name() string {
+	return "windows/activity"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinActivity) Describe() string {
+	return "BAM/DAM execution activity"
+}
+
+// DependsOn reports that the module runs after windows/registry, whose
+// validated SYSTEM hive copy it parses when one was made.
+func (w *WinActivity) DependsOn() []string {
+	return []string{"windows/registry"}
+}
+
+// Collect decodes BAM and DAM entries from the SYSTEM hive into bam.json and creates a manifest.
+func (w *WinActivity) Collect(ctx context.Context, outDir string) error {
+	// Create the windows/activity subdirectory
+	activityDir := filepath.Join(outDir, "windows", "activity")
+	if err := winutil.EnsureDir(activityDir); err != nil {
+		return fmt.Errorf("failed to create activity directory: %w", err)
+	}
+
+	// Get hostname for manifest
+	hostname, err := winutil.Hostname(ctx)
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	manifest := NewActivityManifest(ctx, hostname)
+	manifest.IncrementTotalFiles() // bam.json
+	manifest.IncrementTotalFiles() // control_sets.json
+
+	if err := w.writeBAM(ctx, filepath.Join(filepath.Dir(outDir), registryHiveCopy), activityDir, manifest); err != nil {
+		manifest.AddError("bam.json", err.Error())
+	}
+
+	// Write manifest
+	manifestPath := filepath.Join(activityDir, "manifest.json")
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// writeBAM parses the SYSTEM hive and writes bam.json and control_sets.json;
+// only a bam.json failure is returned. The registry module's
+// copy at registryCopy is used when it passes validation; otherwise a private
+// copy is kept outside the artifacts directory and removed after parsing.
+func (w *WinActivity) writeBAM(ctx context.Context, registryCopy, outDir string, manifest *ActivityManifest) error {
+	hivePath := registryCopy
+	hiveSource := "registry_module"
+	if !regf.CheckFile(registryCopy).Valid {
+		tempDir, err := os.MkdirTemp("", "cryptkeeper-bam-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		hivePath = filepath.Join(tempDir, "SYSTEM")
+		if hiveSource, err = acquireSystemHive(ctx, hivePath); err != nil {
+			return err
+		}
+	}
+
+	if err := WriteControlSetReport(ctx, hivePath, hiveSource, outDir, manifest); err != nil {
+		manifest.AddError("control_sets.json", err.Error())
+	}
+	return WriteBAMReport(ctx, hivePath, hiveSource, volumeDevices(), outDir, manifest)
+}
+
+// acquireSystemHive copies the SYSTEM hive to destPath, falling back to
+// reg save on a live system when the file is locked. It returns the method used.
+func acquireSystemHive(ctx context.Context, destPath string) (string, error) {
+	srcPath := filepath.Join(winutil.SystemRoot(), "System32", "config", "SYSTEM")
+	_, _, copyErr := winutil.CopyFile(ctx, srcPath, destPath)
+	if copyErr == nil {
+		return "copy", nil
+	}
+	if winutil.IsOffline() {
+		return "", fmt.Errorf("failed to copy SYSTEM hive: %w", copyErr)
+	}
+
+	os.Remove(destPath)
+	if err := winutil.ExportRegistryHive(ctx, `HKLM\SYSTEM`, destPath); err != nil {
+		return "", fmt.Errorf("failed to acquire SYSTEM hive (copy: %v; reg save: %w)", copyErr, err)
+	}
+	return "reg_save", nil
+}
+
+// volumeDevices maps lowercased \Device\HarddiskVolumeN names to drive
+// letters. The mapping only describes the live system, so it is empty when
+// collecting from an alternate root.
+func volumeDevices() map[string]string {
+	volumes := make(map[string]string)
+	if winutil.IsOffline() {
+		return volumes
+	}
+
+	buf := make([]uint16, windows.MAX_PATH)
+	for letter := 'A'; letter <= 'Z'; letter++ {
+		drive := string(letter) + ":"
+		drivePtr, err := windows.UTF16PtrFromString(drive)
+		if err != nil {
+			continue
+		}
+		n, err := windows.QueryDosDevice(drivePtr, &buf[0], uint32(len(buf)))
+		if err != nil || n == 0 {
+			continue
+		}
+		// The result is a list of NUL-terminated strings; the first is the current target
+		device := windows.UTF16ToString(buf[:n])
+		if device != "" {
+			volumes[strings.ToLower(device)] = drive
+		}
+	}
+	return volumes
+}
@@ -2,9 +2,13 @@
 package win_ads
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
 )
 
 // ADSItem represents a collected Alternate Data Stream-related file.
@@ -34,12 +38,13 @@ type ADSManifest struct {
 	TotalFiles         int        `json:"total_files"`
 	CollectedFiles     int        `json:"collected_files"`
 	StreamsFound       int        `json:"streams_found"`
+	Summary            schema.Summary `json:"summary"`
 }
 
 // NewADSManifest creates a new ADS manifest with basic information.
-func NewADSManifest(hostname string) *ADSManifest {
+func NewADSManifest(ctx context.Context, hostname string) *ADSManifest {
 	return &ADSManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]ADSItem, 0),
@@ -47,6 +52,7 @@ func NewADSManifest(hostname string) *ADSManifest {
 		TotalFiles:         0,
 		CollectedFiles:     0,
 		StreamsFound:       0,
+		Summary:            schema.NewSummary(),
 	}
 }
 
@@ -58,7 +64,7 @@ func (am *ADSManifest) AddItem(path string, size int64, sha256 string, truncated
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	am.CollectedFiles++
@@ -80,6 +86,7 @@ func (am *ADSManifest) IncrementTotalFiles() {
 // SetStreamsFound sets the number of alternate data streams found.
 func (am *ADSManifest) SetStreamsFound(count int) {
 	am.StreamsFound = count
+	am.Summary.Set(schema.SummaryStreams, count)
 }
 
 // WriteManifest writes the manifest to a JSON file.
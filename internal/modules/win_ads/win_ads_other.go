@@ -19,6 +19,16 @@ func (w *WinADS) Name() string {
 	return "windows/ads"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinADS) Describe() string {
+	return "Alternate Data Streams detection"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinADS) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinADS) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
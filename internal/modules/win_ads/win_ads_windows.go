@@ -25,6 +25,16 @@ func (w *WinADS) Name() string {
 	return "windows/ads"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinADS) Describe() string {
+	return "Alternate Data Streams detection"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinADS) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers Alternate Data Streams information and metadata.
 func (w *WinADS) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/ads subdirectory
@@ -34,13 +44,13 @@ func (w *WinADS) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewADSManifest(hostname)
+	manifest := NewADSManifest(ctx, hostname)
 
 	// Collect ADS information
 	if err := w.collectADSInfo(ctx, adsDir, manifest); err != nil {
@@ -65,10 +75,7 @@ func (w *WinADS) collectADSInfo(ctx context.Context, outDir string, manifest *AD
 	output += "This scan looks for common locations where ADS might be found.\n\n"
 
 	// Get system drive
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	// Scan key directories for ADS
 	scanDirs := []string{
@@ -124,7 +131,7 @@ func (w *WinADS) collectADSInfo(ctx context.Context, outDir string, manifest *AD
 	output += "=== Common ADS Patterns (dir command) ===\n"
 	output += "Scanning for files with Zone.Identifier (downloaded files)...\n"
 	
-	zoneCmd := []string{"/C", fmt.Sprintf("dir /s /a \"%s\\Users\" 2>nul | findstr Zone.Identifier", systemDrive)}
+	zoneCmd := []string{"/C", fmt.Sprintf("dir /s /a \"%s\\Users\" 2>nul | findstr Zone.Identifier", winutil.LiveSystemDrive())}
 	if result, err := winutil.RunCommandWithOutput(ctx, "cmd", zoneCmd); err == nil {
 		if len(strings.TrimSpace(string(result))) > 0 {
 			output += string(result)
@@ -139,8 +146,8 @@ func (w *WinADS) collectADSInfo(ctx context.Context, outDir string, manifest *AD
 	// Scan temp directories more thoroughly
 	output += "=== Detailed Temp Directory ADS Scan ===\n"
 	tempDirs := []string{
-		os.Getenv("TEMP"),
-		os.Getenv("TMP"),
+		winutil.Getenv(ctx, "TEMP"),
+		winutil.Getenv(ctx, "TMP"),
 		systemDrive + "\\Windows\\Temp",
 	}
 
@@ -184,7 +191,7 @@ func (w *WinADS) collectADSInfo(ctx context.Context, outDir string, manifest *AD
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			note := fmt.Sprintf("Alternate Data Streams scan results (%d streams found)", streamCount)
 			manifest.AddItem("ads_scan.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "ads_scan", note)
 			manifest.IncrementTotalFiles()
@@ -0,0 +1,375 @@
+package win_amcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// Amcache schemas. Windows 10 1709 and later record drivers under
+// Root\InventoryDriverBinary; Windows 8 through early Windows 10 only list
+// files under Root\File, from which .sys entries are taken.
+const (
+	SchemaInventory = "inventory"
+	SchemaLegacy    = "legacy_file"
+	SchemaUnknown   = "unknown"
+)
+
+// standardDriverRoots are the directories drivers are normally loaded from,
+// matched against the lowercased path with the drive letter removed.
+var standardDriverRoots = []string{
+	`\windows\system32\`,
+	`\windows\syswow64\`,
+	`\windows\winsxs\`,
+}
+
+// DriverInventoryEntry is a driver binary recorded in Amcache.hve.
+type DriverInventoryEntry struct {
+	Path           string   `json:"path"`
+	Name           string   `json:"name,omitempty"`
+	SHA1           string   `json:"sha1,omitempty"`
+	Signed         *bool    `json:"signed,omitempty"`      // Unknown in the legacy schema
+	KernelMode     *bool    `json:"kernel_mode,omitempty"` // Unknown in the legacy schema
+	InBox          *bool    `json:"in_box,omitempty"`      // Shipped with Windows
+	Service        string   `json:"service,omitempty"`
+	Company        string   `json:"company,omitempty"`
+	Product        string   `json:"product,omitempty"`
+	ProductVersion string   `json:"product_version,omitempty"`
+	DriverVersion  string   `json:"driver_version,omitempty"`
+	Inf            string   `json:"inf,omitempty"`
+	LinkTime       string   `json:"link_time,omitempty"`           // PE header timestamp (RFC3339)
+	LastWriteTime  string   `json:"last_write_time,omitempty"`     // File write time as recorded by Amcache
+	LastWriteRaw   uint64   `json:"last_write_filetime,omitempty"` // Legacy schema FILETIME as stored
+	KeyLastWritten string   `json:"key_last_written,omitempty"`
+	Flags          []string `json:"flags,omitempty"` // "unsigned", "off_path"
+}
+
+// DriverInventory is the structure written to driver_inventory.json.
+type DriverInventory struct {
+	CollectedUTC string                 `json:"collected_utc"`
+	Schema       string                 `json:"schema"`
+	HiveDirty    bool                   `json:"hive_dirty"` // Pending transaction log changes were not applied
+	Drivers      []DriverInventoryEntry `json:"drivers"`
+	Findings     []string               `json:"findings"`
+	Errors       []string               `json:"errors,omitempty"`
+}
+
+// ParseDriverInventory extracts driver binaries from an Amcache hive, using
+// InventoryDriverBinary when present and falling back to .sys files under
+// the legacy Root\File key.
+func ParseDriverInventory(hive *regf.Hive) (*DriverInventory, error) {
+	inventory := &DriverInventory{
+		Schema:    SchemaUnknown,
+		HiveDirty: hive.Dirty(),
+		Drivers:   make([]DriverInventoryEntry, 0),
+		Findings:  make([]string, 0),
+	}
+
+	if key, err := hive.OpenKey(`Root\InventoryDriverBinary`); err == nil {
+		inventory.Schema = SchemaInventory
+		drivers, errs := parseInventoryDriverBinary(key)
+		inventory.Drivers = append(inventory.Drivers, drivers...)
+		inventory.Errors = append(inventory.Errors, errs...)
+	} else if !errors.Is(err, regf.ErrNotFound) {
+		return nil, fmt.Errorf("failed to open InventoryDriverBinary: %w", err)
+	} else if key, err := hive.OpenKey(`Root\File`); err == nil {
+		inventory.Schema = SchemaLegacy
+		drivers, errs := parseLegacyFileDrivers(key)
+		inventory.Drivers = append(inventory.Drivers, drivers...)
+		inventory.Errors = append(inventory.Errors, errs...)
+	} else if !errors.Is(err, regf.ErrNotFound) {
+		return nil, fmt.Errorf("failed to open Root\\File: %w", err)
+	}
+
+	for i := range inventory.Drivers {
+		driver := &inventory.Drivers[i]
+		driver.Flags = flagDriver(*driver)
+		for _, flag := range driver.Flags {
+			inventory.Findings = append(inventory.Findings, driverFinding(flag, *driver))
+		}
+	}
+
+	return inventory, nil
+}
+
+// parseInventoryDriverBinary reads one entry per subkey. Subkey names are the
+// lowercased driver path with forward slashes.
+func parseInventoryDriverBinary(key *regf.Key) ([]DriverInventoryEntry, []string) {
+	drivers := make([]DriverInventoryEntry, 0)
+	var errs []string
+
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return drivers, []string{fmt.Sprintf("InventoryDriverBinary: %v", err)}
+	}
+	for _, sub := range subkeys {
+		values, err := sub.Values()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("InventoryDriverBinary\\%s: %v", sub.Name, err))
+			continue
+		}
+		byName := valueMap(values)
+
+		entry := DriverInventoryEntry{
+			Path:           strings.ReplaceAll(sub.Name, "/", `\`),
+			Name:           stringValue(byName, "DriverName"),
+			SHA1:           amcacheSHA1(stringValue(byName, "DriverId")),
+			Signed:         boolValue(byName, "DriverSigned"),
+			KernelMode:     boolValue(byName, "DriverIsKernelMode"),
+			InBox:          boolValue(byName, "DriverInBox"),
+			Service:        stringValue(byName, "Service"),
+			Company:        stringValue(byName, "DriverCompany"),
+			Product:        stringValue(byName, "Product"),
+			ProductVersion: stringValue(byName, "ProductVersion"),
+			DriverVersion:  stringValue(byName, "DriverVersion"),
+			Inf:            stringValue(byName, "Inf"),
+			LastWriteTime:  stringValue(byName, "DriverLastWriteTime"),
+			KeyLastWritten: formatTime(sub.LastWritten),
+		}
+		if v, ok := byName["drivertimestamp"]; ok {
+			if ts, ok := v.Uint64(); ok && ts > 0 {
+				entry.LinkTime = winutil.FormatTime(time.Unix(int64(ts), 0))
+			}
+		}
+		drivers = append(drivers, entry)
+	}
+
+	return drivers, errs
+}
+
+// parseLegacyFileDrivers reads .sys entries from Root\File\{volume}\{file id}.
+// Values are named by number: 15 is the full path, 101 the SHA-1, 0 the
+// product, 1 the company, and 17 the last modification FILETIME.
+func parseLegacyFileDrivers(key *regf.Key) ([]DriverInventoryEntry, []string) {
+	drivers := make([]DriverInventoryEntry, 0)
+	var errs []string
+
+	volumes, err := key.Subkeys()
+	if err != nil {
+		return drivers, []string{fmt.Sprintf("File: %v", err)}
+	}
+	for _, volume := range volumes {
+		files, err := volume.Subkeys()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("File\\%s: %v", volume.Name, err))
+			continue
+		}
+		for _, file := range files {
+			values, err := file.Values()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("File\\%s\\%s: %v", volume.Name, file.Name, err))
+				continue
+			}
+			byName := valueMap(values)
+
+			path := stringValue(byName, "15")
+			if !strings.HasSuffix(strings.ToLower(path), ".sys") {
+				continue
+			}
+			entry := DriverInventoryEntry{
+				Path:           path,
+				Name:           baseName(path),
+				SHA1:           amcacheSHA1(stringValue(byName, "101")),
+				Company:        stringValue(byName, "1"),
+				Product:        stringValue(byName, "0"),
+				KeyLastWritten: formatTime(file.LastWritten),
+			}
+			if v, ok := byName["17"]; ok {
+				if ft, ok := v.Uint64(); ok {
+					entry.LastWriteTime = formatTime(winutil.FiletimeToUTC(ft))
+					entry.LastWriteRaw = ft
+				}
+			}
+			drivers = append(drivers, entry)
+		}
+	}
+
+	return drivers, errs
+}
+
+// flagDriver returns the BYOVD-relevant flags for a driver.
+func flagDriver(driver DriverInventoryEntry) []string {
+	var flags []string
+	if driver.Signed != nil && !*driver.Signed {
+		flags = append(flags, "unsigned")
+	}
+	if !isStandardDriverPath(driver.Path) {
+		flags = append(flags, "off_path")
+	}
+	return flags
+}
+
+// driverFinding describes a flagged driver.
+func driverFinding(flag string, driver DriverInventoryEntry) string {
+	detail := driver.Path
+	if driver.SHA1 != "" {
+		detail += " (sha1 " + driver.SHA1 + ")"
+	}
+	switch flag {
+	case "unsigned":
+		if driver.KernelMode != nil && *driver.KernelMode {
+			return "unsigned: unsigned kernel-mode driver " + detail
+		}
+		return "unsigned: unsigned driver " + detail
+	case "off_path":
+		return "off_path: driver outside the system driver directories " + detail
+	}
+	return flag + ": " + detail
+}
+
+// isStandardDriverPath reports whether a driver lives under a Windows system directory.
+func isStandardDriverPath(path string) bool {
+	lower := strings.ToLower(strings.ReplaceAll(path, "/", `\`))
+	lower = strings.TrimPrefix(lower, `\??\`)
+	if len(lower) >= 2 && lower[1] == ':' {
+		lower = lower[2:]
+	}
+	for _, alias := range []string{`%systemroot%`, `%windir%`, `\systemroot`} {
+		if strings.HasPrefix(lower, alias) {
+			lower = `\windows` + strings.TrimPrefix(lower, alias)
+			break
+		}
+	}
+	for _, root := range standardDriverRoots {
+		if strings.HasPrefix(lower, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// amcacheSHA1 strips the four-zero prefix Amcache stores before SHA-1 hashes.
+func amcacheSHA1(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if len(id) == 44 && strings.HasPrefix(id, "0000") {
+		return id[4:]
+	}
+	return id
+}
+
+// valueMap indexes values by lowercased name.
+func valueMap(values []*regf.Value) map[string]*regf.Value {
+	byName := make(map[string]*regf.Value, len(values))
+	for _, v := range values {
+		byName[strings.ToLower(v.Name)] = v
+	}
+	return byName
+}
+
+// stringValue returns a string value, or the decimal form of an integer value.
+func stringValue(byName map[string]*regf.Value, name string) string {
+	v, ok := byName[strings.ToLower(name)]
+	if !ok {
+		return ""
+	}
+	if n, ok := v.Uint64(); ok {
+		return fmt.Sprintf("%d", n)
+	}
+	return strings.TrimSpace(v.String())
+}
+
+// boolValue returns an integer value as a boolean, or nil when absent.
+func boolValue(byName map[string]*regf.Value, name string) *bool {
+	v, ok := byName[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	n, ok := v.Uint64()
+	if !ok {
+		return nil
+	}
+	b := n != 0
+	return &b
+}
+
+// formatTime formats a time as RFC3339, or "" for the zero time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return winutil.FormatTime(t)
+}
+
+// baseName returns the final element of a Windows path.
+func baseName(path string) string {
+	if i := strings.LastIndexAny(path, `\/`); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// WriteDriverInventory parses InventoryDriverBinary (or legacy Root\File
+// driver entries) from a collected Amcache hive into driver_inventory.json.
+// A driver_inventory.json already listed in the manifest is replaced.
+func WriteDriverInventory(ctx context.Context, hivePath, outDir string, manifest *AmcacheManifest) error {
+	for _, item := range manifest.Items {
+		if item.Path == "Amcache.hve" && item.Truncated {
+			return fmt.Errorf("Amcache.hve copy is truncated")
+		}
+	}
+
+	hive, err := regf.Open(hivePath)
+	if err != nil {
+		return err
+	}
+	defer hive.Close()
+
+	inventory, err := ParseDriverInventory(hive)
+	if err != nil {
+		return err
+	}
+	inventory.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+
+	outputPath := filepath.Join(outDir, "driver_inventory.json")
+	data, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal driver inventory: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write driver inventory: %w", err)
+	}
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat driver inventory: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash driver inventory: %w", err)
+	}
+	manifest.RemoveItem("driver_inventory.json")
+	note := fmt.Sprintf("Amcache driver inventory, %s schema (%d drivers, %d findings)", inventory.Schema, len(inventory.Drivers), len(inventory.Findings))
+	manifest.AddItem("driver_inventory.json", stat.Size(), sha256Hex, false, stat.ModTime(), "driver_inventory", note)
+
+	return nil
+}
+
+// AnalyzeDriverInventory rebuilds driver_inventory.json from the Amcache.hve
+// copy in a collected windows/amcache directory, for the analyze command.
+func AnalyzeDriverInventory(ctx context.Context, moduleDir string) ([]string, error) {
+	amcacheDir := filepath.Join(moduleDir, "windows", "amcache")
+	hivePath := filepath.Join(amcacheDir, "Amcache.hve")
+	if _, err := os.Stat(hivePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	manifestPath := filepath.Join(amcacheDir, "manifest.json")
+	manifest, err := LoadAmcacheManifest(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read amcache manifest: %w", err)
+	}
+	if err := WriteDriverInventory(ctx, hivePath, amcacheDir, manifest); err != nil {
+		return nil, err
+	}
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return []string{"windows/amcache/driver_inventory.json"}, fmt.Errorf("failed to write amcache manifest: %w", err)
+	}
+	return []string{"windows/amcache/driver_inventory.json", "windows/amcache/manifest.json"}, nil
+}
@@ -0,0 +1,148 @@
+package win_amcache
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+)
+
+// sampleKeyWritten is when the fixture entries were last updated.
+var sampleKeyWritten = time.Date(2024, 2, 27, 22, 41, 7, 0, time.UTC)
+
+// driverBinary returns an InventoryDriverBinary entry as Windows 10 1709 and
+// later write it: a subkey named by the lowercased path, with the SHA-1
+// behind a four-zero prefix in DriverId.
+func driverBinary(path, sha1 string, signed, kernelMode uint32, service string) *regftest.Key {
+	return &regftest.Key{
+		Name:        path,
+		LastWritten: sampleKeyWritten,
+		Values: []regftest.Value{
+			regftest.String("DriverName", path[strings.LastIndex(path, "/")+1:]),
+			regftest.String("DriverId", "0000"+sha1),
+			regftest.DWORD("DriverSigned", signed),
+			regftest.DWORD("DriverIsKernelMode", kernelMode),
+			regftest.DWORD("DriverInBox", 0),
+			regftest.String("Service", service),
+			regftest.String("DriverCompany", "Micro-Star Int'l Co. Ltd."),
+			regftest.String("DriverVersion", "1.0.0.4"),
+			regftest.QWORD("DriverTimeStamp", 1437955200),
+			regftest.String("DriverLastWriteTime", "02/27/2024 22:40:51"),
+		},
+	}
+}
+
+func TestParseDriverInventoryBinary(t *testing.T) {
+	hivePath := regftest.WriteFile(t, "Amcache.hve", &regftest.Key{
+		Name: "{8d2c1e0a-2b3c-11ee-9a5d-806e6f6e6963}",
+		Subkeys: []*regftest.Key{{
+			Name: "Root",
+			Subkeys: []*regftest.Key{
+				{Name: "InventoryApplicationFile"},
+				{Name: "InventoryDriverBinary", Subkeys: []*regftest.Key{
+					driverBinary("c:/windows/system32/drivers/ntfs.sys", "1f0d8b4d3e3c6a9b1a0b6cbe5f3a2d1c0e9f8a7b", 1, 1, "Ntfs"),
+					driverBinary("c:/programdata/msi/rtcore64.sys", "F6F11AD2CD2B0CF95ED42324876BEE1D83E01775", 0, 1, "RTCore64"),
+				}},
+			},
+		}},
+	})
+
+	hive, err := regf.Open(hivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hive.Close()
+	inventory, err := ParseDriverInventory(hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inventory.Schema != SchemaInventory || inventory.HiveDirty || len(inventory.Drivers) != 2 || len(inventory.Errors) != 0 {
+		t.Fatalf("inventory = %+v", inventory)
+	}
+
+	ntfs, rtcore := inventory.Drivers[0], inventory.Drivers[1]
+	if ntfs.Path != `c:\windows\system32\drivers\ntfs.sys` || ntfs.SHA1 != "1f0d8b4d3e3c6a9b1a0b6cbe5f3a2d1c0e9f8a7b" || ntfs.Signed == nil || !*ntfs.Signed || len(ntfs.Flags) != 0 {
+		t.Errorf("ntfs.sys = %+v", ntfs)
+	}
+	if rtcore.SHA1 != "f6f11ad2cd2b0cf95ed42324876bee1d83e01775" || rtcore.Signed == nil || *rtcore.Signed || rtcore.KernelMode == nil || !*rtcore.KernelMode {
+		t.Errorf("RTCore64.sys signing fields = %+v", rtcore)
+	}
+	if rtcore.Name != "rtcore64.sys" || rtcore.Service != "RTCore64" || rtcore.DriverVersion != "1.0.0.4" || rtcore.InBox == nil || *rtcore.InBox {
+		t.Errorf("RTCore64.sys = %+v", rtcore)
+	}
+	if rtcore.LinkTime != "2015-07-27T00:00:00Z" || rtcore.KeyLastWritten != "2024-02-27T22:41:07Z" {
+		t.Errorf("RTCore64.sys times = %s, %s", rtcore.LinkTime, rtcore.KeyLastWritten)
+	}
+	if !reflect.DeepEqual(rtcore.Flags, []string{"unsigned", "off_path"}) {
+		t.Errorf("RTCore64.sys flags = %v", rtcore.Flags)
+	}
+	want := []string{
+		`unsigned: unsigned kernel-mode driver c:\programdata\msi\rtcore64.sys (sha1 f6f11ad2cd2b0cf95ed42324876bee1d83e01775)`,
+		`off_path: driver outside the system driver directories c:\programdata\msi\rtcore64.sys (sha1 f6f11ad2cd2b0cf95ed42324876bee1d83e01775)`,
+	}
+	if !reflect.DeepEqual(inventory.Findings, want) {
+		t.Errorf("findings = %q", inventory.Findings)
+	}
+}
+
+func TestParseDriverInventoryLegacyFile(t *testing.T) {
+	written := time.Date(2016, 5, 4, 10, 30, 0, 0, time.UTC)
+	file := func(id, path, sha1 string) *regftest.Key {
+		return &regftest.Key{Name: id, Values: []regftest.Value{
+			regftest.String("0", "Sample Product"),
+			regftest.String("1", "Sample Co"),
+			regftest.String("15", path),
+			regftest.String("101", "0000"+sha1),
+			regftest.QWORD("17", regftest.Filetime(written)),
+		}}
+	}
+	data := regftest.Build(&regftest.Key{
+		Name: "ROOT",
+		Subkeys: []*regftest.Key{{Name: "Root", Subkeys: []*regftest.Key{{Name: "File", Subkeys: []*regftest.Key{{
+			Name: "c5a8b4e2-0000-0000-0000-100000000000",
+			Subkeys: []*regftest.Key{
+				file("1a", `C:\Windows\System32\notepad.exe`, "ab"),
+				file("2f", `%SystemRoot%\System32\drivers\tcpip.sys`, "3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f"),
+			},
+		}}}}}},
+	})
+	hive, err := regf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inventory, err := ParseDriverInventory(hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inventory.Schema != SchemaLegacy || len(inventory.Drivers) != 1 || len(inventory.Findings) != 0 {
+		t.Fatalf("inventory = %+v", inventory)
+	}
+	tcpip := inventory.Drivers[0]
+	if tcpip.Name != "tcpip.sys" || tcpip.SHA1 != "3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f" || tcpip.Signed != nil || tcpip.Company != "Sample Co" {
+		t.Errorf("tcpip.sys = %+v", tcpip)
+	}
+	if tcpip.LastWriteTime != "2016-05-04T10:30:00Z" || tcpip.LastWriteRaw != regftest.Filetime(written) {
+		t.Errorf("tcpip.sys write time = %s (%d)", tcpip.LastWriteTime, tcpip.LastWriteRaw)
+	}
+}
+
+func TestIsStandardDriverPath(t *testing.T) {
+	tests := map[string]bool{
+		`C:\Windows\System32\drivers\disk.sys`:    true,
+		`\SystemRoot\System32\drivers\acpi.sys`:   true,
+		`\??\C:\Windows\SysWOW64\drivers\x.sys`:   true,
+		`%windir%\WinSxS\amd64_x\y.sys`:           true,
+		`c:/windows/system32/drivers/ntfs.sys`:    true,
+		`C:\Windows\Temp\gdrv.sys`:                false,
+		`C:\Users\alice\AppData\Local\Temp\a.sys`: false,
+	}
+	for path, want := range tests {
+		if got := isStandardDriverPath(path); got != want {
+			t.Errorf("isStandardDriverPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
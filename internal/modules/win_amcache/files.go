@@ -0,0 +1,73 @@
+package win_amcache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cryptkeeper/internal/regf"
+)
+
+// ApplicationFile is an executable recorded under Root\InventoryApplicationFile.
+// Windows adds an entry when a program is installed or first run, so the key
+// write time approximates when the file was first seen.
+type ApplicationFile struct {
+	Path           string `json:"path"`
+	Name           string `json:"name,omitempty"`
+	SHA1           string `json:"sha1,omitempty"`
+	Publisher      string `json:"publisher,omitempty"`
+	Product        string `json:"product,omitempty"`
+	Version        string `json:"version,omitempty"`
+	ProgramID      string `json:"program_id,omitempty"` // Links the entry to InventoryApplication
+	LinkDate       string `json:"link_date,omitempty"`  // PE header timestamp as recorded, e.g. 06/15/2023 10:02:11
+	KeyLastWritten string `json:"key_last_written,omitempty"`
+}
+
+// ParseApplicationFiles extracts the InventoryApplicationFile entries of an
+// Amcache hive. A hive from before Windows 10 1709 has none; its legacy
+// Root\File entries are not read.
+func ParseApplicationFiles(hive *regf.Hive) ([]ApplicationFile, []string, error) {
+	key, err := hive.OpenKey(`Root\InventoryApplicationFile`)
+	if errors.Is(err, regf.ErrNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open InventoryApplicationFile: %w", err)
+	}
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return nil, nil, fmt.Errorf("InventoryApplicationFile: %w", err)
+	}
+
+	files := make([]ApplicationFile, 0, len(subkeys))
+	var errs []string
+	for _, sub := range subkeys {
+		values, err := sub.Values()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("InventoryApplicationFile\\%s: %v", sub.Name, err))
+			continue
+		}
+		byName := valueMap(values)
+
+		file := ApplicationFile{
+			Path:           stringValue(byName, "LowerCaseLongPath"),
+			Name:           stringValue(byName, "Name"),
+			SHA1:           amcacheSHA1(stringValue(byName, "FileId")),
+			Publisher:      stringValue(byName, "Publisher"),
+			Product:        stringValue(byName, "ProductName"),
+			Version:        stringValue(byName, "Version"),
+			ProgramID:      stringValue(byName, "ProgramId"),
+			LinkDate:       stringValue(byName, "LinkDate"),
+			KeyLastWritten: formatTime(sub.LastWritten),
+		}
+		if file.Path == "" {
+			continue
+		}
+		if file.Name == "" {
+			file.Name = baseName(file.Path)
+		}
+		file.Path = strings.ReplaceAll(file.Path, "/", `\`)
+		files = append(files, file)
+	}
+	return files, errs, nil
+}
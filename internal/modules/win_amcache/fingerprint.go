@@ -0,0 +1,363 @@
+package win_amcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// Keys of the SOFTWARE hive holding the MachineGuid and InstallDate values
+// that identify the Windows installation.
+const (
+	cryptographyKey   = `Microsoft\Cryptography`
+	currentVersionKey = `Microsoft\Windows NT\CurrentVersion`
+)
+
+// virtualizationMarkers are substrings of SMBIOS and disk identifiers written
+// by common hypervisors and sandboxes, matched case-insensitively.
+var virtualizationMarkers = []struct {
+	marker   string
+	platform string
+}{
+	{"vmware", "VMware"},
+	{"virtualbox", "VirtualBox"},
+	{"vbox", "VirtualBox"},
+	{"innotek", "VirtualBox"},
+	{"qemu", "QEMU"},
+	{"kvm", "KVM"},
+	{"xen", "Xen"},
+	{"bochs", "Bochs"},
+	{"parallels", "Parallels"},
+	{"bhyve", "bhyve"},
+	{"virtual machine", "Hyper-V"},
+	{"microsoft virtual disk", "Hyper-V"},
+	{"virtual hd", "Hyper-V"},
+	{"amazon ec2", "Amazon EC2"},
+	{"google compute engine", "Google Compute Engine"},
+}
+
+// HardwareBIOS is the firmware reported by Win32_BIOS.
+type HardwareBIOS struct {
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Version      string `json:"version,omitempty"` // SMBIOSBIOSVersion
+	ReleaseDate  string `json:"release_date,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+}
+
+// HardwareBaseBoard is the motherboard reported by Win32_BaseBoard.
+type HardwareBaseBoard struct {
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Product      string `json:"product,omitempty"`
+	Version      string `json:"version,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+}
+
+// HardwareProcessor is one CPU reported by Win32_Processor.
+type HardwareProcessor struct {
+	Name              string `json:"name"`
+	Manufacturer      string `json:"manufacturer,omitempty"`
+	ProcessorID       string `json:"processor_id,omitempty"`
+	Cores             int    `json:"cores,omitempty"`
+	LogicalProcessors int    `json:"logical_processors,omitempty"`
+}
+
+// HardwareDisk is one physical disk reported by Win32_DiskDrive.
+type HardwareDisk struct {
+	Model         string `json:"model"`
+	SerialNumber  string `json:"serial_number,omitempty"`
+	InterfaceType string `json:"interface_type,omitempty"`
+	SizeBytes     uint64 `json:"size_bytes,omitempty"`
+	PNPDeviceID   string `json:"pnp_device_id,omitempty"`
+}
+
+// HardwareTPM describes the TPM reported by Win32_Tpm.
+type HardwareTPM struct {
+	Present         bool   `json:"present"`
+	Enabled         bool   `json:"enabled,omitempty"`
+	Activated       bool   `json:"activated,omitempty"`
+	Manufacturer    string `json:"manufacturer,omitempty"` // ManufacturerIdTxt
+	FirmwareVersion string `json:"firmware_version,omitempty"`
+	SpecVersion     string `json:"spec_version,omitempty"`
+	Error           string `json:"error,omitempty"` // Win32_Tpm needs elevation; presence is unknown when it fails
+}
+
+// HardwareFingerprint is the structure written to hardware_fingerprint.json.
+type HardwareFingerprint struct {
+	CollectedUTC             string              `json:"collected_utc"`
+	Manufacturer             string              `json:"manufacturer,omitempty"`
+	Model                    string              `json:"model,omitempty"`
+	SystemFamily             string              `json:"system_family,omitempty"`
+	SystemSKU                string              `json:"system_sku,omitempty"`
+	SystemSerialNumber       string              `json:"system_serial_number,omitempty"` // Win32_ComputerSystemProduct.IdentifyingNumber
+	SystemUUID               string              `json:"system_uuid,omitempty"`          // SMBIOS UUID
+	BIOS                     HardwareBIOS        `json:"bios"`
+	BaseBoard                HardwareBaseBoard   `json:"baseboard"`
+	Processors               []HardwareProcessor `json:"processors"`
+	Disks                    []HardwareDisk      `json:"disks"`
+	TPM                      *HardwareTPM        `json:"tpm,omitempty"`
+	MachineGUID              string              `json:"machine_guid,omitempty"`
+	InstallDate              string              `json:"install_date,omitempty"`
+	HypervisorPresent        bool                `json:"hypervisor_present"` // Also true on physical hosts running VBS or Hyper-V
+	Virtualized              bool                `json:"virtualized"`
+	VirtualizationPlatform   string              `json:"virtualization_platform,omitempty"`
+	VirtualizationIndicators []string            `json:"virtualization_indicators,omitempty"`
+	Errors                   []string            `json:"errors,omitempty"`
+}
+
+// NewHardwareFingerprint returns an empty fingerprint.
+func NewHardwareFingerprint() *HardwareFingerprint {
+	return &HardwareFingerprint{
+		Processors: make([]HardwareProcessor, 0),
+		Disks:      make([]HardwareDisk, 0),
+	}
+}
+
+// rawHardwareInfo mirrors the object emitted by the hardware PowerShell script.
+type rawHardwareInfo struct {
+	ComputerSystem *struct {
+		Manufacturer      string `json:"Manufacturer"`
+		Model             string `json:"Model"`
+		SystemFamily      string `json:"SystemFamily"`
+		SystemSKUNumber   string `json:"SystemSKUNumber"`
+		HypervisorPresent bool   `json:"HypervisorPresent"`
+	} `json:"ComputerSystem"`
+	BIOS *struct {
+		Manufacturer      string `json:"Manufacturer"`
+		SMBIOSBIOSVersion string `json:"SMBIOSBIOSVersion"`
+		SerialNumber      string `json:"SerialNumber"`
+		ReleaseDate       string `json:"ReleaseDate"`
+	} `json:"BIOS"`
+	BaseBoard *struct {
+		Manufacturer string `json:"Manufacturer"`
+		Product      string `json:"Product"`
+		Version      string `json:"Version"`
+		SerialNumber string `json:"SerialNumber"`
+	} `json:"BaseBoard"`
+	Product *struct {
+		Vendor            string `json:"Vendor"`
+		Name              string `json:"Name"`
+		IdentifyingNumber string `json:"IdentifyingNumber"`
+		UUID              string `json:"UUID"`
+	} `json:"Product"`
+	Processors []struct {
+		Name                      string `json:"Name"`
+		Manufacturer              string `json:"Manufacturer"`
+		ProcessorID               string `json:"ProcessorId"`
+		NumberOfCores             int    `json:"NumberOfCores"`
+		NumberOfLogicalProcessors int    `json:"NumberOfLogicalProcessors"`
+	} `json:"Processors"`
+	Disks []struct {
+		Model         string `json:"Model"`
+		SerialNumber  string `json:"SerialNumber"`
+		InterfaceType string `json:"InterfaceType"`
+		Size          uint64 `json:"Size"`
+		PNPDeviceID   string `json:"PNPDeviceID"`
+	} `json:"Disks"`
+	Tpm *struct {
+		IsEnabled           bool   `json:"IsEnabled_InitialValue"`
+		IsActivated         bool   `json:"IsActivated_InitialValue"`
+		ManufacturerIDTxt   string `json:"ManufacturerIdTxt"`
+		ManufacturerVersion string `json:"ManufacturerVersion"`
+		SpecVersion         string `json:"SpecVersion"`
+	} `json:"Tpm"`
+	TpmError string `json:"TpmError"`
+}
+
+// ParseHardwareInfo assembles a fingerprint from the JSON printed by the
+// hardware Get-CimInstance script, and flags signs of virtualization.
+func ParseHardwareInfo(data []byte) (*HardwareFingerprint, error) {
+	var raw rawHardwareInfo
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse hardware query output: %w", err)
+	}
+
+	fp := NewHardwareFingerprint()
+	if cs := raw.ComputerSystem; cs != nil {
+		fp.Manufacturer = strings.TrimSpace(cs.Manufacturer)
+		fp.Model = strings.TrimSpace(cs.Model)
+		fp.SystemFamily = strings.TrimSpace(cs.SystemFamily)
+		fp.SystemSKU = strings.TrimSpace(cs.SystemSKUNumber)
+		fp.HypervisorPresent = cs.HypervisorPresent
+	}
+	if bios := raw.BIOS; bios != nil {
+		fp.BIOS = HardwareBIOS{
+			Manufacturer: strings.TrimSpace(bios.Manufacturer),
+			Version:      strings.TrimSpace(bios.SMBIOSBIOSVersion),
+			SerialNumber: strings.TrimSpace(bios.SerialNumber),
+		}
+		if t, err := time.Parse(time.RFC3339, bios.ReleaseDate); err == nil {
+			fp.BIOS.ReleaseDate = winutil.FormatTime(t)
+		}
+	}
+	if board := raw.BaseBoard; board != nil {
+		fp.BaseBoard = HardwareBaseBoard{
+			Manufacturer: strings.TrimSpace(board.Manufacturer),
+			Product:      strings.TrimSpace(board.Product),
+			Version:      strings.TrimSpace(board.Version),
+			SerialNumber: strings.TrimSpace(board.SerialNumber),
+		}
+	}
+	if product := raw.Product; product != nil {
+		fp.SystemSerialNumber = strings.TrimSpace(product.IdentifyingNumber)
+		fp.SystemUUID = strings.TrimSpace(product.UUID)
+		if fp.Manufacturer == "" {
+			fp.Manufacturer = strings.TrimSpace(product.Vendor)
+		}
+		if fp.Model == "" {
+			fp.Model = strings.TrimSpace(product.Name)
+		}
+	}
+	for _, cpu := range raw.Processors {
+		fp.Processors = append(fp.Processors, HardwareProcessor{
+			Name:              strings.TrimSpace(cpu.Name),
+			Manufacturer:      strings.TrimSpace(cpu.Manufacturer),
+			ProcessorID:       strings.TrimSpace(cpu.ProcessorID),
+			Cores:             cpu.NumberOfCores,
+			LogicalProcessors: cpu.NumberOfLogicalProcessors,
+		})
+	}
+	for _, disk := range raw.Disks {
+		fp.Disks = append(fp.Disks, HardwareDisk{
+			Model:         strings.TrimSpace(disk.Model),
+			SerialNumber:  strings.TrimSpace(disk.SerialNumber),
+			InterfaceType: strings.TrimSpace(disk.InterfaceType),
+			SizeBytes:     disk.Size,
+			PNPDeviceID:   disk.PNPDeviceID,
+		})
+	}
+	switch {
+	case raw.Tpm != nil:
+		fp.TPM = &HardwareTPM{
+			Present:         true,
+			Enabled:         raw.Tpm.IsEnabled,
+			Activated:       raw.Tpm.IsActivated,
+			Manufacturer:    strings.TrimSpace(raw.Tpm.ManufacturerIDTxt),
+			FirmwareVersion: strings.TrimSpace(raw.Tpm.ManufacturerVersion),
+			SpecVersion:     strings.TrimSpace(raw.Tpm.SpecVersion),
+		}
+	case raw.TpmError != "":
+		fp.TPM = &HardwareTPM{Error: raw.TpmError}
+	default:
+		fp.TPM = &HardwareTPM{}
+	}
+
+	fp.VirtualizationPlatform, fp.VirtualizationIndicators = DetectVirtualization(fp)
+	fp.Virtualized = len(fp.VirtualizationIndicators) > 0
+	return fp, nil
+}
+
+// DetectVirtualization looks for hypervisor vendor strings in the SMBIOS,
+// processor, and disk identifiers of a fingerprint. It returns the first
+// platform matched and one indicator per matching field. HypervisorPresent
+// alone is not treated as a sign, since virtualization-based security sets it
+// on physical machines.
+func DetectVirtualization(fp *HardwareFingerprint) (string, []string) {
+	type field struct{ name, value string }
+	fields := []field{
+		{"manufacturer", fp.Manufacturer},
+		{"model", fp.Model},
+		{"system_family", fp.SystemFamily},
+		{"bios_manufacturer", fp.BIOS.Manufacturer},
+		{"bios_version", fp.BIOS.Version},
+		{"bios_serial_number", fp.BIOS.SerialNumber},
+		{"baseboard_manufacturer", fp.BaseBoard.Manufacturer},
+		{"baseboard_product", fp.BaseBoard.Product},
+	}
+	for _, cpu := range fp.Processors {
+		fields = append(fields, field{"processor_name", cpu.Name})
+	}
+	for _, disk := range fp.Disks {
+		fields = append(fields, field{"disk_model", disk.Model}, field{"disk_pnp_device_id", disk.PNPDeviceID})
+	}
+
+	var platform string
+	var indicators []string
+	for _, field := range fields {
+		lower := strings.ToLower(field.value)
+		for _, m := range virtualizationMarkers {
+			if !strings.Contains(lower, m.marker) {
+				continue
+			}
+			if platform == "" {
+				platform = m.platform
+			}
+			indicators = append(indicators, fmt.Sprintf("%s: %s", field.name, field.value))
+			break
+		}
+	}
+	return platform, indicators
+}
+
+// SetInstallationIdentity records the MachineGuid and the InstallDate value,
+// which holds Unix seconds.
+func (fp *HardwareFingerprint) SetInstallationIdentity(machineGUID string, installDate uint64) {
+	fp.MachineGUID = strings.TrimSpace(machineGUID)
+	if installDate > 0 {
+		fp.InstallDate = winutil.FormatTime(time.Unix(int64(installDate), 0))
+	}
+}
+
+// InstallationIdentityFromHive reads MachineGuid and InstallDate from a
+// SOFTWARE hive file.
+func InstallationIdentityFromHive(hivePath string) (string, uint64, error) {
+	hive, err := regf.Open(hivePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer hive.Close()
+
+	var machineGUID string
+	var installDate uint64
+	key, err := hive.OpenKey(cryptographyKey)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %w", cryptographyKey, err)
+	}
+	if value, err := key.Value("MachineGuid"); err == nil {
+		machineGUID = value.String()
+	}
+	if key, err := hive.OpenKey(currentVersionKey); err == nil {
+		if value, err := key.Value("InstallDate"); err == nil {
+			installDate, _ = value.Uint64()
+		}
+	}
+	return machineGUID, installDate, nil
+}
+
+// WriteHardwareFingerprint writes hardware_fingerprint.json to outDir.
+func WriteHardwareFingerprint(ctx context.Context, fp *HardwareFingerprint, outDir string, manifest *AmcacheManifest) error {
+	fp.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+
+	outputPath := filepath.Join(outDir, "hardware_fingerprint.json")
+	data, err := json.MarshalIndent(fp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal hardware fingerprint: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write hardware fingerprint: %w", err)
+	}
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat hardware fingerprint: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash hardware fingerprint: %w", err)
+	}
+	note := "Hardware and installation identifiers (SMBIOS, CPU, disks, TPM, MachineGuid)"
+	if fp.Virtualized {
+		note += fmt.Sprintf("; virtualization indicators found (%s)", fp.VirtualizationPlatform)
+	}
+	manifest.AddItem("hardware_fingerprint.json", stat.Size(), sha256Hex, false, stat.ModTime(), "hardware_fingerprint", note)
+
+	return nil
+}
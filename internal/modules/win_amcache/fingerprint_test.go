@@ -0,0 +1,115 @@
+package win_amcache
+
+import (
+	"reflect"
+	"testing"
+
+	"cryptkeeper/internal/regf/regftest"
+)
+
+// vmwareHardware is the hardware script's output on a VMware Workstation
+// guest, as PowerShell writes it: with a byte order mark and padded strings.
+const vmwareHardware = "\xef\xbb\xbf" + `{"ComputerSystem":{"Manufacturer":"VMware, Inc.","Model":"VMware7,1","SystemFamily":"","SystemSKUNumber":null,"HypervisorPresent":true},` +
+	`"BIOS":{"Manufacturer":"VMware, Inc.","SMBIOSBIOSVersion":"VMW71.00V.21100432.B64.2301110304","SerialNumber":"VMware-56 4d 8a 1c 2e 3f 4a 5b-6c 7d 8e 9f a0 b1 c2 d3","ReleaseDate":"2023-01-11T00:00:00Z"},` +
+	`"BaseBoard":{"Manufacturer":"Intel Corporation","Product":"440BX Desktop Reference Platform","Version":"None","SerialNumber":"None"},` +
+	`"Product":{"Vendor":"VMware, Inc.","Name":"VMware7,1","IdentifyingNumber":"VMware-56 4d 8a 1c 2e 3f 4a 5b-6c 7d 8e 9f a0 b1 c2 d3","UUID":"1C8A4D56-3F2E-5B4A-6C7D-8E9FA0B1C2D3"},` +
+	`"Processors":[{"Name":"Intel(R) Core(TM) i7-12700H","Manufacturer":"GenuineIntel","ProcessorId":"0FABFBFF000906A3","NumberOfCores":4,"NumberOfLogicalProcessors":4}],` +
+	`"Disks":[{"Model":"VMware Virtual NVMe Disk","SerialNumber":"  6000c29d1e5a4b3c  ","InterfaceType":"SCSI","Size":85896599040,"PNPDeviceID":"SCSI\\DISK&VEN_NVME&PROD_VMWARE_VIRTUAL_N\\5&1982005&0&000000"}],` +
+	`"Tpm":null,"TpmError":"Access denied"}` + "\r\n"
+
+// dellHardware is the output on a physical laptop running virtualization-
+// based security, which sets HypervisorPresent.
+const dellHardware = `{"ComputerSystem":{"Manufacturer":"Dell Inc.","Model":"Latitude 7440","SystemFamily":"Latitude","SystemSKUNumber":"0C0D","HypervisorPresent":true},` +
+	`"BIOS":{"Manufacturer":"Dell Inc.","SMBIOSBIOSVersion":"1.9.1","SerialNumber":"7XK2LM3","ReleaseDate":""},` +
+	`"BaseBoard":{"Manufacturer":"Dell Inc.","Product":"0R1VT4","Version":"A00","SerialNumber":"/7XK2LM3/CNWS20039F00A1/"},` +
+	`"Product":{"Vendor":"Dell Inc.","Name":"Latitude 7440","IdentifyingNumber":"7XK2LM3","UUID":"4C4C4544-0058-4B10-8032-B7C04F4C4D33"},` +
+	`"Processors":[{"Name":"13th Gen Intel(R) Core(TM) i7-1365U","Manufacturer":"GenuineIntel","ProcessorId":"BFEBFBFF000B0671","NumberOfCores":10,"NumberOfLogicalProcessors":12}],` +
+	`"Disks":[{"Model":"KXG80ZNV512G KIOXIA","SerialNumber":"8CE3_8E10_0204_AB11.","InterfaceType":"SCSI","Size":512105932800,"PNPDeviceID":"SCSI\\DISK&VEN_NVME&PROD_KXG80ZNV512G_KIO\\5&2B7C1A4&0&000000"}],` +
+	`"Tpm":{"IsEnabled_InitialValue":true,"IsActivated_InitialValue":true,"ManufacturerIdTxt":"STM ","ManufacturerVersion":"1.769.0.0","SpecVersion":"2.0, 0, 1.59"},"TpmError":""}`
+
+func TestParseHardwareInfoFlagsVirtualMachines(t *testing.T) {
+	fp, err := ParseHardwareInfo([]byte(vmwareHardware))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.Manufacturer != "VMware, Inc." || fp.Model != "VMware7,1" || fp.SystemUUID != "1C8A4D56-3F2E-5B4A-6C7D-8E9FA0B1C2D3" || fp.SystemSerialNumber == "" {
+		t.Errorf("system = %+v", fp)
+	}
+	if fp.BIOS.Version != "VMW71.00V.21100432.B64.2301110304" || fp.BIOS.ReleaseDate != "2023-01-11T00:00:00Z" {
+		t.Errorf("bios = %+v", fp.BIOS)
+	}
+	wantDisks := []HardwareDisk{{
+		Model:         "VMware Virtual NVMe Disk",
+		SerialNumber:  "6000c29d1e5a4b3c",
+		InterfaceType: "SCSI",
+		SizeBytes:     85896599040,
+		PNPDeviceID:   `SCSI\DISK&VEN_NVME&PROD_VMWARE_VIRTUAL_N\5&1982005&0&000000`,
+	}}
+	if !reflect.DeepEqual(fp.Disks, wantDisks) || len(fp.Processors) != 1 || fp.Processors[0].Cores != 4 {
+		t.Errorf("processors %+v, disks %+v", fp.Processors, fp.Disks)
+	}
+	// Without elevation the TPM is unknown, not absent
+	if want := (&HardwareTPM{Error: "Access denied"}); !reflect.DeepEqual(fp.TPM, want) {
+		t.Errorf("tpm = %+v", fp.TPM)
+	}
+
+	wantIndicators := []string{
+		"manufacturer: VMware, Inc.",
+		"model: VMware7,1",
+		"bios_manufacturer: VMware, Inc.",
+		"bios_serial_number: VMware-56 4d 8a 1c 2e 3f 4a 5b-6c 7d 8e 9f a0 b1 c2 d3",
+		"disk_model: VMware Virtual NVMe Disk",
+		`disk_pnp_device_id: SCSI\DISK&VEN_NVME&PROD_VMWARE_VIRTUAL_N\5&1982005&0&000000`,
+	}
+	if !fp.Virtualized || fp.VirtualizationPlatform != "VMware" || !reflect.DeepEqual(fp.VirtualizationIndicators, wantIndicators) {
+		t.Fatalf("virtualization = %v %q %q", fp.Virtualized, fp.VirtualizationPlatform, fp.VirtualizationIndicators)
+	}
+}
+
+func TestParseHardwareInfoPhysicalHost(t *testing.T) {
+	fp, err := ParseHardwareInfo([]byte(dellHardware))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// HypervisorPresent alone does not make a physical host virtual
+	if !fp.HypervisorPresent || fp.Virtualized || fp.VirtualizationPlatform != "" || fp.VirtualizationIndicators != nil {
+		t.Errorf("virtualization = %v %q %q", fp.Virtualized, fp.VirtualizationPlatform, fp.VirtualizationIndicators)
+	}
+	if want := (HardwareBaseBoard{Manufacturer: "Dell Inc.", Product: "0R1VT4", Version: "A00", SerialNumber: "/7XK2LM3/CNWS20039F00A1/"}); fp.BaseBoard != want {
+		t.Errorf("baseboard = %+v", fp.BaseBoard)
+	}
+	if fp.BIOS.ReleaseDate != "" || fp.SystemSKU != "0C0D" || fp.Processors[0].LogicalProcessors != 12 {
+		t.Errorf("fingerprint = %+v", fp)
+	}
+	wantTPM := &HardwareTPM{Present: true, Enabled: true, Activated: true, Manufacturer: "STM", FirmwareVersion: "1.769.0.0", SpecVersion: "2.0, 0, 1.59"}
+	if !reflect.DeepEqual(fp.TPM, wantTPM) {
+		t.Errorf("tpm = %+v", fp.TPM)
+	}
+
+	if _, err := ParseHardwareInfo([]byte("Get-CimInstance : Invalid class")); err == nil {
+		t.Error("PowerShell error text parsed as a fingerprint")
+	}
+}
+
+func TestInstallationIdentityFromHive(t *testing.T) {
+	hivePath := regftest.WriteFile(t, "SOFTWARE", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		regftest.Path("Microsoft",
+			&regftest.Key{Name: "Cryptography", Values: []regftest.Value{regftest.String("MachineGuid", "6b1f2c3d-4e5f-4a6b-8c7d-9e0fa1b2c3d4")}},
+			regftest.Path("Windows NT", &regftest.Key{Name: "CurrentVersion", Values: []regftest.Value{regftest.DWORD("InstallDate", 1700000000)}}),
+		),
+	}})
+	machineGUID, installDate, err := InstallationIdentityFromHive(hivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := NewHardwareFingerprint()
+	fp.SetInstallationIdentity(machineGUID, installDate)
+	if fp.MachineGUID != "6b1f2c3d-4e5f-4a6b-8c7d-9e0fa1b2c3d4" || fp.InstallDate != "2023-11-14T22:13:20Z" {
+		t.Fatalf("identity = %q installed %q", fp.MachineGUID, fp.InstallDate)
+	}
+
+	// A hive without the Cryptography key cannot identify the installation
+	if _, _, err := InstallationIdentityFromHive(regftest.WriteFile(t, "SOFTWARE", &regftest.Key{Name: "ROOT"})); err == nil {
+		t.Error("hive without a MachineGuid read without error")
+	}
+}
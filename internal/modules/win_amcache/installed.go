@@ -0,0 +1,344 @@
+package win_amcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// Installed-software sources reconciled into installed_programs.json.
+const (
+	SourceMachineUninstall = "hklm_uninstall"       // SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall
+	SourceWOW64Uninstall   = "hklm_wow64_uninstall" // SOFTWARE\WOW6432Node\...\Uninstall, 32-bit installers
+	SourceUserUninstall    = "hkcu_uninstall"       // NTUSER.DAT Software\...\Uninstall, per-user installers
+	SourceGetPackage       = "get_package"          // PackageManagement's Get-Package on the live system
+	SourceAmcache          = "amcache_inventory"    // Amcache.hve Root\InventoryApplication, kept after uninstall
+)
+
+// Uninstall keys, relative to the hive that holds them.
+const (
+	machineUninstallKey = `Microsoft\Windows\CurrentVersion\Uninstall`
+	wow64UninstallKey   = `WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`
+	userUninstallKey    = `Software\Microsoft\Windows\CurrentVersion\Uninstall`
+)
+
+// ProgramSource is one place a program was recorded.
+type ProgramSource struct {
+	Source          string `json:"source"`
+	User            string `json:"user,omitempty"` // Profile of the hive, for hkcu_uninstall
+	Key             string `json:"key,omitempty"`  // Uninstall subkey name, often the product code
+	KeyLastWriteUTC string `json:"key_last_write_utc,omitempty"`
+	Version         string `json:"version,omitempty"`
+	InstallDate     string `json:"install_date,omitempty"`
+	InstallLocation string `json:"install_location,omitempty"`
+	UninstallString string `json:"uninstall_string,omitempty"`
+	Provider        string `json:"provider,omitempty"` // Get-Package provider, e.g. Programs or msi, or the Amcache Source value
+}
+
+// InstalledProgram is a program merged across sources by display name.
+type InstalledProgram struct {
+	Name        string          `json:"name"`
+	Publisher   string          `json:"publisher,omitempty"`
+	Versions    []string        `json:"versions"`
+	InstallDate string          `json:"install_date,omitempty"` // Earliest across sources
+	Sources     []ProgramSource `json:"sources"`
+	Flags       []string        `json:"flags,omitempty"`
+
+	installed time.Time
+}
+
+// InstalledProgramsReport is the content of installed_programs.json.
+type InstalledProgramsReport struct {
+	CollectedUTC string             `json:"collected_utc"`
+	Since        string             `json:"since,omitempty"`
+	SourcesRead  []string           `json:"sources_read"`
+	ProgramCount int                `json:"program_count"`
+	FlaggedCount int                `json:"flagged_count"`
+	Programs     []InstalledProgram `json:"programs"`
+	Errors       []string           `json:"errors,omitempty"`
+
+	byName map[string]*InstalledProgram
+	read   map[string]bool
+}
+
+// NewInstalledProgramsReport returns an empty report.
+func NewInstalledProgramsReport() *InstalledProgramsReport {
+	return &InstalledProgramsReport{
+		SourcesRead: make([]string, 0),
+		Programs:    make([]InstalledProgram, 0),
+		byName:      make(map[string]*InstalledProgram),
+		read:        make(map[string]bool),
+	}
+}
+
+// programKey normalizes a display name for matching across sources.
+func programKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// add merges one sighting of a program into the report.
+func (r *InstalledProgramsReport) add(name, publisher string, source ProgramSource, installed time.Time) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return
+	}
+	key := programKey(name)
+	program, ok := r.byName[key]
+	if !ok {
+		program = &InstalledProgram{Name: name, Versions: make([]string, 0), Sources: make([]ProgramSource, 0)}
+		r.byName[key] = program
+	}
+	if program.Publisher == "" {
+		program.Publisher = strings.TrimSpace(publisher)
+	}
+	if source.Version != "" && !containsString(program.Versions, source.Version) {
+		program.Versions = append(program.Versions, source.Version)
+	}
+	if !installed.IsZero() && (program.installed.IsZero() || installed.Before(program.installed)) {
+		program.installed = installed
+		program.InstallDate = winutil.FormatTime(installed)
+	}
+	program.Sources = append(program.Sources, source)
+}
+
+// markRead records that a source was read, so that single-source flags are
+// only raised when there was something to reconcile against.
+func (r *InstalledProgramsReport) markRead(source string) {
+	if !r.read[source] {
+		r.read[source] = true
+		r.SourcesRead = append(r.SourcesRead, source)
+	}
+}
+
+// AddUninstallKeys adds the programs under an uninstall key. A missing key,
+// such as WOW6432Node on 32-bit Windows, only marks the source unread.
+func (r *InstalledProgramsReport) AddUninstallKeys(hive *regf.Hive, keyPath, source, user string) error {
+	key, err := hive.OpenKey(keyPath)
+	if err != nil {
+		return nil
+	}
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return fmt.Errorf("%s: %w", keyPath, err)
+	}
+	r.markRead(source)
+	for _, sub := range subkeys {
+		values, err := sub.Values()
+		if err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("%s\\%s: %v", keyPath, sub.Name, err))
+			continue
+		}
+		byName := valueMap(values)
+		// Hotfixes and components without a name are not listed as programs
+		name := stringValue(byName, "DisplayName")
+		if name == "" {
+			continue
+		}
+		installDate := stringValue(byName, "InstallDate")
+		programSource := ProgramSource{
+			Source:          source,
+			User:            user,
+			Key:             sub.Name,
+			KeyLastWriteUTC: formatTime(sub.LastWritten),
+			Version:         stringValue(byName, "DisplayVersion"),
+			InstallDate:     installDate,
+			InstallLocation: stringValue(byName, "InstallLocation"),
+			UninstallString: stringValue(byName, "UninstallString"),
+		}
+		// Installers that omit InstallDate still write the key when they register
+		installed := parseInstallDate(installDate)
+		if installed.IsZero() {
+			installed = sub.LastWritten
+		}
+		r.add(name, stringValue(byName, "Publisher"), programSource, installed)
+	}
+	return nil
+}
+
+// AddSoftwareHive adds the machine-wide uninstall keys of a SOFTWARE hive.
+func (r *InstalledProgramsReport) AddSoftwareHive(hive *regf.Hive) error {
+	if err := r.AddUninstallKeys(hive, machineUninstallKey, SourceMachineUninstall, ""); err != nil {
+		return err
+	}
+	return r.AddUninstallKeys(hive, wow64UninstallKey, SourceWOW64Uninstall, "")
+}
+
+// AddUserHive adds the per-user uninstall key of an NTUSER.DAT hive.
+func (r *InstalledProgramsReport) AddUserHive(hive *regf.Hive, user string) error {
+	return r.AddUninstallKeys(hive, userUninstallKey, SourceUserUninstall, user)
+}
+
+// AddAmcacheHive adds the InventoryApplication entries of an Amcache hive.
+// Windows keeps an entry after the program is uninstalled until the next
+// inventory run, so a program here and not in the uninstall keys was
+// usually removed recently. A hive from before Windows 10 1709 has no
+// InventoryApplication key and only marks the source unread.
+func (r *InstalledProgramsReport) AddAmcacheHive(hive *regf.Hive) error {
+	key, err := hive.OpenKey(`Root\InventoryApplication`)
+	if err != nil {
+		return nil
+	}
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return fmt.Errorf("InventoryApplication: %w", err)
+	}
+	r.markRead(SourceAmcache)
+	for _, sub := range subkeys {
+		values, err := sub.Values()
+		if err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("InventoryApplication\\%s: %v", sub.Name, err))
+			continue
+		}
+		byName := valueMap(values)
+		installDate := stringValue(byName, "InstallDate")
+		installed := parseInstallDate(installDate)
+		if installed.IsZero() {
+			installed = sub.LastWritten
+		}
+		r.add(stringValue(byName, "Name"), stringValue(byName, "Publisher"), ProgramSource{
+			Source:          SourceAmcache,
+			Key:             sub.Name,
+			KeyLastWriteUTC: formatTime(sub.LastWritten),
+			Version:         stringValue(byName, "Version"),
+			InstallDate:     installDate,
+			InstallLocation: stringValue(byName, "RootDirPath"),
+			UninstallString: stringValue(byName, "UninstallString"),
+			Provider:        stringValue(byName, "Source"),
+		}, installed)
+	}
+	return nil
+}
+
+// getPackageEntry mirrors one object emitted by the Get-Package script.
+type getPackageEntry struct {
+	Name         string `json:"Name"`
+	Version      string `json:"Version"`
+	ProviderName string `json:"ProviderName"`
+	Publisher    string `json:"Publisher"`
+	InstallDate  string `json:"InstallDate"`
+	Location     string `json:"InstallLocation"`
+	Uninstall    string `json:"UninstallString"`
+}
+
+// AddGetPackage adds the output of the Get-Package script.
+func (r *InstalledProgramsReport) AddGetPackage(data []byte) error {
+	var entries []getPackageEntry
+	if err := unmarshalPowerShellJSON(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse Get-Package output: %w", err)
+	}
+	r.markRead(SourceGetPackage)
+	for _, entry := range entries {
+		r.add(entry.Name, entry.Publisher, ProgramSource{
+			Source:          SourceGetPackage,
+			Version:         strings.TrimSpace(entry.Version),
+			InstallDate:     strings.TrimSpace(entry.InstallDate),
+			InstallLocation: strings.TrimSpace(entry.Location),
+			UninstallString: strings.TrimSpace(entry.Uninstall),
+			Provider:        entry.ProviderName,
+		}, parseInstallDate(entry.InstallDate))
+	}
+	return nil
+}
+
+// Reconcile flags programs recorded by only one of several sources read, and
+// programs installed at or after since (when set), then orders the list by name.
+func (r *InstalledProgramsReport) Reconcile(since time.Time) {
+	if !since.IsZero() {
+		r.Since = winutil.FormatTime(since)
+	}
+	r.Programs = make([]InstalledProgram, 0, len(r.byName))
+	for _, program := range r.byName {
+		sources := make(map[string]bool)
+		for _, source := range program.Sources {
+			sources[source.Source] = true
+		}
+		program.Flags = nil
+		if len(sources) == 1 && len(r.SourcesRead) > 1 {
+			for source := range sources {
+				program.Flags = append(program.Flags, "only_in_"+source)
+			}
+		}
+		if !since.IsZero() && !program.installed.IsZero() && !program.installed.Before(since) {
+			program.Flags = append(program.Flags, "installed_since")
+		}
+		if len(program.Flags) > 0 {
+			r.FlaggedCount++
+		}
+		r.Programs = append(r.Programs, *program)
+	}
+	sort.Slice(r.Programs, func(i, j int) bool {
+		return programKey(r.Programs[i].Name) < programKey(r.Programs[j].Name)
+	})
+	r.ProgramCount = len(r.Programs)
+}
+
+// parseInstallDate reads the YYYYMMDD form installers write to InstallDate,
+// also accepting the M/D/YYYY form some write instead and the
+// MM/DD/YYYY hh:mm:ss form of Amcache.
+func parseInstallDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"20060102", "1/2/2006", "01/02/2006 15:04:05", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// unmarshalPowerShellJSON decodes ConvertTo-Json output, which emits a bare object
+// instead of an array when the pipeline yields a single item.
+func unmarshalPowerShellJSON(data []byte, v interface{}) error {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] == '{' {
+		data = append(append([]byte("["), data...), ']')
+	}
+	return json.Unmarshal(data, v)
+}
+
+// containsString reports whether list holds s.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteInstalledPrograms writes installed_programs.json to outDir.
+func WriteInstalledPrograms(ctx context.Context, report *InstalledProgramsReport, outDir string, manifest *AmcacheManifest) error {
+	report.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+
+	outputPath := filepath.Join(outDir, "installed_programs.json")
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal installed programs: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write installed programs: %w", err)
+	}
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat installed programs: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash installed programs: %w", err)
+	}
+	note := fmt.Sprintf("Installed programs reconciled across %s (%d programs, %d flagged)", strings.Join(report.SourcesRead, ", "), report.ProgramCount, report.FlaggedCount)
+	manifest.AddItem("installed_programs.json", stat.Size(), sha256Hex, false, stat.ModTime(), "installed_programs", note)
+	return nil
+}
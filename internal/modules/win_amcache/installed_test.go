@@ -0,0 +1,143 @@
+package win_amcache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+)
+
+// inventoryApplication returns an InventoryApplication entry as Windows 10
+// 1709 and later write it, keyed by the program ID.
+func inventoryApplication(programID, name, version, publisher, installDate, source string) *regftest.Key {
+	return &regftest.Key{Name: programID, LastWritten: sampleKeyWritten, Values: []regftest.Value{
+		regftest.String("ProgramId", programID),
+		regftest.String("Name", name),
+		regftest.String("Version", version),
+		regftest.String("Publisher", publisher),
+		regftest.String("InstallDate", installDate),
+		regftest.String("Source", source),
+		regftest.String("Type", "Application"),
+	}}
+}
+
+// uninstallEntry returns a SOFTWARE Uninstall subkey.
+func uninstallEntry(key, name, version, publisher, installDate string) *regftest.Key {
+	return &regftest.Key{Name: key, LastWritten: sampleKeyWritten, Values: []regftest.Value{
+		regftest.String("DisplayName", name),
+		regftest.String("DisplayVersion", version),
+		regftest.String("Publisher", publisher),
+		regftest.String("InstallDate", installDate),
+	}}
+}
+
+func openTestHive(t *testing.T, name string, root *regftest.Key) *regf.Hive {
+	t.Helper()
+	hive, err := regf.Open(regftest.WriteFile(t, name, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hive.Close() })
+	return hive
+}
+
+func TestReconcileAmcacheAgainstUninstallKeys(t *testing.T) {
+	// AnyDesk was uninstalled after the last inventory run, so only Amcache
+	// still has it; the hotfix entry has no display name
+	amcache := openTestHive(t, "Amcache.hve", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Root", Subkeys: []*regftest.Key{{Name: "InventoryApplication", Subkeys: []*regftest.Key{
+			inventoryApplication("0000f519feec486de87ed73cb92d3cac802400000000", "7-Zip 23.01 (x64)", "23.01", "Igor Pavlov", "11/20/2023 14:02:51", "AddRemoveProgram"),
+			inventoryApplication("00006b3f1a2d5c8e9f0a1b2c3d4e5f60718200000904", "AnyDesk", "8.0.8", "AnyDesk Software GmbH", "02/26/2024 23:17:40", "AddRemoveProgram"),
+		}}}},
+	}})
+	software := openTestHive(t, "SOFTWARE", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		regftest.Path(`Microsoft\Windows\CurrentVersion`, &regftest.Key{Name: "Uninstall", Subkeys: []*regftest.Key{
+			uninstallEntry("7-Zip", "7-Zip  23.01 (x64)", "23.01", "Igor Pavlov", "20231120"),
+			uninstallEntry("{D6E5C4B3-A291-4F8E-B7D6-C5B4A3928170}", "Remote Utilities - Host", "7.2.2.0", "Remote Utilities LLC", "20240227"),
+			{Name: "KB5034441", Values: []regftest.Value{regftest.String("ParentKeyName", "OperatingSystem")}},
+		}}),
+	}})
+
+	report := NewInstalledProgramsReport()
+	if err := report.AddSoftwareHive(software); err != nil {
+		t.Fatal(err)
+	}
+	if err := report.AddAmcacheHive(amcache); err != nil {
+		t.Fatal(err)
+	}
+	report.Reconcile(time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC))
+
+	// WOW6432Node is absent from the fixture and not read
+	if !reflect.DeepEqual(report.SourcesRead, []string{SourceMachineUninstall, SourceAmcache}) {
+		t.Fatalf("sources read = %v", report.SourcesRead)
+	}
+	if report.ProgramCount != 3 || report.FlaggedCount != 2 || len(report.Errors) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	// Names match regardless of spacing; the first sighting names the program
+	sevenZip := report.Programs[0]
+	if sevenZip.Name != "7-Zip  23.01 (x64)" || sevenZip.Flags != nil || sevenZip.InstallDate != "2023-11-20T00:00:00Z" {
+		t.Fatalf("7-Zip = %+v", sevenZip)
+	}
+	if len(sevenZip.Sources) != 2 || sevenZip.Sources[0].Source != SourceMachineUninstall || sevenZip.Sources[1].Source != SourceAmcache {
+		t.Fatalf("7-Zip sources = %+v", sevenZip.Sources)
+	}
+	if !reflect.DeepEqual(sevenZip.Versions, []string{"23.01"}) {
+		t.Fatalf("7-Zip versions = %v", sevenZip.Versions)
+	}
+
+	anyDesk := report.Programs[1]
+	wantSource := ProgramSource{
+		Source:          SourceAmcache,
+		Key:             "00006b3f1a2d5c8e9f0a1b2c3d4e5f60718200000904",
+		KeyLastWriteUTC: "2024-02-27T22:41:07Z",
+		Version:         "8.0.8",
+		InstallDate:     "02/26/2024 23:17:40",
+		Provider:        "AddRemoveProgram",
+	}
+	if anyDesk.Name != "AnyDesk" || anyDesk.Publisher != "AnyDesk Software GmbH" || anyDesk.InstallDate != "2024-02-26T23:17:40Z" ||
+		!reflect.DeepEqual(anyDesk.Sources, []ProgramSource{wantSource}) {
+		t.Fatalf("AnyDesk = %+v", anyDesk)
+	}
+	if !reflect.DeepEqual(anyDesk.Flags, []string{"only_in_amcache_inventory", "installed_since"}) {
+		t.Fatalf("AnyDesk flags = %v", anyDesk.Flags)
+	}
+
+	remote := report.Programs[2]
+	if remote.Name != "Remote Utilities - Host" || !reflect.DeepEqual(remote.Flags, []string{"only_in_hklm_uninstall", "installed_since"}) {
+		t.Fatalf("Remote Utilities = %+v", remote)
+	}
+}
+
+func TestAddAmcacheHiveWithoutInventoryApplication(t *testing.T) {
+	// A Windows 8 hive keeps programs under Root\Programs instead
+	amcache := openTestHive(t, "Amcache.hve", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{regftest.Path(`Root\Programs`)}})
+	report := NewInstalledProgramsReport()
+	if err := report.AddAmcacheHive(amcache); err != nil {
+		t.Fatal(err)
+	}
+	report.Reconcile(time.Time{})
+	if len(report.SourcesRead) != 0 || report.ProgramCount != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestParseInstallDate(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"20231120", time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC)},
+		{"2/7/2024", time.Date(2024, 2, 7, 0, 0, 0, 0, time.UTC)},
+		{"02/26/2024 23:17:40", time.Date(2024, 2, 26, 23, 17, 40, 0, time.UTC)},
+		{"", time.Time{}},
+		{"unknown", time.Time{}},
+	} {
+		if got := parseInstallDate(tt.in); !got.Equal(tt.want) {
+			t.Errorf("parseInstallDate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
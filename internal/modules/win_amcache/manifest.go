@@ -2,9 +2,12 @@
 package win_amcache
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // AmcacheItem represents a collected Amcache-related file.
@@ -36,9 +39,9 @@ type AmcacheManifest struct {
 }
 
 // NewAmcacheManifest creates a new Amcache manifest with basic information.
-func NewAmcacheManifest(hostname, amcachePath, legacyPath string) *AmcacheManifest {
+func NewAmcacheManifest(ctx context.Context, hostname, amcachePath, legacyPath string) *AmcacheManifest {
 	return &AmcacheManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]AmcacheItem, 0),
@@ -56,11 +59,23 @@ func (am *AmcacheManifest) AddItem(path string, size int64, sha256 string, trunc
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 }
 
+// RemoveItem drops every item recorded under path, so a file that is
+// regenerated is listed once.
+func (am *AmcacheManifest) RemoveItem(path string) {
+	items := am.Items[:0]
+	for _, item := range am.Items {
+		if item.Path != path {
+			items = append(items, item)
+		}
+	}
+	am.Items = items
+}
+
 // AddError adds an error to the manifest for a failed collection.
 func (am *AmcacheManifest) AddError(target, errorMsg string) {
 	am.Errors = append(am.Errors, AmcacheError{
@@ -77,4 +92,17 @@ func (am *AmcacheManifest) WriteManifest(manifestPath string) error {
 	}
 
 	return os.WriteFile(manifestPath, data, 0644)
-}
\ No newline at end of file
+}
+
+// LoadAmcacheManifest reads a manifest written by WriteManifest.
+func LoadAmcacheManifest(manifestPath string) (*AmcacheManifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var am AmcacheManifest
+	if err := json.Unmarshal(data, &am); err != nil {
+		return nil, err
+	}
+	return &am, nil
+}
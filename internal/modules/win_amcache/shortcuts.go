@@ -0,0 +1,306 @@
+package win_amcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cryptkeeper/internal/lnk"
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// lnkDir is where the windows/lnk module leaves its shortcut copies,
+// relative to the artifacts root.
+var lnkDir = filepath.Join("windows_lnk", "windows", "lnk")
+
+// InventoryApplicationShortcut schemas. Windows 10 1709 through 1803 record
+// only ShortcutPath; 1809 and later add the target, AUMID, and program ID.
+const (
+	ShortcutSchemaPathOnly = "path_only"
+	ShortcutSchemaTarget   = "target"
+)
+
+// ApplicationShortcut is a shortcut recorded under Root\InventoryApplicationShortcut.
+type ApplicationShortcut struct {
+	ShortcutPath   string   `json:"shortcut_path"`
+	TargetPath     string   `json:"target_path,omitempty"`
+	TargetSource   string   `json:"target_source,omitempty"` // amcache, or lnk when taken from a collected shortcut
+	AUMID          string   `json:"aumid,omitempty"`
+	ProgramID      string   `json:"program_id,omitempty"` // Links the entry to InventoryApplication
+	Schema         string   `json:"schema"`
+	KeyLastWritten string   `json:"key_last_written,omitempty"`
+	LNKFiles       []string `json:"lnk_files,omitempty"` // Collected windows/lnk copies of the shortcut
+}
+
+// ShortcutInventory is the structure written to application_shortcuts.json.
+type ShortcutInventory struct {
+	CollectedUTC string                `json:"collected_utc"`
+	HiveDirty    bool                  `json:"hive_dirty"`
+	Shortcuts    []ApplicationShortcut `json:"shortcuts"`
+	LNKParsed    int                   `json:"lnk_parsed"`
+	Correlated   int                   `json:"correlated"`
+	Errors       []string              `json:"errors,omitempty"`
+}
+
+// CollectedShortcut is a .lnk copy from the windows/lnk module with the
+// target its link data points to.
+type CollectedShortcut struct {
+	Path       string // File name in the windows/lnk directory
+	Username   string
+	Location   string
+	TargetPath string
+}
+
+// ParseApplicationShortcuts extracts the InventoryApplicationShortcut entries
+// of an Amcache hive. A hive from before Windows 10 1709 has none.
+func ParseApplicationShortcuts(hive *regf.Hive) (*ShortcutInventory, error) {
+	inventory := &ShortcutInventory{
+		HiveDirty: hive.Dirty(),
+		Shortcuts: make([]ApplicationShortcut, 0),
+	}
+
+	key, err := hive.OpenKey(`Root\InventoryApplicationShortcut`)
+	if errors.Is(err, regf.ErrNotFound) {
+		return inventory, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open InventoryApplicationShortcut: %w", err)
+	}
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return nil, fmt.Errorf("InventoryApplicationShortcut: %w", err)
+	}
+	for _, sub := range subkeys {
+		values, err := sub.Values()
+		if err != nil {
+			inventory.Errors = append(inventory.Errors, fmt.Sprintf("InventoryApplicationShortcut\\%s: %v", sub.Name, err))
+			continue
+		}
+		byName := valueMap(values)
+
+		shortcut := ApplicationShortcut{
+			ShortcutPath:   stringValue(byName, "ShortcutPath"),
+			TargetPath:     stringValue(byName, "ShortcutTargetPath"),
+			AUMID:          stringValue(byName, "ShortcutAumid"),
+			ProgramID:      stringValue(byName, "ShortcutProgramId"),
+			Schema:         ShortcutSchemaPathOnly,
+			KeyLastWritten: formatTime(sub.LastWritten),
+		}
+		// 1809 and later name the subkey after the lowercased shortcut path
+		if shortcut.ShortcutPath == "" {
+			shortcut.ShortcutPath = sub.Name
+		}
+		if _, ok := byName["shortcuttargetpath"]; ok {
+			shortcut.Schema = ShortcutSchemaTarget
+		}
+		if shortcut.TargetPath != "" {
+			shortcut.TargetSource = "amcache"
+		}
+		inventory.Shortcuts = append(inventory.Shortcuts, shortcut)
+	}
+
+	sort.Slice(inventory.Shortcuts, func(i, j int) bool {
+		return strings.ToLower(inventory.Shortcuts[i].ShortcutPath) < strings.ToLower(inventory.Shortcuts[j].ShortcutPath)
+	})
+	return inventory, nil
+}
+
+// ReadCollectedShortcuts parses the .lnk copies listed in a windows/lnk
+// manifest. Shortcuts that fail to parse are reported and skipped.
+func ReadCollectedShortcuts(dir string) ([]CollectedShortcut, []string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	var manifest struct {
+		Items []struct {
+			Path      string `json:"path"`
+			Truncated bool   `json:"truncated"`
+			Username  string `json:"username"`
+			Location  string `json:"location"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse lnk manifest: %w", err)
+	}
+
+	shortcuts := make([]CollectedShortcut, 0, len(manifest.Items))
+	var errs []string
+	for _, item := range manifest.Items {
+		// The manifest also lists lnk_parsed.json
+		if item.Truncated || !strings.HasSuffix(strings.ToLower(item.Path), ".lnk") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, item.Path))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("lnk %s: %v", item.Path, err))
+			continue
+		}
+		parsed, err := lnk.Parse(content)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("lnk %s: %v", item.Path, err))
+			continue
+		}
+		shortcuts = append(shortcuts, CollectedShortcut{
+			Path:       item.Path,
+			Username:   item.Username,
+			Location:   item.Location,
+			TargetPath: parsed.TargetPath,
+		})
+	}
+	return shortcuts, errs, nil
+}
+
+// Correlate links each Amcache shortcut to the collected .lnk files that
+// point at its target. Path-only entries have no target, so they are matched
+// by shortcut file name, and take their target from the matched file when
+// all matches agree on it.
+func (s *ShortcutInventory) Correlate(collected []CollectedShortcut) {
+	s.LNKParsed = len(collected)
+	byTarget := make(map[string][]CollectedShortcut)
+	byName := make(map[string][]CollectedShortcut)
+	for _, c := range collected {
+		if c.TargetPath != "" {
+			target := normalizeShortcutPath(c.TargetPath)
+			byTarget[target] = append(byTarget[target], c)
+		}
+		name := strings.ToLower(c.Path)
+		byName[name] = append(byName[name], c)
+	}
+
+	s.Correlated = 0
+	for i := range s.Shortcuts {
+		shortcut := &s.Shortcuts[i]
+		shortcut.LNKFiles = nil
+
+		var matches []CollectedShortcut
+		if shortcut.TargetPath != "" && shortcut.TargetSource == "amcache" {
+			matches = byTarget[normalizeShortcutPath(shortcut.TargetPath)]
+		} else {
+			// windows/lnk flattens <location>\<relative path> into the copy's name
+			suffix := "_" + strings.ToLower(baseName(shortcut.ShortcutPath))
+			for name, named := range byName {
+				if strings.HasSuffix(name, suffix) {
+					matches = append(matches, named...)
+				}
+			}
+			if target, ok := commonTarget(matches); ok {
+				shortcut.TargetPath = target
+				shortcut.TargetSource = "lnk"
+			}
+		}
+		for _, m := range matches {
+			shortcut.LNKFiles = append(shortcut.LNKFiles, m.Path)
+		}
+		sort.Strings(shortcut.LNKFiles)
+		if len(shortcut.LNKFiles) > 0 {
+			s.Correlated++
+		}
+	}
+}
+
+// commonTarget returns the target shared by every match.
+func commonTarget(matches []CollectedShortcut) (string, bool) {
+	target := ""
+	for _, m := range matches {
+		switch {
+		case m.TargetPath == "":
+			continue
+		case target == "":
+			target = m.TargetPath
+		case normalizeShortcutPath(m.TargetPath) != normalizeShortcutPath(target):
+			return "", false
+		}
+	}
+	return target, target != ""
+}
+
+// normalizeShortcutPath lowercases a Windows path and unifies its separators
+// so Amcache and link data spellings of one target compare equal.
+func normalizeShortcutPath(path string) string {
+	path = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(path), "/", `\`))
+	return strings.TrimPrefix(path, `\\?\`)
+}
+
+// WriteApplicationShortcuts parses InventoryApplicationShortcut from a
+// collected Amcache hive into application_shortcuts.json, correlated with the
+// .lnk files in lnkPath when the windows/lnk module collected them. An
+// application_shortcuts.json already listed in the manifest is replaced.
+func WriteApplicationShortcuts(ctx context.Context, hivePath, lnkPath, outDir string, manifest *AmcacheManifest) error {
+	for _, item := range manifest.Items {
+		if item.Path == "Amcache.hve" && item.Truncated {
+			return fmt.Errorf("Amcache.hve copy is truncated")
+		}
+	}
+
+	hive, err := regf.Open(hivePath)
+	if err != nil {
+		return err
+	}
+	defer hive.Close()
+
+	inventory, err := ParseApplicationShortcuts(hive)
+	if err != nil {
+		return err
+	}
+	inventory.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+
+	collected, errs, err := ReadCollectedShortcuts(lnkPath)
+	if err != nil && !os.IsNotExist(err) {
+		inventory.Errors = append(inventory.Errors, fmt.Sprintf("windows/lnk: %v", err))
+	}
+	inventory.Errors = append(inventory.Errors, errs...)
+	inventory.Correlate(collected)
+
+	outputPath := filepath.Join(outDir, "application_shortcuts.json")
+	data, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal application shortcuts: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write application shortcuts: %w", err)
+	}
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat application shortcuts: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash application shortcuts: %w", err)
+	}
+	manifest.RemoveItem("application_shortcuts.json")
+	note := fmt.Sprintf("Amcache InventoryApplicationShortcut entries (%d shortcuts, %d matched to collected LNK files)", len(inventory.Shortcuts), inventory.Correlated)
+	manifest.AddItem("application_shortcuts.json", stat.Size(), sha256Hex, false, stat.ModTime(), "application_shortcuts", note)
+
+	return nil
+}
+
+// AnalyzeApplicationShortcuts rebuilds application_shortcuts.json from the
+// Amcache.hve copy in a collected windows/amcache directory and the
+// collection's windows/lnk copies, for the analyze command.
+func AnalyzeApplicationShortcuts(ctx context.Context, moduleDir string) ([]string, error) {
+	amcacheDir := filepath.Join(moduleDir, "windows", "amcache")
+	hivePath := filepath.Join(amcacheDir, "Amcache.hve")
+	if _, err := os.Stat(hivePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	manifestPath := filepath.Join(amcacheDir, "manifest.json")
+	manifest, err := LoadAmcacheManifest(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read amcache manifest: %w", err)
+	}
+	if err := WriteApplicationShortcuts(ctx, hivePath, filepath.Join(filepath.Dir(moduleDir), lnkDir), amcacheDir, manifest); err != nil {
+		return nil, err
+	}
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return []string{"windows/amcache/application_shortcuts.json"}, fmt.Errorf("failed to write amcache manifest: %w", err)
+	}
+	return []string{"windows/amcache/application_shortcuts.json", "windows/amcache/manifest.json"}, nil
+}
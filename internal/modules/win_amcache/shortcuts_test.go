@@ -0,0 +1,96 @@
+package win_amcache
+
+import (
+	"reflect"
+	"testing"
+
+	"cryptkeeper/internal/regf/regftest"
+)
+
+// shortcutHive returns an Amcache hive with one shortcut in each
+// InventoryApplicationShortcut schema: a 1803 entry with only ShortcutPath
+// under an opaque subkey name, and a 1809 entry named by its lowercased path.
+func shortcutHive() *regftest.Key {
+	return &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Root", Subkeys: []*regftest.Key{{Name: "InventoryApplicationShortcut", Subkeys: []*regftest.Key{
+			{
+				Name:        `c:\programdata\microsoft\windows\start menu\programs\startup\onedrive sync.lnk`,
+				LastWritten: sampleKeyWritten,
+				Values: []regftest.Value{
+					regftest.String("ShortcutPath", `C:\ProgramData\Microsoft\Windows\Start Menu\Programs\Startup\OneDrive Sync.lnk`),
+					regftest.String("ShortcutTargetPath", `C:\Users\Public\Libraries\odsync.exe`),
+					regftest.String("ShortcutAumid", ""),
+					regftest.String("ShortcutProgramId", "0000e5a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3"),
+				},
+			},
+			{
+				Name:   "00000a1f7e3c",
+				Values: []regftest.Value{regftest.String("ShortcutPath", `C:\Users\alice\AppData\Roaming\Microsoft\Windows\Start Menu\Programs\PuTTY.lnk`)},
+			},
+		}}}},
+	}}
+}
+
+func TestParseApplicationShortcuts(t *testing.T) {
+	inventory, err := ParseApplicationShortcuts(openTestHive(t, "Amcache.hve", shortcutHive()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ApplicationShortcut{
+		{
+			ShortcutPath:   `C:\ProgramData\Microsoft\Windows\Start Menu\Programs\Startup\OneDrive Sync.lnk`,
+			TargetPath:     `C:\Users\Public\Libraries\odsync.exe`,
+			TargetSource:   "amcache",
+			ProgramID:      "0000e5a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3",
+			Schema:         ShortcutSchemaTarget,
+			KeyLastWritten: "2024-02-27T22:41:07Z",
+		},
+		{
+			ShortcutPath: `C:\Users\alice\AppData\Roaming\Microsoft\Windows\Start Menu\Programs\PuTTY.lnk`,
+			Schema:       ShortcutSchemaPathOnly,
+		},
+	}
+	if inventory.HiveDirty || len(inventory.Errors) != 0 || !reflect.DeepEqual(inventory.Shortcuts, want) {
+		t.Fatalf("shortcuts = %+v\nwant %+v", inventory.Shortcuts, want)
+	}
+
+	// A hive from before Windows 10 1709
+	inventory, err = ParseApplicationShortcuts(openTestHive(t, "Amcache.hve", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{regftest.Path(`Root\File`)}}))
+	if err != nil || len(inventory.Shortcuts) != 0 {
+		t.Fatalf("legacy hive = %+v, %v", inventory, err)
+	}
+}
+
+func TestCorrelateApplicationShortcuts(t *testing.T) {
+	inventory, err := ParseApplicationShortcuts(openTestHive(t, "Amcache.hve", shortcutHive()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inventory.Correlate([]CollectedShortcut{
+		{Path: "ProgramData_Startup_OneDrive Sync.lnk", Location: "ProgramData", TargetPath: `\\?\C:\USERS\PUBLIC\LIBRARIES\ODSYNC.EXE`},
+		{Path: "alice_StartMenu_PuTTY.lnk", Username: "alice", TargetPath: `C:\Program Files\PuTTY\putty.exe`},
+		{Path: "alice_Desktop_notes.lnk", Username: "alice", TargetPath: `C:\Windows\notepad.exe`},
+	})
+	if inventory.LNKParsed != 3 || inventory.Correlated != 2 {
+		t.Fatalf("inventory = %+v", inventory)
+	}
+
+	// Targets match across spellings; the path-only entry takes the LNK target
+	odsync, putty := inventory.Shortcuts[0], inventory.Shortcuts[1]
+	if !reflect.DeepEqual(odsync.LNKFiles, []string{"ProgramData_Startup_OneDrive Sync.lnk"}) || odsync.TargetSource != "amcache" {
+		t.Fatalf("OneDrive Sync = %+v", odsync)
+	}
+	if !reflect.DeepEqual(putty.LNKFiles, []string{"alice_StartMenu_PuTTY.lnk"}) || putty.TargetPath != `C:\Program Files\PuTTY\putty.exe` || putty.TargetSource != "lnk" {
+		t.Fatalf("PuTTY = %+v", putty)
+	}
+
+	// Copies disagreeing on the target leave it unset
+	inventory.Shortcuts[1].TargetPath, inventory.Shortcuts[1].TargetSource = "", ""
+	inventory.Correlate([]CollectedShortcut{
+		{Path: "alice_StartMenu_PuTTY.lnk", TargetPath: `C:\Program Files\PuTTY\putty.exe`},
+		{Path: "bob_Desktop_PuTTY.lnk", TargetPath: `C:\Users\bob\Downloads\putty.exe`},
+	})
+	if putty := inventory.Shortcuts[1]; putty.TargetPath != "" || len(putty.LNKFiles) != 2 {
+		t.Fatalf("PuTTY with conflicting copies = %+v", putty)
+	}
+}
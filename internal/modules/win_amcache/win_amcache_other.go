@@ -14,11 +14,31 @@ func NewWinAmcache() *WinAmcache {
 	return &WinAmcache{}
 }
 
+// SetParse is a no-op on non-Windows platforms.
+func (w *WinAmcache) SetParse(enabled bool) {
+	// No-op on non-Windows platforms
+}
+
+// SetSinceTime is a no-op on non-Windows platforms.
+func (w *WinAmcache) SetSinceTime(sinceRFC3339 string) {
+	// No-op on non-Windows platforms
+}
+
+// DependsOn reports that the module runs after windows/registry and windows/lnk.
+func (w *WinAmcache) DependsOn() []string {
+	return []string{"windows/registry", "windows/lnk"}
+}
+
 // Name returns the module's identifier.
 func (w *WinAmcache) Name() string {
 	return "windows/amcache"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinAmcache) Describe() string {
+	return "Application Compatibility cache"
+}
+
 // Collect is a no-op on non-Windows platforms and always returns nil.
 func (w *WinAmcache) Collect(ctx context.Context, outDir string) error {
 	// This module only works on Windows, so it's a no-op on other platforms
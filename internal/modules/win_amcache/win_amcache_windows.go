@@ -7,23 +7,55 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"cryptkeeper/internal/regf"
 	"cryptkeeper/internal/winutil"
 )
 
+// registryDir is where the windows/registry module leaves its hive copies,
+// relative to the artifacts root.
+var registryDir = filepath.Join("windows_registry", "windows", "registry")
+
 // WinAmcache represents the Windows Amcache collection module.
-type WinAmcache struct{}
+type WinAmcache struct {
+	parse     bool   // Decode the collected Amcache.hve into driver_inventory.json and application_shortcuts.json
+	sinceTime string // RFC3339 cutoff for flagging recently installed programs
+}
 
 // NewWinAmcache creates a new Windows Amcache collection module.
 func NewWinAmcache() *WinAmcache {
 	return &WinAmcache{}
 }
 
+// SetParse enables decoding of the collected Amcache hive.
+func (w *WinAmcache) SetParse(enabled bool) {
+	w.parse = enabled
+}
+
+// SetSinceTime configures the install-time cutoff for installed_programs.json.
+func (w *WinAmcache) SetSinceTime(sinceRFC3339 string) {
+	w.sinceTime = sinceRFC3339
+}
+
+// DependsOn reports that the module runs after windows/registry, whose
+// SOFTWARE and NTUSER copies hold the uninstall keys it reconciles, and after
+// windows/lnk, whose shortcut copies it correlates with Amcache shortcuts.
+func (w *WinAmcache) DependsOn() []string {
+	return []string{"windows/registry", "windows/lnk"}
+}
+
 // Name returns the module's identifier.
 func (w *WinAmcache) Name() string {
 	return "windows/amcache"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinAmcache) Describe() string {
+	return "Application Compatibility cache"
+}
+
 // Collect copies Windows Amcache files and creates a manifest.
 func (w *WinAmcache) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/amcache subdirectory
@@ -33,25 +65,22 @@ func (w *WinAmcache) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Determine Amcache paths
-	systemRoot := os.Getenv("SystemRoot")
-	if systemRoot == "" {
-		systemRoot = "C:\\Windows"
-	}
+	systemRoot := winutil.SystemRoot()
 
 	amcachePath := filepath.Join(systemRoot, "AppCompat", "Programs", "Amcache.hve")
 	legacyPath := filepath.Join(systemRoot, "AppCompat", "Programs", "RecentFileCache.bcf")
 
 	// Create manifest
-	manifest := NewAmcacheManifest(hostname, amcachePath, legacyPath)
+	manifest := NewAmcacheManifest(ctx, hostname, amcachePath, legacyPath)
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Try to collect primary Amcache.hve file
 	if err := w.collectAmcacheFile(ctx, amcachePath, amcacheDir, "Amcache.hve", "amcache", "Primary Amcache registry hive", manifest, constraints); err != nil {
@@ -66,6 +95,26 @@ func (w *WinAmcache) Collect(ctx context.Context, outDir string) error {
 	// Also collect any transaction log files associated with Amcache.hve
 	w.collectAmcacheLogFiles(ctx, filepath.Dir(amcachePath), amcacheDir, manifest, constraints)
 
+	// Anchor the collection to the machine's hardware and installation identity
+	if err := w.collectHardwareFingerprint(ctx, amcacheDir, manifest); err != nil {
+		manifest.AddError("hardware_fingerprint", err.Error())
+	}
+
+	// Reconcile installed software across the uninstall keys, Amcache and Get-Package
+	if err := w.collectInstalledPrograms(ctx, outDir, amcacheDir, manifest); err != nil {
+		manifest.AddError("installed_programs", err.Error())
+	}
+
+	// Decode driver inventory from the collected copy; the live hive stays locked
+	if w.parse {
+		if err := WriteDriverInventory(ctx, filepath.Join(amcacheDir, "Amcache.hve"), amcacheDir, manifest); err != nil {
+			manifest.AddError("driver_inventory", fmt.Sprintf("Failed to parse driver inventory: %v", err))
+		}
+		if err := WriteApplicationShortcuts(ctx, filepath.Join(amcacheDir, "Amcache.hve"), filepath.Join(filepath.Dir(outDir), lnkDir), amcacheDir, manifest); err != nil {
+			manifest.AddError("application_shortcuts", fmt.Sprintf("Failed to parse application shortcuts: %v", err))
+		}
+	}
+
 	// Write manifest
 	manifestPath := filepath.Join(amcacheDir, "manifest.json")
 	if err := manifest.WriteManifest(manifestPath); err != nil {
@@ -85,6 +134,7 @@ func (w *WinAmcache) collectAmcacheFile(ctx context.Context, srcPath, outDir, de
 	}
 
 	// Check if source file exists
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(outDir, destFilename, srcPath)
 	stat, err := os.Stat(srcPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -133,4 +183,174 @@ func (w *WinAmcache) collectAmcacheLogFiles(ctx context.Context, amcacheBaseDir,
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+
+// hardwareScript emits the SMBIOS, CPU, disk, and TPM identifiers as one JSON
+// object. Win32_Tpm needs elevation, so its failure is reported rather than fatal.
+const hardwareScript = `$ErrorActionPreference = 'SilentlyContinue'
+$tpm = $null; $tpmError = ''
+try { $tpm = Get-CimInstance -Namespace root\cimv2\Security\MicrosoftTpm -ClassName Win32_Tpm -ErrorAction Stop | Select-Object -First 1 IsEnabled_InitialValue, IsActivated_InitialValue, ManufacturerIdTxt, ManufacturerVersion, SpecVersion } catch { $tpmError = $_.Exception.Message }
+[pscustomobject]@{
+  ComputerSystem = Get-CimInstance Win32_ComputerSystem | Select-Object -First 1 Manufacturer, Model, SystemFamily, SystemSKUNumber, HypervisorPresent
+  BIOS = Get-CimInstance Win32_BIOS | Select-Object -First 1 Manufacturer, SMBIOSBIOSVersion, SerialNumber, @{Name='ReleaseDate';Expression={ if ($_.ReleaseDate) { $_.ReleaseDate.ToUniversalTime().ToString('yyyy-MM-ddTHH:mm:ssZ') } }}
+  BaseBoard = Get-CimInstance Win32_BaseBoard | Select-Object -First 1 Manufacturer, Product, Version, SerialNumber
+  Product = Get-CimInstance Win32_ComputerSystemProduct | Select-Object -First 1 Vendor, Name, IdentifyingNumber, UUID
+  Processors = @(Get-CimInstance Win32_Processor | Select-Object Name, Manufacturer, ProcessorId, NumberOfCores, NumberOfLogicalProcessors)
+  Disks = @(Get-CimInstance Win32_DiskDrive | Select-Object Model, SerialNumber, InterfaceType, Size, PNPDeviceID)
+  Tpm = $tpm
+  TpmError = $tpmError
+} | ConvertTo-Json -Depth 3 -Compress`
+
+// collectHardwareFingerprint writes hardware_fingerprint.json. The hardware
+// is queried through WMI on a live system only; an offline root still yields
+// MachineGuid and InstallDate from its SOFTWARE hive.
+func (w *WinAmcache) collectHardwareFingerprint(ctx context.Context, outDir string, manifest *AmcacheManifest) error {
+	fp := NewHardwareFingerprint()
+	if winutil.IsOffline() {
+		fp.Errors = append(fp.Errors, "hardware WMI queries need the live system; only the installation identity was read")
+		machineGUID, installDate, err := InstallationIdentityFromHive(filepath.Join(winutil.SystemRoot(), "System32", "config", "SOFTWARE"))
+		if err != nil {
+			fp.Errors = append(fp.Errors, fmt.Sprintf("SOFTWARE hive: %v", err))
+		}
+		fp.SetInstallationIdentity(machineGUID, installDate)
+		return WriteHardwareFingerprint(ctx, fp, outDir, manifest)
+	}
+
+	if output, err := winutil.RunCommandWithOutput(ctx, "powershell", []string{"-NoProfile", "-Command", hardwareScript}); err != nil {
+		fp.Errors = append(fp.Errors, fmt.Sprintf("Get-CimInstance: %v", err))
+	} else if parsed, err := ParseHardwareInfo(output); err != nil {
+		fp.Errors = append(fp.Errors, err.Error())
+	} else {
+		fp = parsed
+	}
+
+	var machineGUID string
+	var installDate uint64
+	if output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", `HKLM\SOFTWARE\` + cryptographyKey, "/v", "MachineGuid"}); err != nil {
+		fp.Errors = append(fp.Errors, fmt.Sprintf("MachineGuid: %v", err))
+	} else if keys := winutil.ParseRegQuery(output); len(keys) > 0 {
+		if value, ok := keys[0].Value("MachineGuid"); ok {
+			machineGUID = value.Data
+		}
+	}
+	if output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", `HKLM\SOFTWARE\` + currentVersionKey, "/v", "InstallDate"}); err != nil {
+		fp.Errors = append(fp.Errors, fmt.Sprintf("InstallDate: %v", err))
+	} else if keys := winutil.ParseRegQuery(output); len(keys) > 0 {
+		installDate, _ = keys[0].DWORD("InstallDate")
+	}
+	fp.SetInstallationIdentity(machineGUID, installDate)
+
+	return WriteHardwareFingerprint(ctx, fp, outDir, manifest)
+}
+
+// getPackageScript lists installed packages with the install metadata the
+// Programs and msi providers expose.
+const getPackageScript = `$ErrorActionPreference = 'SilentlyContinue'
+@(Get-Package | ForEach-Object {
+  [pscustomobject]@{
+    Name = $_.Name
+    Version = $_.Version
+    ProviderName = $_.ProviderName
+    Publisher = $_.Metadata['Publisher']
+    InstallDate = $_.Metadata['InstallDate']
+    InstallLocation = $_.Metadata['InstallLocation']
+    UninstallString = $_.Metadata['UninstallString']
+  }
+}) | ConvertTo-Json -Depth 2 -Compress`
+
+// collectInstalledPrograms writes installed_programs.json from the SOFTWARE
+// and per-user hives, preferring the registry module's copies, from the
+// collected Amcache.hve, and from Get-Package on a live system.
+func (w *WinAmcache) collectInstalledPrograms(ctx context.Context, outDir, amcacheDir string, manifest *AmcacheManifest) error {
+	report := NewInstalledProgramsReport()
+	hiveDir := filepath.Join(filepath.Dir(outDir), registryDir)
+
+	software, err := openHive(filepath.Join(hiveDir, "SOFTWARE.hiv"), filepath.Join(winutil.SystemRoot(), "System32", "config", "SOFTWARE"))
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("SOFTWARE hive: %v", err))
+	} else {
+		if err := report.AddSoftwareHive(software); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("SOFTWARE hive: %v", err))
+		}
+		software.Close()
+	}
+
+	// The live Amcache.hve stays locked, so only the collected copy is read
+	if amcache, err := regf.Open(filepath.Join(amcacheDir, "Amcache.hve")); err == nil {
+		if err := report.AddAmcacheHive(amcache); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Amcache.hve: %v", err))
+		}
+		amcache.Close()
+	} else if !os.IsNotExist(err) {
+		report.Errors = append(report.Errors, fmt.Sprintf("Amcache.hve: %v", err))
+	}
+
+	usersDir := winutil.UsersDir()
+	if entries, err := os.ReadDir(usersDir); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to read users directory: %v", err))
+	} else {
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !entry.IsDir() || isSystemProfile(entry.Name()) {
+				continue
+			}
+			username := entry.Name()
+			ntuser := filepath.Join(usersDir, username, "NTUSER.DAT")
+			if _, err := os.Stat(ntuser); os.IsNotExist(err) {
+				continue
+			}
+			hive, err := openHive(filepath.Join(hiveDir, "NTUSER_"+username+".hiv"), ntuser)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("NTUSER.DAT of %s: %v", username, err))
+				continue
+			}
+			if err := report.AddUserHive(hive, username); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("NTUSER.DAT of %s: %v", username, err))
+			}
+			hive.Close()
+		}
+	}
+
+	// Get-Package describes the running system, not a mounted image
+	if !winutil.IsOffline() {
+		if output, err := winutil.RunCommandWithOutput(ctx, "powershell", []string{"-NoProfile", "-Command", getPackageScript}); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Get-Package: %v", err))
+		} else if err := report.AddGetPackage(output); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	var since time.Time
+	if w.sinceTime != "" {
+		since, _ = time.Parse(time.RFC3339, w.sinceTime)
+	}
+	report.Reconcile(since)
+	return WriteInstalledPrograms(ctx, report, amcacheDir, manifest)
+}
+
+// openHive opens the registry module's copy of a hive when it is valid, and
+// the hive on the collection target otherwise.
+func openHive(registryCopy, hostPath string) (*regf.Hive, error) {
+	if regf.CheckFile(registryCopy).Valid {
+		if hive, err := regf.Open(registryCopy); err == nil {
+			return hive, nil
+		}
+	}
+	hive, err := regf.Open(hostPath)
+	if err != nil {
+		return nil, fmt.Errorf("no valid registry module copy, and %w", err)
+	}
+	return hive, nil
+}
+
+// isSystemProfile reports whether a profile directory belongs to a built-in
+// account rather than a user.
+func isSystemProfile(username string) bool {
+	switch strings.ToLower(username) {
+	case "all users", "default", "default user", "public", "wdagutilityaccount", "defaultuser0", "systemprofile":
+		return true
+	}
+	return false
+}
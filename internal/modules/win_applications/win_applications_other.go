@@ -14,11 +14,30 @@ func NewWinApplications() *WinApplications {
 	return &WinApplications{}
 }
 
+// SetParse is a no-op on non-Windows systems.
+func (w *WinApplications) SetParse(enabled bool) {}
+
+// SetCopyMailboxes is a no-op on non-Windows systems.
+func (w *WinApplications) SetCopyMailboxes(enabled bool) {}
+
+// SetSinceTime is a no-op on non-Windows systems.
+func (w *WinApplications) SetSinceTime(sinceRFC3339 string) {}
+
+// DependsOn reports that the module runs after windows/registry.
+func (w *WinApplications) DependsOn() []string {
+	return []string{"windows/registry"}
+}
+
 // Name returns the module's identifier.
 func (w *WinApplications) Name() string {
 	return "windows/applications"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinApplications) Describe() string {
+	return "Application-specific artifacts"
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinApplications) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
@@ -7,25 +7,62 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"cryptkeeper/internal/regf"
 	"cryptkeeper/internal/winutil"
 )
 
+// registryDir is where the windows/registry module leaves its hive copies,
+// relative to the artifacts root.
+var registryDir = filepath.Join("windows_registry", "windows", "registry")
+
 // WinApplications represents the Windows application artifacts collection module.
-type WinApplications struct{}
+type WinApplications struct {
+	parse         bool // Describe PST/OST folder hierarchies in outlook_mailboxes.json
+	copyMailboxes bool // Copy whole PST/OST files rather than only describing them
+	sinceTime     string // RFC3339 cutoff; older Windows Terminal files are not collected
+}
 
 // NewWinApplications creates a new Windows application artifacts collection module.
 func NewWinApplications() *WinApplications {
 	return &WinApplications{}
 }
 
+// SetParse enables decoding of Outlook PST/OST headers and folder hierarchies.
+func (w *WinApplications) SetParse(enabled bool) {
+	w.parse = enabled
+}
+
+// SetCopyMailboxes enables copying of whole Outlook PST/OST files.
+func (w *WinApplications) SetCopyMailboxes(enabled bool) {
+	w.copyMailboxes = enabled
+}
+
+// SetSinceTime configures the modification-time cutoff for Windows Terminal files.
+func (w *WinApplications) SetSinceTime(sinceRFC3339 string) {
+	w.sinceTime = sinceRFC3339
+}
+
+// DependsOn reports that the module runs after windows/registry, whose
+// NTUSER copies hold the users' console settings.
+func (w *WinApplications) DependsOn() []string {
+	return []string{"windows/registry"}
+}
+
 // Name returns the module's identifier.
 func (w *WinApplications) Name() string {
 	return "windows/applications"
 }
 
-// Collect gathers Windows application-specific artifacts including Office, Skype, Teams, Outlook, and Antivirus.
+// Describe returns a one-line summary of what the module collects.
+func (w *WinApplications) Describe() string {
+	return "Application-specific artifacts"
+}
+
+// Collect gathers Windows application-specific artifacts including Office, Skype, Teams, Outlook, Windows Terminal, and Antivirus.
 func (w *WinApplications) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/applications subdirectory
 	appsDir := filepath.Join(outDir, "windows", "applications")
@@ -34,17 +71,17 @@ func (w *WinApplications) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewApplicationManifest(hostname)
-	constraints := winutil.NewSizeConstraints()
+	manifest := NewApplicationManifest(ctx, hostname)
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Collect per-user application artifacts
-	if err := w.collectPerUserApplications(ctx, appsDir, manifest, constraints); err != nil {
+	if err := w.collectPerUserApplications(ctx, appsDir, filepath.Join(filepath.Dir(outDir), registryDir), manifest, constraints); err != nil {
 		manifest.AddError("per_user_applications", fmt.Sprintf("Failed to collect per-user applications: %v", err))
 	}
 
@@ -63,14 +100,12 @@ func (w *WinApplications) Collect(ctx context.Context, outDir string) error {
 }
 
 // collectPerUserApplications collects application artifacts for each user profile.
-func (w *WinApplications) collectPerUserApplications(ctx context.Context, outDir string, manifest *ApplicationManifest, constraints *winutil.SizeConstraints) error {
+func (w *WinApplications) collectPerUserApplications(ctx context.Context, outDir, hiveDir string, manifest *ApplicationManifest, constraints *winutil.SizeConstraints) error {
 	// Get system drive (usually C:)
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	usersDir := filepath.Join(systemDrive, "Users")
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(outDir, "user profiles", usersDir)
 	userEntries, err := os.ReadDir(usersDir)
 	if err != nil {
 		return fmt.Errorf("failed to read users directory: %w", err)
@@ -100,6 +135,11 @@ func (w *WinApplications) collectPerUserApplications(ctx context.Context, outDir
 
 		// Collect Outlook artifacts
 		w.collectOutlookArtifacts(ctx, userProfileDir, userOutDir, manifest, constraints, username)
+
+		// Collect Windows Terminal settings and console host settings
+		if err := w.collectTerminalArtifacts(ctx, userProfileDir, userOutDir, hiveDir, manifest, constraints, username); err != nil {
+			manifest.AddError("terminal_"+username, fmt.Sprintf("Failed to collect terminal settings: %v", err))
+		}
 	}
 
 	return nil
@@ -109,6 +149,7 @@ func (w *WinApplications) collectPerUserApplications(ctx context.Context, outDir
 func (w *WinApplications) collectOfficeArtifacts(ctx context.Context, userProfileDir, userOutDir string, manifest *ApplicationManifest, constraints *winutil.SizeConstraints, username string) {
 	// Office recent files are typically in AppData\Roaming\Microsoft\Office\Recent
 	officeRecentDir := filepath.Join(userProfileDir, "AppData", "Roaming", "Microsoft", "Office", "Recent")
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(userOutDir, "Office recent files", officeRecentDir)
 	if entries, err := os.ReadDir(officeRecentDir); err == nil {
 		officeOutDir := filepath.Join(userOutDir, "office")
 		if err := winutil.EnsureDir(officeOutDir); err == nil {
@@ -137,6 +178,7 @@ func (w *WinApplications) collectOfficeArtifacts(ctx context.Context, userProfil
 func (w *WinApplications) collectSkypeArtifacts(ctx context.Context, userProfileDir, userOutDir string, manifest *ApplicationManifest, constraints *winutil.SizeConstraints, username string) {
 	// Skype data is typically in AppData\Roaming\Skype
 	skypeDir := filepath.Join(userProfileDir, "AppData", "Roaming", "Skype")
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(userOutDir, "Skype data", skypeDir)
 	if entries, err := os.ReadDir(skypeDir); err == nil {
 		skypeOutDir := filepath.Join(userOutDir, "skype")
 		if err := winutil.EnsureDir(skypeOutDir); err == nil {
@@ -168,6 +210,7 @@ func (w *WinApplications) collectSkypeArtifacts(ctx context.Context, userProfile
 func (w *WinApplications) collectTeamsArtifacts(ctx context.Context, userProfileDir, userOutDir string, manifest *ApplicationManifest, constraints *winutil.SizeConstraints, username string) {
 	// Teams data is typically in AppData\Roaming\Microsoft\Teams
 	teamsDir := filepath.Join(userProfileDir, "AppData", "Roaming", "Microsoft", "Teams")
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(userOutDir, "Teams data", teamsDir)
 	
 	// Look for important Teams files
 	teamsFiles := []struct {
@@ -198,14 +241,19 @@ func (w *WinApplications) collectTeamsArtifacts(ctx context.Context, userProfile
 }
 
 // collectOutlookArtifacts collects Outlook PST/OST files (metadata only due to size).
+// With parsing enabled each file's header and folder hierarchy are described
+// in outlook_mailboxes.json; the files themselves are only copied when
+// mailbox copying is enabled.
 func (w *WinApplications) collectOutlookArtifacts(ctx context.Context, userProfileDir, userOutDir string, manifest *ApplicationManifest, constraints *winutil.SizeConstraints, username string) {
 	// Outlook data files are typically in AppData\Local\Microsoft\Outlook
 	outlookDir := filepath.Join(userProfileDir, "AppData", "Local", "Microsoft", "Outlook")
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(userOutDir, "Outlook data files", outlookDir)
 	
 	if entries, err := os.ReadDir(outlookDir); err == nil {
 		outlookOutDir := filepath.Join(userOutDir, "outlook")
 		if err := winutil.EnsureDir(outlookOutDir); err == nil {
 			infoContent := fmt.Sprintf("Outlook Data Files for user %s:\n\n", username)
+			var mailboxes []OutlookMailbox
 			
 			for _, entry := range entries {
 				if entry.IsDir() {
@@ -223,8 +271,19 @@ func (w *WinApplications) collectOutlookArtifacts(ctx context.Context, userProfi
 						// Add file metadata to info file instead of copying large email files
 						infoContent += fmt.Sprintf("File: %s\n", filename)
 						infoContent += fmt.Sprintf("Size: %d bytes (%.2f MB)\n", stat.Size(), float64(stat.Size())/1024/1024)
-						infoContent += fmt.Sprintf("Modified: %s\n", stat.ModTime().Format("2006-01-02 15:04:05"))
-						infoContent += fmt.Sprintf("Note: Email data file not copied due to size and privacy constraints\n\n")
+						infoContent += fmt.Sprintf("Modified: %s\n", stat.ModTime().UTC().Format(time.RFC3339))
+						if w.copyMailboxes {
+							infoContent += fmt.Sprintf("Note: Email data file copied (--copy-mailboxes)\n\n")
+						} else {
+							infoContent += fmt.Sprintf("Note: Email data file not copied due to size and privacy constraints\n\n")
+						}
+
+						if w.parse {
+							mailboxes = append(mailboxes, w.describeMailbox(srcPath, stat))
+						}
+						if w.copyMailboxes {
+							w.copyMailbox(ctx, srcPath, outlookOutDir, manifest, stat, username)
+						}
 					}
 				}
 			}
@@ -234,7 +293,7 @@ func (w *WinApplications) collectOutlookArtifacts(ctx context.Context, userProfi
 				infoPath := filepath.Join(outlookOutDir, "outlook_files_info.txt")
 				if err := os.WriteFile(infoPath, []byte(infoContent), 0644); err == nil {
 					if stat, err := os.Stat(infoPath); err == nil {
-						if sha256Hex, err := winutil.HashFile(infoPath); err == nil {
+						if sha256Hex, err := winutil.HashFile(ctx, infoPath); err == nil {
 							relPath := filepath.Join("users", username, "outlook", "outlook_files_info.txt")
 							note := fmt.Sprintf("Outlook data files metadata for user %s", username)
 							manifest.AddItem(relPath, stat.Size(), sha256Hex, false, stat.ModTime(), "outlook", note)
@@ -242,8 +301,161 @@ func (w *WinApplications) collectOutlookArtifacts(ctx context.Context, userProfi
 					}
 				}
 			}
+
+			if len(mailboxes) > 0 {
+				if err := writeMailboxes(ctx, mailboxes, outlookOutDir, manifest, username); err != nil {
+					manifest.AddError(fmt.Sprintf("user:%s:outlook_mailboxes", username), err.Error())
+				}
+			}
+		}
+	}
+}
+
+// describeMailbox decodes a PST/OST file in place. The file is opened with
+// backup semantics and generous sharing so an OST held open by Outlook can
+// still be read.
+func (w *WinApplications) describeMailbox(srcPath string, stat os.FileInfo) OutlookMailbox {
+	file, err := winutil.OpenForCopy(srcPath)
+	if err != nil {
+		return OutlookMailbox{
+			File:     stat.Name(),
+			Size:     stat.Size(),
+			Modified: winutil.FormatTime(stat.ModTime()),
+			Error:    fmt.Sprintf("failed to open: %v", err),
 		}
 	}
+	defer file.Close()
+
+	return DescribeMailbox(file, stat.Size(), stat.Name(), stat.ModTime())
+}
+
+// copyMailbox copies a whole PST/OST file. Mailboxes are routinely larger
+// than the per-file cap, which would truncate them into unreadable files, so
+// the cap is not applied; the copy is made only on explicit request.
+func (w *WinApplications) copyMailbox(ctx context.Context, srcPath, outlookOutDir string, manifest *ApplicationManifest, stat os.FileInfo, username string) {
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+
+	destPath := filepath.Join(outlookOutDir, stat.Name())
+	size, sha256Hex, err := winutil.CopyFile(ctx, srcPath, destPath)
+	if err != nil {
+		os.Remove(destPath)
+		manifest.AddError(fmt.Sprintf("user:%s:%s", username, stat.Name()), fmt.Sprintf("failed to copy mailbox: %v", err))
+		return
+	}
+	relPath := filepath.Join("users", username, "outlook", stat.Name())
+	note := fmt.Sprintf("Outlook data file for user %s", username)
+	manifest.AddItem(relPath, size, sha256Hex, false, stat.ModTime(), "outlook", note)
+}
+
+// collectTerminalArtifacts copies the settings.json and state.json of each
+// Windows Terminal installation, packaged or unpackaged, and writes
+// windows_terminal.json with their profiles and startup commands and the
+// user's legacy console settings from NTUSER.DAT.
+func (w *WinApplications) collectTerminalArtifacts(ctx context.Context, userProfileDir, userOutDir, hiveDir string, manifest *ApplicationManifest, constraints *winutil.SizeConstraints, username string) error {
+	installs := TerminalInstallations(filepath.Join(userProfileDir, "AppData", "Local"))
+
+	var since time.Time
+	if w.sinceTime != "" {
+		since, _ = time.Parse(time.RFC3339, w.sinceTime)
+	}
+
+	report := NewTerminalReport(username)
+	names := make([]string, 0, len(installs))
+	for name := range installs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		winutil.CollectSettingsFrom(ctx).Coverage.Check(userOutDir, "Windows Terminal "+name, installs[name])
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		settings := TerminalSettings{Package: name, Profiles: make([]TerminalProfile, 0)}
+		found := false
+		for _, file := range []string{"settings.json", "state.json"} {
+			srcPath := filepath.Join(installs[name], file)
+			stat, err := os.Stat(srcPath)
+			if err != nil || (!since.IsZero() && stat.ModTime().Before(since)) {
+				continue
+			}
+			found = true
+			manifest.IncrementTotalFiles()
+			installOutDir := filepath.Join(userOutDir, "terminal", name)
+			if err := winutil.EnsureDir(installOutDir); err != nil {
+				settings.Errors = append(settings.Errors, err.Error())
+				continue
+			}
+			destPath := filepath.Join(installOutDir, file)
+			size, sha256Hex, truncated, err := winutil.SmartCopy(srcPath, destPath, constraints)
+			if err != nil {
+				settings.Errors = append(settings.Errors, fmt.Sprintf("%s: %v", file, err))
+				continue
+			}
+			relPath := filepath.Join("users", username, "terminal", name, file)
+			note := fmt.Sprintf("Windows Terminal %s (%s) for user %s", file, name, username)
+			manifest.AddItem(relPath, size, sha256Hex, truncated, stat.ModTime(), "terminal", note)
+
+			data, err := os.ReadFile(destPath)
+			if err != nil || truncated {
+				continue
+			}
+			if file == "settings.json" {
+				settings.SettingsFile = relPath
+				err = ParseTerminalSettings(data, &settings)
+			} else {
+				settings.StateFile = relPath
+				err = ParseTerminalState(data, &settings)
+			}
+			if err != nil {
+				settings.Errors = append(settings.Errors, err.Error())
+			}
+		}
+		if found {
+			report.Installations = append(report.Installations, settings)
+		}
+	}
+
+	ntuser := filepath.Join(userProfileDir, "NTUSER.DAT")
+	if _, err := os.Stat(ntuser); err == nil {
+		if hive, err := openHive(filepath.Join(hiveDir, "NTUSER_"+username+".hiv"), ntuser); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("NTUSER.DAT: %v", err))
+		} else {
+			if err := report.AddConsoleHive(hive); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("NTUSER.DAT: %v", err))
+			}
+			hive.Close()
+		}
+	}
+
+	if len(report.Installations) == 0 && len(report.Console) == 0 && len(report.Errors) == 0 {
+		return nil
+	}
+	terminalOutDir := filepath.Join(userOutDir, "terminal")
+	if err := winutil.EnsureDir(terminalOutDir); err != nil {
+		return err
+	}
+	return WriteTerminalReport(ctx, report, terminalOutDir, manifest)
+}
+
+// openHive opens the registry module's copy of a hive when it is valid, and
+// the hive on the collection target otherwise.
+func openHive(registryCopy, hostPath string) (*regf.Hive, error) {
+	if regf.CheckFile(registryCopy).Valid {
+		if hive, err := regf.Open(registryCopy); err == nil {
+			return hive, nil
+		}
+	}
+	hive, err := regf.Open(hostPath)
+	if err != nil {
+		return nil, fmt.Errorf("no valid registry module copy, and %w", err)
+	}
+	return hive, nil
 }
 
 // collectWindowsDefender collects Windows Defender logs and quarantine information.
@@ -254,16 +466,10 @@ func (w *WinApplications) collectWindowsDefender(ctx context.Context, outDir str
 	}
 
 	// Collect Windows Defender logs from ProgramData
-	programData := os.Getenv("ProgramData")
-	if programData == "" {
-		systemDrive := os.Getenv("SystemDrive")
-		if systemDrive == "" {
-			systemDrive = "C:"
-		}
-		programData = filepath.Join(systemDrive, "ProgramData")
-	}
+	programData := winutil.ProgramData()
 
 	defenderLogDir := filepath.Join(programData, "Microsoft", "Windows Defender", "Support")
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(outDir, "Windows Defender logs", defenderLogDir)
 	if entries, err := os.ReadDir(defenderLogDir); err == nil {
 		for _, entry := range entries {
 			if entry.IsDir() {
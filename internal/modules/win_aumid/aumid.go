@@ -0,0 +1,410 @@
+package win_aumid
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cryptkeeper/internal/lnk"
+	"cryptkeeper/internal/regf"
+)
+
+// AUMID kinds.
+const (
+	KindPackaged = "packaged" // PackageFamilyName!AppId of an AppX/MSIX application
+	KindDesktop  = "desktop"  // Explicit or path-derived ID of a desktop application
+)
+
+// AUMID sources.
+const (
+	SourceStartApps          = "get_startapps"
+	SourceStartMenu          = "start_menu_shortcut"
+	SourceActivatableClasses = "activatable_classes"
+)
+
+// activatableClassesKey lists packaged application servers, relative to a
+// Classes root (UsrClass.dat, or Classes under the SOFTWARE hive).
+const activatableClassesKey = `ActivatableClasses\Package`
+
+// packageRepositoryKey holds per-package display names and install folders, relative to UsrClass.dat.
+const packageRepositoryKey = `Local Settings\Software\Microsoft\Windows\CurrentVersion\AppModel\Repository\Packages`
+
+// knownFolder is a folder the shell substitutes with its KNOWNFOLDERID when
+// deriving a desktop application's AUMID from its executable path.
+type knownFolder struct {
+	ID      string
+	Path    string // Relative to the system drive, or to the user profile when PerUser
+	PerUser bool
+}
+
+// knownFolders is ordered so that nested folders match before their parents.
+var knownFolders = []knownFolder{
+	{ID: "{5CD7AEE2-2219-4A67-B85D-6C9CE15660CB}", Path: `AppData\Local\Programs`, PerUser: true},
+	{ID: "{F1B32785-6FBA-4FCF-9D55-7B8E7F157091}", Path: `AppData\Local`, PerUser: true},
+	{ID: "{3EB685DB-65F9-4CF6-A03A-E3EF65729F3D}", Path: `AppData\Roaming`, PerUser: true},
+	{ID: "{5E6C858F-0E22-4760-9AFE-EA3317B67173}", Path: ``, PerUser: true},
+	{ID: "{6D809377-6AF0-444B-8957-A3773F02200E}", Path: `Program Files`},
+	{ID: "{7C5A40EF-A0FB-4BFC-874A-C0F2E0B9FA8E}", Path: `Program Files (x86)`},
+	{ID: "{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}", Path: `Windows\System32`},
+	{ID: "{D65231B0-B2F1-4857-A4CE-A8E7C6EA7D27}", Path: `Windows\SysWOW64`},
+	{ID: "{F38BF404-1D43-42F2-9305-67DE0B28FC23}", Path: `Windows`},
+	{ID: "{62AB5D82-FDC1-4DC3-A9DD-070D1D495D97}", Path: `ProgramData`},
+}
+
+// AUMIDEntry maps one AppUserModelID to the application it names.
+type AUMIDEntry struct {
+	AUMID           string   `json:"aumid"`
+	Kind            string   `json:"kind"` // "packaged" or "desktop"
+	DisplayName     string   `json:"display_name,omitempty"`
+	ExecutablePath  string   `json:"executable_path,omitempty"`
+	PackageFullName string   `json:"package_full_name,omitempty"`
+	PackageFamily   string   `json:"package_family,omitempty"`
+	InstallLocation string   `json:"install_location,omitempty"`
+	Users           []string `json:"users,omitempty"` // Profiles the mapping was found for; empty for system-wide sources
+	Sources         []string `json:"sources"`
+}
+
+// AUMIDMap is the structure written to aumid_map.json.
+type AUMIDMap struct {
+	CollectedUTC string       `json:"collected_utc"`
+	Entries      []AUMIDEntry `json:"entries"`
+	Errors       []string     `json:"errors,omitempty"`
+}
+
+// Lookup returns the entry for an AUMID, ignoring case.
+func (m *AUMIDMap) Lookup(aumid string) (AUMIDEntry, bool) {
+	for _, entry := range m.Entries {
+		if strings.EqualFold(entry.AUMID, aumid) {
+			return entry, true
+		}
+	}
+	return AUMIDEntry{}, false
+}
+
+// StartApp is one application listed by Get-StartApps.
+type StartApp struct {
+	Name  string `json:"Name"`
+	AppID string `json:"AppID"`
+}
+
+// packageInfo is the package-level metadata from the AppModel repository.
+type packageInfo struct {
+	FullName        string
+	DisplayName     string
+	InstallLocation string
+}
+
+// AUMIDBuilder merges AUMID mappings from several sources. Where sources
+// disagree, the first non-empty display name and executable path win, so
+// callers add the most authoritative source first.
+type AUMIDBuilder struct {
+	entries  map[string]*AUMIDEntry
+	packages map[string]packageInfo // Keyed by lowercased package full name
+}
+
+// NewAUMIDBuilder creates an empty builder.
+func NewAUMIDBuilder() *AUMIDBuilder {
+	return &AUMIDBuilder{
+		entries:  make(map[string]*AUMIDEntry),
+		packages: make(map[string]packageInfo),
+	}
+}
+
+// entry returns the entry for aumid, creating it on first use.
+func (b *AUMIDBuilder) entry(aumid string) *AUMIDEntry {
+	key := strings.ToLower(aumid)
+	if e, ok := b.entries[key]; ok {
+		return e
+	}
+	e := &AUMIDEntry{AUMID: aumid, Kind: AUMIDKind(aumid), Sources: make([]string, 0, 1)}
+	if e.Kind == KindPackaged {
+		e.PackageFamily = aumid[:strings.Index(aumid, "!")]
+	}
+	b.entries[key] = e
+	return e
+}
+
+// merge fills empty fields of an entry and records the source and user.
+func (b *AUMIDBuilder) merge(aumid, displayName, exePath, source, user string) *AUMIDEntry {
+	e := b.entry(aumid)
+	if e.DisplayName == "" {
+		e.DisplayName = displayName
+	}
+	if e.ExecutablePath == "" {
+		e.ExecutablePath = exePath
+	}
+	if !containsFold(e.Sources, source) {
+		e.Sources = append(e.Sources, source)
+	}
+	if user != "" && !containsFold(e.Users, user) {
+		e.Users = append(e.Users, user)
+	}
+	return e
+}
+
+// AddStartApps adds the applications listed by Get-StartApps for the
+// collecting account. Path-derived desktop IDs are resolved against profileDir.
+func (b *AUMIDBuilder) AddStartApps(apps []StartApp, user, systemDrive, profileDir string) {
+	for _, app := range apps {
+		if app.AppID == "" {
+			continue
+		}
+		exePath := ResolveKnownFolderPath(app.AppID, systemDrive, profileDir)
+		b.merge(app.AppID, strings.TrimSpace(app.Name), exePath, SourceStartApps, user)
+	}
+}
+
+// AddShortcut adds a Start Menu shortcut. Shortcuts without an explicit
+// System.AppUserModel.ID map under the ID the shell derives from the target.
+// user is empty for the all-users Start Menu.
+func (b *AUMIDBuilder) AddShortcut(lnkPath string, shortcut *lnk.Shortcut, user string) {
+	aumid := shortcut.AppUserModelID
+	if aumid == "" {
+		aumid = DesktopAUMID(shortcut.TargetPath)
+	}
+	if aumid == "" {
+		return
+	}
+	name := strings.TrimSuffix(filepath.Base(lnkPath), filepath.Ext(lnkPath))
+	b.merge(aumid, name, shortcut.TargetPath, SourceStartMenu, user)
+}
+
+// AddClassesHive adds packaged applications registered under
+// ActivatableClasses in a Classes hive root (UsrClass.dat), and package
+// display names from its AppModel repository. classesPrefix is prepended to
+// both keys, e.g. "Classes" when reading the SOFTWARE hive.
+func (b *AUMIDBuilder) AddClassesHive(hive *regf.Hive, classesPrefix, user string) error {
+	repoPath := packageRepositoryKey
+	classesPath := activatableClassesKey
+	if classesPrefix != "" {
+		repoPath = classesPrefix + `\` + repoPath
+		classesPath = classesPrefix + `\` + classesPath
+	}
+
+	// Package metadata first, so server entries can pick it up
+	if repo, err := hive.OpenKey(repoPath); err == nil {
+		if packages, err := repo.Subkeys(); err == nil {
+			for _, pkg := range packages {
+				info := packageInfo{FullName: pkg.Name}
+				if v, err := pkg.Value("DisplayName"); err == nil {
+					info.DisplayName = strings.TrimSpace(v.String())
+				}
+				if v, err := pkg.Value("PackageRootFolder"); err == nil {
+					info.InstallLocation = strings.TrimSpace(v.String())
+				}
+				b.packages[strings.ToLower(pkg.Name)] = info
+			}
+		}
+	}
+
+	key, err := hive.OpenKey(classesPath)
+	if errors.Is(err, regf.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", classesPath, err)
+	}
+	packages, err := key.Subkeys()
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", classesPath, err)
+	}
+
+	for _, pkg := range packages {
+		server, err := pkg.Subkey("Server")
+		if err != nil {
+			continue
+		}
+		servers, err := server.Subkeys()
+		if err != nil {
+			continue
+		}
+		for _, srv := range servers {
+			v, err := srv.Value("AppUserModelId")
+			if err != nil {
+				continue
+			}
+			aumid := strings.TrimSpace(v.String())
+			if aumid == "" {
+				continue
+			}
+			exePath := ""
+			if exe, err := srv.Value("ExePath"); err == nil {
+				exePath = strings.TrimSpace(exe.String())
+			}
+			e := b.merge(aumid, "", exePath, SourceActivatableClasses, user)
+			if e.PackageFullName == "" {
+				e.PackageFullName = pkg.Name
+			}
+		}
+	}
+
+	return nil
+}
+
+// Build returns the merged entries sorted by AUMID, with package display
+// names and install locations filled in for packaged applications.
+func (b *AUMIDBuilder) Build() []AUMIDEntry {
+	// Get-StartApps names packages only by family
+	families := make(map[string]string)
+	for _, info := range b.packages {
+		if family := PackageFamilyName(info.FullName); family != "" {
+			families[strings.ToLower(family)] = info.FullName
+		}
+	}
+
+	entries := make([]AUMIDEntry, 0, len(b.entries))
+	for _, e := range b.entries {
+		if e.Kind == KindPackaged && e.PackageFullName == "" {
+			e.PackageFullName = families[strings.ToLower(e.PackageFamily)]
+		}
+		if e.PackageFullName != "" {
+			if info, ok := b.packages[strings.ToLower(e.PackageFullName)]; ok {
+				if e.DisplayName == "" {
+					e.DisplayName = info.DisplayName
+				}
+				e.InstallLocation = info.InstallLocation
+			}
+		}
+		// A packaged server's ExePath is relative to the install folder
+		if e.InstallLocation != "" && e.ExecutablePath != "" && !strings.HasPrefix(e.ExecutablePath, `\`) && !strings.Contains(e.ExecutablePath, `:\`) {
+			e.ExecutablePath = e.InstallLocation + `\` + e.ExecutablePath
+		}
+		sort.Strings(e.Users)
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].AUMID) < strings.ToLower(entries[j].AUMID)
+	})
+	return entries
+}
+
+// ParseStartApps decodes Get-StartApps | ConvertTo-Json output.
+func ParseStartApps(data []byte) ([]StartApp, error) {
+	var apps []StartApp
+	if err := unmarshalPowerShellJSON(data, &apps); err != nil {
+		return nil, fmt.Errorf("failed to parse Get-StartApps output: %w", err)
+	}
+	return apps, nil
+}
+
+// AUMIDKind classifies an AUMID. Packaged IDs are PackageFamilyName!AppId,
+// where the family name ends in a 13-character publisher hash.
+func AUMIDKind(aumid string) string {
+	bang := strings.Index(aumid, "!")
+	if bang <= 0 || bang == len(aumid)-1 {
+		return KindDesktop
+	}
+	family := aumid[:bang]
+	underscore := strings.LastIndex(family, "_")
+	if underscore <= 0 || len(family)-underscore-1 != 13 {
+		return KindDesktop
+	}
+	return KindPackaged
+}
+
+// PackageFamilyName derives Name_PublisherId from a package full name
+// (Name_Version_Architecture_ResourceId_PublisherId).
+func PackageFamilyName(fullName string) string {
+	parts := strings.Split(fullName, "_")
+	if len(parts) != 5 {
+		return ""
+	}
+	return parts[0] + "_" + parts[4]
+}
+
+// DesktopAUMID derives the ID the shell assigns a desktop application that
+// sets none: its executable path with a known-folder prefix replaced by the
+// folder's KNOWNFOLDERID, e.g. {6D809377-...}\Mozilla Firefox\firefox.exe.
+// It returns "" for paths outside the known folders.
+func DesktopAUMID(targetPath string) string {
+	if len(targetPath) < 3 || targetPath[1] != ':' || targetPath[2] != '\\' {
+		return ""
+	}
+	rest := targetPath[3:]
+	lower := strings.ToLower(rest)
+
+	// Per-user folders under Users\<name>
+	userRest := ""
+	if strings.HasPrefix(lower, `users\`) {
+		if i := strings.Index(rest[len(`users\`):], `\`); i >= 0 {
+			userRest = rest[len(`users\`)+i+1:]
+		}
+	}
+
+	for _, folder := range knownFolders {
+		candidate := rest
+		if folder.PerUser {
+			if userRest == "" {
+				continue
+			}
+			candidate = userRest
+		}
+		if folder.Path == "" {
+			return folder.ID + `\` + candidate
+		}
+		prefix := strings.ToLower(folder.Path) + `\`
+		if strings.HasPrefix(strings.ToLower(candidate), prefix) {
+			return folder.ID + `\` + candidate[len(prefix):]
+		}
+	}
+	return ""
+}
+
+// ResolveKnownFolderPath expands a path-derived desktop AUMID back to an
+// executable path. systemDrive is e.g. "C:"; profileDir resolves per-user
+// folders and may be empty. It returns "" for other AUMIDs.
+func ResolveKnownFolderPath(aumid, systemDrive, profileDir string) string {
+	if !strings.HasPrefix(aumid, "{") {
+		return ""
+	}
+	end := strings.Index(aumid, "}")
+	if end < 0 || end+1 >= len(aumid) || aumid[end+1] != '\\' {
+		return ""
+	}
+	id, rest := aumid[:end+1], aumid[end+2:]
+
+	for _, folder := range knownFolders {
+		if !strings.EqualFold(folder.ID, id) {
+			continue
+		}
+		base := systemDrive + `\` + folder.Path
+		if folder.PerUser {
+			if profileDir == "" {
+				return ""
+			}
+			base = profileDir
+			if folder.Path != "" {
+				base += `\` + folder.Path
+			}
+		}
+		return base + `\` + rest
+	}
+	return ""
+}
+
+// unmarshalPowerShellJSON decodes ConvertTo-Json output, which emits a bare object
+// instead of an array when the pipeline yields a single item.
+func unmarshalPowerShellJSON(data []byte, v interface{}) error {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] == '{' {
+		data = append(append([]byte("["), data...), ']')
+	}
+	return json.Unmarshal(data, v)
+}
+
+// containsFold reports whether list contains s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package win_aumid
+
+import (
+	"reflect"
+	"testing"
+
+	"cryptkeeper/internal/lnk"
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+)
+
+const (
+	calculatorFullName = "Microsoft.WindowsCalculator_11.2210.0.0_x64__8wekyb3d8bbwe"
+	calculatorAUMID    = "Microsoft.WindowsCalculator_8wekyb3d8bbwe!App"
+	firefoxAUMID       = `{6D809377-6AF0-444B-8957-A3773F02200E}\Mozilla Firefox\firefox.exe`
+)
+
+// sampleStartApps is Get-StartApps output for alice.
+const sampleStartApps = "\xef\xbb\xbf" + `[
+{"Name":"Calculator","AppID":"Microsoft.WindowsCalculator_8wekyb3d8bbwe!App"},
+{"Name":"Firefox","AppID":"{6D809377-6AF0-444B-8957-A3773F02200E}\\Mozilla Firefox\\firefox.exe"},
+{"Name":"Slack","AppID":"com.squirrel.slack.slack"},
+{"Name":"","AppID":""}
+]`
+
+// sampleUsrClass is alice's UsrClass.dat with Calculator registered.
+func sampleUsrClass(t *testing.T) *regf.Hive {
+	t.Helper()
+	path := regftest.WriteFile(t, "UsrClass.dat", &regftest.Key{
+		Name: "S-1-5-21-1004336348-1177238915-682003330-1001_Classes",
+		Subkeys: []*regftest.Key{
+			regftest.Path(activatableClassesKey, &regftest.Key{
+				Name: calculatorFullName,
+				Subkeys: []*regftest.Key{regftest.Path("Server", &regftest.Key{
+					Name: "App.AppX1a2b3c.mca",
+					Values: []regftest.Value{
+						regftest.String("AppUserModelId", calculatorAUMID),
+						regftest.String("ExePath", "CalculatorApp.exe"),
+					},
+				})},
+			}),
+			regftest.Path(packageRepositoryKey, &regftest.Key{
+				Name: calculatorFullName,
+				Values: []regftest.Value{
+					regftest.String("DisplayName", "@{Microsoft.WindowsCalculator_11.2210.0.0_x64__8wekyb3d8bbwe?ms-resource://Microsoft.WindowsCalculator/Resources/AppStoreName}"),
+					regftest.String("PackageRootFolder", `C:\Program Files\WindowsApps\`+calculatorFullName),
+				},
+			}),
+		},
+	})
+	hive, err := regf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hive.Close() })
+	return hive
+}
+
+func TestAUMIDBuilderMergesSources(t *testing.T) {
+	apps, err := ParseStartApps([]byte(sampleStartApps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := NewAUMIDBuilder()
+	builder.AddStartApps(apps, "alice", "C:", `C:\Users\alice`)
+	builder.AddShortcut(`C:\ProgramData\Microsoft\Windows\Start Menu\Programs\Firefox.lnk`, &lnk.Shortcut{TargetPath: `C:\Program Files\Mozilla Firefox\firefox.exe`}, "")
+	builder.AddShortcut(`C:\Users\bob\AppData\Roaming\Microsoft\Windows\Start Menu\Programs\Slack.lnk`, &lnk.Shortcut{TargetPath: `C:\Users\bob\AppData\Local\slack\slack.exe`, AppUserModelID: "com.squirrel.slack.slack"}, "bob")
+	builder.AddShortcut(`C:\Users\bob\Desktop\tool.lnk`, &lnk.Shortcut{TargetPath: `D:\tools\tool.exe`}, "bob")
+	if err := builder.AddClassesHive(sampleUsrClass(t), "", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &AUMIDMap{Entries: builder.Build()}
+	if len(m.Entries) != 3 {
+		t.Fatalf("entries = %+v", m.Entries)
+	}
+
+	calculator, ok := m.Lookup("microsoft.windowscalculator_8wekyb3d8bbwe!app")
+	want := AUMIDEntry{
+		AUMID:           calculatorAUMID,
+		Kind:            KindPackaged,
+		DisplayName:     "Calculator",
+		ExecutablePath:  `C:\Program Files\WindowsApps\` + calculatorFullName + `\CalculatorApp.exe`,
+		PackageFullName: calculatorFullName,
+		PackageFamily:   "Microsoft.WindowsCalculator_8wekyb3d8bbwe",
+		InstallLocation: `C:\Program Files\WindowsApps\` + calculatorFullName,
+		Users:           []string{"alice"},
+		Sources:         []string{SourceStartApps, SourceActivatableClasses},
+	}
+	if !ok || !reflect.DeepEqual(calculator, want) {
+		t.Errorf("calculator = %+v\nwant %+v", calculator, want)
+	}
+
+	firefox, ok := m.Lookup(firefoxAUMID)
+	if !ok || firefox.Kind != KindDesktop || firefox.DisplayName != "Firefox" || firefox.ExecutablePath != `C:\Program Files\Mozilla Firefox\firefox.exe` {
+		t.Errorf("firefox = %+v", firefox)
+	}
+	if !reflect.DeepEqual(firefox.Sources, []string{SourceStartApps, SourceStartMenu}) || !reflect.DeepEqual(firefox.Users, []string{"alice"}) {
+		t.Errorf("firefox sources %v, users %v", firefox.Sources, firefox.Users)
+	}
+
+	// An explicit ID carries no path, so it is filled from the shortcut
+	slack, ok := m.Lookup("com.squirrel.slack.slack")
+	if !ok || slack.DisplayName != "Slack" || slack.ExecutablePath != `C:\Users\bob\AppData\Local\slack\slack.exe` || !reflect.DeepEqual(slack.Users, []string{"alice", "bob"}) {
+		t.Errorf("slack = %+v", slack)
+	}
+	if _, ok := m.Lookup(`D:\tools\tool.exe`); ok {
+		t.Error("shortcut outside the known folders mapped")
+	}
+}
+
+func TestDesktopAUMIDRoundTrip(t *testing.T) {
+	tests := []struct {
+		path  string
+		aumid string
+	}{
+		{`C:\Program Files\Mozilla Firefox\firefox.exe`, firefoxAUMID},
+		{`C:\Program Files (x86)\Notepad++\notepad++.exe`, `{7C5A40EF-A0FB-4BFC-874A-C0F2E0B9FA8E}\Notepad++\notepad++.exe`},
+		{`C:\Windows\System32\cmd.exe`, `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\cmd.exe`},
+		{`C:\Users\alice\AppData\Local\Programs\Microsoft VS Code\Code.exe`, `{5CD7AEE2-2219-4A67-B85D-6C9CE15660CB}\Microsoft VS Code\Code.exe`},
+		{`C:\Users\alice\AppData\Local\Discord\Update.exe`, `{F1B32785-6FBA-4FCF-9D55-7B8E7F157091}\Discord\Update.exe`},
+		{`C:\Users\alice\tools\nc.exe`, `{5E6C858F-0E22-4760-9AFE-EA3317B67173}\tools\nc.exe`},
+	}
+	for _, tt := range tests {
+		if got := DesktopAUMID(tt.path); got != tt.aumid {
+			t.Errorf("DesktopAUMID(%q) = %q, want %q", tt.path, got, tt.aumid)
+		}
+		if got := ResolveKnownFolderPath(tt.aumid, "C:", `C:\Users\alice`); got != tt.path {
+			t.Errorf("ResolveKnownFolderPath(%q) = %q, want %q", tt.aumid, got, tt.path)
+		}
+	}
+	if got := ResolveKnownFolderPath(`{5E6C858F-0E22-4760-9AFE-EA3317B67173}\tools\nc.exe`, "C:", ""); got != "" {
+		t.Errorf("per-user folder resolved without a profile: %q", got)
+	}
+}
+
+func TestAUMIDKind(t *testing.T) {
+	tests := map[string]string{
+		calculatorAUMID:              KindPackaged,
+		"Microsoft.Windows.Explorer": KindDesktop,
+		"Chrome!App":                 KindDesktop,
+		"Microsoft.WindowsCalculator_8wekyb3d8bbwe!": KindDesktop,
+	}
+	for aumid, want := range tests {
+		if got := AUMIDKind(aumid); got != want {
+			t.Errorf("AUMIDKind(%q) = %q, want %q", aumid, got, want)
+		}
+	}
+	if got := PackageFamilyName(calculatorFullName); got != "Microsoft.WindowsCalculator_8wekyb3d8bbwe" {
+		t.Errorf("PackageFamilyName = %q", got)
+	}
+}
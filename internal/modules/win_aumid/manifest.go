@@ -0,0 +1,100 @@
+// Package win_aumid provides AppUserModelID mapping collection for cryptkeeper.
+package win_aumid
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
+)
+
+// AUMIDItem represents a collected AUMID artifact.
+type AUMIDItem struct {
+	Path      string `json:"path"`           // Relative path in the archive
+	Size      int64  `json:"size"`           // File size in bytes
+	SHA256    string `json:"sha256"`         // SHA-256 hash
+	Truncated bool   `json:"truncated"`      // Whether the file was truncated due to size limits
+	Note      string `json:"note,omitempty"` // Description of the file
+	Modified  string `json:"modified"`       // File modification time (RFC3339)
+	FileType  string `json:"file_type"`      // Type: "aumid_map"
+}
+
+// AUMIDError represents an error that occurred during collection.
+type AUMIDError struct {
+	Target string `json:"target"` // What failed (e.g., specific file path)
+	Error  string `json:"error"`  // Error message
+}
+
+// AUMIDManifest represents the complete manifest for AUMID collection.
+type AUMIDManifest struct {
+	CreatedUTC         string         `json:"created_utc"`
+	Host               string         `json:"host"`
+	CryptkeeperVersion string         `json:"cryptkeeper_version"`
+	Items              []AUMIDItem    `json:"items"`
+	Errors             []AUMIDError   `json:"errors"`
+	TotalFiles         int            `json:"total_files"`
+	CollectedFiles     int            `json:"collected_files"`
+	AUMIDsFound        int            `json:"aumids_found"`
+	Summary            schema.Summary `json:"summary"`
+}
+
+// NewAUMIDManifest creates a new AUMID manifest with basic information.
+func NewAUMIDManifest(ctx context.Context, hostname string) *AUMIDManifest {
+	return &AUMIDManifest{
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
+		Host:               hostname,
+		CryptkeeperVersion: "v0.1.0",
+		Items:              make([]AUMIDItem, 0),
+		Errors:             make([]AUMIDError, 0),
+		TotalFiles:         0,
+		CollectedFiles:     0,
+		AUMIDsFound:        0,
+		Summary:            schema.NewSummary(),
+	}
+}
+
+// AddItem adds a successfully collected AUMID item to the manifest.
+func (am *AUMIDManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, note string) {
+	am.Items = append(am.Items, AUMIDItem{
+		Path:      path,
+		Size:      size,
+		SHA256:    sha256,
+		Truncated: truncated,
+		Note:      note,
+		Modified:  winutil.FormatTime(modified),
+		FileType:  fileType,
+	})
+	am.CollectedFiles++
+}
+
+// AddError adds an error to the manifest for a failed collection.
+func (am *AUMIDManifest) AddError(target, errorMsg string) {
+	am.Errors = append(am.Errors, AUMIDError{
+		Target: target,
+		Error:  errorMsg,
+	})
+}
+
+// IncrementTotalFiles increments the count of total files found.
+func (am *AUMIDManifest) IncrementTotalFiles() {
+	am.TotalFiles++
+}
+
+// SetAUMIDsFound sets the number of AppUserModelIDs mapped.
+func (am *AUMIDManifest) SetAUMIDsFound(count int) {
+	am.AUMIDsFound = count
+	am.Summary.Set(schema.SummaryAUMIDs, count)
+}
+
+// WriteManifest writes the manifest to a JSON file.
+func (am *AUMIDManifest) WriteManifest(manifestPath string) error {
+	data, err := json.MarshalIndent(am, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath, data, 0644)
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package win_aumid
+
+import (
+	"context"
+)
+
+// WinAUMID represents the AppUserModelID mapping collection module (no-op on non-Windows).
+type WinAUMID struct{}
+
+// NewWinAUMID creates a new AppUserModelID mapping collection module.
+func NewWinAUMID() *WinAUMID {
+	return &WinAUMID{}
+}
+
+// Name returns the module's identifier.
+func (w *WinAUMID) Name() string {
+	return "windows/aumid"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinAUMID) Describe() string {
+	return "AppUserModelID to application map"
+}
+
+// Collect is a no-op on non-Windows systems.
+func (w *WinAUMID) Collect(ctx context.Context, outDir string) error {
+	// No-op on non-Windows systems
+	return nil
+}
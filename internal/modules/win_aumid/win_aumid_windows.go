@@ -0,0 +1,287 @@
+//go:build windows
+
+package win_aumid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cryptkeeper/internal/lnk"
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// profileListKey maps user SIDs to profile directories.
+const profileListKey = `HKLM\SOFTWARE\Microsoft\Windows NT\CurrentVersion\ProfileList`
+
+// startAppsScript lists the Start menu applications of the collecting account as JSON.
+const startAppsScript = `Get-StartApps | Select-Object Name, AppID | ConvertTo-Json -Compress`
+
+// startMenuPrograms is the Programs folder under a Start Menu root.
+var startMenuPrograms = filepath.Join("Microsoft", "Windows", "Start Menu", "Programs")
+
+// WinAUMID represents the AppUserModelID mapping collection module.
+type WinAUMID struct{}
+
+// NewWinAUMID creates a new AppUserModelID mapping collection module.
+func NewWinAUMID() *WinAUMID {
+	return &WinAUMID{}
+}
+
+// Name returns the module's identifier.
+func (w *WinAUMID) Name() string {
+	return "windows/aumid"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinAUMID) Describe() string {
+	return "AppUserModelID to application map"
+}
+
+// Collect builds aumid_map.json from Get-StartApps, Start Menu shortcuts, and
+// the ActivatableClasses registrations in each Classes hive, and creates a manifest.
+func (w *WinAUMID) Collect(ctx context.Context, outDir string) error {
+	// Create the windows/aumid subdirectory
+	aumidDir := filepath.Join(outDir, "windows", "aumid")
+	if err := winutil.EnsureDir(aumidDir); err != nil {
+		return fmt.Errorf("failed to create aumid directory: %w", err)
+	}
+
+	// Get hostname for manifest
+	hostname, err := winutil.Hostname(ctx)
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	manifest := NewAUMIDManifest(ctx, hostname)
+	builder := NewAUMIDBuilder()
+	aumidMap := &AUMIDMap{Entries: make([]AUMIDEntry, 0)}
+
+	// Get-StartApps first: its names are what the user sees in the Start menu
+	if err := w.addStartApps(ctx, builder); err != nil && !errors.Is(err, winutil.ErrRequiresLiveSystem) {
+		aumidMap.Errors = append(aumidMap.Errors, err.Error())
+	}
+
+	// All-users Start Menu and the machine-wide Classes registrations
+	w.addShortcuts(ctx, filepath.Join(winutil.ProgramData(), startMenuPrograms), "", builder, aumidMap)
+	if err := w.addSoftwareHive(ctx, builder); err != nil {
+		aumidMap.Errors = append(aumidMap.Errors, err.Error())
+	}
+
+	if err := w.addUsers(ctx, builder, aumidMap); err != nil {
+		aumidMap.Errors = append(aumidMap.Errors, err.Error())
+		manifest.AddError("users", fmt.Sprintf("Failed to enumerate user profiles: %v", err))
+	}
+
+	aumidMap.Entries = builder.Build()
+	aumidMap.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+	manifest.SetAUMIDsFound(len(aumidMap.Entries))
+
+	if err := w.writeMap(ctx, aumidDir, aumidMap, manifest); err != nil {
+		manifest.AddError("aumid_map.json", err.Error())
+	}
+
+	// Write manifest
+	manifestPath := filepath.Join(aumidDir, "manifest.json")
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// addStartApps adds Get-StartApps output for the collecting account.
+func (w *WinAUMID) addStartApps(ctx context.Context, builder *AUMIDBuilder) error {
+	output, err := winutil.RunCommandWithOutput(ctx, "powershell", []string{"-NoProfile", "-Command", startAppsScript})
+	if err != nil {
+		return fmt.Errorf("failed to run PowerShell Get-StartApps: %w", err)
+	}
+	apps, err := ParseStartApps(output)
+	if err != nil {
+		return err
+	}
+	builder.AddStartApps(apps, winutil.Getenv(ctx, "USERNAME"), winutil.SystemDrive(), winutil.Getenv(ctx, "USERPROFILE"))
+	return nil
+}
+
+// addShortcuts adds every .lnk under a Start Menu Programs folder.
+func (w *WinAUMID) addShortcuts(ctx context.Context, programsDir, username string, builder *AUMIDBuilder, aumidMap *AUMIDMap) {
+	filepath.WalkDir(programsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".lnk") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			aumidMap.Errors = append(aumidMap.Errors, fmt.Sprintf("%s: %v", path, err))
+			return nil
+		}
+		shortcut, err := lnk.Parse(data)
+		if err != nil {
+			aumidMap.Errors = append(aumidMap.Errors, fmt.Sprintf("%s: %v", path, err))
+			return nil
+		}
+		builder.AddShortcut(path, shortcut, username)
+		return nil
+	})
+}
+
+// addSoftwareHive adds the machine-wide ActivatableClasses registrations from
+// a private copy of the SOFTWARE hive.
+func (w *WinAUMID) addSoftwareHive(ctx context.Context, builder *AUMIDBuilder) error {
+	srcPath := filepath.Join(winutil.SystemRoot(), "System32", "config", "SOFTWARE")
+	return w.withHive(ctx, srcPath, `HKLM\SOFTWARE`, func(hive *regf.Hive) error {
+		return builder.AddClassesHive(hive, "Classes", "")
+	})
+}
+
+// addUsers adds each user's Start Menu shortcuts and UsrClass.dat registrations.
+func (w *WinAUMID) addUsers(ctx context.Context, builder *AUMIDBuilder, aumidMap *AUMIDMap) error {
+	usersDir := winutil.UsersDir()
+	userEntries, err := os.ReadDir(usersDir)
+	if err != nil {
+		return fmt.Errorf("failed to read users directory: %w", err)
+	}
+
+	// Loaded hives are saved through HKU\<SID>_Classes instead
+	sids := profileSIDs(ctx)
+
+	for _, userEntry := range userEntries {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if !userEntry.IsDir() {
+			continue
+		}
+		username := userEntry.Name()
+		if w.isSystemProfile(username) {
+			continue
+		}
+		userProfileDir := filepath.Join(usersDir, username)
+
+		w.addShortcuts(ctx, filepath.Join(userProfileDir, "AppData", "Roaming", startMenuPrograms), username, builder, aumidMap)
+
+		hivePath := filepath.Join(userProfileDir, "AppData", "Local", "Microsoft", "Windows", "UsrClass.dat")
+		if _, err := os.Stat(hivePath); err != nil {
+			continue
+		}
+		liveKey := ""
+		if sid, ok := sids[strings.ToLower(username)]; ok {
+			liveKey = `HKU\` + sid + `_Classes`
+		}
+		err := w.withHive(ctx, hivePath, liveKey, func(hive *regf.Hive) error {
+			return builder.AddClassesHive(hive, "", username)
+		})
+		if err != nil {
+			aumidMap.Errors = append(aumidMap.Errors, fmt.Sprintf("%s: %v", username, err))
+		}
+	}
+
+	return nil
+}
+
+// withHive parses a private copy of a hive file, falling back to reg save of
+// liveKey on a live system when the file is locked. The copy is removed afterwards.
+func (w *WinAUMID) withHive(ctx context.Context, srcPath, liveKey string, parse func(*regf.Hive) error) error {
+	tempDir, err := os.MkdirTemp("", "cryptkeeper-aumid-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	hivePath := filepath.Join(tempDir, filepath.Base(srcPath))
+	if _, _, copyErr := winutil.CopyFile(ctx, srcPath, hivePath); copyErr != nil {
+		if winutil.IsOffline() || liveKey == "" {
+			return fmt.Errorf("failed to copy %s: %w", srcPath, copyErr)
+		}
+		os.Remove(hivePath)
+		if err := winutil.ExportRegistryHive(ctx, liveKey, hivePath); err != nil {
+			return fmt.Errorf("failed to acquire %s (copy: %v; reg save: %w)", srcPath, copyErr, err)
+		}
+	}
+
+	hive, err := regf.Open(hivePath)
+	if err != nil {
+		return err
+	}
+	defer hive.Close()
+	return parse(hive)
+}
+
+// writeMap writes aumid_map.json and adds it to the manifest.
+func (w *WinAUMID) writeMap(ctx context.Context, outDir string, aumidMap *AUMIDMap, manifest *AUMIDManifest) error {
+	outputPath := filepath.Join(outDir, "aumid_map.json")
+	data, err := json.MarshalIndent(aumidMap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal AUMID map: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write AUMID map: %w", err)
+	}
+
+	manifest.IncrementTotalFiles()
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat AUMID map: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash AUMID map: %w", err)
+	}
+	note := fmt.Sprintf("AppUserModelID to application map (%d entries)", len(aumidMap.Entries))
+	manifest.AddItem("aumid_map.json", stat.Size(), sha256Hex, false, stat.ModTime(), "aumid_map", note)
+
+	return nil
+}
+
+// profileSIDs maps lowercased profile directory names to user SIDs on a live system.
+func profileSIDs(ctx context.Context) map[string]string {
+	sids := make(map[string]string)
+	output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", profileListKey, "/s"})
+	if err != nil {
+		return sids
+	}
+	for _, key := range winutil.ParseRegQuery(output) {
+		value, ok := key.Value("ProfileImagePath")
+		if !ok {
+			continue
+		}
+		sid := key.Path[strings.LastIndex(key.Path, `\`)+1:]
+		sids[strings.ToLower(filepath.Base(value.Data))] = sid
+	}
+	return sids
+}
+
+// isSystemProfile checks if a username represents a system profile that should be skipped.
+func (w *WinAUMID) isSystemProfile(username string) bool {
+	systemProfiles := []string{
+		"All Users", "Default", "Default User", "Public",
+		"WDAGUtilityAccount", "defaultuser0", "systemprofile",
+	}
+
+	lowerUsername := strings.ToLower(username)
+	for _, profile := range systemProfiles {
+		if lowerUsername == strings.ToLower(profile) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,9 +2,12 @@
 package win_bits
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // BITSItem represents a collected BITS job queue file.
@@ -36,9 +39,9 @@ type BITSManifest struct {
 }
 
 // NewBITSManifest creates a new BITS manifest with basic information.
-func NewBITSManifest(hostname string) *BITSManifest {
+func NewBITSManifest(ctx context.Context, hostname string) *BITSManifest {
 	return &BITSManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]BITSItem, 0),
@@ -56,7 +59,7 @@ func (bm *BITSManifest) AddItem(path string, size int64, sha256 string, truncate
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	bm.CollectedFiles++
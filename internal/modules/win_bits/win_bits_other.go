@@ -19,6 +19,11 @@ func (w *WinBITS) Name() string {
 	return "windows/bits"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinBITS) Describe() string {
+	return "Background Intelligent Transfer Service"
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinBITS) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
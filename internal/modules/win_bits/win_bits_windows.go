@@ -25,6 +25,11 @@ func (w *WinBITS) Name() string {
 	return "windows/bits"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinBITS) Describe() string {
+	return "Background Intelligent Transfer Service"
+}
+
 // Collect copies Windows BITS job queue files and creates a manifest.
 func (w *WinBITS) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/bits subdirectory
@@ -34,27 +39,19 @@ func (w *WinBITS) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewBITSManifest(hostname)
+	manifest := NewBITSManifest(ctx, hostname)
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Get ProgramData path (usually C:\ProgramData)
-	programData := os.Getenv("ProgramData")
-	if programData == "" {
-		// Fallback to common location
-		systemDrive := os.Getenv("SystemDrive")
-		if systemDrive == "" {
-			systemDrive = "C:"
-		}
-		programData = filepath.Join(systemDrive, "ProgramData")
-	}
+	programData := winutil.ProgramData()
 
 	// Collect BITS files from ProgramData\Microsoft\Network\Downloader\
 	bitsSourceDir := filepath.Join(programData, "Microsoft", "Network", "Downloader")
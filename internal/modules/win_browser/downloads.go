@@ -0,0 +1,287 @@
+package win_browser
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/sqlite"
+	"cryptkeeper/internal/winutil"
+)
+
+// chromiumDownloadStates maps the downloads.state column to names.
+var chromiumDownloadStates = map[int64]string{
+	0: "in_progress",
+	1: "complete",
+	2: "cancelled",
+	3: "interrupted",
+}
+
+// BrowserDownload is a single download history entry.
+type BrowserDownload struct {
+	URL           string   `json:"url"`
+	URLChain      []string `json:"url_chain,omitempty"`
+	ReferrerURL   string   `json:"referrer_url,omitempty"`
+	TargetPath    string   `json:"target_path"`
+	MimeType      string   `json:"mime_type,omitempty"`
+	StartTime     string   `json:"start_time,omitempty"`
+	EndTime       string   `json:"end_time,omitempty"`
+	ReceivedBytes int64    `json:"received_bytes"`
+	TotalBytes    int64    `json:"total_bytes"`
+	State         string   `json:"state,omitempty"`
+	DangerType    int64    `json:"danger_type,omitempty"`
+	Opened        bool     `json:"opened"`
+}
+
+// BrowserDownloads is the structure written to downloads.json.
+type BrowserDownloads struct {
+	CollectedUTC string            `json:"collected_utc"`
+	Browser      string            `json:"browser"`
+	User         string            `json:"user"`
+	Profile      string            `json:"profile"`
+	Since        string            `json:"since_utc,omitempty"`
+	Downloads    []BrowserDownload `json:"downloads"`
+	Errors       []string          `json:"errors,omitempty"`
+}
+
+// ParseChromiumDownloads reads the downloads and downloads_url_chains tables of a
+// Chromium History database, skipping downloads started before since.
+func ParseChromiumDownloads(historyPath string, since time.Time) ([]BrowserDownload, error) {
+	db, err := sqlite.Open(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	chains := make(map[int64][]string)
+	chainIndex := make(map[int64][]int64)
+	err = db.ForEachRow("downloads_url_chains", func(row sqlite.Row) error {
+		id := row.Int("id")
+		chains[id] = append(chains[id], row.String("url"))
+		chainIndex[id] = append(chainIndex[id], row.Int("chain_index"))
+		return nil
+	})
+	if err != nil && !errors.Is(err, sqlite.ErrNoSuchTable) {
+		return nil, err
+	}
+
+	downloads := make([]BrowserDownload, 0)
+	err = db.ForEachRow("downloads", func(row sqlite.Row) error {
+		start := webkitMicros(row.Int("start_time"))
+		if !since.IsZero() && !start.IsZero() && start.Before(since) {
+			return nil
+		}
+
+		d := BrowserDownload{
+			ReferrerURL:   row.String("referrer"),
+			TargetPath:    row.String("target_path"),
+			MimeType:      row.String("mime_type"),
+			ReceivedBytes: row.Int("received_bytes"),
+			TotalBytes:    row.Int("total_bytes"),
+			State:         chromiumDownloadStates[row.Int("state")],
+			DangerType:    row.Int("danger_type"),
+			Opened:        row.Int("opened") != 0,
+		}
+		if d.TargetPath == "" {
+			d.TargetPath = row.String("current_path")
+		}
+		if !start.IsZero() {
+			d.StartTime = winutil.FormatTime(start)
+		}
+		if end := webkitMicros(row.Int("end_time")); !end.IsZero() {
+			d.EndTime = winutil.FormatTime(end)
+		}
+
+		chain := orderedChain(chains[row.Int("id")], chainIndex[row.Int("id")])
+		if len(chain) > 0 {
+			d.URL = chain[len(chain)-1]
+			if len(chain) > 1 {
+				d.URLChain = chain
+			}
+		}
+		if d.URL == "" {
+			d.URL = row.String("tab_url")
+		}
+
+		downloads = append(downloads, d)
+		return nil
+	})
+	if err != nil {
+		return downloads, err
+	}
+
+	return downloads, nil
+}
+
+// orderedChain sorts redirect chain URLs by their chain_index.
+func orderedChain(urls []string, indexes []int64) []string {
+	order := make([]int, len(urls))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return indexes[order[a]] < indexes[order[b]] })
+
+	chain := make([]string, len(urls))
+	for i, idx := range order {
+		chain[i] = urls[idx]
+	}
+	return chain
+}
+
+// firefoxDownloadMeta is the JSON stored in the downloads/metaData annotation.
+type firefoxDownloadMeta struct {
+	State    *int64 `json:"state"`
+	EndTime  int64  `json:"endTime"`
+	FileSize int64  `json:"fileSize"`
+}
+
+// firefoxDownloadStates maps download metadata states to names.
+var firefoxDownloadStates = map[int64]string{
+	0: "in_progress",
+	1: "complete",
+	2: "failed",
+	3: "cancelled",
+	4: "paused",
+}
+
+// ParseFirefoxDownloads reads download history from places.sqlite, which stores
+// downloads as moz_annos annotations on the source URL's moz_places row. Older
+// profiles with a moz_downloads table are read from that table instead.
+func ParseFirefoxDownloads(placesPath string, since time.Time) ([]BrowserDownload, error) {
+	db, err := sqlite.Open(placesPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if _, err := db.Table("moz_downloads"); err == nil {
+		return parseLegacyFirefoxDownloads(db, since)
+	}
+
+	attributes := make(map[int64]string)
+	if err := db.ForEachRow("moz_anno_attributes", func(row sqlite.Row) error {
+		attributes[row.Int("id")] = row.String("name")
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	type pending struct {
+		download BrowserDownload
+		added    time.Time
+	}
+	byPlace := make(map[int64]*pending)
+	err = db.ForEachRow("moz_annos", func(row sqlite.Row) error {
+		name := attributes[row.Int("anno_attribute_id")]
+		if !strings.HasPrefix(name, "downloads/") {
+			return nil
+		}
+		placeID := row.Int("place_id")
+		p, ok := byPlace[placeID]
+		if !ok {
+			p = &pending{}
+			byPlace[placeID] = p
+		}
+
+		switch name {
+		case "downloads/destinationFileURI":
+			p.download.TargetPath = fileURIToPath(row.String("content"))
+			if added := prTime(row.Int("dateAdded")); !added.IsZero() {
+				p.added = added
+				p.download.StartTime = winutil.FormatTime(added)
+			}
+		case "downloads/metaData":
+			var meta firefoxDownloadMeta
+			if json.Unmarshal([]byte(row.String("content")), &meta) == nil {
+				if meta.State != nil {
+					p.download.State = firefoxDownloadStates[*meta.State]
+				}
+				if meta.EndTime > 0 {
+					p.download.EndTime = winutil.FormatTime(time.UnixMilli(meta.EndTime))
+				}
+				p.download.TotalBytes = meta.FileSize
+				p.download.ReceivedBytes = meta.FileSize
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.ForEachRow("moz_places", func(row sqlite.Row) error {
+		if p, ok := byPlace[row.Int("id")]; ok {
+			p.download.URL = row.String("url")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	downloads := make([]BrowserDownload, 0, len(byPlace))
+	for _, p := range byPlace {
+		if p.download.TargetPath == "" {
+			continue
+		}
+		if !since.IsZero() && !p.added.IsZero() && p.added.Before(since) {
+			continue
+		}
+		downloads = append(downloads, p.download)
+	}
+	sort.Slice(downloads, func(i, j int) bool { return downloads[i].StartTime < downloads[j].StartTime })
+
+	return downloads, nil
+}
+
+// parseLegacyFirefoxDownloads reads the moz_downloads table used before Firefox 26.
+func parseLegacyFirefoxDownloads(db *sqlite.DB, since time.Time) ([]BrowserDownload, error) {
+	downloads := make([]BrowserDownload, 0)
+	err := db.ForEachRow("moz_downloads", func(row sqlite.Row) error {
+		start := prTime(row.Int("startTime"))
+		if !since.IsZero() && !start.IsZero() && start.Before(since) {
+			return nil
+		}
+		d := BrowserDownload{
+			URL:           row.String("source"),
+			ReferrerURL:   row.String("referrer"),
+			TargetPath:    fileURIToPath(row.String("target")),
+			MimeType:      row.String("mimeType"),
+			ReceivedBytes: row.Int("currBytes"),
+			TotalBytes:    row.Int("maxBytes"),
+			State:         firefoxDownloadStates[row.Int("state")],
+		}
+		if !start.IsZero() {
+			d.StartTime = winutil.FormatTime(start)
+		}
+		if end := prTime(row.Int("endTime")); !end.IsZero() {
+			d.EndTime = winutil.FormatTime(end)
+		}
+		downloads = append(downloads, d)
+		return nil
+	})
+	return downloads, err
+}
+
+// prTime converts a Mozilla PRTime (microseconds since the Unix epoch) to UTC.
+func prTime(us int64) time.Time {
+	if us <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(us).UTC()
+}
+
+// fileURIToPath converts file:///C:/Users/x/file.exe to C:\Users\x\file.exe.
+func fileURIToPath(uri string) string {
+	if !strings.HasPrefix(uri, "file:///") {
+		return uri
+	}
+	path := strings.TrimPrefix(uri, "file:///")
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	return strings.ReplaceAll(path, "/", "\\")
+}
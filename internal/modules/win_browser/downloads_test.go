@@ -0,0 +1,228 @@
+package win_browser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/sqlite/sqlitetest"
+)
+
+var (
+	payloadStarted = time.Date(2024, 2, 27, 22, 41, 3, 0, time.UTC)
+	since          = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// webkit converts a time to microseconds since 1601, as Chromium stores it.
+func webkit(t time.Time) int64 {
+	return t.UnixMicro() + webkitEpochOffset
+}
+
+// chromiumHistory is a History database with the downloads columns Chromium
+// 120 writes. The payload was fetched through a redirect, whose chain rows
+// were written out of order; the installer predates --since.
+func chromiumHistory() []sqlitetest.Table {
+	return []sqlitetest.Table{
+		{Name: "meta", Columns: []string{"key LONGVARCHAR NOT NULL UNIQUE PRIMARY KEY", "value LONGVARCHAR"}, Rows: []sqlitetest.Row{{"version", "66"}}},
+		{
+			Name: "downloads",
+			Columns: []string{
+				"id INTEGER PRIMARY KEY", "guid VARCHAR NOT NULL", "current_path LONGVARCHAR NOT NULL", "target_path LONGVARCHAR NOT NULL",
+				"start_time INTEGER NOT NULL", "received_bytes INTEGER NOT NULL", "total_bytes INTEGER NOT NULL", "state INTEGER NOT NULL",
+				"danger_type INTEGER NOT NULL", "interrupt_reason INTEGER NOT NULL", "hash BLOB NOT NULL", "end_time INTEGER NOT NULL",
+				"opened INTEGER NOT NULL", "last_access_time INTEGER NOT NULL", "transient INTEGER NOT NULL", "referrer VARCHAR NOT NULL",
+				"site_url VARCHAR NOT NULL", "tab_url VARCHAR NOT NULL", "tab_referrer_url VARCHAR NOT NULL", "http_method VARCHAR NOT NULL",
+				"by_ext_id VARCHAR NOT NULL", "by_ext_name VARCHAR NOT NULL", "etag VARCHAR NOT NULL", "last_modified VARCHAR NOT NULL",
+				"mime_type VARCHAR(255) NOT NULL", "original_mime_type VARCHAR(255) NOT NULL",
+			},
+			Rows: []sqlitetest.Row{
+				{
+					1, "2d1f3c aa", `C:\Users\alice\Downloads\ChromeSetup.exe`, `C:\Users\alice\Downloads\ChromeSetup.exe`,
+					webkit(time.Date(2023, 11, 2, 9, 0, 0, 0, time.UTC)), 1363968, 1363968, 1,
+					0, 0, []byte{}, webkit(time.Date(2023, 11, 2, 9, 0, 4, 0, time.UTC)),
+					1, 0, 0, "https://www.google.com/chrome/",
+					"", "https://www.google.com/chrome/", "", "",
+					"", "", "", "", "application/x-msdownload", "application/x-msdownload",
+				},
+				{
+					2, "9b7e01 bb", `C:\Users\alice\Downloads\invoice_0227.crdownload`, `C:\Users\alice\Downloads\invoice_0227.iso`,
+					webkit(payloadStarted), 7340032, 7340032, 1,
+					3, 0, []byte{}, webkit(payloadStarted.Add(12 * time.Second)),
+					0, 0, 0, "https://mail.example.com/",
+					"", "", "", "GET",
+					"", "", "", "", "application/octet-stream", "application/octet-stream",
+				},
+				{
+					// Cancelled before the target was named
+					3, "54c0d2 cc", `C:\Users\alice\Downloads\Unconfirmed 41233.crdownload`, "",
+					webkit(payloadStarted.Add(time.Minute)), 65536, 0, 2,
+					0, 40, []byte{}, 0,
+					0, 0, 0, "",
+					"", "https://files.example.net/get?id=41233", "", "",
+					"", "", "", "", "", "",
+				},
+			},
+		},
+		{
+			Name:    "downloads_url_chains",
+			Columns: []string{"id INTEGER NOT NULL", "chain_index INTEGER NOT NULL", "url LONGVARCHAR NOT NULL", "PRIMARY KEY (id, chain_index)"},
+			Rows: []sqlitetest.Row{
+				{1, 0, "https://dl.google.com/chrome/install/ChromeSetup.exe"},
+				{2, 1, "https://cdn-files.example.org/d/invoice_0227.iso"},
+				{2, 0, "https://bit.example/3xYz"},
+			},
+		},
+	}
+}
+
+func TestParseChromiumDownloads(t *testing.T) {
+	path := sqlitetest.WriteFile(t, "History", chromiumHistory()...)
+	downloads, err := ParseChromiumDownloads(path, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(downloads) != 3 || downloads[0].URL != "https://dl.google.com/chrome/install/ChromeSetup.exe" || !downloads[0].Opened {
+		t.Fatalf("downloads = %+v", downloads)
+	}
+
+	want := []BrowserDownload{
+		{
+			URL:           "https://cdn-files.example.org/d/invoice_0227.iso",
+			URLChain:      []string{"https://bit.example/3xYz", "https://cdn-files.example.org/d/invoice_0227.iso"},
+			ReferrerURL:   "https://mail.example.com/",
+			TargetPath:    `C:\Users\alice\Downloads\invoice_0227.iso`,
+			MimeType:      "application/octet-stream",
+			StartTime:     "2024-02-27T22:41:03Z",
+			EndTime:       "2024-02-27T22:41:15Z",
+			ReceivedBytes: 7340032,
+			TotalBytes:    7340032,
+			State:         "complete",
+			DangerType:    3,
+		},
+		{
+			URL:           "https://files.example.net/get?id=41233",
+			TargetPath:    `C:\Users\alice\Downloads\Unconfirmed 41233.crdownload`,
+			StartTime:     "2024-02-27T22:42:03Z",
+			ReceivedBytes: 65536,
+			State:         "cancelled",
+		},
+	}
+
+	// --since drops downloads started before it
+	downloads, err = ParseChromiumDownloads(path, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(downloads, want) {
+		t.Fatalf("downloads since %s = %+v\nwant %+v", since, downloads, want)
+	}
+}
+
+func TestParseChromiumDownloadsWithoutChains(t *testing.T) {
+	// Profiles from before redirect chains were kept still list downloads
+	tables := chromiumHistory()[:2]
+	downloads, err := ParseChromiumDownloads(sqlitetest.WriteFile(t, "History", tables...), since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(downloads) != 2 || downloads[0].URL != "" || downloads[1].URL != "https://files.example.net/get?id=41233" {
+		t.Fatalf("downloads = %+v", downloads)
+	}
+
+	if _, err := ParseChromiumDownloads(sqlitetest.WriteFile(t, "History", tables[0]), since); err == nil {
+		t.Fatal("History without a downloads table parsed")
+	}
+}
+
+// firefoxPlaces is a places.sqlite in which downloads are annotations on the
+// moz_places row of their source URL.
+func firefoxPlaces() []sqlitetest.Table {
+	prtime := func(t time.Time) int64 { return t.UnixMicro() }
+	return []sqlitetest.Table{
+		{
+			Name:    "moz_places",
+			Columns: []string{"id INTEGER PRIMARY KEY", "url LONGVARCHAR", "title LONGVARCHAR", "rev_host LONGVARCHAR", "visit_count INTEGER DEFAULT 0"},
+			Rows: []sqlitetest.Row{
+				{12, "https://www.mozilla.org/firefox/new/", "Download Firefox", "gro.allizom.www.", 1},
+				{57, "https://cdn-files.example.org/d/tools.zip", nil, "gro.elpmaxe.selif-ndc.", 0},
+				{58, "https://www.7-zip.org/a/7z2301-x64.exe", nil, "gro.piz-7.www.", 0},
+			},
+		},
+		{
+			Name:    "moz_anno_attributes",
+			Columns: []string{"id INTEGER PRIMARY KEY", "name VARCHAR(32) UNIQUE NOT NULL"},
+			Rows:    []sqlitetest.Row{{1, "downloads/destinationFileURI"}, {2, "downloads/metaData"}, {3, "Places/SmartBookmark"}},
+		},
+		{
+			Name: "moz_annos",
+			Columns: []string{
+				"id INTEGER PRIMARY KEY", "place_id INTEGER NOT NULL", "anno_attribute_id INTEGER", "content LONGVARCHAR",
+				"flags INTEGER DEFAULT 0", "expiration INTEGER DEFAULT 0", "type INTEGER DEFAULT 0", "dateAdded INTEGER DEFAULT 0", "lastModified INTEGER DEFAULT 0",
+			},
+			Rows: []sqlitetest.Row{
+				{1, 58, 1, "file:///C:/Users/alice/Downloads/7z2301-x64.exe", 0, 4, 3, prtime(time.Date(2024, 1, 9, 8, 0, 0, 0, time.UTC)), 0},
+				{2, 57, 1, "file:///C:/Users/alice/Downloads/tools%20(1).zip", 0, 4, 3, prtime(payloadStarted), 0},
+				{3, 57, 2, `{"state":1,"deleted":false,"endTime":1709073667000,"fileSize":2097152}`, 0, 4, 3, prtime(payloadStarted), 0},
+				{4, 12, 3, "toolbar", 0, 4, 3, 0, 0},
+			},
+		},
+	}
+}
+
+func TestParseFirefoxDownloads(t *testing.T) {
+	path := sqlitetest.WriteFile(t, "places.sqlite", firefoxPlaces()...)
+	downloads, err := ParseFirefoxDownloads(path, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(downloads) != 2 || downloads[0].TargetPath != `C:\Users\alice\Downloads\7z2301-x64.exe` {
+		t.Fatalf("downloads = %+v", downloads)
+	}
+
+	downloads, err = ParseFirefoxDownloads(path, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BrowserDownload{{
+		URL:           "https://cdn-files.example.org/d/tools.zip",
+		TargetPath:    `C:\Users\alice\Downloads\tools (1).zip`,
+		StartTime:     "2024-02-27T22:41:03Z",
+		EndTime:       "2024-02-27T22:41:07Z",
+		ReceivedBytes: 2097152,
+		TotalBytes:    2097152,
+		State:         "complete",
+	}}
+	if !reflect.DeepEqual(downloads, want) {
+		t.Fatalf("downloads since %s = %+v\nwant %+v", since, downloads, want)
+	}
+}
+
+func TestParseLegacyFirefoxDownloads(t *testing.T) {
+	path := sqlitetest.WriteFile(t, "places.sqlite", sqlitetest.Table{
+		Name: "moz_downloads",
+		Columns: []string{
+			"id INTEGER PRIMARY KEY", "name TEXT", "source TEXT", "target TEXT", "tempPath TEXT", "startTime INTEGER", "endTime INTEGER",
+			"state INTEGER", "referrer TEXT", "entityID TEXT", "currBytes INTEGER NOT NULL DEFAULT 0", "maxBytes INTEGER NOT NULL DEFAULT -1",
+			"mimeType TEXT", "preferredApplication TEXT", "preferredAction INTEGER NOT NULL DEFAULT 0", "autoResume INTEGER NOT NULL DEFAULT 0",
+		},
+		Rows: []sqlitetest.Row{
+			{1, "old.msi", "http://example.com/old.msi", "file:///C:/Users/alice/Desktop/old.msi", "", 1262304000000000, 1262304005000000, 1, "", "", 100, 100, "application/x-msi", "", 0, 0},
+			{2, "nc.exe", "http://10.0.0.9/nc.exe", "file:///C:/Users/alice/Desktop/nc.exe", "", payloadStarted.UnixMicro(), 0, 3, "", "", 5120, 38616, "", "", 0, 0},
+		},
+	})
+	downloads, err := ParseFirefoxDownloads(path, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BrowserDownload{{
+		URL:           "http://10.0.0.9/nc.exe",
+		TargetPath:    `C:\Users\alice\Desktop\nc.exe`,
+		StartTime:     "2024-02-27T22:41:03Z",
+		ReceivedBytes: 5120,
+		TotalBytes:    38616,
+		State:         "cancelled",
+	}}
+	if !reflect.DeepEqual(downloads, want) {
+		t.Fatalf("downloads = %+v", downloads)
+	}
+}
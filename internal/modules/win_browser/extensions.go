@@ -0,0 +1,392 @@
+package win_browser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// webkitEpochOffset is the number of microseconds between the Chromium
+// timestamp origin (1601-01-01 UTC) and the Unix epoch.
+const webkitEpochOffset = 11644473600 * 1000000
+
+// broadHostPatterns grant an extension access to every site.
+var broadHostPatterns = map[string]bool{
+	"<all_urls>":  true,
+	"*://*/*":     true,
+	"http://*/*":  true,
+	"https://*/*": true,
+	"*://*/":      true,
+}
+
+// sensitivePermissions allow traffic interception, code execution outside the
+// browser, or control over other extensions.
+var sensitivePermissions = map[string]bool{
+	"debugger":           true,
+	"nativeMessaging":    true,
+	"proxy":              true,
+	"webRequestBlocking": true,
+	"management":         true,
+	"cookies":            true,
+	"history":            true,
+	"clipboardRead":      true,
+}
+
+// chromiumLocations maps Chromium's Manifest::Location values to names.
+var chromiumLocations = map[int]string{
+	1:  "internal",
+	2:  "external_pref",
+	3:  "external_registry",
+	4:  "unpacked",
+	5:  "component",
+	6:  "external_pref_download",
+	7:  "external_policy_download",
+	8:  "command_line",
+	9:  "external_policy",
+	10: "external_component",
+}
+
+// BrowserExtension is an installed extension or add-on.
+type BrowserExtension struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	Version         string   `json:"version"`
+	Location        string   `json:"location,omitempty"`
+	FromWebstore    bool     `json:"from_webstore"`
+	Enabled         bool     `json:"enabled"`
+	InstallTime     string   `json:"install_time,omitempty"`
+	Path            string   `json:"path,omitempty"`
+	SourceURI       string   `json:"source_uri,omitempty"`
+	Permissions     []string `json:"permissions"`
+	HostPermissions []string `json:"host_permissions"`
+	Flags           []string `json:"flags,omitempty"`
+}
+
+// BrowserExtensions is the structure written to browser_extensions.json.
+type BrowserExtensions struct {
+	CollectedUTC      string             `json:"collected_utc"`
+	Browser           string             `json:"browser"`
+	User              string             `json:"user"`
+	Profile           string             `json:"profile"`
+	Extensions        []BrowserExtension `json:"extensions"`
+	FlaggedExtensions int                `json:"flagged_extensions"`
+	Errors            []string           `json:"errors,omitempty"`
+}
+
+type chromiumManifest struct {
+	Name            string        `json:"name"`
+	Version         string        `json:"version"`
+	DefaultLocale   string        `json:"default_locale"`
+	Permissions     []interface{} `json:"permissions"`
+	HostPermissions []interface{} `json:"host_permissions"`
+	ContentScripts  []struct {
+		Matches []string `json:"matches"`
+	} `json:"content_scripts"`
+}
+
+type chromiumExtensionSetting struct {
+	Location     int               `json:"location"`
+	FromWebstore bool              `json:"from_webstore"`
+	InstallTime  string            `json:"install_time"`
+	State        *int              `json:"state"`
+	Path         string            `json:"path"`
+	Manifest     *chromiumManifest `json:"manifest"`
+}
+
+type chromiumPreferences struct {
+	Extensions struct {
+		Settings map[string]chromiumExtensionSetting `json:"settings"`
+	} `json:"extensions"`
+}
+
+// ReadChromiumExtensions lists the extensions of a Chromium profile from the
+// manifests under extensionsDir and the per-extension settings in the profile's
+// Preferences and Secure Preferences files.
+func ReadChromiumExtensions(extensionsDir string, preferences ...[]byte) ([]BrowserExtension, []string) {
+	var errors []string
+
+	settings := make(map[string]chromiumExtensionSetting)
+	for _, data := range preferences {
+		if len(data) == 0 {
+			continue
+		}
+		var prefs chromiumPreferences
+		if err := json.Unmarshal(data, &prefs); err != nil {
+			errors = append(errors, fmt.Sprintf("failed to parse preferences: %v", err))
+			continue
+		}
+		for id, s := range prefs.Extensions.Settings {
+			settings[id] = s
+		}
+	}
+
+	byID := make(map[string]*BrowserExtension)
+
+	// Store-installed and externally installed extensions live under Extensions\<id>\<version>
+	if ids, err := os.ReadDir(extensionsDir); err == nil {
+		for _, idEntry := range ids {
+			if !idEntry.IsDir() {
+				continue
+			}
+			versions, err := os.ReadDir(filepath.Join(extensionsDir, idEntry.Name()))
+			if err != nil {
+				continue
+			}
+			for _, versionEntry := range versions {
+				if !versionEntry.IsDir() {
+					continue
+				}
+				dir := filepath.Join(extensionsDir, idEntry.Name(), versionEntry.Name())
+				manifest, err := readChromiumManifest(dir)
+				if err != nil {
+					errors = append(errors, fmt.Sprintf("%s: %v", dir, err))
+					continue
+				}
+				ext := newChromiumExtension(idEntry.Name(), dir, manifest)
+				byID[ext.ID] = &ext
+			}
+		}
+	}
+
+	// Unpacked extensions are loaded from arbitrary paths recorded only in preferences
+	for id, s := range settings {
+		ext, ok := byID[id]
+		if !ok {
+			if s.Manifest == nil {
+				continue
+			}
+			created := newChromiumExtension(id, s.Path, s.Manifest)
+			ext = &created
+			byID[id] = ext
+		}
+		ext.Location = chromiumLocations[s.Location]
+		ext.FromWebstore = s.FromWebstore
+		ext.Enabled = s.State == nil || *s.State == 1
+		if t := webkitTime(s.InstallTime); !t.IsZero() {
+			ext.InstallTime = winutil.FormatTime(t)
+		}
+		if s.Path != "" && filepath.IsAbs(s.Path) {
+			ext.Path = s.Path
+		}
+		ext.Flags = flagChromiumExtension(*ext, s.Location)
+	}
+
+	extensions := make([]BrowserExtension, 0, len(byID))
+	for _, ext := range byID {
+		if ext.Flags == nil {
+			ext.Flags = flagChromiumExtension(*ext, 0)
+		}
+		extensions = append(extensions, *ext)
+	}
+	sort.Slice(extensions, func(i, j int) bool { return extensions[i].ID < extensions[j].ID })
+
+	return extensions, errors
+}
+
+func readChromiumManifest(dir string) (*chromiumManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest chromiumManifest
+	if err := json.Unmarshal(trimBOM(data), &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest.json: %w", err)
+	}
+
+	// Localized names look like __MSG_appName__ and resolve from _locales
+	if strings.HasPrefix(manifest.Name, "__MSG_") && manifest.DefaultLocale != "" {
+		key := strings.TrimSuffix(strings.TrimPrefix(manifest.Name, "__MSG_"), "__")
+		if messages, err := os.ReadFile(filepath.Join(dir, "_locales", manifest.DefaultLocale, "messages.json")); err == nil {
+			var m map[string]struct {
+				Message string `json:"message"`
+			}
+			if json.Unmarshal(trimBOM(messages), &m) == nil {
+				for k, v := range m {
+					if strings.EqualFold(k, key) {
+						manifest.Name = v.Message
+						break
+					}
+				}
+			}
+		}
+	}
+
+	return &manifest, nil
+}
+
+func newChromiumExtension(id, path string, manifest *chromiumManifest) BrowserExtension {
+	ext := BrowserExtension{
+		ID:              id,
+		Name:            manifest.Name,
+		Version:         manifest.Version,
+		Enabled:         true,
+		Path:            path,
+		Permissions:     make([]string, 0),
+		HostPermissions: make([]string, 0),
+	}
+
+	// Manifest V2 mixes host patterns into permissions
+	for _, p := range manifest.Permissions {
+		if s, ok := p.(string); ok {
+			if strings.Contains(s, "://") || s == "<all_urls>" {
+				ext.HostPermissions = append(ext.HostPermissions, s)
+			} else {
+				ext.Permissions = append(ext.Permissions, s)
+			}
+		}
+	}
+	for _, p := range manifest.HostPermissions {
+		if s, ok := p.(string); ok {
+			ext.HostPermissions = append(ext.HostPermissions, s)
+		}
+	}
+	for _, cs := range manifest.ContentScripts {
+		ext.HostPermissions = append(ext.HostPermissions, cs.Matches...)
+	}
+
+	return ext
+}
+
+func flagChromiumExtension(ext BrowserExtension, location int) []string {
+	flags := permissionFlags(ext)
+
+	switch location {
+	case 4, 8:
+		flags = append(flags, "unpacked")
+	case 2, 3, 6:
+		flags = append(flags, "sideloaded")
+	case 1:
+		if !ext.FromWebstore {
+			flags = append(flags, "sideloaded")
+		}
+	}
+
+	return flags
+}
+
+func permissionFlags(ext BrowserExtension) []string {
+	flags := make([]string, 0)
+	for _, host := range ext.HostPermissions {
+		if broadHostPatterns[host] {
+			flags = append(flags, "broad_host_access")
+			break
+		}
+	}
+	for _, perm := range ext.Permissions {
+		if sensitivePermissions[perm] {
+			flags = append(flags, "sensitive_permission:"+perm)
+		}
+	}
+	return flags
+}
+
+type firefoxExtensionsFile struct {
+	Addons []struct {
+		ID            string `json:"id"`
+		Version       string `json:"version"`
+		Type          string `json:"type"`
+		Location      string `json:"location"`
+		Active        bool   `json:"active"`
+		SourceURI     string `json:"sourceURI"`
+		Path          string `json:"path"`
+		InstallDate   int64  `json:"installDate"`
+		SignedState   *int   `json:"signedState"`
+		DefaultLocale struct {
+			Name string `json:"name"`
+		} `json:"defaultLocale"`
+		UserPermissions *struct {
+			Permissions []string `json:"permissions"`
+			Origins     []string `json:"origins"`
+		} `json:"userPermissions"`
+	} `json:"addons"`
+}
+
+// ParseFirefoxExtensions parses a Firefox profile's extensions.json.
+func ParseFirefoxExtensions(data []byte) ([]BrowserExtension, error) {
+	var file firefoxExtensionsFile
+	if err := json.Unmarshal(trimBOM(data), &file); err != nil {
+		return nil, fmt.Errorf("failed to parse extensions.json: %w", err)
+	}
+
+	extensions := make([]BrowserExtension, 0, len(file.Addons))
+	for _, addon := range file.Addons {
+		if addon.Type != "" && addon.Type != "extension" {
+			continue
+		}
+		ext := BrowserExtension{
+			ID:              addon.ID,
+			Name:            addon.DefaultLocale.Name,
+			Version:         addon.Version,
+			Location:        addon.Location,
+			Enabled:         addon.Active,
+			Path:            addon.Path,
+			SourceURI:       addon.SourceURI,
+			FromWebstore:    strings.HasPrefix(addon.SourceURI, "https://addons.mozilla.org/"),
+			Permissions:     make([]string, 0),
+			HostPermissions: make([]string, 0),
+		}
+		if addon.InstallDate > 0 {
+			ext.InstallTime = winutil.FormatTime(time.UnixMilli(addon.InstallDate))
+		}
+		if addon.UserPermissions != nil {
+			ext.Permissions = append(ext.Permissions, addon.UserPermissions.Permissions...)
+			ext.HostPermissions = append(ext.HostPermissions, addon.UserPermissions.Origins...)
+		}
+
+		ext.Flags = permissionFlags(ext)
+		builtin := strings.HasPrefix(addon.Location, "app-system") || addon.Location == "app-builtin"
+		if !builtin {
+			if addon.Location != "app-profile" {
+				ext.Flags = append(ext.Flags, "sideloaded")
+			} else if !ext.FromWebstore {
+				ext.Flags = append(ext.Flags, "non_amo_source")
+			}
+			if addon.SignedState != nil && *addon.SignedState <= 0 {
+				ext.Flags = append(ext.Flags, "unsigned")
+			}
+		}
+		extensions = append(extensions, ext)
+	}
+
+	return extensions, nil
+}
+
+// webkitTime converts a Chromium timestamp (decimal string or number of
+// microseconds since 1601) to UTC, returning the zero time if unset.
+func webkitTime(value string) time.Time {
+	us, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || us <= 0 {
+		return time.Time{}
+	}
+	return webkitMicros(us)
+}
+
+func webkitMicros(us int64) time.Time {
+	if us <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(us - webkitEpochOffset).UTC()
+}
+
+func trimBOM(data []byte) []byte {
+	return bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+}
+
+// countFlagged returns the number of extensions with at least one flag.
+func countFlagged(extensions []BrowserExtension) int {
+	count := 0
+	for _, ext := range extensions {
+		if len(ext.Flags) > 0 {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,215 @@
+package win_browser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	uBlockID  = "cjpalhdlnbpafiamejdnhcphjbkeiagm"
+	helperID  = "kbfnbcaeplbcioakkpcpgfkobkghlhen"
+	pdfToolID = "ofmcpbjbfaoaginhlnhbnjpmjoeiegkg"
+)
+
+// uBlockManifest has a localized name and Manifest V2 host permissions mixed
+// into permissions.
+const uBlockManifest = "\xef\xbb\xbf" + `{
+  "manifest_version": 2,
+  "name": "__MSG_extName__",
+  "default_locale": "en",
+  "version": "1.55.0",
+  "permissions": ["contextMenus", "privacy", "storage", "tabs", "webNavigation", "webRequest", "webRequestBlocking", "<all_urls>"]
+}`
+
+// helperManifest is a Manifest V3 extension reading every page, pushed
+// through the registry rather than the Web Store.
+const helperManifest = `{
+  "manifest_version": 3,
+  "name": "Tab Helper",
+  "version": "2.1",
+  "permissions": ["cookies", "nativeMessaging", "storage"],
+  "host_permissions": ["https://*/*"],
+  "content_scripts": [{"matches": ["https://mail.example.com/*"], "js": ["c.js"]}]
+}`
+
+// chromiumProfile lays out a Chrome profile directory: two packed extensions
+// under Extensions, and Preferences recording their install details plus an
+// unpacked extension loaded from a folder outside the profile.
+func chromiumProfile(t *testing.T) string {
+	t.Helper()
+	profileDir := t.TempDir()
+	files := map[string]string{
+		filepath.Join("Extensions", uBlockID, "1.55.0_0", "manifest.json"):                   uBlockManifest,
+		filepath.Join("Extensions", uBlockID, "1.55.0_0", "_locales", "en", "messages.json"): `{"extName": {"message": "uBlock Origin"}}`,
+		filepath.Join("Extensions", helperID, "2.1_0", "manifest.json"):                      helperManifest,
+		filepath.Join("Extensions", "Temp", "scoped_dir_1234", "manifest.json"):              `{not json`,
+		filepath.Join("Extensions", "README"):                                                "",
+		"Preferences": `{"extensions": {"settings": {
+			"` + uBlockID + `": {"location": 1, "from_webstore": true, "install_time": "13350000000000000", "state": 1},
+			"` + helperID + `": {"location": 3, "from_webstore": false, "install_time": "13353511263000000", "state": 1}
+		}}}`,
+		"Secure Preferences": `{"extensions": {"settings": {
+			"` + pdfToolID + `": {"location": 4, "state": 0, "path": "C:\\ProgramData\\pdftool",
+				"manifest": {"name": "PDF Tool", "version": "0.1", "permissions": ["debugger", "*://*/*"]}}
+		}}}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(profileDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return profileDir
+}
+
+func TestReadChromiumExtensions(t *testing.T) {
+	profileDir := chromiumProfile(t)
+	var prefs [][]byte
+	for _, name := range []string{"Preferences", "Secure Preferences"} {
+		data, err := os.ReadFile(filepath.Join(profileDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefs = append(prefs, data)
+	}
+	extensionsDir := filepath.Join(profileDir, "Extensions")
+	extensions, errors := ReadChromiumExtensions(extensionsDir, prefs...)
+
+	// The half-written Temp extension is reported and skipped
+	if len(errors) != 1 {
+		t.Fatalf("errors = %q", errors)
+	}
+	want := []BrowserExtension{
+		{
+			ID:              uBlockID,
+			Name:            "uBlock Origin",
+			Version:         "1.55.0",
+			Location:        "internal",
+			FromWebstore:    true,
+			Enabled:         true,
+			InstallTime:     "2024-01-17T21:20:00Z",
+			Path:            filepath.Join(extensionsDir, uBlockID, "1.55.0_0"),
+			Permissions:     []string{"contextMenus", "privacy", "storage", "tabs", "webNavigation", "webRequest", "webRequestBlocking"},
+			HostPermissions: []string{"<all_urls>"},
+			Flags:           []string{"broad_host_access", "sensitive_permission:webRequestBlocking"},
+		},
+		{
+			ID:              helperID,
+			Name:            "Tab Helper",
+			Version:         "2.1",
+			Location:        "external_registry",
+			Enabled:         true,
+			InstallTime:     "2024-02-27T12:41:03Z",
+			Path:            filepath.Join(extensionsDir, helperID, "2.1_0"),
+			Permissions:     []string{"cookies", "nativeMessaging", "storage"},
+			HostPermissions: []string{"https://*/*", "https://mail.example.com/*"},
+			Flags:           []string{"broad_host_access", "sensitive_permission:cookies", "sensitive_permission:nativeMessaging", "sideloaded"},
+		},
+		{
+			ID:              pdfToolID,
+			Name:            "PDF Tool",
+			Version:         "0.1",
+			Location:        "unpacked",
+			Path:            `C:\ProgramData\pdftool`,
+			Permissions:     []string{"debugger"},
+			HostPermissions: []string{"*://*/*"},
+			Flags:           []string{"broad_host_access", "sensitive_permission:debugger", "unpacked"},
+		},
+	}
+	if !reflect.DeepEqual(extensions, want) {
+		t.Fatalf("extensions = %+v\nwant %+v", extensions, want)
+	}
+	if countFlagged(extensions) != 3 {
+		t.Fatalf("%d flagged", countFlagged(extensions))
+	}
+}
+
+func TestReadChromiumExtensionsWithoutPreferences(t *testing.T) {
+	// Without the profile's settings only the manifests are known
+	extensionsDir := filepath.Join(chromiumProfile(t), "Extensions")
+	extensions, _ := ReadChromiumExtensions(extensionsDir, nil, []byte("{truncated"))
+	if len(extensions) != 2 || extensions[0].Location != "" || extensions[0].FromWebstore || !extensions[1].Enabled ||
+		!reflect.DeepEqual(extensions[1].Flags, []string{"broad_host_access", "sensitive_permission:cookies", "sensitive_permission:nativeMessaging"}) {
+		t.Fatalf("extensions = %+v", extensions)
+	}
+
+	if extensions, errors := ReadChromiumExtensions(filepath.Join(t.TempDir(), "Extensions")); len(extensions) != 0 || len(errors) != 0 {
+		t.Fatalf("missing Extensions directory = %+v, %q", extensions, errors)
+	}
+}
+
+func TestParseFirefoxExtensions(t *testing.T) {
+	data := []byte(`{"schemaVersion": 35, "addons": [
+		{"id": "uBlock0@raymondhill.net", "type": "extension", "version": "1.55.0", "location": "app-profile", "active": true,
+		 "sourceURI": "https://addons.mozilla.org/firefox/downloads/file/4198829/ublock_origin-1.55.0.xpi", "installDate": 1705440000000, "signedState": 2,
+		 "defaultLocale": {"name": "uBlock Origin"},
+		 "userPermissions": {"permissions": ["privacy", "storage", "webRequest", "webRequestBlocking"], "origins": ["<all_urls>"]}},
+		{"id": "sync@helper.example", "type": "extension", "version": "0.3", "location": "app-profile", "active": true,
+		 "sourceURI": "https://cdn-files.example.org/helper.xpi", "signedState": 0,
+		 "defaultLocale": {"name": "Sync Helper"}, "userPermissions": {"permissions": ["cookies"], "origins": []}},
+		{"id": "corp@example.com", "type": "extension", "version": "5.0", "location": "winreg-app-global", "active": false,
+		 "defaultLocale": {"name": "Corp Proxy"}, "userPermissions": {"permissions": ["proxy"], "origins": ["http://*/*"]}},
+		{"id": "formautofill@mozilla.org", "type": "extension", "version": "1.0.1", "location": "app-builtin", "active": true, "signedState": 0},
+		{"id": "langpack-de@firefox.mozilla.org", "type": "locale", "version": "121.0", "location": "app-profile"}
+	]}`)
+	extensions, err := ParseFirefoxExtensions(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BrowserExtension{
+		{
+			ID:              "uBlock0@raymondhill.net",
+			Name:            "uBlock Origin",
+			Version:         "1.55.0",
+			Location:        "app-profile",
+			FromWebstore:    true,
+			Enabled:         true,
+			InstallTime:     "2024-01-16T21:20:00Z",
+			SourceURI:       "https://addons.mozilla.org/firefox/downloads/file/4198829/ublock_origin-1.55.0.xpi",
+			Permissions:     []string{"privacy", "storage", "webRequest", "webRequestBlocking"},
+			HostPermissions: []string{"<all_urls>"},
+			Flags:           []string{"broad_host_access", "sensitive_permission:webRequestBlocking"},
+		},
+		{
+			ID:              "sync@helper.example",
+			Name:            "Sync Helper",
+			Version:         "0.3",
+			Location:        "app-profile",
+			Enabled:         true,
+			SourceURI:       "https://cdn-files.example.org/helper.xpi",
+			Permissions:     []string{"cookies"},
+			HostPermissions: []string{},
+			Flags:           []string{"sensitive_permission:cookies", "non_amo_source", "unsigned"},
+		},
+		{
+			ID:              "corp@example.com",
+			Name:            "Corp Proxy",
+			Version:         "5.0",
+			Location:        "winreg-app-global",
+			Permissions:     []string{"proxy"},
+			HostPermissions: []string{"http://*/*"},
+			Flags:           []string{"broad_host_access", "sensitive_permission:proxy", "sideloaded"},
+		},
+		{
+			ID:              "formautofill@mozilla.org",
+			Version:         "1.0.1",
+			Location:        "app-builtin",
+			Enabled:         true,
+			Permissions:     []string{},
+			HostPermissions: []string{},
+			Flags:           []string{},
+		},
+	}
+	if !reflect.DeepEqual(extensions, want) {
+		t.Fatalf("extensions = %+v\nwant %+v", extensions, want)
+	}
+
+	if _, err := ParseFirefoxExtensions([]byte(`{"addons": [`)); err == nil {
+		t.Fatal("truncated extensions.json parsed")
+	}
+}
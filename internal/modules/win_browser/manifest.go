@@ -2,9 +2,12 @@
 package win_browser
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 type BrowserItem struct {
@@ -14,7 +17,7 @@ type BrowserItem struct {
 	Truncated bool   `json:"truncated"`
 	Note      string `json:"note,omitempty"`
 	Modified  string `json:"modified"`
-	FileType  string `json:"file_type"` // "history", "cookies", "login_data"
+	FileType  string `json:"file_type"` // "history", "cookies", "login_data", "browser_extensions", "downloads"
 }
 
 type BrowserError struct {
@@ -30,11 +33,13 @@ type BrowserManifest struct {
 	Errors             []BrowserError `json:"errors"`
 	TotalFiles         int            `json:"total_files"`
 	CollectedFiles     int            `json:"collected_files"`
+	Since              string         `json:"since,omitempty"`            // Databases modified before this were not collected
+	SkippedBySince     int            `json:"skipped_by_since,omitempty"` // Databases modified before --since
 }
 
-func NewBrowserManifest(hostname string) *BrowserManifest {
+func NewBrowserManifest(ctx context.Context, hostname string) *BrowserManifest {
 	return &BrowserManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]BrowserItem, 0),
@@ -47,7 +52,7 @@ func NewBrowserManifest(hostname string) *BrowserManifest {
 func (bm *BrowserManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, note string) {
 	bm.Items = append(bm.Items, BrowserItem{
 		Path: path, Size: size, SHA256: sha256, Truncated: truncated, Note: note,
-		Modified: modified.UTC().Format(time.RFC3339), FileType: fileType,
+		Modified: winutil.FormatTime(modified), FileType: fileType,
 	})
 	bm.CollectedFiles++
 }
@@ -58,6 +63,8 @@ func (bm *BrowserManifest) AddError(target, errorMsg string) {
 
 func (bm *BrowserManifest) IncrementTotalFiles() { bm.TotalFiles++ }
 
+func (bm *BrowserManifest) IncrementSkippedBySince() { bm.SkippedBySince++ }
+
 func (bm *BrowserManifest) WriteManifest(manifestPath string) error {
 	data, err := json.MarshalIndent(bm, "", "  ")
 	if err != nil { return err }
@@ -6,5 +6,7 @@ import ("context")
 
 type WinBrowser struct{}
 func NewWinBrowser() *WinBrowser { return &WinBrowser{} }
+func (w *WinBrowser) SetSinceTime(sinceRFC3339 string) {}
 func (w *WinBrowser) Name() string { return "windows/browser" }
+func (w *WinBrowser) Describe() string { return "Browser artifacts (Chrome/Edge/Firefox)" }
 func (w *WinBrowser) Collect(ctx context.Context, outDir string) error { return nil }
\ No newline at end of file
@@ -4,37 +4,56 @@ package win_browser
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"cryptkeeper/internal/winutil"
 )
 
-type WinBrowser struct{}
+type WinBrowser struct {
+	sinceTime string // RFC3339 timestamp for filtering download history
+}
 
 func NewWinBrowser() *WinBrowser {
 	return &WinBrowser{}
 }
 
+// SetSinceTime configures the start-time filter for download history and
+// skips profile databases last modified before it.
+func (w *WinBrowser) SetSinceTime(sinceRFC3339 string) {
+	w.sinceTime = sinceRFC3339
+}
+
 func (w *WinBrowser) Name() string {
 	return "windows/browser"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinBrowser) Describe() string {
+	return "Browser artifacts (Chrome/Edge/Firefox)"
+}
+
 func (w *WinBrowser) Collect(ctx context.Context, outDir string) error {
 	browserDir := filepath.Join(outDir, "windows", "browser")
 	if err := winutil.EnsureDir(browserDir); err != nil {
 		return fmt.Errorf("failed to create browser directory: %w", err)
 	}
 
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
-	manifest := NewBrowserManifest(hostname)
-	constraints := winutil.NewSizeConstraints()
+	manifest := NewBrowserManifest(ctx, hostname)
+	if since := w.since(); !since.IsZero() {
+		manifest.Since = winutil.FormatTime(since)
+	}
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Enumerate user profiles for browser artifacts
 	if err := w.collectPerUserBrowserArtifacts(ctx, browserDir, manifest, constraints); err != nil {
@@ -50,12 +69,10 @@ func (w *WinBrowser) Collect(ctx context.Context, outDir string) error {
 }
 
 func (w *WinBrowser) collectPerUserBrowserArtifacts(ctx context.Context, outDir string, manifest *BrowserManifest, constraints *winutil.SizeConstraints) error {
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	usersDir := filepath.Join(systemDrive, "Users")
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(outDir, "user profiles", usersDir)
 	userEntries, err := os.ReadDir(usersDir)
 	if err != nil {
 		return fmt.Errorf("failed to read users directory: %w", err)
@@ -89,6 +106,7 @@ func (w *WinBrowser) collectChromiumArtifacts(ctx context.Context, userProfileDi
 	browserDataDir := filepath.Join(userProfileDir, "AppData", "Local", relativePath)
 	
 	// Look for user profiles (Default, Profile 1, etc.)
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(userOutDir, browserName+" user data", browserDataDir)
 	profiles, err := os.ReadDir(browserDataDir)
 	if err != nil {
 		return
@@ -115,11 +133,16 @@ func (w *WinBrowser) collectChromiumArtifacts(ctx context.Context, userProfileDi
 		dbFiles := []string{"History", "Cookies", "Login Data"}
 		for _, dbFile := range dbFiles {
 			srcPath := filepath.Join(profileDir, dbFile)
+			winutil.CollectSettingsFrom(ctx).Coverage.Check(outputProfileDir, browserName+" "+dbFile, srcPath)
 			if stat, err := os.Stat(srcPath); err == nil {
 				manifest.IncrementTotalFiles()
 				destPath := filepath.Join(outputProfileDir, dbFile)
 				
-				size, sha256Hex, truncated, err := winutil.SmartCopy(srcPath, destPath, constraints)
+				size, sha256Hex, truncated, err := winutil.SmartCopySince(srcPath, destPath, constraints, w.since())
+				if errors.Is(err, winutil.ErrBeforeSince) {
+					manifest.IncrementSkippedBySince()
+					continue
+				}
 				if err != nil {
 					manifest.AddError(srcPath, fmt.Sprintf("Failed to copy %s: %v", dbFile, err))
 					continue
@@ -132,12 +155,48 @@ func (w *WinBrowser) collectChromiumArtifacts(ctx context.Context, userProfileDi
 				manifest.AddItem(relPath, size, sha256Hex, truncated, stat.ModTime(), fileType, note)
 			}
 		}
+
+		relDir := filepath.Join("users", username, strings.ToLower(browserName), profileName)
+
+		// Extensions from on-disk manifests and the profile's extension settings
+		var prefs [][]byte
+		for _, prefsFile := range []string{"Preferences", "Secure Preferences"} {
+			if data, err := os.ReadFile(filepath.Join(profileDir, prefsFile)); err == nil {
+				prefs = append(prefs, data)
+			}
+		}
+		extensions, extErrors := ReadChromiumExtensions(filepath.Join(profileDir, "Extensions"), prefs...)
+		w.writeProfileReport(ctx, outputProfileDir, relDir, "browser_extensions.json", "browser_extensions", BrowserExtensions{
+			CollectedUTC:      winutil.FormatTime(winutil.Now(ctx)),
+			Browser:           browserName,
+			User:              username,
+			Profile:           profileName,
+			Extensions:        extensions,
+			FlaggedExtensions: countFlagged(extensions),
+			Errors:            extErrors,
+		}, manifest, fmt.Sprintf("%s extensions for user %s profile %s (%d flagged)", browserName, username, profileName, countFlagged(extensions)))
+
+		// Download history from the copied History database
+		historyCopy := filepath.Join(outputProfileDir, "History")
+		if _, err := os.Stat(historyCopy); err == nil {
+			report := w.newDownloadsReport(ctx, browserName, username, profileName)
+			downloads, err := ParseChromiumDownloads(historyCopy, w.since())
+			if err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			}
+			if downloads != nil {
+				report.Downloads = downloads
+			}
+			w.writeProfileReport(ctx, outputProfileDir, relDir, "downloads.json", "downloads", report, manifest,
+				fmt.Sprintf("%s download history for user %s profile %s (%d entries)", browserName, username, profileName, len(report.Downloads)))
+		}
 	}
 }
 
 func (w *WinBrowser) collectFirefoxArtifacts(ctx context.Context, userProfileDir, userOutDir string, manifest *BrowserManifest, constraints *winutil.SizeConstraints, username string) {
 	firefoxDir := filepath.Join(userProfileDir, "AppData", "Roaming", "Mozilla", "Firefox", "Profiles")
 	
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(userOutDir, "Firefox profiles", firefoxDir)
 	profiles, err := os.ReadDir(firefoxDir)
 	if err != nil {
 		return
@@ -160,11 +219,16 @@ func (w *WinBrowser) collectFirefoxArtifacts(ctx context.Context, userProfileDir
 		dbFiles := []string{"places.sqlite", "cookies.sqlite"}
 		for _, dbFile := range dbFiles {
 			srcPath := filepath.Join(profileDir, dbFile)
+			winutil.CollectSettingsFrom(ctx).Coverage.Check(outputProfileDir, "Firefox "+dbFile, srcPath)
 			if stat, err := os.Stat(srcPath); err == nil {
 				manifest.IncrementTotalFiles()
 				destPath := filepath.Join(outputProfileDir, dbFile)
 				
-				size, sha256Hex, truncated, err := winutil.SmartCopy(srcPath, destPath, constraints)
+				size, sha256Hex, truncated, err := winutil.SmartCopySince(srcPath, destPath, constraints, w.since())
+				if errors.Is(err, winutil.ErrBeforeSince) {
+					manifest.IncrementSkippedBySince()
+					continue
+				}
 				if err != nil {
 					manifest.AddError(srcPath, fmt.Sprintf("Failed to copy %s: %v", dbFile, err))
 					continue
@@ -177,6 +241,76 @@ func (w *WinBrowser) collectFirefoxArtifacts(ctx context.Context, userProfileDir
 				manifest.AddItem(relPath, size, sha256Hex, truncated, stat.ModTime(), fileType, note)
 			}
 		}
+
+		relDir := filepath.Join("users", username, "firefox", profileName)
+
+		if data, err := os.ReadFile(filepath.Join(profileDir, "extensions.json")); err == nil {
+			report := BrowserExtensions{
+				CollectedUTC: winutil.FormatTime(winutil.Now(ctx)),
+				Browser:      "Firefox",
+				User:         username,
+				Profile:      profileName,
+				Extensions:   make([]BrowserExtension, 0),
+			}
+			if extensions, err := ParseFirefoxExtensions(data); err == nil {
+				report.Extensions = extensions
+				report.FlaggedExtensions = countFlagged(extensions)
+			} else {
+				report.Errors = append(report.Errors, err.Error())
+			}
+			w.writeProfileReport(ctx, outputProfileDir, relDir, "browser_extensions.json", "browser_extensions", report, manifest,
+				fmt.Sprintf("Firefox add-ons for user %s profile %s (%d flagged)", username, profileName, report.FlaggedExtensions))
+		}
+
+		placesCopy := filepath.Join(outputProfileDir, "places.sqlite")
+		if _, err := os.Stat(placesCopy); err == nil {
+			report := w.newDownloadsReport(ctx, "Firefox", username, profileName)
+			downloads, err := ParseFirefoxDownloads(placesCopy, w.since())
+			if err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			}
+			if downloads != nil {
+				report.Downloads = downloads
+			}
+			w.writeProfileReport(ctx, outputProfileDir, relDir, "downloads.json", "downloads", report, manifest,
+				fmt.Sprintf("Firefox download history for user %s profile %s (%d entries)", username, profileName, len(report.Downloads)))
+		}
+	}
+}
+
+func (w *WinBrowser) since() time.Time {
+	return winutil.ParseSince(w.sinceTime)
+}
+
+func (w *WinBrowser) newDownloadsReport(ctx context.Context, browserName, username, profileName string) *BrowserDownloads {
+	return &BrowserDownloads{
+		CollectedUTC: winutil.FormatTime(winutil.Now(ctx)),
+		Browser:      browserName,
+		User:         username,
+		Profile:      profileName,
+		Since:        w.sinceTime,
+		Downloads:    make([]BrowserDownload, 0),
+	}
+}
+
+// writeProfileReport writes a parsed per-profile report and records it in the manifest.
+func (w *WinBrowser) writeProfileReport(ctx context.Context, outputProfileDir, relDir, fileName, fileType string, report interface{}, manifest *BrowserManifest, note string) {
+	outputPath := filepath.Join(outputProfileDir, fileName)
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		manifest.AddError(outputPath, fmt.Sprintf("Failed to marshal %s: %v", fileName, err))
+		return
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		manifest.AddError(outputPath, fmt.Sprintf("Failed to write %s: %v", fileName, err))
+		return
+	}
+
+	manifest.IncrementTotalFiles()
+	if stat, err := os.Stat(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
+			manifest.AddItem(filepath.Join(relDir, fileName), stat.Size(), sha256Hex, false, stat.ModTime(), fileType, note)
+		}
 	}
 }
 
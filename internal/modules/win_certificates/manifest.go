@@ -2,9 +2,13 @@
 package win_certificates
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
 )
 
 // CertificateItem represents a collected certificate-related file.
@@ -34,12 +38,13 @@ type CertificateManifest struct {
 	TotalFiles         int                 `json:"total_files"`
 	CollectedFiles     int                 `json:"collected_files"`
 	CertificatesFound  int                 `json:"certificates_found"`
+	Summary            schema.Summary      `json:"summary"`
 }
 
 // NewCertificateManifest creates a new certificates manifest with basic information.
-func NewCertificateManifest(hostname string) *CertificateManifest {
+func NewCertificateManifest(ctx context.Context, hostname string) *CertificateManifest {
 	return &CertificateManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]CertificateItem, 0),
@@ -47,6 +52,7 @@ func NewCertificateManifest(hostname string) *CertificateManifest {
 		TotalFiles:         0,
 		CollectedFiles:     0,
 		CertificatesFound:  0,
+		Summary:            schema.NewSummary(),
 	}
 }
 
@@ -58,7 +64,7 @@ func (cm *CertificateManifest) AddItem(path string, size int64, sha256 string, t
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	cm.CollectedFiles++
@@ -80,6 +86,7 @@ func (cm *CertificateManifest) IncrementTotalFiles() {
 // SetCertificatesFound sets the number of certificates found.
 func (cm *CertificateManifest) SetCertificatesFound(count int) {
 	cm.CertificatesFound = count
+	cm.Summary.Set(schema.SummaryCertificates, count)
 }
 
 // WriteManifest writes the manifest to a JSON file.
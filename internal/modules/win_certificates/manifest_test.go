@@ -0,0 +1,44 @@
+package win_certificates
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cryptkeeper/internal/schema"
+)
+
+func TestCertificateManifestSummary(t *testing.T) {
+	manifest := NewCertificateManifest(context.Background(), "WS-0142")
+	if manifest.Summary == nil || len(manifest.Summary) != 0 {
+		t.Fatalf("new manifest summary = %v", manifest.Summary)
+	}
+	manifest.SetCertificatesFound(3)
+	manifest.SetCertificatesFound(42)
+
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := manifest.WriteManifest(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tooling reads the uniform summary without knowing the module's fields
+	var generic struct {
+		Summary           schema.Summary `json:"summary"`
+		CertificatesFound int            `json:"certificates_found"`
+	}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		t.Fatal(err)
+	}
+	if generic.Summary[schema.SummaryCertificates] != 42 || generic.Summary["certificates"] != 42 {
+		t.Fatalf("summary = %v, want certificates: 42", generic.Summary)
+	}
+	if generic.CertificatesFound != 42 || len(generic.Summary) != 1 {
+		t.Fatalf("manifest = %s", data)
+	}
+}
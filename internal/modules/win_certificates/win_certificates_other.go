@@ -19,6 +19,16 @@ func (w *WinCertificates) Name() string {
 	return "windows/certificates"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinCertificates) Describe() string {
+	return "Certificate stores and PKI"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinCertificates) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinCertificates) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
@@ -25,6 +25,16 @@ func (w *WinCertificates) Name() string {
 	return "windows/certificates"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinCertificates) Describe() string {
+	return "Certificate stores and PKI"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinCertificates) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers certificate store and PKI configuration information.
 func (w *WinCertificates) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/certificates subdirectory
@@ -34,13 +44,13 @@ func (w *WinCertificates) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewCertificateManifest(hostname)
+	manifest := NewCertificateManifest(ctx, hostname)
 
 	// Collect certificate stores
 	if err := w.collectCertificateStores(ctx, certificatesDir, manifest); err != nil {
@@ -141,7 +151,7 @@ func (w *WinCertificates) collectCertificateStores(ctx context.Context, outDir s
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			note := fmt.Sprintf("Certificate stores information (%d certificates found)", certCount)
 			manifest.AddItem("certificate_stores.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "cert_stores", note)
 			manifest.IncrementTotalFiles()
@@ -196,7 +206,7 @@ func (w *WinCertificates) collectPKIConfig(ctx context.Context, outDir string, m
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("pki_config.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "pki_config", "PKI configuration and certificate services")
 			manifest.IncrementTotalFiles()
 		}
@@ -261,7 +271,7 @@ func (w *WinCertificates) collectCryptoPolicies(ctx context.Context, outDir stri
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("crypto_policies.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "crypto_policies", "Cryptographic policies and algorithm configuration")
 			manifest.IncrementTotalFiles()
 		}
@@ -0,0 +1,149 @@
+package win_certutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// CryptnetUrlCache MetaData files start with a fixed header; the URL and
+// then the ETag follow it as UTF-16LE strings whose byte lengths the header
+// records. The content file in Content shares the metadata file's name.
+const (
+	metadataURLSizeOffset  = 0x0c
+	metadataDownloadOffset = 0x10
+	metadataETagSizeOffset = 0x64
+	metadataFileSizeOffset = 0x70
+	metadataHeaderSize     = 0x74
+)
+
+// Flags recorded on unusual CryptnetUrlCache entries. Certificate validation
+// fetches CRLs, certificates, and CTLs over HTTP or LDAP from PKI hosts;
+// `certutil -urlcache -f` downloads arbitrary files into the same cache.
+const (
+	FlagPEContent       = "pe_content"        // The cached content is a Windows executable
+	FlagIPHost          = "ip_address_host"   // The URL names an IP address rather than a host name
+	FlagNonStandardPort = "non_standard_port" // The URL names a port other than the scheme's default
+	FlagUnusualScheme   = "unusual_scheme"    // Neither http, https, nor ldap
+	FlagUnusualFile     = "unusual_extension" // The URL path ends in an extension PKI downloads do not use
+)
+
+// pkiExtensions are the file extensions certificate validation downloads.
+var pkiExtensions = map[string]bool{
+	".crl": true, ".crt": true, ".cer": true, ".der": true, ".pem": true,
+	".p7b": true, ".p7c": true, ".p7s": true, ".stl": true, ".sst": true,
+	".cab": true, // authrootstl.cab, disallowedcertstl.cab, pinrulesstl.cab
+}
+
+// defaultPorts are the ports a URL may name without being flagged.
+var defaultPorts = map[string]map[string]bool{
+	"http":  {"80": true},
+	"https": {"443": true},
+	"ldap":  {"389": true},
+}
+
+// CryptnetMetadata is the decoded header of a CryptnetUrlCache MetaData file.
+type CryptnetMetadata struct {
+	URL          string
+	ETag         string
+	LastDownload time.Time // Zero when unset
+	ContentSize  uint32
+}
+
+// CryptnetEntry is an entry of cryptnet_urls.json.
+type CryptnetEntry struct {
+	Profile         string   `json:"profile"`                // User name, or systemprofile/LocalService/NetworkService
+	MetadataFile    string   `json:"metadata_file"`          // Path of the MetaData copy relative to windows/certutil
+	ContentFile     string   `json:"content_file,omitempty"` // Path of the Content copy, when one was collected
+	URL             string   `json:"url"`
+	ETag            string   `json:"etag,omitempty"`
+	LastDownloadUTC string   `json:"last_download_utc,omitempty"`
+	ContentSize     uint32   `json:"content_size"`
+	Flags           []string `json:"flags,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// CryptnetURLs is the structure written to cryptnet_urls.json.
+type CryptnetURLs struct {
+	CollectedUTC string          `json:"collected_utc"`
+	Entries      []CryptnetEntry `json:"entries"`
+	FlaggedCount int             `json:"flagged_count"`
+	Errors       []string        `json:"errors,omitempty"`
+}
+
+// ParseCryptnetMetadata decodes a CryptnetUrlCache MetaData file.
+func ParseCryptnetMetadata(data []byte) (*CryptnetMetadata, error) {
+	if len(data) < metadataHeaderSize {
+		return nil, fmt.Errorf("metadata file too short (%d bytes)", len(data))
+	}
+	urlSize := int(binary.LittleEndian.Uint32(data[metadataURLSizeOffset:]))
+	etagSize := int(binary.LittleEndian.Uint32(data[metadataETagSizeOffset:]))
+	if urlSize == 0 || urlSize > len(data)-metadataHeaderSize {
+		return nil, fmt.Errorf("invalid URL length %d", urlSize)
+	}
+
+	meta := &CryptnetMetadata{
+		URL:          decodeUTF16(data[metadataHeaderSize : metadataHeaderSize+urlSize]),
+		LastDownload: winutil.FiletimeToUTC(binary.LittleEndian.Uint64(data[metadataDownloadOffset:])),
+		ContentSize:  binary.LittleEndian.Uint32(data[metadataFileSizeOffset:]),
+	}
+	if etagStart := metadataHeaderSize + urlSize; etagSize > 0 && etagSize <= len(data)-etagStart {
+		meta.ETag = strings.Trim(decodeUTF16(data[etagStart:etagStart+etagSize]), `"`)
+	}
+	return meta, nil
+}
+
+// FlagCryptnetURL returns the reasons a cached URL is unusual for certificate
+// validation, or nil. peContent reports whether the cached content starts
+// with an MZ header.
+func FlagCryptnetURL(rawURL string, peContent bool) []string {
+	var flags []string
+	if peContent {
+		flags = append(flags, FlagPEContent)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return append(flags, FlagUnusualScheme)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	ports, known := defaultPorts[scheme]
+	if !known {
+		flags = append(flags, FlagUnusualScheme)
+	}
+	if host := u.Hostname(); net.ParseIP(host) != nil {
+		flags = append(flags, FlagIPHost)
+	}
+	if port := u.Port(); port != "" && known && !ports[port] {
+		flags = append(flags, FlagNonStandardPort)
+	}
+	if ext := strings.ToLower(path.Ext(u.Path)); ext != "" && !pkiExtensions[ext] {
+		flags = append(flags, FlagUnusualFile)
+	}
+	return flags
+}
+
+// IsPE reports whether data starts with the MZ header of a Windows executable.
+func IsPE(data []byte) bool {
+	return len(data) >= 2 && data[0] == 'M' && data[1] == 'Z'
+}
+
+// decodeUTF16 decodes UTF-16LE bytes, stopping at the first NUL.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
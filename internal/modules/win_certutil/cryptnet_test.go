@@ -0,0 +1,116 @@
+package win_certutil
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// utf16z encodes s as NUL-terminated UTF-16LE.
+func utf16z(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s + "\x00")) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+// metadataFile builds a CryptnetUrlCache MetaData file for a download of
+// size bytes from rawURL at downloaded.
+func metadataFile(rawURL, etag string, downloaded time.Time, size uint32) []byte {
+	urlBytes, etagBytes := utf16z(rawURL), []byte(nil)
+	if etag != "" {
+		etagBytes = utf16z(etag)
+	}
+	data := make([]byte, metadataHeaderSize)
+	binary.LittleEndian.PutUint32(data[0:], 0x29b) // Header version seen on Windows 10 and 11
+	binary.LittleEndian.PutUint32(data[metadataURLSizeOffset:], uint32(len(urlBytes)))
+	filetime := uint64(downloaded.Unix()+11644473600)*10000000 + uint64(downloaded.Nanosecond()/100)
+	binary.LittleEndian.PutUint64(data[metadataDownloadOffset:], filetime)
+	binary.LittleEndian.PutUint32(data[metadataETagSizeOffset:], uint32(len(etagBytes)))
+	binary.LittleEndian.PutUint32(data[metadataFileSizeOffset:], size)
+	return append(append(data, urlBytes...), etagBytes...)
+}
+
+func TestParseCryptnetMetadata(t *testing.T) {
+	downloaded := time.Date(2024, 2, 27, 22, 14, 9, 0, time.UTC)
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want CryptnetMetadata
+	}{
+		{
+			"CRL with ETag",
+			metadataFile("http://crl.microsoft.com/pki/crl/products/MicRooCerAut2011_2011_03_22.crl", `"80ab3f1e2c5ada1:0"`, downloaded, 1004),
+			CryptnetMetadata{URL: "http://crl.microsoft.com/pki/crl/products/MicRooCerAut2011_2011_03_22.crl", ETag: "80ab3f1e2c5ada1:0", LastDownload: downloaded, ContentSize: 1004},
+		},
+		{
+			"certutil download without ETag",
+			metadataFile("http://185.220.101.34:8080/update/chrome_setup.exe", "", downloaded, 482816),
+			CryptnetMetadata{URL: "http://185.220.101.34:8080/update/chrome_setup.exe", LastDownload: downloaded, ContentSize: 482816},
+		},
+		{
+			"never downloaded",
+			metadataFile("http://ctldl.windowsupdate.com/msdownload/update/v3/static/trustedr/en/authrootstl.cab", "", time.Unix(-11644473600, 0), 0),
+			CryptnetMetadata{URL: "http://ctldl.windowsupdate.com/msdownload/update/v3/static/trustedr/en/authrootstl.cab"},
+		},
+	} {
+		meta, err := ParseCryptnetMetadata(tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(*meta, tt.want) {
+			t.Errorf("%s: metadata = %+v, want %+v", tt.name, *meta, tt.want)
+		}
+	}
+}
+
+func TestParseCryptnetMetadataRejectsShortRecords(t *testing.T) {
+	full := metadataFile("http://crl.microsoft.com/pki/crl/products/root.crl", `"1d6a"`, time.Date(2024, 2, 27, 0, 0, 0, 0, time.UTC), 900)
+
+	noURL := append([]byte(nil), full...)
+	binary.LittleEndian.PutUint32(noURL[metadataURLSizeOffset:], 0)
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "too short"},
+		{"header cut short", full[:metadataHeaderSize-1], "too short"},
+		{"URL cut short", full[:metadataHeaderSize+20], "invalid URL length"},
+		{"no URL", noURL, "invalid URL length"},
+	} {
+		if _, err := ParseCryptnetMetadata(tt.data); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// A cut-off ETag is dropped; the URL is still usable
+	etagStart := len(full) - len(utf16z(`"1d6a"`))
+	meta, err := ParseCryptnetMetadata(full[:etagStart+4])
+	if err != nil || meta.URL != "http://crl.microsoft.com/pki/crl/products/root.crl" || meta.ETag != "" {
+		t.Fatalf("metadata with a cut ETag = %+v, %v", meta, err)
+	}
+}
+
+func TestFlagCryptnetURL(t *testing.T) {
+	for _, tt := range []struct {
+		url  string
+		pe   bool
+		want []string
+	}{
+		{"http://crl.microsoft.com/pki/crl/products/MicRooCerAut2011_2011_03_22.crl", false, nil},
+		{"http://ctldl.windowsupdate.com/msdownload/update/v3/static/trustedr/en/disallowedcertstl.cab", false, nil},
+		{"ldap:///CN=CORP-CA,CN=CDP,CN=Public%20Key%20Services,DC=corp,DC=example,DC=com?certificateRevocationList", false, nil},
+		{"http://185.220.101.34:8080/update/chrome_setup.exe", true, []string{FlagPEContent, FlagIPHost, FlagNonStandardPort, FlagUnusualFile}},
+		{"https://raw.githubusercontent.com/x/y/main/payload.ps1", false, []string{FlagUnusualFile}},
+		{"ftp://files.example.com/ca.crt", false, []string{FlagUnusualScheme}},
+	} {
+		if got := FlagCryptnetURL(tt.url, tt.pe); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FlagCryptnetURL(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Package win_certutil provides Windows certificate cache, CTL, and CryptnetUrlCache collection for cryptkeeper.
+package win_certutil
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
+)
+
+// CertutilItem represents a collected certificate cache artifact.
+type CertutilItem struct {
+	Path      string `json:"path"`           // Relative path in the archive
+	Size      int64  `json:"size"`           // File size in bytes
+	SHA256    string `json:"sha256"`         // SHA-256 hash
+	Truncated bool   `json:"truncated"`      // Whether the file was truncated due to size limits
+	Note      string `json:"note,omitempty"` // Description of the file
+	Modified  string `json:"modified"`       // File modification time (RFC3339)
+	FileType  string `json:"file_type"`      // Type: "cert_store", "cryptnet_metadata", "cryptnet_content", "cryptnet_urls"
+}
+
+// CertutilError represents an error that occurred during collection.
+type CertutilError struct {
+	Target string `json:"target"` // What failed (e.g., specific file path)
+	Error  string `json:"error"`  // Error message
+}
+
+// CertutilManifest represents the complete manifest for certificate cache collection.
+type CertutilManifest struct {
+	CreatedUTC         string          `json:"created_utc"`
+	Host               string          `json:"host"`
+	CryptkeeperVersion string          `json:"cryptkeeper_version"`
+	Items              []CertutilItem  `json:"items"`
+	Errors             []CertutilError `json:"errors"`
+	TotalFiles         int             `json:"total_files"`
+	CollectedFiles     int             `json:"collected_files"`
+	URLsFound          int             `json:"urls_found"`
+	FlaggedURLs        int             `json:"flagged_urls"`
+	Summary            schema.Summary  `json:"summary"`
+}
+
+// NewCertutilManifest creates a new certificate cache manifest with basic information.
+func NewCertutilManifest(ctx context.Context, hostname string) *CertutilManifest {
+	return &CertutilManifest{
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
+		Host:               hostname,
+		CryptkeeperVersion: "v0.1.0",
+		Items:              make([]CertutilItem, 0),
+		Errors:             make([]CertutilError, 0),
+		TotalFiles:         0,
+		CollectedFiles:     0,
+		URLsFound:          0,
+		Summary:            schema.NewSummary(),
+	}
+}
+
+// AddItem adds a successfully collected certificate cache item to the manifest.
+func (cm *CertutilManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, note string) {
+	cm.Items = append(cm.Items, CertutilItem{
+		Path:      path,
+		Size:      size,
+		SHA256:    sha256,
+		Truncated: truncated,
+		Note:      note,
+		Modified:  winutil.FormatTime(modified),
+		FileType:  fileType,
+	})
+	cm.CollectedFiles++
+}
+
+// AddError adds an error to the manifest for a failed collection.
+func (cm *CertutilManifest) AddError(target, errorMsg string) {
+	cm.Errors = append(cm.Errors, CertutilError{
+		Target: target,
+		Error:  errorMsg,
+	})
+}
+
+// IncrementTotalFiles increments the count of total files found.
+func (cm *CertutilManifest) IncrementTotalFiles() {
+	cm.TotalFiles++
+}
+
+// SetURLsFound sets the number of CryptnetUrlCache entries decoded and how many were flagged.
+func (cm *CertutilManifest) SetURLsFound(count, flagged int) {
+	cm.URLsFound = count
+	cm.FlaggedURLs = flagged
+	cm.Summary.Set(schema.SummaryCryptnetURLs, count)
+}
+
+// WriteManifest writes the manifest to a JSON file.
+func (cm *CertutilManifest) WriteManifest(manifestPath string) error {
+	data, err := json.MarshalIndent(cm, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath, data, 0644)
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package win_certutil
+
+import (
+	"context"
+)
+
+// WinCertutil represents the certificate cache collection module (no-op on non-Windows).
+type WinCertutil struct{}
+
+// NewWinCertutil creates a new certificate cache collection module.
+func NewWinCertutil() *WinCertutil {
+	return &WinCertutil{}
+}
+
+// Name returns the module's identifier.
+func (w *WinCertutil) Name() string {
+	return "windows/certutil"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinCertutil) Describe() string {
+	return "Certificate caches, CTLs, and CryptnetUrlCache URLs"
+}
+
+// Collect is a no-op on non-Windows systems.
+func (w *WinCertutil) Collect(ctx context.Context, outDir string) error {
+	// No-op on non-Windows systems
+	return nil
+}
@@ -0,0 +1,311 @@
+//go:build windows
+
+package win_certutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// cryptnetCacheDir is the CryptnetUrlCache directory under a profile.
+var cryptnetCacheDir = filepath.Join("AppData", "LocalLow", "Microsoft", "CryptnetUrlCache")
+
+// systemCertificatesDir is the per-user certificate store directory under a profile.
+var systemCertificatesDir = filepath.Join("AppData", "Roaming", "Microsoft", "SystemCertificates")
+
+// fileNotes describes the copied files of each type in the manifest.
+var fileNotes = map[string]string{
+	"cert_store":        "Certificate store file",
+	"cryptnet_metadata": "CryptnetUrlCache metadata",
+	"cryptnet_content":  "CryptnetUrlCache content",
+}
+
+// WinCertutil represents the certificate cache and CryptnetUrlCache collection module.
+type WinCertutil struct{}
+
+// NewWinCertutil creates a new certificate cache collection module.
+func NewWinCertutil() *WinCertutil {
+	return &WinCertutil{}
+}
+
+// Name returns the module's identifier.
+func (w *WinCertutil) Name() string {
+	return "windows/certutil"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinCertutil) Describe() string {
+	return "Certificate caches, CTLs, and CryptnetUrlCache URLs"
+}
+
+// cacheProfile is a profile whose certificate stores and URL cache are collected.
+type cacheProfile struct {
+	Name   string // User name, or the service profile name
+	Dir    string // Profile directory on the host
+	OutRel string // Output directory relative to windows/certutil
+}
+
+// Collect copies the per-user SystemCertificates stores and the
+// CryptnetUrlCache of every user and service profile, decodes the cached
+// URLs into cryptnet_urls.json, and creates a manifest.
+func (w *WinCertutil) Collect(ctx context.Context, outDir string) error {
+	// Create the windows/certutil subdirectory
+	certutilDir := filepath.Join(outDir, "windows", "certutil")
+	if err := winutil.EnsureDir(certutilDir); err != nil {
+		return fmt.Errorf("failed to create certutil directory: %w", err)
+	}
+
+	// Get hostname for manifest
+	hostname, err := winutil.Hostname(ctx)
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	manifest := NewCertutilManifest(ctx, hostname)
+	constraints := winutil.NewSizeConstraints(ctx)
+	urls := &CryptnetURLs{Entries: make([]CryptnetEntry, 0)}
+
+	profiles, err := w.profiles()
+	if err != nil {
+		manifest.AddError("users", fmt.Sprintf("Failed to enumerate user profiles: %v", err))
+	}
+	for _, profile := range profiles {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		storesDir := filepath.Join(profile.Dir, systemCertificatesDir)
+		if err := w.copyTree(ctx, storesDir, filepath.Join(profile.OutRel, "SystemCertificates"), "cert_store", certutilDir, manifest, constraints); err != nil {
+			manifest.AddError(storesDir, err.Error())
+		}
+
+		cacheDir := filepath.Join(profile.Dir, cryptnetCacheDir)
+		cacheRel := filepath.Join(profile.OutRel, "CryptnetUrlCache")
+		if err := w.copyTree(ctx, filepath.Join(cacheDir, "MetaData"), filepath.Join(cacheRel, "MetaData"), "cryptnet_metadata", certutilDir, manifest, constraints); err != nil {
+			manifest.AddError(cacheDir, err.Error())
+			continue
+		}
+		if err := w.copyTree(ctx, filepath.Join(cacheDir, "Content"), filepath.Join(cacheRel, "Content"), "cryptnet_content", certutilDir, manifest, constraints); err != nil {
+			manifest.AddError(cacheDir, err.Error())
+		}
+		w.decodeCache(profile.Name, certutilDir, cacheRel, urls)
+	}
+
+	for _, entry := range urls.Entries {
+		if len(entry.Flags) > 0 {
+			urls.FlaggedCount++
+		}
+	}
+	urls.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+	manifest.SetURLsFound(len(urls.Entries), urls.FlaggedCount)
+
+	if err := w.writeURLs(ctx, certutilDir, urls, manifest); err != nil {
+		manifest.AddError("cryptnet_urls.json", err.Error())
+	}
+
+	// Write manifest
+	manifestPath := filepath.Join(certutilDir, "manifest.json")
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// profiles lists the service profiles, whose URL caches record fetches made
+// by services and the system itself, followed by each user profile.
+func (w *WinCertutil) profiles() ([]cacheProfile, error) {
+	systemRoot := winutil.SystemRoot()
+	profiles := []cacheProfile{
+		{Name: "systemprofile", Dir: filepath.Join(systemRoot, "System32", "config", "systemprofile")},
+		{Name: "LocalService", Dir: filepath.Join(systemRoot, "ServiceProfiles", "LocalService")},
+		{Name: "NetworkService", Dir: filepath.Join(systemRoot, "ServiceProfiles", "NetworkService")},
+	}
+	for i := range profiles {
+		profiles[i].OutRel = filepath.Join("profiles", profiles[i].Name)
+	}
+
+	usersDir := winutil.UsersDir()
+	userEntries, err := os.ReadDir(usersDir)
+	if err != nil {
+		return profiles, fmt.Errorf("failed to read users directory: %w", err)
+	}
+	for _, userEntry := range userEntries {
+		if !userEntry.IsDir() || w.isSystemProfile(userEntry.Name()) {
+			continue
+		}
+		username := userEntry.Name()
+		profiles = append(profiles, cacheProfile{
+			Name:   username,
+			Dir:    filepath.Join(usersDir, username),
+			OutRel: filepath.Join("users", username),
+		})
+	}
+	return profiles, nil
+}
+
+// copyTree copies every file under srcDir to destRel under outDir. A missing
+// srcDir is not an error.
+func (w *WinCertutil) copyTree(ctx context.Context, srcDir, destRel, fileType, outDir string, manifest *CertutilManifest, constraints *winutil.SizeConstraints) error {
+	if _, err := os.Stat(srcDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.WalkDir(srcDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			manifest.AddError(path, err.Error())
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		manifest.IncrementTotalFiles()
+		relFromSource, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			manifest.AddError(path, fmt.Sprintf("Failed to compute relative path: %v", err))
+			return nil
+		}
+		relPath := filepath.Join(destRel, relFromSource)
+		destPath := filepath.Join(outDir, relPath)
+		if err := winutil.EnsureDir(filepath.Dir(destPath)); err != nil {
+			manifest.AddError(path, fmt.Sprintf("Failed to create output directory: %v", err))
+			return nil
+		}
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			manifest.AddError(path, fmt.Sprintf("Failed to stat file: %v", err))
+			return nil
+		}
+		size, sha256Hex, truncated, err := winutil.SmartCopy(path, destPath, constraints)
+		if err != nil {
+			manifest.AddError(path, fmt.Sprintf("Failed to copy file: %v", err))
+			return nil
+		}
+		manifest.AddItem(relPath, size, sha256Hex, truncated, stat.ModTime(), fileType, fmt.Sprintf("%s from %s", fileNotes[fileType], path))
+		return nil
+	})
+}
+
+// decodeCache decodes the collected MetaData files of one profile's
+// CryptnetUrlCache and checks whether each cached content is an executable.
+func (w *WinCertutil) decodeCache(profile, outDir, cacheRel string, urls *CryptnetURLs) {
+	metadataDir := filepath.Join(outDir, cacheRel, "MetaData")
+	entries, err := os.ReadDir(metadataDir)
+	if err != nil {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, dirEntry := range entries {
+		if dirEntry.IsDir() {
+			continue
+		}
+		entry := CryptnetEntry{
+			Profile:      profile,
+			MetadataFile: filepath.Join(cacheRel, "MetaData", dirEntry.Name()),
+		}
+
+		data, err := os.ReadFile(filepath.Join(metadataDir, dirEntry.Name()))
+		if err == nil {
+			var meta *CryptnetMetadata
+			if meta, err = ParseCryptnetMetadata(data); err == nil {
+				entry.URL = meta.URL
+				entry.ETag = meta.ETag
+				entry.ContentSize = meta.ContentSize
+				if !meta.LastDownload.IsZero() {
+					entry.LastDownloadUTC = winutil.FormatTime(meta.LastDownload)
+				}
+			}
+		}
+		if err != nil {
+			entry.Error = err.Error()
+			urls.Entries = append(urls.Entries, entry)
+			continue
+		}
+
+		contentRel := filepath.Join(cacheRel, "Content", dirEntry.Name())
+		peContent := false
+		if header, err := readHeader(filepath.Join(outDir, contentRel)); err == nil {
+			entry.ContentFile = contentRel
+			peContent = IsPE(header)
+		}
+		entry.Flags = FlagCryptnetURL(entry.URL, peContent)
+		urls.Entries = append(urls.Entries, entry)
+	}
+}
+
+// readHeader returns the first bytes of a file.
+func readHeader(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 2)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+// writeURLs writes cryptnet_urls.json.
+func (w *WinCertutil) writeURLs(ctx context.Context, outDir string, urls *CryptnetURLs, manifest *CertutilManifest) error {
+	outputPath := filepath.Join(outDir, "cryptnet_urls.json")
+	data, err := json.MarshalIndent(urls, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cryptnet URLs: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cryptnet URLs: %w", err)
+	}
+
+	manifest.IncrementTotalFiles()
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat cryptnet URLs: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash cryptnet URLs: %w", err)
+	}
+	note := fmt.Sprintf("URLs fetched during certificate validation (%d entries, %d flagged)", len(urls.Entries), urls.FlaggedCount)
+	manifest.AddItem("cryptnet_urls.json", stat.Size(), sha256Hex, false, stat.ModTime(), "cryptnet_urls", note)
+
+	return nil
+}
+
+// isSystemProfile checks if a username represents a system profile that should be skipped.
+func (w *WinCertutil) isSystemProfile(username string) bool {
+	systemProfiles := []string{
+		"All Users", "Default", "Default User", "Public",
+		"WDAGUtilityAccount", "defaultuser0", "systemprofile",
+	}
+
+	lowerUsername := strings.ToLower(username)
+	for _, profile := range systemProfiles {
+		if lowerUsername == strings.ToLower(profile) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,466 @@
+package win_crashdumps
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// driverInventoryPath is where the windows/amcache module writes its driver
+// inventory, relative to the artifacts root.
+var driverInventoryPath = filepath.Join("windows_amcache", "windows", "amcache", "driver_inventory.json")
+
+// Kernel dump header signatures and layout. A crash dump starts with a
+// DUMP_HEADER32 ("PAGEDUMP", 0x1000 bytes) or DUMP_HEADER64 ("PAGEDU64",
+// 0x2000 bytes); minidumps and LiveKernelReports triage dumps follow it with
+// a TRIAGE_DUMP block listing the loaded drivers.
+const (
+	dumpSignature   = "PAGE"
+	dumpValid32     = "DUMP"
+	dumpValid64     = "DU64"
+	header32Size    = 0x1000
+	header64Size    = 0x2000
+	dumpTypeTriage  = 4
+	maxTriageDriver = 4096
+)
+
+// Dump types recorded in the header.
+var dumpTypes = map[uint32]string{
+	1: "full",
+	2: "kernel",
+	3: "header_only",
+	4: "triage",
+	5: "bitmap_full",
+	6: "bitmap_kernel",
+}
+
+// headerLayout holds the field offsets of one header width.
+type headerLayout struct {
+	size             int64
+	pointer          int // Width of addresses and bug check parameters
+	bugCheckCode     int
+	bugCheckParams   int
+	exceptionAddress int // ExceptionRecord.ExceptionAddress
+	dumpType         int
+	systemTime       int
+	driverEntry      int // sizeof(DUMP_DRIVER_ENTRY)
+	ldrEntry         int // Offset of LdrEntry in DUMP_DRIVER_ENTRY
+	dllBase          int // Offsets within KLDR_DATA_TABLE_ENTRY
+	sizeOfImage      int
+}
+
+var (
+	layout32 = headerLayout{
+		size: header32Size, pointer: 4,
+		bugCheckCode: 0x28, bugCheckParams: 0x2C, exceptionAddress: 0x7DC,
+		dumpType: 0xF88, systemTime: 0xFC0,
+		driverEntry: 0x4C, ldrEntry: 0x04, dllBase: 0x18, sizeOfImage: 0x20,
+	}
+	layout64 = headerLayout{
+		size: header64Size, pointer: 8,
+		bugCheckCode: 0x38, bugCheckParams: 0x40, exceptionAddress: 0xF10,
+		dumpType: 0xF98, systemTime: 0xFA8,
+		driverEntry: 0x90, ldrEntry: 0x08, dllBase: 0x30, sizeOfImage: 0x40,
+	}
+)
+
+// Offsets within TRIAGE_DUMP, the same for both widths.
+const (
+	triageDriverListOffset = 0x30
+	triageDriverCount      = 0x34
+	triageStringPoolOffset = 0x38
+)
+
+// bugCheckNames names common stop codes.
+var bugCheckNames = map[uint32]string{
+	0x0000000A: "IRQL_NOT_LESS_OR_EQUAL",
+	0x0000001E: "KMODE_EXCEPTION_NOT_HANDLED",
+	0x00000050: "PAGE_FAULT_IN_NONPAGED_AREA",
+	0x0000007E: "SYSTEM_THREAD_EXCEPTION_NOT_HANDLED",
+	0x0000007F: "UNEXPECTED_KERNEL_MODE_TRAP",
+	0x0000009F: "DRIVER_POWER_STATE_FAILURE",
+	0x000000C4: "DRIVER_VERIFIER_DETECTED_VIOLATION",
+	0x000000D1: "DRIVER_IRQL_NOT_LESS_OR_EQUAL",
+	0x000000EF: "CRITICAL_PROCESS_DIED",
+	0x00000109: "CRITICAL_STRUCTURE_CORRUPTION",
+	0x00000116: "VIDEO_TDR_FAILURE",
+	0x00000117: "VIDEO_TDR_TIMEOUT_DETECTED",
+	0x00000133: "DPC_WATCHDOG_VIOLATION",
+	0x00000139: "KERNEL_SECURITY_CHECK_FAILURE",
+	0x0000013A: "KERNEL_MODE_HEAP_CORRUPTION",
+	0x00000141: "VIDEO_ENGINE_TIMEOUT_DETECTED",
+	0x00000144: "BUGCODE_USB3_DRIVER",
+	0x0000003B: "SYSTEM_SERVICE_EXCEPTION",
+	0x000001A8: "BUGCODE_WIFIDRIVER",
+}
+
+// DumpDriver is a driver loaded when the dump was written.
+type DumpDriver struct {
+	Name string `json:"name"`
+	Base uint64 `json:"base"`
+	Size uint32 `json:"size"`
+}
+
+// CrashDump is the decoded header of one dump file.
+type CrashDump struct {
+	Path            string              `json:"path"` // Relative to windows/crashdumps
+	Format          string              `json:"format"`
+	DumpType        string              `json:"dump_type,omitempty"`
+	BugCheckCode    string              `json:"bugcheck_code"` // 0x000000D1
+	BugCheckName    string              `json:"bugcheck_name,omitempty"`
+	BugCheckParams  []string            `json:"bugcheck_parameters"`
+	CrashTimeUTC    string              `json:"crash_time_utc,omitempty"`
+	FaultingModule  string              `json:"faulting_module,omitempty"`
+	FaultingAddress string              `json:"faulting_address,omitempty"`
+	FaultSource     string              `json:"fault_source,omitempty"` // Which value fell inside the module, e.g. bugcheck_parameter_4
+	DriverCount     int                 `json:"driver_count,omitempty"`
+	Drivers         []DumpDriver        `json:"-"`
+	DriverInventory *InventoryDriverRef `json:"driver_inventory,omitempty"` // The faulting module's Amcache driver entry
+	Error           string              `json:"error,omitempty"`
+}
+
+// InventoryDriverRef is the windows/amcache driver inventory entry matching
+// a faulting module.
+type InventoryDriverRef struct {
+	Path   string   `json:"path"`
+	SHA1   string   `json:"sha1,omitempty"`
+	Signed *bool    `json:"signed,omitempty"`
+	Flags  []string `json:"flags,omitempty"`
+}
+
+// CrashDumpReport is the structure written to crash_dumps.json.
+type CrashDumpReport struct {
+	CollectedUTC    string      `json:"collected_utc"`
+	Dumps           []CrashDump `json:"dumps"`
+	InventoryRead   bool        `json:"driver_inventory_read"` // windows/amcache driver_inventory.json was available
+	FlaggedFaulting int         `json:"flagged_faulting_drivers"`
+	Findings        []string    `json:"findings"`
+}
+
+// ParseDumpHeader decodes the bug check, crash time, and, for triage dumps,
+// the driver list of a kernel crash dump, and attributes the crash to the
+// driver whose image holds the exception address or a bug check parameter.
+func ParseDumpHeader(r io.ReaderAt, size int64) (*CrashDump, error) {
+	sig := make([]byte, 8)
+	if _, err := r.ReadAt(sig, 0); err != nil {
+		return nil, fmt.Errorf("failed to read dump signature: %w", err)
+	}
+	var layout headerLayout
+	dump := &CrashDump{}
+	switch {
+	case string(sig[:4]) == "MDMP":
+		return nil, fmt.Errorf("user-mode minidump, not a kernel crash dump")
+	case string(sig[:4]) != dumpSignature:
+		return nil, fmt.Errorf("not a crash dump (signature %q)", sig[:4])
+	case string(sig[4:]) == dumpValid64:
+		layout, dump.Format = layout64, "PAGEDU64"
+	case string(sig[4:]) == dumpValid32:
+		layout, dump.Format = layout32, "PAGEDUMP"
+	default:
+		return nil, fmt.Errorf("invalid dump header (signature %q)", sig)
+	}
+	if size < layout.size {
+		return nil, fmt.Errorf("dump is %d bytes, shorter than its %d byte header", size, layout.size)
+	}
+
+	header := make([]byte, layout.size)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read dump header: %w", err)
+	}
+	code := binary.LittleEndian.Uint32(header[layout.bugCheckCode:])
+	dump.BugCheckCode = fmt.Sprintf("0x%08X", code)
+	dump.BugCheckName = bugCheckNames[code]
+	params := make([]uint64, 4)
+	for i := range params {
+		params[i] = readPointer(header, layout.bugCheckParams+i*layout.pointer, layout.pointer)
+		dump.BugCheckParams = append(dump.BugCheckParams, fmt.Sprintf("0x%X", params[i]))
+	}
+	dumpType := binary.LittleEndian.Uint32(header[layout.dumpType:])
+	dump.DumpType = dumpTypes[dumpType]
+	if t := winutil.FiletimeToUTC(binary.LittleEndian.Uint64(header[layout.systemTime:])); !t.IsZero() {
+		dump.CrashTimeUTC = winutil.FormatTime(t)
+	}
+
+	if dumpType != dumpTypeTriage {
+		return dump, nil
+	}
+	drivers, err := readTriageDrivers(r, size, layout)
+	if err != nil {
+		dump.Error = err.Error()
+		return dump, nil
+	}
+	dump.Drivers = drivers
+	dump.DriverCount = len(drivers)
+
+	// The exception address is the most direct; for most driver bug checks
+	// one of the parameters is the faulting code address
+	candidates := []struct {
+		source string
+		addr   uint64
+	}{
+		{"exception_address", readPointer(header, layout.exceptionAddress, layout.pointer)},
+		{"bugcheck_parameter_1", params[0]},
+		{"bugcheck_parameter_2", params[1]},
+		{"bugcheck_parameter_3", params[2]},
+		{"bugcheck_parameter_4", params[3]},
+	}
+	for _, candidate := range candidates {
+		if driver, ok := driverAt(drivers, candidate.addr); ok {
+			dump.FaultingModule = driver.Name
+			dump.FaultingAddress = fmt.Sprintf("0x%X", candidate.addr)
+			dump.FaultSource = candidate.source
+			break
+		}
+	}
+	return dump, nil
+}
+
+// readTriageDrivers reads the driver list of the TRIAGE_DUMP block that
+// follows the header. Its offsets are from the start of the file.
+func readTriageDrivers(r io.ReaderAt, size int64, layout headerLayout) ([]DumpDriver, error) {
+	triage := make([]byte, 0x40)
+	if _, err := r.ReadAt(triage, layout.size); err != nil {
+		return nil, fmt.Errorf("failed to read triage header: %w", err)
+	}
+	listOffset := int64(binary.LittleEndian.Uint32(triage[triageDriverListOffset:]))
+	count := int64(binary.LittleEndian.Uint32(triage[triageDriverCount:]))
+	poolOffset := int64(binary.LittleEndian.Uint32(triage[triageStringPoolOffset:]))
+	if count == 0 {
+		return nil, nil
+	}
+	if count > maxTriageDriver || listOffset < layout.size || listOffset+count*int64(layout.driverEntry) > size || poolOffset >= size {
+		return nil, fmt.Errorf("triage driver list out of range (offset %#x, %d drivers)", listOffset, count)
+	}
+
+	entries := make([]byte, count*int64(layout.driverEntry))
+	if _, err := r.ReadAt(entries, listOffset); err != nil {
+		return nil, fmt.Errorf("failed to read triage driver list: %w", err)
+	}
+	drivers := make([]DumpDriver, 0, count)
+	for i := int64(0); i < count; i++ {
+		entry := entries[i*int64(layout.driverEntry):]
+		ldr := entry[layout.ldrEntry:]
+		name, err := readDumpString(r, size, int64(binary.LittleEndian.Uint32(entry)))
+		if err != nil {
+			return nil, fmt.Errorf("driver %d: %w", i, err)
+		}
+		drivers = append(drivers, DumpDriver{
+			Name: name,
+			Base: readPointer(ldr, layout.dllBase, layout.pointer),
+			Size: binary.LittleEndian.Uint32(ldr[layout.sizeOfImage:]),
+		})
+	}
+	return drivers, nil
+}
+
+// readDumpString reads a DUMP_STRING: a character count and UTF-16 text.
+func readDumpString(r io.ReaderAt, size, offset int64) (string, error) {
+	if offset <= 0 || offset+4 > size {
+		return "", fmt.Errorf("string offset %#x out of range", offset)
+	}
+	lengthBuf := make([]byte, 4)
+	if _, err := r.ReadAt(lengthBuf, offset); err != nil {
+		return "", err
+	}
+	length := int64(binary.LittleEndian.Uint32(lengthBuf))
+	if length > 1024 || offset+4+length*2 > size {
+		return "", fmt.Errorf("string at %#x out of range", offset)
+	}
+	buf := make([]byte, length*2)
+	if _, err := r.ReadAt(buf, offset+4); err != nil {
+		return "", err
+	}
+	units := make([]uint16, length)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(buf[i*2:])
+	}
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00"), nil
+}
+
+// readPointer reads a 4 or 8 byte little-endian value.
+func readPointer(b []byte, offset, width int) uint64 {
+	if width == 4 {
+		return uint64(binary.LittleEndian.Uint32(b[offset:]))
+	}
+	return binary.LittleEndian.Uint64(b[offset:])
+}
+
+// driverAt returns the driver whose image contains addr.
+func driverAt(drivers []DumpDriver, addr uint64) (DumpDriver, bool) {
+	if addr == 0 {
+		return DumpDriver{}, false
+	}
+	for _, driver := range drivers {
+		if driver.Size > 0 && addr >= driver.Base && addr-driver.Base < uint64(driver.Size) {
+			return driver, true
+		}
+	}
+	return DumpDriver{}, false
+}
+
+// inventoryDriver is the part of a windows/amcache driver_inventory.json
+// entry the correlation reads.
+type inventoryDriver struct {
+	Path   string   `json:"path"`
+	Name   string   `json:"name"`
+	SHA1   string   `json:"sha1"`
+	Signed *bool    `json:"signed"`
+	Flags  []string `json:"flags"`
+}
+
+// ReadDriverInventory indexes a driver_inventory.json by lowercased file name.
+func ReadDriverInventory(path string) (map[string]inventoryDriver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var inventory struct {
+		Drivers []inventoryDriver `json:"drivers"`
+	}
+	if err := json.Unmarshal(data, &inventory); err != nil {
+		return nil, fmt.Errorf("failed to parse driver inventory: %w", err)
+	}
+	byName := make(map[string]inventoryDriver, len(inventory.Drivers))
+	for _, driver := range inventory.Drivers {
+		byName[strings.ToLower(baseName(driver.Path))] = driver
+	}
+	return byName, nil
+}
+
+// Correlate attaches the Amcache driver inventory entry of each dump's
+// faulting module and raises a finding for each crash blamed on a driver the
+// inventory flagged, e.g. as unsigned or loaded from outside the driver
+// directories.
+func (r *CrashDumpReport) Correlate(inventory map[string]inventoryDriver) {
+	r.InventoryRead = inventory != nil
+	r.FlaggedFaulting = 0
+	for i := range r.Dumps {
+		dump := &r.Dumps[i]
+		dump.DriverInventory = nil
+		if dump.FaultingModule == "" {
+			continue
+		}
+		driver, ok := inventory[strings.ToLower(baseName(dump.FaultingModule))]
+		if !ok {
+			continue
+		}
+		dump.DriverInventory = &InventoryDriverRef{Path: driver.Path, SHA1: driver.SHA1, Signed: driver.Signed, Flags: driver.Flags}
+		if len(driver.Flags) > 0 {
+			r.FlaggedFaulting++
+			r.Findings = append(r.Findings, fmt.Sprintf("%s: bug check %s blamed on %s, flagged by the driver inventory as %s (%s)",
+				dump.Path, dump.BugCheckCode, dump.FaultingModule, strings.Join(driver.Flags, ", "), driver.Path))
+		}
+	}
+}
+
+// baseName returns the final element of a Windows path.
+func baseName(path string) string {
+	if i := strings.LastIndexAny(path, `\/`); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// BuildCrashDumpReport parses every collected dump listed in the manifest.
+// Dumps that fail to parse are listed with the error.
+func BuildCrashDumpReport(ctx context.Context, crashDir string, manifest *CrashDumpsManifest) *CrashDumpReport {
+	report := &CrashDumpReport{
+		CollectedUTC: winutil.FormatTime(winutil.Now(ctx)),
+		Dumps:        make([]CrashDump, 0),
+		Findings:     make([]string, 0),
+	}
+	for _, item := range manifest.Items {
+		if item.FileType != "crash_dump" {
+			continue
+		}
+		dump, err := parseDumpFile(filepath.Join(crashDir, item.Path))
+		if err != nil {
+			dump = &CrashDump{Error: err.Error()}
+		}
+		dump.Path = filepath.ToSlash(item.Path)
+		report.Dumps = append(report.Dumps, *dump)
+	}
+	sort.Slice(report.Dumps, func(i, j int) bool { return report.Dumps[i].Path < report.Dumps[j].Path })
+	return report
+}
+
+// parseDumpFile opens and parses one dump.
+func parseDumpFile(path string) (*CrashDump, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ParseDumpHeader(file, stat.Size())
+}
+
+// WriteCrashDumps parses the collected dumps into crash_dumps.json,
+// correlated with the driver inventory at inventoryPath when windows/amcache
+// wrote one. A crash_dumps.json already listed in the manifest is replaced.
+func WriteCrashDumps(ctx context.Context, crashDir, inventoryPath string, manifest *CrashDumpsManifest) error {
+	report := BuildCrashDumpReport(ctx, crashDir, manifest)
+	inventory, err := ReadDriverInventory(inventoryPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		manifest.AddError("driver_inventory.json", err.Error())
+	}
+	report.Correlate(inventory)
+
+	outputPath := filepath.Join(crashDir, "crash_dumps.json")
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal crash dumps: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write crash dumps: %w", err)
+	}
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat crash dumps: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash crash dumps: %w", err)
+	}
+	manifest.RemoveItem("crash_dumps.json")
+	manifest.SetDumpsParsed(len(report.Dumps), report.FlaggedFaulting)
+	note := fmt.Sprintf("Crash dump bug checks and faulting modules (%d dumps, %d blamed on flagged drivers)", len(report.Dumps), report.FlaggedFaulting)
+	manifest.AddItem("crash_dumps.json", stat.Size(), sha256Hex, false, stat.ModTime(), "crash_dumps", note)
+	return nil
+}
+
+// AnalyzeCrashDumps rebuilds crash_dumps.json from the dumps in a collected
+// windows/crashdumps directory and the collection's Amcache driver
+// inventory, for the analyze command.
+func AnalyzeCrashDumps(ctx context.Context, moduleDir string) ([]string, error) {
+	crashDir := filepath.Join(moduleDir, "windows", "crashdumps")
+	manifestPath := filepath.Join(crashDir, "manifest.json")
+	manifest, err := LoadCrashDumpsManifest(manifestPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crashdumps manifest: %w", err)
+	}
+	if err := WriteCrashDumps(ctx, crashDir, filepath.Join(filepath.Dir(moduleDir), driverInventoryPath), manifest); err != nil {
+		return nil, err
+	}
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return []string{"windows/crashdumps/crash_dumps.json"}, fmt.Errorf("failed to write crashdumps manifest: %w", err)
+	}
+	return []string{"windows/crashdumps/crash_dumps.json", "windows/crashdumps/manifest.json"}, nil
+}
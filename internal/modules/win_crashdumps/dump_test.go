@@ -0,0 +1,168 @@
+package win_crashdumps
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	ntoskrnlBase = 0xfffff80312000000
+	netfltBase   = 0xfffff80330a40000
+	faultAddress = netfltBase + 0x1234
+)
+
+var crashTime = time.Date(2024, 2, 27, 23, 5, 41, 0, time.UTC)
+
+// triageDump builds a 64-bit minidump as Windows writes it to
+// C:\Windows\Minidump: a PAGEDU64 header with the bug check and exception
+// record, then a TRIAGE_DUMP block pointing at the loaded driver list and
+// the string pool holding the driver names.
+func triageDump(code uint32, params [4]uint64, exceptionAddress uint64) []byte {
+	drivers := []DumpDriver{
+		{Name: "ntoskrnl.exe", Base: ntoskrnlBase, Size: 0x1046000},
+		{Name: "netflt.sys", Base: netfltBase, Size: 0x12000},
+	}
+	layout := layout64
+	data := make([]byte, header64Size+0x40)
+	copy(data, "PAGEDU64")
+	binary.LittleEndian.PutUint32(data[layout.bugCheckCode:], code)
+	for i, param := range params {
+		binary.LittleEndian.PutUint64(data[layout.bugCheckParams+i*8:], param)
+	}
+	binary.LittleEndian.PutUint64(data[layout.exceptionAddress:], exceptionAddress)
+	binary.LittleEndian.PutUint32(data[layout.dumpType:], dumpTypeTriage)
+	binary.LittleEndian.PutUint64(data[layout.systemTime:], uint64(crashTime.Unix()+11644473600)*10000000)
+
+	listOffset := len(data)
+	poolOffset := listOffset + len(drivers)*layout.driverEntry
+	triage := data[header64Size:]
+	binary.LittleEndian.PutUint32(triage[triageDriverListOffset:], uint32(listOffset))
+	binary.LittleEndian.PutUint32(triage[triageDriverCount:], uint32(len(drivers)))
+	binary.LittleEndian.PutUint32(triage[triageStringPoolOffset:], uint32(poolOffset))
+
+	var entries, pool []byte
+	for _, driver := range drivers {
+		entry := make([]byte, layout.driverEntry)
+		binary.LittleEndian.PutUint32(entry, uint32(poolOffset+len(pool)))
+		binary.LittleEndian.PutUint64(entry[layout.ldrEntry+layout.dllBase:], driver.Base)
+		binary.LittleEndian.PutUint32(entry[layout.ldrEntry+layout.sizeOfImage:], driver.Size)
+		entries = append(entries, entry...)
+
+		name := utf16.Encode([]rune(driver.Name + "\x00"))
+		pool = binary.LittleEndian.AppendUint32(pool, uint32(len(name)))
+		for _, u := range name {
+			pool = binary.LittleEndian.AppendUint16(pool, u)
+		}
+	}
+	return append(append(data, entries...), pool...)
+}
+
+func TestParseDumpHeaderBlamesTheFaultingDriver(t *testing.T) {
+	params := [4]uint64{0xffffd3037a1c9010, 2, 0, faultAddress}
+	for _, tt := range []struct {
+		name             string
+		exceptionAddress uint64
+		source           string
+		address          uint64
+	}{
+		{"exception in the driver", netfltBase + 0x80, "exception_address", netfltBase + 0x80},
+		{"exception record empty", 0, "bugcheck_parameter_4", faultAddress},
+	} {
+		data := triageDump(0xD1, params, tt.exceptionAddress)
+		dump, err := ParseDumpHeader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		wantDrivers := []DumpDriver{
+			{Name: "ntoskrnl.exe", Base: ntoskrnlBase, Size: 0x1046000},
+			{Name: "netflt.sys", Base: netfltBase, Size: 0x12000},
+		}
+		want := &CrashDump{
+			Format:          "PAGEDU64",
+			DumpType:        "triage",
+			BugCheckCode:    "0x000000D1",
+			BugCheckName:    "DRIVER_IRQL_NOT_LESS_OR_EQUAL",
+			BugCheckParams:  []string{"0xFFFFD3037A1C9010", "0x2", "0x0", "0xFFFFF80330A41234"},
+			CrashTimeUTC:    "2024-02-27T23:05:41Z",
+			FaultingModule:  "netflt.sys",
+			FaultingAddress: fmt.Sprintf("0x%X", tt.address),
+			FaultSource:     tt.source,
+			DriverCount:     2,
+			Drivers:         wantDrivers,
+		}
+		if !reflect.DeepEqual(dump, want) {
+			t.Errorf("%s: dump = %+v\nwant %+v", tt.name, dump, want)
+		}
+	}
+}
+
+func TestParseDumpHeaderSurvivesTruncation(t *testing.T) {
+	data := triageDump(0x3B, [4]uint64{0xc0000005, faultAddress, 0xffff8a0c4d2f6920, 0}, 0)
+
+	// Every cut either fails cleanly or loses only the driver list
+	for n := 0; n < len(data); n++ {
+		dump, err := ParseDumpHeader(bytes.NewReader(data[:n]), int64(n))
+		switch {
+		case n < header64Size && err == nil:
+			t.Fatalf("dump cut to %d bytes parsed", n)
+		case n >= header64Size && err != nil:
+			t.Fatalf("dump cut to %d bytes: %v", n, err)
+		case n >= header64Size && (dump.BugCheckCode != "0x0000003B" || dump.Error == "" || dump.FaultingModule != ""):
+			t.Fatalf("dump cut to %d bytes = %+v", n, dump)
+		}
+	}
+
+	// A driver count or name offset pointing outside the file
+	corrupt := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(corrupt[header64Size+triageDriverCount:], 0xffffffff)
+	if dump, err := ParseDumpHeader(bytes.NewReader(corrupt), int64(len(corrupt))); err != nil || !strings.Contains(dump.Error, "out of range") {
+		t.Fatalf("huge driver count = %+v, %v", dump, err)
+	}
+	corrupt = append([]byte(nil), data...)
+	listOffset := binary.LittleEndian.Uint32(corrupt[header64Size+triageDriverListOffset:])
+	binary.LittleEndian.PutUint32(corrupt[listOffset:], 0x7ffffff0)
+	if dump, err := ParseDumpHeader(bytes.NewReader(corrupt), int64(len(corrupt))); err != nil || !strings.Contains(dump.Error, "driver 0") {
+		t.Fatalf("driver name out of range = %+v, %v", dump, err)
+	}
+}
+
+func TestParseDumpHeaderRejectsOtherFiles(t *testing.T) {
+	for _, tt := range []struct {
+		data []byte
+		want string
+	}{
+		{[]byte("MDMP\x93\xa7\x00\x00"), "user-mode minidump"},
+		{[]byte("PAGEDUMX"), "invalid dump header"},
+		{[]byte("MZ\x90\x00\x03\x00\x00\x00"), "not a crash dump"},
+		{append([]byte("PAGEDUMP"), make([]byte, 0x100)...), "shorter than its 4096 byte header"},
+	} {
+		if _, err := ParseDumpHeader(bytes.NewReader(tt.data), int64(len(tt.data))); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseDumpHeader(%q) = %v, want %q", tt.data[:8], err, tt.want)
+		}
+	}
+}
+
+func TestCorrelateFlagsCrashesOnFlaggedDrivers(t *testing.T) {
+	signed := false
+	report := &CrashDumpReport{Dumps: []CrashDump{
+		{Path: "Minidump/022724-9046-01.dmp", BugCheckCode: "0x000000D1", FaultingModule: "netflt.sys"},
+		{Path: "Minidump/010324-7125-01.dmp", BugCheckCode: "0x00000116", FaultingModule: "nvlddmkm.sys"},
+	}}
+	report.Correlate(map[string]inventoryDriver{
+		"netflt.sys":   {Path: `c:\programdata\netflt\netflt.sys`, SHA1: "6c2a0bd35f4e1a9d8b7c3e5f2a1d9c8b7e6f5a4d", Signed: &signed, Flags: []string{"unsigned", "nonstandard_path"}},
+		"nvlddmkm.sys": {Path: `c:\windows\system32\driverstore\filerepository\nv_dispi.inf_amd64\nvlddmkm.sys`},
+	})
+	if !report.InventoryRead || report.FlaggedFaulting != 1 || report.Dumps[0].DriverInventory == nil || report.Dumps[1].DriverInventory == nil {
+		t.Fatalf("report = %+v", report)
+	}
+	want := []string{`Minidump/022724-9046-01.dmp: bug check 0x000000D1 blamed on netflt.sys, flagged by the driver inventory as unsigned, nonstandard_path (c:\programdata\netflt\netflt.sys)`}
+	if !reflect.DeepEqual(report.Findings, want) {
+		t.Fatalf("findings = %q", report.Findings)
+	}
+}
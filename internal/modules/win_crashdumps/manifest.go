@@ -0,0 +1,145 @@
+// Package win_crashdumps provides Windows kernel crash dump and LiveKernelReports collection for cryptkeeper.
+package win_crashdumps
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
+)
+
+// CrashDumpItem represents a collected crash dump artifact.
+type CrashDumpItem struct {
+	Path      string `json:"path"`           // Relative path in the archive
+	Size      int64  `json:"size"`           // File size in bytes
+	SHA256    string `json:"sha256"`         // SHA-256 hash
+	Truncated bool   `json:"truncated"`      // Always false: dumps are skipped rather than truncated
+	Note      string `json:"note,omitempty"` // Description of the file
+	Modified  string `json:"modified"`       // File modification time (RFC3339)
+	FileType  string `json:"file_type"`      // Type: "crash_dump", "live_kernel_report", "crash_dumps"
+}
+
+// CrashDumpSkip is a dump left uncollected because it exceeds the size caps.
+type CrashDumpSkip struct {
+	Source string `json:"source"` // Path on the host
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+}
+
+// CrashDumpError represents an error that occurred during collection.
+type CrashDumpError struct {
+	Target string `json:"target"` // What failed (e.g., specific file path)
+	Error  string `json:"error"`  // Error message
+}
+
+// CrashDumpsManifest represents the complete manifest for crash dump collection.
+type CrashDumpsManifest struct {
+	CreatedUTC         string           `json:"created_utc"`
+	Host               string           `json:"host"`
+	CryptkeeperVersion string           `json:"cryptkeeper_version"`
+	Items              []CrashDumpItem  `json:"items"`
+	Skipped            []CrashDumpSkip  `json:"skipped"`
+	Errors             []CrashDumpError `json:"errors"`
+	TotalFiles         int              `json:"total_files"`
+	CollectedFiles     int              `json:"collected_files"`
+	DumpsParsed        int              `json:"dumps_parsed"`
+	FlaggedFaulting    int              `json:"flagged_faulting_drivers"`
+	Summary            schema.Summary   `json:"summary"`
+}
+
+// NewCrashDumpsManifest creates a new crash dump manifest with basic information.
+func NewCrashDumpsManifest(ctx context.Context, hostname string) *CrashDumpsManifest {
+	return &CrashDumpsManifest{
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
+		Host:               hostname,
+		CryptkeeperVersion: "v0.1.0",
+		Items:              make([]CrashDumpItem, 0),
+		Skipped:            make([]CrashDumpSkip, 0),
+		Errors:             make([]CrashDumpError, 0),
+		TotalFiles:         0,
+		CollectedFiles:     0,
+		Summary:            schema.NewSummary(),
+	}
+}
+
+// LoadCrashDumpsManifest reads a manifest written by WriteManifest.
+func LoadCrashDumpsManifest(manifestPath string) (*CrashDumpsManifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var cm CrashDumpsManifest
+	if err := json.Unmarshal(data, &cm); err != nil {
+		return nil, err
+	}
+	if cm.Summary == nil {
+		cm.Summary = schema.NewSummary()
+	}
+	return &cm, nil
+}
+
+// AddItem adds a successfully collected crash dump item to the manifest.
+func (cm *CrashDumpsManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, note string) {
+	cm.Items = append(cm.Items, CrashDumpItem{
+		Path:      path,
+		Size:      size,
+		SHA256:    sha256,
+		Truncated: truncated,
+		Note:      note,
+		Modified:  winutil.FormatTime(modified),
+		FileType:  fileType,
+	})
+	cm.CollectedFiles++
+}
+
+// RemoveItem drops an item, e.g. before a parsed output is rewritten, and
+// reports whether it was listed.
+func (cm *CrashDumpsManifest) RemoveItem(path string) bool {
+	for i, item := range cm.Items {
+		if item.Path == path {
+			cm.Items = append(cm.Items[:i], cm.Items[i+1:]...)
+			cm.CollectedFiles--
+			return true
+		}
+	}
+	return false
+}
+
+// AddSkipped records a dump that was not collected.
+func (cm *CrashDumpsManifest) AddSkipped(source string, size int64, reason string) {
+	cm.Skipped = append(cm.Skipped, CrashDumpSkip{Source: source, Size: size, Reason: reason})
+}
+
+// AddError adds an error to the manifest for a failed collection.
+func (cm *CrashDumpsManifest) AddError(target, errorMsg string) {
+	cm.Errors = append(cm.Errors, CrashDumpError{
+		Target: target,
+		Error:  errorMsg,
+	})
+}
+
+// IncrementTotalFiles increments the count of total files found.
+func (cm *CrashDumpsManifest) IncrementTotalFiles() {
+	cm.TotalFiles++
+}
+
+// SetDumpsParsed sets the number of dumps decoded into crash_dumps.json and
+// how many were blamed on a driver the driver inventory flagged.
+func (cm *CrashDumpsManifest) SetDumpsParsed(count, flagged int) {
+	cm.DumpsParsed = count
+	cm.FlaggedFaulting = flagged
+	cm.Summary.Set(schema.SummaryCrashDumps, count)
+}
+
+// WriteManifest writes the manifest to a JSON file.
+func (cm *CrashDumpsManifest) WriteManifest(manifestPath string) error {
+	data, err := json.MarshalIndent(cm, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath, data, 0644)
+}
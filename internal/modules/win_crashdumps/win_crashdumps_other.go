@@ -0,0 +1,36 @@
+//go:build !windows
+
+package win_crashdumps
+
+import (
+	"context"
+)
+
+// WinCrashDumps represents the kernel crash dump collection module (no-op on non-Windows).
+type WinCrashDumps struct{}
+
+// NewWinCrashDumps creates a new crash dump collection module.
+func NewWinCrashDumps() *WinCrashDumps {
+	return &WinCrashDumps{}
+}
+
+// Name returns the module's identifier.
+func (w *WinCrashDumps) Name() string {
+	return "windows/crashdumps"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinCrashDumps) Describe() string {
+	return "Minidumps, LiveKernelReports, and bug check decoding"
+}
+
+// DependsOn orders the module after windows/amcache.
+func (w *WinCrashDumps) DependsOn() []string {
+	return []string{"windows/amcache"}
+}
+
+// Collect is a no-op on non-Windows systems.
+func (w *WinCrashDumps) Collect(ctx context.Context, outDir string) error {
+	// No-op on non-Windows systems
+	return nil
+}
@@ -0,0 +1,173 @@
+//go:build windows
+
+package win_crashdumps
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// WinCrashDumps represents the kernel crash dump collection module.
+type WinCrashDumps struct{}
+
+// NewWinCrashDumps creates a new crash dump collection module.
+func NewWinCrashDumps() *WinCrashDumps {
+	return &WinCrashDumps{}
+}
+
+// Name returns the module's identifier.
+func (w *WinCrashDumps) Name() string {
+	return "windows/crashdumps"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinCrashDumps) Describe() string {
+	return "Minidumps, LiveKernelReports, and bug check decoding"
+}
+
+// DependsOn orders the module after windows/amcache, whose driver inventory
+// the faulting modules are matched against.
+func (w *WinCrashDumps) DependsOn() []string {
+	return []string{"windows/amcache"}
+}
+
+// Collect copies the minidumps under %WINDIR%\Minidump, everything under
+// %WINDIR%\LiveKernelReports, and %WINDIR%\MEMORY.DMP, parses the dump
+// headers into crash_dumps.json, and creates a manifest. A dump over the
+// size caps is skipped, never truncated, as a partial dump is unreadable.
+func (w *WinCrashDumps) Collect(ctx context.Context, outDir string) error {
+	// Create the windows/crashdumps subdirectory
+	crashDir := filepath.Join(outDir, "windows", "crashdumps")
+	if err := winutil.EnsureDir(crashDir); err != nil {
+		return fmt.Errorf("failed to create crashdumps directory: %w", err)
+	}
+
+	// Get hostname for manifest
+	hostname, err := winutil.Hostname(ctx)
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	manifest := NewCrashDumpsManifest(ctx, hostname)
+	constraints := winutil.NewSizeConstraints(ctx)
+	windowsDir := winutil.SystemRoot()
+
+	minidumpDir := filepath.Join(windowsDir, "Minidump")
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(crashDir, "minidumps", minidumpDir)
+	if entries, err := os.ReadDir(minidumpDir); err == nil {
+		for _, entry := range entries {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".dmp") {
+				continue
+			}
+			w.collectFile(ctx, filepath.Join(minidumpDir, entry.Name()), filepath.Join("Minidump", entry.Name()), "crash_dump", crashDir, manifest, constraints)
+		}
+	} else if !os.IsNotExist(err) {
+		manifest.AddError(minidumpDir, fmt.Sprintf("Failed to read directory: %v", err))
+	}
+
+	reportsDir := filepath.Join(windowsDir, "LiveKernelReports")
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(crashDir, "LiveKernelReports", reportsDir)
+	if err := w.collectLiveKernelReports(ctx, reportsDir, crashDir, manifest, constraints); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		manifest.AddError(reportsDir, err.Error())
+	}
+
+	memoryDump := filepath.Join(windowsDir, "MEMORY.DMP")
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(crashDir, "complete memory dump", memoryDump)
+	if _, err := os.Stat(memoryDump); err == nil {
+		w.collectFile(ctx, memoryDump, "MEMORY.DMP", "crash_dump", crashDir, manifest, constraints)
+	}
+
+	if err := WriteCrashDumps(ctx, crashDir, filepath.Join(filepath.Dir(outDir), driverInventoryPath), manifest); err != nil {
+		manifest.AddError("crash_dumps.json", err.Error())
+	}
+
+	// Write manifest
+	manifestPath := filepath.Join(crashDir, "manifest.json")
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// collectLiveKernelReports copies the LiveKernelReports tree, where Windows
+// writes dumps of recovered kernel failures such as GPU timeouts and
+// watchdog hangs, one directory per report type.
+func (w *WinCrashDumps) collectLiveKernelReports(ctx context.Context, reportsDir, crashDir string, manifest *CrashDumpsManifest, constraints *winutil.SizeConstraints) error {
+	err := filepath.WalkDir(reportsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != reportsDir || !os.IsNotExist(err) {
+				manifest.AddError(path, fmt.Sprintf("Failed to access path: %v", err))
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(reportsDir, path)
+		if err != nil {
+			return nil
+		}
+		fileType := "live_kernel_report"
+		if strings.EqualFold(filepath.Ext(path), ".dmp") {
+			fileType = "crash_dump"
+		}
+		w.collectFile(ctx, path, filepath.Join("LiveKernelReports", rel), fileType, crashDir, manifest, constraints)
+		return nil
+	})
+	return err
+}
+
+// collectFile copies one file whole, or records it as skipped when it does
+// not fit within the size caps.
+func (w *WinCrashDumps) collectFile(ctx context.Context, srcPath, relPath, fileType, crashDir string, manifest *CrashDumpsManifest, constraints *winutil.SizeConstraints) {
+	manifest.IncrementTotalFiles()
+
+	stat, err := os.Stat(srcPath)
+	if err != nil {
+		manifest.AddError(srcPath, fmt.Sprintf("Failed to stat file: %v", err))
+		return
+	}
+	if !constraints.CanCollectFile(stat.Size()) {
+		manifest.AddSkipped(srcPath, stat.Size(), fmt.Sprintf("exceeds the size caps (%d MB per file, %d MB per module); dumps are not truncated", constraints.MaxFileSizeMB, constraints.MaxTotalMB))
+		return
+	}
+
+	destPath := filepath.Join(crashDir, relPath)
+	if err := winutil.EnsureDir(filepath.Dir(destPath)); err != nil {
+		manifest.AddError(srcPath, fmt.Sprintf("Failed to create output directory: %v", err))
+		return
+	}
+	size, sha256Hex, err := winutil.CopyFile(ctx, srcPath, destPath)
+	if err != nil {
+		manifest.AddError(srcPath, fmt.Sprintf("Failed to copy file: %v", err))
+		return
+	}
+	constraints.AddFileSize(size)
+
+	note := fmt.Sprintf("Kernel crash dump from %s", srcPath)
+	if fileType == "live_kernel_report" {
+		note = fmt.Sprintf("LiveKernelReports file from %s", srcPath)
+	}
+	manifest.AddItem(relPath, size, sha256Hex, false, stat.ModTime(), fileType, note)
+}
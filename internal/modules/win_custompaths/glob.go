@@ -0,0 +1,197 @@
+package win_custompaths
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// GlobPattern is a compiled --include-path value. Patterns support `*` and `?`
+// within a path segment and `**` as a whole segment matching zero or more
+// directories. Matching is case-insensitive, as on NTFS.
+type GlobPattern struct {
+	Pattern  string   // The value as supplied by the operator
+	Root     string   // Absolute directory (or file, for literal patterns) to start from
+	Literal  bool     // The pattern contains no wildcards
+	segments []string // Wildcard segments relative to Root
+}
+
+// CompileGlob splits a pattern into its static root and wildcard segments.
+// Relative patterns are resolved against the current working directory.
+func CompileGlob(pattern string) (*GlobPattern, error) {
+	trimmed := strings.TrimSpace(pattern)
+	if trimmed == "" {
+		return nil, fmt.Errorf("empty include pattern")
+	}
+
+	g := &GlobPattern{Pattern: pattern}
+
+	wildcard := strings.IndexAny(trimmed, "*?")
+	if wildcard < 0 {
+		root, err := filepath.Abs(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %q: %w", pattern, err)
+		}
+		g.Root = root
+		g.Literal = true
+		// A literal directory collects everything beneath it
+		g.segments = []string{"**"}
+		return g, nil
+	}
+
+	// The root is everything up to the last separator before the first wildcard
+	cut := strings.LastIndexAny(trimmed[:wildcard], `/\`)
+	var root string
+	switch {
+	case cut < 0:
+		root = "."
+	case cut == 0:
+		root = trimmed[:1]
+	default:
+		root = trimmed[:cut]
+		// Keep drive roots ("C:") anchored to the drive rather than its working directory
+		if strings.HasSuffix(root, ":") {
+			root += trimmed[cut : cut+1]
+		}
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %q: %w", pattern, err)
+	}
+	g.Root = abs
+	g.segments = splitSegments(trimmed[cut+1:])
+
+	for _, seg := range g.segments {
+		if strings.Contains(seg, "**") && seg != "**" {
+			return nil, fmt.Errorf("invalid pattern %q: ** must be a whole path segment", pattern)
+		}
+	}
+
+	return g, nil
+}
+
+// Match reports whether a path relative to Root matches the pattern.
+func (g *GlobPattern) Match(rel string) bool {
+	return matchSegments(g.segments, splitSegments(rel), false)
+}
+
+// CanDescend reports whether any path beneath the directory rel could match,
+// allowing the walker to prune subtrees that cannot produce results.
+func (g *GlobPattern) CanDescend(rel string) bool {
+	return matchSegments(g.segments, splitSegments(rel), true)
+}
+
+// Walk calls match for each regular file beneath Root that matches the
+// pattern, and walkErr for each entry that could not be read.
+func (g *GlobPattern) Walk(ctx context.Context, match func(path string), walkErr func(path string, err error)) error {
+	return winutil.StreamWalk(g.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			walkErr(path, err)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		// Never traverse symlinks or junctions (reported as irregular), which
+		// can loop back to an ancestor and make ** recurse without end
+		if d.Type()&(fs.ModeSymlink|fs.ModeIrregular) != 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(g.Root, path)
+		if err != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			if path != g.Root && !g.CanDescend(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() || !g.Match(rel) {
+			return nil
+		}
+
+		match(path)
+		return nil
+	})
+}
+
+// splitSegments splits a path on both Windows and POSIX separators.
+func splitSegments(path string) []string {
+	if path == "." || path == "" {
+		return nil
+	}
+	return strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+}
+
+// matchSegments matches path segments against pattern segments. With partial
+// set, a path that is exhausted before the pattern counts as a match so that
+// directories on the way to a match are walked.
+func matchSegments(pattern, name []string, partial bool) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if partial {
+				return true
+			}
+			// ** consumes zero or more whole segments
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:], false) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return partial
+		}
+		if !matchSegment(pattern[0], name[0]) {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchSegment matches a single path segment against a pattern containing
+// `*` (any run of characters) and `?` (exactly one character).
+func matchSegment(pattern, name string) bool {
+	p := []rune(strings.ToLower(pattern))
+	n := []rune(strings.ToLower(name))
+
+	pi, ni := 0, 0
+	star, mark := -1, 0
+	for ni < len(n) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == n[ni]):
+			pi++
+			ni++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ni
+			pi++
+		case star >= 0:
+			// Backtrack: let the last * absorb one more character
+			pi = star + 1
+			mark++
+			ni = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
@@ -0,0 +1,209 @@
+package win_custompaths
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		// ** spans zero or more directories
+		{`C:\ProgramData\**\*.ps1`, `run.ps1`, true},
+		{`C:\ProgramData\**\*.ps1`, `Microsoft\Windows\Start Menu\Programs\StartUp\run.ps1`, true},
+		{`C:\ProgramData\**\*.ps1`, `Microsoft\run.ps1.txt`, false},
+		{`C:\ProgramData\**\Tasks\**`, `Microsoft\Tasks\a\b\c.xml`, true},
+		{`C:\ProgramData\**\Tasks\**`, `Microsoft\Task\c.xml`, false},
+		// * stays within one segment
+		{`C:\Users\*\Downloads\*.exe`, `alice\Downloads\setup.exe`, true},
+		{`C:\Users\*\Downloads\*.exe`, `alice\Downloads\nested\setup.exe`, false},
+		{`C:\Users\*\Downloads\*.exe`, `alice\Desktop\Downloads\setup.exe`, false},
+		// ? is exactly one character
+		{`C:\Windows\Temp\tmp?.dat`, `tmp1.dat`, true},
+		{`C:\Windows\Temp\tmp?.dat`, `tmp.dat`, false},
+		{`C:\Windows\Temp\tmp?.dat`, `tmp12.dat`, false},
+		{`C:\Windows\Temp\???.log`, `abc.log`, true},
+		{`C:\Windows\Temp\???.log`, `ab.log`, false},
+		// Matching ignores case and accepts either separator
+		{`C:\Users\*\AppData\Roaming\*.LNK`, `Alice/appdata/roaming/Invoice.lnk`, true},
+		{`C:\Windows\Temp\*.ps1`, `ünïcödé.PS1`, true},
+	}
+	for _, tt := range tests {
+		glob, err := CompileGlob(tt.pattern)
+		if err != nil {
+			t.Fatalf("CompileGlob(%q): %v", tt.pattern, err)
+		}
+		if got := glob.Match(tt.rel); got != tt.want {
+			t.Errorf("%s matching %s = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestCompileGlob(t *testing.T) {
+	glob, err := CompileGlob("/var/log/**/*.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if glob.Root != filepath.Clean("/var/log") || glob.Literal || !reflect.DeepEqual(glob.segments, []string{"**", "*.gz"}) {
+		t.Fatalf("absolute pattern = %+v", glob)
+	}
+
+	// Relative patterns resolve against the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	glob, err = CompileGlob("logs/app?.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if glob.Root != filepath.Join(wd, "logs") {
+		t.Errorf("relative pattern root = %s, want %s", glob.Root, filepath.Join(wd, "logs"))
+	}
+	glob, err = CompileGlob("*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if glob.Root != wd {
+		t.Errorf("bare pattern root = %s, want %s", glob.Root, wd)
+	}
+
+	// A literal path collects everything beneath it
+	glob, err = CompileGlob("/etc/ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !glob.Literal || !glob.Match("sshd_config.d/50-cloud.conf") {
+		t.Errorf("literal pattern = %+v", glob)
+	}
+
+	for _, bad := range []string{"", "   ", `C:\Users\a**b\*.exe`} {
+		if _, err := CompileGlob(bad); err == nil {
+			t.Errorf("CompileGlob(%q) accepted", bad)
+		}
+	}
+}
+
+func TestGlobCanDescendPrunes(t *testing.T) {
+	glob, err := CompileGlob(`C:\Users\*\Downloads\*.exe`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !glob.CanDescend(`alice`) || !glob.CanDescend(`alice\Downloads`) {
+		t.Error("directories on the way to a match were pruned")
+	}
+	if glob.CanDescend(`alice\AppData`) || glob.CanDescend(`alice\Downloads\nested`) {
+		t.Error("directories that cannot match were walked")
+	}
+}
+
+// walkMatches returns the matches of pattern beneath root, relative to root.
+func walkMatches(t *testing.T, root, pattern string) []string {
+	t.Helper()
+	glob, err := CompileGlob(filepath.Join(root, pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var matches []string
+	err = glob.Walk(context.Background(), func(path string) {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches = append(matches, filepath.ToSlash(rel))
+	}, func(path string, err error) {
+		t.Errorf("walk error at %s: %v", path, err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func writeTree(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, name := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGlobWalkRecursesAndMatchesSingleCharacters(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root,
+		"ProgramData/run.ps1",
+		"ProgramData/Microsoft/Windows/Start Menu/StartUp/persist.ps1",
+		"ProgramData/Microsoft/notes.txt",
+		"ProgramData/deep/a/b/c/d/e/payload.PS1",
+		"Windows/Temp/tmp1.dat",
+		"Windows/Temp/tmpA.dat",
+		"Windows/Temp/tmp.dat",
+		"Windows/Temp/tmp10.dat",
+	)
+
+	want := []string{
+		"ProgramData/Microsoft/Windows/Start Menu/StartUp/persist.ps1",
+		"ProgramData/deep/a/b/c/d/e/payload.PS1",
+		"ProgramData/run.ps1",
+	}
+	if got := walkMatches(t, root, filepath.Join("ProgramData", "**", "*.ps1")); !reflect.DeepEqual(got, want) {
+		t.Errorf("** matches = %v, want %v", got, want)
+	}
+	want = []string{"Windows/Temp/tmp1.dat", "Windows/Temp/tmpA.dat"}
+	if got := walkMatches(t, root, filepath.Join("Windows", "Temp", "tmp?.dat")); !reflect.DeepEqual(got, want) {
+		t.Errorf("? matches = %v, want %v", got, want)
+	}
+}
+
+func TestGlobWalkDoesNotFollowLinkCycles(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "Users/alice/AppData/script.ps1")
+	// Links back to an ancestor, as Windows profiles carry junctions such as
+	// "Application Data" pointing at their own parent
+	loop := filepath.Join(root, "Users", "alice", "AppData", "Application Data")
+	if err := os.Symlink(filepath.Join(root, "Users", "alice"), loop); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	// A link to a file outside the tree is not collected either
+	outside := filepath.Join(t.TempDir(), "outside.ps1")
+	writeTree(t, filepath.Dir(outside), filepath.Base(outside))
+	if err := os.Symlink(outside, filepath.Join(root, "Users", "alice", "linked.ps1")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := walkMatches(t, root, filepath.Join("**", "*.ps1"))
+	if want := []string{"Users/alice/AppData/script.ps1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("matches = %v, want %v", got, want)
+	}
+}
+
+func TestGlobWalkStopsWhenCancelled(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/1.txt", "a/2.txt", "b/3.txt")
+	glob, err := CompileGlob(filepath.Join(root, "**"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = glob.Walk(ctx, func(path string) {
+		t.Errorf("matched %s after cancellation", path)
+	}, func(string, error) {})
+	if err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Fatalf("Walk = %v, want a cancellation error", err)
+	}
+}
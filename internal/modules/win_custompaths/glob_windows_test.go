@@ -0,0 +1,29 @@
+//go:build windows
+
+package win_custompaths
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGlobWalkDoesNotFollowJunctionCycles(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, `Users/alice/AppData/Local/Temp/stage.ps1`)
+	// Junctions need no privilege, unlike symlinks
+	junction := filepath.Join(root, "Users", "alice", "AppData", "Local", "Application Data")
+	if out, err := exec.Command("cmd", "/c", "mklink", "/J", junction, filepath.Join(root, "Users", "alice")).CombinedOutput(); err != nil {
+		t.Skipf("cannot create a junction: %v: %s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(junction, "AppData", "Local", "Temp", "stage.ps1")); err != nil {
+		t.Fatalf("junction does not loop back: %v", err)
+	}
+
+	got := walkMatches(t, root, filepath.Join("Users", "**", "*.ps1"))
+	if want := []string{"Users/alice/AppData/Local/Temp/stage.ps1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("matches = %v, want %v", got, want)
+	}
+}
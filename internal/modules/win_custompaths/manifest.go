@@ -0,0 +1,103 @@
+// Package win_custompaths provides operator-specified file and glob collection for cryptkeeper.
+package win_custompaths
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
+)
+
+// CustomPathItem represents a file collected because it matched an --include-path value.
+type CustomPathItem struct {
+	Path      string `json:"path"`      // Relative path in the archive
+	Size      int64  `json:"size"`      // File size in bytes
+	SHA256    string `json:"sha256"`    // SHA-256 hash
+	Truncated bool   `json:"truncated"` // Whether the file was truncated due to size limits
+	Modified  string `json:"modified"`  // File modification time (RFC3339)
+	FileType  string `json:"file_type"` // Type: "custom_file"
+	Source    string `json:"source"`    // Original path on the host
+	Pattern   string `json:"pattern"`   // The --include-path value that matched
+}
+
+// CustomPathError represents an error that occurred during collection.
+type CustomPathError struct {
+	Target string `json:"target"` // What failed (pattern or file path)
+	Error  string `json:"error"`  // Error message
+}
+
+// CustomPathManifest represents the complete manifest for custom path collection.
+type CustomPathManifest struct {
+	CreatedUTC         string            `json:"created_utc"`
+	Host               string            `json:"host"`
+	CryptkeeperVersion string            `json:"cryptkeeper_version"`
+	Patterns           []string          `json:"patterns"`
+	Items              []CustomPathItem  `json:"items"`
+	Errors             []CustomPathError `json:"errors"`
+	TotalFiles         int               `json:"total_files"`
+	CollectedFiles     int               `json:"collected_files"`
+	FilteredFiles      int               `json:"filtered_files"` // Matches skipped by the --since filter
+	Summary            schema.Summary    `json:"summary"`
+}
+
+// NewCustomPathManifest creates a new custom path manifest with basic information.
+func NewCustomPathManifest(ctx context.Context, hostname string, patterns []string) *CustomPathManifest {
+	return &CustomPathManifest{
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
+		Host:               hostname,
+		CryptkeeperVersion: "v0.1.0",
+		Patterns:           patterns,
+		Items:              make([]CustomPathItem, 0),
+		Errors:             make([]CustomPathError, 0),
+		TotalFiles:         0,
+		CollectedFiles:     0,
+		Summary:            schema.NewSummary(),
+	}
+}
+
+// AddItem adds a successfully collected file to the manifest.
+func (cm *CustomPathManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, source, pattern string) {
+	cm.Items = append(cm.Items, CustomPathItem{
+		Path:      path,
+		Size:      size,
+		SHA256:    sha256,
+		Truncated: truncated,
+		Modified:  winutil.FormatTime(modified),
+		FileType:  "custom_file",
+		Source:    source,
+		Pattern:   pattern,
+	})
+	cm.CollectedFiles++
+}
+
+// AddError adds an error to the manifest for a failed collection.
+func (cm *CustomPathManifest) AddError(target, errorMsg string) {
+	cm.Errors = append(cm.Errors, CustomPathError{
+		Target: target,
+		Error:  errorMsg,
+	})
+}
+
+// IncrementTotalFiles increments the count of total files matched.
+func (cm *CustomPathManifest) IncrementTotalFiles() {
+	cm.TotalFiles++
+}
+
+// IncrementFilteredFiles increments the count of matches excluded by the time filter.
+func (cm *CustomPathManifest) IncrementFilteredFiles() {
+	cm.FilteredFiles++
+	cm.Summary.Increment(schema.SummaryFilteredFiles)
+}
+
+// WriteManifest writes the manifest to a JSON file.
+func (cm *CustomPathManifest) WriteManifest(manifestPath string) error {
+	data, err := json.MarshalIndent(cm, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath, data, 0644)
+}
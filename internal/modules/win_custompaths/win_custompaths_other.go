@@ -0,0 +1,36 @@
+//go:build !windows
+
+package win_custompaths
+
+import (
+	"context"
+)
+
+// WinCustomPaths represents the custom path collection module stub for non-Windows platforms.
+type WinCustomPaths struct{}
+
+// NewWinCustomPaths creates a new custom path collection module stub.
+func NewWinCustomPaths(patterns []string) *WinCustomPaths {
+	return &WinCustomPaths{}
+}
+
+// SetSinceTime is a no-op on non-Windows platforms.
+func (w *WinCustomPaths) SetSinceTime(sinceRFC3339 string) {
+	// No-op on non-Windows platforms
+}
+
+// Name returns the module's identifier.
+func (w *WinCustomPaths) Name() string {
+	return "windows/custompaths"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinCustomPaths) Describe() string {
+	return "Operator-specified paths and globs"
+}
+
+// Collect is a no-op on non-Windows platforms and always returns nil.
+func (w *WinCustomPaths) Collect(ctx context.Context, outDir string) error {
+	// This module only works on Windows, so it's a no-op on other platforms
+	return nil
+}
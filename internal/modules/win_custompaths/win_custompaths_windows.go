@@ -0,0 +1,168 @@
+//go:build windows
+
+package win_custompaths
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// WinCustomPaths represents the custom path collection module.
+type WinCustomPaths struct {
+	patterns  []string
+	sinceTime string // RFC3339 timestamp for filtering matches by modification time
+}
+
+// NewWinCustomPaths creates a new custom path collection module for the given
+// --include-path values.
+func NewWinCustomPaths(patterns []string) *WinCustomPaths {
+	return &WinCustomPaths{patterns: patterns}
+}
+
+// SetSinceTime configures the modification-time filter applied to matches.
+func (w *WinCustomPaths) SetSinceTime(sinceRFC3339 string) {
+	w.sinceTime = sinceRFC3339
+}
+
+// Name returns the module's identifier.
+func (w *WinCustomPaths) Name() string {
+	return "windows/custompaths"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinCustomPaths) Describe() string {
+	return "Operator-specified paths and globs"
+}
+
+// Collect copies every file matching the configured include patterns.
+func (w *WinCustomPaths) Collect(ctx context.Context, outDir string) error {
+	// Create the windows/custompaths subdirectory
+	customDir := filepath.Join(outDir, "windows", "custompaths")
+	if err := winutil.EnsureDir(customDir); err != nil {
+		return fmt.Errorf("failed to create custompaths directory: %w", err)
+	}
+
+	// Get hostname for manifest
+	hostname, err := winutil.Hostname(ctx)
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	// Create manifest
+	manifest := NewCustomPathManifest(ctx, hostname, w.patterns)
+	constraints := winutil.NewSizeConstraints(ctx)
+
+	var since time.Time
+	if w.sinceTime != "" {
+		if t, err := time.Parse(time.RFC3339, w.sinceTime); err == nil {
+			since = t
+		}
+	}
+
+	// A file matched by several patterns is collected once, under the first match
+	seen := make(map[string]bool)
+	for _, pattern := range w.patterns {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		glob, err := CompileGlob(pattern)
+		if err != nil {
+			manifest.AddError(pattern, err.Error())
+			continue
+		}
+
+		if err := w.collectPattern(ctx, glob, customDir, since, seen, manifest, constraints); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			manifest.AddError(pattern, err.Error())
+		}
+	}
+
+	// Write manifest
+	manifestPath := filepath.Join(customDir, "manifest.json")
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// collectPattern walks the root of a compiled pattern and copies each match.
+func (w *WinCustomPaths) collectPattern(ctx context.Context, glob *GlobPattern, outDir string, since time.Time, seen map[string]bool, manifest *CustomPathManifest, constraints *winutil.SizeConstraints) error {
+	stat, err := os.Stat(glob.Root)
+	if err != nil {
+		return fmt.Errorf("failed to access %s: %w", glob.Root, err)
+	}
+
+	// A literal file path is collected directly
+	if glob.Literal && !stat.IsDir() {
+		w.collectFile(glob.Root, glob.Pattern, outDir, since, seen, manifest, constraints)
+		return nil
+	}
+
+	return glob.Walk(ctx, func(path string) {
+		w.collectFile(path, glob.Pattern, outDir, since, seen, manifest, constraints)
+	}, func(path string, err error) {
+		manifest.AddError(path, fmt.Sprintf("Failed to read: %v", err))
+	})
+}
+
+// collectFile copies a single matched file, applying the since and size filters.
+func (w *WinCustomPaths) collectFile(path, pattern, outDir string, since time.Time, seen map[string]bool, manifest *CustomPathManifest, constraints *winutil.SizeConstraints) {
+	key := strings.ToLower(path)
+	if seen[key] {
+		return
+	}
+	seen[key] = true
+
+	manifest.IncrementTotalFiles()
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		manifest.AddError(path, fmt.Sprintf("Failed to stat file: %v", err))
+		return
+	}
+	if !since.IsZero() && stat.ModTime().Before(since) {
+		manifest.IncrementFilteredFiles()
+		return
+	}
+
+	relPath := archivePathFor(path)
+	destPath := filepath.Join(outDir, relPath)
+	if err := winutil.EnsureDir(filepath.Dir(destPath)); err != nil {
+		manifest.AddError(path, fmt.Sprintf("Failed to create output directory: %v", err))
+		return
+	}
+
+	size, sha256Hex, truncated, err := winutil.SmartCopy(path, destPath, constraints)
+	if err != nil {
+		manifest.AddError(path, fmt.Sprintf("Failed to copy file: %v", err))
+		return
+	}
+
+	manifest.AddItem(relPath, size, sha256Hex, truncated, stat.ModTime(), path, pattern)
+}
+
+// archivePathFor mirrors a host path under the module directory, replacing the
+// volume (e.g. "C:" or "\\server\share") with a plain directory name.
+func archivePathFor(path string) string {
+	volume := filepath.VolumeName(path)
+	rest := strings.TrimPrefix(path, volume)
+
+	volumeDir := strings.Trim(strings.NewReplacer(":", "", "\\", "_", "/", "_").Replace(volume), "_")
+	if volumeDir == "" {
+		volumeDir = "root"
+	}
+
+	return filepath.Join(volumeDir, rest)
+}
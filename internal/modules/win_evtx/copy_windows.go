@@ -9,6 +9,8 @@ import (
 	"syscall"
 
 	"golang.org/x/sys/windows"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // copyFileWithTolerantSharing copies a file using Windows APIs with generous sharing flags
@@ -58,10 +60,7 @@ func copyFileWithTolerantSharing(srcPath, destPath string) error {
 // getLogFilePath constructs the path to a raw event log file in the Windows logs directory.
 func getLogFilePath(logFileName string) string {
 	// Get the Windows directory (usually C:\Windows)
-	winDir := os.Getenv("SystemRoot")
-	if winDir == "" {
-		winDir = "C:\\Windows" // Fallback
-	}
+	winDir := winutil.SystemRoot()
 	
 	return fmt.Sprintf("%s\\System32\\winevt\\Logs\\%s", winDir, logFileName)
 }
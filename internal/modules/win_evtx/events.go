@@ -0,0 +1,248 @@
+package win_evtx
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// TriageEventIDs are high-value event IDs for a fast first look: logons
+// (4624, 4625), special privileges at logon (4672), process creation (4688),
+// service installation (7045), the Security log being cleared (1102), and
+// PowerShell script blocks (4104).
+var TriageEventIDs = []int{1102, 4104, 4624, 4625, 4672, 4688, 7045}
+
+// ParseEventIDs reads a comma-separated list of event IDs and ranges such as
+// "4624,4625,4688" or "4624-4634". The word "triage" stands for TriageEventIDs.
+func ParseEventIDs(list []string) ([]int, error) {
+	seen := make(map[int]bool)
+	ids := make([]int, 0)
+	add := func(id int) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	var items []string
+	for _, entry := range list {
+		items = append(items, strings.Split(entry, ",")...)
+	}
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.EqualFold(item, "triage") {
+			for _, id := range TriageEventIDs {
+				add(id)
+			}
+			continue
+		}
+		first, last, isRange := strings.Cut(item, "-")
+		low, err := parseEventID(first)
+		if err != nil {
+			return nil, err
+		}
+		high := low
+		if isRange {
+			if high, err = parseEventID(last); err != nil {
+				return nil, err
+			}
+			if high < low {
+				return nil, fmt.Errorf("event ID range %s is reversed", item)
+			}
+		}
+		for id := low; id <= high; id++ {
+			add(id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func parseEventID(s string) (int, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || id < 0 || id > 65535 {
+		return 0, fmt.Errorf("invalid event ID %q: must be 0-65535", s)
+	}
+	return id, nil
+}
+
+// sinceWindowMs returns how many milliseconds before now sinceRFC3339 lies,
+// as the timediff of an event query counts them. It is 0, meaning no limit,
+// when sinceRFC3339 is empty or unparseable, and clamped to 0 when it lies in
+// the future.
+func sinceWindowMs(sinceRFC3339 string, now time.Time) int64 {
+	if sinceRFC3339 == "" {
+		return 0
+	}
+	since, err := time.Parse(time.RFC3339, sinceRFC3339)
+	if err != nil {
+		return 0
+	}
+	sinceMs := now.UTC().Sub(since).Milliseconds()
+	if sinceMs < 0 {
+		sinceMs = 0 // Clamp negative values
+	}
+	return sinceMs
+}
+
+// BuildEventQuery returns the XPath filter that selects the given event IDs,
+// limited to events at most sinceMs milliseconds old when sinceMs is positive.
+// Runs of three or more consecutive IDs are written as a range, keeping long
+// lists within the expression limit of the event log query engine.
+func BuildEventQuery(ids []int, sinceMs int64) string {
+	sorted := append([]int(nil), ids...)
+	sort.Ints(sorted)
+
+	terms := make([]string, 0, len(sorted))
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] <= sorted[j]+1 {
+			j++
+		}
+		if sorted[j]-sorted[i] >= 2 {
+			terms = append(terms, fmt.Sprintf("(EventID >= %d and EventID <= %d)", sorted[i], sorted[j]))
+		} else {
+			for k := i; k <= j; k++ {
+				if k == i || sorted[k] != sorted[k-1] {
+					terms = append(terms, fmt.Sprintf("EventID=%d", sorted[k]))
+				}
+			}
+		}
+		i = j + 1
+	}
+
+	conditions := make([]string, 0, 2)
+	if len(terms) > 0 {
+		conditions = append(conditions, "("+strings.Join(terms, " or ")+")")
+	}
+	if sinceMs > 0 {
+		conditions = append(conditions, fmt.Sprintf("TimeCreated[timediff(@SystemTime) <= %d]", sinceMs))
+	}
+	if len(conditions) == 0 {
+		return "*"
+	}
+	return "*[System[" + strings.Join(conditions, " and ") + "]]"
+}
+
+// TriageEvent is one NDJSON line of a targeted event query.
+type TriageEvent struct {
+	Channel        string            `json:"channel"`
+	EventID        int               `json:"event_id"`
+	Provider       string            `json:"provider"`
+	TimeCreatedUTC string            `json:"time_created_utc"`
+	RecordID       uint64            `json:"record_id"`
+	Level          int               `json:"level"`
+	Computer       string            `json:"computer,omitempty"`
+	UserSID        string            `json:"user_sid,omitempty"`
+	Data           map[string]string `json:"data,omitempty"` // EventData, or the fields of UserData
+}
+
+// renderedEvent mirrors the XML wevtutil qe /f:xml renders for one event.
+type renderedEvent struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		} `xml:"Provider"`
+		EventID     int `xml:"EventID"`
+		Level       int `xml:"Level"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		EventRecordID uint64 `xml:"EventRecordID"`
+		Channel       string `xml:"Channel"`
+		Computer      string `xml:"Computer"`
+		Security      struct {
+			UserID string `xml:"UserID,attr"`
+		} `xml:"Security"`
+	} `xml:"System"`
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"EventData"`
+	UserData struct {
+		Record struct {
+			Fields []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"UserData"`
+}
+
+// triageEvent converts a rendered event; channel is used when the event does
+// not name its own.
+func (e *renderedEvent) triageEvent(channel string) TriageEvent {
+	event := TriageEvent{
+		Channel:  e.System.Channel,
+		EventID:  e.System.EventID,
+		Provider: e.System.Provider.Name,
+		RecordID: e.System.EventRecordID,
+		Level:    e.System.Level,
+		Computer: e.System.Computer,
+		UserSID:  e.System.Security.UserID,
+	}
+	if event.Channel == "" {
+		event.Channel = channel
+	}
+	if created, err := time.Parse(time.RFC3339Nano, e.System.TimeCreated.SystemTime); err == nil {
+		event.TimeCreatedUTC = winutil.FormatTime(created)
+	}
+
+	data := make(map[string]string)
+	for i, d := range e.EventData.Data {
+		name := d.Name
+		if name == "" {
+			name = fmt.Sprintf("data_%d", i+1)
+		}
+		data[name] = strings.TrimSpace(d.Value)
+	}
+	for _, field := range e.UserData.Record.Fields {
+		data[field.XMLName.Local] = strings.TrimSpace(field.Value)
+	}
+	if len(data) > 0 {
+		event.Data = data
+	}
+	return event
+}
+
+// WriteTriageEvents converts the concatenated <Event> elements printed by
+// wevtutil qe /f:xml into one JSON object per line on w and returns how many
+// events were written.
+func WriteTriageEvents(rendered []byte, channel string, w io.Writer) (int, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(rendered))
+	encoder := json.NewEncoder(w)
+	count := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to parse rendered events: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Event" {
+			continue
+		}
+		var event renderedEvent
+		if err := decoder.DecodeElement(&event, &start); err != nil {
+			return count, fmt.Errorf("failed to parse rendered event: %w", err)
+		}
+		if err := encoder.Encode(event.triageEvent(channel)); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
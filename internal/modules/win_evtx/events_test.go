@@ -0,0 +1,150 @@
+package win_evtx
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEventIDs(t *testing.T) {
+	ids, err := ParseEventIDs([]string{" 4688", "triage", "4624-4627", "", "7045"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1102, 4104, 4624, 4625, 4626, 4627, 4672, 4688, 7045}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+
+	for _, tt := range []struct {
+		list []string
+		want string
+	}{
+		{[]string{"4625-4624"}, "is reversed"},
+		{[]string{"logon"}, `invalid event ID "logon"`},
+		{[]string{"65536"}, "must be 0-65535"},
+		{[]string{"4624-"}, `invalid event ID ""`},
+	} {
+		if _, err := ParseEventIDs(tt.list); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseEventIDs(%q) = %v, want %q", tt.list, err, tt.want)
+		}
+	}
+}
+
+func TestBuildEventQuery(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		ids     []int
+		sinceMs int64
+		want    string
+	}{
+		{"one ID", []int{1102}, 0, "*[System[(EventID=1102)]]"},
+		{"unsorted with duplicates", []int{4688, 4624, 4688, 4625}, 0,
+			"*[System[(EventID=4624 or EventID=4625 or EventID=4688)]]"},
+		{"runs of three become ranges", []int{4627, 4624, 4626, 4625, 7045, 4634, 4635}, 0,
+			"*[System[((EventID >= 4624 and EventID <= 4627) or EventID=4634 or EventID=4635 or EventID=7045)]]"},
+		{"since window", []int{4624, 4625}, 86400000, "*[System[(EventID=4624 or EventID=4625) and TimeCreated[timediff(@SystemTime) <= 86400000]]]"},
+		{"since window only", nil, 3600000, "*[System[TimeCreated[timediff(@SystemTime) <= 3600000]]]"},
+		{"no filter", nil, 0, "*"},
+	} {
+		if got := BuildEventQuery(tt.ids, tt.sinceMs); got != tt.want {
+			t.Errorf("%s: BuildEventQuery(%v, %d) =\n%s\nwant\n%s", tt.name, tt.ids, tt.sinceMs, got, tt.want)
+		}
+	}
+
+	// The caller's list is left as it was
+	ids := []int{4688, 4624}
+	BuildEventQuery(ids, 0)
+	if !reflect.DeepEqual(ids, []int{4688, 4624}) {
+		t.Errorf("BuildEventQuery sorted its input: %v", ids)
+	}
+}
+
+func TestSinceWindowMs(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	for _, tt := range []struct {
+		since string
+		want  int64
+	}{
+		{"2024-03-01T10:00:00Z", 3600000},
+		{"2024-02-29T11:00:00Z", 86400000},
+		{"2024-03-01T12:30:00+01:00", 0},
+		{"2024-03-02T00:00:00Z", 0},
+		{"", 0},
+		{"yesterday", 0},
+	} {
+		if got := sinceWindowMs(tt.since, now); got != tt.want {
+			t.Errorf("sinceWindowMs(%q) = %d, want %d", tt.since, got, tt.want)
+		}
+	}
+
+	// The window and the IDs end up in the one query run per channel
+	ids, err := ParseEventIDs([]string{"4624,4625", "1102"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "*[System[(EventID=1102 or EventID=4624 or EventID=4625) and TimeCreated[timediff(@SystemTime) <= 7200000]]]"
+	if got := BuildEventQuery(ids, sinceWindowMs("2024-03-01T09:00:00Z", now)); got != want {
+		t.Fatalf("query = %s", got)
+	}
+}
+
+func TestWriteTriageEvents(t *testing.T) {
+	const rendered = `<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'><System>` +
+		`<Provider Name='Microsoft-Windows-Security-Auditing'/><EventID>4624</EventID><Level>0</Level>` +
+		`<TimeCreated SystemTime='2024-03-01T10:15:30.1234567Z'/><EventRecordID>90211</EventRecordID>` +
+		`<Channel>Security</Channel><Computer>WS-0142.corp.example</Computer><Security/></System>` +
+		`<EventData><Data Name='TargetUserName'>alice</Data><Data Name='LogonType'>10</Data><Data>extra</Data></EventData></Event>` +
+		"\r\n" +
+		`<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'><System>` +
+		`<Provider Name='Microsoft-Windows-Eventlog'/><EventID>1102</EventID><Level>4</Level>` +
+		`<TimeCreated SystemTime='2024-03-01T10:20:00Z'/><EventRecordID>90212</EventRecordID>` +
+		`<Security UserID='S-1-5-21-1004336348-1177238915-682003330-1001'/></System>` +
+		`<UserData><LogFileCleared xmlns='http://manifests.microsoft.com/win/2004/08/windows/eventlog'>` +
+		`<SubjectUserName>alice</SubjectUserName></LogFileCleared></UserData></Event>`
+
+	var out bytes.Buffer
+	count, err := WriteTriageEvents([]byte(rendered), "Security", &out)
+	if err != nil || count != 2 {
+		t.Fatalf("WriteTriageEvents = %d, %v", count, err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("output = %q", out.String())
+	}
+	var events []TriageEvent
+	for _, line := range lines {
+		var event TriageEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	want := []TriageEvent{
+		{
+			Channel: "Security", EventID: 4624, Provider: "Microsoft-Windows-Security-Auditing",
+			TimeCreatedUTC: "2024-03-01T10:15:30Z", RecordID: 90211, Computer: "WS-0142.corp.example",
+			Data: map[string]string{"TargetUserName": "alice", "LogonType": "10", "data_3": "extra"},
+		},
+		{
+			Channel: "Security", EventID: 1102, Provider: "Microsoft-Windows-Eventlog",
+			TimeCreatedUTC: "2024-03-01T10:20:00Z", RecordID: 90212, Level: 4,
+			UserSID: "S-1-5-21-1004336348-1177238915-682003330-1001",
+			Data:    map[string]string{"SubjectUserName": "alice"},
+		},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("events =\n%+v\nwant\n%+v", events, want)
+	}
+
+	// No matching events is an empty file, not an error
+	out.Reset()
+	if count, err := WriteTriageEvents(nil, "Security", &out); err != nil || count != 0 || out.Len() != 0 {
+		t.Fatalf("no events = %d, %v, %q", count, err, out.String())
+	}
+	if _, err := WriteTriageEvents([]byte("<Event><System><EventID>4624"), "Security", &out); err == nil {
+		t.Fatal("truncated output accepted")
+	}
+}
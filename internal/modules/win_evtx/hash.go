@@ -2,15 +2,19 @@
 package win_evtx
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // ComputeFileSHA256 calculates the SHA-256 hash of a file using streaming I/O.
-// Returns the hex-encoded hash string and the file size in bytes.
-func ComputeFileSHA256(filePath string) (hash string, size int64, err error) {
+// Returns the hex-encoded hash string (empty when hashing is disabled) and the
+// file size in bytes.
+func ComputeFileSHA256(ctx context.Context, filePath string) (hash string, size int64, err error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return "", 0, fmt.Errorf("failed to open file for hashing: %w", err)
@@ -24,6 +28,11 @@ func ComputeFileSHA256(filePath string) (hash string, size int64, err error) {
 	}
 	size = stat.Size()
 
+	// Only the size is reported when hashing is disabled for the run
+	if !winutil.HashingEnabled(ctx) {
+		return "", size, nil
+	}
+
 	// Create SHA-256 hasher
 	hasher := sha256.New()
 
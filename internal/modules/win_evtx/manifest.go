@@ -2,9 +2,11 @@
 package win_evtx
 
 import (
+	"context"
 	"encoding/json"
 	"os"
-	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // ChannelFile represents information about an exported event log channel.
@@ -13,6 +15,7 @@ type ChannelFile struct {
 	File    string `json:"file"`
 	Size    int64  `json:"size"`
 	SHA256  string `json:"sha256"`
+	Events  *int   `json:"events,omitempty"` // Events written, for NDJSON from a targeted query
 }
 
 // Manifest represents the metadata for collected Windows Event Logs.
@@ -21,15 +24,21 @@ type Manifest struct {
 	CreatedUTC         string        `json:"created_utc"`
 	Host               string        `json:"host"`
 	CryptkeeperVersion string        `json:"cryptkeeper_version"`
+	EventIDs           []int         `json:"event_ids,omitempty"`   // Set in targeted mode (--evtx-event-ids)
+	EventQuery         string        `json:"event_query,omitempty"` // XPath filter of the targeted queries
 }
 
 // WriteManifest creates and writes the manifest.json file with channel metadata.
-func WriteManifest(manifestPath string, channelFiles []ChannelFile, hostname string) error {
+// eventIDs and eventQuery describe a targeted collection and are empty for
+// whole-log exports.
+func WriteManifest(ctx context.Context, manifestPath string, channelFiles []ChannelFile, hostname string, eventIDs []int, eventQuery string) error {
 	manifest := Manifest{
 		ChannelFiles:       channelFiles,
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
+		EventIDs:           eventIDs,
+		EventQuery:         eventQuery,
 	}
 
 	// Marshal to JSON with pretty formatting
@@ -19,11 +19,21 @@ func (w *WinEvtx) SetSinceTime(sinceRFC3339 string) {
 	// No-op on non-Windows platforms
 }
 
+// SetEventIDs is a no-op on non-Windows platforms.
+func (w *WinEvtx) SetEventIDs(ids []int) {
+	// No-op on non-Windows platforms
+}
+
 // Name returns the module's identifier.
 func (w *WinEvtx) Name() string {
 	return "windows/evtx"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinEvtx) Describe() string {
+	return "Windows Event Logs collection"
+}
+
 // Collect is a no-op on non-Windows platforms and always returns nil.
 func (w *WinEvtx) Collect(ctx context.Context, outDir string) error {
 	// This module only works on Windows, so it's a no-op on other platforms
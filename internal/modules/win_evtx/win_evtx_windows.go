@@ -6,15 +6,16 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // WinEvtx represents the Windows Event Log collection module.
 type WinEvtx struct {
 	sinceTime string // RFC3339 timestamp for filtering (optional)
+	eventIDs  []int  // Query only these event IDs instead of exporting whole logs
 }
 
 // NewWinEvtx creates a new Windows Event Log collection module.
@@ -27,11 +28,23 @@ func (w *WinEvtx) SetSinceTime(sinceRFC3339 string) {
 	w.sinceTime = sinceRFC3339
 }
 
+// SetEventIDs switches the module to targeted mode: each channel is queried
+// for these event IDs within the since window and written as NDJSON instead
+// of being exported whole. An empty list keeps whole-log export.
+func (w *WinEvtx) SetEventIDs(ids []int) {
+	w.eventIDs = ids
+}
+
 // Name returns the module's identifier.
 func (w *WinEvtx) Name() string {
 	return "windows/evtx"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinEvtx) Describe() string {
+	return "Windows Event Logs collection"
+}
+
 // ChannelInfo represents information about an event log channel to collect.
 type ChannelInfo struct {
 	Channel  string
@@ -54,7 +67,7 @@ func (w *WinEvtx) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
@@ -63,16 +76,12 @@ func (w *WinEvtx) Collect(ctx context.Context, outDir string) error {
 	var errors []string
 
 	// Calculate since time in milliseconds if provided
-	sinceMs := int64(0)
-	if w.sinceTime != "" {
-		if since, err := time.Parse(time.RFC3339, w.sinceTime); err == nil {
-			now := time.Now().UTC()
-			duration := now.Sub(since)
-			sinceMs = duration.Milliseconds()
-			if sinceMs < 0 {
-				sinceMs = 0 // Clamp negative values
-			}
-		}
+	sinceMs := sinceWindowMs(w.sinceTime, winutil.Now(ctx))
+
+	// Targeted queries run wevtutil against the live logs; images are exported whole
+	var eventQuery string
+	if len(w.eventIDs) > 0 && !winutil.IsOffline() {
+		eventQuery = BuildEventQuery(w.eventIDs, sinceMs)
 	}
 
 	// Process each channel
@@ -83,6 +92,16 @@ func (w *WinEvtx) Collect(ctx context.Context, outDir string) error {
 		default:
 		}
 
+		if eventQuery != "" {
+			channelFile, err := w.queryChannel(ctx, channel, evtxDir, eventQuery)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("%s: %v", channel.Channel, err))
+				continue
+			}
+			channelFiles = append(channelFiles, channelFile)
+			continue
+		}
+
 		outputPath := filepath.Join(evtxDir, channel.FileName)
 		
 		// Try to export the channel
@@ -99,7 +118,7 @@ func (w *WinEvtx) Collect(ctx context.Context, outDir string) error {
 
 		// Check if file exists and compute hash
 		if _, err := os.Stat(outputPath); err == nil {
-			hash, size, hashErr := ComputeFileSHA256(outputPath)
+			hash, size, hashErr := ComputeFileSHA256(ctx, outputPath)
 			if hashErr != nil {
 				errors = append(errors, fmt.Sprintf("%s: failed to hash file: %v", channel.Channel, hashErr))
 				continue
@@ -118,7 +137,11 @@ func (w *WinEvtx) Collect(ctx context.Context, outDir string) error {
 
 	// Write manifest
 	manifestPath := filepath.Join(evtxDir, "manifest.json")
-	if err := WriteManifest(manifestPath, channelFiles, hostname); err != nil {
+	var eventIDs []int
+	if eventQuery != "" {
+		eventIDs = w.eventIDs
+	}
+	if err := WriteManifest(ctx, manifestPath, channelFiles, hostname, eventIDs, eventQuery); err != nil {
 		errors = append(errors, fmt.Sprintf("manifest: %v", err))
 	}
 
@@ -132,6 +155,11 @@ func (w *WinEvtx) Collect(ctx context.Context, outDir string) error {
 
 // exportChannel uses wevtutil.exe to export an event log channel.
 func (w *WinEvtx) exportChannel(ctx context.Context, channel, outputPath string, sinceMs int64) error {
+	// wevtutil reads the running system's logs; images fall back to copying the .evtx files
+	if winutil.IsOffline() {
+		return winutil.ErrRequiresLiveSystem
+	}
+
 	args := []string{"epl", channel, outputPath, "/ow:true"}
 	
 	// Add time filter if specified
@@ -140,10 +168,9 @@ func (w *WinEvtx) exportChannel(ctx context.Context, channel, outputPath string,
 		args = append(args, "/q:"+query)
 	}
 
-	cmd := exec.CommandContext(ctx, "wevtutil", args...)
-	
 	// Capture stderr for error reporting
-	output, err := cmd.CombinedOutput()
+	stdout, stderr, err := winutil.ExecWithContext(ctx, "wevtutil", args...)
+	output := append(stdout, stderr...)
 	if err != nil {
 		// Check for common access denied errors
 		outputStr := string(output)
@@ -158,6 +185,41 @@ func (w *WinEvtx) exportChannel(ctx context.Context, channel, outputPath string,
 	return nil
 }
 
+// queryChannel runs the targeted query against one channel and writes the
+// matching events as NDJSON next to where the exported log would go.
+func (w *WinEvtx) queryChannel(ctx context.Context, channel ChannelInfo, evtxDir, eventQuery string) (ChannelFile, error) {
+	stdout, stderr, err := winutil.ExecWithContext(ctx, "wevtutil", "qe", channel.Channel, "/q:"+eventQuery, "/f:xml")
+	if err != nil {
+		outputStr := string(stderr)
+		if strings.Contains(outputStr, "Access is denied") ||
+			strings.Contains(outputStr, "access denied") ||
+			strings.Contains(outputStr, "0x5") {
+			return ChannelFile{}, getElevationRequiredError(channel.Channel)
+		}
+		return ChannelFile{}, fmt.Errorf("wevtutil qe failed: %w (output: %s)", err, outputStr)
+	}
+
+	fileName := strings.TrimSuffix(channel.FileName, ".evtx") + ".ndjson"
+	outputPath := filepath.Join(evtxDir, fileName)
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return ChannelFile{}, fmt.Errorf("failed to create %s: %w", fileName, err)
+	}
+	events, writeErr := WriteTriageEvents(stdout, channel.Channel, file)
+	if err := file.Close(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if writeErr != nil {
+		return ChannelFile{}, writeErr
+	}
+
+	hash, size, err := ComputeFileSHA256(ctx, outputPath)
+	if err != nil {
+		return ChannelFile{}, fmt.Errorf("failed to hash file: %w", err)
+	}
+	return ChannelFile{Channel: channel.Channel, File: fileName, Size: size, SHA256: hash, Events: &events}, nil
+}
+
 // fallbackCopy attempts to copy the raw event log file directly.
 func (w *WinEvtx) fallbackCopy(channel, outputPath string) error {
 	sourcePath, exists := getChannelLogFilePath(channel)
@@ -2,9 +2,13 @@
 package win_fileshares
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
 )
 
 // FileShareItem represents a collected file share-related file.
@@ -34,12 +38,13 @@ type FileShareManifest struct {
 	TotalFiles         int              `json:"total_files"`
 	CollectedFiles     int              `json:"collected_files"`
 	SharesFound        int              `json:"shares_found"`
+	Summary            schema.Summary   `json:"summary"`
 }
 
 // NewFileShareManifest creates a new file share manifest with basic information.
-func NewFileShareManifest(hostname string) *FileShareManifest {
+func NewFileShareManifest(ctx context.Context, hostname string) *FileShareManifest {
 	return &FileShareManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]FileShareItem, 0),
@@ -47,6 +52,7 @@ func NewFileShareManifest(hostname string) *FileShareManifest {
 		TotalFiles:         0,
 		CollectedFiles:     0,
 		SharesFound:        0,
+		Summary:            schema.NewSummary(),
 	}
 }
 
@@ -58,7 +64,7 @@ func (fsm *FileShareManifest) AddItem(path string, size int64, sha256 string, tr
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	fsm.CollectedFiles++
@@ -80,6 +86,7 @@ func (fsm *FileShareManifest) IncrementTotalFiles() {
 // SetSharesFound sets the number of shares found.
 func (fsm *FileShareManifest) SetSharesFound(count int) {
 	fsm.SharesFound = count
+	fsm.Summary.Set(schema.SummaryShares, count)
 }
 
 // WriteManifest writes the manifest to a JSON file.
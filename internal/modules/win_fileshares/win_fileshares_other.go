@@ -19,6 +19,16 @@ func (w *WinFileShares) Name() string {
 	return "windows/fileshares"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinFileShares) Describe() string {
+	return "File shares and permissions"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinFileShares) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinFileShares) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
@@ -25,6 +25,16 @@ func (w *WinFileShares) Name() string {
 	return "windows/fileshares"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinFileShares) Describe() string {
+	return "File shares and permissions"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinFileShares) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers Windows file shares and permissions information.
 func (w *WinFileShares) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/fileshares subdirectory
@@ -34,13 +44,13 @@ func (w *WinFileShares) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewFileShareManifest(hostname)
+	manifest := NewFileShareManifest(ctx, hostname)
 
 	// Collect file shares information
 	if err := w.collectFileShares(ctx, sharesDir, manifest); err != nil {
@@ -115,7 +125,7 @@ func (w *WinFileShares) collectFileShares(ctx context.Context, outDir string, ma
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("file_shares.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "shares_info", "Windows file shares configuration and details")
 			manifest.IncrementTotalFiles()
 		}
@@ -185,7 +195,7 @@ func (w *WinFileShares) collectSharePermissions(ctx context.Context, outDir stri
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("share_permissions.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "permissions", "Share permissions and security descriptors")
 			manifest.IncrementTotalFiles()
 		}
@@ -258,7 +268,7 @@ func (w *WinFileShares) collectActiveSessions(ctx context.Context, outDir string
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("active_sessions.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "sessions", "Active SMB sessions and open files information")
 			manifest.IncrementTotalFiles()
 		}
@@ -0,0 +1,396 @@
+package win_firewall_net
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// Registry keys holding Defender exclusions, locally configured and from Group Policy.
+const (
+	defenderExclusionsKey       = `HKLM\SOFTWARE\Microsoft\Windows Defender\Exclusions`
+	defenderPolicyExclusionsKey = `HKLM\SOFTWARE\Policies\Microsoft\Windows Defender\Exclusions`
+)
+
+// defenderExclusionKeys lists the keys queried recursively for security_exclusions.json.
+var defenderExclusionKeys = []string{defenderExclusionsKey, defenderPolicyExclusionsKey}
+
+// exclusionSubkeyKinds maps the subkeys under Exclusions to exclusion kinds.
+var exclusionSubkeyKinds = map[string]string{
+	"paths":          "path",
+	"temporarypaths": "path",
+	"processes":      "process",
+	"extensions":     "extension",
+	"ipaddresses":    "ip_address",
+}
+
+// userWritableMarkers are path fragments of locations any user (or malware
+// running as one) can write to. Paths are compared lowercased.
+var userWritableMarkers = []string{
+	`\users\`,
+	`\appdata\`,
+	`\temp\`,
+	`\tmp\`,
+	`\downloads\`,
+	`\programdata\`,
+	`\$recycle.bin\`,
+	`%temp%`,
+	`%tmp%`,
+	`%appdata%`,
+	`%localappdata%`,
+	`%userprofile%`,
+	`%public%`,
+	`%programdata%`,
+}
+
+// broadExclusionPaths are directories whose exclusion disables scanning of
+// most of the system. Drive roots and bare wildcards are handled separately.
+var broadExclusionPaths = []string{
+	`\windows`,
+	`\windows\system32`,
+	`\windows\syswow64`,
+	`\users`,
+	`\program files`,
+	`\program files (x86)`,
+	`\programdata`,
+	`%systemroot%`,
+	`%windir%`,
+	`%systemdrive%`,
+	`%programfiles%`,
+	`%programdata%`,
+}
+
+// executableExtensions are file extensions whose exclusion lets payloads run unscanned.
+var executableExtensions = map[string]bool{
+	"exe": true, "dll": true, "sys": true, "scr": true, "com": true, "ps1": true,
+	"psm1": true, "bat": true, "cmd": true, "vbs": true, "js": true, "jse": true,
+	"hta": true, "msi": true, "lnk": true, "wsf": true, "cpl": true,
+}
+
+// SecurityExclusion is a single Defender exclusion from Get-MpPreference or the registry.
+type SecurityExclusion struct {
+	Source string   `json:"source"` // "mppreference", "registry", or "policy"
+	Kind   string   `json:"kind"`   // "path", "process", "extension", or "ip_address"
+	Value  string   `json:"value"`
+	Flags  []string `json:"flags,omitempty"` // "broad_path", "user_writable", "executable_extension"
+}
+
+// FirewallAllowRule is an enabled allow rule parsed from netsh advfirewall output.
+type FirewallAllowRule struct {
+	Name      string   `json:"name"`
+	Direction string   `json:"direction"`
+	Profiles  string   `json:"profiles"`
+	Protocol  string   `json:"protocol"`
+	LocalPort string   `json:"local_port"`
+	RemoteIP  string   `json:"remote_ip"`
+	Program   string   `json:"program"`
+	Flags     []string `json:"flags,omitempty"` // "user_writable_program", "allow_all_inbound"
+}
+
+// SecurityExclusions is the structure written to security_exclusions.json.
+type SecurityExclusions struct {
+	CollectedUTC       string              `json:"collected_utc"`
+	Exclusions         []SecurityExclusion `json:"exclusions"`
+	FirewallAllowRules []FirewallAllowRule `json:"firewall_allow_rules"`
+	Findings           []string            `json:"findings"`
+	RegistryKeys       []winutil.RegKey    `json:"registry_keys"`
+	Errors             []string            `json:"errors,omitempty"`
+}
+
+// mpPreferenceExclusions mirrors the exclusion properties of Get-MpPreference.
+// ConvertTo-Json renders a single-element list as a bare string and an empty
+// one as null, so each field is decoded leniently.
+type mpPreferenceExclusions struct {
+	ExclusionPath      json.RawMessage
+	ExclusionProcess   json.RawMessage
+	ExclusionExtension json.RawMessage
+	ExclusionIpAddress json.RawMessage
+}
+
+// ParseMpPreferenceExclusions parses `Get-MpPreference | Select-Object Exclusion* | ConvertTo-Json`.
+// Entries Defender masks for non-administrators ("N/A: Must be an administrator...")
+// are dropped.
+func ParseMpPreferenceExclusions(data []byte) ([]SecurityExclusion, error) {
+	var prefs []mpPreferenceExclusions
+	if err := unmarshalPowerShellJSON(data, &prefs); err != nil {
+		return nil, err
+	}
+
+	exclusions := make([]SecurityExclusion, 0)
+	for _, pref := range prefs {
+		fields := []struct {
+			kind string
+			raw  json.RawMessage
+		}{
+			{"path", pref.ExclusionPath},
+			{"process", pref.ExclusionProcess},
+			{"extension", pref.ExclusionExtension},
+			{"ip_address", pref.ExclusionIpAddress},
+		}
+		for _, field := range fields {
+			for _, value := range stringList(field.raw) {
+				if strings.HasPrefix(value, "N/A") {
+					continue
+				}
+				exclusions = append(exclusions, newExclusion("mppreference", field.kind, value))
+			}
+		}
+	}
+
+	return exclusions, nil
+}
+
+// ParseRegistryExclusions extracts exclusions from `reg query <Exclusions> /s`
+// output. Each excluded item is a value name under Paths, Processes,
+// Extensions, IpAddresses, or TemporaryPaths.
+func ParseRegistryExclusions(keys []winutil.RegKey) []SecurityExclusion {
+	exclusions := make([]SecurityExclusion, 0)
+	for _, key := range keys {
+		path := normalizeRegPath(key.Path)
+		parent, subkey := path, ""
+		if i := strings.LastIndex(path, `\`); i >= 0 {
+			parent, subkey = path[:i], path[i+1:]
+		}
+		kind, ok := exclusionSubkeyKinds[subkey]
+		if !ok || !strings.HasSuffix(parent, `\windows defender\exclusions`) {
+			continue
+		}
+
+		source := "registry"
+		if strings.Contains(parent, `\policies\`) {
+			source = "policy"
+		}
+		for _, value := range key.Values {
+			if value.Name == "" || value.Name == "(Default)" {
+				continue
+			}
+			exclusions = append(exclusions, newExclusion(source, kind, value.Name))
+		}
+	}
+
+	return exclusions
+}
+
+// ParseFirewallAllowRules parses `netsh advfirewall firewall show rule name=all verbose`
+// output and keeps only enabled rules whose action is Allow.
+func ParseFirewallAllowRules(output []byte) []FirewallAllowRule {
+	rules := make([]FirewallAllowRule, 0)
+	var current *FirewallAllowRule
+	enabled, allow := false, false
+
+	flush := func() {
+		if current != nil && enabled && allow {
+			current.Flags = flagFirewallRule(*current)
+			rules = append(rules, *current)
+		}
+		current = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		field, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		if field == "rule name" {
+			flush()
+			current = &FirewallAllowRule{Name: value}
+			enabled, allow = false, false
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch field {
+		case "enabled":
+			enabled = strings.EqualFold(value, "Yes")
+		case "action":
+			allow = strings.EqualFold(value, "Allow")
+		case "direction":
+			current.Direction = value
+		case "profiles":
+			current.Profiles = value
+		case "protocol":
+			current.Protocol = value
+		case "localport":
+			current.LocalPort = value
+		case "remoteip":
+			current.RemoteIP = value
+		case "program":
+			current.Program = value
+		}
+	}
+	flush()
+
+	return rules
+}
+
+// BuildSecurityExclusions combines the exclusion sources and allow rules and
+// derives findings from their flags.
+func BuildSecurityExclusions(mpExclusions, regExclusions []SecurityExclusion, keys []winutil.RegKey, rules []FirewallAllowRule) *SecurityExclusions {
+	result := &SecurityExclusions{
+		Exclusions:         make([]SecurityExclusion, 0, len(mpExclusions)+len(regExclusions)),
+		FirewallAllowRules: rules,
+		Findings:           make([]string, 0),
+		RegistryKeys:       keys,
+	}
+	if result.FirewallAllowRules == nil {
+		result.FirewallAllowRules = make([]FirewallAllowRule, 0)
+	}
+	if result.RegistryKeys == nil {
+		result.RegistryKeys = make([]winutil.RegKey, 0)
+	}
+	result.Exclusions = append(result.Exclusions, mpExclusions...)
+	result.Exclusions = append(result.Exclusions, regExclusions...)
+
+	// The same exclusion usually appears in both Get-MpPreference and the
+	// registry; report it once
+	seen := make(map[string]bool)
+	for _, exclusion := range result.Exclusions {
+		for _, flag := range exclusion.Flags {
+			id := flag + "\x00" + exclusion.Kind + "\x00" + strings.ToLower(exclusion.Value)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			result.Findings = append(result.Findings, fmt.Sprintf("%s: Defender %s exclusion %q", flag, exclusion.Kind, exclusion.Value))
+		}
+	}
+	for _, rule := range result.FirewallAllowRules {
+		for _, flag := range rule.Flags {
+			switch flag {
+			case "user_writable_program":
+				result.Findings = append(result.Findings, fmt.Sprintf("%s: firewall rule %q allows %s", flag, rule.Name, rule.Program))
+			case "allow_all_inbound":
+				result.Findings = append(result.Findings, fmt.Sprintf("%s: firewall rule %q allows any inbound traffic", flag, rule.Name))
+			}
+		}
+	}
+
+	return result
+}
+
+// newExclusion builds an exclusion with its flags set.
+func newExclusion(source, kind, value string) SecurityExclusion {
+	return SecurityExclusion{
+		Source: source,
+		Kind:   kind,
+		Value:  value,
+		Flags:  flagExclusion(kind, value),
+	}
+}
+
+// flagExclusion returns the risk flags for an exclusion.
+func flagExclusion(kind, value string) []string {
+	var flags []string
+	switch kind {
+	case "path", "process":
+		if kind == "path" && isBroadPath(value) {
+			flags = append(flags, "broad_path")
+		}
+		if isUserWritablePath(value) {
+			flags = append(flags, "user_writable")
+		}
+	case "extension":
+		ext := strings.ToLower(strings.TrimLeft(strings.TrimSpace(value), "*."))
+		if executableExtensions[ext] {
+			flags = append(flags, "executable_extension")
+		}
+	}
+	return flags
+}
+
+// flagFirewallRule returns the risk flags for an allow rule.
+func flagFirewallRule(rule FirewallAllowRule) []string {
+	var flags []string
+	if program := rule.Program; program != "" && !strings.EqualFold(program, "Any") && isUserWritablePath(program) {
+		flags = append(flags, "user_writable_program")
+	}
+	if strings.EqualFold(rule.Direction, "In") &&
+		isAny(rule.Program) && isAny(rule.LocalPort) && isAny(rule.RemoteIP) && isAny(rule.Protocol) {
+		flags = append(flags, "allow_all_inbound")
+	}
+	return flags
+}
+
+// isBroadPath reports whether a path exclusion covers a drive root, an entire
+// system directory, or everything.
+func isBroadPath(value string) bool {
+	path := strings.ToLower(strings.TrimRight(strings.TrimSpace(value), `\/*`))
+	if path == "" {
+		return true
+	}
+	if len(path) == 2 && path[1] == ':' {
+		return true
+	}
+	if len(path) > 2 && path[1] == ':' {
+		path = path[2:]
+	}
+	for _, broad := range broadExclusionPaths {
+		if path == broad {
+			return true
+		}
+	}
+	return false
+}
+
+// isUserWritablePath reports whether a path lies in a user-writable or temp location.
+func isUserWritablePath(value string) bool {
+	path := strings.ToLower(strings.ReplaceAll(value, "/", `\`)) + `\`
+	for _, marker := range userWritableMarkers {
+		if strings.Contains(path, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAny reports whether a netsh field value matches everything.
+func isAny(value string) bool {
+	return value == "" || strings.EqualFold(value, "Any")
+}
+
+// stringList decodes a PowerShell JSON value that may be null, a string, or a list of strings.
+func stringList(raw json.RawMessage) []string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil && single != "" {
+		return []string{single}
+	}
+	return nil
+}
+
+// normalizeRegPath lowercases a key path and abbreviates the hive name.
+func normalizeRegPath(path string) string {
+	lower := strings.ToLower(strings.TrimSpace(path))
+	return strings.Replace(lower, "hkey_local_machine", "hklm", 1)
+}
+
+// unmarshalPowerShellJSON decodes ConvertTo-Json output, which renders a
+// single result as a bare object rather than a one-element array.
+func unmarshalPowerShellJSON(data []byte, v interface{}) error {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] == '{' {
+		data = append(append([]byte("["), data...), ']')
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,123 @@
+package win_firewall_net
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// sampleMpPreference is Get-MpPreference exclusion output from a host where
+// an attacker excluded their staging directory. A single process exclusion is
+// rendered as a bare string and the masked IP list as a one-element list.
+const sampleMpPreference = `{"ExclusionPath":["C:\\Users\\alice\\AppData\\Local\\Temp\\stage","C:\\","D:\\SQLData"],"ExclusionProcess":"%APPDATA%\\updater.exe","ExclusionExtension":[".ps1","ldf"],"ExclusionIpAddress":["N/A: Must be an administrator to view exclusions"]}`
+
+// sampleExclusionsHive is `reg query ... /s` output for the Defender exclusion
+// keys of the SOFTWARE hive, with the same path set locally and by policy.
+const sampleExclusionsHive = `
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows Defender\Exclusions
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows Defender\Exclusions\Extensions
+    (Default)    REG_SZ
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows Defender\Exclusions\Paths
+    C:\Users\alice\AppData\Local\Temp\stage    REG_DWORD    0x0
+    C:\Windows    REG_DWORD    0x0
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows Defender\Exclusions\Processes
+    sqlservr.exe    REG_DWORD    0x0
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows Defender\Exclusions\TemporaryPaths
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows Defender\Scan
+    AvgCPULoadFactor    REG_DWORD    0x32
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Microsoft\Windows Defender\Exclusions\Paths
+    c:\users\alice\appdata\local\temp\stage    REG_SZ    0
+`
+
+func TestParseMpPreferenceExclusions(t *testing.T) {
+	exclusions, err := ParseMpPreferenceExclusions([]byte("\xef\xbb\xbf" + sampleMpPreference + "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SecurityExclusion{
+		{Source: "mppreference", Kind: "path", Value: `C:\Users\alice\AppData\Local\Temp\stage`, Flags: []string{"user_writable"}},
+		{Source: "mppreference", Kind: "path", Value: `C:\`, Flags: []string{"broad_path"}},
+		{Source: "mppreference", Kind: "path", Value: `D:\SQLData`},
+		{Source: "mppreference", Kind: "process", Value: `%APPDATA%\updater.exe`, Flags: []string{"user_writable"}},
+		{Source: "mppreference", Kind: "extension", Value: ".ps1", Flags: []string{"executable_extension"}},
+		{Source: "mppreference", Kind: "extension", Value: "ldf"},
+	}
+	if !reflect.DeepEqual(exclusions, want) {
+		t.Fatalf("exclusions = %+v\nwant %+v", exclusions, want)
+	}
+
+	// A host without exclusions reports nulls
+	exclusions, err = ParseMpPreferenceExclusions([]byte(`{"ExclusionPath":null,"ExclusionProcess":null,"ExclusionExtension":null,"ExclusionIpAddress":null}`))
+	if err != nil || len(exclusions) != 0 {
+		t.Fatalf("empty preferences = %+v, %v", exclusions, err)
+	}
+	if _, err := ParseMpPreferenceExclusions([]byte("Get-MpPreference : The term is not recognized")); err == nil {
+		t.Error("error text parsed as preferences")
+	}
+}
+
+func TestParseRegistryExclusions(t *testing.T) {
+	keys := winutil.ParseRegQuery([]byte(strings.ReplaceAll(sampleExclusionsHive, "\n", "\r\n")))
+	exclusions := ParseRegistryExclusions(keys)
+	want := []SecurityExclusion{
+		{Source: "registry", Kind: "path", Value: `C:\Users\alice\AppData\Local\Temp\stage`, Flags: []string{"user_writable"}},
+		{Source: "registry", Kind: "path", Value: `C:\Windows`, Flags: []string{"broad_path"}},
+		{Source: "registry", Kind: "process", Value: "sqlservr.exe"},
+		{Source: "policy", Kind: "path", Value: `c:\users\alice\appdata\local\temp\stage`, Flags: []string{"user_writable"}},
+	}
+	if !reflect.DeepEqual(exclusions, want) {
+		t.Fatalf("exclusions = %+v\nwant %+v", exclusions, want)
+	}
+
+	mpExclusions, err := ParseMpPreferenceExclusions([]byte(sampleMpPreference))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := BuildSecurityExclusions(mpExclusions, exclusions, keys, nil)
+	if len(result.Exclusions) != len(mpExclusions)+len(exclusions) || len(result.FirewallAllowRules) != 0 {
+		t.Fatalf("result = %+v", result)
+	}
+
+	// The staging directory appears in all three sources but is reported once
+	wantFindings := []string{
+		`user_writable: Defender path exclusion "C:\\Users\\alice\\AppData\\Local\\Temp\\stage"`,
+		`broad_path: Defender path exclusion "C:\\"`,
+		`user_writable: Defender process exclusion "%APPDATA%\\updater.exe"`,
+		`executable_extension: Defender extension exclusion ".ps1"`,
+		`broad_path: Defender path exclusion "C:\\Windows"`,
+	}
+	if !reflect.DeepEqual(result.Findings, wantFindings) {
+		t.Errorf("findings = %q\nwant %q", result.Findings, wantFindings)
+	}
+}
+
+func TestFlagExclusionPaths(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{`*`, []string{"broad_path"}},
+		{`C:\*`, []string{"broad_path"}},
+		{`E:`, []string{"broad_path"}},
+		{`C:\Program Files (x86)\`, []string{"broad_path"}},
+		{`%SystemRoot%`, []string{"broad_path"}},
+		{`C:\ProgramData`, []string{"broad_path", "user_writable"}},
+		{`C:\Users\Public\Downloads\tool.exe`, []string{"user_writable"}},
+		{`C:/Windows/Temp`, []string{"user_writable"}},
+		{`%LOCALAPPDATA%\Packages`, []string{"user_writable"}},
+		{`C:\Program Files\Veeam\Backup`, nil},
+	}
+	for _, tt := range tests {
+		if got := flagExclusion("path", tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("flagExclusion(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -2,9 +2,12 @@
 package win_firewall_net
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // FirewallNetItem represents a collected firewall or network file.
@@ -15,7 +18,7 @@ type FirewallNetItem struct {
 	Truncated bool   `json:"truncated"` // Whether the file was truncated due to size limits
 	Note      string `json:"note,omitempty"` // Description of the file
 	Modified  string `json:"modified"`  // File modification time (RFC3339)
-	FileType  string `json:"file_type"` // Type: "firewall_log", "network_info"
+	FileType  string `json:"file_type"` // Type: "firewall_log", "network_info", "security_exclusions"
 }
 
 // FirewallNetError represents an error that occurred during collection.
@@ -36,9 +39,9 @@ type FirewallNetManifest struct {
 }
 
 // NewFirewallNetManifest creates a new firewall/network manifest with basic information.
-func NewFirewallNetManifest(hostname string) *FirewallNetManifest {
+func NewFirewallNetManifest(ctx context.Context, hostname string) *FirewallNetManifest {
 	return &FirewallNetManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]FirewallNetItem, 0),
@@ -56,7 +59,7 @@ func (fm *FirewallNetManifest) AddItem(path string, size int64, sha256 string, t
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	fm.CollectedFiles++
@@ -19,6 +19,11 @@ func (w *WinFirewallNet) Name() string {
 	return "windows/firewall_net"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinFirewallNet) Describe() string {
+	return "Windows Firewall and network config"
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinFirewallNet) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
@@ -4,6 +4,7 @@ package win_firewall_net
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -25,6 +26,11 @@ func (w *WinFirewallNet) Name() string {
 	return "windows/firewall_net"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinFirewallNet) Describe() string {
+	return "Windows Firewall and network config"
+}
+
 // Collect copies Windows firewall logs and network configuration.
 func (w *WinFirewallNet) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/firewall_net subdirectory
@@ -34,26 +40,19 @@ func (w *WinFirewallNet) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewFirewallNetManifest(hostname)
+	manifest := NewFirewallNetManifest(ctx, hostname)
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Get SystemRoot path (usually C:\Windows)
-	systemRoot := os.Getenv("SystemRoot")
-	if systemRoot == "" {
-		systemDrive := os.Getenv("SystemDrive")
-		if systemDrive == "" {
-			systemDrive = "C:"
-		}
-		systemRoot = filepath.Join(systemDrive, "Windows")
-	}
+	systemRoot := winutil.SystemRoot()
 
 	// Collect Windows Firewall logs
 	firewallLogDir := filepath.Join(systemRoot, "System32", "LogFiles", "Firewall")
@@ -66,6 +65,11 @@ func (w *WinFirewallNet) Collect(ctx context.Context, outDir string) error {
 		manifest.AddError("network_info", fmt.Sprintf("Failed to collect network info: %v", err))
 	}
 
+	// Collect Defender exclusions and firewall allow rules
+	if err := w.collectSecurityExclusions(ctx, firewallDir, manifest); err != nil {
+		manifest.AddError("security_exclusions", fmt.Sprintf("Failed to collect security exclusions: %v", err))
+	}
+
 	// Write manifest
 	manifestPath := filepath.Join(firewallDir, "manifest.json")
 	if err := manifest.WriteManifest(manifestPath); err != nil {
@@ -174,7 +178,7 @@ func (w *WinFirewallNet) collectIPConfig(ctx context.Context, outDir string, man
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash ipconfig output: %w", err)
 	}
@@ -208,7 +212,7 @@ func (w *WinFirewallNet) collectRouteTable(ctx context.Context, outDir string, m
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash route output: %w", err)
 	}
@@ -219,6 +223,63 @@ func (w *WinFirewallNet) collectRouteTable(ctx context.Context, outDir string, m
 	return nil
 }
 
+// mpPreferenceScript selects the Defender exclusion lists from Get-MpPreference.
+const mpPreferenceScript = `Get-MpPreference | Select-Object ExclusionPath,ExclusionProcess,ExclusionExtension,ExclusionIpAddress | ConvertTo-Json -Compress`
+
+// collectSecurityExclusions gathers Defender exclusions from Get-MpPreference and
+// the registry, plus enabled firewall allow rules, into security_exclusions.json.
+func (w *WinFirewallNet) collectSecurityExclusions(ctx context.Context, outDir string, manifest *FirewallNetManifest) error {
+	outputPath := filepath.Join(outDir, "security_exclusions.json")
+	var errors []string
+
+	var mpExclusions []SecurityExclusion
+	if output, err := winutil.RunCommandWithOutput(ctx, "powershell", []string{"-NoProfile", "-Command", mpPreferenceScript}); err != nil {
+		errors = append(errors, fmt.Sprintf("Get-MpPreference: %v", err))
+	} else if mpExclusions, err = ParseMpPreferenceExclusions(output); err != nil {
+		errors = append(errors, fmt.Sprintf("Get-MpPreference: %v", err))
+	}
+
+	keys := make([]winutil.RegKey, 0)
+	for _, key := range defenderExclusionKeys {
+		result, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", key, "/s"})
+		if err != nil {
+			// The policy key is absent unless exclusions are pushed by GPO
+			continue
+		}
+		keys = append(keys, winutil.ParseRegQuery(result)...)
+	}
+
+	var rules []FirewallAllowRule
+	if result, err := winutil.RunCommandWithOutput(ctx, "netsh", []string{"advfirewall", "firewall", "show", "rule", "name=all", "verbose"}); err == nil {
+		rules = ParseFirewallAllowRules(result)
+	} else {
+		errors = append(errors, fmt.Sprintf("firewall rules: %v", err))
+	}
+
+	exclusions := BuildSecurityExclusions(mpExclusions, ParseRegistryExclusions(keys), keys, rules)
+	exclusions.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+	exclusions.Errors = errors
+
+	data, err := json.MarshalIndent(exclusions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal security exclusions: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write security exclusions: %w", err)
+	}
+
+	// Add to manifest
+	if stat, err := os.Stat(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
+			manifest.IncrementTotalFiles()
+			note := fmt.Sprintf("Defender exclusions and firewall allow rules (%d findings)", len(exclusions.Findings))
+			manifest.AddItem("security_exclusions.json", stat.Size(), sha256Hex, false, stat.ModTime(), "security_exclusions", note)
+		}
+	}
+
+	return nil
+}
+
 // isFirewallLogFile determines if a file is a Windows Firewall log file.
 func (w *WinFirewallNet) isFirewallLogFile(filename string) bool {
 	lowerFilename := strings.ToLower(filename)
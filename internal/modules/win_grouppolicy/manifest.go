@@ -0,0 +1,129 @@
+// Package win_grouppolicy provides Windows Group Policy artifact collection for cryptkeeper.
+package win_grouppolicy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
+)
+
+// GroupPolicyItem represents a collected Group Policy artifact file.
+type GroupPolicyItem struct {
+	Path      string `json:"path"`             // Relative path in the archive
+	Size      int64  `json:"size"`             // File size in bytes
+	SHA256    string `json:"sha256"`           // SHA-256 hash
+	Truncated bool   `json:"truncated"`        // Whether the file was truncated due to size limits
+	Note      string `json:"note,omitempty"`   // Description of the file
+	Modified  string `json:"modified"`         // File modification time (RFC3339)
+	FileType  string `json:"file_type"`        // Type: "registry_pol", "gpo_settings"
+	Source    string `json:"source,omitempty"` // Original path on the host
+}
+
+// GroupPolicyError represents an error that occurred during collection.
+type GroupPolicyError struct {
+	Target string `json:"target"` // What failed (e.g., specific Registry.pol path)
+	Error  string `json:"error"`  // Error message
+}
+
+// GroupPolicyManifest represents the complete manifest for Group Policy collection.
+type GroupPolicyManifest struct {
+	CreatedUTC         string             `json:"created_utc"`
+	Host               string             `json:"host"`
+	CryptkeeperVersion string             `json:"cryptkeeper_version"`
+	Items              []GroupPolicyItem  `json:"items"`
+	Errors             []GroupPolicyError `json:"errors"`
+	TotalFiles         int                `json:"total_files"`
+	CollectedFiles     int                `json:"collected_files"`
+	PolicyFindings     int                `json:"policy_findings"`
+	Summary            schema.Summary     `json:"summary"`
+}
+
+// NewGroupPolicyManifest creates a new Group Policy manifest with basic information.
+func NewGroupPolicyManifest(ctx context.Context, hostname string) *GroupPolicyManifest {
+	return &GroupPolicyManifest{
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
+		Host:               hostname,
+		CryptkeeperVersion: "v0.1.0",
+		Items:              make([]GroupPolicyItem, 0),
+		Errors:             make([]GroupPolicyError, 0),
+		TotalFiles:         0,
+		CollectedFiles:     0,
+		Summary:            schema.NewSummary(),
+	}
+}
+
+// AddItem adds a successfully collected Group Policy item to the manifest.
+func (gm *GroupPolicyManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, source, note string) {
+	gm.Items = append(gm.Items, GroupPolicyItem{
+		Path:      path,
+		Size:      size,
+		SHA256:    sha256,
+		Truncated: truncated,
+		Note:      note,
+		Modified:  winutil.FormatTime(modified),
+		FileType:  fileType,
+		Source:    source,
+	})
+	gm.CollectedFiles++
+}
+
+// RemoveItem drops every item recorded under path, so a file that is
+// regenerated is listed once. It reports whether any item was removed.
+func (gm *GroupPolicyManifest) RemoveItem(path string) bool {
+	items := gm.Items[:0]
+	for _, item := range gm.Items {
+		if item.Path != path {
+			items = append(items, item)
+		}
+	}
+	removed := len(gm.Items) - len(items)
+	gm.Items = items
+	gm.CollectedFiles -= removed
+	return removed > 0
+}
+
+// AddError adds an error to the manifest for a failed collection.
+func (gm *GroupPolicyManifest) AddError(target, errorMsg string) {
+	gm.Errors = append(gm.Errors, GroupPolicyError{
+		Target: target,
+		Error:  errorMsg,
+	})
+}
+
+// IncrementTotalFiles increments the count of total files found.
+func (gm *GroupPolicyManifest) IncrementTotalFiles() {
+	gm.TotalFiles++
+}
+
+// SetPolicyFindings sets the number of security-weakening policies detected.
+func (gm *GroupPolicyManifest) SetPolicyFindings(count int) {
+	gm.PolicyFindings = count
+	gm.Summary.Set(schema.SummaryPolicyFindings, count)
+}
+
+// WriteManifest writes the manifest to a JSON file.
+func (gm *GroupPolicyManifest) WriteManifest(manifestPath string) error {
+	data, err := json.MarshalIndent(gm, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath, data, 0644)
+}
+
+// LoadGroupPolicyManifest reads a manifest written by WriteManifest.
+func LoadGroupPolicyManifest(manifestPath string) (*GroupPolicyManifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var gm GroupPolicyManifest
+	if err := json.Unmarshal(data, &gm); err != nil {
+		return nil, err
+	}
+	return &gm, nil
+}
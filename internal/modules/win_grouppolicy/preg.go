@@ -0,0 +1,231 @@
+package win_grouppolicy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// pregSignature is the header of a Registry.pol file: "PReg" followed by version 1.
+var pregSignature = []byte{'P', 'R', 'e', 'g', 0x01, 0x00, 0x00, 0x00}
+
+// Registry value types used in PReg records.
+const (
+	regSZ       = 1
+	regExpandSZ = 2
+	regBinary   = 3
+	regDWORD    = 4
+	regMultiSZ  = 7
+	regQWORD    = 11
+)
+
+// PolicySetting represents one decoded [key;value;type;size;data] record.
+type PolicySetting struct {
+	Key       string      `json:"key"`
+	ValueName string      `json:"value_name"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data,omitempty"`
+	Deletion  bool        `json:"deletion,omitempty"` // **Del./**DelVals. markers remove values
+	Finding   string      `json:"finding,omitempty"`  // Security-weakening policy description
+}
+
+// ParseRegistryPol decodes the binary PReg format used by Registry.pol files.
+func ParseRegistryPol(data []byte) ([]PolicySetting, error) {
+	if len(data) < len(pregSignature) || !bytes.Equal(data[:len(pregSignature)], pregSignature) {
+		return nil, fmt.Errorf("invalid PReg header")
+	}
+
+	settings := make([]PolicySetting, 0)
+	pos := len(pregSignature)
+	for pos < len(data) {
+		if pos+2 > len(data) {
+			return settings, fmt.Errorf("truncated record at offset %d", pos)
+		}
+		if binary.LittleEndian.Uint16(data[pos:]) != '[' {
+			return settings, fmt.Errorf("expected '[' at offset %d", pos)
+		}
+		pos += 2
+
+		key, next, err := readPolString(data, pos)
+		if err != nil {
+			return settings, err
+		}
+		if pos, err = expectSemicolon(data, next); err != nil {
+			return settings, err
+		}
+
+		valueName, next, err := readPolString(data, pos)
+		if err != nil {
+			return settings, err
+		}
+		if pos, err = expectSemicolon(data, next); err != nil {
+			return settings, err
+		}
+
+		if pos+4 > len(data) {
+			return settings, fmt.Errorf("truncated type at offset %d", pos)
+		}
+		valueType := binary.LittleEndian.Uint32(data[pos:])
+		if pos, err = expectSemicolon(data, pos+4); err != nil {
+			return settings, err
+		}
+
+		if pos+4 > len(data) {
+			return settings, fmt.Errorf("truncated size at offset %d", pos)
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		if pos, err = expectSemicolon(data, pos+4); err != nil {
+			return settings, err
+		}
+
+		if size < 0 || pos+size > len(data) {
+			return settings, fmt.Errorf("value data overruns file at offset %d", pos)
+		}
+		raw := data[pos : pos+size]
+		pos += size
+
+		if pos+2 > len(data) || binary.LittleEndian.Uint16(data[pos:]) != ']' {
+			return settings, fmt.Errorf("expected ']' at offset %d", pos)
+		}
+		pos += 2
+
+		setting := PolicySetting{
+			Key:       key,
+			ValueName: valueName,
+			Type:      regTypeName(valueType),
+			Data:      decodeRegData(valueType, raw),
+			Deletion:  strings.HasPrefix(strings.ToLower(valueName), "**del"), // Written as **del. and **delvals. in practice
+		}
+		setting.Finding = classifySetting(setting)
+		settings = append(settings, setting)
+	}
+
+	return settings, nil
+}
+
+// readPolString reads a NUL-terminated UTF-16LE string starting at pos.
+func readPolString(data []byte, pos int) (string, int, error) {
+	var units []uint16
+	for {
+		if pos+2 > len(data) {
+			return "", pos, fmt.Errorf("unterminated string at offset %d", pos)
+		}
+		u := binary.LittleEndian.Uint16(data[pos:])
+		pos += 2
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units)), pos, nil
+}
+
+// expectSemicolon consumes a UTF-16LE ';' delimiter.
+func expectSemicolon(data []byte, pos int) (int, error) {
+	if pos+2 > len(data) || binary.LittleEndian.Uint16(data[pos:]) != ';' {
+		return pos, fmt.Errorf("expected ';' at offset %d", pos)
+	}
+	return pos + 2, nil
+}
+
+// regTypeName returns the conventional name of a registry value type.
+func regTypeName(t uint32) string {
+	switch t {
+	case regSZ:
+		return "REG_SZ"
+	case regExpandSZ:
+		return "REG_EXPAND_SZ"
+	case regBinary:
+		return "REG_BINARY"
+	case regDWORD:
+		return "REG_DWORD"
+	case regMultiSZ:
+		return "REG_MULTI_SZ"
+	case regQWORD:
+		return "REG_QWORD"
+	case 0:
+		return "REG_NONE"
+	default:
+		return fmt.Sprintf("REG_TYPE_%d", t)
+	}
+}
+
+// decodeRegData converts raw value bytes into a JSON-friendly representation.
+func decodeRegData(t uint32, raw []byte) interface{} {
+	switch t {
+	case regSZ, regExpandSZ:
+		return utf16ToString(raw)
+	case regMultiSZ:
+		parts := strings.Split(utf16ToString(raw), "\x00")
+		values := make([]string, 0, len(parts))
+		for _, p := range parts {
+			if p != "" {
+				values = append(values, p)
+			}
+		}
+		return values
+	case regDWORD:
+		if len(raw) >= 4 {
+			return binary.LittleEndian.Uint32(raw)
+		}
+	case regQWORD:
+		if len(raw) >= 8 {
+			return binary.LittleEndian.Uint64(raw)
+		}
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return hex.EncodeToString(raw)
+}
+
+// utf16ToString decodes UTF-16LE bytes, dropping a trailing NUL terminator.
+func utf16ToString(raw []byte) string {
+	units := make([]uint16, 0, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		units = append(units, binary.LittleEndian.Uint16(raw[i:]))
+	}
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
+
+// weakeningRule describes a policy value that disables a security control.
+type weakeningRule struct {
+	keyContains string
+	valueName   string
+	badValue    uint32
+	finding     string
+}
+
+// weakeningRules lists policies that disable Defender, auditing, or UAC.
+var weakeningRules = []weakeningRule{
+	{`policies\microsoft\windows defender`, "DisableAntiSpyware", 1, "Microsoft Defender disabled by policy"},
+	{`policies\microsoft\windows defender`, "DisableAntiVirus", 1, "Microsoft Defender antivirus disabled by policy"},
+	{`windows defender\real-time protection`, "DisableRealtimeMonitoring", 1, "Defender real-time protection disabled"},
+	{`windows defender\real-time protection`, "DisableBehaviorMonitoring", 1, "Defender behavior monitoring disabled"},
+	{`windows defender\real-time protection`, "DisableIOAVProtection", 1, "Defender download scanning disabled"},
+	{`windows defender\spynet`, "SpynetReporting", 0, "Defender cloud protection disabled"},
+	{`currentversion\policies\system`, "EnableLUA", 0, "User Account Control disabled"},
+	{`currentversion\policies\system`, "ConsentPromptBehaviorAdmin", 0, "UAC elevation prompt suppressed for administrators"},
+	{`currentversion\policies\system\audit`, "ProcessCreationIncludeCmdLine_Enabled", 0, "Process command-line auditing disabled"},
+	{`policies\microsoft\windows\powershell\scriptblocklogging`, "EnableScriptBlockLogging", 0, "PowerShell script block logging disabled"},
+	{`policies\microsoft\windows\eventlog\security`, "Retention", 1, "Security log set to overwrite-never/manual retention"},
+}
+
+// classifySetting returns a finding description if the setting weakens security.
+func classifySetting(s PolicySetting) string {
+	value, ok := s.Data.(uint32)
+	if !ok || s.Deletion {
+		return ""
+	}
+
+	key := strings.ToLower(s.Key)
+	for _, rule := range weakeningRules {
+		if strings.Contains(key, rule.keyContains) && strings.EqualFold(s.ValueName, rule.valueName) && value == rule.badValue {
+			return rule.finding
+		}
+	}
+	return ""
+}
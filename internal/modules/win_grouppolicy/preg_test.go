@@ -0,0 +1,159 @@
+package win_grouppolicy
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// polRecord is one [key;value;type;size;data] record of a fixture Registry.pol.
+type polRecord struct {
+	key, value string
+	valueType  uint32
+	data       []byte
+}
+
+// polString encodes s as NUL-terminated UTF-16LE.
+func polString(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s + "\x00")) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+func polDWORD(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
+
+// buildRegistryPol encodes records in the PReg format.
+func buildRegistryPol(records ...polRecord) []byte {
+	char := func(b []byte, c rune) []byte { return binary.LittleEndian.AppendUint16(b, uint16(c)) }
+	data := append([]byte(nil), pregSignature...)
+	for _, r := range records {
+		data = char(data, '[')
+		data = append(data, polString(r.key)...)
+		data = char(data, ';')
+		data = append(data, polString(r.value)...)
+		data = char(data, ';')
+		data = binary.LittleEndian.AppendUint32(data, r.valueType)
+		data = char(data, ';')
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(r.data)))
+		data = char(data, ';')
+		data = append(data, r.data...)
+		data = char(data, ']')
+	}
+	return data
+}
+
+// fixtureRegistryPol is a machine Registry.pol as an attacker with domain
+// admin rights might leave it: Defender and UAC off, plus benign settings.
+var fixtureRegistryPol = buildRegistryPol(
+	polRecord{`Software\Policies\Microsoft\Windows Defender`, "DisableAntiSpyware", regDWORD, polDWORD(1)},
+	polRecord{`Software\Policies\Microsoft\Windows Defender\Real-Time Protection`, "DisableRealtimeMonitoring", regDWORD, polDWORD(1)},
+	polRecord{`Software\Microsoft\Windows\CurrentVersion\Policies\System`, "EnableLUA", regDWORD, polDWORD(0)},
+	polRecord{`Software\Policies\Microsoft\Windows\WindowsUpdate\AU`, "NoAutoUpdate", regDWORD, polDWORD(0)},
+	polRecord{`Software\Policies\Microsoft\Windows\PowerShell\ScriptBlockLogging`, "**del.EnableScriptBlockLogging", regSZ, polString(" ")},
+	polRecord{`Software\Policies\Microsoft\Windows\System`, "LogonScript", regExpandSZ, polString(`%SystemRoot%\Temp\upd.cmd`)},
+	polRecord{`Software\Policies\Microsoft\Windows\Safer\CodeIdentifiers`, "ExecutableTypes", regMultiSZ, append(polString("EXE"), polString("PS1\x00")...)},
+	polRecord{`Software\Policies\Microsoft\Windows Defender\Exclusions`, "Exclusions_Paths", regQWORD, binary.LittleEndian.AppendUint64(nil, 1<<40)},
+)
+
+func TestParseRegistryPolFixture(t *testing.T) {
+	settings, err := ParseRegistryPol(fixtureRegistryPol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings) != 8 {
+		t.Fatalf("decoded %d settings, want 8", len(settings))
+	}
+
+	want := []PolicySetting{
+		{Key: `Software\Policies\Microsoft\Windows Defender`, ValueName: "DisableAntiSpyware", Type: "REG_DWORD", Data: uint32(1), Finding: "Microsoft Defender disabled by policy"},
+		{Key: `Software\Policies\Microsoft\Windows Defender\Real-Time Protection`, ValueName: "DisableRealtimeMonitoring", Type: "REG_DWORD", Data: uint32(1), Finding: "Defender real-time protection disabled"},
+		{Key: `Software\Microsoft\Windows\CurrentVersion\Policies\System`, ValueName: "EnableLUA", Type: "REG_DWORD", Data: uint32(0), Finding: "User Account Control disabled"},
+		{Key: `Software\Policies\Microsoft\Windows\WindowsUpdate\AU`, ValueName: "NoAutoUpdate", Type: "REG_DWORD", Data: uint32(0)},
+		{Key: `Software\Policies\Microsoft\Windows\PowerShell\ScriptBlockLogging`, ValueName: "**del.EnableScriptBlockLogging", Type: "REG_SZ", Data: " ", Deletion: true},
+		{Key: `Software\Policies\Microsoft\Windows\System`, ValueName: "LogonScript", Type: "REG_EXPAND_SZ", Data: `%SystemRoot%\Temp\upd.cmd`},
+		{Key: `Software\Policies\Microsoft\Windows\Safer\CodeIdentifiers`, ValueName: "ExecutableTypes", Type: "REG_MULTI_SZ", Data: []string{"EXE", "PS1"}},
+		{Key: `Software\Policies\Microsoft\Windows Defender\Exclusions`, ValueName: "Exclusions_Paths", Type: "REG_QWORD", Data: uint64(1 << 40)},
+	}
+	for i := range want {
+		if !reflect.DeepEqual(settings[i], want[i]) {
+			t.Errorf("setting %d = %+v\nwant %+v", i, settings[i], want[i])
+		}
+	}
+}
+
+func TestParseRegistryPolRejectsDamage(t *testing.T) {
+	if _, err := ParseRegistryPol([]byte("PReg\x02\x00\x00\x00")); err == nil {
+		t.Error("version 2 header accepted")
+	}
+	if settings, err := ParseRegistryPol(pregSignature); err != nil || len(settings) != 0 {
+		t.Errorf("empty policy = %v, %v", settings, err)
+	}
+
+	// A truncated file keeps the records before the damage
+	oneRecord := len(buildRegistryPol(polRecord{`Software\Policies\Microsoft\Windows Defender`, "DisableAntiSpyware", regDWORD, polDWORD(1)}))
+	for _, n := range []int{oneRecord + 1, oneRecord + 20, len(fixtureRegistryPol) - 1} {
+		settings, err := ParseRegistryPol(fixtureRegistryPol[:n])
+		if err == nil {
+			t.Errorf("policy truncated to %d bytes decoded without error", n)
+		}
+		if len(settings) == 0 || settings[0].Finding == "" {
+			t.Errorf("policy truncated to %d bytes lost the records before the damage", n)
+		}
+	}
+
+	// A size field that runs past the end of the file
+	overrun := buildRegistryPol(polRecord{`Software\Policies`, "x", regBinary, []byte{1, 2, 3, 4}})
+	binary.LittleEndian.PutUint32(overrun[len(overrun)-12:], 0xFFFF)
+	if _, err := ParseRegistryPol(overrun); err == nil || !strings.Contains(err.Error(), "overruns") {
+		t.Errorf("oversized value = %v", err)
+	}
+}
+
+func TestWriteGPOSettingsReportsFindings(t *testing.T) {
+	dir := t.TempDir()
+	polPath := filepath.Join(dir, "Machine_Registry.pol")
+	if err := os.WriteFile(polPath, fixtureRegistryPol, 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest := NewGroupPolicyManifest(context.Background(), "WS-0142")
+	collected := []collectedPolicy{{
+		Source:   `C:\Windows\System32\GroupPolicy\Machine\Registry.pol`,
+		DestPath: polPath,
+		RelPath:  "Machine_Registry.pol",
+	}}
+	if err := writeGPOSettings(context.Background(), dir, collected, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "gpo_settings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings GPOSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatal(err)
+	}
+	if len(settings.PolicyFiles) != 1 || settings.PolicyFiles[0].Scope != "machine" || len(settings.PolicyFiles[0].Settings) != 8 {
+		t.Fatalf("policy files = %+v", settings.PolicyFiles)
+	}
+	findings := make([]string, 0, len(settings.Findings))
+	for _, finding := range settings.Findings {
+		findings = append(findings, finding.ValueName)
+	}
+	if want := []string{"DisableAntiSpyware", "DisableRealtimeMonitoring", "EnableLUA"}; !reflect.DeepEqual(findings, want) {
+		t.Fatalf("findings = %v, want %v", findings, want)
+	}
+	if manifest.PolicyFindings != 3 || manifest.CollectedFiles != 1 || manifest.Items[0].Path != "gpo_settings.json" {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+}
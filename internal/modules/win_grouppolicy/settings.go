@@ -0,0 +1,159 @@
+package win_grouppolicy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// collectedPolicy tracks a copied Registry.pol for optional parsing.
+type collectedPolicy struct {
+	Source   string
+	DestPath string
+	RelPath  string
+}
+
+// PolicyFile is the decoded content of a single Registry.pol file.
+type PolicyFile struct {
+	Source   string          `json:"source"`
+	Path     string          `json:"path"`
+	Scope    string          `json:"scope"` // "machine", "user", or "unknown"
+	Settings []PolicySetting `json:"settings"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// PolicyFinding is a security-weakening setting surfaced for quick review.
+type PolicyFinding struct {
+	Source    string      `json:"source"`
+	Key       string      `json:"key"`
+	ValueName string      `json:"value_name"`
+	Data      interface{} `json:"data"`
+	Finding   string      `json:"finding"`
+}
+
+// GPOSettings is the structure written to gpo_settings.json.
+type GPOSettings struct {
+	CreatedUTC  string          `json:"created_utc"`
+	PolicyFiles []PolicyFile    `json:"policy_files"`
+	Findings    []PolicyFinding `json:"findings"`
+}
+
+// writeGPOSettings decodes collected Registry.pol files into gpo_settings.json.
+func writeGPOSettings(ctx context.Context, outDir string, collected []collectedPolicy, manifest *GroupPolicyManifest) error {
+	settings := GPOSettings{
+		CreatedUTC:  winutil.FormatTime(winutil.Now(ctx)),
+		PolicyFiles: make([]PolicyFile, 0, len(collected)),
+		Findings:    make([]PolicyFinding, 0),
+	}
+
+	for _, policy := range collected {
+		file := PolicyFile{
+			Source: policy.Source,
+			Path:   policy.RelPath,
+			Scope:  policyScope(policy.Source),
+		}
+
+		data, err := os.ReadFile(policy.DestPath)
+		if err != nil {
+			file.Error = err.Error()
+			settings.PolicyFiles = append(settings.PolicyFiles, file)
+			continue
+		}
+
+		parsed, err := ParseRegistryPol(data)
+		file.Settings = parsed
+		if err != nil {
+			file.Error = err.Error()
+			manifest.AddError(policy.Source, fmt.Sprintf("Failed to parse Registry.pol: %v", err))
+		}
+
+		for _, s := range parsed {
+			if s.Finding != "" {
+				settings.Findings = append(settings.Findings, PolicyFinding{
+					Source:    policy.Source,
+					Key:       s.Key,
+					ValueName: s.ValueName,
+					Data:      s.Data,
+					Finding:   s.Finding,
+				})
+			}
+		}
+		settings.PolicyFiles = append(settings.PolicyFiles, file)
+	}
+
+	outputPath := filepath.Join(outDir, "gpo_settings.json")
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return err
+	}
+
+	manifest.SetPolicyFindings(len(settings.Findings))
+	if !manifest.RemoveItem("gpo_settings.json") {
+		manifest.IncrementTotalFiles()
+	}
+	if stat, err := os.Stat(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
+			note := fmt.Sprintf("Decoded Group Policy settings (%d security-weakening findings)", len(settings.Findings))
+			manifest.AddItem("gpo_settings.json", stat.Size(), sha256Hex, false, stat.ModTime(), "gpo_settings", "", note)
+		}
+	}
+
+	return nil
+}
+
+// policyScope infers whether a Registry.pol applies to the machine or to users.
+func policyScope(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.Contains(lower, `\machine\`):
+		return "machine"
+	case strings.Contains(lower, `\user\`):
+		return "user"
+	default:
+		return "unknown"
+	}
+}
+
+// AnalyzeGPOSettings rebuilds gpo_settings.json from the Registry.pol copies
+// listed in a collected windows/grouppolicy manifest, for the analyze command.
+func AnalyzeGPOSettings(ctx context.Context, moduleDir string) ([]string, error) {
+	gpDir := filepath.Join(moduleDir, "windows", "grouppolicy")
+	manifestPath := filepath.Join(gpDir, "manifest.json")
+	manifest, err := LoadGroupPolicyManifest(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grouppolicy manifest: %w", err)
+	}
+
+	var collected []collectedPolicy
+	for _, item := range manifest.Items {
+		if item.FileType != "registry_pol" || item.Truncated {
+			continue
+		}
+		// Collected on Windows, so the recorded path uses backslashes
+		relPath := filepath.FromSlash(strings.ReplaceAll(item.Path, `\`, "/"))
+		collected = append(collected, collectedPolicy{
+			Source:   item.Source,
+			DestPath: filepath.Join(gpDir, relPath),
+			RelPath:  item.Path,
+		})
+	}
+	if len(collected) == 0 {
+		return nil, nil
+	}
+
+	if err := writeGPOSettings(ctx, gpDir, collected, manifest); err != nil {
+		return nil, fmt.Errorf("failed to write parsed policy settings: %w", err)
+	}
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return []string{"windows/grouppolicy/gpo_settings.json"}, fmt.Errorf("failed to write grouppolicy manifest: %w", err)
+	}
+	return []string{"windows/grouppolicy/gpo_settings.json", "windows/grouppolicy/manifest.json"}, nil
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package win_grouppolicy
+
+import (
+	"context"
+)
+
+// WinGroupPolicy represents the Windows Group Policy collection module stub for non-Windows platforms.
+type WinGroupPolicy struct{}
+
+// NewWinGroupPolicy creates a new Windows Group Policy collection module stub.
+func NewWinGroupPolicy() *WinGroupPolicy {
+	return &WinGroupPolicy{}
+}
+
+// SetParse is a no-op on non-Windows platforms.
+func (w *WinGroupPolicy) SetParse(enabled bool) {
+	// No-op on non-Windows platforms
+}
+
+// Name returns the module's identifier.
+func (w *WinGroupPolicy) Name() string {
+	return "windows/grouppolicy"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinGroupPolicy) Describe() string {
+	return "Group Policy Registry.pol and cached GPOs"
+}
+
+// Collect is a no-op on non-Windows platforms and always returns nil.
+func (w *WinGroupPolicy) Collect(ctx context.Context, outDir string) error {
+	// This module only works on Windows, so it's a no-op on other platforms
+	return nil
+}
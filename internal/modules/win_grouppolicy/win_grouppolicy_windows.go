@@ -0,0 +1,196 @@
+//go:build windows
+
+package win_grouppolicy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// WinGroupPolicy represents the Windows Group Policy collection module.
+type WinGroupPolicy struct {
+	parse bool // Decode Registry.pol files into gpo_settings.json
+}
+
+// NewWinGroupPolicy creates a new Windows Group Policy collection module.
+func NewWinGroupPolicy() *WinGroupPolicy {
+	return &WinGroupPolicy{}
+}
+
+// SetParse enables decoding of collected Registry.pol files.
+func (w *WinGroupPolicy) SetParse(enabled bool) {
+	w.parse = enabled
+}
+
+// Name returns the module's identifier.
+func (w *WinGroupPolicy) Name() string {
+	return "windows/grouppolicy"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinGroupPolicy) Describe() string {
+	return "Group Policy Registry.pol and cached GPOs"
+}
+
+// policySource describes a directory tree that may contain Registry.pol files.
+type policySource struct {
+	Dir      string // Directory on the host
+	Category string // Output subdirectory
+}
+
+// Collect copies Registry.pol files from local, domain, and cached GPO locations.
+func (w *WinGroupPolicy) Collect(ctx context.Context, outDir string) error {
+	// Create the windows/grouppolicy subdirectory
+	gpDir := filepath.Join(outDir, "windows", "grouppolicy")
+	if err := winutil.EnsureDir(gpDir); err != nil {
+		return fmt.Errorf("failed to create grouppolicy directory: %w", err)
+	}
+
+	// Get hostname for manifest
+	hostname, err := winutil.Hostname(ctx)
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	// Create manifest
+	manifest := NewGroupPolicyManifest(ctx, hostname)
+	constraints := winutil.NewSizeConstraints(ctx)
+
+	var collected []collectedPolicy
+	for _, source := range w.policySources() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		files, err := w.collectRegistryPolFiles(ctx, source, gpDir, manifest, constraints)
+		if err != nil {
+			manifest.AddError(source.Dir, err.Error())
+		}
+		collected = append(collected, files...)
+	}
+
+	// Decode the binary policy files when parsing is enabled
+	if w.parse && len(collected) > 0 {
+		if err := writeGPOSettings(ctx, gpDir, collected, manifest); err != nil {
+			manifest.AddError("gpo_settings", fmt.Sprintf("Failed to write parsed policy settings: %v", err))
+		}
+	}
+
+	// Write manifest
+	manifestPath := filepath.Join(gpDir, "manifest.json")
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// policySources returns the locations where enforced and cached policy is stored.
+func (w *WinGroupPolicy) policySources() []policySource {
+	systemRoot := winutil.SystemRoot()
+	programData := winutil.ProgramData()
+
+	sources := []policySource{
+		{Dir: filepath.Join(systemRoot, "System32", "GroupPolicy"), Category: "local"},
+		{Dir: filepath.Join(systemRoot, "System32", "GroupPolicyUsers"), Category: "local_users"},
+		{Dir: filepath.Join(systemRoot, "SYSVOL"), Category: "sysvol"},
+		{Dir: filepath.Join(programData, "Microsoft", "Group Policy", "History"), Category: "history"},
+	}
+
+	// Per-user cached GPO history
+	systemDrive := winutil.SystemDrive()
+	usersDir := filepath.Join(systemDrive+"\\", "Users")
+	if entries, err := os.ReadDir(usersDir); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() || w.isSystemProfile(entry.Name()) {
+				continue
+			}
+			sources = append(sources, policySource{
+				Dir:      filepath.Join(usersDir, entry.Name(), "AppData", "Local", "Microsoft", "Group Policy", "History"),
+				Category: filepath.Join("users", entry.Name()),
+			})
+		}
+	}
+
+	return sources
+}
+
+// collectRegistryPolFiles walks a policy source and copies every Registry.pol it finds.
+func (w *WinGroupPolicy) collectRegistryPolFiles(ctx context.Context, source policySource, outDir string, manifest *GroupPolicyManifest, constraints *winutil.SizeConstraints) ([]collectedPolicy, error) {
+	if _, err := os.Stat(source.Dir); err != nil {
+		// Location not present on this system (e.g. SYSVOL on non-DCs)
+		return nil, nil
+	}
+
+	var collected []collectedPolicy
+	err := filepath.WalkDir(source.Dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if d.IsDir() || !strings.EqualFold(d.Name(), "Registry.pol") {
+			return nil
+		}
+
+		manifest.IncrementTotalFiles()
+
+		relFromSource, err := filepath.Rel(source.Dir, path)
+		if err != nil {
+			manifest.AddError(path, fmt.Sprintf("Failed to compute relative path: %v", err))
+			return nil
+		}
+		relPath := filepath.Join(source.Category, relFromSource)
+		destPath := filepath.Join(outDir, relPath)
+		if err := winutil.EnsureDir(filepath.Dir(destPath)); err != nil {
+			manifest.AddError(path, fmt.Sprintf("Failed to create output directory: %v", err))
+			return nil
+		}
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			manifest.AddError(path, fmt.Sprintf("Failed to stat file: %v", err))
+			return nil
+		}
+
+		size, sha256Hex, truncated, err := winutil.SmartCopy(path, destPath, constraints)
+		if err != nil {
+			manifest.AddError(path, fmt.Sprintf("Failed to copy file: %v", err))
+			return nil
+		}
+
+		note := fmt.Sprintf("Group Policy registry settings (%s scope)", policyScope(path))
+		manifest.AddItem(relPath, size, sha256Hex, truncated, stat.ModTime(), "registry_pol", path, note)
+		collected = append(collected, collectedPolicy{Source: path, DestPath: destPath, RelPath: relPath})
+		return nil
+	})
+
+	return collected, err
+}
+
+// isSystemProfile checks if a username represents a system profile that should be skipped.
+func (w *WinGroupPolicy) isSystemProfile(username string) bool {
+	systemProfiles := []string{
+		"All Users", "Default", "Default User", "Public",
+		"WDAGUtilityAccount", "defaultuser0", "systemprofile",
+	}
+
+	lowerUsername := strings.ToLower(username)
+	for _, profile := range systemProfiles {
+		if lowerUsername == strings.ToLower(profile) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,7 +1,7 @@
 // Package win_iis provides Windows IIS logs collection for cryptkeeper.
 package win_iis
 
-import ("encoding/json"; "os"; "time")
+import ("context"; "encoding/json"; "os"; "time"; "cryptkeeper/internal/winutil")
 
 type IISItem struct {
 	Path      string `json:"path"`
@@ -28,15 +28,15 @@ type IISManifest struct {
 	CollectedFiles     int        `json:"collected_files"`
 }
 
-func NewIISManifest(hostname string) *IISManifest {
+func NewIISManifest(ctx context.Context, hostname string) *IISManifest {
 	return &IISManifest{
-		CreatedUTC: time.Now().UTC().Format(time.RFC3339), Host: hostname, CryptkeeperVersion: "v0.1.0",
+		CreatedUTC: winutil.FormatTime(winutil.Now(ctx)), Host: hostname, CryptkeeperVersion: "v0.1.0",
 		Items: make([]IISItem, 0), Errors: make([]IISError, 0), TotalFiles: 0, CollectedFiles: 0,
 	}
 }
 
 func (im *IISManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, note string) {
-	im.Items = append(im.Items, IISItem{Path: path, Size: size, SHA256: sha256, Truncated: truncated, Note: note, Modified: modified.UTC().Format(time.RFC3339), FileType: fileType})
+	im.Items = append(im.Items, IISItem{Path: path, Size: size, SHA256: sha256, Truncated: truncated, Note: note, Modified: winutil.FormatTime(modified), FileType: fileType})
 	im.CollectedFiles++
 }
 
@@ -7,4 +7,5 @@ import ("context")
 type WinIIS struct{}
 func NewWinIIS() *WinIIS { return &WinIIS{} }
 func (w *WinIIS) Name() string { return "windows/iis" }
+func (w *WinIIS) Describe() string { return "IIS web server logs" }
 func (w *WinIIS) Collect(ctx context.Context, outDir string) error { return nil }
\ No newline at end of file
@@ -22,25 +22,27 @@ func (w *WinIIS) Name() string {
 	return "windows/iis"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinIIS) Describe() string {
+	return "IIS web server logs"
+}
+
 func (w *WinIIS) Collect(ctx context.Context, outDir string) error {
 	iisDir := filepath.Join(outDir, "windows", "iis")
 	if err := winutil.EnsureDir(iisDir); err != nil {
 		return fmt.Errorf("failed to create iis directory: %w", err)
 	}
 
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
-	manifest := NewIISManifest(hostname)
-	constraints := winutil.NewSizeConstraints()
+	manifest := NewIISManifest(ctx, hostname)
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Check if IIS is installed by looking for inetpub
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	inetpubPath := filepath.Join(systemDrive, "inetpub")
 	if _, err := os.Stat(inetpubPath); err != nil {
@@ -2,9 +2,12 @@
 package win_jumplists
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // JumpListItem represents a collected jump list file.
@@ -35,12 +38,14 @@ type JumpListManifest struct {
 	UsersProcessed     int              `json:"users_processed"`
 	TotalFiles         int              `json:"total_files"`
 	CollectedFiles     int              `json:"collected_files"`
+	Since              string           `json:"since,omitempty"`            // Jump lists modified before this were not collected
+	SkippedBySince     int              `json:"skipped_by_since,omitempty"` // Jump lists modified before --since
 }
 
 // NewJumpListManifest creates a new jump list manifest with basic information.
-func NewJumpListManifest(hostname string) *JumpListManifest {
+func NewJumpListManifest(ctx context.Context, hostname string) *JumpListManifest {
 	return &JumpListManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]JumpListItem, 0),
@@ -59,7 +64,7 @@ func (jm *JumpListManifest) AddItem(path string, size int64, sha256 string, trun
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 		Username:  username,
 	})
@@ -84,6 +89,11 @@ func (jm *JumpListManifest) IncrementTotalFiles() {
 	jm.TotalFiles++
 }
 
+// IncrementSkippedBySince counts a jump list skipped as older than --since.
+func (jm *JumpListManifest) IncrementSkippedBySince() {
+	jm.SkippedBySince++
+}
+
 // WriteManifest writes the manifest to a JSON file.
 func (jm *JumpListManifest) WriteManifest(manifestPath string) error {
 	data, err := json.MarshalIndent(jm, "", "  ")
@@ -14,11 +14,19 @@ func NewWinJumpLists() *WinJumpLists {
 	return &WinJumpLists{}
 }
 
+// SetSinceTime is a no-op on non-Windows platforms.
+func (w *WinJumpLists) SetSinceTime(sinceRFC3339 string) {}
+
 // Name returns the module's identifier.
 func (w *WinJumpLists) Name() string {
 	return "windows/jumplists"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinJumpLists) Describe() string {
+	return "Windows Jump Lists"
+}
+
 // Collect is a no-op on non-Windows platforms and always returns nil.
 func (w *WinJumpLists) Collect(ctx context.Context, outDir string) error {
 	// This module only works on Windows, so it's a no-op on other platforms
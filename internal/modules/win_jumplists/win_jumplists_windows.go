@@ -4,27 +4,41 @@ package win_jumplists
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"cryptkeeper/internal/winutil"
 )
 
 // WinJumpLists represents the Windows jump lists collection module.
-type WinJumpLists struct{}
+type WinJumpLists struct {
+	since time.Time // Jump lists modified before this are skipped; zero collects all
+}
 
 // NewWinJumpLists creates a new Windows jump lists collection module.
 func NewWinJumpLists() *WinJumpLists {
 	return &WinJumpLists{}
 }
 
+// SetSinceTime skips jump lists last modified before the RFC3339 cutoff.
+func (w *WinJumpLists) SetSinceTime(sinceRFC3339 string) {
+	w.since = winutil.ParseSince(sinceRFC3339)
+}
+
 // Name returns the module's identifier.
 func (w *WinJumpLists) Name() string {
 	return "windows/jumplists"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinJumpLists) Describe() string {
+	return "Windows Jump Lists"
+}
+
 // Collect copies Windows jump list files and creates a manifest.
 func (w *WinJumpLists) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/jumplists subdirectory
@@ -34,22 +48,22 @@ func (w *WinJumpLists) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewJumpListManifest(hostname)
+	manifest := NewJumpListManifest(ctx, hostname)
+	if !w.since.IsZero() {
+		manifest.Since = winutil.FormatTime(w.since)
+	}
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Get system drive (usually C:)
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	// Collect jump lists from all user profiles
 	usersDir := filepath.Join(systemDrive, "Users")
@@ -68,6 +82,7 @@ func (w *WinJumpLists) Collect(ctx context.Context, outDir string) error {
 
 // collectFromUsersDirectory iterates through user profiles and collects jump lists.
 func (w *WinJumpLists) collectFromUsersDirectory(ctx context.Context, usersDir, outDir string, manifest *JumpListManifest, constraints *winutil.SizeConstraints) error {
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(outDir, "user profiles", usersDir)
 	entries, err := os.ReadDir(usersDir)
 	if err != nil {
 		return fmt.Errorf("failed to read users directory: %w", err)
@@ -107,6 +122,7 @@ func (w *WinJumpLists) collectFromUsersDirectory(ctx context.Context, usersDir,
 
 // collectJumpListsFromDirectory collects jump list files from a specific directory.
 func (w *WinJumpLists) collectJumpListsFromDirectory(ctx context.Context, sourceDir, outDir, fileType, username string, manifest *JumpListManifest, constraints *winutil.SizeConstraints) {
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(outDir, fmt.Sprintf("%s jump lists of %s", fileType, username), sourceDir)
 	entries, err := os.ReadDir(sourceDir)
 	if err != nil {
 		// Don't treat as error if directory doesn't exist (user may not have jump lists)
@@ -150,7 +166,11 @@ func (w *WinJumpLists) collectJumpListsFromDirectory(ctx context.Context, source
 		}
 
 		// Use smart copy with size constraints
-		size, sha256Hex, truncated, err := winutil.SmartCopy(srcPath, destPath, constraints)
+		size, sha256Hex, truncated, err := winutil.SmartCopySince(srcPath, destPath, constraints, w.since)
+		if errors.Is(err, winutil.ErrBeforeSince) {
+			manifest.IncrementSkippedBySince()
+			continue
+		}
 		if err != nil {
 			manifest.AddError(srcPath, fmt.Sprintf("Failed to copy file: %v", err))
 			continue
@@ -2,9 +2,13 @@
 package win_kerberos
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
 )
 
 // KerberosItem represents a collected Kerberos-related file.
@@ -34,12 +38,13 @@ type KerberosManifest struct {
 	TotalFiles         int              `json:"total_files"`
 	CollectedFiles     int              `json:"collected_files"`
 	TicketsFound       int              `json:"tickets_found"`
+	Summary            schema.Summary   `json:"summary"`
 }
 
 // NewKerberosManifest creates a new Kerberos manifest with basic information.
-func NewKerberosManifest(hostname string) *KerberosManifest {
+func NewKerberosManifest(ctx context.Context, hostname string) *KerberosManifest {
 	return &KerberosManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]KerberosItem, 0),
@@ -47,6 +52,7 @@ func NewKerberosManifest(hostname string) *KerberosManifest {
 		TotalFiles:         0,
 		CollectedFiles:     0,
 		TicketsFound:       0,
+		Summary:            schema.NewSummary(),
 	}
 }
 
@@ -58,7 +64,7 @@ func (km *KerberosManifest) AddItem(path string, size int64, sha256 string, trun
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	km.CollectedFiles++
@@ -80,6 +86,7 @@ func (km *KerberosManifest) IncrementTotalFiles() {
 // SetTicketsFound sets the number of tickets found.
 func (km *KerberosManifest) SetTicketsFound(count int) {
 	km.TicketsFound = count
+	km.Summary.Set(schema.SummaryTickets, count)
 }
 
 // WriteManifest writes the manifest to a JSON file.
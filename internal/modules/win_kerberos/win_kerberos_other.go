@@ -19,6 +19,16 @@ func (w *WinKerberos) Name() string {
 	return "windows/kerberos"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinKerberos) Describe() string {
+	return "Kerberos tickets and configuration"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinKerberos) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinKerberos) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
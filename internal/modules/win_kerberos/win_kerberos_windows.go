@@ -25,6 +25,16 @@ func (w *WinKerberos) Name() string {
 	return "windows/kerberos"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinKerberos) Describe() string {
+	return "Kerberos tickets and configuration"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinKerberos) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers Kerberos authentication information and ticket cache data.
 func (w *WinKerberos) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/kerberos subdirectory
@@ -34,13 +44,13 @@ func (w *WinKerberos) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewKerberosManifest(hostname)
+	manifest := NewKerberosManifest(ctx, hostname)
 
 	// Collect Kerberos tickets
 	if err := w.collectKerberosTickets(ctx, kerberosDir, manifest); err != nil {
@@ -118,7 +128,7 @@ func (w *WinKerberos) collectKerberosTickets(ctx context.Context, outDir string,
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("kerberos_tickets.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "kerberos_tickets", "Current Kerberos tickets and cache information")
 			manifest.IncrementTotalFiles()
 		}
@@ -190,7 +200,7 @@ func (w *WinKerberos) collectKerberosConfig(ctx context.Context, outDir string,
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("kerberos_config.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "krb_config", "Kerberos configuration and realm information")
 			manifest.IncrementTotalFiles()
 		}
@@ -2,9 +2,13 @@
 package win_lnk
 
 import (
+	"context"
 	"encoding/json"
 	"os"
+	"strings"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // LNKItem represents a collected LNK shortcut file.
@@ -35,12 +39,15 @@ type LNKManifest struct {
 	UsersProcessed     int       `json:"users_processed"`
 	TotalFiles         int       `json:"total_files"`
 	CollectedFiles     int       `json:"collected_files"`
+	Since              string    `json:"since,omitempty"`            // Shortcuts modified before this were not collected
+	SkippedBySince     int       `json:"skipped_by_since,omitempty"` // Shortcuts modified before --since
+	ParsedFiles        int       `json:"parsed_files"`               // Shortcuts decoded into lnk_parsed.json
 }
 
 // NewLNKManifest creates a new LNK shortcut manifest with basic information.
-func NewLNKManifest(hostname string) *LNKManifest {
+func NewLNKManifest(ctx context.Context, hostname string) *LNKManifest {
 	return &LNKManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]LNKItem, 0),
@@ -51,6 +58,19 @@ func NewLNKManifest(hostname string) *LNKManifest {
 	}
 }
 
+// LoadLNKManifest reads a manifest written by WriteManifest.
+func LoadLNKManifest(manifestPath string) (*LNKManifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var lm LNKManifest
+	if err := json.Unmarshal(data, &lm); err != nil {
+		return nil, err
+	}
+	return &lm, nil
+}
+
 // AddItem adds a successfully collected LNK item to the manifest.
 func (lm *LNKManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, username, location, note string) {
 	lm.Items = append(lm.Items, LNKItem{
@@ -59,13 +79,26 @@ func (lm *LNKManifest) AddItem(path string, size int64, sha256 string, truncated
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		Username:  username,
 		Location:  location,
 	})
 	lm.CollectedFiles++
 }
 
+// RemoveItem drops an item, e.g. before a parsed output is rewritten, and
+// reports whether it was listed.
+func (lm *LNKManifest) RemoveItem(path string) bool {
+	for i, item := range lm.Items {
+		if item.Path == path {
+			lm.Items = append(lm.Items[:i], lm.Items[i+1:]...)
+			lm.CollectedFiles--
+			return true
+		}
+	}
+	return false
+}
+
 // AddError adds an error to the manifest for a failed collection.
 func (lm *LNKManifest) AddError(target, errorMsg string) {
 	lm.Errors = append(lm.Errors, LNKError{
@@ -74,6 +107,18 @@ func (lm *LNKManifest) AddError(target, errorMsg string) {
 	})
 }
 
+// RemoveParseErrors drops the errors recorded by an earlier parse, before the
+// shortcuts are parsed again.
+func (lm *LNKManifest) RemoveParseErrors() {
+	kept := lm.Errors[:0]
+	for _, e := range lm.Errors {
+		if !strings.HasPrefix(e.Error, parseErrorPrefix) {
+			kept = append(kept, e)
+		}
+	}
+	lm.Errors = kept
+}
+
 // IncrementUsersProcessed increments the count of users processed.
 func (lm *LNKManifest) IncrementUsersProcessed() {
 	lm.UsersProcessed++
@@ -84,6 +129,11 @@ func (lm *LNKManifest) IncrementTotalFiles() {
 	lm.TotalFiles++
 }
 
+// IncrementSkippedBySince counts a shortcut skipped as older than --since.
+func (lm *LNKManifest) IncrementSkippedBySince() {
+	lm.SkippedBySince++
+}
+
 // WriteManifest writes the manifest to a JSON file.
 func (lm *LNKManifest) WriteManifest(manifestPath string) error {
 	data, err := json.MarshalIndent(lm, "", "  ")
@@ -0,0 +1,170 @@
+package win_lnk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/lnk"
+	"cryptkeeper/internal/winutil"
+)
+
+// parsedFileName is the decoded shortcut output next to the raw copies.
+const parsedFileName = "lnk_parsed.json"
+
+// parseErrorPrefix marks the manifest errors of shortcuts that could not be
+// decoded, so a later parse can replace them.
+const parseErrorPrefix = "failed to parse shortcut: "
+
+// ParsedLNK is the decoded content of one collected shortcut.
+type ParsedLNK struct {
+	Username         string     `json:"username"`
+	Location         string     `json:"location"`
+	TargetPath       string     `json:"target_path"` // Local path, or UNC path for a target on a share
+	Arguments        string     `json:"arguments,omitempty"`
+	WorkingDirectory string     `json:"working_directory,omitempty"`
+	RelativePath     string     `json:"relative_path,omitempty"`
+	Description      string     `json:"description,omitempty"`
+	IconLocation     string     `json:"icon_location,omitempty"`
+	AppUserModelID   string     `json:"app_user_model_id,omitempty"`
+	TargetCreated    string     `json:"target_created,omitempty"`
+	TargetModified   string     `json:"target_modified,omitempty"`
+	TargetAccessed   string     `json:"target_accessed,omitempty"`
+	TargetSize       uint32     `json:"target_size"`
+	Volume           *LNKVolume `json:"volume,omitempty"`
+}
+
+// LNKVolume is the volume a shortcut's target was on.
+type LNKVolume struct {
+	DriveType    string `json:"drive_type"`
+	SerialNumber string `json:"serial_number"`
+	Label        string `json:"label,omitempty"`
+}
+
+// ParsedLNKReport is the content of lnk_parsed.json, keyed by the collected
+// shortcut file name.
+type ParsedLNKReport struct {
+	CreatedUTC string               `json:"created_utc"`
+	Files      map[string]ParsedLNK `json:"files"`
+}
+
+// WriteParsedLNK decodes the shortcuts listed in the manifest into
+// lnk_parsed.json in lnkDir. A shortcut that fails to decode is recorded as
+// a manifest error and left out. An lnk_parsed.json already listed in the
+// manifest is replaced.
+func WriteParsedLNK(ctx context.Context, lnkDir string, manifest *LNKManifest) error {
+	manifest.RemoveParseErrors()
+	report := ParsedLNKReport{
+		CreatedUTC: winutil.FormatTime(winutil.Now(ctx)),
+		Files:      make(map[string]ParsedLNK),
+	}
+
+	items := make([]LNKItem, 0, len(manifest.Items))
+	for _, item := range manifest.Items {
+		if strings.HasSuffix(strings.ToLower(item.Path), ".lnk") {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	for _, item := range items {
+		if item.Truncated {
+			manifest.AddError(item.Path, parseErrorPrefix+"copy was truncated by the size limits")
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(lnkDir, item.Path))
+		if err != nil {
+			manifest.AddError(item.Path, parseErrorPrefix+err.Error())
+			continue
+		}
+		shortcut, err := lnk.Parse(data)
+		if err != nil {
+			manifest.AddError(item.Path, parseErrorPrefix+err.Error())
+			continue
+		}
+		report.Files[item.Path] = newParsedLNK(item, shortcut)
+	}
+
+	outputPath := filepath.Join(lnkDir, parsedFileName)
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal parsed shortcuts: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write parsed shortcuts: %w", err)
+	}
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat parsed shortcuts: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash parsed shortcuts: %w", err)
+	}
+	manifest.RemoveItem(parsedFileName)
+	manifest.ParsedFiles = len(report.Files)
+	note := fmt.Sprintf("Decoded shortcut targets, arguments, volumes and target times (%d of %d shortcuts)", len(report.Files), len(items))
+	manifest.AddItem(parsedFileName, stat.Size(), sha256Hex, false, stat.ModTime(), "", "", note)
+	return nil
+}
+
+// newParsedLNK converts a decoded shortcut to its JSON form.
+func newParsedLNK(item LNKItem, shortcut *lnk.Shortcut) ParsedLNK {
+	parsed := ParsedLNK{
+		Username:         item.Username,
+		Location:         item.Location,
+		TargetPath:       shortcut.Target(),
+		Arguments:        shortcut.Arguments,
+		WorkingDirectory: shortcut.WorkingDirectory,
+		RelativePath:     shortcut.RelativePath,
+		Description:      shortcut.Description,
+		IconLocation:     shortcut.IconLocation,
+		AppUserModelID:   shortcut.AppUserModelID,
+		TargetCreated:    formatTime(shortcut.TargetCreated),
+		TargetModified:   formatTime(shortcut.TargetModified),
+		TargetAccessed:   formatTime(shortcut.TargetAccessed),
+		TargetSize:       shortcut.TargetSize,
+	}
+	if v := shortcut.Volume; v != nil {
+		parsed.Volume = &LNKVolume{
+			DriveType:    v.DriveType,
+			SerialNumber: fmt.Sprintf("%08X", v.SerialNumber),
+			Label:        v.Label,
+		}
+	}
+	return parsed
+}
+
+// formatTime formats a target time, leaving an unset one empty.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return winutil.FormatTime(t)
+}
+
+// AnalyzeLNK rebuilds lnk_parsed.json from the shortcuts in a collected
+// windows/lnk directory, for the analyze command.
+func AnalyzeLNK(ctx context.Context, moduleDir string) ([]string, error) {
+	lnkDir := filepath.Join(moduleDir, "windows", "lnk")
+	manifestPath := filepath.Join(lnkDir, "manifest.json")
+	manifest, err := LoadLNKManifest(manifestPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lnk manifest: %w", err)
+	}
+	if err := WriteParsedLNK(ctx, lnkDir, manifest); err != nil {
+		return nil, err
+	}
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return []string{"windows/lnk/" + parsedFileName}, fmt.Errorf("failed to write lnk manifest: %w", err)
+	}
+	return []string{"windows/lnk/" + parsedFileName, "windows/lnk/manifest.json"}, nil
+}
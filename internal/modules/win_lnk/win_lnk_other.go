@@ -14,11 +14,19 @@ func NewWinLNK() *WinLNK {
 	return &WinLNK{}
 }
 
+// SetSinceTime is a no-op on non-Windows systems.
+func (w *WinLNK) SetSinceTime(sinceRFC3339 string) {}
+
 // Name returns the module's identifier.
 func (w *WinLNK) Name() string {
 	return "windows/lnk"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinLNK) Describe() string {
+	return "Windows LNK shortcut files"
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinLNK) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
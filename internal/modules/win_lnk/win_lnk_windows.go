@@ -4,27 +4,41 @@ package win_lnk
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"cryptkeeper/internal/winutil"
 )
 
 // WinLNK represents the Windows shortcut files collection module.
-type WinLNK struct{}
+type WinLNK struct {
+	since time.Time // Shortcuts modified before this are skipped; zero collects all
+}
 
 // NewWinLNK creates a new Windows shortcut files collection module.
 func NewWinLNK() *WinLNK {
 	return &WinLNK{}
 }
 
+// SetSinceTime skips shortcuts last modified before the RFC3339 cutoff.
+func (w *WinLNK) SetSinceTime(sinceRFC3339 string) {
+	w.since = winutil.ParseSince(sinceRFC3339)
+}
+
 // Name returns the module's identifier.
 func (w *WinLNK) Name() string {
 	return "windows/lnk"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinLNK) Describe() string {
+	return "Windows LNK shortcut files"
+}
+
 // Collect copies Windows shortcut files and creates a manifest.
 func (w *WinLNK) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/lnk subdirectory
@@ -34,22 +48,22 @@ func (w *WinLNK) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewLNKManifest(hostname)
+	manifest := NewLNKManifest(ctx, hostname)
+	if !w.since.IsZero() {
+		manifest.Since = winutil.FormatTime(w.since)
+	}
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Get system drive (usually C:)
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	// Collect LNK files from all user profiles
 	usersDir := filepath.Join(systemDrive, "Users")
@@ -57,6 +71,11 @@ func (w *WinLNK) Collect(ctx context.Context, outDir string) error {
 		manifest.AddError("users_directory", fmt.Sprintf("Failed to process users directory: %v", err))
 	}
 
+	// Decode the copies; a shortcut that fails to parse is a manifest error
+	if err := WriteParsedLNK(ctx, lnkDir, manifest); err != nil {
+		manifest.AddError(parsedFileName, err.Error())
+	}
+
 	// Write manifest
 	manifestPath := filepath.Join(lnkDir, "manifest.json")
 	if err := manifest.WriteManifest(manifestPath); err != nil {
@@ -68,6 +87,7 @@ func (w *WinLNK) Collect(ctx context.Context, outDir string) error {
 
 // collectFromUsersDirectory iterates through user profiles and collects LNK files.
 func (w *WinLNK) collectFromUsersDirectory(ctx context.Context, usersDir, outDir string, manifest *LNKManifest, constraints *winutil.SizeConstraints) error {
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(outDir, "user profiles", usersDir)
 	entries, err := os.ReadDir(usersDir)
 	if err != nil {
 		return fmt.Errorf("failed to read users directory: %w", err)
@@ -111,6 +131,7 @@ func (w *WinLNK) collectFromUsersDirectory(ctx context.Context, usersDir, outDir
 
 // collectLNKFromDirectory collects LNK files from a specific directory.
 func (w *WinLNK) collectLNKFromDirectory(ctx context.Context, sourceDir, outDir, location, username string, manifest *LNKManifest, constraints *winutil.SizeConstraints) {
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(outDir, fmt.Sprintf("%s shortcuts of %s", location, username), sourceDir)
 	// Walk the directory tree to handle subdirectories (especially for Start Menu)
 	err := filepath.WalkDir(sourceDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
@@ -157,7 +178,11 @@ func (w *WinLNK) collectLNKFromDirectory(ctx context.Context, sourceDir, outDir,
 		}
 
 		// Use smart copy with size constraints
-		size, sha256Hex, truncated, err := winutil.SmartCopy(path, destPath, constraints)
+		size, sha256Hex, truncated, err := winutil.SmartCopySince(path, destPath, constraints, w.since)
+		if errors.Is(err, winutil.ErrBeforeSince) {
+			manifest.IncrementSkippedBySince()
+			return nil
+		}
 		if err != nil {
 			manifest.AddError(path, fmt.Sprintf("Failed to copy file: %v", err))
 			return nil
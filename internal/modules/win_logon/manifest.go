@@ -2,9 +2,13 @@
 package win_logon
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
 )
 
 // LogonItem represents a collected logon session-related file.
@@ -34,12 +38,13 @@ type LogonManifest struct {
 	TotalFiles         int          `json:"total_files"`
 	CollectedFiles     int          `json:"collected_files"`
 	ActiveSessionsFound int         `json:"active_sessions_found"`
+	Summary             schema.Summary `json:"summary"`
 }
 
 // NewLogonManifest creates a new logon sessions manifest with basic information.
-func NewLogonManifest(hostname string) *LogonManifest {
+func NewLogonManifest(ctx context.Context, hostname string) *LogonManifest {
 	return &LogonManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]LogonItem, 0),
@@ -47,6 +52,7 @@ func NewLogonManifest(hostname string) *LogonManifest {
 		TotalFiles:         0,
 		CollectedFiles:     0,
 		ActiveSessionsFound: 0,
+		Summary:            schema.NewSummary(),
 	}
 }
 
@@ -58,7 +64,7 @@ func (lm *LogonManifest) AddItem(path string, size int64, sha256 string, truncat
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	lm.CollectedFiles++
@@ -80,6 +86,7 @@ func (lm *LogonManifest) IncrementTotalFiles() {
 // SetActiveSessionsFound sets the number of active sessions found.
 func (lm *LogonManifest) SetActiveSessionsFound(count int) {
 	lm.ActiveSessionsFound = count
+	lm.Summary.Set(schema.SummaryActiveSessions, count)
 }
 
 // WriteManifest writes the manifest to a JSON file.
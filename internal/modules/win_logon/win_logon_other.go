@@ -19,6 +19,16 @@ func (w *WinLogon) Name() string {
 	return "windows/logon"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinLogon) Describe() string {
+	return "Logon sessions and authentication history"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinLogon) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinLogon) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
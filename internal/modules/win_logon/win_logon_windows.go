@@ -25,6 +25,16 @@ func (w *WinLogon) Name() string {
 	return "windows/logon"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinLogon) Describe() string {
+	return "Logon sessions and authentication history"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinLogon) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers logon sessions and authentication history information.
 func (w *WinLogon) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/logon subdirectory
@@ -34,13 +44,13 @@ func (w *WinLogon) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewLogonManifest(hostname)
+	manifest := NewLogonManifest(ctx, hostname)
 
 	// Collect logon sessions
 	if err := w.collectLogonSessions(ctx, logonDir, manifest); err != nil {
@@ -124,7 +134,7 @@ func (w *WinLogon) collectLogonSessions(ctx context.Context, outDir string, mani
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("logon_sessions.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "logon_sessions", "Current logon sessions and user information")
 			manifest.IncrementTotalFiles()
 		}
@@ -197,7 +207,7 @@ func (w *WinLogon) collectAuthHistory(ctx context.Context, outDir string, manife
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("auth_history.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "auth_history", "Authentication history and cached credentials information")
 			manifest.IncrementTotalFiles()
 		}
@@ -264,7 +274,7 @@ func (w *WinLogon) collectLoginEvents(ctx context.Context, outDir string, manife
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("login_events.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "login_events", "Login events and security audit configuration")
 			manifest.IncrementTotalFiles()
 		}
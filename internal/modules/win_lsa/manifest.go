@@ -2,9 +2,12 @@
 package win_lsa
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // LSAItem represents a collected LSA-related file.
@@ -15,7 +18,7 @@ type LSAItem struct {
 	Truncated bool   `json:"truncated"` // Whether the file was truncated due to size limits
 	Note      string `json:"note,omitempty"` // Description of the file
 	Modified  string `json:"modified"`  // File modification time (RFC3339)
-	FileType  string `json:"file_type"` // Type: "lsa_policy", "auth_packages", "domain_info"
+	FileType  string `json:"file_type"` // Type: "lsa_policy", "auth_packages", "domain_info", "secrets_index"
 }
 
 // LSAError represents an error that occurred during collection.
@@ -36,9 +39,9 @@ type LSAManifest struct {
 }
 
 // NewLSAManifest creates a new LSA manifest with basic information.
-func NewLSAManifest(hostname string) *LSAManifest {
+func NewLSAManifest(ctx context.Context, hostname string) *LSAManifest {
 	return &LSAManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]LSAItem, 0),
@@ -56,7 +59,7 @@ func (lm *LSAManifest) AddItem(path string, size int64, sha256 string, truncated
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	lm.CollectedFiles++
@@ -0,0 +1,276 @@
+package win_lsa
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// registryHiveCopy is where the windows/registry module leaves its copy of
+// the SECURITY hive, relative to the artifacts directory.
+var registryHiveCopy = filepath.Join("windows_registry", "windows", "registry", "SECURITY.hiv")
+
+// Keys of the SECURITY hive that are indexed.
+const (
+	secretsKey = `Policy\Secrets`
+	cacheKey   = "Cache"
+)
+
+// cachedLogonValue matches the NL$1..NL$n cached logon slots in the Cache key.
+var cachedLogonValue = regexp.MustCompile(`^NL\$(\d+)$`)
+
+// cachedLogonHeaderSize is the plaintext header of a cached logon record;
+// the user, domain, and verifier that follow it are encrypted with NL$KM.
+const cachedLogonHeaderSize = 96
+
+// LSASecret describes one secret stored under Policy\Secrets. Only the names,
+// sizes, and update times are read; the values stay encrypted.
+type LSASecret struct {
+	Name           string `json:"name"`
+	Kind           string `json:"kind"`              // "machine_account", "dpapi_system", "cached_logon_key", "service_account", "default_password", "other"
+	Service        string `json:"service,omitempty"` // Service whose account password a _SC_ secret holds
+	KeyLastWritten string `json:"key_last_written,omitempty"`
+	CurrentSize    int    `json:"current_size"`           // Encrypted size of CurrVal; 0 when unset
+	CurrentSet     string `json:"current_set,omitempty"`  // CupdTime, when CurrVal last changed
+	PreviousSize   int    `json:"previous_size"`          // Encrypted size of OldVal; 0 when unset
+	PreviousSet    string `json:"previous_set,omitempty"` // OupdTime, when OldVal last changed
+}
+
+// CachedLogon describes one cached domain logon slot in the Cache key. The
+// account name is encrypted with the NL$KM secret, so only its presence,
+// RID, and last update are recorded.
+type CachedLogon struct {
+	Slot            string `json:"slot"` // Value name, e.g. "NL$1"
+	InUse           bool   `json:"in_use"`
+	UserRID         uint32 `json:"user_rid,omitempty"`
+	PrimaryGroupID  uint32 `json:"primary_group_rid,omitempty"`
+	LastWritten     string `json:"last_written,omitempty"` // When the logon was cached
+	UserNameLength  int    `json:"user_name_length,omitempty"`
+	DomainLength    int    `json:"domain_name_length,omitempty"`
+	DNSDomainLength int    `json:"dns_domain_name_length,omitempty"`
+	Size            int    `json:"size"`
+}
+
+// LSASecretsIndex is the structure written to lsa_secrets_index.json.
+type LSASecretsIndex struct {
+	CollectedUTC        string        `json:"collected_utc"`
+	HiveSource          string        `json:"hive_source"` // "registry_module", "copy", or "reg_save"
+	HiveDirty           bool          `json:"hive_dirty"`  // Pending transaction log changes were not applied
+	SecretsLastWritten  string        `json:"secrets_last_written,omitempty"`
+	Secrets             []LSASecret   `json:"secrets"`
+	CacheLastWritten    string        `json:"cache_last_written,omitempty"`
+	CachedLogonCount    int           `json:"cached_logon_count"` // Slots holding a logon
+	CacheIterationCount *uint64       `json:"cache_iteration_count,omitempty"`
+	CachedLogons        []CachedLogon `json:"cached_logons"`
+	Errors              []string      `json:"errors,omitempty"`
+}
+
+// ParseSecretsIndex lists the LSA secrets and cached domain logon slots of a
+// SECURITY hive without decrypting them.
+func ParseSecretsIndex(hive *regf.Hive) (*LSASecretsIndex, error) {
+	index := &LSASecretsIndex{
+		HiveDirty:    hive.Dirty(),
+		Secrets:      make([]LSASecret, 0),
+		CachedLogons: make([]CachedLogon, 0),
+	}
+
+	secrets, secretsErr := hive.OpenKey(secretsKey)
+	if secretsErr == nil {
+		index.SecretsLastWritten = formatTime(secrets.LastWritten)
+		index.Secrets, index.Errors = parseSecrets(secrets)
+	} else if !errors.Is(secretsErr, regf.ErrNotFound) {
+		index.Errors = append(index.Errors, fmt.Sprintf("%s: %v", secretsKey, secretsErr))
+	}
+
+	cache, cacheErr := hive.OpenKey(cacheKey)
+	if cacheErr == nil {
+		index.CacheLastWritten = formatTime(cache.LastWritten)
+		if err := parseCache(cache, index); err != nil {
+			index.Errors = append(index.Errors, fmt.Sprintf("%s: %v", cacheKey, err))
+		}
+	} else if !errors.Is(cacheErr, regf.ErrNotFound) {
+		index.Errors = append(index.Errors, fmt.Sprintf("%s: %v", cacheKey, cacheErr))
+	}
+
+	if secretsErr != nil && cacheErr != nil {
+		return nil, fmt.Errorf("hive has neither %s nor %s; is it a SECURITY hive?", secretsKey, cacheKey)
+	}
+	return index, nil
+}
+
+// parseSecrets reads each secret's CurrVal/OldVal sizes and CupdTime/OupdTime.
+func parseSecrets(secrets *regf.Key) ([]LSASecret, []string) {
+	list := make([]LSASecret, 0)
+	subkeys, err := secrets.Subkeys()
+	if err != nil {
+		return list, []string{fmt.Sprintf("%s: %v", secretsKey, err)}
+	}
+	for _, key := range subkeys {
+		secret := LSASecret{Name: key.Name, KeyLastWritten: formatTime(key.LastWritten)}
+		secret.Kind, secret.Service = secretKind(key.Name)
+		secret.CurrentSize = defaultValueSize(key, "CurrVal")
+		secret.PreviousSize = defaultValueSize(key, "OldVal")
+		secret.CurrentSet = defaultValueTime(key, "CupdTime")
+		secret.PreviousSet = defaultValueTime(key, "OupdTime")
+		list = append(list, secret)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// secretKind classifies a secret by its well-known name.
+func secretKind(name string) (string, string) {
+	upper := strings.ToUpper(name)
+	switch {
+	case upper == "$MACHINE.ACC":
+		return "machine_account", ""
+	case upper == "DPAPI_SYSTEM":
+		return "dpapi_system", ""
+	case upper == "NL$KM":
+		return "cached_logon_key", ""
+	case upper == "DEFAULTPASSWORD":
+		return "default_password", ""
+	case strings.HasPrefix(upper, "_SC_"):
+		return "service_account", name[len("_SC_"):]
+	}
+	return "other", ""
+}
+
+// defaultValueSize returns the size of a secret subkey's default value, or 0
+// when the subkey is absent.
+func defaultValueSize(secret *regf.Key, subkey string) int {
+	key, err := secret.Subkey(subkey)
+	if err != nil {
+		return 0
+	}
+	value, err := key.Value("")
+	if err != nil {
+		return 0
+	}
+	return len(value.Data)
+}
+
+// defaultValueTime decodes the FILETIME held in a secret subkey's default value.
+func defaultValueTime(secret *regf.Key, subkey string) string {
+	key, err := secret.Subkey(subkey)
+	if err != nil {
+		return ""
+	}
+	value, err := key.Value("")
+	if err != nil || len(value.Data) < 8 {
+		return ""
+	}
+	return formatTime(winutil.FiletimeToUTC(binary.LittleEndian.Uint64(value.Data)))
+}
+
+// parseCache reads the plaintext header of every NL$n cached logon slot.
+func parseCache(cache *regf.Key, index *LSASecretsIndex) error {
+	values, err := cache.Values()
+	if err != nil {
+		return err
+	}
+	for _, value := range values {
+		if strings.EqualFold(value.Name, "NL$IterationCount") {
+			if n, ok := value.Uint64(); ok {
+				index.CacheIterationCount = &n
+			}
+			continue
+		}
+		if !cachedLogonValue.MatchString(strings.ToUpper(value.Name)) {
+			continue
+		}
+		logon := ParseCachedLogon(value.Data)
+		logon.Slot = value.Name
+		if logon.InUse {
+			index.CachedLogonCount++
+		}
+		index.CachedLogons = append(index.CachedLogons, logon)
+	}
+
+	sort.Slice(index.CachedLogons, func(i, j int) bool {
+		a, _ := strconv.Atoi(index.CachedLogons[i].Slot[len("NL$"):])
+		b, _ := strconv.Atoi(index.CachedLogons[j].Slot[len("NL$"):])
+		return a < b
+	})
+	return nil
+}
+
+// ParseCachedLogon decodes the plaintext header of a cached logon record. An
+// empty slot has a zero user name length.
+func ParseCachedLogon(data []byte) CachedLogon {
+	logon := CachedLogon{Size: len(data)}
+	if len(data) < cachedLogonHeaderSize {
+		return logon
+	}
+	logon.UserNameLength = int(binary.LittleEndian.Uint16(data[0:2]))
+	logon.InUse = logon.UserNameLength > 0
+	if !logon.InUse {
+		return logon
+	}
+	logon.DomainLength = int(binary.LittleEndian.Uint16(data[2:4]))
+	logon.UserRID = binary.LittleEndian.Uint32(data[16:20])
+	logon.PrimaryGroupID = binary.LittleEndian.Uint32(data[20:24])
+	logon.LastWritten = formatTime(winutil.FiletimeToUTC(binary.LittleEndian.Uint64(data[32:40])))
+	logon.DNSDomainLength = int(binary.LittleEndian.Uint16(data[60:62]))
+	return logon
+}
+
+// formatTime formats a time as RFC3339, or "" when unset.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return winutil.FormatTime(t)
+}
+
+// WriteSecretsIndex parses the SECURITY hive at hivePath and writes
+// lsa_secrets_index.json to outDir.
+func WriteSecretsIndex(ctx context.Context, hivePath, hiveSource, outDir string, manifest *LSAManifest) error {
+	hive, err := regf.Open(hivePath)
+	if err != nil {
+		return err
+	}
+	defer hive.Close()
+
+	index, err := ParseSecretsIndex(hive)
+	if err != nil {
+		return err
+	}
+	index.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+	index.HiveSource = hiveSource
+
+	outputPath := filepath.Join(outDir, "lsa_secrets_index.json")
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal LSA secrets index: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write LSA secrets index: %w", err)
+	}
+	manifest.IncrementTotalFiles()
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat LSA secrets index: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash LSA secrets index: %w", err)
+	}
+	note := fmt.Sprintf("LSA secret names and cached logon slots from the SECURITY hive, not decrypted (%d secrets, %d cached logons)", len(index.Secrets), index.CachedLogonCount)
+	manifest.AddItem("lsa_secrets_index.json", stat.Size(), sha256Hex, false, stat.ModTime(), "secrets_index", note)
+
+	return nil
+}
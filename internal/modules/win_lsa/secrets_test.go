@@ -0,0 +1,165 @@
+package win_lsa
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+)
+
+// secretValue is the encrypted blob stored as a secret's CurrVal or OldVal;
+// its marker must never reach the index.
+func secretValue(marker string, size int) []byte {
+	data := bytes.Repeat([]byte{0xa5}, size)
+	copy(data[16:], marker)
+	return data
+}
+
+// secret builds a Policy\Secrets subkey. A zero previous time leaves OldVal
+// and OupdTime out, as for a secret that was set only once.
+func secret(name string, written, current, previous time.Time) *regftest.Key {
+	key := &regftest.Key{Name: name, LastWritten: written, Subkeys: []*regftest.Key{
+		{Name: "CurrVal", Values: []regftest.Value{regftest.Binary("", secretValue("CURRENT:"+name, 64))}},
+		{Name: "CupdTime", Values: []regftest.Value{regftest.Binary("", binary.LittleEndian.AppendUint64(nil, regftest.Filetime(current)))}},
+		{Name: "SecDesc", Values: []regftest.Value{regftest.Binary("", make([]byte, 60))}},
+	}}
+	if !previous.IsZero() {
+		key.Subkeys = append(key.Subkeys,
+			&regftest.Key{Name: "OldVal", Values: []regftest.Value{regftest.Binary("", secretValue("PREVIOUS:"+name, 48))}},
+			&regftest.Key{Name: "OupdTime", Values: []regftest.Value{regftest.Binary("", binary.LittleEndian.AppendUint64(nil, regftest.Filetime(previous)))}},
+		)
+	}
+	return key
+}
+
+// cachedLogon returns an NL$n record for a user with the given RID, cached at
+// t, with the encrypted part filled with a marker.
+func cachedLogon(rid uint32, t time.Time) []byte {
+	data := make([]byte, cachedLogonHeaderSize, cachedLogonHeaderSize+128)
+	binary.LittleEndian.PutUint16(data[0:], 10) // alice, in UTF-16
+	binary.LittleEndian.PutUint16(data[2:], 8)  // CORP
+	binary.LittleEndian.PutUint32(data[16:], rid)
+	binary.LittleEndian.PutUint32(data[20:], 513)
+	binary.LittleEndian.PutUint64(data[32:], regftest.Filetime(t))
+	binary.LittleEndian.PutUint16(data[60:], 32) // corp.example.com
+	return append(data, secretValue("CACHED:alice", 128)...)
+}
+
+var (
+	secretsWritten = time.Date(2024, 2, 27, 9, 30, 0, 0, time.UTC)
+	autoLogonSet   = time.Date(2024, 2, 27, 9, 29, 58, 0, time.UTC)
+	serviceSet     = time.Date(2023, 11, 2, 14, 5, 12, 0, time.UTC)
+	serviceReset   = time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	keyCreated     = time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	logonCached    = time.Date(2024, 2, 28, 7, 45, 31, 0, time.UTC)
+)
+
+func writeSecurityHive(t *testing.T) string {
+	t.Helper()
+	return regftest.WriteFile(t, "SECURITY", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Policy", Subkeys: []*regftest.Key{{Name: "Secrets", LastWritten: secretsWritten, Subkeys: []*regftest.Key{
+			secret("DefaultPassword", secretsWritten, autoLogonSet, time.Time{}),
+			secret("_SC_BackupAgent", serviceReset, serviceReset, serviceSet),
+			secret("NL$KM", keyCreated, keyCreated, keyCreated),
+		}}}},
+		{Name: "Cache", LastWritten: logonCached, Values: []regftest.Value{
+			regftest.DWORD("NL$IterationCount", 10240),
+			regftest.Binary("NL$2", make([]byte, cachedLogonHeaderSize+64)),
+			regftest.Binary("NL$1", cachedLogon(1104, logonCached)),
+			regftest.Binary("NL$10", make([]byte, 8)),
+		}},
+	}})
+}
+
+func TestParseSecretsIndex(t *testing.T) {
+	hive, err := regf.Open(writeSecurityHive(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hive.Close()
+	index, err := ParseSecretsIndex(hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.HiveDirty || len(index.Errors) != 0 || index.SecretsLastWritten != "2024-02-27T09:30:00Z" || index.CacheLastWritten != "2024-02-28T07:45:31Z" {
+		t.Fatalf("index = %+v", index)
+	}
+
+	want := []LSASecret{
+		{Name: "DefaultPassword", Kind: "default_password", KeyLastWritten: "2024-02-27T09:30:00Z", CurrentSize: 64, CurrentSet: "2024-02-27T09:29:58Z"},
+		{Name: "NL$KM", Kind: "cached_logon_key", KeyLastWritten: "2022-06-01T10:00:00Z", CurrentSize: 64, CurrentSet: "2022-06-01T10:00:00Z", PreviousSize: 48, PreviousSet: "2022-06-01T10:00:00Z"},
+		{Name: "_SC_BackupAgent", Kind: "service_account", Service: "BackupAgent", KeyLastWritten: "2024-01-15T08:00:00Z", CurrentSize: 64, CurrentSet: "2024-01-15T08:00:00Z", PreviousSize: 48, PreviousSet: "2023-11-02T14:05:12Z"},
+	}
+	if !reflect.DeepEqual(index.Secrets, want) {
+		t.Fatalf("secrets = %+v\nwant %+v", index.Secrets, want)
+	}
+
+	// Slots are ordered by number; the short one is listed but not decoded
+	if index.CacheIterationCount == nil || *index.CacheIterationCount != 10240 || index.CachedLogonCount != 1 {
+		t.Fatalf("cache = %v, %d logons", index.CacheIterationCount, index.CachedLogonCount)
+	}
+	wantLogons := []CachedLogon{
+		{Slot: "NL$1", InUse: true, UserRID: 1104, PrimaryGroupID: 513, LastWritten: "2024-02-28T07:45:31Z", UserNameLength: 10, DomainLength: 8, DNSDomainLength: 32, Size: cachedLogonHeaderSize + 128},
+		{Slot: "NL$2", Size: cachedLogonHeaderSize + 64},
+		{Slot: "NL$10", Size: 8},
+	}
+	if !reflect.DeepEqual(index.CachedLogons, wantLogons) {
+		t.Fatalf("cached logons = %+v\nwant %+v", index.CachedLogons, wantLogons)
+	}
+}
+
+func TestWriteSecretsIndexLeavesValuesOut(t *testing.T) {
+	outDir := t.TempDir()
+	manifest := NewLSAManifest(context.Background(), "WS-0142")
+	if err := WriteSecretsIndex(context.Background(), writeSecurityHive(t), "copy", outDir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "lsa_secrets_index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Items) != 1 || manifest.Items[0].Path != "lsa_secrets_index.json" {
+		t.Fatalf("manifest items = %+v", manifest.Items)
+	}
+
+	// No encoding of any secret value, cached logon, or part of one appears
+	for _, marker := range []string{"CURRENT:DefaultPassword", "PREVIOUS:_SC_BackupAgent", "CURRENT:NL$KM", "CACHED:alice"} {
+		for _, encoded := range []string{
+			marker,
+			hex.EncodeToString([]byte(marker)),
+			strings.ToUpper(hex.EncodeToString([]byte(marker))),
+			base64.StdEncoding.EncodeToString([]byte(marker)),
+		} {
+			if bytes.Contains(data, []byte(encoded)) {
+				t.Errorf("index contains %q of secret %s", encoded, marker)
+			}
+		}
+	}
+	// Nor the filler around the markers, whatever the alignment
+	for _, filler := range []string{"a5a5a5a5", "A5A5A5A5", "paWl", "6Wl", "lpa"} {
+		if bytes.Contains(data, []byte(filler)) {
+			t.Errorf("index contains secret bytes %q", filler)
+		}
+	}
+}
+
+func TestParseSecretsIndexRejectsOtherHives(t *testing.T) {
+	hive, err := regf.Open(regftest.WriteFile(t, "SAM", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{regftest.Path(`SAM\Domains\Account`)}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hive.Close()
+	if _, err := ParseSecretsIndex(hive); err == nil || !strings.Contains(err.Error(), "SECURITY hive") {
+		t.Fatalf("ParseSecretsIndex of a SAM hive = %v", err)
+	}
+}
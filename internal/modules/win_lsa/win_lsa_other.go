@@ -19,6 +19,21 @@ func (w *WinLSA) Name() string {
 	return "windows/lsa"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinLSA) Describe() string {
+	return "LSA policy and authentication"
+}
+
+// DependsOn lists the modules whose output this module reads.
+func (w *WinLSA) DependsOn() []string {
+	return []string{"windows/registry"}
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinLSA) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinLSA) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
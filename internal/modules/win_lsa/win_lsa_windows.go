@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"cryptkeeper/internal/regf"
 	"cryptkeeper/internal/winutil"
 )
 
@@ -24,6 +25,22 @@ func (w *WinLSA) Name() string {
 	return "windows/lsa"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinLSA) Describe() string {
+	return "LSA policy and authentication"
+}
+
+// DependsOn lists the modules whose output this module reads: the SECURITY
+// hive copy made by windows/registry.
+func (w *WinLSA) DependsOn() []string {
+	return []string{"windows/registry"}
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinLSA) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers LSA Secrets and authentication-related information.
 func (w *WinLSA) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/lsa subdirectory
@@ -33,13 +50,13 @@ func (w *WinLSA) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewLSAManifest(hostname)
+	manifest := NewLSAManifest(ctx, hostname)
 
 	// Collect LSA policy information
 	if err := w.collectLSAPolicy(ctx, lsaDir, manifest); err != nil {
@@ -56,6 +73,11 @@ func (w *WinLSA) Collect(ctx context.Context, outDir string) error {
 		manifest.AddError("domain_info", fmt.Sprintf("Failed to collect domain info: %v", err))
 	}
 
+	// Index secret names and cached logons from the SECURITY hive
+	if err := w.writeSecretsIndex(ctx, filepath.Join(filepath.Dir(outDir), registryHiveCopy), lsaDir, manifest); err != nil {
+		manifest.AddError("lsa_secrets_index.json", err.Error())
+	}
+
 	// Write manifest
 	manifestPath := filepath.Join(lsaDir, "manifest.json")
 	if err := manifest.WriteManifest(manifestPath); err != nil {
@@ -110,7 +132,7 @@ func (w *WinLSA) collectLSAPolicy(ctx context.Context, outDir string, manifest *
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("lsa_policy.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "lsa_policy", "LSA policy and security settings information")
 			manifest.IncrementTotalFiles()
 		}
@@ -173,7 +195,7 @@ func (w *WinLSA) collectAuthPackages(ctx context.Context, outDir string, manifes
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("auth_packages.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "auth_packages", "Authentication packages and security support providers")
 			manifest.IncrementTotalFiles()
 		}
@@ -244,11 +266,50 @@ func (w *WinLSA) collectDomainInfo(ctx context.Context, outDir string, manifest
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("domain_info.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "domain_info", "Domain membership and trust relationship information")
 			manifest.IncrementTotalFiles()
 		}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// writeSecretsIndex writes lsa_secrets_index.json from the registry module's
+// SECURITY hive copy at registryCopy when it passes validation; otherwise a
+// private copy is kept outside the artifacts directory and removed after
+// parsing.
+func (w *WinLSA) writeSecretsIndex(ctx context.Context, registryCopy, outDir string, manifest *LSAManifest) error {
+	hivePath := registryCopy
+	hiveSource := "registry_module"
+	if !regf.CheckFile(registryCopy).Valid {
+		tempDir, err := os.MkdirTemp("", "cryptkeeper-lsa-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		hivePath = filepath.Join(tempDir, "SECURITY")
+		if hiveSource, err = acquireSecurityHive(ctx, hivePath); err != nil {
+			return err
+		}
+	}
+
+	return WriteSecretsIndex(ctx, hivePath, hiveSource, outDir, manifest)
+}
+
+// acquireSecurityHive copies the SECURITY hive to destPath, falling back to
+// reg save when the file is locked. It returns the method used.
+func acquireSecurityHive(ctx context.Context, destPath string) (string, error) {
+	srcPath := filepath.Join(winutil.SystemRoot(), "System32", "config", "SECURITY")
+	_, _, copyErr := winutil.CopyFile(ctx, srcPath, destPath)
+	if copyErr == nil {
+		return "copy", nil
+	}
+
+	os.Remove(destPath)
+	if err := winutil.ExportRegistryHive(ctx, `HKLM\SECURITY`, destPath); err != nil {
+		return "", fmt.Errorf("failed to acquire SECURITY hive (copy: %v; reg save: %w)", copyErr, err)
+	}
+	return "reg_save", nil
+}
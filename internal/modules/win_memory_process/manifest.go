@@ -2,9 +2,12 @@
 package win_memory_process
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // MemoryProcessItem represents a collected memory/process artifact file.
@@ -36,9 +39,9 @@ type MemoryProcessManifest struct {
 }
 
 // NewMemoryProcessManifest creates a new memory/process manifest with basic information.
-func NewMemoryProcessManifest(hostname string) *MemoryProcessManifest {
+func NewMemoryProcessManifest(ctx context.Context, hostname string) *MemoryProcessManifest {
 	return &MemoryProcessManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]MemoryProcessItem, 0),
@@ -56,7 +59,7 @@ func (mm *MemoryProcessManifest) AddItem(path string, size int64, sha256 string,
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	mm.CollectedFiles++
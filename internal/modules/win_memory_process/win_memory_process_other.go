@@ -14,11 +14,24 @@ func NewWinMemoryProcess() *WinMemoryProcess {
 	return &WinMemoryProcess{}
 }
 
+// SetPagefileCap is a no-op on non-Windows systems.
+func (w *WinMemoryProcess) SetPagefileCap(capMB int64) {}
+
 // Name returns the module's identifier.
 func (w *WinMemoryProcess) Name() string {
 	return "windows/memory_process"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinMemoryProcess) Describe() string {
+	return "Memory and process artifacts"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinMemoryProcess) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinMemoryProcess) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
@@ -13,18 +13,36 @@ import (
 )
 
 // WinMemoryProcess represents the Windows memory/process collection module.
-type WinMemoryProcess struct{}
+type WinMemoryProcess struct {
+	pagefileCapMB int64 // Largest pagefile, swapfile, or hiberfil copied; 0 disables copying
+}
 
 // NewWinMemoryProcess creates a new Windows memory/process collection module.
 func NewWinMemoryProcess() *WinMemoryProcess {
 	return &WinMemoryProcess{}
 }
 
+// SetPagefileCap sets the largest virtual memory file, in MB, that is copied
+// rather than only described.
+func (w *WinMemoryProcess) SetPagefileCap(capMB int64) {
+	w.pagefileCapMB = capMB
+}
+
 // Name returns the module's identifier.
 func (w *WinMemoryProcess) Name() string {
 	return "windows/memory_process"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinMemoryProcess) Describe() string {
+	return "Memory and process artifacts"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinMemoryProcess) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers Windows memory and process artifacts including virtual memory files and process information.
 func (w *WinMemoryProcess) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/memory_process subdirectory
@@ -34,14 +52,14 @@ func (w *WinMemoryProcess) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewMemoryProcessManifest(hostname)
-	constraints := winutil.NewSizeConstraints()
+	manifest := NewMemoryProcessManifest(ctx, hostname)
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Collect process information (instead of full memory dumps due to size)
 	if err := w.collectProcessInformation(ctx, memoryDir, manifest); err != nil {
@@ -58,7 +76,7 @@ func (w *WinMemoryProcess) Collect(ctx context.Context, outDir string) error {
 		manifest.AddError("memory_information", fmt.Sprintf("Failed to collect memory information: %v", err))
 	}
 
-	// Collect virtual memory files (pagefile, swapfile, hiberfil) - metadata only due to size
+	// Collect virtual memory files (pagefile, swapfile, hiberfil) - metadata only unless under the pagefile cap
 	if err := w.collectVirtualMemoryInfo(ctx, memoryDir, manifest, constraints); err != nil {
 		manifest.AddError("virtual_memory_files", fmt.Sprintf("Failed to collect virtual memory files: %v", err))
 	}
@@ -95,7 +113,7 @@ func (w *WinMemoryProcess) collectProcessInformation(ctx context.Context, outDir
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash process list output: %w", err)
 	}
@@ -110,7 +128,7 @@ func (w *WinMemoryProcess) collectProcessInformation(ctx context.Context, outDir
 	if err == nil {
 		if err := os.WriteFile(outputPath2, output2, 0644); err == nil {
 			if stat2, err := os.Stat(outputPath2); err == nil {
-				if sha256Hex2, err := winutil.HashFile(outputPath2); err == nil {
+				if sha256Hex2, err := winutil.HashFile(ctx, outputPath2); err == nil {
 					manifest.AddItem("tasklist_services.txt", stat2.Size(), sha256Hex2, false, stat2.ModTime(), "process_list", "Process list with services from tasklist /svc")
 					manifest.IncrementTotalFiles()
 				}
@@ -145,7 +163,7 @@ func (w *WinMemoryProcess) collectHandleInformation(ctx context.Context, outDir
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash handles output: %w", err)
 	}
@@ -187,7 +205,7 @@ func (w *WinMemoryProcess) collectMemoryInformation(ctx context.Context, outDir
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash memory info output: %w", err)
 	}
@@ -198,13 +216,11 @@ func (w *WinMemoryProcess) collectMemoryInformation(ctx context.Context, outDir
 	return nil
 }
 
-// collectVirtualMemoryInfo collects information about virtual memory files (metadata only).
+// collectVirtualMemoryInfo collects information about virtual memory files,
+// copying those no larger than the pagefile cap.
 func (w *WinMemoryProcess) collectVirtualMemoryInfo(ctx context.Context, outDir string, manifest *MemoryProcessManifest, constraints *winutil.SizeConstraints) error {
 	// Get system drive
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	// Check for virtual memory files and collect metadata
 	virtualMemoryFiles := []struct {
@@ -227,7 +243,7 @@ func (w *WinMemoryProcess) collectVirtualMemoryInfo(ctx context.Context, outDir
 			infoContent += fmt.Sprintf("Description: %s\n", vmFile.desc)
 			infoContent += fmt.Sprintf("Size: %d bytes (%.2f GB)\n", stat.Size(), float64(stat.Size())/1024/1024/1024)
 			infoContent += fmt.Sprintf("Modified: %s\n", stat.ModTime().Format(time.RFC3339))
-			infoContent += fmt.Sprintf("Note: File not copied due to size constraints\n\n")
+			infoContent += fmt.Sprintf("Note: %s\n\n", w.copyVirtualMemoryFile(ctx, filePath, outDir, stat, manifest))
 		} else {
 			infoContent += fmt.Sprintf("File: %s\n", vmFile.filename)
 			infoContent += fmt.Sprintf("Status: Not found or not accessible\n\n")
@@ -242,10 +258,33 @@ func (w *WinMemoryProcess) collectVirtualMemoryInfo(ctx context.Context, outDir
 
 	// Add info file to manifest
 	if stat, err := os.Stat(infoPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(infoPath); err == nil {
-			manifest.AddItem("virtual_memory_files_info.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "pagefile", "Virtual memory files metadata (files not copied due to size)")
+		if sha256Hex, err := winutil.HashFile(ctx, infoPath); err == nil {
+			manifest.AddItem("virtual_memory_files_info.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "pagefile", "Virtual memory files metadata")
 		}
 	}
 
 	return nil
+}
+
+// copyVirtualMemoryFile copies a virtual memory file no larger than the
+// pagefile cap and returns the note recorded for it. The system holds these
+// files open, so the copy falls back to the shadow copy, resuming after the
+// checkpoint of a live attempt that failed partway.
+func (w *WinMemoryProcess) copyVirtualMemoryFile(ctx context.Context, filePath, outDir string, stat os.FileInfo, manifest *MemoryProcessManifest) string {
+	if w.pagefileCapMB <= 0 || stat.Size() > w.pagefileCapMB*1024*1024 {
+		return "File not copied due to size constraints"
+	}
+
+	destPath := filepath.Join(outDir, stat.Name())
+	size, sha256Hex, source, err := winutil.CopyFileOrShadow(ctx, winutil.SnapshotPath(filePath), destPath)
+	if err != nil {
+		manifest.AddError(filePath, fmt.Sprintf("Failed to copy %s: %v", stat.Name(), err))
+		return fmt.Sprintf("Copy failed: %v", err)
+	}
+	note := fmt.Sprintf("%s copied from %s", stat.Name(), filePath)
+	if source == "shadow_copy" {
+		note += " via shadow copy"
+	}
+	manifest.AddItem(stat.Name(), size, sha256Hex, false, stat.ModTime(), "pagefile", note)
+	return "Copied as " + stat.Name()
 }
\ No newline at end of file
@@ -2,9 +2,12 @@
 package win_mft
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // MFTItem represents a collected MFT-related file.
@@ -37,9 +40,9 @@ type MFTManifest struct {
 }
 
 // NewMFTManifest creates a new MFT manifest with basic information.
-func NewMFTManifest(hostname string) *MFTManifest {
+func NewMFTManifest(ctx context.Context, hostname string) *MFTManifest {
 	return &MFTManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]MFTItem, 0),
@@ -58,7 +61,7 @@ func (mm *MFTManifest) AddItem(path string, size int64, sha256 string, truncated
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	mm.CollectedFiles++
@@ -14,11 +14,24 @@ func NewWinMFT() *WinMFT {
 	return &WinMFT{}
 }
 
+// SetRawMFTCap is a no-op on non-Windows systems.
+func (w *WinMFT) SetRawMFTCap(capMB int64) {}
+
 // Name returns the module's identifier.
 func (w *WinMFT) Name() string {
 	return "windows/mft"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinMFT) Describe() string {
+	return "NTFS Master File Table metadata"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinMFT) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinMFT) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
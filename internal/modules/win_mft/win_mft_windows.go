@@ -13,18 +13,36 @@ import (
 )
 
 // WinMFT represents the NTFS Master File Table collection module.
-type WinMFT struct{}
+type WinMFT struct {
+	rawMFTCapMB int64 // Largest $MFT copied; 0 disables copying
+}
 
 // NewWinMFT creates a new NTFS Master File Table collection module.
 func NewWinMFT() *WinMFT {
 	return &WinMFT{}
 }
 
+// SetRawMFTCap sets the largest $MFT, in MB, that is copied rather than only
+// described.
+func (w *WinMFT) SetRawMFTCap(capMB int64) {
+	w.rawMFTCapMB = capMB
+}
+
 // Name returns the module's identifier.
 func (w *WinMFT) Name() string {
 	return "windows/mft"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinMFT) Describe() string {
+	return "NTFS Master File Table metadata"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinMFT) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers NTFS Master File Table records and metadata.
 func (w *WinMFT) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/mft subdirectory
@@ -34,13 +52,13 @@ func (w *WinMFT) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewMFTManifest(hostname)
+	manifest := NewMFTManifest(ctx, hostname)
 
 	// Collect NTFS volumes information
 	if err := w.collectVolumeInfo(ctx, mftDir, manifest); err != nil {
@@ -52,6 +70,13 @@ func (w *WinMFT) Collect(ctx context.Context, outDir string) error {
 		manifest.AddError("mft_metadata", fmt.Sprintf("Failed to collect MFT metadata: %v", err))
 	}
 
+	// Copy the system drive's raw $MFT when it is under the raw MFT cap
+	if w.rawMFTCapMB > 0 {
+		if err := w.collectRawMFT(ctx, mftDir, manifest); err != nil {
+			manifest.AddError("raw_mft", fmt.Sprintf("Failed to copy raw MFT: %v", err))
+		}
+	}
+
 	// Collect file system information
 	if err := w.collectFileSystemInfo(ctx, mftDir, manifest); err != nil {
 		manifest.AddError("filesystem_info", fmt.Sprintf("Failed to collect filesystem info: %v", err))
@@ -114,7 +139,7 @@ func (w *WinMFT) collectVolumeInfo(ctx context.Context, outDir string, manifest
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("volume_info.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "mft_parsed", "NTFS volume and filesystem information")
 			manifest.IncrementTotalFiles()
 		}
@@ -132,10 +157,7 @@ func (w *WinMFT) collectMFTMetadata(ctx context.Context, outDir string, manifest
 	output += "This collection focuses on MFT-related metadata accessible via standard APIs.\n\n"
 
 	// Use dir command to get file metadata from root directories
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	// Get detailed directory listings for key system directories
 	keyDirs := []string{
@@ -161,7 +183,7 @@ func (w *WinMFT) collectMFTMetadata(ctx context.Context, outDir string, manifest
 
 	// Get file allocation table info
 	output += "=== File Allocation Information ===\n"
-	fsstatCmd := []string{"/C", fmt.Sprintf("fsutil fsinfo statistics %s", systemDrive)}
+	fsstatCmd := []string{"/C", fmt.Sprintf("fsutil fsinfo statistics %s", winutil.LiveSystemDrive())}
 	if result, err := winutil.RunCommandWithOutput(ctx, "cmd", fsstatCmd); err == nil {
 		output += string(result)
 	} else {
@@ -175,7 +197,7 @@ func (w *WinMFT) collectMFTMetadata(ctx context.Context, outDir string, manifest
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("mft_metadata.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "mft_parsed", "MFT-related metadata and file system statistics")
 			manifest.IncrementTotalFiles()
 		}
@@ -184,6 +206,33 @@ func (w *WinMFT) collectMFTMetadata(ctx context.Context, outDir string, manifest
 	return nil
 }
 
+// collectRawMFT copies the system drive's $MFT. It is usually hundreds of
+// megabytes and held open by NTFS, so the copy falls back to the shadow copy,
+// resuming after the checkpoint of a live attempt that failed partway.
+func (w *WinMFT) collectRawMFT(ctx context.Context, outDir string, manifest *MFTManifest) error {
+	mftPath := winutil.SnapshotPath(filepath.Join(winutil.SystemDrive()+`\`, "$MFT"))
+	stat, err := os.Stat(mftPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat $MFT: %w", err)
+	}
+	manifest.IncrementTotalFiles()
+	if stat.Size() > w.rawMFTCapMB*1024*1024 {
+		return fmt.Errorf("$MFT is %d bytes, larger than the %d MB raw MFT cap", stat.Size(), w.rawMFTCapMB)
+	}
+
+	destPath := filepath.Join(outDir, "MFT.bin")
+	size, sha256Hex, source, err := winutil.CopyFileOrShadow(ctx, mftPath, destPath)
+	if err != nil {
+		return err
+	}
+	note := fmt.Sprintf("Raw $MFT of %s", winutil.SystemDrive())
+	if source == "shadow_copy" {
+		note += " via shadow copy"
+	}
+	manifest.AddItem("MFT.bin", size, sha256Hex, false, stat.ModTime(), "mft_raw", note)
+	return nil
+}
+
 // collectFileSystemInfo collects general file system information.
 func (w *WinMFT) collectFileSystemInfo(ctx context.Context, outDir string, manifest *MFTManifest) error {
 	outputPath := filepath.Join(outDir, "filesystem_info.txt")
@@ -226,7 +275,7 @@ func (w *WinMFT) collectFileSystemInfo(ctx context.Context, outDir string, manif
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("filesystem_info.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "file_metadata", "General file system and disk information")
 			manifest.IncrementTotalFiles()
 		}
@@ -0,0 +1,160 @@
+package win_modern
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// recentSideloadWindow defines how recent a non-Store install must be to be flagged.
+const recentSideloadWindow = 30 * 24 * time.Hour
+
+// AppxPackage represents a single installed AppX/MSIX package.
+type AppxPackage struct {
+	Name              string   `json:"name"`
+	Publisher         string   `json:"publisher"`
+	Version           string   `json:"version"`
+	PackageFullName   string   `json:"package_full_name"`
+	InstallLocation   string   `json:"install_location"`
+	InstallDate       string   `json:"install_date,omitempty"` // RFC3339, derived from the install folder creation time
+	SignatureKind     string   `json:"signature_kind"`         // "Store", "System", "Developer", "Enterprise", "None"
+	IsDevelopmentMode bool     `json:"is_development_mode"`    // Registered via Add-AppxPackage -Register (sideloaded)
+	IsFramework       bool     `json:"is_framework"`
+	NonRemovable      bool     `json:"non_removable"`
+	Flags             []string `json:"flags,omitempty"` // Suspicious indicators
+}
+
+// AppxProvisionedPackage represents a package provisioned for all users.
+type AppxProvisionedPackage struct {
+	DisplayName     string `json:"display_name"`
+	Version         string `json:"version"`
+	PackageName     string `json:"package_name"`
+	PublisherID     string `json:"publisher_id"`
+	InstallLocation string `json:"install_location"`
+}
+
+// AppxInventory is the structured content written to appx_packages.json.
+type AppxInventory struct {
+	CollectedUTC        string                   `json:"collected_utc"`
+	Packages            []AppxPackage            `json:"packages"`
+	ProvisionedPackages []AppxProvisionedPackage `json:"provisioned_packages"`
+	FlaggedPackages     int                      `json:"flagged_packages"`
+	Errors              []string                 `json:"errors,omitempty"`
+}
+
+// rawAppxPackage mirrors the shape emitted by the Get-AppxPackage PowerShell pipeline.
+type rawAppxPackage struct {
+	Name              string `json:"Name"`
+	Publisher         string `json:"Publisher"`
+	Version           string `json:"Version"`
+	PackageFullName   string `json:"PackageFullName"`
+	InstallLocation   string `json:"InstallLocation"`
+	InstallDate       string `json:"InstallDate"`
+	SignatureKind     string `json:"SignatureKind"`
+	IsDevelopmentMode bool   `json:"IsDevelopmentMode"`
+	IsFramework       bool   `json:"IsFramework"`
+	NonRemovable      bool   `json:"NonRemovable"`
+}
+
+// rawProvisionedPackage mirrors the shape emitted by Get-AppxProvisionedPackage.
+type rawProvisionedPackage struct {
+	DisplayName     string `json:"DisplayName"`
+	Version         string `json:"Version"`
+	PackageName     string `json:"PackageName"`
+	PublisherID     string `json:"PublisherId"`
+	InstallLocation string `json:"InstallLocation"`
+}
+
+// ParseAppxPackages decodes the JSON produced by Get-AppxPackage | ConvertTo-Json and
+// flags non-Store or recently sideloaded packages relative to now.
+func ParseAppxPackages(data []byte, now time.Time) ([]AppxPackage, error) {
+	var raws []rawAppxPackage
+	if err := unmarshalPowerShellJSON(data, &raws); err != nil {
+		return nil, fmt.Errorf("failed to parse Get-AppxPackage output: %w", err)
+	}
+
+	packages := make([]AppxPackage, 0, len(raws))
+	for _, raw := range raws {
+		pkg := AppxPackage{
+			Name:              raw.Name,
+			Publisher:         raw.Publisher,
+			Version:           raw.Version,
+			PackageFullName:   raw.PackageFullName,
+			InstallLocation:   raw.InstallLocation,
+			SignatureKind:     raw.SignatureKind,
+			IsDevelopmentMode: raw.IsDevelopmentMode,
+			IsFramework:       raw.IsFramework,
+			NonRemovable:      raw.NonRemovable,
+		}
+
+		var installed time.Time
+		if raw.InstallDate != "" {
+			if t, err := time.Parse(time.RFC3339, raw.InstallDate); err == nil {
+				installed = t.UTC()
+				pkg.InstallDate = winutil.FormatTime(installed)
+			}
+		}
+
+		pkg.Flags = flagAppxPackage(pkg, installed, now)
+		packages = append(packages, pkg)
+	}
+
+	return packages, nil
+}
+
+// ParseAppxProvisionedPackages decodes the JSON produced by
+// Get-AppxProvisionedPackage -Online | ConvertTo-Json.
+func ParseAppxProvisionedPackages(data []byte) ([]AppxProvisionedPackage, error) {
+	var raws []rawProvisionedPackage
+	if err := unmarshalPowerShellJSON(data, &raws); err != nil {
+		return nil, fmt.Errorf("failed to parse Get-AppxProvisionedPackage output: %w", err)
+	}
+
+	packages := make([]AppxProvisionedPackage, 0, len(raws))
+	for _, raw := range raws {
+		packages = append(packages, AppxProvisionedPackage{
+			DisplayName:     raw.DisplayName,
+			Version:         raw.Version,
+			PackageName:     raw.PackageName,
+			PublisherID:     raw.PublisherID,
+			InstallLocation: raw.InstallLocation,
+		})
+	}
+
+	return packages, nil
+}
+
+// flagAppxPackage returns the suspicious indicators for a package.
+func flagAppxPackage(pkg AppxPackage, installed, now time.Time) []string {
+	var flags []string
+
+	nonStore := !strings.EqualFold(pkg.SignatureKind, "Store") && !strings.EqualFold(pkg.SignatureKind, "System")
+	if nonStore {
+		flags = append(flags, "non_store_source")
+	}
+	if pkg.IsDevelopmentMode {
+		flags = append(flags, "development_mode_sideload")
+	}
+	if (nonStore || pkg.IsDevelopmentMode) && !installed.IsZero() && now.Sub(installed) <= recentSideloadWindow {
+		flags = append(flags, "recently_sideloaded")
+	}
+
+	return flags
+}
+
+// unmarshalPowerShellJSON decodes ConvertTo-Json output, which emits a bare object
+// instead of an array when the pipeline yields a single item.
+func unmarshalPowerShellJSON(data []byte, v interface{}) error {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] == '{' {
+		data = append(append([]byte("["), data...), ']')
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,83 @@
+package win_modern
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// sampleAppxPackages is Get-AppxPackage output as shaped by appxPackagesScript:
+// a Store app, a system app, a recently registered developer package and an
+// older enterprise-signed line-of-business app.
+const sampleAppxPackages = "\xef\xbb\xbf" + `[
+{"Name":"Microsoft.WindowsCalculator","Publisher":"CN=Microsoft Corporation, O=Microsoft Corporation, L=Redmond, S=Washington, C=US","Version":"11.2307.4.0","PackageFullName":"Microsoft.WindowsCalculator_11.2307.4.0_x64__8wekyb3d8bbwe","InstallLocation":"C:\\Program Files\\WindowsApps\\Microsoft.WindowsCalculator_11.2307.4.0_x64__8wekyb3d8bbwe","IsDevelopmentMode":false,"IsFramework":false,"NonRemovable":false,"SignatureKind":"Store","InstallDate":"2024-01-10T08:12:44Z"},
+{"Name":"Microsoft.Windows.ShellExperienceHost","Publisher":"CN=Microsoft Windows, O=Microsoft Corporation, L=Redmond, S=Washington, C=US","Version":"10.0.19041.3636","PackageFullName":"Microsoft.Windows.ShellExperienceHost_10.0.19041.3636_neutral_neutral_cw5n1h2txyewy","InstallLocation":"C:\\Windows\\SystemApps\\ShellExperienceHost_cw5n1h2txyewy","IsDevelopmentMode":false,"IsFramework":false,"NonRemovable":true,"SignatureKind":"System","InstallDate":null},
+{"Name":"UpdaterHelper","Publisher":"CN=Contoso Dev","Version":"1.0.0.0","PackageFullName":"UpdaterHelper_1.0.0.0_x64__p2wxv0ry6mvxg","InstallLocation":"C:\\Users\\alice\\AppData\\Local\\Temp\\pkg","IsDevelopmentMode":true,"IsFramework":false,"NonRemovable":false,"SignatureKind":"Developer","InstallDate":"2024-02-27T22:41:05Z"},
+{"Name":"Contoso.Timesheets","Publisher":"CN=Contoso Ltd","Version":"3.4.1.0","PackageFullName":"Contoso.Timesheets_3.4.1.0_x64__4q9r7v6b3ehyt","InstallLocation":"C:\\Program Files\\WindowsApps\\Contoso.Timesheets_3.4.1.0_x64__4q9r7v6b3ehyt","IsDevelopmentMode":false,"IsFramework":false,"NonRemovable":false,"SignatureKind":"Enterprise","InstallDate":"2023-06-01T09:00:00Z"}
+]`
+
+func TestParseAppxPackages(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	packages, err := ParseAppxPackages([]byte(sampleAppxPackages), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) != 4 {
+		t.Fatalf("parsed %d packages, want 4", len(packages))
+	}
+
+	calculator := packages[0]
+	if calculator.Name != "Microsoft.WindowsCalculator" || calculator.Version != "11.2307.4.0" ||
+		calculator.SignatureKind != "Store" || calculator.InstallDate != "2024-01-10T08:12:44Z" {
+		t.Errorf("Store package = %+v", calculator)
+	}
+	if !packages[1].NonRemovable || packages[1].InstallDate != "" {
+		t.Errorf("system package = %+v", packages[1])
+	}
+
+	wantFlags := [][]string{
+		nil,
+		nil,
+		{"non_store_source", "development_mode_sideload", "recently_sideloaded"},
+		{"non_store_source"},
+	}
+	for i, pkg := range packages {
+		if !reflect.DeepEqual(pkg.Flags, wantFlags[i]) {
+			t.Errorf("%s flags = %v, want %v", pkg.Name, pkg.Flags, wantFlags[i])
+		}
+	}
+}
+
+func TestParseAppxPackagesSingleObject(t *testing.T) {
+	// ConvertTo-Json emits a bare object for a one-item pipeline
+	single := `{"Name":"UpdaterHelper","SignatureKind":"None","IsDevelopmentMode":true,"InstallDate":"not a date"}`
+	packages, err := ParseAppxPackages([]byte(single), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) != 1 || packages[0].InstallDate != "" {
+		t.Fatalf("packages = %+v", packages)
+	}
+	// Without an install date the package cannot be called recent
+	if want := []string{"non_store_source", "development_mode_sideload"}; !reflect.DeepEqual(packages[0].Flags, want) {
+		t.Fatalf("flags = %v, want %v", packages[0].Flags, want)
+	}
+
+	if packages, err := ParseAppxPackages([]byte("  \r\n"), time.Now()); err != nil || len(packages) != 0 {
+		t.Fatalf("empty output = %v, %v", packages, err)
+	}
+	if _, err := ParseAppxPackages([]byte("Get-AppxPackage : Access is denied"), time.Now()); err == nil {
+		t.Fatal("PowerShell error text parsed as packages")
+	}
+}
+
+func TestParseAppxProvisionedPackages(t *testing.T) {
+	data := `{"DisplayName":"Microsoft.WindowsCalculator","Version":"2021.2307.4.0","PackageName":"Microsoft.WindowsCalculator_2021.2307.4.0_neutral_~_8wekyb3d8bbwe","PublisherId":"8wekyb3d8bbwe","InstallLocation":"%SYSTEMDRIVE%\\Program Files\\WindowsApps\\Microsoft.WindowsCalculator_2021.2307.4.0_neutral_~_8wekyb3d8bbwe\\AppxMetadata\\AppxBundleManifest.xml"}`
+	packages, err := ParseAppxProvisionedPackages([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) != 1 || packages[0].PublisherID != "8wekyb3d8bbwe" || packages[0].DisplayName != "Microsoft.WindowsCalculator" {
+		t.Fatalf("provisioned packages = %+v", packages)
+	}
+}
@@ -2,9 +2,12 @@
 package win_modern
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // ModernItem represents a collected modern Windows artifact file.
@@ -36,9 +39,9 @@ type ModernManifest struct {
 }
 
 // NewModernManifest creates a new modern artifacts manifest with basic information.
-func NewModernManifest(hostname string) *ModernManifest {
+func NewModernManifest(ctx context.Context, hostname string) *ModernManifest {
 	return &ModernManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]ModernItem, 0),
@@ -56,7 +59,7 @@ func (mm *ModernManifest) AddItem(path string, size int64, sha256 string, trunca
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	mm.CollectedFiles++
@@ -0,0 +1,297 @@
+package win_modern
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// Keys of the SOFTWARE hive read for cloud sync roots and corporate management.
+const (
+	syncRootManagerKey = `Microsoft\Windows\CurrentVersion\Explorer\SyncRootManager`
+	oneDrivePolicyKey  = `Policies\Microsoft\OneDrive`
+	gpoMachineKey      = `Microsoft\Windows\CurrentVersion\Group Policy\DataStore\Machine\0`
+	profileListKey     = `Microsoft\Windows NT\CurrentVersion\ProfileList`
+)
+
+// Account kinds of a OneDrive sync root, taken from its ID.
+const (
+	AccountPersonal = "personal"
+	AccountBusiness = "business"
+)
+
+// SyncRootRecord is one SyncRootManager subkey as read from a hive or reg query.
+type SyncRootRecord struct {
+	ID        string
+	Values    map[string]string // Lowercased value name to data
+	UserRoots map[string]string // User SID to local folder, from UserSyncRoots
+}
+
+// CloudSyncRoot is a cloud provider folder registered with the cloud files API.
+type CloudSyncRoot struct {
+	ID          string   `json:"id"`
+	Provider    string   `json:"provider"`
+	DisplayName string   `json:"display_name,omitempty"`
+	AccountKind string   `json:"account_kind,omitempty"` // personal or business, for OneDrive
+	AccountID   string   `json:"account_id,omitempty"`   // Account or tenant part of the ID
+	SID         string   `json:"sid,omitempty"`
+	User        string   `json:"user,omitempty"`
+	Path        string   `json:"path,omitempty"`
+	Flags       []string `json:"flags,omitempty"`
+}
+
+// CloudSyncRoots is the content of cloud_sync_roots.json.
+type CloudSyncRoots struct {
+	CollectedUTC        string          `json:"collected_utc"`
+	Source              string          `json:"source"` // registry_module, hive_file, or reg_query
+	CorporateIndicators []string        `json:"corporate_indicators"`
+	SyncRoots           []CloudSyncRoot `json:"sync_roots"`
+	FlaggedCount        int             `json:"flagged_count"`
+	Errors              []string        `json:"errors,omitempty"`
+}
+
+// NewCloudSyncRoots returns an empty report.
+func NewCloudSyncRoots() *CloudSyncRoots {
+	return &CloudSyncRoots{
+		CorporateIndicators: make([]string, 0),
+		SyncRoots:           make([]CloudSyncRoot, 0),
+	}
+}
+
+// ReadSyncRootRecords reads the SyncRootManager subkeys of a SOFTWARE hive.
+// A hive without the key has no sync roots.
+func ReadSyncRootRecords(software *regf.Hive) ([]SyncRootRecord, error) {
+	key, err := software.OpenKey(syncRootManagerKey)
+	if err != nil {
+		return nil, nil
+	}
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", syncRootManagerKey, err)
+	}
+	records := make([]SyncRootRecord, 0, len(subkeys))
+	for _, sub := range subkeys {
+		record := SyncRootRecord{ID: sub.Name, Values: hiveStrings(sub), UserRoots: make(map[string]string)}
+		if userRoots, err := sub.Subkey("UserSyncRoots"); err == nil {
+			for sid, path := range hiveStrings(userRoots) {
+				record.UserRoots[strings.ToUpper(sid)] = path
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// hiveStrings returns the string values of a key, keyed by lowercased name.
+func hiveStrings(key *regf.Key) map[string]string {
+	strs := make(map[string]string)
+	values, err := key.Values()
+	if err != nil {
+		return strs
+	}
+	for _, v := range values {
+		if n, ok := v.Uint64(); ok {
+			strs[strings.ToLower(v.Name)] = fmt.Sprintf("%d", n)
+			continue
+		}
+		strs[strings.ToLower(v.Name)] = strings.TrimSpace(v.String())
+	}
+	return strs
+}
+
+// SyncRootRecordsFromRegQuery rebuilds the records from the output of
+// `reg query <SyncRootManager> /s`.
+func SyncRootRecordsFromRegQuery(keys []winutil.RegKey) []SyncRootRecord {
+	byID := make(map[string]*SyncRootRecord)
+	order := make([]string, 0)
+	for _, key := range keys {
+		i := strings.Index(strings.ToLower(key.Path), strings.ToLower(syncRootManagerKey)+`\`)
+		if i < 0 {
+			continue
+		}
+		rest := key.Path[i+len(syncRootManagerKey)+1:]
+		id, sub, _ := strings.Cut(rest, `\`)
+		record, ok := byID[id]
+		if !ok {
+			record = &SyncRootRecord{ID: id, Values: make(map[string]string), UserRoots: make(map[string]string)}
+			byID[id] = record
+			order = append(order, id)
+		}
+		switch {
+		case sub == "":
+			for _, v := range key.Values {
+				record.Values[strings.ToLower(v.Name)] = v.Data
+			}
+		case strings.EqualFold(sub, "UserSyncRoots"):
+			for _, v := range key.Values {
+				record.UserRoots[strings.ToUpper(v.Name)] = v.Data
+			}
+		}
+	}
+	records := make([]SyncRootRecord, 0, len(order))
+	for _, id := range order {
+		records = append(records, *byID[id])
+	}
+	return records
+}
+
+// CorporateIndicators lists signs in a SOFTWARE hive that the machine is
+// managed by an organization: a domain recorded by Group Policy and OneDrive
+// policies such as a tenant allow list.
+func CorporateIndicators(software *regf.Hive) []string {
+	indicators := make([]string, 0)
+	if key, err := software.OpenKey(gpoMachineKey); err == nil {
+		if values := hiveStrings(key); values["domainname"] != "" {
+			indicators = append(indicators, "domain_joined:"+values["domainname"])
+		}
+	}
+	if key, err := software.OpenKey(oneDrivePolicyKey); err == nil {
+		if _, err := key.Subkey("AllowTenantList"); err == nil {
+			indicators = append(indicators, "onedrive_tenant_allow_list")
+		}
+		values := hiveStrings(key)
+		if values["disablepersonalsync"] == "1" {
+			indicators = append(indicators, "onedrive_personal_sync_disabled")
+		}
+		if values["kfmsilentoptin"] != "" {
+			indicators = append(indicators, "onedrive_known_folder_move_tenant:"+values["kfmsilentoptin"])
+		}
+	}
+	return indicators
+}
+
+// ProfileUsers maps the SIDs in a SOFTWARE hive's ProfileList to the last
+// element of each profile path.
+func ProfileUsers(software *regf.Hive) map[string]string {
+	users := make(map[string]string)
+	key, err := software.OpenKey(profileListKey)
+	if err != nil {
+		return users
+	}
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return users
+	}
+	for _, sub := range subkeys {
+		if path := hiveStrings(sub)["profileimagepath"]; path != "" {
+			users[strings.ToUpper(sub.Name)] = filepath.Base(strings.ReplaceAll(path, `\`, "/"))
+		}
+	}
+	return users
+}
+
+// ParseSyncRootID splits a sync root ID of the form
+// Provider!SID!Account, e.g. OneDrive!S-1-5-21-...!Personal|4a1b..., into
+// its provider, SID, and account parts.
+func ParseSyncRootID(id string) (string, string, string) {
+	parts := strings.SplitN(id, "!", 3)
+	switch len(parts) {
+	case 1:
+		return parts[0], "", ""
+	case 2:
+		return parts[0], parts[1], ""
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+// accountKind splits the account part of a OneDrive sync root ID, such as
+// Personal|4a1b... or Business1|contoso..., into its kind and account ID.
+// Other providers' account parts are returned whole as the ID.
+func accountKind(provider, account string) (string, string) {
+	kind, id, ok := strings.Cut(account, "|")
+	if !ok || !strings.EqualFold(provider, "OneDrive") {
+		return "", account
+	}
+	switch strings.ToLower(strings.TrimRight(kind, "0123456789")) {
+	case AccountPersonal:
+		return AccountPersonal, id
+	case AccountBusiness:
+		return AccountBusiness, id
+	}
+	return "", id
+}
+
+// BuildSyncRoots turns the records into report entries, one per user folder,
+// and flags personal OneDrive accounts when the machine shows corporate
+// management or also syncs a OneDrive for Business tenant.
+func (r *CloudSyncRoots) BuildSyncRoots(records []SyncRootRecord, users map[string]string) {
+	for _, record := range records {
+		provider, _, account := ParseSyncRootID(record.ID)
+		if kind, _ := accountKind(provider, account); kind == AccountBusiness {
+			r.CorporateIndicators = append(r.CorporateIndicators, "onedrive_business_sync_root")
+			break
+		}
+	}
+	corporate := len(r.CorporateIndicators) > 0
+
+	for _, record := range records {
+		provider, sid, account := ParseSyncRootID(record.ID)
+		root := CloudSyncRoot{
+			ID:          record.ID,
+			Provider:    provider,
+			DisplayName: record.Values["displaynameresource"],
+			SID:         strings.ToUpper(sid),
+		}
+		root.AccountKind, root.AccountID = accountKind(provider, account)
+		if root.AccountKind == AccountPersonal && corporate {
+			root.Flags = append(root.Flags, "personal_onedrive_on_corporate_machine")
+		}
+
+		// Each user syncing the root has its own folder; without any, the SID of the ID stands
+		paths := record.UserRoots
+		if len(paths) == 0 {
+			paths = map[string]string{root.SID: ""}
+		}
+		sids := make([]string, 0, len(paths))
+		for s := range paths {
+			sids = append(sids, s)
+		}
+		sort.Strings(sids)
+		for _, s := range sids {
+			entry := root
+			if s != "" {
+				entry.SID = s
+			}
+			entry.Path = paths[s]
+			entry.User = users[entry.SID]
+			if len(entry.Flags) > 0 {
+				r.FlaggedCount++
+			}
+			r.SyncRoots = append(r.SyncRoots, entry)
+		}
+	}
+}
+
+// WriteCloudSyncRoots writes cloud_sync_roots.json to outDir.
+func WriteCloudSyncRoots(ctx context.Context, report *CloudSyncRoots, outDir string, manifest *ModernManifest) error {
+	report.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+
+	outputPath := filepath.Join(outDir, "cloud_sync_roots.json")
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cloud sync roots: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cloud sync roots: %w", err)
+	}
+
+	manifest.IncrementTotalFiles()
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat cloud sync roots: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash cloud sync roots: %w", err)
+	}
+	note := fmt.Sprintf("Cloud files sync roots from SyncRootManager (%d roots, %d flagged)", len(report.SyncRoots), report.FlaggedCount)
+	manifest.AddItem("cloud_sync_roots.json", stat.Size(), sha256Hex, false, stat.ModTime(), "onedrive", note)
+	return nil
+}
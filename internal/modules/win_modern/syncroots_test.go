@@ -0,0 +1,138 @@
+package win_modern
+
+import (
+	"reflect"
+	"testing"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+	"cryptkeeper/internal/winutil"
+)
+
+const (
+	aliceSID = "S-1-5-21-3623811015-3361044348-30300820-1104"
+	bobSID   = "S-1-5-21-3623811015-3361044348-30300820-1105"
+
+	personalRootID = "OneDrive!" + aliceSID + "!Personal|4a1b9c2d7e3f5a60"
+	businessRootID = "OneDrive!" + aliceSID + "!Business1|contoso.onmicrosoft.com"
+	dropboxRootID  = "Dropbox!" + bobSID + "!bob@example.net"
+)
+
+// syncRoot returns a SyncRootManager subkey with the folders of its users.
+func syncRoot(id, displayName string, userRoots ...regftest.Value) *regftest.Key {
+	key := &regftest.Key{Name: id, Values: []regftest.Value{
+		regftest.String("DisplayNameResource", displayName),
+		regftest.DWORD("Flags", 34),
+	}}
+	if len(userRoots) > 0 {
+		key.Subkeys = []*regftest.Key{{Name: "UserSyncRoots", Values: userRoots}}
+	}
+	return key
+}
+
+// syncRootSoftware returns a domain-joined machine's SOFTWARE hive on which
+// alice syncs both a work tenant and a personal OneDrive, and bob a Dropbox.
+// Subkeys are in the order a hive keeps them, sorted by name.
+func syncRootSoftware(t *testing.T) *regf.Hive {
+	t.Helper()
+	hive, err := regf.Open(regftest.WriteFile(t, "SOFTWARE", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Microsoft", Subkeys: []*regftest.Key{
+			{Name: "Windows", Subkeys: []*regftest.Key{{Name: "CurrentVersion", Subkeys: []*regftest.Key{
+				{Name: "Explorer", Subkeys: []*regftest.Key{{Name: "SyncRootManager", Subkeys: []*regftest.Key{
+					syncRoot(dropboxRootID, "Dropbox"),
+					syncRoot(businessRootID, "OneDrive - Contoso", regftest.String(aliceSID, `C:\Users\alice\OneDrive - Contoso`)),
+					syncRoot(personalRootID, "OneDrive - Personal", regftest.String(aliceSID, `C:\Users\alice\OneDrive`)),
+				}}}},
+				regftest.Path(`Group Policy\DataStore\Machine`, &regftest.Key{Name: "0", Values: []regftest.Value{
+					regftest.String("DomainName", "corp.example.com"),
+				}}),
+			}}}},
+			regftest.Path(`Windows NT\CurrentVersion`, &regftest.Key{Name: "ProfileList", Subkeys: []*regftest.Key{
+				{Name: aliceSID, Values: []regftest.Value{regftest.String("ProfileImagePath", `C:\Users\alice`)}},
+				{Name: bobSID, Values: []regftest.Value{regftest.String("ProfileImagePath", `C:\Users\bob`)}},
+			}}),
+		}},
+	}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hive.Close() })
+	return hive
+}
+
+func TestBuildSyncRootsFromTheHive(t *testing.T) {
+	software := syncRootSoftware(t)
+	records, err := ReadSyncRootRecords(software)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := NewCloudSyncRoots()
+	report.CorporateIndicators = append(report.CorporateIndicators, CorporateIndicators(software)...)
+	report.BuildSyncRoots(records, ProfileUsers(software))
+
+	if !reflect.DeepEqual(report.CorporateIndicators, []string{"domain_joined:corp.example.com", "onedrive_business_sync_root"}) {
+		t.Fatalf("corporate indicators = %v", report.CorporateIndicators)
+	}
+	// Bob's Dropbox has no UserSyncRoots, so the SID of its ID names the user
+	want := []CloudSyncRoot{
+		{ID: dropboxRootID, Provider: "Dropbox", DisplayName: "Dropbox", AccountID: "bob@example.net", SID: bobSID, User: "bob"},
+		{ID: businessRootID, Provider: "OneDrive", DisplayName: "OneDrive - Contoso", AccountKind: AccountBusiness, AccountID: "contoso.onmicrosoft.com", SID: aliceSID, User: "alice", Path: `C:\Users\alice\OneDrive - Contoso`},
+		{
+			ID: personalRootID, Provider: "OneDrive", DisplayName: "OneDrive - Personal", AccountKind: AccountPersonal, AccountID: "4a1b9c2d7e3f5a60",
+			SID: aliceSID, User: "alice", Path: `C:\Users\alice\OneDrive`, Flags: []string{"personal_onedrive_on_corporate_machine"},
+		},
+	}
+	if !reflect.DeepEqual(report.SyncRoots, want) || report.FlaggedCount != 1 {
+		t.Fatalf("sync roots = %+v\nwant %+v", report.SyncRoots, want)
+	}
+}
+
+func TestSyncRootRecordsFromRegQueryMatchTheHive(t *testing.T) {
+	const key = `HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows\CurrentVersion\Explorer\SyncRootManager\`
+	output := []byte("\r\n" +
+		key + dropboxRootID + "\r\n" +
+		"    DisplayNameResource    REG_SZ    Dropbox\r\n" +
+		"    Flags    REG_DWORD    34\r\n" +
+		"\r\n" +
+		key + businessRootID + "\r\n" +
+		"    DisplayNameResource    REG_SZ    OneDrive - Contoso\r\n" +
+		"    Flags    REG_DWORD    34\r\n" +
+		"\r\n" +
+		key + businessRootID + `\UserSyncRoots` + "\r\n" +
+		"    " + aliceSID + "    REG_SZ    C:\\Users\\alice\\OneDrive - Contoso\r\n" +
+		"\r\n" +
+		key + personalRootID + "\r\n" +
+		"    DisplayNameResource    REG_SZ    OneDrive - Personal\r\n" +
+		"    Flags    REG_DWORD    34\r\n" +
+		"\r\n" +
+		key + personalRootID + `\UserSyncRoots` + "\r\n" +
+		"    " + aliceSID + "    REG_SZ    C:\\Users\\alice\\OneDrive\r\n")
+	live := NewCloudSyncRoots()
+	live.BuildSyncRoots(SyncRootRecordsFromRegQuery(winutil.ParseRegQuery(output)), nil)
+
+	records, err := ReadSyncRootRecords(syncRootSoftware(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromHive := NewCloudSyncRoots()
+	fromHive.BuildSyncRoots(records, nil)
+	if !reflect.DeepEqual(live.SyncRoots, fromHive.SyncRoots) || !reflect.DeepEqual(live.CorporateIndicators, fromHive.CorporateIndicators) {
+		t.Fatalf("reg query = %+v\nhive %+v", live.SyncRoots, fromHive.SyncRoots)
+	}
+}
+
+func TestParseSyncRootID(t *testing.T) {
+	for _, tt := range []struct {
+		id, provider, sid, account string
+	}{
+		{personalRootID, "OneDrive", aliceSID, "Personal|4a1b9c2d7e3f5a60"},
+		{"iCloudDrive!" + bobSID, "iCloudDrive", bobSID, ""},
+		{"Box", "Box", "", ""},
+		{"GoogleDrive!" + bobSID + "!bob@example.net!1", "GoogleDrive", bobSID, "bob@example.net!1"},
+	} {
+		provider, sid, account := ParseSyncRootID(tt.id)
+		if provider != tt.provider || sid != tt.sid || account != tt.account {
+			t.Errorf("ParseSyncRootID(%q) = %q, %q, %q", tt.id, provider, sid, account)
+		}
+	}
+}
@@ -19,6 +19,16 @@ func (w *WinModern) Name() string {
 	return "windows/modern"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinModern) Describe() string {
+	return "Cloud and modern Windows artifacts"
+}
+
+// DependsOn reports that the module runs after windows/registry.
+func (w *WinModern) DependsOn() []string {
+	return []string{"windows/registry"}
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinModern) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
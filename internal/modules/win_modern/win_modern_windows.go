@@ -4,14 +4,20 @@ package win_modern
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"cryptkeeper/internal/regf"
 	"cryptkeeper/internal/winutil"
 )
 
+// registryDir is where the windows/registry module leaves its hive copies,
+// relative to the artifacts root.
+var registryDir = filepath.Join("windows_registry", "windows", "registry")
+
 // WinModern represents the Windows modern artifacts collection module.
 type WinModern struct{}
 
@@ -25,6 +31,17 @@ func (w *WinModern) Name() string {
 	return "windows/modern"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinModern) Describe() string {
+	return "Cloud and modern Windows artifacts"
+}
+
+// DependsOn reports that the module runs after windows/registry, whose
+// SOFTWARE copy holds the cloud sync root registrations.
+func (w *WinModern) DependsOn() []string {
+	return []string{"windows/registry"}
+}
+
 // Collect gathers Windows modern and cloud artifacts including OneDrive, Store apps, Cortana, Timeline, and Clipboard.
 func (w *WinModern) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/modern subdirectory
@@ -34,14 +51,14 @@ func (w *WinModern) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewModernManifest(hostname)
-	constraints := winutil.NewSizeConstraints()
+	manifest := NewModernManifest(ctx, hostname)
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Collect per-user modern artifacts
 	if err := w.collectPerUserModernArtifacts(ctx, modernDir, manifest, constraints); err != nil {
@@ -53,6 +70,11 @@ func (w *WinModern) Collect(ctx context.Context, outDir string) error {
 		manifest.AddError("store_apps", fmt.Sprintf("Failed to collect Store apps info: %v", err))
 	}
 
+	// Attribute synced cloud accounts from the SyncRootManager registrations
+	if err := w.collectCloudSyncRoots(ctx, outDir, modernDir, manifest); err != nil {
+		manifest.AddError("cloud_sync_roots", err.Error())
+	}
+
 	// Write manifest
 	manifestPath := filepath.Join(modernDir, "manifest.json")
 	if err := manifest.WriteManifest(manifestPath); err != nil {
@@ -65,10 +87,7 @@ func (w *WinModern) Collect(ctx context.Context, outDir string) error {
 // collectPerUserModernArtifacts collects modern artifacts for each user profile.
 func (w *WinModern) collectPerUserModernArtifacts(ctx context.Context, outDir string, manifest *ModernManifest, constraints *winutil.SizeConstraints) error {
 	// Get system drive (usually C:)
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	usersDir := filepath.Join(systemDrive, "Users")
 	userEntries, err := os.ReadDir(usersDir)
@@ -263,34 +282,110 @@ func (w *WinModern) collectClipboardHistory(ctx context.Context, userProfileDir,
 	}
 }
 
-// collectStoreAppsInfo collects Windows Store apps information.
+// appxPackagesScript emits installed packages as JSON with string-typed enums and a derived install date.
+const appxPackagesScript = `Get-AppxPackage -AllUsers | Select-Object Name, Publisher, Version, PackageFullName, InstallLocation, IsDevelopmentMode, IsFramework, NonRemovable, @{Name='SignatureKind';Expression={$_.SignatureKind.ToString()}}, @{Name='InstallDate';Expression={ if ($_.InstallLocation -and (Test-Path -LiteralPath $_.InstallLocation)) { (Get-Item -LiteralPath $_.InstallLocation).CreationTimeUtc.ToString('yyyy-MM-ddTHH:mm:ssZ') } }} | ConvertTo-Json -Compress`
+
+// appxProvisionedScript emits packages provisioned for all users as JSON.
+const appxProvisionedScript = `Get-AppxProvisionedPackage -Online | Select-Object DisplayName, Version, PackageName, PublisherId, InstallLocation | ConvertTo-Json -Compress`
+
+// collectStoreAppsInfo builds a structured AppX/MSIX package inventory.
 func (w *WinModern) collectStoreAppsInfo(ctx context.Context, outDir string, manifest *ModernManifest) error {
-	outputPath := filepath.Join(outDir, "store_apps_info.txt")
+	outputPath := filepath.Join(outDir, "appx_packages.json")
+	inventory := AppxInventory{
+		CollectedUTC:        winutil.FormatTime(winutil.Now(ctx)),
+		Packages:            make([]AppxPackage, 0),
+		ProvisionedPackages: make([]AppxProvisionedPackage, 0),
+	}
 
-	// Use PowerShell to get installed Store apps
-	psScript := `Get-AppxPackage | Select-Object Name, Version, InstallLocation, PackageFullName | Format-Table -AutoSize`
-	args := []string{"-Command", psScript}
-	output, err := winutil.RunCommandWithOutput(ctx, "powershell", args)
+	// Installed packages for all users
+	output, err := winutil.RunCommandWithOutput(ctx, "powershell", []string{"-NoProfile", "-Command", appxPackagesScript})
+	if err != nil {
+		return fmt.Errorf("failed to run PowerShell Get-AppxPackage: %w", err)
+	}
+	packages, err := ParseAppxPackages(output, winutil.Now(ctx).UTC())
 	if err != nil {
-		return fmt.Errorf("failed to run PowerShell Store apps command: %w", err)
+		return err
+	}
+	inventory.Packages = packages
+	for _, pkg := range packages {
+		if len(pkg.Flags) > 0 {
+			inventory.FlaggedPackages++
+		}
+	}
+
+	// Provisioned packages (requires elevation, so failures are recorded rather than fatal)
+	if output, err := winutil.RunCommandWithOutput(ctx, "powershell", []string{"-NoProfile", "-Command", appxProvisionedScript}); err != nil {
+		inventory.Errors = append(inventory.Errors, fmt.Sprintf("Get-AppxProvisionedPackage: %v", err))
+	} else if provisioned, err := ParseAppxProvisionedPackages(output); err != nil {
+		inventory.Errors = append(inventory.Errors, err.Error())
+	} else {
+		inventory.ProvisionedPackages = provisioned
 	}
 
-	// Write output to file
-	if err := os.WriteFile(outputPath, output, 0644); err != nil {
-		return fmt.Errorf("failed to write Store apps info: %w", err)
+	data, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal AppX inventory: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write AppX inventory: %w", err)
 	}
 
 	// Add to manifest
+	manifest.IncrementTotalFiles()
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
-			manifest.AddItem("store_apps_info.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "store_apps", "Windows Store apps information from PowerShell Get-AppxPackage")
-			manifest.IncrementTotalFiles()
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
+			note := fmt.Sprintf("AppX package inventory (%d installed, %d provisioned, %d flagged)",
+				len(inventory.Packages), len(inventory.ProvisionedPackages), inventory.FlaggedPackages)
+			manifest.AddItem("appx_packages.json", stat.Size(), sha256Hex, false, stat.ModTime(), "store_apps", note)
 		}
 	}
 
 	return nil
 }
 
+// collectCloudSyncRoots writes cloud_sync_roots.json from the registry
+// module's SOFTWARE copy, the hive on the collection target, or, when the
+// live hive is locked, reg query.
+func (w *WinModern) collectCloudSyncRoots(ctx context.Context, outDir, modernDir string, manifest *ModernManifest) error {
+	report := NewCloudSyncRoots()
+	registryCopy := filepath.Join(filepath.Dir(outDir), registryDir, "SOFTWARE.hiv")
+	hostPath := filepath.Join(winutil.SystemRoot(), "System32", "config", "SOFTWARE")
+
+	var software *regf.Hive
+	if regf.CheckFile(registryCopy).Valid {
+		if hive, err := regf.Open(registryCopy); err == nil {
+			software, report.Source = hive, "registry_module"
+		}
+	}
+	if software == nil {
+		if hive, err := regf.Open(hostPath); err == nil {
+			software, report.Source = hive, "hive_file"
+		} else if winutil.IsOffline() {
+			return fmt.Errorf("failed to open SOFTWARE hive: %w", err)
+		}
+	}
+
+	if software != nil {
+		defer software.Close()
+		records, err := ReadSyncRootRecords(software)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		report.CorporateIndicators = append(report.CorporateIndicators, CorporateIndicators(software)...)
+		report.BuildSyncRoots(records, ProfileUsers(software))
+		return WriteCloudSyncRoots(ctx, report, modernDir, manifest)
+	}
+
+	// The live SOFTWARE hive is locked without a registry module copy
+	report.Source = "reg_query"
+	output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", `HKLM\SOFTWARE\` + syncRootManagerKey, "/s"})
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("reg query SyncRootManager: %v", err))
+	}
+	report.BuildSyncRoots(SyncRootRecordsFromRegQuery(winutil.ParseRegQuery(output)), nil)
+	return WriteCloudSyncRoots(ctx, report, modernDir, manifest)
+}
+
 // walkAndCollectFiles recursively walks a directory and collects interesting files.
 func (w *WinModern) walkAndCollectFiles(ctx context.Context, sourceDir, outDir string, manifest *ModernManifest, constraints *winutil.SizeConstraints, username, fileType, description string) {
 	filepath.WalkDir(sourceDir, func(path string, d os.DirEntry, err error) error {
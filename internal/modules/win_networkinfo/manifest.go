@@ -2,9 +2,12 @@
 package win_networkinfo
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // NetworkInfoItem represents a collected network information file.
@@ -36,9 +39,9 @@ type NetworkInfoManifest struct {
 }
 
 // NewNetworkInfoManifest creates a new network information manifest with basic information.
-func NewNetworkInfoManifest(hostname string) *NetworkInfoManifest {
+func NewNetworkInfoManifest(ctx context.Context, hostname string) *NetworkInfoManifest {
 	return &NetworkInfoManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]NetworkInfoItem, 0),
@@ -56,7 +59,7 @@ func (nm *NetworkInfoManifest) AddItem(path string, size int64, sha256 string, t
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	nm.CollectedFiles++
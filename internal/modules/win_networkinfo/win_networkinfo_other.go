@@ -19,6 +19,16 @@ func (w *WinNetworkInfo) Name() string {
 	return "windows/networkinfo"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinNetworkInfo) Describe() string {
+	return "Network configuration and DNS cache"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinNetworkInfo) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinNetworkInfo) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
@@ -24,6 +24,16 @@ func (w *WinNetworkInfo) Name() string {
 	return "windows/networkinfo"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinNetworkInfo) Describe() string {
+	return "Network configuration and DNS cache"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinNetworkInfo) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers Windows network information including DNS cache, connections, ARP table, and SMB shares.
 func (w *WinNetworkInfo) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/networkinfo subdirectory
@@ -33,13 +43,13 @@ func (w *WinNetworkInfo) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewNetworkInfoManifest(hostname)
+	manifest := NewNetworkInfoManifest(ctx, hostname)
 
 	// Collect DNS cache
 	if err := w.collectDNSCache(ctx, networkDir, manifest); err != nil {
@@ -93,7 +103,7 @@ func (w *WinNetworkInfo) collectDNSCache(ctx context.Context, outDir string, man
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash DNS cache output: %w", err)
 	}
@@ -127,7 +137,7 @@ func (w *WinNetworkInfo) collectNetworkConnections(ctx context.Context, outDir s
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash netstat output: %w", err)
 	}
@@ -161,7 +171,7 @@ func (w *WinNetworkInfo) collectARPTable(ctx context.Context, outDir string, man
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash ARP table output: %w", err)
 	}
@@ -195,7 +205,7 @@ func (w *WinNetworkInfo) collectSMBShares(ctx context.Context, outDir string, ma
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash SMB shares output: %w", err)
 	}
@@ -0,0 +1,58 @@
+//go:build windows
+
+package win_networkinfo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cryptkeeper/internal/winutil"
+)
+
+func TestCollectCommandsAreAudited(t *testing.T) {
+	artifactsDir := t.TempDir()
+	if err := winutil.StartCommandAudit(artifactsDir); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(artifactsDir, "windows_networkinfo")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	collectErr := NewWinNetworkInfo().Collect(context.Background(), outDir)
+	if err := winutil.StopCommandAudit(); err != nil {
+		t.Fatal(err)
+	}
+	if collectErr != nil {
+		t.Logf("Collect: %v", collectErr)
+	}
+
+	file, err := os.Open(filepath.Join(artifactsDir, winutil.CommandsExecutedName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	started := make(map[string]bool)
+	ended := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record winutil.CommandRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		switch record.Event {
+		case winutil.CommandEventStart:
+			started[record.Command] = true
+		case winutil.CommandEventEnd:
+			ended[record.Command] = true
+		}
+	}
+	for _, command := range []string{"ipconfig", "netstat"} {
+		if !started[command] || !ended[command] {
+			t.Errorf("%s not recorded as started and ended", command)
+		}
+	}
+}
@@ -2,9 +2,12 @@
 package win_persistence
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // PersistenceItem represents a collected persistence/malware hunting artifact file.
@@ -36,9 +39,9 @@ type PersistenceManifest struct {
 }
 
 // NewPersistenceManifest creates a new persistence artifacts manifest with basic information.
-func NewPersistenceManifest(hostname string) *PersistenceManifest {
+func NewPersistenceManifest(ctx context.Context, hostname string) *PersistenceManifest {
 	return &PersistenceManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]PersistenceItem, 0),
@@ -56,7 +59,7 @@ func (pm *PersistenceManifest) AddItem(path string, size int64, sha256 string, t
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	pm.CollectedFiles++
@@ -0,0 +1,130 @@
+package win_persistence
+
+import (
+	"fmt"
+	"strings"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// Registry view labels. On 64-bit Windows the 32-bit view redirects
+// HKLM\SOFTWARE (and HKCU\SOFTWARE\Classes) to WOW6432Node, which holds
+// autoruns and COM registrations invisible to a 64-bit-only query.
+const (
+	ViewNative = "native"
+	ViewWOW64  = "wow64"
+)
+
+// RegistryView is a registry view and the reg.exe switch that selects it.
+type RegistryView struct {
+	Label string
+	Flag  string
+}
+
+// RegistryViews are queried for every autorun and COM key.
+var RegistryViews = []RegistryView{
+	{Label: ViewNative, Flag: "/reg:64"},
+	{Label: ViewWOW64, Flag: "/reg:32"},
+}
+
+// ViewQueryArgs returns reg.exe arguments that run args against a view.
+func ViewQueryArgs(args []string, view RegistryView) []string {
+	return append(append([]string{}, args...), view.Flag)
+}
+
+// ViewResult is the parsed output of one query in one registry view.
+type ViewResult struct {
+	View  string
+	Keys  []winutil.RegKey
+	Error string
+}
+
+// ViewStatus records whether a query succeeded in a view.
+type ViewStatus struct {
+	View  string `json:"view"`
+	Error string `json:"error,omitempty"`
+}
+
+// ViewedKey is a registry key with the views it was found in.
+type ViewedKey struct {
+	Path   string             `json:"path"`
+	Values []winutil.RegValue `json:"values"`
+	Views  []string           `json:"views"` // "native", "wow64", or both for keys shared between views
+}
+
+// ViewedQuery is a key queried in every registry view with the results merged.
+type ViewedQuery struct {
+	Key   string       `json:"key"`
+	Views []ViewStatus `json:"views"`
+	Keys  []ViewedKey  `json:"keys"`
+}
+
+// QueryViews runs reg.exe arguments in every registry view through query and
+// returns the merged results along with the raw output labeled by view. A
+// failure in one view is recorded and does not stop the other.
+func QueryViews(label string, args []string, query func(args []string) ([]byte, error)) (ViewedQuery, string) {
+	results := make([]ViewResult, 0, len(RegistryViews))
+	text := ""
+
+	for _, view := range RegistryViews {
+		text += fmt.Sprintf("=== %s [%s] ===\n", label, view.Label)
+		result, err := query(ViewQueryArgs(args, view))
+		if err != nil {
+			text += fmt.Sprintf("Error querying key: %v\n\n", err)
+			results = append(results, ViewResult{View: view.Label, Error: err.Error()})
+			continue
+		}
+		text += string(result)
+		text += "\n\n"
+		results = append(results, ViewResult{View: view.Label, Keys: winutil.ParseRegQuery(result)})
+	}
+
+	return MergeViews(label, results), text
+}
+
+// MergeViews combines per-view results for one queried key. Keys that are
+// identical in both views (shared, unredirected keys) are reported once and
+// labeled with both views; redirected keys appear under their WOW6432Node
+// path labeled wow64. Order follows the first view each key was seen in.
+func MergeViews(key string, results []ViewResult) ViewedQuery {
+	query := ViewedQuery{
+		Key:   key,
+		Views: make([]ViewStatus, 0, len(results)),
+		Keys:  make([]ViewedKey, 0),
+	}
+
+	index := make(map[string]int)
+	for _, result := range results {
+		query.Views = append(query.Views, ViewStatus{View: result.View, Error: result.Error})
+		for _, regKey := range result.Keys {
+			id := keyIdentity(regKey)
+			if i, ok := index[id]; ok {
+				query.Keys[i].Views = append(query.Keys[i].Views, result.View)
+				continue
+			}
+			index[id] = len(query.Keys)
+			query.Keys = append(query.Keys, ViewedKey{
+				Path:   regKey.Path,
+				Values: regKey.Values,
+				Views:  []string{result.View},
+			})
+		}
+	}
+
+	return query
+}
+
+// keyIdentity identifies a key by its path and values so only identical keys merge.
+func keyIdentity(key winutil.RegKey) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(key.Path))
+	for _, v := range key.Values {
+		b.WriteString("\x00")
+		b.WriteString(v.Name)
+		b.WriteString("\x00")
+		b.WriteString(v.Type)
+		b.WriteString("\x00")
+		b.WriteString(v.Data)
+	}
+	return b.String()
+}
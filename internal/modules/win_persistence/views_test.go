@@ -0,0 +1,79 @@
+package win_persistence
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The Run key as reg.exe reports it in each view on 64-bit Windows. The 32-bit
+// view lists the redirected key, where the implant registered itself, under its
+// WOW6432Node path; the CLSID key is shared and identical in both views.
+const (
+	nativeRunKey = "\r\nHKEY_LOCAL_MACHINE\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Run\r\n" +
+		"    SecurityHealth    REG_EXPAND_SZ    %windir%\\system32\\SecurityHealthSystray.exe\r\n\r\n"
+	wow64RunKey = "\r\nHKEY_LOCAL_MACHINE\\SOFTWARE\\WOW6432Node\\Microsoft\\Windows\\CurrentVersion\\Run\r\n" +
+		"    Updater    REG_SZ    C:\\Users\\Public\\updater.exe\r\n\r\n"
+	sharedClassesKey = "\r\nHKEY_LOCAL_MACHINE\\SOFTWARE\\Classes\\CLSID\\{0A29FF9E-7F9C-4437-8B11-F424491E3931}\\InprocServer32\r\n" +
+		"    (Default)    REG_SZ    C:\\Windows\\System32\\shell32.dll\r\n\r\n"
+)
+
+func TestQueryViewsLabelsEachView(t *testing.T) {
+	const key = `HKLM\SOFTWARE\Microsoft\Windows\CurrentVersion\Run`
+	var queried [][]string
+	query, text := QueryViews(key, []string{"query", key, "/s"}, func(args []string) ([]byte, error) {
+		queried = append(queried, args)
+		switch args[len(args)-1] {
+		case "/reg:64":
+			return []byte(nativeRunKey + sharedClassesKey), nil
+		case "/reg:32":
+			return []byte(wow64RunKey + sharedClassesKey), nil
+		}
+		return nil, errors.New("no view selected")
+	})
+
+	want := [][]string{{"query", key, "/s", "/reg:64"}, {"query", key, "/s", "/reg:32"}}
+	if !reflect.DeepEqual(queried, want) {
+		t.Fatalf("queried %q, want %q", queried, want)
+	}
+	if !reflect.DeepEqual(query.Views, []ViewStatus{{View: ViewNative}, {View: ViewWOW64}}) {
+		t.Errorf("views = %+v", query.Views)
+	}
+	if len(query.Keys) != 3 {
+		t.Fatalf("keys = %+v", query.Keys)
+	}
+	labels := map[string][]string{}
+	for _, k := range query.Keys {
+		labels[k.Path] = k.Views
+	}
+	wantLabels := map[string][]string{
+		`HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows\CurrentVersion\Run`:                                {ViewNative},
+		`HKEY_LOCAL_MACHINE\SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Run`:                    {ViewWOW64},
+		`HKEY_LOCAL_MACHINE\SOFTWARE\Classes\CLSID\{0A29FF9E-7F9C-4437-8B11-F424491E3931}\InprocServer32`: {ViewNative, ViewWOW64},
+	}
+	if !reflect.DeepEqual(labels, wantLabels) {
+		t.Errorf("view labels = %v, want %v", labels, wantLabels)
+	}
+	if !strings.Contains(text, "=== "+key+" [native] ===") || !strings.Contains(text, "=== "+key+" [wow64] ===") || !strings.Contains(text, `C:\Users\Public\updater.exe`) {
+		t.Errorf("raw output = %q", text)
+	}
+}
+
+func TestQueryViewsRecordsAFailedView(t *testing.T) {
+	query, text := QueryViews("com", []string{"query", `HKLM\SOFTWARE\Classes\CLSID`}, func(args []string) ([]byte, error) {
+		if args[len(args)-1] == "/reg:32" {
+			return nil, errors.New("ERROR: The system was unable to find the specified registry key or value.")
+		}
+		return []byte(sharedClassesKey), nil
+	})
+	if len(query.Views) != 2 || query.Views[0].Error != "" || !strings.HasPrefix(query.Views[1].Error, "ERROR: The system was unable") {
+		t.Fatalf("views = %+v", query.Views)
+	}
+	if len(query.Keys) != 1 || !reflect.DeepEqual(query.Keys[0].Views, []string{ViewNative}) {
+		t.Errorf("keys = %+v", query.Keys)
+	}
+	if !strings.Contains(text, "Error querying key: ERROR: The system was unable") {
+		t.Errorf("raw output = %q", text)
+	}
+}
@@ -19,6 +19,11 @@ func (w *WinPersistence) Name() string {
 	return "windows/persistence"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinPersistence) Describe() string {
+	return "Persistence mechanisms and malware hunting"
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinPersistence) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
@@ -4,6 +4,7 @@ package win_persistence
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -25,6 +26,11 @@ func (w *WinPersistence) Name() string {
 	return "windows/persistence"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinPersistence) Describe() string {
+	return "Persistence mechanisms and malware hunting"
+}
+
 // Collect gathers Windows persistence and malware hunting artifacts.
 func (w *WinPersistence) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/persistence subdirectory
@@ -34,14 +40,14 @@ func (w *WinPersistence) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewPersistenceManifest(hostname)
-	constraints := winutil.NewSizeConstraints()
+	manifest := NewPersistenceManifest(ctx, hostname)
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Collect autorun locations
 	if err := w.collectAutoRunLocations(ctx, persistenceDir, manifest); err != nil {
@@ -85,17 +91,12 @@ func (w *WinPersistence) collectAutoRunLocations(ctx context.Context, outDir str
 	}
 
 	output := "Windows Autorun Locations Analysis:\n\n"
+	queries := make([]ViewedQuery, 0, len(autorunKeys))
 
 	for _, key := range autorunKeys {
-		args := []string{"query", key, "/s"}
-		if result, err := winutil.RunCommandWithOutput(ctx, "reg", args); err == nil {
-			output += fmt.Sprintf("=== %s ===\n", key)
-			output += string(result)
-			output += "\n\n"
-		} else {
-			output += fmt.Sprintf("=== %s ===\n", key)
-			output += fmt.Sprintf("Error querying key: %v\n\n", err)
-		}
+		query, text := w.queryViews(ctx, key, []string{"query", key, "/s"})
+		output += text
+		queries = append(queries, query)
 	}
 
 	// Write output to file
@@ -105,22 +106,23 @@ func (w *WinPersistence) collectAutoRunLocations(ctx context.Context, outDir str
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("autorun_locations.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "autoruns", "Comprehensive autorun registry locations analysis")
 			manifest.IncrementTotalFiles()
 		}
 	}
 
+	if err := w.writeViewedQueries(ctx, outDir, "autorun_locations.json", "autoruns", "Autorun keys from the native and WOW6432Node registry views", queries, manifest); err != nil {
+		manifest.AddError("autorun_locations.json", err.Error())
+	}
+
 	return nil
 }
 
 // collectPerUserPersistence collects per-user persistence artifacts including ShellBags and cache files.
 func (w *WinPersistence) collectPerUserPersistence(ctx context.Context, outDir string, manifest *PersistenceManifest, constraints *winutil.SizeConstraints) error {
 	// Get system drive (usually C:)
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	usersDir := filepath.Join(systemDrive, "Users")
 	userEntries, err := os.ReadDir(usersDir)
@@ -148,7 +150,7 @@ func (w *WinPersistence) collectPerUserPersistence(ctx context.Context, outDir s
 		w.collectIconCache(ctx, userProfileDir, userOutDir, manifest, constraints, username)
 
 		// Note: ShellBags are in the registry (NTUSER.DAT) which is already collected by win_registry
-		w.createShellBagsNote(userOutDir, manifest, username)
+		w.createShellBagsNote(ctx, userOutDir, manifest, username)
 	}
 
 	return nil
@@ -249,7 +251,7 @@ func (w *WinPersistence) collectIconCache(ctx context.Context, userProfileDir, u
 }
 
 // createShellBagsNote creates a note about ShellBags being in the registry.
-func (w *WinPersistence) createShellBagsNote(userOutDir string, manifest *PersistenceManifest, username string) {
+func (w *WinPersistence) createShellBagsNote(ctx context.Context, userOutDir string, manifest *PersistenceManifest, username string) {
 	noteContent := fmt.Sprintf("ShellBags Information for user %s:\n\n", username)
 	noteContent += "ShellBags data is stored in the Windows Registry and is captured by the win_registry module.\n"
 	noteContent += "ShellBags contain information about folder access history and window positions.\n\n"
@@ -262,7 +264,7 @@ func (w *WinPersistence) createShellBagsNote(userOutDir string, manifest *Persis
 	notePath := filepath.Join(userOutDir, "shellbags_info.txt")
 	if err := os.WriteFile(notePath, []byte(noteContent), 0644); err == nil {
 		if stat, err := os.Stat(notePath); err == nil {
-			if sha256Hex, err := winutil.HashFile(notePath); err == nil {
+			if sha256Hex, err := winutil.HashFile(ctx, notePath); err == nil {
 				relPath := filepath.Join("users", username, "shellbags_info.txt")
 				note := fmt.Sprintf("ShellBags registry information for user %s", username)
 				manifest.AddItem(relPath, stat.Size(), sha256Hex, false, stat.ModTime(), "shellbags", note)
@@ -282,14 +284,12 @@ func (w *WinPersistence) collectCOMObjects(ctx context.Context, outDir string, m
 	}
 
 	output := "COM Objects Registration Information:\n\n"
+	queries := make([]ViewedQuery, 0, len(comKeys))
 
 	for _, key := range comKeys {
-		args := []string{"query", key, "/f", "InprocServer32", "/s", "/k"}
-		if result, err := winutil.RunCommandWithOutput(ctx, "reg", args); err == nil {
-			output += fmt.Sprintf("=== %s (InprocServer32) ===\n", key)
-			output += string(result)
-			output += "\n\n"
-		}
+		query, text := w.queryViews(ctx, key+" (InprocServer32)", []string{"query", key, "/f", "InprocServer32", "/s", "/k"})
+		output += text
+		queries = append(queries, query)
 	}
 
 	// Write output to file
@@ -299,12 +299,49 @@ func (w *WinPersistence) collectCOMObjects(ctx context.Context, outDir string, m
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("com_objects.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "com_objects", "COM objects registration information")
 			manifest.IncrementTotalFiles()
 		}
 	}
 
+	if err := w.writeViewedQueries(ctx, outDir, "com_objects.json", "com_objects", "InprocServer32 registrations from the native and WOW6432Node registry views", queries, manifest); err != nil {
+		manifest.AddError("com_objects.json", err.Error())
+	}
+
+	return nil
+}
+
+// queryViews runs a reg query in the native and 32-bit registry views and
+// returns the merged results along with the raw output labeled by view.
+func (w *WinPersistence) queryViews(ctx context.Context, label string, args []string) (ViewedQuery, string) {
+	return QueryViews(label, args, func(args []string) ([]byte, error) {
+		return winutil.RunCommandWithOutput(ctx, "reg", args)
+	})
+}
+
+// writeViewedQueries writes merged registry view results as JSON and adds the file to the manifest.
+func (w *WinPersistence) writeViewedQueries(ctx context.Context, outDir, filename, fileType, note string, queries []ViewedQuery, manifest *PersistenceManifest) error {
+	outputPath := filepath.Join(outDir, filename)
+	data, err := json.MarshalIndent(queries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", filename, err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", filename, err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", filename, err)
+	}
+	manifest.AddItem(filename, stat.Size(), sha256Hex, false, stat.ModTime(), fileType, note)
+	manifest.IncrementTotalFiles()
+
 	return nil
 }
 
@@ -2,9 +2,13 @@
 package win_prefetch
 
 import (
+	"context"
 	"encoding/json"
 	"os"
+	"strings"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // PrefetchItem represents a collected prefetch file.
@@ -34,12 +38,15 @@ type PrefetchManifest struct {
 	TotalFiles           int             `json:"total_files"`
 	CollectedFiles       int             `json:"collected_files"`
 	PrefetchPath         string          `json:"prefetch_path"`
+	Since                string          `json:"since,omitempty"`            // Prefetch files modified before this were not collected
+	SkippedBySince       int             `json:"skipped_by_since,omitempty"` // Prefetch files modified before --since
+	ParsedFiles          int             `json:"parsed_files"`               // Prefetch files decoded into prefetch_parsed.json
 }
 
 // NewPrefetchManifest creates a new prefetch manifest with basic information.
-func NewPrefetchManifest(hostname string, prefetchEnabled bool, prefetchPath string) *PrefetchManifest {
+func NewPrefetchManifest(ctx context.Context, hostname string, prefetchEnabled bool, prefetchPath string) *PrefetchManifest {
 	return &PrefetchManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]PrefetchItem, 0),
@@ -51,6 +58,19 @@ func NewPrefetchManifest(hostname string, prefetchEnabled bool, prefetchPath str
 	}
 }
 
+// LoadPrefetchManifest reads a manifest written by WriteManifest.
+func LoadPrefetchManifest(manifestPath string) (*PrefetchManifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var pm PrefetchManifest
+	if err := json.Unmarshal(data, &pm); err != nil {
+		return nil, err
+	}
+	return &pm, nil
+}
+
 // AddItem adds a successfully collected prefetch item to the manifest.
 func (pm *PrefetchManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, note string) {
 	pm.Items = append(pm.Items, PrefetchItem{
@@ -59,11 +79,24 @@ func (pm *PrefetchManifest) AddItem(path string, size int64, sha256 string, trun
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 	})
 	pm.CollectedFiles++
 }
 
+// RemoveItem drops an item, e.g. before a parsed output is rewritten, and
+// reports whether it was listed.
+func (pm *PrefetchManifest) RemoveItem(path string) bool {
+	for i, item := range pm.Items {
+		if item.Path == path {
+			pm.Items = append(pm.Items[:i], pm.Items[i+1:]...)
+			pm.CollectedFiles--
+			return true
+		}
+	}
+	return false
+}
+
 // AddError adds an error to the manifest for a failed collection.
 func (pm *PrefetchManifest) AddError(target, errorMsg string) {
 	pm.Errors = append(pm.Errors, PrefetchError{
@@ -72,6 +105,23 @@ func (pm *PrefetchManifest) AddError(target, errorMsg string) {
 	})
 }
 
+// RemoveParseErrors drops the errors recorded by an earlier parse, before the
+// prefetch files are parsed again.
+func (pm *PrefetchManifest) RemoveParseErrors() {
+	kept := pm.Errors[:0]
+	for _, e := range pm.Errors {
+		if !strings.HasPrefix(e.Error, parseErrorPrefix) {
+			kept = append(kept, e)
+		}
+	}
+	pm.Errors = kept
+}
+
+// IncrementSkippedBySince counts a prefetch file skipped as older than --since.
+func (pm *PrefetchManifest) IncrementSkippedBySince() {
+	pm.SkippedBySince++
+}
+
 // SetTotalFiles sets the total number of prefetch files found.
 func (pm *PrefetchManifest) SetTotalFiles(total int) {
 	pm.TotalFiles = total
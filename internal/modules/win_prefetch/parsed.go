@@ -0,0 +1,165 @@
+package win_prefetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cryptkeeper/internal/prefetch"
+	"cryptkeeper/internal/winutil"
+)
+
+// parsedFileName is the decoded prefetch output next to the raw copies.
+const parsedFileName = "prefetch_parsed.json"
+
+// parseErrorPrefix marks the manifest errors of prefetch files that could not
+// be decoded, so a later parse can replace them.
+const parseErrorPrefix = "failed to parse prefetch file: "
+
+// ParsedPrefetch is the decoded content of one collected prefetch file.
+type ParsedPrefetch struct {
+	Version     int              `json:"version"`
+	Compressed  bool             `json:"compressed"`
+	Executable  string           `json:"executable"`
+	Hash        string           `json:"hash"`
+	RunCount    int              `json:"run_count"`
+	LastRun     []string         `json:"last_run"` // Most recent first
+	Volumes     []PrefetchVolume `json:"volumes"`
+	FilesLoaded []string         `json:"files_loaded"`
+}
+
+// PrefetchVolume is a volume a program loaded files from.
+type PrefetchVolume struct {
+	DevicePath   string   `json:"device_path"`
+	SerialNumber string   `json:"serial_number"`
+	Created      string   `json:"created,omitempty"`
+	Directories  []string `json:"directories"`
+}
+
+// ParsedPrefetchReport is the content of prefetch_parsed.json, keyed by the
+// collected .pf file name.
+type ParsedPrefetchReport struct {
+	CreatedUTC string                    `json:"created_utc"`
+	Files      map[string]ParsedPrefetch `json:"files"`
+}
+
+// WriteParsedPrefetch decodes the prefetch files listed in the manifest into
+// prefetch_parsed.json in prefetchDir. A file that fails to decode is
+// recorded as a manifest error and left out. A prefetch_parsed.json already
+// listed in the manifest is replaced.
+func WriteParsedPrefetch(ctx context.Context, prefetchDir string, manifest *PrefetchManifest) error {
+	manifest.RemoveParseErrors()
+	report := ParsedPrefetchReport{
+		CreatedUTC: winutil.FormatTime(winutil.Now(ctx)),
+		Files:      make(map[string]ParsedPrefetch),
+	}
+
+	items := make([]PrefetchItem, 0, len(manifest.Items))
+	for _, item := range manifest.Items {
+		if strings.HasSuffix(strings.ToLower(item.Path), ".pf") {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	for _, item := range items {
+		name := item.Path
+		if item.Truncated {
+			manifest.AddError(name, parseErrorPrefix+"copy was truncated by the size limits")
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(prefetchDir, name))
+		if err != nil {
+			manifest.AddError(name, parseErrorPrefix+err.Error())
+			continue
+		}
+		file, err := prefetch.Parse(data)
+		if err != nil {
+			manifest.AddError(name, parseErrorPrefix+err.Error())
+			continue
+		}
+		report.Files[name] = newParsedPrefetch(file)
+	}
+
+	outputPath := filepath.Join(prefetchDir, parsedFileName)
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal parsed prefetch: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write parsed prefetch: %w", err)
+	}
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat parsed prefetch: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash parsed prefetch: %w", err)
+	}
+	manifest.RemoveItem(parsedFileName)
+	manifest.ParsedFiles = len(report.Files)
+	note := fmt.Sprintf("Decoded prefetch run counts, run times and loaded files (%d of %d files)", len(report.Files), len(items))
+	manifest.AddItem(parsedFileName, stat.Size(), sha256Hex, false, stat.ModTime(), note)
+	return nil
+}
+
+// newParsedPrefetch converts a decoded prefetch file to its JSON form.
+func newParsedPrefetch(file *prefetch.File) ParsedPrefetch {
+	parsed := ParsedPrefetch{
+		Version:     file.Version,
+		Compressed:  file.Compressed,
+		Executable:  file.ExecutableName,
+		Hash:        fmt.Sprintf("%08X", file.Hash),
+		RunCount:    file.RunCount,
+		LastRun:     make([]string, 0, len(file.LastRunTimes)),
+		Volumes:     make([]PrefetchVolume, 0, len(file.Volumes)),
+		FilesLoaded: file.Files,
+	}
+	if parsed.FilesLoaded == nil {
+		parsed.FilesLoaded = make([]string, 0)
+	}
+	for _, t := range file.LastRunTimes {
+		parsed.LastRun = append(parsed.LastRun, winutil.FormatTime(t))
+	}
+	for _, v := range file.Volumes {
+		volume := PrefetchVolume{
+			DevicePath:   v.DevicePath,
+			SerialNumber: fmt.Sprintf("%08X", v.SerialNumber),
+			Directories:  v.Directories,
+		}
+		if !v.Created.IsZero() {
+			volume.Created = winutil.FormatTime(v.Created)
+		}
+		if volume.Directories == nil {
+			volume.Directories = make([]string, 0)
+		}
+		parsed.Volumes = append(parsed.Volumes, volume)
+	}
+	return parsed
+}
+
+// AnalyzePrefetch rebuilds prefetch_parsed.json from the .pf files in a
+// collected windows/prefetch directory, for the analyze command.
+func AnalyzePrefetch(ctx context.Context, moduleDir string) ([]string, error) {
+	prefetchDir := filepath.Join(moduleDir, "windows", "prefetch")
+	manifestPath := filepath.Join(prefetchDir, "manifest.json")
+	manifest, err := LoadPrefetchManifest(manifestPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prefetch manifest: %w", err)
+	}
+	if err := WriteParsedPrefetch(ctx, prefetchDir, manifest); err != nil {
+		return nil, err
+	}
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return []string{"windows/prefetch/" + parsedFileName}, fmt.Errorf("failed to write prefetch manifest: %w", err)
+	}
+	return []string{"windows/prefetch/" + parsedFileName, "windows/prefetch/manifest.json"}, nil
+}
@@ -14,11 +14,19 @@ func NewWinPrefetch() *WinPrefetch {
 	return &WinPrefetch{}
 }
 
+// SetSinceTime is a no-op on non-Windows platforms.
+func (w *WinPrefetch) SetSinceTime(sinceRFC3339 string) {}
+
 // Name returns the module's identifier.
 func (w *WinPrefetch) Name() string {
 	return "windows/prefetch"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinPrefetch) Describe() string {
+	return "Windows Prefetch files"
+}
+
 // Collect is a no-op on non-Windows platforms and always returns nil.
 func (w *WinPrefetch) Collect(ctx context.Context, outDir string) error {
 	// This module only works on Windows, so it's a no-op on other platforms
@@ -4,27 +4,42 @@ package win_prefetch
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"cryptkeeper/internal/winutil"
 )
 
 // WinPrefetch represents the Windows prefetch file collection module.
-type WinPrefetch struct{}
+type WinPrefetch struct {
+	since time.Time // Prefetch files modified before this are skipped; zero collects all
+}
 
 // NewWinPrefetch creates a new Windows prefetch collection module.
 func NewWinPrefetch() *WinPrefetch {
 	return &WinPrefetch{}
 }
 
+// SetSinceTime skips prefetch files last modified, and so last run, before
+// the RFC3339 cutoff.
+func (w *WinPrefetch) SetSinceTime(sinceRFC3339 string) {
+	w.since = winutil.ParseSince(sinceRFC3339)
+}
+
 // Name returns the module's identifier.
 func (w *WinPrefetch) Name() string {
 	return "windows/prefetch"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinPrefetch) Describe() string {
+	return "Windows Prefetch files"
+}
+
 // Collect copies Windows prefetch files and creates a manifest.
 func (w *WinPrefetch) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/prefetch subdirectory
@@ -34,24 +49,25 @@ func (w *WinPrefetch) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Determine prefetch path
-	systemRoot := os.Getenv("SystemRoot")
-	if systemRoot == "" {
-		systemRoot = "C:\\Windows"
-	}
+	systemRoot := winutil.SystemRoot()
 	prefetchPath := filepath.Join(systemRoot, "Prefetch")
 
 	// Check if prefetch is enabled by checking if directory exists and has .pf files
+	winutil.CollectSettingsFrom(ctx).Coverage.Check(prefetchDir, "prefetch files", prefetchPath)
 	prefetchEnabled, totalFiles := w.checkPrefetchStatus(prefetchPath)
 
 	// Create manifest
-	manifest := NewPrefetchManifest(hostname, prefetchEnabled, prefetchPath)
+	manifest := NewPrefetchManifest(ctx, hostname, prefetchEnabled, prefetchPath)
 	manifest.SetTotalFiles(totalFiles)
+	if !w.since.IsZero() {
+		manifest.Since = winutil.FormatTime(w.since)
+	}
 
 	// If prefetch is not enabled or no files found, still create manifest
 	if !prefetchEnabled || totalFiles == 0 {
@@ -66,13 +82,18 @@ func (w *WinPrefetch) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Collect all .pf files
 	if err := w.collectPrefetchFiles(ctx, prefetchPath, prefetchDir, manifest, constraints); err != nil {
 		return fmt.Errorf("failed to collect prefetch files: %w", err)
 	}
 
+	// Decode the copies; a file that fails to parse is a manifest error
+	if err := WriteParsedPrefetch(ctx, prefetchDir, manifest); err != nil {
+		manifest.AddError(parsedFileName, err.Error())
+	}
+
 	// Write manifest
 	manifestPath := filepath.Join(prefetchDir, "manifest.json")
 	if err := manifest.WriteManifest(manifestPath); err != nil {
@@ -146,7 +167,11 @@ func (w *WinPrefetch) collectPrefetchFile(srcPath, destPath string, manifest *Pr
 	}
 
 	// Use smart copy with size constraints
-	size, sha256Hex, truncated, err := winutil.SmartCopy(srcPath, destPath, constraints)
+	size, sha256Hex, truncated, err := winutil.SmartCopySince(srcPath, destPath, constraints, w.since)
+	if errors.Is(err, winutil.ErrBeforeSince) {
+		manifest.IncrementSkippedBySince()
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to copy prefetch file: %w", err)
 	}
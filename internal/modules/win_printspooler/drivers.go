@@ -0,0 +1,435 @@
+package win_printspooler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// recentDriverWindow defines how recently a driver must have been installed to
+// be flagged when --since is not given.
+const recentDriverWindow = 30 * 24 * time.Hour
+
+// Registry keys holding the spooler's driver, monitor, port, and policy configuration.
+const (
+	printEnvironmentsKey = `HKLM\SYSTEM\CurrentControlSet\Control\Print\Environments`
+	printMonitorsKey     = `HKLM\SYSTEM\CurrentControlSet\Control\Print\Monitors`
+	printPortsKey        = `HKLM\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Ports`
+	pointAndPrintKey     = `HKLM\SOFTWARE\Policies\Microsoft\Windows NT\Printers\PointAndPrint`
+)
+
+// printConfigKeys lists the keys queried recursively for print_drivers.json.
+var printConfigKeys = []string{printEnvironmentsKey, printMonitorsKey, printPortsKey, pointAndPrintKey}
+
+// defaultMonitorDLLs are the port monitor DLLs shipped with Windows. Any other
+// monitor DLL is loaded into spoolsv.exe as SYSTEM and is a known persistence point.
+var defaultMonitorDLLs = map[string]bool{
+	"localspl.dll": true,
+	"tcpmon.dll":   true,
+	"usbmon.dll":   true,
+	"wsdmon.dll":   true,
+	"apmon.dll":    true,
+	"appmon.dll":   true,
+	"fxsmon.dll":   true,
+}
+
+// environmentDirs maps spooler environment names to their driver directory under spool\drivers.
+var environmentDirs = map[string]string{
+	"windows x64":    "x64",
+	"windows nt x86": "W32X86",
+	"windows arm64":  "ARM64",
+	"windows ia64":   "IA64",
+}
+
+// PrintDriver is an installed printer driver.
+type PrintDriver struct {
+	Name           string   `json:"name"`
+	Environment    string   `json:"environment"` // e.g. "Windows x64"
+	Version        string   `json:"version"`     // Driver model version, e.g. "3" or "4"
+	Manufacturer   string   `json:"manufacturer,omitempty"`
+	Provider       string   `json:"provider,omitempty"`
+	InfPath        string   `json:"inf_path,omitempty"`
+	DriverPath     string   `json:"driver_path,omitempty"`
+	ConfigFile     string   `json:"config_file,omitempty"`
+	DataFile       string   `json:"data_file,omitempty"`
+	DependentFiles []string `json:"dependent_files,omitempty"`
+	DriverDate     string   `json:"driver_date,omitempty"`
+	DriverVersion  string   `json:"driver_version,omitempty"`
+	InstalledUTC   string   `json:"installed_utc,omitempty"` // Newest creation or modification time of the driver files
+	Sources        []string `json:"sources"`                 // "registry", "powershell"
+	Flags          []string `json:"flags,omitempty"`         // Suspicious indicators
+}
+
+// Files returns the driver, configuration, data, and dependent files of the driver.
+func (d PrintDriver) Files() []string {
+	files := make([]string, 0, 3+len(d.DependentFiles))
+	for _, f := range append([]string{d.DriverPath, d.ConfigFile, d.DataFile}, d.DependentFiles...) {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// PortMonitor is a registered print port monitor.
+type PortMonitor struct {
+	Name   string   `json:"name"`
+	Driver string   `json:"driver"`
+	Flags  []string `json:"flags,omitempty"`
+}
+
+// PrintPort is a configured printer port.
+type PrintPort struct {
+	Name    string   `json:"name"`
+	Monitor string   `json:"monitor,omitempty"`
+	Flags   []string `json:"flags,omitempty"`
+}
+
+// PrintDriverReport is the structure written to print_drivers.json.
+type PrintDriverReport struct {
+	CollectedUTC   string        `json:"collected_utc"`
+	RecentSinceUTC string        `json:"recent_since_utc"` // Drivers installed after this are flagged recently_added
+	Drivers        []PrintDriver `json:"drivers"`
+	Monitors       []PortMonitor `json:"monitors"`
+	Ports          []PrintPort   `json:"ports"`
+	FlaggedDrivers int           `json:"flagged_drivers"`
+	Findings       []string      `json:"findings"`
+	Errors         []string      `json:"errors,omitempty"`
+}
+
+// ParseRegistryDrivers extracts drivers from `reg query <Environments> /s` output,
+// where each driver is a key Environments\<env>\Drivers\Version-<n>\<name>.
+func ParseRegistryDrivers(keys []winutil.RegKey) []PrintDriver {
+	drivers := make([]PrintDriver, 0)
+	for _, key := range keys {
+		parts, ok := subkeyParts(key.Path, printEnvironmentsKey)
+		if !ok || len(parts) != 4 || !strings.EqualFold(parts[1], "Drivers") || !strings.HasPrefix(strings.ToLower(parts[2]), "version-") {
+			continue
+		}
+
+		driver := PrintDriver{
+			Name:        parts[3],
+			Environment: parts[0],
+			Version:     parts[2][len("version-"):],
+			Sources:     []string{"registry"},
+		}
+		for _, v := range key.Values {
+			switch strings.ToLower(v.Name) {
+			case "driver":
+				driver.DriverPath = v.Data
+			case "configuration file":
+				driver.ConfigFile = v.Data
+			case "data file":
+				driver.DataFile = v.Data
+			case "dependent files":
+				driver.DependentFiles = splitMultiString(v.Data)
+			case "manufacturer":
+				driver.Manufacturer = v.Data
+			case "provider":
+				driver.Provider = v.Data
+			case "infpath":
+				driver.InfPath = v.Data
+			}
+		}
+		drivers = append(drivers, driver)
+	}
+
+	return drivers
+}
+
+// ParseRegistryMonitors extracts port monitors (Monitors\<name> with a Driver value).
+func ParseRegistryMonitors(keys []winutil.RegKey) []PortMonitor {
+	monitors := make([]PortMonitor, 0)
+	for _, key := range keys {
+		parts, ok := subkeyParts(key.Path, printMonitorsKey)
+		if !ok || len(parts) != 1 {
+			continue
+		}
+		monitor := PortMonitor{Name: parts[0]}
+		if v, ok := key.Value("Driver"); ok {
+			monitor.Driver = v.Data
+		}
+		if monitor.Driver != "" && !defaultMonitorDLLs[strings.ToLower(baseName(monitor.Driver))] {
+			monitor.Flags = append(monitor.Flags, "non_default_monitor_dll")
+		}
+		monitors = append(monitors, monitor)
+	}
+	return monitors
+}
+
+// ParseRegistryPorts extracts ports from the value names of the Ports key and
+// from monitor-specific Monitors\<monitor>\Ports\<port> subkeys.
+func ParseRegistryPorts(keys []winutil.RegKey) []PrintPort {
+	ports := make([]PrintPort, 0)
+	for _, key := range keys {
+		if normalizeKey(key.Path) == normalizeKey(printPortsKey) {
+			for _, v := range key.Values {
+				ports = append(ports, PrintPort{Name: v.Name, Flags: portFlags(v.Name)})
+			}
+			continue
+		}
+		if parts, ok := subkeyParts(key.Path, printMonitorsKey); ok && len(parts) == 3 && strings.EqualFold(parts[1], "Ports") {
+			ports = append(ports, PrintPort{Name: parts[2], Monitor: parts[0], Flags: portFlags(parts[2])})
+		}
+	}
+	return ports
+}
+
+// portFlags flags ports that name a file system path. Writing a print job to
+// such a port drops arbitrary files as SYSTEM (CVE-2020-1048 "PrintDemon").
+func portFlags(name string) []string {
+	if isAbsWindowsPath(name) {
+		return []string{"file_path_port"}
+	}
+	return nil
+}
+
+// PointAndPrintFindings reports Point and Print policy values that permit
+// unprivileged driver installation (the PrintNightmare exposure).
+func PointAndPrintFindings(keys []winutil.RegKey) []string {
+	findings := make([]string, 0)
+	for _, key := range keys {
+		if normalizeKey(key.Path) != normalizeKey(pointAndPrintKey) {
+			continue
+		}
+		if v, ok := key.DWORD("NoWarningNoElevationOnInstall"); ok && v == 1 {
+			findings = append(findings, "point_and_print_no_elevation: NoWarningNoElevationOnInstall=1 installs drivers without a UAC prompt")
+		}
+		if v, ok := key.DWORD("UpdatePromptSettings"); ok && v != 0 {
+			findings = append(findings, fmt.Sprintf("point_and_print_update_no_prompt: UpdatePromptSettings=%d", v))
+		}
+		if v, ok := key.DWORD("RestrictDriverInstallationToAdministrators"); ok && v == 0 {
+			findings = append(findings, "driver_install_unrestricted: RestrictDriverInstallationToAdministrators=0 lets non-admins install drivers")
+		}
+	}
+	return findings
+}
+
+// rawPrinterDriver mirrors the shape emitted by the Get-PrinterDriver PowerShell pipeline.
+type rawPrinterDriver struct {
+	Name               string   `json:"Name"`
+	PrinterEnvironment string   `json:"PrinterEnvironment"`
+	MajorVersion       int      `json:"MajorVersion"`
+	Manufacturer       string   `json:"Manufacturer"`
+	Provider           string   `json:"Provider"`
+	InfPath            string   `json:"InfPath"`
+	Path               string   `json:"Path"`
+	ConfigFile         string   `json:"ConfigFile"`
+	DataFile           string   `json:"DataFile"`
+	DependentFiles     []string `json:"DependentFiles"`
+	DriverDate         string   `json:"DriverDate"`
+	DriverVersion      string   `json:"DriverVersion"`
+}
+
+// ParsePrinterDrivers decodes the JSON produced by the Get-PrinterDriver pipeline.
+func ParsePrinterDrivers(data []byte) ([]PrintDriver, error) {
+	var raws []rawPrinterDriver
+	if err := unmarshalPowerShellJSON(data, &raws); err != nil {
+		return nil, fmt.Errorf("failed to parse Get-PrinterDriver output: %w", err)
+	}
+
+	drivers := make([]PrintDriver, 0, len(raws))
+	for _, raw := range raws {
+		drivers = append(drivers, PrintDriver{
+			Name:           raw.Name,
+			Environment:    raw.PrinterEnvironment,
+			Version:        fmt.Sprintf("%d", raw.MajorVersion),
+			Manufacturer:   raw.Manufacturer,
+			Provider:       raw.Provider,
+			InfPath:        raw.InfPath,
+			DriverPath:     raw.Path,
+			ConfigFile:     raw.ConfigFile,
+			DataFile:       raw.DataFile,
+			DependentFiles: raw.DependentFiles,
+			DriverDate:     raw.DriverDate,
+			DriverVersion:  raw.DriverVersion,
+			Sources:        []string{"powershell"},
+		})
+	}
+
+	return drivers, nil
+}
+
+// MergeDrivers combines registry and Get-PrinterDriver results for the same
+// driver (matched on name, environment, and version). Registry values win;
+// live values fill the gaps, since Get-PrinterDriver reports full paths and dates.
+func MergeDrivers(registry, live []PrintDriver) []PrintDriver {
+	merged := make([]PrintDriver, 0, len(registry)+len(live))
+	index := make(map[string]int)
+	key := func(d PrintDriver) string {
+		return strings.ToLower(d.Name + "|" + d.Environment + "|" + d.Version)
+	}
+
+	for _, d := range registry {
+		index[key(d)] = len(merged)
+		merged = append(merged, d)
+	}
+	for _, d := range live {
+		i, ok := index[key(d)]
+		if !ok {
+			index[key(d)] = len(merged)
+			merged = append(merged, d)
+			continue
+		}
+		m := &merged[i]
+		m.Sources = append(m.Sources, d.Sources...)
+		// Prefer the absolute paths reported by the spooler
+		if isAbsWindowsPath(d.DriverPath) {
+			m.DriverPath = d.DriverPath
+		}
+		if isAbsWindowsPath(d.ConfigFile) {
+			m.ConfigFile = d.ConfigFile
+		}
+		if isAbsWindowsPath(d.DataFile) {
+			m.DataFile = d.DataFile
+		}
+		if len(d.DependentFiles) > 0 {
+			m.DependentFiles = d.DependentFiles
+		}
+		fillEmpty(&m.Manufacturer, d.Manufacturer)
+		fillEmpty(&m.Provider, d.Provider)
+		fillEmpty(&m.InfPath, d.InfPath)
+		fillEmpty(&m.DriverDate, d.DriverDate)
+		fillEmpty(&m.DriverVersion, d.DriverVersion)
+	}
+
+	sort.Slice(merged, func(i, j int) bool { return key(merged[i]) < key(merged[j]) })
+	return merged
+}
+
+// ResolveDriverFile returns the full path of a driver file. The registry
+// stores bare file names relative to spool\drivers\<arch>\<version>.
+func ResolveDriverFile(systemRoot, environment, version, file string) string {
+	if file == "" || isAbsWindowsPath(file) {
+		return file
+	}
+	arch, ok := environmentDirs[strings.ToLower(environment)]
+	if !ok {
+		arch = environment
+	}
+	return strings.Join([]string{systemRoot, "System32", "spool", "drivers", arch, version, file}, `\`)
+}
+
+// FlagDrivers sets the suspicious indicators on each driver and returns the
+// number flagged. Driver files outside the spooler's driver directory and the
+// driver store are flagged non_standard_path; drivers whose files were
+// created or modified at or after cutoff are flagged recently_added.
+func FlagDrivers(drivers []PrintDriver, systemRoot string, cutoff time.Time) int {
+	standardDirs := []string{
+		normalizePath(systemRoot + `\System32\spool\drivers\`),
+		normalizePath(systemRoot + `\System32\DriverStore\`),
+	}
+
+	flagged := 0
+	for i := range drivers {
+		d := &drivers[i]
+		d.Flags = nil
+
+		for _, f := range d.Files() {
+			path := normalizePath(ResolveDriverFile(systemRoot, d.Environment, d.Version, f))
+			standard := false
+			for _, dir := range standardDirs {
+				if strings.HasPrefix(path, dir) {
+					standard = true
+					break
+				}
+			}
+			if !standard {
+				d.Flags = append(d.Flags, "non_standard_path")
+				break
+			}
+		}
+
+		if installed, err := winutil.ParseTime(d.InstalledUTC); err == nil && !cutoff.IsZero() && !installed.Before(cutoff) {
+			d.Flags = append(d.Flags, "recently_added")
+		}
+
+		if len(d.Flags) > 0 {
+			flagged++
+		}
+	}
+
+	return flagged
+}
+
+// hasFlag reports whether flags contains flag.
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// subkeyParts returns the path components of key below parent, if it is a descendant.
+func subkeyParts(key, parent string) ([]string, bool) {
+	k, p := normalizeKey(key), normalizeKey(parent)+`\`
+	if !strings.HasPrefix(k, p) {
+		return nil, false
+	}
+	rest := strings.TrimSpace(key)[len(strings.TrimSpace(key))-(len(k)-len(p)):]
+	return strings.Split(rest, `\`), true
+}
+
+// normalizeKey lowercases a key path and abbreviates the hive name.
+func normalizeKey(path string) string {
+	lower := strings.ToLower(strings.TrimSpace(path))
+	return strings.Replace(lower, "hkey_local_machine", "hklm", 1)
+}
+
+// normalizePath lowercases a Windows path and uses backslash separators.
+func normalizePath(path string) string {
+	return strings.ToLower(strings.ReplaceAll(path, "/", `\`))
+}
+
+// isAbsWindowsPath reports whether path has a drive letter or is a UNC path.
+func isAbsWindowsPath(path string) bool {
+	if len(path) >= 3 && path[1] == ':' && (path[2] == '\\' || path[2] == '/') {
+		return true
+	}
+	return strings.HasPrefix(path, `\\`)
+}
+
+// baseName returns the last component of a Windows path.
+func baseName(path string) string {
+	if i := strings.LastIndexAny(path, `\/`); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// splitMultiString splits REG_MULTI_SZ data, which reg.exe prints joined by a literal \0.
+func splitMultiString(data string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(data, `\0`) {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func fillEmpty(dst *string, value string) {
+	if *dst == "" {
+		*dst = value
+	}
+}
+
+// unmarshalPowerShellJSON decodes ConvertTo-Json output, which emits a bare object
+// instead of an array when the pipeline yields a single item.
+func unmarshalPowerShellJSON(data []byte, v interface{}) error {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] == '{' {
+		data = append(append([]byte("["), data...), ']')
+	}
+	return json.Unmarshal(data, v)
+}
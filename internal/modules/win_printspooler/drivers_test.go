@@ -0,0 +1,170 @@
+package win_printspooler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// sampleSpoolerRegistry is `reg query` output for the spooler keys of a host
+// where a driver was added the day before collection.
+const sampleSpoolerRegistry = `
+HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control\Print\Environments\Windows x64
+    Directory    REG_SZ    x64
+
+HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control\Print\Environments\Windows x64\Drivers\Version-3\Microsoft Print To PDF
+    Configuration File    REG_SZ    PrintConfig.dll
+    Data File    REG_SZ    MPDW-PDC.xml
+    Driver    REG_SZ    mxdwdrv.dll
+    Dependent Files    REG_MULTI_SZ    MPDW-manifest.ini\0MPDW-constraints.js
+    Manufacturer    REG_SZ    Microsoft
+    InfPath    REG_SZ    C:\Windows\System32\DriverStore\FileRepository\prnms009.inf_amd64_3107874c7db0aa5a\prnms009.inf
+
+HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control\Print\Environments\Windows x64\Drivers\Version-3\HP Universal Printing PCL 6
+    Configuration File    REG_SZ    unidrvui.dll
+    Driver    REG_SZ    unidrv.dll
+    Manufacturer    REG_SZ    HP
+
+HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control\Print\Environments\Windows x64\Drivers\Version-3\HP Universal Printing PCL 6\Files
+    Count    REG_DWORD    0x2
+
+HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control\Print\Monitors\Local Port
+    Driver    REG_SZ    localspl.dll
+
+HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control\Print\Monitors\Standard TCP/IP Port
+    Driver    REG_SZ    tcpmon.dll
+
+HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control\Print\Monitors\Standard TCP/IP Port\Ports\IP_10.0.4.20
+    HostName    REG_SZ    10.0.4.20
+
+HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control\Print\Monitors\AppMonitor
+    Driver    REG_SZ    C:\ProgramData\svc\monhost.dll
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Ports
+    COM1:    REG_SZ    9600,n,8,1
+    C:\Windows\System32\wbem\wbemcomn.dll    REG_SZ
+    PORTPROMPT:    REG_SZ
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Microsoft\Windows NT\Printers\PointAndPrint
+    RestrictDriverInstallationToAdministrators    REG_DWORD    0x0
+    NoWarningNoElevationOnInstall    REG_DWORD    0x1
+`
+
+// samplePrinterDrivers is Get-PrinterDriver output for the same host: the PDF
+// driver, plus a driver the attacker added from a user-writable directory.
+const samplePrinterDrivers = `[
+{"Name":"Microsoft Print To PDF","PrinterEnvironment":"Windows x64","MajorVersion":3,"Manufacturer":"Microsoft","Path":"C:\\Windows\\System32\\DriverStore\\FileRepository\\prnms009.inf_amd64_3107874c7db0aa5a\\Amd64\\mxdwdrv.dll","ConfigFile":"C:\\Windows\\system32\\spool\\DRIVERS\\x64\\3\\PrintConfig.dll","DataFile":"C:\\Windows\\system32\\spool\\DRIVERS\\x64\\3\\MPDW-PDC.xml","DependentFiles":["C:\\Windows\\system32\\spool\\DRIVERS\\x64\\3\\MPDW-manifest.ini"],"DriverDate":"2006-06-21T00:00:00Z","DriverVersion":"10.0.19041.1"},
+{"Name":"Generic Fax Driver","PrinterEnvironment":"Windows x64","MajorVersion":3,"Manufacturer":"Generic","Path":"C:\\Users\\Public\\Documents\\nightmare.dll","ConfigFile":"C:\\Windows\\system32\\spool\\DRIVERS\\x64\\3\\unidrvui.dll","DataFile":"","DependentFiles":null,"DriverDate":"2021-07-01T00:00:00Z","DriverVersion":"1.0.0.0"}
+]`
+
+func TestFlagDriversMarksRecentlyAdded(t *testing.T) {
+	const systemRoot = `C:\Windows`
+	keys := winutil.ParseRegQuery([]byte(strings.ReplaceAll(sampleSpoolerRegistry, "\n", "\r\n")))
+	live, err := ParsePrinterDrivers([]byte(samplePrinterDrivers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drivers := MergeDrivers(ParseRegistryDrivers(keys), live)
+	if len(drivers) != 3 {
+		t.Fatalf("merged %d drivers, want 3: %+v", len(drivers), drivers)
+	}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	installed := map[string]time.Time{
+		"Generic Fax Driver":          now.Add(-2 * time.Hour),
+		"HP Universal Printing PCL 6": now.Add(-24 * time.Hour),
+		"Microsoft Print To PDF":      time.Date(2019, 12, 7, 9, 14, 0, 0, time.UTC),
+	}
+	for i := range drivers {
+		drivers[i].InstalledUTC = winutil.FormatTime(installed[drivers[i].Name])
+	}
+
+	flagged := FlagDrivers(drivers, systemRoot, now.Add(-recentDriverWindow))
+	want := map[string][]string{
+		"Generic Fax Driver":          {"non_standard_path", "recently_added"},
+		"HP Universal Printing PCL 6": {"recently_added"},
+		"Microsoft Print To PDF":      nil,
+	}
+	for _, d := range drivers {
+		if !reflect.DeepEqual(d.Flags, want[d.Name]) {
+			t.Errorf("%s flags = %v, want %v", d.Name, d.Flags, want[d.Name])
+		}
+	}
+	if flagged != 2 {
+		t.Errorf("flagged %d drivers, want 2", flagged)
+	}
+
+	// Narrowing the window with --since leaves only the newest driver recent
+	flagged = FlagDrivers(drivers, systemRoot, now.Add(-6*time.Hour))
+	for _, d := range drivers {
+		if d.Name == "HP Universal Printing PCL 6" && hasFlag(d.Flags, "recently_added") {
+			t.Error("driver added before --since flagged recently_added")
+		}
+	}
+	if flagged != 1 {
+		t.Errorf("flagged %d drivers after --since, want 1", flagged)
+	}
+}
+
+func TestMergeDriversPrefersSpoolerPaths(t *testing.T) {
+	keys := winutil.ParseRegQuery([]byte(sampleSpoolerRegistry))
+	live, err := ParsePrinterDrivers([]byte(samplePrinterDrivers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pdf PrintDriver
+	for _, d := range MergeDrivers(ParseRegistryDrivers(keys), live) {
+		if d.Name == "Microsoft Print To PDF" {
+			pdf = d
+		}
+	}
+	if !reflect.DeepEqual(pdf.Sources, []string{"registry", "powershell"}) || pdf.Version != "3" {
+		t.Fatalf("merged driver = %+v", pdf)
+	}
+	if !strings.HasSuffix(pdf.DriverPath, `\Amd64\mxdwdrv.dll`) || pdf.DriverVersion != "10.0.19041.1" {
+		t.Errorf("merged driver paths = %s, %s", pdf.DriverPath, pdf.DriverVersion)
+	}
+	if want := []string{`C:\Windows\system32\spool\DRIVERS\x64\3\MPDW-manifest.ini`}; !reflect.DeepEqual(pdf.DependentFiles, want) {
+		t.Errorf("dependent files = %v", pdf.DependentFiles)
+	}
+
+	// Registry-only drivers resolve bare names under spool\drivers
+	if got := ResolveDriverFile(`C:\Windows`, "Windows x64", "3", "unidrv.dll"); got != `C:\Windows\System32\spool\drivers\x64\3\unidrv.dll` {
+		t.Errorf("resolved driver file = %s", got)
+	}
+}
+
+func TestSpoolerRegistryFindings(t *testing.T) {
+	keys := winutil.ParseRegQuery([]byte(sampleSpoolerRegistry))
+
+	monitors := ParseRegistryMonitors(keys)
+	if len(monitors) != 3 {
+		t.Fatalf("monitors = %+v", monitors)
+	}
+	for _, m := range monitors {
+		wantFlagged := m.Name == "AppMonitor"
+		if (len(m.Flags) > 0) != wantFlagged {
+			t.Errorf("monitor %s flags = %v", m.Name, m.Flags)
+		}
+	}
+
+	ports := ParseRegistryPorts(keys)
+	names := make([]string, 0, len(ports))
+	for _, p := range ports {
+		names = append(names, p.Name)
+		if wantFlagged := strings.HasPrefix(p.Name, `C:\`); hasFlag(p.Flags, "file_path_port") != wantFlagged {
+			t.Errorf("port %s flags = %v", p.Name, p.Flags)
+		}
+	}
+	if want := []string{"IP_10.0.4.20", "COM1:", `C:\Windows\System32\wbem\wbemcomn.dll`, "PORTPROMPT:"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ports = %v, want %v", names, want)
+	}
+
+	findings := PointAndPrintFindings(keys)
+	if len(findings) != 2 || !strings.HasPrefix(findings[0], "point_and_print_no_elevation") || !strings.HasPrefix(findings[1], "driver_install_unrestricted") {
+		t.Errorf("Point and Print findings = %q", findings)
+	}
+}
@@ -0,0 +1,100 @@
+// Package win_printspooler provides Windows print spooler driver, port, and spool file collection for cryptkeeper.
+package win_printspooler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
+)
+
+// PrintSpoolerItem represents a collected print spooler artifact.
+type PrintSpoolerItem struct {
+	Path      string `json:"path"`           // Relative path in the archive
+	Size      int64  `json:"size"`           // File size in bytes
+	SHA256    string `json:"sha256"`         // SHA-256 hash
+	Truncated bool   `json:"truncated"`      // Whether the file was truncated due to size limits
+	Note      string `json:"note,omitempty"` // Description of the file
+	Modified  string `json:"modified"`       // File modification time (RFC3339)
+	FileType  string `json:"file_type"`      // Type: "print_drivers", "driver_file", "spool_file"
+}
+
+// PrintSpoolerError represents an error that occurred during collection.
+type PrintSpoolerError struct {
+	Target string `json:"target"` // What failed (e.g., specific file path)
+	Error  string `json:"error"`  // Error message
+}
+
+// PrintSpoolerManifest represents the complete manifest for print spooler collection.
+type PrintSpoolerManifest struct {
+	CreatedUTC         string              `json:"created_utc"`
+	Host               string              `json:"host"`
+	CryptkeeperVersion string              `json:"cryptkeeper_version"`
+	Items              []PrintSpoolerItem  `json:"items"`
+	Errors             []PrintSpoolerError `json:"errors"`
+	TotalFiles         int                 `json:"total_files"`
+	CollectedFiles     int                 `json:"collected_files"`
+	DriversFound       int                 `json:"drivers_found"`
+	Summary            schema.Summary      `json:"summary"`
+}
+
+// NewPrintSpoolerManifest creates a new print spooler manifest with basic information.
+func NewPrintSpoolerManifest(ctx context.Context, hostname string) *PrintSpoolerManifest {
+	return &PrintSpoolerManifest{
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
+		Host:               hostname,
+		CryptkeeperVersion: "v0.1.0",
+		Items:              make([]PrintSpoolerItem, 0),
+		Errors:             make([]PrintSpoolerError, 0),
+		TotalFiles:         0,
+		CollectedFiles:     0,
+		DriversFound:       0,
+		Summary:            schema.NewSummary(),
+	}
+}
+
+// AddItem adds a successfully collected print spooler item to the manifest.
+func (pm *PrintSpoolerManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, note string) {
+	pm.Items = append(pm.Items, PrintSpoolerItem{
+		Path:      path,
+		Size:      size,
+		SHA256:    sha256,
+		Truncated: truncated,
+		Note:      note,
+		Modified:  winutil.FormatTime(modified),
+		FileType:  fileType,
+	})
+	pm.CollectedFiles++
+}
+
+// AddError adds an error to the manifest for a failed collection.
+func (pm *PrintSpoolerManifest) AddError(target, errorMsg string) {
+	pm.Errors = append(pm.Errors, PrintSpoolerError{
+		Target: target,
+		Error:  errorMsg,
+	})
+}
+
+// IncrementTotalFiles increments the count of total files found.
+func (pm *PrintSpoolerManifest) IncrementTotalFiles() {
+	pm.TotalFiles++
+}
+
+// SetDriversFound sets the number of installed printer drivers enumerated.
+func (pm *PrintSpoolerManifest) SetDriversFound(count int) {
+	pm.DriversFound = count
+	pm.Summary.Set(schema.SummaryPrintDrivers, count)
+}
+
+// WriteManifest writes the manifest to a JSON file.
+func (pm *PrintSpoolerManifest) WriteManifest(manifestPath string) error {
+	data, err := json.MarshalIndent(pm, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath, data, 0644)
+}
@@ -0,0 +1,34 @@
+//go:build !windows
+
+package win_printspooler
+
+import (
+	"context"
+)
+
+// WinPrintSpooler represents the Windows print spooler collection module (no-op on non-Windows).
+type WinPrintSpooler struct{}
+
+// NewWinPrintSpooler creates a new Windows print spooler collection module.
+func NewWinPrintSpooler() *WinPrintSpooler {
+	return &WinPrintSpooler{}
+}
+
+// SetSinceTime is a no-op on non-Windows systems.
+func (w *WinPrintSpooler) SetSinceTime(sinceRFC3339 string) {}
+
+// Name returns the module's identifier.
+func (w *WinPrintSpooler) Name() string {
+	return "windows/printspooler"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinPrintSpooler) Describe() string {
+	return "Printer drivers, ports, and spool files"
+}
+
+// Collect is a no-op on non-Windows systems.
+func (w *WinPrintSpooler) Collect(ctx context.Context, outDir string) error {
+	// No-op on non-Windows systems
+	return nil
+}
@@ -0,0 +1,354 @@
+//go:build windows
+
+package win_printspooler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// printerDriversScript lists installed drivers with full file paths; dates are
+// formatted in PowerShell so the JSON does not carry /Date()/ literals.
+const printerDriversScript = `Get-PrinterDriver | Select-Object Name, PrinterEnvironment, MajorVersion, Manufacturer, Provider, InfPath, Path, ConfigFile, DataFile, DependentFiles, @{Name='DriverDate';Expression={ if ($_.DriverDate) { $_.DriverDate.ToUniversalTime().ToString('yyyy-MM-ddTHH:mm:ssZ') } }}, @{Name='DriverVersion';Expression={ [string]$_.DriverVersion }} | ConvertTo-Json -Compress`
+
+// WinPrintSpooler represents the Windows print spooler collection module.
+type WinPrintSpooler struct {
+	sinceTime string // RFC3339 timestamp; drivers installed after it are copied and flagged
+}
+
+// NewWinPrintSpooler creates a new Windows print spooler collection module.
+func NewWinPrintSpooler() *WinPrintSpooler {
+	return &WinPrintSpooler{}
+}
+
+// SetSinceTime configures the cutoff for recently added drivers.
+func (w *WinPrintSpooler) SetSinceTime(sinceRFC3339 string) {
+	w.sinceTime = sinceRFC3339
+}
+
+// Name returns the module's identifier.
+func (w *WinPrintSpooler) Name() string {
+	return "windows/printspooler"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinPrintSpooler) Describe() string {
+	return "Printer drivers, ports, and spool files"
+}
+
+// Collect enumerates printer drivers, ports, and monitors, copies recently
+// added or out-of-place driver files and pending spool files, and creates a manifest.
+func (w *WinPrintSpooler) Collect(ctx context.Context, outDir string) error {
+	// Create the windows/printspooler subdirectory
+	spoolerDir := filepath.Join(outDir, "windows", "printspooler")
+	if err := winutil.EnsureDir(spoolerDir); err != nil {
+		return fmt.Errorf("failed to create print spooler directory: %w", err)
+	}
+
+	// Get hostname for manifest
+	hostname, err := winutil.Hostname(ctx)
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	// Create manifest
+	manifest := NewPrintSpoolerManifest(ctx, hostname)
+
+	// Initialize size constraints
+	constraints := winutil.NewSizeConstraints(ctx)
+
+	systemRoot := winutil.SystemRoot()
+	cutoff := w.cutoff(ctx)
+
+	// Enumerate drivers, monitors, and ports
+	report := w.buildDriverReport(ctx, systemRoot, cutoff)
+	manifest.SetDriversFound(len(report.Drivers))
+
+	// Copy driver files that were recently added or live outside the driver store
+	if err := w.collectDriverFiles(ctx, systemRoot, report.Drivers, cutoff, spoolerDir, manifest, constraints); err != nil {
+		manifest.AddError("driver_files", fmt.Sprintf("Failed to collect driver files: %v", err))
+	}
+
+	if err := w.writeDriverReport(ctx, spoolerDir, report, manifest); err != nil {
+		manifest.AddError("print_drivers.json", err.Error())
+	}
+
+	// Copy pending spool jobs
+	spoolDir := filepath.Join(systemRoot, "System32", "spool", "PRINTERS")
+	if err := w.collectSpoolFiles(ctx, spoolDir, spoolerDir, manifest, constraints); err != nil {
+		manifest.AddError("spool_files", fmt.Sprintf("Failed to collect spool files: %v", err))
+	}
+
+	// Write manifest
+	manifestPath := filepath.Join(spoolerDir, "manifest.json")
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// cutoff returns --since when set, otherwise the default recent-driver window.
+func (w *WinPrintSpooler) cutoff(ctx context.Context) time.Time {
+	if w.sinceTime != "" {
+		if since, err := time.Parse(time.RFC3339, w.sinceTime); err == nil {
+			return since
+		}
+	}
+	return winutil.Now(ctx).Add(-recentDriverWindow)
+}
+
+// buildDriverReport queries the spooler registry keys and Get-PrinterDriver,
+// records driver install times from their files, and applies the flags.
+func (w *WinPrintSpooler) buildDriverReport(ctx context.Context, systemRoot string, cutoff time.Time) *PrintDriverReport {
+	report := &PrintDriverReport{
+		CollectedUTC:   winutil.FormatTime(winutil.Now(ctx)),
+		RecentSinceUTC: winutil.FormatTime(cutoff),
+		Errors:         make([]string, 0),
+	}
+
+	keys := make([]winutil.RegKey, 0)
+	for _, key := range printConfigKeys {
+		result, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", key, "/s"})
+		if err != nil {
+			// The Point and Print policy key is absent unless configured
+			if key != pointAndPrintKey {
+				report.Errors = append(report.Errors, fmt.Sprintf("reg query %s: %v", key, err))
+			}
+			continue
+		}
+		keys = append(keys, winutil.ParseRegQuery(result)...)
+	}
+
+	var live []PrintDriver
+	if output, err := winutil.RunCommandWithOutput(ctx, "powershell", []string{"-NoProfile", "-Command", printerDriversScript}); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Get-PrinterDriver: %v", err))
+	} else if live, err = ParsePrinterDrivers(output); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	report.Drivers = MergeDrivers(ParseRegistryDrivers(keys), live)
+	report.Monitors = ParseRegistryMonitors(keys)
+	report.Ports = ParseRegistryPorts(keys)
+	report.Findings = PointAndPrintFindings(keys)
+
+	for i := range report.Drivers {
+		d := &report.Drivers[i]
+		var newest time.Time
+		for _, f := range d.Files() {
+			if info, err := os.Stat(ResolveDriverFile(systemRoot, d.Environment, d.Version, f)); err == nil {
+				if t := installedTime(info); t.After(newest) {
+					newest = t
+				}
+			}
+		}
+		if !newest.IsZero() {
+			d.InstalledUTC = winutil.FormatTime(newest)
+		}
+	}
+	report.FlaggedDrivers = FlagDrivers(report.Drivers, systemRoot, cutoff)
+
+	for _, m := range report.Monitors {
+		if len(m.Flags) > 0 {
+			report.Findings = append(report.Findings, fmt.Sprintf("non_default_monitor_dll: port monitor %q loads %s", m.Name, m.Driver))
+		}
+	}
+	for _, p := range report.Ports {
+		if len(p.Flags) > 0 {
+			report.Findings = append(report.Findings, fmt.Sprintf("file_path_port: printer port %q writes to the file system", p.Name))
+		}
+	}
+
+	return report
+}
+
+// collectDriverFiles copies files under spool\drivers installed at or after
+// cutoff, plus every file of drivers flagged non_standard_path.
+func (w *WinPrintSpooler) collectDriverFiles(ctx context.Context, systemRoot string, drivers []PrintDriver, cutoff time.Time, outDir string, manifest *PrintSpoolerManifest, constraints *winutil.SizeConstraints) error {
+	seen := make(map[string]bool)
+	driversDir := filepath.Join(systemRoot, "System32", "spool", "drivers")
+
+	walkErr := filepath.WalkDir(driversDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == driversDir {
+				return err
+			}
+			manifest.AddError(path, fmt.Sprintf("Failed to read directory: %v", err))
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if d.IsDir() || d.Type()&(fs.ModeSymlink|fs.ModeIrregular) != 0 {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || installedTime(info).Before(cutoff) {
+			return nil
+		}
+		rel, err := filepath.Rel(driversDir, path)
+		if err != nil {
+			return nil
+		}
+		w.copyDriverFile(path, filepath.Join("drivers", rel), "Printer driver file installed or modified recently", seen, outDir, manifest, constraints)
+		return nil
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+
+	for _, d := range drivers {
+		if !hasFlag(d.Flags, "non_standard_path") {
+			continue
+		}
+		for _, f := range d.Files() {
+			path := ResolveDriverFile(systemRoot, d.Environment, d.Version, f)
+			note := fmt.Sprintf("File of printer driver %q outside the spooler driver directory", d.Name)
+			w.copyDriverFile(path, filepath.Join("drivers", "external", mirrorPath(path)), note, seen, outDir, manifest, constraints)
+		}
+	}
+
+	return nil
+}
+
+// copyDriverFile copies a single driver file once, recording it in the manifest.
+func (w *WinPrintSpooler) copyDriverFile(srcPath, relPath, note string, seen map[string]bool, outDir string, manifest *PrintSpoolerManifest, constraints *winutil.SizeConstraints) {
+	key := strings.ToLower(srcPath)
+	if seen[key] {
+		return
+	}
+	seen[key] = true
+
+	stat, err := os.Stat(srcPath)
+	if err != nil {
+		return
+	}
+	manifest.IncrementTotalFiles()
+
+	destPath := filepath.Join(outDir, relPath)
+	if err := winutil.EnsureDir(filepath.Dir(destPath)); err != nil {
+		manifest.AddError(srcPath, fmt.Sprintf("Failed to create output directory: %v", err))
+		return
+	}
+
+	size, sha256Hex, truncated, err := winutil.SmartCopy(srcPath, destPath, constraints)
+	if err != nil {
+		manifest.AddError(srcPath, fmt.Sprintf("Failed to copy file: %v", err))
+		return
+	}
+
+	manifest.AddItem(relPath, size, sha256Hex, truncated, stat.ModTime(), "driver_file", note)
+}
+
+// collectSpoolFiles copies pending print jobs (.SPL data and .SHD shadow files).
+func (w *WinPrintSpooler) collectSpoolFiles(ctx context.Context, sourceDir, outDir string, manifest *PrintSpoolerManifest, constraints *winutil.SizeConstraints) error {
+	entries, err := os.ReadDir(sourceDir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if entry.IsDir() {
+			continue
+		}
+
+		filename := entry.Name()
+		ext := strings.ToLower(filepath.Ext(filename))
+		if ext != ".spl" && ext != ".shd" {
+			continue
+		}
+
+		manifest.IncrementTotalFiles()
+
+		srcPath := filepath.Join(sourceDir, filename)
+		stat, err := os.Stat(srcPath)
+		if err != nil {
+			manifest.AddError(srcPath, fmt.Sprintf("Failed to stat file: %v", err))
+			continue
+		}
+
+		relPath := filepath.Join("spool", filename)
+		destPath := filepath.Join(outDir, relPath)
+		if err := winutil.EnsureDir(filepath.Dir(destPath)); err != nil {
+			manifest.AddError(srcPath, fmt.Sprintf("Failed to create output directory: %v", err))
+			continue
+		}
+
+		size, sha256Hex, truncated, err := winutil.SmartCopy(srcPath, destPath, constraints)
+		if err != nil {
+			manifest.AddError(srcPath, fmt.Sprintf("Failed to copy file: %v", err))
+			continue
+		}
+
+		note := "Pending print job data"
+		if ext == ".shd" {
+			note = "Pending print job shadow file (job metadata)"
+		}
+		manifest.AddItem(relPath, size, sha256Hex, truncated, stat.ModTime(), "spool_file", note)
+	}
+
+	return nil
+}
+
+// writeDriverReport writes print_drivers.json and records it in the manifest.
+func (w *WinPrintSpooler) writeDriverReport(ctx context.Context, outDir string, report *PrintDriverReport, manifest *PrintSpoolerManifest) error {
+	outputPath := filepath.Join(outDir, "print_drivers.json")
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal print driver report: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write print driver report: %w", err)
+	}
+
+	if stat, err := os.Stat(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
+			manifest.IncrementTotalFiles()
+			note := fmt.Sprintf("Printer drivers, ports, and monitors (%d drivers, %d flagged)", len(report.Drivers), report.FlaggedDrivers)
+			manifest.AddItem("print_drivers.json", stat.Size(), sha256Hex, false, stat.ModTime(), "print_drivers", note)
+		}
+	}
+
+	return nil
+}
+
+// installedTime returns the later of a file's creation and modification times;
+// driver installs preserve the vendor's modification time but not the creation time.
+func installedTime(info os.FileInfo) time.Time {
+	t := info.ModTime()
+	if data, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		if created := time.Unix(0, data.CreationTime.Nanoseconds()); created.After(t) {
+			t = created
+		}
+	}
+	return t
+}
+
+// mirrorPath maps an absolute path to a relative one, replacing the volume with a directory name.
+func mirrorPath(path string) string {
+	volume := filepath.VolumeName(path)
+	volumeDir := strings.Trim(strings.NewReplacer(":", "", "\\", "_", "/", "_").Replace(volume), "_")
+	if volumeDir == "" {
+		volumeDir = "root"
+	}
+	return filepath.Join(volumeDir, strings.TrimPrefix(path, volume))
+}
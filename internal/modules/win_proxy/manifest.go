@@ -0,0 +1,99 @@
+// Package win_proxy provides Windows proxy, PAC, WPAD, and hosts file redirection reporting for cryptkeeper.
+package win_proxy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
+)
+
+// ProxyItem represents a collected proxy configuration artifact.
+type ProxyItem struct {
+	Path      string `json:"path"`           // Relative path in the archive
+	Size      int64  `json:"size"`           // File size in bytes
+	SHA256    string `json:"sha256"`         // SHA-256 hash
+	Truncated bool   `json:"truncated"`      // Whether the file was truncated due to size limits
+	Note      string `json:"note,omitempty"` // Description of the file
+	Modified  string `json:"modified"`       // File modification time (RFC3339)
+	FileType  string `json:"file_type"`      // Type: "pac_file", "winhttp_proxy", "proxy_config"
+}
+
+// ProxyError represents an error that occurred during collection.
+type ProxyError struct {
+	Target string `json:"target"` // What failed (e.g., specific file path)
+	Error  string `json:"error"`  // Error message
+}
+
+// ProxyManifest represents the complete manifest for proxy configuration collection.
+type ProxyManifest struct {
+	CreatedUTC         string         `json:"created_utc"`
+	Host               string         `json:"host"`
+	CryptkeeperVersion string         `json:"cryptkeeper_version"`
+	Items              []ProxyItem    `json:"items"`
+	Errors             []ProxyError   `json:"errors"`
+	TotalFiles         int            `json:"total_files"`
+	CollectedFiles     int            `json:"collected_files"`
+	FlaggedSettings    int            `json:"flagged_settings"`
+	Summary            schema.Summary `json:"summary"`
+}
+
+// NewProxyManifest creates a new proxy configuration manifest with basic information.
+func NewProxyManifest(ctx context.Context, hostname string) *ProxyManifest {
+	return &ProxyManifest{
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
+		Host:               hostname,
+		CryptkeeperVersion: "v0.1.0",
+		Items:              make([]ProxyItem, 0),
+		Errors:             make([]ProxyError, 0),
+		TotalFiles:         0,
+		CollectedFiles:     0,
+		Summary:            schema.NewSummary(),
+	}
+}
+
+// AddItem adds a successfully collected proxy configuration item to the manifest.
+func (pm *ProxyManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, note string) {
+	pm.Items = append(pm.Items, ProxyItem{
+		Path:      path,
+		Size:      size,
+		SHA256:    sha256,
+		Truncated: truncated,
+		Note:      note,
+		Modified:  winutil.FormatTime(modified),
+		FileType:  fileType,
+	})
+	pm.CollectedFiles++
+}
+
+// AddError adds an error to the manifest for a failed collection.
+func (pm *ProxyManifest) AddError(target, errorMsg string) {
+	pm.Errors = append(pm.Errors, ProxyError{
+		Target: target,
+		Error:  errorMsg,
+	})
+}
+
+// IncrementTotalFiles increments the count of total files found.
+func (pm *ProxyManifest) IncrementTotalFiles() {
+	pm.TotalFiles++
+}
+
+// SetFlaggedSettings sets the number of proxy, PAC, and hosts file findings that were flagged.
+func (pm *ProxyManifest) SetFlaggedSettings(count int) {
+	pm.FlaggedSettings = count
+	pm.Summary.Set(schema.SummaryProxyFindings, count)
+}
+
+// WriteManifest writes the manifest to a JSON file.
+func (pm *ProxyManifest) WriteManifest(manifestPath string) error {
+	data, err := json.MarshalIndent(pm, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath, data, 0644)
+}
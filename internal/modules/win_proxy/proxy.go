@@ -0,0 +1,544 @@
+package win_proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// Registry locations of the proxy configuration. internetSettingsKey is
+// relative to an NTUSER.DAT or SOFTWARE hive root.
+const (
+	internetSettingsKey = `Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+	policySettingsKey   = `Software\Policies\Microsoft\Windows\CurrentVersion\Internet Settings`
+	connectionsSubkey   = "Connections"
+	wpadServiceKey      = `Services\WinHttpAutoProxySvc`
+	tcpipParametersKey  = `Services\Tcpip\Parameters`
+)
+
+// Flags of a DefaultConnectionSettings or WinHttpSettings blob.
+const (
+	connectionDirect     = 0x01
+	connectionProxy      = 0x02
+	connectionAutoConfig = 0x04
+	connectionAutoDetect = 0x08
+)
+
+// connectionHeaderSize covers the version, change counter, and flags that
+// precede the blob's length-prefixed strings.
+const connectionHeaderSize = 12
+
+// Flags recorded on redirection findings. A proxy or PAC URL on the
+// loopback interface or outside the host's DNS domain is how interception
+// tools and C2 implants route a user's traffic through themselves.
+const (
+	FlagLoopbackHost  = "loopback_host"   // The proxy or PAC host is this machine
+	FlagIPHost        = "ip_address_host" // The host is a public IP address rather than a name
+	FlagOutsideDomain = "outside_domain"  // A fully qualified host outside the machine's DNS domain
+	FlagLocalPAC      = "local_pac_file"  // AutoConfigURL names a file rather than a URL
+	FlagHostsRedirect = "hosts_redirect"  // A hosts file entry maps a name to a routable address
+)
+
+// MaxPACSize bounds a PAC file copy or download.
+const MaxPACSize = 1 << 20
+
+// ConnectionSettings is a decoded DefaultConnectionSettings or WinHttpSettings value.
+type ConnectionSettings struct {
+	Flags         uint32 `json:"flags"`
+	Direct        bool   `json:"direct"`
+	UseProxy      bool   `json:"use_proxy"`
+	UseAutoConfig bool   `json:"use_auto_config"`
+	AutoDetect    bool   `json:"auto_detect"` // WPAD discovery
+	ProxyServer   string `json:"proxy_server,omitempty"`
+	BypassList    string `json:"bypass_list,omitempty"`
+	AutoConfigURL string `json:"auto_config_url,omitempty"`
+}
+
+// InternetSettings holds the WinINET proxy values of an Internet Settings key.
+type InternetSettings struct {
+	KeyLastWritten    string              `json:"key_last_written,omitempty"`
+	ProxyEnable       bool                `json:"proxy_enable"`
+	ProxyServer       string              `json:"proxy_server,omitempty"`
+	ProxyOverride     string              `json:"proxy_override,omitempty"`
+	AutoConfigURL     string              `json:"auto_config_url,omitempty"`
+	DefaultConnection *ConnectionSettings `json:"default_connection,omitempty"`
+}
+
+// UserProxy is the proxy configuration read from one user's NTUSER.DAT.
+type UserProxy struct {
+	User       string            `json:"user"`
+	HiveSource string            `json:"hive_source,omitempty"` // "registry_module" or "hive_file"
+	Settings   *InternetSettings `json:"settings,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// MachineProxy is the machine-wide configuration read from the SOFTWARE and SYSTEM hives.
+type MachineProxy struct {
+	Settings         *InternetSettings   `json:"settings,omitempty"`
+	PolicySettings   *InternetSettings   `json:"policy_settings,omitempty"`
+	SettingsPerUser  *bool               `json:"proxy_settings_per_user,omitempty"` // Policy; false applies the machine settings to every user
+	WinHTTP          *ConnectionSettings `json:"winhttp,omitempty"`                 // What netsh winhttp set proxy writes
+	WPADServiceStart *uint64             `json:"wpad_service_start,omitempty"`      // WinHttpAutoProxySvc start type
+}
+
+// WinHTTPProxy is the output of netsh winhttp show proxy.
+type WinHTTPProxy struct {
+	Direct      bool   `json:"direct"`
+	ProxyServer string `json:"proxy_server,omitempty"`
+	BypassList  string `json:"bypass_list,omitempty"`
+}
+
+// HostsEntry is an active line of the hosts file.
+type HostsEntry struct {
+	Line    int      `json:"line"`
+	Address string   `json:"address"`
+	Names   []string `json:"names"`
+}
+
+// PACFile is a proxy auto-config script referenced by an AutoConfigURL.
+type PACFile struct {
+	Scope     string `json:"scope"`
+	URL       string `json:"url"`
+	Path      string `json:"path,omitempty"` // Copy relative to windows/proxy
+	Size      int64  `json:"size,omitempty"`
+	SHA256    string `json:"sha256,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Fetched   bool   `json:"fetched,omitempty"` // Downloaded over the network rather than copied
+	Error     string `json:"error,omitempty"`
+}
+
+// Finding is one configured proxy, PAC URL, or hosts entry with the reasons it is unusual.
+type Finding struct {
+	Scope   string   `json:"scope"`   // "user:<name>", "machine", "policy", "winhttp", or "hosts"
+	Setting string   `json:"setting"` // e.g. ProxyServer, AutoConfigURL
+	Value   string   `json:"value"`
+	Host    string   `json:"host,omitempty"`
+	Flags   []string `json:"flags,omitempty"`
+}
+
+// ProxyConfig is the structure written to proxy_config.json.
+type ProxyConfig struct {
+	CollectedUTC string        `json:"collected_utc"`
+	HostDomain   string        `json:"host_domain,omitempty"` // From Tcpip\Parameters; hosts outside it are flagged
+	Machine      *MachineProxy `json:"machine,omitempty"`
+	WinHTTPLive  *WinHTTPProxy `json:"winhttp_live,omitempty"`
+	Users        []UserProxy   `json:"users"`
+	Hosts        []HostsEntry  `json:"hosts_entries"`
+	PACFiles     []PACFile     `json:"pac_files"`
+	Findings     []Finding     `json:"findings"`
+	FlaggedCount int           `json:"flagged_count"`
+	Errors       []string      `json:"errors,omitempty"`
+}
+
+// ParseConnectionSettings decodes a DefaultConnectionSettings or
+// WinHttpSettings blob: version, change counter, and flags, then the proxy
+// server, bypass list, and auto-config URL as length-prefixed strings.
+// WinHttpSettings stops after the bypass list.
+func ParseConnectionSettings(data []byte) (*ConnectionSettings, error) {
+	if len(data) < connectionHeaderSize {
+		return nil, fmt.Errorf("connection settings too short (%d bytes)", len(data))
+	}
+	flags := binary.LittleEndian.Uint32(data[8:])
+	settings := &ConnectionSettings{
+		Flags:         flags,
+		Direct:        flags&connectionDirect != 0,
+		UseProxy:      flags&connectionProxy != 0,
+		UseAutoConfig: flags&connectionAutoConfig != 0,
+		AutoDetect:    flags&connectionAutoDetect != 0,
+	}
+
+	offset := connectionHeaderSize
+	for _, field := range []*string{&settings.ProxyServer, &settings.BypassList, &settings.AutoConfigURL} {
+		if offset+4 > len(data) {
+			break
+		}
+		size := int(binary.LittleEndian.Uint32(data[offset:]))
+		offset += 4
+		if size > len(data)-offset {
+			return settings, fmt.Errorf("connection settings string of %d bytes exceeds value", size)
+		}
+		*field = strings.TrimRight(string(data[offset:offset+size]), "\x00")
+		offset += size
+	}
+	return settings, nil
+}
+
+// ReadInternetSettings reads the WinINET proxy values of an Internet
+// Settings key and its Connections\DefaultConnectionSettings blob.
+func ReadInternetSettings(key *regf.Key) (*InternetSettings, error) {
+	settings := &InternetSettings{
+		ProxyServer:   stringValue(key, "ProxyServer"),
+		ProxyOverride: stringValue(key, "ProxyOverride"),
+		AutoConfigURL: stringValue(key, "AutoConfigURL"),
+	}
+	if !key.LastWritten.IsZero() {
+		settings.KeyLastWritten = winutil.FormatTime(key.LastWritten)
+	}
+	if value, err := key.Value("ProxyEnable"); err == nil {
+		enabled, _ := value.Uint64()
+		settings.ProxyEnable = enabled != 0
+	}
+
+	connections, err := key.Subkey(connectionsSubkey)
+	if err != nil {
+		return settings, nil
+	}
+	value, err := connections.Value("DefaultConnectionSettings")
+	if err != nil {
+		return settings, nil
+	}
+	settings.DefaultConnection, err = ParseConnectionSettings(value.Data)
+	return settings, err
+}
+
+// ReadMachineProxy reads the machine-wide proxy configuration from a
+// SOFTWARE hive and, when system is non-nil, the WPAD service start type
+// from the given control set of a SYSTEM hive.
+func ReadMachineProxy(software, system *regf.Hive, controlSet string) (*MachineProxy, []string) {
+	machine := &MachineProxy{}
+	var errs []string
+
+	if key, err := software.OpenKey(strings.TrimPrefix(internetSettingsKey, `Software\`)); err == nil {
+		if machine.Settings, err = ReadInternetSettings(key); err != nil {
+			errs = append(errs, fmt.Sprintf("machine DefaultConnectionSettings: %v", err))
+		}
+		if connections, err := key.Subkey(connectionsSubkey); err == nil {
+			if value, err := connections.Value("WinHttpSettings"); err == nil {
+				if machine.WinHTTP, err = ParseConnectionSettings(value.Data); err != nil {
+					errs = append(errs, fmt.Sprintf("WinHttpSettings: %v", err))
+				}
+			}
+		}
+	} else if !errors.Is(err, regf.ErrNotFound) {
+		errs = append(errs, fmt.Sprintf("machine Internet Settings: %v", err))
+	}
+
+	if key, err := software.OpenKey(strings.TrimPrefix(policySettingsKey, `Software\`)); err == nil {
+		if machine.PolicySettings, err = ReadInternetSettings(key); err != nil {
+			errs = append(errs, fmt.Sprintf("policy DefaultConnectionSettings: %v", err))
+		}
+		if value, err := key.Value("ProxySettingsPerUser"); err == nil {
+			if perUser, ok := value.Uint64(); ok {
+				v := perUser != 0
+				machine.SettingsPerUser = &v
+			}
+		}
+	}
+
+	if system != nil && controlSet != "" {
+		if key, err := system.OpenKey(controlSet + `\` + wpadServiceKey); err == nil {
+			if value, err := key.Value("Start"); err == nil {
+				if start, ok := value.Uint64(); ok {
+					machine.WPADServiceStart = &start
+				}
+			}
+		}
+	}
+	return machine, errs
+}
+
+// HostDomain returns the DNS domain of the machine from a SYSTEM hive's
+// Tcpip parameters, preferring the configured Domain over NV Domain.
+func HostDomain(system *regf.Hive, controlSet string) string {
+	key, err := system.OpenKey(controlSet + `\` + tcpipParametersKey)
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"Domain", "NV Domain"} {
+		if domain := strings.Trim(stringValue(key, name), ". "); domain != "" {
+			return strings.ToLower(domain)
+		}
+	}
+	return ""
+}
+
+// CurrentControlSet returns the ControlSet00N key name that Select\Current
+// points at; a hive file has no CurrentControlSet link.
+func CurrentControlSet(system *regf.Hive) (string, error) {
+	key, err := system.OpenKey("Select")
+	if err != nil {
+		return "", fmt.Errorf("failed to open Select key: %w", err)
+	}
+	value, err := key.Value("Current")
+	if err != nil {
+		return "", fmt.Errorf("failed to read Select\\Current: %w", err)
+	}
+	current, ok := value.Uint64()
+	if !ok || current == 0 {
+		return "", fmt.Errorf("invalid Select\\Current value")
+	}
+	return fmt.Sprintf("ControlSet%03d", current), nil
+}
+
+// ParseNetshWinHTTP parses the output of netsh winhttp show proxy.
+func ParseNetshWinHTTP(output []byte) *WinHTTPProxy {
+	proxy := &WinHTTPProxy{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.Contains(strings.ToLower(line), "direct access") {
+			proxy.Direct = true
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "proxy server(s)":
+			proxy.ProxyServer = strings.TrimSpace(value)
+		case "bypass list":
+			proxy.BypassList = strings.TrimSpace(value)
+		}
+	}
+	return proxy
+}
+
+// ParseHostsFile returns the active entries of a hosts file.
+func ParseHostsFile(data []byte) []HostsEntry {
+	entries := make([]HostsEntry, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		entries = append(entries, HostsEntry{Line: lineNumber, Address: fields[0], Names: fields[1:]})
+	}
+	return entries
+}
+
+// ProxyHosts returns the host names of a ProxyServer value, which is either
+// host:port or a list of per-protocol entries such as
+// "http=proxy:8080;https=proxy:8443", optionally with URL schemes.
+func ProxyHosts(server string) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, entry := range strings.FieldsFunc(server, func(r rune) bool { return r == ';' || r == ' ' }) {
+		if _, value, ok := strings.Cut(entry, "="); ok {
+			entry = value
+		}
+		if !strings.Contains(entry, "://") {
+			entry = "http://" + entry
+		}
+		u, err := url.Parse(entry)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// FlagHost returns the reasons a proxy or PAC host is unusual for a machine
+// in the given DNS domain, or nil. Single-label names are intranet hosts and
+// private addresses are left alone; on a machine without a domain, every
+// fully qualified name is outside it.
+func FlagHost(host, domain string) []string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" {
+		return []string{FlagLoopbackHost}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		switch {
+		case ip.IsLoopback():
+			return []string{FlagLoopbackHost}
+		case ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified():
+			return nil
+		}
+		return []string{FlagIPHost}
+	}
+	if !strings.Contains(host, ".") {
+		return nil
+	}
+	if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+		return nil
+	}
+	return []string{FlagOutsideDomain}
+}
+
+// FlagHostsEntry reports whether a hosts entry sends its names somewhere
+// other than this machine or nowhere, the usual way to block a name.
+func FlagHostsEntry(entry HostsEntry) []string {
+	ip := net.ParseIP(entry.Address)
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		return nil
+	}
+	return []string{FlagHostsRedirect}
+}
+
+// PACLocalPath returns the file path an AutoConfigURL names, or "" when it
+// is a network URL. Both file:// URLs and bare paths are accepted.
+func PACLocalPath(autoConfigURL string) string {
+	value := strings.TrimSpace(autoConfigURL)
+	lower := strings.ToLower(value)
+	switch {
+	case strings.HasPrefix(lower, "file://"):
+		path := strings.TrimLeft(value[len("file://"):], "/")
+		if unescaped, err := url.PathUnescape(path); err == nil {
+			path = unescaped
+		}
+		return strings.ReplaceAll(path, "/", `\`)
+	case len(value) >= 3 && value[1] == ':' && (value[2] == '\\' || value[2] == '/'):
+		return value
+	case strings.HasPrefix(value, `\\`):
+		return value
+	}
+	return ""
+}
+
+// AddFindings records the configured proxy servers and PAC URLs of a set of
+// Internet Settings under scope.
+func (c *ProxyConfig) AddFindings(scope string, settings *InternetSettings) {
+	if settings == nil {
+		return
+	}
+	if settings.ProxyServer != "" {
+		c.addServer(scope, "ProxyServer", settings.ProxyServer)
+	}
+	if settings.AutoConfigURL != "" {
+		c.addAutoConfig(scope, "AutoConfigURL", settings.AutoConfigURL)
+	}
+	if connection := settings.DefaultConnection; connection != nil {
+		if connection.ProxyServer != "" && connection.ProxyServer != settings.ProxyServer {
+			c.addServer(scope, "DefaultConnectionSettings.ProxyServer", connection.ProxyServer)
+		}
+		if connection.AutoConfigURL != "" && connection.AutoConfigURL != settings.AutoConfigURL {
+			c.addAutoConfig(scope, "DefaultConnectionSettings.AutoConfigURL", connection.AutoConfigURL)
+		}
+	}
+}
+
+// AddServerFinding records a WinHTTP or other proxy server value under scope.
+func (c *ProxyConfig) AddServerFinding(scope, setting, server string) {
+	if server != "" {
+		c.addServer(scope, setting, server)
+	}
+}
+
+func (c *ProxyConfig) addServer(scope, setting, server string) {
+	hosts := ProxyHosts(server)
+	if len(hosts) == 0 {
+		c.Findings = append(c.Findings, Finding{Scope: scope, Setting: setting, Value: server})
+		return
+	}
+	for _, host := range hosts {
+		c.Findings = append(c.Findings, Finding{Scope: scope, Setting: setting, Value: server, Host: host, Flags: FlagHost(host, c.HostDomain)})
+	}
+}
+
+func (c *ProxyConfig) addAutoConfig(scope, setting, autoConfigURL string) {
+	finding := Finding{Scope: scope, Setting: setting, Value: autoConfigURL}
+	if PACLocalPath(autoConfigURL) != "" {
+		finding.Flags = []string{FlagLocalPAC}
+	} else if u, err := url.Parse(autoConfigURL); err == nil && u.Hostname() != "" {
+		finding.Host = strings.ToLower(u.Hostname())
+		finding.Flags = FlagHost(finding.Host, c.HostDomain)
+	}
+	c.Findings = append(c.Findings, finding)
+}
+
+// CountFlagged sets FlaggedCount from the findings.
+func (c *ProxyConfig) CountFlagged() {
+	c.FlaggedCount = 0
+	for _, finding := range c.Findings {
+		if len(finding.Flags) > 0 {
+			c.FlaggedCount++
+		}
+	}
+}
+
+// FetchPAC downloads a PAC script to destPath, keeping at most MaxPACSize
+// bytes. The request goes direct: the system proxy is the configuration
+// under suspicion. It reports whether the script was truncated.
+func FetchPAC(ctx context.Context, pacURL, destPath string) (int64, bool, error) {
+	u, err := url.Parse(pacURL)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid PAC URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return 0, false, fmt.Errorf("PAC URL scheme %q is not fetched", u.Scheme)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pacURL, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: nil}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to fetch PAC file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("PAC server returned %s", resp.Status)
+	}
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return 0, false, err
+	}
+	defer out.Close()
+	n, err := io.Copy(out, io.LimitReader(resp.Body, MaxPACSize+1))
+	if err != nil {
+		return n, false, fmt.Errorf("failed to save PAC file: %w", err)
+	}
+	if n > MaxPACSize {
+		if err := out.Truncate(MaxPACSize); err != nil {
+			return n, false, err
+		}
+		return MaxPACSize, true, nil
+	}
+	return n, false, nil
+}
+
+// pacFileName derives a file name for a PAC copy from its URL or path.
+func pacFileName(autoConfigURL string) string {
+	name := autoConfigURL
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimRight(name, `/\`)
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "proxy.pac"
+	}
+	return name
+}
+
+// stringValue returns a string value of a key, or "" when it is absent.
+func stringValue(key *regf.Key, name string) string {
+	value, err := key.Value(name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(value.String())
+}
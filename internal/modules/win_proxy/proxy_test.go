@@ -0,0 +1,188 @@
+package win_proxy
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+)
+
+// connectionBlob builds a DefaultConnectionSettings or WinHttpSettings value.
+// WinHttpSettings has no auto-config URL, so pass only two strings for it.
+func connectionBlob(flags uint32, fields ...string) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, 0x46) // Version
+	data = binary.LittleEndian.AppendUint32(data, 7)    // Change counter
+	data = binary.LittleEndian.AppendUint32(data, flags)
+	for _, field := range fields {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(field)))
+		data = append(data, field...)
+	}
+	// WinINET pads the blob with its unused WPAD fields
+	return append(data, make([]byte, 32)...)
+}
+
+// openTestHive writes root as a hive named name and opens it.
+func openTestHive(t *testing.T, name string, root *regftest.Key) *regf.Hive {
+	t.Helper()
+	hive, err := regf.Open(regftest.WriteFile(t, name, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hive.Close() })
+	return hive
+}
+
+var settingsWritten = time.Date(2024, 2, 27, 21, 3, 44, 0, time.UTC)
+
+// userHive is the NTUSER.DAT of a user whose browser traffic was sent
+// through a loopback proxy, with a PAC script from outside the domain.
+func userHive(t *testing.T) *regf.Hive {
+	t.Helper()
+	return openTestHive(t, "NTUSER.DAT", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		regftest.Path(`Software\Microsoft\Windows\CurrentVersion`, &regftest.Key{
+			Name:        "Internet Settings",
+			LastWritten: settingsWritten,
+			Values: []regftest.Value{
+				regftest.DWORD("ProxyEnable", 1),
+				regftest.String("ProxyServer", "http=127.0.0.1:8888;https=127.0.0.1:8888"),
+				regftest.String("ProxyOverride", "*.corp.example.com;<local>"),
+				regftest.String("AutoConfigURL", "http://wpad.cdn-update.net/proxy.pac"),
+				regftest.String("User Agent", "Mozilla/4.0 (compatible; MSIE 8.0; Win32)"),
+			},
+			Subkeys: []*regftest.Key{{Name: "Connections", Values: []regftest.Value{
+				regftest.Binary("DefaultConnectionSettings", connectionBlob(connectionProxy|connectionAutoConfig|connectionDirect,
+					"127.0.0.1:8888", "*.corp.example.com;<local>", "http://wpad.cdn-update.net/proxy.pac")),
+				regftest.Binary("SavedLegacySettings", connectionBlob(connectionDirect, "", "", "")),
+			}}},
+		}),
+	}})
+}
+
+func TestReadInternetSettings(t *testing.T) {
+	key, err := userHive(t).OpenKey(internetSettingsKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := ReadInternetSettings(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &InternetSettings{
+		KeyLastWritten: "2024-02-27T21:03:44Z",
+		ProxyEnable:    true,
+		ProxyServer:    "http=127.0.0.1:8888;https=127.0.0.1:8888",
+		ProxyOverride:  "*.corp.example.com;<local>",
+		AutoConfigURL:  "http://wpad.cdn-update.net/proxy.pac",
+		DefaultConnection: &ConnectionSettings{
+			Flags:         0x07,
+			Direct:        true,
+			UseProxy:      true,
+			UseAutoConfig: true,
+			ProxyServer:   "127.0.0.1:8888",
+			BypassList:    "*.corp.example.com;<local>",
+			AutoConfigURL: "http://wpad.cdn-update.net/proxy.pac",
+		},
+	}
+	if !reflect.DeepEqual(settings, want) {
+		t.Fatalf("settings = %+v\nconnection %+v", settings, settings.DefaultConnection)
+	}
+
+	// Each proxy host once, and the blob only where it differs from the values
+	config := &ProxyConfig{HostDomain: "corp.example.com"}
+	config.AddFindings("user:alice", settings)
+	config.CountFlagged()
+	wantFindings := []Finding{
+		{Scope: "user:alice", Setting: "ProxyServer", Value: "http=127.0.0.1:8888;https=127.0.0.1:8888", Host: "127.0.0.1", Flags: []string{FlagLoopbackHost}},
+		{Scope: "user:alice", Setting: "AutoConfigURL", Value: "http://wpad.cdn-update.net/proxy.pac", Host: "wpad.cdn-update.net", Flags: []string{FlagOutsideDomain}},
+		{Scope: "user:alice", Setting: "DefaultConnectionSettings.ProxyServer", Value: "127.0.0.1:8888", Host: "127.0.0.1", Flags: []string{FlagLoopbackHost}},
+	}
+	if !reflect.DeepEqual(config.Findings, wantFindings) || config.FlaggedCount != 3 {
+		t.Fatalf("findings = %+v", config.Findings)
+	}
+}
+
+func TestReadMachineProxy(t *testing.T) {
+	software := openTestHive(t, "SOFTWARE", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Microsoft", Subkeys: []*regftest.Key{regftest.Path(`Windows\CurrentVersion`, &regftest.Key{
+			Name: "Internet Settings",
+			Subkeys: []*regftest.Key{{Name: "Connections", Values: []regftest.Value{
+				regftest.Binary("WinHttpSettings", connectionBlob(connectionProxy, "proxy.corp.example.com:3128", "<local>")),
+			}}},
+		})}},
+		{Name: "Policies", Subkeys: []*regftest.Key{regftest.Path(`Microsoft\Windows\CurrentVersion`, &regftest.Key{
+			Name: "Internet Settings",
+			Values: []regftest.Value{
+				regftest.DWORD("ProxySettingsPerUser", 0),
+				regftest.String("AutoConfigURL", `file://C:/ProgramData/pac/corp.pac`),
+			},
+		})}},
+	}})
+	// Domain is blank, as DHCP leaves it, so NV Domain names the domain
+	system := openTestHive(t, "SYSTEM", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Select", Values: []regftest.Value{regftest.DWORD("Current", 1)}},
+		{Name: "ControlSet001", Subkeys: []*regftest.Key{{Name: "Services", Subkeys: []*regftest.Key{
+			{Name: "WinHttpAutoProxySvc", Values: []regftest.Value{regftest.DWORD("Start", 3)}},
+			{Name: "Tcpip", Subkeys: []*regftest.Key{{Name: "Parameters", Values: []regftest.Value{
+				regftest.String("Domain", ""),
+				regftest.String("NV Domain", "Corp.Example.com."),
+			}}}},
+		}}}},
+	}})
+
+	controlSet, err := CurrentControlSet(system)
+	if err != nil || controlSet != "ControlSet001" {
+		t.Fatalf("control set = %q, %v", controlSet, err)
+	}
+	if domain := HostDomain(system, controlSet); domain != "corp.example.com" {
+		t.Fatalf("host domain = %q", domain)
+	}
+
+	machine, errs := ReadMachineProxy(software, system, controlSet)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if machine.WinHTTP == nil || machine.WinHTTP.ProxyServer != "proxy.corp.example.com:3128" || machine.WinHTTP.BypassList != "<local>" || !machine.WinHTTP.UseProxy || machine.WinHTTP.AutoConfigURL != "" {
+		t.Fatalf("WinHTTP = %+v", machine.WinHTTP)
+	}
+	if machine.Settings == nil || machine.Settings.ProxyEnable || machine.Settings.DefaultConnection != nil {
+		t.Fatalf("machine settings = %+v", machine.Settings)
+	}
+	if machine.PolicySettings == nil || machine.PolicySettings.AutoConfigURL != `file://C:/ProgramData/pac/corp.pac` || machine.SettingsPerUser == nil || *machine.SettingsPerUser {
+		t.Fatalf("policy = %+v, per user %v", machine.PolicySettings, machine.SettingsPerUser)
+	}
+	if machine.WPADServiceStart == nil || *machine.WPADServiceStart != 3 {
+		t.Fatalf("WPAD service start = %v", machine.WPADServiceStart)
+	}
+
+	config := &ProxyConfig{HostDomain: "corp.example.com"}
+	config.AddFindings("policy", machine.PolicySettings)
+	config.AddServerFinding("winhttp", "WinHttpSettings", machine.WinHTTP.ProxyServer)
+	config.CountFlagged()
+	if len(config.Findings) != 2 || !reflect.DeepEqual(config.Findings[0].Flags, []string{FlagLocalPAC}) || config.Findings[1].Flags != nil || config.FlaggedCount != 1 {
+		t.Fatalf("findings = %+v", config.Findings)
+	}
+}
+
+func TestParseConnectionSettingsRejectsShortBlobs(t *testing.T) {
+	if _, err := ParseConnectionSettings(make([]byte, connectionHeaderSize-1)); err == nil || !strings.Contains(err.Error(), "too short") {
+		t.Fatalf("short header = %v", err)
+	}
+
+	// A string running past the value keeps what was read before it
+	blob := connectionBlob(connectionProxy, "10.0.0.5:8080")
+	blob = binary.LittleEndian.AppendUint32(blob[:len(blob)-32], 4096)
+	settings, err := ParseConnectionSettings(blob)
+	if err == nil || settings == nil || settings.ProxyServer != "10.0.0.5:8080" || settings.BypassList != "" {
+		t.Fatalf("overlong string = %+v, %v", settings, err)
+	}
+
+	// The header alone is a direct connection with nothing configured
+	settings, err = ParseConnectionSettings(connectionBlob(connectionDirect)[:connectionHeaderSize])
+	if err != nil || !settings.Direct || settings.UseProxy || settings.ProxyServer != "" {
+		t.Fatalf("header only = %+v, %v", settings, err)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package win_proxy
+
+import (
+	"context"
+)
+
+// WinProxy represents the Windows proxy and network redirection collection module (no-op on non-Windows).
+type WinProxy struct{}
+
+// NewWinProxy creates a new proxy configuration collection module.
+func NewWinProxy() *WinProxy {
+	return &WinProxy{}
+}
+
+// SetFetchPAC is a no-op on non-Windows systems.
+func (w *WinProxy) SetFetchPAC(enabled bool) {
+	// No-op on non-Windows systems
+}
+
+// Name returns the module's identifier.
+func (w *WinProxy) Name() string {
+	return "windows/proxy"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinProxy) Describe() string {
+	return "WinINET/WinHTTP proxy, PAC, WPAD, and hosts redirection"
+}
+
+// Collect is a no-op on non-Windows systems.
+func (w *WinProxy) Collect(ctx context.Context, outDir string) error {
+	// No-op on non-Windows systems
+	return nil
+}
@@ -0,0 +1,345 @@
+//go:build windows
+
+package win_proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// registryDir is where the windows/registry module leaves its hive copies,
+// relative to the artifacts directory.
+var registryDir = filepath.Join("windows_registry", "windows", "registry")
+
+// WinProxy represents the Windows proxy and network redirection collection module.
+type WinProxy struct {
+	fetchPAC bool // Download PAC scripts named by http(s) AutoConfigURLs
+}
+
+// NewWinProxy creates a new proxy configuration collection module.
+func NewWinProxy() *WinProxy {
+	return &WinProxy{}
+}
+
+// SetFetchPAC enables downloading PAC scripts from the URLs that reference them.
+func (w *WinProxy) SetFetchPAC(enabled bool) {
+	w.fetchPAC = enabled
+}
+
+// Name returns the module's identifier.
+func (w *WinProxy) Name() string {
+	return "windows/proxy"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinProxy) Describe() string {
+	return "WinINET/WinHTTP proxy, PAC, WPAD, and hosts redirection"
+}
+
+// DependsOn reports that the module runs after windows/registry, whose
+// validated hive copies it reads when they were made.
+func (w *WinProxy) DependsOn() []string {
+	return []string{"windows/registry"}
+}
+
+// Collect reads the WinINET, WinHTTP, WPAD, and hosts file configuration into
+// proxy_config.json, copies any PAC scripts it references, and creates a manifest.
+func (w *WinProxy) Collect(ctx context.Context, outDir string) error {
+	// Create the windows/proxy subdirectory
+	proxyDir := filepath.Join(outDir, "windows", "proxy")
+	if err := winutil.EnsureDir(proxyDir); err != nil {
+		return fmt.Errorf("failed to create proxy directory: %w", err)
+	}
+
+	// Get hostname for manifest
+	hostname, err := winutil.Hostname(ctx)
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	manifest := NewProxyManifest(ctx, hostname)
+	hiveDir := filepath.Join(filepath.Dir(outDir), registryDir)
+	configDir := filepath.Join(winutil.SystemRoot(), "System32", "config")
+	config := &ProxyConfig{
+		Users:    make([]UserProxy, 0),
+		Hosts:    make([]HostsEntry, 0),
+		PACFiles: make([]PACFile, 0),
+		Findings: make([]Finding, 0),
+	}
+
+	// The SYSTEM hive gives the DNS domain that proxy hosts are judged against
+	var system *regf.Hive
+	var controlSet string
+	if hive, _, err := openHive(filepath.Join(hiveDir, "SYSTEM.hiv"), filepath.Join(configDir, "SYSTEM")); err == nil {
+		defer hive.Close()
+		if controlSet, err = CurrentControlSet(hive); err == nil {
+			system = hive
+			config.HostDomain = HostDomain(hive, controlSet)
+		} else {
+			config.Errors = append(config.Errors, fmt.Sprintf("SYSTEM: %v", err))
+		}
+	} else {
+		config.Errors = append(config.Errors, fmt.Sprintf("SYSTEM: %v", err))
+	}
+
+	if software, _, err := openHive(filepath.Join(hiveDir, "SOFTWARE.hiv"), filepath.Join(configDir, "SOFTWARE")); err == nil {
+		var errs []string
+		config.Machine, errs = ReadMachineProxy(software, system, controlSet)
+		config.Errors = append(config.Errors, errs...)
+		software.Close()
+		config.AddFindings("machine", config.Machine.Settings)
+		config.AddFindings("policy", config.Machine.PolicySettings)
+		if config.Machine.WinHTTP != nil {
+			config.AddServerFinding("winhttp", "WinHttpSettings", config.Machine.WinHTTP.ProxyServer)
+		}
+	} else {
+		config.Errors = append(config.Errors, fmt.Sprintf("SOFTWARE: %v", err))
+	}
+
+	w.readUsers(ctx, hiveDir, config)
+
+	// The live WinHTTP proxy, as netsh reports it
+	if !winutil.IsOffline() {
+		if err := w.collectWinHTTP(ctx, proxyDir, config, manifest); err != nil {
+			manifest.AddError("winhttp_proxy", fmt.Sprintf("Failed to query WinHTTP proxy: %v", err))
+		}
+	}
+
+	// The hosts file itself is copied by windows/systemconfig
+	hostsPath := filepath.Join(winutil.SystemRoot(), "System32", "drivers", "etc", "hosts")
+	if data, err := os.ReadFile(hostsPath); err == nil {
+		config.Hosts = ParseHostsFile(data)
+		for _, entry := range config.Hosts {
+			if flags := FlagHostsEntry(entry); flags != nil {
+				config.Findings = append(config.Findings, Finding{Scope: "hosts", Setting: fmt.Sprintf("line %d", entry.Line), Value: entry.Address, Host: strings.Join(entry.Names, " "), Flags: flags})
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		config.Errors = append(config.Errors, fmt.Sprintf("hosts: %v", err))
+	}
+
+	w.collectPACFiles(ctx, proxyDir, config, manifest)
+
+	config.CountFlagged()
+	config.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+	manifest.SetFlaggedSettings(config.FlaggedCount)
+
+	if err := w.writeConfig(ctx, proxyDir, config, manifest); err != nil {
+		manifest.AddError("proxy_config.json", err.Error())
+	}
+
+	// Write manifest
+	manifestPath := filepath.Join(proxyDir, "manifest.json")
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// openHive opens the registry module's copy of a hive when it passes
+// validation, or else the hive file itself, which succeeds for an offline
+// root or a profile whose user is logged off. It returns where the hive came from.
+func openHive(registryCopy, hostPath string) (*regf.Hive, string, error) {
+	if regf.CheckFile(registryCopy).Valid {
+		if hive, err := regf.Open(registryCopy); err == nil {
+			return hive, "registry_module", nil
+		}
+	}
+	hive, err := regf.Open(hostPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("no valid registry module copy, and %w", err)
+	}
+	return hive, "hive_file", nil
+}
+
+// readUsers reads each user profile's Internet Settings from NTUSER.DAT.
+func (w *WinProxy) readUsers(ctx context.Context, hiveDir string, config *ProxyConfig) {
+	usersDir := winutil.UsersDir()
+	entries, err := os.ReadDir(usersDir)
+	if err != nil {
+		config.Errors = append(config.Errors, fmt.Sprintf("failed to read users directory: %v", err))
+		return
+	}
+
+	for _, entry := range entries {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if !entry.IsDir() || w.isSystemProfile(entry.Name()) {
+			continue
+		}
+
+		username := entry.Name()
+		user := UserProxy{User: username}
+		hive, source, err := openHive(filepath.Join(hiveDir, "NTUSER_"+username+".hiv"), filepath.Join(usersDir, username, "NTUSER.DAT"))
+		if err != nil {
+			if _, statErr := os.Stat(filepath.Join(usersDir, username, "NTUSER.DAT")); os.IsNotExist(statErr) {
+				continue
+			}
+			user.Error = err.Error()
+			config.Users = append(config.Users, user)
+			continue
+		}
+		user.HiveSource = source
+
+		if key, err := hive.OpenKey(internetSettingsKey); err == nil {
+			if user.Settings, err = ReadInternetSettings(key); err != nil {
+				user.Error = fmt.Sprintf("DefaultConnectionSettings: %v", err)
+			}
+		}
+		hive.Close()
+
+		config.AddFindings("user:"+username, user.Settings)
+		config.Users = append(config.Users, user)
+	}
+}
+
+// collectWinHTTP saves and parses the output of netsh winhttp show proxy.
+func (w *WinProxy) collectWinHTTP(ctx context.Context, outDir string, config *ProxyConfig, manifest *ProxyManifest) error {
+	output, err := winutil.RunCommandWithOutput(ctx, "netsh", []string{"winhttp", "show", "proxy"})
+	if err != nil {
+		return err
+	}
+
+	outputPath := filepath.Join(outDir, "winhttp_proxy.txt")
+	if err := os.WriteFile(outputPath, output, 0644); err != nil {
+		return fmt.Errorf("failed to write netsh output: %w", err)
+	}
+	manifest.IncrementTotalFiles()
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat netsh output: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash netsh output: %w", err)
+	}
+	manifest.AddItem("winhttp_proxy.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "winhttp_proxy", "WinHTTP proxy from netsh winhttp show proxy")
+
+	config.WinHTTPLive = ParseNetshWinHTTP(output)
+	// The hive's WinHttpSettings already produced a finding for the same server
+	if config.Machine == nil || config.Machine.WinHTTP == nil || config.Machine.WinHTTP.ProxyServer != config.WinHTTPLive.ProxyServer {
+		config.AddServerFinding("winhttp", "netsh winhttp", config.WinHTTPLive.ProxyServer)
+	}
+	return nil
+}
+
+// collectPACFiles copies the PAC script of every distinct AutoConfigURL
+// found, downloading network URLs only when fetchPAC is set.
+func (w *WinProxy) collectPACFiles(ctx context.Context, outDir string, config *ProxyConfig, manifest *ProxyManifest) {
+	seen := make(map[string]bool)
+	constraints := winutil.NewSizeConstraints(ctx)
+	for _, finding := range config.Findings {
+		if !strings.HasSuffix(finding.Setting, "AutoConfigURL") || seen[strings.ToLower(finding.Value)] {
+			continue
+		}
+		seen[strings.ToLower(finding.Value)] = true
+
+		pac := PACFile{Scope: finding.Scope, URL: finding.Value}
+		relPath := filepath.Join("pac", fmt.Sprintf("%02d_%s", len(config.PACFiles)+1, pacFileName(finding.Value)))
+		destPath := filepath.Join(outDir, relPath)
+		if err := winutil.EnsureDir(filepath.Dir(destPath)); err != nil {
+			pac.Error = err.Error()
+			config.PACFiles = append(config.PACFiles, pac)
+			continue
+		}
+
+		var modified time.Time
+		if localPath := PACLocalPath(finding.Value); localPath != "" {
+			localPath = hostPath(localPath)
+			stat, err := os.Stat(localPath)
+			if err == nil {
+				modified = stat.ModTime()
+				pac.Size, pac.SHA256, pac.Truncated, err = winutil.SmartCopy(localPath, destPath, constraints)
+			}
+			if err != nil {
+				pac.Error = err.Error()
+			}
+		} else if !w.fetchPAC {
+			pac.Error = "network PAC URL not fetched; enable with --fetch-pac"
+		} else if winutil.IsOffline() {
+			pac.Error = "network PAC URL not fetched from an offline root"
+		} else {
+			size, truncated, err := FetchPAC(ctx, finding.Value, destPath)
+			if err == nil {
+				pac.Size, pac.Truncated, pac.Fetched = size, truncated, true
+				modified = winutil.Now(ctx)
+				pac.SHA256, err = winutil.HashFile(ctx, destPath)
+			}
+			if err != nil {
+				os.Remove(destPath)
+				pac.Error = err.Error()
+			}
+		}
+
+		if pac.Error == "" {
+			pac.Path = relPath
+			manifest.IncrementTotalFiles()
+			manifest.AddItem(relPath, pac.Size, pac.SHA256, pac.Truncated, modified, "pac_file", fmt.Sprintf("PAC script from %s (%s)", finding.Value, finding.Scope))
+		}
+		config.PACFiles = append(config.PACFiles, pac)
+	}
+}
+
+// hostPath maps a drive-letter path recorded on the host onto the offline
+// root when collecting from one.
+func hostPath(path string) string {
+	if !winutil.IsOffline() || len(path) < 2 || path[1] != ':' {
+		return path
+	}
+	return winutil.SystemDrive() + path[2:]
+}
+
+// writeConfig writes proxy_config.json.
+func (w *WinProxy) writeConfig(ctx context.Context, outDir string, config *ProxyConfig, manifest *ProxyManifest) error {
+	outputPath := filepath.Join(outDir, "proxy_config.json")
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal proxy configuration: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write proxy configuration: %w", err)
+	}
+
+	manifest.IncrementTotalFiles()
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat proxy configuration: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash proxy configuration: %w", err)
+	}
+	note := fmt.Sprintf("WinINET, WinHTTP, WPAD, PAC, and hosts file redirection (%d findings, %d flagged)", len(config.Findings), config.FlaggedCount)
+	manifest.AddItem("proxy_config.json", stat.Size(), sha256Hex, false, stat.ModTime(), "proxy_config", note)
+
+	return nil
+}
+
+// isSystemProfile checks if a username represents a system profile that should be skipped.
+func (w *WinProxy) isSystemProfile(username string) bool {
+	systemProfiles := []string{
+		"All Users", "Default", "Default User", "Public",
+		"WDAGUtilityAccount", "defaultuser0", "systemprofile",
+	}
+
+	lowerUsername := strings.ToLower(username)
+	for _, profile := range systemProfiles {
+		if lowerUsername == strings.ToLower(profile) {
+			return true
+		}
+	}
+
+	return false
+}
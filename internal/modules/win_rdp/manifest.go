@@ -2,9 +2,12 @@
 package win_rdp
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // RDPItem represents a collected RDP artifact file.
@@ -15,7 +18,7 @@ type RDPItem struct {
 	Truncated bool   `json:"truncated"` // Whether the file was truncated due to size limits
 	Note      string `json:"note,omitempty"` // Description of the file
 	Modified  string `json:"modified"`  // File modification time (RFC3339)
-	FileType  string `json:"file_type"` // Type: "bitmap_cache", "config"
+	FileType  string `json:"file_type"` // Type: "bitmap_cache", "config", "rdp_config"
 }
 
 // RDPError represents an error that occurred during collection.
@@ -36,9 +39,9 @@ type RDPManifest struct {
 }
 
 // NewRDPManifest creates a new RDP manifest with basic information.
-func NewRDPManifest(hostname string) *RDPManifest {
+func NewRDPManifest(ctx context.Context, hostname string) *RDPManifest {
 	return &RDPManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]RDPItem, 0),
@@ -56,7 +59,7 @@ func (rm *RDPManifest) AddItem(path string, size int64, sha256 string, truncated
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	rm.CollectedFiles++
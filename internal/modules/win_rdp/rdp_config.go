@@ -0,0 +1,384 @@
+package win_rdp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// defaultRDPPort is the standard RDP-Tcp listener port.
+const defaultRDPPort = 3389
+
+// maxRemoteDesktopUsers is the member count above which the Remote Desktop Users group is flagged.
+const maxRemoteDesktopUsers = 10
+
+// broadPrincipals are group members that grant RDP to effectively everyone.
+var broadPrincipals = []string{
+	"everyone",
+	"authenticated users",
+	"users",
+	"domain users",
+	"interactive",
+	"nt authority\\authenticated users",
+	"nt authority\\interactive",
+	"builtin\\users",
+}
+
+// Registry keys making up the server-side remote access configuration.
+const (
+	terminalServerKey   = `HKLM\SYSTEM\CurrentControlSet\Control\Terminal Server`
+	rdpTcpKey           = `HKLM\SYSTEM\CurrentControlSet\Control\Terminal Server\WinStations\RDP-Tcp`
+	tsPolicyKey         = `HKLM\SOFTWARE\Policies\Microsoft\Windows NT\Terminal Services`
+	remoteAssistanceKey = `HKLM\SYSTEM\CurrentControlSet\Control\Remote Assistance`
+	tsGatewayKey        = `HKLM\SOFTWARE\Microsoft\Terminal Server Gateway`
+)
+
+// rdpConfigKeys lists the keys queried for rdp_config.json.
+var rdpConfigKeys = []string{terminalServerKey, rdpTcpKey, tsPolicyKey, remoteAssistanceKey, tsGatewayKey}
+
+// FirewallRule is an inbound firewall rule parsed from netsh advfirewall output.
+type FirewallRule struct {
+	Name      string `json:"name"`
+	Enabled   bool   `json:"enabled"`
+	Direction string `json:"direction"`
+	Action    string `json:"action"`
+	Protocol  string `json:"protocol"`
+	LocalPort string `json:"local_port"`
+	Profiles  string `json:"profiles"`
+}
+
+// RDPConfig is the structure written to rdp_config.json.
+type RDPConfig struct {
+	CollectedUTC            string           `json:"collected_utc"`
+	RDPEnabled              bool             `json:"rdp_enabled"`
+	EnabledByPolicy         bool             `json:"enabled_by_policy,omitempty"` // fDenyTSConnections came from Group Policy
+	ListenerPort            int              `json:"listener_port"`
+	NLARequired             bool             `json:"nla_required"`
+	SecurityLayer           *uint64          `json:"security_layer,omitempty"`
+	MinEncryptionLevel      *uint64          `json:"min_encryption_level,omitempty"`
+	RemoteAssistanceEnabled bool             `json:"remote_assistance_enabled"`
+	GatewayConfigured       bool             `json:"gateway_configured"`
+	RemoteDesktopUsers      []string         `json:"remote_desktop_users"`
+	FirewallRules           []FirewallRule   `json:"firewall_rules"` // Enabled inbound rules covering the listener port
+	Findings                []string         `json:"findings"`
+	RegistryKeys            []winutil.RegKey `json:"registry_keys"`
+	Errors                  []string         `json:"errors,omitempty"`
+}
+
+// BuildRDPConfig derives the effective remote access configuration from the
+// queried registry keys, Remote Desktop Users membership, and firewall rules.
+// Group Policy values take precedence over the local settings they override.
+func BuildRDPConfig(keys []winutil.RegKey, rdpUsers []string, rules []FirewallRule) *RDPConfig {
+	config := &RDPConfig{
+		ListenerPort:       defaultRDPPort,
+		RemoteDesktopUsers: rdpUsers,
+		FirewallRules:      make([]FirewallRule, 0),
+		Findings:           make([]string, 0),
+		RegistryKeys:       keys,
+	}
+	if config.RemoteDesktopUsers == nil {
+		config.RemoteDesktopUsers = make([]string, 0)
+	}
+
+	local := findRegKey(keys, terminalServerKey)
+	listener := findRegKey(keys, rdpTcpKey)
+	policy := findRegKey(keys, tsPolicyKey)
+	assistance := findRegKey(keys, remoteAssistanceKey)
+
+	// RDP is enabled when connections are not denied
+	deny, hasDeny := uint64(1), false
+	if policy != nil {
+		if v, ok := policy.DWORD("fDenyTSConnections"); ok {
+			deny, hasDeny = v, true
+			config.EnabledByPolicy = v == 0
+		}
+	}
+	if !hasDeny && local != nil {
+		if v, ok := local.DWORD("fDenyTSConnections"); ok {
+			deny = v
+		}
+	}
+	config.RDPEnabled = deny == 0
+
+	nla, hasNLA := uint64(0), false
+	if policy != nil {
+		nla, hasNLA = policy.DWORD("UserAuthentication")
+	}
+	if listener != nil {
+		if v, ok := listener.DWORD("PortNumber"); ok && v > 0 && v <= 65535 {
+			config.ListenerPort = int(v)
+		}
+		if !hasNLA {
+			nla, _ = listener.DWORD("UserAuthentication")
+		}
+		if v, ok := listener.DWORD("SecurityLayer"); ok {
+			config.SecurityLayer = &v
+		}
+		if v, ok := listener.DWORD("MinEncryptionLevel"); ok {
+			config.MinEncryptionLevel = &v
+		}
+	}
+	config.NLARequired = nla == 1
+
+	if assistance != nil {
+		if v, ok := assistance.DWORD("fAllowToGetHelp"); ok {
+			config.RemoteAssistanceEnabled = v == 1
+		}
+	}
+	if gateway := findRegKey(keys, tsGatewayKey); gateway != nil {
+		config.GatewayConfigured = true
+	}
+
+	port := strconv.Itoa(config.ListenerPort)
+	for _, rule := range rules {
+		if rule.Enabled && strings.EqualFold(rule.Direction, "In") && portListIncludes(rule.LocalPort, port) {
+			config.FirewallRules = append(config.FirewallRules, rule)
+		}
+	}
+
+	config.Findings = rdpFindings(config)
+	return config
+}
+
+// HiveRDPConfigKeys reads the keys of rdpConfigKeys from SYSTEM and SOFTWARE
+// hive files, naming them and rendering their values as reg query would so
+// BuildRDPConfig treats both sources alike. Absent keys are left out, as
+// reg query fails on them; software may be nil when that hive is unreadable.
+func HiveRDPConfigKeys(system, software *regf.Hive) ([]winutil.RegKey, error) {
+	controlSet, err := currentControlSet(system)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]winutil.RegKey, 0)
+	for _, path := range rdpConfigKeys {
+		hive, rel := software, strings.TrimPrefix(path, `HKLM\SOFTWARE\`)
+		if strings.HasPrefix(path, `HKLM\SYSTEM\CurrentControlSet\`) {
+			hive, rel = system, controlSet+`\`+strings.TrimPrefix(path, `HKLM\SYSTEM\CurrentControlSet\`)
+		}
+		if hive == nil {
+			continue
+		}
+		key, err := hive.OpenKey(rel)
+		if errors.Is(err, regf.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		values, err := key.Values()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		regKey := winutil.RegKey{Path: path, Values: make([]winutil.RegValue, 0, len(values))}
+		for _, value := range values {
+			regKey.Values = append(regKey.Values, regQueryValue(value))
+		}
+		keys = append(keys, regKey)
+	}
+	return keys, nil
+}
+
+// regQueryValue renders a hive value as reg query prints it.
+func regQueryValue(value *regf.Value) winutil.RegValue {
+	name := value.Name
+	if name == "" {
+		name = "(Default)"
+	}
+	switch value.Type {
+	case regf.TypeDWORD, regf.TypeDWORDBE, regf.TypeQWORD:
+		n, _ := value.Uint64()
+		typeName := "REG_DWORD"
+		if value.Type == regf.TypeQWORD {
+			typeName = "REG_QWORD"
+		}
+		return winutil.RegValue{Name: name, Type: typeName, Data: fmt.Sprintf("0x%x", n)}
+	case regf.TypeString:
+		return winutil.RegValue{Name: name, Type: "REG_SZ", Data: value.String()}
+	case regf.TypeExpandStr:
+		return winutil.RegValue{Name: name, Type: "REG_EXPAND_SZ", Data: value.String()}
+	case regf.TypeMultiStr:
+		return winutil.RegValue{Name: name, Type: "REG_MULTI_SZ", Data: strings.Join(value.Strings(), `\0`)}
+	default:
+		return winutil.RegValue{Name: name, Type: "REG_BINARY", Data: strings.ToUpper(hex.EncodeToString(value.Data))}
+	}
+}
+
+// currentControlSet returns the ControlSet00N key name that Select\Current
+// points at; a hive file has no CurrentControlSet link.
+func currentControlSet(system *regf.Hive) (string, error) {
+	key, err := system.OpenKey("Select")
+	if err != nil {
+		return "", fmt.Errorf("failed to open Select key: %w", err)
+	}
+	value, err := key.Value("Current")
+	if err != nil {
+		return "", fmt.Errorf("failed to read Select\\Current: %w", err)
+	}
+	current, ok := value.Uint64()
+	if !ok || current == 0 {
+		return "", fmt.Errorf("invalid Select\\Current value")
+	}
+	return fmt.Sprintf("ControlSet%03d", current), nil
+}
+
+// rdpFindings returns indicators that remote access was enabled or weakened.
+func rdpFindings(config *RDPConfig) []string {
+	findings := make([]string, 0)
+
+	if config.RDPEnabled {
+		if config.ListenerPort != defaultRDPPort {
+			findings = append(findings, fmt.Sprintf("rdp_nonstandard_port: RDP listener on port %d", config.ListenerPort))
+		}
+		if !config.NLARequired {
+			findings = append(findings, "nla_disabled: Network Level Authentication is not required")
+		}
+		if config.SecurityLayer != nil && *config.SecurityLayer == 0 {
+			findings = append(findings, "rdp_security_layer: native RDP security (no TLS) negotiated")
+		}
+		for _, rule := range config.FirewallRules {
+			if strings.EqualFold(rule.Action, "Allow") && config.ListenerPort != defaultRDPPort {
+				findings = append(findings, fmt.Sprintf("firewall_allows_nonstandard_rdp_port: rule %q allows inbound port %d", rule.Name, config.ListenerPort))
+			}
+		}
+	}
+
+	for _, member := range config.RemoteDesktopUsers {
+		lower := strings.ToLower(member)
+		for _, broad := range broadPrincipals {
+			if lower == broad || strings.HasSuffix(lower, "\\"+broad) {
+				findings = append(findings, fmt.Sprintf("broad_rdp_users: %s is a member of Remote Desktop Users", member))
+				break
+			}
+		}
+	}
+	if len(config.RemoteDesktopUsers) > maxRemoteDesktopUsers {
+		findings = append(findings, fmt.Sprintf("broad_rdp_users: Remote Desktop Users has %d members", len(config.RemoteDesktopUsers)))
+	}
+
+	if config.RemoteAssistanceEnabled {
+		findings = append(findings, "remote_assistance_enabled: unsolicited help requests are allowed")
+	}
+
+	return findings
+}
+
+// findRegKey returns the parsed key whose path matches, accepting both the
+// HKLM and HKEY_LOCAL_MACHINE spellings reg.exe may print.
+func findRegKey(keys []winutil.RegKey, path string) *winutil.RegKey {
+	want := normalizeRegPath(path)
+	for i := range keys {
+		if normalizeRegPath(keys[i].Path) == want {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// normalizeRegPath lowercases a key path and abbreviates the hive name.
+func normalizeRegPath(path string) string {
+	lower := strings.ToLower(strings.TrimSpace(path))
+	return strings.Replace(lower, "hkey_local_machine", "hklm", 1)
+}
+
+// portListIncludes reports whether a netsh LocalPort value (e.g. "3389",
+// "3389,5000-5010" or "Any") covers port.
+func portListIncludes(list, port string) bool {
+	target, err := strconv.Atoi(port)
+	if err != nil {
+		return false
+	}
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if strings.EqualFold(part, "Any") {
+			return true
+		}
+		if lo, hi, ok := strings.Cut(part, "-"); ok {
+			l, err1 := strconv.Atoi(lo)
+			h, err2 := strconv.Atoi(hi)
+			if err1 == nil && err2 == nil && target >= l && target <= h {
+				return true
+			}
+			continue
+		}
+		if part == port {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLocalGroupMembers extracts members from `net localgroup <group>` output,
+// which lists them between a dashed separator and the completion message.
+func ParseLocalGroupMembers(output []byte) []string {
+	members := make([]string, 0)
+	inMembers := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "---") {
+			inMembers = true
+			continue
+		}
+		if !inMembers || line == "" {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(line), "the command completed") {
+			break
+		}
+		members = append(members, line)
+	}
+
+	return members
+}
+
+// ParseFirewallRules parses `netsh advfirewall firewall show rule name=all` output.
+// Each rule is a block of "Field:   value" lines beginning with "Rule Name:".
+func ParseFirewallRules(output []byte) []FirewallRule {
+	rules := make([]FirewallRule, 0)
+	var current *FirewallRule
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		field, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		if field == "rule name" {
+			rules = append(rules, FirewallRule{Name: value})
+			current = &rules[len(rules)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch field {
+		case "enabled":
+			current.Enabled = strings.EqualFold(value, "Yes")
+		case "direction":
+			current.Direction = value
+		case "action":
+			current.Action = value
+		case "protocol":
+			current.Protocol = value
+		case "localport":
+			current.LocalPort = value
+		case "profiles":
+			current.Profiles = value
+		}
+	}
+
+	return rules
+}
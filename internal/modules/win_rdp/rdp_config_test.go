@@ -0,0 +1,126 @@
+package win_rdp
+
+import (
+	"reflect"
+	"testing"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+)
+
+// openHive writes root as a hive named name and opens it.
+func openHive(t *testing.T, name string, root *regftest.Key) *regf.Hive {
+	t.Helper()
+	hive, err := regf.Open(regftest.WriteFile(t, name, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hive.Close() })
+	return hive
+}
+
+// localSystemHive is the SYSTEM hive of a workstation with RDP enabled
+// locally and the listener left at its defaults.
+func localSystemHive(t *testing.T) *regf.Hive {
+	t.Helper()
+	return openHive(t, "SYSTEM", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Select", Values: []regftest.Value{regftest.DWORD("Current", 1)}},
+		{Name: "ControlSet001", Subkeys: []*regftest.Key{{Name: "Control", Subkeys: []*regftest.Key{
+			{Name: "Terminal Server", Values: []regftest.Value{
+				regftest.DWORD("fDenyTSConnections", 0),
+				regftest.DWORD("fSingleSessionPerUser", 1),
+			}, Subkeys: []*regftest.Key{
+				regftest.Path(`WinStations\RDP-Tcp`),
+			}},
+			{Name: "Remote Assistance", Values: []regftest.Value{regftest.DWORD("fAllowToGetHelp", 1)}},
+		}}}},
+	}})
+}
+
+func TestHiveRDPConfigKeys(t *testing.T) {
+	system := openHive(t, "SYSTEM", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Select", Values: []regftest.Value{regftest.DWORD("Current", 1)}},
+		{Name: "ControlSet001", Subkeys: []*regftest.Key{{Name: "Control", Subkeys: []*regftest.Key{
+			{Name: "Terminal Server", Values: []regftest.Value{regftest.DWORD("fDenyTSConnections", 0)}, Subkeys: []*regftest.Key{
+				{Name: "WinStations", Subkeys: []*regftest.Key{{Name: "RDP-Tcp", Values: []regftest.Value{
+					regftest.DWORD("PortNumber", 50102),
+					regftest.DWORD("UserAuthentication", 0),
+					regftest.DWORD("SecurityLayer", 0),
+					regftest.DWORD("MinEncryptionLevel", 2),
+					regftest.String("DrRedirectDisable", "0"),
+				}}}},
+			}},
+			{Name: "Remote Assistance", Values: []regftest.Value{regftest.DWORD("fAllowToGetHelp", 1)}},
+		}}}},
+	}})
+
+	keys, err := HiveRDPConfigKeys(system, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, len(keys))
+	for i, key := range keys {
+		paths[i] = key.Path
+	}
+	// The policy and gateway keys are in SOFTWARE
+	if want := []string{terminalServerKey, rdpTcpKey, remoteAssistanceKey}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("keys = %v, want %v", paths, want)
+	}
+	if port, ok := keys[1].Value("PortNumber"); !ok || port.Type != "REG_DWORD" || port.Data != "0xc3b6" {
+		t.Fatalf("PortNumber = %+v", port)
+	}
+
+	config := BuildRDPConfig(keys, nil, []FirewallRule{
+		{Name: "RDP custom", Enabled: true, Direction: "In", Action: "Allow", Protocol: "TCP", LocalPort: "50102", Profiles: "Domain,Private,Public"},
+		{Name: "Remote Desktop - User Mode (TCP-In)", Enabled: true, Direction: "In", Action: "Allow", Protocol: "TCP", LocalPort: "3389"},
+	})
+	if !config.RDPEnabled || config.EnabledByPolicy || config.ListenerPort != 50102 || config.NLARequired || !config.RemoteAssistanceEnabled || config.GatewayConfigured {
+		t.Fatalf("config = %+v", config)
+	}
+	if config.SecurityLayer == nil || *config.SecurityLayer != 0 || config.MinEncryptionLevel == nil || *config.MinEncryptionLevel != 2 {
+		t.Fatalf("security settings = %v, %v", config.SecurityLayer, config.MinEncryptionLevel)
+	}
+	// Only the rule covering the listener's port is kept
+	if len(config.FirewallRules) != 1 || config.FirewallRules[0].Name != "RDP custom" {
+		t.Fatalf("firewall rules = %+v", config.FirewallRules)
+	}
+	want := []string{
+		"rdp_nonstandard_port: RDP listener on port 50102",
+		"nla_disabled: Network Level Authentication is not required",
+		"rdp_security_layer: native RDP security (no TLS) negotiated",
+		`firewall_allows_nonstandard_rdp_port: rule "RDP custom" allows inbound port 50102`,
+		"remote_assistance_enabled: unsolicited help requests are allowed",
+	}
+	if !reflect.DeepEqual(config.Findings, want) {
+		t.Fatalf("findings = %q", config.Findings)
+	}
+}
+
+func TestHiveRDPConfigKeysPolicyOverridesLocalSettings(t *testing.T) {
+	software := openHive(t, "SOFTWARE", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Policies", Subkeys: []*regftest.Key{regftest.Path(`Microsoft\Windows NT`, &regftest.Key{Name: "Terminal Services", Values: []regftest.Value{
+			regftest.DWORD("fDenyTSConnections", 1),
+			regftest.DWORD("UserAuthentication", 1),
+		}})}},
+		regftest.Path(`Microsoft\Terminal Server Gateway`),
+	}})
+
+	keys, err := HiveRDPConfigKeys(localSystemHive(t), software)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 5 {
+		t.Fatalf("keys = %+v", keys)
+	}
+	config := BuildRDPConfig(keys, nil, nil)
+	if config.RDPEnabled || config.EnabledByPolicy || !config.NLARequired || !config.GatewayConfigured || config.ListenerPort != defaultRDPPort {
+		t.Fatalf("config = %+v", config)
+	}
+}
+
+func TestHiveRDPConfigKeysNeedsTheCurrentControlSet(t *testing.T) {
+	system := openHive(t, "SYSTEM", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{{Name: "ControlSet001"}}})
+	if _, err := HiveRDPConfigKeys(system, nil); err == nil {
+		t.Fatal("HiveRDPConfigKeys of a hive without Select succeeded")
+	}
+}
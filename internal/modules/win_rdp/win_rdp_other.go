@@ -19,6 +19,11 @@ func (w *WinRDP) Name() string {
 	return "windows/rdp"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinRDP) Describe() string {
+	return "RDP artifacts and bitmap cache"
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinRDP) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
@@ -4,11 +4,13 @@ package win_rdp
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"cryptkeeper/internal/regf"
 	"cryptkeeper/internal/winutil"
 )
 
@@ -25,6 +27,11 @@ func (w *WinRDP) Name() string {
 	return "windows/rdp"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinRDP) Describe() string {
+	return "RDP artifacts and bitmap cache"
+}
+
 // Collect copies Windows RDP artifacts including bitmap cache and configuration.
 func (w *WinRDP) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/rdp subdirectory
@@ -34,22 +41,27 @@ func (w *WinRDP) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewRDPManifest(hostname)
+	manifest := NewRDPManifest(ctx, hostname)
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Enumerate user profiles for per-user RDP artifacts
 	if err := w.collectPerUserRDPArtifacts(ctx, rdpDir, manifest, constraints); err != nil {
 		manifest.AddError("user_artifacts", fmt.Sprintf("Failed to collect per-user RDP artifacts: %v", err))
 	}
 
+	// Collect server-side remote access configuration
+	if err := w.collectRDPConfig(ctx, rdpDir, manifest); err != nil {
+		manifest.AddError("rdp_config", fmt.Sprintf("Failed to collect RDP configuration: %v", err))
+	}
+
 	// Write manifest
 	manifestPath := filepath.Join(rdpDir, "manifest.json")
 	if err := manifest.WriteManifest(manifestPath); err != nil {
@@ -62,10 +74,7 @@ func (w *WinRDP) Collect(ctx context.Context, outDir string) error {
 // collectPerUserRDPArtifacts collects RDP artifacts for each user profile.
 func (w *WinRDP) collectPerUserRDPArtifacts(ctx context.Context, outDir string, manifest *RDPManifest, constraints *winutil.SizeConstraints) error {
 	// Get system drive (usually C:)
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	usersDir := filepath.Join(systemDrive, "Users")
 	userEntries, err := os.ReadDir(usersDir)
@@ -195,7 +204,7 @@ func (w *WinRDP) collectDefaultRDP(ctx context.Context, userProfileDir, userOutD
 	}
 	defer srcFile.Close()
 
-	size, sha256Hex, err := winutil.CopyFileStreaming(srcFile, destPath)
+	size, sha256Hex, err := winutil.CopyFileStreaming(ctx, srcFile, destPath)
 	if err != nil {
 		return fmt.Errorf("failed to copy Default.rdp: %w", err)
 	}
@@ -210,6 +219,92 @@ func (w *WinRDP) collectDefaultRDP(ctx context.Context, userProfileDir, userOutD
 	return nil
 }
 
+// collectRDPConfig queries the Terminal Services registry, Remote Desktop Users
+// membership, and inbound firewall rules into rdp_config.json. Under an
+// offline root only the registry settings are read, from the image's hives.
+func (w *WinRDP) collectRDPConfig(ctx context.Context, outDir string, manifest *RDPManifest) error {
+	outputPath := filepath.Join(outDir, "rdp_config.json")
+	if winutil.IsOffline() {
+		// An image has no group membership or firewall to ask; the registry
+		// settings come from its hives
+		keys, err := hiveRDPConfigKeys()
+		if err != nil {
+			return err
+		}
+		return writeRDPConfig(ctx, outputPath, BuildRDPConfig(keys, nil, nil), nil, manifest)
+	}
+
+	var errors []string
+	keys := make([]winutil.RegKey, 0)
+	for _, key := range rdpConfigKeys {
+		result, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", key})
+		if err != nil {
+			// Policy and gateway keys are absent unless configured
+			continue
+		}
+		keys = append(keys, winutil.ParseRegQuery(result)...)
+	}
+
+	var rdpUsers []string
+	if result, err := winutil.RunCommandWithOutput(ctx, "net", []string{"localgroup", "Remote Desktop Users"}); err == nil {
+		rdpUsers = ParseLocalGroupMembers(result)
+	} else {
+		errors = append(errors, fmt.Sprintf("Remote Desktop Users: %v", err))
+	}
+
+	var rules []FirewallRule
+	if result, err := winutil.RunCommandWithOutput(ctx, "netsh", []string{"advfirewall", "firewall", "show", "rule", "name=all", "dir=in"}); err == nil {
+		rules = ParseFirewallRules(result)
+	} else {
+		errors = append(errors, fmt.Sprintf("firewall rules: %v", err))
+	}
+
+	return writeRDPConfig(ctx, outputPath, BuildRDPConfig(keys, rdpUsers, rules), errors, manifest)
+}
+
+// hiveRDPConfigKeys reads the remote access keys from the SYSTEM and SOFTWARE
+// hives under the offline root.
+func hiveRDPConfigKeys() ([]winutil.RegKey, error) {
+	configDir := filepath.Join(winutil.SystemRoot(), "System32", "config")
+	system, err := regf.Open(filepath.Join(configDir, "SYSTEM"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SYSTEM hive: %w", err)
+	}
+	defer system.Close()
+	// Policy and gateway settings are lost with SOFTWARE, the rest is not
+	software, err := regf.Open(filepath.Join(configDir, "SOFTWARE"))
+	if err != nil {
+		return HiveRDPConfigKeys(system, nil)
+	}
+	defer software.Close()
+	return HiveRDPConfigKeys(system, software)
+}
+
+// writeRDPConfig writes rdp_config.json and lists it in the manifest.
+func writeRDPConfig(ctx context.Context, outputPath string, config *RDPConfig, errors []string, manifest *RDPManifest) error {
+	config.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+	config.Errors = errors
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal RDP configuration: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write RDP configuration: %w", err)
+	}
+
+	// Add to manifest
+	if stat, err := os.Stat(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
+			manifest.IncrementTotalFiles()
+			note := fmt.Sprintf("Server-side RDP and remote access configuration (%d findings)", len(config.Findings))
+			manifest.AddItem("rdp_config.json", stat.Size(), sha256Hex, false, stat.ModTime(), "rdp_config", note)
+		}
+	}
+
+	return nil
+}
+
 // isSystemProfile checks if a username represents a system profile that should be skipped.
 func (w *WinRDP) isSystemProfile(username string) bool {
 	systemProfiles := []string{
@@ -0,0 +1,199 @@
+package win_recyclebin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// Collector copies $Recycle.Bin trees, grouping them by volume and SID.
+type Collector struct {
+	OutDir      string // Module output directory; each volume gets a subdirectory named by its letter
+	Resolver    *SIDResolver
+	Since       time.Time // Entries deleted before this are skipped; zero collects all
+	Manifest    *RecycleBinManifest
+	Constraints *winutil.SizeConstraints
+}
+
+// pairFiles are the directory entries of one $I/$R pair.
+type pairFiles struct {
+	info    string
+	recycle string
+	dir     bool
+}
+
+// CollectVolume copies every SID directory of the $Recycle.Bin at
+// recycleBinPath, the recycle bin of drive (e.g. "D:"), and records the
+// volume's grouping in the manifest.
+func (c *Collector) CollectVolume(ctx context.Context, drive, recycleBinPath string) {
+	volume := RecycleBinVolume{Drive: drive, Path: recycleBinPath, Users: make([]RecycleBinUser, 0)}
+	defer func() { c.Manifest.AddVolume(volume) }()
+
+	sidDirs, err := os.ReadDir(recycleBinPath)
+	if err != nil {
+		c.Manifest.AddError(recycleBinPath, fmt.Sprintf("Failed to read recycle bin directory: %v", err))
+		return
+	}
+
+	letter := strings.TrimSuffix(drive, ":")
+	for _, sidDir := range sidDirs {
+		if ctx.Err() != nil {
+			return
+		}
+		if !sidDir.IsDir() {
+			continue
+		}
+		sid := sidDir.Name()
+		user := RecycleBinUser{SID: sid, Entries: make([]RecycleBinEntry, 0)}
+		if c.Resolver != nil {
+			user.User, user.UserSource = c.Resolver.Resolve(sid)
+		}
+		c.collectSID(ctx, drive, filepath.Join(recycleBinPath, sid), filepath.Join(letter, sid), &user)
+		volume.Users = append(volume.Users, user)
+	}
+}
+
+// collectSID copies the $I/$R pairs of one SID directory. relDir is the SID
+// directory's path relative to the module output directory.
+func (c *Collector) collectSID(ctx context.Context, drive, sidPath, relDir string, user *RecycleBinUser) {
+	entries, err := os.ReadDir(sidPath)
+	if err != nil {
+		c.Manifest.AddError(sidPath, fmt.Sprintf("Failed to read SID directory: %v", err))
+		return
+	}
+
+	pairs := make(map[string]*pairFiles)
+	order := make([]string, 0)
+	for _, entry := range entries {
+		id, isInfo, ok := PairID(entry.Name())
+		if !ok {
+			continue
+		}
+		pair, seen := pairs[id]
+		if !seen {
+			pair = &pairFiles{}
+			pairs[id] = pair
+			order = append(order, id)
+		}
+		if isInfo && !entry.IsDir() {
+			pair.info = entry.Name()
+		} else if !isInfo {
+			pair.recycle = entry.Name()
+			pair.dir = entry.IsDir()
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(c.OutDir, relDir), 0755); err != nil {
+		c.Manifest.AddError(sidPath, fmt.Sprintf("Failed to create SID directory: %v", err))
+		return
+	}
+
+	for _, id := range order {
+		if ctx.Err() != nil {
+			return
+		}
+		pair := pairs[id]
+		entry := RecycleBinEntry{ID: id, IsDirectory: pair.dir}
+
+		var info *InfoFile
+		if pair.info != "" {
+			if data, err := os.ReadFile(filepath.Join(sidPath, pair.info)); err != nil {
+				entry.Error = fmt.Sprintf("failed to read %s: %v", pair.info, err)
+			} else if info, err = ParseInfoFile(data); err != nil {
+				entry.Error = err.Error()
+			}
+		}
+		if info != nil {
+			entry.OriginalPath = info.OriginalPath
+			entry.OriginalSize = info.OriginalSize
+			if !info.Deleted.IsZero() {
+				entry.DeletedUTC = winutil.FormatTime(info.Deleted)
+			}
+			// An entry without a readable deletion time is kept
+			if !c.Since.IsZero() && !info.Deleted.IsZero() && info.Deleted.Before(c.Since) {
+				user.SkippedBySince++
+				continue
+			}
+		}
+
+		note := fmt.Sprintf("Recycle Bin file from drive %s, SID %s", drive, user.SID)
+		if entry.OriginalPath != "" {
+			note += fmt.Sprintf(", deleted from %s", entry.OriginalPath)
+		}
+		if pair.info != "" {
+			entry.InfoFile = filepath.Join(relDir, pair.info)
+			if c.copyFile(filepath.Join(sidPath, pair.info), entry.InfoFile, "info_file", note) {
+				entry.Files++
+			}
+		}
+		if pair.recycle != "" {
+			entry.RecycleFile = filepath.Join(relDir, pair.recycle)
+			if pair.dir {
+				entry.Files += c.copyTree(ctx, filepath.Join(sidPath, pair.recycle), entry.RecycleFile, note)
+			} else if c.copyFile(filepath.Join(sidPath, pair.recycle), entry.RecycleFile, "recycle_file", note) {
+				entry.Files++
+			}
+		}
+		user.Entries = append(user.Entries, entry)
+	}
+}
+
+// copyTree copies the files of a deleted directory's $R tree and returns how
+// many were copied.
+func (c *Collector) copyTree(ctx context.Context, srcDir, relDir, note string) int {
+	copied := 0
+	err := filepath.WalkDir(srcDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			c.Manifest.AddError(path, fmt.Sprintf("Failed to read deleted directory: %v", err))
+			if d != nil && d.IsDir() && path != srcDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return nil
+		}
+		if c.copyFile(path, filepath.Join(relDir, rel), "recycle_file", note) {
+			copied++
+		}
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		c.Manifest.AddError(srcDir, fmt.Sprintf("Failed to walk deleted directory: %v", err))
+	}
+	return copied
+}
+
+// copyFile copies one file to relPath under the output directory and lists it.
+func (c *Collector) copyFile(srcPath, relPath, fileType, note string) bool {
+	c.Manifest.IncrementTotalFiles()
+	stat, err := os.Stat(srcPath)
+	if err != nil {
+		c.Manifest.AddError(srcPath, fmt.Sprintf("Failed to stat file: %v", err))
+		return false
+	}
+	destPath := filepath.Join(c.OutDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		c.Manifest.AddError(srcPath, fmt.Sprintf("Failed to create directory: %v", err))
+		return false
+	}
+	size, sha256Hex, truncated, err := winutil.SmartCopy(srcPath, destPath, c.Constraints)
+	if err != nil {
+		c.Manifest.AddError(srcPath, fmt.Sprintf("Failed to copy file: %v", err))
+		return false
+	}
+	c.Manifest.AddItem(relPath, size, sha256Hex, truncated, stat.ModTime(), fileType, note)
+	return true
+}
@@ -0,0 +1,244 @@
+package win_recyclebin
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+	"cryptkeeper/internal/winutil"
+)
+
+// infoFile encodes a $I file in the given format version.
+func infoFile(version int, originalPath string, size uint64, deleted time.Time) []byte {
+	data := binary.LittleEndian.AppendUint64(nil, uint64(version))
+	data = binary.LittleEndian.AppendUint64(data, size)
+	data = binary.LittleEndian.AppendUint64(data, regftest.Filetime(deleted))
+	path := utf16.Encode([]rune(originalPath + "\x00"))
+	if version == 2 {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(path)))
+	} else {
+		path = append(path, make([]uint16, infoV1PathBytes/2-len(path))...)
+	}
+	for _, u := range path {
+		data = binary.LittleEndian.AppendUint16(data, u)
+	}
+	return data
+}
+
+// writeBinFile writes a file of a synthetic volume.
+func writeBinFile(t *testing.T, root, name string, data []byte) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectVolumesGroupsBySID(t *testing.T) {
+	const alice, bob, unknown = "S-1-5-21-1-2-3-1001", "S-1-5-21-1-2-3-1002", "S-1-5-21-9-9-9-500"
+	deleted := time.Date(2024, 2, 20, 9, 15, 0, 0, time.UTC)
+
+	// C: holds a Windows 10 entry and one deleted before --since; D: a
+	// deleted directory in the Vista format and an $R file whose $I is gone
+	volumeC, volumeD := t.TempDir(), t.TempDir()
+	writeBinFile(t, volumeC, alice+"/$IAB12CD.docx", infoFile(2, `C:\Users\alice\Documents\plan.docx`, 11, deleted))
+	writeBinFile(t, volumeC, alice+"/$RAB12CD.docx", []byte("plan contents"))
+	writeBinFile(t, volumeC, alice+"/$IOLD001.txt", infoFile(2, `C:\Users\alice\old.txt`, 3, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)))
+	writeBinFile(t, volumeC, alice+"/$ROLD001.txt", []byte("old"))
+	writeBinFile(t, volumeC, alice+"/desktop.ini", []byte("[.ShellClassInfo]"))
+	if err := os.MkdirAll(filepath.Join(volumeC, "S-1-5-18"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeBinFile(t, volumeD, bob+"/$IXY99ZZ", infoFile(1, `D:\Projects\old`, 4096, deleted.Add(time.Hour)))
+	writeBinFile(t, volumeD, bob+"/$RXY99ZZ/src/main.go", []byte("package main"))
+	writeBinFile(t, volumeD, bob+"/$RXY99ZZ/README", []byte("readme"))
+	writeBinFile(t, volumeD, unknown+"/$RORPHAN.exe", []byte("MZ"))
+
+	outDir := t.TempDir()
+	manifest := NewRecycleBinManifest(context.Background(), "host")
+	collector := &Collector{
+		OutDir:      outDir,
+		Resolver:    NewSIDResolver(map[string]string{alice: "alice"}, map[string]string{bob: "bob"}),
+		Since:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Manifest:    manifest,
+		Constraints: winutil.NewSizeConstraints(context.Background()),
+	}
+	collector.CollectVolume(context.Background(), "C:", volumeC)
+	collector.CollectVolume(context.Background(), "D:", volumeD)
+
+	want := []RecycleBinVolume{
+		{Drive: "C:", Path: volumeC, Users: []RecycleBinUser{
+			{SID: "S-1-5-18", User: "SYSTEM", UserSource: "well_known", Entries: []RecycleBinEntry{}},
+			{SID: alice, User: "alice", UserSource: "profile_list", SkippedBySince: 1, Entries: []RecycleBinEntry{{
+				ID:           "AB12CD.DOCX",
+				InfoFile:     filepath.Join("C", alice, "$IAB12CD.docx"),
+				RecycleFile:  filepath.Join("C", alice, "$RAB12CD.docx"),
+				OriginalPath: `C:\Users\alice\Documents\plan.docx`,
+				OriginalSize: 11,
+				DeletedUTC:   "2024-02-20T09:15:00Z",
+				Files:        2,
+			}}},
+		}},
+		{Drive: "D:", Path: volumeD, Users: []RecycleBinUser{
+			{SID: bob, User: "bob", UserSource: "sam", Entries: []RecycleBinEntry{{
+				ID:           "XY99ZZ",
+				InfoFile:     filepath.Join("D", bob, "$IXY99ZZ"),
+				RecycleFile:  filepath.Join("D", bob, "$RXY99ZZ"),
+				OriginalPath: `D:\Projects\old`,
+				OriginalSize: 4096,
+				DeletedUTC:   "2024-02-20T10:15:00Z",
+				IsDirectory:  true,
+				Files:        3,
+			}}},
+			// Without its $I the deletion time is unknown, so --since keeps it
+			{SID: unknown, Entries: []RecycleBinEntry{{ID: "ORPHAN.EXE", RecycleFile: filepath.Join("D", unknown, "$RORPHAN.exe"), Files: 1}}},
+		}},
+	}
+	if !reflect.DeepEqual(manifest.Volumes, want) {
+		t.Fatalf("volumes =\n%+v\nwant\n%+v", manifest.Volumes, want)
+	}
+	if len(manifest.Errors) != 0 || manifest.CollectedFiles != 6 || manifest.TotalFiles != 6 {
+		t.Fatalf("manifest collected %d of %d files, errors %+v", manifest.CollectedFiles, manifest.TotalFiles, manifest.Errors)
+	}
+
+	// Each volume's bins are copied under its letter, the skipped pair not at all
+	for name, content := range map[string]string{
+		"C/" + alice + "/$RAB12CD.docx":      "plan contents",
+		"D/" + bob + "/$RXY99ZZ/src/main.go": "package main",
+		"D/" + unknown + "/$RORPHAN.exe":     "MZ",
+	} {
+		got, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+		if err != nil || string(got) != content {
+			t.Errorf("%s = %q, %v", name, got, err)
+		}
+	}
+	for _, name := range []string{"C/" + alice + "/$ROLD001.txt", "C/" + alice + "/desktop.ini"} {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("%s copied: %v", name, err)
+		}
+	}
+}
+
+func TestParseInfoFileRejectsDamagedFiles(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"short":           make([]byte, 10),
+		"unknown version": infoFile(3, `C:\x`, 1, time.Now()),
+		"overlong path":   infoFile(2, `C:\x`, 1, time.Now())[:infoHeaderSize+6],
+	} {
+		if _, err := ParseInfoFile(data); err == nil {
+			t.Errorf("%s $I file parsed", name)
+		}
+	}
+}
+
+func TestSIDResolverReadsProfileListAndSAM(t *testing.T) {
+	software := mustOpenHive(t, regftest.WriteFile(t, "SOFTWARE", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		regftest.Path(profileListKey,
+			&regftest.Key{Name: "S-1-5-18", Values: []regftest.Value{regftest.String("ProfileImagePath", `%systemroot%\system32\config\systemprofile`)}},
+			&regftest.Key{Name: "S-1-5-21-1-2-3-1001", Values: []regftest.Value{regftest.String("ProfileImagePath", `C:\Users\alice`)}},
+			&regftest.Key{Name: "S-1-5-21-7-7-7-1105", Values: []regftest.Value{regftest.String("ProfileImagePath", `C:\Users\jdoe.CORP\`)}},
+		),
+	}}))
+	profiles, err := ProfileUsers(software)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The Account V value closes with the machine SID S-1-5-21-1-2-3; each
+	// account's RID is the type of its Names entry's default value
+	machineSID := []byte{1, 4, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0}
+	for _, sub := range []uint32{1, 2, 3} {
+		machineSID = binary.LittleEndian.AppendUint32(machineSID, sub)
+	}
+	sam := mustOpenHive(t, regftest.WriteFile(t, "SAM", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		regftest.Path(`SAM\Domains`, &regftest.Key{
+			Name:   "Account",
+			Values: []regftest.Value{regftest.Binary("V", append(make([]byte, 40), machineSID...))},
+			Subkeys: []*regftest.Key{regftest.Path(`Users`, &regftest.Key{Name: "Names", Subkeys: []*regftest.Key{
+				{Name: "Administrator", Values: []regftest.Value{{Type: 500}}},
+				{Name: "alice", Values: []regftest.Value{{Type: 1001}}},
+				{Name: "svc_backup", Values: []regftest.Value{{Type: 1003}}},
+			}})},
+		}),
+	}}))
+	accounts, err := LocalAccounts(sam)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := NewSIDResolver(profiles, accounts)
+	for sid, want := range map[string][2]string{
+		"S-1-5-21-1-2-3-1001": {"alice", "profile_list"},
+		"s-1-5-21-7-7-7-1105": {"jdoe.CORP", "profile_list"},
+		"S-1-5-21-1-2-3-1003": {"svc_backup", "sam"},
+		"S-1-5-21-1-2-3-500":  {"Administrator", "sam"},
+		"S-1-5-18":            {"systemprofile", "profile_list"},
+		"S-1-5-20":            {"NETWORK SERVICE", "well_known"},
+		"S-1-5-21-1-2-3-1009": {"", ""},
+	} {
+		if user, source := resolver.Resolve(sid); user != want[0] || source != want[1] {
+			t.Errorf("Resolve(%s) = %q, %q, want %q, %q", sid, user, source, want[0], want[1])
+		}
+	}
+}
+
+// mustOpenHive opens a test hive for the rest of the test.
+func mustOpenHive(t *testing.T, path string) *regf.Hive {
+	t.Helper()
+	hive, err := regf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hive.Close() })
+	return hive
+}
+
+func TestManifestIsDeterministicUnderAFrozenClock(t *testing.T) {
+	frozen := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ctx := winutil.WithCollectSettings(context.Background(), &winutil.CollectSettings{
+		Now:      func() time.Time { return frozen },
+		Hostname: func() (string, error) { return "WS-0142", nil },
+	})
+
+	volume := t.TempDir()
+	writeBinFile(t, volume, "S-1-5-21-1-2-3-1001/$IAB12CD.docx", infoFile(2, `C:\Users\alice\plan.docx`, 11, frozen.Add(-time.Hour)))
+	writeBinFile(t, volume, "S-1-5-21-1-2-3-1001/$RAB12CD.docx", []byte("plan contents"))
+
+	write := func() []byte {
+		hostname, _ := winutil.Hostname(ctx)
+		manifest := NewRecycleBinManifest(ctx, hostname)
+		collector := &Collector{OutDir: t.TempDir(), Manifest: manifest, Constraints: winutil.NewSizeConstraints(ctx)}
+		collector.CollectVolume(ctx, "C:", volume)
+		path := filepath.Join(t.TempDir(), "manifest.json")
+		if err := manifest.WriteManifest(path); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	first := write()
+	if second := write(); string(first) != string(second) {
+		t.Fatalf("manifests differ:\n%s\n%s", first, second)
+	}
+	var manifest RecycleBinManifest
+	if err := json.Unmarshal(first, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.CreatedUTC != "2024-03-01T12:00:00Z" || manifest.Host != "WS-0142" || len(manifest.Items) != 2 {
+		t.Fatalf("manifest = %s", first)
+	}
+}
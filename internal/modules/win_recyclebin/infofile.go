@@ -0,0 +1,219 @@
+package win_recyclebin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// $I file layouts: version 1 (Vista to 8.1) holds a fixed 260-character
+// path, version 2 (Windows 10 and later) a length-prefixed one.
+const (
+	infoHeaderSize  = 24
+	infoV1PathBytes = 520
+)
+
+// InfoFile is the metadata a $I file records about one deleted item.
+type InfoFile struct {
+	Version      uint64
+	OriginalSize uint64
+	Deleted      time.Time
+	OriginalPath string
+}
+
+// ParseInfoFile decodes a $I file of either format.
+func ParseInfoFile(data []byte) (*InfoFile, error) {
+	if len(data) < infoHeaderSize {
+		return nil, fmt.Errorf("$I file too short (%d bytes)", len(data))
+	}
+	info := &InfoFile{
+		Version:      binary.LittleEndian.Uint64(data[0:8]),
+		OriginalSize: binary.LittleEndian.Uint64(data[8:16]),
+		Deleted:      winutil.FiletimeToUTC(binary.LittleEndian.Uint64(data[16:24])),
+	}
+	switch info.Version {
+	case 1:
+		end := infoHeaderSize + infoV1PathBytes
+		if len(data) < end {
+			end = len(data)
+		}
+		info.OriginalPath = decodeUTF16(data[infoHeaderSize:end])
+	case 2:
+		if len(data) < infoHeaderSize+4 {
+			return nil, fmt.Errorf("$I file truncated before path length")
+		}
+		chars := int(binary.LittleEndian.Uint32(data[infoHeaderSize:]))
+		end := infoHeaderSize + 4 + 2*chars
+		if chars <= 0 || end > len(data) {
+			return nil, fmt.Errorf("$I path length %d exceeds file", chars)
+		}
+		info.OriginalPath = decodeUTF16(data[infoHeaderSize+4 : end])
+	default:
+		return nil, fmt.Errorf("unsupported $I version %d", info.Version)
+	}
+	return info, nil
+}
+
+// decodeUTF16 decodes little-endian UTF-16 up to the first NUL.
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+// PairID returns the identifier shared by a $I/$R pair, e.g. "ABC123.docx"
+// for both $IABC123.docx and $RABC123.docx, and whether name is a $I file.
+func PairID(name string) (string, bool, bool) {
+	if len(name) < 3 || name[0] != '$' {
+		return "", false, false
+	}
+	switch name[1] {
+	case 'I', 'i':
+		return strings.ToUpper(name[2:]), true, true
+	case 'R', 'r':
+		return strings.ToUpper(name[2:]), false, true
+	}
+	return "", false, false
+}
+
+// profileListKey maps user SIDs to profile directories in the SOFTWARE hive.
+const profileListKey = `Microsoft\Windows NT\CurrentVersion\ProfileList`
+
+// samAccountKey holds the machine SID and the local account names of the SAM hive.
+const samAccountKey = `SAM\Domains\Account`
+
+// ProfileUsers maps the SIDs in a SOFTWARE hive's ProfileList to the last
+// element of each profile path, which is the account name the profile was
+// created for.
+func ProfileUsers(software *regf.Hive) (map[string]string, error) {
+	key, err := software.OpenKey(profileListKey)
+	if err != nil {
+		return nil, err
+	}
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]string, len(subkeys))
+	for _, sub := range subkeys {
+		value, err := sub.Value("ProfileImagePath")
+		if err != nil {
+			continue
+		}
+		if user := profileUser(value.String()); user != "" {
+			users[strings.ToUpper(sub.Name)] = user
+		}
+	}
+	return users, nil
+}
+
+// profileUser returns the last element of a profile path with either separator.
+func profileUser(profilePath string) string {
+	profilePath = strings.TrimRight(profilePath, `\/`)
+	if i := strings.LastIndexAny(profilePath, `\/`); i >= 0 {
+		return profilePath[i+1:]
+	}
+	return profilePath
+}
+
+// LocalAccounts maps the SIDs of a SAM hive's local accounts to their names.
+// An account's RID is the type of its Names subkey's default value, and the
+// machine SID closes the Account key's V value.
+func LocalAccounts(sam *regf.Hive) (map[string]string, error) {
+	account, err := sam.OpenKey(samAccountKey)
+	if err != nil {
+		return nil, err
+	}
+	v, err := account.Value("V")
+	if err != nil {
+		return nil, fmt.Errorf("%s\\V: %w", samAccountKey, err)
+	}
+	// The machine SID is S-1-5-21 with three subauthorities: 24 bytes
+	if len(v.Data) < 24 {
+		return nil, fmt.Errorf("%s\\V too short for a machine SID", samAccountKey)
+	}
+	machineSID := formatSID(v.Data[len(v.Data)-24:])
+	if !strings.HasPrefix(machineSID, "S-1-5-21-") {
+		return nil, fmt.Errorf("%s\\V does not end in a machine SID", samAccountKey)
+	}
+
+	names, err := sam.OpenKey(samAccountKey + `\Users\Names`)
+	if err != nil {
+		return nil, err
+	}
+	subkeys, err := names.Subkeys()
+	if err != nil {
+		return nil, err
+	}
+	accounts := make(map[string]string, len(subkeys))
+	for _, sub := range subkeys {
+		value, err := sub.Value("")
+		if err != nil {
+			continue
+		}
+		accounts[fmt.Sprintf("%s-%d", machineSID, value.Type)] = sub.Name
+	}
+	return accounts, nil
+}
+
+// formatSID formats a binary security identifier as S-1-5-21-...
+func formatSID(b []byte) string {
+	if len(b) < 8 || b[0] != 1 || len(b) < 8+4*int(b[1]) {
+		return ""
+	}
+	var authority uint64
+	for _, v := range b[2:8] {
+		authority = authority<<8 | uint64(v)
+	}
+	var sid strings.Builder
+	fmt.Fprintf(&sid, "S-%d-%d", b[0], authority)
+	for i := 0; i < int(b[1]); i++ {
+		fmt.Fprintf(&sid, "-%d", binary.LittleEndian.Uint32(b[8+4*i:]))
+	}
+	return sid.String()
+}
+
+// wellKnownSIDs names the built-in accounts that own recycle bins.
+var wellKnownSIDs = map[string]string{
+	"S-1-5-18": "SYSTEM",
+	"S-1-5-19": "LOCAL SERVICE",
+	"S-1-5-20": "NETWORK SERVICE",
+}
+
+// SIDResolver names the owners of recycle bin SID directories.
+type SIDResolver struct {
+	profiles map[string]string // From ProfileList; covers domain accounts that logged on
+	accounts map[string]string // From the SAM; covers local accounts without a profile
+}
+
+// NewSIDResolver combines the ProfileList and SAM mappings; either may be nil.
+func NewSIDResolver(profiles, accounts map[string]string) *SIDResolver {
+	return &SIDResolver{profiles: profiles, accounts: accounts}
+}
+
+// Resolve returns the account name for a SID and where it was found:
+// "profile_list", "sam", "well_known", or "" when it is unknown.
+func (r *SIDResolver) Resolve(sid string) (string, string) {
+	upper := strings.ToUpper(sid)
+	if name, ok := r.profiles[upper]; ok {
+		return name, "profile_list"
+	}
+	if name, ok := r.accounts[upper]; ok {
+		return name, "sam"
+	}
+	if name, ok := wellKnownSIDs[upper]; ok {
+		return name, "well_known"
+	}
+	return "", ""
+}
@@ -1,7 +1,7 @@
 // Package win_recyclebin provides Windows Recycle Bin collection for cryptkeeper.
 package win_recyclebin
 
-import ("encoding/json"; "os"; "time")
+import ("context"; "encoding/json"; "os"; "time"; "cryptkeeper/internal/winutil")
 
 type RecycleBinItem struct {
 	Path      string `json:"path"`
@@ -26,17 +26,20 @@ type RecycleBinManifest struct {
 	Errors             []RecycleBinError `json:"errors"`
 	TotalFiles         int               `json:"total_files"`
 	CollectedFiles     int               `json:"collected_files"`
+	Since              string            `json:"since,omitempty"` // Entries deleted before this were not collected
+	Volumes            []RecycleBinVolume `json:"volumes"`
 }
 
-func NewRecycleBinManifest(hostname string) *RecycleBinManifest {
+func NewRecycleBinManifest(ctx context.Context, hostname string) *RecycleBinManifest {
 	return &RecycleBinManifest{
-		CreatedUTC: time.Now().UTC().Format(time.RFC3339), Host: hostname, CryptkeeperVersion: "v0.1.0",
+		CreatedUTC: winutil.FormatTime(winutil.Now(ctx)), Host: hostname, CryptkeeperVersion: "v0.1.0",
 		Items: make([]RecycleBinItem, 0), Errors: make([]RecycleBinError, 0), TotalFiles: 0, CollectedFiles: 0,
+		Volumes: make([]RecycleBinVolume, 0),
 	}
 }
 
 func (rm *RecycleBinManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, note string) {
-	rm.Items = append(rm.Items, RecycleBinItem{Path: path, Size: size, SHA256: sha256, Truncated: truncated, Note: note, Modified: modified.UTC().Format(time.RFC3339), FileType: fileType})
+	rm.Items = append(rm.Items, RecycleBinItem{Path: path, Size: size, SHA256: sha256, Truncated: truncated, Note: note, Modified: winutil.FormatTime(modified), FileType: fileType})
 	rm.CollectedFiles++
 }
 
@@ -50,4 +53,38 @@ func (rm *RecycleBinManifest) WriteManifest(manifestPath string) error {
 	data, err := json.MarshalIndent(rm, "", "  ")
 	if err != nil { return err }
 	return os.WriteFile(manifestPath, data, 0644)
-}
\ No newline at end of file
+}
+// RecycleBinEntry is one deleted item: a $I metadata file and the $R file or
+// directory holding its content.
+type RecycleBinEntry struct {
+	ID           string `json:"id"` // Shared suffix of the $I/$R names
+	InfoFile     string `json:"info_file,omitempty"`
+	RecycleFile  string `json:"recycle_file,omitempty"`
+	OriginalPath string `json:"original_path,omitempty"`
+	OriginalSize uint64 `json:"original_size,omitempty"`
+	DeletedUTC   string `json:"deleted_utc,omitempty"`
+	IsDirectory  bool   `json:"is_directory"`
+	Files        int    `json:"files"` // Files copied for the entry, including those inside a deleted directory
+	Error        string `json:"error,omitempty"`
+}
+
+// RecycleBinUser is the recycle bin of one SID on one volume.
+type RecycleBinUser struct {
+	SID            string            `json:"sid"`
+	User           string            `json:"user,omitempty"`
+	UserSource     string            `json:"user_source,omitempty"` // "profile_list", "sam", or "well_known"
+	Entries        []RecycleBinEntry `json:"entries"`
+	SkippedBySince int               `json:"skipped_by_since,omitempty"` // Entries deleted before --since
+}
+
+// RecycleBinVolume groups the recycle bins found on one volume.
+type RecycleBinVolume struct {
+	Drive string           `json:"drive"`
+	Path  string           `json:"path"`
+	Users []RecycleBinUser `json:"users"`
+}
+
+// AddVolume records the per-SID grouping of one volume's recycle bin.
+func (rm *RecycleBinManifest) AddVolume(volume RecycleBinVolume) {
+	rm.Volumes = append(rm.Volumes, volume)
+}
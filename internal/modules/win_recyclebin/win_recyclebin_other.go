@@ -6,5 +6,8 @@ import ("context")
 
 type WinRecycleBin struct{}
 func NewWinRecycleBin() *WinRecycleBin { return &WinRecycleBin{} }
+func (w *WinRecycleBin) SetSinceTime(sinceRFC3339 string) {}
 func (w *WinRecycleBin) Name() string { return "windows/recyclebin" }
+func (w *WinRecycleBin) Describe() string { return "Recycle Bin artifacts" }
+func (w *WinRecycleBin) DependsOn() []string { return []string{"windows/registry"} }
 func (w *WinRecycleBin) Collect(ctx context.Context, outDir string) error { return nil }
\ No newline at end of file
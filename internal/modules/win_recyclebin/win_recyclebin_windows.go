@@ -8,40 +8,85 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"cryptkeeper/internal/regf"
 	"cryptkeeper/internal/winutil"
 )
 
-type WinRecycleBin struct{}
+// registryDir is where the windows/registry module leaves its hive copies,
+// relative to the artifacts directory.
+var registryDir = filepath.Join("windows_registry", "windows", "registry")
+
+// liveProfileListKey is ProfileList as reg query addresses it.
+const liveProfileListKey = `HKLM\SOFTWARE\` + profileListKey
+
+type WinRecycleBin struct {
+	sinceTime string // RFC3339 cutoff on the $I deletion time
+}
 
 func NewWinRecycleBin() *WinRecycleBin {
 	return &WinRecycleBin{}
 }
 
+// SetSinceTime configures the deletion-time filter for recycle bin entries.
+func (w *WinRecycleBin) SetSinceTime(sinceRFC3339 string) {
+	w.sinceTime = sinceRFC3339
+}
+
 func (w *WinRecycleBin) Name() string {
 	return "windows/recyclebin"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinRecycleBin) Describe() string {
+	return "Recycle Bin artifacts"
+}
+
+// DependsOn reports that the module runs after windows/registry, whose
+// SOFTWARE and SAM copies name the owners of the SID directories.
+func (w *WinRecycleBin) DependsOn() []string {
+	return []string{"windows/registry"}
+}
+
 func (w *WinRecycleBin) Collect(ctx context.Context, outDir string) error {
 	recycleBinDir := filepath.Join(outDir, "windows", "recyclebin")
 	if err := winutil.EnsureDir(recycleBinDir); err != nil {
 		return fmt.Errorf("failed to create recyclebin directory: %w", err)
 	}
 
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
-	manifest := NewRecycleBinManifest(hostname)
-	constraints := winutil.NewSizeConstraints()
+	manifest := NewRecycleBinManifest(ctx, hostname)
+	collector := &Collector{
+		OutDir:      recycleBinDir,
+		Resolver:    w.sidResolver(ctx, filepath.Join(filepath.Dir(outDir), registryDir), manifest),
+		Manifest:    manifest,
+		Constraints: winutil.NewSizeConstraints(ctx),
+	}
+	if w.sinceTime != "" {
+		if since, err := time.Parse(time.RFC3339, w.sinceTime); err == nil {
+			collector.Since = since
+			manifest.Since = winutil.FormatTime(since)
+		}
+	}
 
-	// Collect from all drives
-	drives := []string{"C:", "D:", "E:", "F:", "G:", "H:"}
+	// Every fixed volume has its own recycle bin, or only the alternate root when collecting from an image
+	drives, err := winutil.FixedDrives()
+	if err != nil {
+		manifest.AddError("fixed_drives", fmt.Sprintf("Failed to list fixed volumes, trying C: through H:: %v", err))
+		drives = []string{"C:", "D:", "E:", "F:", "G:", "H:"}
+	}
+	if winutil.IsOffline() {
+		drives = []string{winutil.SystemDrive()}
+	}
 	for _, drive := range drives {
-		recycleBinPath := filepath.Join(drive, "$Recycle.Bin")
+		recycleBinPath := winutil.SnapshotPath(filepath.Join(drive+`\`, "$Recycle.Bin"))
 		if _, err := os.Stat(recycleBinPath); err == nil {
-			w.collectRecycleBinFromDrive(ctx, recycleBinPath, recycleBinDir, manifest, constraints, drive)
+			collector.CollectVolume(ctx, drive, recycleBinPath)
 		}
 	}
 
@@ -53,86 +98,70 @@ func (w *WinRecycleBin) Collect(ctx context.Context, outDir string) error {
 	return nil
 }
 
-func (w *WinRecycleBin) collectRecycleBinFromDrive(ctx context.Context, recycleBinPath, outDir string, manifest *RecycleBinManifest, constraints *winutil.SizeConstraints, drive string) {
-	sidDirs, err := os.ReadDir(recycleBinPath)
-	if err != nil {
-		manifest.AddError(recycleBinPath, fmt.Sprintf("Failed to read recycle bin directory: %v", err))
-		return
-	}
+// sidResolver builds the SID-to-account mapping from the registry module's
+// SOFTWARE and SAM copies, or the hive files themselves on an offline root.
+// On a live system without a SOFTWARE copy, ProfileList is read with reg query.
+func (w *WinRecycleBin) sidResolver(ctx context.Context, hiveDir string, manifest *RecycleBinManifest) *SIDResolver {
+	configDir := filepath.Join(winutil.SystemRoot(), "System32", "config")
 
-	for _, sidDir := range sidDirs {
-		if !sidDir.IsDir() {
-			continue
+	var profiles map[string]string
+	if hive, err := openHive(filepath.Join(hiveDir, "SOFTWARE.hiv"), filepath.Join(configDir, "SOFTWARE")); err == nil {
+		profiles, err = ProfileUsers(hive)
+		hive.Close()
+		if err != nil {
+			manifest.AddError("ProfileList", err.Error())
 		}
+	} else if !winutil.IsOffline() {
+		profiles = liveProfileUsers(ctx)
+	} else {
+		manifest.AddError("SOFTWARE", err.Error())
+	}
 
-		sidName := sidDir.Name()
-		sidPath := filepath.Join(recycleBinPath, sidName)
-		
-		sidOutDir := filepath.Join(outDir, strings.Replace(drive, ":", "", 1), sidName)
-		if err := winutil.EnsureDir(sidOutDir); err != nil {
-			continue
+	var accounts map[string]string
+	if hive, err := openHive(filepath.Join(hiveDir, "SAM.hiv"), filepath.Join(configDir, "SAM")); err == nil {
+		accounts, err = LocalAccounts(hive)
+		hive.Close()
+		if err != nil {
+			manifest.AddError("SAM", err.Error())
 		}
-
-		// Collect files from this SID directory
-		w.collectRecycleBinFiles(ctx, sidPath, sidOutDir, manifest, constraints, drive, sidName)
+	} else {
+		manifest.AddError("SAM", err.Error())
 	}
+
+	return NewSIDResolver(profiles, accounts)
 }
 
-func (w *WinRecycleBin) collectRecycleBinFiles(ctx context.Context, sidPath, sidOutDir string, manifest *RecycleBinManifest, constraints *winutil.SizeConstraints, drive, sidName string) {
-	entries, err := os.ReadDir(sidPath)
+// openHive opens the registry module's copy of a hive when it passes
+// validation, or else the hive file itself, which succeeds for an offline root.
+func openHive(registryCopy, hostPath string) (*regf.Hive, error) {
+	if regf.CheckFile(registryCopy).Valid {
+		if hive, err := regf.Open(registryCopy); err == nil {
+			return hive, nil
+		}
+	}
+	hive, err := regf.Open(hostPath)
 	if err != nil {
-		manifest.AddError(sidPath, fmt.Sprintf("Failed to read SID directory: %v", err))
-		return
+		return nil, fmt.Errorf("no valid registry module copy, and %w", err)
 	}
+	return hive, nil
+}
 
-	for _, entry := range entries {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
-
-		if entry.IsDir() {
-			continue
-		}
-
-		filename := entry.Name()
-		if !w.isRecycleBinFile(filename) {
-			continue
-		}
-
-		manifest.IncrementTotalFiles()
-
-		srcPath := filepath.Join(sidPath, filename)
-		destPath := filepath.Join(sidOutDir, filename)
-
-		stat, err := os.Stat(srcPath)
-		if err != nil {
-			manifest.AddError(srcPath, fmt.Sprintf("Failed to stat file: %v", err))
+// liveProfileUsers maps ProfileList SIDs to profile directory names with reg query.
+func liveProfileUsers(ctx context.Context) map[string]string {
+	users := make(map[string]string)
+	output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", liveProfileListKey, "/s"})
+	if err != nil {
+		return users
+	}
+	for _, key := range winutil.ParseRegQuery(output) {
+		value, ok := key.Value("ProfileImagePath")
+		if !ok {
 			continue
 		}
-
-		size, sha256Hex, truncated, err := winutil.SmartCopy(srcPath, destPath, constraints)
-		if err != nil {
-			manifest.AddError(srcPath, fmt.Sprintf("Failed to copy file: %v", err))
-			continue
+		sid := key.Path[strings.LastIndex(key.Path, `\`)+1:]
+		if user := profileUser(value.Data); user != "" {
+			users[strings.ToUpper(sid)] = user
 		}
-
-		fileType := w.classifyRecycleBinFile(filename)
-		relPath := filepath.Join(strings.Replace(drive, ":", "", 1), sidName, filename)
-		note := fmt.Sprintf("Recycle Bin file from drive %s, SID %s (%s)", drive, sidName, filename)
-
-		manifest.AddItem(relPath, size, sha256Hex, truncated, stat.ModTime(), fileType, note)
 	}
+	return users
 }
-
-func (w *WinRecycleBin) isRecycleBinFile(filename string) bool {
-	return strings.HasPrefix(filename, "$I") || strings.HasPrefix(filename, "$R")
-}
-
-func (w *WinRecycleBin) classifyRecycleBinFile(filename string) string {
-	if strings.HasPrefix(filename, "$I") {
-		return "info_file"
-	}
-	return "recycle_file"
-}
\ No newline at end of file
@@ -0,0 +1,94 @@
+package win_registry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// hiveMethods are the ways of obtaining a hive file: a direct copy, and the
+// reg.exe export and shadow copy fallbacks.
+type hiveMethods struct {
+	copy   func(ctx context.Context, srcPath, destPath string, constraints *winutil.SizeConstraints) (int64, string, error)
+	export func(ctx context.Context, regKey, destPath string, constraints *winutil.SizeConstraints) (int64, string, bool, error)
+	shadow func(ctx context.Context, srcPath, destPath string, constraints *winutil.SizeConstraints) (int64, string, error)
+}
+
+// collectHive attempts to collect a single registry hive using multiple
+// methods. Every result is validated; a direct copy that fails validation
+// (typically a hive caught mid-write) is replaced by the first fallback that
+// yields a valid hive, and kept, flagged invalid, only when none does.
+func collectHive(ctx context.Context, methods hiveMethods, hive RegistryHive, outDir string, manifest *RegistryManifest, constraints *winutil.SizeConstraints) error {
+	destPath := filepath.Join(outDir, hive.Name+".hiv")
+	relPath, _ := filepath.Rel(outDir, destPath)
+
+	// Method 1: Try direct file copy with backup semantics
+	size, sha256Hex, copyErr := methods.copy(ctx, hive.FilePath, destPath, constraints)
+	if copyErr == nil {
+		check := regf.CheckFile(destPath)
+		if check.Valid {
+			constraints.AddFileSize(size)
+			manifest.AddItem(relPath, size, sha256Hex, false, hive.Note, "copy", check, "")
+			return nil
+		}
+
+		// Set the partial copy aside while the fallbacks write to destPath
+		reason := "direct copy failed validation: " + strings.Join(check.Problems, "; ")
+		partialPath := destPath + ".partial"
+		if err := os.Rename(destPath, partialPath); err != nil {
+			return fmt.Errorf("failed to set aside invalid copy of %s: %w", hive.Name, err)
+		}
+		if recoverHive(ctx, methods, hive, destPath, relPath, reason, manifest, constraints) {
+			os.Remove(partialPath)
+			return nil
+		}
+
+		// Ship the invalid copy flagged rather than nothing
+		if err := os.Rename(partialPath, destPath); err != nil {
+			return fmt.Errorf("failed to restore invalid copy of %s: %w", hive.Name, err)
+		}
+		constraints.AddFileSize(size)
+		manifest.AddItem(relPath, size, sha256Hex, false, hive.Note, "copy", check, "")
+		manifest.AddError(hive.Name, reason+"; no fallback produced a valid hive")
+		return nil
+	}
+
+	if recoverHive(ctx, methods, hive, destPath, relPath, fmt.Sprintf("direct copy failed: %v", copyErr), manifest, constraints) {
+		return nil
+	}
+
+	return fmt.Errorf("failed to collect hive %s using all methods", hive.Name)
+}
+
+// recoverHive tries the fallback methods in order and records the first that
+// produces a valid hive at destPath. It reports whether one succeeded.
+func recoverHive(ctx context.Context, methods hiveMethods, hive RegistryHive, destPath, relPath, reason string, manifest *RegistryManifest, constraints *winutil.SizeConstraints) bool {
+	// Method 2: Try reg.exe export (fallback for system hives only)
+	if !hive.IsUserHive && hive.RegKey != "" {
+		if size, sha256Hex, truncated, err := methods.export(ctx, hive.RegKey, destPath, constraints); err == nil {
+			if check := regf.CheckFile(destPath); check.Valid {
+				constraints.AddFileSize(size)
+				manifest.AddItem(relPath, size, sha256Hex, truncated, hive.Note, "reg_export", check, reason)
+				return true
+			}
+			os.Remove(destPath)
+		}
+	}
+
+	// Method 3: Copy the hive from the newest shadow copy of its volume
+	if size, sha256Hex, err := methods.shadow(ctx, hive.FilePath, destPath, constraints); err == nil {
+		if check := regf.CheckFile(destPath); check.Valid {
+			constraints.AddFileSize(size)
+			manifest.AddItem(relPath, size, sha256Hex, false, hive.Note+" (from shadow copy)", "shadow_copy", check, reason)
+			return true
+		}
+		os.Remove(destPath)
+	}
+
+	return false
+}
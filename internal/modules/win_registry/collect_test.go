@@ -0,0 +1,161 @@
+package win_registry
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cryptkeeper/internal/regf/regftest"
+	"cryptkeeper/internal/winutil"
+)
+
+// validHive is a complete hive file; its first 6000 bytes are what a copy
+// cut short mid-write leaves behind.
+var validHive = regftest.Build(&regftest.Key{
+	Name:    "CMI-CreateHive{2A7FB991-7BBE-4F9D-B91E-7CB51D4737F5}",
+	Subkeys: []*regftest.Key{regftest.Path(`ControlSet001\Services\EventLog`)},
+})
+
+// fakeHiveMethods records which methods ran, writing the given content for
+// each; nil content fails the method.
+type fakeHiveMethods struct {
+	copied, exported, shadowed []byte
+	calls                      []string
+}
+
+func (f *fakeHiveMethods) write(method string, content []byte, destPath string) (int64, string, error) {
+	f.calls = append(f.calls, method)
+	if content == nil {
+		return 0, "", errors.New(method + " unavailable")
+	}
+	if err := os.WriteFile(destPath, content, 0644); err != nil {
+		return 0, "", err
+	}
+	sha256Hex, err := winutil.HashFile(context.Background(), destPath)
+	return int64(len(content)), sha256Hex, err
+}
+
+func (f *fakeHiveMethods) methods() hiveMethods {
+	return hiveMethods{
+		copy: func(ctx context.Context, srcPath, destPath string, constraints *winutil.SizeConstraints) (int64, string, error) {
+			return f.write("copy", f.copied, destPath)
+		},
+		export: func(ctx context.Context, regKey, destPath string, constraints *winutil.SizeConstraints) (int64, string, bool, error) {
+			size, sha256Hex, err := f.write("reg_export", f.exported, destPath)
+			return size, sha256Hex, false, err
+		},
+		shadow: func(ctx context.Context, srcPath, destPath string, constraints *winutil.SizeConstraints) (int64, string, error) {
+			return f.write("shadow_copy", f.shadowed, destPath)
+		},
+	}
+}
+
+var (
+	systemHive = RegistryHive{Name: "SYSTEM", FilePath: `C:\Windows\System32\config\SYSTEM`, RegKey: `HKLM\SYSTEM`, Note: "System configuration hive"}
+	userHive   = RegistryHive{Name: "alice_NTUSER", FilePath: `C:\Users\alice\NTUSER.DAT`, Note: "User hive", IsUserHive: true}
+)
+
+func collectWith(t *testing.T, fake *fakeHiveMethods, hive RegistryHive) (*RegistryManifest, string, error) {
+	t.Helper()
+	outDir := t.TempDir()
+	manifest := NewRegistryManifest(context.Background(), "host", false, false)
+	err := collectHive(context.Background(), fake.methods(), hive, outDir, manifest, winutil.NewSizeConstraints(context.Background()))
+	return manifest, outDir, err
+}
+
+func TestCollectHiveAcceptsValidCopy(t *testing.T) {
+	fake := &fakeHiveMethods{copied: validHive, exported: validHive}
+	manifest, _, err := collectWith(t, fake, systemHive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(fake.calls, ",") != "copy" {
+		t.Errorf("methods tried = %v", fake.calls)
+	}
+	if len(manifest.Items) != 1 || manifest.Items[0].Method != "copy" || !manifest.Items[0].HiveValid || manifest.Items[0].FallbackReason != "" {
+		t.Errorf("items = %+v", manifest.Items)
+	}
+}
+
+func TestCollectHiveReplacesTruncatedCopy(t *testing.T) {
+	fake := &fakeHiveMethods{copied: validHive[:6000], exported: validHive}
+	manifest, outDir, err := collectWith(t, fake, systemHive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(fake.calls, ",") != "copy,reg_export" {
+		t.Errorf("methods tried = %v", fake.calls)
+	}
+	if len(manifest.Items) != 1 || len(manifest.Errors) != 0 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+	item := manifest.Items[0]
+	if item.Path != "SYSTEM.hiv" || item.Method != "reg_export" || !item.HiveValid || item.Size != int64(len(validHive)) {
+		t.Errorf("item = %+v", item)
+	}
+	if !strings.HasPrefix(item.FallbackReason, "direct copy failed validation: ") || !strings.Contains(item.FallbackReason, "not a multiple of 4096") {
+		t.Errorf("fallback reason = %q", item.FallbackReason)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "SYSTEM.hiv"))
+	if err != nil || len(data) != len(validHive) {
+		t.Fatalf("collected hive is %d bytes, %v", len(data), err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "SYSTEM.hiv.partial")); !os.IsNotExist(err) {
+		t.Errorf("partial copy left behind: %v", err)
+	}
+}
+
+func TestCollectHiveKeepsInvalidCopyWithoutFallback(t *testing.T) {
+	// User hives cannot be exported, and this volume has no shadow copy
+	fake := &fakeHiveMethods{copied: validHive[:6000], exported: validHive}
+	manifest, outDir, err := collectWith(t, fake, userHive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(fake.calls, ",") != "copy,shadow_copy" {
+		t.Errorf("methods tried = %v", fake.calls)
+	}
+	if len(manifest.Items) != 1 {
+		t.Fatalf("items = %+v", manifest.Items)
+	}
+	item := manifest.Items[0]
+	if item.Method != "copy" || item.HiveValid || len(item.ValidationProblems) == 0 || item.Size != 6000 {
+		t.Errorf("item = %+v", item)
+	}
+	if len(manifest.Errors) != 1 || manifest.Errors[0].Target != "alice_NTUSER" || !strings.HasSuffix(manifest.Errors[0].Error, "no fallback produced a valid hive") {
+		t.Errorf("errors = %+v", manifest.Errors)
+	}
+	if data, err := os.ReadFile(filepath.Join(outDir, "alice_NTUSER.hiv")); err != nil || len(data) != 6000 {
+		t.Errorf("invalid copy not kept: %d bytes, %v", len(data), err)
+	}
+}
+
+func TestCollectHiveFallsBackToShadowCopy(t *testing.T) {
+	dirty := append([]byte{}, validHive...)
+	dirty[4]++ // Exported mid-write
+	regftest.SetChecksum(dirty)
+	fake := &fakeHiveMethods{exported: dirty, shadowed: validHive}
+	manifest, _, err := collectWith(t, fake, systemHive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(fake.calls, ",") != "copy,reg_export,shadow_copy" {
+		t.Errorf("methods tried = %v", fake.calls)
+	}
+	if len(manifest.Items) != 1 || manifest.Items[0].Method != "shadow_copy" || !manifest.Items[0].HiveValid {
+		t.Fatalf("items = %+v", manifest.Items)
+	}
+	if reason := manifest.Items[0].FallbackReason; reason != "direct copy failed: copy unavailable" {
+		t.Errorf("fallback reason = %q", reason)
+	}
+
+	// Nothing works
+	_, _, err = collectWith(t, &fakeHiveMethods{}, systemHive)
+	if err == nil || err.Error() != "failed to collect hive SYSTEM using all methods" {
+		t.Errorf("collectHive = %v", err)
+	}
+}
@@ -2,19 +2,25 @@
 package win_registry
 
 import (
+	"context"
 	"encoding/json"
 	"os"
-	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
 )
 
 // RegistryItem represents a collected registry hive or artifact.
 type RegistryItem struct {
-	Path      string `json:"path"`      // Relative path in the archive
-	Size      int64  `json:"size"`      // File size in bytes
-	SHA256    string `json:"sha256"`    // SHA-256 hash
-	Truncated bool   `json:"truncated"` // Whether the file was truncated due to size limits
-	Note      string `json:"note,omitempty"` // Optional notes (e.g., "system hive", "user hive")
-	Method    string `json:"method,omitempty"` // Collection method: "copy" or "reg_export"
+	Path               string   `json:"path"`                          // Relative path in the archive
+	Size               int64    `json:"size"`                          // File size in bytes
+	SHA256             string   `json:"sha256"`                        // SHA-256 hash
+	Truncated          bool     `json:"truncated"`                     // Whether the file was truncated due to size limits
+	Note               string   `json:"note,omitempty"`                // Optional notes (e.g., "system hive", "user hive")
+	Method             string   `json:"method,omitempty"`              // Collection method: "copy", "reg_export", or "shadow_copy"
+	HiveValid          bool     `json:"hive_valid"`                    // Whether the collected file passed regf header validation
+	ValidationProblems []string `json:"validation_problems,omitempty"` // Why validation failed
+	FallbackReason     string   `json:"fallback_reason,omitempty"`     // Why the direct copy was replaced by the method used
 }
 
 // RegistryError represents an error that occurred during collection.
@@ -35,9 +41,9 @@ type RegistryManifest struct {
 }
 
 // NewRegistryManifest creates a new registry manifest with basic information.
-func NewRegistryManifest(hostname string, backupPriv, restorePriv bool) *RegistryManifest {
+func NewRegistryManifest(ctx context.Context, hostname string, backupPriv, restorePriv bool) *RegistryManifest {
 	return &RegistryManifest{
-		CreatedUTC:           time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:           winutil.FormatTime(winutil.Now(ctx)),
 		Host:                 hostname,
 		CryptkeeperVersion:   "v0.1.0",
 		Items:                make([]RegistryItem, 0),
@@ -47,15 +53,19 @@ func NewRegistryManifest(hostname string, backupPriv, restorePriv bool) *Registr
 	}
 }
 
-// AddItem adds a successfully collected registry item to the manifest.
-func (rm *RegistryManifest) AddItem(path string, size int64, sha256 string, truncated bool, note, method string) {
+// AddItem adds a successfully collected registry item to the manifest with
+// the result of validating its hive header.
+func (rm *RegistryManifest) AddItem(path string, size int64, sha256 string, truncated bool, note, method string, check regf.HeaderCheck, fallbackReason string) {
 	rm.Items = append(rm.Items, RegistryItem{
-		Path:      path,
-		Size:      size,
-		SHA256:    sha256,
-		Truncated: truncated,
-		Note:      note,
-		Method:    method,
+		Path:               path,
+		Size:               size,
+		SHA256:             sha256,
+		Truncated:          truncated,
+		Note:               note,
+		Method:             method,
+		HiveValid:          check.Valid,
+		ValidationProblems: check.Problems,
+		FallbackReason:     fallbackReason,
 	})
 }
 
@@ -88,10 +98,7 @@ type RegistryHive struct {
 
 // GetSystemHives returns the list of system registry hives to collect.
 func GetSystemHives() []RegistryHive {
-	systemRoot := os.Getenv("SystemRoot")
-	if systemRoot == "" {
-		systemRoot = "C:\\Windows"
-	}
+	systemRoot := winutil.SystemRoot()
 	
 	configPath := systemRoot + "\\System32\\config\\"
 	
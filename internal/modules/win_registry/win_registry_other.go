@@ -19,6 +19,11 @@ func (w *WinRegistry) Name() string {
 	return "windows/registry"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinRegistry) Describe() string {
+	return "Windows Registry hives"
+}
+
 // Collect is a no-op on non-Windows platforms and always returns nil.
 func (w *WinRegistry) Collect(ctx context.Context, outDir string) error {
 	// This module only works on Windows, so it's a no-op on other platforms
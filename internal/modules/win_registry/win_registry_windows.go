@@ -25,6 +25,11 @@ func (w *WinRegistry) Name() string {
 	return "windows/registry"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinRegistry) Describe() string {
+	return "Windows Registry hives"
+}
+
 // Collect copies Windows registry hives and creates a manifest.
 func (w *WinRegistry) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/registry subdirectory
@@ -34,7 +39,7 @@ func (w *WinRegistry) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
@@ -46,10 +51,10 @@ func (w *WinRegistry) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Create manifest
-	manifest := NewRegistryManifest(hostname, backupPriv, restorePriv)
+	manifest := NewRegistryManifest(ctx, hostname, backupPriv, restorePriv)
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Collect system hives
 	systemHives := GetSystemHives()
@@ -87,90 +92,83 @@ func (w *WinRegistry) Collect(ctx context.Context, outDir string) error {
 
 // collectHive attempts to collect a single registry hive using multiple methods.
 func (w *WinRegistry) collectHive(ctx context.Context, hive RegistryHive, outDir string, manifest *RegistryManifest, constraints *winutil.SizeConstraints) error {
-	destPath := filepath.Join(outDir, hive.Name+".hiv")
-
-	// Method 1: Try direct file copy with backup semantics
-	if err := w.copyHiveFile(hive.FilePath, destPath, hive.Note, manifest, constraints); err == nil {
-		return nil
+	methods := hiveMethods{
+		copy:   w.copyHiveFile,
+		export: w.exportHiveWithReg,
+		shadow: w.copyHiveFromShadow,
 	}
-
-	// Method 2: Try reg.exe export (fallback for system hives only)
-	if !hive.IsUserHive && hive.RegKey != "" {
-		if err := w.exportHiveWithReg(ctx, hive.RegKey, destPath, hive.Note, manifest, constraints); err == nil {
-			return nil
-		}
-	}
-
-	return fmt.Errorf("failed to collect hive %s using all methods", hive.Name)
+	return collectHive(ctx, methods, hive, outDir, manifest, constraints)
 }
 
 // copyHiveFile attempts direct file copy of a registry hive.
-func (w *WinRegistry) copyHiveFile(srcPath, destPath, note string, manifest *RegistryManifest, constraints *winutil.SizeConstraints) error {
+func (w *WinRegistry) copyHiveFile(ctx context.Context, srcPath, destPath string, constraints *winutil.SizeConstraints) (int64, string, error) {
 	// Check if source file exists
 	stat, err := os.Stat(srcPath)
 	if err != nil {
-		return fmt.Errorf("source hive file not accessible: %w", err)
+		return 0, "", fmt.Errorf("source hive file not accessible: %w", err)
 	}
 
 	// Check size constraints
 	if !constraints.CanCollectFile(stat.Size()) {
-		return fmt.Errorf("hive file too large (%d bytes) or would exceed total limit", stat.Size())
+		return 0, "", fmt.Errorf("hive file too large (%d bytes) or would exceed total limit", stat.Size())
 	}
 
 	// Use Windows-specific file copy with generous sharing
-	size, sha256Hex, err := winutil.CopyFile(srcPath, destPath)
+	size, sha256Hex, err := winutil.CopyFile(ctx, srcPath, destPath)
 	if err != nil {
-		return fmt.Errorf("failed to copy hive file: %w", err)
+		return 0, "", fmt.Errorf("failed to copy hive file: %w", err)
 	}
 
-	// Update constraints and manifest
-	constraints.AddFileSize(size)
-	relPath, _ := filepath.Rel(filepath.Dir(destPath), destPath)
-	manifest.AddItem(relPath, size, sha256Hex, false, note, "copy")
-
-	return nil
+	return size, sha256Hex, nil
 }
 
 // exportHiveWithReg uses reg.exe to export a registry hive.
-func (w *WinRegistry) exportHiveWithReg(ctx context.Context, regKey, destPath, note string, manifest *RegistryManifest, constraints *winutil.SizeConstraints) error {
+func (w *WinRegistry) exportHiveWithReg(ctx context.Context, regKey, destPath string, constraints *winutil.SizeConstraints) (int64, string, bool, error) {
 	// Export using reg.exe
 	if err := winutil.ExportRegistryHive(ctx, regKey, destPath); err != nil {
-		return fmt.Errorf("reg export failed: %w", err)
+		return 0, "", false, fmt.Errorf("reg export failed: %w", err)
 	}
 
 	// Get file info and compute hash
 	stat, err := os.Stat(destPath)
 	if err != nil {
-		return fmt.Errorf("failed to stat exported hive: %w", err)
+		return 0, "", false, fmt.Errorf("failed to stat exported hive: %w", err)
 	}
 
 	// Check if the exported file fits within constraints
 	if !constraints.CanCollectFile(stat.Size()) {
 		os.Remove(destPath) // Clean up
-		return fmt.Errorf("exported hive too large (%d bytes)", stat.Size())
+		return 0, "", false, fmt.Errorf("exported hive too large (%d bytes)", stat.Size())
 	}
 
 	// Compute SHA-256 (read the file we just created)
-	size, sha256Hex, truncated, err := winutil.FullCopy(destPath, destPath+".tmp")
+	size, sha256Hex, truncated, err := winutil.FullCopy(ctx, destPath, destPath+".tmp")
 	if err != nil {
-		return fmt.Errorf("failed to compute hash: %w", err)
+		return 0, "", false, fmt.Errorf("failed to compute hash: %w", err)
 	}
 	
 	// Replace original with temp file that has computed hash
 	os.Remove(destPath)
 	os.Rename(destPath+".tmp", destPath)
 
-	// Update constraints and manifest
-	constraints.AddFileSize(size)
-	relPath, _ := filepath.Rel(filepath.Dir(destPath), destPath)
-	manifest.AddItem(relPath, size, sha256Hex, truncated, note, "reg_export")
+	return size, sha256Hex, truncated, nil
+}
 
-	return nil
+// copyHiveFromShadow copies a hive from the newest existing shadow copy of
+// its volume. Shadow copies are only listed, never created, and the copy
+// reflects the hive as of that snapshot.
+func (w *WinRegistry) copyHiveFromShadow(ctx context.Context, srcPath, destPath string, constraints *winutil.SizeConstraints) (int64, string, error) {
+	shadowPath, err := winutil.LatestShadowPath(ctx, srcPath)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return w.copyHiveFile(ctx, shadowPath, destPath, constraints)
 }
 
 // collectUserHives enumerates users and collects their registry hives.
 func (w *WinRegistry) collectUserHives(ctx context.Context, outDir string, manifest *RegistryManifest, constraints *winutil.SizeConstraints) error {
-	usersDir := "C:\\Users"
+	usersDir := winutil.UsersDir()
 	
 	// Read users directory
 	entries, err := os.ReadDir(usersDir)
@@ -2,9 +2,12 @@
 package win_services_drivers
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // ServiceDriverItem represents a collected service or driver file.
@@ -36,9 +39,9 @@ type ServiceDriverManifest struct {
 }
 
 // NewServiceDriverManifest creates a new services/drivers manifest with basic information.
-func NewServiceDriverManifest(hostname string) *ServiceDriverManifest {
+func NewServiceDriverManifest(ctx context.Context, hostname string) *ServiceDriverManifest {
 	return &ServiceDriverManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]ServiceDriverItem, 0),
@@ -56,7 +59,7 @@ func (sm *ServiceDriverManifest) AddItem(path string, size int64, sha256 string,
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	sm.CollectedFiles++
@@ -19,6 +19,11 @@ func (w *WinServicesDrivers) Name() string {
 	return "windows/services_drivers"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinServicesDrivers) Describe() string {
+	return "System drivers and services"
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinServicesDrivers) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
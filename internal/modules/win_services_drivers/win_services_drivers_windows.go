@@ -25,6 +25,11 @@ func (w *WinServicesDrivers) Name() string {
 	return "windows/services_drivers"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinServicesDrivers) Describe() string {
+	return "System drivers and services"
+}
+
 // Collect copies Windows driver files and creates system info reports.
 func (w *WinServicesDrivers) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/services_drivers subdirectory
@@ -34,26 +39,19 @@ func (w *WinServicesDrivers) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewServiceDriverManifest(hostname)
+	manifest := NewServiceDriverManifest(ctx, hostname)
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Get SystemRoot path (usually C:\Windows)
-	systemRoot := os.Getenv("SystemRoot")
-	if systemRoot == "" {
-		systemDrive := os.Getenv("SystemDrive")
-		if systemDrive == "" {
-			systemDrive = "C:"
-		}
-		systemRoot = filepath.Join(systemDrive, "Windows")
-	}
+	systemRoot := winutil.SystemRoot()
 
 	// Collect driver files from System32\drivers\
 	driversDir := filepath.Join(systemRoot, "System32", "drivers")
@@ -159,7 +157,7 @@ func (w *WinServicesDrivers) collectDriverQuery(ctx context.Context, outDir stri
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash driverquery output: %w", err)
 	}
@@ -2,9 +2,13 @@
 package win_signatures
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
 )
 
 // SignatureItem represents a collected file signature-related file.
@@ -34,12 +38,13 @@ type SignatureManifest struct {
 	TotalFiles         int               `json:"total_files"`
 	CollectedFiles     int               `json:"collected_files"`
 	SignedFilesFound   int               `json:"signed_files_found"`
+	Summary            schema.Summary    `json:"summary"`
 }
 
 // NewSignatureManifest creates a new file signatures manifest with basic information.
-func NewSignatureManifest(hostname string) *SignatureManifest {
+func NewSignatureManifest(ctx context.Context, hostname string) *SignatureManifest {
 	return &SignatureManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]SignatureItem, 0),
@@ -47,6 +52,7 @@ func NewSignatureManifest(hostname string) *SignatureManifest {
 		TotalFiles:         0,
 		CollectedFiles:     0,
 		SignedFilesFound:   0,
+		Summary:            schema.NewSummary(),
 	}
 }
 
@@ -58,7 +64,7 @@ func (sm *SignatureManifest) AddItem(path string, size int64, sha256 string, tru
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	sm.CollectedFiles++
@@ -80,6 +86,7 @@ func (sm *SignatureManifest) IncrementTotalFiles() {
 // SetSignedFilesFound sets the number of signed files found.
 func (sm *SignatureManifest) SetSignedFilesFound(count int) {
 	sm.SignedFilesFound = count
+	sm.Summary.Set(schema.SummarySignedFiles, count)
 }
 
 // WriteManifest writes the manifest to a JSON file.
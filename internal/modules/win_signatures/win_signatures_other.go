@@ -19,6 +19,16 @@ func (w *WinSignatures) Name() string {
 	return "windows/signatures"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinSignatures) Describe() string {
+	return "File signatures and digital certificates"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinSignatures) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinSignatures) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
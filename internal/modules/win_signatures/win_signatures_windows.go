@@ -25,6 +25,16 @@ func (w *WinSignatures) Name() string {
 	return "windows/signatures"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinSignatures) Describe() string {
+	return "File signatures and digital certificates"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinSignatures) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers file signatures and digital certificate information.
 func (w *WinSignatures) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/signatures subdirectory
@@ -34,13 +44,13 @@ func (w *WinSignatures) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewSignatureManifest(hostname)
+	manifest := NewSignatureManifest(ctx, hostname)
 
 	// Collect file signatures
 	if err := w.collectFileSignatures(ctx, signaturesDir, manifest); err != nil {
@@ -69,10 +79,7 @@ func (w *WinSignatures) collectFileSignatures(ctx context.Context, outDir string
 	output += "Note: This scan checks digital signatures of key system executables.\n\n"
 
 	// Get system drive
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	// Key system directories to scan for signed executables
 	scanDirs := []string{
@@ -151,7 +158,7 @@ func (w *WinSignatures) collectFileSignatures(ctx context.Context, outDir string
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			note := fmt.Sprintf("File signature verification results (%d signed files found)", signedCount)
 			manifest.AddItem("file_signatures.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "signatures", note)
 			manifest.IncrementTotalFiles()
@@ -238,7 +245,7 @@ func (w *WinSignatures) collectDigitalCertificates(ctx context.Context, outDir s
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("digital_certificates.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "certificates", "Digital certificate store information")
 			manifest.IncrementTotalFiles()
 		}
@@ -0,0 +1,292 @@
+package win_srum
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/ese"
+	"cryptkeeper/internal/winutil"
+)
+
+// SRUM provider tables decoded into srum_app_timeline.json.
+const (
+	AppTimelineTable       = "{5C8CF1C7-7257-4F13-B223-970EF5939312}"
+	PushNotificationsTable = "{D10CA2FE-6FCF-4F6D-848E-B2E99266FA86}"
+	idMapTable             = "SruDbIdMapTable"
+)
+
+// SruDbIdMapTable identifier types; the others hold UTF-16 names.
+const idTypeUserSID = 3
+
+// knownTables describes SRUM tables that are recognised but not decoded here.
+var knownTables = map[string]string{
+	"{973F5D5C-1D90-4944-BE8E-24B94231A174}":   "Network Data Usage",
+	"{D10CA2FE-6FCF-4F6D-848E-B2E99266FA89}":   "Application Resource Usage",
+	"{DD6636C4-8929-4683-974E-22C046A43763}":   "Network Connectivity Usage",
+	"{FEE4E14F-02A9-4550-B5CE-5FA2DA202E37}":   "Energy Usage",
+	"{FEE4E14F-02A9-4550-B5CE-5FA2DA202E37}LT": "Energy Usage (long term)",
+	"SruDbCheckpointTable":                     "SRUM checkpoint state",
+}
+
+// timelineNamedColumns are App Timeline columns given their own field rather
+// than listed under counters.
+var timelineNamedColumns = map[string]bool{
+	"autoincid": true, "timestamp": true, "appid": true, "userid": true,
+	"endtime": true, "durationms": true,
+}
+
+// SRUMTimelineEntry is a row of the App Timeline provider table: one span of
+// an application's foreground and background activity.
+type SRUMTimelineEntry struct {
+	ID           int64            `json:"auto_inc_id"`
+	TimestampUTC string           `json:"timestamp_utc,omitempty"` // When SRUM recorded the row
+	EndTimeUTC   string           `json:"end_time_utc,omitempty"`  // End of the recorded span
+	DurationMS   int64            `json:"duration_ms"`
+	AppID        int64            `json:"app_id"`
+	App          string           `json:"app,omitempty"` // Resolved through SruDbIdMapTable
+	UserID       int64            `json:"user_id"`
+	User         string           `json:"user,omitempty"`     // SID resolved through SruDbIdMapTable
+	Counters     map[string]int64 `json:"counters,omitempty"` // Remaining integer columns, e.g. InFocusS, UserInputS, AudioOutS
+}
+
+// SRUMPushNotification is a row of the push notification provider table.
+type SRUMPushNotification struct {
+	ID               int64  `json:"auto_inc_id"`
+	TimestampUTC     string `json:"timestamp_utc,omitempty"`
+	AppID            int64  `json:"app_id"`
+	App              string `json:"app,omitempty"`
+	UserID           int64  `json:"user_id"`
+	User             string `json:"user,omitempty"`
+	NotificationType int64  `json:"notification_type"`
+	PayloadSize      int64  `json:"payload_size"`
+	NetworkType      int64  `json:"network_type"`
+}
+
+// SRUMSkippedTable is a table of the database that was not decoded.
+type SRUMSkippedTable struct {
+	Table       string `json:"table"`
+	Description string `json:"description,omitempty"`
+	Note        string `json:"note"`
+}
+
+// AppTimelineReport is the structure written to srum_app_timeline.json.
+type AppTimelineReport struct {
+	Source            string                 `json:"source"`
+	CollectedUTC      string                 `json:"collected_utc"`
+	AppTimeline       []SRUMTimelineEntry    `json:"app_timeline"`
+	PushNotifications []SRUMPushNotification `json:"push_notifications"`
+	SkippedTables     []SRUMSkippedTable     `json:"skipped_tables"`
+	Errors            []string               `json:"errors,omitempty"`
+}
+
+// ParseAppTimeline decodes the App Timeline and push notification tables of
+// a SRUM database, resolving application and user identifiers through
+// SruDbIdMapTable. A missing provider table is recorded as an error rather
+// than failing the parse, since providers vary between Windows builds.
+func ParseAppTimeline(db *ese.DB) *AppTimelineReport {
+	report := &AppTimelineReport{
+		AppTimeline:       make([]SRUMTimelineEntry, 0),
+		PushNotifications: make([]SRUMPushNotification, 0),
+		SkippedTables:     make([]SRUMSkippedTable, 0),
+	}
+
+	ids, err := readIDMap(db)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", idMapTable, err))
+	}
+
+	err = db.ForEachRow(AppTimelineTable, func(row ese.Row) error {
+		entry := SRUMTimelineEntry{
+			ID:           row.Int("AutoIncId"),
+			TimestampUTC: formatTime(row.Time("TimeStamp")),
+			EndTimeUTC:   formatTime(row.Time("EndTime")),
+			DurationMS:   row.Int("DurationMS"),
+			AppID:        row.Int("AppId"),
+			App:          ids[row.Int("AppId")],
+			UserID:       row.Int("UserId"),
+			User:         ids[row.Int("UserId")],
+		}
+		for _, column := range row.IntColumns() {
+			if timelineNamedColumns[strings.ToLower(column)] {
+				continue
+			}
+			if entry.Counters == nil {
+				entry.Counters = make(map[string]int64)
+			}
+			entry.Counters[column] = row.Int(column)
+		}
+		report.AppTimeline = append(report.AppTimeline, entry)
+		return nil
+	})
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("App Timeline: %v", err))
+	}
+
+	err = db.ForEachRow(PushNotificationsTable, func(row ese.Row) error {
+		report.PushNotifications = append(report.PushNotifications, SRUMPushNotification{
+			ID:               row.Int("AutoIncId"),
+			TimestampUTC:     formatTime(row.Time("TimeStamp")),
+			AppID:            row.Int("AppId"),
+			App:              ids[row.Int("AppId")],
+			UserID:           row.Int("UserId"),
+			User:             ids[row.Int("UserId")],
+			NotificationType: row.Int("NotificationType"),
+			PayloadSize:      row.Int("PayloadSize"),
+			NetworkType:      row.Int("NetworkType"),
+		})
+		return nil
+	})
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Push Notifications: %v", err))
+	}
+
+	for _, table := range db.Tables() {
+		if strings.HasPrefix(table, "MSys") || strings.EqualFold(table, idMapTable) ||
+			strings.EqualFold(table, AppTimelineTable) || strings.EqualFold(table, PushNotificationsTable) {
+			continue
+		}
+		skipped := SRUMSkippedTable{Table: table, Note: "unknown table; not decoded"}
+		if description, ok := knownTables[strings.ToUpper(table)]; ok {
+			skipped.Description = description
+			skipped.Note = "known SRUM table; not decoded into this report"
+		}
+		report.SkippedTables = append(report.SkippedTables, skipped)
+	}
+	sort.Slice(report.SkippedTables, func(i, j int) bool { return report.SkippedTables[i].Table < report.SkippedTables[j].Table })
+
+	return report
+}
+
+// readIDMap maps SruDbIdMapTable indexes to application names and user SIDs.
+func readIDMap(db *ese.DB) (map[int64]string, error) {
+	ids := make(map[int64]string)
+	err := db.ForEachRow(idMapTable, func(row ese.Row) error {
+		blob := row.Bytes("IdBlob")
+		if len(blob) == 0 {
+			return nil
+		}
+		if row.Int("IdType") == idTypeUserSID {
+			if sid := formatSID(blob); sid != "" {
+				ids[row.Int("IdIndex")] = sid
+			}
+			return nil
+		}
+		ids[row.Int("IdIndex")] = decodeUTF16(blob)
+		return nil
+	})
+	return ids, err
+}
+
+// WriteAppTimelineReport decodes the SRUM database at dbPath into
+// srum_app_timeline.json under outDir and records it in the manifest.
+func WriteAppTimelineReport(ctx context.Context, dbPath, outDir string, manifest *SRUMManifest) error {
+	for _, item := range manifest.Items {
+		if strings.EqualFold(item.Path, filepath.Base(dbPath)) && item.Truncated {
+			return fmt.Errorf("%s copy is truncated", item.Path)
+		}
+	}
+
+	db, err := ese.Open(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open SRUM database: %w", err)
+	}
+	defer db.Close()
+
+	report := ParseAppTimeline(db)
+	report.Source = filepath.Base(dbPath)
+	report.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+
+	outputPath := filepath.Join(outDir, "srum_app_timeline.json")
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal SRUM app timeline: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write SRUM app timeline: %w", err)
+	}
+
+	if !manifest.RemoveItem("srum_app_timeline.json") {
+		manifest.IncrementTotalFiles()
+	}
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat SRUM app timeline: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash SRUM app timeline: %w", err)
+	}
+	note := fmt.Sprintf("SRUM App Timeline and push notification rows (%d timeline, %d notifications, %d tables skipped)",
+		len(report.AppTimeline), len(report.PushNotifications), len(report.SkippedTables))
+	manifest.AddItem("srum_app_timeline.json", stat.Size(), sha256Hex, false, stat.ModTime(), "app_timeline", note)
+
+	return nil
+}
+
+// AnalyzeAppTimeline rebuilds srum_app_timeline.json from the SRUDB.dat copy
+// in a collected windows/srum directory, for the analyze command.
+func AnalyzeAppTimeline(ctx context.Context, moduleDir string) ([]string, error) {
+	srumDir := filepath.Join(moduleDir, "windows", "srum")
+	dbPath := filepath.Join(srumDir, "SRUDB.dat")
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	manifestPath := filepath.Join(srumDir, "manifest.json")
+	manifest, err := LoadSRUMManifest(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read srum manifest: %w", err)
+	}
+	if err := WriteAppTimelineReport(ctx, dbPath, srumDir, manifest); err != nil {
+		return nil, err
+	}
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return []string{"windows/srum/srum_app_timeline.json"}, fmt.Errorf("failed to write srum manifest: %w", err)
+	}
+	return []string{"windows/srum/srum_app_timeline.json", "windows/srum/manifest.json"}, nil
+}
+
+// formatTime formats a non-zero time as RFC3339 in UTC.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return winutil.FormatTime(t)
+}
+
+// formatSID formats a binary security identifier as S-1-5-21-...
+func formatSID(b []byte) string {
+	if len(b) < 8 || b[0] != 1 || len(b) < 8+4*int(b[1]) {
+		return ""
+	}
+	var authority uint64
+	for _, v := range b[2:8] {
+		authority = authority<<8 | uint64(v)
+	}
+	var sid strings.Builder
+	fmt.Fprintf(&sid, "S-%d-%d", b[0], authority)
+	for i := 0; i < int(b[1]); i++ {
+		fmt.Fprintf(&sid, "-%d", binary.LittleEndian.Uint32(b[8+4*i:]))
+	}
+	return sid.String()
+}
+
+// decodeUTF16 decodes UTF-16LE bytes, stopping at the first NUL.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
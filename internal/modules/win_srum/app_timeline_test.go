@@ -0,0 +1,178 @@
+package win_srum
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/ese"
+	"cryptkeeper/internal/ese/esetest"
+)
+
+var timelineRecorded = time.Date(2024, 2, 27, 23, 0, 0, 0, time.UTC)
+
+// utf16Bytes encodes an SruDbIdMapTable name as SRUM stores it.
+func utf16Bytes(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s + "\x00")) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+// aliceSID is S-1-5-21-1004336348-1177238915-682003330-1001 in binary form.
+var aliceSID = func() []byte {
+	b := []byte{1, 5, 0, 0, 0, 0, 0, 5}
+	for _, sub := range []uint32{21, 1004336348, 1177238915, 682003330, 1001} {
+		b = binary.LittleEndian.AppendUint32(b, sub)
+	}
+	return b
+}()
+
+// srumTables is a SRUDB.dat in which rclone ran in the background for an
+// hour and a Store app received push notifications.
+func srumTables() []esetest.Table {
+	idMap := esetest.Table{
+		Name:    idMapTable,
+		Columns: []esetest.Column{esetest.UnsignedByte("IdType"), esetest.Long("IdIndex"), esetest.LongBinary("IdBlob")},
+		Rows: []esetest.Row{
+			{"IdType": 0, "IdIndex": 412, "IdBlob": utf16Bytes(`\Device\HarddiskVolume3\Users\Public\rclone.exe`)},
+			{"IdType": 2, "IdIndex": 415, "IdBlob": utf16Bytes("Microsoft.WindowsStore_8wekyb3d8bbwe!App")},
+			{"IdType": idTypeUserSID, "IdIndex": 306, "IdBlob": aliceSID},
+			{"IdType": 0, "IdIndex": 999},
+		},
+	}
+	timeline := esetest.Table{
+		Name: AppTimelineTable,
+		Columns: []esetest.Column{
+			esetest.Long("AutoIncId"),
+			esetest.DateTime("TimeStamp"),
+			esetest.Long("AppId"),
+			esetest.Long("UserId"),
+			esetest.LongLong("EndTime"),
+			esetest.Long("DurationMS"),
+			esetest.Long("InFocusS"),
+			esetest.Long("UserInputS"),
+			esetest.Long("AudioOutS"),
+			esetest.LongLong("CpuTimeUs"),
+		},
+		Rows: []esetest.Row{
+			{
+				"AutoIncId": 7181, "TimeStamp": timelineRecorded, "AppId": 412, "UserId": 306,
+				"EndTime": esetest.Filetime(timelineRecorded.Add(-time.Minute)), "DurationMS": 3600000,
+				"InFocusS": 0, "UserInputS": 0, "CpuTimeUs": 1843200000,
+			},
+			// An app the identifier map does not know
+			{"AutoIncId": 7182, "TimeStamp": timelineRecorded, "AppId": 777, "UserId": 306, "DurationMS": 5000},
+		},
+	}
+	push := esetest.Table{
+		Name: PushNotificationsTable,
+		Columns: []esetest.Column{
+			esetest.Long("AutoIncId"), esetest.DateTime("TimeStamp"), esetest.Long("AppId"), esetest.Long("UserId"),
+			esetest.Long("NotificationType"), esetest.Long("PayloadSize"), esetest.Long("NetworkType"),
+		},
+		Rows: []esetest.Row{
+			{"AutoIncId": 33, "TimeStamp": timelineRecorded, "AppId": 415, "UserId": 306, "NotificationType": 1, "PayloadSize": 2048, "NetworkType": 71},
+		},
+	}
+	return []esetest.Table{
+		idMap, timeline, push,
+		{Name: "{973F5D5C-1D90-4944-BE8E-24B94231A174}", Columns: []esetest.Column{esetest.Long("AutoIncId")}},
+		{Name: "{7ACBBAA3-D029-4BE4-9A7A-0885927F1D8F}", Columns: []esetest.Column{esetest.Long("AutoIncId")}},
+	}
+}
+
+func TestParseAppTimeline(t *testing.T) {
+	db, err := ese.Open(esetest.WriteFile(t, "SRUDB.dat", srumTables()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	report := ParseAppTimeline(db)
+	if len(report.Errors) != 0 {
+		t.Fatalf("errors = %v", report.Errors)
+	}
+
+	want := []SRUMTimelineEntry{
+		{
+			ID:           7181,
+			TimestampUTC: "2024-02-27T23:00:00Z",
+			EndTimeUTC:   "2024-02-27T22:59:00Z",
+			DurationMS:   3600000,
+			AppID:        412,
+			App:          `\Device\HarddiskVolume3\Users\Public\rclone.exe`,
+			UserID:       306,
+			User:         "S-1-5-21-1004336348-1177238915-682003330-1001",
+			Counters:     map[string]int64{"InFocusS": 0, "UserInputS": 0, "CpuTimeUs": 1843200000},
+		},
+		{ID: 7182, TimestampUTC: "2024-02-27T23:00:00Z", DurationMS: 5000, AppID: 777, UserID: 306, User: "S-1-5-21-1004336348-1177238915-682003330-1001"},
+	}
+	if !reflect.DeepEqual(report.AppTimeline, want) {
+		t.Fatalf("app timeline = %+v\nwant %+v", report.AppTimeline, want)
+	}
+
+	wantPush := []SRUMPushNotification{{
+		ID: 33, TimestampUTC: "2024-02-27T23:00:00Z", AppID: 415, App: "Microsoft.WindowsStore_8wekyb3d8bbwe!App",
+		UserID: 306, User: "S-1-5-21-1004336348-1177238915-682003330-1001", NotificationType: 1, PayloadSize: 2048, NetworkType: 71,
+	}}
+	if !reflect.DeepEqual(report.PushNotifications, wantPush) {
+		t.Fatalf("push notifications = %+v", report.PushNotifications)
+	}
+
+	wantSkipped := []SRUMSkippedTable{
+		{Table: "{7ACBBAA3-D029-4BE4-9A7A-0885927F1D8F}", Note: "unknown table; not decoded"},
+		{Table: "{973F5D5C-1D90-4944-BE8E-24B94231A174}", Description: "Network Data Usage", Note: "known SRUM table; not decoded into this report"},
+	}
+	if !reflect.DeepEqual(report.SkippedTables, wantSkipped) {
+		t.Fatalf("skipped tables = %+v", report.SkippedTables)
+	}
+}
+
+func TestParseAppTimelineWithoutProviderTables(t *testing.T) {
+	// A build without the App Timeline provider still reports the rest
+	db, err := ese.Open(esetest.WriteFile(t, "SRUDB.dat", srumTables()[0], srumTables()[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	report := ParseAppTimeline(db)
+	if len(report.AppTimeline) != 0 || len(report.PushNotifications) != 1 || len(report.Errors) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestWriteAppTimelineReport(t *testing.T) {
+	dbPath := esetest.WriteFile(t, "SRUDB.dat", srumTables()...)
+	outDir := t.TempDir()
+	manifest := NewSRUMManifest(context.Background(), "WS-0142")
+	if err := WriteAppTimelineReport(context.Background(), dbPath, outDir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "srum_app_timeline.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report AppTimelineReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Source != "SRUDB.dat" || len(report.AppTimeline) != 2 || report.AppTimeline[0].App != `\Device\HarddiskVolume3\Users\Public\rclone.exe` {
+		t.Fatalf("report = %+v", report)
+	}
+	if len(manifest.Items) != 1 || manifest.Items[0].Path != "srum_app_timeline.json" {
+		t.Fatalf("manifest items = %+v", manifest.Items)
+	}
+
+	// A truncated copy of the database is not decoded
+	manifest.AddItem("SRUDB.dat", 4096, "", true, time.Time{}, "srum_db", "")
+	if err := WriteAppTimelineReport(context.Background(), dbPath, outDir, manifest); err == nil {
+		t.Fatal("truncated SRUDB.dat decoded")
+	}
+}
@@ -2,9 +2,12 @@
 package win_srum
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // SRUMItem represents a collected SRUM database file.
@@ -36,9 +39,9 @@ type SRUMManifest struct {
 }
 
 // NewSRUMManifest creates a new SRUM manifest with basic information.
-func NewSRUMManifest(hostname string) *SRUMManifest {
+func NewSRUMManifest(ctx context.Context, hostname string) *SRUMManifest {
 	return &SRUMManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]SRUMItem, 0),
@@ -56,12 +59,27 @@ func (sm *SRUMManifest) AddItem(path string, size int64, sha256 string, truncate
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	sm.CollectedFiles++
 }
 
+// RemoveItem drops any entry for path, so a rewritten file is listed once.
+// It reports whether an entry was removed.
+func (sm *SRUMManifest) RemoveItem(path string) bool {
+	items := sm.Items[:0]
+	for _, item := range sm.Items {
+		if item.Path != path {
+			items = append(items, item)
+		}
+	}
+	removed := len(sm.Items) - len(items)
+	sm.Items = items
+	sm.CollectedFiles -= removed
+	return removed > 0
+}
+
 // AddError adds an error to the manifest for a failed collection.
 func (sm *SRUMManifest) AddError(target, errorMsg string) {
 	sm.Errors = append(sm.Errors, SRUMError{
@@ -83,4 +101,17 @@ func (sm *SRUMManifest) WriteManifest(manifestPath string) error {
 	}
 
 	return os.WriteFile(manifestPath, data, 0644)
-}
\ No newline at end of file
+}
+
+// LoadSRUMManifest reads a manifest written by WriteManifest.
+func LoadSRUMManifest(manifestPath string) (*SRUMManifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var sm SRUMManifest
+	if err := json.Unmarshal(data, &sm); err != nil {
+		return nil, err
+	}
+	return &sm, nil
+}
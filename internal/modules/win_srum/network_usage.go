@@ -0,0 +1,314 @@
+package win_srum
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+const (
+	// highEgressBytes flags any application that sent at least this much in the window.
+	highEgressBytes = 100 * 1024 * 1024
+
+	// nonBrowserEgressBytes flags non-browser applications with notable egress.
+	nonBrowserEgressBytes = 10 * 1024 * 1024
+)
+
+// browserExecutables lists processes whose large egress is expected.
+var browserExecutables = map[string]bool{
+	"chrome.exe":   true,
+	"msedge.exe":   true,
+	"firefox.exe":  true,
+	"iexplore.exe": true,
+	"brave.exe":    true,
+	"opera.exe":    true,
+	"vivaldi.exe":  true,
+}
+
+// SRUMNetworkRecord is a single row from the SRUM Network Data Usage table.
+type SRUMNetworkRecord struct {
+	App       string
+	User      string
+	Timestamp time.Time // UTC
+	RawTime   string    // Timestamp as exported
+	BytesSent uint64
+	BytesRecv uint64
+}
+
+// AppNetworkUsage is the per-application aggregate written to network_usage.json.
+type AppNetworkUsage struct {
+	App       string   `json:"app"`
+	Users     []string `json:"users,omitempty"`
+	BytesSent uint64   `json:"bytes_sent"`
+	BytesRecv uint64   `json:"bytes_received"`
+	Records   int      `json:"records"`
+	FirstSeen string   `json:"first_seen_utc,omitempty"`
+	LastSeen  string   `json:"last_seen_utc,omitempty"`
+	FirstRaw  string   `json:"first_seen_raw,omitempty"` // As exported, before UTC normalization
+	LastRaw   string   `json:"last_seen_raw,omitempty"`
+	Flags     []string `json:"flags,omitempty"`
+}
+
+// NetworkUsageReport is the structure written to network_usage.json.
+type NetworkUsageReport struct {
+	CreatedUTC   string            `json:"created_utc"`
+	WindowStart  string            `json:"window_start_utc,omitempty"`
+	WindowEnd    string            `json:"window_end_utc,omitempty"`
+	Source       string            `json:"source"`
+	SourceZone   string            `json:"source_timezone,omitempty"` // Zone applied to export times without an offset
+	TotalRecords int               `json:"total_records"`
+	Applications []AppNetworkUsage `json:"applications"`
+	FlaggedApps  int               `json:"flagged_apps"`
+}
+
+// srumTimeLayouts are the timestamp formats emitted by SRUM exports.
+var srumTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"1/2/2006 3:04:05 PM",
+	"1/2/2006 15:04",
+	"01/02/2006 15:04:05",
+}
+
+// ParseSRUMNetworkCSV extracts Network Data Usage rows from a SRUM CSV export
+// (e.g. powercfg /srumutil /csv). Columns are located by header name so rows from
+// other SRUM tables, which lack byte counters, are skipped. Timestamps without
+// a UTC offset are interpreted in loc, the zone of the host that exported them.
+func ParseSRUMNetworkCSV(r io.Reader, loc *time.Location) ([]SRUMNetworkRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	records := make([]SRUMNetworkRecord, 0)
+	var cols map[string]int
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return records, fmt.Errorf("failed to read SRUM CSV: %w", err)
+		}
+
+		// A header row may appear at the top of each exported table
+		if header := srumHeaderColumns(row); header != nil {
+			cols = header
+			continue
+		}
+		if cols == nil {
+			continue
+		}
+
+		sentIdx, hasSent := cols["sent"]
+		recvIdx, hasRecv := cols["recv"]
+		if !hasSent || !hasRecv || sentIdx >= len(row) || recvIdx >= len(row) {
+			continue
+		}
+
+		sent, err1 := strconv.ParseUint(strings.TrimSpace(row[sentIdx]), 10, 64)
+		recv, err2 := strconv.ParseUint(strings.TrimSpace(row[recvIdx]), 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		rec := SRUMNetworkRecord{BytesSent: sent, BytesRecv: recv}
+		if idx, ok := cols["app"]; ok && idx < len(row) {
+			rec.App = strings.TrimSpace(row[idx])
+		}
+		if idx, ok := cols["user"]; ok && idx < len(row) {
+			rec.User = strings.TrimSpace(row[idx])
+		}
+		if idx, ok := cols["time"]; ok && idx < len(row) {
+			rec.RawTime = strings.TrimSpace(row[idx])
+			rec.Timestamp = parseSRUMTime(rec.RawTime, loc)
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// srumHeaderColumns maps well-known SRUM column names to indexes, or returns nil
+// if the row is not a header.
+func srumHeaderColumns(row []string) map[string]int {
+	cols := make(map[string]int)
+	for i, name := range row {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+		case "appid", "app", "application", "exeinfo", "app name":
+			cols["app"] = i
+		case "userid", "user", "usersid", "user sid":
+			cols["user"] = i
+		case "timestamp", "time", "time stamp":
+			cols["time"] = i
+		case "bytessent", "bytes sent":
+			cols["sent"] = i
+		case "bytesrecvd", "bytesreceived", "bytes received", "bytes recvd":
+			cols["recv"] = i
+		}
+	}
+	if _, ok := cols["app"]; !ok {
+		return nil
+	}
+	if _, ok := cols["time"]; !ok {
+		return nil
+	}
+	return cols
+}
+
+// parseSRUMTime parses a SRUM timestamp into UTC, returning the zero time if
+// unrecognized. powercfg exports local times, so zone-less layouts use loc.
+func parseSRUMTime(s string, loc *time.Location) time.Time {
+	for _, layout := range srumTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// AggregateNetworkUsage totals SRUM network records per application within the
+// [since, until] window (zero values leave that side open) and flags high-volume
+// or unusual senders.
+func AggregateNetworkUsage(records []SRUMNetworkRecord, since, until time.Time) []AppNetworkUsage {
+	type accumulator struct {
+		usage AppNetworkUsage
+		users map[string]bool
+		first time.Time
+		last  time.Time
+		// Exported values of first and last
+		firstRaw string
+		lastRaw  string
+	}
+
+	byApp := make(map[string]*accumulator)
+	for _, rec := range records {
+		if !rec.Timestamp.IsZero() {
+			if !since.IsZero() && rec.Timestamp.Before(since) {
+				continue
+			}
+			if !until.IsZero() && rec.Timestamp.After(until) {
+				continue
+			}
+		}
+
+		app := rec.App
+		if app == "" {
+			app = "unknown"
+		}
+		key := strings.ToLower(app)
+		acc, ok := byApp[key]
+		if !ok {
+			acc = &accumulator{usage: AppNetworkUsage{App: app}, users: make(map[string]bool)}
+			byApp[key] = acc
+		}
+
+		acc.usage.BytesSent += rec.BytesSent
+		acc.usage.BytesRecv += rec.BytesRecv
+		acc.usage.Records++
+		if rec.User != "" {
+			acc.users[rec.User] = true
+		}
+		if !rec.Timestamp.IsZero() {
+			if acc.first.IsZero() || rec.Timestamp.Before(acc.first) {
+				acc.first = rec.Timestamp
+				acc.firstRaw = rec.RawTime
+			}
+			if rec.Timestamp.After(acc.last) {
+				acc.last = rec.Timestamp
+				acc.lastRaw = rec.RawTime
+			}
+		}
+	}
+
+	usages := make([]AppNetworkUsage, 0, len(byApp))
+	for _, acc := range byApp {
+		usage := acc.usage
+		for user := range acc.users {
+			usage.Users = append(usage.Users, user)
+		}
+		sort.Strings(usage.Users)
+		if !acc.first.IsZero() {
+			usage.FirstSeen = winutil.FormatTime(acc.first)
+			usage.LastSeen = winutil.FormatTime(acc.last)
+			usage.FirstRaw = acc.firstRaw
+			usage.LastRaw = acc.lastRaw
+		}
+		usage.Flags = flagNetworkUsage(usage)
+		usages = append(usages, usage)
+	}
+
+	// Largest senders first
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].BytesSent != usages[j].BytesSent {
+			return usages[i].BytesSent > usages[j].BytesSent
+		}
+		return usages[i].App < usages[j].App
+	})
+
+	return usages
+}
+
+// flagNetworkUsage returns the indicators for an application's network usage.
+func flagNetworkUsage(usage AppNetworkUsage) []string {
+	var flags []string
+	browser := isBrowserApp(usage.App)
+
+	if usage.BytesSent >= highEgressBytes {
+		flags = append(flags, "high_egress")
+	}
+	if !browser && usage.BytesSent >= nonBrowserEgressBytes {
+		flags = append(flags, "non_browser_egress")
+		if usage.BytesSent > usage.BytesRecv {
+			flags = append(flags, "egress_exceeds_ingress")
+		}
+	}
+
+	return flags
+}
+
+// isBrowserApp reports whether a SRUM app identifier refers to a web browser.
+func isBrowserApp(app string) bool {
+	// SRUM app identifiers are often full device paths
+	name := strings.ToLower(filepath.Base(strings.ReplaceAll(app, "\\", "/")))
+	return browserExecutables[name]
+}
+
+// BuildNetworkUsageReport parses a SRUM CSV export and aggregates it into a
+// report. loc is the exporting host's zone, applied to times without an offset.
+func BuildNetworkUsageReport(csvData []byte, source string, loc *time.Location, since, until, now time.Time) (*NetworkUsageReport, error) {
+	records, err := ParseSRUMNetworkCSV(bytes.NewReader(csvData), loc)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &NetworkUsageReport{
+		CreatedUTC:   winutil.FormatTime(now),
+		Source:       source,
+		SourceZone:   now.In(loc).Format("MST -07:00"),
+		TotalRecords: len(records),
+		Applications: AggregateNetworkUsage(records, since, until),
+	}
+	if !since.IsZero() {
+		report.WindowStart = winutil.FormatTime(since)
+	}
+	if !until.IsZero() {
+		report.WindowEnd = winutil.FormatTime(until)
+	}
+	for _, app := range report.Applications {
+		if len(app.Flags) > 0 {
+			report.FlaggedApps++
+		}
+	}
+
+	return report, nil
+}
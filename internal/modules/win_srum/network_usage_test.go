@@ -0,0 +1,111 @@
+package win_srum
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mb = 1024 * 1024
+
+// syntheticSRUMExport is a powercfg /srumutil /csv export with an application
+// table (no byte counters) followed by the Network Data Usage table.
+const syntheticSRUMExport = "\ufeffAppId,UserId,TimeStamp,ForegroundCycleTime\r\n" +
+	`\Device\HarddiskVolume3\Windows\explorer.exe,S-1-5-21-1-1001,2024-02-27 09:00:00,123456` + "\r\n" +
+	"\r\n" +
+	"AppId,UserId,TimeStamp,InterfaceLuid,L2ProfileId,BytesSent,BytesRecvd\r\n" +
+	// A browser with heavy uploads is high volume but expected
+	`\Device\HarddiskVolume3\Program Files\Google\Chrome\Application\chrome.exe,S-1-5-21-1-1001,2024-02-27 10:00:00,1689399632855040,0,62914560,524288000` + "\r\n" +
+	`\Device\HarddiskVolume3\Program Files\Google\Chrome\Application\chrome.exe,S-1-5-21-1-1001,2024-02-27 11:00:00,1689399632855040,0,62914560,104857600` + "\r\n" +
+	// rclone exfiltration split across two users and three hours
+	`\Device\HarddiskVolume3\Users\Public\rclone.exe,S-1-5-21-1-1001,2024-02-27 23:00:00,1689399632855040,0,73400320,1048576` + "\r\n" +
+	`\Device\HarddiskVolume3\Users\Public\RCLONE.EXE,S-1-5-18,2024-02-28 00:00:00,1689399632855040,0,41943040,1048576` + "\r\n" +
+	`\Device\HarddiskVolume3\Users\Public\rclone.exe,S-1-5-21-1-1001,2024-02-28 01:00:00,1689399632855040,0,2097152,0` + "\r\n" +
+	// Outside the window
+	`\Device\HarddiskVolume3\Users\Public\rclone.exe,S-1-5-21-1-1001,2024-03-05 01:00:00,1689399632855040,0,943718400,0` + "\r\n" +
+	// Small non-browser traffic and a download-heavy updater
+	`\Device\HarddiskVolume3\Windows\System32\svchost.exe,S-1-5-19,2024-02-27 12:00:00,1689399632855040,0,1048576,2097152` + "\r\n" +
+	`\Device\HarddiskVolume3\Program Files\Microsoft OneDrive\OneDrive.exe,S-1-5-21-1-1001,2024-02-27 13:00:00,1689399632855040,0,20971520,209715200` + "\r\n" +
+	// Unparseable counters are skipped
+	`\Device\HarddiskVolume3\Windows\System32\svchost.exe,S-1-5-19,2024-02-27 14:00:00,1689399632855040,0,n/a,0` + "\r\n"
+
+func TestNetworkUsageTotalsAndFlags(t *testing.T) {
+	now := time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)
+	since := time.Date(2024, 2, 27, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	report, err := BuildNetworkUsageReport([]byte(syntheticSRUMExport), "srum_network.csv", time.UTC, since, until, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalRecords != 8 || report.WindowStart != "2024-02-27T00:00:00Z" || report.WindowEnd != "2024-03-01T00:00:00Z" {
+		t.Fatalf("report = %+v", report)
+	}
+
+	want := []struct {
+		name       string
+		sent, recv uint64
+		records    int
+		users      []string
+		flags      []string
+	}{
+		{"chrome.exe", 120 * mb, 600 * mb, 2, []string{"S-1-5-21-1-1001"}, []string{"high_egress"}},
+		{"rclone.exe", 112 * mb, 2 * mb, 3, []string{"S-1-5-18", "S-1-5-21-1-1001"}, []string{"high_egress", "non_browser_egress", "egress_exceeds_ingress"}},
+		{"OneDrive.exe", 20 * mb, 200 * mb, 1, []string{"S-1-5-21-1-1001"}, []string{"non_browser_egress"}},
+		{"svchost.exe", 1 * mb, 2 * mb, 1, []string{"S-1-5-19"}, nil},
+	}
+	// Largest senders first
+	apps := report.Applications
+	if len(apps) != len(want) {
+		t.Fatalf("%d applications, want %d", len(apps), len(want))
+	}
+	for i, w := range want {
+		app := apps[i]
+		if !strings.HasSuffix(strings.ToLower(app.App), strings.ToLower(w.name)) {
+			t.Errorf("application %d = %s, want %s", i, app.App, w.name)
+			continue
+		}
+		if app.BytesSent != w.sent || app.BytesRecv != w.recv || app.Records != w.records {
+			t.Errorf("%s totals = %d sent, %d received in %d records; want %d, %d in %d", w.name, app.BytesSent, app.BytesRecv, app.Records, w.sent, w.recv, w.records)
+		}
+		if !reflect.DeepEqual(app.Users, w.users) {
+			t.Errorf("%s users = %v, want %v", w.name, app.Users, w.users)
+		}
+		if !reflect.DeepEqual(app.Flags, w.flags) {
+			t.Errorf("%s flags = %v, want %v", w.name, app.Flags, w.flags)
+		}
+	}
+	if rclone := apps[1]; rclone.FirstSeen != "2024-02-27T23:00:00Z" || rclone.LastSeen != "2024-02-28T01:00:00Z" || rclone.LastRaw != "2024-02-28 01:00:00" {
+		t.Errorf("rclone seen %s to %s", rclone.FirstSeen, rclone.LastSeen)
+	}
+	if report.FlaggedApps != 3 {
+		t.Errorf("flagged %d applications, want 3", report.FlaggedApps)
+	}
+}
+
+func TestNetworkUsageAppliesExportZone(t *testing.T) {
+	zone := time.FixedZone("EST", -5*3600)
+	csv := "AppId,TimeStamp,BytesSent,BytesRecvd\r\n" +
+		`C:\Tools\nc.exe,2024-02-27 20:30:00,100,0` + "\r\n" +
+		`C:\Tools\nc.exe,2024-02-28T03:00:00+02:00,100,0` + "\r\n"
+	records, err := ParseSRUMNetworkCSV(strings.NewReader(csv), zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("parsed %d records", len(records))
+	}
+	// Local export times move to UTC; times with an offset keep theirs
+	if got := records[0].Timestamp; !got.Equal(time.Date(2024, 2, 28, 1, 30, 0, 0, time.UTC)) {
+		t.Errorf("zone-less time = %s", got)
+	}
+	if got := records[1].Timestamp; !got.Equal(time.Date(2024, 2, 28, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("offset time = %s", got)
+	}
+
+	// The window is applied in UTC: only the first record is after 01:15
+	usage := AggregateNetworkUsage(records, time.Date(2024, 2, 28, 1, 15, 0, 0, time.UTC), time.Time{})
+	if len(usage) != 1 || usage[0].Records != 1 || usage[0].BytesSent != 100 {
+		t.Fatalf("usage = %+v", usage)
+	}
+}
@@ -14,11 +14,31 @@ func NewWinSRUM() *WinSRUM {
 	return &WinSRUM{}
 }
 
+// SetCorrelate is a no-op on non-Windows systems.
+func (w *WinSRUM) SetCorrelate(enabled bool) {
+	// No-op on non-Windows systems
+}
+
+// SetParse is a no-op on non-Windows systems.
+func (w *WinSRUM) SetParse(enabled bool) {
+	// No-op on non-Windows systems
+}
+
+// SetWindow is a no-op on non-Windows systems.
+func (w *WinSRUM) SetWindow(sinceRFC3339, untilRFC3339 string) {
+	// No-op on non-Windows systems
+}
+
 // Name returns the module's identifier.
 func (w *WinSRUM) Name() string {
 	return "windows/srum"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinSRUM) Describe() string {
+	return "System Resource Usage Monitor"
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinSRUM) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
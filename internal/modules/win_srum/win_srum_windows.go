@@ -4,27 +4,59 @@ package win_srum
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"cryptkeeper/internal/winutil"
 )
 
 // WinSRUM represents the Windows SRUM collection module.
-type WinSRUM struct{}
+type WinSRUM struct {
+	correlate bool      // Produce network_usage.json from the SRUM export
+	parse     bool      // Decode the collected SRUDB.dat into srum_app_timeline.json
+	since     time.Time // Start of the aggregation window (zero = open)
+	until     time.Time // End of the aggregation window (zero = open)
+}
 
 // NewWinSRUM creates a new Windows SRUM collection module.
 func NewWinSRUM() *WinSRUM {
 	return &WinSRUM{}
 }
 
+// SetCorrelate enables the per-application network usage report.
+func (w *WinSRUM) SetCorrelate(enabled bool) {
+	w.correlate = enabled
+}
+
+// SetParse enables decoding of the App Timeline and push notification tables.
+func (w *WinSRUM) SetParse(enabled bool) {
+	w.parse = enabled
+}
+
+// SetWindow configures the aggregation window from RFC3339 bounds (empty = open).
+func (w *WinSRUM) SetWindow(sinceRFC3339, untilRFC3339 string) {
+	if t, err := time.Parse(time.RFC3339, sinceRFC3339); err == nil {
+		w.since = t.UTC()
+	}
+	if t, err := time.Parse(time.RFC3339, untilRFC3339); err == nil {
+		w.until = t.UTC()
+	}
+}
+
 // Name returns the module's identifier.
 func (w *WinSRUM) Name() string {
 	return "windows/srum"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinSRUM) Describe() string {
+	return "System Resource Usage Monitor"
+}
+
 // Collect copies Windows SRUM database files and creates a manifest.
 func (w *WinSRUM) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/srum subdirectory
@@ -34,22 +66,19 @@ func (w *WinSRUM) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewSRUMManifest(hostname)
+	manifest := NewSRUMManifest(ctx, hostname)
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Get system paths
-	systemRoot := os.Getenv("SystemRoot")
-	if systemRoot == "" {
-		systemRoot = "C:\\Windows"
-	}
+	systemRoot := winutil.SystemRoot()
 
 	// Collect SRUM database files from System32\sru\
 	srumSourceDir := filepath.Join(systemRoot, "System32", "sru")
@@ -57,6 +86,20 @@ func (w *WinSRUM) Collect(ctx context.Context, outDir string) error {
 		manifest.AddError("srum_directory", fmt.Sprintf("Failed to collect SRUM files: %v", err))
 	}
 
+	// Build per-application network totals from the SRUM export
+	if w.correlate {
+		if err := w.collectNetworkUsage(ctx, srumDir, manifest); err != nil {
+			manifest.AddError("network_usage", fmt.Sprintf("Failed to build network usage report: %v", err))
+		}
+	}
+
+	// Decode the App Timeline from the collected copy; the live database stays locked
+	if w.parse {
+		if err := WriteAppTimelineReport(ctx, filepath.Join(srumDir, "SRUDB.dat"), srumDir, manifest); err != nil {
+			manifest.AddError("app_timeline", fmt.Sprintf("Failed to parse SRUM app timeline: %v", err))
+		}
+	}
+
 	// Write manifest
 	manifestPath := filepath.Join(srumDir, "manifest.json")
 	if err := manifest.WriteManifest(manifestPath); err != nil {
@@ -148,4 +191,49 @@ func (w *WinSRUM) classifyFile(filename string) (fileType, note string) {
 		}
 		return "database", fmt.Sprintf("SRUM database file (%s)", filename)
 	}
-}
\ No newline at end of file
+}
+
+// collectNetworkUsage exports SRUM via powercfg and aggregates network bytes per application.
+func (w *WinSRUM) collectNetworkUsage(ctx context.Context, outDir string, manifest *SRUMManifest) error {
+	exportPath := filepath.Join(outDir, "srumutil_export.csv")
+	if _, err := winutil.RunCommandWithOutput(ctx, "powercfg", []string{"/srumutil", "/output", exportPath, "/csv"}); err != nil {
+		return fmt.Errorf("powercfg /srumutil export failed: %w", err)
+	}
+
+	// Keep the raw export alongside the report for reproducibility
+	manifest.IncrementTotalFiles()
+	if stat, err := os.Stat(exportPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, exportPath); err == nil {
+			manifest.AddItem("srumutil_export.csv", stat.Size(), sha256Hex, false, stat.ModTime(), "export", "SRUM CSV export from powercfg /srumutil")
+		}
+	}
+
+	data, err := os.ReadFile(exportPath)
+	if err != nil {
+		return fmt.Errorf("failed to read SRUM export: %w", err)
+	}
+
+	report, err := BuildNetworkUsageReport(data, "powercfg /srumutil", time.Local, w.since, w.until, winutil.Now(ctx))
+	if err != nil {
+		return err
+	}
+
+	outputPath := filepath.Join(outDir, "network_usage.json")
+	reportData, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal network usage report: %w", err)
+	}
+	if err := os.WriteFile(outputPath, reportData, 0644); err != nil {
+		return fmt.Errorf("failed to write network usage report: %w", err)
+	}
+
+	manifest.IncrementTotalFiles()
+	if stat, err := os.Stat(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
+			note := fmt.Sprintf("Per-application SRUM network totals (%d apps, %d flagged)", len(report.Applications), report.FlaggedApps)
+			manifest.AddItem("network_usage.json", stat.Size(), sha256Hex, false, stat.ModTime(), "network_usage", note)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package win_systemconfig
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// set is a cmd.exe builtin rather than an executable, so the process
+// environment is listed through the command interpreter.
+const environmentCommand = "cmd"
+
+var environmentArgs = []string{"/c", "set"}
+
+// runCommand runs the environment listing; tests replace it.
+var runCommand = winutil.RunCommandWithOutput
+
+// Registry keys holding the persistent environment. The machine key is
+// relative to a control set; the user key to an NTUSER.DAT root.
+const (
+	machineEnvironmentKey = `Control\Session Manager\Environment`
+	userEnvironmentKey    = "Environment"
+)
+
+// EnvironmentVariable is a persistent environment variable from the registry.
+type EnvironmentVariable struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"` // REG_SZ, or REG_EXPAND_SZ for values with unexpanded %references%
+	Value string `json:"value"`
+}
+
+// EnvironmentScope is the persistent environment of the machine or one user.
+type EnvironmentScope struct {
+	Scope          string                `json:"scope"`  // "machine" or "user:<name>"
+	Source         string                `json:"source"` // "reg_query" or "hive"
+	KeyPath        string                `json:"key_path"`
+	KeyLastWritten string                `json:"key_last_written,omitempty"` // Hive source only
+	Variables      []EnvironmentVariable `json:"variables"`
+	Error          string                `json:"error,omitempty"`
+}
+
+// EnvironmentReport is the structure written to environment_registry.json.
+type EnvironmentReport struct {
+	CollectedUTC string             `json:"collected_utc"`
+	Scopes       []EnvironmentScope `json:"scopes"`
+	Errors       []string           `json:"errors,omitempty"`
+}
+
+// registryTypeNames maps hive value types to the names reg.exe prints.
+var registryTypeNames = map[uint32]string{
+	regf.TypeNone:      "REG_NONE",
+	regf.TypeString:    "REG_SZ",
+	regf.TypeExpandStr: "REG_EXPAND_SZ",
+	regf.TypeBinary:    "REG_BINARY",
+	regf.TypeDWORD:     "REG_DWORD",
+	regf.TypeMultiStr:  "REG_MULTI_SZ",
+	regf.TypeQWORD:     "REG_QWORD",
+}
+
+// writeProcessEnvironment writes the output of cmd /c set to
+// environment_variables.txt and records it in the manifest.
+func writeProcessEnvironment(ctx context.Context, outDir string, manifest *SystemConfigManifest) error {
+	outputPath := filepath.Join(outDir, "environment_variables.txt")
+
+	// Run set through cmd.exe to get the process environment variables
+	output, err := runCommand(ctx, environmentCommand, environmentArgs)
+	if err != nil {
+		return fmt.Errorf("failed to run cmd /c set: %w", err)
+	}
+
+	// Write output to file
+	if err := os.WriteFile(outputPath, output, 0644); err != nil {
+		return fmt.Errorf("failed to write environment variables output: %w", err)
+	}
+
+	// Get file info and add to manifest
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat environment variables output: %w", err)
+	}
+
+	// Calculate hash of the output file
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash environment variables output: %w", err)
+	}
+
+	manifest.AddItem("environment_variables.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "environment", "Process environment variables from cmd /c set")
+	manifest.IncrementTotalFiles()
+
+	return nil
+}
+
+// EnvironmentFromRegQuery returns the variables of the first key in parsed
+// reg query output.
+func EnvironmentFromRegQuery(keys []winutil.RegKey) []EnvironmentVariable {
+	variables := make([]EnvironmentVariable, 0)
+	if len(keys) == 0 {
+		return variables
+	}
+	for _, value := range keys[0].Values {
+		variables = append(variables, EnvironmentVariable{Name: value.Name, Type: value.Type, Value: value.Data})
+	}
+	return variables
+}
+
+// EnvironmentFromHive reads the variables of an Environment key in a hive.
+func EnvironmentFromHive(hive *regf.Hive, keyPath string) (EnvironmentScope, error) {
+	scope := EnvironmentScope{Source: "hive", KeyPath: keyPath, Variables: make([]EnvironmentVariable, 0)}
+	key, err := hive.OpenKey(keyPath)
+	if err != nil {
+		return scope, err
+	}
+	if !key.LastWritten.IsZero() {
+		scope.KeyLastWritten = winutil.FormatTime(key.LastWritten)
+	}
+	values, err := key.Values()
+	if err != nil {
+		return scope, err
+	}
+	for _, value := range values {
+		typeName, ok := registryTypeNames[value.Type]
+		if !ok {
+			typeName = fmt.Sprintf("REG_TYPE_%d", value.Type)
+		}
+		// Render data the way reg query prints it
+		data := value.String()
+		if n, ok := value.Uint64(); ok {
+			data = fmt.Sprintf("0x%x", n)
+		} else if value.Type == regf.TypeMultiStr {
+			data = strings.Join(value.Strings(), `\0`)
+		} else if value.Type == regf.TypeBinary || value.Type == regf.TypeNone {
+			data = strings.ToUpper(hex.EncodeToString(value.Data))
+		}
+		scope.Variables = append(scope.Variables, EnvironmentVariable{Name: value.Name, Type: typeName, Value: data})
+	}
+	return scope, nil
+}
+
+// currentControlSet returns the ControlSet00N key name that Select\Current
+// points at; a hive file has no CurrentControlSet link.
+func currentControlSet(hive *regf.Hive) (string, error) {
+	key, err := hive.OpenKey("Select")
+	if err != nil {
+		return "", fmt.Errorf("failed to open Select key: %w", err)
+	}
+	value, err := key.Value("Current")
+	if err != nil {
+		return "", fmt.Errorf("failed to read Select\\Current: %w", err)
+	}
+	current, ok := value.Uint64()
+	if !ok || current == 0 {
+		return "", fmt.Errorf("invalid Select\\Current value")
+	}
+	return fmt.Sprintf("ControlSet%03d", current), nil
+}
@@ -0,0 +1,96 @@
+package win_systemconfig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+)
+
+func TestProcessEnvironmentRunsSetThroughCmd(t *testing.T) {
+	const output = "ComSpec=C:\\Windows\\system32\\cmd.exe\r\nPath=C:\\Windows\\system32;C:\\Windows\r\nUSERNAME=alice\r\n"
+	var commands [][]string
+	saved := runCommand
+	runCommand = func(ctx context.Context, name string, args []string) ([]byte, error) {
+		commands = append(commands, append([]string{name}, args...))
+		return []byte(output), nil
+	}
+	t.Cleanup(func() { runCommand = saved })
+
+	dir := t.TempDir()
+	manifest := NewSystemConfigManifest(context.Background(), "host")
+	if err := writeProcessEnvironment(context.Background(), dir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	// set is a builtin of the interpreter, not a program of its own
+	if want := [][]string{{"cmd", "/c", "set"}}; !reflect.DeepEqual(commands, want) {
+		t.Fatalf("commands = %v, want %v", commands, want)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "environment_variables.txt"))
+	if err != nil || string(data) != output {
+		t.Fatalf("environment_variables.txt = %q, %v", data, err)
+	}
+	if len(manifest.Items) != 1 || manifest.Items[0].Size != int64(len(output)) || manifest.Items[0].FileType != "environment" || manifest.TotalFiles != 1 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+
+	// A failed command leaves no empty file behind
+	runCommand = func(ctx context.Context, name string, args []string) ([]byte, error) {
+		return nil, errors.New("exec: \"cmd\": executable file not found")
+	}
+	dir = t.TempDir()
+	if err := writeProcessEnvironment(context.Background(), dir, NewSystemConfigManifest(context.Background(), "host")); err == nil || !strings.Contains(err.Error(), "cmd /c set") {
+		t.Fatalf("failed command = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "environment_variables.txt")); !os.IsNotExist(err) {
+		t.Errorf("environment_variables.txt written after a failure: %v", err)
+	}
+}
+
+func TestEnvironmentFromHive(t *testing.T) {
+	written := time.Date(2024, 1, 9, 16, 20, 0, 0, time.UTC)
+	path := regftest.Value{Name: "Path", Type: regf.TypeExpandStr, Data: regftest.String("", `%SystemRoot%\system32;C:\Tools`).Data}
+	hivePath := regftest.WriteFile(t, "SYSTEM", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		{Name: "Select", Values: []regftest.Value{regftest.DWORD("Current", 2)}},
+		regftest.Path(`ControlSet002\Control\Session Manager`, &regftest.Key{Name: "Environment", LastWritten: written, Values: []regftest.Value{
+			regftest.String("ComSpec", `%SystemRoot%\system32\cmd.exe`),
+			path,
+			regftest.DWORD("NUMBER_OF_PROCESSORS", 8),
+		}}),
+	}})
+	hive, err := regf.Open(hivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hive.Close()
+
+	controlSet, err := currentControlSet(hive)
+	if err != nil || controlSet != "ControlSet002" {
+		t.Fatalf("current control set = %q, %v", controlSet, err)
+	}
+	scope, err := EnvironmentFromHive(hive, controlSet+`\`+machineEnvironmentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []EnvironmentVariable{
+		{Name: "ComSpec", Type: "REG_SZ", Value: `%SystemRoot%\system32\cmd.exe`},
+		{Name: "Path", Type: "REG_EXPAND_SZ", Value: `%SystemRoot%\system32;C:\Tools`},
+		{Name: "NUMBER_OF_PROCESSORS", Type: "REG_DWORD", Value: "0x8"},
+	}
+	if !reflect.DeepEqual(scope.Variables, want) || scope.Source != "hive" || scope.KeyLastWritten != "2024-01-09T16:20:00Z" {
+		t.Fatalf("scope = %+v", scope)
+	}
+
+	// A user hive without an Environment key is an error with no variables
+	scope, err = EnvironmentFromHive(hive, userEnvironmentKey)
+	if err == nil || scope.Variables == nil || len(scope.Variables) != 0 {
+		t.Fatalf("missing key = %+v, %v", scope, err)
+	}
+}
@@ -2,9 +2,12 @@
 package win_systemconfig
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // SystemConfigItem represents a collected system configuration file.
@@ -36,9 +39,9 @@ type SystemConfigManifest struct {
 }
 
 // NewSystemConfigManifest creates a new system configuration manifest with basic information.
-func NewSystemConfigManifest(hostname string) *SystemConfigManifest {
+func NewSystemConfigManifest(ctx context.Context, hostname string) *SystemConfigManifest {
 	return &SystemConfigManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]SystemConfigItem, 0),
@@ -56,7 +59,7 @@ func (sm *SystemConfigManifest) AddItem(path string, size int64, sha256 string,
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	sm.CollectedFiles++
@@ -19,6 +19,11 @@ func (w *WinSystemConfig) Name() string {
 	return "windows/systemconfig"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinSystemConfig) Describe() string {
+	return "System configuration and services"
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinSystemConfig) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
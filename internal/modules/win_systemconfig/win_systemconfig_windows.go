@@ -4,13 +4,19 @@ package win_systemconfig
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"cryptkeeper/internal/regf"
 	"cryptkeeper/internal/winutil"
 )
 
+// profileListKey maps user SIDs to profile directories.
+const profileListKey = `HKLM\SOFTWARE\Microsoft\Windows NT\CurrentVersion\ProfileList`
+
 // WinSystemConfig represents the Windows system configuration collection module.
 type WinSystemConfig struct{}
 
@@ -24,6 +30,11 @@ func (w *WinSystemConfig) Name() string {
 	return "windows/systemconfig"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinSystemConfig) Describe() string {
+	return "System configuration and services"
+}
+
 // Collect gathers Windows system configuration including services, startup locations, environment, timezone, and hosts file.
 func (w *WinSystemConfig) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/systemconfig subdirectory
@@ -33,13 +44,13 @@ func (w *WinSystemConfig) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewSystemConfigManifest(hostname)
+	manifest := NewSystemConfigManifest(ctx, hostname)
 
 	// Collect services configuration
 	if err := w.collectServicesConfig(ctx, configDir, manifest); err != nil {
@@ -56,10 +67,18 @@ func (w *WinSystemConfig) Collect(ctx context.Context, outDir string) error {
 		manifest.AddError("environment_variables", fmt.Sprintf("Failed to collect environment variables: %v", err))
 	}
 
+	// The persistent environment, which new processes inherit, can differ from ours
+	if err := w.collectRegistryEnvironment(ctx, configDir, manifest); err != nil {
+		manifest.AddError("environment_registry", fmt.Sprintf("Failed to collect registry environment: %v", err))
+	}
+
 	// Collect timezone configuration
 	if err := w.collectTimezoneConfig(ctx, configDir, manifest); err != nil {
 		manifest.AddError("timezone_config", fmt.Sprintf("Failed to collect timezone config: %v", err))
 	}
+	if err := w.collectTimezoneInfo(ctx, configDir, manifest); err != nil {
+		manifest.AddError("timezone", fmt.Sprintf("Failed to record host time zone: %v", err))
+	}
 
 	// Collect hosts file
 	if err := w.collectHostsFile(ctx, configDir, manifest); err != nil {
@@ -98,7 +117,7 @@ func (w *WinSystemConfig) collectServicesConfig(ctx context.Context, outDir stri
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash services config output: %w", err)
 	}
@@ -132,7 +151,7 @@ func (w *WinSystemConfig) collectStartupLocations(ctx context.Context, outDir st
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash startup programs output: %w", err)
 	}
@@ -145,38 +164,176 @@ func (w *WinSystemConfig) collectStartupLocations(ctx context.Context, outDir st
 
 // collectEnvironmentVariables collects system and user environment variables.
 func (w *WinSystemConfig) collectEnvironmentVariables(ctx context.Context, outDir string, manifest *SystemConfigManifest) error {
-	outputPath := filepath.Join(outDir, "environment_variables.txt")
+	return writeProcessEnvironment(ctx, outDir, manifest)
+}
+
+// collectRegistryEnvironment writes the machine and per-user environment
+// variables configured in the registry to environment_registry.json. A live
+// system is read with reg query; an offline root from its hive files.
+func (w *WinSystemConfig) collectRegistryEnvironment(ctx context.Context, outDir string, manifest *SystemConfigManifest) error {
+	report := &EnvironmentReport{Scopes: make([]EnvironmentScope, 0)}
+
+	machine := EnvironmentScope{Scope: "machine"}
+	if !winutil.IsOffline() {
+		machine.Source = "reg_query"
+		machine.KeyPath = `HKLM\SYSTEM\CurrentControlSet\` + machineEnvironmentKey
+		output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", machine.KeyPath})
+		if err != nil {
+			machine.Error = err.Error()
+		}
+		machine.Variables = EnvironmentFromRegQuery(winutil.ParseRegQuery(output))
+	} else {
+		machine = w.machineEnvironmentFromHive()
+	}
+	report.Scopes = append(report.Scopes, machine)
 
-	// Run set command to get all environment variables
-	args := []string{}
-	output, err := winutil.RunCommandWithOutput(ctx, "set", args)
+	usersDir := winutil.UsersDir()
+	userEntries, err := os.ReadDir(usersDir)
 	if err != nil {
-		return fmt.Errorf("failed to run set command: %w", err)
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to read users directory: %v", err))
 	}
 
-	// Write output to file
-	if err := os.WriteFile(outputPath, output, 0644); err != nil {
-		return fmt.Errorf("failed to write environment variables output: %w", err)
+	// Loaded hives cannot be copied; their SIDs let reg query read them instead
+	sids := map[string]string{}
+	if !winutil.IsOffline() {
+		sids = profileSIDs(ctx)
+	}
+	for _, userEntry := range userEntries {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if !userEntry.IsDir() || w.isSystemProfile(userEntry.Name()) {
+			continue
+		}
+		username := userEntry.Name()
+		hivePath := filepath.Join(usersDir, username, "NTUSER.DAT")
+		if _, err := os.Stat(hivePath); err != nil {
+			continue
+		}
+		scope := w.userEnvironment(ctx, hivePath, sids[strings.ToLower(username)])
+		scope.Scope = "user:" + username
+		report.Scopes = append(report.Scopes, scope)
 	}
 
-	// Get file info and add to manifest
-	stat, err := os.Stat(outputPath)
+	report.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+	outputPath := filepath.Join(outDir, "environment_registry.json")
+	data, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to stat environment variables output: %w", err)
+		return fmt.Errorf("failed to marshal registry environment: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write registry environment: %w", err)
 	}
 
-	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	stat, err := os.Stat(outputPath)
 	if err != nil {
-		return fmt.Errorf("failed to hash environment variables output: %w", err)
+		return fmt.Errorf("failed to stat registry environment: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash registry environment: %w", err)
 	}
 
-	manifest.AddItem("environment_variables.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "environment", "Environment variables from set command")
+	manifest.AddItem("environment_registry.json", stat.Size(), sha256Hex, false, stat.ModTime(), "environment", fmt.Sprintf("Persistent environment from Session Manager and user Environment keys (%d scopes)", len(report.Scopes)))
 	manifest.IncrementTotalFiles()
 
 	return nil
 }
 
+// machineEnvironmentFromHive reads Session Manager\Environment from the
+// SYSTEM hive of an offline root.
+func (w *WinSystemConfig) machineEnvironmentFromHive() EnvironmentScope {
+	hive, err := regf.Open(filepath.Join(winutil.SystemRoot(), "System32", "config", "SYSTEM"))
+	if err != nil {
+		return EnvironmentScope{Scope: "machine", Source: "hive", Error: fmt.Sprintf("failed to open SYSTEM hive: %v", err)}
+	}
+	defer hive.Close()
+
+	controlSet, err := currentControlSet(hive)
+	if err != nil {
+		return EnvironmentScope{Scope: "machine", Source: "hive", Error: err.Error()}
+	}
+	scope, err := EnvironmentFromHive(hive, controlSet+`\`+machineEnvironmentKey)
+	scope.Scope = "machine"
+	if err != nil {
+		scope.Error = err.Error()
+	}
+	return scope
+}
+
+// userEnvironment reads the Environment key from a private copy of a user's
+// NTUSER.DAT, falling back to reg query against HKU when the hive is loaded.
+func (w *WinSystemConfig) userEnvironment(ctx context.Context, hivePath, sid string) EnvironmentScope {
+	tempDir, err := os.MkdirTemp("", "cryptkeeper-env-")
+	if err != nil {
+		return EnvironmentScope{Error: fmt.Sprintf("failed to create temporary directory: %v", err)}
+	}
+	defer os.RemoveAll(tempDir)
+
+	tempHive := filepath.Join(tempDir, "NTUSER.DAT")
+	_, _, copyErr := winutil.CopyFile(ctx, hivePath, tempHive)
+	if copyErr == nil {
+		hive, err := regf.Open(tempHive)
+		if err != nil {
+			return EnvironmentScope{Source: "hive", Error: err.Error()}
+		}
+		defer hive.Close()
+		scope, err := EnvironmentFromHive(hive, userEnvironmentKey)
+		if err != nil {
+			scope.Error = err.Error()
+		}
+		return scope
+	}
+
+	if sid == "" || winutil.IsOffline() {
+		return EnvironmentScope{Source: "hive", Error: fmt.Sprintf("failed to copy NTUSER.DAT: %v", copyErr)}
+	}
+	scope := EnvironmentScope{Source: "reg_query", KeyPath: `HKU\` + sid + `\` + userEnvironmentKey}
+	output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", scope.KeyPath})
+	if err != nil {
+		scope.Error = err.Error()
+	}
+	scope.Variables = EnvironmentFromRegQuery(winutil.ParseRegQuery(output))
+	return scope
+}
+
+// profileSIDs maps lowercased profile directory names to user SIDs on a live system.
+func profileSIDs(ctx context.Context) map[string]string {
+	sids := make(map[string]string)
+	output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", profileListKey, "/s"})
+	if err != nil {
+		return sids
+	}
+	for _, key := range winutil.ParseRegQuery(output) {
+		value, ok := key.Value("ProfileImagePath")
+		if !ok {
+			continue
+		}
+		sid := key.Path[strings.LastIndex(key.Path, `\`)+1:]
+		sids[strings.ToLower(filepath.Base(value.Data))] = sid
+	}
+	return sids
+}
+
+// isSystemProfile checks if a username represents a system profile that should be skipped.
+func (w *WinSystemConfig) isSystemProfile(username string) bool {
+	systemProfiles := []string{
+		"All Users", "Default", "Default User", "Public",
+		"WDAGUtilityAccount", "defaultuser0", "systemprofile",
+	}
+
+	lowerUsername := strings.ToLower(username)
+	for _, profile := range systemProfiles {
+		if lowerUsername == strings.ToLower(profile) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // collectTimezoneConfig collects timezone and time synchronization settings.
 func (w *WinSystemConfig) collectTimezoneConfig(ctx context.Context, outDir string, manifest *SystemConfigManifest) error {
 	outputPath := filepath.Join(outDir, "timezone_config.txt")
@@ -205,7 +362,7 @@ func (w *WinSystemConfig) collectTimezoneConfig(ctx context.Context, outDir stri
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash timezone config output: %w", err)
 	}
@@ -216,17 +373,42 @@ func (w *WinSystemConfig) collectTimezoneConfig(ctx context.Context, outDir stri
 	return nil
 }
 
+// collectTimezoneInfo writes the active time zone and bias as timezone.json,
+// the same record reported as host_timezone in the run output.
+func (w *WinSystemConfig) collectTimezoneInfo(ctx context.Context, outDir string, manifest *SystemConfigManifest) error {
+	tz, err := winutil.CurrentTimezone()
+	if err != nil {
+		return err
+	}
+
+	outputPath := filepath.Join(outDir, "timezone.json")
+	data, err := json.MarshalIndent(tz, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal time zone: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write time zone: %w", err)
+	}
+
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat time zone: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash time zone: %w", err)
+	}
+
+	manifest.AddItem("timezone.json", stat.Size(), sha256Hex, false, stat.ModTime(), "timezone", fmt.Sprintf("Host time zone %s (UTC%s)", tz.StandardName, tz.UTCOffset))
+	manifest.IncrementTotalFiles()
+
+	return nil
+}
+
 // collectHostsFile collects the Windows hosts file.
 func (w *WinSystemConfig) collectHostsFile(ctx context.Context, outDir string, manifest *SystemConfigManifest) error {
 	// Get SystemRoot path (usually C:\Windows)
-	systemRoot := os.Getenv("SystemRoot")
-	if systemRoot == "" {
-		systemDrive := os.Getenv("SystemDrive")
-		if systemDrive == "" {
-			systemDrive = "C:"
-		}
-		systemRoot = filepath.Join(systemDrive, "Windows")
-	}
+	systemRoot := winutil.SystemRoot()
 
 	hostsPath := filepath.Join(systemRoot, "System32", "drivers", "etc", "hosts")
 	
@@ -247,7 +429,7 @@ func (w *WinSystemConfig) collectHostsFile(ctx context.Context, outDir string, m
 	}
 	defer srcFile.Close()
 
-	size, sha256Hex, err := winutil.CopyFileStreaming(srcFile, destPath)
+	size, sha256Hex, err := winutil.CopyFileStreaming(ctx, srcFile, destPath)
 	if err != nil {
 		return fmt.Errorf("failed to copy hosts file: %w", err)
 	}
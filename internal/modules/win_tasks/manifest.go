@@ -2,9 +2,12 @@
 package win_tasks
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // TaskItem represents a collected scheduled task file.
@@ -37,9 +40,9 @@ type TaskManifest struct {
 }
 
 // NewTaskManifest creates a new scheduled tasks manifest with basic information.
-func NewTaskManifest(hostname string) *TaskManifest {
+func NewTaskManifest(ctx context.Context, hostname string) *TaskManifest {
 	return &TaskManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]TaskItem, 0),
@@ -58,7 +61,7 @@ func (tm *TaskManifest) AddItem(path string, size int64, sha256 string, truncate
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		TaskPath:  taskPath,
 	})
 	tm.CollectedFiles++
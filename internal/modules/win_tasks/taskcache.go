@@ -0,0 +1,245 @@
+package win_tasks
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// taskCacheKey is where the Task Scheduler service registers tasks. Tree
+// mirrors the task folder hierarchy and is what the Task Scheduler UI and
+// schtasks enumerate; Tasks holds one {GUID} key per task.
+const taskCacheKey = `HKLM\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache`
+
+// Anomalies recorded in task_anomalies.json.
+const (
+	// AnomalyMissingTree: the task has an XML definition or a Tasks entry but
+	// no Tree entry, so it can run while hidden from the Task Scheduler UI.
+	AnomalyMissingTree = "missing_tree_entry"
+	// AnomalyMissingTasks: no TaskCache\Tasks key records the task, or the
+	// Tree entry's Id names no Tasks key.
+	AnomalyMissingTasks = "missing_tasks_entry"
+	// AnomalyMissingXML: the task is registered but System32\Tasks has no definition.
+	AnomalyMissingXML = "missing_xml"
+	// AnomalyPathMismatch: the Tasks entry the Tree Id points at records another path.
+	AnomalyPathMismatch = "path_mismatch"
+	// AnomalyMissingSD: the Tree entry has no SD value, which hides the task
+	// from enumeration even though it is still scheduled (the Tarrask technique).
+	AnomalyMissingSD = "missing_security_descriptor"
+)
+
+// TaskAnomaly is a task that is not consistently present in the three
+// sources the Task Scheduler keeps in step.
+type TaskAnomaly struct {
+	Path      string   `json:"path"`         // Task path, e.g. \Microsoft\Windows\Defrag\ScheduledDefrag
+	ID        string   `json:"id,omitempty"` // Task GUID from Tree or Tasks
+	InXML     bool     `json:"in_xml"`       // Definition present under System32\Tasks
+	InTree    bool     `json:"in_tree"`      // Present under TaskCache\Tree
+	InTasks   bool     `json:"in_tasks"`     // Present under TaskCache\Tasks
+	Anomalies []string `json:"anomalies"`
+	Detail    string   `json:"detail,omitempty"`
+}
+
+// TaskAnomalyReport is written to task_anomalies.json.
+type TaskAnomalyReport struct {
+	CreatedUTC     string        `json:"created_utc"`
+	RegistrySource string        `json:"registry_source"` // "reg_query" on a live system, "hive" offline
+	XMLTasks       int           `json:"xml_tasks"`
+	TreeTasks      int           `json:"tree_tasks"`
+	CacheTasks     int           `json:"cache_tasks"`
+	Anomalies      []TaskAnomaly `json:"anomalies"`
+	Errors         []string      `json:"errors,omitempty"`
+}
+
+// taskCache is the registry side of the cross-check, keyed by lowercased task path.
+type taskCache struct {
+	tree  map[string]treeEntry
+	tasks map[string]cacheEntry // Keyed by lowercased GUID
+}
+
+type treeEntry struct {
+	path  string
+	id    string
+	hasSD bool
+}
+
+type cacheEntry struct {
+	id   string
+	path string
+}
+
+// parseTaskCache sorts TaskCache keys, as printed by `reg query /s` or read
+// from a hive, into Tree tasks and Tasks entries. Tree keys without an Id
+// value are folders and are skipped.
+func parseTaskCache(keys []winutil.RegKey) taskCache {
+	cache := taskCache{tree: make(map[string]treeEntry), tasks: make(map[string]cacheEntry)}
+	for _, key := range keys {
+		lower := strings.ToLower(key.Path)
+		if i := strings.Index(lower, `\taskcache\tree\`); i >= 0 {
+			id, ok := key.Value("Id")
+			if !ok || id.Data == "" {
+				continue
+			}
+			_, hasSD := key.Value("SD")
+			path := key.Path[i+len(`\taskcache\tree`):]
+			cache.tree[strings.ToLower(path)] = treeEntry{path: path, id: id.Data, hasSD: hasSD}
+			continue
+		}
+		if i := strings.Index(lower, `\taskcache\tasks\`); i >= 0 {
+			id := key.Path[i+len(`\taskcache\tasks\`):]
+			if strings.Contains(id, `\`) {
+				continue
+			}
+			entry := cacheEntry{id: id}
+			if path, ok := key.Value("Path"); ok {
+				entry.path = path.Data
+			}
+			cache.tasks[strings.ToLower(id)] = entry
+		}
+	}
+	return cache
+}
+
+// CheckTaskCache compares the task definitions under System32\Tasks (paths
+// relative to it, with either separator) with the TaskCache Tree and Tasks
+// keys. The report lists every task missing from at least one of them, or
+// whose registry entries disagree, sorted by path.
+func CheckTaskCache(xmlPaths []string, keys []winutil.RegKey, registrySource string) *TaskAnomalyReport {
+	cache := parseTaskCache(keys)
+	report := &TaskAnomalyReport{
+		RegistrySource: registrySource,
+		XMLTasks:       len(xmlPaths),
+		TreeTasks:      len(cache.tree),
+		CacheTasks:     len(cache.tasks),
+		Anomalies:      make([]TaskAnomaly, 0),
+	}
+
+	byPath := make(map[string]*TaskAnomaly)
+	get := func(path string) *TaskAnomaly {
+		lower := strings.ToLower(path)
+		if a, ok := byPath[lower]; ok {
+			return a
+		}
+		a := &TaskAnomaly{Path: path}
+		byPath[lower] = a
+		return a
+	}
+
+	for _, rel := range xmlPaths {
+		get(`\` + strings.TrimLeft(strings.ReplaceAll(rel, "/", `\`), `\`)).InXML = true
+	}
+	for _, entry := range cache.tasks {
+		if entry.path == "" {
+			continue
+		}
+		a := get(entry.path)
+		a.InTasks = true
+		a.ID = entry.id
+	}
+	for lower, entry := range cache.tree {
+		a := get(entry.path)
+		a.InTree = true
+		a.ID = entry.id
+		if !entry.hasSD {
+			a.Anomalies = append(a.Anomalies, AnomalyMissingSD)
+		}
+		linked, ok := cache.tasks[strings.ToLower(entry.id)]
+		switch {
+		case !ok:
+			a.Anomalies = append(a.Anomalies, AnomalyMissingTasks)
+		case linked.path != "" && strings.ToLower(linked.path) != lower:
+			a.Anomalies = append(a.Anomalies, AnomalyPathMismatch)
+			a.Detail = fmt.Sprintf("Tasks entry %s records path %s", linked.id, linked.path)
+		}
+	}
+
+	for _, a := range byPath {
+		if !a.InTree {
+			a.Anomalies = append(a.Anomalies, AnomalyMissingTree)
+		}
+		if !a.InXML {
+			a.Anomalies = append(a.Anomalies, AnomalyMissingXML)
+		}
+		if !a.InTasks && !a.InTree {
+			a.Anomalies = append(a.Anomalies, AnomalyMissingTasks)
+		}
+		if len(a.Anomalies) == 0 {
+			continue
+		}
+		sort.Strings(a.Anomalies)
+		report.Anomalies = append(report.Anomalies, *a)
+	}
+	sort.Slice(report.Anomalies, func(i, j int) bool {
+		return strings.ToLower(report.Anomalies[i].Path) < strings.ToLower(report.Anomalies[j].Path)
+	})
+	return report
+}
+
+// HiveTaskCacheKeys reads the TaskCache Tree and Tasks keys from a SOFTWARE
+// hive, naming them as reg query would so CheckTaskCache treats both sources
+// alike.
+func HiveTaskCacheKeys(hive *regf.Hive) ([]winutil.RegKey, error) {
+	root := strings.TrimPrefix(taskCacheKey, `HKLM\SOFTWARE\`)
+	var keys []winutil.RegKey
+	for _, sub := range []string{"Tree", "Tasks"} {
+		key, err := hive.OpenKey(root + `\` + sub)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open TaskCache\\%s: %w", sub, err)
+		}
+		if err := collectHiveKeys(key, taskCacheKey+`\`+sub, 0, &keys); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// maxTreeDepth bounds the Tree folder recursion.
+const maxTreeDepth = 32
+
+func collectHiveKeys(key *regf.Key, path string, depth int, keys *[]winutil.RegKey) error {
+	if depth > maxTreeDepth {
+		return fmt.Errorf("TaskCache tree too deep at %s", path)
+	}
+	values, err := key.Values()
+	if err != nil {
+		return err
+	}
+	regKey := winutil.RegKey{Path: path, Values: make([]winutil.RegValue, 0, len(values))}
+	for _, value := range values {
+		switch {
+		case value.Type == regf.TypeBinary:
+			regKey.Values = append(regKey.Values, winutil.RegValue{Name: value.Name, Type: "REG_BINARY", Data: strings.ToUpper(hex.EncodeToString(value.Data))})
+		case value.String() != "":
+			regKey.Values = append(regKey.Values, winutil.RegValue{Name: value.Name, Type: "REG_SZ", Data: value.String()})
+		}
+	}
+	*keys = append(*keys, regKey)
+
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return err
+	}
+	for _, sub := range subkeys {
+		if err := collectHiveKeys(sub, path+`\`+sub.Name, depth+1, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTaskAnomalies writes the report as indented JSON.
+func WriteTaskAnomalies(ctx context.Context, report *TaskAnomalyReport, path string) error {
+	report.CreatedUTC = winutil.FormatTime(winutil.Now(ctx))
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,153 @@
+package win_tasks
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+	"cryptkeeper/internal/winutil"
+)
+
+// sampleTaskCache is `reg query ... /s` output for a TaskCache where one task
+// had its Tree key deleted, one had its SD value removed, and the Tasks
+// entries of two others were tampered with.
+const sampleTaskCache = `
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache\Tree\Microsoft
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache\Tree\Microsoft\Windows\Defrag\ScheduledDefrag
+    SD    REG_BINARY    010002805C000000
+    Id    REG_SZ    {1D417A53-0AA5-4E5C-8C7E-3D5C56A1D3E1}
+    Index    REG_DWORD    0x3
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache\Tree\OneDrive Sync
+    Id    REG_SZ    {6C2A9B7E-41F0-4D33-9E52-0B7A8D1C4F20}
+    Index    REG_DWORD    0x3
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache\Tree\Adobe Updater
+    SD    REG_BINARY    010002805C000000
+    Id    REG_SZ    {A4F0E1D2-0000-4000-8000-00000000ADBE}
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache\Tree\GoogleUpdateTaskMachineUA
+    SD    REG_BINARY    010002805C000000
+    Id    REG_SZ    {0F3A61C4-5B0E-4C4D-A1E8-6B1F3D2C9A77}
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache\Tasks\{1D417A53-0AA5-4E5C-8C7E-3D5C56A1D3E1}
+    Path    REG_SZ    \Microsoft\Windows\Defrag\ScheduledDefrag
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache\Tasks\{6C2A9B7E-41F0-4D33-9E52-0B7A8D1C4F20}
+    Path    REG_SZ    \OneDrive Sync
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache\Tasks\{9B8E7D6C-1234-4ABC-9DEF-0123456789AB}
+    Path    REG_SZ    \SysMaint
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache\Tasks\{0F3A61C4-5B0E-4C4D-A1E8-6B1F3D2C9A77}
+    Path    REG_SZ    \GoogleUpdateTaskMachineCore
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache\Tasks\{0F3A61C4-5B0E-4C4D-A1E8-6B1F3D2C9A77}\Triggers
+`
+
+// sampleTaskFiles are the definitions under System32\Tasks for the same host.
+var sampleTaskFiles = []string{
+	`Microsoft\Windows\Defrag\ScheduledDefrag`,
+	"OneDrive Sync",
+	"SysMaint",
+	"Adobe Updater",
+	"GoogleUpdateTaskMachineUA",
+	"Dropped/Backup",
+}
+
+func TestCheckTaskCacheFindsMissingEntries(t *testing.T) {
+	keys := winutil.ParseRegQuery([]byte(strings.ReplaceAll(sampleTaskCache, "\n", "\r\n")))
+	report := CheckTaskCache(sampleTaskFiles, keys, "reg_query")
+	if report.XMLTasks != 6 || report.TreeTasks != 4 || report.CacheTasks != 4 {
+		t.Fatalf("counts = %d xml, %d tree, %d tasks", report.XMLTasks, report.TreeTasks, report.CacheTasks)
+	}
+
+	want := []TaskAnomaly{
+		{Path: `\Adobe Updater`, ID: "{A4F0E1D2-0000-4000-8000-00000000ADBE}", InXML: true, InTree: true, Anomalies: []string{AnomalyMissingTasks}},
+		{Path: `\Dropped\Backup`, InXML: true, Anomalies: []string{AnomalyMissingTasks, AnomalyMissingTree}},
+		{Path: `\GoogleUpdateTaskMachineCore`, ID: "{0F3A61C4-5B0E-4C4D-A1E8-6B1F3D2C9A77}", InTasks: true, Anomalies: []string{AnomalyMissingTree, AnomalyMissingXML}},
+		{
+			Path: `\GoogleUpdateTaskMachineUA`, ID: "{0F3A61C4-5B0E-4C4D-A1E8-6B1F3D2C9A77}", InXML: true, InTree: true,
+			Anomalies: []string{AnomalyPathMismatch},
+			Detail:    `Tasks entry {0F3A61C4-5B0E-4C4D-A1E8-6B1F3D2C9A77} records path \GoogleUpdateTaskMachineCore`,
+		},
+		{Path: `\OneDrive Sync`, ID: "{6C2A9B7E-41F0-4D33-9E52-0B7A8D1C4F20}", InXML: true, InTree: true, InTasks: true, Anomalies: []string{AnomalyMissingSD}},
+		{Path: `\SysMaint`, ID: "{9B8E7D6C-1234-4ABC-9DEF-0123456789AB}", InXML: true, InTasks: true, Anomalies: []string{AnomalyMissingTree}},
+	}
+	if !reflect.DeepEqual(report.Anomalies, want) {
+		t.Fatalf("anomalies =\n%+v\nwant\n%+v", report.Anomalies, want)
+	}
+
+	// Nothing is reported when every source agrees
+	var defrag []winutil.RegKey
+	for _, key := range keys {
+		if strings.Contains(key.Path, "Defrag") || strings.Contains(key.Path, "{1D417A53") {
+			defrag = append(defrag, key)
+		}
+	}
+	report = CheckTaskCache([]string{`Microsoft\Windows\Defrag\ScheduledDefrag`}, defrag, "reg_query")
+	if len(defrag) != 2 || len(report.Anomalies) != 0 {
+		t.Fatalf("consistent task reported: %+v", report.Anomalies)
+	}
+}
+
+func TestHiveTaskCacheKeysMatchRegQuery(t *testing.T) {
+	sd := []byte{0x01, 0x00, 0x02, 0x80, 0x5c, 0x00, 0x00, 0x00}
+	tree := &regftest.Key{Name: "Tree", Subkeys: []*regftest.Key{
+		regftest.Path(`Microsoft\Windows\Defrag`, &regftest.Key{Name: "ScheduledDefrag", Values: []regftest.Value{
+			regftest.Binary("SD", sd),
+			regftest.String("Id", "{1D417A53-0AA5-4E5C-8C7E-3D5C56A1D3E1}"),
+			regftest.DWORD("Index", 3),
+		}}),
+		{Name: "SysMaint", Values: []regftest.Value{regftest.String("Id", "{9B8E7D6C-1234-4ABC-9DEF-0123456789AB}")}},
+	}}
+	tasks := &regftest.Key{Name: "Tasks", Subkeys: []*regftest.Key{
+		{Name: "{1D417A53-0AA5-4E5C-8C7E-3D5C56A1D3E1}", Values: []regftest.Value{regftest.String("Path", `\Microsoft\Windows\Defrag\ScheduledDefrag`)}},
+	}}
+	path := regftest.WriteFile(t, "SOFTWARE", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		regftest.Path(`Microsoft\Windows NT\CurrentVersion\Schedule\TaskCache`, tree, tasks),
+	}})
+	keys, err := HiveTaskCacheKeys(mustOpen(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defrag := taskCacheKey + `\Tree\Microsoft\Windows\Defrag\ScheduledDefrag`
+	var found bool
+	for _, key := range keys {
+		if key.Path != defrag {
+			continue
+		}
+		found = true
+		if sd, ok := key.Value("SD"); !ok || sd.Data != "010002805C000000" {
+			t.Errorf("SD = %+v", sd)
+		}
+	}
+	if !found {
+		t.Fatalf("no key %s in %+v", defrag, keys)
+	}
+
+	report := CheckTaskCache([]string{`Microsoft\Windows\Defrag\ScheduledDefrag`, "SysMaint"}, keys, "hive")
+	want := []TaskAnomaly{{Path: `\SysMaint`, ID: "{9B8E7D6C-1234-4ABC-9DEF-0123456789AB}", InXML: true, InTree: true, Anomalies: []string{AnomalyMissingSD, AnomalyMissingTasks}}}
+	if !reflect.DeepEqual(report.Anomalies, want) {
+		t.Fatalf("anomalies = %+v\nwant %+v", report.Anomalies, want)
+	}
+
+	// A SOFTWARE hive without a TaskCache is an error, not an empty registry
+	if _, err := HiveTaskCacheKeys(mustOpen(t, regftest.WriteFile(t, "SOFTWARE", &regftest.Key{Name: "ROOT"}))); err == nil {
+		t.Error("hive without TaskCache read without error")
+	}
+}
+
+// mustOpen opens a test hive for the rest of the test.
+func mustOpen(t *testing.T, path string) *regf.Hive {
+	t.Helper()
+	hive, err := regf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hive.Close() })
+	return hive
+}
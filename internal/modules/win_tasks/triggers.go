@@ -0,0 +1,371 @@
+package win_tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// Trigger types recorded in task_triggers.json, from the task XML element names.
+const (
+	TriggerEvent        = "event"
+	TriggerLogon        = "logon"
+	TriggerBoot         = "boot"
+	TriggerIdle         = "idle"
+	TriggerSessionState = "session_state_change"
+	TriggerRegistration = "registration"
+)
+
+// triggerTypes maps the task XML trigger elements that fire on a system
+// condition rather than a schedule. TimeTrigger and CalendarTrigger are not
+// indexed.
+var triggerTypes = map[string]string{
+	"EventTrigger":              TriggerEvent,
+	"LogonTrigger":              TriggerLogon,
+	"BootTrigger":               TriggerBoot,
+	"IdleTrigger":               TriggerIdle,
+	"SessionStateChangeTrigger": TriggerSessionState,
+	"RegistrationTrigger":       TriggerRegistration,
+}
+
+// flaggedTriggers are the triggers whose script or LOLBin actions are flagged.
+var flaggedTriggers = map[string]bool{TriggerEvent: true, TriggerLogon: true}
+
+// scriptExtensions are files run by a script host rather than loaded as code.
+var scriptExtensions = map[string]bool{
+	".ps1": true, ".psm1": true, ".bat": true, ".cmd": true, ".vbs": true, ".vbe": true,
+	".js": true, ".jse": true, ".wsf": true, ".wsh": true, ".hta": true, ".sct": true,
+}
+
+// lolbins are signed Windows binaries commonly abused to run attacker code.
+var lolbins = map[string]bool{
+	"powershell.exe": true, "pwsh.exe": true, "cmd.exe": true, "wscript.exe": true, "cscript.exe": true,
+	"mshta.exe": true, "rundll32.exe": true, "regsvr32.exe": true, "msiexec.exe": true, "certutil.exe": true,
+	"bitsadmin.exe": true, "installutil.exe": true, "regasm.exe": true, "regsvcs.exe": true, "msbuild.exe": true,
+	"forfiles.exe": true, "wmic.exe": true, "odbcconf.exe": true, "cmstp.exe": true, "conhost.exe": true,
+}
+
+// TaskTrigger is one condition trigger of a task.
+type TaskTrigger struct {
+	Type        string   `json:"type"`
+	Enabled     bool     `json:"enabled"`
+	Delay       string   `json:"delay,omitempty"`        // ISO 8601 duration, e.g. PT30S
+	UserID      string   `json:"user_id,omitempty"`      // Logon and session triggers limited to one user
+	StateChange string   `json:"state_change,omitempty"` // Session trigger, e.g. SessionUnlock
+	Channels    []string `json:"channels,omitempty"`     // Event channels the subscription selects from
+	XPath       []string `json:"xpath,omitempty"`        // Select queries of the subscription
+	Suppress    []string `json:"suppress,omitempty"`     // Suppress queries of the subscription
+	Condition   string   `json:"condition,omitempty"`    // Event subscription as stored, when it is not a QueryList
+}
+
+// TaskAction is one action of a task.
+type TaskAction struct {
+	Type             string `json:"type"` // "exec" or "com_handler"
+	Command          string `json:"command,omitempty"`
+	Arguments        string `json:"arguments,omitempty"`
+	WorkingDirectory string `json:"working_directory,omitempty"`
+	ClassID          string `json:"class_id,omitempty"`
+	Kind             string `json:"kind,omitempty"` // "script" or "lolbin" when the action runs one
+}
+
+// TriggeredTask is a task with at least one condition trigger.
+type TriggeredTask struct {
+	Path     string        `json:"path"` // Task path, e.g. \Microsoft\Windows\Defrag\ScheduledDefrag
+	Author   string        `json:"author,omitempty"`
+	UserID   string        `json:"user_id,omitempty"` // Principal the task runs as
+	RunLevel string        `json:"run_level,omitempty"`
+	Enabled  bool          `json:"enabled"`
+	Hidden   bool          `json:"hidden"`
+	Triggers []TaskTrigger `json:"triggers"`
+	Actions  []TaskAction  `json:"actions"`
+	Flags    []string      `json:"flags,omitempty"`
+}
+
+// TaskTriggerReport is written to task_triggers.json.
+type TaskTriggerReport struct {
+	CreatedUTC   string          `json:"created_utc"`
+	TasksParsed  int             `json:"tasks_parsed"`
+	Tasks        []TriggeredTask `json:"tasks"`
+	FlaggedTasks int             `json:"flagged_tasks"`
+	Errors       []string        `json:"errors,omitempty"`
+}
+
+// rawTask mirrors the task XML schema. Triggers are read in document order
+// as generic elements so that every trigger type shares one shape.
+type rawTask struct {
+	RegistrationInfo struct {
+		Author string `xml:"Author"`
+	} `xml:"RegistrationInfo"`
+	Triggers struct {
+		Triggers []struct {
+			XMLName      xml.Name
+			Enabled      *bool  `xml:"Enabled"`
+			Delay        string `xml:"Delay"`
+			UserID       string `xml:"UserId"`
+			StateChange  string `xml:"StateChange"`
+			Subscription string `xml:"Subscription"`
+		} `xml:",any"`
+	} `xml:"Triggers"`
+	Settings struct {
+		Enabled *bool `xml:"Enabled"`
+		Hidden  bool  `xml:"Hidden"`
+	} `xml:"Settings"`
+	Actions struct {
+		Actions []struct {
+			XMLName          xml.Name
+			Command          string `xml:"Command"`
+			Arguments        string `xml:"Arguments"`
+			WorkingDirectory string `xml:"WorkingDirectory"`
+			ClassID          string `xml:"ClassId"`
+		} `xml:",any"`
+	} `xml:"Actions"`
+	Principals struct {
+		Principal []struct {
+			UserID   string `xml:"UserId"`
+			GroupID  string `xml:"GroupId"`
+			RunLevel string `xml:"RunLevel"`
+		} `xml:"Principal"`
+	} `xml:"Principals"`
+}
+
+// rawQueryList mirrors the QueryList an EventTrigger subscription holds.
+type rawQueryList struct {
+	Queries []struct {
+		Path     string     `xml:"Path,attr"`
+		Select   []rawQuery `xml:"Select"`
+		Suppress []rawQuery `xml:"Suppress"`
+	} `xml:"Query"`
+}
+
+type rawQuery struct {
+	Path  string `xml:"Path,attr"`
+	XPath string `xml:",chardata"`
+}
+
+// ParseTaskTriggers decodes a task XML definition, which Windows writes
+// as UTF-16 with a byte order mark. It returns nil when the task has no
+// condition trigger.
+func ParseTaskTriggers(taskPath string, data []byte) (*TriggeredTask, error) {
+	var raw rawTask
+	decoder := xml.NewDecoder(bytes.NewReader(taskXMLToUTF8(data)))
+	// The bytes are UTF-8 by now, whatever the declaration says
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) { return input, nil }
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to parse task XML: %w", err)
+	}
+
+	task := &TriggeredTask{
+		Path:     taskPath,
+		Author:   strings.TrimSpace(raw.RegistrationInfo.Author),
+		Enabled:  raw.Settings.Enabled == nil || *raw.Settings.Enabled,
+		Hidden:   raw.Settings.Hidden,
+		Triggers: make([]TaskTrigger, 0),
+		Actions:  make([]TaskAction, 0),
+	}
+	if len(raw.Principals.Principal) > 0 {
+		principal := raw.Principals.Principal[0]
+		task.UserID = strings.TrimSpace(principal.UserID)
+		if task.UserID == "" {
+			task.UserID = strings.TrimSpace(principal.GroupID)
+		}
+		task.RunLevel = strings.TrimSpace(principal.RunLevel)
+	}
+
+	for _, rt := range raw.Triggers.Triggers {
+		triggerType, ok := triggerTypes[rt.XMLName.Local]
+		if !ok {
+			continue
+		}
+		trigger := TaskTrigger{
+			Type:        triggerType,
+			Enabled:     rt.Enabled == nil || *rt.Enabled,
+			Delay:       strings.TrimSpace(rt.Delay),
+			UserID:      strings.TrimSpace(rt.UserID),
+			StateChange: strings.TrimSpace(rt.StateChange),
+		}
+		if triggerType == TriggerEvent {
+			parseSubscription(&trigger, rt.Subscription)
+		}
+		task.Triggers = append(task.Triggers, trigger)
+	}
+	if len(task.Triggers) == 0 {
+		return nil, nil
+	}
+
+	for _, ra := range raw.Actions.Actions {
+		switch ra.XMLName.Local {
+		case "Exec":
+			action := TaskAction{
+				Type:             "exec",
+				Command:          strings.TrimSpace(ra.Command),
+				Arguments:        strings.TrimSpace(ra.Arguments),
+				WorkingDirectory: strings.TrimSpace(ra.WorkingDirectory),
+			}
+			action.Kind = actionKind(action.Command, action.Arguments)
+			task.Actions = append(task.Actions, action)
+		case "ComHandler":
+			task.Actions = append(task.Actions, TaskAction{Type: "com_handler", ClassID: strings.TrimSpace(ra.ClassID)})
+		}
+	}
+
+	task.Flags = flagTriggeredTask(task)
+	return task, nil
+}
+
+// parseSubscription extracts the channels and XPath queries of an event
+// trigger's QueryList.
+func parseSubscription(trigger *TaskTrigger, subscription string) {
+	subscription = strings.TrimSpace(subscription)
+	if subscription == "" {
+		return
+	}
+	var list rawQueryList
+	if err := xml.Unmarshal([]byte(subscription), &list); err != nil || len(list.Queries) == 0 {
+		trigger.Condition = subscription
+		return
+	}
+	seen := make(map[string]bool)
+	addChannel := func(channel string) {
+		if channel != "" && !seen[strings.ToLower(channel)] {
+			seen[strings.ToLower(channel)] = true
+			trigger.Channels = append(trigger.Channels, channel)
+		}
+	}
+	for _, query := range list.Queries {
+		addChannel(query.Path)
+		for _, sel := range query.Select {
+			addChannel(sel.Path)
+			trigger.XPath = append(trigger.XPath, strings.TrimSpace(sel.XPath))
+		}
+		for _, sup := range query.Suppress {
+			trigger.Suppress = append(trigger.Suppress, strings.TrimSpace(sup.XPath))
+		}
+	}
+}
+
+// actionKind reports whether an exec action runs a script or a LOLBin. A
+// script passed as an argument to a script host counts as a script.
+func actionKind(command, arguments string) string {
+	base := strings.ToLower(filepath.Base(strings.ReplaceAll(strings.Trim(command, `"`), `\`, "/")))
+	if scriptExtensions[filepath.Ext(base)] {
+		return "script"
+	}
+	if lolbins[base] || lolbins[base+".exe"] {
+		for _, arg := range strings.Fields(strings.ToLower(arguments)) {
+			if scriptExtensions[filepath.Ext(strings.Trim(arg, `"'`))] {
+				return "script"
+			}
+		}
+		return "lolbin"
+	}
+	return ""
+}
+
+// flagTriggeredTask flags event- and logon-triggered tasks that run a
+// script or LOLBin, e.g. "event_trigger_lolbin".
+func flagTriggeredTask(task *TriggeredTask) []string {
+	var flags []string
+	seen := make(map[string]bool)
+	for _, trigger := range task.Triggers {
+		if !flaggedTriggers[trigger.Type] {
+			continue
+		}
+		for _, action := range task.Actions {
+			if action.Kind == "" {
+				continue
+			}
+			flag := trigger.Type + "_trigger_" + action.Kind
+			if !seen[flag] {
+				seen[flag] = true
+				flags = append(flags, flag)
+			}
+		}
+	}
+	return flags
+}
+
+// taskXMLToUTF8 converts a UTF-16 task definition to UTF-8. Definitions
+// without a UTF-16 byte order mark are returned as they are.
+func taskXMLToUTF8(data []byte) []byte {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		order = binary.BigEndian
+	default:
+		return bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	}
+	units := make([]uint16, 0, len(data)/2)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// IndexTaskTriggers parses every task definition copied under tasksDir,
+// whose layout mirrors System32\Tasks, for condition triggers.
+func IndexTaskTriggers(tasksDir string, isTaskFile func(string) bool) (*TaskTriggerReport, error) {
+	report := &TaskTriggerReport{Tasks: make([]TriggeredTask, 0)}
+	err := filepath.WalkDir(tasksDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if path == tasksDir {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() || !isTaskFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(tasksDir, path)
+		if err != nil {
+			return nil
+		}
+		taskPath := `\` + strings.TrimSuffix(strings.ReplaceAll(rel, "/", `\`), ".xml")
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", taskPath, err))
+			return nil
+		}
+		report.TasksParsed++
+		task, err := ParseTaskTriggers(taskPath, data)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", taskPath, err))
+			return nil
+		}
+		if task != nil {
+			report.Tasks = append(report.Tasks, *task)
+			if len(task.Flags) > 0 {
+				report.FlaggedTasks++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(report.Tasks, func(i, j int) bool { return report.Tasks[i].Path < report.Tasks[j].Path })
+	return report, nil
+}
+
+// WriteTaskTriggers writes the report as indented JSON.
+func WriteTaskTriggers(ctx context.Context, report *TaskTriggerReport, path string) error {
+	report.CreatedUTC = winutil.FormatTime(winutil.Now(ctx))
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
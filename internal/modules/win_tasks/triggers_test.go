@@ -0,0 +1,172 @@
+package win_tasks
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// eventTask is a task definition as schtasks registers one that runs a
+// script whenever an account logs on with explicit credentials or the
+// Security log is cleared. The subscription is an escaped QueryList.
+const eventTask = `<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <RegistrationInfo>
+    <Author>CORP\svc-deploy</Author>
+    <URI>\Microsoft\Windows\WDI\SrvSetupResults</URI>
+  </RegistrationInfo>
+  <Triggers>
+    <EventTrigger>
+      <Enabled>true</Enabled>
+      <Delay>PT30S</Delay>
+      <Subscription>&lt;QueryList&gt;&lt;Query Id="0" Path="Security"&gt;&lt;Select Path="Security"&gt;*[System[(EventID=4648)]]&lt;/Select&gt;&lt;Select Path="System"&gt;*[System[Provider[@Name='Microsoft-Windows-Eventlog'] and EventID=104]]&lt;/Select&gt;&lt;Suppress Path="Security"&gt;*[EventData[Data[@Name='TargetUserName']='svc-backup']]&lt;/Suppress&gt;&lt;/Query&gt;&lt;/QueryList&gt;</Subscription>
+    </EventTrigger>
+    <TimeTrigger>
+      <StartBoundary>2024-02-27T03:00:00</StartBoundary>
+    </TimeTrigger>
+    <LogonTrigger>
+      <Enabled>false</Enabled>
+      <UserId>CORP\alice</UserId>
+    </LogonTrigger>
+  </Triggers>
+  <Principals>
+    <Principal id="Author">
+      <UserId>S-1-5-18</UserId>
+      <RunLevel>HighestAvailable</RunLevel>
+    </Principal>
+  </Principals>
+  <Settings>
+    <Hidden>true</Hidden>
+  </Settings>
+  <Actions Context="Author">
+    <Exec>
+      <Command>C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe</Command>
+      <Arguments>-NoP -W Hidden -File "C:\ProgramData\WDI\setup.ps1"</Arguments>
+    </Exec>
+    <ComHandler>
+      <ClassId>{B1AEBB5D-EAD9-4476-B375-9C3ED9F32AFC}</ClassId>
+    </ComHandler>
+  </Actions>
+</Task>
+`
+
+// utf16Task encodes a definition as Windows writes it: UTF-16LE with a
+// byte order mark.
+func utf16Task(xml string) []byte {
+	data := []byte{0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(xml)) {
+		data = binary.LittleEndian.AppendUint16(data, u)
+	}
+	return data
+}
+
+func TestParseTaskTriggersDecodesTheSubscription(t *testing.T) {
+	task, err := ParseTaskTriggers(`\Microsoft\Windows\WDI\SrvSetupResults`, utf16Task(eventTask))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Author != `CORP\svc-deploy` || task.UserID != "S-1-5-18" || task.RunLevel != "HighestAvailable" || !task.Enabled || !task.Hidden {
+		t.Fatalf("task = %+v", task)
+	}
+
+	// The time trigger is not indexed
+	want := []TaskTrigger{
+		{
+			Type:     TriggerEvent,
+			Enabled:  true,
+			Delay:    "PT30S",
+			Channels: []string{"Security", "System"},
+			XPath: []string{
+				"*[System[(EventID=4648)]]",
+				"*[System[Provider[@Name='Microsoft-Windows-Eventlog'] and EventID=104]]",
+			},
+			Suppress: []string{"*[EventData[Data[@Name='TargetUserName']='svc-backup']]"},
+		},
+		{Type: TriggerLogon, UserID: `CORP\alice`},
+	}
+	if !reflect.DeepEqual(task.Triggers, want) {
+		t.Fatalf("triggers = %+v\nwant %+v", task.Triggers, want)
+	}
+
+	wantActions := []TaskAction{
+		{
+			Type:      "exec",
+			Command:   `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`,
+			Arguments: `-NoP -W Hidden -File "C:\ProgramData\WDI\setup.ps1"`,
+			Kind:      "script",
+		},
+		{Type: "com_handler", ClassID: "{B1AEBB5D-EAD9-4476-B375-9C3ED9F32AFC}"},
+	}
+	if !reflect.DeepEqual(task.Actions, wantActions) {
+		t.Fatalf("actions = %+v", task.Actions)
+	}
+	if !reflect.DeepEqual(task.Flags, []string{"event_trigger_script", "logon_trigger_script"}) {
+		t.Fatalf("flags = %v", task.Flags)
+	}
+}
+
+func TestParseTaskTriggersKeepsAMalformedSubscription(t *testing.T) {
+	for _, subscription := range []string{
+		"&lt;QueryList&gt;&lt;Query Id=\"0\"&gt;&lt;Select Path=\"Security\"&gt;*&lt;/Query&gt;",
+		"*[System[EventID=4624]]",
+		"&lt;QueryList&gt;&lt;/QueryList&gt;",
+	} {
+		xml := strings.Replace(eventTask, eventTask[strings.Index(eventTask, "<Subscription>"):strings.Index(eventTask, "</Subscription>")], "<Subscription>"+subscription, 1)
+		task, err := ParseTaskTriggers(`\Updater`, []byte(xml))
+		if err != nil {
+			t.Fatal(err)
+		}
+		trigger := task.Triggers[0]
+		want := strings.NewReplacer("&lt;", "<", "&gt;", ">").Replace(subscription)
+		if trigger.Type != TriggerEvent || trigger.Condition != want || trigger.Channels != nil || trigger.XPath != nil {
+			t.Errorf("trigger of subscription %q = %+v", subscription, trigger)
+		}
+	}
+}
+
+func TestParseTaskTriggersWithoutConditionTriggers(t *testing.T) {
+	xml := `<?xml version="1.0"?><Task><Triggers><TimeTrigger><StartBoundary>2024-02-27T03:00:00</StartBoundary></TimeTrigger></Triggers>` +
+		`<Actions><Exec><Command>cmd.exe</Command></Exec></Actions></Task>`
+	if task, err := ParseTaskTriggers(`\Nightly`, []byte(xml)); err != nil || task != nil {
+		t.Fatalf("scheduled task = %+v, %v", task, err)
+	}
+	if _, err := ParseTaskTriggers(`\Broken`, []byte("<Task><Triggers>")); err == nil {
+		t.Fatal("truncated task XML parsed")
+	}
+}
+
+func TestIndexTaskTriggers(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"Microsoft/Windows/WDI/SrvSetupResults": utf16Task(eventTask),
+		"Nightly":                               []byte(`<Task><Triggers><TimeTrigger/></Triggers></Task>`),
+		"Broken":                                []byte("<Task><Triggers>"),
+		"desktop.ini":                           []byte("[.ShellClassInfo]"),
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := IndexTaskTriggers(dir, func(name string) bool { return name != "desktop.ini" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TasksParsed != 3 || len(report.Tasks) != 1 || report.FlaggedTasks != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.Tasks[0].Path != `\Microsoft\Windows\WDI\SrvSetupResults` {
+		t.Fatalf("task path = %s", report.Tasks[0].Path)
+	}
+	if len(report.Errors) != 1 || !strings.HasPrefix(report.Errors[0], `\Broken: `) {
+		t.Fatalf("errors = %q", report.Errors)
+	}
+}
@@ -19,6 +19,11 @@ func (w *WinTasks) Name() string {
 	return "windows/tasks"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinTasks) Describe() string {
+	return "Windows Scheduled Tasks"
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinTasks) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
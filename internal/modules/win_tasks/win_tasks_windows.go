@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"cryptkeeper/internal/regf"
 	"cryptkeeper/internal/winutil"
 )
 
@@ -25,6 +26,11 @@ func (w *WinTasks) Name() string {
 	return "windows/tasks"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinTasks) Describe() string {
+	return "Windows Scheduled Tasks"
+}
+
 // Collect copies Windows scheduled task files and creates a manifest.
 func (w *WinTasks) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/tasks subdirectory
@@ -34,22 +40,19 @@ func (w *WinTasks) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewTaskManifest(hostname)
+	manifest := NewTaskManifest(ctx, hostname)
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Get system paths
-	systemRoot := os.Getenv("SystemRoot")
-	if systemRoot == "" {
-		systemRoot = "C:\\Windows"
-	}
+	systemRoot := winutil.SystemRoot()
 
 	// Collect scheduled task files from System32\Tasks\
 	tasksSourceDir := filepath.Join(systemRoot, "System32", "Tasks")
@@ -57,6 +60,16 @@ func (w *WinTasks) Collect(ctx context.Context, outDir string) error {
 		manifest.AddError("tasks_directory", fmt.Sprintf("Failed to collect scheduled tasks: %v", err))
 	}
 
+	// Cross-check the task definitions against the TaskCache registration
+	if err := w.checkTaskCache(ctx, tasksSourceDir, tasksDir, manifest); err != nil {
+		manifest.AddError("task_anomalies", err.Error())
+	}
+
+	// Index event, logon, boot, and other condition triggers from the copies
+	if err := w.indexTaskTriggers(ctx, tasksDir, manifest); err != nil {
+		manifest.AddError("task_triggers", err.Error())
+	}
+
 	// Write manifest
 	manifestPath := filepath.Join(tasksDir, "manifest.json")
 	if err := manifest.WriteManifest(manifestPath); err != nil {
@@ -141,6 +154,96 @@ func (w *WinTasks) collectTaskFiles(ctx context.Context, sourceDir, outDir, rela
 	return nil
 }
 
+// checkTaskCache writes task_anomalies.json, listing tasks the XML files,
+// TaskCache\Tree, and TaskCache\Tasks do not agree on. A live system's
+// registry is read with reg query; an offline image's SOFTWARE hive is
+// opened in place.
+func (w *WinTasks) checkTaskCache(ctx context.Context, tasksSourceDir, tasksDir string, manifest *TaskManifest) error {
+	var xmlPaths []string
+	err := filepath.WalkDir(tasksSourceDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if path == tasksSourceDir {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() || !w.isTaskFile(d.Name()) {
+			return nil
+		}
+		if rel, err := filepath.Rel(tasksSourceDir, path); err == nil {
+			xmlPaths = append(xmlPaths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list task definitions: %w", err)
+	}
+
+	var keys []winutil.RegKey
+	source := "reg_query"
+	if !winutil.IsOffline() {
+		output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", taskCacheKey, "/s"})
+		if err != nil {
+			return fmt.Errorf("failed to query TaskCache: %w", err)
+		}
+		keys = winutil.ParseRegQuery(output)
+	} else {
+		source = "hive"
+		hive, err := regf.Open(filepath.Join(winutil.SystemRoot(), "System32", "config", "SOFTWARE"))
+		if err != nil {
+			return fmt.Errorf("failed to open SOFTWARE hive: %w", err)
+		}
+		keys, err = HiveTaskCacheKeys(hive)
+		hive.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	report := CheckTaskCache(xmlPaths, keys, source)
+	reportPath := filepath.Join(tasksDir, "task_anomalies.json")
+	if err := WriteTaskAnomalies(ctx, report, reportPath); err != nil {
+		return fmt.Errorf("failed to write task anomalies: %w", err)
+	}
+
+	stat, err := os.Stat(reportPath)
+	if err != nil {
+		return err
+	}
+	sha256Hex, err := winutil.HashFile(ctx, reportPath)
+	if err != nil {
+		return err
+	}
+	note := fmt.Sprintf("Tasks XML vs TaskCache cross-check (%d anomalies)", len(report.Anomalies))
+	manifest.AddItem("task_anomalies.json", stat.Size(), sha256Hex, false, stat.ModTime(), "", note)
+	return nil
+}
+
+// indexTaskTriggers writes task_triggers.json from the task definitions
+// copied into tasksDir.
+func (w *WinTasks) indexTaskTriggers(ctx context.Context, tasksDir string, manifest *TaskManifest) error {
+	report, err := IndexTaskTriggers(tasksDir, w.isTaskFile)
+	if err != nil {
+		return fmt.Errorf("failed to index task triggers: %w", err)
+	}
+	reportPath := filepath.Join(tasksDir, "task_triggers.json")
+	if err := WriteTaskTriggers(ctx, report, reportPath); err != nil {
+		return fmt.Errorf("failed to write task triggers: %w", err)
+	}
+
+	stat, err := os.Stat(reportPath)
+	if err != nil {
+		return err
+	}
+	sha256Hex, err := winutil.HashFile(ctx, reportPath)
+	if err != nil {
+		return err
+	}
+	note := fmt.Sprintf("Event, logon, boot, and idle triggers of scheduled tasks (%d tasks, %d flagged)", len(report.Tasks), report.FlaggedTasks)
+	manifest.AddItem("task_triggers.json", stat.Size(), sha256Hex, false, stat.ModTime(), "", note)
+	return nil
+}
+
 // isTaskFile determines if a file is a scheduled task file.
 func (w *WinTasks) isTaskFile(filename string) bool {
 	lowerFilename := strings.ToLower(filename)
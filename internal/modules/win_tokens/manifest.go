@@ -2,9 +2,12 @@
 package win_tokens
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // TokenItem represents a collected access token-related file.
@@ -15,7 +18,7 @@ type TokenItem struct {
 	Truncated bool   `json:"truncated"` // Whether the file was truncated due to size limits
 	Note      string `json:"note,omitempty"` // Description of the file
 	Modified  string `json:"modified"`  // File modification time (RFC3339)
-	FileType  string `json:"file_type"` // Type: "access_tokens", "privileges", "token_groups"
+	FileType  string `json:"file_type"` // Type: "access_tokens", "privileges", "token_groups", "token_info"
 }
 
 // TokenError represents an error that occurred during collection.
@@ -36,9 +39,9 @@ type TokenManifest struct {
 }
 
 // NewTokenManifest creates a new access tokens manifest with basic information.
-func NewTokenManifest(hostname string) *TokenManifest {
+func NewTokenManifest(ctx context.Context, hostname string) *TokenManifest {
 	return &TokenManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]TokenItem, 0),
@@ -56,7 +59,7 @@ func (tm *TokenManifest) AddItem(path string, size int64, sha256 string, truncat
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	tm.CollectedFiles++
@@ -0,0 +1,185 @@
+package win_tokens
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dangerousPrivileges are privileges that enable credential theft, token
+// impersonation, or kernel access when enabled in a token.
+var dangerousPrivileges = map[string]bool{
+	"SeDebugPrivilege":              true,
+	"SeBackupPrivilege":             true,
+	"SeRestorePrivilege":            true,
+	"SeImpersonatePrivilege":        true,
+	"SeAssignPrimaryTokenPrivilege": true,
+	"SeTcbPrivilege":                true,
+	"SeLoadDriverPrivilege":         true,
+	"SeTakeOwnershipPrivilege":      true,
+	"SeCreateTokenPrivilege":        true,
+}
+
+// TokenUser is the user section of whoami /all.
+type TokenUser struct {
+	Name string `json:"name"`
+	SID  string `json:"sid"`
+}
+
+// TokenGroup is a single group entry from whoami /all.
+type TokenGroup struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	SID        string   `json:"sid"`
+	Attributes []string `json:"attributes"`
+	Enabled    bool     `json:"enabled"`
+	DenyOnly   bool     `json:"deny_only"`
+	Integrity  bool     `json:"integrity_label,omitempty"`
+}
+
+// TokenPrivilege is a single privilege entry from whoami /all.
+type TokenPrivilege struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Dangerous   bool   `json:"dangerous,omitempty"`
+}
+
+// TokenInfo is the structure written to token_info.json.
+type TokenInfo struct {
+	CollectedUTC   string           `json:"collected_utc"`
+	User           TokenUser        `json:"user"`
+	Groups         []TokenGroup     `json:"groups"`
+	Privileges     []TokenPrivilege `json:"privileges"`
+	IntegrityLevel string           `json:"integrity_level,omitempty"`
+	Findings       []string         `json:"findings"`
+}
+
+// ParseWhoamiCSV parses the output of `whoami /all /fo csv`, which emits the user,
+// group, and privilege tables as consecutive CSV sections each with its own header.
+func ParseWhoamiCSV(data []byte) (*TokenInfo, error) {
+	info := &TokenInfo{
+		Groups:     make([]TokenGroup, 0),
+		Privileges: make([]TokenPrivilege, 0),
+		Findings:   make([]string, 0),
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	section := ""
+	sawHeader := false
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return info, fmt.Errorf("failed to parse whoami CSV: %w", err)
+		}
+		if len(row) == 0 || (len(row) == 1 && strings.TrimSpace(row[0]) == "") {
+			continue
+		}
+
+		switch strings.ToLower(strings.TrimSpace(row[0])) {
+		case "user name":
+			section, sawHeader = "user", true
+			continue
+		case "group name":
+			section, sawHeader = "group", true
+			continue
+		case "privilege name":
+			section, sawHeader = "privilege", true
+			continue
+		}
+
+		switch section {
+		case "user":
+			if len(row) >= 2 {
+				info.User = TokenUser{Name: row[0], SID: row[1]}
+			}
+		case "group":
+			if len(row) >= 4 {
+				info.Groups = append(info.Groups, newTokenGroup(row))
+			}
+		case "privilege":
+			if len(row) >= 3 {
+				info.Privileges = append(info.Privileges, newTokenPrivilege(row))
+			}
+		}
+	}
+
+	if !sawHeader {
+		return info, fmt.Errorf("no whoami CSV sections found")
+	}
+
+	info.Findings = tokenFindings(info)
+	return info, nil
+}
+
+// newTokenGroup builds a group entry from a CSV row.
+func newTokenGroup(row []string) TokenGroup {
+	group := TokenGroup{
+		Name:       row[0],
+		Type:       row[1],
+		SID:        row[2],
+		Attributes: make([]string, 0),
+	}
+
+	for _, attr := range strings.Split(row[3], ",") {
+		attr = strings.TrimSpace(attr)
+		if attr == "" {
+			continue
+		}
+		group.Attributes = append(group.Attributes, attr)
+		lower := strings.ToLower(attr)
+		if lower == "enabled group" {
+			group.Enabled = true
+		}
+		if strings.Contains(lower, "deny only") {
+			group.DenyOnly = true
+		}
+	}
+
+	// Mandatory integrity labels use the S-1-16 authority
+	if strings.EqualFold(group.Type, "Label") || strings.HasPrefix(group.SID, "S-1-16-") {
+		group.Integrity = true
+	}
+
+	return group
+}
+
+// newTokenPrivilege builds a privilege entry from a CSV row.
+func newTokenPrivilege(row []string) TokenPrivilege {
+	return TokenPrivilege{
+		Name:        row[0],
+		Description: row[1],
+		Enabled:     strings.EqualFold(strings.TrimSpace(row[2]), "Enabled"),
+		Dangerous:   dangerousPrivileges[row[0]],
+	}
+}
+
+// tokenFindings derives noteworthy indicators from the parsed token.
+func tokenFindings(info *TokenInfo) []string {
+	findings := make([]string, 0)
+
+	for _, group := range info.Groups {
+		if group.Integrity {
+			info.IntegrityLevel = group.Name
+		}
+		if group.DenyOnly {
+			findings = append(findings, fmt.Sprintf("deny-only group: %s (%s)", group.Name, group.SID))
+		}
+	}
+
+	for _, priv := range info.Privileges {
+		if priv.Dangerous && priv.Enabled {
+			findings = append(findings, fmt.Sprintf("dangerous privilege enabled: %s", priv.Name))
+		}
+	}
+
+	return findings
+}
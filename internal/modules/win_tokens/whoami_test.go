@@ -0,0 +1,78 @@
+package win_tokens
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sampleWhoamiCSV is `whoami /all /fo csv` from a filtered administrator token
+// in which SeDebugPrivilege has since been enabled.
+const sampleWhoamiCSV = "\r\n" +
+	`"User Name","SID"` + "\r\n" +
+	`"finance-ws7\alice","S-1-5-21-3623811015-3361044348-30300820-1013"` + "\r\n" +
+	"\r\n" +
+	`"Group Name","Type","SID","Attributes"` + "\r\n" +
+	`"Everyone","Well-known group","S-1-1-0","Mandatory group, Enabled by default, Enabled group"` + "\r\n" +
+	`"BUILTIN\Administrators","Alias","S-1-5-32-544","Group used for deny only"` + "\r\n" +
+	`"BUILTIN\Users","Alias","S-1-5-32-545","Mandatory group, Enabled by default, Enabled group"` + "\r\n" +
+	`"NT AUTHORITY\INTERACTIVE","Well-known group","S-1-5-4","Mandatory group, Enabled by default, Enabled group"` + "\r\n" +
+	`"Mandatory Label\Medium Mandatory Level","Label","S-1-16-8192",""` + "\r\n" +
+	"\r\n" +
+	`"Privilege Name","Description","State"` + "\r\n" +
+	`"SeShutdownPrivilege","Shut down the system","Disabled"` + "\r\n" +
+	`"SeChangeNotifyPrivilege","Bypass traverse checking","Enabled"` + "\r\n" +
+	`"SeDebugPrivilege","Debug programs","Enabled"` + "\r\n" +
+	`"SeImpersonatePrivilege","Impersonate a client after authentication","Disabled"` + "\r\n"
+
+func TestParseWhoamiCSV(t *testing.T) {
+	info, err := ParseWhoamiCSV([]byte("\xef\xbb\xbf" + sampleWhoamiCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.User != (TokenUser{Name: `finance-ws7\alice`, SID: "S-1-5-21-3623811015-3361044348-30300820-1013"}) {
+		t.Errorf("user = %+v", info.User)
+	}
+	if len(info.Groups) != 5 || len(info.Privileges) != 4 {
+		t.Fatalf("parsed %d groups and %d privileges, want 5 and 4", len(info.Groups), len(info.Privileges))
+	}
+
+	admins := info.Groups[1]
+	if admins.SID != "S-1-5-32-544" || !admins.DenyOnly || admins.Enabled || !reflect.DeepEqual(admins.Attributes, []string{"Group used for deny only"}) {
+		t.Errorf("deny-only group = %+v", admins)
+	}
+	everyone := info.Groups[0]
+	if !everyone.Enabled || everyone.DenyOnly || len(everyone.Attributes) != 3 {
+		t.Errorf("enabled group = %+v", everyone)
+	}
+	if label := info.Groups[4]; !label.Integrity || len(label.Attributes) != 0 {
+		t.Errorf("integrity label = %+v", label)
+	}
+	if info.IntegrityLevel != `Mandatory Label\Medium Mandatory Level` {
+		t.Errorf("integrity level = %q", info.IntegrityLevel)
+	}
+
+	debug := info.Privileges[2]
+	if debug.Name != "SeDebugPrivilege" || !debug.Enabled || !debug.Dangerous {
+		t.Errorf("SeDebugPrivilege = %+v", debug)
+	}
+	if impersonate := info.Privileges[3]; impersonate.Enabled || !impersonate.Dangerous {
+		t.Errorf("SeImpersonatePrivilege = %+v", impersonate)
+	}
+
+	// A disabled dangerous privilege is not a finding
+	want := []string{
+		"deny-only group: BUILTIN\\Administrators (S-1-5-32-544)",
+		"dangerous privilege enabled: SeDebugPrivilege",
+	}
+	if !reflect.DeepEqual(info.Findings, want) {
+		t.Errorf("findings = %q, want %q", info.Findings, want)
+	}
+}
+
+func TestParseWhoamiCSVRejectsPlainText(t *testing.T) {
+	text := "USER INFORMATION\r\n----------------\r\n\r\nUser Name         SID\r\n"
+	if _, err := ParseWhoamiCSV([]byte(text)); err == nil || !strings.Contains(err.Error(), "no whoami CSV sections") {
+		t.Fatalf("table output = %v, want an error", err)
+	}
+}
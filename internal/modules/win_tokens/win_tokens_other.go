@@ -19,6 +19,16 @@ func (w *WinTokens) Name() string {
 	return "windows/tokens"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinTokens) Describe() string {
+	return "Access tokens and privileges"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinTokens) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinTokens) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
@@ -4,6 +4,7 @@ package win_tokens
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -24,6 +25,16 @@ func (w *WinTokens) Name() string {
 	return "windows/tokens"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinTokens) Describe() string {
+	return "Access tokens and privileges"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinTokens) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers access tokens and privileges information.
 func (w *WinTokens) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/tokens subdirectory
@@ -33,13 +44,13 @@ func (w *WinTokens) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewTokenManifest(hostname)
+	manifest := NewTokenManifest(ctx, hostname)
 
 	// Collect access tokens information
 	if err := w.collectAccessTokens(ctx, tokensDir, manifest); err != nil {
@@ -56,6 +67,11 @@ func (w *WinTokens) Collect(ctx context.Context, outDir string) error {
 		manifest.AddError("token_groups", fmt.Sprintf("Failed to collect token groups: %v", err))
 	}
 
+	// Collect structured token information
+	if err := w.collectTokenInfo(ctx, tokensDir, manifest); err != nil {
+		manifest.AddError("token_info", fmt.Sprintf("Failed to collect structured token info: %v", err))
+	}
+
 	// Write manifest
 	manifestPath := filepath.Join(tokensDir, "manifest.json")
 	if err := manifest.WriteManifest(manifestPath); err != nil {
@@ -110,7 +126,7 @@ func (w *WinTokens) collectAccessTokens(ctx context.Context, outDir string, mani
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("access_tokens.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "access_tokens", "Access token information for current process")
 			manifest.IncrementTotalFiles()
 		}
@@ -119,6 +135,41 @@ func (w *WinTokens) collectAccessTokens(ctx context.Context, outDir string, mani
 	return nil
 }
 
+// collectTokenInfo parses `whoami /all /fo csv` into token_info.json.
+func (w *WinTokens) collectTokenInfo(ctx context.Context, outDir string, manifest *TokenManifest) error {
+	outputPath := filepath.Join(outDir, "token_info.json")
+
+	result, err := winutil.RunCommandWithOutput(ctx, "whoami", []string{"/all", "/fo", "csv"})
+	if err != nil {
+		return fmt.Errorf("failed to run whoami /all /fo csv: %w", err)
+	}
+
+	info, err := ParseWhoamiCSV(result)
+	if err != nil {
+		return err
+	}
+	info.CollectedUTC = winutil.FormatTime(winutil.Now(ctx))
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal token info: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write token info: %w", err)
+	}
+
+	// Add to manifest
+	if stat, err := os.Stat(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
+			note := fmt.Sprintf("Structured token user, groups, and privileges (%d findings)", len(info.Findings))
+			manifest.AddItem("token_info.json", stat.Size(), sha256Hex, false, stat.ModTime(), "token_info", note)
+			manifest.IncrementTotalFiles()
+		}
+	}
+
+	return nil
+}
+
 // collectPrivileges collects privileges and user rights information.
 func (w *WinTokens) collectPrivileges(ctx context.Context, outDir string, manifest *TokenManifest) error {
 	outputPath := filepath.Join(outDir, "privileges.txt")
@@ -176,7 +227,7 @@ func (w *WinTokens) collectPrivileges(ctx context.Context, outDir string, manife
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("privileges.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "privileges", "User privileges and rights assignments")
 			manifest.IncrementTotalFiles()
 		}
@@ -256,7 +307,7 @@ func (w *WinTokens) collectTokenGroups(ctx context.Context, outDir string, manif
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("token_groups.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "token_groups", "Token groups and SID information")
 			manifest.IncrementTotalFiles()
 		}
@@ -2,9 +2,13 @@
 package win_trustedinstaller
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
 )
 
 // TrustedInstallerItem represents a collected TrustedInstaller-related file.
@@ -34,12 +38,13 @@ type TrustedInstallerManifest struct {
 	TotalFiles         int                      `json:"total_files"`
 	CollectedFiles     int                      `json:"collected_files"`
 	IntegrityViolations int                     `json:"integrity_violations"`
+	Summary             schema.Summary          `json:"summary"`
 }
 
 // NewTrustedInstallerManifest creates a new TrustedInstaller manifest with basic information.
-func NewTrustedInstallerManifest(hostname string) *TrustedInstallerManifest {
+func NewTrustedInstallerManifest(ctx context.Context, hostname string) *TrustedInstallerManifest {
 	return &TrustedInstallerManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]TrustedInstallerItem, 0),
@@ -47,6 +52,7 @@ func NewTrustedInstallerManifest(hostname string) *TrustedInstallerManifest {
 		TotalFiles:         0,
 		CollectedFiles:     0,
 		IntegrityViolations: 0,
+		Summary:            schema.NewSummary(),
 	}
 }
 
@@ -58,7 +64,7 @@ func (tim *TrustedInstallerManifest) AddItem(path string, size int64, sha256 str
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	tim.CollectedFiles++
@@ -80,6 +86,7 @@ func (tim *TrustedInstallerManifest) IncrementTotalFiles() {
 // SetIntegrityViolations sets the number of integrity violations found.
 func (tim *TrustedInstallerManifest) SetIntegrityViolations(count int) {
 	tim.IntegrityViolations = count
+	tim.Summary.Set(schema.SummaryIntegrityViolations, count)
 }
 
 // WriteManifest writes the manifest to a JSON file.
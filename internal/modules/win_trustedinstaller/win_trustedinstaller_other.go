@@ -19,6 +19,16 @@ func (w *WinTrustedInstaller) Name() string {
 	return "windows/trustedinstaller"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinTrustedInstaller) Describe() string {
+	return "TrustedInstaller and system integrity"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinTrustedInstaller) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinTrustedInstaller) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
@@ -25,6 +25,16 @@ func (w *WinTrustedInstaller) Name() string {
 	return "windows/trustedinstaller"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinTrustedInstaller) Describe() string {
+	return "TrustedInstaller and system integrity"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinTrustedInstaller) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers TrustedInstaller and system integrity information.
 func (w *WinTrustedInstaller) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/trustedinstaller subdirectory
@@ -34,13 +44,13 @@ func (w *WinTrustedInstaller) Collect(ctx context.Context, outDir string) error
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewTrustedInstallerManifest(hostname)
+	manifest := NewTrustedInstallerManifest(ctx, hostname)
 
 	// Collect TrustedInstaller information
 	if err := w.collectTrustedInstallerInfo(ctx, tiDir, manifest); err != nil {
@@ -94,10 +104,7 @@ func (w *WinTrustedInstaller) collectTrustedInstallerInfo(ctx context.Context, o
 
 	// Check file ownership of critical system files
 	output += "=== Critical System File Ownership ===\n"
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	criticalFiles := []string{
 		systemDrive + "\\Windows\\System32\\kernel32.dll",
@@ -132,7 +139,7 @@ func (w *WinTrustedInstaller) collectTrustedInstallerInfo(ctx context.Context, o
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("trusted_installer.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "trusted_installer", "TrustedInstaller service and file ownership information")
 			manifest.IncrementTotalFiles()
 		}
@@ -156,7 +163,7 @@ func (w *WinTrustedInstaller) collectSystemIntegrity(ctx context.Context, outDir
 	output += "Checking SFC scan history...\n"
 	
 	// Check CBS log for recent SFC activity
-	cbsLogPath := os.Getenv("SystemRoot") + "\\Logs\\CBS\\CBS.log"
+	cbsLogPath := winutil.SystemRoot() + "\\Logs\\CBS\\CBS.log"
 	if _, err := os.Stat(cbsLogPath); err == nil {
 		// Get last few lines of CBS log
 		tailCmd := []string{"/C", fmt.Sprintf("powershell \"Get-Content '%s' | Select-Object -Last 20\"", cbsLogPath)}
@@ -218,7 +225,7 @@ func (w *WinTrustedInstaller) collectSystemIntegrity(ctx context.Context, outDir
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			note := fmt.Sprintf("System integrity verification results (%d violations found)", violationCount)
 			manifest.AddItem("system_integrity.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "system_integrity", note)
 			manifest.IncrementTotalFiles()
@@ -289,7 +296,7 @@ func (w *WinTrustedInstaller) collectWFPInfo(ctx context.Context, outDir string,
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("wfp_info.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "wfp_info", "Windows File Protection and Resource Protection information")
 			manifest.IncrementTotalFiles()
 		}
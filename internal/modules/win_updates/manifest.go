@@ -0,0 +1,100 @@
+// Package win_updates provides Windows Update history and patch state collection for cryptkeeper.
+package win_updates
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
+)
+
+// UpdatesItem represents a collected Windows Update artifact.
+type UpdatesItem struct {
+	Path      string `json:"path"`           // Relative path in the archive
+	Size      int64  `json:"size"`           // File size in bytes
+	SHA256    string `json:"sha256"`         // SHA-256 hash
+	Truncated bool   `json:"truncated"`      // Whether the file was truncated due to size limits
+	Note      string `json:"note,omitempty"` // Description of the file
+	Modified  string `json:"modified"`       // File modification time (RFC3339)
+	FileType  string `json:"file_type"`      // Type: "update_history", "datastore", "log"
+}
+
+// UpdatesError represents an error that occurred during collection.
+type UpdatesError struct {
+	Target string `json:"target"` // What failed (e.g., specific file path)
+	Error  string `json:"error"`  // Error message
+}
+
+// UpdatesManifest represents the complete manifest for Windows Update collection.
+type UpdatesManifest struct {
+	CreatedUTC         string         `json:"created_utc"`
+	Host               string         `json:"host"`
+	CryptkeeperVersion string         `json:"cryptkeeper_version"`
+	Items              []UpdatesItem  `json:"items"`
+	Errors             []UpdatesError `json:"errors"`
+	TotalFiles         int            `json:"total_files"`
+	CollectedFiles     int            `json:"collected_files"`
+	UpdatesFound       int            `json:"updates_found"`
+	Summary            schema.Summary `json:"summary"`
+}
+
+// NewUpdatesManifest creates a new Windows Update manifest with basic information.
+func NewUpdatesManifest(ctx context.Context, hostname string) *UpdatesManifest {
+	return &UpdatesManifest{
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
+		Host:               hostname,
+		CryptkeeperVersion: "v0.1.0",
+		Items:              make([]UpdatesItem, 0),
+		Errors:             make([]UpdatesError, 0),
+		TotalFiles:         0,
+		CollectedFiles:     0,
+		UpdatesFound:       0,
+		Summary:            schema.NewSummary(),
+	}
+}
+
+// AddItem adds a successfully collected Windows Update item to the manifest.
+func (um *UpdatesManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, note string) {
+	um.Items = append(um.Items, UpdatesItem{
+		Path:      path,
+		Size:      size,
+		SHA256:    sha256,
+		Truncated: truncated,
+		Note:      note,
+		Modified:  winutil.FormatTime(modified),
+		FileType:  fileType,
+	})
+	um.CollectedFiles++
+}
+
+// AddError adds an error to the manifest for a failed collection.
+func (um *UpdatesManifest) AddError(target, errorMsg string) {
+	um.Errors = append(um.Errors, UpdatesError{
+		Target: target,
+		Error:  errorMsg,
+	})
+}
+
+// IncrementTotalFiles increments the count of total files found.
+func (um *UpdatesManifest) IncrementTotalFiles() {
+	um.TotalFiles++
+}
+
+// SetUpdatesFound sets the number of installed updates found.
+func (um *UpdatesManifest) SetUpdatesFound(count int) {
+	um.UpdatesFound = count
+	um.Summary.Set(schema.SummaryInstalledUpdates, count)
+}
+
+// WriteManifest writes the manifest to a JSON file.
+func (um *UpdatesManifest) WriteManifest(manifestPath string) error {
+	data, err := json.MarshalIndent(um, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath, data, 0644)
+}
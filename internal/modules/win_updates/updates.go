@@ -0,0 +1,452 @@
+package win_updates
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// Registry keys holding Windows Update policy and update service state.
+const (
+	wuPolicyKey   = `HKLM\SOFTWARE\Policies\Microsoft\Windows\WindowsUpdate`
+	auPolicyKey   = `HKLM\SOFTWARE\Policies\Microsoft\Windows\WindowsUpdate\AU`
+	uxSettingsKey = `HKLM\SOFTWARE\Microsoft\WindowsUpdate\UX\Settings`
+	servicesKey   = `HKLM\SYSTEM\CurrentControlSet\Services`
+)
+
+// updateServices must be able to start for Windows Update to patch the system.
+var updateServices = []string{"wuauserv", "UsoSvc", "WaaSMedicSvc"}
+
+// serviceStartDisabled is the Start value of a disabled service.
+const serviceStartDisabled = 4
+
+// staleUpdateWindow defines how old the newest installed update may be before
+// the system is flagged as missing recent updates.
+const staleUpdateWindow = 60 * 24 * time.Hour
+
+// DefaultDataStoreCapMB is the largest DataStore.edb copied by default.
+const DefaultDataStoreCapMB = 512
+
+// Update history sources.
+const (
+	SourceGetHotFix    = "get_hotfix"
+	SourceWMICQFE      = "wmic_qfe"
+	SourceUpdateEvents = "update_client_events"
+)
+
+// Windows Update findings.
+const (
+	FindingNoRecentUpdates = "no_recent_updates"
+	FindingUpdatesDisabled = "updates_disabled_by_policy"
+	FindingServiceDisabled = "update_service_disabled"
+	FindingUpdatesPaused   = "updates_paused"
+	FindingWSUSOverHTTP    = "wsus_over_http"
+	FindingInstallFailures = "update_install_failures"
+)
+
+// updateEventStatus maps Microsoft-Windows-WindowsUpdateClient event IDs in
+// the System log to the installation step they record.
+var updateEventStatus = map[int]string{
+	19: "installed",
+	20: "failed",
+	43: "started",
+}
+
+var kbPattern = regexp.MustCompile(`KB\d{6,8}`)
+
+// HotFix is an installed update as listed by Get-HotFix or wmic qfe.
+type HotFix struct {
+	HotFixID    string `json:"hotfix_id"`
+	Description string `json:"description,omitempty"`
+	InstalledBy string `json:"installed_by,omitempty"`
+	InstalledOn string `json:"installed_on,omitempty"` // YYYY-MM-DD when the date could be parsed, else as reported
+	Source      string `json:"source"`
+}
+
+// UpdateEvent is a Windows Update client installation event.
+type UpdateEvent struct {
+	TimeUTC string `json:"time_utc"`
+	EventID int    `json:"event_id"`
+	Status  string `json:"status"` // "installed", "failed", or "started"
+	Title   string `json:"title,omitempty"`
+	KB      string `json:"kb,omitempty"`
+}
+
+// UpdatePolicy is the Windows Update configuration read from the registry.
+type UpdatePolicy struct {
+	NoAutoUpdate               *uint64           `json:"no_auto_update,omitempty"`
+	AUOptions                  *uint64           `json:"au_options,omitempty"`
+	DisableWindowsUpdateAccess *uint64           `json:"disable_windows_update_access,omitempty"`
+	UseWUServer                *uint64           `json:"use_wu_server,omitempty"`
+	WUServer                   string            `json:"wu_server,omitempty"`
+	WUStatusServer             string            `json:"wu_status_server,omitempty"`
+	PauseUpdatesExpiryTime     string            `json:"pause_updates_expiry_time,omitempty"`
+	ServiceStart               map[string]uint64 `json:"service_start,omitempty"` // Start value per update service
+}
+
+// DataStoreInfo describes the Windows Update DataStore.edb database.
+type DataStoreInfo struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified"`         // RFC3339 UTC
+	Copied   bool   `json:"copied"`           // Copied into the collection (under the cap)
+	Source   string `json:"source,omitempty"` // "copy" or "shadow_copy" when copied
+	SHA256   string `json:"sha256,omitempty"` // Set when copied
+	Error    string `json:"error,omitempty"`
+}
+
+// UpdateHistory is the structure written to update_history.json.
+type UpdateHistory struct {
+	CollectedUTC      string         `json:"collected_utc"`
+	Sources           []string       `json:"sources"` // History sources that produced output
+	HotFixes          []HotFix       `json:"hotfixes"`
+	Events            []UpdateEvent  `json:"events"`
+	LastInstalledDate string         `json:"last_installed_date,omitempty"` // Newest install date from any source
+	Policy            UpdatePolicy   `json:"policy"`
+	DataStore         *DataStoreInfo `json:"datastore,omitempty"`
+	Findings          []string       `json:"findings"`
+	Errors            []string       `json:"errors,omitempty"`
+}
+
+// rawHotFix is one object of the Get-HotFix JSON written by the collector,
+// with InstalledOn already formatted as yyyy-MM-dd.
+type rawHotFix struct {
+	HotFixID    string `json:"HotFixID"`
+	Description string `json:"Description"`
+	InstalledBy string `json:"InstalledBy"`
+	InstalledOn string `json:"InstalledOn"`
+}
+
+// ParseHotFixes decodes Get-HotFix output converted to JSON.
+func ParseHotFixes(data []byte) ([]HotFix, error) {
+	var raws []rawHotFix
+	if err := unmarshalPowerShellJSON(data, &raws); err != nil {
+		return nil, fmt.Errorf("failed to parse Get-HotFix output: %w", err)
+	}
+
+	hotfixes := make([]HotFix, 0, len(raws))
+	for _, raw := range raws {
+		if raw.HotFixID == "" {
+			continue
+		}
+		hotfixes = append(hotfixes, HotFix{
+			HotFixID:    strings.TrimSpace(raw.HotFixID),
+			Description: strings.TrimSpace(raw.Description),
+			InstalledBy: strings.TrimSpace(raw.InstalledBy),
+			InstalledOn: normalizeInstallDate(raw.InstalledOn),
+			Source:      SourceGetHotFix,
+		})
+	}
+	return hotfixes, nil
+}
+
+// ParseQFE decodes `wmic qfe get ... /format:csv` output. Columns are located
+// by the header row, which wmic prints after a blank line.
+func ParseQFE(output []byte) ([]HotFix, error) {
+	text := strings.ReplaceAll(string(output), "\r", "")
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse wmic qfe output: %w", err)
+	}
+
+	hotfixes := make([]HotFix, 0)
+	var columns map[string]int
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	for _, record := range records {
+		if columns == nil {
+			for _, cell := range record {
+				if strings.EqualFold(strings.TrimSpace(cell), "HotFixID") {
+					columns = make(map[string]int, len(record))
+					for i, name := range record {
+						columns[strings.ToLower(strings.TrimSpace(name))] = i
+					}
+					break
+				}
+			}
+			continue
+		}
+		id := field(record, "hotfixid")
+		if id == "" {
+			continue
+		}
+		hotfixes = append(hotfixes, HotFix{
+			HotFixID:    id,
+			Description: field(record, "description"),
+			InstalledBy: field(record, "installedby"),
+			InstalledOn: normalizeInstallDate(field(record, "installedon")),
+			Source:      SourceWMICQFE,
+		})
+	}
+	if columns == nil {
+		return nil, fmt.Errorf("wmic qfe output has no header row")
+	}
+	return hotfixes, nil
+}
+
+// normalizeInstallDate renders an InstalledOn value as YYYY-MM-DD. wmic
+// reports M/D/YYYY or, for some updates, a hex FILETIME; values that match
+// neither are returned unchanged.
+func normalizeInstallDate(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	for _, layout := range []string{"2006-01-02", "1/2/2006", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	if len(value) == 16 {
+		if raw, err := strconv.ParseUint(value, 16, 64); err == nil {
+			if t := winutil.FiletimeToUTC(raw); !t.IsZero() {
+				return t.Format("2006-01-02")
+			}
+		}
+	}
+	return value
+}
+
+// rawUpdateEvent is one object of the Get-WinEvent JSON written by the collector.
+type rawUpdateEvent struct {
+	TimeCreated string `json:"TimeCreated"` // Round-trip ("o") format, UTC
+	ID          int    `json:"Id"`
+	Title       string `json:"Title"`
+}
+
+// ParseUpdateEvents decodes WindowsUpdateClient events converted to JSON,
+// newest first as Get-WinEvent returns them.
+func ParseUpdateEvents(data []byte) ([]UpdateEvent, error) {
+	var raws []rawUpdateEvent
+	if err := unmarshalPowerShellJSON(data, &raws); err != nil {
+		return nil, fmt.Errorf("failed to parse update events: %w", err)
+	}
+
+	events := make([]UpdateEvent, 0, len(raws))
+	for _, raw := range raws {
+		status, ok := updateEventStatus[raw.ID]
+		if !ok {
+			continue
+		}
+		event := UpdateEvent{
+			TimeUTC: raw.TimeCreated,
+			EventID: raw.ID,
+			Status:  status,
+			Title:   strings.TrimSpace(raw.Title),
+			KB:      kbPattern.FindString(raw.Title),
+		}
+		if t, err := time.Parse(time.RFC3339Nano, raw.TimeCreated); err == nil {
+			event.TimeUTC = winutil.FormatTime(t)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// ParseUpdatePolicy reads the Windows Update policy values and update service
+// start types from registry keys, as listed by reg query or HiveRegKey.
+func ParseUpdatePolicy(keys []winutil.RegKey) UpdatePolicy {
+	policy := UpdatePolicy{ServiceStart: make(map[string]uint64)}
+	dword := func(key winutil.RegKey, name string) *uint64 {
+		if v, ok := key.DWORD(name); ok {
+			return &v
+		}
+		return nil
+	}
+	str := func(key winutil.RegKey, name string) string {
+		if v, ok := key.Value(name); ok {
+			return strings.TrimSpace(v.Data)
+		}
+		return ""
+	}
+
+	for _, key := range keys {
+		path := normalizeKey(key.Path)
+		switch {
+		case strings.EqualFold(path, wuPolicyKey):
+			policy.DisableWindowsUpdateAccess = dword(key, "DisableWindowsUpdateAccess")
+			policy.WUServer = str(key, "WUServer")
+			policy.WUStatusServer = str(key, "WUStatusServer")
+		case strings.EqualFold(path, auPolicyKey):
+			policy.NoAutoUpdate = dword(key, "NoAutoUpdate")
+			policy.AUOptions = dword(key, "AUOptions")
+			policy.UseWUServer = dword(key, "UseWUServer")
+		case strings.EqualFold(path, uxSettingsKey):
+			policy.PauseUpdatesExpiryTime = str(key, "PauseUpdatesExpiryTime")
+		default:
+			for _, service := range updateServices {
+				if strings.EqualFold(path, servicesKey+`\`+service) {
+					if start, ok := key.DWORD("Start"); ok {
+						policy.ServiceStart[service] = start
+					}
+				}
+			}
+		}
+	}
+	return policy
+}
+
+var controlSetPattern = regexp.MustCompile(`(?i)\\ControlSet\d{3}\\`)
+
+// normalizeKey rewrites a reg query key path in the HKLM\...\CurrentControlSet form used above.
+func normalizeKey(path string) string {
+	if len(path) >= len(`HKEY_LOCAL_MACHINE`) && strings.EqualFold(path[:len(`HKEY_LOCAL_MACHINE`)], `HKEY_LOCAL_MACHINE`) {
+		path = "HKLM" + path[len(`HKEY_LOCAL_MACHINE`):]
+	}
+	return controlSetPattern.ReplaceAllString(path, `\CurrentControlSet\`)
+}
+
+// HiveRegKey reads a key of an offline hive into the reg query form, under
+// displayPath. Integer values are rendered as 0x-prefixed hex and string
+// values as text; other types are skipped. A missing key yields regf.ErrNotFound.
+func HiveRegKey(hive *regf.Hive, path, displayPath string) (winutil.RegKey, error) {
+	key, err := hive.OpenKey(path)
+	if err != nil {
+		return winutil.RegKey{}, err
+	}
+	values, err := key.Values()
+	if err != nil {
+		return winutil.RegKey{}, err
+	}
+
+	regKey := winutil.RegKey{Path: displayPath, Values: make([]winutil.RegValue, 0, len(values))}
+	for _, value := range values {
+		if n, ok := value.Uint64(); ok {
+			regKey.Values = append(regKey.Values, winutil.RegValue{Name: value.Name, Type: "REG_DWORD", Data: fmt.Sprintf("0x%x", n)})
+		} else if s := value.String(); s != "" {
+			regKey.Values = append(regKey.Values, winutil.RegValue{Name: value.Name, Type: "REG_SZ", Data: s})
+		}
+	}
+	return regKey, nil
+}
+
+// currentControlSet returns the ControlSet00N key name that Select\Current
+// points at; a hive file has no CurrentControlSet link.
+func currentControlSet(hive *regf.Hive) (string, error) {
+	selectKey, err := hive.OpenKey("Select")
+	if err != nil {
+		return "", fmt.Errorf("failed to open Select key: %w", err)
+	}
+	value, err := selectKey.Value("Current")
+	if err != nil {
+		return "", fmt.Errorf("failed to read Select\\Current: %w", err)
+	}
+	current, ok := value.Uint64()
+	if !ok || current == 0 {
+		return "", fmt.Errorf("invalid Select\\Current value")
+	}
+	return fmt.Sprintf("ControlSet%03d", current), nil
+}
+
+// FinalizeHistory sorts the hotfixes, records the newest install date, and
+// flags missing recent updates and disabled, paused, or redirected updating
+// relative to now.
+func FinalizeHistory(history *UpdateHistory, now time.Time) {
+	sort.SliceStable(history.HotFixes, func(i, j int) bool {
+		a, b := history.HotFixes[i], history.HotFixes[j]
+		if a.InstalledOn != b.InstalledOn {
+			return a.InstalledOn > b.InstalledOn
+		}
+		return a.HotFixID < b.HotFixID
+	})
+
+	var newest time.Time
+	for _, hotfix := range history.HotFixes {
+		if t, err := time.Parse("2006-01-02", hotfix.InstalledOn); err == nil && t.After(newest) {
+			newest = t
+		}
+	}
+	failures := 0
+	for _, event := range history.Events {
+		t, err := winutil.ParseTime(event.TimeUTC)
+		if err != nil {
+			continue
+		}
+		switch event.Status {
+		case "installed":
+			if t.After(newest) {
+				newest = t
+			}
+		case "failed":
+			failures++
+		}
+	}
+
+	switch {
+	case !newest.IsZero():
+		history.LastInstalledDate = newest.Format("2006-01-02")
+		if age := now.Sub(newest); age > staleUpdateWindow {
+			history.Findings = append(history.Findings, fmt.Sprintf("%s: newest installed update dated %s, %d days before collection",
+				FindingNoRecentUpdates, history.LastInstalledDate, int(age.Hours()/24)))
+		}
+	case history.hotfixesListed() && len(history.HotFixes) == 0:
+		history.Findings = append(history.Findings, FindingNoRecentUpdates+": no installed updates recorded")
+	}
+
+	policy := history.Policy
+	if policy.NoAutoUpdate != nil && *policy.NoAutoUpdate == 1 {
+		history.Findings = append(history.Findings, FindingUpdatesDisabled+": NoAutoUpdate=1 disables automatic updates")
+	}
+	if policy.AUOptions != nil && *policy.AUOptions == 1 {
+		history.Findings = append(history.Findings, FindingUpdatesDisabled+": AUOptions=1 never checks for updates")
+	}
+	if policy.DisableWindowsUpdateAccess != nil && *policy.DisableWindowsUpdateAccess == 1 {
+		history.Findings = append(history.Findings, FindingUpdatesDisabled+": DisableWindowsUpdateAccess=1 blocks Windows Update")
+	}
+	for _, service := range updateServices {
+		if start, ok := policy.ServiceStart[service]; ok && start == serviceStartDisabled {
+			history.Findings = append(history.Findings, fmt.Sprintf("%s: %s Start=4 (disabled)", FindingServiceDisabled, service))
+		}
+	}
+	if policy.PauseUpdatesExpiryTime != "" {
+		if until, err := time.Parse(time.RFC3339, policy.PauseUpdatesExpiryTime); err == nil && until.After(now) {
+			history.Findings = append(history.Findings, fmt.Sprintf("%s: paused until %s", FindingUpdatesPaused, until.UTC().Format(time.RFC3339)))
+		}
+	}
+	if policy.UseWUServer != nil && *policy.UseWUServer == 1 && strings.HasPrefix(strings.ToLower(policy.WUServer), "http://") {
+		history.Findings = append(history.Findings, fmt.Sprintf("%s: WUServer=%s can be spoofed by a network attacker", FindingWSUSOverHTTP, policy.WUServer))
+	}
+	if failures > 0 {
+		history.Findings = append(history.Findings, fmt.Sprintf("%s: %d failed update installations in the System log", FindingInstallFailures, failures))
+	}
+}
+
+// hotfixesListed reports whether Get-HotFix or wmic qfe produced a list, so
+// an empty HotFixes means none are installed rather than none were read.
+func (h *UpdateHistory) hotfixesListed() bool {
+	for _, source := range h.Sources {
+		if source == SourceGetHotFix || source == SourceWMICQFE {
+			return true
+		}
+	}
+	return false
+}
+
+// unmarshalPowerShellJSON decodes ConvertTo-Json output, which emits a bare object
+// instead of an array when the pipeline yields a single item.
+func unmarshalPowerShellJSON(data []byte, v interface{}) error {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] == '{' {
+		data = append(append([]byte("["), data...), ']')
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,172 @@
+package win_updates
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+	"cryptkeeper/internal/winutil"
+)
+
+// sampleHotFixes is the collector's Get-HotFix JSON: the last update is five
+// months old and one entry has an ID but no install date.
+const sampleHotFixes = "\xef\xbb\xbf" + `[
+{"HotFixID":"KB5031988","Description":"Update","InstalledBy":"NT AUTHORITY\\SYSTEM","InstalledOn":"2023-10-11"},
+{"HotFixID":"KB5032189 ","Description":"Security Update","InstalledBy":"","InstalledOn":"2023-11-14"},
+{"HotFixID":"KB5011048","Description":"Update","InstalledBy":"CORP\\admin","InstalledOn":null},
+{"HotFixID":"","Description":"","InstalledBy":"","InstalledOn":""}
+]`
+
+// sampleQFE is `wmic qfe get HotFixID,Description,InstalledBy,InstalledOn /format:csv` output.
+const sampleQFE = "\r\r\nNode,Description,HotFixID,InstalledBy,InstalledOn\r\r\n" +
+	"WS-0142,Update,KB5031988,NT AUTHORITY\\SYSTEM,10/11/2023\r\r\n" +
+	"WS-0142,Security Update,KB5032189,,11/14/2023\r\r\n" +
+	"WS-0142,Update,KB4562830,,01d6a1b2c3d4e5f6\r\r\n"
+
+func TestParseHotFixes(t *testing.T) {
+	hotfixes, err := ParseHotFixes([]byte(sampleHotFixes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HotFix{
+		{HotFixID: "KB5031988", Description: "Update", InstalledBy: `NT AUTHORITY\SYSTEM`, InstalledOn: "2023-10-11", Source: SourceGetHotFix},
+		{HotFixID: "KB5032189", Description: "Security Update", InstalledOn: "2023-11-14", Source: SourceGetHotFix},
+		{HotFixID: "KB5011048", Description: "Update", InstalledBy: `CORP\admin`, Source: SourceGetHotFix},
+	}
+	if !reflect.DeepEqual(hotfixes, want) {
+		t.Fatalf("hotfixes = %+v\nwant %+v", hotfixes, want)
+	}
+
+	// A host with one update emits a bare object
+	hotfixes, err = ParseHotFixes([]byte(`{"HotFixID":"KB5031988","Description":"Update","InstalledBy":"","InstalledOn":"2023-10-11"}`))
+	if err != nil || len(hotfixes) != 1 || hotfixes[0].HotFixID != "KB5031988" {
+		t.Fatalf("single hotfix = %+v, %v", hotfixes, err)
+	}
+	if _, err := ParseHotFixes([]byte("Get-HotFix : Access is denied")); err == nil {
+		t.Error("error text parsed as hotfixes")
+	}
+}
+
+func TestParseQFE(t *testing.T) {
+	hotfixes, err := ParseQFE([]byte(sampleQFE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotfixes) != 3 || hotfixes[0].InstalledOn != "2023-10-11" || hotfixes[1].InstalledOn != "2023-11-14" || hotfixes[0].Source != SourceWMICQFE {
+		t.Fatalf("hotfixes = %+v", hotfixes)
+	}
+	if hotfixes[2].InstalledOn != "2020-10-13" {
+		t.Errorf("FILETIME install date = %q", hotfixes[2].InstalledOn)
+	}
+	if _, err := ParseQFE([]byte("No Instance(s) Available.\r\n")); err == nil {
+		t.Error("output without a header row accepted")
+	}
+}
+
+func TestFinalizeHistoryFlagsStaleAndDisabledUpdates(t *testing.T) {
+	hotfixes, err := ParseHotFixes([]byte(sampleHotFixes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := ParseUpdateEvents([]byte(`[
+{"TimeCreated":"2023-12-12T18:04:51.1234567Z","Id":20,"Title":"2023-12 Cumulative Update for Windows 10 Version 22H2 for x64-based Systems (KB5033372)"},
+{"TimeCreated":"2023-12-12T17:58:02.0000000Z","Id":43,"Title":"2023-12 Cumulative Update for Windows 10 Version 22H2 for x64-based Systems (KB5033372)"},
+{"TimeCreated":"2023-11-14T19:30:00.0000000Z","Id":19,"Title":"Security Intelligence Update for Microsoft Defender Antivirus - KB2267602"},
+{"TimeCreated":"2023-11-14T19:00:00.0000000Z","Id":44,"Title":"downloading"}
+]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || events[0].Status != "failed" || events[0].KB != "KB5033372" || events[0].TimeUTC != winutil.FormatTime(time.Date(2023, 12, 12, 18, 4, 51, 123456700, time.UTC)) {
+		t.Fatalf("events = %+v", events)
+	}
+
+	keys := winutil.ParseRegQuery([]byte(strings.ReplaceAll(`
+HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Microsoft\Windows\WindowsUpdate
+    WUServer    REG_SZ    http://wsus.corp.example:8530
+    WUStatusServer    REG_SZ    http://wsus.corp.example:8530
+
+HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Microsoft\Windows\WindowsUpdate\AU
+    NoAutoUpdate    REG_DWORD    0x1
+    UseWUServer    REG_DWORD    0x1
+
+HKEY_LOCAL_MACHINE\SYSTEM\ControlSet001\Services\wuauserv
+    Start    REG_DWORD    0x4
+
+HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Services\UsoSvc
+    Start    REG_DWORD    0x2
+`, "\n", "\r\n")))
+	history := &UpdateHistory{
+		Sources:  []string{SourceGetHotFix, SourceUpdateEvents},
+		HotFixes: hotfixes,
+		Events:   events,
+		Policy:   ParseUpdatePolicy(keys),
+	}
+	FinalizeHistory(history, time.Date(2024, 4, 2, 12, 0, 0, 0, time.UTC))
+
+	var order []string
+	for _, hotfix := range history.HotFixes {
+		order = append(order, hotfix.HotFixID)
+	}
+	if want := []string{"KB5032189", "KB5031988", "KB5011048"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("hotfix order = %v, want %v", order, want)
+	}
+	if history.LastInstalledDate != "2023-11-14" {
+		t.Errorf("last installed = %q", history.LastInstalledDate)
+	}
+	want := []string{
+		FindingNoRecentUpdates + ": newest installed update dated 2023-11-14, 139 days before collection",
+		FindingUpdatesDisabled + ": NoAutoUpdate=1 disables automatic updates",
+		FindingServiceDisabled + ": wuauserv Start=4 (disabled)",
+		FindingWSUSOverHTTP + ": WUServer=http://wsus.corp.example:8530 can be spoofed by a network attacker",
+		FindingInstallFailures + ": 1 failed update installations in the System log",
+	}
+	if !reflect.DeepEqual(history.Findings, want) {
+		t.Errorf("findings = %q\nwant %q", history.Findings, want)
+	}
+
+	// An empty list from Get-HotFix means nothing is installed
+	empty := &UpdateHistory{Sources: []string{SourceGetHotFix}, HotFixes: []HotFix{}}
+	FinalizeHistory(empty, time.Now())
+	if len(empty.Findings) != 1 || empty.Findings[0] != FindingNoRecentUpdates+": no installed updates recorded" {
+		t.Errorf("findings with no hotfixes = %q", empty.Findings)
+	}
+}
+
+func TestHiveRegKeyReadsOfflineServices(t *testing.T) {
+	path := regftest.WriteFile(t, "SYSTEM", &regftest.Key{
+		Name: "ROOT",
+		Subkeys: []*regftest.Key{
+			{Name: "Select", Values: []regftest.Value{regftest.DWORD("Current", 2)}},
+			regftest.Path(`ControlSet002\Services`, &regftest.Key{Name: "WaaSMedicSvc", Values: []regftest.Value{
+				regftest.DWORD("Start", 4),
+				regftest.String("ImagePath", `%systemroot%\system32\svchost.exe -k wusvcs -p`),
+				regftest.Binary("FailureActions", []byte{0x80, 0x51, 0x01, 0x00, 0x00}),
+			}}),
+		},
+	})
+	hive, err := regf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hive.Close()
+
+	controlSet, err := currentControlSet(hive)
+	if err != nil || controlSet != "ControlSet002" {
+		t.Fatalf("current control set = %q, %v", controlSet, err)
+	}
+	key, err := HiveRegKey(hive, controlSet+`\Services\WaaSMedicSvc`, servicesKey+`\WaaSMedicSvc`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key.Values) != 2 {
+		t.Fatalf("values = %+v", key.Values)
+	}
+	policy := ParseUpdatePolicy([]winutil.RegKey{key})
+	if policy.ServiceStart["WaaSMedicSvc"] != serviceStartDisabled {
+		t.Errorf("service start = %v", policy.ServiceStart)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !windows
+
+package win_updates
+
+import (
+	"context"
+)
+
+// WinUpdates represents the Windows Update history collection module (no-op on non-Windows).
+type WinUpdates struct{}
+
+// NewWinUpdates creates a new Windows Update history collection module.
+func NewWinUpdates() *WinUpdates {
+	return &WinUpdates{}
+}
+
+// SetDataStoreCap is a no-op on non-Windows systems.
+func (w *WinUpdates) SetDataStoreCap(capMB int64) {}
+
+// Name returns the module's identifier.
+func (w *WinUpdates) Name() string {
+	return "windows/updates"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinUpdates) Describe() string {
+	return "Windows Update history and patch state"
+}
+
+// Collect is a no-op on non-Windows systems.
+func (w *WinUpdates) Collect(ctx context.Context, outDir string) error {
+	// No-op on non-Windows systems
+	return nil
+}
@@ -0,0 +1,328 @@
+//go:build windows
+
+package win_updates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// hotFixScript lists installed updates as JSON, with InstalledOn as a plain date.
+const hotFixScript = `Get-HotFix | Select-Object HotFixID, Description, InstalledBy, @{Name='InstalledOn';Expression={if ($_.InstalledOn) { $_.InstalledOn.ToString('yyyy-MM-dd') }}} | ConvertTo-Json -Compress`
+
+// updateEventsScript lists Windows Update client install events from the System log as JSON.
+const updateEventsScript = `Get-WinEvent -FilterHashtable @{LogName='System'; ProviderName='Microsoft-Windows-WindowsUpdateClient'; Id=19,20,43} -MaxEvents 1000 -ErrorAction SilentlyContinue | Select-Object @{Name='TimeCreated';Expression={$_.TimeCreated.ToUniversalTime().ToString('o')}}, Id, @{Name='Title';Expression={$_.Properties[0].Value}} | ConvertTo-Json -Compress`
+
+// WinUpdates represents the Windows Update history collection module.
+type WinUpdates struct {
+	dataStoreCapMB int64 // Largest DataStore.edb copied; 0 disables copying
+}
+
+// NewWinUpdates creates a new Windows Update history collection module.
+func NewWinUpdates() *WinUpdates {
+	return &WinUpdates{dataStoreCapMB: DefaultDataStoreCapMB}
+}
+
+// SetDataStoreCap sets the largest DataStore.edb, in MB, that is copied rather than only described.
+func (w *WinUpdates) SetDataStoreCap(capMB int64) {
+	w.dataStoreCapMB = capMB
+}
+
+// Name returns the module's identifier.
+func (w *WinUpdates) Name() string {
+	return "windows/updates"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinUpdates) Describe() string {
+	return "Windows Update history and patch state"
+}
+
+// Collect gathers the installed update history, Windows Update policy, the
+// DataStore.edb database, and Windows Update logs, and creates a manifest.
+func (w *WinUpdates) Collect(ctx context.Context, outDir string) error {
+	// Create the windows/updates subdirectory
+	updatesDir := filepath.Join(outDir, "windows", "updates")
+	if err := winutil.EnsureDir(updatesDir); err != nil {
+		return fmt.Errorf("failed to create updates directory: %w", err)
+	}
+
+	// Get hostname for manifest
+	hostname, err := winutil.Hostname(ctx)
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	manifest := NewUpdatesManifest(ctx, hostname)
+	constraints := winutil.NewSizeConstraints(ctx)
+	now := winutil.Now(ctx)
+	history := &UpdateHistory{
+		Sources:  make([]string, 0),
+		HotFixes: make([]HotFix, 0),
+		Events:   make([]UpdateEvent, 0),
+		Findings: make([]string, 0),
+	}
+
+	if err := w.collectHotFixes(ctx, history); err != nil && !errors.Is(err, winutil.ErrRequiresLiveSystem) {
+		history.Errors = append(history.Errors, err.Error())
+	}
+	if err := w.collectEvents(ctx, history); err != nil && !errors.Is(err, winutil.ErrRequiresLiveSystem) {
+		history.Errors = append(history.Errors, err.Error())
+	}
+	w.readPolicy(ctx, history)
+
+	systemRoot := winutil.SystemRoot()
+	dataStorePath := filepath.Join(systemRoot, "SoftwareDistribution", "DataStore", "DataStore.edb")
+	history.DataStore = w.collectDataStore(ctx, dataStorePath, updatesDir, manifest)
+
+	if err := w.collectLogs(ctx, systemRoot, updatesDir, manifest, constraints); err != nil {
+		manifest.AddError("logs", fmt.Sprintf("Failed to collect Windows Update logs: %v", err))
+	}
+
+	FinalizeHistory(history, now)
+	history.CollectedUTC = winutil.FormatTime(now)
+	manifest.SetUpdatesFound(len(history.HotFixes))
+
+	if err := w.writeHistory(ctx, updatesDir, history, manifest); err != nil {
+		manifest.AddError("update_history.json", err.Error())
+	}
+
+	// Write manifest
+	manifestPath := filepath.Join(updatesDir, "manifest.json")
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// collectHotFixes lists installed updates with Get-HotFix, falling back to wmic qfe.
+func (w *WinUpdates) collectHotFixes(ctx context.Context, history *UpdateHistory) error {
+	output, err := winutil.RunCommandWithOutput(ctx, "powershell", []string{"-NoProfile", "-Command", hotFixScript})
+	if err == nil {
+		hotfixes, parseErr := ParseHotFixes(output)
+		if parseErr == nil {
+			history.HotFixes = append(history.HotFixes, hotfixes...)
+			history.Sources = append(history.Sources, SourceGetHotFix)
+			return nil
+		}
+		err = parseErr
+	}
+	if errors.Is(err, winutil.ErrRequiresLiveSystem) {
+		return err
+	}
+
+	output, qfeErr := winutil.RunCommandWithOutput(ctx, "wmic", []string{"qfe", "get", "Description,HotFixID,InstalledBy,InstalledOn", "/format:csv"})
+	if qfeErr != nil {
+		return fmt.Errorf("failed to list installed updates (Get-HotFix: %v; wmic qfe: %w)", err, qfeErr)
+	}
+	hotfixes, qfeErr := ParseQFE(output)
+	if qfeErr != nil {
+		return fmt.Errorf("failed to list installed updates (Get-HotFix: %v; wmic qfe: %w)", err, qfeErr)
+	}
+	history.HotFixes = append(history.HotFixes, hotfixes...)
+	history.Sources = append(history.Sources, SourceWMICQFE)
+	return nil
+}
+
+// collectEvents reads Windows Update client install events from the System log.
+func (w *WinUpdates) collectEvents(ctx context.Context, history *UpdateHistory) error {
+	output, err := winutil.RunCommandWithOutput(ctx, "powershell", []string{"-NoProfile", "-Command", updateEventsScript})
+	if err != nil {
+		if errors.Is(err, winutil.ErrRequiresLiveSystem) {
+			return err
+		}
+		return fmt.Errorf("failed to read Windows Update events: %w", err)
+	}
+	events, err := ParseUpdateEvents(output)
+	if err != nil {
+		return err
+	}
+	history.Events = append(history.Events, events...)
+	history.Sources = append(history.Sources, SourceUpdateEvents)
+	return nil
+}
+
+// readPolicy reads the Windows Update policy and service start types with reg
+// query on a live system, or from the SOFTWARE and SYSTEM hives under an
+// alternate root. Absent keys are the default configuration and not an error.
+func (w *WinUpdates) readPolicy(ctx context.Context, history *UpdateHistory) {
+	var keys []winutil.RegKey
+
+	if !winutil.IsOffline() {
+		paths := []string{wuPolicyKey, auPolicyKey, uxSettingsKey}
+		for _, service := range updateServices {
+			paths = append(paths, servicesKey+`\`+service)
+		}
+		for _, path := range paths {
+			output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", path})
+			if err != nil {
+				continue
+			}
+			keys = append(keys, winutil.ParseRegQuery(output)...)
+		}
+		history.Policy = ParseUpdatePolicy(keys)
+		return
+	}
+
+	configDir := filepath.Join(winutil.SystemRoot(), "System32", "config")
+	err := withHive(filepath.Join(configDir, "SOFTWARE"), func(hive *regf.Hive) error {
+		for _, path := range []string{wuPolicyKey, auPolicyKey, uxSettingsKey} {
+			if key, err := HiveRegKey(hive, strings.TrimPrefix(path, `HKLM\SOFTWARE\`), path); err == nil {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		history.Errors = append(history.Errors, err.Error())
+	}
+
+	err = withHive(filepath.Join(configDir, "SYSTEM"), func(hive *regf.Hive) error {
+		controlSet, err := currentControlSet(hive)
+		if err != nil {
+			return err
+		}
+		for _, service := range updateServices {
+			if key, err := HiveRegKey(hive, controlSet+`\Services\`+service, servicesKey+`\`+service); err == nil {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		history.Errors = append(history.Errors, err.Error())
+	}
+
+	history.Policy = ParseUpdatePolicy(keys)
+}
+
+// withHive opens a hive file of an offline image in place; nothing holds it
+// locked, so no private copy is needed.
+func withHive(path string, read func(*regf.Hive) error) error {
+	hive, err := regf.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer hive.Close()
+	return read(hive)
+}
+
+// collectDataStore records DataStore.edb's size and write time and copies it
+// when it is no larger than the cap. The Windows Update service holds the
+// database open, so a locked live copy falls back to the newest shadow copy.
+func (w *WinUpdates) collectDataStore(ctx context.Context, srcPath, outDir string, manifest *UpdatesManifest) *DataStoreInfo {
+	stat, err := os.Stat(srcPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			manifest.AddError(srcPath, fmt.Sprintf("Failed to stat DataStore.edb: %v", err))
+		}
+		return nil
+	}
+	manifest.IncrementTotalFiles()
+	info := &DataStoreInfo{
+		Path:     srcPath,
+		Size:     stat.Size(),
+		Modified: winutil.FormatTime(stat.ModTime()),
+	}
+
+	if w.dataStoreCapMB <= 0 || stat.Size() > w.dataStoreCapMB*1024*1024 {
+		return info
+	}
+
+	destPath := filepath.Join(outDir, "DataStore.edb")
+	// A copy that fails partway resumes from the shadow copy
+	size, sha256Hex, source, err := winutil.CopyFileOrShadow(ctx, srcPath, destPath)
+	if err != nil {
+		info.Error = fmt.Sprintf("failed to copy DataStore.edb: %v", err)
+		manifest.AddError(srcPath, info.Error)
+		return info
+	}
+
+	info.Copied = true
+	info.Source = source
+	info.SHA256 = sha256Hex
+	note := "Windows Update DataStore.edb (ESE database)"
+	if source == "shadow_copy" {
+		note += " from shadow copy"
+	}
+	manifest.AddItem("DataStore.edb", size, sha256Hex, false, stat.ModTime(), "datastore", note)
+	return info
+}
+
+// collectLogs copies ReportingEvents.log and the Windows Update ETL traces under
+// Logs\WindowsUpdate, within the size constraints.
+func (w *WinUpdates) collectLogs(ctx context.Context, systemRoot, outDir string, manifest *UpdatesManifest, constraints *winutil.SizeConstraints) error {
+	sources := []string{filepath.Join(systemRoot, "SoftwareDistribution", "ReportingEvents.log")}
+	traces, err := filepath.Glob(filepath.Join(systemRoot, "Logs", "WindowsUpdate", "*.etl"))
+	if err != nil {
+		return err
+	}
+	sources = append(sources, traces...)
+
+	logsDir := filepath.Join(outDir, "logs")
+	for _, srcPath := range sources {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		stat, err := os.Stat(srcPath)
+		if err != nil {
+			continue
+		}
+		manifest.IncrementTotalFiles()
+		if err := winutil.EnsureDir(logsDir); err != nil {
+			return fmt.Errorf("failed to create logs directory: %w", err)
+		}
+
+		filename := filepath.Base(srcPath)
+		size, sha256Hex, truncated, err := winutil.SmartCopy(srcPath, filepath.Join(logsDir, filename), constraints)
+		if err != nil {
+			manifest.AddError(srcPath, fmt.Sprintf("Failed to copy file: %v", err))
+			continue
+		}
+		note := "Windows Update trace log"
+		if strings.EqualFold(filename, "ReportingEvents.log") {
+			note = "Windows Update reporting events log"
+		}
+		manifest.AddItem("logs/"+filename, size, sha256Hex, truncated, stat.ModTime(), "log", note)
+	}
+
+	return nil
+}
+
+// writeHistory writes update_history.json and adds it to the manifest.
+func (w *WinUpdates) writeHistory(ctx context.Context, outDir string, history *UpdateHistory, manifest *UpdatesManifest) error {
+	outputPath := filepath.Join(outDir, "update_history.json")
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal update history: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write update history: %w", err)
+	}
+
+	manifest.IncrementTotalFiles()
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat update history: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash update history: %w", err)
+	}
+	note := fmt.Sprintf("Windows Update history (%d hotfixes, %d events, %d findings)", len(history.HotFixes), len(history.Events), len(history.Findings))
+	manifest.AddItem("update_history.json", stat.Size(), sha256Hex, false, stat.ModTime(), "update_history", note)
+
+	return nil
+}
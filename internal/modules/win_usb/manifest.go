@@ -2,9 +2,12 @@
 package win_usb
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // USBItem represents a collected USB-related file.
@@ -35,9 +38,9 @@ type USBManifest struct {
 	CollectedFiles     int       `json:"collected_files"`
 }
 
-func NewUSBManifest(hostname string) *USBManifest {
+func NewUSBManifest(ctx context.Context, hostname string) *USBManifest {
 	return &USBManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]USBItem, 0),
@@ -54,7 +57,7 @@ func (um *USBManifest) AddItem(path string, size int64, sha256 string, truncated
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	um.CollectedFiles++
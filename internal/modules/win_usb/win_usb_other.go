@@ -8,4 +8,5 @@ type WinUSB struct{}
 
 func NewWinUSB() *WinUSB { return &WinUSB{} }
 func (w *WinUSB) Name() string { return "windows/usb" }
+func (w *WinUSB) Describe() string { return "USB device installation logs" }
 func (w *WinUSB) Collect(ctx context.Context, outDir string) error { return nil }
\ No newline at end of file
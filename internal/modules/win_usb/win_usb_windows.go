@@ -22,19 +22,24 @@ func (w *WinUSB) Name() string {
 	return "windows/usb"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinUSB) Describe() string {
+	return "USB device installation logs"
+}
+
 func (w *WinUSB) Collect(ctx context.Context, outDir string) error {
 	usbDir := filepath.Join(outDir, "windows", "usb")
 	if err := winutil.EnsureDir(usbDir); err != nil {
 		return fmt.Errorf("failed to create usb directory: %w", err)
 	}
 
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
-	manifest := NewUSBManifest(hostname)
-	constraints := winutil.NewSizeConstraints()
+	manifest := NewUSBManifest(ctx, hostname)
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Collect setupapi.dev.log
 	if err := w.collectSetupAPILog(ctx, usbDir, manifest, constraints); err != nil {
@@ -55,14 +60,7 @@ func (w *WinUSB) Collect(ctx context.Context, outDir string) error {
 }
 
 func (w *WinUSB) collectSetupAPILog(ctx context.Context, outDir string, manifest *USBManifest, constraints *winutil.SizeConstraints) error {
-	systemRoot := os.Getenv("SystemRoot")
-	if systemRoot == "" {
-		systemDrive := os.Getenv("SystemDrive")
-		if systemDrive == "" {
-			systemDrive = "C:"
-		}
-		systemRoot = filepath.Join(systemDrive, "Windows")
-	}
+	systemRoot := winutil.SystemRoot()
 
 	setupAPIPath := filepath.Join(systemRoot, "inf", "setupapi.dev.log")
 	
@@ -2,9 +2,12 @@
 package win_usn
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // USNItem represents a collected USN Journal-related file.
@@ -37,9 +40,9 @@ type USNManifest struct {
 }
 
 // NewUSNManifest creates a new USN Journal manifest with basic information.
-func NewUSNManifest(hostname string) *USNManifest {
+func NewUSNManifest(ctx context.Context, hostname string) *USNManifest {
 	return &USNManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]USNItem, 0),
@@ -58,7 +61,7 @@ func (um *USNManifest) AddItem(path string, size int64, sha256 string, truncated
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	um.CollectedFiles++
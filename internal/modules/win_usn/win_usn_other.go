@@ -19,6 +19,16 @@ func (w *WinUSN) Name() string {
 	return "windows/usn"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinUSN) Describe() string {
+	return "NTFS USN Journal information"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinUSN) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinUSN) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
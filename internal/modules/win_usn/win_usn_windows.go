@@ -25,6 +25,16 @@ func (w *WinUSN) Name() string {
 	return "windows/usn"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinUSN) Describe() string {
+	return "NTFS USN Journal information"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinUSN) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers NTFS USN Journal information and metadata.
 func (w *WinUSN) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/usn subdirectory
@@ -34,13 +44,13 @@ func (w *WinUSN) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewUSNManifest(hostname)
+	manifest := NewUSNManifest(ctx, hostname)
 
 	// Collect USN Journal information
 	if err := w.collectUSNJournalInfo(ctx, usnDir, manifest); err != nil {
@@ -109,7 +119,7 @@ func (w *WinUSN) collectUSNJournalInfo(ctx context.Context, outDir string, manif
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("usn_journal_info.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "usn_info", "NTFS USN Journal information and statistics")
 			manifest.IncrementTotalFiles()
 		}
@@ -125,14 +135,11 @@ func (w *WinUSN) collectChangeJournalStats(ctx context.Context, outDir string, m
 	output := "Change Journal Statistics and Configuration:\n\n"
 
 	// Get system drive
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive == "" {
-		systemDrive = "C:"
-	}
+	systemDrive := winutil.SystemDrive()
 
 	// Get file system statistics which includes change journal info
 	output += "=== File System Statistics ===\n"
-	fsStatsCmd := []string{"fsinfo", "statistics", systemDrive}
+	fsStatsCmd := []string{"fsinfo", "statistics", winutil.LiveSystemDrive()}
 	if result, err := winutil.RunCommandWithOutput(ctx, "fsutil", fsStatsCmd); err == nil {
 		output += string(result)
 		output += "\n"
@@ -181,7 +188,7 @@ func (w *WinUSN) collectChangeJournalStats(ctx context.Context, outDir string, m
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("change_journal_stats.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "journal_metadata", "Change journal statistics and recent file activity")
 			manifest.IncrementTotalFiles()
 		}
@@ -2,9 +2,13 @@
 package win_vss
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
 )
 
 // VSSItem represents a collected Volume Shadow Copy-related file.
@@ -34,12 +38,13 @@ type VSSManifest struct {
 	TotalFiles         int        `json:"total_files"`
 	CollectedFiles     int        `json:"collected_files"`
 	ShadowCopiesFound  int        `json:"shadow_copies_found"`
+	Summary            schema.Summary `json:"summary"`
 }
 
 // NewVSSManifest creates a new VSS manifest with basic information.
-func NewVSSManifest(hostname string) *VSSManifest {
+func NewVSSManifest(ctx context.Context, hostname string) *VSSManifest {
 	return &VSSManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]VSSItem, 0),
@@ -47,6 +52,7 @@ func NewVSSManifest(hostname string) *VSSManifest {
 		TotalFiles:         0,
 		CollectedFiles:     0,
 		ShadowCopiesFound:  0,
+		Summary:            schema.NewSummary(),
 	}
 }
 
@@ -58,7 +64,7 @@ func (vm *VSSManifest) AddItem(path string, size int64, sha256 string, truncated
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	vm.CollectedFiles++
@@ -80,6 +86,7 @@ func (vm *VSSManifest) IncrementTotalFiles() {
 // SetShadowCopiesFound sets the number of shadow copies found.
 func (vm *VSSManifest) SetShadowCopiesFound(count int) {
 	vm.ShadowCopiesFound = count
+	vm.Summary.Set(schema.SummaryShadowCopies, count)
 }
 
 // WriteManifest writes the manifest to a JSON file.
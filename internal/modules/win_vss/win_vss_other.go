@@ -19,6 +19,16 @@ func (w *WinVSS) Name() string {
 	return "windows/vss"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinVSS) Describe() string {
+	return "Volume Shadow Copy Service"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinVSS) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinVSS) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
@@ -25,6 +25,16 @@ func (w *WinVSS) Name() string {
 	return "windows/vss"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinVSS) Describe() string {
+	return "Volume Shadow Copy Service"
+}
+
+// RequiresLiveSystem reports that the module queries the running OS.
+func (w *WinVSS) RequiresLiveSystem() bool {
+	return true
+}
+
 // Collect gathers Volume Shadow Copy Service information and metadata.
 func (w *WinVSS) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/vss subdirectory
@@ -34,13 +44,13 @@ func (w *WinVSS) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewVSSManifest(hostname)
+	manifest := NewVSSManifest(ctx, hostname)
 
 	// Collect VSS information using vssadmin
 	if err := w.collectVSSAdminInfo(ctx, vssDir, manifest); err != nil {
@@ -122,7 +132,7 @@ func (w *WinVSS) collectVSSAdminInfo(ctx context.Context, outDir string, manifes
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("vssadmin_info.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "vss_info", "Volume Shadow Copy Service information from vssadmin")
 			manifest.IncrementTotalFiles()
 		}
@@ -164,7 +174,7 @@ func (w *WinVSS) collectShadowCopies(ctx context.Context, outDir string, manifes
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("shadow_copies_wmic.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "shadow_copies", "Shadow copy information from WMIC")
 			manifest.IncrementTotalFiles()
 		}
@@ -216,7 +226,7 @@ func (w *WinVSS) collectVSSWriters(ctx context.Context, outDir string, manifest
 
 	// Add to manifest
 	if stat, err := os.Stat(outputPath); err == nil {
-		if sha256Hex, err := winutil.HashFile(outputPath); err == nil {
+		if sha256Hex, err := winutil.HashFile(ctx, outputPath); err == nil {
 			manifest.AddItem("vss_writers_detail.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "vss_config", "Detailed VSS writers and providers information")
 			manifest.IncrementTotalFiles()
 		}
@@ -2,9 +2,12 @@
 package win_wmi
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
+
+	"cryptkeeper/internal/winutil"
 )
 
 // WMIItem represents a collected WMI repository file.
@@ -36,9 +39,9 @@ type WMIManifest struct {
 }
 
 // NewWMIManifest creates a new WMI manifest with basic information.
-func NewWMIManifest(hostname string) *WMIManifest {
+func NewWMIManifest(ctx context.Context, hostname string) *WMIManifest {
 	return &WMIManifest{
-		CreatedUTC:         time.Now().UTC().Format(time.RFC3339),
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
 		Host:               hostname,
 		CryptkeeperVersion: "v0.1.0",
 		Items:              make([]WMIItem, 0),
@@ -56,7 +59,7 @@ func (wm *WMIManifest) AddItem(path string, size int64, sha256 string, truncated
 		SHA256:    sha256,
 		Truncated: truncated,
 		Note:      note,
-		Modified:  modified.UTC().Format(time.RFC3339),
+		Modified:  winutil.FormatTime(modified),
 		FileType:  fileType,
 	})
 	wm.CollectedFiles++
@@ -19,6 +19,11 @@ func (w *WinWMI) Name() string {
 	return "windows/wmi"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinWMI) Describe() string {
+	return "WMI repository and subscriptions"
+}
+
 // Collect is a no-op on non-Windows systems.
 func (w *WinWMI) Collect(ctx context.Context, outDir string) error {
 	// No-op on non-Windows systems
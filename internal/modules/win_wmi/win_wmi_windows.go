@@ -25,6 +25,11 @@ func (w *WinWMI) Name() string {
 	return "windows/wmi"
 }
 
+// Describe returns a one-line summary of what the module collects.
+func (w *WinWMI) Describe() string {
+	return "WMI repository and subscriptions"
+}
+
 // Collect copies Windows WMI repository files and creates subscription reports.
 func (w *WinWMI) Collect(ctx context.Context, outDir string) error {
 	// Create the windows/wmi subdirectory
@@ -34,26 +39,19 @@ func (w *WinWMI) Collect(ctx context.Context, outDir string) error {
 	}
 
 	// Get hostname for manifest
-	hostname, err := os.Hostname()
+	hostname, err := winutil.Hostname(ctx)
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	// Create manifest
-	manifest := NewWMIManifest(hostname)
+	manifest := NewWMIManifest(ctx, hostname)
 
 	// Initialize size constraints
-	constraints := winutil.NewSizeConstraints()
+	constraints := winutil.NewSizeConstraints(ctx)
 
 	// Get SystemRoot path (usually C:\Windows)
-	systemRoot := os.Getenv("SystemRoot")
-	if systemRoot == "" {
-		systemDrive := os.Getenv("SystemDrive")
-		if systemDrive == "" {
-			systemDrive = "C:"
-		}
-		systemRoot = filepath.Join(systemDrive, "Windows")
-	}
+	systemRoot := winutil.SystemRoot()
 
 	// Collect WMI repository files from System32\wbem\Repository\
 	wmiRepoDir := filepath.Join(systemRoot, "System32", "wbem", "Repository")
@@ -191,7 +189,7 @@ $subscriptions | ConvertTo-Json -Depth 10
 	}
 
 	// Calculate hash of the output file
-	sha256Hex, err := winutil.HashFile(outputPath)
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to hash WMI subscriptions output: %w", err)
 	}
@@ -0,0 +1,100 @@
+// Package win_wsl provides Windows Subsystem for Linux distribution collection for cryptkeeper.
+package win_wsl
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"cryptkeeper/internal/schema"
+	"cryptkeeper/internal/winutil"
+)
+
+// WSLItem represents a collected WSL artifact.
+type WSLItem struct {
+	Path      string `json:"path"`           // Relative path in the archive
+	Size      int64  `json:"size"`           // File size in bytes
+	SHA256    string `json:"sha256"`         // SHA-256 hash
+	Truncated bool   `json:"truncated"`      // Whether the file was truncated due to size limits
+	Note      string `json:"note,omitempty"` // Description of the file
+	Modified  string `json:"modified"`       // File modification time (RFC3339)
+	FileType  string `json:"file_type"`      // Type: "wsl", "wsl_list", "vhdx"
+}
+
+// WSLError represents an error that occurred during collection.
+type WSLError struct {
+	Target string `json:"target"` // What failed (e.g., specific file path)
+	Error  string `json:"error"`  // Error message
+}
+
+// WSLManifest represents the complete manifest for WSL collection.
+type WSLManifest struct {
+	CreatedUTC         string         `json:"created_utc"`
+	Host               string         `json:"host"`
+	CryptkeeperVersion string         `json:"cryptkeeper_version"`
+	Items              []WSLItem      `json:"items"`
+	Errors             []WSLError     `json:"errors"`
+	TotalFiles         int            `json:"total_files"`
+	CollectedFiles     int            `json:"collected_files"`
+	DistributionsFound int            `json:"distributions_found"`
+	Summary            schema.Summary `json:"summary"`
+}
+
+// NewWSLManifest creates a new WSL manifest with basic information.
+func NewWSLManifest(ctx context.Context, hostname string) *WSLManifest {
+	return &WSLManifest{
+		CreatedUTC:         winutil.FormatTime(winutil.Now(ctx)),
+		Host:               hostname,
+		CryptkeeperVersion: "v0.1.0",
+		Items:              make([]WSLItem, 0),
+		Errors:             make([]WSLError, 0),
+		TotalFiles:         0,
+		CollectedFiles:     0,
+		DistributionsFound: 0,
+		Summary:            schema.NewSummary(),
+	}
+}
+
+// AddItem adds a successfully collected WSL item to the manifest.
+func (wm *WSLManifest) AddItem(path string, size int64, sha256 string, truncated bool, modified time.Time, fileType, note string) {
+	wm.Items = append(wm.Items, WSLItem{
+		Path:      path,
+		Size:      size,
+		SHA256:    sha256,
+		Truncated: truncated,
+		Note:      note,
+		Modified:  winutil.FormatTime(modified),
+		FileType:  fileType,
+	})
+	wm.CollectedFiles++
+}
+
+// AddError adds an error to the manifest for a failed collection.
+func (wm *WSLManifest) AddError(target, errorMsg string) {
+	wm.Errors = append(wm.Errors, WSLError{
+		Target: target,
+		Error:  errorMsg,
+	})
+}
+
+// IncrementTotalFiles increments the count of total files found.
+func (wm *WSLManifest) IncrementTotalFiles() {
+	wm.TotalFiles++
+}
+
+// SetDistributionsFound sets the number of WSL distributions found.
+func (wm *WSLManifest) SetDistributionsFound(count int) {
+	wm.DistributionsFound = count
+	wm.Summary.Set(schema.SummaryWSLDistributions, count)
+}
+
+// WriteManifest writes the manifest to a JSON file.
+func (wm *WSLManifest) WriteManifest(manifestPath string) error {
+	data, err := json.MarshalIndent(wm, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath, data, 0644)
+}
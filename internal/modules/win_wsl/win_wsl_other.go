@@ -0,0 +1,37 @@
+//go:build !windows
+
+package win_wsl
+
+import (
+	"context"
+)
+
+// WinWSL represents the Windows Subsystem for Linux collection module (no-op on non-Windows).
+type WinWSL struct{}
+
+// NewWinWSL creates a new Windows Subsystem for Linux collection module.
+func NewWinWSL() *WinWSL {
+	return &WinWSL{}
+}
+
+// SetSinceTime is a no-op on non-Windows systems.
+func (w *WinWSL) SetSinceTime(sinceRFC3339 string) {}
+
+// SetImageCap is a no-op on non-Windows systems.
+func (w *WinWSL) SetImageCap(capMB int64) {}
+
+// Name returns the module's identifier.
+func (w *WinWSL) Name() string {
+	return "windows/wsl"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinWSL) Describe() string {
+	return "WSL distributions and disk images"
+}
+
+// Collect is a no-op on non-Windows systems.
+func (w *WinWSL) Collect(ctx context.Context, outDir string) error {
+	// No-op on non-Windows systems
+	return nil
+}
@@ -0,0 +1,342 @@
+//go:build windows
+
+package win_wsl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// profileListKey maps user SIDs to profile directories.
+const profileListKey = `HKLM\SOFTWARE\Microsoft\Windows NT\CurrentVersion\ProfileList`
+
+// WinWSL represents the Windows Subsystem for Linux collection module.
+type WinWSL struct {
+	sinceTime  string // RFC3339 timestamp; images written after it are flagged
+	imageCapMB int64  // Largest ext4.vhdx copied; 0 disables copying
+}
+
+// NewWinWSL creates a new Windows Subsystem for Linux collection module.
+func NewWinWSL() *WinWSL {
+	return &WinWSL{imageCapMB: DefaultImageCapMB}
+}
+
+// SetSinceTime configures the cutoff for recently modified disk images.
+func (w *WinWSL) SetSinceTime(sinceRFC3339 string) {
+	w.sinceTime = sinceRFC3339
+}
+
+// SetImageCap sets the largest ext4.vhdx, in MB, that is copied rather than only described.
+func (w *WinWSL) SetImageCap(capMB int64) {
+	w.imageCapMB = capMB
+}
+
+// Name returns the module's identifier.
+func (w *WinWSL) Name() string {
+	return "windows/wsl"
+}
+
+// Describe returns a one-line summary of what the module collects.
+func (w *WinWSL) Describe() string {
+	return "WSL distributions and disk images"
+}
+
+// Collect enumerates registered WSL distributions from each user's hive,
+// describes their disk images, lists live distributions, and creates a manifest.
+func (w *WinWSL) Collect(ctx context.Context, outDir string) error {
+	// Create the windows/wsl subdirectory
+	wslDir := filepath.Join(outDir, "windows", "wsl")
+	if err := winutil.EnsureDir(wslDir); err != nil {
+		return fmt.Errorf("failed to create wsl directory: %w", err)
+	}
+
+	// Get hostname for manifest
+	hostname, err := winutil.Hostname(ctx)
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	manifest := NewWSLManifest(ctx, hostname)
+	now := winutil.Now(ctx)
+	report := &WSLReport{
+		Distributions: make([]WSLDistribution, 0),
+		Findings:      make([]string, 0),
+	}
+
+	// Images written inside the window are flagged
+	since := now.Add(-recentImageWindow)
+	if w.sinceTime != "" {
+		if t, err := time.Parse(time.RFC3339, w.sinceTime); err == nil {
+			since = t
+		}
+	}
+
+	if err := w.collectUserDistributions(ctx, wslDir, report, manifest); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		manifest.AddError("user_distributions", fmt.Sprintf("Failed to enumerate user distributions: %v", err))
+	}
+
+	if err := w.collectLiveList(ctx, wslDir, report, manifest); err != nil && !errors.Is(err, winutil.ErrRequiresLiveSystem) {
+		manifest.AddError("wsl_list", fmt.Sprintf("Failed to list distributions: %v", err))
+	}
+
+	FinalizeReport(report, since)
+	report.CollectedUTC = winutil.FormatTime(now)
+	manifest.SetDistributionsFound(len(report.Distributions))
+
+	if err := w.writeReport(ctx, wslDir, report, manifest); err != nil {
+		manifest.AddError("wsl.json", err.Error())
+	}
+
+	// Write manifest
+	manifestPath := filepath.Join(wslDir, "manifest.json")
+	if err := manifest.WriteManifest(manifestPath); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// collectUserDistributions reads each user's Lxss registrations and describes
+// every ext4.vhdx found, registered or not.
+func (w *WinWSL) collectUserDistributions(ctx context.Context, outDir string, report *WSLReport, manifest *WSLManifest) error {
+	usersDir := filepath.Join(winutil.SystemDrive(), "Users")
+	userEntries, err := os.ReadDir(usersDir)
+	if err != nil {
+		return fmt.Errorf("failed to read users directory: %w", err)
+	}
+
+	// Loaded hives cannot be copied; their SIDs let reg query read them instead
+	sids := profileSIDs(ctx)
+
+	for _, userEntry := range userEntries {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if !userEntry.IsDir() {
+			continue
+		}
+		username := userEntry.Name()
+		if w.isSystemProfile(username) {
+			continue
+		}
+		userProfileDir := filepath.Join(usersDir, username)
+
+		distributions, err := w.readUserDistributions(ctx, userProfileDir, username, sids)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", username, err))
+		}
+
+		registered := make(map[string]bool)
+		for i := range distributions {
+			dist := &distributions[i]
+			if dist.BasePath == "" {
+				continue
+			}
+			imagePath := filepath.Join(dist.BasePath, "ext4.vhdx")
+			registered[strings.ToLower(imagePath)] = true
+			if _, err := os.Stat(imagePath); err == nil {
+				dist.Image = w.describeImage(ctx, imagePath, outDir, username, dist.GUID, manifest)
+			}
+		}
+
+		// Images under Store packages with no registration, e.g. from a copied profile
+		pattern := filepath.Join(userProfileDir, "AppData", "Local", "Packages", "*", "LocalState", "ext4.vhdx")
+		matches, _ := filepath.Glob(pattern)
+		for _, imagePath := range matches {
+			if registered[strings.ToLower(imagePath)] {
+				continue
+			}
+			packageDir := filepath.Base(filepath.Dir(filepath.Dir(imagePath)))
+			distributions = append(distributions, WSLDistribution{
+				User:          username,
+				BasePath:      filepath.Dir(imagePath),
+				PackageFamily: packageDir,
+				Source:        "filesystem",
+				Image:         w.describeImage(ctx, imagePath, outDir, username, packageDir, manifest),
+			})
+		}
+
+		report.Distributions = append(report.Distributions, distributions...)
+	}
+
+	return nil
+}
+
+// readUserDistributions parses Lxss from a private copy of the user's
+// NTUSER.DAT, falling back to reg query against HKU when the hive is loaded.
+func (w *WinWSL) readUserDistributions(ctx context.Context, userProfileDir, username string, sids map[string]string) ([]WSLDistribution, error) {
+	hivePath := filepath.Join(userProfileDir, "NTUSER.DAT")
+	if _, err := os.Stat(hivePath); err != nil {
+		return nil, nil
+	}
+
+	tempDir, err := os.MkdirTemp("", "cryptkeeper-wsl-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tempHive := filepath.Join(tempDir, "NTUSER.DAT")
+	_, _, copyErr := winutil.CopyFile(ctx, hivePath, tempHive)
+	if copyErr == nil {
+		hive, err := regf.Open(tempHive)
+		if err != nil {
+			return nil, err
+		}
+		defer hive.Close()
+		return ParseLxssHive(hive, username)
+	}
+
+	sid, ok := sids[strings.ToLower(username)]
+	if !ok || winutil.IsOffline() {
+		return nil, fmt.Errorf("failed to copy NTUSER.DAT: %w", copyErr)
+	}
+	output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", `HKU\` + sid + `\` + lxssKey, "/s"})
+	if err != nil {
+		// reg query fails when the Lxss key does not exist
+		return nil, nil
+	}
+	return ParseLxssRegQuery(winutil.ParseRegQuery(output), username), nil
+}
+
+// describeImage records an ext4.vhdx's size and write time, copying it when it
+// is no larger than the image cap.
+func (w *WinWSL) describeImage(ctx context.Context, imagePath, outDir, username, label string, manifest *WSLManifest) *WSLImage {
+	manifest.IncrementTotalFiles()
+
+	stat, err := os.Stat(imagePath)
+	if err != nil {
+		return &WSLImage{Path: imagePath, Error: err.Error()}
+	}
+	image := &WSLImage{
+		Path:     imagePath,
+		Size:     stat.Size(),
+		Modified: winutil.FormatTime(stat.ModTime()),
+	}
+
+	if w.imageCapMB <= 0 || stat.Size() > w.imageCapMB*1024*1024 {
+		return image
+	}
+
+	destDir := filepath.Join(outDir, "users", username, filepath.Base(label))
+	if err := winutil.EnsureDir(destDir); err != nil {
+		image.Error = fmt.Sprintf("failed to create image directory: %v", err)
+		return image
+	}
+	destPath := filepath.Join(destDir, "ext4.vhdx")
+	// A running WSL 2 distribution holds its image open, so the copy falls
+	// back to the shadow copy
+	size, sha256Hex, _, err := winutil.CopyFileOrShadow(ctx, imagePath, destPath)
+	if err != nil {
+		image.Error = fmt.Sprintf("failed to copy image: %v", err)
+		manifest.AddError(imagePath, image.Error)
+		return image
+	}
+
+	image.Copied = true
+	image.SHA256 = sha256Hex
+	relPath, _ := filepath.Rel(outDir, destPath)
+	manifest.AddItem(filepath.ToSlash(relPath), size, sha256Hex, false, stat.ModTime(), "vhdx", fmt.Sprintf("WSL disk image for %s", username))
+	return image
+}
+
+// collectLiveList runs wsl --list --verbose and saves the decoded output.
+func (w *WinWSL) collectLiveList(ctx context.Context, outDir string, report *WSLReport, manifest *WSLManifest) error {
+	output, err := winutil.RunCommandWithOutput(ctx, "wsl", []string{"--list", "--verbose"})
+	if err != nil {
+		return err
+	}
+	report.LiveList = ParseWSLList(output)
+
+	outputPath := filepath.Join(outDir, "wsl_list.txt")
+	if err := os.WriteFile(outputPath, []byte(DecodeWSLOutput(output)), 0644); err != nil {
+		return fmt.Errorf("failed to write wsl list: %w", err)
+	}
+
+	manifest.IncrementTotalFiles()
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat wsl list: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash wsl list: %w", err)
+	}
+	manifest.AddItem("wsl_list.txt", stat.Size(), sha256Hex, false, stat.ModTime(), "wsl_list", "wsl --list --verbose for the collecting account")
+
+	return nil
+}
+
+// writeReport writes wsl.json and adds it to the manifest.
+func (w *WinWSL) writeReport(ctx context.Context, outDir string, report *WSLReport, manifest *WSLManifest) error {
+	outputPath := filepath.Join(outDir, "wsl.json")
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal WSL report: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write WSL report: %w", err)
+	}
+
+	manifest.IncrementTotalFiles()
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat WSL report: %w", err)
+	}
+	sha256Hex, err := winutil.HashFile(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash WSL report: %w", err)
+	}
+	note := fmt.Sprintf("WSL distributions (%d distributions, %d findings)", len(report.Distributions), len(report.Findings))
+	manifest.AddItem("wsl.json", stat.Size(), sha256Hex, false, stat.ModTime(), "wsl", note)
+
+	return nil
+}
+
+// profileSIDs maps lowercased profile directory names to user SIDs on a live system.
+func profileSIDs(ctx context.Context) map[string]string {
+	sids := make(map[string]string)
+	output, err := winutil.RunCommandWithOutput(ctx, "reg", []string{"query", profileListKey, "/s"})
+	if err != nil {
+		return sids
+	}
+	for _, key := range winutil.ParseRegQuery(output) {
+		value, ok := key.Value("ProfileImagePath")
+		if !ok {
+			continue
+		}
+		sid := key.Path[strings.LastIndex(key.Path, `\`)+1:]
+		sids[strings.ToLower(filepath.Base(value.Data))] = sid
+	}
+	return sids
+}
+
+// isSystemProfile checks if a username represents a system profile that should be skipped.
+func (w *WinWSL) isSystemProfile(username string) bool {
+	systemProfiles := []string{
+		"All Users", "Default", "Default User", "Public",
+		"WDAGUtilityAccount", "defaultuser0", "systemprofile",
+	}
+
+	lowerUsername := strings.ToLower(username)
+	for _, profile := range systemProfiles {
+		if lowerUsername == strings.ToLower(profile) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,299 @@
+package win_wsl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/winutil"
+)
+
+// lxssKey is the per-user key listing registered distributions, relative to the user hive root.
+const lxssKey = `Software\Microsoft\Windows\CurrentVersion\Lxss`
+
+// recentImageWindow defines how recently an ext4.vhdx must have been written to
+// be flagged when --since is not given.
+const recentImageWindow = 7 * 24 * time.Hour
+
+// DefaultImageCapMB is the largest ext4.vhdx copied by default. Images are
+// usually many gigabytes, so most are only described, not copied.
+const DefaultImageCapMB = 256
+
+// Distribution flags.
+const (
+	FlagRootDefaultUser = "root_default_user"
+	FlagRecentImage     = "recently_modified_image"
+	FlagUnregistered    = "unregistered_image"
+)
+
+// WSLImage describes a distribution's ext4.vhdx disk image.
+type WSLImage struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified"`         // RFC3339 UTC
+	Copied   bool   `json:"copied"`           // Copied into the collection (under the image cap)
+	SHA256   string `json:"sha256,omitempty"` // Set when copied
+	Error    string `json:"error,omitempty"`
+}
+
+// WSLDistribution is a WSL distribution registered for, or found under, a user profile.
+type WSLDistribution struct {
+	User           string    `json:"user"`
+	GUID           string    `json:"guid,omitempty"`
+	Name           string    `json:"name,omitempty"`
+	BasePath       string    `json:"base_path,omitempty"`
+	PackageFamily  string    `json:"package_family,omitempty"`
+	DefaultUID     *uint64   `json:"default_uid,omitempty"`
+	Version        uint64    `json:"version,omitempty"` // 1 or 2
+	State          uint64    `json:"state,omitempty"`   // 1 = installed
+	Default        bool      `json:"default"`           // The user's default distribution
+	Source         string    `json:"source"`            // "hive", "reg_query", or "filesystem"
+	KeyLastWritten string    `json:"key_last_written,omitempty"`
+	Image          *WSLImage `json:"image,omitempty"`
+	Flags          []string  `json:"flags,omitempty"`
+}
+
+// WSLListEntry is a row of `wsl --list --verbose`.
+type WSLListEntry struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Version string `json:"version"`
+	Default bool   `json:"default"`
+}
+
+// WSLReport is the structure written to wsl.json.
+type WSLReport struct {
+	CollectedUTC  string            `json:"collected_utc"`
+	Distributions []WSLDistribution `json:"distributions"`
+	LiveList      []WSLListEntry    `json:"live_list,omitempty"`
+	Findings      []string          `json:"findings"`
+	Errors        []string          `json:"errors,omitempty"`
+}
+
+// ParseLxssHive reads the distributions registered in a user's NTUSER.DAT.
+// A hive without an Lxss key yields no distributions and no error.
+func ParseLxssHive(hive *regf.Hive, user string) ([]WSLDistribution, error) {
+	key, err := hive.OpenKey(lxssKey)
+	if errors.Is(err, regf.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Lxss key: %w", err)
+	}
+
+	defaultGUID := ""
+	if v, err := key.Value("DefaultDistribution"); err == nil {
+		defaultGUID = strings.TrimSpace(v.String())
+	}
+
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Lxss subkeys: %w", err)
+	}
+
+	distributions := make([]WSLDistribution, 0, len(subkeys))
+	for _, sub := range subkeys {
+		values, err := sub.Values()
+		if err != nil {
+			return distributions, fmt.Errorf("Lxss\\%s: %w", sub.Name, err)
+		}
+		dist := WSLDistribution{
+			User:   user,
+			GUID:   sub.Name,
+			Source: "hive",
+		}
+		if !sub.LastWritten.IsZero() {
+			dist.KeyLastWritten = winutil.FormatTime(sub.LastWritten)
+		}
+		for _, v := range values {
+			switch strings.ToLower(v.Name) {
+			case "distributionname":
+				dist.Name = strings.TrimSpace(v.String())
+			case "basepath":
+				dist.BasePath = NormalizeBasePath(v.String())
+			case "packagefamilyname":
+				dist.PackageFamily = strings.TrimSpace(v.String())
+			case "defaultuid":
+				if n, ok := v.Uint64(); ok {
+					dist.DefaultUID = &n
+				}
+			case "version":
+				dist.Version, _ = v.Uint64()
+			case "state":
+				dist.State, _ = v.Uint64()
+			}
+		}
+		dist.Default = defaultGUID != "" && strings.EqualFold(defaultGUID, dist.GUID)
+		distributions = append(distributions, dist)
+	}
+
+	return distributions, nil
+}
+
+// ParseLxssRegQuery reads distributions from `reg query <Lxss key> /s` output,
+// used for users whose hive is loaded and could not be copied.
+func ParseLxssRegQuery(keys []winutil.RegKey, user string) []WSLDistribution {
+	defaultGUID := ""
+	distributions := make([]WSLDistribution, 0)
+	for _, key := range keys {
+		lower := strings.ToLower(key.Path)
+		if strings.HasSuffix(lower, `\lxss`) {
+			if v, ok := key.Value("DefaultDistribution"); ok {
+				defaultGUID = strings.TrimSpace(v.Data)
+			}
+			continue
+		}
+		idx := strings.LastIndex(lower, `\lxss\`)
+		if idx < 0 || strings.Contains(key.Path[idx+len(`\lxss\`):], `\`) {
+			continue
+		}
+
+		dist := WSLDistribution{
+			User:   user,
+			GUID:   key.Path[idx+len(`\lxss\`):],
+			Source: "reg_query",
+		}
+		if v, ok := key.Value("DistributionName"); ok {
+			dist.Name = strings.TrimSpace(v.Data)
+		}
+		if v, ok := key.Value("BasePath"); ok {
+			dist.BasePath = NormalizeBasePath(v.Data)
+		}
+		if v, ok := key.Value("PackageFamilyName"); ok {
+			dist.PackageFamily = strings.TrimSpace(v.Data)
+		}
+		if n, ok := key.DWORD("DefaultUid"); ok {
+			dist.DefaultUID = &n
+		}
+		dist.Version, _ = key.DWORD("Version")
+		dist.State, _ = key.DWORD("State")
+		distributions = append(distributions, dist)
+	}
+
+	for i := range distributions {
+		distributions[i].Default = defaultGUID != "" && strings.EqualFold(defaultGUID, distributions[i].GUID)
+	}
+	return distributions
+}
+
+// NormalizeBasePath strips the \\?\ long-path prefix WSL stores on BasePath.
+func NormalizeBasePath(path string) string {
+	path = strings.TrimSpace(path)
+	return strings.TrimPrefix(path, `\\?\`)
+}
+
+// ParseWSLList parses `wsl --list --verbose` output, which wsl.exe writes as
+// UTF-16LE. The default distribution is marked with an asterisk.
+func ParseWSLList(output []byte) []WSLListEntry {
+	text := DecodeWSLOutput(output)
+	entries := make([]WSLListEntry, 0)
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	header := true
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if header {
+			// NAME STATE VERSION
+			header = false
+			continue
+		}
+
+		entry := WSLListEntry{}
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "*") {
+			entry.Default = true
+			trimmed = strings.TrimSpace(trimmed[1:])
+		}
+		fields := strings.Fields(trimmed)
+		if len(fields) < 3 {
+			continue
+		}
+		// Names cannot contain spaces, but keep any extra fields with the name
+		entry.Version = fields[len(fields)-1]
+		entry.State = fields[len(fields)-2]
+		entry.Name = strings.Join(fields[:len(fields)-2], " ")
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// DecodeWSLOutput converts wsl.exe output to a string, decoding UTF-16LE when
+// the output carries a byte-order mark or NUL high bytes.
+func DecodeWSLOutput(output []byte) string {
+	utf16le := bytes.HasPrefix(output, []byte{0xff, 0xfe}) ||
+		(len(output) >= 2 && output[1] == 0 && output[0] != 0)
+	if !utf16le {
+		return string(output)
+	}
+
+	output = bytes.TrimPrefix(output, []byte{0xff, 0xfe})
+	units := make([]uint16, 0, len(output)/2)
+	for i := 0; i+1 < len(output); i += 2 {
+		units = append(units, uint16(output[i])|uint16(output[i+1])<<8)
+	}
+	return string(utf16.Decode(units))
+}
+
+// FlagDistribution returns the indicators for a distribution. An image
+// written after since is flagged as recently modified.
+func FlagDistribution(dist WSLDistribution, since time.Time) []string {
+	var flags []string
+	if dist.DefaultUID != nil && *dist.DefaultUID == 0 {
+		flags = append(flags, FlagRootDefaultUser)
+	}
+	if dist.Image != nil && dist.Image.Modified != "" {
+		if modified, err := winutil.ParseTime(dist.Image.Modified); err == nil && modified.After(since) {
+			flags = append(flags, FlagRecentImage)
+		}
+	}
+	if dist.Source == "filesystem" {
+		flags = append(flags, FlagUnregistered)
+	}
+	return flags
+}
+
+// distributionFinding describes a flagged distribution.
+func distributionFinding(flag string, dist WSLDistribution) string {
+	name := dist.Name
+	if name == "" {
+		name = dist.BasePath
+	}
+	switch flag {
+	case FlagRootDefaultUser:
+		return fmt.Sprintf("%s: %s (user %s) logs in as root by default", flag, name, dist.User)
+	case FlagRecentImage:
+		return fmt.Sprintf("%s: %s (user %s) disk image written %s", flag, name, dist.User, dist.Image.Modified)
+	case FlagUnregistered:
+		return fmt.Sprintf("%s: %s (user %s) has no Lxss registration", flag, dist.Image.Path, dist.User)
+	}
+	return flag + ": " + name
+}
+
+// FinalizeReport flags every distribution, collects findings, and sorts the
+// distributions by user and name.
+func FinalizeReport(report *WSLReport, since time.Time) {
+	sort.SliceStable(report.Distributions, func(i, j int) bool {
+		a, b := report.Distributions[i], report.Distributions[j]
+		if a.User != b.User {
+			return a.User < b.User
+		}
+		return a.Name < b.Name
+	})
+	for i := range report.Distributions {
+		dist := &report.Distributions[i]
+		dist.Flags = FlagDistribution(*dist, since)
+		for _, flag := range dist.Flags {
+			report.Findings = append(report.Findings, distributionFinding(flag, *dist))
+		}
+	}
+}
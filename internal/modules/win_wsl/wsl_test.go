@@ -0,0 +1,156 @@
+package win_wsl
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/regf"
+	"cryptkeeper/internal/regf/regftest"
+	"cryptkeeper/internal/winutil"
+)
+
+const (
+	ubuntuGUID = "{6c8a1f3e-0b74-4d2e-9a51-3f7c2e9b4d10}"
+	kaliGUID   = "{e2a94c07-5d1b-4f63-8c2a-91b0d7e6f5a3}"
+)
+
+// lxssHive returns an NTUSER.DAT with an Ubuntu distribution as the
+// default and a Kali one imported with wsl --import, logging in as root.
+func lxssHive(t *testing.T) *regf.Hive {
+	t.Helper()
+	hive, err := regf.Open(regftest.WriteFile(t, "NTUSER.DAT", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{
+		regftest.Path(`Software\Microsoft\Windows\CurrentVersion`, &regftest.Key{
+			Name:   "Lxss",
+			Values: []regftest.Value{regftest.String("DefaultDistribution", ubuntuGUID)},
+			Subkeys: []*regftest.Key{
+				{Name: ubuntuGUID, LastWritten: time.Date(2024, 1, 9, 16, 20, 0, 0, time.UTC), Values: []regftest.Value{
+					regftest.String("DistributionName", "Ubuntu-22.04"),
+					regftest.String("BasePath", `\\?\C:\Users\alice\AppData\Local\Packages\CanonicalGroupLimited.Ubuntu22.04LTS_79rhkp1fndgsc\LocalState`),
+					regftest.String("PackageFamilyName", "CanonicalGroupLimited.Ubuntu22.04LTS_79rhkp1fndgsc"),
+					regftest.DWORD("DefaultUid", 1000),
+					regftest.DWORD("Version", 2),
+					regftest.DWORD("State", 1),
+					regftest.DWORD("Flags", 15),
+				}},
+				{Name: kaliGUID, Values: []regftest.Value{
+					regftest.String("DistributionName", "kali"),
+					regftest.String("BasePath", `C:\ProgramData\wsl\kali`),
+					regftest.DWORD("DefaultUid", 0),
+					regftest.DWORD("Version", 2),
+					regftest.DWORD("State", 1),
+				}},
+			},
+		}),
+	}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hive.Close() })
+	return hive
+}
+
+func TestParseLxssHive(t *testing.T) {
+	distributions, err := ParseLxssHive(lxssHive(t), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid1000, uid0 := uint64(1000), uint64(0)
+	want := []WSLDistribution{
+		{
+			User:           "alice",
+			GUID:           ubuntuGUID,
+			Name:           "Ubuntu-22.04",
+			BasePath:       `C:\Users\alice\AppData\Local\Packages\CanonicalGroupLimited.Ubuntu22.04LTS_79rhkp1fndgsc\LocalState`,
+			PackageFamily:  "CanonicalGroupLimited.Ubuntu22.04LTS_79rhkp1fndgsc",
+			DefaultUID:     &uid1000,
+			Version:        2,
+			State:          1,
+			Default:        true,
+			Source:         "hive",
+			KeyLastWritten: "2024-01-09T16:20:00Z",
+		},
+		{
+			User:       "alice",
+			GUID:       kaliGUID,
+			Name:       "kali",
+			BasePath:   `C:\ProgramData\wsl\kali`,
+			DefaultUID: &uid0,
+			Version:    2,
+			State:      1,
+			Source:     "hive",
+		},
+	}
+	if !reflect.DeepEqual(distributions, want) {
+		t.Fatalf("distributions = %+v\nwant %+v", distributions, want)
+	}
+
+	// A user who never installed WSL
+	hive, err := regf.Open(regftest.WriteFile(t, "NTUSER.DAT", &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{regftest.Path(`Software\Microsoft`)}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hive.Close()
+	if distributions, err := ParseLxssHive(hive, "bob"); err != nil || len(distributions) != 0 {
+		t.Fatalf("hive without Lxss = %+v, %v", distributions, err)
+	}
+}
+
+func TestParseLxssRegQueryMatchesTheHive(t *testing.T) {
+	output := []byte("\r\n" +
+		"HKEY_USERS\\S-1-5-21-1004\\Software\\Microsoft\\Windows\\CurrentVersion\\Lxss\r\n" +
+		"    DefaultDistribution    REG_SZ    " + ubuntuGUID + "\r\n" +
+		"\r\n" +
+		"HKEY_USERS\\S-1-5-21-1004\\Software\\Microsoft\\Windows\\CurrentVersion\\Lxss\\" + ubuntuGUID + "\r\n" +
+		"    DistributionName    REG_SZ    Ubuntu-22.04\r\n" +
+		"    BasePath    REG_SZ    \\\\?\\C:\\Users\\alice\\AppData\\Local\\Packages\\CanonicalGroupLimited.Ubuntu22.04LTS_79rhkp1fndgsc\\LocalState\r\n" +
+		"    PackageFamilyName    REG_SZ    CanonicalGroupLimited.Ubuntu22.04LTS_79rhkp1fndgsc\r\n" +
+		"    DefaultUid    REG_DWORD    0x3e8\r\n" +
+		"    Version    REG_DWORD    0x2\r\n" +
+		"    State    REG_DWORD    0x1\r\n" +
+		"\r\n" +
+		"HKEY_USERS\\S-1-5-21-1004\\Software\\Microsoft\\Windows\\CurrentVersion\\Lxss\\" + kaliGUID + "\r\n" +
+		"    DistributionName    REG_SZ    kali\r\n" +
+		"    BasePath    REG_SZ    C:\\ProgramData\\wsl\\kali\r\n" +
+		"    DefaultUid    REG_DWORD    0x0\r\n" +
+		"    Version    REG_DWORD    0x2\r\n" +
+		"    State    REG_DWORD    0x1\r\n")
+	live := ParseLxssRegQuery(winutil.ParseRegQuery(output), "alice")
+	fromHive, err := ParseLxssHive(lxssHive(t), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(live) != len(fromHive) {
+		t.Fatalf("reg query found %d distributions, the hive %d", len(live), len(fromHive))
+	}
+	for i := range live {
+		live[i].Source, fromHive[i].Source, fromHive[i].KeyLastWritten = "", "", ""
+	}
+	if !reflect.DeepEqual(live, fromHive) {
+		t.Fatalf("reg query = %+v\nhive %+v", live, fromHive)
+	}
+}
+
+func TestFinalizeReportFlagsDistributions(t *testing.T) {
+	distributions, err := ParseLxssHive(lxssHive(t), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	distributions[0].Image = &WSLImage{Path: distributions[0].BasePath + `\ext4.vhdx`, Modified: "2024-03-01T08:00:00Z"}
+	distributions = append(distributions, WSLDistribution{
+		User:   "alice",
+		Source: "filesystem",
+		Image:  &WSLImage{Path: `C:\Users\alice\wsl\ext4.vhdx`, Modified: "2023-06-01T00:00:00Z"},
+	})
+	report := &WSLReport{Distributions: distributions}
+	FinalizeReport(report, time.Date(2024, 2, 23, 0, 0, 0, 0, time.UTC))
+
+	want := []string{
+		`unregistered_image: C:\Users\alice\wsl\ext4.vhdx (user alice) has no Lxss registration`,
+		"recently_modified_image: Ubuntu-22.04 (user alice) disk image written 2024-03-01T08:00:00Z",
+		"root_default_user: kali (user alice) logs in as root by default",
+	}
+	if !reflect.DeepEqual(report.Findings, want) {
+		t.Fatalf("findings = %q", report.Findings)
+	}
+}
@@ -14,6 +14,17 @@ import (
 // For durations, it computes nowUTC - duration and returns the result as RFC3339.
 // Returns the normalized RFC3339 string, whether the input was set, and any error.
 func NormalizeSince(input string, now time.Time) (normalizedRFC3339 string, wasSet bool, err error) {
+	return normalizeTimeBound("--since", input, now)
+}
+
+// NormalizeUntil parses and normalizes an --until flag value using the same rules as
+// NormalizeSince: an RFC3339 timestamp, or a duration meaning "that long before now".
+func NormalizeUntil(input string, now time.Time) (normalizedRFC3339 string, wasSet bool, err error) {
+	return normalizeTimeBound("--until", input, now)
+}
+
+// normalizeTimeBound implements NormalizeSince and NormalizeUntil for the named flag.
+func normalizeTimeBound(flagName, input string, now time.Time) (normalizedRFC3339 string, wasSet bool, err error) {
 	if input == "" {
 		return "", false, nil
 	}
@@ -26,7 +37,7 @@ func NormalizeSince(input string, now time.Time) (normalizedRFC3339 string, wasS
 	// Try parsing as duration
 	duration, err := parseDurationWithWeeksAndDays(input)
 	if err != nil {
-		return "", true, fmt.Errorf("invalid --since: must be RFC3339 or a duration like 7d, 72h, 15m, 30s, 2w")
+		return "", true, fmt.Errorf("invalid %s: must be RFC3339 or a duration like 7d, 72h, 15m, 30s, 2w", flagName)
 	}
 
 	// Compute nowUTC - duration and format as RFC3339 (truncate to seconds)
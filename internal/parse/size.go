@@ -0,0 +1,43 @@
+package parse
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// byteSizePattern matches a size such as "1GB", "500 MB", "1.5g", or "4096".
+var byteSizePattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([kmgt]?)(?:i?b)?$`)
+
+// ParseByteSize parses a size with an optional K, M, G, or T unit, each a
+// power of 1024 as in the --*-mb flags, e.g. "1GB" is 1024 MB. A bare number
+// is bytes. Units are case-insensitive and may end in B or iB.
+func ParseByteSize(s string) (int64, error) {
+	parts := byteSizePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if parts == nil {
+		return 0, fmt.Errorf("invalid size %q: use a number with an optional unit, e.g. 1GB or 500MB", s)
+	}
+	value, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+
+	scale := float64(1)
+	switch parts[2] {
+	case "k":
+		scale = 1 << 10
+	case "m":
+		scale = 1 << 20
+	case "g":
+		scale = 1 << 30
+	case "t":
+		scale = 1 << 40
+	}
+	size := value * scale
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return int64(size), nil
+}
@@ -0,0 +1,265 @@
+// Package prefetch decodes Windows prefetch (.pf) files: the executable name,
+// run count, last run times, and the volumes, directories, and files the
+// program loaded in its first seconds.
+package prefetch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// Prefetch format versions by the Windows release that writes them.
+const (
+	VersionXP    = 17 // Windows XP and Server 2003
+	VersionVista = 23 // Windows Vista and 7
+	Version8     = 26 // Windows 8 and 8.1
+	Version10    = 30 // Windows 10 and 11
+	Version11    = 31 // Windows 11 24H2
+)
+
+// mamSignature starts a compressed prefetch file; the fourth byte is the
+// compression format, with the high bit set when a CRC32 follows the size.
+var mamSignature = []byte("MAM")
+
+// mamXpressHuffman is the MAM compression format Windows 10 writes.
+const mamXpressHuffman = 4
+
+// sccaSignature follows the version number of a decompressed prefetch file.
+var sccaSignature = []byte("SCCA")
+
+// sccaHeaderSize is the header before the file information section.
+const sccaHeaderSize = 84
+
+var errTruncated = errors.New("prefetch file is truncated")
+
+// File is the decoded content of a prefetch file.
+type File struct {
+	Version        int
+	Compressed     bool // Stored MAM-compressed, as Windows 10 and later write them
+	ExecutableName string
+	Hash           uint32 // Of the executable's path, the hex suffix of the file name
+	RunCount       int
+	LastRunTimes   []time.Time // Most recent first; Windows 8 and later keep eight
+	Volumes        []Volume
+	Files          []string // Files loaded, as NT device paths
+}
+
+// Volume is a volume the program loaded files from.
+type Volume struct {
+	DevicePath   string
+	SerialNumber uint32
+	Created      time.Time
+	Directories  []string
+}
+
+// Parse decodes a prefetch file, decompressing it first when it is
+// MAM-compressed.
+func Parse(data []byte) (*File, error) {
+	compressed := false
+	if len(data) >= 8 && bytes.Equal(data[:3], mamSignature) {
+		decompressed, err := decompressMAM(data)
+		if err != nil {
+			return nil, err
+		}
+		data, compressed = decompressed, true
+	}
+
+	if len(data) < sccaHeaderSize || !bytes.Equal(data[4:8], sccaSignature) {
+		return nil, errors.New("not a prefetch file")
+	}
+	file := &File{
+		Version:        int(binary.LittleEndian.Uint32(data)),
+		Compressed:     compressed,
+		ExecutableName: decodeUTF16(data[16:76]),
+		Hash:           binary.LittleEndian.Uint32(data[76:]),
+	}
+
+	layout, ok := layouts[file.Version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported prefetch version %d", file.Version)
+	}
+	info := data[sccaHeaderSize:]
+	if len(info) < layout.infoSize {
+		return nil, errTruncated
+	}
+
+	file.RunCount = int(binary.LittleEndian.Uint32(info[layout.runCount(info):]))
+	for i := 0; i < layout.lastRunTimes; i++ {
+		if t := filetime(info[layout.lastRunTime+8*i:]); !t.IsZero() {
+			file.LastRunTimes = append(file.LastRunTimes, t)
+		}
+	}
+
+	stringsOffset := int(binary.LittleEndian.Uint32(info[16:]))
+	stringsSize := int(binary.LittleEndian.Uint32(info[20:]))
+	if section, ok := slice(data, stringsOffset, stringsSize); ok {
+		file.Files = splitUTF16(section)
+	}
+
+	volumesOffset := int(binary.LittleEndian.Uint32(info[24:]))
+	volumeCount := int(binary.LittleEndian.Uint32(info[28:]))
+	volumesSize := int(binary.LittleEndian.Uint32(info[32:]))
+	if section, ok := slice(data, volumesOffset, volumesSize); ok {
+		file.Volumes = parseVolumes(section, volumeCount, layout.volumeEntrySize)
+	}
+
+	return file, nil
+}
+
+// layout locates the fields of one prefetch version's file information
+// section, relative to its start after the header. infoSize is the shortest
+// section a version writes: the metrics array starts at 0xF0 in Vista and 7
+// files, at 0x130 in Windows 8 files, and at 0x130 or 0x128 in Windows 10.
+type layout struct {
+	infoSize        int
+	lastRunTime     int
+	lastRunTimes    int
+	runCountOffset  int
+	volumeEntrySize int
+	shortVariant    bool // Windows 10 also writes a section 8 bytes shorter, with the run count 8 bytes earlier
+}
+
+var layouts = map[int]layout{
+	VersionXP:    {infoSize: 68, lastRunTime: 36, lastRunTimes: 1, runCountOffset: 60, volumeEntrySize: 40},
+	VersionVista: {infoSize: 156, lastRunTime: 44, lastRunTimes: 1, runCountOffset: 68, volumeEntrySize: 104},
+	Version8:     {infoSize: 220, lastRunTime: 44, lastRunTimes: 8, runCountOffset: 124, volumeEntrySize: 104},
+	Version10:    {infoSize: 212, lastRunTime: 44, lastRunTimes: 8, runCountOffset: 124, volumeEntrySize: 96, shortVariant: true},
+	Version11:    {infoSize: 212, lastRunTime: 44, lastRunTimes: 8, runCountOffset: 124, volumeEntrySize: 96, shortVariant: true},
+}
+
+// shortInfoEnd is where the metrics array starts after the shorter Windows 10
+// file information section.
+const shortInfoEnd = sccaHeaderSize + 212
+
+// runCount returns where the run count is. The metrics array follows the
+// file information section directly, so its offset tells the section's size.
+func (l layout) runCount(info []byte) int {
+	if l.shortVariant && binary.LittleEndian.Uint32(info) == shortInfoEnd {
+		return l.runCountOffset - 8
+	}
+	return l.runCountOffset
+}
+
+// parseVolumes decodes the volume information entries. Offsets inside an
+// entry are relative to the start of the volumes section.
+func parseVolumes(section []byte, count, entrySize int) []Volume {
+	// A corrupt count cannot claim more entries than the section holds
+	count = min(count, len(section)/entrySize)
+	volumes := make([]Volume, 0, count)
+	for i := 0; i < count; i++ {
+		entry, ok := slice(section, i*entrySize, entrySize)
+		if !ok {
+			break
+		}
+		volume := Volume{
+			Created:      filetime(entry[8:]),
+			SerialNumber: binary.LittleEndian.Uint32(entry[16:]),
+		}
+		pathOffset := int(binary.LittleEndian.Uint32(entry))
+		pathChars := int(binary.LittleEndian.Uint32(entry[4:]))
+		if path, ok := slice(section, pathOffset, 2*pathChars); ok {
+			volume.DevicePath = decodeUTF16(path)
+		}
+
+		// Directory strings are a 16-bit character count, then the
+		// NUL-terminated name
+		dirOffset := int(binary.LittleEndian.Uint32(entry[28:]))
+		dirCount := int(binary.LittleEndian.Uint32(entry[32:]))
+		pos := dirOffset
+		for d := 0; d < dirCount; d++ {
+			header, ok := slice(section, pos, 2)
+			if !ok {
+				break
+			}
+			chars := int(binary.LittleEndian.Uint16(header))
+			name, ok := slice(section, pos+2, 2*chars)
+			if !ok {
+				break
+			}
+			volume.Directories = append(volume.Directories, decodeUTF16(name))
+			pos += 2 + 2*(chars+1)
+		}
+
+		volumes = append(volumes, volume)
+	}
+	return volumes
+}
+
+// decompressMAM expands a MAM-compressed prefetch file: "MAM", the format
+// byte, the decompressed size, an optional CRC32, then the stream.
+func decompressMAM(data []byte) ([]byte, error) {
+	format := data[3]
+	size := int(binary.LittleEndian.Uint32(data[4:]))
+	stream := data[8:]
+	if format&0x80 != 0 {
+		if len(stream) < 4 {
+			return nil, errTruncated
+		}
+		stream = stream[4:]
+	}
+	if format&0x7F != mamXpressHuffman {
+		return nil, fmt.Errorf("unsupported MAM compression format %d", format&0x7F)
+	}
+	// Prefetch files are small; a huge size means a corrupt header
+	if size <= 0 || size > 64<<20 {
+		return nil, fmt.Errorf("implausible decompressed size %d", size)
+	}
+	out, err := decompressXpressHuffman(stream, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress prefetch file: %w", err)
+	}
+	return out, nil
+}
+
+// slice returns b[offset:offset+size] when it lies within b.
+func slice(b []byte, offset, size int) ([]byte, bool) {
+	if offset < 0 || size < 0 || offset > len(b) || size > len(b)-offset {
+		return nil, false
+	}
+	return b[offset : offset+size], true
+}
+
+// filetime converts the FILETIME at the start of b.
+func filetime(b []byte) time.Time {
+	return winutil.FiletimeToUTC(binary.LittleEndian.Uint64(b))
+}
+
+// decodeUTF16 decodes little-endian UTF-16 up to the first NUL.
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+// splitUTF16 decodes a run of NUL-terminated UTF-16 strings.
+func splitUTF16(b []byte) []string {
+	var out []string
+	units := make([]uint16, 0, 64)
+	for i := 0; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u != 0 {
+			units = append(units, u)
+			continue
+		}
+		if len(units) > 0 {
+			out = append(out, string(utf16.Decode(units)))
+			units = units[:0]
+		}
+	}
+	if len(units) > 0 {
+		out = append(out, string(utf16.Decode(units)))
+	}
+	return out
+}
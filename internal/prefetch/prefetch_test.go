@@ -0,0 +1,239 @@
+package prefetch
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// fixture describes a synthetic prefetch file.
+type fixture struct {
+	version  int
+	infoSize int // File information section size; the metrics array follows it
+	runCount int // Where the run count is in the file information section
+	lastRuns []time.Time
+}
+
+var (
+	fixtureRun     = time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	fixtureCreated = time.Date(2023, 6, 12, 8, 0, 0, 0, time.UTC)
+	fixtureFiles   = []string{`\VOLUME{01d2}\WINDOWS\SYSTEM32\NTDLL.DLL`, `\VOLUME{01d2}\TEMP\EVIL.EXE`}
+)
+
+func utf16le(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+func putFiletime(b []byte, t time.Time) {
+	binary.LittleEndian.PutUint64(b, uint64(t.UnixNano()/100+116444736000000000))
+}
+
+// build lays out the header, the file information section, the filename
+// strings, and one volume with one directory.
+func (f fixture) build() []byte {
+	layout := layouts[f.version]
+	header := make([]byte, sccaHeaderSize)
+	binary.LittleEndian.PutUint32(header, uint32(f.version))
+	copy(header[4:], sccaSignature)
+	copy(header[16:76], utf16le("EVIL.EXE"))
+	binary.LittleEndian.PutUint32(header[76:], 0x1A2B3C4D)
+
+	var strs []byte
+	for _, name := range fixtureFiles {
+		strs = append(strs, utf16le(name)...)
+		strs = append(strs, 0, 0)
+	}
+
+	entrySize := layout.volumeEntrySize
+	devicePath := utf16le(`\VOLUME{01d2}`)
+	dirName := utf16le(`\VOLUME{01d2}\TEMP`)
+	volumes := make([]byte, entrySize)
+	binary.LittleEndian.PutUint32(volumes, uint32(entrySize))
+	binary.LittleEndian.PutUint32(volumes[4:], uint32(len(devicePath)/2))
+	putFiletime(volumes[8:], fixtureCreated)
+	binary.LittleEndian.PutUint32(volumes[16:], 0xDEADBEEF)
+	volumes = append(volumes, devicePath...)
+	volumes = append(volumes, 0, 0)
+	binary.LittleEndian.PutUint32(volumes[28:], uint32(len(volumes)))
+	binary.LittleEndian.PutUint32(volumes[32:], 1)
+	volumes = binary.LittleEndian.AppendUint16(volumes, uint16(len(dirName)/2))
+	volumes = append(volumes, dirName...)
+	volumes = append(volumes, 0, 0)
+
+	metricsOffset := sccaHeaderSize + f.infoSize
+	stringsOffset := metricsOffset + 32
+	volumesOffset := stringsOffset + len(strs)
+	info := make([]byte, f.infoSize)
+	binary.LittleEndian.PutUint32(info, uint32(metricsOffset))
+	binary.LittleEndian.PutUint32(info[16:], uint32(stringsOffset))
+	binary.LittleEndian.PutUint32(info[20:], uint32(len(strs)))
+	binary.LittleEndian.PutUint32(info[24:], uint32(volumesOffset))
+	binary.LittleEndian.PutUint32(info[28:], 1)
+	binary.LittleEndian.PutUint32(info[32:], uint32(len(volumes)))
+	for i, t := range f.lastRuns {
+		putFiletime(info[layout.lastRunTime+8*i:], t)
+	}
+	binary.LittleEndian.PutUint32(info[f.runCount:], 7)
+
+	data := append(header, info...)
+	data = append(data, make([]byte, 32)...) // Metrics array
+	data = append(data, strs...)
+	data = append(data, volumes...)
+	binary.LittleEndian.PutUint32(data[12:], uint32(len(data)))
+	return data
+}
+
+// compressMAM wraps data as Windows 10 stores prefetch files, as one Xpress
+// Huffman block of literals, every byte value with an 8-bit code.
+func compressMAM(data []byte) []byte {
+	if len(data) > xpressBlockSize {
+		panic("fixture does not fit one Xpress block")
+	}
+	out := append([]byte("MAM"), mamXpressHuffman)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(data)))
+	for i := 0; i < xpressTableBytes; i++ {
+		if i < 128 {
+			out = append(out, 0x88)
+		} else {
+			out = append(out, 0)
+		}
+	}
+	// Canonical 8-bit codes equal the literal, so the stream is the data
+	// packed two bytes, most significant first, to a little-endian word
+	for i := 0; i < len(data); i += 2 {
+		hi, lo := data[i], byte(0)
+		if i+1 < len(data) {
+			lo = data[i+1]
+		}
+		out = append(out, lo, hi)
+	}
+	return append(out, 0, 0, 0, 0)
+}
+
+func checkFixture(t *testing.T, file *File, version int, lastRuns int) {
+	t.Helper()
+	if file.Version != version || file.ExecutableName != "EVIL.EXE" || file.Hash != 0x1A2B3C4D {
+		t.Fatalf("header = version %d, %q, hash %08X", file.Version, file.ExecutableName, file.Hash)
+	}
+	if file.RunCount != 7 {
+		t.Fatalf("run count = %d, want 7", file.RunCount)
+	}
+	if len(file.LastRunTimes) != lastRuns || !file.LastRunTimes[0].Equal(fixtureRun) {
+		t.Fatalf("last run times = %v, want %d starting at %v", file.LastRunTimes, lastRuns, fixtureRun)
+	}
+	if len(file.Files) != len(fixtureFiles) || file.Files[1] != fixtureFiles[1] {
+		t.Fatalf("files = %q", file.Files)
+	}
+	if len(file.Volumes) != 1 {
+		t.Fatalf("volumes = %+v", file.Volumes)
+	}
+	volume := file.Volumes[0]
+	if volume.DevicePath != `\VOLUME{01d2}` || volume.SerialNumber != 0xDEADBEEF || !volume.Created.Equal(fixtureCreated) {
+		t.Fatalf("volume = %+v", volume)
+	}
+	if len(volume.Directories) != 1 || volume.Directories[0] != `\VOLUME{01d2}\TEMP` {
+		t.Fatalf("directories = %q", volume.Directories)
+	}
+}
+
+func TestParseUncompressedVista(t *testing.T) {
+	// Vista and 7 files have the metrics array at 0xF0 and the run count at 0x98
+	data := fixture{version: VersionVista, infoSize: 156, runCount: 0x98 - sccaHeaderSize, lastRuns: []time.Time{fixtureRun}}.build()
+	file, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Compressed {
+		t.Fatal("uncompressed file reported as compressed")
+	}
+	checkFixture(t, file, VersionVista, 1)
+}
+
+func TestParseCompressedWindows10(t *testing.T) {
+	runs := []time.Time{fixtureRun, fixtureRun.Add(-time.Hour), fixtureRun.Add(-48 * time.Hour)}
+	tests := []struct {
+		name          string
+		infoSize      int
+		metricsOffset int
+		runCount      int // Offset in the file
+	}{
+		{"long section", 220, 0x130, 0xD0},
+		{"short section", 212, 0x128, 0xC8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if sccaHeaderSize+tt.infoSize != tt.metricsOffset {
+				t.Fatalf("fixture metrics offset %#x does not follow a %d-byte section", tt.metricsOffset, tt.infoSize)
+			}
+			data := fixture{version: Version10, infoSize: tt.infoSize, runCount: tt.runCount - sccaHeaderSize, lastRuns: runs}.build()
+			file, err := Parse(compressMAM(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !file.Compressed {
+				t.Fatal("MAM file not reported as compressed")
+			}
+			checkFixture(t, file, Version10, len(runs))
+		})
+	}
+	if shortInfoEnd != 0x128 {
+		t.Fatalf("shortInfoEnd = %#x, want the 0x128 metrics offset of the short section", shortInfoEnd)
+	}
+}
+
+func TestParseRejectsTruncatedAndCorruptFiles(t *testing.T) {
+	vista := fixture{version: VersionVista, infoSize: 156, runCount: 68, lastRuns: []time.Time{fixtureRun}}.build()
+	win10 := fixture{version: Version10, infoSize: 212, runCount: 116, lastRuns: []time.Time{fixtureRun}}.build()
+	compressed := compressMAM(win10)
+
+	badVersion := append([]byte(nil), vista...)
+	binary.LittleEndian.PutUint32(badVersion, 99)
+	badFormat := append([]byte(nil), compressed...)
+	badFormat[3] = 2
+	hugeSize := append([]byte(nil), compressed...)
+	binary.LittleEndian.PutUint32(hugeSize[4:], 1<<30)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, nil},
+		{"not prefetch", []byte("MZ\x90\x00 this is a PE file, not a prefetch file at all ........................"), nil},
+		{"truncated information", vista[:sccaHeaderSize+100], errTruncated},
+		{"unsupported version", badVersion, nil},
+		{"truncated stream", compressed[:200], nil},
+		{"unsupported MAM format", badFormat, nil},
+		{"implausible size", hugeSize, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := Parse(tt.data)
+			if err == nil {
+				t.Fatalf("Parse accepted a bad file: %+v", file)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Parse = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Sections pointing past the end are left out rather than failing the file
+	corrupt := append([]byte(nil), vista...)
+	binary.LittleEndian.PutUint32(corrupt[sccaHeaderSize+20:], 1<<20)
+	binary.LittleEndian.PutUint32(corrupt[sccaHeaderSize+28:], 1<<20)
+	file, err := Parse(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Files) != 0 || len(file.Volumes) != 1 || file.RunCount != 7 {
+		t.Fatalf("corrupt sections decoded as %+v", file)
+	}
+}
@@ -0,0 +1,199 @@
+package prefetch
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Xpress Huffman parameters (MS-XCA 2.2): each block of up to 64 KiB of
+// output is preceded by the 4-bit code lengths of its 512 symbols, and no
+// code is longer than 15 bits.
+const (
+	xpressBlockSize    = 64 * 1024
+	xpressSymbols      = 512
+	xpressTableBytes   = xpressSymbols / 2
+	xpressMaxCodeBits  = 15
+	xpressDecodeTable  = 1 << xpressMaxCodeBits
+	xpressMinMatchSize = 3
+)
+
+var errXpressCorrupt = errors.New("corrupt Xpress Huffman stream")
+
+// decompressXpressHuffman decodes an LZ77+Huffman stream (MS-XCA 2.2.4), as
+// used by compressed prefetch files, into exactly outSize bytes.
+func decompressXpressHuffman(in []byte, outSize int) ([]byte, error) {
+	out := make([]byte, 0, outSize)
+	pos := 0
+
+	var lengths [xpressSymbols]uint8
+	var table [xpressDecodeTable]uint16
+	for len(out) < outSize {
+		if pos+xpressTableBytes+4 > len(in) {
+			return nil, errXpressCorrupt
+		}
+		for i, b := range in[pos : pos+xpressTableBytes] {
+			lengths[2*i] = b & 0x0F
+			lengths[2*i+1] = b >> 4
+		}
+		if err := buildXpressTable(&lengths, &table); err != nil {
+			return nil, err
+		}
+		pos += xpressTableBytes
+
+		// Codes are read most significant bit first from little-endian
+		// 16-bit words; extra length bytes sit between the words
+		r := &xpressBits{in: in, pos: pos}
+		r.bits = uint32(r.word())<<16 | uint32(r.word())
+		r.extra = 16
+
+		blockEnd := min(len(out)+xpressBlockSize, outSize)
+		for len(out) < blockEnd {
+			symbol := table[r.bits>>(32-xpressMaxCodeBits)]
+			if err := r.consume(int(lengths[symbol])); err != nil {
+				return nil, err
+			}
+			if symbol < 256 {
+				out = append(out, byte(symbol))
+				continue
+			}
+
+			symbol -= 256
+			length := int(symbol & 15)
+			offsetBits := int(symbol >> 4)
+			if length == 15 {
+				b, err := r.byte()
+				if err != nil {
+					return nil, err
+				}
+				length = int(b)
+				if length == 255 {
+					w, err := r.rawUint16()
+					if err != nil {
+						return nil, err
+					}
+					length = int(w)
+					if length == 0 {
+						d, err := r.rawUint32()
+						if err != nil {
+							return nil, err
+						}
+						length = int(d)
+					}
+					if length < 15 {
+						return nil, errXpressCorrupt
+					}
+					length -= 15
+				}
+				length += 15
+			}
+			length += xpressMinMatchSize
+
+			offset := 1 << offsetBits
+			if offsetBits > 0 {
+				offset += int(r.bits >> (32 - offsetBits))
+				if err := r.consume(offsetBits); err != nil {
+					return nil, err
+				}
+			}
+			if offset > len(out) || length > outSize-len(out) {
+				return nil, errXpressCorrupt
+			}
+			// Byte by byte, as a match may overlap the bytes it produces
+			start := len(out) - offset
+			for i := 0; i < length; i++ {
+				out = append(out, out[start+i])
+			}
+		}
+		pos = r.pos
+	}
+	return out, nil
+}
+
+// buildXpressTable fills the decoding table indexed by the next 15 input bits
+// with the symbol of the canonical code they start with.
+func buildXpressTable(lengths *[xpressSymbols]uint8, table *[xpressDecodeTable]uint16) error {
+	entry := 0
+	for bits := 1; bits <= xpressMaxCodeBits; bits++ {
+		for symbol, length := range lengths {
+			if int(length) != bits {
+				continue
+			}
+			count := 1 << (xpressMaxCodeBits - bits)
+			if entry+count > xpressDecodeTable {
+				return errXpressCorrupt
+			}
+			for i := 0; i < count; i++ {
+				table[entry+i] = uint16(symbol)
+			}
+			entry += count
+		}
+	}
+	if entry != xpressDecodeTable {
+		return errXpressCorrupt
+	}
+	return nil
+}
+
+// xpressBits reads the bit stream of an Xpress Huffman block. bits holds the
+// next bits, most significant first, and extra how many of them past the
+// first 16 are valid.
+type xpressBits struct {
+	in    []byte
+	pos   int
+	bits  uint32
+	extra int
+}
+
+// word reads the next 16-bit word, or zero past the end, where the reader
+// looks ahead of the last codes of a stream.
+func (r *xpressBits) word() uint16 {
+	if r.pos+2 > len(r.in) {
+		r.pos += 2
+		return 0
+	}
+	w := binary.LittleEndian.Uint16(r.in[r.pos:])
+	r.pos += 2
+	return w
+}
+
+// consume drops n bits and refills from the next word when fewer than 16
+// remain.
+func (r *xpressBits) consume(n int) error {
+	r.bits <<= n
+	r.extra -= n
+	if r.extra < 0 {
+		if r.pos >= len(r.in)+4 {
+			return errXpressCorrupt
+		}
+		r.bits |= uint32(r.word()) << -r.extra
+		r.extra += 16
+	}
+	return nil
+}
+
+func (r *xpressBits) byte() (byte, error) {
+	if r.pos >= len(r.in) {
+		return 0, errXpressCorrupt
+	}
+	b := r.in[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *xpressBits) rawUint16() (uint16, error) {
+	if r.pos+2 > len(r.in) {
+		return 0, errXpressCorrupt
+	}
+	w := binary.LittleEndian.Uint16(r.in[r.pos:])
+	r.pos += 2
+	return w, nil
+}
+
+func (r *xpressBits) rawUint32() (uint32, error) {
+	if r.pos+4 > len(r.in) {
+		return 0, errXpressCorrupt
+	}
+	d := binary.LittleEndian.Uint32(r.in[r.pos:])
+	r.pos += 4
+	return d, nil
+}
@@ -0,0 +1,122 @@
+// Package progress tracks the file each collection module is copying so an
+// interrupted run can report exactly where it stopped.
+package progress
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ModuleProgress is the copy state of one module's output directory.
+type ModuleProgress struct {
+	ModuleDir      string `json:"module_dir"`
+	InFlight       string `json:"in_flight,omitempty"`
+	LastCompleted  string `json:"last_completed,omitempty"`
+	CompletedFiles int64  `json:"completed_files"`
+}
+
+// slot holds the per-module state. Copies update it with atomic stores so
+// recording progress never blocks a copy on the snapshot lock.
+type slot struct {
+	inFlight      atomic.Pointer[string]
+	lastCompleted atomic.Pointer[string]
+	completed     atomic.Int64
+}
+
+// Tracker attributes copies to modules by the first path component of the
+// destination relative to the artifacts root.
+type Tracker struct {
+	mu    sync.Mutex
+	root  string
+	slots map[string]*slot
+}
+
+// NewTracker creates an empty tracker with no root set.
+func NewTracker() *Tracker {
+	return &Tracker{slots: make(map[string]*slot)}
+}
+
+// Default is the process-wide tracker used by the winutil copy helpers.
+var Default = NewTracker()
+
+// SetRoot sets the artifacts directory and clears previous state. Copies
+// outside the root are not tracked.
+func (t *Tracker) SetRoot(root string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.root = root
+	t.slots = make(map[string]*slot)
+}
+
+// BeginCopy records src as in flight for the module owning dst. The returned
+// function must be called when the copy ends; completed marks src as the
+// module's last fully copied file. A copy that ends without completing stays
+// in flight until the module starts its next one, because a copy cut short by
+// cancellation usually returns before the run takes its snapshot.
+func (t *Tracker) BeginCopy(src, dst string) func(completed bool) {
+	s := t.slotFor(dst)
+	if s == nil {
+		return func(bool) {}
+	}
+
+	path := src
+	s.inFlight.Store(&path)
+	return func(completed bool) {
+		if completed {
+			s.inFlight.CompareAndSwap(&path, nil)
+			s.lastCompleted.Store(&path)
+			s.completed.Add(1)
+		}
+	}
+}
+
+// Snapshot returns the current state of every module that has copied a file.
+func (t *Tracker) Snapshot() []ModuleProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := make([]ModuleProgress, 0, len(t.slots))
+	for dir, s := range t.slots {
+		mp := ModuleProgress{ModuleDir: dir, CompletedFiles: s.completed.Load()}
+		if p := s.inFlight.Load(); p != nil {
+			mp.InFlight = *p
+		}
+		if p := s.lastCompleted.Load(); p != nil {
+			mp.LastCompleted = *p
+		}
+		snapshot = append(snapshot, mp)
+	}
+
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].ModuleDir < snapshot[j].ModuleDir })
+	return snapshot
+}
+
+// slotFor returns the slot of the module directory containing dst.
+func (t *Tracker) slotFor(dst string) *slot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.root == "" {
+		return nil
+	}
+	rel, err := filepath.Rel(t.root, dst)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	dir := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+
+	s, ok := t.slots[dir]
+	if !ok {
+		s = &slot{}
+		t.slots[dir] = s
+	}
+	return s
+}
+
+// BeginCopy records a copy on the Default tracker.
+func BeginCopy(src, dst string) func(completed bool) {
+	return Default.BeginCopy(src, dst)
+}
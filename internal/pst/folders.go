@@ -0,0 +1,181 @@
+package pst
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// Well-known node IDs.
+const (
+	nidMessageStore = 0x21
+	nidRootFolder   = 0x122
+)
+
+// Node ID types (the low five bits of a NID).
+const (
+	nidTypeMask          = 0x1f
+	nidTypeNormalFolder  = 0x02
+	nidTypeContentsTable = 0x0e
+)
+
+// Property IDs read from the store, folders, and contents tables.
+const (
+	propDisplayName        = 0x3001
+	propContentCount       = 0x3602
+	propContentUnreadCount = 0x3603
+)
+
+// Contents table columns holding a message's date, in order of preference.
+var messageTimeTags = []uint32{
+	0x0e060000 | typeTime, // PidTagMessageDeliveryTime
+	0x00390000 | typeTime, // PidTagClientSubmitTime
+	0x30080000 | typeTime, // PidTagLastModificationTime
+}
+
+// Folder is a folder of the mailbox hierarchy. Counts come from the folder's
+// properties; the date range comes from its contents table.
+type Folder struct {
+	NID          uint32
+	ParentNID    uint32
+	Name         string
+	Path         string    // Folder names from the top of the store, joined with "/"
+	MessageCount int64     // PidTagContentCount
+	UnreadCount  int64     // PidTagContentUnreadCount
+	Earliest     time.Time // Oldest message date in the contents table, zero if none
+	Latest       time.Time // Newest message date in the contents table, zero if none
+	Error        string    // Why the folder could not be fully decoded
+}
+
+// StoreName returns the display name of the message store.
+func (f *File) StoreName() (string, error) {
+	if err := f.checkSupported(); err != nil {
+		return "", err
+	}
+	node, err := f.findNode(nidMessageStore)
+	if err != nil {
+		return "", err
+	}
+	pc, err := f.openPropertyContext(node)
+	if err != nil {
+		return "", err
+	}
+	return pc.String(propDisplayName), nil
+}
+
+// Folders returns every folder below the root folder, sorted by path. A
+// folder whose properties or contents table cannot be decoded is still
+// returned with Error set.
+func (f *File) Folders() ([]Folder, error) {
+	if err := f.checkSupported(); err != nil {
+		return nil, err
+	}
+
+	folders := make(map[uint32]*Folder)
+	contents := make(map[uint32]nodeEntry)
+	nodes := make(map[uint32]nodeEntry)
+	err := f.walkNodes(func(node nodeEntry) error {
+		switch node.nid & nidTypeMask {
+		case nidTypeNormalFolder:
+			nodes[node.nid] = node
+			folders[node.nid] = &Folder{NID: node.nid, ParentNID: node.parent}
+		case nidTypeContentsTable:
+			contents[node.nid] = node
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for nid, folder := range folders {
+		pc, err := f.openPropertyContext(nodes[nid])
+		if err != nil {
+			folder.Error = err.Error()
+			continue
+		}
+		folder.Name = pc.String(propDisplayName)
+		folder.MessageCount, _ = pc.Int(propContentCount)
+		folder.UnreadCount, _ = pc.Int(propContentUnreadCount)
+
+		table, ok := contents[nid&^nidTypeMask|nidTypeContentsTable]
+		if !ok {
+			continue
+		}
+		if err := f.messageRange(table, folder); err != nil {
+			folder.Error = fmt.Sprintf("contents table: %v", err)
+		}
+	}
+
+	out := make([]Folder, 0, len(folders))
+	for _, folder := range folders {
+		if folder.NID == nidRootFolder {
+			continue
+		}
+		folder.Path = folderPath(folders, folder)
+		out = append(out, *folder)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].NID < out[j].NID
+	})
+	return out, nil
+}
+
+// messageRange sets a folder's earliest and latest message times from its
+// contents table, using the first date column the table carries per row.
+func (f *File) messageRange(node nodeEntry, folder *Folder) error {
+	tc, err := f.openTableContext(node)
+	if err != nil {
+		return err
+	}
+	var columns []tableColumn
+	for _, tag := range messageTimeTags {
+		if col, ok := tc.column(tag); ok && col.size == 8 {
+			columns = append(columns, col)
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	return tc.forEachRow(func(row []byte) {
+		for _, col := range columns {
+			cell := tc.cell(row, col)
+			if cell == nil {
+				continue
+			}
+			t := winutil.FiletimeToUTC(binary.LittleEndian.Uint64(cell))
+			if t.IsZero() {
+				continue
+			}
+			if folder.Earliest.IsZero() || t.Before(folder.Earliest) {
+				folder.Earliest = t
+			}
+			if t.After(folder.Latest) {
+				folder.Latest = t
+			}
+			return
+		}
+	})
+}
+
+// folderPath joins the names from below the root folder down to folder. The
+// root folder is its own parent and has no name of its own.
+func folderPath(folders map[uint32]*Folder, folder *Folder) string {
+	var names []string
+	seen := make(map[uint32]bool)
+	for cur := folder; cur != nil && !seen[cur.NID]; cur = folders[cur.ParentNID] {
+		seen[cur.NID] = true
+		if cur.NID == nidRootFolder || cur.ParentNID == cur.NID {
+			break
+		}
+		names = append([]string{cur.Name}, names...)
+	}
+	return strings.Join(names, "/")
+}
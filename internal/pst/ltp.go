@@ -0,0 +1,371 @@
+package pst
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Heap-on-node signatures.
+const (
+	heapSignature = 0xec
+	clientBTH     = 0xb5
+	clientTC      = 0x7c
+	clientPC      = 0xbc
+)
+
+// Property types read from property and table contexts.
+const (
+	typeInt32   = 0x0003
+	typeBoolean = 0x000b
+	typeString8 = 0x001e
+	typeString  = 0x001f
+	typeTime    = 0x0040
+)
+
+// heap is a heap-on-node: allocations spread over a node's data blocks and
+// addressed by HID. Values too large for the heap live in subnodes.
+type heap struct {
+	file     *File
+	blocks   [][]byte
+	subnodes map[uint32]subnode
+	client   byte
+	userRoot uint32
+}
+
+// openHeap reads the heap stored in a node.
+func (f *File) openHeap(node nodeEntry) (*heap, error) {
+	blocks, err := f.readData(node.bidData)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 || len(blocks[0]) < 12 {
+		return nil, fmt.Errorf("node %#x has no heap", node.nid)
+	}
+	if blocks[0][2] != heapSignature {
+		return nil, fmt.Errorf("node %#x is not a heap-on-node", node.nid)
+	}
+	subnodes, err := f.readSubnodes(node.bidSub)
+	if err != nil {
+		return nil, err
+	}
+	return &heap{
+		file:     f,
+		blocks:   blocks,
+		subnodes: subnodes,
+		client:   blocks[0][3],
+		userRoot: binary.LittleEndian.Uint32(blocks[0][4:8]),
+	}, nil
+}
+
+// isHID reports whether an HNID refers to a heap allocation rather than a subnode.
+func isHID(hnid uint32) bool {
+	return hnid&0x1f == 0
+}
+
+// alloc returns the bytes of a heap allocation.
+func (h *heap) alloc(hid uint32) ([]byte, error) {
+	if !isHID(hid) {
+		return nil, fmt.Errorf("hnid %#x is not a heap id", hid)
+	}
+	index := int(hid>>5) & 0x7ff
+	blockIndex := int(hid >> 16)
+	if index == 0 || blockIndex >= len(h.blocks) {
+		return nil, fmt.Errorf("heap id %#x out of range", hid)
+	}
+	block := h.blocks[blockIndex]
+	if len(block) < 2 {
+		return nil, fmt.Errorf("heap block %d is truncated", blockIndex)
+	}
+	pageMap := int(binary.LittleEndian.Uint16(block))
+	if pageMap+4 > len(block) {
+		return nil, fmt.Errorf("heap page map of block %d out of range", blockIndex)
+	}
+	count := int(binary.LittleEndian.Uint16(block[pageMap:]))
+	if index > count || pageMap+4+(count+1)*2 > len(block) {
+		return nil, fmt.Errorf("heap id %#x out of range", hid)
+	}
+	start := int(binary.LittleEndian.Uint16(block[pageMap+4+(index-1)*2:]))
+	end := int(binary.LittleEndian.Uint16(block[pageMap+4+index*2:]))
+	if start > end || end > len(block) {
+		return nil, fmt.Errorf("heap allocation %#x is corrupt", hid)
+	}
+	return block[start:end], nil
+}
+
+// value returns the bytes an HNID refers to, from the heap or a subnode.
+func (h *heap) value(hnid uint32) ([]byte, error) {
+	if hnid == 0 {
+		return nil, nil
+	}
+	if isHID(hnid) {
+		return h.alloc(hnid)
+	}
+	blocks, err := h.subnodeData(hnid)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	for _, b := range blocks {
+		data = append(data, b...)
+	}
+	return data, nil
+}
+
+// subnodeData returns the data blocks of one of the node's subnodes.
+func (h *heap) subnodeData(nid uint32) ([][]byte, error) {
+	sub, ok := h.subnodes[nid]
+	if !ok {
+		return nil, fmt.Errorf("subnode %#x: %w", nid, ErrNotFound)
+	}
+	return h.file.readData(sub.bidData)
+}
+
+// bthRecord is a leaf record of a BTree-on-heap.
+type bthRecord struct {
+	key  []byte
+	data []byte
+}
+
+// bthRecords returns every leaf record of the BTree-on-heap whose header is at hid.
+func (h *heap) bthRecords(hid uint32) ([]bthRecord, error) {
+	header, err := h.alloc(hid)
+	if err != nil {
+		return nil, err
+	}
+	if len(header) < 8 || header[0] != clientBTH {
+		return nil, fmt.Errorf("heap id %#x is not a b-tree header", hid)
+	}
+	keySize, dataSize, levels := int(header[1]), int(header[2]), int(header[3])
+	if keySize == 0 {
+		return nil, fmt.Errorf("b-tree at %#x has empty keys", hid)
+	}
+	var records []bthRecord
+	err = h.collectRecords(binary.LittleEndian.Uint32(header[4:8]), levels, keySize, dataSize, &records)
+	return records, err
+}
+
+func (h *heap) collectRecords(hid uint32, level, keySize, dataSize int, records *[]bthRecord) error {
+	if hid == 0 {
+		return nil
+	}
+	if level > maxTreeDepth {
+		return fmt.Errorf("heap b-tree too deep")
+	}
+	data, err := h.alloc(hid)
+	if err != nil {
+		return err
+	}
+	if level > 0 {
+		for i := 0; i+keySize+4 <= len(data); i += keySize + 4 {
+			if err := h.collectRecords(binary.LittleEndian.Uint32(data[i+keySize:]), level-1, keySize, dataSize, records); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := 0; i+keySize+dataSize <= len(data); i += keySize + dataSize {
+		*records = append(*records, bthRecord{key: data[i : i+keySize], data: data[i+keySize : i+keySize+dataSize]})
+	}
+	return nil
+}
+
+// property is an entry of a property context.
+type property struct {
+	typ  uint16
+	hnid uint32 // Inline data for types of 4 bytes or less
+}
+
+// propertyContext is a decoded property context (a node's property bag).
+type propertyContext struct {
+	heap  *heap
+	props map[uint16]property
+}
+
+// openPropertyContext reads the property context stored in a node.
+func (f *File) openPropertyContext(node nodeEntry) (*propertyContext, error) {
+	h, err := f.openHeap(node)
+	if err != nil {
+		return nil, err
+	}
+	if h.client != clientPC {
+		return nil, fmt.Errorf("node %#x is not a property context", node.nid)
+	}
+	records, err := h.bthRecords(h.userRoot)
+	if err != nil {
+		return nil, err
+	}
+	pc := &propertyContext{heap: h, props: make(map[uint16]property, len(records))}
+	for _, rec := range records {
+		if len(rec.key) != 2 || len(rec.data) != 6 {
+			return nil, fmt.Errorf("node %#x has malformed property records", node.nid)
+		}
+		pc.props[binary.LittleEndian.Uint16(rec.key)] = property{
+			typ:  binary.LittleEndian.Uint16(rec.data),
+			hnid: binary.LittleEndian.Uint32(rec.data[2:]),
+		}
+	}
+	return pc, nil
+}
+
+// String returns a string property, or "" if it is absent.
+func (pc *propertyContext) String(id uint16) string {
+	prop, ok := pc.props[id]
+	if !ok || (prop.typ != typeString && prop.typ != typeString8) {
+		return ""
+	}
+	data, err := pc.heap.value(prop.hnid)
+	if err != nil {
+		return ""
+	}
+	return decodeString(prop.typ, data)
+}
+
+// Int returns an integer property and whether it is present.
+func (pc *propertyContext) Int(id uint16) (int64, bool) {
+	prop, ok := pc.props[id]
+	if !ok {
+		return 0, false
+	}
+	switch prop.typ {
+	case typeInt32:
+		return int64(int32(prop.hnid)), true
+	case typeBoolean:
+		return int64(prop.hnid & 0xff), true
+	}
+	return 0, false
+}
+
+// tableColumn describes a column of a table context.
+type tableColumn struct {
+	tag    uint32 // Property ID in the high word, type in the low word
+	offset int
+	size   int
+	bit    int // Index of the column's bit in the cell existence block
+}
+
+// tableContext is a decoded table context (a node's rows, e.g. a folder's contents).
+type tableContext struct {
+	heap      *heap
+	columns   []tableColumn
+	rowSize   int
+	cebOffset int
+	rows      uint32 // HNID of the row matrix
+	rowIndex  uint32 // HID of the row index b-tree
+}
+
+// openTableContext reads the table context stored in a node.
+func (f *File) openTableContext(node nodeEntry) (*tableContext, error) {
+	h, err := f.openHeap(node)
+	if err != nil {
+		return nil, err
+	}
+	if h.client != clientTC {
+		return nil, fmt.Errorf("node %#x is not a table context", node.nid)
+	}
+	info, err := h.alloc(h.userRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(info) < 22 || info[0] != clientTC {
+		return nil, fmt.Errorf("node %#x has a malformed table header", node.nid)
+	}
+	count := int(info[1])
+	if 22+count*8 > len(info) {
+		return nil, fmt.Errorf("node %#x has a truncated column list", node.nid)
+	}
+	tc := &tableContext{
+		heap:      h,
+		cebOffset: int(binary.LittleEndian.Uint16(info[6:8])),
+		rowSize:   int(binary.LittleEndian.Uint16(info[8:10])),
+		rowIndex:  binary.LittleEndian.Uint32(info[10:14]),
+		rows:      binary.LittleEndian.Uint32(info[14:18]),
+	}
+	for i := 0; i < count; i++ {
+		col := info[22+i*8:]
+		tc.columns = append(tc.columns, tableColumn{
+			tag:    binary.LittleEndian.Uint32(col),
+			offset: int(binary.LittleEndian.Uint16(col[4:6])),
+			size:   int(col[6]),
+			bit:    int(col[7]),
+		})
+	}
+	return tc, nil
+}
+
+// column returns the column with the given tag.
+func (tc *tableContext) column(tag uint32) (tableColumn, bool) {
+	for _, col := range tc.columns {
+		if col.tag == tag {
+			return col, true
+		}
+	}
+	return tableColumn{}, false
+}
+
+// forEachRow calls fn with the raw bytes of every row. Rows never span data
+// blocks, so each block of the row matrix holds a whole number of rows.
+func (tc *tableContext) forEachRow(fn func(row []byte)) error {
+	if tc.rows == 0 || tc.rowSize == 0 {
+		return nil
+	}
+	remaining := -1
+	if tc.rowIndex != 0 {
+		records, err := tc.heap.bthRecords(tc.rowIndex)
+		if err != nil {
+			return err
+		}
+		remaining = len(records)
+	}
+
+	var blocks [][]byte
+	if isHID(tc.rows) {
+		data, err := tc.heap.alloc(tc.rows)
+		if err != nil {
+			return err
+		}
+		blocks = [][]byte{data}
+	} else {
+		var err error
+		if blocks, err = tc.heap.subnodeData(tc.rows); err != nil {
+			return err
+		}
+	}
+	for _, block := range blocks {
+		for i := 0; i+tc.rowSize <= len(block) && remaining != 0; i += tc.rowSize {
+			fn(block[i : i+tc.rowSize])
+			remaining--
+		}
+	}
+	return nil
+}
+
+// cell returns a fixed-size cell of a row, or nil when the cell is empty.
+func (tc *tableContext) cell(row []byte, col tableColumn) []byte {
+	ceb := tc.cebOffset + col.bit/8
+	if ceb >= len(row) || row[ceb]&(0x80>>(col.bit%8)) == 0 {
+		return nil
+	}
+	if col.offset+col.size > len(row) {
+		return nil
+	}
+	return row[col.offset : col.offset+col.size]
+}
+
+// decodeString decodes PtypString (UTF-16LE) and PtypString8 data. 8-bit
+// strings are read as Latin-1 since the code page is not recorded.
+func decodeString(typ uint16, data []byte) string {
+	if typ == typeString8 {
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return strings.TrimRight(string(runes), "\x00")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
@@ -0,0 +1,506 @@
+// Package pst provides a minimal read-only reader for Outlook PST and OST
+// files. It decodes the file header of the ANSI, Unicode, and 4K-page
+// Unicode formats and, for ANSI and Unicode files, walks the node and block
+// B-trees and the property and table contexts of folders so the folder
+// hierarchy, message counts, and message date ranges can be reported without
+// Outlook or MAPI. Message bodies, recipients, and attachments are never read.
+package pst
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// headerMagic begins every PST and OST file.
+const headerMagic = "!BDN"
+
+// Client signatures recorded in the header.
+const (
+	clientPST = 0x4d53 // "SM"
+	clientOST = 0x4f53 // "SO"
+)
+
+// File format versions (wVer).
+const (
+	versionANSI      = 14
+	versionANSIMax   = 15
+	versionUnicode   = 23
+	versionUnicode4K = 36
+)
+
+// Formats reported in Header.Format.
+const (
+	FormatANSI      = "ansi"
+	FormatUnicode   = "unicode"
+	FormatUnicode4K = "unicode_4k"
+)
+
+// Data block encodings (bCryptMethod).
+const (
+	cryptNone    = 0x00
+	cryptPermute = 0x01
+	cryptCyclic  = 0x02
+)
+
+// Page types of B-tree pages.
+const (
+	pageBBT = 0x80
+	pageNBT = 0x81
+)
+
+// pageSize is the size of every B-tree page in ANSI and Unicode files.
+const pageSize = 512
+
+// maxBlockSize bounds a single data block, trailer included.
+const maxBlockSize = 8192
+
+// bidInternal marks blocks holding NDB structures (XBLOCK, SLBLOCK, ...)
+// rather than node data; internal blocks are never encoded.
+const bidInternal = 0x02
+
+// maxTreeDepth bounds B-tree and data-tree recursion so corrupt files cannot loop forever.
+const maxTreeDepth = 16
+
+// ErrUnsupported is returned when the header is readable but the folder
+// hierarchy of the file cannot be decoded (4K-page OST files, cyclic encoding).
+var ErrUnsupported = errors.New("unsupported pst format")
+
+// ErrNotFound is returned when a node, block, or property does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Header holds the file-level fields of a PST or OST header.
+type Header struct {
+	Client        string // "pst" or "ost"
+	Format        string // FormatANSI, FormatUnicode, or FormatUnicode4K
+	Version       uint16 // wVer
+	ClientVersion uint16 // wVerClient
+	Encryption    string // "none", "permute", "cyclic", or "unknown"
+	FileEOF       uint64 // ibFileEof: logical file size recorded in the header
+}
+
+// File is an open PST or OST file.
+type File struct {
+	r       io.ReaderAt
+	closer  io.Closer
+	size    int64
+	header  Header
+	unicode bool
+	crypt   byte
+	nbtRoot uint64 // File offset of the node B-tree root page
+	bbtRoot uint64 // File offset of the block B-tree root page
+	pages   map[uint64][]byte
+}
+
+// nodeEntry is a leaf entry of the node B-tree.
+type nodeEntry struct {
+	nid     uint32
+	bidData uint64
+	bidSub  uint64
+	parent  uint32
+}
+
+// subnode is an entry of a node's subnode B-tree.
+type subnode struct {
+	bidData uint64
+	bidSub  uint64
+}
+
+// maxCachedPages bounds the B-tree page cache.
+const maxCachedPages = 4096
+
+// Open opens a PST or OST file for reading.
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	file, err := NewReader(f, stat.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	file.closer = f
+	return file, nil
+}
+
+// NewReader reads a PST or OST file from r, which holds size bytes. Only the
+// header is required to be valid; the B-trees are read on demand.
+func NewReader(r io.ReaderAt, size int64) (*File, error) {
+	buf := make([]byte, 564)
+	if size < int64(len(buf)) {
+		return nil, fmt.Errorf("file too small for a pst header (%d bytes)", size)
+	}
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return nil, fmt.Errorf("failed to read pst header: %w", err)
+	}
+	if string(buf[:4]) != headerMagic {
+		return nil, fmt.Errorf("not a pst file (bad signature)")
+	}
+
+	f := &File{r: r, size: size, pages: make(map[uint64][]byte)}
+	f.header.Version = binary.LittleEndian.Uint16(buf[10:12])
+	f.header.ClientVersion = binary.LittleEndian.Uint16(buf[12:14])
+	switch binary.LittleEndian.Uint16(buf[8:10]) {
+	case clientPST:
+		f.header.Client = "pst"
+	case clientOST:
+		f.header.Client = "ost"
+	default:
+		f.header.Client = "unknown"
+	}
+
+	switch v := f.header.Version; {
+	case v == versionANSI || v == versionANSIMax:
+		f.header.Format = FormatANSI
+		f.header.FileEOF = uint64(binary.LittleEndian.Uint32(buf[168:172]))
+		f.nbtRoot = uint64(binary.LittleEndian.Uint32(buf[188:192]))
+		f.bbtRoot = uint64(binary.LittleEndian.Uint32(buf[196:200]))
+		f.crypt = buf[461]
+	case v >= versionUnicode:
+		f.unicode = true
+		f.header.Format = FormatUnicode
+		if v >= versionUnicode4K {
+			f.header.Format = FormatUnicode4K
+		}
+		f.header.FileEOF = binary.LittleEndian.Uint64(buf[184:192])
+		f.nbtRoot = binary.LittleEndian.Uint64(buf[224:232])
+		f.bbtRoot = binary.LittleEndian.Uint64(buf[240:248])
+		f.crypt = buf[513]
+	default:
+		return nil, fmt.Errorf("unknown pst version %d", v)
+	}
+
+	switch f.crypt {
+	case cryptNone:
+		f.header.Encryption = "none"
+	case cryptPermute:
+		f.header.Encryption = "permute"
+	case cryptCyclic:
+		f.header.Encryption = "cyclic"
+	default:
+		f.header.Encryption = "unknown"
+	}
+	return f, nil
+}
+
+// Close closes the underlying file when it was opened with Open.
+func (f *File) Close() error {
+	if f.closer != nil {
+		return f.closer.Close()
+	}
+	return nil
+}
+
+// Header returns the decoded file header.
+func (f *File) Header() Header {
+	return f.header
+}
+
+// checkSupported reports whether the node and block layers can be decoded.
+func (f *File) checkSupported() error {
+	if f.header.Format == FormatUnicode4K {
+		return fmt.Errorf("%w: 4K-page file (version %d)", ErrUnsupported, f.header.Version)
+	}
+	if f.crypt != cryptNone && f.crypt != cryptPermute {
+		return fmt.Errorf("%w: %s block encoding", ErrUnsupported, f.header.Encryption)
+	}
+	return nil
+}
+
+// readPage reads and checks the B-tree page at offset off.
+func (f *File) readPage(off uint64, ptype byte) ([]byte, error) {
+	if page, ok := f.pages[off]; ok {
+		return page, nil
+	}
+	if off+pageSize > uint64(f.size) {
+		return nil, fmt.Errorf("page offset %#x beyond end of file", off)
+	}
+	page := make([]byte, pageSize)
+	if _, err := f.r.ReadAt(page, int64(off)); err != nil {
+		return nil, fmt.Errorf("failed to read page at %#x: %w", off, err)
+	}
+	trailer := 500
+	if f.unicode {
+		trailer = 496
+	}
+	if page[trailer] != ptype || page[trailer+1] != ptype {
+		return nil, fmt.Errorf("page at %#x has type %#x, want %#x", off, page[trailer], ptype)
+	}
+	if len(f.pages) >= maxCachedPages {
+		f.pages = make(map[uint64][]byte)
+	}
+	f.pages[off] = page
+	return page, nil
+}
+
+// pageEntries returns the entries of a B-tree page and its level.
+func (f *File) pageEntries(page []byte) ([][]byte, int, error) {
+	meta := 496
+	if f.unicode {
+		meta = 488
+	}
+	count, size, level := int(page[meta]), int(page[meta+2]), int(page[meta+3])
+	if size == 0 || count*size > meta {
+		return nil, 0, fmt.Errorf("corrupt page entry table (%d entries of %d bytes)", count, size)
+	}
+	entries := make([][]byte, count)
+	for i := range entries {
+		entries[i] = page[i*size : (i+1)*size]
+	}
+	return entries, level, nil
+}
+
+// ptrSize is the size of BIDs, offsets, and B-tree keys in this format.
+func (f *File) ptrSize() int {
+	if f.unicode {
+		return 8
+	}
+	return 4
+}
+
+// readPtr reads a BID, offset, or NID sized for this format.
+func (f *File) readPtr(b []byte) uint64 {
+	if f.unicode {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return uint64(binary.LittleEndian.Uint32(b))
+}
+
+// walkNodes calls fn for every leaf entry of the node B-tree.
+func (f *File) walkNodes(fn func(nodeEntry) error) error {
+	return f.walkNodePage(f.nbtRoot, 0, fn)
+}
+
+func (f *File) walkNodePage(off uint64, depth int, fn func(nodeEntry) error) error {
+	if depth > maxTreeDepth {
+		return fmt.Errorf("node b-tree too deep")
+	}
+	page, err := f.readPage(off, pageNBT)
+	if err != nil {
+		return err
+	}
+	entries, level, err := f.pageEntries(page)
+	if err != nil {
+		return err
+	}
+	p := f.ptrSize()
+	for _, e := range entries {
+		if level > 0 {
+			if len(e) < 3*p {
+				return fmt.Errorf("short node b-tree index entry")
+			}
+			if err := f.walkNodePage(f.readPtr(e[2*p:]), depth+1, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(e) < 3*p+4 {
+			return fmt.Errorf("short node b-tree entry")
+		}
+		if err := fn(nodeEntry{
+			nid:     uint32(f.readPtr(e)),
+			bidData: f.readPtr(e[p:]),
+			bidSub:  f.readPtr(e[2*p:]),
+			parent:  binary.LittleEndian.Uint32(e[3*p:]),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findNode looks up a node in the node B-tree.
+func (f *File) findNode(nid uint32) (nodeEntry, error) {
+	off := f.nbtRoot
+	p := f.ptrSize()
+	for depth := 0; depth <= maxTreeDepth; depth++ {
+		page, err := f.readPage(off, pageNBT)
+		if err != nil {
+			return nodeEntry{}, err
+		}
+		entries, level, err := f.pageEntries(page)
+		if err != nil {
+			return nodeEntry{}, err
+		}
+		if level == 0 {
+			for _, e := range entries {
+				if len(e) >= 3*p+4 && uint32(f.readPtr(e)) == nid {
+					return nodeEntry{
+						nid:     nid,
+						bidData: f.readPtr(e[p:]),
+						bidSub:  f.readPtr(e[2*p:]),
+						parent:  binary.LittleEndian.Uint32(e[3*p:]),
+					}, nil
+				}
+			}
+			return nodeEntry{}, fmt.Errorf("node %#x: %w", nid, ErrNotFound)
+		}
+		next, ok := f.childFor(entries, uint64(nid), p)
+		if !ok {
+			return nodeEntry{}, fmt.Errorf("node %#x: %w", nid, ErrNotFound)
+		}
+		off = next
+	}
+	return nodeEntry{}, fmt.Errorf("node b-tree too deep")
+}
+
+// childFor picks the child page of an index page whose key range covers key.
+func (f *File) childFor(entries [][]byte, key uint64, p int) (uint64, bool) {
+	var child uint64
+	found := false
+	for _, e := range entries {
+		if len(e) < 3*p {
+			break
+		}
+		if f.readPtr(e) > key {
+			break
+		}
+		child = f.readPtr(e[2*p:])
+		found = true
+	}
+	return child, found
+}
+
+// findBlock looks up a block's file offset and size in the block B-tree.
+func (f *File) findBlock(bid uint64) (uint64, int, error) {
+	bid &^= 1 // The lowest bit is reserved and not part of the key
+	off := f.bbtRoot
+	p := f.ptrSize()
+	for depth := 0; depth <= maxTreeDepth; depth++ {
+		page, err := f.readPage(off, pageBBT)
+		if err != nil {
+			return 0, 0, err
+		}
+		entries, level, err := f.pageEntries(page)
+		if err != nil {
+			return 0, 0, err
+		}
+		if level == 0 {
+			for _, e := range entries {
+				if len(e) >= 2*p+2 && f.readPtr(e)&^1 == bid {
+					return f.readPtr(e[p:]), int(binary.LittleEndian.Uint16(e[2*p:])), nil
+				}
+			}
+			return 0, 0, fmt.Errorf("block %#x: %w", bid, ErrNotFound)
+		}
+		next, ok := f.childFor(entries, bid, p)
+		if !ok {
+			return 0, 0, fmt.Errorf("block %#x: %w", bid, ErrNotFound)
+		}
+		off = next
+	}
+	return 0, 0, fmt.Errorf("block b-tree too deep")
+}
+
+// readBlock reads a block's payload, decoding data blocks.
+func (f *File) readBlock(bid uint64) ([]byte, error) {
+	off, size, err := f.findBlock(bid)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxBlockSize || off+uint64(size) > uint64(f.size) {
+		return nil, fmt.Errorf("block %#x out of range", bid)
+	}
+	data := make([]byte, size)
+	if _, err := f.r.ReadAt(data, int64(off)); err != nil {
+		return nil, fmt.Errorf("failed to read block %#x: %w", bid, err)
+	}
+	if bid&bidInternal == 0 && f.crypt == cryptPermute {
+		decodePermute(data)
+	}
+	return data, nil
+}
+
+// readData returns the data blocks of a node, expanding XBLOCK and XXBLOCK
+// trees. Heap-on-node IDs address these blocks by index.
+func (f *File) readData(bid uint64) ([][]byte, error) {
+	if bid == 0 {
+		return nil, nil
+	}
+	var blocks [][]byte
+	err := f.collectData(bid, 0, &blocks)
+	return blocks, err
+}
+
+func (f *File) collectData(bid uint64, depth int, blocks *[][]byte) error {
+	if depth > 2 {
+		return fmt.Errorf("data tree too deep")
+	}
+	data, err := f.readBlock(bid)
+	if err != nil {
+		return err
+	}
+	if bid&bidInternal == 0 {
+		*blocks = append(*blocks, data)
+		return nil
+	}
+	if len(data) < 8 || data[0] != 0x01 {
+		return fmt.Errorf("block %#x is not a data tree block", bid)
+	}
+	count := int(binary.LittleEndian.Uint16(data[2:4]))
+	p := f.ptrSize()
+	if 8+count*p > len(data) {
+		return fmt.Errorf("data tree block %#x is truncated", bid)
+	}
+	for i := 0; i < count; i++ {
+		if err := f.collectData(f.readPtr(data[8+i*p:]), depth+1, blocks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSubnodes returns a node's subnode B-tree keyed by subnode NID.
+func (f *File) readSubnodes(bid uint64) (map[uint32]subnode, error) {
+	subnodes := make(map[uint32]subnode)
+	if bid == 0 {
+		return subnodes, nil
+	}
+	return subnodes, f.collectSubnodes(bid, 0, subnodes)
+}
+
+func (f *File) collectSubnodes(bid uint64, depth int, subnodes map[uint32]subnode) error {
+	if depth > maxTreeDepth {
+		return fmt.Errorf("subnode tree too deep")
+	}
+	data, err := f.readBlock(bid)
+	if err != nil {
+		return err
+	}
+	if len(data) < 4 || data[0] != 0x02 {
+		return fmt.Errorf("block %#x is not a subnode block", bid)
+	}
+	level := data[1]
+	count := int(binary.LittleEndian.Uint16(data[2:4]))
+	p := f.ptrSize()
+	start := 4
+	if f.unicode {
+		start = 8
+	}
+	size := 3 * p
+	if level > 0 {
+		size = 2 * p
+	}
+	if start+count*size > len(data) {
+		return fmt.Errorf("subnode block %#x is truncated", bid)
+	}
+	for i := 0; i < count; i++ {
+		e := data[start+i*size:]
+		if level > 0 {
+			if err := f.collectSubnodes(f.readPtr(e[p:]), depth+1, subnodes); err != nil {
+				return err
+			}
+			continue
+		}
+		subnodes[uint32(f.readPtr(e))] = subnode{bidData: f.readPtr(e[p:]), bidSub: f.readPtr(e[2*p:])}
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package pst
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// testNode is a node of a test file and the data block it points to.
+type testNode struct {
+	nid    uint32
+	parent uint32
+	data   []byte
+}
+
+// newTestHeader returns a header of the given version with the B-tree roots
+// and block encoding at the offsets of that format.
+func newTestHeader(client, version uint16, crypt byte, nbtRoot, bbtRoot, eof uint64) []byte {
+	header := make([]byte, 564)
+	copy(header, headerMagic)
+	binary.LittleEndian.PutUint16(header[8:], client)
+	binary.LittleEndian.PutUint16(header[10:], version)
+	binary.LittleEndian.PutUint16(header[12:], 19)
+	if version <= versionANSIMax {
+		binary.LittleEndian.PutUint32(header[168:], uint32(eof))
+		binary.LittleEndian.PutUint32(header[188:], uint32(nbtRoot))
+		binary.LittleEndian.PutUint32(header[196:], uint32(bbtRoot))
+		header[461] = crypt
+	} else {
+		binary.LittleEndian.PutUint64(header[184:], eof)
+		binary.LittleEndian.PutUint64(header[224:], nbtRoot)
+		binary.LittleEndian.PutUint64(header[240:], bbtRoot)
+		header[513] = crypt
+	}
+	return header
+}
+
+// buildUnicodeFile writes a permute-encoded Unicode PST holding nodes, with a
+// single leaf page for each B-tree.
+func buildUnicodeFile(nodes []testNode) []byte {
+	const nbtOffset, bbtOffset, blockStart = 0x400, 0x600, 0x800
+	var encode [256]byte
+	for i, b := range permuteDecode {
+		encode[b] = byte(i)
+	}
+
+	file := make([]byte, blockStart)
+	nbt := make([]byte, pageSize)
+	bbt := make([]byte, pageSize)
+	for i, node := range nodes {
+		bid := uint64(i+1) * 4
+		off := uint64(len(file))
+		for _, b := range node.data {
+			file = append(file, encode[b])
+		}
+		for len(file)%64 != 0 {
+			file = append(file, 0)
+		}
+
+		e := nbt[i*32:]
+		binary.LittleEndian.PutUint64(e, uint64(node.nid))
+		binary.LittleEndian.PutUint64(e[8:], bid)
+		binary.LittleEndian.PutUint32(e[24:], node.parent)
+
+		e = bbt[i*24:]
+		binary.LittleEndian.PutUint64(e, bid)
+		binary.LittleEndian.PutUint64(e[8:], off)
+		binary.LittleEndian.PutUint16(e[16:], uint16(len(node.data)))
+		binary.LittleEndian.PutUint16(e[18:], 2)
+	}
+	for _, page := range []struct {
+		buf   []byte
+		ptype byte
+		size  byte
+	}{{nbt, pageNBT, 32}, {bbt, pageBBT, 24}} {
+		page.buf[488] = byte(len(nodes))
+		page.buf[489] = byte(488 / int(page.size))
+		page.buf[490] = page.size
+		page.buf[496], page.buf[497] = page.ptype, page.ptype
+	}
+	copy(file[nbtOffset:], nbt)
+	copy(file[bbtOffset:], bbt)
+	copy(file, newTestHeader(clientPST, versionUnicode, cryptPermute, nbtOffset, bbtOffset, uint64(len(file))))
+	return file
+}
+
+// hid is the heap ID of the index'th (1-based) allocation of the first block.
+func hid(index int) uint32 {
+	return uint32(index) << 5
+}
+
+// buildHeap lays out allocations as a single-block heap-on-node whose user
+// root is the first allocation.
+func buildHeap(client byte, allocs [][]byte) []byte {
+	block := make([]byte, 12)
+	block[2], block[3] = heapSignature, client
+	binary.LittleEndian.PutUint32(block[4:], hid(1))
+	offsets := []uint16{uint16(len(block))}
+	for _, a := range allocs {
+		block = append(block, a...)
+		offsets = append(offsets, uint16(len(block)))
+	}
+	binary.LittleEndian.PutUint16(block, uint16(len(block)))
+	block = binary.LittleEndian.AppendUint16(block, uint16(len(allocs)))
+	block = binary.LittleEndian.AppendUint16(block, 0)
+	for _, off := range offsets {
+		block = binary.LittleEndian.AppendUint16(block, off)
+	}
+	return block
+}
+
+// testProp is a property of a test property context: a string or an int32.
+type testProp struct {
+	id    uint16
+	str   string
+	value int32
+}
+
+// buildPropertyContext returns the heap of a property context.
+func buildPropertyContext(props ...testProp) []byte {
+	sort.Slice(props, func(i, j int) bool { return props[i].id < props[j].id })
+	allocs := [][]byte{{clientBTH, 2, 6, 0, 0, 0, 0, 0}, nil}
+	binary.LittleEndian.PutUint32(allocs[0][4:], hid(2))
+	for _, p := range props {
+		rec := binary.LittleEndian.AppendUint16(nil, p.id)
+		if p.str != "" {
+			var data []byte
+			for _, u := range utf16.Encode([]rune(p.str)) {
+				data = binary.LittleEndian.AppendUint16(data, u)
+			}
+			allocs = append(allocs, data)
+			rec = binary.LittleEndian.AppendUint16(rec, typeString)
+			rec = binary.LittleEndian.AppendUint32(rec, hid(len(allocs)))
+		} else {
+			rec = binary.LittleEndian.AppendUint16(rec, typeInt32)
+			rec = binary.LittleEndian.AppendUint32(rec, uint32(p.value))
+		}
+		allocs[1] = append(allocs[1], rec...)
+	}
+	return buildHeap(clientPC, allocs)
+}
+
+// buildContentsTable returns the heap of a contents table with delivery and
+// submit time columns. A zero time leaves its cell empty.
+func buildContentsTable(rows [][2]time.Time) []byte {
+	const rowSize, ceb = 25, 24
+	columns := []struct {
+		tag    uint32
+		offset uint16
+		size   byte
+	}{
+		{0x67f20003, 0, 4}, // PidTagLtpRowId
+		{0x67f30003, 4, 4}, // PidTagLtpRowVer
+		{messageTimeTags[0], 8, 8},
+		{messageTimeTags[1], 16, 8},
+	}
+	info := []byte{clientTC, byte(len(columns))}
+	for _, ib := range []uint16{24, 24, 24, rowSize} {
+		info = binary.LittleEndian.AppendUint16(info, ib)
+	}
+	info = binary.LittleEndian.AppendUint32(info, hid(2)) // Row index
+	info = binary.LittleEndian.AppendUint32(info, hid(4)) // Row matrix
+	info = binary.LittleEndian.AppendUint32(info, 0)
+	for i, col := range columns {
+		info = binary.LittleEndian.AppendUint32(info, col.tag)
+		info = binary.LittleEndian.AppendUint16(info, col.offset)
+		info = append(info, col.size, byte(i))
+	}
+
+	var index, matrix []byte
+	for i, times := range rows {
+		row := make([]byte, rowSize)
+		binary.LittleEndian.PutUint32(row, uint32(0x200024+i*0x20))
+		row[ceb] = 0xc0
+		for j, t := range times {
+			if t.IsZero() {
+				continue
+			}
+			ft := uint64(t.Unix()+11644473600) * 10000000
+			binary.LittleEndian.PutUint64(row[8+j*8:], ft)
+			row[ceb] |= 0x20 >> j
+		}
+		matrix = append(matrix, row...)
+		index = binary.LittleEndian.AppendUint32(index, binary.LittleEndian.Uint32(row))
+		index = binary.LittleEndian.AppendUint32(index, uint32(i))
+	}
+	bth := []byte{clientBTH, 4, 4, 0}
+	bth = binary.LittleEndian.AppendUint32(bth, hid(3))
+	return buildHeap(clientTC, [][]byte{info, bth, index, matrix})
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+}
+
+func TestUnicodeFolderHierarchy(t *testing.T) {
+	const (
+		inbox, inboxContents    = 0x8022, 0x802e
+		projects                = 0x8042
+		sentItems, sentContents = 0x8062, 0x806e
+	)
+	data := buildUnicodeFile([]testNode{
+		{nid: nidMessageStore, data: buildPropertyContext(testProp{id: propDisplayName, str: "alice@example.com"})},
+		{nid: nidRootFolder, parent: nidRootFolder, data: buildPropertyContext(testProp{id: propContentCount})},
+		{nid: inbox, parent: nidRootFolder, data: buildPropertyContext(
+			testProp{id: propDisplayName, str: "Inbox"},
+			testProp{id: propContentCount, value: 3},
+			testProp{id: propContentUnreadCount, value: 1},
+		)},
+		{nid: inboxContents, parent: inbox, data: buildContentsTable([][2]time.Time{
+			{date(2024, 1, 5), date(2024, 1, 4)},
+			{{}, date(2024, 2, 10)},
+			{date(2023, 11, 20), {}},
+		})},
+		{nid: projects, parent: inbox, data: buildPropertyContext(testProp{id: propDisplayName, str: "Projets été"})},
+		{nid: sentItems, parent: nidRootFolder, data: buildPropertyContext(
+			testProp{id: propDisplayName, str: "Sent Items"},
+			testProp{id: propContentCount, value: 7},
+		)},
+		{nid: sentContents, parent: sentItems, data: []byte("not a heap-on-node")},
+	})
+
+	f, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Header{Client: "pst", Format: FormatUnicode, Version: versionUnicode, ClientVersion: 19, Encryption: "permute", FileEOF: uint64(len(data))}
+	if f.Header() != want {
+		t.Fatalf("header = %+v, want %+v", f.Header(), want)
+	}
+	if name, err := f.StoreName(); err != nil || name != "alice@example.com" {
+		t.Fatalf("StoreName = %q, %v", name, err)
+	}
+
+	folders, err := f.Folders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, folder := range folders {
+		paths = append(paths, folder.Path)
+	}
+	if want := []string{"Inbox", "Inbox/Projets été", "Sent Items"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("folder paths = %q, want %q", paths, want)
+	}
+
+	got := folders[0]
+	if got.MessageCount != 3 || got.UnreadCount != 1 || got.Error != "" {
+		t.Errorf("Inbox = %+v", got)
+	}
+	if !got.Earliest.Equal(date(2023, 11, 20)) || !got.Latest.Equal(date(2024, 2, 10)) {
+		t.Errorf("Inbox date range = %v .. %v", got.Earliest, got.Latest)
+	}
+	if folders[1].MessageCount != 0 || !folders[1].Earliest.IsZero() || folders[1].Error != "" {
+		t.Errorf("folder without a contents table = %+v", folders[1])
+	}
+
+	// A damaged contents table keeps the folder and its counts
+	if sent := folders[2]; sent.MessageCount != 7 || !strings.HasPrefix(sent.Error, "contents table: ") {
+		t.Errorf("Sent Items = %+v", sent)
+	}
+}
+
+func TestHeaderFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []byte
+		want    Header
+		folders error
+	}{
+		{
+			name:   "ansi ost",
+			header: newTestHeader(clientOST, versionANSI, cryptNone, 0, 0, 271360),
+			want:   Header{Client: "ost", Format: FormatANSI, Version: versionANSI, ClientVersion: 19, Encryption: "none", FileEOF: 271360},
+		},
+		{
+			name:    "unicode 4k",
+			header:  newTestHeader(clientOST, versionUnicode4K, cryptPermute, 0, 0, 1<<30),
+			want:    Header{Client: "ost", Format: FormatUnicode4K, Version: versionUnicode4K, ClientVersion: 19, Encryption: "permute", FileEOF: 1 << 30},
+			folders: ErrUnsupported,
+		},
+		{
+			name:    "cyclic",
+			header:  newTestHeader(clientPST, versionUnicode, cryptCyclic, 0, 0, 8192),
+			want:    Header{Client: "pst", Format: FormatUnicode, Version: versionUnicode, ClientVersion: 19, Encryption: "cyclic", FileEOF: 8192},
+			folders: ErrUnsupported,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewReader(bytes.NewReader(tt.header), int64(len(tt.header)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Header() != tt.want {
+				t.Errorf("header = %+v, want %+v", f.Header(), tt.want)
+			}
+			if tt.folders != nil {
+				if _, err := f.Folders(); !errors.Is(err, tt.folders) {
+					t.Errorf("Folders = %v, want %v", err, tt.folders)
+				}
+			}
+		})
+	}
+}
+
+func TestNewReaderRejectsNonPST(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"too small", []byte(headerMagic), "file too small"},
+		{"bad signature", append([]byte("MZ\x90\x00"), make([]byte, 600)...), "bad signature"},
+		{"unknown version", newTestHeader(clientPST, 20, cryptNone, 0, 0, 0), "unknown pst version 20"},
+	}
+	for _, tt := range tests {
+		if _, err := NewReader(bytes.NewReader(tt.data), int64(len(tt.data))); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: NewReader = %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package regf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// hiveBlockSize is the unit hive files grow in; a complete hive is a multiple of it.
+const hiveBlockSize = 4096
+
+// headerChecksumOffset holds the XOR of the preceding 127 header dwords.
+const headerChecksumOffset = 0x1FC
+
+// HeaderCheck is the result of validating a hive file's base block.
+type HeaderCheck struct {
+	Valid    bool     `json:"valid"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// CheckFile validates the base block of the hive file at path.
+func CheckFile(path string) HeaderCheck {
+	f, err := os.Open(path)
+	if err != nil {
+		return HeaderCheck{Problems: []string{err.Error()}}
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return HeaderCheck{Problems: []string{err.Error()}}
+	}
+	return CheckHeader(f, stat.Size())
+}
+
+// CheckHeader validates a hive's base block against its size: the regf
+// signature, matching primary and secondary sequence numbers, the header
+// checksum, a size that is a multiple of 4096 and covers the hive bins the
+// header declares, and an hbin signature at the first bin. A copy taken while
+// the hive was being written, or cut short, fails one or more of these.
+func CheckHeader(r io.ReaderAt, size int64) HeaderCheck {
+	var problems []string
+
+	header := make([]byte, hiveBlockSize)
+	if size < hiveBlockSize {
+		problems = append(problems, fmt.Sprintf("file is %d bytes, smaller than the 4096-byte base block", size))
+		return HeaderCheck{Problems: problems}
+	}
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return HeaderCheck{Problems: []string{fmt.Sprintf("failed to read base block: %v", err)}}
+	}
+
+	if string(header[:4]) != headerMagic {
+		problems = append(problems, "bad regf signature")
+		return HeaderCheck{Problems: problems}
+	}
+
+	primarySeq := binary.LittleEndian.Uint32(header[4:8])
+	secondarySeq := binary.LittleEndian.Uint32(header[8:12])
+	if primarySeq != secondarySeq {
+		problems = append(problems, fmt.Sprintf("sequence numbers differ (primary %d, secondary %d): the hive was mid-write", primarySeq, secondarySeq))
+	}
+
+	if stored, computed := binary.LittleEndian.Uint32(header[headerChecksumOffset:]), headerChecksum(header); stored != computed {
+		problems = append(problems, fmt.Sprintf("header checksum mismatch (stored 0x%08x, computed 0x%08x)", stored, computed))
+	}
+
+	if size%hiveBlockSize != 0 {
+		problems = append(problems, fmt.Sprintf("size %d is not a multiple of 4096", size))
+	}
+	binsSize := int64(binary.LittleEndian.Uint32(header[0x28:0x2c]))
+	if hbinStart+binsSize > size {
+		problems = append(problems, fmt.Sprintf("header declares %d bytes of hive bins but the file holds %d", binsSize, size-hbinStart))
+	}
+
+	if size > hbinStart {
+		magic := make([]byte, 4)
+		if _, err := r.ReadAt(magic, hbinStart); err != nil || string(magic) != "hbin" {
+			problems = append(problems, "first hive bin lacks the hbin signature")
+		}
+	}
+
+	return HeaderCheck{Valid: len(problems) == 0, Problems: problems}
+}
+
+// headerChecksum computes the base block checksum: the XOR of the first 127
+// dwords, with 0 and 0xFFFFFFFF remapped as Windows does.
+func headerChecksum(header []byte) uint32 {
+	var sum uint32
+	for i := 0; i < headerChecksumOffset; i += 4 {
+		sum ^= binary.LittleEndian.Uint32(header[i:])
+	}
+	switch sum {
+	case 0xFFFFFFFF:
+		return 0xFFFFFFFE
+	case 0:
+		return 1
+	}
+	return sum
+}
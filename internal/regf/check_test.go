@@ -0,0 +1,53 @@
+package regf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cryptkeeper/internal/regf/regftest"
+)
+
+func TestCheckHeaderDetectsDamage(t *testing.T) {
+	valid := regftest.Build(&regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{{Name: "Select"}}})
+	tests := []struct {
+		name   string
+		damage func(hive []byte) []byte
+		want   string
+	}{
+		{"cut inside the base block", func(h []byte) []byte { return h[:2048] }, "smaller than the 4096-byte base block"},
+		{"zeroed signature", func(h []byte) []byte { copy(h, "\x00\x00\x00\x00"); return h }, "bad regf signature"},
+		{"mid-write", func(h []byte) []byte {
+			binary.LittleEndian.PutUint32(h[4:], 7)
+			regftest.SetChecksum(h)
+			return h
+		}, "sequence numbers differ (primary 7, secondary 1)"},
+		{"header edited", func(h []byte) []byte { h[0x30] = 'x'; return h }, "header checksum mismatch"},
+		{"cut mid-bin", func(h []byte) []byte { return h[:6000] }, "size 6000 is not a multiple of 4096"},
+		{"bins missing", func(h []byte) []byte { return h[:4096] }, "header declares 4096 bytes of hive bins but the file holds 0"},
+		{"bin overwritten", func(h []byte) []byte { copy(h[0x1000:], "\x00\x00\x00\x00"); return h }, "first hive bin lacks the hbin signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hive := tt.damage(append([]byte{}, valid...))
+			check := CheckHeader(bytes.NewReader(hive), int64(len(hive)))
+			if check.Valid || !strings.Contains(strings.Join(check.Problems, "; "), tt.want) {
+				t.Errorf("problems = %q, want %q", check.Problems, tt.want)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "SYSTEM")
+	if err := os.WriteFile(path, valid, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if check := CheckFile(path); !check.Valid || len(check.Problems) != 0 {
+		t.Errorf("intact hive = %+v", check)
+	}
+	if check := CheckFile(path + ".missing"); check.Valid || len(check.Problems) != 1 {
+		t.Errorf("missing hive = %+v", check)
+	}
+}
@@ -0,0 +1,476 @@
+// Package regf provides a minimal read-only reader for Windows registry hive
+// files (the "regf" format). It walks key and value cells directly so
+// collected hives (Amcache.hve, SYSTEM, NTUSER.DAT) can be parsed without
+// loading them into the live registry. Transaction logs are not replayed, so
+// changes still pending in .LOG1/.LOG2 files of a dirty hive are not seen.
+package regf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"cryptkeeper/internal/winutil"
+)
+
+// headerMagic begins every registry hive file.
+const headerMagic = "regf"
+
+// hbinStart is the file offset of the first hive bin; cell offsets are relative to it.
+const hbinStart = 0x1000
+
+// Key and value flags.
+const (
+	keyCompName   = 0x0020 // Key name is stored as Latin-1 rather than UTF-16LE
+	valueCompName = 0x0001 // Value name is stored as Latin-1 rather than UTF-16LE
+)
+
+// dataInline marks value data stored in the data offset field itself.
+const dataInline = 0x80000000
+
+// bigDataSegmentSize is the largest payload of one big data ("db") segment.
+const bigDataSegmentSize = 16344
+
+// maxListDepth bounds nested "ri" subkey index recursion so corrupt hives cannot loop forever.
+const maxListDepth = 8
+
+// Registry value types.
+const (
+	TypeNone      = 0
+	TypeString    = 1
+	TypeExpandStr = 2
+	TypeBinary    = 3
+	TypeDWORD     = 4
+	TypeDWORDBE   = 5
+	TypeLink      = 6
+	TypeMultiStr  = 7
+	TypeQWORD     = 11
+)
+
+// ErrNotFound is returned when a key or value does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Hive is an open registry hive file.
+type Hive struct {
+	r        io.ReaderAt
+	closer   io.Closer
+	size     int64
+	rootCell uint32
+	minor    uint32
+	dirty    bool
+}
+
+// Key is a registry key (nk cell).
+type Key struct {
+	hive        *Hive
+	Name        string
+	LastWritten time.Time
+	subkeyCount uint32
+	subkeyList  uint32
+	valueCount  uint32
+	valueList   uint32
+}
+
+// Value is a registry value (vk cell) with its data loaded.
+type Value struct {
+	Name string
+	Type uint32
+	Data []byte
+}
+
+// Open opens a hive file for reading.
+func Open(path string) (*Hive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	hive, err := NewReader(f, stat.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	hive.closer = f
+	return hive, nil
+}
+
+// NewReader reads a hive from r, which holds size bytes.
+func NewReader(r io.ReaderAt, size int64) (*Hive, error) {
+	header := make([]byte, 0x30)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read hive header: %w", err)
+	}
+	if string(header[:4]) != headerMagic {
+		return nil, fmt.Errorf("not a registry hive (bad signature)")
+	}
+
+	primarySeq := binary.LittleEndian.Uint32(header[4:8])
+	secondarySeq := binary.LittleEndian.Uint32(header[8:12])
+	return &Hive{
+		r:        r,
+		size:     size,
+		minor:    binary.LittleEndian.Uint32(header[0x18:0x1c]),
+		rootCell: binary.LittleEndian.Uint32(header[0x24:0x28]),
+		dirty:    primarySeq != secondarySeq,
+	}, nil
+}
+
+// Close closes the underlying file when the hive was opened with Open.
+func (h *Hive) Close() error {
+	if h.closer != nil {
+		return h.closer.Close()
+	}
+	return nil
+}
+
+// Dirty reports whether the hive header sequence numbers differ, meaning
+// writes were pending in its transaction logs when it was copied.
+func (h *Hive) Dirty() bool {
+	return h.dirty
+}
+
+// Root returns the hive's root key.
+func (h *Hive) Root() (*Key, error) {
+	return h.key(h.rootCell)
+}
+
+// OpenKey returns the key at a backslash-separated path below the root.
+// Names are matched case-insensitively, as Windows does.
+func (h *Hive) OpenKey(path string) (*Key, error) {
+	key, err := h.Root()
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range strings.Split(strings.Trim(path, `\`), `\`) {
+		if part == "" {
+			continue
+		}
+		if key, err = key.Subkey(part); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Subkeys returns the key's subkeys.
+func (k *Key) Subkeys() ([]*Key, error) {
+	if k.subkeyCount == 0 || k.subkeyList == 0xffffffff {
+		return nil, nil
+	}
+
+	offsets, err := k.hive.subkeyOffsets(k.subkeyList, 0)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(offsets))
+	for _, off := range offsets {
+		sub, err := k.hive.key(off)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, sub)
+	}
+	return keys, nil
+}
+
+// Subkey returns the direct subkey with the given name.
+func (k *Key) Subkey(name string) (*Key, error) {
+	subkeys, err := k.Subkeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range subkeys {
+		if strings.EqualFold(sub.Name, name) {
+			return sub, nil
+		}
+	}
+	return nil, fmt.Errorf("key %q: %w", name, ErrNotFound)
+}
+
+// Values returns the key's values.
+func (k *Key) Values() ([]*Value, error) {
+	if k.valueCount == 0 || k.valueList == 0xffffffff {
+		return nil, nil
+	}
+
+	list, err := k.hive.cell(k.valueList)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(list)) < uint64(k.valueCount)*4 {
+		return nil, fmt.Errorf("value list of key %q is truncated", k.Name)
+	}
+
+	values := make([]*Value, 0, k.valueCount)
+	for i := uint32(0); i < k.valueCount; i++ {
+		value, err := k.hive.value(binary.LittleEndian.Uint32(list[i*4:]))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Value returns the named value, matched case-insensitively. The default
+// value has an empty name.
+func (k *Key) Value(name string) (*Value, error) {
+	values, err := k.Values()
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		if strings.EqualFold(value.Name, name) {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("value %q: %w", name, ErrNotFound)
+}
+
+// String returns REG_SZ, REG_EXPAND_SZ, and REG_LINK data as a string, and
+// the entries of REG_MULTI_SZ joined by commas. Other types return "".
+func (v *Value) String() string {
+	switch v.Type {
+	case TypeString, TypeExpandStr, TypeLink:
+		return decodeUTF16(v.Data)
+	case TypeMultiStr:
+		return strings.Join(v.Strings(), ",")
+	}
+	return ""
+}
+
+// Strings returns the entries of REG_MULTI_SZ data, or the single string of a string value.
+func (v *Value) Strings() []string {
+	if v.Type != TypeMultiStr {
+		if s := v.String(); s != "" {
+			return []string{s}
+		}
+		return nil
+	}
+	var out []string
+	for _, s := range strings.Split(decodeUTF16(v.Data), "\x00") {
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Uint64 returns REG_DWORD, REG_DWORD_BIG_ENDIAN, and REG_QWORD data as an integer.
+func (v *Value) Uint64() (uint64, bool) {
+	switch {
+	case v.Type == TypeDWORD && len(v.Data) >= 4:
+		return uint64(binary.LittleEndian.Uint32(v.Data)), true
+	case v.Type == TypeDWORDBE && len(v.Data) >= 4:
+		return uint64(binary.BigEndian.Uint32(v.Data)), true
+	case v.Type == TypeQWORD && len(v.Data) >= 8:
+		return binary.LittleEndian.Uint64(v.Data), true
+	}
+	return 0, false
+}
+
+// cell returns the payload of the allocated cell at a hive bin offset.
+func (h *Hive) cell(off uint32) ([]byte, error) {
+	pos := int64(hbinStart) + int64(off)
+	if off == 0xffffffff || pos+4 > h.size {
+		return nil, fmt.Errorf("cell offset 0x%x out of range", off)
+	}
+
+	var sizeBuf [4]byte
+	if _, err := h.r.ReadAt(sizeBuf[:], pos); err != nil {
+		return nil, fmt.Errorf("failed to read cell at 0x%x: %w", off, err)
+	}
+	size := int32(binary.LittleEndian.Uint32(sizeBuf[:]))
+	if size >= 0 {
+		return nil, fmt.Errorf("cell at 0x%x is not allocated", off)
+	}
+	length := int64(-size) - 4
+	if length < 0 || pos+4+length > h.size {
+		return nil, fmt.Errorf("cell at 0x%x overruns the hive", off)
+	}
+
+	data := make([]byte, length)
+	if _, err := h.r.ReadAt(data, pos+4); err != nil {
+		return nil, fmt.Errorf("failed to read cell at 0x%x: %w", off, err)
+	}
+	return data, nil
+}
+
+// key parses the nk cell at off.
+func (h *Hive) key(off uint32) (*Key, error) {
+	data, err := h.cell(off)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 76 || string(data[:2]) != "nk" {
+		return nil, fmt.Errorf("cell at 0x%x is not a key", off)
+	}
+
+	flags := binary.LittleEndian.Uint16(data[2:4])
+	nameLen := int(binary.LittleEndian.Uint16(data[72:74]))
+	if 76+nameLen > len(data) {
+		return nil, fmt.Errorf("key name at 0x%x is truncated", off)
+	}
+
+	return &Key{
+		hive:        h,
+		Name:        decodeName(data[76:76+nameLen], flags&keyCompName != 0),
+		LastWritten: winutil.FiletimeToUTC(binary.LittleEndian.Uint64(data[4:12])),
+		subkeyCount: binary.LittleEndian.Uint32(data[20:24]),
+		subkeyList:  binary.LittleEndian.Uint32(data[28:32]),
+		valueCount:  binary.LittleEndian.Uint32(data[36:40]),
+		valueList:   binary.LittleEndian.Uint32(data[40:44]),
+	}, nil
+}
+
+// subkeyOffsets flattens an lf, lh, li, or ri subkey list into nk cell offsets.
+func (h *Hive) subkeyOffsets(off uint32, depth int) ([]uint32, error) {
+	if depth > maxListDepth {
+		return nil, fmt.Errorf("subkey index at 0x%x nests too deeply", off)
+	}
+	data, err := h.cell(off)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("subkey list at 0x%x is truncated", off)
+	}
+
+	sig := string(data[:2])
+	count := int(binary.LittleEndian.Uint16(data[2:4]))
+	stride := 4
+	if sig == "lf" || sig == "lh" {
+		stride = 8 // offset followed by a name hint or hash
+	} else if sig != "li" && sig != "ri" {
+		return nil, fmt.Errorf("cell at 0x%x is not a subkey list", off)
+	}
+	if 4+count*stride > len(data) {
+		return nil, fmt.Errorf("subkey list at 0x%x is truncated", off)
+	}
+
+	offsets := make([]uint32, 0, count)
+	for i := 0; i < count; i++ {
+		entry := binary.LittleEndian.Uint32(data[4+i*stride:])
+		if sig != "ri" {
+			offsets = append(offsets, entry)
+			continue
+		}
+		nested, err := h.subkeyOffsets(entry, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, nested...)
+	}
+	return offsets, nil
+}
+
+// value parses the vk cell at off and loads its data.
+func (h *Hive) value(off uint32) (*Value, error) {
+	data, err := h.cell(off)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 20 || string(data[:2]) != "vk" {
+		return nil, fmt.Errorf("cell at 0x%x is not a value", off)
+	}
+
+	nameLen := int(binary.LittleEndian.Uint16(data[2:4]))
+	dataSize := binary.LittleEndian.Uint32(data[4:8])
+	dataOff := binary.LittleEndian.Uint32(data[8:12])
+	flags := binary.LittleEndian.Uint16(data[16:18])
+	if 20+nameLen > len(data) {
+		return nil, fmt.Errorf("value name at 0x%x is truncated", off)
+	}
+
+	value := &Value{
+		Name: decodeName(data[20:20+nameLen], flags&valueCompName != 0),
+		Type: binary.LittleEndian.Uint32(data[12:16]),
+	}
+
+	switch {
+	case dataSize&dataInline != 0:
+		// Up to four bytes live in the offset field
+		size := dataSize &^ dataInline
+		if size > 4 {
+			size = 4
+		}
+		value.Data = data[8 : 8+size]
+	case dataSize == 0:
+		value.Data = []byte{}
+	default:
+		if value.Data, err = h.valueData(dataOff, dataSize); err != nil {
+			return nil, fmt.Errorf("value %q: %w", value.Name, err)
+		}
+	}
+	return value, nil
+}
+
+// valueData reads value data from a data cell or, for large values in hive
+// format 1.4 and later, from the segments of a big data cell.
+func (h *Hive) valueData(off, size uint32) ([]byte, error) {
+	data, err := h.cell(off)
+	if err != nil {
+		return nil, err
+	}
+	if size > bigDataSegmentSize && h.minor >= 4 && len(data) >= 8 && string(data[:2]) == "db" {
+		count := int(binary.LittleEndian.Uint16(data[2:4]))
+		list, err := h.cell(binary.LittleEndian.Uint32(data[4:8]))
+		if err != nil {
+			return nil, err
+		}
+		if count*4 > len(list) {
+			return nil, fmt.Errorf("big data segment list is truncated")
+		}
+
+		var buf bytes.Buffer
+		for i := 0; i < count && uint32(buf.Len()) < size; i++ {
+			segment, err := h.cell(binary.LittleEndian.Uint32(list[i*4:]))
+			if err != nil {
+				return nil, err
+			}
+			if len(segment) > bigDataSegmentSize {
+				segment = segment[:bigDataSegmentSize]
+			}
+			buf.Write(segment)
+		}
+		data = buf.Bytes()
+	}
+	if uint32(len(data)) < size {
+		return nil, fmt.Errorf("data is truncated")
+	}
+	return data[:size], nil
+}
+
+// decodeName decodes a key or value name stored as Latin-1 or UTF-16LE.
+func decodeName(b []byte, compressed bool) string {
+	if !compressed {
+		return decodeUTF16(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// decodeUTF16 decodes UTF-16LE data, stopping at a trailing terminator.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, binary.LittleEndian.Uint16(b[i:]))
+	}
+	for len(u) > 0 && u[len(u)-1] == 0 {
+		u = u[:len(u)-1]
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,123 @@
+package regf
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/regf/regftest"
+)
+
+func TestReadBuiltHive(t *testing.T) {
+	written := time.Date(2024, 3, 1, 9, 15, 0, 0, time.UTC)
+	data := regftest.Build(&regftest.Key{
+		Name: "CsiTool-CreateHive-{00000000-0000-0000-0000-000000000000}",
+		Subkeys: []*regftest.Key{{
+			Name:        "Microsoft",
+			LastWritten: written,
+			Subkeys: []*regftest.Key{{
+				Name: "Windows NT",
+				Subkeys: []*regftest.Key{{
+					Name: "CurrentVersion",
+					Values: []regftest.Value{
+						regftest.String("ProductName", "Windows 10 Pro"),
+						regftest.String("RegisteredOwner", strings.Repeat("Ω", 40)),
+						regftest.DWORD("CurrentMajorVersionNumber", 10),
+						regftest.QWORD("InstallTime", 133210000000000000),
+						regftest.MultiString("PendingFileRenameOperations", `\??\C:\a.tmp`, ""),
+						regftest.Binary("DigitalProductId", []byte{1, 2, 3}),
+						regftest.String("", "default"),
+					},
+				}},
+			}},
+		}},
+	})
+	if check := CheckHeader(bytes.NewReader(data), int64(len(data))); !check.Valid {
+		t.Fatalf("built hive fails the header check: %v", check.Problems)
+	}
+
+	hive, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hive.Dirty() {
+		t.Error("clean hive reported dirty")
+	}
+	microsoft, err := hive.OpenKey(`\microsoft`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !microsoft.LastWritten.Equal(written) {
+		t.Errorf("last written = %v, want %v", microsoft.LastWritten, written)
+	}
+	key, err := hive.OpenKey(`MICROSOFT\Windows NT\currentversion`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"productname", "Windows 10 Pro"},
+		{"RegisteredOwner", strings.Repeat("Ω", 40)},
+		{"CurrentMajorVersionNumber", ""},
+		{"PendingFileRenameOperations", `\??\C:\a.tmp`},
+		{"", "default"},
+	}
+	for _, tt := range tests {
+		value, err := key.Value(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := value.String(); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	for name, want := range map[string]uint64{"CurrentMajorVersionNumber": 10, "InstallTime": 133210000000000000} {
+		value, err := key.Value(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := value.Uint64(); !ok || got != want {
+			t.Errorf("%s = %d, %v", name, got, ok)
+		}
+	}
+	if value, err := key.Value("DigitalProductId"); err != nil || value.Type != TypeBinary || !bytes.Equal(value.Data, []byte{1, 2, 3}) {
+		t.Errorf("DigitalProductId = %+v, %v", value, err)
+	}
+
+	if _, err := hive.OpenKey(`Microsoft\Windows\CurrentVersion`); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing key = %v, want ErrNotFound", err)
+	}
+	if _, err := key.Value("ProductId"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing value = %v, want ErrNotFound", err)
+	}
+}
+
+func TestReadDirtyHive(t *testing.T) {
+	data := regftest.Build(&regftest.Key{Name: "ROOT"})
+	data[4]++ // Primary sequence number ahead of the secondary
+	regftest.SetChecksum(data)
+
+	hive, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hive.Dirty() {
+		t.Error("hive with pending log writes not reported dirty")
+	}
+	root, err := hive.Root()
+	if err != nil || root.Name != "ROOT" {
+		t.Fatalf("root = %+v, %v", root, err)
+	}
+	if subkeys, err := root.Subkeys(); err != nil || len(subkeys) != 0 {
+		t.Errorf("subkeys = %v, %v", subkeys, err)
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("not a hive at all, just text padding it out to 0x30")), 51); err == nil {
+		t.Error("text accepted as a hive")
+	}
+}
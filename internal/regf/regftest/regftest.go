@@ -0,0 +1,249 @@
+// Package regftest builds small registry hive files for tests of the
+// packages that parse collected hives. The hives it writes are well formed
+// as far as regf reads and checks them: a valid base block, a single hive
+// bin, lh subkey lists, and resident value data.
+package regftest
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// Registry value types, as in regf.
+const (
+	typeString   = 1
+	typeBinary   = 3
+	typeDWORD    = 4
+	typeMultiStr = 7
+	typeQWORD    = 11
+)
+
+// Key is a key to write, with its values and subkeys.
+type Key struct {
+	Name        string
+	LastWritten time.Time
+	Values      []Value
+	Subkeys     []*Key
+}
+
+// Value is a value to write.
+type Value struct {
+	Name string
+	Type uint32
+	Data []byte
+}
+
+// Path returns the first key of a backslash-separated path of empty keys,
+// e.g. `Microsoft\Windows`, with subkeys under the last one.
+func Path(path string, subkeys ...*Key) *Key {
+	names := strings.Split(path, `\`)
+	key := &Key{Name: names[len(names)-1], Subkeys: subkeys}
+	for i := len(names) - 2; i >= 0; i-- {
+		key = &Key{Name: names[i], Subkeys: []*Key{key}}
+	}
+	return key
+}
+
+// String returns a REG_SZ value.
+func String(name, s string) Value {
+	return Value{Name: name, Type: typeString, Data: encodeUTF16(s + "\x00")}
+}
+
+// MultiString returns a REG_MULTI_SZ value.
+func MultiString(name string, list ...string) Value {
+	return Value{Name: name, Type: typeMultiStr, Data: encodeUTF16(strings.Join(list, "\x00") + "\x00\x00")}
+}
+
+// DWORD returns a REG_DWORD value.
+func DWORD(name string, v uint32) Value {
+	return Value{Name: name, Type: typeDWORD, Data: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+// QWORD returns a REG_QWORD value.
+func QWORD(name string, v uint64) Value {
+	return Value{Name: name, Type: typeQWORD, Data: binary.LittleEndian.AppendUint64(nil, v)}
+}
+
+// Binary returns a REG_BINARY value.
+func Binary(name string, data []byte) Value {
+	return Value{Name: name, Type: typeBinary, Data: data}
+}
+
+// Filetime converts a time to a Windows FILETIME.
+func Filetime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix()+11644473600)*10000000 + uint64(t.Nanosecond()/100)
+}
+
+// Build returns a hive file whose root key is root.
+func Build(root *Key) []byte {
+	b := &builder{bin: make([]byte, 0x20)}
+	rootCell := b.key(root, true)
+
+	// The unused rest of the bin is one free cell
+	binSize := (len(b.bin) + 8 + 0xfff) &^ 0xfff
+	free := binSize - len(b.bin)
+	b.bin = binary.LittleEndian.AppendUint32(b.bin, uint32(free))
+	b.bin = append(b.bin, make([]byte, free-4)...)
+	copy(b.bin, "hbin")
+	binary.LittleEndian.PutUint32(b.bin[8:], uint32(binSize))
+
+	header := make([]byte, 0x1000)
+	copy(header, "regf")
+	binary.LittleEndian.PutUint32(header[4:], 1)    // Primary sequence number
+	binary.LittleEndian.PutUint32(header[8:], 1)    // Secondary sequence number
+	binary.LittleEndian.PutUint32(header[0x14:], 1) // Major version
+	binary.LittleEndian.PutUint32(header[0x18:], 5) // Minor version
+	binary.LittleEndian.PutUint32(header[0x20:], 1) // File format: direct memory load
+	binary.LittleEndian.PutUint32(header[0x24:], rootCell)
+	binary.LittleEndian.PutUint32(header[0x28:], uint32(binSize))
+	binary.LittleEndian.PutUint32(header[0x2c:], 1) // Clustering factor
+	SetChecksum(header)
+
+	return append(header, b.bin...)
+}
+
+// WriteFile writes the hive built from root to name in a temporary directory
+// and returns its path.
+func WriteFile(t *testing.T, name string, root *Key) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, Build(root), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// SetChecksum recomputes the base block checksum after a test edits the header.
+func SetChecksum(hive []byte) {
+	var sum uint32
+	for i := 0; i < 0x1fc; i += 4 {
+		sum ^= binary.LittleEndian.Uint32(hive[i:])
+	}
+	switch sum {
+	case 0xffffffff:
+		sum = 0xfffffffe
+	case 0:
+		sum = 1
+	}
+	binary.LittleEndian.PutUint32(hive[0x1fc:], sum)
+}
+
+// builder appends cells to a hive bin.
+type builder struct {
+	bin []byte
+}
+
+// cell appends an allocated cell and returns its offset from the first bin.
+func (b *builder) cell(payload []byte) uint32 {
+	off := uint32(len(b.bin))
+	size := (len(payload) + 4 + 7) &^ 7
+	b.bin = binary.LittleEndian.AppendUint32(b.bin, uint32(-int32(size)))
+	b.bin = append(b.bin, payload...)
+	b.bin = append(b.bin, make([]byte, size-4-len(payload))...)
+	return off
+}
+
+// key writes a key's values and subkeys, then its nk cell.
+func (b *builder) key(k *Key, root bool) uint32 {
+	subkeyList := uint32(0xffffffff)
+	if len(k.Subkeys) > 0 {
+		list := make([]byte, 4, 4+8*len(k.Subkeys))
+		copy(list, "lh")
+		binary.LittleEndian.PutUint16(list[2:], uint16(len(k.Subkeys)))
+		for _, sub := range k.Subkeys {
+			list = binary.LittleEndian.AppendUint32(list, b.key(sub, false))
+			list = binary.LittleEndian.AppendUint32(list, nameHash(sub.Name))
+		}
+		subkeyList = b.cell(list)
+	}
+
+	valueList := uint32(0xffffffff)
+	if len(k.Values) > 0 {
+		list := make([]byte, 0, 4*len(k.Values))
+		for _, v := range k.Values {
+			list = binary.LittleEndian.AppendUint32(list, b.value(v))
+		}
+		valueList = b.cell(list)
+	}
+
+	name, compressed := encodeName(k.Name)
+	nk := make([]byte, 76, 76+len(name))
+	copy(nk, "nk")
+	var flags uint16
+	if compressed {
+		flags |= 0x0020
+	}
+	if root {
+		flags |= 0x0004 | 0x0008 // Hive entry, cannot be deleted
+	}
+	binary.LittleEndian.PutUint16(nk[2:], flags)
+	binary.LittleEndian.PutUint64(nk[4:], Filetime(k.LastWritten))
+	binary.LittleEndian.PutUint32(nk[20:], uint32(len(k.Subkeys)))
+	binary.LittleEndian.PutUint32(nk[28:], subkeyList)
+	binary.LittleEndian.PutUint32(nk[32:], 0xffffffff)
+	binary.LittleEndian.PutUint32(nk[36:], uint32(len(k.Values)))
+	binary.LittleEndian.PutUint32(nk[40:], valueList)
+	binary.LittleEndian.PutUint32(nk[44:], 0xffffffff)
+	binary.LittleEndian.PutUint32(nk[48:], 0xffffffff)
+	binary.LittleEndian.PutUint16(nk[72:], uint16(len(name)))
+	return b.cell(append(nk, name...))
+}
+
+// value writes a vk cell, with data of up to four bytes held inline.
+func (b *builder) value(v Value) uint32 {
+	name, compressed := encodeName(v.Name)
+	vk := make([]byte, 20, 20+len(name))
+	copy(vk, "vk")
+	binary.LittleEndian.PutUint16(vk[2:], uint16(len(name)))
+	if len(v.Data) <= 4 {
+		binary.LittleEndian.PutUint32(vk[4:], uint32(len(v.Data))|0x80000000)
+		copy(vk[8:12], v.Data)
+	} else {
+		binary.LittleEndian.PutUint32(vk[4:], uint32(len(v.Data)))
+		binary.LittleEndian.PutUint32(vk[8:], b.cell(v.Data))
+	}
+	binary.LittleEndian.PutUint32(vk[12:], v.Type)
+	if compressed {
+		binary.LittleEndian.PutUint16(vk[16:], 0x0001)
+	}
+	return b.cell(append(vk, name...))
+}
+
+// encodeName stores a name as Latin-1 when it fits, as Windows does, and as
+// UTF-16LE otherwise.
+func encodeName(name string) ([]byte, bool) {
+	latin := make([]byte, 0, len(name))
+	for _, r := range name {
+		if r > 0xff {
+			return encodeUTF16(name), false
+		}
+		latin = append(latin, byte(r))
+	}
+	return latin, true
+}
+
+// nameHash is the lh list hash of a key name.
+func nameHash(name string) uint32 {
+	var h uint32
+	for _, r := range strings.ToUpper(name) {
+		h = h*37 + uint32(r)
+	}
+	return h
+}
+
+// encodeUTF16 encodes s as UTF-16LE.
+func encodeUTF16(s string) []byte {
+	var out []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = binary.LittleEndian.AppendUint16(out, u)
+	}
+	return out
+}
@@ -5,14 +5,34 @@ import (
 	"time"
 	
 	"cryptkeeper/internal/core"
+	"cryptkeeper/internal/winutil"
 )
 
+// HashingEnabled is the RunOutput Hashing value when collected files were hashed.
+const HashingEnabled = "enabled"
+
+// HashingDeferred is the RunOutput Hashing value when files were copied
+// unhashed and hashed afterwards by a pool of workers (--hash-workers).
+const HashingDeferred = "deferred"
+
 // RunOutput represents the complete JSON output structure for a harvest command execution.
 type RunOutput struct {
 	Command          string        `json:"command"`
+	Tool             core.BuildInfo `json:"tool"`
+	Hashing          string        `json:"hashing"`
+	HashWorkers      int           `json:"hash_workers,omitempty"` // Workers of a separate hashing pass (--hash-workers)
+	RunID            string        `json:"run_id,omitempty"`
 	ArtifactsDir     string        `json:"artifacts_dir"`
 	ArchivePath      string        `json:"archive_path"`
 	Encrypted        bool          `json:"encrypted"`
+	Compression      string        `json:"compression,omitempty"` // Archive codec: gzip or zstd
+	CompressionLevel int           `json:"compression_level,omitempty"`
+	ArchiveVolumes   []core.ArchiveVolume `json:"archive_volumes,omitempty"` // Files of an archive split with --split-size
+	ArchiveSHA256    string        `json:"archive_sha256,omitempty"`
+	Signature        string        `json:"signature,omitempty"`          // Detached signature written with --sign-key
+	SigningPublicKey string        `json:"signing_public_key,omitempty"` // OpenSSH format
+	CombinedManifest string        `json:"combined_manifest,omitempty"` // Copy of combined_manifest.json beside the archive, with its hash
+	Upload           *core.S3Upload `json:"upload_s3,omitempty"`         // Objects written by --upload-s3
 	AgeRecipientSet  bool          `json:"age_recipient_set"`
 	Parallelism      int           `json:"parallelism"`
 	ModuleTimeout    string        `json:"module_timeout"`
@@ -25,6 +45,51 @@ type RunOutput struct {
 	// Optional fields for forward compatibility
 	Since               string `json:"since,omitempty"`
 	SinceNormalizedUTC  string `json:"since_normalized_utc,omitempty"`
+	Until               string `json:"until,omitempty"`
+	UntilNormalizedUTC  string `json:"until_normalized_utc,omitempty"`
+	Profile             string `json:"profile,omitempty"`
+	ManifestSealed      bool   `json:"manifest_sealed,omitempty"`
+	Interrupted         bool   `json:"interrupted,omitempty"`
+	LowDiskSpace        bool   `json:"low_disk_space,omitempty"`
+	SizeBudgetExhausted bool   `json:"size_budget_exhausted,omitempty"`
+	OfflineRoot         string `json:"offline_root,omitempty"`
+	IOCMatches          int    `json:"ioc_matches,omitempty"`
+	IOCSeverity         string `json:"ioc_severity,omitempty"`
+	PEFlagged           int    `json:"pe_flagged,omitempty"`
+	Deduplicated        int    `json:"deduplicated,omitempty"`
+	ThrottleWait        string `json:"throttle_wait,omitempty"`
+	NonInteractive      string `json:"non_interactive,omitempty"` // Why no operator console was attached
+	
+	// What a --dry-run would have copied; no archive was created
+	DryRun *DryRunProjection `json:"dry_run,omitempty"`
+	
+	// Copy limits the run collected under, for reproducing it
+	SizeCaps *SizeCaps `json:"size_caps,omitempty"`
+	
+	// Collected bytes, archive size, and per-module contributions
+	Stats *core.RunStats `json:"stats,omitempty"`
+	
+	// Short name, registry names, and FQDN of the target; hostname names the archive
+	HostNames *core.HostNames `json:"host_names,omitempty"`
+	
+	// Shadow copy the run read the system volume from (--use-snapshot)
+	Snapshot *winutil.Snapshot `json:"snapshot,omitempty"`
+	
+	// Host time zone, for placing local times recorded on the host on a UTC timeline
+	HostTimezone *winutil.HostTimezone `json:"host_timezone,omitempty"`
+}
+
+// DryRunProjection is the file count and size a --dry-run projected.
+type DryRunProjection struct {
+	ProjectedFiles int64 `json:"projected_files"`
+	ProjectedBytes int64 `json:"projected_bytes"`
+}
+
+// SizeCaps records the per-file, per-module, and run-wide copy limits.
+type SizeCaps struct {
+	MaxFileMB     int64 `json:"max_file_mb"`   // 0 when unlimited
+	MaxModuleMB   int64 `json:"max_module_mb"` // 0 when unlimited
+	MaxTotalBytes int64 `json:"max_total_bytes,omitempty"` // --max-total-size; absent when unlimited
 }
 
 // NewRunOutput creates a new RunOutput with the provided parameters.
@@ -43,6 +108,8 @@ func NewRunOutput(
 ) *RunOutput {
 	return &RunOutput{
 		Command:         "harvest",
+		Tool:            core.CurrentBuildInfo(),
+		Hashing:         HashingEnabled,
 		ArtifactsDir:    artifactsDir,
 		ArchivePath:     archivePath,
 		Encrypted:       encrypted,
@@ -53,7 +120,7 @@ func NewRunOutput(
 		ModuleResults:   moduleResults,
 		FileCount:       fileCount,
 		BytesWritten:    bytesWritten,
-		TimestampUTC:    timestamp.UTC().Format(time.RFC3339),
+		TimestampUTC:    winutil.FormatTime(timestamp),
 	}
 }
 
@@ -64,5 +131,172 @@ func (ro *RunOutput) SetSince(since, sinceNormalized string) {
 	}
 	if sinceNormalized != "" {
 		ro.SinceNormalizedUTC = sinceNormalized
+		if t, err := winutil.ParseTime(sinceNormalized); err == nil {
+			ro.SinceNormalizedUTC = winutil.FormatTime(t)
+		}
+	}
+}
+
+// SetUntil sets the until-related fields for the output.
+func (ro *RunOutput) SetUntil(until, untilNormalized string) {
+	if until != "" {
+		ro.Until = until
+	}
+	if untilNormalized != "" {
+		ro.UntilNormalizedUTC = untilNormalized
+		if t, err := winutil.ParseTime(untilNormalized); err == nil {
+			ro.UntilNormalizedUTC = winutil.FormatTime(t)
+		}
+	}
+}
+
+// SetRunID records the unique identifier of this run.
+func (ro *RunOutput) SetRunID(runID string) {
+	ro.RunID = runID
+}
+
+// SetHashing records whether collected files were hashed.
+func (ro *RunOutput) SetHashing(enabled bool) {
+	ro.Hashing = HashingEnabled
+	if !enabled {
+		ro.Hashing = core.HashingDisabled
+	}
+}
+
+// SetHashWorkers records the size of the worker pool of a separate hashing
+// pass; 0 means files were hashed as they were copied. Module manifests of a
+// deferred run carry no hashes, so the root manifest is the one to check.
+func (ro *RunOutput) SetHashWorkers(workers int) {
+	ro.HashWorkers = workers
+	if workers > 0 && ro.Hashing == HashingEnabled {
+		ro.Hashing = HashingDeferred
+	}
+}
+
+// SetManifestSealed records that the root collection manifest carries an HMAC seal.
+func (ro *RunOutput) SetManifestSealed(sealed bool) {
+	ro.ManifestSealed = sealed
+}
+
+// SetSession records how cryptkeeper was started when nobody was at a
+// console, e.g. in session 0 under PsExec or an EDR agent.
+func (ro *RunOutput) SetSession(session winutil.Session) {
+	if !session.Interactive {
+		ro.NonInteractive = session.Reason
+	}
+}
+
+// SetHostNames records the names of the collection target.
+func (ro *RunOutput) SetHostNames(names *core.HostNames) {
+	ro.HostNames = names
+}
+
+// SetSnapshot records the shadow copy created for the run and whether it was deleted.
+func (ro *RunOutput) SetSnapshot(snapshot *winutil.Snapshot) {
+	ro.Snapshot = snapshot
+}
+
+// SetInterrupted records that collection was cancelled before all modules finished.
+func (ro *RunOutput) SetInterrupted(interrupted bool) {
+	ro.Interrupted = interrupted
+}
+
+// SetLowDiskSpace records that the free space guard stopped copies during collection.
+func (ro *RunOutput) SetLowDiskSpace(low bool) {
+	ro.LowDiskSpace = low
+}
+
+// SetDryRun marks the run as a --dry-run and records what it would have copied.
+func (ro *RunOutput) SetDryRun(files, bytes int64) {
+	ro.DryRun = &DryRunProjection{ProjectedFiles: files, ProjectedBytes: bytes}
+}
+
+// SetArchiveSHA256 records the SHA-256 of the archive as written.
+func (ro *RunOutput) SetArchiveSHA256(sha256Hex string) {
+	ro.ArchiveSHA256 = sha256Hex
+}
+
+// SetSignature records the detached archive signature and the public key it verifies with.
+func (ro *RunOutput) SetSignature(path, publicKey string) {
+	ro.Signature = path
+	ro.SigningPublicKey = publicKey
+}
+
+// SetCombinedManifest records the path of the combined manifest written beside the archive.
+func (ro *RunOutput) SetCombinedManifest(path string) {
+	ro.CombinedManifest = path
+}
+
+// SetUpload records the objects --upload-s3 wrote, or how far it got before failing.
+func (ro *RunOutput) SetUpload(upload *core.S3Upload) {
+	ro.Upload = upload
+}
+
+// SetSizeCaps records the size caps in effect after clamping.
+func (ro *RunOutput) SetSizeCaps(fileMB, moduleMB, totalBytes int64) {
+	ro.SizeCaps = &SizeCaps{MaxFileMB: fileMB, MaxModuleMB: moduleMB, MaxTotalBytes: totalBytes}
+}
+
+// SetSizeBudgetExhausted records that --max-total-size refused copies during collection.
+func (ro *RunOutput) SetSizeBudgetExhausted(exhausted bool) {
+	ro.SizeBudgetExhausted = exhausted
+}
+
+// SetProfile records the collection profile the module set was expanded from.
+func (ro *RunOutput) SetProfile(profile string) {
+	ro.Profile = profile
+}
+
+// SetOfflineRoot records the mounted image or alternate root collected from.
+func (ro *RunOutput) SetOfflineRoot(root string) {
+	ro.OfflineRoot = root
+}
+
+// SetIOCMatches records how many collected files matched the --ioc-hashes set.
+// Any match is a high-severity finding.
+func (ro *RunOutput) SetIOCMatches(count int) {
+	ro.IOCMatches = count
+	if count > 0 {
+		ro.IOCSeverity = core.IOCSeverityHigh
+	}
+}
+
+// SetPEFlagged records how many collected executables --pe-triage flagged.
+func (ro *RunOutput) SetPEFlagged(count int) {
+	ro.PEFlagged = count
+}
+
+// SetCompression records the codec the archive was compressed with and at
+// which level.
+func (ro *RunOutput) SetCompression(compression string, level int) {
+	ro.Compression = compression
+	ro.CompressionLevel = level
+}
+
+// SetArchiveVolumes records the files an archive split with --split-size
+// was written as.
+func (ro *RunOutput) SetArchiveVolumes(volumes []core.ArchiveVolume) {
+	ro.ArchiveVolumes = volumes
+}
+
+// SetDeduplicated records how many files --dedup stored as links to identical content.
+func (ro *RunOutput) SetDeduplicated(count int) {
+	ro.Deduplicated = count
+}
+
+// SetThrottleWait records how long the adaptive throttle delayed copies.
+func (ro *RunOutput) SetThrottleWait(wait time.Duration) {
+	if wait > 0 {
+		ro.ThrottleWait = wait.Round(time.Millisecond).String()
 	}
-}
\ No newline at end of file
+}
+
+// SetHostTimezone records the collection host's time zone and active bias.
+func (ro *RunOutput) SetHostTimezone(tz *winutil.HostTimezone) {
+	ro.HostTimezone = tz
+}
+
+// SetStats records the collection and compression statistics of the run.
+func (ro *RunOutput) SetStats(stats *core.RunStats) {
+	ro.Stats = stats
+}
@@ -0,0 +1,49 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cryptkeeper/internal/core"
+	"cryptkeeper/internal/winutil"
+)
+
+func TestRunOutputRecordsVersion(t *testing.T) {
+	output := NewRunOutput(t.TempDir(), "", false, false, 4, time.Minute, nil, nil, 0, 0, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	data, err := json.Marshal(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Tool struct {
+			Version   string `json:"version"`
+			GoVersion string `json:"go_version"`
+		} `json:"tool"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Tool.Version == "" || decoded.Tool.Version != core.Version() || decoded.Tool.GoVersion == "" {
+		t.Fatalf("run output tool = %+v in %s", decoded.Tool, data)
+	}
+}
+
+func TestRunOutputTimesFollowTimeFormat(t *testing.T) {
+	if err := winutil.SetTimeFormat(winutil.TimeFormatEpoch); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { winutil.SetTimeFormat(winutil.TimeFormatRFC3339) })
+
+	output := NewRunOutput(t.TempDir(), "", false, false, 4, time.Minute, nil, nil, 0, 0, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	output.SetSince("7d", "2024-02-23T12:00:00Z")
+	output.SetUntil("2024-03-01", "2024-03-01T00:00:00Z")
+	if output.TimestampUTC != "1709294400" || output.SinceNormalizedUTC != "1708689600" || output.UntilNormalizedUTC != "1709251200" {
+		t.Fatalf("times = %s, since %s, until %s", output.TimestampUTC, output.SinceNormalizedUTC, output.UntilNormalizedUTC)
+	}
+	// The operator's own input is kept as given
+	if output.Since != "7d" || output.Until != "2024-03-01" {
+		t.Errorf("since %q, until %q", output.Since, output.Until)
+	}
+}
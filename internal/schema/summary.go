@@ -0,0 +1,43 @@
+package schema
+
+// Well-known Summary keys shared by module manifests.
+const (
+	SummaryCertificates          = "certificates"
+	SummaryStreams               = "streams"
+	SummaryShares                = "shares"
+	SummaryShadowCopies          = "shadow_copies"
+	SummaryTickets               = "tickets"
+	SummarySignedFiles           = "signed_files"
+	SummaryActiveSessions        = "active_sessions"
+	SummaryPolicyFindings        = "policy_findings"
+	SummaryIntegrityViolations   = "integrity_violations"
+	SummaryFilteredFiles         = "filtered_files"
+	SummaryPrintDrivers          = "print_drivers"
+	SummaryBAMEntries            = "bam_entries"
+	SummaryWSLDistributions      = "wsl_distributions"
+	SummaryAUMIDs                = "aumids"
+	SummaryInstalledUpdates      = "installed_updates"
+	SummaryControlSetDivergences = "control_set_divergences"
+	SummaryCryptnetURLs          = "cryptnet_urls"
+	SummaryProxyFindings         = "proxy_findings"
+	SummaryCrashDumps            = "crash_dumps"
+)
+
+// Summary holds the module-specific counts of a manifest under uniform keys,
+// so tooling can read them without knowing each module's field names.
+type Summary map[string]int
+
+// NewSummary creates an empty summary.
+func NewSummary() Summary {
+	return make(Summary)
+}
+
+// Set records count under key.
+func (s Summary) Set(key string, count int) {
+	s[key] = count
+}
+
+// Increment adds one to the count under key.
+func (s Summary) Increment(key string) {
+	s[key]++
+}
@@ -0,0 +1,553 @@
+// Package sqlite provides a minimal read-only reader for SQLite 3 database
+// files. It walks table b-trees directly so collected databases (browser
+// history, notification stores) can be parsed without cgo or an external
+// engine. Indexes, WITHOUT ROWID tables, and uncheckpointed WAL content are
+// not read.
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// headerMagic begins every SQLite 3 database file.
+const headerMagic = "SQLite format 3\x00"
+
+// Page types used by table b-trees.
+const (
+	pageTableInterior = 0x05
+	pageTableLeaf     = 0x0d
+)
+
+// maxTreeDepth bounds b-tree recursion so corrupt pages cannot loop forever.
+const maxTreeDepth = 64
+
+// Text encodings recorded in the database header.
+const (
+	encodingUTF8    = 1
+	encodingUTF16LE = 2
+	encodingUTF16BE = 3
+)
+
+// ErrNoSuchTable is returned when a table is not in the schema.
+var ErrNoSuchTable = errors.New("no such table")
+
+// DB is an open SQLite database file.
+type DB struct {
+	r          io.ReaderAt
+	closer     io.Closer
+	pageSize   int
+	usableSize int
+	pageCount  int
+	encoding   uint32
+	tables     map[string]*Table
+}
+
+// Table describes a table from sqlite_master.
+type Table struct {
+	Name     string
+	RootPage int
+	SQL      string
+	Columns  []string
+	rowidCol int // Index of the INTEGER PRIMARY KEY column aliasing the rowid, or -1
+}
+
+// Row is a single table row. Values are nil, int64, float64, string, or []byte.
+type Row struct {
+	RowID   int64
+	Values  []interface{}
+	columns map[string]int
+}
+
+// Open opens a database file for reading.
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	db, err := NewReader(f, stat.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	db.closer = f
+	return db, nil
+}
+
+// NewReader reads a database of the given size from r. The page count is
+// taken from the size rather than the header, which older writers leave stale.
+func NewReader(r io.ReaderAt, size int64) (*DB, error) {
+	header := make([]byte, 100)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read database header: %w", err)
+	}
+	if string(header[:16]) != headerMagic {
+		return nil, fmt.Errorf("not a SQLite 3 database")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size %d", pageSize)
+	}
+
+	db := &DB{
+		r:          r,
+		pageSize:   pageSize,
+		usableSize: pageSize - int(header[20]),
+		pageCount:  int(size / int64(pageSize)),
+		encoding:   binary.BigEndian.Uint32(header[56:60]),
+		tables:     make(map[string]*Table),
+	}
+	if db.encoding == 0 {
+		db.encoding = encodingUTF8
+	}
+
+	if err := db.loadSchema(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close releases the underlying file.
+func (db *DB) Close() error {
+	if db.closer != nil {
+		return db.closer.Close()
+	}
+	return nil
+}
+
+// Tables returns the names of all tables in the schema.
+func (db *DB) Tables() []string {
+	names := make([]string, 0, len(db.tables))
+	for _, t := range db.tables {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// Table returns the schema entry for a table, matched case-insensitively.
+func (db *DB) Table(name string) (*Table, error) {
+	t, ok := db.tables[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchTable, name)
+	}
+	return t, nil
+}
+
+// ForEachRow calls fn for every row of a table in rowid order. Returning an
+// error from fn stops the scan and is returned.
+func (db *DB) ForEachRow(table string, fn func(Row) error) error {
+	t, err := db.Table(table)
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string]int, len(t.Columns))
+	for i, c := range t.Columns {
+		columns[strings.ToLower(c)] = i
+	}
+
+	return db.walkTable(t.RootPage, 0, func(rowid int64, payload []byte) error {
+		values, err := db.decodeRecord(payload)
+		if err != nil {
+			return err
+		}
+		// Columns added by ALTER TABLE are absent from older records
+		for len(values) < len(t.Columns) {
+			values = append(values, nil)
+		}
+		if t.rowidCol >= 0 && t.rowidCol < len(values) && values[t.rowidCol] == nil {
+			values[t.rowidCol] = rowid
+		}
+		return fn(Row{RowID: rowid, Values: values, columns: columns})
+	})
+}
+
+// Get returns the value of a named column, or nil if the column is unknown.
+func (r Row) Get(column string) interface{} {
+	i, ok := r.columns[strings.ToLower(column)]
+	if !ok || i >= len(r.Values) {
+		return nil
+	}
+	return r.Values[i]
+}
+
+// Int returns a column as an integer, converting floats and numeric text.
+func (r Row) Int(column string) int64 {
+	switch v := r.Get(column).(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case string:
+		var n int64
+		fmt.Sscan(v, &n)
+		return n
+	}
+	return 0
+}
+
+// String returns a column as text; blobs are returned as raw bytes.
+func (r Row) String(column string) string {
+	switch v := r.Get(column).(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return fmt.Sprint(v)
+	case float64:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// loadSchema reads sqlite_master, which is always rooted at page 1.
+func (db *DB) loadSchema() error {
+	return db.walkTable(1, 0, func(rowid int64, payload []byte) error {
+		values, err := db.decodeRecord(payload)
+		if err != nil {
+			return err
+		}
+		if len(values) < 5 {
+			return nil
+		}
+		kind, _ := values[0].(string)
+		name, _ := values[1].(string)
+		root, _ := values[3].(int64)
+		sql, _ := values[4].(string)
+		if kind != "table" || root <= 0 {
+			return nil
+		}
+		columns, rowidCol := parseColumns(sql)
+		db.tables[strings.ToLower(name)] = &Table{
+			Name:     name,
+			RootPage: int(root),
+			SQL:      sql,
+			Columns:  columns,
+			rowidCol: rowidCol,
+		}
+		return nil
+	})
+}
+
+// readPage returns the raw bytes of a 1-based page number.
+func (db *DB) readPage(n int) ([]byte, error) {
+	if n < 1 || n > db.pageCount {
+		return nil, fmt.Errorf("page %d out of range", n)
+	}
+	page := make([]byte, db.pageSize)
+	read, err := db.r.ReadAt(page, int64(n-1)*int64(db.pageSize))
+	if err != nil && !(err == io.EOF && read == db.pageSize) {
+		return nil, fmt.Errorf("failed to read page %d: %w", n, err)
+	}
+	return page, nil
+}
+
+// walkTable visits every leaf cell of a table b-tree rooted at page.
+func (db *DB) walkTable(pageNum, depth int, fn func(rowid int64, payload []byte) error) error {
+	if depth > maxTreeDepth {
+		return fmt.Errorf("b-tree too deep at page %d", pageNum)
+	}
+
+	page, err := db.readPage(pageNum)
+	if err != nil {
+		return err
+	}
+
+	// Page 1 starts with the 100-byte database header
+	offset := 0
+	if pageNum == 1 {
+		offset = 100
+	}
+	hdr := page[offset:]
+	pageType := hdr[0]
+	cellCount := int(binary.BigEndian.Uint16(hdr[3:5]))
+
+	headerSize := 8
+	if pageType == pageTableInterior {
+		headerSize = 12
+	}
+	pointers := hdr[headerSize:]
+	if len(pointers) < cellCount*2 {
+		return fmt.Errorf("corrupt cell pointer array on page %d", pageNum)
+	}
+
+	switch pageType {
+	case pageTableInterior:
+		for i := 0; i < cellCount; i++ {
+			cell := int(binary.BigEndian.Uint16(pointers[i*2:]))
+			if cell+4 > len(page) {
+				return fmt.Errorf("corrupt cell on page %d", pageNum)
+			}
+			child := int(binary.BigEndian.Uint32(page[cell:]))
+			if err := db.walkTable(child, depth+1, fn); err != nil {
+				return err
+			}
+		}
+		right := int(binary.BigEndian.Uint32(hdr[8:12]))
+		return db.walkTable(right, depth+1, fn)
+
+	case pageTableLeaf:
+		for i := 0; i < cellCount; i++ {
+			cell := int(binary.BigEndian.Uint16(pointers[i*2:]))
+			if cell >= len(page) {
+				return fmt.Errorf("corrupt cell on page %d", pageNum)
+			}
+			rowid, payload, err := db.readLeafCell(page, cell)
+			if err != nil {
+				return err
+			}
+			if err := fn(rowid, payload); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unexpected page type 0x%02x on page %d", pageType, pageNum)
+	}
+}
+
+// readLeafCell decodes a table leaf cell, following overflow pages.
+func (db *DB) readLeafCell(page []byte, cell int) (int64, []byte, error) {
+	payloadSize, n := readVarint(page[cell:])
+	cell += n
+	rowid, n := readVarint(page[cell:])
+	cell += n
+
+	total := int(payloadSize)
+	if total < 0 {
+		return 0, nil, fmt.Errorf("invalid payload size")
+	}
+
+	// Work out how much of the payload is stored on this page
+	u := db.usableSize
+	maxLocal := u - 35
+	local := total
+	if total > maxLocal {
+		minLocal := ((u-12)*32)/255 - 23
+		local = minLocal + (total-minLocal)%(u-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if cell+local > len(page) {
+		return 0, nil, fmt.Errorf("cell payload exceeds page")
+	}
+
+	payload := make([]byte, 0, total)
+	payload = append(payload, page[cell:cell+local]...)
+	if local == total {
+		return int64(rowid), payload, nil
+	}
+
+	if cell+local+4 > len(page) {
+		return 0, nil, fmt.Errorf("missing overflow pointer")
+	}
+	next := int(binary.BigEndian.Uint32(page[cell+local:]))
+	for hops := 0; len(payload) < total; hops++ {
+		if next == 0 || hops > db.pageCount+1 {
+			return 0, nil, fmt.Errorf("truncated overflow chain")
+		}
+		overflow, err := db.readPage(next)
+		if err != nil {
+			return 0, nil, err
+		}
+		next = int(binary.BigEndian.Uint32(overflow[:4]))
+		chunk := overflow[4:u]
+		if remaining := total - len(payload); len(chunk) > remaining {
+			chunk = chunk[:remaining]
+		}
+		payload = append(payload, chunk...)
+	}
+
+	return int64(rowid), payload, nil
+}
+
+// decodeRecord decodes a record-format payload into column values.
+func (db *DB) decodeRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := readVarint(payload)
+	if int(headerSize) > len(payload) || headerSize < uint64(n) {
+		return nil, fmt.Errorf("invalid record header")
+	}
+
+	var types []uint64
+	for pos := n; pos < int(headerSize); {
+		t, m := readVarint(payload[pos:])
+		if m == 0 {
+			return nil, fmt.Errorf("invalid record header")
+		}
+		types = append(types, t)
+		pos += m
+	}
+
+	values := make([]interface{}, 0, len(types))
+	body := payload[headerSize:]
+	for _, t := range types {
+		size := serialTypeSize(t)
+		if size > len(body) {
+			return nil, fmt.Errorf("record body truncated")
+		}
+		data := body[:size]
+		body = body[size:]
+
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t >= 1 && t <= 6:
+			values = append(values, readInt(data))
+		case t == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(data)))
+		case t == 8:
+			values = append(values, int64(0))
+		case t == 9:
+			values = append(values, int64(1))
+		case t >= 12 && t%2 == 0:
+			values = append(values, append([]byte(nil), data...))
+		case t >= 13:
+			values = append(values, db.decodeText(data))
+		default:
+			values = append(values, nil)
+		}
+	}
+
+	return values, nil
+}
+
+// decodeText converts stored text to a Go string using the database encoding.
+func (db *DB) decodeText(data []byte) string {
+	if db.encoding == encodingUTF8 || len(data)%2 != 0 {
+		return string(data)
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if db.encoding == encodingUTF16BE {
+			units[i] = binary.BigEndian.Uint16(data[i*2:])
+		} else {
+			units[i] = binary.LittleEndian.Uint16(data[i*2:])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// serialTypeSize returns the body size in bytes of a record serial type.
+func serialTypeSize(t uint64) int {
+	switch {
+	case t <= 4:
+		return [...]int{0, 1, 2, 3, 4}[t]
+	case t == 5:
+		return 6
+	case t == 6 || t == 7:
+		return 8
+	case t >= 12:
+		return int((t - 12) / 2)
+	}
+	return 0
+}
+
+// readInt decodes a big-endian two's-complement integer of 1-8 bytes.
+func readInt(data []byte) int64 {
+	var v int64
+	if len(data) > 0 && data[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, b := range data {
+		v = v<<8 | int64(b)
+	}
+	return v
+}
+
+// readVarint decodes a SQLite variable-length integer, returning its length.
+func readVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return v, len(b)
+}
+
+// parseColumns extracts column names from a CREATE TABLE statement and the
+// index of an INTEGER PRIMARY KEY column, which aliases the rowid.
+func parseColumns(sql string) ([]string, int) {
+	open := strings.Index(sql, "(")
+	end := strings.LastIndex(sql, ")")
+	if open < 0 || end <= open {
+		return nil, -1
+	}
+
+	var columns []string
+	rowidCol := -1
+	for _, def := range splitTopLevel(sql[open+1 : end]) {
+		fields := strings.Fields(def)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PRIMARY", "UNIQUE", "CHECK", "FOREIGN", "CONSTRAINT":
+			continue
+		}
+		name := strings.Trim(fields[0], "\"`[]'")
+		upper := strings.ToUpper(def)
+		if len(fields) > 1 && strings.ToUpper(fields[1]) == "INTEGER" && strings.Contains(upper, "PRIMARY KEY") {
+			rowidCol = len(columns)
+		}
+		columns = append(columns, name)
+	}
+
+	return columns, rowidCol
+}
+
+// splitTopLevel splits column definitions on commas outside parentheses and quotes.
+func splitTopLevel(s string) []string {
+	var parts []string
+	var current bytes.Buffer
+	depth := 0
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '[':
+			quote = ']'
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
@@ -0,0 +1,186 @@
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"cryptkeeper/internal/sqlite/sqlitetest"
+)
+
+// sampleTables has a table spread over several leaf pages, one with rows
+// written before a column was added, and an empty one.
+func sampleTables() []sqlitetest.Table {
+	var visits []sqlitetest.Row
+	for i := 1; i <= 400; i++ {
+		visits = append(visits, sqlitetest.Row{i * 2, fmt.Sprintf("https://example.test/page/%d", i), int64(13350000000000000 + i), float64(i) / 8, []byte{byte(i)}})
+	}
+	return []sqlitetest.Table{
+		{
+			Name:    "visits",
+			Columns: []string{"id INTEGER PRIMARY KEY", "url LONGVARCHAR", "visit_time INTEGER NOT NULL", "score REAL", "hash BLOB"},
+			Rows:    visits,
+		},
+		{
+			Name:    "meta",
+			Columns: []string{"key LONGVARCHAR NOT NULL UNIQUE PRIMARY KEY", "value LONGVARCHAR", "added INTEGER DEFAULT 0"},
+			Rows:    []sqlitetest.Row{{"version", "42"}, {"last_compatible_version", "16", -7}},
+		},
+		{Name: "empty", Columns: []string{"id INTEGER PRIMARY KEY"}},
+	}
+}
+
+func openSample(t *testing.T) *DB {
+	t.Helper()
+	data := sqlitetest.Build(sampleTables()...)
+	db, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSchema(t *testing.T) {
+	db := openSample(t)
+	tables := db.Tables()
+	sort.Strings(tables)
+	if !reflect.DeepEqual(tables, []string{"empty", "meta", "visits"}) {
+		t.Fatalf("tables = %v", tables)
+	}
+
+	// Names match case-insensitively
+	table, err := db.Table("VISITS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Name != "visits" || table.RootPage != 2 || table.rowidCol != 0 ||
+		!reflect.DeepEqual(table.Columns, []string{"id", "url", "visit_time", "score", "hash"}) {
+		t.Fatalf("table = %+v", table)
+	}
+	if meta, _ := db.Table("meta"); meta.rowidCol != -1 {
+		t.Fatalf("meta aliases column %d as the rowid", meta.rowidCol)
+	}
+
+	if _, err := db.Table("downloads"); !errors.Is(err, ErrNoSuchTable) {
+		t.Fatalf("missing table = %v", err)
+	}
+	if err := db.ForEachRow("downloads", func(Row) error { return nil }); !errors.Is(err, ErrNoSuchTable) {
+		t.Fatalf("rows of a missing table = %v", err)
+	}
+}
+
+func TestForEachRow(t *testing.T) {
+	db := openSample(t)
+
+	// Rows come back in rowid order across the leaves of the interior root
+	var rows []Row
+	if err := db.ForEachRow("visits", func(row Row) error {
+		rows = append(rows, row)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 400 {
+		t.Fatalf("%d rows, want 400", len(rows))
+	}
+	for i, row := range rows {
+		if row.RowID != int64(i+1)*2 {
+			t.Fatalf("row %d has rowid %d", i, row.RowID)
+		}
+	}
+	last := rows[399]
+	want := []interface{}{int64(800), "https://example.test/page/400", int64(13350000000000400), 50.0, []byte{byte(400 % 256)}}
+	if !reflect.DeepEqual(last.Values, want) {
+		t.Fatalf("last row = %v, want %v", last.Values, want)
+	}
+	if last.Int("ID") != 800 || last.String("url") != "https://example.test/page/400" || last.Int("score") != 50 || last.String("visit_time") != "13350000000000400" {
+		t.Fatalf("row accessors = %d, %q, %d", last.Int("ID"), last.String("url"), last.Int("score"))
+	}
+	if last.Get("missing") != nil || last.String("missing") != "" || last.Int("missing") != 0 {
+		t.Fatal("unknown column has a value")
+	}
+
+	// Rows older than a column added by ALTER TABLE read it as null
+	var meta [][]interface{}
+	if err := db.ForEachRow("meta", func(row Row) error {
+		meta = append(meta, row.Values)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(meta, [][]interface{}{{"version", "42", nil}, {"last_compatible_version", "16", int64(-7)}}) {
+		t.Fatalf("meta rows = %v", meta)
+	}
+
+	// An empty table has no rows, and fn's error stops the scan
+	if err := db.ForEachRow("empty", func(Row) error { t.Fatal("row in an empty table"); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	stop := errors.New("stop")
+	count := 0
+	if err := db.ForEachRow("visits", func(Row) error { count++; return stop }); err != stop || count != 1 {
+		t.Fatalf("stopped scan = %v after %d rows", err, count)
+	}
+}
+
+func TestNewReaderRejectsDamagedDatabases(t *testing.T) {
+	valid := sqlitetest.Build(sampleTables()...)
+	tests := []struct {
+		name   string
+		damage func(db []byte) []byte
+		want   string
+	}{
+		{"not SQLite", func(db []byte) []byte { return append([]byte("regf"), db[4:]...) }, "not a SQLite 3 database"},
+		{"header cut", func(db []byte) []byte { return db[:50] }, "failed to read database header"},
+		{"odd page size", func(db []byte) []byte {
+			binary.BigEndian.PutUint16(db[16:], 3000)
+			return db
+		}, "invalid page size"},
+		{"schema page type", func(db []byte) []byte {
+			db[100] = 0x0a
+			return db
+		}, "unexpected page type"},
+		{"schema cell count", func(db []byte) []byte {
+			binary.BigEndian.PutUint16(db[103:], 0x7fff)
+			return db
+		}, "corrupt cell pointer array"},
+	}
+	for _, tt := range tests {
+		data := tt.damage(append([]byte(nil), valid...))
+		if _, err := NewReader(bytes.NewReader(data), int64(len(data))); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// A table whose leaves were cut off fails when it is read
+	data := valid[:3*4096]
+	db, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ForEachRow("visits", func(Row) error { return nil }); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Fatalf("truncated table = %v", err)
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	for _, tt := range []struct {
+		sql      string
+		columns  []string
+		rowidCol int
+	}{
+		{"CREATE TABLE urls(id INTEGER PRIMARY KEY AUTOINCREMENT,url LONGVARCHAR,title LONGVARCHAR)", []string{"id", "url", "title"}, 0},
+		{`CREATE TABLE "moz_annos" ("id" INTEGER PRIMARY KEY, "content" LONGVARCHAR, CONSTRAINT c UNIQUE (id))`, []string{"id", "content"}, 0},
+		{"CREATE TABLE t (a TEXT DEFAULT 'x,y', [b] INT, d NUMERIC(10, 2), PRIMARY KEY (a))", []string{"a", "b", "d"}, -1},
+	} {
+		columns, rowidCol := parseColumns(tt.sql)
+		if !reflect.DeepEqual(columns, tt.columns) || rowidCol != tt.rowidCol {
+			t.Errorf("parseColumns(%q) = %q, %d", tt.sql, columns, rowidCol)
+		}
+	}
+}
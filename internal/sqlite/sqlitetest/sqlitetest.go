@@ -0,0 +1,346 @@
+// Package sqlitetest builds small SQLite databases for tests of the packages
+// that parse collected ones, such as browser History and places.sqlite. The
+// databases it writes are well formed SQLite 3 files in UTF-8 with 4 KB
+// pages: sqlite_master on page 1, and each table a single leaf page or, when
+// its rows need more, leaves under one interior root page. Records are
+// stored inline, so a row must fit on a page without overflow.
+package sqlitetest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Layout of the written file.
+const (
+	pageSize          = 4096
+	headerSize        = 100 // The database header at the start of page 1
+	pageTableInterior = 0x05
+	pageTableLeaf     = 0x0d
+	leafHeaderSize    = 8
+	interiorHeader    = 12
+	maxLocal          = pageSize - 35 // Largest payload stored without overflow
+)
+
+// Table is a table to write. Columns are column definitions as they appear in
+// CREATE TABLE, such as "id INTEGER PRIMARY KEY" or "url LONGVARCHAR".
+type Table struct {
+	Name    string
+	Columns []string
+	Rows    []Row
+}
+
+// Row holds a record's values in column order. Values are nil, any Go
+// integer, bool (stored as 0 or 1), float64, string, or []byte. A row shorter
+// than the columns is one written before later columns were added by ALTER
+// TABLE. The value of an INTEGER PRIMARY KEY column becomes the rowid; rows
+// without one take the rowid after the previous row's.
+type Row []interface{}
+
+// Build returns a database file holding tables. It panics when a row does not
+// fit on a page, rowids are out of order, or a value has an unsupported type.
+func Build(tables ...Table) []byte {
+	pages := [][]byte{nil} // Page 1, sqlite_master, is laid out last
+	var master []cell
+	for _, table := range tables {
+		cells := tableCells(table)
+		root := len(pages) + 1
+		leaves := packLeaves(table.Name, cells, 0)
+		if len(leaves) == 1 {
+			pages = append(pages, leaves[0].page)
+		} else {
+			pages = append(pages, nil)
+			children := make([]int, len(leaves))
+			for i, leaf := range leaves {
+				pages = append(pages, leaf.page)
+				children[i] = len(pages)
+			}
+			pages[root-1] = interiorPage(table.Name, leaves, children)
+		}
+
+		sql := fmt.Sprintf("CREATE TABLE %s (%s)", table.Name, strings.Join(table.Columns, ", "))
+		payload := record(table.Name, Row{"table", table.Name, table.Name, root, sql})
+		master = append(master, cell{rowid: int64(len(master) + 1), payload: payload})
+	}
+
+	schema := packLeaves("sqlite_master", master, headerSize)
+	if len(schema) != 1 {
+		panic("sqlitetest: sqlite_master does not fit on page 1")
+	}
+	pages[0] = schema[0].page
+
+	header := pages[0][:headerSize]
+	copy(header, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(header[16:], pageSize)
+	header[18], header[19] = 1, 1 // Rollback journal file format
+	header[21], header[22], header[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(header[24:], 1) // File change counter
+	binary.BigEndian.PutUint32(header[28:], uint32(len(pages)))
+	binary.BigEndian.PutUint32(header[40:], 1) // Schema cookie
+	binary.BigEndian.PutUint32(header[44:], 4) // Schema format
+	binary.BigEndian.PutUint32(header[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(header[92:], 1) // Version valid for the change counter
+	binary.BigEndian.PutUint32(header[96:], 3040001)
+
+	data := make([]byte, 0, len(pages)*pageSize)
+	for _, page := range pages {
+		data = append(data, page...)
+	}
+	return data
+}
+
+// WriteFile writes the database built from tables to name in a temporary
+// directory and returns its path.
+func WriteFile(t *testing.T, name string, tables ...Table) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, Build(tables...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// cell is a table leaf cell before it is placed on a page.
+type cell struct {
+	rowid   int64
+	payload []byte
+}
+
+// leaf is a laid out leaf page and the largest rowid on it.
+type leaf struct {
+	page     []byte
+	maxRowid int64
+}
+
+// tableCells encodes the rows of a table, storing an INTEGER PRIMARY KEY
+// value as the rowid and a null in the record, as SQLite does.
+func tableCells(table Table) []cell {
+	alias := -1
+	for i, def := range table.Columns {
+		fields := strings.Fields(strings.ToUpper(def))
+		if len(fields) > 1 && fields[1] == "INTEGER" && strings.Contains(strings.ToUpper(def), "PRIMARY KEY") {
+			alias = i
+		}
+	}
+
+	cells := make([]cell, 0, len(table.Rows))
+	var rowid int64
+	for _, row := range table.Rows {
+		next := rowid + 1
+		if alias >= 0 && alias < len(row) && row[alias] != nil {
+			id, ok := integer(row[alias])
+			if !ok {
+				panic(fmt.Sprintf("sqlitetest: table %s: rowid %v is not an integer", table.Name, row[alias]))
+			}
+			next = id
+			row = append(Row(nil), row...)
+			row[alias] = nil
+		}
+		if len(cells) > 0 && next <= rowid {
+			panic(fmt.Sprintf("sqlitetest: table %s: rowid %d after %d", table.Name, next, rowid))
+		}
+		rowid = next
+		cells = append(cells, cell{rowid: rowid, payload: record(table.Name, row)})
+	}
+	return cells
+}
+
+// packLeaves lays cells out on as many leaf pages as they need. The first
+// page's b-tree header starts at offset, past the database header on page 1.
+func packLeaves(table string, cells []cell, offset int) []leaf {
+	var leaves []leaf
+	for len(cells) > 0 || len(leaves) == 0 {
+		var encoded [][]byte
+		used := offset + leafHeaderSize
+		if len(leaves) > 0 {
+			used = leafHeaderSize
+		}
+		n := 0
+		for ; n < len(cells); n++ {
+			if len(cells[n].payload) > maxLocal {
+				panic(fmt.Sprintf("sqlitetest: table %s: row %d needs overflow pages", table, cells[n].rowid))
+			}
+			c := appendVarint(nil, uint64(len(cells[n].payload)))
+			c = appendVarint(c, uint64(cells[n].rowid))
+			c = append(c, cells[n].payload...)
+			if used+2+len(c) > pageSize {
+				break
+			}
+			used += 2 + len(c)
+			encoded = append(encoded, c)
+		}
+		if n == 0 && len(cells) > 0 {
+			panic(fmt.Sprintf("sqlitetest: table %s: row %d does not fit on a page", table, cells[0].rowid))
+		}
+
+		start := offset
+		if len(leaves) > 0 {
+			start = 0
+		}
+		l := leaf{page: btreePage(pageTableLeaf, start, leafHeaderSize, encoded)}
+		if n > 0 {
+			l.maxRowid = cells[n-1].rowid
+		}
+		leaves = append(leaves, l)
+		cells = cells[n:]
+	}
+	return leaves
+}
+
+// interiorPage points at each leaf but the last by its largest rowid, and at
+// the last as the right-most child.
+func interiorPage(table string, leaves []leaf, children []int) []byte {
+	var encoded [][]byte
+	used := interiorHeader
+	for i, l := range leaves[:len(leaves)-1] {
+		c := binary.BigEndian.AppendUint32(nil, uint32(children[i]))
+		c = appendVarint(c, uint64(l.maxRowid))
+		used += 2 + len(c)
+		encoded = append(encoded, c)
+	}
+	if used > pageSize {
+		panic(fmt.Sprintf("sqlitetest: table %s needs more than two b-tree levels", table))
+	}
+	page := btreePage(pageTableInterior, 0, interiorHeader, encoded)
+	binary.BigEndian.PutUint32(page[8:], uint32(children[len(children)-1]))
+	return page
+}
+
+// btreePage writes a b-tree page header at offset, the cell pointer array
+// after it, and the cells packed from the end of the page.
+func btreePage(kind byte, offset, hdrSize int, cells [][]byte) []byte {
+	page := make([]byte, pageSize)
+	hdr := page[offset:]
+	hdr[0] = kind
+	binary.BigEndian.PutUint16(hdr[3:], uint16(len(cells)))
+
+	content := pageSize
+	for i, c := range cells {
+		content -= len(c)
+		copy(page[content:], c)
+		binary.BigEndian.PutUint16(hdr[hdrSize+2*i:], uint16(content))
+	}
+	binary.BigEndian.PutUint16(hdr[5:], uint16(content))
+	return page
+}
+
+// record encodes values in the record format: a header of serial types
+// behind its own length, then the values.
+func record(table string, row Row) []byte {
+	var types, body []byte
+	for _, v := range row {
+		serial, data := encode(table, v)
+		types = appendVarint(types, serial)
+		body = append(body, data...)
+	}
+
+	// The header length counts itself, which may take a second byte
+	size := len(types) + 1
+	if size > 0x7f {
+		size++
+	}
+	return append(append(appendVarint(nil, uint64(size)), types...), body...)
+}
+
+// encode returns the serial type and stored bytes of a value, using the
+// smallest integer width that holds it.
+func encode(table string, v interface{}) (uint64, []byte) {
+	switch x := v.(type) {
+	case nil:
+		return 0, nil
+	case bool:
+		if x {
+			return 9, nil
+		}
+		return 8, nil
+	case float64:
+		return 7, binary.BigEndian.AppendUint64(nil, math.Float64bits(x))
+	case string:
+		return uint64(13 + 2*len(x)), []byte(x)
+	case []byte:
+		return uint64(12 + 2*len(x)), append([]byte(nil), x...)
+	}
+
+	n, ok := integer(v)
+	if !ok {
+		panic(fmt.Sprintf("sqlitetest: table %s: unsupported value %T", table, v))
+	}
+	switch {
+	case n == 0:
+		return 8, nil
+	case n == 1:
+		return 9, nil
+	}
+	for _, width := range []struct {
+		serial uint64
+		bytes  int
+	}{{1, 1}, {2, 2}, {3, 3}, {4, 4}, {5, 6}, {6, 8}} {
+		bits := uint(width.bytes * 8)
+		if bits == 64 || (n >= -1<<(bits-1) && n < 1<<(bits-1)) {
+			data := binary.BigEndian.AppendUint64(nil, uint64(n))
+			return width.serial, data[8-width.bytes:]
+		}
+	}
+	panic("unreachable")
+}
+
+// integer returns any Go integer as an int64.
+func integer(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// appendVarint appends v as a SQLite variable-length integer: seven bits per
+// byte, most significant first, with a full ninth byte for large values.
+func appendVarint(b []byte, v uint64) []byte {
+	if v > 0x00ffffffffffffff {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [9]byte
+	i := len(buf)
+	for {
+		i--
+		buf[i] = byte(v & 0x7f)
+		if i < len(buf)-1 {
+			buf[i] |= 0x80
+		}
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	return append(b, buf[i:]...)
+}
@@ -0,0 +1,40 @@
+package winutil
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Now returns the current time from the clock of the run whose Collect
+// context is ctx, so a run with a fixed clock writes the same timestamps
+// every time. Outside a run it is the system time.
+func Now(ctx context.Context) time.Time {
+	return CollectSettingsFrom(ctx).now()
+}
+
+// Hostname returns the host name from the environment of the run whose
+// Collect context is ctx, or the kernel's outside a run.
+func Hostname(ctx context.Context) (string, error) {
+	if hostname := CollectSettingsFrom(ctx).Hostname; hostname != nil {
+		return hostname()
+	}
+	return os.Hostname()
+}
+
+// Getenv returns an environment variable from the environment of the run
+// whose Collect context is ctx, or the process's outside a run.
+func Getenv(ctx context.Context, key string) string {
+	if getenv := CollectSettingsFrom(ctx).Getenv; getenv != nil {
+		return getenv(key)
+	}
+	return os.Getenv(key)
+}
+
+// now reads the run's clock.
+func (s *CollectSettings) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,166 @@
+package winutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandsExecutedName is the command audit log written to the artifacts root by --dump-commands.
+const CommandsExecutedName = "commands_executed.jsonl"
+
+// Command record events: every command gets a start record before it runs
+// and an end record once it has finished, with the same ID. A start record
+// without an end is a command that never returned.
+const (
+	CommandEventStart = "start"
+	CommandEventEnd   = "end"
+)
+
+// CommandRecord is one event of an external command run on the subject
+// system. Output itself is not recorded, only how much was captured; the
+// end and output fields are only set on end records.
+type CommandRecord struct {
+	ID          int64    `json:"id"`
+	Event       string   `json:"event"`
+	Command     string   `json:"command"`
+	Args        []string `json:"args"`
+	CommandLine string   `json:"command_line"`
+	StartUTC    string   `json:"start_utc"`
+	EndUTC      string   `json:"end_utc,omitempty"`
+	DurationMS  int64    `json:"duration_ms,omitempty"`
+	ExitCode    *int     `json:"exit_code,omitempty"` // -1 when the process did not start or was killed
+	StdoutBytes int      `json:"stdout_bytes,omitempty"`
+	StderrBytes int      `json:"stderr_bytes,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// commandAudit appends records per external command while enabled.
+type commandAudit struct {
+	mu     sync.Mutex
+	file   *os.File
+	err    error // First write failure; later records are dropped
+	lastID int64
+}
+
+var audit commandAudit
+
+// StartCommandAudit begins recording every command run through
+// ExecWithContext to commands_executed.jsonl in artifactsDir.
+func StartCommandAudit(artifactsDir string) error {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	if audit.file != nil {
+		return fmt.Errorf("command audit already started")
+	}
+	file, err := os.OpenFile(filepath.Join(artifactsDir, CommandsExecutedName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create command audit log: %w", err)
+	}
+	audit.file = file
+	audit.err = nil
+	audit.lastID = 0
+	return nil
+}
+
+// StopCommandAudit closes the audit log. It reports the first write failure, if any.
+func StopCommandAudit() error {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	if audit.file == nil {
+		return nil
+	}
+	err := audit.file.Close()
+	audit.file = nil
+	if audit.err != nil {
+		return audit.err
+	}
+	return err
+}
+
+// beginCommand appends the start record of a command about to run when the
+// audit is enabled, returning the ID its end record is written with.
+func beginCommand(name string, args []string, start time.Time) int64 {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	if audit.file == nil || audit.err != nil {
+		return 0
+	}
+	audit.lastID++
+	audit.write(CommandRecord{
+		ID:          audit.lastID,
+		Event:       CommandEventStart,
+		Command:     name,
+		Args:        append([]string{}, args...),
+		CommandLine: FormatCommandLine(name, args),
+		StartUTC:    FormatTime(start),
+	})
+	return audit.lastID
+}
+
+// recordCommand appends the end record of the command beginCommand
+// returned id for, when the audit is enabled.
+func recordCommand(id int64, name string, args []string, start, end time.Time, exitCode, stdoutBytes, stderrBytes int, runErr error) {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	if audit.file == nil || audit.err != nil || id == 0 {
+		return
+	}
+
+	record := CommandRecord{
+		ID:          id,
+		Event:       CommandEventEnd,
+		Command:     name,
+		Args:        append([]string{}, args...),
+		CommandLine: FormatCommandLine(name, args),
+		StartUTC:    FormatTime(start),
+		EndUTC:      FormatTime(end),
+		DurationMS:  end.Sub(start).Milliseconds(),
+		ExitCode:    &exitCode,
+		StdoutBytes: stdoutBytes,
+		StderrBytes: stderrBytes,
+	}
+	if runErr != nil {
+		record.Error = runErr.Error()
+	}
+	audit.write(record)
+}
+
+// write appends one record line, with audit.mu held. The line is written
+// with a single call and synced, so it survives the collector crashing
+// during the command that follows.
+func (a *commandAudit) write(record CommandRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		a.err = fmt.Errorf("failed to marshal command record: %w", err)
+		return
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		a.err = fmt.Errorf("failed to write command audit log: %w", err)
+		return
+	}
+	if err := a.file.Sync(); err != nil {
+		a.err = fmt.Errorf("failed to sync command audit log: %w", err)
+	}
+}
+
+// FormatCommandLine renders a command and its arguments as a single line,
+// quoting arguments that contain spaces or quotes.
+func FormatCommandLine(name string, args []string) string {
+	parts := make([]string, 0, len(args)+1)
+	for _, part := range append([]string{name}, args...) {
+		if part == "" || strings.ContainsAny(part, " \t\"") {
+			part = `"` + strings.ReplaceAll(part, `"`, `\"`) + `"`
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
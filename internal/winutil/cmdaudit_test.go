@@ -0,0 +1,91 @@
+package winutil
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// readCommandRecords parses commands_executed.jsonl in dir.
+func readCommandRecords(t *testing.T, dir string) []CommandRecord {
+	t.Helper()
+	file, err := os.Open(filepath.Join(dir, CommandsExecutedName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []CommandRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record CommandRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("bad record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// shellCommand returns a command printing 3 bytes to stdout and 4 to stderr,
+// then exiting with code 3.
+func shellCommand() (string, []string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", []string{"/c", "echo|set /p=out& echo err 1>&2& exit 3"}
+	}
+	return "sh", []string{"-c", "printf out; printf 'err\\n' >&2; exit 3"}
+}
+
+func TestCommandAuditRecordsStartAndEnd(t *testing.T) {
+	dir := t.TempDir()
+	if err := StartCommandAudit(dir); err != nil {
+		t.Fatal(err)
+	}
+	name, args := shellCommand()
+	ExecWithContext(context.Background(), name, args...)
+	ExecWithContext(context.Background(), "cryptkeeper-no-such-command")
+	if err := StopCommandAudit(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readCommandRecords(t, dir)
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want a start and an end per command: %+v", len(records), records)
+	}
+	start, end := records[0], records[1]
+	if start.Event != CommandEventStart || end.Event != CommandEventEnd || start.ID != end.ID || start.ID == 0 {
+		t.Fatalf("records not a start/end pair: %+v, %+v", start, end)
+	}
+	if start.Command != name || start.CommandLine != FormatCommandLine(name, args) || start.ExitCode != nil || start.EndUTC != "" {
+		t.Fatalf("start record = %+v", start)
+	}
+	if end.ExitCode == nil || *end.ExitCode != 3 || end.StdoutBytes != 3 || end.StderrBytes == 0 || end.EndUTC == "" {
+		t.Fatalf("end record = %+v", end)
+	}
+
+	missingStart, missingEnd := records[2], records[3]
+	if missingStart.ID == start.ID || missingStart.ID != missingEnd.ID {
+		t.Fatalf("IDs %d, %d, %d not distinct per command", start.ID, missingStart.ID, missingEnd.ID)
+	}
+	if missingEnd.ExitCode == nil || *missingEnd.ExitCode != -1 || missingEnd.Error == "" {
+		t.Fatalf("command that did not start recorded as %+v", missingEnd)
+	}
+}
+
+func TestCommandAuditDisabled(t *testing.T) {
+	name, args := shellCommand()
+	if id := beginCommand(name, args, time.Now()); id != 0 {
+		t.Fatalf("disabled audit assigned ID %d", id)
+	}
+	if _, _, err := ExecWithContext(context.Background(), name, args...); err == nil {
+		t.Fatal("exit code 3 not reported as an error")
+	}
+	if err := StopCommandAudit(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,57 @@
+package winutil
+
+import (
+	"context"
+	"time"
+
+	"cryptkeeper/internal/coverage"
+)
+
+// CollectSettings are the copy limits and environment of one run. core.Run
+// hands them to every module through the context its Collect receives, so
+// two runs in one process do not share them.
+type CollectSettings struct {
+	MaxFileSizeMB int64              // Per-file cap; zero keeps DefaultMaxFileSizeMB
+	MaxTotalMB    int64              // Per-module cap; zero keeps DefaultMaxTotalMB
+	Budget        *SizeBudget        // Run-wide --max-total-size budget; nil has no limit
+	DryRun        *DryRun            // Projection of a --dry-run; nil copies for real
+	MinFreeSpace  *FreeSpaceGuard    // --min-free-space-mb guard; nil has none
+	Coverage      *coverage.Recorder // Probes for --coverage; nil records none
+	NoHash        bool               // Skip SHA-256 of copies, as for --no-hash
+
+	// The run's clock, host name, and environment variables, read through
+	// Now, Hostname, and Getenv; nil reads the system's
+	Now      func() time.Time
+	Hostname func() (string, error)
+	Getenv   func(string) string
+}
+
+// NewCollectSettings returns the settings for the --max-file-mb,
+// --max-module-mb, and --max-total-size values, in which zero removes a limit
+// and a negative cap keeps the default.
+func NewCollectSettings(fileMB, moduleMB, totalBytes int64) *CollectSettings {
+	return &CollectSettings{
+		MaxFileSizeMB: capMB(fileMB),
+		MaxTotalMB:    capMB(moduleMB),
+		Budget:        NewSizeBudget(totalBytes),
+	}
+}
+
+// collectSettingsKey is the context key of a run's CollectSettings.
+type collectSettingsKey struct{}
+
+// WithCollectSettings returns a context carrying settings to the copy helpers.
+func WithCollectSettings(ctx context.Context, settings *CollectSettings) context.Context {
+	return context.WithValue(ctx, collectSettingsKey{}, settings)
+}
+
+// CollectSettingsFrom returns the settings ctx carries, or the defaults when
+// it carries none, as for a module run outside core.Run.
+func CollectSettingsFrom(ctx context.Context) *CollectSettings {
+	if ctx != nil {
+		if settings, ok := ctx.Value(collectSettingsKey{}).(*CollectSettings); ok && settings != nil {
+			return settings
+		}
+	}
+	return &CollectSettings{}
+}
@@ -0,0 +1,94 @@
+package winutil
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ErrNonInteractive is returned by PromptSecret when nobody can answer a
+// prompt, as when cryptkeeper is pushed through PsExec or an EDR agent.
+var ErrNonInteractive = errors.New("no interactive console to prompt on")
+
+// Session is how the process was started, as far as prompting is concerned.
+type Session struct {
+	Interactive bool
+	Reason      string // Why the session is not interactive
+}
+
+// currentSession is the session probe; replaced when simulating a
+// non-interactive run.
+var currentSession = platformSession
+
+// CurrentSession reports whether an operator is attached to a console. Runs
+// in session 0 (services, PsExec without -i, most EDR live-response
+// consoles), without a console window, or with redirected standard input
+// are not interactive.
+func CurrentSession() Session {
+	return currentSession()
+}
+
+// PromptSecret asks for a secret on the console without echoing it. It fails
+// at once with ErrNonInteractive instead of waiting on input that will never
+// come.
+func PromptSecret(prompt string) (string, error) {
+	if session := CurrentSession(); !session.Interactive {
+		return "", fmt.Errorf("%w: %s", ErrNonInteractive, session.Reason)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := readSecret()
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read from console: %w", err)
+	}
+	return secret, nil
+}
+
+// readLine reads one line from standard input without its line ending.
+func readLine() (string, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// isCharDevice reports whether f is a character device, such as a terminal,
+// rather than a pipe or file.
+func isCharDevice(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ansiEscape matches terminal control sequences: CSI sequences such as
+// colours and cursor movement, OSC sequences such as window titles, and the
+// remaining two-byte escapes.
+var ansiEscape = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[0-~])`)
+
+// ConsoleOutput returns the writer for human-readable output to f. On a
+// terminal that is f itself; otherwise terminal escapes are stripped, so
+// colour that PowerShell or another child process put into an error message
+// does not end up as noise in a log file or an EDR transcript.
+func ConsoleOutput(f *os.File) io.Writer {
+	if IsTerminal(f) {
+		return f
+	}
+	return plainWriter{f}
+}
+
+// plainWriter drops terminal escapes from each write. log.Logger writes an
+// entry in one call, so a sequence is never split across writes.
+type plainWriter struct {
+	w io.Writer
+}
+
+func (p plainWriter) Write(b []byte) (int, error) {
+	if _, err := p.w.Write(ansiEscape.ReplaceAll(b, nil)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
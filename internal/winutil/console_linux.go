@@ -0,0 +1,40 @@
+//go:build linux
+
+package winutil
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// IsTerminal reports whether f is a terminal. /dev/null is a character
+// device too; only a terminal answers TCGETS.
+func IsTerminal(f *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS)
+	return err == nil
+}
+
+func platformSession() Session {
+	if !IsTerminal(os.Stdin) {
+		return Session{Reason: "standard input is not a terminal"}
+	}
+	return Session{Interactive: true}
+}
+
+// readSecret reads a line from the terminal with echo turned off.
+func readSecret() (string, error) {
+	fd := int(os.Stdin.Fd())
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return "", err
+	}
+	quiet := *termios
+	quiet.Lflag &^= unix.ECHO
+	quiet.Lflag |= unix.ICANON | unix.ISIG
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &quiet); err != nil {
+		return "", err
+	}
+	defer unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+	return readLine()
+}
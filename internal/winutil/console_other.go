@@ -0,0 +1,25 @@
+//go:build !windows && !linux
+
+package winutil
+
+import (
+	"errors"
+	"os"
+)
+
+// IsTerminal reports whether f is a terminal, or at least a character device.
+func IsTerminal(f *os.File) bool {
+	return isCharDevice(f)
+}
+
+func platformSession() Session {
+	if !IsTerminal(os.Stdin) {
+		return Session{Reason: "standard input is not a terminal"}
+	}
+	return Session{Interactive: true}
+}
+
+// readSecret is not implemented here; secrets must come from the environment.
+func readSecret() (string, error) {
+	return "", errors.ErrUnsupported
+}
@@ -0,0 +1,74 @@
+package winutil
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPromptSecretFailsWhenNonInteractive(t *testing.T) {
+	saved := currentSession
+	defer func() { currentSession = saved }()
+	currentSession = func() Session {
+		return Session{Reason: "running in session 0, as a service or through remote execution"}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := PromptSecret("Passphrase: ")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrNonInteractive) {
+			t.Fatalf("PromptSecret = %v, want ErrNonInteractive", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("PromptSecret blocked in a non-interactive session")
+	}
+}
+
+func TestIsTerminalRejectsFilesAndPipes(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if IsTerminal(f) {
+		t.Error("a regular file was taken for a terminal")
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if IsTerminal(r) || IsTerminal(w) {
+		t.Error("a pipe was taken for a terminal")
+	}
+}
+
+func TestConsoleOutputStripsEscapesOffTerminal(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	line := "Warning: \x1b[31;1mGet-WinEvent: access denied\x1b[0m \x1b]0;title\x07done\x1b7\n"
+	n, err := ConsoleOutput(f).Write([]byte(line))
+	if err != nil || n != len(line) {
+		t.Fatalf("Write = %d, %v; want %d, nil", n, err, len(line))
+	}
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Warning: Get-WinEvent: access denied done\n"; !bytes.Equal(got, []byte(want)) {
+		t.Fatalf("wrote %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build windows
+
+package winutil
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var procGetConsoleWindow = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetConsoleWindow")
+
+// IsTerminal reports whether f is a console; redirected handles are not.
+func IsTerminal(f *os.File) bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(f.Fd()), &mode) == nil
+}
+
+func platformSession() Session {
+	var sessionID uint32
+	if err := windows.ProcessIdToSessionId(windows.GetCurrentProcessId(), &sessionID); err == nil && sessionID == 0 {
+		return Session{Reason: "running in session 0, as a service or through remote execution"}
+	}
+	if hwnd, _, _ := procGetConsoleWindow.Call(); hwnd == 0 {
+		return Session{Reason: "no console window is attached"}
+	}
+	if !IsTerminal(os.Stdin) {
+		return Session{Reason: "standard input is not a console"}
+	}
+	return Session{Interactive: true}
+}
+
+// readSecret reads a line from the console with echo turned off.
+func readSecret() (string, error) {
+	handle := windows.Handle(os.Stdin.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return "", err
+	}
+	if err := windows.SetConsoleMode(handle, mode&^windows.ENABLE_ECHO_INPUT|windows.ENABLE_LINE_INPUT|windows.ENABLE_PROCESSED_INPUT); err != nil {
+		return "", err
+	}
+	defer windows.SetConsoleMode(handle, mode)
+	return readLine()
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package winutil
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// FixedDrives returns the drive letters, e.g. "C:", of the fixed local volumes.
+// Removable, network, optical, and RAM disks are left out.
+func FixedDrives() ([]string, error) {
+	mask, err := windows.GetLogicalDrives()
+	if err != nil {
+		return nil, err
+	}
+	drives := make([]string, 0)
+	for i := 0; i < 26; i++ {
+		if mask&(1<<uint(i)) == 0 {
+			continue
+		}
+		drive := string(rune('A'+i)) + ":"
+		root, err := windows.UTF16PtrFromString(drive + `\`)
+		if err != nil {
+			continue
+		}
+		if windows.GetDriveType(root) == windows.DRIVE_FIXED {
+			drives = append(drives, drive)
+		}
+	}
+	return drives, nil
+}
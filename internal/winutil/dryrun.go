@@ -0,0 +1,34 @@
+package winutil
+
+import (
+	"sync/atomic"
+)
+
+// DryRun is the projection of a --dry-run: the copy helpers of a run whose
+// settings carry one report the size of each source without creating the
+// destination, and count here what they would have written. It is safe for
+// concurrent use.
+type DryRun struct {
+	files atomic.Int64
+	bytes atomic.Int64
+}
+
+// NewDryRun returns an empty projection.
+func NewDryRun() *DryRun {
+	return &DryRun{}
+}
+
+// Totals returns the number of files and bytes the copies of the dry run
+// would have written.
+func (d *DryRun) Totals() (files, bytes int64) {
+	if d == nil {
+		return 0, 0
+	}
+	return d.files.Load(), d.bytes.Load()
+}
+
+// project records a copy of size bytes that the dry run skipped.
+func (d *DryRun) project(size int64) {
+	d.files.Add(1)
+	d.bytes.Add(size)
+}
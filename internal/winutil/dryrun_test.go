@@ -0,0 +1,86 @@
+package winutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDryRunProjectsCopiesWithoutWriting(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.bin")
+	large := filepath.Join(dir, "large.bin")
+	writeSizedFile(t, small, 1000)
+	writeSizedFile(t, large, 3*bytesPerMB)
+
+	settings := NewCollectSettings(1, 0, 0)
+	settings.DryRun = NewDryRun()
+	ctx := WithCollectSettings(context.Background(), settings)
+
+	if _, _, truncated, err := SmartCopy(small, filepath.Join(dir, "small.out"), NewSizeConstraints(ctx)); err != nil || truncated {
+		t.Fatalf("small copy: truncated %v, err %v", truncated, err)
+	}
+	// Truncated files count at their capped size
+	bytes, _, truncated, err := SmartCopy(large, filepath.Join(dir, "large.out"), NewSizeConstraints(ctx))
+	if err != nil || !truncated || bytes != bytesPerMB {
+		t.Fatalf("large copy: %d bytes, truncated %v, err %v", bytes, truncated, err)
+	}
+	if _, _, err := CopyFileResumable(ctx, small, filepath.Join(dir, "resumed.out")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, projected := settings.DryRun.Totals()
+	if files != 3 || projected != 2000+bytesPerMB {
+		t.Fatalf("projected %d files, %d bytes; want 3 files, %d bytes", files, projected, 2000+bytesPerMB)
+	}
+	for _, name := range []string{"small.out", "large.out", "resumed.out"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("dry run created %s", name)
+		}
+	}
+}
+
+func TestDryRunIsScopedToItsRun(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	writeSizedFile(t, src, 500)
+
+	dry := &CollectSettings{DryRun: NewDryRun()}
+	if _, _, _, err := SmartCopy(src, filepath.Join(dir, "dry.out"), NewSizeConstraints(WithCollectSettings(context.Background(), dry))); err != nil {
+		t.Fatal(err)
+	}
+	// A concurrent real run still copies
+	realOut := filepath.Join(dir, "real.out")
+	if _, _, _, err := SmartCopy(src, realOut, NewSizeConstraints(context.Background())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(realOut); err != nil {
+		t.Fatalf("real run did not copy: %v", err)
+	}
+	if files, _ := dry.DryRun.Totals(); files != 1 {
+		t.Fatalf("dry run projected %d files, want 1", files)
+	}
+	var none *DryRun
+	if files, bytes := none.Totals(); files != 0 || bytes != 0 {
+		t.Fatal("nil projection reports totals")
+	}
+}
+
+func TestDryRunChargesSizeBudget(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	writeSizedFile(t, src, 600)
+
+	settings := &CollectSettings{Budget: NewSizeBudget(1000), DryRun: NewDryRun()}
+	ctx := WithCollectSettings(context.Background(), settings)
+	if _, _, _, err := SmartCopy(src, filepath.Join(dir, "a.out"), NewSizeConstraints(ctx)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := SmartCopy(src, filepath.Join(dir, "b.out"), NewSizeConstraints(ctx)); err == nil {
+		t.Fatal("dry run ignored the size budget")
+	}
+	if !settings.Budget.Exhausted() {
+		t.Fatal("budget not exhausted")
+	}
+}
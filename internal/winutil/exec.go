@@ -0,0 +1,51 @@
+package winutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// ExecWithContext executes a command with context support, returning stdout, stderr, and error.
+// This provides a consistent interface for executing Windows commands with timeout support.
+// Commands always describe the running OS, so they are refused when collecting from an alternate root.
+// Every command that runs is recorded in the --dump-commands audit log, as it
+// starts and when it ends.
+func ExecWithContext(ctx context.Context, name string, args ...string) (stdout, stderr []byte, err error) {
+	if IsOffline() {
+		return nil, nil, ErrRequiresLiveSystem
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+
+	// The start record is written first, so a command that never returns
+	// is still on record
+	start := Now(ctx)
+	id := beginCommand(name, args, start)
+	err = cmd.Run()
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	recordCommand(id, name, args, start, Now(ctx), exitCode, stdoutBuf.Len(), stderrBuf.Len(), err)
+	return stdoutBuf.Bytes(), stderrBuf.Bytes(), err
+}
+
+// RunCommandWithOutput executes a command and returns its output as bytes.
+// This is a simplified wrapper around ExecWithContext for modules that just need stdout.
+func RunCommandWithOutput(ctx context.Context, name string, args []string) ([]byte, error) {
+	stdout, stderr, err := ExecWithContext(ctx, name, args...)
+	if errors.Is(err, ErrRequiresLiveSystem) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("command %s failed: %w (stderr: %s)", name, err, string(stderr))
+	}
+	return stdout, nil
+}
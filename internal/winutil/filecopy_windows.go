@@ -3,7 +3,8 @@
 package winutil
 
 import (
-	"crypto/sha256"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -12,6 +13,8 @@ import (
 	"syscall"
 
 	"golang.org/x/sys/windows"
+
+	"cryptkeeper/internal/progress"
 )
 
 // OpenForCopy opens a file for reading using Windows APIs with generous sharing flags
@@ -42,9 +45,37 @@ func OpenForCopy(path string) (*os.File, error) {
 	return file, nil
 }
 
+// openCopySource opens the source of a checkpointed copy.
+func openCopySource(path string) (*os.File, error) {
+	return OpenForCopy(path)
+}
+
 // CopyFileStreaming performs a streaming copy from an open source file to a destination path,
-// computing SHA-256 hash during the copy. Returns bytes copied and hex-encoded hash.
-func CopyFileStreaming(src *os.File, dstPath string) (bytes int64, sha256Hex string, err error) {
+// computing SHA-256 hash during the copy. Returns bytes copied and hex-encoded hash,
+// which is empty when hashing is disabled. Copied bytes are charged to the
+// size budget of the run whose Collect context is ctx.
+func CopyFileStreaming(ctx context.Context, src *os.File, dstPath string) (bytes int64, sha256Hex string, err error) {
+	settings := CollectSettingsFrom(ctx)
+
+	// Record the copy so an interrupted run can report it
+	done := progress.BeginCopy(src.Name(), dstPath)
+	defer func() { done(err == nil) }()
+
+	// Yield to the system's real workload before starting the next file
+	throttleWait()
+
+	// Respect the free space minimum before writing to the output volume
+	if stat, statErr := src.Stat(); statErr == nil {
+		if err := reserveSpace(settings, dstPath, stat.Size()); err != nil {
+			return 0, "", err
+		}
+		defer func() { settings.Budget.settle(stat.Size(), bytes, err) }()
+		if settings.DryRun != nil {
+			settings.DryRun.project(stat.Size())
+			return stat.Size(), "", nil
+		}
+	}
+
 	// Create destination file
 	dst, err := os.Create(dstPath)
 	if err != nil {
@@ -52,27 +83,39 @@ func CopyFileStreaming(src *os.File, dstPath string) (bytes int64, sha256Hex str
 	}
 	defer dst.Close()
 
-	// Create SHA-256 hasher
-	hasher := sha256.New()
+	// Write to both destination and hasher, or straight to the destination
+	// when hashing is disabled
+	writer, sum := hashingWriter(settings, dst)
 
-	// Create a multi-writer to write to both destination and hasher
-	multiWriter := io.MultiWriter(dst, hasher)
-
-	// Stream copy from source through multi-writer
-	bytes, err = io.Copy(multiWriter, src)
+	// Stream copy from source through the writer
+	bytes, err = io.Copy(writer, src)
 	if err != nil {
 		return 0, "", fmt.Errorf("failed to copy file contents: %w", err)
 	}
 
-	// Get the hex-encoded hash
-	sha256Hex = fmt.Sprintf("%x", hasher.Sum(nil))
-
-	return bytes, sha256Hex, nil
+	return bytes, sum(), nil
 }
 
 // CopyFile is a convenience function that opens a source file and performs streaming copy
-// with hash computation. Returns file size, hash, and any error.
-func CopyFile(srcPath, dstPath string) (size int64, sha256Hex string, err error) {
+// with hash computation. Returns file size, hash, and any error. Files of
+// CheckpointThresholdBytes or more go through CopyFileResumable. A failed copy
+// removes the partial destination and its checkpoint sidecar, so neither is
+// bundled; CopyFileOrShadow keeps the checkpoint for the shadow copy to resume.
+func CopyFile(ctx context.Context, srcPath, dstPath string) (size int64, sha256Hex string, err error) {
+	if IsRunOutput(srcPath) {
+		return 0, "", fmt.Errorf("%w: %s", ErrRunOutput, srcPath)
+	}
+	defer func() {
+		if err != nil {
+			RemovePartialCopy(dstPath)
+		}
+	}()
+
+	// Large files are checkpointed, so a copy failing near the end resumes
+	if stat, err := os.Stat(srcPath); err == nil && stat.Size() >= checkpointThreshold {
+		return CopyFileResumable(ctx, srcPath, dstPath)
+	}
+
 	// Open source file with tolerant sharing
 	srcFile, err := OpenForCopy(srcPath)
 	if err != nil {
@@ -81,7 +124,7 @@ func CopyFile(srcPath, dstPath string) (size int64, sha256Hex string, err error)
 	defer srcFile.Close()
 
 	// Perform streaming copy with hashing
-	size, sha256Hex, err = CopyFileStreaming(srcFile, dstPath)
+	size, sha256Hex, err = CopyFileStreaming(ctx, srcFile, dstPath)
 	if err != nil {
 		return 0, "", fmt.Errorf("failed to copy file: %w", err)
 	}
@@ -89,6 +132,33 @@ func CopyFile(srcPath, dstPath string) (size int64, sha256Hex string, err error)
 	return size, sha256Hex, nil
 }
 
+// CopyFileOrShadow copies a file the system may hold open. When the live file
+// cannot be read to the end, the copy resumes from the newest shadow copy of
+// its volume, after the checkpoint the live attempt left. It returns the
+// source read, "copy" or "shadow_copy". Offline, only the file itself is read.
+// A failed copy leaves nothing behind, as with CopyFile.
+func CopyFileOrShadow(ctx context.Context, srcPath, dstPath string) (size int64, sha256Hex, source string, err error) {
+	if IsOffline() {
+		size, sha256Hex, err = CopyFile(ctx, srcPath, dstPath)
+		return size, sha256Hex, "copy", err
+	}
+
+	size, sha256Hex, err = CopyFileResumable(ctx, srcPath, dstPath)
+	if err == nil || errors.Is(err, ErrRunOutput) {
+		return size, sha256Hex, "copy", err
+	}
+	copyErr := err
+	shadowPath, err := LatestShadowPath(ctx, srcPath)
+	if err == nil {
+		size, sha256Hex, err = CopyFile(ctx, shadowPath, dstPath)
+	}
+	if err != nil {
+		RemovePartialCopy(dstPath)
+		return 0, "", "", fmt.Errorf("%v; shadow copy: %v", copyErr, err)
+	}
+	return size, sha256Hex, "shadow_copy", nil
+}
+
 // EnsureDir creates a directory and all necessary parent directories.
 func EnsureDir(path string) error {
 	return os.MkdirAll(path, 0755)
@@ -0,0 +1,40 @@
+//go:build windows
+
+package winutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFileRemovesAFailedCopy(t *testing.T) {
+	saved := checkpointThreshold
+	checkpointThreshold = 64 * 1024
+	t.Cleanup(func() { checkpointThreshold = saved })
+
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "pagefile.sys"), filepath.Join(dir, "out.sys")
+	data := writeRandomFile(t, src, 512*1024)
+
+	// Every attempt fails past the first checkpoint, which would otherwise
+	// leave the partial copy and its sidecar to be bundled
+	newResumeFixture(t, copyAttempts, 200*1024)
+	if _, _, err := CopyFile(context.Background(), src, dst); !errors.Is(err, errDeviceGone) {
+		t.Fatalf("failing copy = %v", err)
+	}
+	for _, path := range []string{dst, dst + CheckpointSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s left after a failed copy: %v", filepath.Base(path), err)
+		}
+	}
+
+	newResumeFixture(t, 0, 0)
+	size, hash, err := CopyFile(context.Background(), src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCopy(t, dst, data, size, hash)
+}
@@ -0,0 +1,20 @@
+package winutil
+
+import "time"
+
+// filetimeEpochSeconds is the number of seconds from the FILETIME epoch
+// (1601-01-01 UTC) to the Unix epoch.
+const filetimeEpochSeconds = 11644473600
+
+// FiletimeToUTC converts a raw Windows FILETIME (100ns intervals since
+// 1601-01-01 UTC) to a UTC time. FILETIMEs on disk are always UTC, so no zone
+// adjustment is made. Zero, the "never set" marker, yields the zero time;
+// values before the Unix epoch convert normally.
+func FiletimeToUTC(raw uint64) time.Time {
+	if raw == 0 {
+		return time.Time{}
+	}
+	seconds := int64(raw/10000000) - filetimeEpochSeconds
+	nanos := int64(raw%10000000) * 100
+	return time.Unix(seconds, nanos).UTC()
+}
@@ -0,0 +1,55 @@
+package winutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFiletimeToUTC(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  uint64
+		want time.Time
+	}{
+		{"never set", 0, time.Time{}},
+		{"FILETIME epoch plus one tick", 1, time.Date(1601, 1, 1, 0, 0, 0, 100, time.UTC)},
+		{"before the Unix epoch", 116444736000000000 - 10000000, time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{"Unix epoch", 116444736000000000, time.Unix(0, 0).UTC()},
+		{"after the Unix epoch", 116444736000000001, time.Unix(0, 100).UTC()},
+		{"collection time", 133537680000000000, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{"sub-second ticks", 133537680001234567, time.Date(2024, 3, 1, 12, 0, 0, 123456700, time.UTC)},
+	}
+	for _, tt := range tests {
+		got := FiletimeToUTC(tt.raw)
+		if !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("%s: FiletimeToUTC(%d) = %v, want %v", tt.name, tt.raw, got, tt.want)
+		}
+	}
+	if !FiletimeToUTC(0).IsZero() {
+		t.Error("zero FILETIME did not yield the zero time")
+	}
+}
+
+func TestFormatUTCOffset(t *testing.T) {
+	tests := map[int]string{
+		0:    "+00:00",
+		300:  "-05:00", // Eastern Standard Time
+		240:  "-04:00", // Eastern Daylight Time
+		-60:  "+01:00",
+		-330: "+05:30",
+		-345: "+05:45",
+		570:  "-09:30",
+	}
+	for bias, want := range tests {
+		if got := formatUTCOffset(bias); got != want {
+			t.Errorf("formatUTCOffset(%d) = %q, want %q", bias, got, want)
+		}
+	}
+}
+
+func TestCurrentTimezoneRefusesOfflineRoot(t *testing.T) {
+	newFakeRoot(t)
+	if _, err := CurrentTimezone(); err != ErrRequiresLiveSystem {
+		t.Errorf("CurrentTimezone = %v, want %v", err, ErrRequiresLiveSystem)
+	}
+}
@@ -0,0 +1,117 @@
+package winutil
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultMinFreeSpaceMB is the default amount of free space kept on the output volume.
+const DefaultMinFreeSpaceMB = 1024
+
+// LowDiskSpaceStatus is the skip reason recorded when the free space guard stops a copy.
+const LowDiskSpaceStatus = "skipped: low_disk_space"
+
+// LowDiskSpaceError is returned by SmartCopy once copying a file would take the
+// destination volume below the configured minimum free space.
+type LowDiskSpaceError struct {
+	Path        string
+	FreeBytes   uint64
+	NeededBytes uint64
+	MinBytes    uint64
+	skipped     bool // a copy was refused, rather than the startup check failing
+}
+
+func (e *LowDiskSpaceError) Error() string {
+	if !e.skipped {
+		return fmt.Sprintf("%d MB free, minimum %d MB required", e.FreeBytes/(1024*1024), e.MinBytes/(1024*1024))
+	}
+	return fmt.Sprintf("%s (%d MB free, %d MB needed, minimum %d MB)",
+		LowDiskSpaceStatus, e.FreeBytes/(1024*1024), e.NeededBytes/(1024*1024), e.MinBytes/(1024*1024))
+}
+
+// FreeSpaceGuard keeps copies of a run from taking the destination volume
+// below a minimum free space; it is safe for concurrent use. Once tripped it
+// stays tripped, so every later copy in the run is skipped. A nil guard
+// allows every copy.
+type FreeSpaceGuard struct {
+	mu       sync.Mutex
+	minBytes uint64
+	tripped  *LowDiskSpaceError
+}
+
+// freeSpace is the free space probe used by the guard; replaced when simulating low space.
+var freeSpace = FreeSpace
+
+// NewFreeSpaceGuard returns a guard keeping mb megabytes free on the
+// destination volume, or nil, no guard, when mb is zero or less.
+func NewFreeSpaceGuard(mb int64) *FreeSpaceGuard {
+	if mb <= 0 {
+		return nil
+	}
+	return &FreeSpaceGuard{minBytes: uint64(mb) * 1024 * 1024}
+}
+
+// Tripped reports whether the guard has stopped copying during the run.
+func (g *FreeSpaceGuard) Tripped() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.tripped != nil
+}
+
+// CheckFreeSpace returns an error if the volume holding path has less than
+// minMB megabytes available.
+func CheckFreeSpace(path string, minMB int64) error {
+	free, err := freeSpace(path)
+	if err != nil {
+		return fmt.Errorf("failed to query free space for %s: %w", path, err)
+	}
+	minBytes := uint64(minMB) * 1024 * 1024
+	if free < minBytes {
+		return &LowDiskSpaceError{Path: path, FreeBytes: free, MinBytes: minBytes}
+	}
+	return nil
+}
+
+// reserveSpace checks that writing needBytes to dstPath keeps its volume above
+// the free space threshold, then charges them to the run's size budget. The
+// caller settles the reservation with the bytes the copy wrote.
+func reserveSpace(settings *CollectSettings, dstPath string, needBytes int64) error {
+	// A dry run writes nothing, so the free space guard is not consulted
+	if settings.DryRun == nil {
+		if err := settings.MinFreeSpace.reserve(dstPath, needBytes); err != nil {
+			return err
+		}
+	}
+	return settings.Budget.reserve(dstPath, needBytes)
+}
+
+// reserve checks that writing needBytes to dstPath keeps its volume above
+// the threshold. A failed free space query does not block collection.
+func (g *FreeSpaceGuard) reserve(dstPath string, needBytes int64) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.tripped != nil {
+		return &LowDiskSpaceError{Path: dstPath, FreeBytes: g.tripped.FreeBytes, NeededBytes: uint64(needBytes), MinBytes: g.minBytes, skipped: true}
+	}
+
+	free, err := freeSpace(filepath.Dir(dstPath))
+	if err != nil {
+		return nil
+	}
+	if needBytes < 0 {
+		needBytes = 0
+	}
+	if free < g.minBytes || free-g.minBytes < uint64(needBytes) {
+		g.tripped = &LowDiskSpaceError{Path: dstPath, FreeBytes: free, NeededBytes: uint64(needBytes), MinBytes: g.minBytes, skipped: true}
+		return g.tripped
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !windows && !linux && !darwin && !freebsd
+
+package winutil
+
+import (
+	"errors"
+)
+
+// FreeSpace is not supported on this platform.
+func FreeSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
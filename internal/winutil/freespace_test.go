@@ -0,0 +1,115 @@
+package winutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// simulateFreeSpace replaces the free space probe with one reporting *free
+// bytes for one test.
+func simulateFreeSpace(t *testing.T, free *uint64) {
+	t.Helper()
+	saved := freeSpace
+	freeSpace = func(string) (uint64, error) { return *free, nil }
+	t.Cleanup(func() { freeSpace = saved })
+}
+
+func TestSmartCopyStopsAtLowFreeSpace(t *testing.T) {
+	free := uint64(1024+3) * bytesPerMB
+	simulateFreeSpace(t, &free)
+
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	guard := NewFreeSpaceGuard(1024)
+	copyFile := func(name string) error {
+		constraints := NewSizeConstraints(WithCollectSettings(context.Background(), &CollectSettings{MinFreeSpace: guard}))
+		src := filepath.Join(srcDir, name)
+		writeSizedFile(t, src, bytesPerMB)
+		_, _, _, err := SmartCopy(src, filepath.Join(dstDir, name), constraints)
+		if err == nil {
+			free -= bytesPerMB
+		}
+		return err
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err := copyFile(fmt.Sprintf("copied%d.evtx", i)); err != nil {
+			t.Fatalf("copy %d with room to spare: %v", i, err)
+		}
+	}
+	if guard.Tripped() {
+		t.Fatal("guard tripped before the threshold")
+	}
+
+	// The next copy would leave less than the minimum free
+	err := copyFile("refused.evtx")
+	var lowSpace *LowDiskSpaceError
+	if !errors.As(err, &lowSpace) || !strings.HasPrefix(err.Error(), LowDiskSpaceStatus) {
+		t.Fatalf("copy below the threshold = %v, want %s", err, LowDiskSpaceStatus)
+	}
+	if lowSpace.FreeBytes != 1024*bytesPerMB || lowSpace.NeededBytes != bytesPerMB || lowSpace.MinBytes != 1024*bytesPerMB {
+		t.Fatalf("error = %+v", lowSpace)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "refused.evtx")); !os.IsNotExist(err) {
+		t.Fatalf("refused copy created its destination: %v", err)
+	}
+	if !guard.Tripped() {
+		t.Fatal("guard not reported as tripped")
+	}
+
+	// Copying stays stopped for the rest of the run, even if space is freed
+	free = 4096 * bytesPerMB
+	if err := copyFile("after.evtx"); !errors.As(err, &lowSpace) || !strings.HasPrefix(err.Error(), LowDiskSpaceStatus) {
+		t.Fatalf("copy after the guard tripped = %v", err)
+	}
+
+	// A new run starts over
+	guard = NewFreeSpaceGuard(1024)
+	if err := copyFile("next-run.evtx"); err != nil {
+		t.Fatalf("copy in a new run: %v", err)
+	}
+}
+
+func TestDryRunIgnoresFreeSpace(t *testing.T) {
+	free := uint64(0)
+	simulateFreeSpace(t, &free)
+
+	src := filepath.Join(t.TempDir(), "Security.evtx")
+	writeSizedFile(t, src, bytesPerMB)
+	settings := &CollectSettings{DryRun: NewDryRun(), MinFreeSpace: NewFreeSpaceGuard(1024)}
+	constraints := NewSizeConstraints(WithCollectSettings(context.Background(), settings))
+	if _, _, _, err := SmartCopy(src, filepath.Join(t.TempDir(), "Security.evtx"), constraints); err != nil {
+		t.Fatalf("dry run copy = %v", err)
+	}
+	if settings.MinFreeSpace.Tripped() {
+		t.Fatal("dry run tripped the guard")
+	}
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	free := uint64(512) * bytesPerMB
+	simulateFreeSpace(t, &free)
+
+	if err := CheckFreeSpace("C:\\Temp", 256); err != nil {
+		t.Fatalf("512 MB free against a 256 MB minimum: %v", err)
+	}
+	err := CheckFreeSpace("C:\\Temp", 1024)
+	var lowSpace *LowDiskSpaceError
+	if !errors.As(err, &lowSpace) || err.Error() != "512 MB free, minimum 1024 MB required" {
+		t.Fatalf("startup check = %v", err)
+	}
+}
+
+func TestFreeSpaceQueriesTheVolume(t *testing.T) {
+	free, err := FreeSpace(t.TempDir())
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("free space is not supported on this platform")
+	}
+	if err != nil || free == 0 {
+		t.Fatalf("FreeSpace = %d, %v", free, err)
+	}
+}
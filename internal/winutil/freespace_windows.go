@@ -0,0 +1,20 @@
+//go:build windows
+
+package winutil
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// FreeSpace returns the bytes available to the caller on the volume containing path.
+func FreeSpace(path string) (uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &freeBytesAvailable, &totalBytes, &totalFreeBytes); err != nil {
+		return 0, err
+	}
+	return freeBytesAvailable, nil
+}
@@ -0,0 +1,52 @@
+package winutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// newHasher creates the SHA-256 state for a copy; replaced when counting hashers.
+var newHasher = sha256.New
+
+// HashingEnabled reports whether the run whose Collect context is ctx hashes
+// its copies. Hashing is enabled unless the run's settings set NoHash.
+func HashingEnabled(ctx context.Context) bool {
+	return !CollectSettingsFrom(ctx).NoHash
+}
+
+// hashingWriter returns the writer a copy should stream into and a function
+// returning the hex SHA-256 of what was written. With hashing disabled in
+// settings dst is returned as is, so no hasher sees the data, and the hash
+// is "".
+func hashingWriter(settings *CollectSettings, dst io.Writer) (io.Writer, func() string) {
+	if settings.NoHash {
+		return dst, func() string { return "" }
+	}
+	hasher := newHasher()
+	return io.MultiWriter(dst, hasher), func() string { return fmt.Sprintf("%x", hasher.Sum(nil)) }
+}
+
+// HashFile calculates the SHA-256 hash of a file. It returns "" without
+// reading the file when hashing is disabled for the run whose Collect context
+// is ctx.
+func HashFile(ctx context.Context, filePath string) (string, error) {
+	if !HashingEnabled(ctx) {
+		return "", nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	hasher := newHasher()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
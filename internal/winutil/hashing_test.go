@@ -0,0 +1,102 @@
+package winutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// countHashers counts the SHA-256 states created until the test ends.
+func countHashers(t testing.TB) *int {
+	t.Helper()
+	count := new(int)
+	newHasher = func() hash.Hash {
+		*count++
+		return sha256.New()
+	}
+	t.Cleanup(func() { newHasher = sha256.New })
+	return count
+}
+
+// hashingContext returns the Collect context of a run that hashes its copies
+// or not.
+func hashingContext(enabled bool) context.Context {
+	return WithCollectSettings(context.Background(), &CollectSettings{NoHash: !enabled})
+}
+
+func TestNoHashSkipsTheHasher(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "Security.evtx")
+	writeSizedFile(t, src, 3*bytesPerMB)
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	copies := func(t *testing.T, ctx context.Context) []string {
+		t.Helper()
+		_, full, _, err := FullCopy(ctx, src, filepath.Join(t.TempDir(), "full"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, tail, truncated, err := TailCopy(ctx, src, filepath.Join(t.TempDir(), "tail"), bytesPerMB)
+		if err != nil || !truncated {
+			t.Fatalf("TailCopy = %v, truncated %v", err, truncated)
+		}
+		hashed, err := HashFile(ctx, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []string{full, tail, hashed}
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		hashers := countHashers(t)
+		sums := copies(t, hashingContext(true))
+		if *hashers != 3 || sums[0] != want || sums[2] != want || len(sums[1]) != 64 {
+			t.Errorf("%d hashers, sums %q", *hashers, sums)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		ctx := hashingContext(false)
+		hashers := countHashers(t)
+		sums := copies(t, ctx)
+		if *hashers != 0 {
+			t.Errorf("--no-hash created %d hashers", *hashers)
+		}
+		for _, sum := range sums {
+			if sum != "" {
+				t.Errorf("--no-hash returned hash %q", sum)
+			}
+		}
+		if HashingEnabled(ctx) {
+			t.Error("hashing reported enabled")
+		}
+	})
+}
+
+func BenchmarkFullCopy(b *testing.B) {
+	src := filepath.Join(b.TempDir(), "SOFTWARE")
+	writeSizedFile(b, src, 16*bytesPerMB)
+	dst := filepath.Join(b.TempDir(), "SOFTWARE")
+	for _, hashing := range []bool{true, false} {
+		b.Run(fmt.Sprintf("hashing=%v", hashing), func(b *testing.B) {
+			ctx := hashingContext(hashing)
+			hashers := countHashers(b)
+			b.SetBytes(16 * bytesPerMB)
+			for i := 0; i < b.N; i++ {
+				if _, _, _, err := FullCopy(ctx, src, dst); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if !hashing && *hashers != 0 {
+				b.Fatalf("--no-hash created %d hashers", *hashers)
+			}
+		})
+	}
+}
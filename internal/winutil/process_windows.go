@@ -3,29 +3,11 @@
 package winutil
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
 	"fmt"
-	"io"
-	"os"
-	"os/exec"
 	"strings"
 )
 
-// ExecWithContext executes a command with context support, returning stdout, stderr, and error.
-// This provides a consistent interface for executing Windows commands with timeout support.
-func ExecWithContext(ctx context.Context, name string, args ...string) (stdout, stderr []byte, err error) {
-	cmd := exec.CommandContext(ctx, name, args...)
-	
-	var stdoutBuf, stderrBuf bytes.Buffer
-	cmd.Stdout = &stdoutBuf
-	cmd.Stderr = &stderrBuf
-	
-	err = cmd.Run()
-	return stdoutBuf.Bytes(), stderrBuf.Bytes(), err
-}
-
 // ExportEventLog wraps wevtutil.exe to export an event log channel with optional time filtering.
 // This is a specialized version for event log export with proper context handling.
 func ExportEventLog(ctx context.Context, channel string, destPath string, sinceRFC3339 string) error {
@@ -93,29 +75,3 @@ func GetSystemInfo(ctx context.Context) (map[string]string, error) {
 	
 	return info, nil
 }
-
-// RunCommandWithOutput executes a command and returns its output as bytes.
-// This is a simplified wrapper around ExecWithContext for modules that just need stdout.
-func RunCommandWithOutput(ctx context.Context, name string, args []string) ([]byte, error) {
-	stdout, stderr, err := ExecWithContext(ctx, name, args...)
-	if err != nil {
-		return nil, fmt.Errorf("command %s failed: %w (stderr: %s)", name, err, string(stderr))
-	}
-	return stdout, nil
-}
-
-// HashFile calculates the SHA-256 hash of a file.
-func HashFile(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
-	}
-	defer file.Close()
-
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, file); err != nil {
-		return "", fmt.Errorf("failed to hash file: %w", err)
-	}
-
-	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
-}
\ No newline at end of file
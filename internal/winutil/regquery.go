@@ -0,0 +1,95 @@
+// Package winutil provides parsing helpers for reg.exe output.
+package winutil
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// RegValue is a single value line from `reg query` output.
+type RegValue struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+// RegKey is a key header from `reg query` output and the values listed under it.
+type RegKey struct {
+	Path   string     `json:"path"`
+	Values []RegValue `json:"values"`
+}
+
+// Value returns the named value of the key, matched case-insensitively.
+func (k RegKey) Value(name string) (RegValue, bool) {
+	for _, v := range k.Values {
+		if strings.EqualFold(v.Name, name) {
+			return v, true
+		}
+	}
+	return RegValue{}, false
+}
+
+// DWORD returns the named value parsed as an integer (REG_DWORD/REG_QWORD render as 0x-prefixed hex).
+func (k RegKey) DWORD(name string) (uint64, bool) {
+	v, ok := k.Value(name)
+	if !ok {
+		return 0, false
+	}
+	return ParseRegInteger(v.Data)
+}
+
+// ParseRegInteger parses integer data as printed by reg.exe.
+func ParseRegInteger(data string) (uint64, bool) {
+	data = strings.TrimSpace(data)
+	var (
+		n   uint64
+		err error
+	)
+	if strings.HasPrefix(strings.ToLower(data), "0x") {
+		n, err = strconv.ParseUint(data[2:], 16, 64)
+	} else {
+		n, err = strconv.ParseUint(data, 10, 64)
+	}
+	return n, err == nil
+}
+
+// ParseRegQuery parses the text printed by `reg query <key> [/s]`. Key headers
+// start at column zero; value lines are indented and use four spaces to
+// separate name, type, and data. The "(Default)" value keeps that name.
+func ParseRegQuery(output []byte) []RegKey {
+	keys := make([]RegKey, 0)
+	current := -1
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "HK") {
+			keys = append(keys, RegKey{Path: line, Values: make([]RegValue, 0)})
+			current = len(keys) - 1
+			continue
+		}
+
+		if current < 0 || !strings.HasPrefix(line, " ") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimLeft(line, " "), "    ", 3)
+		if len(parts) < 2 || !strings.HasPrefix(parts[1], "REG_") {
+			continue
+		}
+		value := RegValue{Name: parts[0], Type: parts[1]}
+		if len(parts) == 3 {
+			value.Data = parts[2]
+		}
+		keys[current].Values = append(keys[current].Values, value)
+	}
+
+	return keys
+}
@@ -0,0 +1,246 @@
+package winutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"cryptkeeper/internal/progress"
+)
+
+const (
+	// CheckpointThresholdBytes is the source size from which CopyFile records
+	// checkpoints, so a failed copy resumes instead of starting over.
+	CheckpointThresholdBytes = 256 * 1024 * 1024
+
+	// CheckpointSuffix is appended to the destination path to name its sidecar.
+	CheckpointSuffix = ".ckpt"
+
+	// copyAttempts is how often a checkpointed copy is tried before giving up.
+	copyAttempts = 3
+)
+
+// copyRetryDelay is the wait before the first retry; it doubles after each attempt.
+var copyRetryDelay = time.Second
+
+// checkpointInterval is how many bytes are copied between checkpoints.
+var checkpointInterval int64 = 64 * 1024 * 1024
+
+// checkpointThreshold is the source size from which CopyFile checkpoints;
+// replaced in tests.
+var checkpointThreshold int64 = CheckpointThresholdBytes
+
+// copySourceReader wraps the source of a checkpointed copy once it is
+// positioned; replaced to fail copies mid-stream.
+var copySourceReader = func(src io.Reader) io.Reader { return src }
+
+// copyCheckpoint is the content of a .ckpt sidecar: how much of the source
+// the destination already holds, and the hash that proves it.
+type copyCheckpoint struct {
+	Source         string `json:"source"`
+	SourceSize     int64  `json:"source_size"`
+	SourceModified string `json:"source_modified"` // RFC3339Nano, compared exactly
+	Bytes          int64  `json:"bytes"`
+	PrefixSHA256   string `json:"prefix_sha256"` // SHA-256 of the first Bytes bytes
+	UpdatedUTC     string `json:"updated_utc"`
+}
+
+// matches reports whether a checkpoint was made against a source of this
+// size and modification time. The path is not compared, so a copy that
+// failed on the live file can resume from a shadow copy of the same file.
+func (c *copyCheckpoint) matches(stat os.FileInfo) bool {
+	return c.SourceSize == stat.Size() &&
+		c.SourceModified == stat.ModTime().UTC().Format(time.RFC3339Nano) &&
+		c.Bytes > 0 && c.Bytes <= stat.Size()
+}
+
+// CopyFileResumable copies a file, recording a checkpoint in a .ckpt sidecar
+// after every checkpointInterval bytes. A copy that fails mid-stream is
+// retried, resuming after the last checkpoint once the destination prefix
+// still hashes to the recorded value; a checkpoint left by an earlier call
+// is resumed the same way. The sidecar is removed when the copy completes,
+// and kept when it fails so a later call, e.g. on a shadow copy of the same
+// file, can resume; RemovePartialCopy discards both. The prefix is always
+// hashed, as the checkpoint needs it, but the returned hash is "" when
+// hashing is disabled. Copied bytes are charged to the size budget of the
+// run whose Collect context is ctx.
+func CopyFileResumable(ctx context.Context, srcPath, dstPath string) (size int64, sha256Hex string, err error) {
+	if IsRunOutput(srcPath) {
+		return 0, "", fmt.Errorf("%w: %s", ErrRunOutput, srcPath)
+	}
+	settings := CollectSettingsFrom(ctx)
+	if settings.DryRun != nil {
+		stat, err := os.Stat(srcPath)
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to stat source file: %w", err)
+		}
+		if err := settings.Budget.reserve(dstPath, stat.Size()); err != nil {
+			return 0, "", err
+		}
+		settings.DryRun.project(stat.Size())
+		return stat.Size(), "", nil
+	}
+	delay := copyRetryDelay
+	for attempt := 1; ; attempt++ {
+		size, sha256Hex, err = copyWithCheckpoints(settings, srcPath, dstPath)
+		var retry *retryableCopyError
+		if err == nil || !errors.As(err, &retry) || attempt == copyAttempts {
+			if retry != nil {
+				err = retry.err
+			}
+			return size, sha256Hex, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// RemovePartialCopy removes a failed copy's destination and checkpoint sidecar.
+func RemovePartialCopy(dstPath string) {
+	os.Remove(dstPath)
+	os.Remove(dstPath + CheckpointSuffix)
+}
+
+// retryableCopyError marks a failure after the copy started, which a later
+// attempt may get past; failures to open or stat the source are final.
+type retryableCopyError struct{ err error }
+
+func (e *retryableCopyError) Error() string { return e.err.Error() }
+func (e *retryableCopyError) Unwrap() error { return e.err }
+
+// copyWithCheckpoints makes one attempt at a checkpointed copy. What it
+// reserves from the size budget is released again when the attempt fails, so
+// a retry does not charge the same bytes twice, and a resumed attempt charges
+// the whole file, including the prefix an earlier attempt copied.
+func copyWithCheckpoints(settings *CollectSettings, srcPath, dstPath string) (size int64, sha256Hex string, err error) {
+	src, err := openCopySource(srcPath)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	done := progress.BeginCopy(srcPath, dstPath)
+	defer func() { done(err == nil) }()
+	throttleWait()
+
+	hasher := sha256.New()
+	offset := resumeOffset(dstPath, stat, hasher)
+	// Only the rest of the file needs free space, but the whole of it ends up
+	// in the collection and is charged to the budget
+	if err := settings.MinFreeSpace.reserve(dstPath, stat.Size()-offset); err != nil {
+		return 0, "", err
+	}
+	reserved := stat.Size()
+	if err := settings.Budget.reserve(dstPath, reserved); err != nil {
+		return 0, "", err
+	}
+	defer func() { settings.Budget.settle(reserved, size, err) }()
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create destination file %s: %w", dstPath, err)
+	}
+	defer dst.Close()
+	if err := dst.Truncate(offset); err != nil {
+		return 0, "", fmt.Errorf("failed to truncate destination file: %w", err)
+	}
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		return 0, "", fmt.Errorf("failed to seek destination file: %w", err)
+	}
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return 0, "", &retryableCopyError{fmt.Errorf("failed to seek source file: %w", err)}
+	}
+
+	checkpoint := copyCheckpoint{
+		Source:         srcPath,
+		SourceSize:     stat.Size(),
+		SourceModified: stat.ModTime().UTC().Format(time.RFC3339Nano),
+	}
+	reader := copySourceReader(src)
+	writer := io.MultiWriter(dst, hasher)
+	copied := offset
+	for {
+		n, err := io.CopyN(writer, reader, checkpointInterval)
+		copied += n
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, "", &retryableCopyError{fmt.Errorf("failed to copy file contents at offset %d: %w", copied, err)}
+		}
+		// The recorded prefix must be on disk before the checkpoint claims it
+		if err := dst.Sync(); err != nil {
+			return 0, "", &retryableCopyError{fmt.Errorf("failed to flush destination file: %w", err)}
+		}
+		checkpoint.Bytes = copied
+		checkpoint.PrefixSHA256 = fmt.Sprintf("%x", hasher.Sum(nil))
+		checkpoint.UpdatedUTC = FormatTime(settings.now())
+		if err := writeCheckpoint(dstPath, &checkpoint); err != nil {
+			return 0, "", &retryableCopyError{err}
+		}
+	}
+
+	os.Remove(dstPath + CheckpointSuffix)
+	if settings.NoHash {
+		return copied, "", nil
+	}
+	return copied, fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// resumeOffset returns how many bytes of an earlier copy can be kept, after
+// feeding them to hasher, or 0 when there is no checkpoint for this source
+// or the destination no longer matches it.
+func resumeOffset(dstPath string, stat os.FileInfo, hasher hash.Hash) int64 {
+	data, err := os.ReadFile(dstPath + CheckpointSuffix)
+	if err != nil {
+		return 0
+	}
+	var checkpoint copyCheckpoint
+	if json.Unmarshal(data, &checkpoint) != nil || !checkpoint.matches(stat) {
+		return 0
+	}
+	dst, err := os.Open(dstPath)
+	if err != nil {
+		return 0
+	}
+	defer dst.Close()
+
+	if n, err := io.CopyN(hasher, dst, checkpoint.Bytes); err != nil || n != checkpoint.Bytes {
+		hasher.Reset()
+		return 0
+	}
+	if fmt.Sprintf("%x", hasher.Sum(nil)) != checkpoint.PrefixSHA256 {
+		hasher.Reset()
+		return 0
+	}
+	// Sum leaves the hasher's state alone, so hashing continues after the prefix
+	return checkpoint.Bytes
+}
+
+// writeCheckpoint replaces the sidecar atomically, so a crash mid-write
+// leaves the previous checkpoint intact.
+func writeCheckpoint(dstPath string, checkpoint *copyCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	tmp := dstPath + CheckpointSuffix + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, dstPath+CheckpointSuffix); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
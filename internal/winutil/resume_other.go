@@ -0,0 +1,10 @@
+//go:build !windows
+
+package winutil
+
+import "os"
+
+// openCopySource opens the source of a checkpointed copy.
+func openCopySource(path string) (*os.File, error) {
+	return os.Open(path)
+}
@@ -0,0 +1,261 @@
+package winutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// errDeviceGone stands in for a read failing partway through a large copy,
+// such as a shadow copy being removed underneath it.
+var errDeviceGone = errors.New("the device is not ready")
+
+// failingReader fails once the copy has read failAt bytes of the source.
+type failingReader struct {
+	r      io.Reader
+	read   int64
+	failAt int64
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	left := f.failAt - f.read
+	if left <= 0 {
+		return 0, errDeviceGone
+	}
+	if int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := f.r.Read(p)
+	f.read += int64(n)
+	return n, err
+}
+
+// resumeFixture shrinks checkpoints to 64KB and makes the source of each of
+// the first failures copy attempts fail after failAt bytes.
+type resumeFixture struct {
+	failures int
+	failAt   int64
+	readers  []*failingReader
+}
+
+func newResumeFixture(t *testing.T, failures int, failAt int64) *resumeFixture {
+	t.Helper()
+	f := &resumeFixture{failures: failures, failAt: failAt}
+	savedInterval, savedDelay := checkpointInterval, copyRetryDelay
+	checkpointInterval, copyRetryDelay = 64*1024, 0
+	copySourceReader = func(src io.Reader) io.Reader {
+		reader := &failingReader{r: src, failAt: 1 << 62}
+		if len(f.readers) < f.failures {
+			reader.failAt = f.failAt
+		}
+		f.readers = append(f.readers, reader)
+		return reader
+	}
+	t.Cleanup(func() {
+		checkpointInterval, copyRetryDelay = savedInterval, savedDelay
+		copySourceReader = func(src io.Reader) io.Reader { return src }
+	})
+	return f
+}
+
+// reads returns how many source bytes each attempt so far read.
+func (f *resumeFixture) reads() []int64 {
+	reads := make([]int64, len(f.readers))
+	for i, r := range f.readers {
+		reads[i] = r.read
+	}
+	return reads
+}
+
+// writeRandomFile writes size bytes of reproducible random content.
+func writeRandomFile(t *testing.T, path string, size int) []byte {
+	t.Helper()
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func sha256Of(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readCheckpoint returns the sidecar of dstPath.
+func readCheckpoint(t *testing.T, dstPath string) copyCheckpoint {
+	t.Helper()
+	data, err := os.ReadFile(dstPath + CheckpointSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checkpoint copyCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	return checkpoint
+}
+
+// checkCopy fails the test unless dstPath holds data and hash is its SHA-256.
+func checkCopy(t *testing.T, dstPath string, data []byte, size int64, hash string) {
+	t.Helper()
+	copied, err := os.ReadFile(dstPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(copied, data) || size != int64(len(data)) || hash != sha256Of(data) {
+		t.Fatalf("copy of %d bytes: read back %d bytes, size %d, hash %s", len(data), len(copied), size, hash)
+	}
+	if _, err := os.Stat(dstPath + CheckpointSuffix); !os.IsNotExist(err) {
+		t.Errorf("checkpoint left after a completed copy: %v", err)
+	}
+}
+
+func TestResumableCopyRetriesFromTheLastCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "pagefile.sys"), filepath.Join(dir, "out", "pagefile.sys")
+	if err := os.Mkdir(filepath.Dir(dst), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := writeRandomFile(t, src, 1<<20+1234)
+	fixture := newResumeFixture(t, 1, 300*1024)
+
+	settings := &CollectSettings{Budget: NewSizeBudget(8 << 20)}
+	size, hash, err := CopyFileResumable(WithCollectSettings(context.Background(), settings), src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCopy(t, dst, data, size, hash)
+	// The retry starts from the checkpoint at 256KB, not from the start
+	if want := []int64{300 * 1024, int64(len(data)) - 256*1024}; !reflect.DeepEqual(fixture.reads(), want) {
+		t.Fatalf("attempts read %v, want %v", fixture.reads(), want)
+	}
+	// The prefix kept from the failed attempt is charged like the rest
+	if used := settings.Budget.Used(); used != int64(len(data)) {
+		t.Fatalf("budget used = %d, want %d", used, len(data))
+	}
+}
+
+func TestResumableCopyResumesAfterAFailedCall(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "ext4.vhdx"), filepath.Join(dir, "ext4.vhdx.copy")
+	data := writeRandomFile(t, src, 1<<20+1234)
+	fixture := newResumeFixture(t, copyAttempts, 200*1024)
+
+	// Every attempt gets further, from the checkpoint the one before it left
+	settings := &CollectSettings{Budget: NewSizeBudget(8 << 20)}
+	ctx := WithCollectSettings(context.Background(), settings)
+	if _, _, err := CopyFileResumable(ctx, src, dst); !errors.Is(err, errDeviceGone) {
+		t.Fatalf("failing copy = %v", err)
+	}
+	if want := []int64{200 * 1024, 200 * 1024, 200 * 1024}; !reflect.DeepEqual(fixture.reads(), want) {
+		t.Fatalf("attempts read %v, want %v", fixture.reads(), want)
+	}
+	checkpoint := readCheckpoint(t, dst)
+	if checkpoint.Bytes != 576*1024 || checkpoint.PrefixSHA256 != sha256Of(data[:576*1024]) || checkpoint.SourceSize != int64(len(data)) || checkpoint.Source != src {
+		t.Fatalf("checkpoint = %+v", checkpoint)
+	}
+	if used := settings.Budget.Used(); used != 0 {
+		t.Fatalf("failed copy left %d bytes charged", used)
+	}
+
+	// A later call, e.g. on a shadow copy of the same file, picks it up
+	size, hash, err := CopyFileResumable(ctx, src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCopy(t, dst, data, size, hash)
+	if reads := fixture.reads(); reads[len(reads)-1] != int64(len(data))-576*1024 {
+		t.Fatalf("resumed call read %d bytes", reads[len(reads)-1])
+	}
+	if used := settings.Budget.Used(); used != int64(len(data)) {
+		t.Fatalf("budget used = %d, want %d", used, len(data))
+	}
+}
+
+func TestResumableCopyRestartsWhenThePrefixNoLongerMatches(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "$MFT"), filepath.Join(dir, "MFT.bin")
+	data := writeRandomFile(t, src, 512*1024)
+
+	interrupt := func() {
+		t.Helper()
+		newResumeFixture(t, copyAttempts, 100*1024)
+		if _, _, err := CopyFileResumable(context.Background(), src, dst); !errors.Is(err, errDeviceGone) {
+			t.Fatalf("failing copy = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func()
+	}{
+		{"destination edited", func() {
+			file, err := os.OpenFile(dst, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			if _, err := file.WriteAt([]byte{^data[10]}, 10); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"destination truncated", func() {
+			if err := os.Truncate(dst, 1000); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"source modified", func() {
+			if err := os.Chtimes(src, time.Now(), time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"checkpoint damaged", func() {
+			if err := os.WriteFile(dst+CheckpointSuffix, []byte(`{"bytes":`), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		interrupt()
+		tt.change()
+		fixture := newResumeFixture(t, 0, 0)
+		size, hash, err := CopyFileResumable(context.Background(), src, dst)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		checkCopy(t, dst, data, size, hash)
+		if reads := fixture.reads(); !reflect.DeepEqual(reads, []int64{int64(len(data))}) {
+			t.Fatalf("%s: copy read %v, want the whole file", tt.name, reads)
+		}
+	}
+}
+
+func TestResumableCopyWithoutHashing(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "hiberfil.sys"), filepath.Join(dir, "hiberfil.copy")
+	data := writeRandomFile(t, src, 300*1024)
+	newResumeFixture(t, 1, 100*1024)
+
+	// The prefix is still hashed to resume, but no hash is reported
+	ctx := WithCollectSettings(context.Background(), &CollectSettings{NoHash: true})
+	size, hash, err := CopyFileResumable(ctx, src, dst)
+	if err != nil || hash != "" || size != int64(len(data)) {
+		t.Fatalf("copy = %d, %q, %v", size, hash, err)
+	}
+	copied, err := os.ReadFile(dst)
+	if err != nil || !bytes.Equal(copied, data) {
+		t.Fatalf("copy differs from the source: %v", err)
+	}
+}
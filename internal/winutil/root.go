@@ -0,0 +1,79 @@
+package winutil
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// ErrRequiresLiveSystem is returned by command helpers when collecting from an
+// alternate root, where querying the running OS would report the wrong system.
+var ErrRequiresLiveSystem = errors.New("skipped: requires_live_system")
+
+// systemGetenv reads the variables naming the live system's directories;
+// replaced in tests so the examiner's environment does not leak into them.
+var systemGetenv = os.Getenv
+
+// offlineRoot is the mounted image or alternate root set by --root; empty means the live system.
+var offlineRoot string
+
+// SetOfflineRoot directs path lookups at a mounted image or alternate root
+// (e.g. "E:\" for an E01 mounted as a drive). An empty root restores the live system.
+func SetOfflineRoot(root string) {
+	root = strings.TrimRight(root, `\/`)
+	offlineRoot = root
+}
+
+// OfflineRoot returns the alternate root, or "" when collecting from the live system.
+func OfflineRoot() string {
+	return offlineRoot
+}
+
+// IsOffline reports whether collection targets an alternate root rather than the live system.
+func IsOffline() bool {
+	return offlineRoot != ""
+}
+
+// SystemDrive returns the drive (or root directory) holding the Windows
+// installation, or its shadow copy device under --use-snapshot.
+func SystemDrive() string {
+	return SnapshotPath(LiveSystemDrive())
+}
+
+// LiveSystemDrive returns the drive letter of the Windows installation even
+// when a snapshot is in use, for commands such as fsutil that take a volume
+// rather than read files.
+func LiveSystemDrive() string {
+	if offlineRoot != "" {
+		return offlineRoot
+	}
+	if systemDrive := systemGetenv("SystemDrive"); systemDrive != "" {
+		return systemDrive
+	}
+	return "C:"
+}
+
+// SystemRoot returns the Windows directory of the collection target.
+func SystemRoot() string {
+	if offlineRoot == "" {
+		if systemRoot := systemGetenv("SystemRoot"); systemRoot != "" {
+			return SnapshotPath(systemRoot)
+		}
+	}
+	return SystemDrive() + "\\Windows"
+}
+
+// ProgramData returns the ProgramData directory of the collection target.
+func ProgramData() string {
+	if offlineRoot == "" {
+		if programData := systemGetenv("ProgramData"); programData != "" {
+			return SnapshotPath(programData)
+		}
+	}
+	return SystemDrive() + "\\ProgramData"
+}
+
+// UsersDir returns the directory holding user profiles on the collection target.
+func UsersDir() string {
+	return SystemDrive() + "\\Users"
+}
@@ -0,0 +1,81 @@
+package winutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newFakeRoot writes a minimal Windows tree, as found on a mounted image, and
+// directs lookups at it for one test.
+func newFakeRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, name := range []string{
+		"Windows/Prefetch/CMD.EXE-4A81B364.pf",
+		"Windows/System32/config/SYSTEM",
+		"ProgramData/Microsoft/Windows/Start Menu/Programs/StartUp/updater.lnk",
+		"Users/alice/NTUSER.DAT",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The examiner's own environment must not leak into the lookups
+	systemGetenv = func(key string) string {
+		return map[string]string{"SystemDrive": "C:", "SystemRoot": `C:\WINDOWS`, "ProgramData": `C:\ProgramData`}[key]
+	}
+	SetOfflineRoot(root + string(filepath.Separator))
+	t.Cleanup(func() {
+		SetOfflineRoot("")
+		systemGetenv = os.Getenv
+	})
+	return root
+}
+
+func TestOfflineRootResolvesSystemPaths(t *testing.T) {
+	root := newFakeRoot(t)
+	if !IsOffline() || OfflineRoot() != root {
+		t.Fatalf("offline root = %q, want %q", OfflineRoot(), root)
+	}
+	tests := []struct {
+		name      string
+		got, want string
+	}{
+		{"SystemDrive", SystemDrive(), root},
+		{"LiveSystemDrive", LiveSystemDrive(), root},
+		{"SystemRoot", SystemRoot(), root + `\Windows`},
+		{"ProgramData", ProgramData(), root + `\ProgramData`},
+		{"UsersDir", UsersDir(), root + `\Users`},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+
+	SetOfflineRoot("")
+	if SystemRoot() != `C:\WINDOWS` || UsersDir() != `C:\Users` || IsOffline() {
+		t.Errorf("live lookups = %q, %q", SystemRoot(), UsersDir())
+	}
+}
+
+func TestOfflineRootRefusesLiveQueries(t *testing.T) {
+	newFakeRoot(t)
+	if _, _, err := ExecWithContext(context.Background(), "hostname"); !errors.Is(err, ErrRequiresLiveSystem) {
+		t.Errorf("ExecWithContext = %v, want %v", err, ErrRequiresLiveSystem)
+	}
+	if _, err := RunCommandWithOutput(context.Background(), "reg", []string{"save", `HKLM\SYSTEM`, "SYSTEM"}); !errors.Is(err, ErrRequiresLiveSystem) {
+		t.Errorf("RunCommandWithOutput = %v, want %v", err, ErrRequiresLiveSystem)
+	}
+	if ErrRequiresLiveSystem.Error() != "skipped: requires_live_system" {
+		t.Errorf("status = %q", ErrRequiresLiveSystem)
+	}
+}
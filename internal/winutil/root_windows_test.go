@@ -0,0 +1,23 @@
+//go:build windows
+
+package winutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOfflineRootReadsTheFakeTree(t *testing.T) {
+	newFakeRoot(t)
+	for _, path := range []string{
+		filepath.Join(SystemRoot(), "Prefetch", "CMD.EXE-4A81B364.pf"),
+		filepath.Join(SystemRoot(), "System32", "config", "SYSTEM"),
+		filepath.Join(ProgramData(), "Microsoft", "Windows", "Start Menu", "Programs", "StartUp", "updater.lnk"),
+		filepath.Join(UsersDir(), "alice", "NTUSER.DAT"),
+	} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("lookup under the fake root: %v", err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package winutil
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrRunOutput is returned when a module would copy the run's own output,
+// which would put the collection, or its archive, inside itself.
+var ErrRunOutput = errors.New("refusing to collect cryptkeeper's own output")
+
+// runOutput holds the locations set by SetRunOutput.
+var runOutput struct {
+	mu           sync.RWMutex
+	artifactsDir string
+	outDir       string
+}
+
+// SetRunOutput records the run's artifacts directory and the directory its
+// archive is written to. From then on StreamWalk does not enter the
+// artifacts directory or report archives in the output directory, unless
+// the walk starts inside the artifacts directory, and SmartCopy, CopyFile,
+// and CopyFileResumable refuse them as sources. Other files in the output directory are still
+// collected. Empty arguments clear the exclusion.
+func SetRunOutput(artifactsDir, outDir string) {
+	runOutput.mu.Lock()
+	defer runOutput.mu.Unlock()
+	runOutput.artifactsDir = cleanOutputPath(artifactsDir)
+	runOutput.outDir = cleanOutputPath(outDir)
+}
+
+// IsRunOutput reports whether path is inside the artifacts directory, or is
+// a collection archive in the output directory.
+func IsRunOutput(path string) bool {
+	runOutput.mu.RLock()
+	defer runOutput.mu.RUnlock()
+	if runOutput.artifactsDir == "" && runOutput.outDir == "" {
+		return false
+	}
+	path = cleanOutputPath(path)
+	if runOutput.artifactsDir != "" && PathWithin(path, runOutput.artifactsDir) {
+		return true
+	}
+	return runOutput.outDir != "" && IsCollectionArchive(filepath.Base(path)) &&
+		strings.EqualFold(filepath.Dir(path), runOutput.outDir)
+}
+
+// IsCollectionArchive reports whether a file name is that of an archive
+// written by BundleAndMaybeEncrypt, e.g. cryptkeeper_HOST_20240101T000000Z.tar.gz
+// or .tar.zst, either optionally followed by .age, or one volume of such an
+// archive split with --split-size (.001, .002, ...).
+func IsCollectionArchive(name string) bool {
+	name = strings.ToLower(name)
+	if ext := filepath.Ext(name); len(ext) == 4 && strings.Trim(ext[1:], "0123456789") == "" {
+		name = strings.TrimSuffix(name, ext)
+	}
+	name = strings.TrimSuffix(name, ".age")
+	return strings.HasPrefix(name, "cryptkeeper_") &&
+		(strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tar.zst"))
+}
+
+// PathWithin reports whether path is dir or below it. Both should be
+// absolute; letter case is ignored, as on NTFS.
+func PathWithin(path, dir string) bool {
+	rel, err := filepath.Rel(strings.ToLower(filepath.Clean(dir)), strings.ToLower(filepath.Clean(path)))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// cleanOutputPath returns an absolute, cleaned form of path, or "".
+func cleanOutputPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
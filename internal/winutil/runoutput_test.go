@@ -0,0 +1,132 @@
+package winutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeRunTree lays out a temp directory as a run leaves it with --out
+// pointing at the directory holding its artifacts directory: the artifacts,
+// the archive and a volume of a split one next to them, and unrelated files
+// a module walking the temp directory should collect.
+func writeRunTree(t *testing.T) (tempDir, artifactsDir string) {
+	t.Helper()
+	tempDir = t.TempDir()
+	artifactsDir = filepath.Join(tempDir, "cryptkeeper_20240301T120000Z_9f2c")
+	for _, name := range []string{
+		"cryptkeeper_20240301T120000Z_9f2c/windows_prefetch/CMD.EXE-4A81B364.pf",
+		"cryptkeeper_20240301T120000Z_9f2c/collection_manifest.json",
+		"cryptkeeper_WS-0142_20240301T120000Z.tar.gz",
+		"cryptkeeper_WS-0142_20240301T120000Z.tar.zst.age.001",
+		"dropper.ps1",
+		"cryptkeeper_notes.txt",
+		"installer/setup.log",
+	} {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeSizedFile(t, path, 16)
+	}
+	SetRunOutput(artifactsDir, tempDir)
+	t.Cleanup(func() { SetRunOutput("", "") })
+	return tempDir, artifactsDir
+}
+
+func TestStreamWalkPassesOverTheRunOutput(t *testing.T) {
+	tempDir, artifactsDir := writeRunTree(t)
+
+	// A module walking the temp directory sees neither the collection nor
+	// its archive
+	got := walkPaths(t, tempDir, nil)
+	want := []string{".", "cryptkeeper_notes.txt", "dropper.ps1", "installer", "installer/setup.log"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("walk of the temp directory visited %v, want %v", got, want)
+	}
+
+	// Building the manifest and the bundle walks the artifacts directory itself
+	got = walkPaths(t, artifactsDir, nil)
+	want = []string{".", "collection_manifest.json", "windows_prefetch", "windows_prefetch/CMD.EXE-4A81B364.pf"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("walk of the artifacts directory visited %v, want %v", got, want)
+	}
+
+	// Without a recorded run nothing is left out
+	SetRunOutput("", "")
+	if got := walkPaths(t, tempDir, nil); len(got) != 11 {
+		t.Fatalf("walk without a run visited %v", got)
+	}
+}
+
+func TestCopiesRefuseTheRunOutput(t *testing.T) {
+	tempDir, artifactsDir := writeRunTree(t)
+	dst := t.TempDir()
+	ctx := context.Background()
+	constraints := NewSizeConstraints(ctx)
+
+	for _, src := range []string{
+		filepath.Join(tempDir, "cryptkeeper_WS-0142_20240301T120000Z.tar.gz"),
+		filepath.Join(tempDir, "cryptkeeper_WS-0142_20240301T120000Z.tar.zst.age.001"),
+		filepath.Join(artifactsDir, "windows_prefetch", "CMD.EXE-4A81B364.pf"),
+	} {
+		if _, _, _, err := SmartCopy(src, filepath.Join(dst, "out"), constraints); !errors.Is(err, ErrRunOutput) {
+			t.Errorf("SmartCopy(%s) = %v", src, err)
+		}
+		if _, _, err := CopyFileResumable(ctx, src, filepath.Join(dst, "out")); !errors.Is(err, ErrRunOutput) {
+			t.Errorf("CopyFileResumable(%s) = %v", src, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "out")); !os.IsNotExist(err) {
+		t.Errorf("refused copy wrote its destination: %v", err)
+	}
+
+	// Other files in the output directory are collected as usual
+	if size, _, _, err := SmartCopy(filepath.Join(tempDir, "dropper.ps1"), filepath.Join(dst, "dropper.ps1"), constraints); err != nil || size != 16 {
+		t.Fatalf("copy of an unrelated file = %d, %v", size, err)
+	}
+}
+
+func TestIsCollectionArchive(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want bool
+	}{
+		{"cryptkeeper_WS-0142_20240301T120000Z.tar.gz", true},
+		{"cryptkeeper_WS-0142_20240301T120000Z.tar.zst", true},
+		{"CRYPTKEEPER_WS-0142_20240301T120000Z.TAR.GZ.AGE", true},
+		{"cryptkeeper_WS-0142_20240301T120000Z.tar.zst.age.012", true},
+		{"cryptkeeper_WS-0142_20240301T120000Z.tar.gz.sig", false},
+		{"cryptkeeper_WS-0142_20240301T120000Z.tar.gz.part", false},
+		{"cryptkeeper_notes.txt", false},
+		{"backup_20240301.tar.gz", false},
+	} {
+		if got := IsCollectionArchive(tt.name); got != tt.want {
+			t.Errorf("IsCollectionArchive(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPathWithin(t *testing.T) {
+	dir := filepath.Join(string(filepath.Separator)+"tmp", "cryptkeeper_run")
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		{dir, true},
+		{dir + string(filepath.Separator), true},
+		{filepath.Join(dir, "windows_prefetch", "A.pf"), true},
+		{filepath.Join(filepath.Dir(dir), "CRYPTKEEPER_RUN", "x"), true},
+		{filepath.Join(dir, "..", "cryptkeeper_run", "x"), true},
+		{dir + "_2", false},
+		{filepath.Dir(dir), false},
+		{filepath.Join(dir, "..", "other"), false},
+	} {
+		if got := PathWithin(tt.path, dir); got != tt.want {
+			t.Errorf("PathWithin(%q, %q) = %v, want %v", tt.path, dir, got, tt.want)
+		}
+	}
+}
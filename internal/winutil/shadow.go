@@ -0,0 +1,34 @@
+package winutil
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// ParseShadowVolumes returns the shadow copy device paths listed by
+// `vssadmin list shadows`, oldest first, e.g.
+// \\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy3.
+func ParseShadowVolumes(output []byte) []string {
+	var volumes []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "Shadow Copy Volume:") {
+			continue
+		}
+		if volume := strings.TrimSpace(strings.TrimPrefix(line, "Shadow Copy Volume:")); volume != "" {
+			volumes = append(volumes, volume)
+		}
+	}
+	return volumes
+}
+
+// ShadowPath maps a drive-letter path onto a shadow copy device path.
+// It returns "" for paths without a drive letter.
+func ShadowPath(volume, path string) string {
+	if len(path) < 3 || path[1] != ':' || path[2] != '\\' {
+		return ""
+	}
+	return strings.TrimRight(volume, `\`) + path[2:]
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package winutil
+
+import (
+	"context"
+	"fmt"
+)
+
+// LatestShadowPath maps a drive-letter path onto the newest existing shadow
+// copy of its volume. Shadow copies are only listed, never created.
+func LatestShadowPath(ctx context.Context, path string) (string, error) {
+	if len(path) < 2 || path[1] != ':' {
+		return "", fmt.Errorf("path %s has no drive letter", path)
+	}
+	output, err := RunCommandWithOutput(ctx, "vssadmin", []string{"list", "shadows", "/for=" + path[:2]})
+	if err != nil {
+		return "", fmt.Errorf("failed to list shadow copies: %w", err)
+	}
+	volumes := ParseShadowVolumes(output)
+	if len(volumes) == 0 {
+		return "", fmt.Errorf("no shadow copies of %s", path[:2])
+	}
+	return ShadowPath(volumes[len(volumes)-1], path), nil
+}
@@ -0,0 +1,41 @@
+package winutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrBeforeSince is returned by SmartCopySince for a file last modified
+// before the --since cutoff; the caller counts it as skipped, not failed.
+var ErrBeforeSince = errors.New("modified before --since")
+
+// ParseSince parses the normalized --since timestamp modules receive through
+// SetSinceTime, returning the zero time when it is empty or malformed.
+func ParseSince(sinceRFC3339 string) time.Time {
+	if sinceRFC3339 == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, sinceRFC3339)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// SmartCopySince is SmartCopy for a file collected only if it was modified at
+// or after since. A file modified earlier is left uncopied and ErrBeforeSince
+// is returned; a zero since copies every file.
+func SmartCopySince(srcPath, dstPath string, constraints *SizeConstraints, since time.Time) (bytes int64, sha256Hex string, truncated bool, err error) {
+	if !since.IsZero() {
+		stat, err := os.Stat(srcPath)
+		if err != nil {
+			return 0, "", false, fmt.Errorf("failed to stat source file: %w", err)
+		}
+		if stat.ModTime().Before(since) {
+			return 0, "", false, ErrBeforeSince
+		}
+	}
+	return SmartCopy(srcPath, dstPath, constraints)
+}
@@ -0,0 +1,104 @@
+package winutil
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SizeBudgetStatus is the error recorded for copies refused once the
+// run-wide --max-total-size budget is spent.
+const SizeBudgetStatus = "global size budget exhausted"
+
+// SizeBudgetError is returned by SmartCopy once copying a file would take the
+// bytes copied by all modules together past --max-total-size.
+type SizeBudgetError struct {
+	Path        string
+	NeededBytes int64
+	UsedBytes   int64
+	BudgetBytes int64
+}
+
+func (e *SizeBudgetError) Error() string {
+	return fmt.Sprintf("%s (%d bytes needed, %d of %d bytes used)",
+		SizeBudgetStatus, e.NeededBytes, e.UsedBytes, e.BudgetBytes)
+}
+
+// SizeBudget tracks the bytes copied by every module of a run against the
+// run-wide limit; it is safe for concurrent use. Once exhausted it stays
+// exhausted, so every later copy in the run is refused and the output size
+// has a fixed ceiling. A nil budget has no limit.
+type SizeBudget struct {
+	mu        sync.Mutex
+	limit     int64
+	used      int64
+	exhausted bool
+}
+
+// NewSizeBudget returns a budget of limit bytes, or nil, no limit, when
+// limit is zero or less.
+func NewSizeBudget(limit int64) *SizeBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &SizeBudget{limit: limit}
+}
+
+// Exhausted reports whether the budget has refused a copy.
+func (b *SizeBudget) Exhausted() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exhausted
+}
+
+// Used returns the bytes charged against the budget.
+func (b *SizeBudget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// reserve charges needBytes for a copy to dstPath against the budget,
+// refusing the copy when they do not fit in what is left.
+func (b *SizeBudget) reserve(dstPath string, needBytes int64) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if needBytes < 0 {
+		needBytes = 0
+	}
+	if b.exhausted || b.used+needBytes > b.limit {
+		b.exhausted = true
+		return &SizeBudgetError{Path: dstPath, NeededBytes: needBytes, UsedBytes: b.used, BudgetBytes: b.limit}
+	}
+	b.used += needBytes
+	return nil
+}
+
+// release returns bytes reserved for a copy that failed or wrote less than
+// it reserved. An exhausted budget stays exhausted.
+func (b *SizeBudget) release(bytes int64) {
+	if b == nil || bytes <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used = max(b.used-bytes, 0)
+}
+
+// settle releases what a copy reserved beyond the bytes it wrote: all of it
+// when the copy failed.
+func (b *SizeBudget) settle(reserved, written int64, err error) {
+	if err != nil {
+		written = 0
+	}
+	b.release(reserved - written)
+}
@@ -0,0 +1,163 @@
+package winutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func writeSizedFile(t testing.TB, path string, size int) {
+	t.Helper()
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSizeBudgetReserveAndRelease(t *testing.T) {
+	budget := NewSizeBudget(100)
+	if err := budget.reserve("a", 60); err != nil {
+		t.Fatalf("reserve 60 of 100: %v", err)
+	}
+	budget.settle(60, 40, nil)
+	if used := budget.Used(); used != 40 {
+		t.Fatalf("used after a short copy = %d, want 40", used)
+	}
+	if err := budget.reserve("b", 50); err != nil {
+		t.Fatalf("reserve 50 with 60 left: %v", err)
+	}
+	budget.settle(50, 50, errors.New("copy failed"))
+	if used := budget.Used(); used != 40 {
+		t.Fatalf("used after a failed copy = %d, want 40", used)
+	}
+
+	var budgetErr *SizeBudgetError
+	if err := budget.reserve("c", 61); !errors.As(err, &budgetErr) {
+		t.Fatalf("reserve 61 with 60 left = %v, want SizeBudgetError", err)
+	}
+	if !budget.Exhausted() {
+		t.Fatal("budget not exhausted after refusing a copy")
+	}
+	if err := budget.reserve("d", 1); err == nil {
+		t.Fatal("exhausted budget accepted a later copy")
+	}
+}
+
+func TestNilSizeBudgetHasNoLimit(t *testing.T) {
+	budget := NewSizeBudget(0)
+	if budget != nil {
+		t.Fatal("NewSizeBudget(0) should have no limit")
+	}
+	if err := budget.reserve("a", 1<<40); err != nil {
+		t.Fatalf("nil budget refused a copy: %v", err)
+	}
+	budget.settle(1<<40, 0, nil)
+	if budget.Exhausted() || budget.Used() != 0 {
+		t.Fatal("nil budget reports usage")
+	}
+}
+
+func TestSizeBudgetConcurrentReservations(t *testing.T) {
+	budget := NewSizeBudget(1000)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if budget.reserve("f", 30) == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 33 {
+		t.Fatalf("accepted %d reservations of 30 bytes in 1000, want 33", accepted)
+	}
+	if used := budget.Used(); used != 990 {
+		t.Fatalf("used = %d, want 990", used)
+	}
+}
+
+func TestSmartCopyReleasesBudgetOfFailedCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	writeSizedFile(t, src, 4096)
+
+	budget := NewSizeBudget(6000)
+	ctx := WithCollectSettings(context.Background(), &CollectSettings{Budget: budget})
+
+	// The destination directory does not exist, so the copy fails after
+	// its bytes were reserved
+	for i := 0; i < 3; i++ {
+		if _, _, _, err := SmartCopy(src, filepath.Join(dir, "missing", "dst.bin"), NewSizeConstraints(ctx)); err == nil {
+			t.Fatal("copy into a missing directory succeeded")
+		}
+	}
+	if used := budget.Used(); used != 0 {
+		t.Fatalf("failed copies left %d bytes charged", used)
+	}
+
+	if _, _, _, err := SmartCopy(src, filepath.Join(dir, "dst.bin"), NewSizeConstraints(ctx)); err != nil {
+		t.Fatalf("copy after failed copies: %v", err)
+	}
+	if used := budget.Used(); used != 4096 {
+		t.Fatalf("used = %d, want 4096", used)
+	}
+	var budgetErr *SizeBudgetError
+	if _, _, _, err := SmartCopy(src, filepath.Join(dir, "dst2.bin"), NewSizeConstraints(ctx)); !errors.As(err, &budgetErr) {
+		t.Fatalf("copy past the budget = %v, want SizeBudgetError", err)
+	}
+}
+
+func TestCollectSettingsAreScopedToTheirRun(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	writeSizedFile(t, src, 1000)
+
+	first := NewSizeBudget(1500)
+	second := NewSizeBudget(1500)
+	firstCtx := WithCollectSettings(context.Background(), &CollectSettings{Budget: first})
+	secondCtx := WithCollectSettings(context.Background(), &CollectSettings{Budget: second})
+
+	if _, _, _, err := SmartCopy(src, filepath.Join(dir, "a.bin"), NewSizeConstraints(firstCtx)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := SmartCopy(src, filepath.Join(dir, "b.bin"), NewSizeConstraints(secondCtx)); err != nil {
+		t.Fatalf("second run charged with the first run's copy: %v", err)
+	}
+	if first.Used() != 1000 || second.Used() != 1000 {
+		t.Fatalf("used = %d and %d, want 1000 each", first.Used(), second.Used())
+	}
+
+	// Without settings a copy has no budget
+	if _, _, _, err := SmartCopy(src, filepath.Join(dir, "c.bin"), NewSizeConstraints(context.Background())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyFileResumableReleasesBudgetOfFailedCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	writeSizedFile(t, src, 2048)
+
+	budget := NewSizeBudget(4096)
+	ctx := WithCollectSettings(context.Background(), &CollectSettings{Budget: budget})
+	if _, _, err := CopyFileResumable(ctx, src, filepath.Join(dir, "missing", "dst.bin")); err == nil {
+		t.Fatal("copy into a missing directory succeeded")
+	}
+	if used := budget.Used(); used != 0 {
+		t.Fatalf("failed copy left %d bytes charged", used)
+	}
+	if _, _, err := CopyFileResumable(ctx, src, filepath.Join(dir, "dst.bin")); err != nil {
+		t.Fatal(err)
+	}
+	if used := budget.Used(); used != 2048 {
+		t.Fatalf("used = %d, want 2048", used)
+	}
+}
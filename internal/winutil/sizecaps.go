@@ -2,10 +2,13 @@
 package winutil
 
 import (
-	"crypto/sha256"
+	"context"
 	"fmt"
 	"io"
+	"math"
 	"os"
+
+	"cryptkeeper/internal/progress"
 )
 
 const (
@@ -15,37 +18,63 @@ const (
 	// DefaultMaxTotalMB is the default maximum total size for all files in a module
 	DefaultMaxTotalMB = 2048
 
+	// UnlimitedMB is the cap of a limit set to zero: larger than any file,
+	// yet small enough that sums and byte conversions do not overflow
+	UnlimitedMB = math.MaxInt64 >> 21
+
 	// BufferSize for streaming operations
 	BufferSize = 64 * 1024 // 64KB buffer
 )
 
 // SizeConstraints defines limits for file collection
 type SizeConstraints struct {
-	MaxFileSizeMB  int64 // Maximum size for a single file in MB
-	MaxTotalMB     int64 // Maximum total size for all files in MB
-	CurrentTotalMB int64 // Current total size collected
+	MaxFileSizeMB     int64 // Maximum size for a single file in MB
+	MaxTotalMB        int64 // Maximum total size for all files in MB
+	CurrentTotalBytes int64 // Bytes collected so far
+
+	settings *CollectSettings // The run's settings, from the module's Collect context
+}
+
+// bytesPerMB converts the MB caps to the bytes they are enforced in.
+const bytesPerMB = 1024 * 1024
+
+// capMB maps a cap of zero to UnlimitedMB.
+func capMB(mb int64) int64 {
+	if mb == 0 {
+		return UnlimitedMB
+	}
+	return mb
 }
 
-// NewSizeConstraints creates size constraints with default values
-func NewSizeConstraints() *SizeConstraints {
-	return &SizeConstraints{
-		MaxFileSizeMB:  DefaultMaxFileSizeMB,
-		MaxTotalMB:     DefaultMaxTotalMB,
-		CurrentTotalMB: 0,
+// NewSizeConstraints creates size constraints with the caps of the run whose
+// Collect context is ctx
+func NewSizeConstraints(ctx context.Context) *SizeConstraints {
+	settings := CollectSettingsFrom(ctx)
+	constraints := &SizeConstraints{
+		MaxFileSizeMB: DefaultMaxFileSizeMB,
+		MaxTotalMB:    DefaultMaxTotalMB,
+		settings:      settings,
+	}
+	if settings.MaxFileSizeMB > 0 {
+		constraints.MaxFileSizeMB = settings.MaxFileSizeMB
 	}
+	if settings.MaxTotalMB > 0 {
+		constraints.MaxTotalMB = settings.MaxTotalMB
+	}
+	return constraints
 }
 
-// CanCollectFile checks if a file can be collected based on size constraints
+// CanCollectFile checks if a file can be collected based on size constraints.
+// Sizes are compared in bytes, so files under a megabyte count toward the
+// total too.
 func (sc *SizeConstraints) CanCollectFile(fileSizeBytes int64) bool {
-	fileSizeMB := fileSizeBytes / (1024 * 1024)
-	
 	// Check if file exceeds individual file limit
-	if fileSizeMB > sc.MaxFileSizeMB {
+	if fileSizeBytes > sc.MaxFileBytes() {
 		return false
 	}
 	
 	// Check if adding this file would exceed total limit
-	if sc.CurrentTotalMB+fileSizeMB > sc.MaxTotalMB {
+	if fileSizeBytes > sc.RemainingBytes() {
 		return false
 	}
 	
@@ -54,13 +83,30 @@ func (sc *SizeConstraints) CanCollectFile(fileSizeBytes int64) bool {
 
 // AddFileSize updates the current total size
 func (sc *SizeConstraints) AddFileSize(fileSizeBytes int64) {
-	sc.CurrentTotalMB += fileSizeBytes / (1024 * 1024)
+	sc.CurrentTotalBytes += fileSizeBytes
+}
+
+// MaxFileBytes returns the per-file cap in bytes.
+func (sc *SizeConstraints) MaxFileBytes() int64 {
+	return sc.MaxFileSizeMB * bytesPerMB
+}
+
+// RemainingBytes returns how many more bytes the total cap allows.
+func (sc *SizeConstraints) RemainingBytes() int64 {
+	return max(sc.MaxTotalMB*bytesPerMB-sc.CurrentTotalBytes, 0)
 }
 
 // TailCopy copies the tail (end) of a large file when it exceeds size limits.
 // This is useful for log files where recent entries are most important.
-// Returns bytes copied, SHA-256 hash, and whether the file was truncated.
-func TailCopy(srcPath, dstPath string, maxBytes int64) (bytes int64, sha256Hex string, truncated bool, err error) {
+// Returns bytes copied, SHA-256 hash (empty when hashing is disabled), and
+// whether the file was truncated. In a dry run of the run whose Collect
+// context is ctx, nothing is written.
+func TailCopy(ctx context.Context, srcPath, dstPath string, maxBytes int64) (bytes int64, sha256Hex string, truncated bool, err error) {
+	return tailCopy(CollectSettingsFrom(ctx), srcPath, dstPath, maxBytes)
+}
+
+// tailCopy is TailCopy under the given run settings.
+func tailCopy(settings *CollectSettings, srcPath, dstPath string, maxBytes int64) (bytes int64, sha256Hex string, truncated bool, err error) {
 	// Open source file
 	srcFile, err := os.Open(srcPath)
 	if err != nil {
@@ -78,11 +124,17 @@ func TailCopy(srcPath, dstPath string, maxBytes int64) (bytes int64, sha256Hex s
 	
 	// If file is within limits, do a normal copy
 	if fileSize <= maxBytes {
-		return FullCopy(srcPath, dstPath)
+		return fullCopy(settings, srcPath, dstPath)
 	}
 
 	// File exceeds limits, copy tail
 	truncated = true
+	if settings.DryRun != nil {
+		settings.DryRun.project(maxBytes)
+		return maxBytes, "", true, nil
+	}
+	done := progress.BeginCopy(srcPath, dstPath)
+	defer func() { done(err == nil) }()
 	
 	// Seek to the position where we want to start copying (tail)
 	seekPos := fileSize - maxBytes
@@ -97,24 +149,39 @@ func TailCopy(srcPath, dstPath string, maxBytes int64) (bytes int64, sha256Hex s
 	}
 	defer dstFile.Close()
 
-	// Create hasher
-	hasher := sha256.New()
-	
-	// Create multi-writer for destination and hash
-	multiWriter := io.MultiWriter(dstFile, hasher)
+	// Hash while copying unless hashing is disabled
+	writer, sum := hashingWriter(settings, dstFile)
 	
 	// Copy limited bytes from tail
-	bytes, err = io.CopyN(multiWriter, srcFile, maxBytes)
+	bytes, err = io.CopyN(writer, srcFile, maxBytes)
 	if err != nil && err != io.EOF {
 		return 0, "", true, fmt.Errorf("failed to copy file tail: %w", err)
 	}
 
-	sha256Hex = fmt.Sprintf("%x", hasher.Sum(nil))
-	return bytes, sha256Hex, true, nil
+	return bytes, sum(), true, nil
+}
+
+// FullCopy performs a complete file copy with hashing, unless hashing is
+// disabled. In a dry run of the run whose Collect context is ctx, nothing is
+// written.
+func FullCopy(ctx context.Context, srcPath, dstPath string) (bytes int64, sha256Hex string, truncated bool, err error) {
+	return fullCopy(CollectSettingsFrom(ctx), srcPath, dstPath)
 }
 
-// FullCopy performs a complete file copy with hashing
-func FullCopy(srcPath, dstPath string) (bytes int64, sha256Hex string, truncated bool, err error) {
+// fullCopy is FullCopy under the given run settings.
+func fullCopy(settings *CollectSettings, srcPath, dstPath string) (bytes int64, sha256Hex string, truncated bool, err error) {
+	if settings.DryRun != nil {
+		stat, err := os.Stat(srcPath)
+		if err != nil {
+			return 0, "", false, fmt.Errorf("failed to stat source file: %w", err)
+		}
+		settings.DryRun.project(stat.Size())
+		return stat.Size(), "", false, nil
+	}
+
+	done := progress.BeginCopy(srcPath, dstPath)
+	defer func() { done(err == nil) }()
+
 	srcFile, err := os.Open(srcPath)
 	if err != nil {
 		return 0, "", false, fmt.Errorf("failed to open source file: %w", err)
@@ -127,20 +194,21 @@ func FullCopy(srcPath, dstPath string) (bytes int64, sha256Hex string, truncated
 	}
 	defer dstFile.Close()
 
-	hasher := sha256.New()
-	multiWriter := io.MultiWriter(dstFile, hasher)
+	writer, sum := hashingWriter(settings, dstFile)
 	
-	bytes, err = io.Copy(multiWriter, srcFile)
+	bytes, err = io.Copy(writer, srcFile)
 	if err != nil {
 		return 0, "", false, fmt.Errorf("failed to copy file: %w", err)
 	}
 
-	sha256Hex = fmt.Sprintf("%x", hasher.Sum(nil))
-	return bytes, sha256Hex, false, nil
+	return bytes, sum(), false, nil
 }
 
 // SmartCopy decides whether to do a full copy or tail copy based on size constraints
 func SmartCopy(srcPath, dstPath string, constraints *SizeConstraints) (bytes int64, sha256Hex string, truncated bool, err error) {
+	if IsRunOutput(srcPath) {
+		return 0, "", false, fmt.Errorf("%w: %s", ErrRunOutput, srcPath)
+	}
 	// Get source file size
 	stat, err := os.Stat(srcPath)
 	if err != nil {
@@ -148,12 +216,19 @@ func SmartCopy(srcPath, dstPath string, constraints *SizeConstraints) (bytes int
 	}
 
 	fileSize := stat.Size()
-	maxBytes := constraints.MaxFileSizeMB * 1024 * 1024
+	maxBytes := constraints.MaxFileBytes()
+	settings := constraints.settings
+	if settings == nil {
+		settings = &CollectSettings{}
+	}
+
+	// Yield to the system's real workload before starting the next file
+	throttleWait()
 
 	// Check if we can collect this file
 	if !constraints.CanCollectFile(fileSize) {
 		// File is too large, try tail copy with max allowed size
-		maxAllowedBytes := (constraints.MaxTotalMB - constraints.CurrentTotalMB) * 1024 * 1024
+		maxAllowedBytes := constraints.RemainingBytes()
 		if maxAllowedBytes <= 0 {
 			return 0, "", false, fmt.Errorf("total size limit exceeded, cannot collect file")
 		}
@@ -162,10 +237,22 @@ func SmartCopy(srcPath, dstPath string, constraints *SizeConstraints) (bytes int
 			maxAllowedBytes = maxBytes
 		}
 		
-		bytes, sha256Hex, truncated, err = TailCopy(srcPath, dstPath, maxAllowedBytes)
+		// Stop before the copy would leave the output volume below the free space minimum
+		reserved := min(fileSize, maxAllowedBytes)
+		if err := reserveSpace(settings, dstPath, reserved); err != nil {
+			return 0, "", false, err
+		}
+		
+		bytes, sha256Hex, truncated, err = tailCopy(settings, srcPath, dstPath, maxAllowedBytes)
+		settings.Budget.settle(reserved, bytes, err)
 	} else {
+		if err := reserveSpace(settings, dstPath, fileSize); err != nil {
+			return 0, "", false, err
+		}
+		
 		// File is within limits, do full copy
-		bytes, sha256Hex, truncated, err = FullCopy(srcPath, dstPath)
+		bytes, sha256Hex, truncated, err = fullCopy(settings, srcPath, dstPath)
+		settings.Budget.settle(fileSize, bytes, err)
 	}
 
 	// Update size constraints if successful
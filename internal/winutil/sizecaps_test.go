@@ -0,0 +1,103 @@
+package winutil
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSizeConstraintsUsesRunSettings(t *testing.T) {
+	tests := []struct {
+		name                  string
+		settings              *CollectSettings
+		wantFileMB, wantTotal int64
+	}{
+		{"no settings keeps defaults", nil, DefaultMaxFileSizeMB, DefaultMaxTotalMB},
+		{"zero fields keep defaults", &CollectSettings{}, DefaultMaxFileSizeMB, DefaultMaxTotalMB},
+		{"flag values", NewCollectSettings(64, 512, 0), 64, 512},
+		{"zero flag removes the cap", NewCollectSettings(0, 0, 0), UnlimitedMB, UnlimitedMB},
+		{"negative flag keeps the default", NewCollectSettings(-1, -1, 0), DefaultMaxFileSizeMB, DefaultMaxTotalMB},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.settings != nil {
+				ctx = WithCollectSettings(ctx, tt.settings)
+			}
+			constraints := NewSizeConstraints(ctx)
+			if constraints.MaxFileSizeMB != tt.wantFileMB || constraints.MaxTotalMB != tt.wantTotal {
+				t.Fatalf("caps = %d/%d MB, want %d/%d MB",
+					constraints.MaxFileSizeMB, constraints.MaxTotalMB, tt.wantFileMB, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestSizeCapsAreScopedToTheirRun(t *testing.T) {
+	small := NewSizeConstraints(WithCollectSettings(context.Background(), NewCollectSettings(1, 2, 0)))
+	large := NewSizeConstraints(WithCollectSettings(context.Background(), NewCollectSettings(100, 200, 0)))
+	if small.MaxFileSizeMB != 1 || large.MaxFileSizeMB != 100 {
+		t.Fatalf("file caps = %d and %d, want 1 and 100", small.MaxFileSizeMB, large.MaxFileSizeMB)
+	}
+	if !large.CanCollectFile(50*bytesPerMB) || small.CanCollectFile(50*bytesPerMB) {
+		t.Fatal("one run's caps applied to the other")
+	}
+}
+
+func TestUnlimitedCapsDoNotOverflow(t *testing.T) {
+	constraints := NewSizeConstraints(WithCollectSettings(context.Background(), NewCollectSettings(0, 0, 0)))
+	if !constraints.CanCollectFile(1 << 50) {
+		t.Fatal("unlimited caps refused a 1 PB file")
+	}
+	constraints.AddFileSize(1 << 50)
+	if constraints.RemainingBytes() <= 0 {
+		t.Fatal("unlimited module cap reported as spent")
+	}
+}
+
+func TestSmallFilesAddUpToTheTotalCap(t *testing.T) {
+	const fileSize = 100 * 1024
+	constraints := NewSizeConstraints(WithCollectSettings(context.Background(), NewCollectSettings(1, 1, 0)))
+	accepted := 0
+	for i := 0; i < 100 && constraints.CanCollectFile(fileSize); i++ {
+		constraints.AddFileSize(fileSize)
+		accepted++
+	}
+	if want := bytesPerMB / fileSize; accepted != want {
+		t.Fatalf("a 1 MB cap accepted %d files of 100 KB, want %d", accepted, want)
+	}
+	if constraints.CurrentTotalBytes != int64(accepted)*fileSize {
+		t.Fatalf("total = %d bytes, want %d", constraints.CurrentTotalBytes, accepted*fileSize)
+	}
+}
+
+func TestSmartCopyEnforcesTotalCapOnSmallFiles(t *testing.T) {
+	const fileSize = 100 * 1024
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	constraints := NewSizeConstraints(WithCollectSettings(context.Background(), NewCollectSettings(1, 1, 0)))
+
+	var copied int64
+	full, truncatedFiles, refused := 0, 0, 0
+	for i := 0; i < 20; i++ {
+		src := filepath.Join(srcDir, fmt.Sprintf("fragment%02d.bin", i))
+		writeSizedFile(t, src, fileSize)
+		n, _, truncated, err := SmartCopy(src, filepath.Join(dstDir, filepath.Base(src)), constraints)
+		switch {
+		case err != nil:
+			refused++
+		case truncated:
+			truncatedFiles++
+		default:
+			full++
+		}
+		copied += n
+	}
+	if copied != bytesPerMB || constraints.CurrentTotalBytes != bytesPerMB {
+		t.Fatalf("copied %d bytes (accounted %d) under a 1 MB cap, want exactly %d", copied, constraints.CurrentTotalBytes, bytesPerMB)
+	}
+	// Ten whole files, the tail of the eleventh to fill the cap, then nothing
+	if full != 10 || truncatedFiles != 1 || refused != 9 {
+		t.Fatalf("%d full, %d truncated, %d refused copies; want 10, 1, 9", full, truncatedFiles, refused)
+	}
+}
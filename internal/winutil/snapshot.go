@@ -0,0 +1,127 @@
+package winutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Snapshot is the shadow copy of the system volume that a run with
+// --use-snapshot creates once. Every file-based module reads the system
+// volume through it, so files held open on the live system, such as the
+// hives of logged-on users, can be copied, and all modules see the same
+// moment in time.
+type Snapshot struct {
+	ID         string `json:"shadow_id"`
+	Device     string `json:"device"` // e.g. \\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy4
+	Drive      string `json:"drive"`  // Live drive the snapshot is of, e.g. C:
+	CreatedUTC string `json:"created_utc"`
+	Deleted    bool   `json:"deleted"`
+	DeleteErr  string `json:"delete_error,omitempty"`
+}
+
+// activeSnapshot is the snapshot set by UseSnapshot; nil reads the live volume.
+var activeSnapshot *Snapshot
+
+// UseSnapshot directs path lookups on the snapshot's drive at the snapshot.
+// A nil snapshot restores the live volume.
+func UseSnapshot(snapshot *Snapshot) {
+	activeSnapshot = snapshot
+}
+
+// ActiveSnapshot returns the snapshot in use, or nil.
+func ActiveSnapshot() *Snapshot {
+	return activeSnapshot
+}
+
+// SnapshotPath maps a path on the snapshotted drive onto the snapshot
+// device. Paths on other drives, and every path when no snapshot is in use,
+// are returned unchanged.
+func SnapshotPath(path string) string {
+	snapshot := activeSnapshot
+	if snapshot == nil || len(path) < 2 || !strings.EqualFold(path[:2], snapshot.Drive) {
+		return path
+	}
+	device := strings.TrimRight(snapshot.Device, `\`)
+	if len(path) == 2 {
+		return device
+	}
+	if path[2] != '\\' && path[2] != '/' {
+		return path
+	}
+	return device + `\` + path[3:]
+}
+
+// snapshotCommand runs vssadmin to delete a snapshot; replaced in tests.
+var snapshotCommand = RunCommandWithOutput
+
+// Delete removes the shadow copy, recording the outcome on the snapshot. If
+// it is the snapshot in use, path lookups return to the live volume first,
+// even when the deletion fails, as the device may no longer be readable.
+// Deleting an already deleted snapshot does nothing.
+func (s *Snapshot) Delete(ctx context.Context) error {
+	if s == nil || s.Deleted {
+		return nil
+	}
+	if activeSnapshot == s {
+		activeSnapshot = nil
+	}
+	id := strings.Trim(s.ID, "{}")
+	_, err := snapshotCommand(ctx, "vssadmin", []string{"delete", "shadows", "/shadow={" + id + "}", "/quiet"})
+	if err != nil {
+		s.DeleteErr = err.Error()
+		return fmt.Errorf("failed to delete shadow copy %s: %w", s.ID, err)
+	}
+	s.Deleted = true
+	s.DeleteErr = ""
+	return nil
+}
+
+// shadowCreateErrors are the return values of Win32_ShadowCopy.Create.
+var shadowCreateErrors = map[int]string{
+	1:  "access denied",
+	2:  "invalid argument",
+	3:  "volume not found",
+	4:  "volume not supported",
+	5:  "unsupported shadow copy context",
+	6:  "insufficient storage",
+	7:  "volume is in use",
+	8:  "maximum number of shadow copies reached",
+	9:  "another shadow copy operation is in progress",
+	10: "shadow copy provider vetoed the operation",
+	11: "shadow copy provider not registered",
+	12: "shadow copy provider failure",
+}
+
+// ParseSnapshotCreate reads the JSON printed by the snapshot creation script:
+// the Win32_ShadowCopy.Create return value, the new shadow copy's ID, and its
+// device object. created is when the script ran.
+func ParseSnapshotCreate(output []byte, drive string, created time.Time) (*Snapshot, error) {
+	var result struct {
+		ReturnValue  int
+		ShadowID     string
+		DeviceObject string
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(bytes.TrimPrefix(output, []byte("\xef\xbb\xbf"))), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse shadow copy creation output: %w", err)
+	}
+	if result.ReturnValue != 0 {
+		reason, ok := shadowCreateErrors[result.ReturnValue]
+		if !ok {
+			reason = "unknown error"
+		}
+		return nil, fmt.Errorf("shadow copy creation failed: %s (%d)", reason, result.ReturnValue)
+	}
+	if result.ShadowID == "" || result.DeviceObject == "" {
+		return nil, fmt.Errorf("shadow copy creation returned no shadow copy")
+	}
+	return &Snapshot{
+		ID:         result.ShadowID,
+		Device:     result.DeviceObject,
+		Drive:      strings.ToUpper(drive[:2]),
+		CreatedUTC: FormatTime(created),
+	}, nil
+}
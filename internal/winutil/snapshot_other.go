@@ -0,0 +1,13 @@
+//go:build !windows
+
+package winutil
+
+import (
+	"context"
+	"errors"
+)
+
+// CreateSnapshot is not implemented off Windows.
+func CreateSnapshot(ctx context.Context, drive string) (*Snapshot, error) {
+	return nil, errors.ErrUnsupported
+}
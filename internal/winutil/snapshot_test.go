@@ -0,0 +1,138 @@
+package winutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testShadowDevice = `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy4`
+
+// useTestSnapshot makes a snapshot of C: the one in use for one test, with
+// an environment naming the usual system directories.
+func useTestSnapshot(t *testing.T) *Snapshot {
+	t.Helper()
+	systemGetenv = func(key string) string {
+		return map[string]string{"SystemDrive": "C:", "SystemRoot": `C:\WINDOWS`, "ProgramData": `C:\ProgramData`}[key]
+	}
+	snapshot := &Snapshot{ID: "{6B3A1F6E-2D47-4C8A-9E0B-5F1D2C3A4B5C}", Device: testShadowDevice + `\`, Drive: "C:"}
+	UseSnapshot(snapshot)
+	t.Cleanup(func() {
+		UseSnapshot(nil)
+		systemGetenv = os.Getenv
+	})
+	return snapshot
+}
+
+func TestSnapshotResolvesSystemPaths(t *testing.T) {
+	snapshot := useTestSnapshot(t)
+	if ActiveSnapshot() != snapshot {
+		t.Fatal("snapshot not in use")
+	}
+	tests := []struct {
+		name      string
+		got, want string
+	}{
+		{"SystemDrive", SystemDrive(), testShadowDevice},
+		{"LiveSystemDrive", LiveSystemDrive(), "C:"},
+		{"SystemRoot", SystemRoot(), testShadowDevice + `\WINDOWS`},
+		{"ProgramData", ProgramData(), testShadowDevice + `\ProgramData`},
+		{"UsersDir", UsersDir(), testShadowDevice + `\Users`},
+		{"hive", SnapshotPath(`c:\Users\alice\NTUSER.DAT`), testShadowDevice + `\Users\alice\NTUSER.DAT`},
+		{"forward slash", SnapshotPath(`C:/$Recycle.Bin`), testShadowDevice + `\$Recycle.Bin`},
+		{"drive root", SnapshotPath(`C:\`), testShadowDevice + `\`},
+		{"other drive", SnapshotPath(`D:\$Recycle.Bin`), `D:\$Recycle.Bin`},
+		{"drive-relative", SnapshotPath(`C:Windows`), `C:Windows`},
+		{"already mapped", SnapshotPath(testShadowDevice + `\Windows`), testShadowDevice + `\Windows`},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+
+	// Without a snapshot every path is the live one
+	UseSnapshot(nil)
+	if SystemRoot() != `C:\WINDOWS` || SystemDrive() != "C:" || SnapshotPath(`C:\Users`) != `C:\Users` {
+		t.Fatalf("live paths = %q, %q", SystemDrive(), SystemRoot())
+	}
+}
+
+func TestSnapshotDeleteRemovesTheOneSnapshot(t *testing.T) {
+	snapshot := useTestSnapshot(t)
+	var commands [][]string
+	fail := false
+	snapshotCommand = func(ctx context.Context, name string, args []string) ([]byte, error) {
+		commands = append(commands, append([]string{name}, args...))
+		if fail {
+			return nil, errors.New("command vssadmin failed: exit status 2")
+		}
+		return nil, nil
+	}
+	t.Cleanup(func() { snapshotCommand = RunCommandWithOutput })
+
+	// A failed deletion is recorded for the run output and can be retried;
+	// lookups no longer go through a device that may be half gone
+	fail = true
+	if err := snapshot.Delete(context.Background()); err == nil || !strings.Contains(err.Error(), snapshot.ID) {
+		t.Fatalf("failed delete = %v", err)
+	}
+	if snapshot.Deleted || snapshot.DeleteErr == "" || ActiveSnapshot() != nil || SystemDrive() != "C:" {
+		t.Fatalf("after failed delete: %+v, system drive %q", snapshot, SystemDrive())
+	}
+
+	fail = false
+	if err := snapshot.Delete(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !snapshot.Deleted || snapshot.DeleteErr != "" {
+		t.Fatalf("after delete: %+v", snapshot)
+	}
+	// Deleting at the end of collection and again when the run returns
+	// removes it only once
+	if err := snapshot.Delete(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"vssadmin", "delete", "shadows", "/shadow={6B3A1F6E-2D47-4C8A-9E0B-5F1D2C3A4B5C}", "/quiet"}
+	if len(commands) != 2 || !reflect.DeepEqual(commands[1], want) {
+		t.Fatalf("commands = %v", commands)
+	}
+
+	// Deleting another snapshot leaves the one in use alone
+	UseSnapshot(snapshot)
+	other := &Snapshot{ID: "{00000000-0000-0000-0000-000000000001}", Drive: "D:"}
+	if err := other.Delete(context.Background()); err != nil || ActiveSnapshot() != snapshot {
+		t.Fatalf("deleting another snapshot = %v, active %v", err, ActiveSnapshot())
+	}
+	var none *Snapshot
+	if err := none.Delete(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseSnapshotCreate(t *testing.T) {
+	output := []byte("\xef\xbb\xbf" + `{"ReturnValue":0,"ShadowID":"{6B3A1F6E-2D47-4C8A-9E0B-5F1D2C3A4B5C}","DeviceObject":"` + strings.ReplaceAll(testShadowDevice, `\`, `\\`) + `"}` + "\r\n")
+	snapshot, err := ParseSnapshotCreate(output, `c:\`, time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Snapshot{ID: "{6B3A1F6E-2D47-4C8A-9E0B-5F1D2C3A4B5C}", Device: testShadowDevice, Drive: "C:", CreatedUTC: "2024-03-01T11:00:00Z"}
+	if !reflect.DeepEqual(snapshot, want) {
+		t.Fatalf("snapshot = %+v", snapshot)
+	}
+
+	for _, tt := range []struct{ output, want string }{
+		{`{"ReturnValue":6,"ShadowID":"","DeviceObject":""}`, "insufficient storage (6)"},
+		{`{"ReturnValue":99}`, "unknown error (99)"},
+		{`{"ReturnValue":0,"ShadowID":"","DeviceObject":""}`, "returned no shadow copy"},
+		{`Get-WmiObject : Access denied`, "failed to parse"},
+	} {
+		if _, err := ParseSnapshotCreate([]byte(tt.output), "C:", time.Time{}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseSnapshotCreate(%s) = %v, want %q", tt.output, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+//go:build windows
+
+package winutil
+
+import (
+	"context"
+	"fmt"
+)
+
+// createSnapshotScript creates a client-accessible shadow copy of the volume
+// in $drive and prints its ID and device object as JSON.
+const createSnapshotScript = `$ErrorActionPreference = 'Stop'
+$result = (Get-WmiObject -List Win32_ShadowCopy).Create($drive, 'ClientAccessible')
+$device = ''
+if ($result.ReturnValue -eq 0) {
+  $device = (Get-CimInstance Win32_ShadowCopy -Filter "ID='$($result.ShadowID)'").DeviceObject
+}
+[pscustomobject]@{ ReturnValue = [int]$result.ReturnValue; ShadowID = [string]$result.ShadowID; DeviceObject = [string]$device } | ConvertTo-Json -Compress`
+
+// CreateSnapshot creates a shadow copy of the volume holding drive, e.g. "C:".
+// Unlike LatestShadowPath this changes the system, so callers only use it
+// when the operator asked for it, and must delete the snapshot afterwards.
+func CreateSnapshot(ctx context.Context, drive string) (*Snapshot, error) {
+	if IsOffline() {
+		return nil, ErrRequiresLiveSystem
+	}
+	if len(drive) < 2 || drive[1] != ':' {
+		return nil, fmt.Errorf("%s is not a drive", drive)
+	}
+	script := fmt.Sprintf("$drive = '%s\\'\n%s", drive[:2], createSnapshotScript)
+	output, err := RunCommandWithOutput(ctx, "powershell", []string{"-NoProfile", "-NonInteractive", "-Command", script})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shadow copy of %s: %w", drive[:2], err)
+	}
+	return ParseSnapshotCreate(output, drive, Now(ctx))
+}
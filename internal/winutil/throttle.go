@@ -0,0 +1,126 @@
+package winutil
+
+import (
+	"sync"
+	"time"
+)
+
+// Default adaptive throttle thresholds.
+const (
+	DefaultThrottleCPUPercent = 80
+	DefaultThrottleDiskQueue  = 2
+)
+
+// Adaptive throttle timing. Samples are reused for sampleInterval so runs of
+// small files do not query the counters once per file, and a single file never
+// waits longer than maxFileWait so collection cannot stall indefinitely.
+const (
+	sampleInterval = time.Second
+	minBackoff     = 250 * time.Millisecond
+	maxBackoff     = 5 * time.Second
+	maxFileWait    = 30 * time.Second
+)
+
+// LoadSample is a single reading of system utilization.
+type LoadSample struct {
+	CPUPercent      float64 // Total processor time across all CPUs, 0-100
+	DiskQueueLength float64 // Current disk queue length summed over physical disks
+}
+
+// BackoffDelay decides how long to wait before the next copy. While either
+// reading is above its threshold the delay doubles from minBackoff up to
+// maxBackoff; once both are at or below their thresholds it drops to zero.
+// A threshold of zero or less is ignored.
+func BackoffDelay(sample LoadSample, cpuThreshold, queueThreshold float64, previous time.Duration) time.Duration {
+	busy := (cpuThreshold > 0 && sample.CPUPercent > cpuThreshold) ||
+		(queueThreshold > 0 && sample.DiskQueueLength > queueThreshold)
+	if !busy {
+		return 0
+	}
+	if previous < minBackoff {
+		return minBackoff
+	}
+	if next := previous * 2; next < maxBackoff {
+		return next
+	}
+	return maxBackoff
+}
+
+// adaptiveThrottle holds the run-wide throttle configuration and state.
+type adaptiveThrottle struct {
+	mu             sync.Mutex
+	enabled        bool
+	cpuThreshold   float64
+	queueThreshold float64
+	lastSample     LoadSample
+	lastSampled    time.Time
+	delay          time.Duration
+	totalWait      time.Duration
+	unsupported    bool
+}
+
+var throttle adaptiveThrottle
+
+// sampleLoad is the utilization probe used by the throttle; replaced when simulating load.
+var sampleLoad = SampleLoad
+
+// sleep pauses between samples; replaced when simulating load.
+var sleep = time.Sleep
+
+// SetAdaptiveThrottle enables load-reactive throttling between file copies.
+// Copies are delayed while CPU utilization exceeds cpuPercent or the disk
+// queue length exceeds diskQueue.
+func SetAdaptiveThrottle(enabled bool, cpuPercent, diskQueue float64) {
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+	throttle.enabled = enabled
+	throttle.cpuThreshold = cpuPercent
+	throttle.queueThreshold = diskQueue
+	throttle.lastSampled = time.Time{}
+	throttle.delay = 0
+	throttle.totalWait = 0
+	throttle.unsupported = false
+}
+
+// AdaptiveThrottleWait returns the total time copies were delayed by the adaptive throttle.
+func AdaptiveThrottleWait() time.Duration {
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+	return throttle.totalWait
+}
+
+// throttleWait blocks while the system is busy, re-sampling after each delay.
+// Sampling failures disable the throttle rather than blocking collection.
+// The lock is held while waiting so concurrent modules back off together.
+func throttleWait() {
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+
+	if !throttle.enabled || throttle.unsupported {
+		return
+	}
+
+	var waited time.Duration
+	for waited < maxFileWait {
+		if time.Since(throttle.lastSampled) >= sampleInterval || throttle.delay > 0 {
+			sample, err := sampleLoad()
+			if err != nil {
+				throttle.unsupported = true
+				return
+			}
+			throttle.lastSample = sample
+			throttle.lastSampled = time.Now()
+		}
+
+		throttle.delay = BackoffDelay(throttle.lastSample, throttle.cpuThreshold, throttle.queueThreshold, throttle.delay)
+		if throttle.delay == 0 {
+			return
+		}
+		if remaining := maxFileWait - waited; throttle.delay > remaining {
+			throttle.delay = remaining
+		}
+		sleep(throttle.delay)
+		waited += throttle.delay
+		throttle.totalWait += throttle.delay
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package winutil
+
+import (
+	"errors"
+)
+
+// SampleLoad is not implemented off Windows; the adaptive throttle disables itself.
+func SampleLoad() (LoadSample, error) {
+	return LoadSample{}, errors.ErrUnsupported
+}
@@ -0,0 +1,121 @@
+package winutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		sample   LoadSample
+		previous time.Duration
+		want     time.Duration
+	}{
+		{"idle", LoadSample{CPUPercent: 35, DiskQueueLength: 0.4}, 0, 0},
+		{"at the thresholds", LoadSample{CPUPercent: 80, DiskQueueLength: 2}, 0, 0},
+		{"busy CPU starts the backoff", LoadSample{CPUPercent: 97}, 0, minBackoff},
+		{"deep disk queue starts the backoff", LoadSample{CPUPercent: 20, DiskQueueLength: 6.5}, 0, minBackoff},
+		{"still busy doubles", LoadSample{CPUPercent: 97}, time.Second, 2 * time.Second},
+		{"doubling is capped", LoadSample{CPUPercent: 97}, 4 * time.Second, maxBackoff},
+		{"recovery clears the backoff", LoadSample{CPUPercent: 12}, maxBackoff, 0},
+	}
+	for _, tt := range tests {
+		if got := BackoffDelay(tt.sample, DefaultThrottleCPUPercent, DefaultThrottleDiskQueue, tt.previous); got != tt.want {
+			t.Errorf("%s: BackoffDelay = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// A zero threshold turns that check off
+	if got := BackoffDelay(LoadSample{CPUPercent: 100, DiskQueueLength: 40}, 0, 0, 0); got != 0 {
+		t.Errorf("disabled thresholds: BackoffDelay = %v, want 0", got)
+	}
+	if got := BackoffDelay(LoadSample{CPUPercent: 100, DiskQueueLength: 40}, 0, 50, 0); got != 0 {
+		t.Errorf("CPU check disabled: BackoffDelay = %v, want 0", got)
+	}
+}
+
+// simulateLoad feeds throttleWait the given readings and records its sleeps.
+func simulateLoad(t *testing.T, readings []LoadSample, failAfter int) *[]time.Duration {
+	t.Helper()
+	slept := new([]time.Duration)
+	calls := 0
+	sampleLoad = func() (LoadSample, error) {
+		calls++
+		if failAfter > 0 && calls > failAfter {
+			return LoadSample{}, errors.ErrUnsupported
+		}
+		sample := readings[len(readings)-1]
+		if calls <= len(readings) {
+			sample = readings[calls-1]
+		}
+		return sample, nil
+	}
+	sleep = func(d time.Duration) { *slept = append(*slept, d) }
+	t.Cleanup(func() {
+		sampleLoad, sleep = SampleLoad, time.Sleep
+		SetAdaptiveThrottle(false, 0, 0)
+	})
+	return slept
+}
+
+func TestThrottleWaitBacksOffUntilIdle(t *testing.T) {
+	busy, idle := LoadSample{CPUPercent: 99, DiskQueueLength: 8}, LoadSample{CPUPercent: 10}
+	slept := simulateLoad(t, []LoadSample{busy, busy, busy, idle}, 0)
+	SetAdaptiveThrottle(true, DefaultThrottleCPUPercent, DefaultThrottleDiskQueue)
+
+	throttleWait()
+	want := []time.Duration{minBackoff, 2 * minBackoff, 4 * minBackoff}
+	if len(*slept) != len(want) {
+		t.Fatalf("slept %v, want %v", *slept, want)
+	}
+	for i := range want {
+		if (*slept)[i] != want[i] {
+			t.Fatalf("slept %v, want %v", *slept, want)
+		}
+	}
+	if AdaptiveThrottleWait() != 7*minBackoff {
+		t.Errorf("total wait = %v", AdaptiveThrottleWait())
+	}
+
+	// The idle reading is reused for the next file
+	throttleWait()
+	if len(*slept) != len(want) {
+		t.Errorf("idle system delayed the next copy: %v", *slept)
+	}
+}
+
+func TestThrottleWaitIsBoundedPerFile(t *testing.T) {
+	slept := simulateLoad(t, []LoadSample{{CPUPercent: 100}}, 0)
+	SetAdaptiveThrottle(true, DefaultThrottleCPUPercent, DefaultThrottleDiskQueue)
+
+	throttleWait()
+	var total time.Duration
+	for _, d := range *slept {
+		total += d
+	}
+	if total != maxFileWait {
+		t.Errorf("a permanently busy system delayed one file by %v, want %v", total, maxFileWait)
+	}
+}
+
+func TestThrottleWaitDisablesItselfWithoutCounters(t *testing.T) {
+	slept := simulateLoad(t, []LoadSample{{CPUPercent: 100}}, 1)
+	SetAdaptiveThrottle(true, DefaultThrottleCPUPercent, DefaultThrottleDiskQueue)
+
+	throttleWait()
+	throttleWait()
+	throttleWait()
+	if len(*slept) != 1 || AdaptiveThrottleWait() != minBackoff {
+		t.Errorf("slept %v after the counters failed", *slept)
+	}
+
+	// Left off, nothing is sampled
+	SetAdaptiveThrottle(false, 0, 0)
+	sampleLoad = func() (LoadSample, error) {
+		t.Fatal("disabled throttle sampled the load")
+		return LoadSample{}, nil
+	}
+	throttleWait()
+}
@@ -0,0 +1,79 @@
+package winutil
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Timestamp formats selectable with --time-format.
+const (
+	TimeFormatRFC3339 = "rfc3339"
+	TimeFormatEpoch   = "epoch"
+	TimeFormatEpochMS = "epoch-ms"
+)
+
+// epochMSThreshold separates epoch seconds from epoch milliseconds when
+// parsing: 1e11 seconds is in the year 5138, 1e11 milliseconds in 1973.
+const epochMSThreshold = 100000000000
+
+// timeFormat is the format FormatTime writes for the whole run.
+var timeFormat atomic.Value
+
+// ValidateTimeFormat checks a --time-format value.
+func ValidateTimeFormat(format string) error {
+	switch format {
+	case TimeFormatRFC3339, TimeFormatEpoch, TimeFormatEpochMS:
+		return nil
+	}
+	return fmt.Errorf("unsupported time format %q (use %s, %s, or %s)", format, TimeFormatRFC3339, TimeFormatEpoch, TimeFormatEpochMS)
+}
+
+// SetTimeFormat selects how FormatTime renders timestamps in JSON output.
+// The default is RFC3339.
+func SetTimeFormat(format string) error {
+	if err := ValidateTimeFormat(format); err != nil {
+		return err
+	}
+	timeFormat.Store(format)
+	return nil
+}
+
+// TimeFormat returns the format set with SetTimeFormat.
+func TimeFormat() string {
+	if format, ok := timeFormat.Load().(string); ok {
+		return format
+	}
+	return TimeFormatRFC3339
+}
+
+// FormatTime renders t in UTC in the run's time format: RFC3339 by
+// default, or Unix seconds or milliseconds as a decimal string, so that
+// every output field keeps the same JSON type whichever format is chosen.
+func FormatTime(t time.Time) string {
+	switch TimeFormat() {
+	case TimeFormatEpoch:
+		return strconv.FormatInt(t.Unix(), 10)
+	case TimeFormatEpochMS:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// ParseTime reads a timestamp written by FormatTime in any of the formats,
+// so output read back, possibly by a run using another format, still parses.
+// Integers of magnitude 1e11 and above are taken as milliseconds.
+func ParseTime(s string) (time.Time, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n >= epochMSThreshold || n <= -epochMSThreshold {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,78 @@
+package winutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// withTimeFormat selects format for one test.
+func withTimeFormat(t *testing.T, format string) {
+	t.Helper()
+	if err := SetTimeFormat(format); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetTimeFormat(TimeFormatRFC3339) })
+}
+
+func TestFormatTimeIsUniformAcrossFields(t *testing.T) {
+	// The times a module records: its own clock in UTC, a file time in the
+	// host's zone, and a FILETIME-derived time with sub-second precision
+	type record struct {
+		CollectedUTC string `json:"collected_utc"`
+		Modified     string `json:"modified"`
+		LastRun      string `json:"last_run"`
+	}
+	collected := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	modified := time.Date(2024, 3, 1, 13, 30, 15, 0, time.FixedZone("CET", 3600))
+	lastRun := time.Date(2024, 2, 28, 23, 59, 59, 250*int(time.Millisecond), time.UTC)
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{TimeFormatRFC3339, `{"collected_utc":"2024-03-01T12:00:00Z","modified":"2024-03-01T12:30:15Z","last_run":"2024-02-28T23:59:59Z"}`},
+		{TimeFormatEpoch, `{"collected_utc":"1709294400","modified":"1709296215","last_run":"1709164799"}`},
+		{TimeFormatEpochMS, `{"collected_utc":"1709294400000","modified":"1709296215000","last_run":"1709164799250"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			withTimeFormat(t, tt.format)
+			data, err := json.Marshal(record{FormatTime(collected), FormatTime(modified), FormatTime(lastRun)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Fatalf("marshaled as %s\nwant %s", data, tt.want)
+			}
+
+			// Output of any format reads back as the same instant, to the
+			// format's precision
+			var decoded record
+			json.Unmarshal(data, &decoded)
+			precision := time.Second
+			if tt.format == TimeFormatEpochMS {
+				precision = time.Millisecond
+			}
+			for field, want := range map[string]time.Time{decoded.CollectedUTC: collected, decoded.Modified: modified, decoded.LastRun: lastRun} {
+				got, err := ParseTime(field)
+				if err != nil || !got.Equal(want.Truncate(precision)) || got.Location() != time.UTC {
+					t.Errorf("ParseTime(%q) = %v, %v, want %v", field, got, err, want.Truncate(precision))
+				}
+			}
+		})
+	}
+}
+
+func TestSetTimeFormatRejectsUnknownFormats(t *testing.T) {
+	withTimeFormat(t, TimeFormatEpoch)
+	if err := SetTimeFormat("iso8601"); err == nil {
+		t.Fatal("iso8601 accepted")
+	}
+	if got := TimeFormat(); got != TimeFormatEpoch {
+		t.Errorf("format after a rejected value = %s", got)
+	}
+	if _, err := ParseTime("2024-03-01 12:00:00"); err == nil {
+		t.Error("time without a zone parsed")
+	}
+}
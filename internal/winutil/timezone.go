@@ -0,0 +1,51 @@
+package winutil
+
+import (
+	"fmt"
+	"time"
+)
+
+// HostTimezone is the collection host's time zone at the time of collection.
+// Local times recorded by the host convert to UTC as local + BiasMinutes.
+type HostTimezone struct {
+	StandardName   string `json:"standard_name"`
+	DaylightName   string `json:"daylight_name,omitempty"`
+	BiasMinutes    int    `json:"bias_minutes"` // Active bias, including daylight saving when in effect
+	UTCOffset      string `json:"utc_offset"`   // Active offset from UTC, e.g. "-05:00"
+	DaylightActive bool   `json:"daylight_active"`
+	Source         string `json:"source"` // "GetTimeZoneInformation" or "go_runtime"
+}
+
+// CurrentTimezone reports the live host's time zone. It returns
+// ErrRequiresLiveSystem when collecting from an alternate root, whose zone is
+// unrelated to the machine running cryptkeeper.
+func CurrentTimezone() (*HostTimezone, error) {
+	if IsOffline() {
+		return nil, ErrRequiresLiveSystem
+	}
+	return hostTimezone()
+}
+
+// formatUTCOffset renders a bias as a UTC offset; a positive bias is west of UTC.
+func formatUTCOffset(biasMinutes int) string {
+	offset := -biasMinutes
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, offset/60, offset%60)
+}
+
+// goRuntimeTimezone describes time.Local, for platforms without the Windows API.
+func goRuntimeTimezone() *HostTimezone {
+	name, offsetSeconds := time.Now().Zone()
+	bias := -offsetSeconds / 60
+	return &HostTimezone{
+		StandardName:   name,
+		BiasMinutes:    bias,
+		UTCOffset:      formatUTCOffset(bias),
+		DaylightActive: time.Now().IsDST(),
+		Source:         "go_runtime",
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package winutil
+
+// hostTimezone falls back to the Go runtime's local zone off Windows.
+func hostTimezone() (*HostTimezone, error) {
+	return goRuntimeTimezone(), nil
+}
@@ -0,0 +1,39 @@
+//go:build windows
+
+package winutil
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// Return values of GetTimeZoneInformation.
+const (
+	timeZoneIDStandard = 1
+	timeZoneIDDaylight = 2
+)
+
+// hostTimezone reads the active zone and bias with GetTimeZoneInformation.
+func hostTimezone() (*HostTimezone, error) {
+	var tzi windows.Timezoneinformation
+	rc, err := windows.GetTimeZoneInformation(&tzi)
+	if err != nil {
+		return nil, err
+	}
+
+	bias := int(tzi.Bias)
+	switch rc {
+	case timeZoneIDStandard:
+		bias += int(tzi.StandardBias)
+	case timeZoneIDDaylight:
+		bias += int(tzi.DaylightBias)
+	}
+
+	return &HostTimezone{
+		StandardName:   windows.UTF16ToString(tzi.StandardName[:]),
+		DaylightName:   windows.UTF16ToString(tzi.DaylightName[:]),
+		BiasMinutes:    bias,
+		UTCOffset:      formatUTCOffset(bias),
+		DaylightActive: rc == timeZoneIDDaylight,
+		Source:         "GetTimeZoneInformation",
+	}, nil
+}
@@ -0,0 +1,98 @@
+package winutil
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// StreamWalkBatch is how many directory entries StreamWalk holds per open
+// directory. Memory stays bounded by the batch size times the tree depth,
+// however many entries a single directory has.
+const StreamWalkBatch = 256
+
+// StreamWalk walks the tree rooted at root like filepath.WalkDir, calling fn
+// for root and every file and directory below it, and honours fs.SkipDir and
+// fs.SkipAll the same way. Unlike WalkDir it reads each directory in batches
+// of StreamWalkBatch rather than loading and sorting the whole listing, so
+// entries arrive in directory order. Symlinks and junctions are passed to fn
+// but never followed, and a directory that is the same file as one of its
+// ancestors (a bind mount loop) is not descended into. The run's own output,
+// as recorded by SetRunOutput, is passed over unless root lies inside it.
+//
+// As with WalkDir, when a directory cannot be opened or read fn is called a
+// second time for it with the error.
+func StreamWalk(root string, fn fs.WalkDirFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = streamWalkDir(root, fs.FileInfoToDirEntry(info), nil, !IsRunOutput(root), fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// streamWalkDir visits path and, for a plain directory, everything below it.
+// ancestors holds the directories above path, for loop detection, and
+// skipOutput whether entries that are the run's output are left out.
+func streamWalkDir(path string, d fs.DirEntry, ancestors []os.FileInfo, skipOutput bool, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() || d.Type()&(fs.ModeSymlink|fs.ModeIrregular) != 0 {
+		if err == fs.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		return skipDirError(fn(path, d, err))
+	}
+	defer dir.Close()
+
+	info, err := dir.Stat()
+	if err != nil {
+		return skipDirError(fn(path, d, err))
+	}
+	for _, ancestor := range ancestors {
+		if os.SameFile(info, ancestor) {
+			return nil
+		}
+	}
+	ancestors = append(ancestors, info)
+
+	for {
+		entries, readErr := dir.ReadDir(StreamWalkBatch)
+		for _, entry := range entries {
+			entryPath := filepath.Join(path, entry.Name())
+			if skipOutput && IsRunOutput(entryPath) {
+				continue
+			}
+			if err := streamWalkDir(entryPath, entry, ancestors, skipOutput, fn); err != nil {
+				// SkipDir from a file skips the rest of this directory
+				if err == fs.SkipDir {
+					return nil
+				}
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return skipDirError(fn(path, d, readErr))
+		}
+	}
+}
+
+// skipDirError treats fs.SkipDir returned for a failed directory as leaving
+// that directory, which it already has.
+func skipDirError(err error) error {
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
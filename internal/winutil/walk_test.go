@@ -0,0 +1,143 @@
+package winutil
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// walkPaths returns the paths StreamWalk visits below root, sorted.
+func walkPaths(t *testing.T, root string, fn func(path string, d fs.DirEntry) error) []string {
+	t.Helper()
+	var paths []string
+	err := StreamWalk(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		paths = append(paths, filepath.ToSlash(rel))
+		if fn != nil {
+			return fn(path, d)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// writeFlatDir writes a directory of n empty files.
+func writeFlatDir(t *testing.T, n int) string {
+	t.Helper()
+	dir := t.TempDir()
+	for i := 0; i < n; i++ {
+		writeSizedFile(t, filepath.Join(dir, fmt.Sprintf("evt%05d.log", i)), 0)
+	}
+	return dir
+}
+
+func TestStreamWalkAllocationsStayFlat(t *testing.T) {
+	// Allocations per entry do not grow with the size of the directory, as
+	// they would if the whole listing were read, grown, and sorted at once
+	perEntry := func(n int) float64 {
+		dir := writeFlatDir(t, n)
+		allocs := testing.AllocsPerRun(3, func() {
+			StreamWalk(dir, func(path string, d fs.DirEntry, err error) error {
+				return err
+			})
+		})
+		return allocs / float64(n)
+	}
+	small, large := perEntry(StreamWalkBatch), perEntry(16*StreamWalkBatch)
+	if large > small*1.1 || large < small*0.5 {
+		t.Fatalf("allocations per entry = %.2f for %d entries, %.2f for %d", small, StreamWalkBatch, large, 16*StreamWalkBatch)
+	}
+}
+
+func TestStreamWalkVisitsTheTreeLikeWalkDir(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a/b/c.txt", "a/d.txt", "e/f/g/h.txt", "i.txt"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeSizedFile(t, path, 1)
+	}
+	for i := 0; i < StreamWalkBatch+10; i++ {
+		writeSizedFile(t, filepath.Join(root, "a", fmt.Sprintf("%03d.log", i)), 0)
+	}
+
+	var want []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		rel, _ := filepath.Rel(root, path)
+		want = append(want, filepath.ToSlash(rel))
+		return err
+	})
+	sort.Strings(want)
+	if got := walkPaths(t, root, nil); !reflect.DeepEqual(got, want) {
+		t.Fatalf("StreamWalk visited %d paths, WalkDir %d", len(got), len(want))
+	}
+
+	// SkipDir from a directory leaves it out; from a file, the rest of its
+	// directory
+	got := walkPaths(t, root, func(path string, d fs.DirEntry) error {
+		if d.IsDir() && d.Name() == "a" || d.Name() == "h.txt" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if want := []string{".", "a", "e", "e/f", "e/f/g", "e/f/g/h.txt", "i.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("with SkipDir visited %v, want %v", got, want)
+	}
+
+	// SkipAll stops the walk without an error
+	var visited int
+	if err := StreamWalk(root, func(path string, d fs.DirEntry, err error) error {
+		visited++
+		return fs.SkipAll
+	}); err != nil || visited != 1 {
+		t.Fatalf("SkipAll = %v after %d paths", err, visited)
+	}
+}
+
+func TestStreamWalkDoesNotFollowLinks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "data", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeSizedFile(t, filepath.Join(root, "data", "sub", "x.txt"), 1)
+	// A link back to the root would loop forever if it were followed
+	if err := os.Symlink(root, filepath.Join(root, "data", "loop")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	var linkType fs.FileMode
+	got := walkPaths(t, root, func(path string, d fs.DirEntry) error {
+		if d.Name() == "loop" {
+			linkType = d.Type()
+		}
+		return nil
+	})
+	if want := []string{".", "data", "data/loop", "data/sub", "data/sub/x.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("visited %v, want %v", got, want)
+	}
+	if linkType&fs.ModeSymlink == 0 {
+		t.Errorf("link passed as type %v", linkType)
+	}
+
+	// A missing root is reported to fn
+	var reported error
+	StreamWalk(filepath.Join(root, "missing"), func(path string, d fs.DirEntry, err error) error {
+		reported = err
+		return nil
+	})
+	if !os.IsNotExist(reported) {
+		t.Errorf("missing root reported %v", reported)
+	}
+}